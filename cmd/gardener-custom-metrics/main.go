@@ -8,26 +8,70 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"math"
+	"net"
+	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/component-base/logs"
 	"k8s.io/component-base/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/yaml"
 
+	"github.com/gardener/gardener-custom-metrics/pkg/admin"
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
+	"github.com/gardener/gardener-custom-metrics/pkg/config_file"
+	"github.com/gardener/gardener-custom-metrics/pkg/configz"
+	"github.com/gardener/gardener-custom-metrics/pkg/connection_monitor"
 	"github.com/gardener/gardener-custom-metrics/pkg/ha"
 	"github.com/gardener/gardener-custom-metrics/pkg/input"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/kapi_api"
 	"github.com/gardener/gardener-custom-metrics/pkg/metrics_provider"
+	"github.com/gardener/gardener-custom-metrics/pkg/probe"
+	"github.com/gardener/gardener-custom-metrics/pkg/remote_write"
+	"github.com/gardener/gardener-custom-metrics/pkg/replication"
+	"github.com/gardener/gardener-custom-metrics/pkg/sharding"
+	"github.com/gardener/gardener-custom-metrics/pkg/tracing"
+	"github.com/gardener/gardener-custom-metrics/pkg/util/flagutil"
 	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
 	k8sclient "github.com/gardener/gardener-custom-metrics/pkg/util/k8s/client"
+	"github.com/gardener/gardener-custom-metrics/pkg/util/k8s/permissions"
+	"github.com/gardener/gardener-custom-metrics/pkg/util/logging"
 )
 
+// The name of the command line flag which turns on validate-only mode
+const validateOnlyFlagName = "validate-only"
+
+// How long do we wait for pending traces to be flushed, upon exit
+const tracingShutdownTimeout = 5 * time.Second
+
+// How many consecutive failures to point the service to this process make the HA service degraded
+const haServiceDegradedThreshold = 3
+
+// The name under which the metadata of the served metrics is included in the diagnostic information exposed by the
+// condition registry
+const metricMetadataInfoName = "metricMetadata"
+
 func main() {
 	rootCmd := getRootCommand()
 	if err := rootCmd.Execute(); err != nil {
@@ -44,62 +88,635 @@ func getRootCommand() *cobra.Command {
 			"by directly scraping metrics from individual shoot kube-apiserver pods.",
 	}
 	cmd.AddCommand(getVersionCommand())
+	cmd.AddCommand(getProbeCommand())
+	cmd.AddCommand(getPrintDefaultsCommand())
+	cmd.AddCommand(getAdminCommand())
+
+	options := newCLIOptionSet(cmd.Flags())
+	cmd.RunE = func(_ *cobra.Command, _ []string) error {
+		if options.validateOnly {
+			return validateOptions(options)
+		}
+		runApplication(options)
+		return nil
+	}
+	// Errors are reported by main()
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	return cmd
+}
+
+// cliOptionSet holds the CLI options of all application components, bound to a single flag set
+type cliOptionSet struct {
+	flags                  *pflag.FlagSet
+	input                  *input.CLIOptions
+	remoteWrite            *remote_write.CLIOptions
+	kapiAPI                *kapi_api.CLIOptions
+	metricsProviderService *metrics_provider.MetricsProviderService
+	app                    *app.CLIOptions
+	sharding               *sharding.CLIOptions
+	replication            *replication.CLIOptions
+	tracing                *tracing.CLIOptions
+	configFile             string // Path to the config file. See package config_file.
+	validateOnly           bool   // Only validate the configuration, instead of running the application
+}
+
+// newCLIOptionSet creates the CLI options of all application components, with default values, and binds them to the
+// specified flag set.
+func newCLIOptionSet(flags *pflag.FlagSet) *cliOptionSet {
+	options := newDefaultCLIOptionSet()
+	options.flags = flags
+
+	// Bind CLI option objects to the command line
+	options.input.AddFlags(flags)
+	options.remoteWrite.AddFlags(flags)
+	options.kapiAPI.AddFlags(flags)
+	options.metricsProviderService.AddCLIFlags(flags)
+	options.app.AddFlags(flags)
+	options.sharding.AddFlags(flags)
+	options.replication.AddFlags(flags)
+	options.tracing.AddFlags(flags)
+	flags.StringVar(&options.configFile, config_file.FlagName, options.configFile,
+		"Path to a YAML file containing settings, keyed by command line flag name. Flags specified on the command line "+
+			"take precedence. Changes to log-level, log-level-scraper, log-level-controllers, scrape-period, "+
+			"namespace-include and namespace-exclude take effect without a restart.")
+	flags.BoolVar(&options.validateOnly, validateOnlyFlagName, options.validateOnly,
+		"Validate the configuration (command line and config file) and exit, instead of running the application. "+
+			"Exits with a non-zero status if the configuration is not valid. Does not access the cluster.")
+	flags.AddGoFlagSet(flag.CommandLine) // Make sure we get the klog flags
+
+	return options
+}
 
+// newDefaultCLIOptionSet creates the CLI options of all application components, with default values, without binding
+// them to a flag set.
+func newDefaultCLIOptionSet() *cliOptionSet {
 	// Prepare CLI options for the services implementing the back end
-	inputCLIOptions := input.NewCLIOptions()
-	// The metrics server library requires that the MetricsProviderService instance processes its own CLI options
-	metricsProviderService := metrics_provider.NewMetricsProviderService()
-	appOptions := &app.CLIOptions{
-		ManagerOptions: gutil.ManagerOptions{
-			LeaderElection:          true,
-			LeaderElectionID:        gutil.LeaderElectionNameID(app.Name),
-			LeaderElectionNamespace: os.Getenv("LEADER_ELECTION_NAMESPACE"),
+	return &cliOptionSet{
+		input:       input.NewCLIOptions(),
+		remoteWrite: remote_write.NewCLIOptions(),
+		kapiAPI:     kapi_api.NewCLIOptions(),
+		// The metrics server library requires that the MetricsProviderService instance processes its own CLI options
+		metricsProviderService: metrics_provider.NewMetricsProviderService(),
+		app: &app.CLIOptions{
+			ManagerOptions: gutil.ManagerOptions{
+				LeaderElection:          true,
+				LeaderElectionID:        gutil.LeaderElectionNameID(app.Name),
+				LeaderElectionNamespace: os.Getenv("LEADER_ELECTION_NAMESPACE"),
+			},
+			RestOptions:    gutil.NewRESTOptions(),
+			LogLevel:       app.VerbosityVerbose - 1, // Log everything up to, but excluding verbose
+			HAMode:         app.HAModeActivePassive,
+			HAEndpointMode: app.HAEndpointModeEndpoints,
+
+			ShutdownDrainPeriod: 10 * time.Second,
+
+			HARetryPeriod:    ha.DefaultRetryPeriod,
+			HAMaxRetryPeriod: ha.DefaultMaxRetryPeriod,
+			HARetryJitter:    0.2,
+
+			KapiPodSelector:      gutil.DefaultKapiPodSelector,
+			ShootNamespacePrefix: gutil.DefaultShootNamespacePrefix,
+
+			LogLevelScraper:     -1, // Same as LogLevel
+			LogLevelControllers: -1, // Same as LogLevel
+
+			PermissionCheck: true,
+
+			DirectClientTimeout: 5 * time.Second,
+
+			InformerStallTimeout: 15 * time.Minute,
 		},
-		RestOptions: gutil.NewRESTOptions(),
-		LogLevel:    app.VerbosityVerbose - 1, // Log everything up to, but excluding verbose
+		sharding:    sharding.NewCLIOptions(),
+		replication: replication.NewCLIOptions(),
+		tracing:     tracing.NewCLIOptions(),
 	}
+}
 
-	// Bind CLI option objects to the command line
-	inputCLIOptions.AddFlags(cmd.Flags())
-	metricsProviderService.AddCLIFlags(cmd.Flags())
-	appOptions.AddFlags(cmd.Flags())
-	cmd.Flags().AddGoFlagSet(flag.CommandLine) // Make sure we get the klog flags
+// defaults returns the default values of the settings of all application components, keyed by command line flag name.
+// Must be called on an option set which is not bound to the command line. Binds the components which do not provide
+// their own defaults to a throwaway flag set, so the option set is not usable afterwards.
+func (options *cliOptionSet) defaults() (map[string]interface{}, error) {
+	flags := pflag.NewFlagSet(app.Name, pflag.ContinueOnError)
+	options.remoteWrite.AddFlags(flags)
+	options.kapiAPI.AddFlags(flags)
+	options.metricsProviderService.AddCLIFlags(flags)
+	options.sharding.AddFlags(flags)
+	options.replication.AddFlags(flags)
+	options.tracing.AddFlags(flags)
 
-	cmd.Run = func(_ *cobra.Command, _ []string) {
-		runApplication(inputCLIOptions, metricsProviderService, appOptions)
+	sources := []func() (map[string]interface{}, error){
+		options.app.Defaults,
+		options.input.Defaults,
+		func() (map[string]interface{}, error) { return flagutil.Defaults(flags) },
 	}
+	result := map[string]interface{}{}
+	for _, source := range sources {
+		defaults, err := source()
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range defaults {
+			result[name] = value
+		}
+	}
+	return result, nil
+}
 
-	return cmd
+// validateOptions checks the configuration of all application components for invalid values and inconsistent
+// combinations, without running the application, and without accessing the environment.
+func validateOptions(options *cliOptionSet) error {
+	if err := applyConfigFile(options); err != nil {
+		return err
+	}
+	if err := options.app.Validate(); err != nil {
+		return fmt.Errorf("invalid application level CLI options: %w", err)
+	}
+	if err := options.input.Complete(); err != nil {
+		return fmt.Errorf("invalid input data service CLI options: %w", err)
+	}
+	if err := options.metricsProviderService.ValidateCLIConfiguration(options.input.Completed().ScrapePeriod); err != nil {
+		return fmt.Errorf("invalid metrics provider service CLI options: %w", err)
+	}
+	if err := options.remoteWrite.Complete(); err != nil {
+		return fmt.Errorf("invalid remote-write CLI options: %w", err)
+	}
+	if err := options.kapiAPI.Complete(); err != nil {
+		return fmt.Errorf("invalid Kapi gRPC API CLI options: %w", err)
+	}
+	if err := options.tracing.Complete(); err != nil {
+		return fmt.Errorf("invalid tracing CLI options: %w", err)
+	}
+	if options.app.HAMode == app.HAModeSharded {
+		if err := options.sharding.Complete(); err != nil {
+			return fmt.Errorf("invalid sharding CLI options: %w", err)
+		}
+	}
+	if err := validateReplicationOptions(options.replication, options.app.HAMode); err != nil {
+		return fmt.Errorf("invalid replication CLI options: %w", err)
+	}
+
+	fmt.Println("Configuration is valid")
+	return nil
+}
+
+// applyConfigFile applies the settings from the config file, if one is specified, to the option set's flags.
+// Must be called after the command line is parsed, and before the options are completed.
+func applyConfigFile(options *cliOptionSet) error {
+	if options.configFile == "" {
+		return nil
+	}
+
+	settings, err := config_file.Read(options.configFile)
+	if err != nil {
+		return err
+	}
+	return settings.Apply(options.flags)
+}
+
+// reloadSettings applies the settings which are safe to change at runtime - log levels, scrape period, and namespace
+// filters - based on the specified config file settings. Changes to other settings take effect upon restart.
+// The reloaded input configuration is recorded in configRegistry.
+func reloadSettings(
+	settings config_file.Settings,
+	logLevels *logging.Levels,
+	inputServices []input.InputDataService,
+	configRegistry *configz.Registry,
+	log logr.Logger) {
+
+	// Derive the configuration the same way as on startup, so command line flags keep taking precedence over the file
+	options := newCLIOptionSet(pflag.NewFlagSet(app.Name, pflag.ContinueOnError))
+	if err := options.flags.Parse(os.Args[1:]); err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to reload settings: parsing command line")
+		return
+	}
+	if err := settings.Apply(options.flags); err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to reload settings")
+		return
+	}
+	if err := options.input.Complete(); err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to reload settings: completing input data service options")
+		return
+	}
+	err := options.metricsProviderService.ValidateCLIConfiguration(options.input.Completed().ScrapePeriod)
+	if err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to reload settings")
+		return
+	}
+
+	componentLogLevels := options.app.ComponentLogLevels()
+	logLevels.Set(options.app.LogLevel, componentLogLevels)
+	for _, inputService := range inputServices {
+		inputService.ApplyReloadableConfig(options.input.Completed())
+	}
+	configRegistry.Set("input", options.input.Completed())
+	log.V(app.VerbosityInfo).Info(
+		"Settings reloaded", "logLevel", options.app.LogLevel, "componentLogLevels", componentLogLevels)
 }
 
 // completeAppCLIOptions completes initialisation based on application-level CLI options.
-// Upon error, any of the returned Logger, Manager, and HAService may be nil.
+// Upon error, any of the returned Logger, Manager, HAService, and condition Registry may be nil. The returned HAService
+// is also nil, if HA is turned off, or in sharded mode without shared endpoints. With shared endpoints, the HAService
+// is in shared mode, and lists this process in the service endpoints while the conditions report it ready.
+//
+// The logLevels parameter is set to the configured log levels, and can later be used to change them at runtime.
+//
+// If the provider metrics endpoint is enabled, the metrics in providerMetricsRegistry are exposed at
+// [metrics_provider.ProviderMetricsPath], on the manager's metrics server. The conditions in the returned condition
+// Registry are always exposed at [conditions.DebugPath], on the same server, the configuration recorded in
+// configRegistry - at [configz.Path], and the metric metadata served by metricMetadataHandler - at
+// [metrics_provider.MetadataPath]. If registrySnapshotHandler is not nil, it is exposed at [replication.SnapshotPath].
+// The completed application-level configuration is recorded in configRegistry.
+//
+// The manager's cache holds only the seed secrets named by secretNames, among all secrets, and only the Kapi pods and
+// the pods selected by otherPods, among all pods. otherPods may be nil.
 func completeAppCLIOptions(
-	ctx context.Context, appOptions *app.CLIOptions) (*logr.Logger, manager.Manager, *ha.HAService, error) {
+	ctx context.Context,
+	appOptions *app.CLIOptions,
+	secretNames []string,
+	otherPods labels.Selector,
+	logLevels *logging.Levels,
+	providerMetricsRegistry *prometheus.Registry,
+	configRegistry *configz.Registry,
+	metricMetadataHandler http.Handler,
+	registrySnapshotHandler http.Handler,
+) (*logr.Logger, manager.Manager, *ha.HAService, *conditions.Registry, error) {
 
 	if err := appOptions.Complete(); err != nil {
-		return nil, nil, nil, fmt.Errorf("completing application level CLI options: %w", err)
+		return nil, nil, nil, nil, fmt.Errorf("completing application level CLI options: %w", err)
 	}
+	configRegistry.Set("app", appOptions.Completed())
 
 	// Create log
-	log := initLogs(ctx, appOptions.Completed().LogLevel)
+	logLevels.Set(appOptions.Completed().LogLevel, appOptions.Completed().ComponentLogLevels)
+	log := initLogs(ctx, logLevels)
 	log.V(app.VerbosityInfo).Info("Initializing", "version", version.Get().GitVersion)
+	conditionRegistry := conditions.NewRegistry(log)
 
 	// Create manager
 	log.V(app.VerbosityInfo).Info("Creating client set")
-	if _, err := k8sclient.GetClientSet(appOptions.RestOptions.Kubeconfig); err != nil {
-		return &log, nil, nil, fmt.Errorf("create client set: %w", err)
+	clientSet, err := k8sclient.GetClientSet(appOptions.RestOptions.Kubeconfig)
+	if err != nil {
+		return &log, nil, nil, nil, fmt.Errorf("create client set: %w", err)
+	}
+	if appOptions.Completed().PermissionCheck {
+		log.V(app.VerbosityVerbose).Info("Checking K8s API permissions")
+		err := permissions.Check(ctx, clientSet.AuthorizationV1(), requiredPermissions(appOptions.Completed()))
+		if err != nil {
+			return &log, nil, nil, nil, fmt.Errorf("checking K8s API permissions: %w", err)
+		}
 	}
 	log.V(app.VerbosityVerbose).Info("Creating controller manager")
-	mgr, err := manager.New(appOptions.RestOptions.Completed().Config, appOptions.Completed().ManagerOptions())
+	managerOptions := appOptions.Completed().ManagerOptions(secretNames, otherPods)
+	managerOptions.Metrics.ExtraHandlers = map[string]http.Handler{
+		conditions.DebugPath: conditionRegistry,
+		configz.Path:         configRegistry,
+
+		metrics_provider.MetadataPath: metricMetadataHandler,
+	}
+	if registrySnapshotHandler != nil {
+		managerOptions.Metrics.ExtraHandlers[replication.SnapshotPath] = registrySnapshotHandler
+	}
+	if appOptions.Completed().DryRun {
+		log.V(app.VerbosityInfo).Info("Dry run. No changes will be made to the seed cluster")
+		managerOptions.NewClient = func(config *rest.Config, options client.Options) (client.Client, error) {
+			c, err := client.New(config, options)
+			if err != nil {
+				return nil, err
+			}
+			return k8sclient.NewDryRunClient(c, log), nil
+		}
+		// A broadcaster which is not connected to the seed. Events are logged instead.
+		eventBroadcaster := record.NewBroadcaster()
+		eventBroadcaster.StartStructuredLogging(app.VerbosityVerbose)
+		managerOptions.EventBroadcaster = eventBroadcaster //nolint:staticcheck
+	}
+	if appOptions.Completed().ProviderMetricsEndpoint {
+		managerOptions.Metrics.ExtraHandlers[metrics_provider.ProviderMetricsPath] =
+			promhttp.HandlerFor(providerMetricsRegistry, promhttp.HandlerOpts{})
+	}
+	mgr, err := manager.New(appOptions.RestOptions.Completed().Config, managerOptions)
 	if err != nil {
-		return &log, nil, nil, fmt.Errorf("creating controller manager: %w", err)
+		return &log, nil, nil, nil, fmt.Errorf("creating controller manager: %w", err)
+	}
+	if err := mgr.AddReadyzCheck("conditions", conditionRegistry.ReadyzCheck); err != nil {
+		return &log, nil, nil, nil, fmt.Errorf("adding conditions readiness check to controller manager: %w", err)
+	}
+
+	if appOptions.Completed().HAMode == app.HAModeOff {
+		log.V(app.VerbosityInfo).Info("HA mode is off. Not managing service endpoints")
+		return &log, mgr, nil, conditionRegistry, nil
+	}
+	if appOptions.Completed().HAMode == app.HAModeSharded && !appOptions.Completed().HASharedEndpoints {
+		log.V(app.VerbosityInfo).Info("HA mode is sharded. Not managing service endpoints")
+		return &log, mgr, nil, conditionRegistry, nil
 	}
 
 	// Create HA service
-	haService := ha.NewHAService(mgr.GetAPIReader(), mgr.GetClient(), appOptions.Namespace, appOptions.AccessIPAddress, appOptions.AccessPort, log)
+	directClient, err := newDirectClient(appOptions.Completed(), mgr, log)
+	if err != nil {
+		return &log, nil, nil, nil, err
+	}
+	haService := ha.NewHAService(
+		directClient,
+		directClient,
+		appOptions.Namespace,
+		appOptions.AccessIPAddress,
+		appOptions.AccessPort,
+		appOptions.Completed().HAEndpointMode,
+		log)
+	// Failing to point the service to this process does not make the process itself any less able to serve
+	haService.SetConditionReporter(
+		conditionRegistry.NewReporter(ha.ConditionType, haServiceDegradedThreshold, false))
+	haService.SetRetryOptions(ha.RetryOptions{
+		InitialPeriod: appOptions.Completed().HARetryPeriod,
+		MaxPeriod:     appOptions.Completed().HAMaxRetryPeriod,
+		Jitter:        appOptions.Completed().HARetryJitter,
+	})
+	if appOptions.Completed().HAMode == app.HAModeSharded {
+		haService.SetSharedMode(ha.SharedModeOptions{
+			IsHealthy: func() bool { return conditionRegistry.ReadyzCheck(nil) == nil },
+		})
+	}
+	if err := ctrlmetrics.Registry.Register(haService); err != nil {
+		return &log, nil, nil, nil, fmt.Errorf("registering HA service metrics: %w", err)
+	}
+
+	return &log, mgr, haService, conditionRegistry, nil
+}
+
+// newDirectClient creates an uncached seed client, which is throttled, and times out, independently of the manager's
+// cached client, so a slow seed kube-apiserver, or heavy informer traffic, does not stall the coordination between
+// replicas. In dry-run mode, the client does not write.
+func newDirectClient(appConfig *app.CLIConfig, mgr manager.Manager, log logr.Logger) (client.Client, error) {
+	directClient, err := client.New(
+		appConfig.DirectRESTConfig, client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		return nil, fmt.Errorf("creating direct seed client: %w", err)
+	}
+	if appConfig.DryRun {
+		return k8sclient.NewDryRunClient(directClient, log), nil
+	}
+	return directClient, nil
+}
+
+// newConnectionMonitor creates a monitor which restarts the application, if the connection between the manager's
+// informers and the seed kube-apiserver stalls. It watches the informers of the objects which the input data service
+// controllers watch, and pings the seed via a direct client, which does not share the informers' connections.
+func newConnectionMonitor(
+	appConfig *app.CLIConfig, mgr manager.Manager, log logr.Logger) (*connection_monitor.ConnectionMonitor, error) {
+
+	directClient, err := newDirectClient(appConfig, mgr, log)
+	if err != nil {
+		return nil, err
+	}
+	ping := func(ctx context.Context) error {
+		return directClient.List(ctx, &corev1.NamespaceList{}, client.Limit(1))
+	}
+
+	return connection_monitor.NewConnectionMonitor(
+		mgr.GetCache(),
+		[]client.Object{&corev1.Pod{}, &corev1.Secret{}, &corev1.Namespace{}},
+		ping,
+		appConfig.InformerStallTimeout,
+		log), nil
+}
+
+// requiredPermissions returns the K8s API permissions which the application requires, given the specified
+// application-level configuration. The list mirrors the RBAC rules in example/rbac.yaml.
+func requiredPermissions(appConfig *app.CLIConfig) []permissions.Permission {
+	const leaseGroup = "coordination.k8s.io"
+
+	var result []permissions.Permission
+	for _, resource := range []string{"namespaces", "pods", "secrets"} {
+		for _, verb := range []string{"get", "list", "watch"} {
+			result = append(result, permissions.Permission{Verb: verb, Resource: resource})
+		}
+	}
+	result = append(result,
+		permissions.Permission{Verb: "create", Resource: "events"},
+		permissions.Permission{Verb: "patch", Resource: "events"})
+
+	switch appConfig.HAMode {
+	case app.HAModeActivePassive:
+		if appConfig.LeaderElection {
+			// Like the controller manager, default to the application's namespace
+			namespace := appConfig.LeaderElectionNamespace
+			if namespace == "" {
+				namespace = appConfig.Namespace
+			}
+			result = append(result,
+				permissions.Permission{Verb: "create", Group: leaseGroup, Resource: "leases", Namespace: namespace})
+			for _, verb := range []string{"get", "update"} {
+				result = append(result, permissions.Permission{
+					Verb:      verb,
+					Group:     leaseGroup,
+					Resource:  "leases",
+					Namespace: namespace,
+					Name:      appConfig.LeaderElectionID,
+				})
+			}
+		}
+		result = append(result, endpointPermissions(appConfig)...)
+	case app.HAModeSharded:
+		for _, verb := range []string{"create", "list", "update", "delete"} {
+			result = append(result, permissions.Permission{
+				Verb: verb, Group: leaseGroup, Resource: "leases", Namespace: appConfig.Namespace})
+		}
+		if appConfig.HASharedEndpoints {
+			// In shared mode, the Endpoints object is created by whichever replica comes first
+			if appConfig.HAEndpointMode != app.HAEndpointModeEndpointSlice {
+				result = append(result, permissions.Permission{
+					Verb: "create", Resource: "endpoints", Namespace: appConfig.Namespace})
+			}
+			result = append(result, endpointPermissions(appConfig)...)
+		}
+	}
 
-	return &log, mgr, haService, nil
+	if appConfig.DryRun {
+		// Write requests are not made
+		result = slices.DeleteFunc(result, func(permission permissions.Permission) bool {
+			return permission.Verb != "get" && permission.Verb != "list" && permission.Verb != "watch"
+		})
+	}
+	return result
+}
+
+// endpointPermissions returns the K8s API permissions which the HAService requires, to maintain the service endpoint
+// objects specified by the endpoint mode in the specified application-level configuration
+func endpointPermissions(appConfig *app.CLIConfig) []permissions.Permission {
+	const endpointSliceGroup = "discovery.k8s.io"
+
+	var result []permissions.Permission
+	if appConfig.HAEndpointMode != app.HAEndpointModeEndpointSlice {
+		for _, verb := range []string{"get", "update"} {
+			result = append(result, permissions.Permission{
+				Verb: verb, Resource: "endpoints", Namespace: appConfig.Namespace, Name: app.Name})
+		}
+	}
+	if appConfig.HAEndpointMode != app.HAEndpointModeEndpoints {
+		result = append(result, permissions.Permission{
+			Verb: "create", Group: endpointSliceGroup, Resource: "endpointslices", Namespace: appConfig.Namespace})
+		for _, verb := range []string{"get", "update", "delete"} {
+			result = append(result, permissions.Permission{
+				Verb:      verb,
+				Group:     endpointSliceGroup,
+				Resource:  "endpointslices",
+				Namespace: appConfig.Namespace,
+				Name:      app.Name,
+			})
+		}
+	}
+	return result
+}
+
+// completeTracingCLIOptions completes initialisation based on CLI options related to trace export. It returns a
+// function which flushes pending traces, and must be called upon application exit.
+func completeTracingCLIOptions(ctx context.Context, options *tracing.CLIOptions, log logr.Logger) (func(), error) {
+	if err := options.Complete(); err != nil {
+		return nil, fmt.Errorf("completing tracing CLI options: %w", err)
+	}
+
+	shutdown, err := tracing.Setup(ctx, options.Completed())
+	if err != nil {
+		return nil, err
+	}
+	if options.Completed().IsEnabled() {
+		log.V(app.VerbosityInfo).Info("Exporting traces", "endpoint", options.Completed().Endpoint)
+	}
+
+	return func() {
+		// The application context is already cancelled at this point. Allow the flush a brief period of its own.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdown(shutdownCtx); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to flush traces")
+		}
+	}, nil
+}
+
+// completeShardingCLIOptions completes initialisation based on CLI options related to sharding metric scraping across
+// replicas. It returns nil values, if the HA mode is not sharded.
+func completeShardingCLIOptions(
+	options *sharding.CLIOptions,
+	appOptions *app.CLIOptions,
+	mgr manager.Manager,
+	log logr.Logger) (*sharding.Membership, *sharding.PeerForwarder, error) {
+
+	if appOptions.Completed().HAMode != app.HAModeSharded {
+		return nil, nil, nil
+	}
+	if err := options.Complete(); err != nil {
+		return nil, nil, fmt.Errorf("completing sharding CLI options: %w", err)
+	}
+
+	directClient, err := newDirectClient(appOptions.Completed(), mgr, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	membership := sharding.NewMembership(
+		directClient,
+		directClient,
+		appOptions.Namespace,
+		net.JoinHostPort(appOptions.AccessIPAddress, strconv.Itoa(appOptions.AccessPort)),
+		options.Completed(),
+		log)
+	forwarder, err := sharding.NewPeerForwarder(membership, options.Completed(), appOptions.Namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return membership, forwarder, nil
+}
+
+// memberIPAddresses returns the IP addresses of the live shard members
+func memberIPAddresses(membership *sharding.Membership) []string {
+	members := membership.Members()
+	result := make([]string, 0, len(members))
+	for _, member := range members {
+		if host, _, err := net.SplitHostPort(member.Address); err == nil {
+			result = append(result, host)
+		}
+	}
+	return result
+}
+
+// validateReplicationOptions completes the CLI options related to replicating the leader's registry to standby
+// replicas, and checks that replication, if enabled, is used with the specified HA mode
+func validateReplicationOptions(options *replication.CLIOptions, haMode string) error {
+	if err := options.Complete(); err != nil {
+		return err
+	}
+	if options.Completed().Enabled && haMode != app.HAModeActivePassive {
+		return fmt.Errorf("replication requires the '%s' HA mode", app.HAModeActivePassive)
+	}
+	return nil
+}
+
+// completeReplicationCLIOptions completes initialisation based on CLI options related to replicating the leader's
+// registry to standby replicas. It returns nil, if replication is disabled. Otherwise, it directs snapshotHandler to
+// serve the Kapi records of the input service's registry, and returns a Replicator which copies the leader's records to
+// the same registry, while this process is a standby replica. Upon election, the input service's controllers and
+// scraper wait until the Replicator stops. Must be called before the input service's AddToManager.
+func completeReplicationCLIOptions(
+	options *replication.CLIOptions,
+	appOptions *app.CLIOptions,
+	haService *ha.HAService,
+	inputService input.InputDataService,
+	snapshotHandler *replication.SnapshotHandler,
+	mgr manager.Manager,
+	log logr.Logger) (*replication.Replicator, error) {
+
+	if err := validateReplicationOptions(options, appOptions.Completed().HAMode); err != nil {
+		return nil, fmt.Errorf("completing replication CLI options: %w", err)
+	}
+	if !options.Completed().Enabled || haService == nil {
+		return nil, nil
+	}
+
+	snapshotHandler.SetRegistry(inputService.DataRegistry(), options.Completed().BearerToken)
+	replicator := replication.NewReplicator(
+		inputService.DataRegistry(),
+		haService.LeaderAddress,
+		appOptions.AccessIPAddress,
+		mgr.Elected(),
+		options.Completed(),
+		log)
+	inputService.SetStartGate(replicator.WaitForStop)
+	return replicator, nil
+}
+
+// addWarmupGates holds off the readiness of the process, and the registration of the process in the service endpoints,
+// until the warmup gates of all input services open. Input services without a warmup gate are ignored. haService may be
+// nil.
+func addWarmupGates(inputServices []input.InputDataService, mgr manager.Manager, haService *ha.HAService) error {
+	var gates []*input.WarmupGate
+	for _, service := range inputServices {
+		if gate := service.WarmupGate(); gate != nil {
+			checkName := "warmup"
+			if len(gates) > 0 {
+				checkName = fmt.Sprintf("warmup-%d", len(gates))
+			}
+			if err := mgr.AddReadyzCheck(checkName, gate.ReadyzCheck); err != nil {
+				return fmt.Errorf("adding warmup readiness check to controller manager: %w", err)
+			}
+			gates = append(gates, gate)
+		}
+	}
+	if len(gates) == 0 || haService == nil {
+		return nil
+	}
+
+	haService.SetPublishGate(func() bool {
+		for _, gate := range gates {
+			if !gate.IsOpen() {
+				return false
+			}
+		}
+		return true
+	})
+	return nil
 }
 
 // completeInputServiceCLIOptions completes initialisation based on CLI options related to input data processing.
@@ -112,17 +729,79 @@ func completeInputServiceCLIOptions(options *input.CLIOptions, log logr.Logger)
 	return inputService, nil
 }
 
+// completeClusterInputServices creates an input data service for each of the additional clusters specified in the
+// application-level CLI options, and adds it to a dedicated controller manager. The cluster managers run as part of
+// primaryManager, so they are subject to its leader election. They do not serve metrics or health probes of their own.
+// The input services do not report conditions - conditions reflect the health of the primary cluster's components.
+//
+// The cluster managers' caches hold only the secrets named by secretNames, among all secrets, and only the Kapi pods
+// and the pods selected by otherPods, among all pods. The input services' own metrics carry a "cluster" label with the
+// cluster's name. See clusterMetricsRegisterer.
+//
+// Returns the input services, keyed by cluster name.
+func completeClusterInputServices(
+	appConfig *app.CLIConfig,
+	inputConfig *input.CLIConfig,
+	secretNames []string,
+	otherPods labels.Selector,
+	primaryManager manager.Manager,
+	isNamespaceOwned func(namespace string) bool,
+	log logr.Logger) (map[string]input.InputDataService, error) {
+
+	result := make(map[string]input.InputDataService, len(appConfig.RESTConfig.AdditionalClusters))
+	for _, cluster := range appConfig.RESTConfig.AdditionalClusters {
+		clusterLog := log.WithValues("cluster", cluster.Name)
+		clusterLog.V(app.VerbosityInfo).Info("Creating controller manager for additional cluster")
+		managerOptions := appConfig.ManagerOptions(secretNames, otherPods)
+		managerOptions.LeaderElection = false
+		managerOptions.Metrics.BindAddress = "0"
+		managerOptions.HealthProbeBindAddress = "0"
+		managerOptions.Logger = clusterLog
+		clusterManager, err := manager.New(cluster.Config, managerOptions)
+		if err != nil {
+			return nil, fmt.Errorf("creating controller manager for cluster '%s': %w", cluster.Name, err)
+		}
+
+		inputService := input.NewInputDataServiceFactory().NewInputDataService(inputConfig, clusterLog)
+		inputService.SetKapiSelector(appConfig.KapiSelector)
+		inputService.SetMetricsRegisterer(clusterMetricsRegisterer(cluster.Name))
+		if isNamespaceOwned != nil {
+			inputService.SetShardPredicate(isNamespaceOwned)
+		}
+		if err := inputService.AddToManager(clusterManager); err != nil {
+			return nil, fmt.Errorf("adding input data service to manager of cluster '%s': %w", cluster.Name, err)
+		}
+		if err := primaryManager.Add(clusterManager); err != nil {
+			return nil, fmt.Errorf("adding manager of cluster '%s' to controller manager: %w", cluster.Name, err)
+		}
+		result[cluster.Name] = inputService
+	}
+
+	return result, nil
+}
+
+// clusterMetricsRegisterer returns a registerer which adds a "cluster" label with the specified value to all metrics
+// registered through it. Each input data service registers the same metrics, so with additional clusters, the services
+// need distinct labels to share the controller-runtime registry. The primary cluster's name is empty.
+func clusterMetricsRegisterer(cluster string) prometheus.Registerer {
+	return prometheus.WrapRegistererWith(prometheus.Labels{"cluster": cluster}, ctrlmetrics.Registry)
+}
+
 // completeMetircsProviderServiceCLIOptions completes initialisation based on CLI options related to metrics serving.
 // It returns a [manager.Runnable] which can be executed under the supervision of a controller manager.
 //
 // The onFailedFunc parameter is a function which will be called by the [manager.Runnable] if it fails.
 func completeMetircsProviderServiceCLIOptions(
 	metricsService *metrics_provider.MetricsProviderService,
-	inputService input.InputDataService,
+	dataSource input_data_registry.InputDataSource,
+	scrapePeriod time.Duration,
 	log logr.Logger,
 	onFailedFunc context.CancelFunc) (manager.RunnableFunc, error) {
 
-	if err := metricsService.CompleteCLIConfiguration(inputService.DataSource(), log); err != nil {
+	if err := metricsService.ValidateCLIConfiguration(scrapePeriod); err != nil {
+		return nil, fmt.Errorf("validating metrics adapter command line arguments: %w", err)
+	}
+	if err := metricsService.CompleteCLIConfiguration(dataSource, log); err != nil {
 		return nil, fmt.Errorf("configure metrics adapter based on command line arguments: %w", err)
 	}
 
@@ -139,18 +818,74 @@ func completeMetircsProviderServiceCLIOptions(
 	return metricsProviderRunnable, nil
 }
 
+// completeRemoteWriteCLIOptions completes initialisation based on CLI options related to remote-write export of metrics.
+// It returns nil, if remote-write export is disabled.
+func completeRemoteWriteCLIOptions(
+	options *remote_write.CLIOptions,
+	metricsService *metrics_provider.MetricsProviderService,
+	dataSource input_data_registry.InputDataSource,
+	log logr.Logger) (*remote_write.Exporter, error) {
+
+	if err := options.Complete(); err != nil {
+		return nil, fmt.Errorf("completing remote-write CLI options: %w", err)
+	}
+	if !options.Completed().IsEnabled() {
+		return nil, nil
+	}
+
+	return remote_write.NewExporter(metricsService.Provider(), dataSource, options.Completed(), log)
+}
+
+// completeKapiAPICLIOptions completes initialisation based on CLI options related to the gRPC API which serves the Kapi
+// metrics records. It returns nil, if the API is disabled.
+func completeKapiAPICLIOptions(
+	options *kapi_api.CLIOptions,
+	dataSource input_data_registry.InputDataSource,
+	log logr.Logger) (*kapi_api.Server, error) {
+
+	if err := options.Complete(); err != nil {
+		return nil, fmt.Errorf("completing Kapi gRPC API CLI options: %w", err)
+	}
+	if !options.Completed().IsEnabled() {
+		return nil, nil
+	}
+
+	return kapi_api.NewServer(dataSource, options.Completed(), log)
+}
+
 // runApplication implements the activity of the application's main command. As input, it takes various CLI options
 // which have been bound to CLI parameters, but not yet completed.
-func runApplication(
-	inputCLIOptions *input.CLIOptions,
-	metricsProviderService *metrics_provider.MetricsProviderService,
-	appOptions *app.CLIOptions) {
-
-	ctx := genericapiserver.SetupSignalContext() // Context closed on SIGTERM and SIGINT
-	ctx, cancel := context.WithCancel(ctx)
+func runApplication(options *cliOptionSet) {
+	signalCtx := genericapiserver.SetupSignalContext() // Context closed on SIGTERM and SIGINT
+	// The application context. Upon termination signal, it is closed by the shutdown drainer, once draining is complete.
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	plog, manager, haService, err := completeAppCLIOptions(ctx, appOptions)
+	if err := applyConfigFile(options); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	logLevels := logging.NewLevels(options.app.LogLevel)
+	providerMetricsRegistry := prometheus.NewRegistry()
+	configRegistry := configz.NewRegistry()
+	var registrySnapshotHandler *replication.SnapshotHandler
+	var registrySnapshotHTTPHandler http.Handler // Stays a nil interface, if replication is disabled
+	if options.replication.Enabled {
+		registrySnapshotHandler = replication.NewSnapshotHandler()
+		registrySnapshotHTTPHandler = registrySnapshotHandler
+	}
+	plog, manager, haService, conditionRegistry, err :=
+		completeAppCLIOptions(
+			ctx,
+			options.app,
+			options.input.SecretNames(),
+			options.input.CachedPodLabels(),
+			logLevels,
+			providerMetricsRegistry,
+			configRegistry,
+			options.metricsProviderService.MetadataHandler(),
+			registrySnapshotHTTPHandler)
 	if err != nil {
 		if plog != nil {
 			plog.V(app.VerbosityError).Error(err, "Failed to complete app-level CLI options")
@@ -162,36 +897,230 @@ func runApplication(
 	defer logs.FlushLogs()
 
 	log := *plog
-	inputService, err := completeInputServiceCLIOptions(inputCLIOptions, log)
+	shutdownTracing, err := completeTracingCLIOptions(ctx, options.tracing, log)
+	if err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to complete tracing CLI options")
+		return
+	}
+	defer shutdownTracing()
+	configRegistry.Set("tracing", options.tracing.Completed())
+
+	membership, shardForwarder, err := completeShardingCLIOptions(options.sharding, options.app, manager, log)
+	if err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to complete sharding CLI options")
+		return
+	}
+	if membership != nil {
+		configRegistry.Set("sharding", options.sharding.Completed())
+		if haService != nil {
+			haService.SetLiveAddresses(func() []string { return memberIPAddresses(membership) })
+		}
+	}
+
+	inputService, err := completeInputServiceCLIOptions(options.input, log)
 	if err != nil {
 		log.V(app.VerbosityError).Error(err, "Failed to complete input service CLI options")
 		return
 	}
+	configRegistry.Set("input", options.input.Completed())
+	inputService.SetKapiSelector(options.app.Completed().KapiSelector)
+	var isNamespaceOwned func(namespace string) bool
+	if membership != nil {
+		isNamespaceOwned = membership.IsLocal
+		inputService.SetShardPredicate(isNamespaceOwned)
+	}
+	inputService.SetConditionRegistry(conditionRegistry)
+	if len(options.app.Completed().RESTConfig.AdditionalClusters) > 0 {
+		inputService.SetMetricsRegisterer(clusterMetricsRegisterer(""))
+	}
+	if bindAddress := options.app.Completed().AdminBindAddress; bindAddress != "" {
+		adminHandler := admin.NewHandler()
+		adminHandler.SetBackend(inputService)
+		if err := manager.Add(admin.NewServer(bindAddress, adminHandler, log)); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to add admin server to controller manager")
+			return
+		}
+	}
+	inputServices := []input.InputDataService{inputService}
+	replicator, err := completeReplicationCLIOptions(
+		options.replication, options.app, haService, inputService, registrySnapshotHandler, manager, log)
+	if err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to complete replication CLI options")
+		return
+	}
+	configRegistry.Set("replication", options.replication.Completed())
+
+	// With additional clusters, consumers see the data of all clusters, keyed by cluster name. The primary cluster's
+	// name is empty.
+	dataSource := inputService.DataSource()
+	if len(options.app.Completed().RESTConfig.AdditionalClusters) > 0 {
+		clusterInputServices, err := completeClusterInputServices(
+			options.app.Completed(),
+			options.input.Completed(),
+			options.input.SecretNames(),
+			options.input.CachedPodLabels(),
+			manager,
+			isNamespaceOwned,
+			log)
+		if err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to set up additional clusters")
+			return
+		}
+		dataSources := map[string]input_data_registry.InputDataSource{"": dataSource}
+		for cluster, clusterInputService := range clusterInputServices {
+			dataSources[cluster] = clusterInputService.DataSource()
+			inputServices = append(inputServices, clusterInputService)
+		}
+		dataSource = input_data_registry.NewCompositeDataSource(dataSources)
+	}
+	if err := addWarmupGates(inputServices, manager, haService); err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to set up the warmup gates")
+		return
+	}
 
 	metricsProviderRunnable, err :=
-		completeMetircsProviderServiceCLIOptions(metricsProviderService, inputService, log, cancel)
+		completeMetircsProviderServiceCLIOptions(
+			options.metricsProviderService, dataSource, options.input.Completed().ScrapePeriod, log, cancel)
 	if err != nil {
 		log.V(app.VerbosityError).Error(err, "Failed to complete metrics provider service CLI options")
 		return
 	}
+	configRegistry.Set("metricsProvider", options.metricsProviderService.Config())
+	conditionRegistry.AddInfo(metricMetadataInfoName, func() any {
+		return options.metricsProviderService.Provider().MetricMetadata()
+	})
+	if shardForwarder != nil {
+		options.metricsProviderService.Provider().SetShardForwarder(shardForwarder)
+	}
+	if options.app.Completed().HAMode == app.HAModeActivePassive && options.app.Completed().LeaderElection {
+		// Only the leader scrapes, so other replicas have no data to serve
+		options.metricsProviderService.SetLeaderElected(manager.Elected())
+	}
+	if options.input.Completed().BackgroundScrapePeriod > 0 {
+		options.metricsProviderService.Provider().SetQueryObserver(func(namespace string) {
+			for _, service := range inputServices {
+				service.NotifyNamespaceQueried(namespace)
+			}
+		})
+	}
+	if etcdSource := inputService.EtcdDataSource(); etcdSource != nil {
+		options.metricsProviderService.Provider().SetEtcdSource(etcdSource)
+	}
+	if options.metricsProviderService.DeploymentMetricsEnabled() {
+		// Read from the manager's cache. The provider metrics collector lists the Deployments upon each collection.
+		options.metricsProviderService.Provider().SetDeploymentSource(
+			metrics_provider.NewClientDeploymentSource(manager.GetClient()))
+	}
+
+	remoteWriteExporter, err :=
+		completeRemoteWriteCLIOptions(options.remoteWrite, options.metricsProviderService, dataSource, log)
+	if err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to complete remote-write CLI options")
+		return
+	}
+	configRegistry.Set("remoteWrite", options.remoteWrite.Completed())
+
+	kapiAPIServer, err := completeKapiAPICLIOptions(options.kapiAPI, dataSource, log)
+	if err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to complete Kapi gRPC API CLI options")
+		return
+	}
+	configRegistry.Set("kapiAPI", options.kapiAPI.Completed())
+
+	var providerMetricsCollector *metrics_provider.ProviderMetricsCollector
+	if options.app.Completed().ProviderMetricsEndpoint {
+		providerMetricsCollector =
+			metrics_provider.NewProviderMetricsCollector(options.metricsProviderService.Provider(), log)
+		if err := providerMetricsRegistry.Register(providerMetricsCollector); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to register provider metrics collector")
+			return
+		}
+	}
 
 	// Add backend services to the manager
 	if err := manager.Add(metricsProviderRunnable); err != nil {
 		log.V(app.VerbosityError).Error(err, "Failed to add metrics provider service to manager")
 		return
 	}
-	if err := manager.Add(haService); err != nil {
-		log.V(app.VerbosityError).Error(err, "Failed to add HA service to manager")
-		return
+	if haService != nil {
+		if err := manager.Add(haService); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to add HA service to manager")
+			return
+		}
+	}
+	if membership != nil {
+		if err := manager.Add(membership); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to add shard membership to manager")
+			return
+		}
 	}
 	if err := inputService.AddToManager(manager); err != nil {
 		log.V(app.VerbosityError).Error(err, "Failed to add input data service to manager")
 		return
 	}
+	if replicator != nil {
+		if err := manager.Add(replicator); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to add replicator to manager")
+			return
+		}
+	}
+	if options.app.Completed().InformerStallTimeout > 0 && options.input.Completed().Simulation == nil {
+		connectionMonitor, err := newConnectionMonitor(options.app.Completed(), manager, log)
+		if err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to create connection monitor")
+			return
+		}
+		if err := manager.Add(connectionMonitor); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to add connection monitor to manager")
+			return
+		}
+	}
+	if remoteWriteExporter != nil {
+		if err := manager.Add(remoteWriteExporter); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to add remote-write exporter to manager")
+			return
+		}
+	}
+	if kapiAPIServer != nil {
+		if err := manager.Add(kapiAPIServer); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to add Kapi gRPC API server to manager")
+			return
+		}
+	}
+	if providerMetricsCollector != nil {
+		if err := manager.Add(providerMetricsCollector); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to add provider metrics collector to manager")
+			return
+		}
+	}
+
+	if options.configFile != "" {
+		watcher := config_file.NewWatcher(
+			options.configFile,
+			config_file.DefaultWatchPeriod,
+			func(settings config_file.Settings) {
+				reloadSettings(settings, logLevels, inputServices, configRegistry, log)
+			},
+			log)
+		if err := manager.Add(watcher); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to add config file watcher to manager")
+			return
+		}
+	}
+
+	drainer := ha.NewShutdownDrainer(options.app.Completed().ShutdownDrainPeriod, haService, log)
+	if err := manager.AddReadyzCheck("shutdown-drain", drainer.ReadyzCheck); err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to add shutdown drain readiness check to manager")
+		return
+	}
+	go drainer.Run(signalCtx, ctx, cancel)
 
 	// Finally, run the manager
 	log.V(app.VerbosityInfo).Info("Starting controller manager")
-	if err := manager.Start(ctx); err != nil {
+	err = manager.Start(ctx)
+	// The manager released the leader lease upon stopping
+	drainer.WithdrawReleasedEndpoints()
+	if err != nil {
 		log.V(app.VerbosityError).Error(err, "Failed to start the controller manager")
 		return
 	}
@@ -210,10 +1139,146 @@ func getVersionCommand() *cobra.Command {
 	return cmd
 }
 
-func initLogs(ctx context.Context, level int) logr.Logger {
+// getPrintDefaultsCommand returns a command which prints the default values of the application's settings, as YAML
+func getPrintDefaultsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use: "print-defaults",
+		Long: "Print the default values of the application's settings, keyed by command line flag name, as YAML. The " +
+			"output is a valid config file (see --" + config_file.FlagName + "), and is meant to keep deployment " +
+			"templates in sync with the application's defaults.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			defaults, err := newDefaultCLIOptionSet().defaults()
+			if err != nil {
+				return fmt.Errorf("determining the default settings: %w", err)
+			}
+			content, err := yaml.Marshal(defaults)
+			if err != nil {
+				return fmt.Errorf("formatting the default settings: %w", err)
+			}
+			_, err = cmd.OutOrStdout().Write(content)
+			return err
+		},
+	}
+}
+
+// getProbeCommand returns a command which queries the custom metrics API served by a running instance of the
+// application, and explains why the metrics of a given pod are, or are not, available.
+func getProbeCommand() *cobra.Command {
+	options := probe.NewOptions()
+	cmd := &cobra.Command{
+		Use: "probe",
+		Long: "Query the custom metrics API served by the application, either via the aggregated API, or directly at " +
+			"an adapter replica, and diagnose the availability of the metrics of a given kube-apiserver pod. " +
+			"Exits with a non-zero status if the pod's request rate is not available.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := options.Validate(); err != nil {
+				return err
+			}
+			config, err := options.RESTConfig()
+			if err != nil {
+				return err
+			}
+			prober, err := probe.NewProber(config, options)
+			if err != nil {
+				return err
+			}
+			return prober.Run(cmd.Context(), os.Stdout)
+		},
+	}
+	options.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+// getAdminCommand returns a command which inspects and maintains the per-shoot data in the registry of a running
+// instance of the application, via its admin endpoint
+func getAdminCommand() *cobra.Command {
+	options := admin.NewOptions()
+	cmd := &cobra.Command{
+		Use: "admin",
+		Long: "Inspect and maintain the per-shoot data held by a running replica of the application, via the admin " +
+			"endpoint on its admin server. The replica must run with --admin-bind-address. Only the replica's primary " +
+			"cluster is covered.",
+	}
+	options.AddFlags(cmd.PersistentFlags())
+
+	// Wraps the run function of a subcommand with option validation, and client creation
+	withClient := func(run func(cmd *cobra.Command, client *admin.Client, args []string) error) func(
+		*cobra.Command, []string) error {
+
+		return func(cmd *cobra.Command, args []string) error {
+			if err := options.Validate(); err != nil {
+				return err
+			}
+			return run(cmd, admin.NewClient(options), args)
+		}
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "shoots",
+			Short: "List the shoots on record, with the number of kube-apiserver pods of each",
+			Args:  cobra.NoArgs,
+			RunE: withClient(func(cmd *cobra.Command, client *admin.Client, _ []string) error {
+				shoots, err := client.ListShoots(cmd.Context())
+				if err != nil {
+					return err
+				}
+				return admin.WriteShoots(cmd.OutOrStdout(), shoots)
+			}),
+		},
+		&cobra.Command{
+			Use:   "show NAMESPACE",
+			Short: "Show the scrape state of each kube-apiserver pod of the shoot in the specified namespace",
+			Args:  cobra.ExactArgs(1),
+			RunE: withClient(func(cmd *cobra.Command, client *admin.Client, args []string) error {
+				kapis, err := client.GetShoot(cmd.Context(), args[0])
+				if err != nil {
+					return err
+				}
+				return admin.WriteKapis(cmd.OutOrStdout(), kapis, time.Now())
+			}),
+		},
+		&cobra.Command{
+			Use:   "rescrape NAMESPACE",
+			Short: "Scrape the kube-apiserver pods of the shoot in the specified namespace right away",
+			Long: "Scrape the kube-apiserver pods of the shoot in the specified namespace right away, instead of at " +
+				"their next regular scrape. Pods which are scraped at a lower priority due to repeated failures are " +
+				"included. Scrape rate limits still apply.",
+			Args: cobra.ExactArgs(1),
+			RunE: withClient(func(cmd *cobra.Command, client *admin.Client, args []string) error {
+				count, err := client.Rescrape(cmd.Context(), args[0])
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(cmd.OutOrStdout(), "%d kube-apiserver pods due for scraping\n", count)
+				return err
+			}),
+		},
+		&cobra.Command{
+			Use:   "purge NAMESPACE POD",
+			Short: "Discard the record of a stuck kube-apiserver pod",
+			Long: "Discard the record of a stuck kube-apiserver pod, along with its samples and scrape state. The pod " +
+				"is back on record, with a fresh state, the next time the application reconciles it.",
+			Args: cobra.ExactArgs(2),
+			RunE: withClient(func(cmd *cobra.Command, client *admin.Client, args []string) error {
+				if err := client.PurgeKapi(cmd.Context(), args[0], args[1]); err != nil {
+					return err
+				}
+				_, err := fmt.Fprintf(cmd.OutOrStdout(), "Purged %s/%s\n", args[0], args[1])
+				return err
+			}),
+		},
+	)
+
+	return cmd
+}
+
+func initLogs(ctx context.Context, levels *logging.Levels) logr.Logger {
 	logs.InitLogs()
 
-	logger := zap.New(zap.UseDevMode(true), zap.Level(zapcore.Level(-level)))
+	// Level filtering is left to the levels object, which can apply a different level to each component
+	zapLogger := zap.New(zap.UseDevMode(true), zap.Level(zapcore.Level(math.MinInt8)))
+	logger := logr.New(logging.NewSink(zapLogger.GetSink(), levels))
 	logf.SetLogger(logger)
 	log := logf.Log.WithName(app.Name)
 	logf.IntoContext(ctx, log)
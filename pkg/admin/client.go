@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// The maximum number of bytes read from an error response body, to include in the error message
+const maxErrorBodySize = 1024
+
+// Options are the command line options of the admin client
+type Options struct {
+	// The base URL of the admin server of the application instance to administer, e.g. reached via kubectl
+	// port-forward
+	Address string
+	Timeout time.Duration // The time limit for each request to the admin endpoint
+}
+
+// NewOptions creates an Options object with default values
+func NewOptions() *Options {
+	return &Options{
+		Address: "http://localhost:8090",
+		Timeout: 10 * time.Second,
+	}
+}
+
+// AddFlags binds the options to the specified flag set
+func (options *Options) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&options.Address, "address", options.Address,
+		"Base URL of the admin server of the application replica to administer, e.g. forwarded to localhost via "+
+			"kubectl port-forward. The replica must run with --admin-bind-address.")
+	flags.DurationVar(&options.Timeout, "timeout", options.Timeout, "Time limit for each request to the replica")
+}
+
+// Validate checks the options for missing and invalid values
+func (options *Options) Validate() error {
+	address, err := url.Parse(options.Address)
+	if err != nil || (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+		return fmt.Errorf("--address must be an absolute http or https URL")
+	}
+	if options.Timeout <= 0 {
+		return fmt.Errorf("--timeout must be positive")
+	}
+	return nil
+}
+
+// Client accesses the admin endpoint of an application instance. See Handler.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient creates a Client which accesses the admin endpoint of the application instance specified by the options
+func NewClient(options *Options) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(options.Address, "/") + Path,
+		httpClient: &http.Client{Timeout: options.Timeout},
+	}
+}
+
+// ListShoots returns a summary of each shoot in the registry, ordered by namespace
+func (c *Client) ListShoots(ctx context.Context) ([]ShootSummary, error) {
+	var result []ShootSummary
+	if err := c.do(ctx, http.MethodGet, "shoots", http.StatusOK, &result); err != nil {
+		return nil, fmt.Errorf("listing shoots: %w", err)
+	}
+	return result, nil
+}
+
+// GetShoot returns the scrape state of each of the shoot's Kapis, ordered by pod name
+func (c *Client) GetShoot(ctx context.Context, namespace string) ([]KapiState, error) {
+	var result []KapiState
+	if err := c.do(ctx, http.MethodGet, "shoots/"+url.PathEscape(namespace), http.StatusOK, &result); err != nil {
+		return nil, fmt.Errorf("getting shoot %s: %w", namespace, err)
+	}
+	return result, nil
+}
+
+// Rescrape makes the shoot's Kapis due for scraping right away. Returns the number of Kapis affected.
+func (c *Client) Rescrape(ctx context.Context, namespace string) (int, error) {
+	var result RescrapeResult
+	path := "shoots/" + url.PathEscape(namespace) + "/rescrape"
+	if err := c.do(ctx, http.MethodPost, path, http.StatusOK, &result); err != nil {
+		return 0, fmt.Errorf("rescraping shoot %s: %w", namespace, err)
+	}
+	return result.KapiCount, nil
+}
+
+// PurgeKapi removes the record of the specified Kapi from the registry
+func (c *Client) PurgeKapi(ctx context.Context, namespace string, pod string) error {
+	path := "shoots/" + url.PathEscape(namespace) + "/kapis/" + url.PathEscape(pod)
+	if err := c.do(ctx, http.MethodDelete, path, http.StatusNoContent, nil); err != nil {
+		return fmt.Errorf("purging Kapi %s/%s: %w", namespace, pod, err)
+	}
+	return nil
+}
+
+// do sends a request with the specified method to the specified path, relative to the admin endpoint. Fails if the
+// response status differs from expectedStatus. If result is not nil, the response body is decoded into it.
+func (c *Client) do(ctx context.Context, method string, path string, expectedStatus int, result any) error {
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != expectedStatus {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+		return fmt.Errorf("the server responded with %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// WriteShoots writes the specified shoot summaries to out, as a human-readable table
+func WriteShoots(out io.Writer, shoots []ShootSummary) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tKAPIS\tAUTH")
+	for _, shoot := range shoots {
+		fmt.Fprintf(w, "%s\t%d\t%t\n", shoot.Namespace, shoot.KapiCount, shoot.HasAuthSecret)
+	}
+	return w.Flush()
+}
+
+// WriteKapis writes the scrape state of the specified Kapis to out, as a human-readable table. Times are shown as ages
+// relative to now.
+func WriteKapis(out io.Writer, kapis []KapiState, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "POD\tLAST SCRAPE\tLAST SAMPLE\tFAULTS\tSCRAPE PERIOD\tFLAGS\tURL")
+	for _, kapi := range kapis {
+		faults := fmt.Sprint(kapi.FaultCount)
+		if kapi.LastFaultCategory != "" {
+			faults += " (" + kapi.LastFaultCategory + ")"
+		}
+		scrapePeriod := "default"
+		if kapi.ScrapePeriod > 0 {
+			scrapePeriod = kapi.ScrapePeriod.String()
+		}
+		var flags []string
+		if kapi.ScrapeExcluded {
+			flags = append(flags, "excluded")
+		}
+		if kapi.NotReady {
+			flags = append(flags, "not-ready")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			kapi.Pod,
+			formatAge(kapi.LastScrapeTime, now),
+			formatAge(kapi.LastSampleTime, now),
+			faults,
+			scrapePeriod,
+			strings.Join(flags, ","),
+			kapi.MetricsURL)
+	}
+	return w.Flush()
+}
+
+// formatAge returns how long before now the specified time is, or "never", if the time is zero
+func formatAge(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return now.Sub(t).Truncate(time.Second).String() + " ago"
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package admin
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("admin.Options", func() {
+	Describe("Validate", func() {
+		DescribeTable("should reject an invalid address",
+			func(address string) {
+				// Arrange
+				options := NewOptions()
+				options.Address = address
+
+				// Act
+				err := options.Validate()
+
+				// Assert
+				Expect(err).To(HaveOccurred())
+			},
+			Entry("relative URL", "localhost:8080"),
+			Entry("unsupported scheme", "ftp://localhost:8080"),
+			Entry("no host", "http://"),
+		)
+
+		It("should accept the defaults", func() {
+			// Arrange
+			options := NewOptions()
+
+			// Act
+			err := options.Validate()
+
+			// Assert
+			Expect(err).To(Succeed())
+		})
+	})
+})
+
+var _ = Describe("admin.WriteKapis", func() {
+	It("should show times as ages, and the Kapi's faults and flags", func() {
+		// Arrange
+		now := gcmtesting.NewTime(1, 0, 0)
+		kapis := []KapiState{
+			{
+				Pod:               "pod1",
+				MetricsURL:        "https://10.0.0.1/metrics",
+				LastScrapeTime:    now.Add(-90 * time.Second),
+				FaultCount:        2,
+				LastFaultCategory: "network",
+				ScrapePeriod:      30 * time.Second,
+				NotReady:          true,
+			},
+		}
+		out := &bytes.Buffer{}
+
+		// Act
+		err := WriteKapis(out, kapis, now)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(out.String()).To(MatchRegexp(
+			`pod1\s+1m30s ago\s+never\s+2 \(network\)\s+30s\s+not-ready\s+https://10\.0\.0\.1/metrics`))
+	})
+})
@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package admin implements a maintenance endpoint, through which operators inspect the per-shoot data in the registry
+// of a running instance of the application, force a shoot's Kapis to be scraped right away, or purge the record of a
+// stuck Kapi. It also implements the client used by the application's admin command.
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// Path is the path, on the admin server, under which the admin endpoint is exposed. See Handler and Server.
+const Path = "/debug/admin/"
+
+// Backend is the part of the input data service which the admin endpoint operates on
+type Backend interface {
+	// DataRegistry returns the registry which holds the per-shoot data
+	DataRegistry() input_data_registry.InputDataRegistry
+	// ExpediteNamespace makes the Kapis of the shoot in the specified namespace due for scraping right away. Returns
+	// the number of Kapis affected.
+	ExpediteNamespace(namespace string) int
+	// RequestPodReconcile makes the pod controller reconcile the specified Kapi pod right away, which adds the Kapi
+	// back to the registry, if the pod still exists. Returns false, if the request was dropped.
+	RequestPodReconcile(namespace string, podName string) bool
+}
+
+// ShootSummary is the admin endpoint's representation of a shoot in the registry
+type ShootSummary struct {
+	Namespace string `json:"namespace"`
+	KapiCount int    `json:"kapiCount"`
+	// True if the registry holds the credentials used to scrape the shoot's Kapis
+	HasAuthSecret bool `json:"hasAuthSecret"`
+}
+
+// KapiState is the admin endpoint's representation of the scrape state of a single Kapi in the registry
+type KapiState struct {
+	Pod               string        `json:"pod"`
+	MetricsURL        string        `json:"metricsUrl"`
+	LastScrapeTime    time.Time     `json:"lastScrapeTime"`
+	LastSampleTime    time.Time     `json:"lastSampleTime"`
+	FaultCount        int           `json:"faultCount"`
+	LastFaultCategory string        `json:"lastFaultCategory,omitempty"`
+	ScrapePeriod      time.Duration `json:"scrapePeriod,omitempty"` // Zero if the Kapi uses the global scrape period
+	ScrapeExcluded    bool          `json:"scrapeExcluded,omitempty"`
+	NotReady          bool          `json:"notReady,omitempty"`
+}
+
+// RescrapeResult is the admin endpoint's response to a rescrape request
+type RescrapeResult struct {
+	// The number of the shoot's Kapis which became due for scraping
+	KapiCount int `json:"kapiCount"`
+}
+
+// Handler is an [http.Handler] which serves the admin endpoint:
+//   - GET shoots - lists the shoots in the registry
+//   - GET shoots/{namespace} - lists the scrape state of the shoot's Kapis
+//   - POST shoots/{namespace}/rescrape - makes the shoot's Kapis due for scraping right away
+//   - DELETE shoots/{namespace}/kapis/{pod} - removes the Kapi's record from the registry, and has the pod controller
+//     reconcile the pod right away, which adds the Kapi back with a fresh record, if the pod still exists
+//
+// All paths are relative to [Path]. Responses are in JSON format. The backend is specified after creation, because the
+// handler is created before the input data service exists. Until then, the handler responds with 503 Service
+// Unavailable.
+type Handler struct {
+	backend atomic.Pointer[Backend]
+	mux     *http.ServeMux
+}
+
+// NewHandler creates a Handler with no backend. See SetBackend.
+func NewHandler() *Handler {
+	h := &Handler{mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET "+Path+"shoots", h.listShoots)
+	h.mux.HandleFunc("GET "+Path+"shoots/{namespace}", h.getShoot)
+	h.mux.HandleFunc("POST "+Path+"shoots/{namespace}/rescrape", h.rescrape)
+	h.mux.HandleFunc("DELETE "+Path+"shoots/{namespace}/kapis/{pod}", h.purgeKapi)
+	return h
+}
+
+// SetBackend specifies the input data service on which the handler operates. Concurrency-safe.
+func (h *Handler) SetBackend(backend Backend) {
+	h.backend.Store(&backend)
+}
+
+// ServeHTTP implements [http.Handler].
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.backend.Load() == nil {
+		http.Error(w, "the registry is not initialized yet", http.StatusServiceUnavailable)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// listShoots responds with the ShootSummary of each shoot in the registry, ordered by namespace
+func (h *Handler) listShoots(w http.ResponseWriter, _ *http.Request) {
+	registry := (*h.backend.Load()).DataRegistry()
+	namespaces := registry.GetShootNamespaces()
+	slices.Sort(namespaces)
+
+	result := make([]ShootSummary, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		result = append(result, ShootSummary{
+			Namespace:     namespace,
+			KapiCount:     len(registry.DataSource().GetShootKapis(namespace)),
+			HasAuthSecret: registry.GetShootAuthSecret(namespace) != "",
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// getShoot responds with the KapiState of each of the shoot's Kapis, ordered by pod name
+func (h *Handler) getShoot(w http.ResponseWriter, r *http.Request) {
+	registry := (*h.backend.Load()).DataRegistry()
+	namespace := r.PathValue("namespace")
+	shootKapis := registry.DataSource().GetShootKapis(namespace)
+	if len(shootKapis) == 0 {
+		http.Error(w, "the registry has no Kapis in namespace "+namespace, http.StatusNotFound)
+		return
+	}
+
+	result := make([]KapiState, 0, len(shootKapis))
+	for _, shootKapi := range shootKapis {
+		kapi := registry.GetKapiData(namespace, shootKapi.PodName())
+		if kapi == nil { // Removed in the meantime
+			continue
+		}
+		result = append(result, KapiState{
+			Pod:               kapi.PodName(),
+			MetricsURL:        kapi.MetricsUrl,
+			LastScrapeTime:    kapi.LastMetricsScrapeTime,
+			LastSampleTime:    kapi.MetricsTimeNew,
+			FaultCount:        kapi.FaultCount,
+			LastFaultCategory: string(kapi.LastFaultCategory),
+			ScrapePeriod:      kapi.ScrapePeriod,
+			ScrapeExcluded:    kapi.ScrapeExcluded,
+			NotReady:          kapi.NotReady,
+		})
+	}
+	slices.SortFunc(result, func(a, b KapiState) int { return strings.Compare(a.Pod, b.Pod) })
+	writeJSON(w, http.StatusOK, result)
+}
+
+// rescrape makes the shoot's Kapis due for scraping, and responds with a RescrapeResult
+func (h *Handler) rescrape(w http.ResponseWriter, r *http.Request) {
+	namespace := r.PathValue("namespace")
+	count := (*h.backend.Load()).ExpediteNamespace(namespace)
+	if count == 0 {
+		http.Error(w, "the scrape queue has no Kapis in namespace "+namespace, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, RescrapeResult{KapiCount: count})
+}
+
+// purgeKapi removes the Kapi's record from the registry, requests a reconciliation of the Kapi pod, so the Kapi gets a
+// fresh record, and responds with 204 No Content. If the reconciliation request is dropped, the Kapi stays off the
+// registry until the pod changes, so the response is 503 Service Unavailable.
+func (h *Handler) purgeKapi(w http.ResponseWriter, r *http.Request) {
+	backend := *h.backend.Load()
+	namespace, pod := r.PathValue("namespace"), r.PathValue("pod")
+	if !backend.DataRegistry().RemoveKapiData(namespace, pod) {
+		http.Error(w, "the registry has no Kapi "+namespace+"/"+pod, http.StatusNotFound)
+		return
+	}
+	if !backend.RequestPodReconcile(namespace, pod) {
+		http.Error(w, "the Kapi was purged, but too many pod reconciliations are pending to add it back right away. "+
+			"It is added back when the pod changes.", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON responds with the specified status code, and the JSON representation of the specified value
+func writeJSON(w http.ResponseWriter, statusCode int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	// Too late to report a failure via the status code. The client detects the truncated body.
+	_ = json.NewEncoder(w).Encode(value)
+}
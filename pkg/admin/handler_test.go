@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+// fakeBackend implements Backend on top of a registry, and records the namespaces passed to ExpediteNamespace, and the
+// pods passed to RequestPodReconcile
+type fakeBackend struct {
+	registry            input_data_registry.InputDataRegistry
+	expeditedNamespaces []string
+	reconciledPods      []string
+}
+
+func (fb *fakeBackend) DataRegistry() input_data_registry.InputDataRegistry {
+	return fb.registry
+}
+
+func (fb *fakeBackend) ExpediteNamespace(namespace string) int {
+	fb.expeditedNamespaces = append(fb.expeditedNamespaces, namespace)
+	return len(fb.registry.DataSource().GetShootKapis(namespace))
+}
+
+func (fb *fakeBackend) RequestPodReconcile(namespace string, podName string) bool {
+	fb.reconciledPods = append(fb.reconciledPods, namespace+"/"+podName)
+	return true
+}
+
+var _ = Describe("admin.Handler", func() {
+	const (
+		testNs  = "shoot--my-shoot"
+		otherNs = "shoot--other-shoot"
+	)
+
+	var (
+		// Creates a backend whose registry has two Kapis in testNs, one of them failing, and one Kapi in otherNs.
+		// Only testNs has an auth secret.
+		newTestBackend = func() *fakeBackend {
+			idr := input_data_registry.NewInputDataRegistry(time.Second, logr.Discard())
+			idr.SetKapiData(testNs, "pod2", "uid2", nil, "https://10.0.0.2/metrics")
+			idr.SetKapiData(testNs, "pod1", "uid1", nil, "https://10.0.0.1/metrics")
+			idr.SetKapiData(otherNs, "pod3", "uid3", nil, "https://10.0.0.3/metrics")
+			idr.SetKapiLastScrapeTime(testNs, "pod1", gcmtesting.NewTime(1, 0, 0))
+			idr.NotifyKapiMetricsFault(testNs, "pod2", input_data_registry.ScrapeErrorNetwork)
+			idr.SetShootAuthSecret(testNs, "token")
+			return &fakeBackend{registry: idr}
+		}
+		// Serves a handler with the specified backend, and returns a client for it
+		newTestClient = func(backend Backend) *Client {
+			handler := NewHandler()
+			if backend != nil {
+				handler.SetBackend(backend)
+			}
+			server := httptest.NewServer(handler)
+			DeferCleanup(server.Close)
+			options := NewOptions()
+			options.Address = server.URL
+			return NewClient(options)
+		}
+	)
+
+	It("should list the shoots in the registry, ordered by namespace", func() {
+		// Arrange
+		client := newTestClient(newTestBackend())
+
+		// Act
+		shoots, err := client.ListShoots(context.Background())
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(shoots).To(Equal([]ShootSummary{
+			{Namespace: testNs, KapiCount: 2, HasAuthSecret: true},
+			{Namespace: otherNs, KapiCount: 1},
+		}))
+	})
+
+	It("should show the scrape state of the shoot's Kapis, ordered by pod name", func() {
+		// Arrange
+		client := newTestClient(newTestBackend())
+
+		// Act
+		kapis, err := client.GetShoot(context.Background(), testNs)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(kapis).To(HaveLen(2))
+		Expect(kapis[0].Pod).To(Equal("pod1"))
+		Expect(kapis[0].MetricsURL).To(Equal("https://10.0.0.1/metrics"))
+		Expect(kapis[0].LastScrapeTime.Equal(gcmtesting.NewTime(1, 0, 0))).To(BeTrue())
+		Expect(kapis[0].FaultCount).To(BeZero())
+		Expect(kapis[1].Pod).To(Equal("pod2"))
+		Expect(kapis[1].FaultCount).To(Equal(1))
+		Expect(kapis[1].LastFaultCategory).To(Equal(string(input_data_registry.ScrapeErrorNetwork)))
+	})
+
+	It("should fail to show a shoot which is not in the registry", func() {
+		// Arrange
+		client := newTestClient(newTestBackend())
+
+		// Act
+		_, err := client.GetShoot(context.Background(), "shoot--missing")
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("404")))
+	})
+
+	It("should expedite the scrape of the shoot's Kapis", func() {
+		// Arrange
+		backend := newTestBackend()
+		client := newTestClient(backend)
+
+		// Act
+		count, err := client.Rescrape(context.Background(), testNs)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(count).To(Equal(2))
+		Expect(backend.expeditedNamespaces).To(Equal([]string{testNs}))
+	})
+
+	It("should remove the purged Kapi from the registry, request a reconciliation of its pod, and leave the shoot's "+
+		"other Kapis alone", func() {
+		// Arrange
+		backend := newTestBackend()
+		client := newTestClient(backend)
+
+		// Act
+		err := client.PurgeKapi(context.Background(), testNs, "pod2")
+		errAgain := client.PurgeKapi(context.Background(), testNs, "pod2")
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(errAgain).To(MatchError(ContainSubstring("404")))
+		Expect(backend.registry.GetKapiData(testNs, "pod2")).To(BeNil())
+		Expect(backend.registry.GetKapiData(testNs, "pod1")).NotTo(BeNil())
+		Expect(backend.reconciledPods).To(Equal([]string{testNs + "/pod2"}))
+	})
+
+	It("should respond with 503 Service Unavailable, until the backend is set", func() {
+		// Arrange
+		client := newTestClient(nil)
+
+		// Act
+		_, err := client.ListShoots(context.Background())
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("503")))
+	})
+
+	It("should reject requests with an unsupported method", func() {
+		// Arrange
+		handler := NewHandler()
+		handler.SetBackend(newTestBackend())
+		recorder := httptest.NewRecorder()
+
+		// Act
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, Path+"shoots", nil))
+
+		// Assert
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+// The time limit for completing the requests in progress, when the server stops
+const shutdownTimeout = 5 * time.Second
+
+// Server serves a Handler at a dedicated address. The admin endpoint is not authenticated, so it is not served by the
+// metrics server, which is reachable by other seed components, but at an address of its own, meant to be a loopback
+// address, reached via kubectl port-forward.
+//
+// Server implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable].
+type Server struct {
+	bindAddress string
+	handler     http.Handler
+	log         logr.Logger
+}
+
+// NewServer creates a Server which serves the specified handler at bindAddress
+func NewServer(bindAddress string, handler *Handler, parentLogger logr.Logger) *Server {
+	return &Server{
+		bindAddress: bindAddress,
+		handler:     handler,
+		log:         parentLogger.WithName("admin"),
+	}
+}
+
+// NeedLeaderElection implements [sigs.k8s.io/controller-runtime/pkg/manager.LeaderElectionRunnable]. Each replica can
+// be inspected, not just the leader.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It serves the admin endpoint until the
+// context is cancelled. Fails if the bind address is not available.
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.bindAddress)
+	if err != nil {
+		return fmt.Errorf("starting admin server: %w", err)
+	}
+	return s.serve(ctx, listener)
+}
+
+// serve serves the admin endpoint on the specified listener, until the context is cancelled. Closes the listener.
+func (s *Server) serve(ctx context.Context, listener net.Listener) error {
+	log := s.log.WithValues("op", "adminProc")
+	server := &http.Server{Handler: s.handler, ReadHeaderTimeout: 10 * time.Second}
+	serveResult := make(chan error, 1)
+	go func() {
+		serveResult <- server.Serve(listener)
+	}()
+	log.V(app.VerbosityInfo).Info("Admin server started", "address", listener.Addr().String())
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to stop the admin server gracefully")
+		}
+		log.V(app.VerbosityInfo).Info("Context closed, exiting")
+		return nil
+	case err := <-serveResult:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("serving admin endpoint: %w", err)
+	}
+}
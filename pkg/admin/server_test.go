@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package admin
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+var _ = Describe("admin.Server", func() {
+	Describe("serve", func() {
+		It("should serve the admin endpoint, until the context is cancelled", func() {
+			// Arrange
+			handler := NewHandler()
+			handler.SetBackend(&fakeBackend{
+				registry: input_data_registry.NewInputDataRegistry(time.Second, logr.Discard()),
+			})
+			server := NewServer("", handler, logr.Discard())
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).To(Succeed())
+			ctx, cancel := context.WithCancel(context.Background())
+			serveResult := make(chan error, 1)
+			options := NewOptions()
+			options.Address = "http://" + listener.Addr().String()
+			client := NewClient(options)
+
+			// Act
+			go func() {
+				serveResult <- server.serve(ctx, listener)
+			}()
+			_, errRescrape := client.Rescrape(context.Background(), "shoot--missing")
+			cancel()
+
+			// Assert
+			Expect(errRescrape).To(MatchError(ContainSubstring("404")))
+			Eventually(serveResult).Should(Receive(BeNil()))
+			_, err = net.Dial("tcp", listener.Addr().String())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -6,17 +6,22 @@ package app
 
 import (
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/spf13/pflag"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
+	"github.com/gardener/gardener-custom-metrics/pkg/util/flagutil"
 	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
 )
 
@@ -28,6 +33,65 @@ const (
 	qpsFlagName             = "qps"
 	logLevelFlagName        = "log-level"
 	debugFlagName           = "debug"
+	haModeFlagName          = "ha-mode"
+	haEndpointModeFlagName  = "ha-endpoint-mode"
+
+	haSharedEndpointsFlagName = "ha-shared-endpoints"
+
+	providerMetricsEndpointFlagName = "provider-metrics-endpoint"
+	adminBindAddressFlagName        = "admin-bind-address"
+	shutdownDrainPeriodFlagName     = "shutdown-drain-period"
+
+	haRetryPeriodFlagName    = "ha-retry-period"
+	haMaxRetryPeriodFlagName = "ha-max-retry-period"
+	haRetryJitterFlagName    = "ha-retry-jitter"
+
+	kapiPodSelectorFlagName       = "kapi-pod-selector"
+	shootNamespacePrefixFlagName  = "shoot-namespace-prefix"
+	shootNamespacePatternFlagName = "shoot-namespace-pattern"
+	legacySecretSelectionFlagName = "legacy-secret-selection"
+
+	logLevelScraperFlagName     = "log-level-scraper"
+	logLevelControllersFlagName = "log-level-controllers"
+
+	permissionCheckFlagName = "permission-check"
+
+	clientTimeoutFlagName       = "client-timeout"
+	directClientQPSFlagName     = "direct-client-qps"
+	directClientBurstFlagName   = "direct-client-burst"
+	directClientTimeoutFlagName = "direct-client-timeout"
+
+	dryRunFlagName = "dry-run"
+
+	informerStallTimeoutFlagName = "informer-stall-timeout"
+)
+
+// The type of the secrets in which Helm stores its releases. Excluded from the cache in legacy secret selection mode.
+const helmReleaseSecretType = "helm.sh/release.v1"
+
+// Values of the --ha-mode flag
+const (
+	// HAModeActivePassive runs replicas in active/passive mode: replicas elect a leader, and the HA service points the
+	// application's service endpoint to the leader.
+	HAModeActivePassive = "active-passive"
+	// HAModeOff runs a single replica, without leader election, and without managing the service endpoint. The replica
+	// is expected to be reached through a regular, selector-based service.
+	HAModeOff = "off"
+	// HAModeSharded runs multiple active replicas, without leader election, and, unless the --ha-shared-endpoints
+	// flag is set, without managing the service endpoint. Each replica scrapes a subset (shard) of the shoot
+	// namespaces, and forwards metric requests for namespaces it does not own to the owning replica.
+	HAModeSharded = "sharded"
+)
+
+// Values of the --ha-endpoint-mode flag
+const (
+	// HAEndpointModeEndpoints directs the service to the leader via a core/v1 Endpoints object
+	HAEndpointModeEndpoints = "endpoints"
+	// HAEndpointModeEndpointSlice directs the service to the leader via a discovery.k8s.io/v1 EndpointSlice object
+	HAEndpointModeEndpointSlice = "endpointslice"
+	// HAEndpointModeBoth maintains both an EndpointSlice and an Endpoints object, for compatibility with consumers
+	// which only understand one of them
+	HAEndpointModeBoth = "both"
 )
 
 // CLIOptions are command line options with application-level relevance
@@ -44,11 +108,44 @@ type CLIOptions struct {
 	RestOptions     *gutil.RESTOptions
 	LogLevel        int
 	Debug           bool
+	HAMode          string
+	HAEndpointMode  string
+
+	HASharedEndpoints bool
+
+	ProviderMetricsEndpoint bool
+	AdminBindAddress        string
+	ShutdownDrainPeriod     time.Duration
+
+	HARetryPeriod    time.Duration
+	HAMaxRetryPeriod time.Duration
+	HARetryJitter    float64
+
+	KapiPodSelector       string
+	ShootNamespacePrefix  string
+	ShootNamespacePattern string
+	LegacySecretSelection bool
+
+	LogLevelScraper     int
+	LogLevelControllers int
+
+	PermissionCheck bool
 
 	// Queries per second allowed on the client connection to the seed kube-apiserver
 	QPS float32
 	// Short-term burst allowance for the QPS setting
 	Burst int
+
+	// Settings of the seed kube-apiserver clients. See the help of the respective flags. They are applied to
+	// CLIConfig.RESTConfig and CLIConfig.DirectRESTConfig.
+	ClientTimeout       time.Duration
+	DirectClientQPS     float32
+	DirectClientBurst   int
+	DirectClientTimeout time.Duration
+
+	DryRun bool
+
+	InformerStallTimeout time.Duration
 }
 
 // AddFlags implements Flagger.AddFlags.
@@ -71,23 +168,280 @@ func (options *CLIOptions) AddFlags(flags *pflag.FlagSet) {
 		"Request throttling for this client: brief request bursts are allowed to exceed the throttling rate by this much.")
 	flags.Float32Var(&options.QPS, qpsFlagName, options.QPS,
 		"Request throttling rate for this client, expressed as average number of requests per second.")
+	flags.BoolVar(&options.DryRun, dryRunFlagName, options.DryRun,
+		fmt.Sprintf(
+			"If set, the application scrapes and serves metrics, but makes no changes to the seed cluster: write "+
+				"requests are logged instead of being made, no events are recorded, and leader election is off, so "+
+				"the service endpoints are left to the replicas which are not in dry-run mode. Intended for canary "+
+				"rollouts. Default: %t",
+			options.DryRun))
+	flags.DurationVar(&options.ClientTimeout, clientTimeoutFlagName, options.ClientTimeout,
+		fmt.Sprintf(
+			"The timeout of each request made by the cached (informer-backed) seed client. Also applies to watches, "+
+				"which are then re-established once per this period. Zero means no timeout. Default: %s",
+			options.ClientTimeout))
+	flags.Float32Var(&options.DirectClientQPS, directClientQPSFlagName, options.DirectClientQPS,
+		fmt.Sprintf(
+			"Like --%s, but for the direct (uncached) seed client, which is used by leader election, by the "+
+				"management of the service endpoints, and by shard membership, so their requests are not throttled "+
+				"along with the cached client's. Zero means that --%s applies. Default: %g",
+			qpsFlagName, qpsFlagName, options.DirectClientQPS))
+	flags.IntVar(&options.DirectClientBurst, directClientBurstFlagName, options.DirectClientBurst,
+		fmt.Sprintf(
+			"Like --%s, but for the direct seed client. See --%s. Zero means that --%s applies. Default: %d",
+			burstFlagName, directClientQPSFlagName, burstFlagName, options.DirectClientBurst))
+	flags.DurationVar(&options.DirectClientTimeout, directClientTimeoutFlagName, options.DirectClientTimeout,
+		fmt.Sprintf(
+			"The timeout of each request made by the direct seed client (see --%s), so a slow seed kube-apiserver "+
+				"fails leader election renewals and endpoint updates in time for a retry, instead of stalling them. "+
+				"Zero means no timeout. Default: %s",
+			directClientQPSFlagName, options.DirectClientTimeout))
 	flags.IntVar(&options.LogLevel, logLevelFlagName, options.LogLevel,
 		"Log messages which have their level greater than this, will be suppressed.")
 	flags.BoolVar(&options.Debug, debugFlagName, options.Debug,
 		"If set, runs the application in a mode which facilitates debugging, e.g. with extremely slow leader election.")
+	flags.StringVar(&options.HAMode, haModeFlagName, options.HAMode,
+		fmt.Sprintf(
+			"High availability mode. '%s': replicas elect a leader, and the service endpoint is pointed to the leader. "+
+				"'%s': single replica, no leader election, and no endpoint management - the application is expected "+
+				"to be exposed through a regular, selector-based service. '%s': like '%s', but with multiple "+
+				"replicas, each scraping a subset of the shoot namespaces.",
+			HAModeActivePassive, HAModeOff, HAModeSharded, HAModeOff))
+	flags.StringVar(&options.HAEndpointMode, haEndpointModeFlagName, options.HAEndpointMode,
+		fmt.Sprintf(
+			"In '%s' HA mode, the kind of object used to point the service to the leader. '%s': core/v1 Endpoints. "+
+				"'%s': discovery.k8s.io/v1 EndpointSlice, removed when the leader steps down. '%s': both.",
+			HAModeActivePassive, HAEndpointModeEndpoints, HAEndpointModeEndpointSlice, HAEndpointModeBoth))
+	flags.BoolVar(&options.HASharedEndpoints, haSharedEndpointsFlagName, options.HASharedEndpoints,
+		fmt.Sprintf(
+			"If set, in '%s' HA mode, each replica lists itself in the service endpoints while it is ready, so "+
+				"consumers can read from all replicas, instead of relying on a selector-based service. The kind of "+
+				"object is determined by --%s.",
+			HAModeSharded, haEndpointModeFlagName))
+	flags.BoolVar(&options.ProviderMetricsEndpoint, providerMetricsEndpointFlagName, options.ProviderMetricsEndpoint,
+		"If set, the custom metric values currently being served are also exposed in Prometheus format, at the "+
+			"/provider-metrics path of the metrics server.")
+	flags.StringVar(&options.AdminBindAddress, adminBindAddressFlagName, options.AdminBindAddress,
+		"If set, a maintenance endpoint is served at this address, e.g. 127.0.0.1:8090, at the /debug/admin/ path. It "+
+			"lists the shoots and Kapis on record, forces the Kapis of a shoot to be scraped right away, and purges "+
+			"the record of a Kapi. Meant for use via the admin command, through kubectl port-forward. The endpoint is "+
+			"not authenticated, so the address must be a loopback address, which is only reachable from within the "+
+			"pod.")
+	flags.DurationVar(&options.ShutdownDrainPeriod, shutdownDrainPeriodFlagName, options.ShutdownDrainPeriod,
+		fmt.Sprintf(
+			"Upon termination signal, the application reports itself as not ready, withdraws its address from the "+
+				"service endpoints in shared HA mode, and keeps serving for this long, before it stops. In "+
+				"active-passive HA mode, the leader's endpoints are withdrawn after it releases the leader lease. Must "+
+				"be shorter than the pod's termination grace period. Zero stops the application right away. Default: %s",
+			options.ShutdownDrainPeriod))
+	flags.DurationVar(&options.HARetryPeriod, haRetryPeriodFlagName, options.HARetryPeriod,
+		fmt.Sprintf(
+			"In '%s' HA mode, if pointing the service to the leader fails, the wait before the first retry. The wait "+
+				"doubles with each failed retry, up to the --%s value. Default: %s",
+			HAModeActivePassive, haMaxRetryPeriodFlagName, options.HARetryPeriod))
+	flags.DurationVar(&options.HAMaxRetryPeriod, haMaxRetryPeriodFlagName, options.HAMaxRetryPeriod,
+		fmt.Sprintf(
+			"The upper limit of the wait between retries, when pointing the service to the leader fails. See --%s. "+
+				"Default: %s",
+			haRetryPeriodFlagName, options.HAMaxRetryPeriod))
+	flags.Float64Var(&options.HARetryJitter, haRetryJitterFlagName, options.HARetryJitter,
+		fmt.Sprintf(
+			"Each wait between retries, when pointing the service to the leader fails, is randomly extended by up to "+
+				"this fraction of its length, so replicas do not retry in lockstep. Zero disables jitter. Default: %g",
+			options.HARetryJitter))
+	flags.StringVar(&options.KapiPodSelector, kapiPodSelectorFlagName, options.KapiPodSelector,
+		fmt.Sprintf(
+			"Label selector which identifies the shoot kube-apiserver pods, in the usual Kubernetes selector syntax, "+
+				"e.g. 'app=kubernetes,role in (apiserver,kube-apiserver)'. Default: %s",
+			options.KapiPodSelector))
+	flags.StringVar(&options.ShootNamespacePrefix, shootNamespacePrefixFlagName, options.ShootNamespacePrefix,
+		fmt.Sprintf(
+			"Only namespaces whose name starts with this prefix are considered to contain shoot control planes. "+
+				"Default: %s",
+			options.ShootNamespacePrefix))
+	flags.StringVar(&options.ShootNamespacePattern, shootNamespacePatternFlagName, options.ShootNamespacePattern,
+		fmt.Sprintf(
+			"If not empty, a regular expression which the name of a namespace must match, in addition to having the "+
+				"--%s prefix, for the namespace to be considered to contain a shoot control plane.",
+			shootNamespacePrefixFlagName))
+	flags.BoolVar(&options.LegacySecretSelection, legacySecretSelectionFlagName, options.LegacySecretSelection,
+		fmt.Sprintf(
+			"By default, only the seed secrets whose 'name' label names one of the secrets used by the application "+
+				"are cached. Set this for seeds where those secrets lack the label, as with older naming conventions. "+
+				"All secrets, except Helm release secrets, are then cached, at a much higher memory cost. Default: %t",
+			options.LegacySecretSelection))
+	flags.IntVar(&options.LogLevelScraper, logLevelScraperFlagName, options.LogLevelScraper,
+		fmt.Sprintf(
+			"Like --%s, but only applies to messages from the scraper, which can then be debugged without flooding "+
+				"the log with messages from other components. Negative means that --%s applies. Default: %d",
+			logLevelFlagName, logLevelFlagName, options.LogLevelScraper))
+	flags.IntVar(&options.LogLevelControllers, logLevelControllersFlagName, options.LogLevelControllers,
+		fmt.Sprintf(
+			"Like --%s, but only applies to messages from the pod and secret controllers. Negative means that --%s "+
+				"applies. Default: %d",
+			logLevelFlagName, logLevelFlagName, options.LogLevelControllers))
+	flags.BoolVar(&options.PermissionCheck, permissionCheckFlagName, options.PermissionCheck,
+		fmt.Sprintf(
+			"If set, upon startup, the application verifies that it has all K8s API permissions it requires for the "+
+				"configured HA mode, and exits with a message listing the missing ones, if any. Default: %t",
+			options.PermissionCheck))
+	flags.DurationVar(&options.InformerStallTimeout, informerStallTimeoutFlagName, options.InformerStallTimeout,
+		fmt.Sprintf(
+			"If the seed informers deliver no events for this long, and the seed kube-apiserver also fails to respond "+
+				"to direct requests, the connection to the seed is considered stalled (e.g. because the seed "+
+				"kube-apiserver address changed), and the application restarts. Zero disables the check. Default: %s",
+			options.InformerStallTimeout))
 	options.RestOptions.AddFlags(flags)
 	options.ManagerOptions.AddFlags(flags)
 }
 
+// Defaults returns the default values which AddFlags registers for the flags it binds, keyed by flag name. Those are
+// the current values of the options, so Defaults called on options which are not yet bound to the command line, yields
+// the effective application defaults. See [flagutil.Defaults] for the form of the values. Does not modify the options.
+func (options *CLIOptions) Defaults() (map[string]interface{}, error) {
+	// Binding to a flag overwrites the field with the flag default, so bind a copy
+	optionsCopy := *options
+	restOptions := *options.RestOptions
+	optionsCopy.RestOptions = &restOptions
+	flags := pflag.NewFlagSet(Name, pflag.ContinueOnError)
+	optionsCopy.AddFlags(flags)
+	return flagutil.Defaults(flags)
+}
+
+// Validate checks the options for invalid values and inconsistent combinations, without accessing the environment
+// (e.g. without loading a kubeconfig). Complete performs the same checks, so Validate only needs to be called on its own
+// when the configuration is to be checked without running the application.
+func (options *CLIOptions) Validate() error {
+	switch options.HAMode {
+	case HAModeActivePassive, HAModeOff, HAModeSharded:
+	default:
+		return fmt.Errorf(
+			"invalid --%s option '%s'. Valid values: %s, %s, %s",
+			haModeFlagName, options.HAMode, HAModeActivePassive, HAModeOff, HAModeSharded)
+	}
+	switch options.HAEndpointMode {
+	case HAEndpointModeEndpoints, HAEndpointModeEndpointSlice, HAEndpointModeBoth:
+	default:
+		return fmt.Errorf(
+			"invalid --%s option '%s'. Valid values: %s, %s, %s", haEndpointModeFlagName, options.HAEndpointMode,
+			HAEndpointModeEndpoints, HAEndpointModeEndpointSlice, HAEndpointModeBoth)
+	}
+	if options.HAMode != HAModeOff {
+		// Consumers reach the replica(s) at the access address, through the service endpoints or via shard forwarding
+		if options.Namespace == "" {
+			return fmt.Errorf("the --%s option is required in '%s' HA mode", namespaceFlagName, options.HAMode)
+		}
+		if net.ParseIP(options.AccessIPAddress) == nil {
+			return fmt.Errorf(
+				"the --%s option must specify a valid IP address in '%s' HA mode, but it is '%s'",
+				accessIPAddressFlagName, options.HAMode, options.AccessIPAddress)
+		}
+		if options.AccessPort <= 0 || options.AccessPort > 65535 {
+			return fmt.Errorf(
+				"the --%s option must be between 1 and 65535 in '%s' HA mode, but it is %d",
+				accessPortFlagName, options.HAMode, options.AccessPort)
+		}
+	}
+	if options.QPS < 0 {
+		return fmt.Errorf("the --%s option must not be negative", qpsFlagName)
+	}
+	if options.Burst < 0 {
+		return fmt.Errorf("the --%s option must not be negative", burstFlagName)
+	}
+	if options.ClientTimeout < 0 {
+		return fmt.Errorf("the --%s option must not be negative", clientTimeoutFlagName)
+	}
+	if options.DirectClientQPS < 0 {
+		return fmt.Errorf("the --%s option must not be negative", directClientQPSFlagName)
+	}
+	if options.DirectClientBurst < 0 {
+		return fmt.Errorf("the --%s option must not be negative", directClientBurstFlagName)
+	}
+	if options.DirectClientTimeout < 0 {
+		return fmt.Errorf("the --%s option must not be negative", directClientTimeoutFlagName)
+	}
+	if options.ShutdownDrainPeriod < 0 {
+		return fmt.Errorf("the --%s option must not be negative", shutdownDrainPeriodFlagName)
+	}
+	if options.InformerStallTimeout < 0 {
+		return fmt.Errorf("the --%s option must not be negative", informerStallTimeoutFlagName)
+	}
+	if options.HARetryPeriod <= 0 {
+		return fmt.Errorf("the --%s option must be positive", haRetryPeriodFlagName)
+	}
+	if options.HAMaxRetryPeriod < options.HARetryPeriod {
+		return fmt.Errorf(
+			"the --%s option must not be less than the --%s option", haMaxRetryPeriodFlagName, haRetryPeriodFlagName)
+	}
+	if options.HARetryJitter < 0 {
+		return fmt.Errorf("the --%s option must not be negative", haRetryJitterFlagName)
+	}
+	if options.AdminBindAddress != "" && !isLoopbackAddress(options.AdminBindAddress) {
+		return fmt.Errorf(
+			"the --%s option must specify a loopback address and a port, e.g. 127.0.0.1:8090, but it is '%s'",
+			adminBindAddressFlagName, options.AdminBindAddress)
+	}
+	if _, err := options.kapiSelector(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// isLoopbackAddress returns true if the specified host:port address is on a loopback interface
+func isLoopbackAddress(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || port == "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ComponentLogLevels returns the log levels of the components whose level is set separately from --log-level, keyed by
+// component name (e.g. LogComponentScraper). Components which are not in the map use the --log-level value.
+// Unlike Completed, it is available before Complete is called, so the log levels can be reloaded at runtime.
+func (options *CLIOptions) ComponentLogLevels() map[string]int {
+	result := make(map[string]int, 2)
+	if options.LogLevelScraper >= 0 {
+		result[LogComponentScraper] = options.LogLevelScraper
+	}
+	if options.LogLevelControllers >= 0 {
+		result[LogComponentControllers] = options.LogLevelControllers
+	}
+	return result
+}
+
+// kapiSelector creates the KapiSelector specified by the options
+func (options *CLIOptions) kapiSelector() (*gutil.KapiSelector, error) {
+	selector, err := gutil.NewKapiSelector(
+		options.KapiPodSelector, options.ShootNamespacePrefix, options.ShootNamespacePattern)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"invalid --%s, --%s, or --%s option: %w",
+			kapiPodSelectorFlagName, shootNamespacePrefixFlagName, shootNamespacePatternFlagName, err)
+	}
+	return selector, nil
+}
+
 // Complete implements [ctlcmd.Completer.Complete]. It uses CLI parameters to derive the actual configuration settings
 // to be used by the application.
 func (options *CLIOptions) Complete() error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
 	if err := options.ManagerOptions.Complete(); err != nil {
 		return err
 	}
 	if err := options.RestOptions.Complete(); err != nil {
 		return err
 	}
+	kapiSelector, err := options.kapiSelector()
+	if err != nil {
+		return err
+	}
 	options.config = &CLIConfig{
 		ManagerConfig:   *options.ManagerOptions.Completed(),
 		RESTConfig:      *options.RestOptions.Completed(),
@@ -96,12 +450,58 @@ func (options *CLIOptions) Complete() error {
 		AccessPort:      options.AccessPort,
 		Debug:           options.Debug,
 		LogLevel:        options.LogLevel,
+		HAMode:          options.HAMode,
+		HAEndpointMode:  options.HAEndpointMode,
+
+		HASharedEndpoints: options.HASharedEndpoints,
+
+		ProviderMetricsEndpoint: options.ProviderMetricsEndpoint,
+		AdminBindAddress:        options.AdminBindAddress,
+		ShutdownDrainPeriod:     options.ShutdownDrainPeriod,
+
+		HARetryPeriod:    options.HARetryPeriod,
+		HAMaxRetryPeriod: options.HAMaxRetryPeriod,
+		HARetryJitter:    options.HARetryJitter,
+
+		KapiSelector:          kapiSelector,
+		LegacySecretSelection: options.LegacySecretSelection,
+
+		ComponentLogLevels: options.ComponentLogLevels(),
+
+		PermissionCheck: options.PermissionCheck,
+		DryRun:          options.DryRun,
+
+		InformerStallTimeout: options.InformerStallTimeout,
+	}
+	if options.DryRun {
+		// Leader election writes to the seed
+		options.config.LeaderElection = false
 	}
 	options.config.RESTConfig.Config.Burst = options.Burst
 	options.config.RESTConfig.Config.QPS = options.QPS
+	options.config.RESTConfig.Config.Timeout = options.ClientTimeout
+	options.config.DirectRESTConfig = options.directRESTConfig(options.config.RESTConfig.Config)
 	return nil
 }
 
+// directRESTConfig returns the configuration of the direct seed client, derived from the specified configuration of
+// the cached client. All clients created from the result share a single rate limiter, so the QPS and burst settings
+// apply to the direct clients as a whole.
+func (options *CLIOptions) directRESTConfig(cachedConfig *rest.Config) *rest.Config {
+	result := rest.CopyConfig(cachedConfig)
+	if options.DirectClientQPS > 0 {
+		result.QPS = options.DirectClientQPS
+	}
+	if options.DirectClientBurst > 0 {
+		result.Burst = options.DirectClientBurst
+	}
+	result.Timeout = options.DirectClientTimeout
+	if result.QPS > 0 {
+		result.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(result.QPS, result.Burst)
+	}
+	return result
+}
+
 // Completed returns a CLIConfig which contains the configuration settings derived from CLI parameters. Only call this
 // if `Complete` was successful.
 func (options *CLIOptions) Completed() *CLIConfig {
@@ -124,12 +524,54 @@ type CLIConfig struct {
 	LogLevel int
 	// Run the application in a mode which facilitates debugging, e.g. with extremely slow leader election
 	Debug bool
+	// High availability mode. One of HAModeActivePassive, HAModeOff, HAModeSharded.
+	HAMode string
+	// The kind of object used to point the service to the leader. One of HAEndpointModeEndpoints,
+	// HAEndpointModeEndpointSlice, HAEndpointModeBoth.
+	HAEndpointMode string
+	// In HAModeSharded, each replica lists itself in the service endpoints, instead of relying on a selector-based
+	// service
+	HASharedEndpoints bool
+	// Expose the custom metric values currently being served, in Prometheus format, on the metrics server
+	ProviderMetricsEndpoint bool
+	// If not empty, the maintenance endpoint of package admin is served at this loopback address
+	AdminBindAddress string
+	// Upon termination signal, keep serving for this long, after reporting not ready
+	ShutdownDrainPeriod time.Duration
+	// If pointing the service to the leader fails, the wait before the first retry
+	HARetryPeriod time.Duration
+	// The upper limit of the exponentially growing wait between retries to point the service to the leader
+	HAMaxRetryPeriod time.Duration
+	// Each wait between retries to point the service to the leader is randomly extended by up to this fraction
+	HARetryJitter float64
+	// Identifies the shoot Kapi pods, and the namespaces which contain shoot control planes
+	KapiSelector *gutil.KapiSelector
+	// Cache all seed secrets, except Helm release secrets, instead of only those whose 'name' label names a secret used
+	// by the application. For seeds where those secrets lack the label.
+	LegacySecretSelection bool
+	// The log levels of the components whose level differs from LogLevel, keyed by component name. See
+	// CLIOptions.ComponentLogLevels.
+	ComponentLogLevels map[string]int
+	// Upon startup, verify that the application has all K8s API permissions it requires
+	PermissionCheck bool
+	// The configuration of the direct (uncached) seed client, used by leader election, by the management of the service
+	// endpoints, and by shard membership. Differs from RESTConfig in its throttling and timeout settings.
+	DirectRESTConfig *rest.Config
+	// Make no changes to the seed cluster. Write requests are logged instead of being made.
+	DryRun bool
+	// If the seed informers deliver no events for this long, and the seed kube-apiserver is not reachable, restart the
+	// application. Zero disables the check.
+	InformerStallTimeout time.Duration
 }
 
 // Apply sets the values of this CLIConfig in the given manager.Options.
 func (c *CLIConfig) Apply(opts *manager.Options) {
 	c.ManagerConfig.Apply(opts)
 	opts.LeaderElectionReleaseOnCancel = true
+	opts.LeaderElectionConfig = c.DirectRESTConfig
+	if c.HAMode == HAModeOff || c.HAMode == HAModeSharded {
+		opts.LeaderElection = false
+	}
 
 	if c.Debug {
 		leaseDuration := time.Second * 600
@@ -141,28 +583,34 @@ func (c *CLIConfig) Apply(opts *manager.Options) {
 	}
 }
 
-// ManagerOptions initializes empty manager.Options, applies the set values and returns it.
-func (c *CLIConfig) ManagerOptions() manager.Options {
+// ManagerOptions initializes empty manager.Options, applies the set values and returns it. The manager's cache is
+// restricted to the Kapi pods, the pods selected by otherPods, and the secrets named by secretNames, so it does not
+// hold all pods and secrets in the seed. otherPods may be nil. See [gutil.KapiSelector.PodLabelSelectorWith].
+func (c *CLIConfig) ManagerOptions(secretNames []string, otherPods labels.Selector) manager.Options {
 	var opts manager.Options
 	c.Apply(&opts)
 
-	nameRequirement, err := labels.NewRequirement("name", selection.In, []string{"ca", "shoot-access-gardener-custom-metrics"})
-	runtime.Must(err)
-	secretsLabelSelector := labels.NewSelector().Add(*nameRequirement)
-
 	opts.Cache = cache.Options{
 		ByObject: map[client.Object]cache.ByObject{
-			&corev1.Secret{}: {
-				Label: secretsLabelSelector,
-			},
+			&corev1.Secret{}: c.secretCacheSelection(secretNames),
 			&corev1.Pod{}: {
-				Label: labels.SelectorFromSet(map[string]string{
-					"app":  "kubernetes",
-					"role": "apiserver",
-				}),
+				Label: c.KapiSelector.PodLabelSelectorWith(otherPods),
 			},
 		},
 	}
 
 	return opts
 }
+
+// secretCacheSelection returns the selection of the secrets held by the manager's cache: the secrets whose 'name'
+// label is one of secretNames. In legacy mode, the secrets are not labeled, and all secrets, except the typically
+// numerous and large Helm release secrets, are selected. The controllers then pick the relevant secrets by name.
+func (c *CLIConfig) secretCacheSelection(secretNames []string) cache.ByObject {
+	if c.LegacySecretSelection {
+		return cache.ByObject{Field: fields.OneTermNotEqualSelector("type", helmReleaseSecretType)}
+	}
+
+	nameRequirement, err := labels.NewRequirement("name", selection.In, secretNames)
+	runtime.Must(err)
+	return cache.ByObject{Label: labels.NewSelector().Add(*nameRequirement)}
+}
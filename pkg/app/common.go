@@ -19,3 +19,11 @@ const (
 	VerbosityVerbose = 75
 	VerbosityDebug   = 100
 )
+
+// Application components whose log level can be set separately from the log level of the application as a whole
+const (
+	// LogComponentScraper is the component which scrapes metrics from the shoot kube-apiservers
+	LogComponentScraper = "scraper"
+	// LogComponentControllers comprises the controllers which track shoot kube-apiserver pods and secrets
+	LogComponentControllers = "controllers"
+)
@@ -0,0 +1,392 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package conditions keeps track of the health of the application's components, in the form of conditions, similar to
+// the ones on K8s objects, so operators can see e.g. "SecretControllerDegraded: ..." instead of having to go through
+// the log.
+package conditions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+// DebugPath is the path, on the controller manager's metrics server, at which the conditions, along with any
+// additional diagnostic information registered via Registry.AddInfo, are exposed in JSON format
+const DebugPath = "/debug/conditions"
+
+// The share of the scopes of a scoped condition which must be failing, for the condition to become degraded. See
+// Registry.NewScopedReporter.
+const scopedDegradedRatio = 0.5
+
+// How long the errors of a scope are kept after the most recent one. A scope which is gone, e.g. a deleted shoot, stops
+// reporting, so its errors must not count forever. Scopes which keep failing are retried well within that time.
+const scopeErrorRetention = 30 * time.Minute
+
+// Condition describes the health of a single application component, at a point in time
+type Condition struct {
+	// The kind of condition, e.g. "SecretControllerDegraded"
+	Type string `json:"type"`
+	// True if the component is degraded, i.e. it has failed at least the configured number of consecutive times, or,
+	// for a scoped condition, enough of its scopes have
+	Status metav1.ConditionStatus `json:"status"`
+	// The most recent error, if the component has ever failed. Kept after the component recovers.
+	Message string `json:"message,omitempty"`
+	// When Status last changed. Zero if it never changed.
+	LastTransitionTime time.Time `json:"lastTransitionTime,omitempty"`
+	// When the most recent error occurred. Zero if the component has never failed.
+	LastErrorTime time.Time `json:"lastErrorTime,omitempty"`
+	// How many times the component failed since its last success. For a scoped condition, only counts the failures
+	// which pertain to no particular scope.
+	ConsecutiveErrorCount int `json:"consecutiveErrorCount"`
+	// Scoped conditions only: how many scopes have failed at least the configured number of consecutive times, and how
+	// many scopes there are, as of the last time the condition was read. See Registry.NewScopedReporter.
+	FailingScopeCount int `json:"failingScopeCount,omitempty"`
+	ScopeCount        int `json:"scopeCount,omitempty"`
+	// How many times the component failed since the application started
+	TotalErrorCount int64 `json:"totalErrorCount"`
+	// If true, the application's readiness check fails while the component is degraded
+	AffectsReadiness bool `json:"affectsReadiness"`
+}
+
+// Registry is an in-memory collection of conditions, updated by the respective components, via ComponentReporter
+// objects. All public operations are concurrency-safe.
+type Registry struct {
+	log logr.Logger
+
+	// Maps <condition type> -> <condition>. Values cannot be nil.
+	conditions map[string]*condition
+	// Maps <name> -> <function which returns the current diagnostic information of that name>. See AddInfo.
+	infoSources map[string]func() any
+	lock        sync.Mutex // Synchronises access to conditions and infoSources, and to the objects referenced by them
+
+	testIsolation testIsolation
+}
+
+// condition is the internal representation of a Condition
+type condition struct {
+	Condition
+	degradedThreshold int // The number of consecutive errors which make the component, or a scope, degraded
+
+	// Returns the number of scopes of a scoped condition. Nil if the condition is not scoped.
+	scopeCount func() int
+	// Maps <scope> -> <the errors of the scope since its last success>. Only used by scoped conditions.
+	scopeErrors map[string]*scopeErrors
+	// Whether enough of the scopes were failing, as of the last time the condition was read
+	isScopeDegraded bool
+}
+
+// scopeErrors holds the recent errors of a single scope of a scoped condition
+type scopeErrors struct {
+	consecutiveCount int
+	lastErrorTime    time.Time
+}
+
+// Enables redirecting some function calls for the purposes of test isolation
+type testIsolation struct {
+	// Points to time.Now
+	TimeNow func() time.Time
+}
+
+// NewRegistry creates a new, empty Registry
+func NewRegistry(parentLogger logr.Logger) *Registry {
+	return &Registry{
+		log:           parentLogger.WithName("conditions"),
+		conditions:    make(map[string]*condition),
+		infoSources:   make(map[string]func() any),
+		testIsolation: testIsolation{TimeNow: time.Now},
+	}
+}
+
+// NewReporter adds a condition of the specified type to the registry, and returns a ComponentReporter which the
+// respective component uses to update the condition. If a condition of that type already exists, it is reset.
+//
+// The condition becomes degraded after degradedThreshold consecutive errors, and recovers upon the next success. A
+// degradedThreshold lower than 1 is treated as 1.
+//
+// If affectsReadiness is true, the registry's readiness check fails while the condition is degraded.
+//
+// Returns nil if the registry is nil. A nil ComponentReporter is valid and ignores all reports.
+func (r *Registry) NewReporter(conditionType string, degradedThreshold int, affectsReadiness bool) *ComponentReporter {
+	return r.newReporter(conditionType, degradedThreshold, affectsReadiness, nil)
+}
+
+// NewScopedReporter is like NewReporter, but for a component whose operations each pertain to a scope, e.g. a shoot,
+// so that a few failing scopes do not make the whole component degraded. Errors reported via
+// ComponentReporter.ReportScopedError are counted per scope, and a scope is failing once it has degradedThreshold
+// consecutive errors. The condition is degraded while at least half of the scopes are failing. scopeCount returns the
+// total number of scopes. It is called whenever the condition is read, without holding the registry's lock, and must
+// be concurrency-safe.
+//
+// Errors reported via ComponentReporter.ReportError pertain to the component as a whole, and make the condition
+// degraded after degradedThreshold consecutive ones, as with NewReporter.
+func (r *Registry) NewScopedReporter(
+	conditionType string, degradedThreshold int, affectsReadiness bool, scopeCount func() int) *ComponentReporter {
+
+	return r.newReporter(conditionType, degradedThreshold, affectsReadiness, scopeCount)
+}
+
+// newReporter implements NewReporter and NewScopedReporter. scopeCount is nil for conditions which are not scoped.
+func (r *Registry) newReporter(
+	conditionType string, degradedThreshold int, affectsReadiness bool, scopeCount func() int) *ComponentReporter {
+
+	if r == nil {
+		return nil
+	}
+	if degradedThreshold < 1 {
+		degradedThreshold = 1
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	c := &condition{
+		Condition: Condition{
+			Type:             conditionType,
+			Status:           metav1.ConditionFalse,
+			AffectsReadiness: affectsReadiness,
+		},
+		degradedThreshold: degradedThreshold,
+		scopeCount:        scopeCount,
+	}
+	if scopeCount != nil {
+		c.scopeErrors = make(map[string]*scopeErrors)
+	}
+	r.conditions[conditionType] = c
+	return &ComponentReporter{registry: r, conditionType: conditionType}
+}
+
+// Conditions returns a copy of all conditions in the registry, ordered by type. Scoped conditions are evaluated anew.
+func (r *Registry) Conditions() []Condition {
+	// The scope counts are obtained without holding the lock, as the sources may take locks of their own
+	r.lock.Lock()
+	scopeCountSources := make(map[*condition]func() int)
+	for _, c := range r.conditions {
+		if c.scopeCount != nil {
+			scopeCountSources[c] = c.scopeCount
+		}
+	}
+	r.lock.Unlock()
+	scopeCounts := make(map[*condition]int, len(scopeCountSources))
+	for c, source := range scopeCountSources {
+		scopeCounts[c] = source()
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.testIsolation.TimeNow()
+	result := make([]Condition, 0, len(r.conditions))
+	for _, c := range r.conditions {
+		if scopeCount, ok := scopeCounts[c]; ok { // Skips conditions which were replaced in the meantime
+			r.evaluateScopesThreadUnsafe(c, scopeCount, now)
+		}
+		result = append(result, c.Condition)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Type < result[j].Type })
+
+	return result
+}
+
+// ReadyzCheck implements [sigs.k8s.io/controller-runtime/pkg/healthz.Checker]. It fails while any of the conditions
+// which affect readiness is degraded, and lists those conditions, along with their most recent error.
+func (r *Registry) ReadyzCheck(_ *http.Request) error {
+	var degraded []string
+	for _, c := range r.Conditions() {
+		if c.AffectsReadiness && c.Status == metav1.ConditionTrue {
+			degraded = append(degraded, fmt.Sprintf("%s: last error: %s", c.Type, c.Message))
+		}
+	}
+
+	if len(degraded) > 0 {
+		return fmt.Errorf("%s", strings.Join(degraded, "; "))
+	}
+	return nil
+}
+
+// AddInfo registers additional diagnostic information, which is exposed under the specified name, alongside the
+// conditions, e.g. the effective values of settings which are derived at runtime. The source function is called upon
+// each request to the debug endpoint, and its result must be JSON serializable. It must be concurrency-safe.
+// If information of that name already exists, it is replaced. Has no effect if the registry is nil.
+func (r *Registry) AddInfo(name string, source func() any) {
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.infoSources[name] = source
+}
+
+// debugResponse is the body of the responses served by Registry.ServeHTTP
+type debugResponse struct {
+	Conditions []Condition    `json:"conditions"`
+	Info       map[string]any `json:"info,omitempty"`
+}
+
+// ServeHTTP implements [http.Handler]. It responds with all conditions in the registry, ordered by type, and all
+// additional diagnostic information, in JSON format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	response := debugResponse{Conditions: r.Conditions()}
+	r.lock.Lock()
+	infoSources := make(map[string]func() any, len(r.infoSources))
+	for name, source := range r.infoSources {
+		infoSources[name] = source
+	}
+	r.lock.Unlock()
+	if len(infoSources) > 0 {
+		// Sources are called without holding the lock, as they may take locks of their own
+		response.Info = make(map[string]any, len(infoSources))
+		for name, source := range infoSources {
+			response.Info[name] = source()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		r.log.V(app.VerbosityError).Error(err, "Failed to write conditions response")
+	}
+}
+
+// Called by ComponentReporter. See ComponentReporter.ReportError and ComponentReporter.ReportScopedError. An empty
+// scope means that the error pertains to the component as a whole.
+func (r *Registry) reportError(conditionType string, scope string, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	c := r.conditions[conditionType]
+	now := r.testIsolation.TimeNow()
+	c.TotalErrorCount++
+	c.LastErrorTime = now
+	c.Message = err.Error()
+	if c.scopeCount != nil && scope != "" {
+		// The share of failing scopes is evaluated when the condition is read. See evaluateScopesThreadUnsafe.
+		errs := c.scopeErrors[scope]
+		if errs == nil {
+			errs = &scopeErrors{}
+			c.scopeErrors[scope] = errs
+		}
+		errs.consecutiveCount++
+		errs.lastErrorTime = now
+		return
+	}
+
+	c.ConsecutiveErrorCount++
+	r.updateStatusThreadUnsafe(c, now)
+}
+
+// Called by ComponentReporter. See ComponentReporter.ReportSuccess and ComponentReporter.ReportScopedSuccess. An empty
+// scope means that the success pertains to the component as a whole.
+func (r *Registry) reportSuccess(conditionType string, scope string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	c := r.conditions[conditionType]
+	if c.scopeCount != nil && scope != "" {
+		delete(c.scopeErrors, scope)
+		return
+	}
+
+	c.ConsecutiveErrorCount = 0
+	r.updateStatusThreadUnsafe(c, r.testIsolation.TimeNow())
+}
+
+// evaluateScopesThreadUnsafe determines whether enough of the scoped condition's scopes are failing, for the
+// condition to be degraded, and updates the condition's status accordingly. Drops the errors of the scopes which have
+// not reported an error for scopeErrorRetention. The number of scopes is taken to be at least the number of scopes
+// with errors on record, as scopeCount may lag behind.
+// The caller must hold the registry's lock.
+func (r *Registry) evaluateScopesThreadUnsafe(c *condition, scopeCount int, now time.Time) {
+	failingCount := 0
+	for scope, errs := range c.scopeErrors {
+		if now.Sub(errs.lastErrorTime) > scopeErrorRetention {
+			delete(c.scopeErrors, scope)
+			continue
+		}
+		if errs.consecutiveCount >= c.degradedThreshold {
+			failingCount++
+		}
+	}
+	c.FailingScopeCount = failingCount
+	c.ScopeCount = max(scopeCount, len(c.scopeErrors))
+	c.isScopeDegraded = failingCount > 0 && float64(failingCount) >= scopedDegradedRatio*float64(c.ScopeCount)
+	r.updateStatusThreadUnsafe(c, now)
+}
+
+// updateStatusThreadUnsafe sets the condition's status according to its error counts, and records the transition, if
+// the status changes.
+// The caller must hold the registry's lock.
+func (r *Registry) updateStatusThreadUnsafe(c *condition, now time.Time) {
+	isDegraded := c.ConsecutiveErrorCount >= c.degradedThreshold || c.isScopeDegraded
+	switch {
+	case isDegraded && c.Status != metav1.ConditionTrue:
+		c.Status = metav1.ConditionTrue
+		c.LastTransitionTime = now
+		r.log.V(app.VerbosityError).Error(errors.New(c.Message), "Component degraded",
+			"condition", c.Type,
+			"consecutiveErrors", c.ConsecutiveErrorCount,
+			"failingScopes", c.FailingScopeCount,
+			"scopes", c.ScopeCount)
+	case !isDegraded && c.Status == metav1.ConditionTrue:
+		c.Status = metav1.ConditionFalse
+		c.LastTransitionTime = now
+		r.log.V(app.VerbosityInfo).Info("Component recovered", "condition", c.Type)
+	}
+}
+
+// ComponentReporter updates a single condition in a Registry. Create instances via Registry.NewReporter.
+// A nil ComponentReporter is valid, and ignores all reports, so components can report unconditionally, regardless of
+// whether condition tracking is set up.
+type ComponentReporter struct {
+	registry      *Registry
+	conditionType string
+}
+
+// ReportError records a failure of the component as a whole. The error becomes the condition's message.
+func (rep *ComponentReporter) ReportError(err error) {
+	if rep == nil || err == nil {
+		return
+	}
+	rep.registry.reportError(rep.conditionType, "", err)
+}
+
+// ReportSuccess records a successful operation of the component as a whole, which resets its consecutive error count
+func (rep *ComponentReporter) ReportSuccess() {
+	if rep == nil {
+		return
+	}
+	rep.registry.reportSuccess(rep.conditionType, "")
+}
+
+// ReportScopedError records a failure of the component, which pertains to the specified scope, e.g. a shoot namespace.
+// The error becomes the condition's message. If the condition is not scoped, or the scope is empty, it is the same as
+// ReportError. See Registry.NewScopedReporter.
+func (rep *ComponentReporter) ReportScopedError(scope string, err error) {
+	if rep == nil || err == nil {
+		return
+	}
+	rep.registry.reportError(rep.conditionType, scope, err)
+}
+
+// ReportScopedSuccess records a successful operation of the component, which pertains to the specified scope, and
+// resets the scope's consecutive error count. If the condition is not scoped, or the scope is empty, it is the same as
+// ReportSuccess.
+func (rep *ComponentReporter) ReportScopedSuccess(scope string) {
+	if rep == nil {
+		return
+	}
+	rep.registry.reportSuccess(rep.conditionType, scope)
+}
@@ -0,0 +1,279 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package conditions
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("conditions.Registry", func() {
+	const testConditionType = "TestControllerDegraded"
+
+	var (
+		testTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		newTestRegistry = func() *Registry {
+			registry := NewRegistry(logr.Discard())
+			registry.testIsolation.TimeNow = func() time.Time { return testTime }
+			return registry
+		}
+	)
+
+	Describe("NewReporter", func() {
+		It("should add a condition which is not degraded", func() {
+			// Arrange
+			registry := newTestRegistry()
+
+			// Act
+			registry.NewReporter(testConditionType, 2, true)
+
+			// Assert
+			Expect(registry.Conditions()).To(Equal([]Condition{{
+				Type:             testConditionType,
+				Status:           metav1.ConditionFalse,
+				AffectsReadiness: true,
+			}}))
+		})
+		It("should return a nil reporter which ignores reports, if the registry is nil", func() {
+			// Arrange
+			var registry *Registry
+
+			// Act
+			reporter := registry.NewReporter(testConditionType, 2, true)
+
+			// Assert
+			Expect(reporter).To(BeNil())
+			reporter.ReportError(errors.New("test"))
+			reporter.ReportSuccess()
+		})
+	})
+
+	Describe("ComponentReporter", func() {
+		It("should mark the condition as degraded only once the threshold of consecutive errors is reached", func() {
+			// Arrange
+			registry := newTestRegistry()
+			reporter := registry.NewReporter(testConditionType, 2, true)
+
+			// Act
+			reporter.ReportError(errors.New("first"))
+			afterFirst := registry.Conditions()[0]
+			reporter.ReportError(errors.New("second"))
+			afterSecond := registry.Conditions()[0]
+
+			// Assert
+			Expect(afterFirst.Status).To(Equal(metav1.ConditionFalse))
+			Expect(afterFirst.Message).To(Equal("first"))
+			Expect(afterFirst.ConsecutiveErrorCount).To(Equal(1))
+			Expect(afterSecond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(afterSecond.Message).To(Equal("second"))
+			Expect(afterSecond.ConsecutiveErrorCount).To(Equal(2))
+			Expect(afterSecond.TotalErrorCount).To(Equal(int64(2)))
+			Expect(afterSecond.LastErrorTime).To(Equal(testTime))
+			Expect(afterSecond.LastTransitionTime).To(Equal(testTime))
+		})
+		It("should reset the consecutive error count and recover the condition upon success, but keep the totals", func() {
+			// Arrange
+			registry := newTestRegistry()
+			reporter := registry.NewReporter(testConditionType, 1, true)
+			reporter.ReportError(errors.New("test"))
+			registry.testIsolation.TimeNow = func() time.Time { return testTime.Add(time.Minute) }
+
+			// Act
+			reporter.ReportSuccess()
+
+			// Assert
+			condition := registry.Conditions()[0]
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.ConsecutiveErrorCount).To(BeZero())
+			Expect(condition.TotalErrorCount).To(Equal(int64(1)))
+			Expect(condition.Message).To(Equal("test"))
+			Expect(condition.LastTransitionTime).To(Equal(testTime.Add(time.Minute)))
+		})
+	})
+
+	Describe("scoped ComponentReporter", func() {
+		It("should not mark the condition as degraded, while less than half of the scopes are failing", func() {
+			// Arrange
+			registry := newTestRegistry()
+			reporter := registry.NewScopedReporter(testConditionType, 2, true, func() int { return 3 })
+
+			// Act
+			for i := 0; i < 10; i++ {
+				reporter.ReportScopedError("shoot--a", errors.New("test"))
+				reporter.ReportScopedSuccess("shoot--b")
+			}
+
+			// Assert
+			condition := registry.Conditions()[0]
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.FailingScopeCount).To(Equal(1))
+			Expect(condition.ScopeCount).To(Equal(3))
+			Expect(condition.TotalErrorCount).To(Equal(int64(10)))
+			Expect(registry.ReadyzCheck(nil)).To(Succeed())
+		})
+
+		It("should mark the condition as degraded, once half of the scopes are failing, and recover after that", func() {
+			// Arrange
+			registry := newTestRegistry()
+			reporter := registry.NewScopedReporter(testConditionType, 2, true, func() int { return 4 })
+			for _, scope := range []string{"shoot--a", "shoot--b"} {
+				reporter.ReportScopedError(scope, errors.New("test"))
+			}
+			Expect(registry.Conditions()[0].Status).To(Equal(metav1.ConditionFalse))
+
+			// Act
+			for _, scope := range []string{"shoot--a", "shoot--b"} {
+				reporter.ReportScopedError(scope, errors.New("test"))
+			}
+			degraded := registry.Conditions()[0]
+			reporter.ReportScopedSuccess("shoot--a")
+			recovered := registry.Conditions()[0]
+
+			// Assert
+			Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+			Expect(degraded.FailingScopeCount).To(Equal(2))
+			Expect(recovered.Status).To(Equal(metav1.ConditionFalse))
+			Expect(recovered.FailingScopeCount).To(Equal(1))
+		})
+
+		It("should count at least the scopes with errors on record, if the scope count lags behind", func() {
+			// Arrange
+			registry := newTestRegistry()
+			reporter := registry.NewScopedReporter(testConditionType, 1, true, func() int { return 0 })
+
+			// Act
+			reporter.ReportScopedError("shoot--a", errors.New("test"))
+
+			// Assert
+			condition := registry.Conditions()[0]
+			Expect(condition.ScopeCount).To(Equal(1))
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should drop the errors of a scope which stopped reporting", func() {
+			// Arrange
+			registry := newTestRegistry()
+			reporter := registry.NewScopedReporter(testConditionType, 1, true, func() int { return 1 })
+			reporter.ReportScopedError("shoot--a", errors.New("test"))
+			Expect(registry.Conditions()[0].Status).To(Equal(metav1.ConditionTrue))
+
+			// Act
+			registry.testIsolation.TimeNow = func() time.Time { return testTime.Add(scopeErrorRetention + time.Second) }
+			condition := registry.Conditions()[0]
+
+			// Assert
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.FailingScopeCount).To(BeZero())
+		})
+
+		It("should count the errors which pertain to no scope towards the component as a whole", func() {
+			// Arrange
+			registry := newTestRegistry()
+			reporter := registry.NewScopedReporter(testConditionType, 2, true, func() int { return 10 })
+
+			// Act
+			reporter.ReportError(errors.New("test"))
+			reporter.ReportScopedError("", errors.New("test"))
+
+			// Assert
+			condition := registry.Conditions()[0]
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.ConsecutiveErrorCount).To(Equal(2))
+			Expect(condition.FailingScopeCount).To(BeZero())
+		})
+
+		It("should treat scoped reports as unscoped ones, if the condition is not scoped", func() {
+			// Arrange
+			registry := newTestRegistry()
+			reporter := registry.NewReporter(testConditionType, 2, true)
+
+			// Act
+			reporter.ReportScopedError("shoot--a", errors.New("test"))
+			reporter.ReportScopedError("shoot--b", errors.New("test"))
+
+			// Assert
+			condition := registry.Conditions()[0]
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.ConsecutiveErrorCount).To(Equal(2))
+		})
+	})
+
+	Describe("ReadyzCheck", func() {
+		It("should fail while a condition which affects readiness is degraded, and name the condition", func() {
+			// Arrange
+			registry := newTestRegistry()
+			registry.NewReporter(testConditionType, 1, true).ReportError(errors.New("boom"))
+			registry.NewReporter("OtherDegraded", 1, true)
+
+			// Act
+			err := registry.ReadyzCheck(nil)
+
+			// Assert
+			Expect(err).To(MatchError(testConditionType + ": last error: boom"))
+		})
+		It("should succeed if only conditions which do not affect readiness are degraded", func() {
+			// Arrange
+			registry := newTestRegistry()
+			registry.NewReporter(testConditionType, 1, false).ReportError(errors.New("boom"))
+
+			// Act
+			err := registry.ReadyzCheck(nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+		})
+	})
+
+	Describe("ServeHTTP", func() {
+		It("should respond with all conditions, in JSON format, ordered by type", func() {
+			// Arrange
+			registry := newTestRegistry()
+			registry.NewReporter("B", 1, false).ReportError(errors.New("boom"))
+			registry.NewReporter("A", 1, true)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, DebugPath, nil))
+
+			// Assert
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+			var result debugResponse
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &result)).To(Succeed())
+			Expect(result.Conditions).To(HaveLen(2))
+			Expect(result.Conditions[0].Type).To(Equal("A"))
+			Expect(result.Conditions[1].Type).To(Equal("B"))
+			Expect(result.Conditions[1].Status).To(Equal(metav1.ConditionTrue))
+			Expect(result.Conditions[1].Message).To(Equal("boom"))
+			Expect(result.Info).To(BeEmpty())
+		})
+
+		It("should include the current value of each registered info source", func() {
+			// Arrange
+			registry := newTestRegistry()
+			value := "old"
+			registry.AddInfo("settings", func() any { return map[string]string{"value": value} })
+			value = "new"
+			recorder := httptest.NewRecorder()
+
+			// Act
+			registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, DebugPath, nil))
+
+			// Assert
+			var result debugResponse
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &result)).To(Succeed())
+			Expect(result.Info).To(HaveKeyWithValue("settings", map[string]any{"value": "new"}))
+		})
+	})
+})
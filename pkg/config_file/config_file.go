@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package config_file supports specifying the application's configuration in a YAML file, as an alternative to
+// command line flags.
+//
+// The file is a YAML map, the keys of which are the names of command line flags, without the leading dashes. Values
+// have the same meaning as the respective flag value. Lists and maps are accepted for flags which take
+// comma-separated values, e.g.:
+//
+//	scrape-period: 30s
+//	namespace-exclude:
+//	  - shoot--garden-*
+//	metric-static-labels:
+//	  seed: my-seed
+//
+// A flag specified on the command line takes precedence over the same setting in the file.
+package config_file
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+// FlagName is the name of the command line flag which specifies the path to the config file
+const FlagName = "config"
+
+// Settings maps flag names to flag values, in the textual form in which they would appear on the command line
+type Settings map[string]string
+
+// Read reads and parses the config file at the specified path
+func Read(path string) (Settings, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	return Parse(content)
+}
+
+// Parse parses the content of a config file
+func Parse(content []byte) (Settings, error) {
+	jsonContent, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+
+	var document map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonContent))
+	decoder.UseNumber() // Preserve the textual form of numbers, e.g. avoid turning 1000000 into 1e+06
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("parsing config file: the file must contain a YAML map: %w", err)
+	}
+
+	result := make(Settings, len(document))
+	for name, value := range document {
+		text, err := formatValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing config file: setting '%s': %w", name, err)
+		}
+		result[name] = text
+	}
+	return result, nil
+}
+
+// Apply sets the flags in the specified flag set to the values in the Settings. Flags which were already set (e.g.
+// on the command line) retain their values. Returns an error if a setting does not correspond to a known flag, or if
+// its value is not valid for that flag.
+func (s Settings) Apply(flags *pflag.FlagSet) error {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Deterministic error reporting
+
+	for _, name := range names {
+		if name == FlagName {
+			return fmt.Errorf("config file: setting '%s' is not allowed in the config file", name)
+		}
+		flag := flags.Lookup(name)
+		if flag == nil {
+			return fmt.Errorf("config file: unknown setting '%s'", name)
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := flags.Set(name, s[name]); err != nil {
+			return fmt.Errorf("config file: invalid value for setting '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// formatValue converts a parsed YAML value to the textual form which the respective command line flag would accept
+func formatValue(value interface{}) (string, error) {
+	switch typedValue := value.(type) {
+	case string:
+		return typedValue, nil
+	case json.Number:
+		return typedValue.String(), nil
+	case bool:
+		return fmt.Sprint(typedValue), nil
+	case []interface{}:
+		items := make([]string, 0, len(typedValue))
+		for _, item := range typedValue {
+			text, err := formatScalar(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		items := make([]string, 0, len(typedValue))
+		for key, item := range typedValue {
+			text, err := formatScalar(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, key+"="+text)
+		}
+		sort.Strings(items)
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value '%v'", value)
+	}
+}
+
+// formatScalar is like formatValue, but only accepts scalar values
+func formatScalar(value interface{}) (string, error) {
+	switch value.(type) {
+	case []interface{}, map[string]interface{}:
+		return "", fmt.Errorf("nested lists and maps are not supported")
+	}
+	return formatValue(value)
+}
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config_file
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+)
+
+var _ = Describe("config_file", func() {
+	Describe("Parse", func() {
+		It("should convert scalars, lists and maps to their command line form", func() {
+			// Arrange
+			content := []byte(`
+scrape-period: 30s
+qps: 1000000
+debug: true
+namespace-exclude:
+  - shoot--garden-*
+  - shoot--test-*
+metric-static-labels:
+  seed: my-seed
+  region: eu
+`)
+
+			// Act
+			settings, err := Parse(content)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(settings).To(Equal(Settings{
+				"scrape-period":        "30s",
+				"qps":                  "1000000",
+				"debug":                "true",
+				"namespace-exclude":    "shoot--garden-*,shoot--test-*",
+				"metric-static-labels": "region=eu,seed=my-seed",
+			}))
+		})
+
+		It("should fail if the content is not a YAML map", func() {
+			// Act
+			_, err := Parse([]byte("- a\n- b\n"))
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail on nested lists", func() {
+			// Act
+			_, err := Parse([]byte("namespace-exclude:\n  - [a, b]\n"))
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("namespace-exclude"))
+		})
+	})
+
+	Describe("Read", func() {
+		It("should parse the file at the specified path", func() {
+			// Arrange
+			path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+			Expect(os.WriteFile(path, []byte("log-level: 3\n"), 0600)).To(Succeed())
+
+			// Act
+			settings, err := Read(path)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(settings).To(Equal(Settings{"log-level": "3"}))
+		})
+
+		It("should fail if the file does not exist", func() {
+			// Act
+			_, err := Read(filepath.Join(GinkgoT().TempDir(), "missing.yaml"))
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Settings.Apply", func() {
+		var (
+			newFlagSet = func() (*pflag.FlagSet, *time.Duration, *[]string) {
+				flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+				period := flags.Duration("scrape-period", time.Minute, "")
+				exclude := flags.StringSlice("namespace-exclude", []string{"default"}, "")
+				flags.String(FlagName, "", "")
+				return flags, period, exclude
+			}
+		)
+
+		It("should set the flags which are not set on the command line", func() {
+			// Arrange
+			flags, period, exclude := newFlagSet()
+			Expect(flags.Parse([]string{"--scrape-period=2m"})).To(Succeed())
+
+			// Act
+			err := Settings{"scrape-period": "30s", "namespace-exclude": "a,b"}.Apply(flags)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(*period).To(Equal(2 * time.Minute))
+			Expect(*exclude).To(Equal([]string{"a", "b"}))
+		})
+
+		It("should fail on unknown settings", func() {
+			// Arrange
+			flags, _, _ := newFlagSet()
+
+			// Act
+			err := Settings{"no-such-flag": "1"}.Apply(flags)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("no-such-flag"))
+		})
+
+		It("should fail on invalid values", func() {
+			// Arrange
+			flags, _, _ := newFlagSet()
+
+			// Act
+			err := Settings{"scrape-period": "soon"}.Apply(flags)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("scrape-period"))
+		})
+
+		It("should not allow the config file to point to another config file", func() {
+			// Arrange
+			flags, _, _ := newFlagSet()
+
+			// Act
+			err := Settings{FlagName: "other.yaml"}.Apply(flags)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config_file
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+// DefaultWatchPeriod is the recommended period at which a Watcher checks the config file for changes
+const DefaultWatchPeriod = 10 * time.Second
+
+// Watcher periodically checks a config file for changes, and reports the new settings when the file content changes.
+//
+// The file is polled, rather than watched for file system events, so changes are detected reliably, even when the
+// file is replaced via a symbolic link swap, as is the case with files projected from a K8s ConfigMap.
+//
+// Watcher implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable].
+type Watcher struct {
+	path     string
+	period   time.Duration
+	onChange func(settings Settings)
+	log      logr.Logger
+
+	// The file content at the time of the last check. Only accessed by the watcher goroutine.
+	lastContent []byte
+
+	testIsolation watcherTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// NewWatcher creates a Watcher which checks the file at the specified path once per period, and calls onChange with
+// the new settings each time the file content changes. Changes are detected relative to the file content at the time
+// of the call.
+func NewWatcher(
+	path string, period time.Duration, onChange func(settings Settings), parentLogger logr.Logger) *Watcher {
+
+	content, _ := os.ReadFile(path)
+	return &Watcher{
+		path:        path,
+		period:      period,
+		onChange:    onChange,
+		log:         parentLogger.WithName("config-watcher"),
+		lastContent: content,
+		testIsolation: watcherTestIsolation{
+			TimeAfter: time.After,
+			ReadFile:  os.ReadFile,
+		},
+	}
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It checks the file once per period,
+// until the context is cancelled.
+func (w *Watcher) Start(ctx context.Context) error {
+	log := w.log.WithValues("op", "configWatcherProc")
+	log.V(app.VerbosityVerbose).Info("Config file watcher started", "path", w.path, "period", w.period)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.V(app.VerbosityInfo).Info("Context closed, exiting")
+			return nil
+		case <-w.testIsolation.TimeAfter(w.period):
+			w.check()
+		}
+	}
+}
+
+// NeedLeaderElection implements [sigs.k8s.io/controller-runtime/pkg/manager.LeaderElectionRunnable]. Settings are
+// reloaded by all replicas, not just the leader.
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// check reads the file and calls onChange, if the content changed since the last check. Invalid content is logged,
+// and not reported to onChange.
+func (w *Watcher) check() {
+	content, err := w.testIsolation.ReadFile(w.path)
+	if err != nil {
+		w.log.V(app.VerbosityError).Error(err, "Failed to read config file", "path", w.path)
+		return
+	}
+	if bytes.Equal(content, w.lastContent) {
+		return
+	}
+	w.lastContent = content
+
+	settings, err := Parse(content)
+	if err != nil {
+		w.log.V(app.VerbosityError).Error(err, "Ignoring changed config file, which is not valid", "path", w.path)
+		return
+	}
+	w.log.V(app.VerbosityInfo).Info("Config file changed, reloading settings", "path", w.path)
+	w.onChange(settings)
+}
+
+//#region Test isolation
+
+// watcherTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the Watcher unit during tests
+type watcherTestIsolation struct {
+	// Points to [time.After]
+	TimeAfter func(time.Duration) <-chan time.Time
+	// Points to [os.ReadFile]
+	ReadFile func(name string) ([]byte, error)
+}
+
+//#endregion Test isolation
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config_file
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("config_file.Watcher", func() {
+	var (
+		// Creates a watcher for which the file content is whatever *content points to at the time of the check
+		newTestWatcher = func(initialContent string) (*Watcher, *string, *[]Settings) {
+			content := initialContent
+			var reported []Settings
+			watcher := NewWatcher("config.yaml", time.Minute, func(settings Settings) {
+				reported = append(reported, settings)
+			}, logr.Discard())
+			watcher.lastContent = []byte(initialContent)
+			watcher.testIsolation.ReadFile = func(string) ([]byte, error) { return []byte(content), nil }
+			return watcher, &content, &reported
+		}
+	)
+
+	Describe("check", func() {
+		It("should not report anything if the file did not change", func() {
+			// Arrange
+			watcher, _, reported := newTestWatcher("log-level: 1\n")
+
+			// Act
+			watcher.check()
+
+			// Assert
+			Expect(*reported).To(BeEmpty())
+		})
+
+		It("should report the new settings once, when the file changes", func() {
+			// Arrange
+			watcher, content, reported := newTestWatcher("log-level: 1\n")
+			*content = "log-level: 2\n"
+
+			// Act
+			watcher.check()
+			watcher.check()
+
+			// Assert
+			Expect(*reported).To(Equal([]Settings{{"log-level": "2"}}))
+		})
+
+		It("should not report invalid content", func() {
+			// Arrange
+			watcher, content, reported := newTestWatcher("log-level: 1\n")
+			*content = "- not a map\n"
+
+			// Act
+			watcher.check()
+
+			// Assert
+			Expect(*reported).To(BeEmpty())
+		})
+	})
+
+	Describe("Start", func() {
+		It("should check the file when the period elapses, and exit when the context is cancelled", func() {
+			// Arrange
+			watcher, content, reported := newTestWatcher("log-level: 1\n")
+			*content = "log-level: 2\n"
+			timeChannel := make(chan time.Time)
+			watcher.testIsolation.TimeAfter = func(time.Duration) <-chan time.Time { return timeChannel }
+			ctx, cancel := context.WithCancel(context.Background())
+			exited := make(chan struct{})
+
+			// Act
+			go func() {
+				defer close(exited)
+				Expect(watcher.Start(ctx)).To(Succeed())
+			}()
+			timeChannel <- time.Now()
+			timeChannel <- time.Now() // Blocks until the first check completes
+
+			// Assert
+			Expect(*reported).To(HaveLen(1))
+			cancel()
+			Eventually(exited).Should(BeClosed())
+		})
+	})
+
+	Describe("NeedLeaderElection", func() {
+		It("should return false", func() {
+			Expect((&Watcher{}).NeedLeaderElection()).To(BeFalse())
+		})
+	})
+})
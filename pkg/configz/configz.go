@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package configz exposes the effective configuration of a running application instance, i.e. the completed
+// configuration of each component, including defaults and values derived at startup, so operators can see what was
+// actually applied, rather than reconstructing it from command line, config file and defaults.
+package configz
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Path is the path, on the controller manager's metrics server, at which the effective configuration is exposed in
+// YAML format
+const Path = "/debug/configz"
+
+// RedactedValue replaces the values of secret fields in the rendered configuration
+const RedactedValue = "<redacted>"
+
+// The names of struct fields whose values are secret, and are therefore replaced by RedactedValue when rendered. The
+// list covers the credentials which can be embedded in a [k8s.io/client-go/rest.Config]. Paths to files containing
+// secrets are not themselves secret, and are rendered as is.
+var redactedFieldNames = map[string]bool{
+	"BearerToken":  true,
+	"Password":     true,
+	"KeyData":      true,
+	"AuthProvider": true, // May contain tokens
+	"ExecProvider": true, // May contain secrets in its environment
+}
+
+// The maximum depth to which nested values are rendered. A guard against reference cycles.
+const maxDepth = 16
+
+// Registry holds the effective configuration of the application's components, each one under its own name, and
+// serves it via HTTP. All public operations are concurrency-safe.
+type Registry struct {
+	// Maps <component name> -> <completed configuration of the component>
+	configs map[string]any
+	lock    sync.Mutex
+}
+
+// NewRegistry creates a new, empty Registry
+func NewRegistry() *Registry {
+	return &Registry{configs: make(map[string]any)}
+}
+
+// Set records the specified configuration as the one in effect for the named component, replacing any configuration
+// previously recorded under that name. The configuration is rendered upon each request to the endpoint, so config
+// must not be modified after the call - components which change their configuration at runtime call Set again with
+// the new configuration. Has no effect if the registry is nil.
+func (r *Registry) Set(name string, config any) {
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.configs[name] = config
+}
+
+// Render returns the configuration of all components, keyed by component name, in YAML format. Secret values are
+// redacted, and fields which have no meaningful textual representation, e.g. functions, are omitted.
+func (r *Registry) Render() ([]byte, error) {
+	r.lock.Lock()
+	rendered := make(map[string]any, len(r.configs))
+	for name, config := range r.configs {
+		if value, ok := renderValue(reflect.ValueOf(config), 0); ok {
+			rendered[name] = value
+		}
+	}
+	r.lock.Unlock()
+
+	return yaml.Marshal(rendered)
+}
+
+// ServeHTTP implements [http.Handler]. It responds with the configuration of all components, in YAML format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	body, err := r.Render()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("rendering the configuration: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(body)
+}
+
+// renderValue converts the specified value to a tree of maps, slices and scalars, which is suitable for YAML
+// serialization. Returns ok=false if the value should be omitted.
+func renderValue(value reflect.Value, depth int) (result any, ok bool) {
+	if !value.IsValid() {
+		return nil, true
+	}
+	if depth > maxDepth {
+		return nil, false
+	}
+
+	switch value.Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil, false
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil, true
+		}
+	}
+
+	// Types like time.Duration, labels.Selector, and *regexp.Regexp are best represented by their textual form. Structs
+	// with exported fields are rendered field by field instead, as their String method is typically a debug dump.
+	if stringer, ok := value.Interface().(fmt.Stringer); ok && !hasExportedFields(value) {
+		return stringer.String(), true
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return renderValue(value.Elem(), depth+1)
+	case reflect.Struct:
+		if !hasExportedFields(value) {
+			return nil, false
+		}
+		return renderStruct(value, depth)
+	case reflect.Map:
+		return renderMap(value, depth)
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			// Binary data, e.g. certificates. Not meaningful in a configuration summary.
+			return fmt.Sprintf("<%d bytes>", value.Len()), true
+		}
+		items := make([]any, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			if item, ok := renderValue(value.Index(i), depth+1); ok {
+				items = append(items, item)
+			}
+		}
+		return items, true
+	default:
+		return value.Interface(), true
+	}
+}
+
+// renderStruct renders the exported fields of the specified struct value, keyed by field name. The fields of embedded
+// structs are promoted to the outer struct, the same way they are accessed in code.
+func renderStruct(value reflect.Value, depth int) (map[string]any, bool) {
+	result := make(map[string]any)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if redactedFieldNames[field.Name] {
+			if !value.Field(i).IsZero() {
+				result[field.Name] = RedactedValue
+			}
+			continue
+		}
+
+		rendered, ok := renderValue(value.Field(i), depth+1)
+		if !ok {
+			continue
+		}
+		if embedded, isMap := rendered.(map[string]any); isMap && field.Anonymous {
+			for key, item := range embedded {
+				result[key] = item
+			}
+			continue
+		}
+		result[field.Name] = rendered
+	}
+
+	return result, true
+}
+
+// renderMap renders the specified map value, with its keys in textual form
+func renderMap(value reflect.Value, depth int) (map[string]any, bool) {
+	if value.IsNil() {
+		return nil, true
+	}
+
+	result := make(map[string]any, value.Len())
+	for _, key := range value.MapKeys() {
+		if item, ok := renderValue(value.MapIndex(key), depth+1); ok {
+			result[fmt.Sprint(key)] = item
+		}
+	}
+
+	return result, true
+}
+
+// hasExportedFields returns true if the specified value, or the value it points to, is a struct with at least one
+// exported field
+func hasExportedFields(value reflect.Value) bool {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return false
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return false
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		if value.Type().Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package configz
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = Describe("configz.Registry", func() {
+	type EmbeddedConfig struct {
+		Embedded string
+	}
+	type testConfig struct {
+		EmbeddedConfig
+		Period    time.Duration
+		Selector  labels.Selector
+		Pattern   *regexp.Regexp
+		Labels    map[string]string
+		Nested    *testConfig
+		Callback  func()
+		Password  string
+		REST      *rest.Config
+		unexposed string
+	}
+
+	var (
+		// Renders the registry's configuration and parses it back into a generic tree
+		render = func(registry *Registry) map[string]any {
+			body, err := registry.Render()
+			Expect(err).To(Succeed())
+			var result map[string]any
+			Expect(yaml.Unmarshal(body, &result)).To(Succeed())
+			return result
+		}
+	)
+
+	Describe("Render", func() {
+		It("should render the configuration of each component under its name", func() {
+			// Arrange
+			registry := NewRegistry()
+			selector, err := labels.Parse("app=kubernetes")
+			Expect(err).To(Succeed())
+			registry.Set("a", &testConfig{
+				EmbeddedConfig: EmbeddedConfig{Embedded: "promoted"},
+				Period:         time.Minute,
+				Selector:       selector,
+				Pattern:        regexp.MustCompile("^shoot--"),
+				Labels:         map[string]string{"seed": "my-seed"},
+				Nested:         &testConfig{Period: time.Second},
+				Callback:       func() {},
+				unexposed:      "x",
+			})
+			registry.Set("b", 5)
+
+			// Act
+			result := render(registry)
+
+			// Assert
+			Expect(result).To(HaveKeyWithValue("b", float64(5)))
+			Expect(result).To(HaveKey("a"))
+			a := result["a"].(map[string]any)
+			Expect(a).To(HaveKeyWithValue("Embedded", "promoted"))
+			Expect(a).To(HaveKeyWithValue("Period", "1m0s"))
+			Expect(a).To(HaveKeyWithValue("Selector", "app=kubernetes"))
+			Expect(a).To(HaveKeyWithValue("Pattern", "^shoot--"))
+			Expect(a).To(HaveKeyWithValue("Labels", map[string]any{"seed": "my-seed"}))
+			Expect(a["Nested"]).To(HaveKeyWithValue("Period", "1s"))
+			Expect(a).NotTo(HaveKey("Callback"))
+			Expect(a).NotTo(HaveKey("unexposed"))
+		})
+
+		It("should redact secret values, including the credentials in a rest.Config", func() {
+			// Arrange
+			registry := NewRegistry()
+			registry.Set("a", &testConfig{
+				Password: "secret1",
+				REST: &rest.Config{
+					Host:            "https://seed",
+					BearerToken:     "secret2",
+					TLSClientConfig: rest.TLSClientConfig{KeyData: []byte("secret3"), CAData: []byte("ca")},
+				},
+			})
+
+			// Act
+			body, err := registry.Render()
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(string(body)).NotTo(ContainSubstring("secret"))
+			var result map[string]any
+			Expect(yaml.Unmarshal(body, &result)).To(Succeed())
+			a := result["a"].(map[string]any)
+			Expect(a).To(HaveKeyWithValue("Password", RedactedValue))
+			restConfig := a["REST"].(map[string]any)
+			Expect(restConfig).To(HaveKeyWithValue("Host", "https://seed"))
+			Expect(restConfig).To(HaveKeyWithValue("BearerToken", RedactedValue))
+			// The fields of the embedded TLSClientConfig are promoted
+			Expect(restConfig).To(HaveKeyWithValue("KeyData", RedactedValue))
+			Expect(restConfig).To(HaveKeyWithValue("CAData", "<2 bytes>"))
+		})
+
+		It("should not mark empty secret fields as redacted", func() {
+			// Arrange
+			registry := NewRegistry()
+			registry.Set("a", &testConfig{})
+
+			// Act
+			result := render(registry)
+
+			// Assert
+			Expect(result["a"]).NotTo(HaveKey("Password"))
+		})
+	})
+
+	Describe("Set", func() {
+		It("should replace the configuration previously recorded under the same name", func() {
+			// Arrange
+			registry := NewRegistry()
+			registry.Set("a", &testConfig{Period: time.Minute})
+
+			// Act
+			registry.Set("a", &testConfig{Period: time.Hour})
+
+			// Assert
+			Expect(render(registry)["a"]).To(HaveKeyWithValue("Period", "1h0m0s"))
+		})
+
+		It("should have no effect, if the registry is nil", func() {
+			// Arrange
+			var registry *Registry
+
+			// Act and assert
+			registry.Set("a", &testConfig{})
+		})
+	})
+
+	Describe("ServeHTTP", func() {
+		It("should respond with the configuration, in YAML format", func() {
+			// Arrange
+			registry := NewRegistry()
+			registry.Set("a", &testConfig{Period: time.Minute})
+			recorder := httptest.NewRecorder()
+
+			// Act
+			registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, Path, nil))
+
+			// Assert
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/yaml"))
+			Expect(recorder.Body.String()).To(ContainSubstring("Period: 1m0s"))
+		})
+	})
+})
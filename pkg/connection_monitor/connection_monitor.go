@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package connection_monitor detects a stalled connection between the controller manager's informers and the seed
+// kube-apiserver. When the seed kube-apiserver endpoint changes (e.g. during control plane migration), long-running
+// watches may hang silently, instead of failing, and the cached state of the seed goes stale without any errors.
+package connection_monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+const (
+	// How many times per stall timeout do we check for a stall
+	checksPerStallTimeout = 4
+	// After this many consecutive failed pings, while the informers are stalled, the connection is considered broken
+	pingFailureThreshold = 3
+)
+
+// ErrConnectionStalled is returned by [ConnectionMonitor.Start], when it finds the connection to the seed
+// kube-apiserver stalled
+var ErrConnectionStalled = errors.New("the connection to the seed kube-apiserver is stalled")
+
+// InformerSource provides the informers of a controller manager's cache.
+// [sigs.k8s.io/controller-runtime/pkg/cache.Cache] implements it.
+type InformerSource interface {
+	GetInformer(ctx context.Context, obj client.Object, opts ...cache.InformerGetOption) (cache.Informer, error)
+}
+
+// ConnectionMonitor watches the events delivered by a set of informers. If none of them delivers an event for longer
+// than the stall timeout, it pings the seed kube-apiserver over a separate connection. If the ping fails
+// pingFailureThreshold times in a row, while the informers remain silent, the monitor considers the connection
+// stalled, and exits with [ErrConnectionStalled]. That stops the controller manager, which results in a controlled
+// restart of the application, with fresh connections and a full resync of the cache.
+//
+// Silent informers alone are not a sign of trouble - a small seed may go without changes to the watched objects for
+// a long time. Neither is a failing ping alone - the informers may still be receiving events over their existing
+// connections.
+//
+// ConnectionMonitor implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable]. It requires leader election,
+// because the informers of the watched objects only start along with the controllers which use them.
+type ConnectionMonitor struct {
+	informers    InformerSource
+	objects      []client.Object
+	ping         func(ctx context.Context) error
+	stallTimeout time.Duration
+	log          logr.Logger
+
+	lock          sync.Mutex
+	lastEventTime time.Time // The time of the most recent informer event. Protected by lock.
+
+	testIsolation monitorTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// NewConnectionMonitor creates a ConnectionMonitor which watches the informers, obtained from the specified source,
+// for the specified object types. The object types should be ones which the application already watches, otherwise
+// the monitor causes additional informers to be created.
+//
+// ping sends a request to the seed kube-apiserver, over a connection different from the one used by the informers, and
+// fails if the server cannot be reached. stallTimeout is how long the informers may go without events, before the
+// monitor pings the server.
+func NewConnectionMonitor(
+	informers InformerSource,
+	objects []client.Object,
+	ping func(ctx context.Context) error,
+	stallTimeout time.Duration,
+	parentLogger logr.Logger) *ConnectionMonitor {
+
+	return &ConnectionMonitor{
+		informers:     informers,
+		objects:       objects,
+		ping:          ping,
+		stallTimeout:  stallTimeout,
+		log:           parentLogger.WithName("connection-monitor"),
+		testIsolation: monitorTestIsolation{TimeNow: time.Now, TimeAfter: time.After},
+	}
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It monitors the informers until the
+// context is cancelled, or until it finds the connection stalled, in which case it returns an error wrapping
+// [ErrConnectionStalled].
+func (m *ConnectionMonitor) Start(ctx context.Context) error {
+	// Starting to monitor counts as activity, so the informers get a full stall timeout to deliver their first event
+	m.recordEvent()
+	handler := toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    func(_ interface{}) { m.recordEvent() },
+		UpdateFunc: func(_, _ interface{}) { m.recordEvent() },
+		DeleteFunc: func(_ interface{}) { m.recordEvent() },
+	}
+	for _, object := range m.objects {
+		informer, err := m.informers.GetInformer(ctx, object)
+		if err != nil {
+			return fmt.Errorf("connection monitor: getting the informer for %T: %w", object, err)
+		}
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return fmt.Errorf("connection monitor: adding an event handler to the informer for %T: %w", object, err)
+		}
+	}
+	m.log.V(app.VerbosityVerbose).Info("Connection monitor started", "stallTimeout", m.stallTimeout)
+
+	pingFailureCount := 0
+	for {
+		select {
+		case <-ctx.Done():
+			m.log.V(app.VerbosityInfo).Info("Context closed, exiting")
+			return nil
+		case <-m.testIsolation.TimeAfter(m.stallTimeout / checksPerStallTimeout):
+		}
+
+		silence := m.getSilence()
+		if silence < m.stallTimeout {
+			pingFailureCount = 0
+			continue
+		}
+
+		err := m.ping(ctx)
+		if err == nil {
+			m.log.V(app.VerbosityVerbose).Info(
+				"No informer events, but the seed kube-apiserver is reachable", "silence", silence)
+			pingFailureCount = 0
+			continue
+		}
+		if ctx.Err() != nil {
+			continue // Exit via the context check
+		}
+
+		pingFailureCount++
+		m.log.V(app.VerbosityInfo).Info(
+			"No informer events, and the seed kube-apiserver is not reachable",
+			"silence", silence, "pingFailureCount", pingFailureCount, "error", err.Error())
+		if pingFailureCount >= pingFailureThreshold {
+			err = fmt.Errorf("%w: no informer events for %s, and %d consecutive pings failed, the last one with: %w",
+				ErrConnectionStalled, silence, pingFailureCount, err)
+			m.log.V(app.VerbosityError).Error(err, "Restarting, to re-establish the connection")
+			return err
+		}
+	}
+}
+
+// recordEvent records the current time as the time of the most recent informer event
+func (m *ConnectionMonitor) recordEvent() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.lastEventTime = m.testIsolation.TimeNow()
+}
+
+// getSilence returns how long it has been since the most recent informer event
+func (m *ConnectionMonitor) getSilence() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.testIsolation.TimeNow().Sub(m.lastEventTime)
+}
+
+//#region Test isolation
+
+// monitorTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the ConnectionMonitor unit during tests
+type monitorTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+	// Points to [time.After]
+	TimeAfter func(time.Duration) <-chan time.Time
+}
+
+//#endregion Test isolation
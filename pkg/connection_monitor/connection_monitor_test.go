@@ -0,0 +1,220 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package connection_monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("ConnectionMonitor", func() {
+	const stallTimeout = 4 * time.Minute
+
+	var (
+		informer  *fakeInformer
+		pingError *atomic.Pointer[error]
+		pingCount *atomic.Int32
+		clock     *fakeClock
+		ticks     chan time.Time
+		waiting   chan struct{} // Receives when the monitor is done with a check, and waits for the next one
+		cancel    context.CancelFunc
+		result    chan error
+	)
+
+	// tick waits for the monitor to be done with the previous check, then advances the clock by a check period, and
+	// lets the monitor run a check
+	tick := func() {
+		<-waiting
+		ticks <- clock.Advance(stallTimeout / checksPerStallTimeout)
+	}
+
+	BeforeEach(func() {
+		// The monitor goroutine may outlive the spec, so it must only access variables which are local to the spec
+		informer = &fakeInformer{handlerAdded: make(chan struct{})}
+		pingError, pingCount = &atomic.Pointer[error]{}, &atomic.Int32{}
+		connectionRefused := fmt.Errorf("connection refused")
+		pingError.Store(&connectionRefused)
+		clock = &fakeClock{now: gcmtesting.DefaultDate()}
+		ticks = make(chan time.Time)
+		waiting = make(chan struct{})
+		result = make(chan error, 1)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+
+		localPingError, localPingCount, localClock, localTicks, localWaiting, localResult :=
+			pingError, pingCount, clock, ticks, waiting, result
+		monitor := NewConnectionMonitor(
+			&fakeInformerSource{informer: informer},
+			[]client.Object{&corev1.Pod{}},
+			func(_ context.Context) error {
+				localPingCount.Add(1)
+				return *localPingError.Load()
+			},
+			stallTimeout,
+			logr.Discard())
+		monitor.testIsolation.TimeNow = localClock.Now
+		monitor.testIsolation.TimeAfter = func(_ time.Duration) <-chan time.Time {
+			select {
+			case localWaiting <- struct{}{}:
+			case <-ctx.Done():
+			}
+			return localTicks
+		}
+
+		go func() { localResult <- monitor.Start(ctx) }()
+	})
+
+	It("should exit with ErrConnectionStalled, if informers are silent and repeated pings fail", func() {
+		// Act
+		for i := 0; i < checksPerStallTimeout-1+pingFailureThreshold; i++ {
+			tick()
+		}
+
+		// Assert
+		var err error
+		Eventually(result).Should(Receive(&err))
+		Expect(errors.Is(err, ErrConnectionStalled)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+		Expect(pingCount.Load()).To(BeEquivalentTo(pingFailureThreshold))
+	})
+
+	It("should not ping, as long as informers deliver events", func() {
+		// Act
+		for i := 0; i < 3*checksPerStallTimeout; i++ {
+			tick()
+			informer.handler.OnAdd(&corev1.Pod{}, false)
+		}
+		<-waiting
+
+		// Assert
+		Expect(result).NotTo(Receive())
+		Expect(pingCount.Load()).To(BeZero())
+	})
+
+	It("should not exit, if informers are silent, but the ping succeeds", func() {
+		// Arrange
+		var noError error
+		pingError.Store(&noError)
+
+		// Act
+		for i := 0; i < 3*checksPerStallTimeout; i++ {
+			tick()
+		}
+		<-waiting
+
+		// Assert
+		Expect(result).NotTo(Receive())
+		Expect(pingCount.Load()).To(BeEquivalentTo(2*checksPerStallTimeout + 1))
+	})
+
+	It("should reset the ping failure count, when an informer event arrives", func() {
+		// Act
+		for i := 0; i < checksPerStallTimeout-1+pingFailureThreshold-1; i++ {
+			tick()
+		}
+		<-waiting
+		informer.handler.OnUpdate(&corev1.Pod{}, &corev1.Pod{})
+		ticks <- clock.Advance(stallTimeout / checksPerStallTimeout)
+		for i := 0; i < checksPerStallTimeout-2; i++ {
+			tick()
+		}
+		<-waiting
+
+		// Assert
+		Expect(result).NotTo(Receive())
+		Expect(pingCount.Load()).To(BeEquivalentTo(pingFailureThreshold - 1))
+	})
+
+	It("should exit without error, when the context is cancelled", func() {
+		// Act
+		tick()
+		cancel()
+
+		// Assert
+		var err error
+		Eventually(result).Should(Receive(&err))
+		Expect(err).To(Succeed())
+	})
+})
+
+// fakeInformerSource always returns the same informer
+type fakeInformerSource struct {
+	informer *fakeInformer
+}
+
+func (s *fakeInformerSource) GetInformer(
+	_ context.Context, _ client.Object, _ ...cache.InformerGetOption) (cache.Informer, error) {
+
+	return s.informer, nil
+}
+
+// fakeInformer records the event handler added to it, and closes handlerAdded, once that happens. Supports a single
+// event handler.
+type fakeInformer struct {
+	handler      toolscache.ResourceEventHandler
+	handlerAdded chan struct{}
+}
+
+func (i *fakeInformer) AddEventHandler(
+	handler toolscache.ResourceEventHandler) (toolscache.ResourceEventHandlerRegistration, error) {
+
+	i.handler = handler
+	close(i.handlerAdded)
+	return nil, nil
+}
+
+func (i *fakeInformer) AddEventHandlerWithResyncPeriod(
+	handler toolscache.ResourceEventHandler, _ time.Duration) (toolscache.ResourceEventHandlerRegistration, error) {
+
+	return i.AddEventHandler(handler)
+}
+
+func (i *fakeInformer) RemoveEventHandler(_ toolscache.ResourceEventHandlerRegistration) error {
+	return nil
+}
+
+func (i *fakeInformer) AddIndexers(_ toolscache.Indexers) error {
+	return nil
+}
+
+func (i *fakeInformer) HasSynced() bool {
+	return true
+}
+
+// fakeClock is a concurrency-safe clock which only moves when advanced
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+// Now returns the current time of the clock
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by the specified duration, and returns the new time
+func (c *fakeClock) Advance(duration time.Duration) time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(duration)
+	return c.now
+}
@@ -8,21 +8,56 @@ package ha
 import (
 	"context"
 	"fmt"
+	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
 	"github.com/gardener/gardener-custom-metrics/pkg/util/errutil"
 )
 
+// How long do we wait for the EndpointSlice removal, after leadership is lost
+const endpointSliceCleanupTimeout = 10 * time.Second
+
+// How often the HAService checks whether the publish gate has opened. See SetPublishGate.
+const publishGatePollPeriod = 1 * time.Second
+
+// ConditionType is the type of the condition which reports whether the HAService manages to point the service to this
+// process. See package conditions.
+const ConditionType = "HAServiceDegraded"
+
+// Default retry settings, used unless SetRetryOptions specifies otherwise
+const (
+	DefaultRetryPeriod    = 1 * time.Second
+	DefaultMaxRetryPeriod = 5 * time.Minute
+)
+
+// RetryOptions controls how the HAService retries failed attempts to point the service to this process. The retry
+// period starts at InitialPeriod, and doubles after each failed attempt, up to MaxPeriod.
+type RetryOptions struct {
+	// InitialPeriod is the wait before the first retry
+	InitialPeriod time.Duration
+	// MaxPeriod is the upper limit of the exponentially growing retry period
+	MaxPeriod time.Duration
+	// Jitter, if greater than zero, randomly extends each wait by up to this fraction of the retry period, so replicas
+	// which fail at the same time do not retry in lockstep
+	Jitter float64
+}
+
 // HAService is the main type of the package. It takes care of concerns related to running the application in high
 // availability mode. When running in active/passive replication mode, HAService ensures that all requests go to the
-// active replica.
+// active replica. In shared mode, it lists each healthy replica in the service's endpoints. See SetSharedMode.
 // HAService implements [ctlmgr.Runnable].
 // For information about individual fields, see NewHAService().
 type HAService struct {
@@ -32,6 +67,21 @@ type HAService struct {
 	namespace        string
 	servingIPAddress string
 	servingPort      int
+	endpointMode     string
+	condition        *conditions.ComponentReporter // Receives the outcome of each endpoint update. May be nil.
+	retryOptions     RetryOptions
+
+	// The wait before the next attempt to point the service to this process. Zero once an attempt succeeds.
+	retryBackoff prometheus.Gauge
+	// The number of consecutive failed attempts to point the service to this process
+	retryCount prometheus.Gauge
+
+	// Nil, unless the HAService is in shared mode. See SetSharedMode.
+	sharedMode *SharedModeOptions
+	// Set by WithdrawEndpoints. Keeps the HAService in shared mode from adding this process back to the endpoints.
+	isWithdrawn atomic.Bool
+	// If not nil, the service is not pointed to this process while it returns false. See SetPublishGate.
+	publishGate func() bool
 
 	testIsolation testIsolation
 }
@@ -40,6 +90,8 @@ type HAService struct {
 type testIsolation struct {
 	// Points to time.After
 	TimeAfter func(time.Duration) <-chan time.Time
+	// Points to [wait.Jitter]
+	Jitter func(duration time.Duration, maxFactor float64) time.Duration
 }
 
 // NewHAService creates a new HAService instance.
@@ -53,8 +105,17 @@ type testIsolation struct {
 // servingIPAddress is the IP address at which custom metrics from this process can be consumed.
 //
 // servingPort is the network port at which custom metrics from this process can be consumed.
+//
+// endpointMode is the kind of object used to point the service to this process. One of [app.HAEndpointModeEndpoints],
+// [app.HAEndpointModeEndpointSlice], [app.HAEndpointModeBoth].
 func NewHAService(
-	apiReader client.Reader, client client.Client, namespace string, servingIPAddress string, servingPort int, parentLogger logr.Logger) *HAService {
+	apiReader client.Reader,
+	client client.Client,
+	namespace string,
+	servingIPAddress string,
+	servingPort int,
+	endpointMode string,
+	parentLogger logr.Logger) *HAService {
 
 	return &HAService{
 		log:              parentLogger.WithName("ha"),
@@ -63,10 +124,71 @@ func NewHAService(
 		namespace:        namespace,
 		servingIPAddress: servingIPAddress,
 		servingPort:      servingPort,
-		testIsolation:    testIsolation{TimeAfter: time.After},
+		endpointMode:     endpointMode,
+		retryOptions:     RetryOptions{InitialPeriod: DefaultRetryPeriod, MaxPeriod: DefaultMaxRetryPeriod},
+		retryBackoff: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gardener_custom_metrics_ha_retry_backoff_seconds",
+			Help: "The wait before the next attempt to point the service to this process. Zero if the last attempt " +
+				"succeeded.",
+		}),
+		retryCount: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gardener_custom_metrics_ha_retry_count",
+			Help: "The number of consecutive failed attempts to point the service to this process",
+		}),
+		testIsolation: testIsolation{TimeAfter: time.After, Jitter: wait.Jitter},
 	}
 }
 
+// SetRetryOptions replaces the default settings which control how failed attempts to point the service to this
+// process are retried. Must be called before Start.
+func (ha *HAService) SetRetryOptions(options RetryOptions) {
+	ha.retryOptions = options
+}
+
+// SetPublishGate keeps the HAService from pointing the service to this process, for as long as isOpen returns false,
+// e.g. while the process has no data to serve yet. When not in shared mode, the gate is only checked before the
+// service is pointed to this process. In shared mode, the process is treated as unhealthy while the gate is closed.
+// Must be called before Start.
+func (ha *HAService) SetPublishGate(isOpen func() bool) {
+	ha.publishGate = isOpen
+}
+
+// waitForPublishGate blocks until the publish gate opens, or the context is cancelled. See SetPublishGate.
+func (ha *HAService) waitForPublishGate(ctx context.Context) error {
+	if ha.publishGate == nil || ha.publishGate() {
+		return nil
+	}
+
+	ha.log.V(app.VerbosityInfo).Info("Waiting for the publish gate to open, before pointing the service to this process")
+	for !ha.publishGate() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("starting HA service: waiting for the publish gate: %w", ctx.Err())
+		case <-ha.testIsolation.TimeAfter(publishGatePollPeriod):
+		}
+	}
+	ha.log.V(app.VerbosityInfo).Info("The publish gate is open")
+	return nil
+}
+
+// Describe implements [prometheus.Collector.Describe].
+func (ha *HAService) Describe(ch chan<- *prometheus.Desc) {
+	ha.retryBackoff.Describe(ch)
+	ha.retryCount.Describe(ch)
+}
+
+// Collect implements [prometheus.Collector.Collect].
+func (ha *HAService) Collect(ch chan<- prometheus.Metric) {
+	ha.retryBackoff.Collect(ch)
+	ha.retryCount.Collect(ch)
+}
+
+// SetConditionReporter directs the HAService to report the outcome of its attempts to point the service to this
+// process, to the specified condition. Must be called before Start.
+func (ha *HAService) SetConditionReporter(condition *conditions.ComponentReporter) {
+	ha.condition = condition
+}
+
 func (ha *HAService) setEndpoints(ctx context.Context) error {
 	endpoints := corev1.Endpoints{
 		ObjectMeta: metav1.ObjectMeta{
@@ -90,27 +212,252 @@ func (ha *HAService) setEndpoints(ctx context.Context) error {
 	return errutil.Wrap("updating the service endpoint to point to the new leader", err)
 }
 
+// newEndpointSlice returns an EndpointSlice object which identifies the service's EndpointSlice, with no other data
+func (ha *HAService) newEndpointSlice() *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      app.Name,
+			Namespace: ha.namespace,
+		},
+	}
+}
+
+func (ha *HAService) setEndpointSlice(ctx context.Context) error {
+	const errorContext = "updating the service endpoint slice to point to the new leader"
+	slice := ha.newEndpointSlice()
+	// Bypass client cache, same as for Endpoints
+	err := ha.apiReader.Get(ctx, client.ObjectKeyFromObject(slice), slice)
+	isNotFound := errors.IsNotFound(err)
+	if err != nil && !isNotFound {
+		return fmt.Errorf("%s: retrieving endpoint slice: %w", errorContext, err)
+	}
+
+	slice.ObjectMeta.Labels = map[string]string{
+		"app":                        app.Name,
+		discoveryv1.LabelServiceName: app.Name,
+		discoveryv1.LabelManagedBy:   app.Uri,
+	}
+	slice.AddressType = discoveryv1.AddressTypeIPv4
+	if ip := net.ParseIP(ha.servingIPAddress); ip != nil && ip.To4() == nil {
+		slice.AddressType = discoveryv1.AddressTypeIPv6
+	}
+	slice.Endpoints = []discoveryv1.Endpoint{{
+		Addresses:  []string{ha.servingIPAddress},
+		Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+	}}
+	slice.Ports = []discoveryv1.EndpointPort{{
+		Port:     ptr.To(int32(ha.servingPort)),
+		Protocol: ptr.To(corev1.ProtocolTCP),
+	}}
+
+	if isNotFound {
+		err = ha.client.Create(ctx, slice)
+	} else {
+		err = ha.client.Update(ctx, slice)
+	}
+	return errutil.Wrap(errorContext, err)
+}
+
+// removeEndpointSlice deletes the service's EndpointSlice, if it still points to this process. The deletion is
+// conditioned on the UID and resource version of the object which was checked, so if a new leader updates the object
+// in the meantime, the deletion fails, instead of undoing the new leader's update.
+func (ha *HAService) removeEndpointSlice(ctx context.Context) error {
+	slice := ha.newEndpointSlice()
+	err := ha.apiReader.Get(ctx, client.ObjectKeyFromObject(slice), slice)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("removing the service endpoint slice: retrieving endpoint slice: %w", err)
+	}
+
+	if len(slice.Endpoints) != 1 || len(slice.Endpoints[0].Addresses) != 1 ||
+		slice.Endpoints[0].Addresses[0] != ha.servingIPAddress {
+
+		ha.log.V(app.VerbosityVerbose).Info("The service endpoint slice no longer points to this process. Leaving it as is")
+		return nil
+	}
+
+	err = ha.client.Delete(ctx, slice, client.Preconditions{UID: &slice.UID, ResourceVersion: &slice.ResourceVersion})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		ha.log.V(app.VerbosityVerbose).Info("The service endpoint slice was changed by someone else. Leaving it as is")
+		return nil
+	}
+	return errutil.Wrap("removing the service endpoint slice", err)
+}
+
+// removeEndpoints clears the addresses of the service's Endpoints object, if it still points to this process. The update
+// carries the resource version of the object which was checked, so if a new leader updates the object in the meantime,
+// the update fails, instead of undoing the new leader's update.
+func (ha *HAService) removeEndpoints(ctx context.Context) error {
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      app.Name,
+			Namespace: ha.namespace,
+		},
+	}
+	err := ha.apiReader.Get(ctx, client.ObjectKeyFromObject(&endpoints), &endpoints)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("removing the service endpoints: retrieving endpoints: %w", err)
+	}
+
+	if len(endpoints.Subsets) != 1 || len(endpoints.Subsets[0].Addresses) != 1 ||
+		endpoints.Subsets[0].Addresses[0].IP != ha.servingIPAddress {
+
+		ha.log.V(app.VerbosityVerbose).Info("The service endpoints no longer point to this process. Leaving them as is")
+		return nil
+	}
+
+	endpoints.Subsets = nil
+	err = ha.client.Update(ctx, &endpoints)
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		ha.log.V(app.VerbosityVerbose).Info("The service endpoints were changed by someone else. Leaving them as is")
+		return nil
+	}
+	return errutil.Wrap("removing the service endpoints", err)
+}
+
+// WithdrawEndpoints stops pointing the service to this process, via the kinds of objects specified by the endpoint
+// mode. Objects which already point elsewhere are left as they are. In shared mode, only the address of this process
+// is removed, and it is not added back afterwards. Used upon shutdown, so consumers stop sending requests to this
+// process before it stops serving.
+func (ha *HAService) WithdrawEndpoints(ctx context.Context) error {
+	if ha.sharedMode != nil {
+		ha.isWithdrawn.Store(true)
+		return ha.reconcileShared(ctx, false)
+	}
+	if ha.endpointMode != app.HAEndpointModeEndpointSlice {
+		if err := ha.removeEndpoints(ctx); err != nil {
+			return err
+		}
+	}
+	if ha.endpointMode != app.HAEndpointModeEndpoints {
+		if err := ha.removeEndpointSlice(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishEndpoints points the service to this process, via the kinds of objects specified by the endpoint mode
+func (ha *HAService) publishEndpoints(ctx context.Context) error {
+	if ha.endpointMode != app.HAEndpointModeEndpointSlice {
+		if err := ha.setEndpoints(ctx); err != nil {
+			return err
+		}
+	}
+	if ha.endpointMode != app.HAEndpointModeEndpoints {
+		if err := ha.setEndpointSlice(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LeaderAddress returns the IP address to which the leader points the service, as recorded in the kind of object
+// specified by the endpoint mode (the Endpoints object, if both kinds are used). Returns an empty string, if the
+// service does not point to a single address, e.g. because no leader has taken over yet. Not meant for shared mode.
+func (ha *HAService) LeaderAddress(ctx context.Context) (string, error) {
+	if ha.endpointMode == app.HAEndpointModeEndpointSlice {
+		slice := ha.newEndpointSlice()
+		err := ha.apiReader.Get(ctx, client.ObjectKeyFromObject(slice), slice)
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("determining the leader address: retrieving endpoint slice: %w", err)
+		}
+		if len(slice.Endpoints) != 1 || len(slice.Endpoints[0].Addresses) != 1 {
+			return "", nil
+		}
+		return slice.Endpoints[0].Addresses[0], nil
+	}
+
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      app.Name,
+			Namespace: ha.namespace,
+		},
+	}
+	err := ha.apiReader.Get(ctx, client.ObjectKeyFromObject(&endpoints), &endpoints)
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("determining the leader address: retrieving endpoints: %w", err)
+	}
+	if len(endpoints.Subsets) != 1 || len(endpoints.Subsets[0].Addresses) != 1 {
+		return "", nil
+	}
+	return endpoints.Subsets[0].Addresses[0].IP, nil
+}
+
+// NeedLeaderElection implements [sigs.k8s.io/controller-runtime/pkg/manager.LeaderElectionRunnable]. Only the leader
+// points the service to itself, unless the HAService is in shared mode.
+func (ha *HAService) NeedLeaderElection() bool {
+	return ha.sharedMode == nil
+}
+
 // Start implements [ctlmgr.Runnable.Start]. The HAService.manager runs this function when this process becomes the
 // leader. The function ensures that the single endpoint for the gardener-metrics-provider service points to this
 // process' server endpoint, thus ensuring that all requests go to the leader.
+//
+// If an EndpointSlice is used, the function keeps running until the context is cancelled (i.e. leadership is lost),
+// and then removes the EndpointSlice, unless it was already taken over by a new leader.
+//
+// In shared mode, the function runs on all replicas. It keeps the address of this process listed in the endpoints
+// while the process is healthy, until the context is cancelled, and then removes it.
+//
+// If a publish gate is set, the service is only pointed to this process once the gate opens. See SetPublishGate.
 func (ha *HAService) Start(ctx context.Context) error {
-	retryPeriod := 1 * time.Second
-	maxRetryPeriod := 5 * time.Minute
+	if ha.sharedMode != nil {
+		return ha.startShared(ctx)
+	}
+	if err := ha.waitForPublishGate(ctx); err != nil {
+		return err
+	}
+	retryPeriod := ha.retryOptions.InitialPeriod
+	failureCount := 0
 
-	for err := ha.setEndpoints(ctx); err != nil; err = ha.setEndpoints(ctx) {
-		ha.log.V(app.VerbosityError).Error(err, "Failed to set service endpoints")
+	for err := ha.publishEndpoints(ctx); err != nil; err = ha.publishEndpoints(ctx) {
+		delay := retryPeriod
+		if ha.retryOptions.Jitter > 0 {
+			delay = ha.testIsolation.Jitter(retryPeriod, ha.retryOptions.Jitter)
+		}
+		failureCount++
+		ha.retryBackoff.Set(delay.Seconds())
+		ha.retryCount.Set(float64(failureCount))
+		ha.log.V(app.VerbosityError).Error(err, "Failed to set service endpoints", "retryAfter", delay)
+		ha.condition.ReportError(err)
 
 		select {
 		case <-ctx.Done():
 			return fmt.Errorf("starting HA service: %w", ctx.Err())
-		case <-ha.testIsolation.TimeAfter(retryPeriod):
+		case <-ha.testIsolation.TimeAfter(delay):
 		}
 
 		retryPeriod *= 2
-		if retryPeriod > maxRetryPeriod {
-			retryPeriod = maxRetryPeriod
+		if retryPeriod > ha.retryOptions.MaxPeriod {
+			retryPeriod = ha.retryOptions.MaxPeriod
 		}
 	}
+	ha.retryBackoff.Set(0)
+	ha.retryCount.Set(0)
+	ha.condition.ReportSuccess()
 
+	if ha.endpointMode == app.HAEndpointModeEndpoints {
+		return nil
+	}
+
+	<-ctx.Done()
+	// The original context is already cancelled. Allow the cleanup a brief period of its own.
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), endpointSliceCleanupTimeout)
+	defer cancel()
+	if err := ha.removeEndpointSlice(cleanupCtx); err != nil {
+		ha.log.V(app.VerbosityError).Error(err, "Failed to remove service endpoint slice")
+	}
 	return nil
 }
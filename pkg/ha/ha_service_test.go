@@ -12,12 +12,15 @@ import (
 	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
 )
 
 var _ = Describe("HAService", func() {
@@ -31,7 +34,7 @@ var _ = Describe("HAService", func() {
 		It("should set the respective service endpoints ", func() {
 			// Arrange
 			fakeClient := fake.NewClientBuilder().Build()
-			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, logr.Discard())
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
 
 			endpoints := &corev1.Endpoints{
 				ObjectMeta: metav1.ObjectMeta{
@@ -62,7 +65,7 @@ var _ = Describe("HAService", func() {
 
 			// Arrange
 			fakeClient := fake.NewClientBuilder().Build()
-			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, logr.Discard())
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
 			timeAfterChan := make(chan time.Time)
 			var timeAfterDuration atomic.Int64
 			ha.testIsolation.TimeAfter = func(duration time.Duration) <-chan time.Time {
@@ -104,10 +107,91 @@ var _ = Describe("HAService", func() {
 			Expect(actual.Subsets[0].Addresses[0].IP).To(Equal(testIPAddress))
 		})
 
+		It("should not point the service to this process, before the publish gate opens", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			ha := NewHAService(
+				fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
+			Expect(fakeClient.Create(context.Background(), &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: app.Name, Namespace: testNs},
+			})).To(Succeed())
+			var isOpen atomic.Bool
+			ha.SetPublishGate(isOpen.Load)
+			timeAfterChan := make(chan time.Time)
+			var timeAfterDuration atomic.Int64
+			ha.testIsolation.TimeAfter = func(duration time.Duration) <-chan time.Time {
+				timeAfterDuration.Store(int64(duration))
+				return timeAfterChan
+			}
+			var isComplete atomic.Bool
+			getIPs := func() []corev1.EndpointAddress {
+				actual := corev1.Endpoints{}
+				Expect(fakeClient.Get(context.Background(), kclient.ObjectKey{Namespace: testNs, Name: app.Name}, &actual)).
+					To(Succeed())
+				if len(actual.Subsets) == 0 {
+					return nil
+				}
+				return actual.Subsets[0].Addresses
+			}
+
+			// Act and assert
+			go func() {
+				_ = ha.Start(context.Background())
+				isComplete.Store(true)
+			}()
+
+			timeAfterChan <- time.Now()
+			Expect(timeAfterDuration.Load()).To(Equal(int64(publishGatePollPeriod)))
+			Expect(isComplete.Load()).To(BeFalse())
+			Expect(getIPs()).To(BeEmpty())
+
+			isOpen.Store(true)
+			timeAfterChan <- time.Now()
+			Eventually(isComplete.Load).Should(BeTrue())
+			Expect(getIPs()).To(Equal([]corev1.EndpointAddress{{IP: testIPAddress}}))
+		})
+
+		It("should report the failed attempts and the eventual success to the condition", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
+			conditionRegistry := conditions.NewRegistry(logr.Discard())
+			ha.SetConditionReporter(conditionRegistry.NewReporter(ConditionType, 1, false))
+			timeAfterChan := make(chan time.Time)
+			ha.testIsolation.TimeAfter = func(_ time.Duration) <-chan time.Time {
+				return timeAfterChan
+			}
+			var isComplete atomic.Bool
+
+			// Act and assert
+			go func() {
+				_ = ha.Start(context.Background())
+				isComplete.Store(true)
+			}()
+
+			Eventually(func() metav1.ConditionStatus {
+				return conditionRegistry.Conditions()[0].Status
+			}).Should(Equal(metav1.ConditionTrue))
+
+			endpoints := &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      app.Name,
+					Namespace: ha.namespace,
+				},
+			}
+			Expect(fakeClient.Create(context.Background(), endpoints)).To(Succeed())
+			timeAfterChan <- time.Now()
+
+			Eventually(isComplete.Load).Should(BeTrue())
+			condition := conditionRegistry.Conditions()[0]
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.TotalErrorCount).To(Equal(int64(1)))
+		})
+
 		It("should immediately abort retrying, if the context gets canceled", func() {
 			// Arrange
 			fakeClient := fake.NewClientBuilder().Build()
-			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, logr.Discard())
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
 
 			timeAfterChan := make(chan time.Time)
 			ha.testIsolation.TimeAfter = func(_ time.Duration) <-chan time.Time {
@@ -140,7 +224,7 @@ var _ = Describe("HAService", func() {
 
 			// Arrange
 			fakeClient := fake.NewClientBuilder().Build()
-			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, logr.Discard())
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
 			timeAfterChan := make(chan time.Time)
 			var timeAfterDuration atomic.Int64
 			ha.testIsolation.TimeAfter = func(duration time.Duration) <-chan time.Time {
@@ -165,5 +249,293 @@ var _ = Describe("HAService", func() {
 			}
 			Consistently(timeAfterDuration.Load).Should(Equal(int64(expectedMax)))
 		})
+
+		It("should apply the retry options, including jitter, and expose the backoff state in metrics", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
+			ha.SetRetryOptions(RetryOptions{InitialPeriod: 3 * time.Second, MaxPeriod: 4 * time.Second, Jitter: 0.5})
+			var jitterFactor atomic.Value
+			ha.testIsolation.Jitter = func(duration time.Duration, maxFactor float64) time.Duration {
+				jitterFactor.Store(maxFactor)
+				return duration + time.Second
+			}
+			timeAfterChan := make(chan time.Time)
+			var timeAfterDuration atomic.Int64
+			ha.testIsolation.TimeAfter = func(duration time.Duration) <-chan time.Time {
+				timeAfterDuration.Store(int64(duration))
+				return timeAfterChan
+			}
+			var isComplete atomic.Bool
+
+			// Act and assert
+			go func() {
+				_ = ha.Start(context.Background())
+				isComplete.Store(true)
+			}()
+
+			Eventually(timeAfterDuration.Load).Should(Equal(int64(4 * time.Second)))
+			Expect(jitterFactor.Load()).To(Equal(0.5))
+			Expect(promtestutil.ToFloat64(ha.retryBackoff)).To(Equal(4.0))
+			Expect(promtestutil.ToFloat64(ha.retryCount)).To(Equal(1.0))
+
+			timeAfterChan <- time.Now()
+			Eventually(timeAfterDuration.Load).Should(Equal(int64(5 * time.Second))) // Capped at max, plus jitter
+			Expect(promtestutil.ToFloat64(ha.retryCount)).To(Equal(2.0))
+
+			endpoints := &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      app.Name,
+					Namespace: ha.namespace,
+				},
+			}
+			Expect(fakeClient.Create(context.Background(), endpoints)).To(Succeed())
+			timeAfterChan <- time.Now()
+
+			Eventually(isComplete.Load).Should(BeTrue())
+			Expect(promtestutil.ToFloat64(ha.retryBackoff)).To(BeZero())
+			Expect(promtestutil.ToFloat64(ha.retryCount)).To(BeZero())
+		})
+	})
+
+	Describe("Start with EndpointSlice", func() {
+		var (
+			getSlice = func(client kclient.Client) (*discoveryv1.EndpointSlice, error) {
+				slice := &discoveryv1.EndpointSlice{}
+				err := client.Get(context.Background(), kclient.ObjectKey{Namespace: testNs, Name: app.Name}, slice)
+				return slice, err
+			}
+		)
+
+		It("should create an endpoint slice which points to this process, and remove it when the context is "+
+			"cancelled", func() {
+
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			ha := NewHAService(
+				fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpointSlice, logr.Discard())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var isComplete atomic.Bool
+
+			// Act
+			go func() {
+				defer GinkgoRecover()
+				Expect(ha.Start(ctx)).To(Succeed())
+				isComplete.Store(true)
+			}()
+
+			// Assert
+			Eventually(func() error { _, err := getSlice(fakeClient); return err }).Should(Succeed())
+			slice, _ := getSlice(fakeClient)
+			Expect(slice.Labels[discoveryv1.LabelServiceName]).To(Equal(app.Name))
+			Expect(slice.AddressType).To(Equal(discoveryv1.AddressTypeIPv4))
+			Expect(slice.Endpoints).To(HaveLen(1))
+			Expect(slice.Endpoints[0].Addresses).To(Equal([]string{testIPAddress}))
+			Expect(*slice.Endpoints[0].Conditions.Ready).To(BeTrue())
+			Expect(slice.Ports).To(HaveLen(1))
+			Expect(*slice.Ports[0].Port).To(Equal(int32(testPort)))
+			Consistently(isComplete.Load).Should(BeFalse())
+			endpoints := corev1.Endpoints{}
+			err := fakeClient.Get(context.Background(), kclient.ObjectKey{Namespace: testNs, Name: app.Name}, &endpoints)
+			Expect(err).To(HaveOccurred()) // Endpoints are not managed in this mode
+
+			cancel()
+			Eventually(isComplete.Load).Should(BeTrue())
+			_, err = getSlice(fakeClient)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should update both the Endpoints and the endpoint slice, in 'both' mode", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeBoth, logr.Discard())
+			endpoints := &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: app.Name, Namespace: testNs}}
+			Expect(fakeClient.Create(context.Background(), endpoints)).To(Succeed())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Act
+			go func() {
+				_ = ha.Start(ctx)
+			}()
+
+			// Assert
+			Eventually(func() error { _, err := getSlice(fakeClient); return err }).Should(Succeed())
+			Expect(fakeClient.Get(context.Background(), kclient.ObjectKeyFromObject(endpoints), endpoints)).To(Succeed())
+			Expect(endpoints.Subsets).To(HaveLen(1))
+			Expect(endpoints.Subsets[0].Addresses[0].IP).To(Equal(testIPAddress))
+		})
+
+		It("should use the IPv6 address type for an IPv6 serving address", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			ha := NewHAService(fakeClient, fakeClient, testNs, "fd00::1", testPort, app.HAEndpointModeEndpointSlice, logr.Discard())
+
+			// Act
+			err := ha.setEndpointSlice(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+			slice, err := getSlice(fakeClient)
+			Expect(err).To(Succeed())
+			Expect(slice.AddressType).To(Equal(discoveryv1.AddressTypeIPv6))
+		})
+	})
+
+	Describe("removeEndpointSlice", func() {
+		It("should not remove an endpoint slice which points to another process", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			newLeader := NewHAService(
+				fakeClient, fakeClient, testNs, "5.6.7.8", testPort, app.HAEndpointModeEndpointSlice, logr.Discard())
+			Expect(newLeader.setEndpointSlice(context.Background())).To(Succeed())
+			ha := NewHAService(
+				fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpointSlice, logr.Discard())
+
+			// Act
+			err := ha.removeEndpointSlice(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+			slice := &discoveryv1.EndpointSlice{}
+			Expect(fakeClient.Get(context.Background(), kclient.ObjectKey{Namespace: testNs, Name: app.Name}, slice)).
+				To(Succeed())
+			Expect(slice.Endpoints[0].Addresses).To(Equal([]string{"5.6.7.8"}))
+		})
+
+		It("should succeed if the endpoint slice does not exist", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			ha := NewHAService(
+				fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpointSlice, logr.Discard())
+
+			// Act
+			err := ha.removeEndpointSlice(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+		})
+	})
+
+	Describe("WithdrawEndpoints", func() {
+		var (
+			newEndpoints = func(ip string) *corev1.Endpoints {
+				return &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{Name: app.Name, Namespace: testNs},
+					Subsets: []corev1.EndpointSubset{{
+						Addresses: []corev1.EndpointAddress{{IP: ip}},
+						Ports:     []corev1.EndpointPort{{Port: testPort, Protocol: "TCP"}},
+					}},
+				}
+			}
+		)
+
+		It("should clear the Endpoints and remove the endpoint slice, if they point to this process", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeBoth, logr.Discard())
+			Expect(fakeClient.Create(context.Background(), newEndpoints("5.6.7.8"))).To(Succeed())
+			Expect(ha.publishEndpoints(context.Background())).To(Succeed())
+
+			// Act
+			err := ha.WithdrawEndpoints(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+			endpoints := &corev1.Endpoints{}
+			Expect(fakeClient.Get(context.Background(), kclient.ObjectKey{Namespace: testNs, Name: app.Name}, endpoints)).
+				To(Succeed())
+			Expect(endpoints.Subsets).To(BeEmpty())
+			err = fakeClient.Get(
+				context.Background(), kclient.ObjectKey{Namespace: testNs, Name: app.Name}, &discoveryv1.EndpointSlice{})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should not clear Endpoints which point to another process", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().WithObjects(newEndpoints("5.6.7.8")).Build()
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
+
+			// Act
+			err := ha.WithdrawEndpoints(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+			endpoints := &corev1.Endpoints{}
+			Expect(fakeClient.Get(context.Background(), kclient.ObjectKey{Namespace: testNs, Name: app.Name}, endpoints)).
+				To(Succeed())
+			Expect(endpoints.Subsets).To(HaveLen(1))
+			Expect(endpoints.Subsets[0].Addresses[0].IP).To(Equal("5.6.7.8"))
+		})
+
+		It("should succeed if the Endpoints do not exist", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
+
+			// Act
+			err := ha.WithdrawEndpoints(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+		})
+	})
+
+	Describe("LeaderAddress", func() {
+		It("should return the address in the Endpoints object", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			leader := NewHAService(fakeClient, fakeClient, testNs, "5.6.7.8", testPort, app.HAEndpointModeBoth, logr.Discard())
+			Expect(fakeClient.Create(context.Background(), &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: app.Name, Namespace: testNs},
+			})).To(Succeed())
+			Expect(leader.publishEndpoints(context.Background())).To(Succeed())
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeBoth, logr.Discard())
+
+			// Act
+			address, err := ha.LeaderAddress(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(address).To(Equal("5.6.7.8"))
+		})
+
+		It("should return the address in the endpoint slice, in endpoint slice mode", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			leader := NewHAService(
+				fakeClient, fakeClient, testNs, "5.6.7.8", testPort, app.HAEndpointModeEndpointSlice, logr.Discard())
+			Expect(leader.publishEndpoints(context.Background())).To(Succeed())
+			ha := NewHAService(
+				fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpointSlice, logr.Discard())
+
+			// Act
+			address, err := ha.LeaderAddress(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(address).To(Equal("5.6.7.8"))
+		})
+
+		It("should return an empty address, if the service does not point to a leader", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().WithObjects(&corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: app.Name, Namespace: testNs},
+			}).Build()
+			ha := NewHAService(fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
+			sliceHA := NewHAService(
+				fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpointSlice, logr.Discard())
+
+			// Act
+			address, err := ha.LeaderAddress(context.Background())
+			sliceAddress, sliceErr := sliceHA.LeaderAddress(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(address).To(BeEmpty())
+			Expect(sliceErr).To(Succeed())
+			Expect(sliceAddress).To(BeEmpty())
+		})
 	})
 })
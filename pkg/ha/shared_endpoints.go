@@ -0,0 +1,255 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ha
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/util/errutil"
+)
+
+// DefaultSharedResyncPeriod is the default period at which an HAService in shared mode reconciles the presence of this
+// process in the service's endpoint objects
+const DefaultSharedResyncPeriod = 30 * time.Second
+
+// SharedModeOptions configures the shared mode of the HAService. See SetSharedMode.
+type SharedModeOptions struct {
+	// ResyncPeriod is how often the presence of this process in the endpoint objects is reconciled. Zero means
+	// DefaultSharedResyncPeriod.
+	ResyncPeriod time.Duration
+	// IsHealthy reports whether this process is fit to receive traffic. Nil means always.
+	IsHealthy func() bool
+	// LiveAddresses, if not nil, returns the IP addresses of all replicas which are currently live, this one included.
+	// The addresses of the other replicas which are not among them are pruned from the endpoint objects, so a replica
+	// which terminated without withdrawing its address does not keep receiving traffic. A live replica which gets
+	// pruned by mistake, e.g. based on a stale list, adds itself back within a resync period.
+	LiveAddresses func() []string
+}
+
+// SetSharedMode switches the HAService to shared mode, for use with multiple active replicas (see
+// [app.HAModeSharded]). Instead of pointing the service exclusively to this process, the HAService lists the address of
+// this process in the service's endpoint objects, alongside the addresses of the other replicas, for as long as this
+// process is healthy. In shared mode, the HAService runs without leader election. Must be called before Start.
+func (ha *HAService) SetSharedMode(options SharedModeOptions) {
+	if options.ResyncPeriod <= 0 {
+		options.ResyncPeriod = DefaultSharedResyncPeriod
+	}
+	ha.sharedMode = &options
+}
+
+// SetLiveAddresses sets [SharedModeOptions.LiveAddresses]. Allows the source of live addresses to be provided after the
+// HAService switched to shared mode. Must be called before Start, and only in shared mode.
+func (ha *HAService) SetLiveAddresses(liveAddresses func() []string) {
+	ha.sharedMode.LiveAddresses = liveAddresses
+}
+
+// startShared implements Start in shared mode. It reconciles the presence of this process in the endpoint objects once
+// per resync period, until the context is cancelled, and then withdraws the address of this process.
+func (ha *HAService) startShared(ctx context.Context) error {
+	resyncPeriod := ha.sharedMode.ResyncPeriod
+	failureCount := 0
+	for {
+		if err := ha.reconcileShared(ctx, ha.isServingShared()); err != nil {
+			failureCount++
+			ha.retryBackoff.Set(resyncPeriod.Seconds())
+			ha.retryCount.Set(float64(failureCount))
+			ha.log.V(app.VerbosityError).Error(err, "Failed to update shared service endpoints", "retryAfter", resyncPeriod)
+			ha.condition.ReportError(err)
+		} else {
+			failureCount = 0
+			ha.retryBackoff.Set(0)
+			ha.retryCount.Set(0)
+			ha.condition.ReportSuccess()
+		}
+
+		select {
+		case <-ctx.Done():
+			// The original context is already cancelled. Allow the cleanup a brief period of its own.
+			cleanupCtx, cancel := context.WithTimeout(context.Background(), endpointSliceCleanupTimeout)
+			defer cancel()
+			if err := ha.reconcileShared(cleanupCtx, false); err != nil {
+				ha.log.V(app.VerbosityError).Error(err, "Failed to withdraw from shared service endpoints")
+			}
+			return nil
+		case <-ha.testIsolation.TimeAfter(resyncPeriod):
+		}
+	}
+}
+
+// isServingShared returns true if, in shared mode, the address of this process should be listed in the endpoint objects
+func (ha *HAService) isServingShared() bool {
+	if ha.isWithdrawn.Load() || (ha.publishGate != nil && !ha.publishGate()) {
+		return false
+	}
+	return ha.sharedMode.IsHealthy == nil || ha.sharedMode.IsHealthy()
+}
+
+// reconcileShared adds the address of this process to the endpoint objects specified by the endpoint mode, or removes
+// it from them, depending on isServing. Concurrent updates by other replicas are retried right away.
+func (ha *HAService) reconcileShared(ctx context.Context, isServing bool) error {
+	isConcurrentUpdate := func(err error) bool { return errors.IsConflict(err) || errors.IsAlreadyExists(err) }
+	if ha.endpointMode != app.HAEndpointModeEndpointSlice {
+		err := retry.OnError(retry.DefaultRetry, isConcurrentUpdate, func() error {
+			return ha.updateSharedEndpoints(ctx, isServing)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if ha.endpointMode != app.HAEndpointModeEndpoints {
+		return retry.OnError(retry.DefaultRetry, isConcurrentUpdate, func() error {
+			return ha.updateSharedEndpointSlice(ctx, isServing)
+		})
+	}
+	return nil
+}
+
+// desiredSharedAddresses returns the addresses which the endpoint objects should list, given the ones they currently
+// list: the current ones, without the addresses of replicas which are no longer live, and with the address of this
+// process added or removed, depending on isServing. The result is sorted, and free of duplicates.
+func (ha *HAService) desiredSharedAddresses(current []string, isServing bool) []string {
+	var liveAddresses map[string]bool
+	if ha.sharedMode.LiveAddresses != nil {
+		liveAddresses = make(map[string]bool)
+		for _, address := range ha.sharedMode.LiveAddresses() {
+			liveAddresses[address] = true
+		}
+	}
+
+	result := make([]string, 0, len(current)+1)
+	for _, address := range current {
+		if address == ha.servingIPAddress || (liveAddresses != nil && !liveAddresses[address]) {
+			continue
+		}
+		result = append(result, address)
+	}
+	if isServing {
+		result = append(result, ha.servingIPAddress)
+	}
+	sort.Strings(result)
+	return slices.Compact(result)
+}
+
+// updateSharedEndpoints brings the service's Endpoints object to the state determined by desiredSharedAddresses. The
+// update carries the resource version of the object which was read, so concurrent updates by other replicas fail with
+// a conflict, instead of being overwritten.
+func (ha *HAService) updateSharedEndpoints(ctx context.Context, isServing bool) error {
+	const errorContext = "updating the shared service endpoints"
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      app.Name,
+			Namespace: ha.namespace,
+		},
+	}
+	// Bypass client cache, same as in active/passive mode
+	err := ha.apiReader.Get(ctx, client.ObjectKeyFromObject(&endpoints), &endpoints)
+	isNotFound := errors.IsNotFound(err)
+	if err != nil && !isNotFound {
+		return fmt.Errorf("%s: retrieving endpoints: %w", errorContext, err)
+	}
+
+	var current []string
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			current = append(current, address.IP)
+		}
+	}
+	desired := ha.desiredSharedAddresses(current, isServing)
+	if slices.Equal(current, desired) {
+		return nil
+	}
+
+	endpoints.ObjectMeta.Labels = map[string]string{"app": app.Name}
+	endpoints.Subsets = nil
+	if len(desired) > 0 {
+		subset := corev1.EndpointSubset{Ports: []corev1.EndpointPort{{Port: int32(ha.servingPort), Protocol: "TCP"}}}
+		for _, address := range desired {
+			subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{IP: address})
+		}
+		endpoints.Subsets = []corev1.EndpointSubset{subset}
+	}
+
+	if isNotFound {
+		err = ha.client.Create(ctx, &endpoints)
+	} else {
+		err = ha.client.Update(ctx, &endpoints)
+	}
+	return errutil.Wrap(errorContext, err)
+}
+
+// updateSharedEndpointSlice brings the service's EndpointSlice to the state determined by desiredSharedAddresses. The
+// slice is deleted once it lists no addresses. Like updateSharedEndpoints, it fails upon concurrent updates, instead of
+// overwriting them.
+func (ha *HAService) updateSharedEndpointSlice(ctx context.Context, isServing bool) error {
+	const errorContext = "updating the shared service endpoint slice"
+	slice := ha.newEndpointSlice()
+	err := ha.apiReader.Get(ctx, client.ObjectKeyFromObject(slice), slice)
+	isNotFound := errors.IsNotFound(err)
+	if err != nil && !isNotFound {
+		return fmt.Errorf("%s: retrieving endpoint slice: %w", errorContext, err)
+	}
+
+	var current []string
+	for _, endpoint := range slice.Endpoints {
+		current = append(current, endpoint.Addresses...)
+	}
+	desired := ha.desiredSharedAddresses(current, isServing)
+	if len(desired) == 0 {
+		if isNotFound {
+			return nil
+		}
+		err = ha.client.Delete(
+			ctx, slice, client.Preconditions{UID: &slice.UID, ResourceVersion: &slice.ResourceVersion})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return errutil.Wrap(errorContext, err)
+	}
+	if slices.Equal(current, desired) {
+		return nil
+	}
+
+	slice.ObjectMeta.Labels = map[string]string{
+		"app":                        app.Name,
+		discoveryv1.LabelServiceName: app.Name,
+		discoveryv1.LabelManagedBy:   app.Uri,
+	}
+	slice.AddressType = discoveryv1.AddressTypeIPv4
+	if ip := net.ParseIP(ha.servingIPAddress); ip != nil && ip.To4() == nil {
+		slice.AddressType = discoveryv1.AddressTypeIPv6
+	}
+	slice.Endpoints = nil
+	for _, address := range desired {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{address},
+			Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+		})
+	}
+	slice.Ports = []discoveryv1.EndpointPort{{
+		Port:     ptr.To(int32(ha.servingPort)),
+		Protocol: ptr.To(corev1.ProtocolTCP),
+	}}
+
+	if isNotFound {
+		err = ha.client.Create(ctx, slice)
+	} else {
+		err = ha.client.Update(ctx, slice)
+	}
+	return errutil.Wrap(errorContext, err)
+}
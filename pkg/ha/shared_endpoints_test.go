@@ -0,0 +1,259 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ha
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+var _ = Describe("HAService in shared mode", func() {
+	const (
+		testNs        = "shoot--my-shoot"
+		testIPAddress = "1.2.3.4"
+		testPort      = 777
+	)
+
+	var (
+		newSharedHAService = func(client kclient.Client, endpointMode string, options SharedModeOptions) *HAService {
+			ha := NewHAService(client, client, testNs, testIPAddress, testPort, endpointMode, logr.Discard())
+			ha.SetSharedMode(options)
+			return ha
+		}
+		newEndpoints = func(ips ...string) *corev1.Endpoints {
+			subset := corev1.EndpointSubset{Ports: []corev1.EndpointPort{{Port: testPort, Protocol: "TCP"}}}
+			for _, ip := range ips {
+				subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{IP: ip})
+			}
+			return &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: app.Name, Namespace: testNs},
+				Subsets:    []corev1.EndpointSubset{subset},
+			}
+		}
+		getEndpointIPs = func(client kclient.Client) []string {
+			endpoints := &corev1.Endpoints{}
+			Expect(client.Get(context.Background(), kclient.ObjectKey{Namespace: testNs, Name: app.Name}, endpoints)).
+				To(Succeed())
+			var result []string
+			for _, subset := range endpoints.Subsets {
+				for _, address := range subset.Addresses {
+					result = append(result, address.IP)
+				}
+			}
+			return result
+		}
+		getSlice = func(client kclient.Client) (*discoveryv1.EndpointSlice, error) {
+			slice := &discoveryv1.EndpointSlice{}
+			err := client.Get(context.Background(), kclient.ObjectKey{Namespace: testNs, Name: app.Name}, slice)
+			return slice, err
+		}
+	)
+
+	Describe("NeedLeaderElection", func() {
+		It("should require leader election only outside shared mode", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			ha := NewHAService(
+				fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
+			sharedHA := newSharedHAService(fakeClient, app.HAEndpointModeEndpoints, SharedModeOptions{})
+
+			// Act
+			isNeeded := ha.NeedLeaderElection()
+			isNeededShared := sharedHA.NeedLeaderElection()
+
+			// Assert
+			Expect(isNeeded).To(BeTrue())
+			Expect(isNeededShared).To(BeFalse())
+		})
+	})
+
+	Describe("desiredSharedAddresses", func() {
+		It("should add this process' address, keeping the result sorted and free of duplicates", func() {
+			// Arrange
+			ha := newSharedHAService(nil, app.HAEndpointModeEndpoints, SharedModeOptions{})
+
+			// Act
+			result := ha.desiredSharedAddresses([]string{"5.6.7.8", "1.1.1.1", testIPAddress}, true)
+
+			// Assert
+			Expect(result).To(Equal([]string{"1.1.1.1", testIPAddress, "5.6.7.8"}))
+		})
+
+		It("should remove this process' address, if not serving", func() {
+			// Arrange
+			ha := newSharedHAService(nil, app.HAEndpointModeEndpoints, SharedModeOptions{})
+
+			// Act
+			result := ha.desiredSharedAddresses([]string{"5.6.7.8", testIPAddress}, false)
+
+			// Assert
+			Expect(result).To(Equal([]string{"5.6.7.8"}))
+		})
+
+		It("should remove the addresses of replicas which are not live", func() {
+			// Arrange
+			ha := newSharedHAService(nil, app.HAEndpointModeEndpoints, SharedModeOptions{
+				LiveAddresses: func() []string { return []string{"5.6.7.8"} },
+			})
+
+			// Act
+			result := ha.desiredSharedAddresses([]string{"5.6.7.8", "9.9.9.9"}, true)
+
+			// Assert
+			Expect(result).To(Equal([]string{testIPAddress, "5.6.7.8"}))
+		})
+	})
+
+	Describe("Start", func() {
+		It("should add this process to the Endpoints alongside the other replicas, and remove it when the context "+
+			"is cancelled", func() {
+
+			// Arrange
+			fakeClient := fake.NewClientBuilder().WithObjects(newEndpoints("5.6.7.8")).Build()
+			ha := newSharedHAService(fakeClient, app.HAEndpointModeEndpoints, SharedModeOptions{})
+			ha.testIsolation.TimeAfter = func(_ time.Duration) <-chan time.Time { return make(chan time.Time) }
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var isComplete atomic.Bool
+
+			// Act
+			go func() {
+				defer GinkgoRecover()
+				Expect(ha.Start(ctx)).To(Succeed())
+				isComplete.Store(true)
+			}()
+
+			// Assert
+			Eventually(func() []string { return getEndpointIPs(fakeClient) }).
+				Should(Equal([]string{testIPAddress, "5.6.7.8"}))
+			Consistently(isComplete.Load).Should(BeFalse())
+
+			cancel()
+			Eventually(isComplete.Load).Should(BeTrue())
+			Expect(getEndpointIPs(fakeClient)).To(Equal([]string{"5.6.7.8"}))
+		})
+
+		It("should create the Endpoints, if they do not exist", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			ha := newSharedHAService(fakeClient, app.HAEndpointModeEndpoints, SharedModeOptions{})
+
+			// Act
+			err := ha.reconcileShared(context.Background(), true)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(getEndpointIPs(fakeClient)).To(Equal([]string{testIPAddress}))
+		})
+
+		It("should remove this process from the endpoints while it is not healthy, and add it back once it is", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().WithObjects(newEndpoints(testIPAddress, "5.6.7.8")).Build()
+			var isHealthy atomic.Bool
+			ha := newSharedHAService(fakeClient, app.HAEndpointModeEndpoints, SharedModeOptions{IsHealthy: isHealthy.Load})
+			timeAfterChan := make(chan time.Time)
+			ha.testIsolation.TimeAfter = func(_ time.Duration) <-chan time.Time { return timeAfterChan }
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Act and assert
+			go func() {
+				_ = ha.Start(ctx)
+			}()
+
+			Eventually(func() []string { return getEndpointIPs(fakeClient) }).Should(Equal([]string{"5.6.7.8"}))
+
+			isHealthy.Store(true)
+			timeAfterChan <- time.Now()
+			Eventually(func() []string { return getEndpointIPs(fakeClient) }).
+				Should(Equal([]string{testIPAddress, "5.6.7.8"}))
+		})
+
+		It("should keep this process out of the endpoints while the publish gate is closed", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().WithObjects(newEndpoints("5.6.7.8")).Build()
+			var isOpen atomic.Bool
+			ha := newSharedHAService(fakeClient, app.HAEndpointModeEndpoints, SharedModeOptions{})
+			ha.SetPublishGate(isOpen.Load)
+			timeAfterChan := make(chan time.Time)
+			ha.testIsolation.TimeAfter = func(_ time.Duration) <-chan time.Time { return timeAfterChan }
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Act and assert
+			go func() {
+				_ = ha.Start(ctx)
+			}()
+
+			timeAfterChan <- time.Now() // The first reconciliation is complete
+			Expect(getEndpointIPs(fakeClient)).To(Equal([]string{"5.6.7.8"}))
+
+			isOpen.Store(true)
+			timeAfterChan <- time.Now()
+			Eventually(func() []string { return getEndpointIPs(fakeClient) }).
+				Should(Equal([]string{testIPAddress, "5.6.7.8"}))
+		})
+
+		It("should maintain an endpoint slice listing all replicas, and delete it once it lists none", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			other := NewHAService(
+				fakeClient, fakeClient, testNs, "5.6.7.8", testPort, app.HAEndpointModeEndpointSlice, logr.Discard())
+			other.SetSharedMode(SharedModeOptions{})
+			ha := newSharedHAService(fakeClient, app.HAEndpointModeEndpointSlice, SharedModeOptions{})
+
+			// Act and assert
+			Expect(other.reconcileShared(context.Background(), true)).To(Succeed())
+			Expect(ha.reconcileShared(context.Background(), true)).To(Succeed())
+			slice, err := getSlice(fakeClient)
+			Expect(err).To(Succeed())
+			Expect(slice.Endpoints).To(HaveLen(2))
+			Expect(slice.Endpoints[0].Addresses).To(Equal([]string{testIPAddress}))
+			Expect(slice.Endpoints[1].Addresses).To(Equal([]string{"5.6.7.8"}))
+			Expect(*slice.Endpoints[0].Conditions.Ready).To(BeTrue())
+			Expect(slice.Labels[discoveryv1.LabelServiceName]).To(Equal(app.Name))
+			Expect(*slice.Ports[0].Port).To(Equal(int32(testPort)))
+
+			Expect(other.reconcileShared(context.Background(), false)).To(Succeed())
+			slice, err = getSlice(fakeClient)
+			Expect(err).To(Succeed())
+			Expect(slice.Endpoints).To(HaveLen(1))
+			Expect(slice.Endpoints[0].Addresses).To(Equal([]string{testIPAddress}))
+
+			Expect(ha.reconcileShared(context.Background(), false)).To(Succeed())
+			_, err = getSlice(fakeClient)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("WithdrawEndpoints", func() {
+		It("should remove only this process' address, and keep it from being added back", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().WithObjects(newEndpoints(testIPAddress, "5.6.7.8")).Build()
+			ha := newSharedHAService(fakeClient, app.HAEndpointModeEndpoints, SharedModeOptions{})
+
+			// Act
+			err := ha.WithdrawEndpoints(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(getEndpointIPs(fakeClient)).To(Equal([]string{"5.6.7.8"}))
+			Expect(ha.reconcileShared(context.Background(), ha.isServingShared())).To(Succeed())
+			Expect(getEndpointIPs(fakeClient)).To(Equal([]string{"5.6.7.8"}))
+		})
+	})
+})
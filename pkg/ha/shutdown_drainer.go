@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+// How long do we wait for the service endpoints to be withdrawn, when draining
+const endpointWithdrawalTimeout = 10 * time.Second
+
+// ShutdownDrainer coordinates the graceful shutdown of the application. Upon termination signal, instead of stopping
+// the application right away, while HPAs may be mid-request, it drains the application:
+//   - marks the application as not ready, so selector-based services stop routing requests to it
+//   - in shared mode, withdraws the address of this process from the service endpoints maintained by the HAService
+//   - keeps serving for the drain period, so requests which are already underway, or were routed based on stale
+//     endpoint information, complete
+//
+// Only then does it stop the application. In active-passive mode, the leader's endpoints are the only ones, so they
+// are not withdrawn while this process holds the leader lease, i.e. while no other replica can take over. See
+// WithdrawReleasedEndpoints.
+type ShutdownDrainer struct {
+	log         logr.Logger
+	drainPeriod time.Duration
+	haService   *HAService // Nil if the application does not manage service endpoints
+
+	isDraining atomic.Bool
+
+	testIsolation drainerTestIsolation
+}
+
+// Enables redirecting some function calls for the purposes of test isolation
+type drainerTestIsolation struct {
+	// Points to time.After
+	TimeAfter func(time.Duration) <-chan time.Time
+}
+
+// NewShutdownDrainer creates a new ShutdownDrainer instance.
+//
+// drainPeriod is how long the application keeps serving after a termination signal. Zero turns draining off.
+//
+// haService is the service which maintains the service endpoints pointing to this process. Nil if there is none.
+func NewShutdownDrainer(drainPeriod time.Duration, haService *HAService, parentLogger logr.Logger) *ShutdownDrainer {
+	return &ShutdownDrainer{
+		log:           parentLogger.WithName("shutdown-drainer"),
+		drainPeriod:   drainPeriod,
+		haService:     haService,
+		testIsolation: drainerTestIsolation{TimeAfter: time.After},
+	}
+}
+
+// ReadyzCheck implements [sigs.k8s.io/controller-runtime/pkg/healthz.Checker]. It fails once draining has started.
+func (d *ShutdownDrainer) ReadyzCheck(_ *http.Request) error {
+	if d.isDraining.Load() {
+		return errors.New("draining before shutdown")
+	}
+	return nil
+}
+
+// Run waits for signalCtx to be cancelled, then drains the application, and finally stops it by calling stop.
+// appCtx is the context of the running application. If it gets cancelled first, e.g. because the application failed,
+// Run returns without draining. If appCtx gets cancelled while draining, draining is cut short.
+func (d *ShutdownDrainer) Run(signalCtx context.Context, appCtx context.Context, stop context.CancelFunc) {
+	select {
+	case <-appCtx.Done():
+		return
+	case <-signalCtx.Done():
+	}
+	defer stop()
+
+	if d.drainPeriod <= 0 {
+		d.log.V(app.VerbosityInfo).Info("Termination signal received. Shutting down")
+		return
+	}
+
+	d.log.V(app.VerbosityInfo).Info("Termination signal received. Draining before shutdown", "period", d.drainPeriod)
+	d.isDraining.Store(true)
+	if d.haService != nil && d.haService.sharedMode != nil {
+		withdrawalCtx, cancel := context.WithTimeout(appCtx, endpointWithdrawalTimeout)
+		if err := d.haService.WithdrawEndpoints(withdrawalCtx); err != nil {
+			d.log.V(app.VerbosityError).Error(err, "Failed to withdraw service endpoints")
+		}
+		cancel()
+	}
+
+	select {
+	case <-appCtx.Done():
+	case <-d.testIsolation.TimeAfter(d.drainPeriod):
+		d.log.V(app.VerbosityInfo).Info("Drain period elapsed. Shutting down")
+	}
+}
+
+// WithdrawReleasedEndpoints withdraws the service endpoints maintained by the HAService in active-passive mode, if they
+// still point to this process. Meant to be called after the manager stopped, and released the leader lease, so another
+// replica can take over right away. Endpoints which a new leader already took over are left as they are. Has no
+// effect in shared mode, where the endpoints are withdrawn while draining, or if there is no HAService.
+func (d *ShutdownDrainer) WithdrawReleasedEndpoints() {
+	if d.haService == nil || d.haService.sharedMode != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), endpointWithdrawalTimeout)
+	defer cancel()
+	if err := d.haService.WithdrawEndpoints(ctx); err != nil {
+		d.log.V(app.VerbosityError).Error(err, "Failed to withdraw service endpoints")
+	}
+}
@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ha
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+var _ = Describe("ShutdownDrainer", func() {
+	const (
+		testNs        = "garden"
+		testIPAddress = "1.2.3.4"
+		testPort      = 777
+		drainPeriod   = 10 * time.Second
+	)
+
+	var (
+		// Creates a drainer whose drain period elapses when a value is sent on the returned channel
+		newTestDrainer = func(haService *HAService) (*ShutdownDrainer, chan time.Time, *atomic.Int64) {
+			drainer := NewShutdownDrainer(drainPeriod, haService, logr.Discard())
+			timeAfterChan := make(chan time.Time)
+			var timeAfterDuration atomic.Int64
+			drainer.testIsolation.TimeAfter = func(duration time.Duration) <-chan time.Time {
+				timeAfterDuration.Store(int64(duration))
+				return timeAfterChan
+			}
+			return drainer, timeAfterChan, &timeAfterDuration
+		}
+	)
+
+	Describe("Run", func() {
+		It("should report not ready upon signal, keep the leader's endpoints, and stop the application once the drain "+
+			"period elapses", func() {
+
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			haService := NewHAService(
+				fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
+			endpoints := &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: app.Name, Namespace: testNs}}
+			Expect(fakeClient.Create(context.Background(), endpoints)).To(Succeed())
+			Expect(haService.publishEndpoints(context.Background())).To(Succeed())
+			drainer, timeAfterChan, timeAfterDuration := newTestDrainer(haService)
+			signalCtx, signal := context.WithCancel(context.Background())
+			appCtx, stop := context.WithCancel(context.Background())
+			defer stop()
+			var isComplete atomic.Bool
+
+			// Act and assert
+			go func() {
+				drainer.Run(signalCtx, appCtx, stop)
+				isComplete.Store(true)
+			}()
+
+			Consistently(isComplete.Load).Should(BeFalse())
+			Expect(drainer.ReadyzCheck(nil)).To(Succeed())
+
+			signal()
+			Eventually(timeAfterDuration.Load).Should(Equal(int64(drainPeriod)))
+			Expect(drainer.ReadyzCheck(nil)).NotTo(Succeed())
+			Expect(fakeClient.Get(context.Background(), kclient.ObjectKeyFromObject(endpoints), endpoints)).To(Succeed())
+			Expect(endpoints.Subsets).To(HaveLen(1))
+			Consistently(isComplete.Load).Should(BeFalse())
+			Expect(appCtx.Err()).To(Succeed())
+
+			timeAfterChan <- time.Now()
+			Eventually(isComplete.Load).Should(BeTrue())
+			Expect(appCtx.Err()).To(HaveOccurred())
+		})
+
+		It("should withdraw the address of this process upon signal, in shared mode", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			haService := NewHAService(
+				fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
+			haService.SetSharedMode(SharedModeOptions{})
+			drainer, _, timeAfterDuration := newTestDrainer(haService)
+			signalCtx, signal := context.WithCancel(context.Background())
+			appCtx, stop := context.WithCancel(context.Background())
+			defer stop()
+			go drainer.Run(signalCtx, appCtx, stop)
+
+			// Act
+			signal()
+
+			// Assert
+			Eventually(timeAfterDuration.Load).Should(Equal(int64(drainPeriod)))
+			Expect(haService.isWithdrawn.Load()).To(BeTrue())
+		})
+
+		It("should stop the application right away upon signal, if the drain period is zero", func() {
+			// Arrange
+			drainer := NewShutdownDrainer(0, nil, logr.Discard())
+			signalCtx, signal := context.WithCancel(context.Background())
+			appCtx, stop := context.WithCancel(context.Background())
+			defer stop()
+			signal()
+
+			// Act
+			drainer.Run(signalCtx, appCtx, stop)
+
+			// Assert
+			Expect(appCtx.Err()).To(HaveOccurred())
+			Expect(drainer.ReadyzCheck(nil)).To(Succeed())
+		})
+
+		It("should return without draining, if the application stops before any signal", func() {
+			// Arrange
+			drainer, _, timeAfterDuration := newTestDrainer(nil)
+			appCtx, stop := context.WithCancel(context.Background())
+			stop()
+
+			// Act
+			drainer.Run(context.Background(), appCtx, stop)
+
+			// Assert
+			Expect(timeAfterDuration.Load()).To(BeZero())
+			Expect(drainer.ReadyzCheck(nil)).To(Succeed())
+		})
+
+		It("should cut draining short, if the application stops while draining", func() {
+			// Arrange
+			drainer, _, timeAfterDuration := newTestDrainer(nil)
+			signalCtx, signal := context.WithCancel(context.Background())
+			appCtx, stop := context.WithCancel(context.Background())
+			defer stop()
+			var isComplete atomic.Bool
+			go func() {
+				drainer.Run(signalCtx, appCtx, stop)
+				isComplete.Store(true)
+			}()
+			signal()
+			Eventually(timeAfterDuration.Load).Should(Equal(int64(drainPeriod)))
+
+			// Act
+			stop()
+
+			// Assert
+			Eventually(isComplete.Load).Should(BeTrue())
+		})
+	})
+
+	Describe("WithdrawReleasedEndpoints", func() {
+		It("should withdraw the leader's endpoints, if they still point to this process", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			haService := NewHAService(
+				fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
+			endpoints := &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: app.Name, Namespace: testNs}}
+			Expect(fakeClient.Create(context.Background(), endpoints)).To(Succeed())
+			Expect(haService.publishEndpoints(context.Background())).To(Succeed())
+			drainer := NewShutdownDrainer(drainPeriod, haService, logr.Discard())
+
+			// Act
+			drainer.WithdrawReleasedEndpoints()
+
+			// Assert
+			Expect(fakeClient.Get(context.Background(), kclient.ObjectKeyFromObject(endpoints), endpoints)).To(Succeed())
+			Expect(endpoints.Subsets).To(BeEmpty())
+		})
+
+		It("should leave the endpoints alone, once a new leader took them over", func() {
+			// Arrange
+			fakeClient := fake.NewClientBuilder().Build()
+			haService := NewHAService(
+				fakeClient, fakeClient, testNs, testIPAddress, testPort, app.HAEndpointModeEndpoints, logr.Discard())
+			newLeader := NewHAService(
+				fakeClient, fakeClient, testNs, "5.6.7.8", testPort, app.HAEndpointModeEndpoints, logr.Discard())
+			endpoints := &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: app.Name, Namespace: testNs}}
+			Expect(fakeClient.Create(context.Background(), endpoints)).To(Succeed())
+			Expect(haService.publishEndpoints(context.Background())).To(Succeed())
+			Expect(newLeader.publishEndpoints(context.Background())).To(Succeed())
+			drainer := NewShutdownDrainer(drainPeriod, haService, logr.Discard())
+
+			// Act
+			drainer.WithdrawReleasedEndpoints()
+
+			// Assert
+			Expect(fakeClient.Get(context.Background(), kclient.ObjectKeyFromObject(endpoints), endpoints)).To(Succeed())
+			Expect(endpoints.Subsets).To(HaveLen(1))
+			Expect(endpoints.Subsets[0].Addresses[0].IP).To(Equal("5.6.7.8"))
+		})
+	})
+})
@@ -5,16 +5,86 @@
 package input
 
 import (
+	"crypto/x509"
 	"fmt"
+	"net"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	podctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller/pod"
+	secretctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller/secret"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/etcd"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/metrics_scraper"
+	"github.com/gardener/gardener-custom-metrics/pkg/util/flagutil"
 )
 
 const (
-	scrapePeriodFlagName            = "scrape-period"
-	scrapeFlowControlPeriodFlagName = "scrape-flow-control-period"
-	minSampleGapFlagName            = "min-sample-gap"
+	scrapePeriodFlagName                = "scrape-period"
+	scrapeFlowControlPeriodFlagName     = "scrape-flow-control-period"
+	minSampleGapFlagName                = "min-sample-gap"
+	scrapeProxyURLFlagName              = "scrape-proxy-url"
+	staleKapiFaultCountFlagName         = "stale-kapi-fault-count"
+	staleKapiCheckPeriodFlagName        = "stale-kapi-check-period"
+	namespaceIncludeFlagName            = "namespace-include"
+	namespaceExcludeFlagName            = "namespace-exclude"
+	tokenSourceFlagName                 = "token-source"
+	tokenRequestKubeconfigFlagName      = "token-request-kubeconfig-secret"
+	tokenRequestSAFlagName              = "token-request-service-account"
+	tokenRequestExpirationFlagName      = "token-request-expiration"
+	tokenDirectoryFlagName              = "token-directory"
+	podIPFamilyFlagName                 = "pod-ip-family"
+	podCIDRsFlagName                    = "pod-cidrs"
+	metricsPortNameFlagName             = "metrics-port-name"
+	shootScrapeConcurrencyFlagName      = "max-shoot-scrape-concurrency"
+	shootScrapeRateFlagName             = "max-shoot-scrape-rate"
+	shootFirstScrapeConcurrencyFlagName = "max-shoot-first-scrape-concurrency"
+	scrapeSchemeFlagName                = "scrape-scheme"
+	scrapeInsecureFlagName              = "scrape-insecure-skip-tls-verify"
+	scrapeTLSServerNameFlagName         = "scrape-tls-server-name"
+	maxScrapeResponseSizeFlagName       = "max-scrape-response-size"
+	etcdMetricsFlagName                 = "etcd-metrics"
+	etcdMetricsPortFlagName             = "etcd-metrics-port"
+	caGracePeriodFlagName               = "ca-grace-period"
+	caFallbackBundleFlagName            = "ca-fallback-bundle"
+	backgroundScrapePeriodFlagName      = "background-scrape-period"
+	consumerWindowFlagName              = "consumer-window"
+	tlsSessionCacheSizeFlagName         = "scrape-tls-session-cache-size"
+	tlsCurvePreferencesFlagName         = "scrape-tls-curve-preferences"
+	tlsIdentityPatternFlagName          = "scrape-tls-identity-pattern"
+	tlsPinPodIPFlagName                 = "scrape-tls-pin-pod-ip"
+	scrapeProtobufFlagName              = "scrape-protobuf"
+	scrapeDisableGzipFlagName           = "scrape-disable-gzip"
+	scrapeReadBufferSizeFlagName        = "scrape-read-buffer-size"
+	warmupMinCoverageFlagName           = "warmup-min-coverage"
+	warmupMaxWaitFlagName               = "warmup-max-wait"
+	syncBarrierTimeoutFlagName          = "sync-barrier-timeout"
+
+	// TokenSourceSecret directs that shoot access tokens are read from the shoot access secret
+	TokenSourceSecret = "secret"
+	// TokenSourceTokenRequest directs that shoot access tokens are requested via the TokenRequest API
+	TokenSourceTokenRequest = "token-request"
+	// TokenSourceFile directs that shoot access tokens are read from files, one per shoot namespace, under a directory
+	TokenSourceFile = "file"
+
+	minTokenRequestExpiration = 10 * time.Minute // The TokenRequest API rejects shorter lifetimes
+
+	// PodIPFamilyPrimary directs that dual-stack Kapi pods are scraped via their primary IP address
+	PodIPFamilyPrimary = "primary"
+
+	simulateFlagName               = "simulate"
+	simulateShootsFlagName         = "simulate-shoots"
+	simulateKapisFlagName          = "simulate-kapis-per-shoot"
+	simulateWaveformFlagName       = "simulate-waveform"
+	simulateBaseRateFlagName       = "simulate-base-rate"
+	simulateAmplitudeFlagName      = "simulate-amplitude"
+	simulateWaveformPeriodFlagName = "simulate-waveform-period"
 )
 
 // CLIOptions are command line options related to processing the data on which custom metrics are based.
@@ -25,6 +95,71 @@ type CLIOptions struct {
 	ScrapePeriod            time.Duration
 	ScrapeFlowControlPeriod time.Duration
 	MinSampleGap            time.Duration
+	ScrapeProxyURL          string
+	StaleKapiFaultCount     int
+	StaleKapiCheckPeriod    time.Duration
+	NamespaceInclude        []string
+	NamespaceExclude        []string
+	TokenSource             string
+	// The TokenRequest fields only apply if TokenSource is TokenSourceTokenRequest
+	TokenRequestKubeconfigSecret string
+	TokenRequestServiceAccount   string // In <namespace>/<name> format
+	TokenRequestExpiration       time.Duration
+	// Only applies if TokenSource is TokenSourceFile
+	TokenDirectory string
+	// One of PodIPFamilyPrimary, "IPv4", "IPv6"
+	PodIPFamily string
+	// In CIDR notation. Empty means no pod address is preferred based on its CIDR.
+	PodCIDRs []string
+	// If not empty, pods are scraped at each container port of this name
+	MetricsPortName string
+	// Zero means no limit
+	MaxShootScrapeConcurrency int
+	MaxShootScrapeRate        float64
+	// Zero means no limit
+	MaxShootFirstScrapeConcurrency int
+	// One of input_data_registry.ScrapeSchemeHTTPS, input_data_registry.ScrapeSchemeHTTP
+	ScrapeScheme                string
+	ScrapeInsecureSkipTLSVerify bool
+	// A server name, or input_data_registry.TLSServerNameAny
+	ScrapeTLSServerName string
+	// In bytes, after decompression
+	MaxScrapeResponseSize int64
+	EnableEtcdMetrics     bool
+	// Only applies if EnableEtcdMetrics is true
+	EtcdMetricsPort int
+	CAGracePeriod   time.Duration
+	// Path to a PEM file. Empty means no fallback.
+	CAFallbackBundle string
+	// Zero disables background scraping
+	BackgroundScrapePeriod time.Duration
+	// Only applies if BackgroundScrapePeriod is not zero
+	ConsumerWindow time.Duration
+	// Zero disables TLS session resumption
+	TLSSessionCacheSize int
+	// Curve names, as accepted by metrics_scraper.ParseCurveID. Empty means the Go defaults.
+	TLSCurvePreferences []string
+	// A regular expression, as accepted by metrics_scraper.ParseIdentityPattern. Empty disables the check.
+	TLSIdentityPattern string
+	TLSPinPodIP        bool
+	ScrapeProtobuf     bool
+	ScrapeDisableGzip  bool
+	// In bytes. Must not be less than metrics_scraper.DefaultReadBufferSize.
+	ScrapeReadBufferSize int
+	// Zero disables the warmup gate
+	WarmupMinCoverage float64
+	// Only applies if WarmupMinCoverage is not zero
+	WarmupMaxWait time.Duration
+	// Zero disables the sync barrier
+	SyncBarrierTimeout time.Duration
+	// The Simulate fields only apply if Simulate is true
+	Simulate               bool
+	SimulateShoots         int
+	SimulateKapisPerShoot  int
+	SimulateWaveform       string
+	SimulateBaseRate       float64
+	SimulateAmplitude      float64
+	SimulateWaveformPeriod time.Duration
 
 	// PodController contains Pod controller options.
 	PodController *ControllerOptions
@@ -38,6 +173,34 @@ func NewCLIOptions() *CLIOptions {
 		ScrapePeriod:            60 * time.Second,
 		ScrapeFlowControlPeriod: 200 * time.Millisecond,
 		MinSampleGap:            10 * time.Second,
+		StaleKapiFaultCount:     10,
+		StaleKapiCheckPeriod:    5 * time.Minute,
+		TokenSource:             TokenSourceSecret,
+
+		MaxShootFirstScrapeConcurrency: 1,
+
+		TokenRequestKubeconfigSecret: "generic-token-kubeconfig",
+		TokenRequestServiceAccount:   "kube-system/gardener-custom-metrics",
+		TokenRequestExpiration:       time.Hour,
+		TokenDirectory:               "/var/run/secrets/gardener-custom-metrics/shoots",
+		PodIPFamily:                  PodIPFamilyPrimary,
+		ScrapeScheme:                 input_data_registry.ScrapeSchemeHTTPS,
+		ScrapeTLSServerName:          input_data_registry.DefaultTLSServerName,
+		MaxScrapeResponseSize:        metrics_scraper.DefaultMaxResponseSize,
+		EtcdMetricsPort:              2381,
+		CAGracePeriod:                10 * time.Minute,
+		ConsumerWindow:               10 * time.Minute,
+		TLSSessionCacheSize:          metrics_scraper.DefaultTLSSessionCacheSize,
+		ScrapeReadBufferSize:         metrics_scraper.DefaultReadBufferSize,
+		WarmupMaxWait:                3 * time.Minute,
+		SyncBarrierTimeout:           30 * time.Second,
+
+		SimulateShoots:         10,
+		SimulateKapisPerShoot:  2,
+		SimulateWaveform:       WaveformSine,
+		SimulateBaseRate:       100,
+		SimulateAmplitude:      50,
+		SimulateWaveformPeriod: 10 * time.Minute,
 		PodController: &ControllerOptions{
 			MaxConcurrentReconciles: 10,
 		},
@@ -66,13 +229,389 @@ func (options *CLIOptions) AddFlags(flags *pflag.FlagSet) {
 		minSampleGapFlagName,
 		options.MinSampleGap,
 		fmt.Sprintf(
-			"If the last two metrics samples are closer in time than this, don't use them to calculate rate. Default: %d",
+			"If the last two metrics samples are closer in time than this, don't use them to calculate rate. Capped at "+
+				"a third of the scrape period, including per-namespace scrape period overrides. Default: %d",
 			options.MinSampleGap))
+	flags.StringVar(
+		&options.ScrapeProxyURL,
+		scrapeProxyURLFlagName,
+		options.ScrapeProxyURL,
+		fmt.Sprintf(
+			"If specified, kube-apiserver pods are scraped through the HTTP CONNECT (http/https scheme) or SOCKS5 "+
+				"(socks5 scheme) proxy at this URL, e.g. a reversed VPN or konnectivity tunnel endpoint. "+
+				"Any occurrence of '%s' is replaced by the shoot namespace. Default: direct connection",
+			metrics_scraper.ProxyURLNamespacePlaceholder))
+	flags.IntVar(
+		&options.StaleKapiFaultCount,
+		staleKapiFaultCountFlagName,
+		options.StaleKapiFaultCount,
+		fmt.Sprintf(
+			"After this many consecutive failed scrapes, check whether the kube-apiserver pod still exists, and stop "+
+				"tracking it if it doesn't. Zero disables the check. Default: %d",
+			options.StaleKapiFaultCount))
+	flags.DurationVar(
+		&options.StaleKapiCheckPeriod,
+		staleKapiCheckPeriodFlagName,
+		options.StaleKapiCheckPeriod,
+		fmt.Sprintf(
+			"How often do we check for kube-apiserver pods which fail to scrape because they no longer exist. Default: %s",
+			options.StaleKapiCheckPeriod))
+
+	flags.StringSliceVar(
+		&options.NamespaceInclude,
+		namespaceIncludeFlagName,
+		options.NamespaceInclude,
+		"If specified, only kube-apiserver pods in shoot namespaces matching at least one of these glob patterns "+
+			"(e.g. 'shoot--garden-*') are scraped. Default: all shoot namespaces")
+	flags.StringSliceVar(
+		&options.NamespaceExclude,
+		namespaceExcludeFlagName,
+		options.NamespaceExclude,
+		fmt.Sprintf(
+			"Kube-apiserver pods in shoot namespaces matching any of these glob patterns are not scraped, even if they "+
+				"match --%s. Default: none",
+			namespaceIncludeFlagName))
+
+	flags.StringVar(
+		&options.TokenSource,
+		tokenSourceFlagName,
+		options.TokenSource,
+		fmt.Sprintf(
+			"Where do shoot access tokens used for scraping come from. '%s': read from the shoot access secret, which "+
+				"is maintained externally. '%s': requested from the shoot via the TokenRequest API, and refreshed "+
+				"before they expire. '%s': read from files mounted into the pod, e.g. projected by another workload, "+
+				"see --%s. Default: %s",
+			TokenSourceSecret, TokenSourceTokenRequest, TokenSourceFile, tokenDirectoryFlagName, options.TokenSource))
+	flags.StringVar(
+		&options.TokenRequestKubeconfigSecret,
+		tokenRequestKubeconfigFlagName,
+		options.TokenRequestKubeconfigSecret,
+		fmt.Sprintf(
+			"In '%s' mode, the 'name' label of the secret in each shoot namespace, whose 'kubeconfig' key points to "+
+				"the shoot kube-apiserver. The secret's actual name may carry a hash suffix. Tokens are requested "+
+				"with the token in the shoot access secret. Default: %s",
+			TokenSourceTokenRequest, options.TokenRequestKubeconfigSecret))
+	flags.StringVar(
+		&options.TokenRequestServiceAccount,
+		tokenRequestSAFlagName,
+		options.TokenRequestServiceAccount,
+		fmt.Sprintf(
+			"In '%s' mode, the shoot service account, in <namespace>/<name> format, for which tokens are requested. "+
+				"Default: %s",
+			TokenSourceTokenRequest, options.TokenRequestServiceAccount))
+	flags.DurationVar(
+		&options.TokenRequestExpiration,
+		tokenRequestExpirationFlagName,
+		options.TokenRequestExpiration,
+		fmt.Sprintf(
+			"In '%s' mode, the requested token lifetime. Tokens are refreshed after 80%% of their lifetime. "+
+				"Minimum: %s. Default: %s",
+			TokenSourceTokenRequest, minTokenRequestExpiration, options.TokenRequestExpiration))
+	flags.StringVar(
+		&options.TokenDirectory,
+		tokenDirectoryFlagName,
+		options.TokenDirectory,
+		fmt.Sprintf(
+			"In '%s' mode, the directory which contains one subdirectory per shoot namespace, named after the "+
+				"namespace. The shoot's access token is read from the '%s' file in that subdirectory, and re-read "+
+				"when it changes. CA certificates are still read from the shoot's CA secrets. Default: %s",
+			TokenSourceFile, tokenFileName, options.TokenDirectory))
+
+	flags.StringVar(
+		&options.PodIPFamily,
+		podIPFamilyFlagName,
+		options.PodIPFamily,
+		fmt.Sprintf(
+			"Which address of dual-stack kube-apiserver pods is scraped. '%s': the pod's primary address. '%s' or "+
+				"'%s': the address of that IP family, if the pod has one. If scraping keeps failing, the address of "+
+				"the other IP family is tried. Default: %s",
+			PodIPFamilyPrimary, corev1.IPv4Protocol, corev1.IPv6Protocol, options.PodIPFamily))
+	flags.StringSliceVar(
+		&options.PodCIDRs,
+		podCIDRsFlagName,
+		options.PodCIDRs,
+		"The seed cluster's pod CIDRs. Of the addresses of a kube-apiserver pod, the ones within these CIDRs are "+
+			"scraped in preference to the others of the same IP family, e.g. to the node addresses reported by pods in "+
+			"the host network. If empty, no address is preferred based on its CIDR.")
+	flags.StringVar(
+		&options.MetricsPortName,
+		metricsPortNameFlagName,
+		options.MetricsPortName,
+		"If not empty, kube-apiserver pods whose containers declare ports of this name are scraped at each such port, "+
+			"and the request counters are summed, e.g. to also account for the requests served by an apiserver-proxy sidecar. "+
+			"Pods without such ports are scraped at the port specified by their metrics port annotation, as usual.")
+	flags.IntVar(
+		&options.MaxShootScrapeConcurrency,
+		shootScrapeConcurrencyFlagName,
+		options.MaxShootScrapeConcurrency,
+		"The maximum number of scrapes in progress at the same time, against the kube-apiserver pods of a single "+
+			"shoot. Zero means no limit.")
+	flags.Float64Var(
+		&options.MaxShootScrapeRate,
+		shootScrapeRateFlagName,
+		options.MaxShootScrapeRate,
+		"The maximum number of scrapes per second, against the kube-apiserver pods of a single shoot. Protects "+
+			"shoots with many kube-apiserver replicas from bursts of scrapes. Zero means no limit.")
+	flags.IntVar(
+		&options.MaxShootFirstScrapeConcurrency,
+		shootFirstScrapeConcurrencyFlagName,
+		options.MaxShootFirstScrapeConcurrency,
+		fmt.Sprintf(
+			"The maximum number of first scrapes of newly created kube-apiserver pods in progress at the same time, "+
+				"per shoot. The first scrapes of new pods are spread over a scrape period. This additionally protects "+
+				"shoots whose kube-apiserver pods get replaced at once, e.g. during a seed upgrade, from bursts of "+
+				"first scrapes. Zero means no limit. Default: %d",
+			options.MaxShootFirstScrapeConcurrency))
+	flags.StringVar(
+		&options.ScrapeScheme,
+		scrapeSchemeFlagName,
+		options.ScrapeScheme,
+		fmt.Sprintf(
+			"The URL scheme used to scrape kube-apiserver pods: '%s' or '%s'. Plain http is meant for test "+
+				"environments, where e.g. a sidecar terminates mTLS in front of the kube-apiserver. Individual shoots "+
+				"can override this via the %s namespace annotation. Default: %s",
+			input_data_registry.ScrapeSchemeHTTPS, input_data_registry.ScrapeSchemeHTTP,
+			podctl.ScrapeSchemeAnnotation, options.ScrapeScheme))
+	flags.BoolVar(
+		&options.ScrapeInsecureSkipTLSVerify,
+		scrapeInsecureFlagName,
+		options.ScrapeInsecureSkipTLSVerify,
+		fmt.Sprintf(
+			"If set, the serving certificates of kube-apiserver pods are not verified when scraping. Meant for "+
+				"development clusters only. Individual shoots can override this via the %s namespace annotation.",
+			podctl.InsecureSkipTLSVerifyAnnotation))
+	flags.StringVar(
+		&options.ScrapeTLSServerName,
+		scrapeTLSServerNameFlagName,
+		options.ScrapeTLSServerName,
+		fmt.Sprintf(
+			"The server name which the serving certificates of kube-apiserver pods are expected to carry. The value "+
+				"'%s' accepts any server name, as long as the certificate is signed by the shoot CA - a fallback for "+
+				"kube-apiservers whose certificates do not carry a predictable server name. Individual shoots can "+
+				"override this via the %s namespace annotation. Default: %s",
+			input_data_registry.TLSServerNameAny, podctl.TLSServerNameAnnotation, options.ScrapeTLSServerName))
+	flags.Int64Var(
+		&options.MaxScrapeResponseSize,
+		maxScrapeResponseSizeFlagName,
+		options.MaxScrapeResponseSize,
+		fmt.Sprintf(
+			"The maximum size, in bytes, of a kube-apiserver metrics response, after decompression. Larger responses "+
+				"fail the scrape, which protects the application from running out of memory, if a kube-apiserver "+
+				"misbehaves. Default: %d",
+			options.MaxScrapeResponseSize))
+	flags.BoolVar(
+		&options.EnableEtcdMetrics,
+		etcdMetricsFlagName,
+		options.EnableEtcdMetrics,
+		fmt.Sprintf(
+			"If set, the shoot etcd pods (label %s=%s) are scraped too, and their etcd_server_* counters are served as "+
+				"separate custom metrics, e.g. to autoscale etcd.",
+			etcd.EtcdPodLabelKey, etcd.EtcdPodLabelValue))
+	flags.IntVar(
+		&options.EtcdMetricsPort,
+		etcdMetricsPortFlagName,
+		options.EtcdMetricsPort,
+		fmt.Sprintf(
+			"The port at which etcd pods serve metrics over plain HTTP, as configured via etcd's "+
+				"--listen-metrics-urls option. Only applies with --%s. Default: %d",
+			etcdMetricsFlagName, options.EtcdMetricsPort))
+	flags.DurationVar(
+		&options.CAGracePeriod,
+		caGracePeriodFlagName,
+		options.CAGracePeriod,
+		fmt.Sprintf(
+			"How long the last seen CA certificate of a shoot keeps being used to verify its kube-apiservers, after the "+
+				"shoot's CA secret goes missing, e.g. during CA rotation. Zero disables that. Default: %s",
+			options.CAGracePeriod))
+	flags.StringVar(
+		&options.CAFallbackBundle,
+		caFallbackBundleFlagName,
+		options.CAFallbackBundle,
+		fmt.Sprintf(
+			"If not empty, the path to a PEM file with CA certificates, e.g. the seed cluster's generic CA bundle, "+
+				"which are used to verify the kube-apiservers of shoots whose CA secret is missing, once the --%s "+
+				"expires. If empty, such shoots are not scraped.",
+			caGracePeriodFlagName))
+	flags.DurationVar(
+		&options.BackgroundScrapePeriod,
+		backgroundScrapePeriodFlagName,
+		options.BackgroundScrapePeriod,
+		fmt.Sprintf(
+			"If not zero, the kube-apiservers of shoots whose custom metrics were not queried within the --%s are "+
+				"scraped at this longer period, instead of the --%s. A query brings the shoot back to the regular "+
+				"scrape period immediately. Zero scrapes all shoots at the regular period.",
+			consumerWindowFlagName, scrapePeriodFlagName))
+	flags.DurationVar(
+		&options.ConsumerWindow,
+		consumerWindowFlagName,
+		options.ConsumerWindow,
+		fmt.Sprintf(
+			"How long after the last query of its custom metrics a shoot keeps being scraped at the regular period. "+
+				"Only applies with --%s. Default: %s",
+			backgroundScrapePeriodFlagName, options.ConsumerWindow))
+	flags.IntVar(
+		&options.TLSSessionCacheSize,
+		tlsSessionCacheSizeFlagName,
+		options.TLSSessionCacheSize,
+		fmt.Sprintf(
+			"The number of TLS sessions cached by each shoot's scrape client, so that new connections to the "+
+				"kube-apiservers resume a previous session, instead of performing a full handshake. Zero disables "+
+				"session resumption. Default: %d",
+			options.TLSSessionCacheSize))
+	flags.StringSliceVar(
+		&options.TLSCurvePreferences,
+		tlsCurvePreferencesFlagName,
+		options.TLSCurvePreferences,
+		"The elliptic curves used in the TLS key exchange with the kube-apiservers, in order of preference. "+
+			"Any of X25519, P256, P384, P521. If empty, the Go defaults apply.")
+	flags.StringVar(
+		&options.TLSIdentityPattern,
+		tlsIdentityPatternFlagName,
+		options.TLSIdentityPattern,
+		"If not empty, a regular expression which at least one DNS name in the serving certificate of a "+
+			"kube-apiserver pod must match entirely, e.g. 'kube-apiserver(\\..+)?'. Applies on top of the regular "+
+			"certificate verification, so only endpoints with a kube-apiserver identity are scraped, rather than any "+
+			"endpoint with a certificate signed by the shoot CA.")
+	flags.BoolVar(
+		&options.TLSPinPodIP,
+		tlsPinPodIPFlagName,
+		options.TLSPinPodIP,
+		"If set, the serving certificate of a kube-apiserver pod must carry the pod's IP address, as an IP SAN. "+
+			"Guards against scraping another endpoint, which took over the IP address of a deleted pod. Only for "+
+			"setups where the kube-apiservers' serving certificates carry their pod IPs.")
+	flags.BoolVar(
+		&options.ScrapeProtobuf,
+		scrapeProtobufFlagName,
+		options.ScrapeProtobuf,
+		"If set, scrapes prefer the Prometheus protobuf exposition format, which is considerably cheaper to parse "+
+			"than the text format. kube-apiservers which do not support it keep responding in the text format.")
+	flags.BoolVar(
+		&options.ScrapeDisableGzip,
+		scrapeDisableGzipFlagName,
+		options.ScrapeDisableGzip,
+		"If set, scrapes never request gzip compressed responses. By default, compression is requested from the "+
+			"kube-apiservers whose responses proved to compress well. On fast seed networks, decompression may cost "+
+			"more CPU than the bandwidth it saves is worth.")
+	flags.IntVar(
+		&options.ScrapeReadBufferSize,
+		scrapeReadBufferSizeFlagName,
+		options.ScrapeReadBufferSize,
+		fmt.Sprintf(
+			"The size, in bytes, of the buffer through which each kube-apiserver metrics response is parsed. A larger "+
+				"buffer takes fewer reads to consume a large response, at the cost of memory for each concurrent "+
+				"scrape. Must not be less than %d. Default: %d",
+			metrics_scraper.DefaultReadBufferSize, options.ScrapeReadBufferSize))
+	flags.Float64Var(
+		&options.WarmupMinCoverage,
+		warmupMinCoverageFlagName,
+		options.WarmupMinCoverage,
+		fmt.Sprintf(
+			"If greater than zero, once scraping starts, e.g. upon leader election, the application reports itself "+
+				"as not ready, and the service is not pointed to it, until this fraction (0-1] of the known "+
+				"kube-apiserver pods have a fresh metrics sample, or until --%s elapses. This keeps consumers from "+
+				"seeing the empty values of a freshly elected leader. Zero disables the wait.",
+			warmupMaxWaitFlagName))
+	flags.DurationVar(
+		&options.WarmupMaxWait,
+		warmupMaxWaitFlagName,
+		options.WarmupMaxWait,
+		fmt.Sprintf(
+			"The maximum time the application waits for the first scrape wave to reach --%s. Default: %s",
+			warmupMinCoverageFlagName, options.WarmupMaxWait))
+	flags.DurationVar(
+		&options.SyncBarrierTimeout,
+		syncBarrierTimeoutFlagName,
+		options.SyncBarrierTimeout,
+		fmt.Sprintf(
+			"Once scraping starts, the maximum time it waits for the pod and secret informers to sync, and for the "+
+				"shoot of each kube-apiserver pod to have an access token on record, before the first scrape of the pod. "+
+				"Avoids a burst of futile scrapes upon startup. Zero disables the wait. Default: %s",
+			options.SyncBarrierTimeout))
+
+	flags.BoolVar(
+		&options.Simulate,
+		simulateFlagName,
+		options.Simulate,
+		"Instead of scraping the kube-apiservers of actual shoots, serve metrics for synthetic shoots, whose request "+
+			"rates evolve according to a configurable waveform. Meant for load testing, e.g. in a kind cluster. The "+
+			"shoot namespaces are named 'shoot--sim--shoot-<i>', and the pods 'kube-apiserver-sim-<j>'.")
+	flags.IntVar(
+		&options.SimulateShoots,
+		simulateShootsFlagName,
+		options.SimulateShoots,
+		fmt.Sprintf("In simulation mode, the number of simulated shoots. Default: %d", options.SimulateShoots))
+	flags.IntVar(
+		&options.SimulateKapisPerShoot,
+		simulateKapisFlagName,
+		options.SimulateKapisPerShoot,
+		fmt.Sprintf(
+			"In simulation mode, the number of kube-apiserver pods per simulated shoot. Default: %d",
+			options.SimulateKapisPerShoot))
+	flags.StringVar(
+		&options.SimulateWaveform,
+		simulateWaveformFlagName,
+		options.SimulateWaveform,
+		fmt.Sprintf(
+			"In simulation mode, the shape of the request rate over time. One of '%s', '%s', '%s', '%s'. "+
+				"The waves of different shoots are phase shifted relative to each other. Default: %s",
+			WaveformConstant, WaveformSine, WaveformSquare, WaveformSawtooth, options.SimulateWaveform))
+	flags.Float64Var(
+		&options.SimulateBaseRate,
+		simulateBaseRateFlagName,
+		options.SimulateBaseRate,
+		fmt.Sprintf(
+			"In simulation mode, the average request rate, in requests per second, of each kube-apiserver pod. "+
+				"Default: %g",
+			options.SimulateBaseRate))
+	flags.Float64Var(
+		&options.SimulateAmplitude,
+		simulateAmplitudeFlagName,
+		options.SimulateAmplitude,
+		fmt.Sprintf(
+			"In simulation mode, how far, in requests per second, the request rate deviates from the base rate at the "+
+				"peaks of the wave. Default: %g",
+			options.SimulateAmplitude))
+	flags.DurationVar(
+		&options.SimulateWaveformPeriod,
+		simulateWaveformPeriodFlagName,
+		options.SimulateWaveformPeriod,
+		fmt.Sprintf("In simulation mode, the period of the request rate wave. Default: %s", options.SimulateWaveformPeriod))
 
 	options.PodController.AddFlags(flags, "pod-")
 	options.SecretController.AddFlags(flags, "secret-")
 }
 
+// Defaults returns the default values which AddFlags registers for the flags it binds, keyed by flag name. Those are
+// the current values of the options, so Defaults called on the result of NewCLIOptions yields the effective defaults.
+// See [flagutil.Defaults] for the form of the values. Does not modify the options.
+func (options *CLIOptions) Defaults() (map[string]interface{}, error) {
+	optionsCopy := *options
+	podController, secretController := *options.PodController, *options.SecretController
+	optionsCopy.PodController, optionsCopy.SecretController = &podController, &secretController
+	flags := pflag.NewFlagSet("input", pflag.ContinueOnError)
+	optionsCopy.AddFlags(flags)
+	return flagutil.Defaults(flags)
+}
+
+// SecretNames returns the names of the seed secrets which the configured token source requires. Unlike most settings,
+// available before Complete is called, because the manager's cache, which is restricted to those secrets, is created
+// first.
+func (options *CLIOptions) SecretNames() []string {
+	if options.TokenSource == TokenSourceTokenRequest {
+		return secretctl.SecretNames(options.TokenRequestKubeconfigSecret)
+	}
+	return secretctl.SecretNames("")
+}
+
+// CachedPodLabels returns the label selector of the seed pods, other than the Kapi pods, which the input data service
+// watches via the manager's cache, or nil if there are none. Like SecretNames, available before Complete is called.
+func (options *CLIOptions) CachedPodLabels() labels.Selector {
+	if options.EnableEtcdMetrics {
+		return etcd.PodLabelSelector()
+	}
+	return nil
+}
+
 // Complete implements [github.com/gardener/gardener/extensions/pkg/controller/cmd.Completer.Complete].
 func (options *CLIOptions) Complete() error {
 	if err := options.PodController.Complete(); err != nil {
@@ -81,18 +620,309 @@ func (options *CLIOptions) Complete() error {
 	if err := options.SecretController.Complete(); err != nil {
 		return fmt.Errorf("failed to complete secret controller options: %w", err)
 	}
+	if options.ScrapePeriod <= 0 {
+		return fmt.Errorf("the --%s option must be positive", scrapePeriodFlagName)
+	}
+	if options.ScrapeFlowControlPeriod <= 0 {
+		return fmt.Errorf("the --%s option must be positive", scrapeFlowControlPeriodFlagName)
+	}
+	if options.MinSampleGap < 0 {
+		return fmt.Errorf("the --%s option must not be negative", minSampleGapFlagName)
+	}
+	if options.StaleKapiFaultCount < 0 {
+		return fmt.Errorf("the --%s option must not be negative", staleKapiFaultCountFlagName)
+	}
+	if options.StaleKapiFaultCount > 0 && options.StaleKapiCheckPeriod <= 0 {
+		return fmt.Errorf("the --%s option must be positive", staleKapiCheckPeriodFlagName)
+	}
+	if _, err := metrics_scraper.ResolveProxyURL(options.ScrapeProxyURL, "shoot--validation"); err != nil {
+		return fmt.Errorf("invalid --%s option: %w", scrapeProxyURLFlagName, err)
+	}
+
+	namespaceFilter := metrics_scraper.NamespaceFilter{
+		Include: options.NamespaceInclude,
+		Exclude: options.NamespaceExclude,
+	}
+	if err := namespaceFilter.Validate(); err != nil {
+		return fmt.Errorf("invalid --%s or --%s option: %w", namespaceIncludeFlagName, namespaceExcludeFlagName, err)
+	}
+
+	var podIPFamily corev1.IPFamily
+	switch options.PodIPFamily {
+	case PodIPFamilyPrimary:
+	case string(corev1.IPv4Protocol), string(corev1.IPv6Protocol):
+		podIPFamily = corev1.IPFamily(options.PodIPFamily)
+	default:
+		return fmt.Errorf(
+			"the --%s option must be one of '%s', '%s', '%s'",
+			podIPFamilyFlagName, PodIPFamilyPrimary, corev1.IPv4Protocol, corev1.IPv6Protocol)
+	}
+	var podCIDRs []*net.IPNet
+	for _, podCIDR := range options.PodCIDRs {
+		_, ipNet, err := net.ParseCIDR(podCIDR)
+		if err != nil {
+			return fmt.Errorf("invalid --%s option: %w", podCIDRsFlagName, err)
+		}
+		podCIDRs = append(podCIDRs, ipNet)
+	}
+
+	if options.MetricsPortName != "" {
+		if errs := validation.IsValidPortName(options.MetricsPortName); len(errs) > 0 {
+			return fmt.Errorf("invalid --%s option: %s", metricsPortNameFlagName, strings.Join(errs, "; "))
+		}
+	}
+
+	if options.MaxShootScrapeConcurrency < 0 {
+		return fmt.Errorf("the --%s option must not be negative", shootScrapeConcurrencyFlagName)
+	}
+	if options.MaxShootScrapeRate < 0 {
+		return fmt.Errorf("the --%s option must not be negative", shootScrapeRateFlagName)
+	}
+	if options.MaxShootFirstScrapeConcurrency < 0 {
+		return fmt.Errorf("the --%s option must not be negative", shootFirstScrapeConcurrencyFlagName)
+	}
+	if options.MaxScrapeResponseSize <= 0 {
+		return fmt.Errorf("the --%s option must be positive", maxScrapeResponseSizeFlagName)
+	}
+	if options.ScrapeReadBufferSize < metrics_scraper.DefaultReadBufferSize {
+		return fmt.Errorf(
+			"the --%s option must not be less than %d", scrapeReadBufferSizeFlagName, metrics_scraper.DefaultReadBufferSize)
+	}
+	if options.EnableEtcdMetrics && (options.EtcdMetricsPort <= 0 || options.EtcdMetricsPort > 65535) {
+		return fmt.Errorf("the --%s option must be between 1 and 65535", etcdMetricsPortFlagName)
+	}
+	switch options.ScrapeScheme {
+	case input_data_registry.ScrapeSchemeHTTPS, input_data_registry.ScrapeSchemeHTTP:
+	default:
+		return fmt.Errorf(
+			"the --%s option must be one of '%s', '%s'",
+			scrapeSchemeFlagName, input_data_registry.ScrapeSchemeHTTPS, input_data_registry.ScrapeSchemeHTTP)
+	}
+	if options.ScrapeTLSServerName == "" {
+		return fmt.Errorf("the --%s option must not be empty", scrapeTLSServerNameFlagName)
+	}
+	if options.CAGracePeriod < 0 {
+		return fmt.Errorf("the --%s option must not be negative", caGracePeriodFlagName)
+	}
+	if options.BackgroundScrapePeriod < 0 {
+		return fmt.Errorf("the --%s option must not be negative", backgroundScrapePeriodFlagName)
+	}
+	if options.BackgroundScrapePeriod > 0 {
+		if options.BackgroundScrapePeriod < options.ScrapePeriod {
+			return fmt.Errorf(
+				"the --%s option must not be shorter than the --%s option",
+				backgroundScrapePeriodFlagName, scrapePeriodFlagName)
+		}
+		if options.ConsumerWindow <= 0 {
+			return fmt.Errorf("the --%s option must be positive", consumerWindowFlagName)
+		}
+	}
+	if options.WarmupMinCoverage < 0 || options.WarmupMinCoverage > 1 {
+		return fmt.Errorf("the --%s option must be between 0 and 1", warmupMinCoverageFlagName)
+	}
+	if options.WarmupMinCoverage > 0 && options.WarmupMaxWait <= 0 {
+		return fmt.Errorf("the --%s option must be positive", warmupMaxWaitFlagName)
+	}
+	if options.SyncBarrierTimeout < 0 {
+		return fmt.Errorf("the --%s option must not be negative", syncBarrierTimeoutFlagName)
+	}
+	fallbackCACertPool, err := options.loadCAFallbackBundle()
+	if err != nil {
+		return err
+	}
+	tlsSettings, err := options.completeTLSSettings()
+	if err != nil {
+		return err
+	}
+
+	tokenRequest, err := options.completeTokenRequest()
+	if err != nil {
+		return err
+	}
+	var tokenDirectory string
+	if options.TokenSource == TokenSourceFile {
+		if options.TokenDirectory == "" {
+			return fmt.Errorf("the --%s option must not be empty", tokenDirectoryFlagName)
+		}
+		tokenDirectory = options.TokenDirectory
+	}
+	simulation, err := options.completeSimulation()
+	if err != nil {
+		return err
+	}
 
 	options.config = &CLIConfig{
 		ScrapePeriod:            options.ScrapePeriod,
 		ScrapeFlowControlPeriod: options.ScrapeFlowControlPeriod,
 		MinSampleGap:            options.MinSampleGap,
-		PodController:           options.PodController.Completed(),
-		SecretController:        options.SecretController.Completed(),
+		ScrapeProxyURL:          options.ScrapeProxyURL,
+		StaleKapiFaultCount:     options.StaleKapiFaultCount,
+		StaleKapiCheckPeriod:    options.StaleKapiCheckPeriod,
+		NamespaceFilter:         namespaceFilter,
+		TokenRequest:            tokenRequest,
+		TokenDirectory:          tokenDirectory,
+		PodIPFamily:             podIPFamily,
+		PodCIDRs:                podCIDRs,
+		MetricsPortName:         options.MetricsPortName,
+		ShootScrapeLimits: metrics_scraper.ShootScrapeLimits{
+			MaxConcurrency: options.MaxShootScrapeConcurrency,
+			MaxRate:        options.MaxShootScrapeRate,
+
+			MaxFirstScrapeConcurrency: options.MaxShootFirstScrapeConcurrency,
+		},
+		ScrapeSettings: input_data_registry.ShootScrapeSettings{
+			Scheme:                options.ScrapeScheme,
+			InsecureSkipTLSVerify: options.ScrapeInsecureSkipTLSVerify,
+			TLSServerName:         options.ScrapeTLSServerName,
+		},
+		Simulation:       simulation,
+		PodController:    options.PodController.Completed(),
+		SecretController: options.SecretController.Completed(),
+
+		MaxScrapeResponseSize: options.MaxScrapeResponseSize,
+		EnableEtcdMetrics:     options.EnableEtcdMetrics,
+		EtcdMetricsPort:       options.EtcdMetricsPort,
+		CAGracePeriod:         options.CAGracePeriod,
+		FallbackCACertPool:    fallbackCACertPool,
+
+		BackgroundScrapePeriod: options.BackgroundScrapePeriod,
+		ConsumerWindow:         options.ConsumerWindow,
+
+		ScrapeTLS:      tlsSettings,
+		ScrapeProtobuf: options.ScrapeProtobuf,
+		ScrapeResponse: metrics_scraper.ResponseSettings{
+			DisableGzip:    options.ScrapeDisableGzip,
+			ReadBufferSize: options.ScrapeReadBufferSize,
+		},
+
+		WarmupMinCoverage: options.WarmupMinCoverage,
+		WarmupMaxWait:     options.WarmupMaxWait,
+
+		SyncBarrierTimeout: options.SyncBarrierTimeout,
 	}
 
 	return nil
 }
 
+// loadCAFallbackBundle reads the CA certificates in the file specified by the CAFallbackBundle option. Returns nil, if
+// the option is empty.
+func (options *CLIOptions) loadCAFallbackBundle() (*x509.CertPool, error) {
+	if options.CAFallbackBundle == "" {
+		return nil, nil
+	}
+
+	bundle, err := os.ReadFile(options.CAFallbackBundle)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s option: %w", caFallbackBundleFlagName, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf(
+			"invalid --%s option: the file '%s' contains no PEM encoded certificates",
+			caFallbackBundleFlagName, options.CAFallbackBundle)
+	}
+	return pool, nil
+}
+
+// completeTLSSettings validates the scrape TLS options, and returns the resulting settings
+func (options *CLIOptions) completeTLSSettings() (metrics_scraper.TLSSettings, error) {
+	if options.TLSSessionCacheSize < 0 {
+		return metrics_scraper.TLSSettings{}, fmt.Errorf("the --%s option must not be negative", tlsSessionCacheSizeFlagName)
+	}
+	settings := metrics_scraper.TLSSettings{SessionCacheSize: options.TLSSessionCacheSize}
+	if options.TLSSessionCacheSize == 0 {
+		// In TLSSettings, zero selects the default size, and a negative size disables the cache
+		settings.SessionCacheSize = -1
+	}
+	for _, name := range options.TLSCurvePreferences {
+		curve, err := metrics_scraper.ParseCurveID(name)
+		if err != nil {
+			return metrics_scraper.TLSSettings{}, fmt.Errorf("invalid --%s option: %w", tlsCurvePreferencesFlagName, err)
+		}
+		settings.CurvePreferences = append(settings.CurvePreferences, curve)
+	}
+	if options.TLSIdentityPattern != "" {
+		pattern, err := metrics_scraper.ParseIdentityPattern(options.TLSIdentityPattern)
+		if err != nil {
+			return metrics_scraper.TLSSettings{}, fmt.Errorf("invalid --%s option: %w", tlsIdentityPatternFlagName, err)
+		}
+		settings.IdentityPattern = pattern
+	}
+	settings.PinPodIP = options.TLSPinPodIP
+	return settings, nil
+}
+
+// completeTokenRequest validates the token source options, and returns the resulting token request configuration, or nil
+// if tokens are not requested via the TokenRequest API.
+func (options *CLIOptions) completeTokenRequest() (*secretctl.TokenRequestConfig, error) {
+	switch options.TokenSource {
+	case TokenSourceSecret, TokenSourceFile:
+		return nil, nil
+	case TokenSourceTokenRequest:
+	default:
+		return nil, fmt.Errorf(
+			"the --%s option must be one of '%s', '%s', '%s'",
+			tokenSourceFlagName, TokenSourceSecret, TokenSourceTokenRequest, TokenSourceFile)
+	}
+
+	if options.TokenRequestKubeconfigSecret == "" {
+		return nil, fmt.Errorf("the --%s option must not be empty", tokenRequestKubeconfigFlagName)
+	}
+	saNamespace, saName, ok := strings.Cut(options.TokenRequestServiceAccount, "/")
+	if !ok || saNamespace == "" || saName == "" {
+		return nil, fmt.Errorf(
+			"the --%s option must be in <namespace>/<name> format, but is '%s'",
+			tokenRequestSAFlagName, options.TokenRequestServiceAccount)
+	}
+	if options.TokenRequestExpiration < minTokenRequestExpiration {
+		return nil, fmt.Errorf(
+			"the --%s option must be at least %s", tokenRequestExpirationFlagName, minTokenRequestExpiration)
+	}
+
+	return &secretctl.TokenRequestConfig{
+		KubeconfigSecretName:    options.TokenRequestKubeconfigSecret,
+		ServiceAccountNamespace: saNamespace,
+		ServiceAccountName:      saName,
+		Expiration:              options.TokenRequestExpiration,
+	}, nil
+}
+
+// completeSimulation validates the simulation options, and returns the resulting simulation configuration, or nil if
+// simulation mode is off.
+func (options *CLIOptions) completeSimulation() (*SimulationConfig, error) {
+	if !options.Simulate {
+		return nil, nil
+	}
+
+	if options.SimulateShoots <= 0 {
+		return nil, fmt.Errorf("the --%s option must be positive", simulateShootsFlagName)
+	}
+	if options.SimulateKapisPerShoot <= 0 {
+		return nil, fmt.Errorf("the --%s option must be positive", simulateKapisFlagName)
+	}
+	if err := validateSimulationWaveform(options.SimulateWaveform); err != nil {
+		return nil, fmt.Errorf("invalid --%s option: %w", simulateWaveformFlagName, err)
+	}
+	if options.SimulateBaseRate < 0 {
+		return nil, fmt.Errorf("the --%s option must not be negative", simulateBaseRateFlagName)
+	}
+	if options.SimulateAmplitude < 0 {
+		return nil, fmt.Errorf("the --%s option must not be negative", simulateAmplitudeFlagName)
+	}
+	if options.SimulateWaveformPeriod <= 0 {
+		return nil, fmt.Errorf("the --%s option must be positive", simulateWaveformPeriodFlagName)
+	}
+
+	return &SimulationConfig{
+		ShootCount:        options.SimulateShoots,
+		KapiCountPerShoot: options.SimulateKapisPerShoot,
+		Waveform:          options.SimulateWaveform,
+		BaseRate:          options.SimulateBaseRate,
+		Amplitude:         options.SimulateAmplitude,
+		WaveformPeriod:    options.SimulateWaveformPeriod,
+	}, nil
+}
+
 // Completed returns the final, processed values of the options. Only call this if `Complete` was successful.
 func (options *CLIOptions) Completed() *CLIConfig {
 	return options.config
@@ -106,9 +936,81 @@ type CLIConfig struct {
 
 	// If two consecutive metrics samples are closer than this, they are considered to not provide sufficient
 	// differential (rate) calculation accuracy, and are not used as a pair (each may still be used, paired with other
-	// samples).
+	// samples). The value actually applied is capped, based on the scrape period. See
+	// input_data_registry.EffectiveMinSampleGap.
 	MinSampleGap time.Duration
 
+	// If not empty, scrapes are routed through the proxy at this URL. See
+	// [metrics_scraper.ScraperOptions.ProxyURLTemplate].
+	ScrapeProxyURL string
+
+	// A Kapi with this many consecutive scrape faults is checked for existence, and removed from tracking if its pod no
+	// longer exists. Zero disables the check.
+	StaleKapiFaultCount int
+	// How often do we check for stale Kapis
+	StaleKapiCheckPeriod time.Duration
+
+	// Selects the shoot namespaces whose Kapis are scraped
+	NamespaceFilter metrics_scraper.NamespaceFilter
+
+	// If not nil, shoot access tokens are requested via the TokenRequest API, instead of being read from the shoot
+	// access secret
+	TokenRequest *secretctl.TokenRequestConfig
+	// If not empty, shoot access tokens are read from files under this directory, instead of from the shoot access
+	// secret. See tokenFileWatcher.
+	TokenDirectory string
+
+	// Dual-stack Kapi pods are scraped via their address of this IP family. If empty, via their primary address.
+	PodIPFamily corev1.IPFamily
+	// Addresses of Kapi pods within these CIDRs are scraped in preference to the pods' other addresses of the same IP
+	// family. May be empty.
+	PodCIDRs []*net.IPNet
+	// If not empty, Kapi pods are scraped at each container port of this name, and the values are summed
+	MetricsPortName string
+	// Caps the scrape load on each individual shoot
+	ShootScrapeLimits metrics_scraper.ShootScrapeLimits
+	// The scrape settings which apply to shoots without settings of their own. See podctl.ScrapeSchemeAnnotation.
+	ScrapeSettings input_data_registry.ShootScrapeSettings
+	// Kapi metrics responses larger than this many bytes, after decompression, fail the scrape
+	MaxScrapeResponseSize int64
+
+	// If true, the shoot etcd pods are scraped too, and their metrics are served. See package etcd.
+	EnableEtcdMetrics bool
+	// The port at which etcd pods serve metrics over plain HTTP
+	EtcdMetricsPort int
+
+	// How long the last seen CA certificates of a shoot keep being used, after they go missing. See
+	// [metrics_scraper.ScraperOptions.CAGracePeriod].
+	CAGracePeriod time.Duration
+	// If not nil, verifies the Kapis of shoots without CA certificates, once the CAGracePeriod expires. See
+	// [metrics_scraper.ScraperOptions.FallbackCACertPool].
+	FallbackCACertPool *x509.CertPool
+
+	// If not zero, shoots whose metrics were not queried within the ConsumerWindow are scraped at this period. See
+	// [metrics_scraper.ScraperOptions.BackgroundScrapePeriod].
+	BackgroundScrapePeriod time.Duration
+	// How long after the last query of its metrics a shoot keeps being scraped at the regular period
+	ConsumerWindow time.Duration
+
+	// Tunes the TLS configuration used to scrape the Kapis. See [metrics_scraper.ScraperOptions.TLS].
+	ScrapeTLS metrics_scraper.TLSSettings
+	// If true, scrapes prefer the protobuf exposition format. See [metrics_scraper.ScraperOptions.AcceptProtobuf].
+	ScrapeProtobuf bool
+	// Tunes how scrape responses are requested and read. See [metrics_scraper.ScraperOptions.Response].
+	ScrapeResponse metrics_scraper.ResponseSettings
+
+	// If not zero, a WarmupGate holds off readiness until this fraction of the known Kapis have a fresh sample
+	WarmupMinCoverage float64
+	// The WarmupGate opens after this much time, regardless of the scrape coverage
+	WarmupMaxWait time.Duration
+
+	// Bounds the wait for the initial informer sync and the shoots' auth data, before the first scrapes. Zero disables
+	// the wait. See [metrics_scraper.ScraperOptions.SyncBarrierTimeout].
+	SyncBarrierTimeout time.Duration
+
+	// If not nil, the registry is populated with synthetic Kapis, instead of scraping the Kapis of actual shoots
+	Simulation *SimulationConfig
+
 	// PodController contains Pod controller configuration.
 	PodController *ControllerConfig
 	// SecretController contains Secret controller configuration.
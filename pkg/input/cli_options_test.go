@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+var _ = Describe("input.CLIOptions", func() {
+	Describe("CachedPodLabels", func() {
+		var (
+			kapiPodLabels = labels.Set{"app": "kubernetes", "role": "apiserver"}
+			etcdPodLabels = labels.Set{"app": "etcd-statefulset", "role": "main"}
+
+			// Returns the label selector of the pods held by the cache of the manager created for the specified options
+			getCachePodSelector = func(options *CLIOptions) labels.Selector {
+				managerOptions := (&app.CLIConfig{}).ManagerOptions(options.SecretNames(), options.CachedPodLabels())
+				for object, byObject := range managerOptions.Cache.ByObject {
+					if _, ok := object.(*corev1.Pod); ok {
+						return byObject.Label
+					}
+				}
+				return nil
+			}
+		)
+
+		It("should let the manager's cache hold the etcd pods, along with the Kapi pods, if etcd metrics are enabled",
+			func() {
+				// Arrange
+				options := NewCLIOptions()
+				options.EnableEtcdMetrics = true
+
+				// Act
+				selector := getCachePodSelector(options)
+
+				// Assert
+				Expect(selector).NotTo(BeNil())
+				Expect(selector.Matches(etcdPodLabels)).To(BeTrue())
+				Expect(selector.Matches(kapiPodLabels)).To(BeTrue())
+			})
+
+		It("should restrict the manager's cache to the Kapi pods, if etcd metrics are not enabled", func() {
+			// Arrange
+			options := NewCLIOptions()
+
+			// Act
+			selector := getCachePodSelector(options)
+
+			// Assert
+			Expect(selector).NotTo(BeNil())
+			Expect(selector.Matches(etcdPodLabels)).To(BeFalse())
+			Expect(selector.Matches(kapiPodLabels)).To(BeTrue())
+		})
+	})
+})
@@ -15,17 +15,44 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
 	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
 )
 
 // Actuator acts upon objects being reconciled by a Reconciler.
+//
+// If an Actuator operation returns an error, the operation is considered to have failed, and reconciliation is
+// requeued according to the controller's default (exponential) schedule. Otherwise, the Result specifies whether, and
+// when, the object is reconciled again.
 type Actuator interface {
 	// CreateOrUpdate reconciles object creation or update.
-	CreateOrUpdate(context.Context, client.Object) (time.Duration, error)
+	CreateOrUpdate(context.Context, client.Object) (Result, error)
 	// Delete reconciles object deletion.
-	Delete(context.Context, client.Object) (time.Duration, error)
+	Delete(context.Context, client.Object) (Result, error)
+}
+
+// Result is the outcome of an Actuator operation. It mirrors [reconcile.Result]. The zero value means that the
+// operation completed, and a following reconciliation is not necessary.
+type Result struct {
+	// Requeue, if true, requests a following reconciliation according to the controller's rate limiting, even though
+	// the operation did not fail. Ignored if RequeueAfter is greater than zero.
+	Requeue bool
+	// RequeueAfter, if greater than zero, requests a following reconciliation after the specified period
+	RequeueAfter time.Duration
+}
+
+// RequeueAfter returns a Result which requests a following reconciliation after the specified period. A period of
+// zero results in no following reconciliation.
+func RequeueAfter(period time.Duration) Result {
+	return Result{RequeueAfter: period}
+}
+
+// reconcileResult converts the Result to the equivalent [reconcile.Result]
+func (r Result) reconcileResult() reconcile.Result {
+	return reconcile.Result{Requeue: r.Requeue, RequeueAfter: r.RequeueAfter}
 }
 
 // AddArgs are the arguments required when adding a controller to a manager.
@@ -41,6 +68,8 @@ type AddArgs struct {
 	Predicates []predicate.Predicate
 	// WatchBuilder defines additional watches that should be set up.
 	WatchBuilder gutil.WatchBuilder
+	// Condition receives the outcome of each reconciliation. May be nil.
+	Condition *conditions.ComponentReporter
 }
 
 // Factory is used to create new Controller instances. It supports redirecting some function calls, for the purpose of test
@@ -58,7 +87,12 @@ func NewControllerFactory() *Factory {
 // AddNewControllerToManager creates a new controller and adds it to the specified manager, using the specified args.
 func (factory *Factory) AddNewControllerToManager(mgr manager.Manager, args AddArgs) error {
 	args.ControllerOptions.Reconciler =
-		NewReconciler(args.Actuator, args.ControlledObjectType, mgr.GetClient(), log.Log.WithName(args.ControllerName))
+		NewReconciler(
+			args.Actuator,
+			args.ControlledObjectType,
+			mgr.GetClient(),
+			args.Condition,
+			log.Log.WithName(args.ControllerName))
 
 	// Create controller
 	controller, err := factory.newController(args.ControllerName, mgr, args.ControllerOptions)
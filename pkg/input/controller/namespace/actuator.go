@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package namespace
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	gcmctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// The namespace actuator acts upon shoot namespace deletions, purging all registry data of the respective shoot. The
+// registry data is normally removed piecemeal, upon the deletion of the individual Kapi pods and secrets, but those
+// events can be missed, e.g. while the application is down, leaving orphaned shoot data behind.
+type actuator struct {
+	dataRegistry input_data_registry.InputDataRegistry
+	log          logr.Logger
+}
+
+// newActuator creates a new namespace actuator, which purges the data of deleted shoots from the specified registry
+func newActuator(dataRegistry input_data_registry.InputDataRegistry, log logr.Logger) gcmctl.Actuator {
+	log.V(app.VerbosityVerbose).Info("Creating actuator")
+	return &actuator{
+		dataRegistry: dataRegistry,
+		log:          log,
+	}
+}
+
+// CreateOrUpdate has no effect. The data of an existing shoot is maintained by the other controllers.
+// See [gcmctl.Actuator] for the meaning of the returned values.
+func (a *actuator) CreateOrUpdate(_ context.Context, _ client.Object) (gcmctl.Result, error) {
+	return gcmctl.Result{}, nil
+}
+
+// Delete tracks shoot namespace deletion events, and purges all registry data of the respective shoot.
+// See [gcmctl.Actuator] for the meaning of the returned values.
+func (a *actuator) Delete(_ context.Context, obj client.Object) (gcmctl.Result, error) {
+	if a.dataRegistry.RemoveShootData(obj.GetName()) {
+		a.log.V(app.VerbosityInfo).Info("Purged the data of a deleted shoot namespace", "namespace", obj.GetName())
+	}
+	return gcmctl.Result{}, nil
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package namespace
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+var _ = Describe("input.controller.namespace.actuator", func() {
+	const testNs = "shoot--my-shoot"
+
+	var (
+		newTestRegistry = func() input_data_registry.InputDataRegistry {
+			idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
+			idr.SetKapiData(testNs, "kapi-1", "", nil, "https://10.0.0.1/metrics")
+			idr.SetKapiData(testNs, "kapi-2", "", nil, "https://10.0.0.2/metrics")
+			idr.SetShootAuthSecret(testNs, "token")
+			idr.SetKapiData(testNs+"-other", "kapi-1", "", nil, "https://10.0.0.3/metrics")
+			return idr
+		}
+		newTestNamespace = func() *corev1.Namespace {
+			return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNs}}
+		}
+	)
+
+	Describe("Delete", func() {
+		It("should purge all data of the shoot, and leave other shoots intact", func() {
+			// Arrange
+			idr := newTestRegistry()
+			actuator := newActuator(idr, logr.Discard())
+
+			// Act
+			result, err := actuator.Delete(context.Background(), newTestNamespace())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result).To(BeZero())
+			Expect(idr.GetShootNamespaces()).To(ConsistOf(testNs + "-other"))
+			Expect(idr.GetShootAuthSecret(testNs)).To(BeEmpty())
+		})
+	})
+
+	Describe("CreateOrUpdate", func() {
+		It("should leave the shoot's data intact", func() {
+			// Arrange
+			idr := newTestRegistry()
+			actuator := newActuator(idr, logr.Discard())
+
+			// Act
+			result, err := actuator.CreateOrUpdate(context.Background(), newTestNamespace())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result).To(BeZero())
+			Expect(idr.GetShootNamespaces()).To(ConsistOf(testNs, testNs+"-other"))
+			Expect(idr.DataSource().GetShootKapis(testNs)).To(HaveLen(2))
+		})
+	})
+})
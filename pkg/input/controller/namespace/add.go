@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package namespace
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
+	gcmctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
+)
+
+// AddToManager adds a new namespace controller to the specified manager, along with a sweeper which catches the
+// deletions the controller missed. Both purge the registry data of deleted shoot namespaces.
+// dataRegistry is a concurrency-safe data repository, from which the controller removes the data of deleted shoots.
+// selector identifies the shoot namespaces. If nil, the Gardener defaults apply.
+// condition, if not nil, receives the outcome of each reconciliation.
+func AddToManager(
+	mgr manager.Manager,
+	dataRegistry input_data_registry.InputDataRegistry,
+	controllerOptions controller.Options,
+	selector *gutil.KapiSelector,
+	condition *conditions.ComponentReporter,
+	log logr.Logger) error {
+
+	log = log.WithName("namespace-controller")
+	err := gcmctl.NewControllerFactory().AddNewControllerToManager(mgr, gcmctl.AddArgs{
+		Actuator:             newActuator(dataRegistry, log),
+		ControllerName:       app.Name + "-namespace-controller",
+		ControllerOptions:    controllerOptions,
+		ControlledObjectType: &corev1.Namespace{},
+		Predicates:           []predicate.Predicate{newPredicate(selector)},
+		Condition:            condition,
+	})
+	if err != nil {
+		return err
+	}
+
+	sweeper := newSweeper(dataRegistry, mgr.GetClient(), mgr.GetAPIReader(), sweepPeriod, log.WithName("sweeper"))
+	if err := mgr.Add(sweeper); err != nil {
+		return fmt.Errorf("add namespace sweeper to manager: %w", err)
+	}
+	return nil
+}
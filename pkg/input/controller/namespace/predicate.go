@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package namespace
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
+)
+
+// newPredicate creates a predicate filter meant to run against a seed cluster. It only allows the deletion events of
+// shoot namespaces, as identified by the specified selector. A nil selector applies the Gardener defaults.
+//
+// A namespace which is merely terminating is not of interest: its pods and secrets are still being deleted, and their
+// own events keep the registry up to date until the namespace is gone.
+func newPredicate(selector *gutil.KapiSelector) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return false },
+		UpdateFunc: func(event.UpdateEvent) bool { return false },
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return e.Object != nil && selector.IsShootNamespace(e.Object.GetName())
+		},
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package namespace
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("input.controller.namespace.predicate", func() {
+	var (
+		newNamespace = func(name string) *corev1.Namespace {
+			return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		}
+	)
+
+	It("should only allow the deletion events of shoot namespaces", func() {
+		// Arrange
+		p := newPredicate(nil)
+		shootNs, otherNs := newNamespace("shoot--my-shoot"), newNamespace("kube-system")
+		terminatingNs := newNamespace("shoot--my-shoot")
+		terminatingNs.DeletionTimestamp = &metav1.Time{}
+
+		// Act & Assert
+		Expect(p.Delete(event.DeleteEvent{Object: shootNs})).To(BeTrue())
+		Expect(p.Delete(event.DeleteEvent{Object: otherNs})).To(BeFalse())
+		Expect(p.Create(event.CreateEvent{Object: shootNs})).To(BeFalse())
+		Expect(p.Update(event.UpdateEvent{ObjectOld: shootNs, ObjectNew: terminatingNs})).To(BeFalse())
+		Expect(p.Generic(event.GenericEvent{Object: shootNs})).To(BeFalse())
+	})
+})
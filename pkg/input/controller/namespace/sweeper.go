@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package namespace
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// How often the sweeper checks the registry for shoots whose namespace no longer exists
+const sweepPeriod = 10 * time.Minute
+
+// sweeper purges the registry data of shoots whose namespace no longer exists. It catches the namespace deletions which
+// the namespace controller missed, e.g. because they took place while the application was down, and the registry data
+// outlived the downtime.
+//
+// sweeper implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable].
+type sweeper struct {
+	dataRegistry input_data_registry.InputDataRegistry
+	// Used to check whether a namespace exists. Normally backed by the cache.
+	reader client.Reader
+	// Used to confirm that a namespace, which the reader reports as missing, is indeed missing. Bypasses the cache, so
+	// a lagging cache does not cause the data of an existing shoot to be purged.
+	apiReader client.Reader
+	period    time.Duration
+	log       logr.Logger
+
+	testIsolation sweeperTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// newSweeper creates a sweeper which checks the dataRegistry once per period. reader is used to check whether a shoot
+// namespace exists, and apiReader - to confirm that a namespace is missing, before its data is purged.
+func newSweeper(
+	dataRegistry input_data_registry.InputDataRegistry,
+	reader client.Reader,
+	apiReader client.Reader,
+	period time.Duration,
+	log logr.Logger) *sweeper {
+
+	return &sweeper{
+		dataRegistry:  dataRegistry,
+		reader:        reader,
+		apiReader:     apiReader,
+		period:        period,
+		log:           log,
+		testIsolation: sweeperTestIsolation{TimeAfter: time.After},
+	}
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It sweeps the registry right away, to
+// catch the deletions which took place during a downtime, and then once per period, until the context is cancelled.
+func (s *sweeper) Start(ctx context.Context) error {
+	s.log.V(app.VerbosityVerbose).Info("Namespace sweeper started", "period", s.period)
+
+	for {
+		s.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			s.log.V(app.VerbosityInfo).Info("Context closed, exiting")
+			return nil
+		case <-s.testIsolation.TimeAfter(s.period):
+		}
+	}
+}
+
+// sweep performs a single pass over the shoots in the registry, and purges the data of the ones whose namespace no
+// longer exists
+func (s *sweeper) sweep(ctx context.Context) {
+	for _, namespace := range s.dataRegistry.GetShootNamespaces() {
+		if !s.isMissing(ctx, s.reader, namespace) || !s.isMissing(ctx, s.apiReader, namespace) {
+			continue
+		}
+
+		s.log.V(app.VerbosityInfo).Info(
+			"Purging the data of a shoot namespace which no longer exists", "namespace", namespace)
+		s.dataRegistry.RemoveShootData(namespace)
+	}
+}
+
+// isMissing returns true if the specified reader confirms that the namespace does not exist. Read errors are logged,
+// and treated as if the namespace exists.
+func (s *sweeper) isMissing(ctx context.Context, reader client.Reader, namespace string) bool {
+	err := reader.Get(ctx, client.ObjectKey{Name: namespace}, &corev1.Namespace{})
+	if err == nil {
+		return false
+	}
+	if !apierrors.IsNotFound(err) {
+		s.log.V(app.VerbosityError).Error(err, "Failed to check whether shoot namespace exists", "namespace", namespace)
+		return false
+	}
+	return true
+}
+
+//#region Test isolation
+
+// sweeperTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the sweeper unit during tests
+type sweeperTestIsolation struct {
+	// Points to [time.After]
+	TimeAfter func(time.Duration) <-chan time.Time
+}
+
+//#endregion Test isolation
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package namespace
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+var _ = Describe("input.controller.namespace.sweeper", func() {
+	const (
+		existingNs = "shoot--existing"
+		deletedNs  = "shoot--deleted"
+		laggingNs  = "shoot--lagging" // Missing in the cache, but present on the server
+	)
+
+	var (
+		newNamespace = func(name string) client.Object {
+			return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		}
+		newTestSweeper = func() (*sweeper, input_data_registry.InputDataRegistry) {
+			idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
+			for _, ns := range []string{existingNs, deletedNs, laggingNs} {
+				idr.SetKapiData(ns, "kapi", "", nil, "https://"+ns+"/metrics")
+			}
+			reader := fake.NewClientBuilder().WithObjects(newNamespace(existingNs)).Build()
+			apiReader := fake.NewClientBuilder().WithObjects(newNamespace(existingNs), newNamespace(laggingNs)).Build()
+			return newSweeper(idr, reader, apiReader, time.Minute, logr.Discard()), idr
+		}
+	)
+
+	Describe("sweep", func() {
+		It("should purge the data of the shoots whose namespace is confirmed missing", func() {
+			// Arrange
+			s, idr := newTestSweeper()
+
+			// Act
+			s.sweep(context.Background())
+
+			// Assert
+			Expect(idr.GetShootNamespaces()).To(ConsistOf(existingNs, laggingNs))
+		})
+	})
+
+	Describe("Start", func() {
+		It("should sweep right away, and then once per period, until the context is cancelled", func() {
+			// Arrange
+			s, idr := newTestSweeper()
+			timeAfter := make(chan time.Time)
+			s.testIsolation.TimeAfter = func(time.Duration) <-chan time.Time { return timeAfter }
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+
+			// Act
+			go func() {
+				defer close(done)
+				Expect(s.Start(ctx)).To(Succeed())
+			}()
+
+			// Assert
+			Eventually(idr.GetShootNamespaces).Should(ConsistOf(existingNs, laggingNs))
+			idr.SetKapiData(deletedNs, "kapi", "", nil, "https://"+deletedNs+"/metrics")
+			timeAfter <- time.Now()
+			Eventually(idr.GetShootNamespaces).Should(ConsistOf(existingNs, laggingNs))
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+	})
+})
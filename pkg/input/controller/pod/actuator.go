@@ -7,15 +7,20 @@ package pod
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
 	gcmctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller"
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
 )
 
 // The pod actuator acts upon kube-apiserver pods, maintaining the information necessary to scrape
@@ -25,70 +30,293 @@ type actuator struct {
 	// А concurrency-safe data repository. Source of various data used by the controller and also where the controller
 	// stores the data it produces.
 	dataRegistry input_data_registry.InputDataRegistry
+	// Reads shoot namespaces, to obtain their scrape period and scrape settings annotations
+	client client.Reader
+	// Dual-stack pods are scraped via their address of this IP family. If empty, via their primary address.
+	ipFamily corev1.IPFamily
+	// Pod addresses within these CIDRs are preferred over the other addresses of the same IP family. May be empty.
+	podCIDRs []*net.IPNet
+	// If not empty, pods are scraped at each container port of this name. See getMetricsEndpoints.
+	metricsPortName string
+	// Identifies Kapi pods. Nil means the Gardener defaults.
+	selector *gutil.KapiSelector
+	// Keeps track of the pods which are not scraped, because their address is already used by another Kapi
+	addressConflicts *addressConflictTracker
 }
 
 // NewActuator creates a new pod actuator.
 // dataRegistry: a concurrency-safe data repository, source of various data used by the controller, and also where
 // the controller stores the data it produces.
-func NewActuator(dataRegistry input_data_registry.InputDataRegistry, log logr.Logger) gcmctl.Actuator {
+// client: used to read the shoot namespace, which may carry scrape period and scrape settings annotations.
+// ipFamily: dual-stack pods are scraped via their address of this IP family. If empty, via their primary address.
+// podCIDRs: the cluster's pod CIDRs. Pod addresses within them are preferred over the pod's other addresses of the same
+// IP family, e.g. the node addresses reported by pods in the host network. May be empty.
+// metricsPortName: if not empty, pods are scraped at each container port of this name, and the values are summed.
+// selector: identifies Kapi pods. If nil, the Gardener defaults apply.
+// addressCondition: if not nil, reports the pods which are not scraped, because their address is already used by
+// another Kapi.
+func NewActuator(
+	dataRegistry input_data_registry.InputDataRegistry,
+	client client.Reader,
+	ipFamily corev1.IPFamily,
+	podCIDRs []*net.IPNet,
+	metricsPortName string,
+	selector *gutil.KapiSelector,
+	addressCondition *conditions.ComponentReporter,
+	log logr.Logger) gcmctl.Actuator {
 
 	log.V(app.VerbosityVerbose).Info("Creating actuator")
 	return &actuator{
-		dataRegistry: dataRegistry,
-		log:          log,
+		dataRegistry:     dataRegistry,
+		client:           client,
+		ipFamily:         ipFamily,
+		podCIDRs:         podCIDRs,
+		metricsPortName:  metricsPortName,
+		selector:         selector,
+		addressConflicts: newAddressConflictTracker(addressCondition),
+		log:              log,
 	}
 }
 
 // CreateOrUpdate tracks shoot kube-apiserver pod creation and update events, and maintains a record of data which
 // is relevant to other components.
-// Returns:
-//   - If an error is returned, the operation is considered to have failed, and reconciliation will be requeued
-//     according to default (exponential) schedule.
-//   - If error is nil and the Duration is greater than 0, the operation completed successfully and a following
-//     reconciliation will be requeued after the specified Duration.
-//   - If error is nil, and the Duration is 0, the operation completed successfully and a following delay-based
-//     reconciliation is not necessary.
-func (a *actuator) CreateOrUpdate(ctx context.Context, obj client.Object) (time.Duration, error) {
-	if !isPodLabeledAsShootKapi(obj) {
+// See [gcmctl.Actuator] for the meaning of the returned values.
+func (a *actuator) CreateOrUpdate(ctx context.Context, obj client.Object) (gcmctl.Result, error) {
+	if !isPodLabeledAsShootKapi(obj, a.selector) {
 		// The pod is still there, but the labels which qualify it as a ShootKapi pod were removed
 		return a.Delete(ctx, obj)
 	}
 
 	pod, ok := toPod(obj, a.log.WithValues("namespace", obj.GetNamespace(), "name", obj.GetName()))
 	if !ok {
-		return 0, nil // Do not requeue
+		return gcmctl.Result{}, nil // Do not requeue
 	}
+	if !a.isScrapeEnabled(pod) {
+		return a.exclude(pod), nil
+	}
+
+	endpoints := a.getMetricsEndpoints(pod)
+	preferredURL, alternateURL := getMetricsURLs(pod, a.ipFamily, a.podCIDRs, endpoints[0])
+	metricsUrl := a.selectMetricsURL(pod, preferredURL, alternateURL)
+	// The further endpoints are scraped via the address of the same IP family as the first one
+	isAlternateSelected := alternateURL != "" && metricsUrl == alternateURL
+	var extraMetricsUrls []string
+	for _, endpoint := range endpoints[1:] {
+		extraPreferredURL, extraAlternateURL := getMetricsURLs(pod, a.ipFamily, a.podCIDRs, endpoint)
+		if isAlternateSelected {
+			extraMetricsUrls = append(extraMetricsUrls, extraAlternateURL)
+		} else {
+			extraMetricsUrls = append(extraMetricsUrls, extraPreferredURL)
+		}
+	}
+	podKey := client.ObjectKeyFromObject(pod)
+	if len(getPodIPs(pod, nil)) > 0 {
+		// Pods without an address yet cannot be confused with each other
+		metricsUrls := append([]string{metricsUrl}, extraMetricsUrls...)
+		if other, conflictingUrl := findAddressConflict(a.dataRegistry, podKey, metricsUrls); other != nil {
+			a.log.V(app.VerbosityInfo).Info(
+				"Not scraping pod, because its metrics URL is already used by another Kapi",
+				"namespace", pod.Namespace, "name", pod.Name, "hostNetwork", pod.Spec.HostNetwork, "url", conflictingUrl,
+				"otherNamespace", other.ShootNamespace(), "otherName", other.PodName())
+			a.addressConflicts.reportConflict(podKey, conflictingUrl, other)
+			a.dataRegistry.RemoveKapiData(pod.Namespace, pod.Name)
+			return gcmctl.RequeueAfter(addressConflictRecheckPeriod), nil
+		}
+	}
+	a.addressConflicts.clearConflict(podKey)
 
-	metricsUrl := fmt.Sprintf("https://%s/metrics", pod.Status.PodIP)
 	labelsCopy := make(map[string]string, len(pod.Labels))
 	for k, v := range pod.Labels {
 		labelsCopy[k] = v
 	}
 	a.dataRegistry.SetKapiData(pod.Namespace, pod.Name, pod.UID, labelsCopy, metricsUrl)
+	a.dataRegistry.SetKapiExtraMetricsUrls(pod.Namespace, pod.Name, extraMetricsUrls)
+	a.dataRegistry.SetKapiReady(pod.Namespace, pod.Name, isPodReady(pod))
+
+	scrapePeriod, err := a.getScrapePeriod(ctx, pod)
+	if err != nil {
+		return gcmctl.Result{}, err
+	}
+	a.dataRegistry.SetKapiScrapePeriod(pod.Namespace, pod.Name, scrapePeriod)
+
+	scrapeSettings, err := a.getShootScrapeSettings(ctx, pod)
+	if err != nil {
+		return gcmctl.Result{}, err
+	}
+	a.dataRegistry.SetShootScrapeSettings(pod.Namespace, scrapeSettings)
 
-	return 0, nil
+	if alternateURL != "" {
+		// Periodically check whether scrapes via the selected IP family keep failing
+		return gcmctl.RequeueAfter(ipFamilyFallbackCheckPeriod), nil
+	}
+	return gcmctl.Result{}, nil
 }
 
 // Delete tracks shoot kube-apiserver pod deletion events, and deletes the data record maintained for the respective pod.
-// Returns:
-//   - If an error is returned, the operation is considered to have failed, and reconciliation will be requeued
-//     according to default (exponential) schedule.
-//   - If error is nil and the Duration is greater than 0, the operation completed successfully and a following
-//     reconciliation will be requeued after the specified Duration.
-//   - If error is nil, and the Duration is 0, the operation completed successfully and a following delay-based
-//     reconciliation is not necessary.
-func (a *actuator) Delete(_ context.Context, obj client.Object) (requeueAfter time.Duration, err error) {
+// See [gcmctl.Actuator] for the meaning of the returned values.
+func (a *actuator) Delete(_ context.Context, obj client.Object) (gcmctl.Result, error) {
 	log := a.log.WithValues("namespace", obj.GetNamespace(), "name", obj.GetName())
 	pod, ok := toPod(obj, log)
 	if !ok {
-		return 0, nil // Do not requeue
+		return gcmctl.Result{}, nil // Do not requeue
 	}
 
+	a.addressConflicts.clearConflict(client.ObjectKeyFromObject(pod))
 	if !a.dataRegistry.RemoveKapiData(pod.Namespace, pod.Name) {
 		log.V(app.VerbosityInfo).Info("Controller was notified about deletion of a pod it was not currently tracking")
 	}
 
-	return 0, nil
+	return gcmctl.Result{}, nil
+}
+
+// isScrapeEnabled returns false if the pod is excluded from scraping by its ScrapeAnnotation. An invalid annotation is
+// logged, and the pod is scraped.
+func (a *actuator) isScrapeEnabled(pod *corev1.Pod) bool {
+	isScraped, err := parseScrapeAnnotation(pod.Annotations)
+	if err != nil {
+		a.log.V(app.VerbosityError).Error(
+			err, "Invalid scrape annotation. Scraping the pod.", "namespace", pod.Namespace, "name", pod.Name)
+	}
+	return isScraped
+}
+
+// exclude removes the record of a pod which is excluded from scraping, if one exists
+func (a *actuator) exclude(pod *corev1.Pod) gcmctl.Result {
+	a.addressConflicts.clearConflict(client.ObjectKeyFromObject(pod))
+	if a.dataRegistry.RemoveKapiData(pod.Namespace, pod.Name) {
+		a.log.V(app.VerbosityInfo).Info(
+			"Pod was annotated as excluded from scraping. Removed it from the scrape targets",
+			"namespace", pod.Namespace, "name", pod.Name)
+	} else {
+		a.log.V(app.VerbosityVerbose).Info(
+			"Not scraping pod, because it is annotated as excluded from scraping",
+			"namespace", pod.Namespace, "name", pod.Name)
+	}
+	return gcmctl.Result{}
+}
+
+// selectMetricsURL returns the URL at which the pod should be scraped: preferredURL, unless scraping via the URL on
+// record keeps failing. In that case, the pod is switched to the other one of preferredURL and alternateURL. An empty
+// alternateURL means that the pod is not dual-stack, and preferredURL is the only option.
+func (a *actuator) selectMetricsURL(pod *corev1.Pod, preferredURL string, alternateURL string) string {
+	if alternateURL == "" {
+		return preferredURL
+	}
+	kapi := a.dataRegistry.GetKapiData(pod.Namespace, pod.Name)
+	if kapi == nil {
+		return preferredURL
+	}
+
+	currentURL, otherURL := preferredURL, alternateURL
+	if kapi.MetricsUrl == alternateURL {
+		currentURL, otherURL = alternateURL, preferredURL
+	}
+	if kapi.FaultCount < ipFamilyFallbackFaultCount {
+		return currentURL
+	}
+
+	a.log.V(app.VerbosityInfo).Info(
+		"Scraping keeps failing. Switching to the pod's address of the other IP family",
+		"namespace", pod.Namespace, "name", pod.Name, "faultCount", kapi.FaultCount, "url", otherURL)
+	return otherURL
+}
+
+// getMetricsEndpoint returns the endpoint at which the specified pod's metrics are scraped, as specified by the metrics
+// port and path annotations on the pod. An invalid annotation is logged, and the respective default is used instead.
+func (a *actuator) getMetricsEndpoint(pod *corev1.Pod) metricsEndpoint {
+	log := a.log.WithValues("namespace", pod.Namespace, "name", pod.Name)
+	endpoint := defaultMetricsEndpoint
+
+	port, err := parseMetricsPortAnnotation(pod.Annotations)
+	if err != nil {
+		log.V(app.VerbosityError).Error(err, "Ignoring invalid metrics port annotation on pod")
+	} else {
+		endpoint.port = port
+	}
+
+	path, err := parseMetricsPathAnnotation(pod.Annotations)
+	if err != nil {
+		log.V(app.VerbosityError).Error(err, "Ignoring invalid metrics path annotation on pod")
+	} else {
+		endpoint.path = path
+	}
+
+	return endpoint
+}
+
+// getMetricsEndpoints returns the endpoints at which the specified pod's metrics are scraped. If a metrics port name is
+// configured, and the pod's containers declare ports of that name, there is one endpoint per such port, e.g. one for the
+// kube-apiserver container, and one for an apiserver-proxy sidecar. Otherwise, there is the single endpoint returned by
+// getMetricsEndpoint. The path is specified by the metrics path annotation in either case. The result is never empty.
+func (a *actuator) getMetricsEndpoints(pod *corev1.Pod) []metricsEndpoint {
+	endpoint := a.getMetricsEndpoint(pod)
+	if a.metricsPortName == "" {
+		return []metricsEndpoint{endpoint}
+	}
+
+	var result []metricsEndpoint
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == a.metricsPortName {
+				result = append(result, metricsEndpoint{port: strconv.Itoa(int(port.ContainerPort)), path: endpoint.path})
+			}
+		}
+	}
+	if len(result) == 0 {
+		return []metricsEndpoint{endpoint}
+	}
+
+	return result
+}
+
+// getScrapePeriod returns the scrape period override for the specified pod, as specified by the scrape period
+// annotation on the pod, or if absent - on the pod's namespace. Returns zero if neither specifies an override.
+// An invalid annotation is logged and ignored.
+func (a *actuator) getScrapePeriod(ctx context.Context, pod *corev1.Pod) (time.Duration, error) {
+	log := a.log.WithValues("namespace", pod.Namespace, "name", pod.Name)
+
+	scrapePeriod, err := parseScrapePeriodAnnotation(pod.Annotations)
+	if err != nil {
+		log.V(app.VerbosityError).Error(err, "Ignoring invalid scrape period annotation on pod")
+	}
+	if scrapePeriod > 0 {
+		return scrapePeriod, nil
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := a.client.Get(ctx, client.ObjectKey{Name: pod.Namespace}, namespace); err != nil {
+		if apierrors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("reading namespace %s: %w", pod.Namespace, err)
+	}
+
+	scrapePeriod, err = parseScrapePeriodAnnotation(namespace.Annotations)
+	if err != nil {
+		log.V(app.VerbosityError).Error(err, "Ignoring invalid scrape period annotation on namespace")
+	}
+	return scrapePeriod, nil
+}
+
+// getShootScrapeSettings returns the scrape settings specified by the annotations on the pod's namespace, or nil if the
+// namespace specifies none, and the global settings apply. Invalid annotations are logged and ignored.
+func (a *actuator) getShootScrapeSettings(
+	ctx context.Context, pod *corev1.Pod) (*input_data_registry.ShootScrapeSettings, error) {
+
+	namespace := &corev1.Namespace{}
+	if err := a.client.Get(ctx, client.ObjectKey{Name: pod.Namespace}, namespace); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading namespace %s: %w", pod.Namespace, err)
+	}
+
+	settings, err := parseScrapeSettingsAnnotations(namespace.Annotations)
+	if err != nil {
+		a.log.V(app.VerbosityError).Error(
+			err, "Ignoring invalid scrape settings annotations on namespace", "namespace", pod.Namespace)
+	}
+	return settings, nil
 }
 
 func toPod(obj client.Object, log logr.Logger) (*corev1.Pod, bool) {
@@ -99,3 +327,13 @@ func toPod(obj client.Object, log logr.Logger) (*corev1.Pod, bool) {
 
 	return pod, ok
 }
+
+// isPodReady returns true if the pod's Ready condition is true
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
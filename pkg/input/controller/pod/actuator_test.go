@@ -7,6 +7,7 @@ package pod
 import (
 	"context"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -15,7 +16,10 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
+	gcmctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller"
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
 )
 
@@ -29,7 +33,8 @@ var _ = Describe("input.controller.pod.actuator", func() {
 	var (
 		newTestActuator = func() (*actuator, input_data_registry.InputDataRegistry) {
 			idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
-			actuator := NewActuator(idr, logr.Discard()).(*actuator)
+			actuator := NewActuator(
+				idr, fake.NewClientBuilder().Build(), "", nil, "", nil, nil, logr.Discard()).(*actuator)
 			return actuator, idr
 		}
 		newTestPod = func() *corev1.Pod {
@@ -44,6 +49,11 @@ var _ = Describe("input.controller.pod.actuator", func() {
 				},
 			}
 		}
+		newDualStackTestPod = func() *corev1.Pod {
+			pod := newTestPod()
+			pod.Status.PodIPs = []corev1.PodIP{{IP: testIP}, {IP: "fd00::1"}}
+			return pod
+		}
 	)
 
 	Describe("CreateOrUpdate", func() {
@@ -69,6 +79,74 @@ var _ = Describe("input.controller.pod.actuator", func() {
 			Expect(kapi.LastMetricsScrapeTime).To(BeZero())
 			Expect(kapi.FaultCount).To(BeZero())
 		})
+		It("should record whether the pod is ready", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			pod := newTestPod()
+			ctx := context.Background()
+
+			// Act and assert
+			actuator.CreateOrUpdate(ctx, pod)
+			Expect(idr.GetKapiData(testNs, testPodName).NotReady).To(BeTrue())
+			pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+			actuator.CreateOrUpdate(ctx, pod)
+			Expect(idr.GetKapiData(testNs, testPodName).NotReady).To(BeFalse())
+		})
+		It("should record the scrape period override from the pod annotation, in preference to the namespace one", func() {
+			// Arrange
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:        testNs,
+				Annotations: map[string]string{ScrapePeriodAnnotation: "45s"},
+			}}
+			idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
+			actuator := NewActuator(
+				idr, fake.NewClientBuilder().WithObjects(namespace).Build(), "", nil, "", nil, nil, logr.Discard())
+			pod := newTestPod()
+			ctx := context.Background()
+
+			// Act & assert
+			_, err := actuator.CreateOrUpdate(ctx, pod)
+			Expect(err).To(Succeed())
+			Expect(idr.GetKapiData(testNs, testPodName).ScrapePeriod).To(Equal(45 * time.Second))
+
+			pod.Annotations = map[string]string{ScrapePeriodAnnotation: "15s"}
+			_, err = actuator.CreateOrUpdate(ctx, pod)
+			Expect(err).To(Succeed())
+			Expect(idr.GetKapiData(testNs, testPodName).ScrapePeriod).To(Equal(15 * time.Second))
+		})
+		It("should record the scrape settings specified by the namespace annotations", func() {
+			// Arrange
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:        testNs,
+				Annotations: map[string]string{ScrapeSchemeAnnotation: "http"},
+			}}
+			idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
+			idr.SetDefaultShootScrapeSettings(input_data_registry.ShootScrapeSettings{InsecureSkipTLSVerify: true})
+			actuator := NewActuator(
+				idr, fake.NewClientBuilder().WithObjects(namespace).Build(), "", nil, "", nil, nil, logr.Discard())
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), newTestPod())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(idr.GetScrapeContext(testNs, testPodName).ScrapeSettings).To(Equal(
+				input_data_registry.ShootScrapeSettings{Scheme: input_data_registry.ScrapeSchemeHTTP}))
+		})
+		It("should ignore an invalid scrape period annotation", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			pod := newTestPod()
+			pod.Annotations = map[string]string{ScrapePeriodAnnotation: "1s"}
+			ctx := context.Background()
+
+			// Act
+			_, err := actuator.CreateOrUpdate(ctx, pod)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(idr.GetKapiData(testNs, testPodName).ScrapePeriod).To(BeZero())
+		})
 		It("should return no error, and a zero requeue delay, upon successful Kapi creation", func() {
 			// Arrange
 			actuator, _ := newTestActuator()
@@ -121,12 +199,12 @@ var _ = Describe("input.controller.pod.actuator", func() {
 			actuator, idr := newTestActuator()
 			pod := newTestPod()
 			ctx := context.Background()
-			idr.SetKapiData(testNs, testPodName, "", nil, "")
+			idr.SetKapiData(testNs, testPodName, "", nil, fmt.Sprintf("https://%s/metrics", testIP))
 			scrapeTimeInitial := time.Now().Add(-1 * time.Minute)
 			idr.SetKapiLastScrapeTime(testNs, testPodName, scrapeTimeInitial)
 			idr.SetKapiMetrics(testNs, testPodName, 777)
 			metricsTimeInitial := time.Now()
-			idr.NotifyKapiMetricsFault(testNs, testPodName)
+			idr.NotifyKapiMetricsFault(testNs, testPodName, input_data_registry.ScrapeErrorNetwork)
 			time.Sleep(1 * time.Millisecond)
 
 			// Act
@@ -144,6 +222,220 @@ var _ = Describe("input.controller.pod.actuator", func() {
 			Expect(kapi.LastMetricsScrapeTime).To(Equal(scrapeTimeInitial))
 			Expect(kapi.FaultCount).To(Equal(1))
 		})
+		It("should scrape at the port and path specified by the pod annotations, ignoring invalid ones", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			pod := newTestPod()
+			pod.Annotations = map[string]string{MetricsPortAnnotation: "8443", MetricsPathAnnotation: "/custom/metrics"}
+			ctx := context.Background()
+
+			// Act & assert
+			_, err := actuator.CreateOrUpdate(ctx, pod)
+			Expect(err).To(Succeed())
+			Expect(idr.GetKapiData(testNs, testPodName).MetricsUrl).
+				To(Equal(fmt.Sprintf("https://%s:8443/custom/metrics", testIP)))
+
+			pod.Annotations[MetricsPortAnnotation] = "secure"
+			_, err = actuator.CreateOrUpdate(ctx, pod)
+			Expect(err).To(Succeed())
+			Expect(idr.GetKapiData(testNs, testPodName).MetricsUrl).
+				To(Equal(fmt.Sprintf("https://%s/custom/metrics", testIP)))
+		})
+		It("should scrape each container port of the configured name, if the pod declares such ports", func() {
+			// Arrange
+			idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
+			actuator := NewActuator(
+				idr, fake.NewClientBuilder().Build(), "", nil, "metrics", nil, nil, logr.Discard())
+			pod := newTestPod()
+			pod.Annotations = map[string]string{MetricsPathAnnotation: "/custom/metrics"}
+			pod.Spec.Containers = []corev1.Container{
+				{Name: "kube-apiserver", Ports: []corev1.ContainerPort{{Name: "metrics", ContainerPort: 443}}},
+				{Name: "proxy", Ports: []corev1.ContainerPort{
+					{Name: "admin", ContainerPort: 9000}, {Name: "metrics", ContainerPort: 9443}}},
+			}
+			ctx := context.Background()
+
+			// Act & assert
+			_, err := actuator.CreateOrUpdate(ctx, pod)
+			Expect(err).To(Succeed())
+			kapi := idr.GetKapiData(testNs, testPodName)
+			Expect(kapi.MetricsUrl).To(Equal(fmt.Sprintf("https://%s:443/custom/metrics", testIP)))
+			Expect(kapi.ExtraMetricsUrls).To(Equal([]string{fmt.Sprintf("https://%s:9443/custom/metrics", testIP)}))
+
+			pod.Spec.Containers = nil
+			_, err = actuator.CreateOrUpdate(ctx, pod)
+			Expect(err).To(Succeed())
+			kapi = idr.GetKapiData(testNs, testPodName)
+			Expect(kapi.MetricsUrl).To(Equal(fmt.Sprintf("https://%s/custom/metrics", testIP)))
+			Expect(kapi.ExtraMetricsUrls).To(BeEmpty())
+		})
+		It("should scrape an IPv6 pod via its bracketed address", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			pod := newTestPod()
+			pod.Status.PodIP = "fd00::1"
+			ctx := context.Background()
+
+			// Act
+			requeue, err := actuator.CreateOrUpdate(ctx, pod)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(requeue).To(BeZero())
+			Expect(idr.GetKapiData(testNs, testPodName).MetricsUrl).To(Equal("https://[fd00::1]/metrics"))
+		})
+		It("should scrape a dual-stack pod via its address of the preferred IP family, and requeue a fallback check", func() {
+			// Arrange
+			idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
+			actuator := NewActuator(
+				idr, fake.NewClientBuilder().Build(), corev1.IPv6Protocol, nil, "", nil, nil, logr.Discard())
+			pod := newDualStackTestPod()
+			ctx := context.Background()
+
+			// Act
+			requeue, err := actuator.CreateOrUpdate(ctx, pod)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(requeue).To(Equal(gcmctl.RequeueAfter(ipFamilyFallbackCheckPeriod)))
+			Expect(idr.GetKapiData(testNs, testPodName).MetricsUrl).To(Equal("https://[fd00::1]/metrics"))
+		})
+		It("should switch a dual-stack pod to its address of the other IP family, once scraping keeps failing", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			pod := newDualStackTestPod()
+			ctx := context.Background()
+			actuator.CreateOrUpdate(ctx, pod)
+			for i := 0; i < ipFamilyFallbackFaultCount-1; i++ {
+				idr.NotifyKapiMetricsFault(testNs, testPodName, input_data_registry.ScrapeErrorNetwork)
+			}
+
+			// Act & assert
+			actuator.CreateOrUpdate(ctx, pod)
+			Expect(idr.GetKapiData(testNs, testPodName).MetricsUrl).To(Equal(fmt.Sprintf("https://%s/metrics", testIP)))
+
+			idr.NotifyKapiMetricsFault(testNs, testPodName, input_data_registry.ScrapeErrorNetwork)
+			actuator.CreateOrUpdate(ctx, pod)
+			kapi := idr.GetKapiData(testNs, testPodName)
+			Expect(kapi.MetricsUrl).To(Equal("https://[fd00::1]/metrics"))
+			Expect(kapi.FaultCount).To(BeZero())
+
+			actuator.CreateOrUpdate(ctx, pod)
+			Expect(idr.GetKapiData(testNs, testPodName).MetricsUrl).To(Equal("https://[fd00::1]/metrics"))
+		})
+		It("should scrape a pod via its address within the pod CIDRs, in preference to the primary one", func() {
+			// Arrange
+			idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
+			_, podCIDR, _ := net.ParseCIDR("100.64.0.0/12")
+			actuator := NewActuator(
+				idr, fake.NewClientBuilder().Build(), "", []*net.IPNet{podCIDR}, "", nil, nil, logr.Discard())
+			pod := newTestPod()
+			pod.Status.PodIPs = []corev1.PodIP{{IP: testIP}, {IP: "100.64.0.7"}}
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), pod)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(idr.GetKapiData(testNs, testPodName).MetricsUrl).To(Equal("https://100.64.0.7/metrics"))
+		})
+		It("should skip a pod whose metrics URL is already used by another Kapi, and report that until resolved", func() {
+			// Arrange
+			idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
+			conditionRegistry := conditions.NewRegistry(logr.Discard())
+			condition := conditionRegistry.NewReporter("PodAddressDegraded", 1, false)
+			actuator := NewActuator(idr, fake.NewClientBuilder().Build(), "", nil, "", nil, condition, logr.Discard())
+			ctx := context.Background()
+			firstPod := newTestPod()
+			firstPod.Spec.HostNetwork = true
+			secondPod := firstPod.DeepCopy()
+			secondPod.Namespace = testNs + "-other"
+			actuator.CreateOrUpdate(ctx, firstPod)
+
+			// Act
+			requeue, err := actuator.CreateOrUpdate(ctx, secondPod)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(requeue).To(Equal(gcmctl.RequeueAfter(addressConflictRecheckPeriod)))
+			Expect(idr.GetKapiData(secondPod.Namespace, testPodName)).To(BeNil())
+			Expect(conditionRegistry.Conditions()[0].Status).To(Equal(metav1.ConditionTrue))
+			Expect(conditionRegistry.Conditions()[0].Message).To(ContainSubstring(testNs + "/" + testPodName))
+
+			// Act & assert: the conflict ends once the first pod goes away
+			actuator.Delete(ctx, firstPod)
+			requeue, err = actuator.CreateOrUpdate(ctx, secondPod)
+			Expect(err).To(Succeed())
+			Expect(requeue).To(BeZero())
+			Expect(idr.GetKapiData(secondPod.Namespace, testPodName)).NotTo(BeNil())
+			Expect(conditionRegistry.Conditions()[0].Status).To(Equal(metav1.ConditionFalse))
+		})
+		It("should not consider pods without an address to be in conflict", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			ctx := context.Background()
+			firstPod := newTestPod()
+			firstPod.Status.PodIP = ""
+			secondPod := firstPod.DeepCopy()
+			secondPod.Name = testPodName + "-other"
+			actuator.CreateOrUpdate(ctx, firstPod)
+
+			// Act
+			requeue, err := actuator.CreateOrUpdate(ctx, secondPod)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(requeue).To(BeZero())
+			Expect(idr.GetKapiData(testNs, secondPod.Name)).NotTo(BeNil())
+		})
+		It("should not create a Kapi record, if the pod is annotated as excluded from scraping", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			pod := newTestPod()
+			pod.Annotations = map[string]string{ScrapeAnnotation: "false"}
+
+			// Act
+			requeue, err := actuator.CreateOrUpdate(context.Background(), pod)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(requeue).To(BeZero())
+			Expect(idr.GetKapiData(testNs, testPodName)).To(BeNil())
+		})
+		It("should delete the existing record once a pod is excluded from scraping, and recreate it once readmitted", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			pod := newTestPod()
+			ctx := context.Background()
+			actuator.CreateOrUpdate(ctx, pod)
+			idr.SetKapiMetrics(testNs, testPodName, 10)
+
+			// Act & assert
+			pod.Annotations = map[string]string{ScrapeAnnotation: "false"}
+			_, err := actuator.CreateOrUpdate(ctx, pod)
+			Expect(err).To(Succeed())
+			Expect(idr.GetKapiData(testNs, testPodName)).To(BeNil())
+
+			delete(pod.Annotations, ScrapeAnnotation)
+			_, err = actuator.CreateOrUpdate(ctx, pod)
+			Expect(err).To(Succeed())
+			kapi := idr.GetKapiData(testNs, testPodName)
+			Expect(kapi).NotTo(BeNil())
+			Expect(kapi.TotalRequestCountNew).To(BeZero())
+		})
+		It("should scrape a pod whose scrape annotation is invalid", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			pod := newTestPod()
+			pod.Annotations = map[string]string{ScrapeAnnotation: "never"}
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), pod)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(idr.GetKapiData(testNs, testPodName)).NotTo(BeNil())
+		})
 		It("should delete the existing record, if a pod loses the labeling which qualifies it as Kapi pod", func() {
 			// Arrange
 			actuator, idr := newTestActuator()
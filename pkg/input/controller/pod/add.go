@@ -5,31 +5,77 @@
 package pod
 
 import (
+	"net"
+
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
 	gcmctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller"
 	scrape_target_registry "github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
 )
 
 // AddToManager adds a new pod controller to the specified manager.
 // dataRegistry is a concurrency-safe data repository where the controller finds data it needs, and stores
-// the data it produces.
+// the data it produces. Dual-stack pods are scraped via their address of the specified IP family. If ipFamily is empty,
+// via their primary address. Pod addresses within podCIDRs are preferred over the pod's other addresses of the same IP
+// family. If metricsPortName is not empty, pods are scraped at each container port of that name, and the values are
+// summed. selector identifies the Kapi pods. If nil, the Gardener defaults apply. condition, if not nil, receives the
+// outcome of each reconciliation. addressCondition, if not nil, reports the pods which are not scraped, because their
+// address is already used by another Kapi. reconcileRequests, if not nil, delivers pods which the controller reconciles
+// right away, whether they changed or not. Only the pods' namespace and name matter.
 func AddToManager(
 	mgr manager.Manager,
 	dataRegistry scrape_target_registry.InputDataRegistry,
 	controllerOptions controller.Options,
+	ipFamily corev1.IPFamily,
+	podCIDRs []*net.IPNet,
+	metricsPortName string,
+	selector *gutil.KapiSelector,
+	condition *conditions.ComponentReporter,
+	addressCondition *conditions.ComponentReporter,
+	reconcileRequests <-chan event.GenericEvent,
 	log logr.Logger) error {
 
+	// Reconcile the Kapi pods in a namespace, when the namespace's scrape period or scrape settings annotations change
+	var watchBuilder gutil.WatchBuilder
+	watchBuilder.Register(func(ctl controller.Controller) error {
+		return ctl.Watch(
+			source.Kind(mgr.GetCache(), &corev1.Namespace{}),
+			handler.EnqueueRequestsFromMapFunc(
+				mapNamespaceToKapiPods(mgr.GetClient(), selector, log.WithName("pod-controller"))),
+			newNamespacePredicate(selector))
+	})
+	if reconcileRequests != nil {
+		watchBuilder.Register(func(ctl controller.Controller) error {
+			return ctl.Watch(&source.Channel{Source: reconcileRequests}, &handler.EnqueueRequestForObject{})
+		})
+	}
+
+	actuator := NewActuator(
+		dataRegistry,
+		mgr.GetClient(),
+		ipFamily,
+		podCIDRs,
+		metricsPortName,
+		selector,
+		addressCondition,
+		log.WithName("pod-controller"))
 	return gcmctl.NewControllerFactory().AddNewControllerToManager(mgr, gcmctl.AddArgs{
-		Actuator:             NewActuator(dataRegistry, log.WithName("pod-controller")),
+		Actuator:             actuator,
 		ControllerName:       app.Name + "-pod-controller",
 		ControllerOptions:    controllerOptions,
 		ControlledObjectType: &corev1.Pod{},
-		Predicates:           []predicate.Predicate{NewPredicate(log)},
+		Predicates:           []predicate.Predicate{NewPredicate(selector, log)},
+		WatchBuilder:         watchBuilder,
+		Condition:            condition,
 	})
 }
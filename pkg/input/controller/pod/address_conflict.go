@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// How often a Kapi pod which is skipped due to an address conflict is checked again. The conflict ends when the other
+// pod goes away, or changes its address, and neither event triggers a reconciliation of the skipped pod.
+const addressConflictRecheckPeriod = 1 * time.Minute
+
+// findAddressConflict returns a Kapi, other than the specified pod, which is scraped at any of the specified URLs,
+// along with that URL. Returns nil if there is no such Kapi. Scraping two Kapis at the same URL would attribute the
+// metrics of one of them to both. That happens e.g. with pods which run in the host network, and report the address of
+// their node, or when an address is reused before the deletion of its previous pod is processed.
+func findAddressConflict(
+	dataRegistry input_data_registry.InputDataRegistry,
+	pod types.NamespacedName,
+	metricsUrls []string) (*input_data_registry.KapiData, string) {
+
+	for _, metricsUrl := range metricsUrls {
+		for _, kapi := range dataRegistry.GetKapiDataByMetricsUrl(metricsUrl) {
+			if kapi.ShootNamespace() != pod.Namespace || kapi.PodName() != pod.Name {
+				return kapi, metricsUrl
+			}
+		}
+	}
+	return nil, ""
+}
+
+// addressConflictTracker keeps track of the Kapi pods which are skipped due to an address conflict, and reflects them
+// in a condition: the condition reports an error for each skipped pod, and recovers once no pod is skipped.
+// Concurrency-safe.
+type addressConflictTracker struct {
+	// Receives the conflicts. May be nil.
+	condition *conditions.ComponentReporter
+	// The pods currently skipped
+	conflicts map[types.NamespacedName]bool
+	lock      sync.Mutex
+}
+
+// newAddressConflictTracker creates an addressConflictTracker which reports to the specified condition, which may be
+// nil
+func newAddressConflictTracker(condition *conditions.ComponentReporter) *addressConflictTracker {
+	return &addressConflictTracker{
+		condition: condition,
+		conflicts: make(map[types.NamespacedName]bool),
+	}
+}
+
+// reportConflict records that the specified pod is skipped, because its metrics URL is also used by the other Kapi
+func (t *addressConflictTracker) reportConflict(
+	pod types.NamespacedName, metricsUrl string, other *input_data_registry.KapiData) {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.conflicts[pod] = true
+	t.condition.ReportError(fmt.Errorf(
+		"skipping pod %s, because its metrics URL %s is already used by pod %s/%s",
+		pod, metricsUrl, other.ShootNamespace(), other.PodName()))
+}
+
+// clearConflict records that the specified pod is not skipped. If no pod is skipped any more, the condition recovers.
+func (t *addressConflictTracker) clearConflict(pod types.NamespacedName) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.conflicts, pod)
+	if len(t.conflicts) == 0 {
+		t.condition.ReportSuccess()
+	}
+}
@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MetricsPortAnnotation, if present on a kube-apiserver pod, specifies the port at which the pod's metrics are
+	// scraped, e.g. "8443". If absent, the default HTTPS port is used.
+	MetricsPortAnnotation = "custom-metrics.gardener.cloud/metrics-port"
+	// MetricsPathAnnotation, if present on a kube-apiserver pod, specifies the URL path at which the pod's metrics are
+	// scraped, e.g. "/custom/metrics". If absent, defaultMetricsPath is used.
+	MetricsPathAnnotation = "custom-metrics.gardener.cloud/metrics-path"
+
+	defaultMetricsPath = "/metrics"
+)
+
+// metricsEndpoint specifies where, on a kube-apiserver pod, the pod's metrics are scraped
+type metricsEndpoint struct {
+	port string // If empty, the default HTTPS port
+	path string
+}
+
+// defaultMetricsEndpoint is where the metrics of kube-apiserver pods without endpoint annotations are scraped
+var defaultMetricsEndpoint = metricsEndpoint{path: defaultMetricsPath}
+
+// parseMetricsPortAnnotation returns the port specified by the MetricsPortAnnotation among the specified
+// annotations, or an empty string if the annotation is absent.
+func parseMetricsPortAnnotation(annotations map[string]string) (string, error) {
+	value, ok := annotations[MetricsPortAnnotation]
+	if !ok {
+		return "", nil
+	}
+
+	port, err := strconv.Atoi(value)
+	if err != nil {
+		return "", fmt.Errorf("parsing annotation %s: %w", MetricsPortAnnotation, err)
+	}
+	if port <= 0 || port > 65535 {
+		return "", fmt.Errorf("annotation %s: the value %s is not between 1 and 65535", MetricsPortAnnotation, value)
+	}
+
+	return strconv.Itoa(port), nil
+}
+
+// parseMetricsPathAnnotation returns the URL path specified by the MetricsPathAnnotation among the specified
+// annotations, or defaultMetricsPath if the annotation is absent.
+func parseMetricsPathAnnotation(annotations map[string]string) (string, error) {
+	value, ok := annotations[MetricsPathAnnotation]
+	if !ok {
+		return defaultMetricsPath, nil
+	}
+
+	if !strings.HasPrefix(value, "/") || strings.ContainsAny(value, "?#") {
+		return defaultMetricsPath, fmt.Errorf(
+			"annotation %s: the value %s is not an absolute URL path, without query or fragment",
+			MetricsPathAnnotation,
+			value)
+	}
+
+	return value, nil
+}
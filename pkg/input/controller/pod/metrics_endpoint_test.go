@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("input.controller.pod metrics endpoint", func() {
+	Describe("parseMetricsPortAnnotation", func() {
+		It("should return the annotated port, or an empty string if the annotation is absent", func() {
+			Expect(parseMetricsPortAnnotation(map[string]string{MetricsPortAnnotation: "8443"})).To(Equal("8443"))
+			Expect(parseMetricsPortAnnotation(nil)).To(BeEmpty())
+		})
+		It("should return an error if the value is not a valid port number", func() {
+			for _, value := range []string{"https", "0", "65536", "-1", ""} {
+				_, err := parseMetricsPortAnnotation(map[string]string{MetricsPortAnnotation: value})
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Describe("parseMetricsPathAnnotation", func() {
+		It("should return the annotated path, or the default path if the annotation is absent", func() {
+			Expect(parseMetricsPathAnnotation(map[string]string{MetricsPathAnnotation: "/custom/metrics"})).
+				To(Equal("/custom/metrics"))
+			Expect(parseMetricsPathAnnotation(nil)).To(Equal(defaultMetricsPath))
+		})
+		It("should return an error if the value is not an absolute path, or has a query or fragment", func() {
+			for _, value := range []string{"metrics", "", "/metrics?format=text", "/metrics#top"} {
+				_, err := parseMetricsPathAnnotation(map[string]string{MetricsPathAnnotation: value})
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+})
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	"net"
+	"net/url"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// When scraping a dual-stack Kapi pod fails this many consecutive times, the pod is scraped via its IP address of
+	// the other IP family
+	ipFamilyFallbackFaultCount = 3
+	// How often the scrape faults of dual-stack Kapi pods are checked, to decide whether to switch IP families
+	ipFamilyFallbackCheckPeriod = 1 * time.Minute
+)
+
+// ipFamilyOf returns the IP family of the specified IP address, or an empty string if it is not a valid IP address
+func ipFamilyOf(ip string) corev1.IPFamily {
+	parsedIP := net.ParseIP(ip)
+	switch {
+	case parsedIP == nil:
+		return ""
+	case parsedIP.To4() != nil:
+		return corev1.IPv4Protocol
+	default:
+		return corev1.IPv6Protocol
+	}
+}
+
+// getPodIPs returns the valid, distinct IP addresses of the pod. The addresses within podCIDRs come first, followed by
+// the rest. Within each group, the primary address comes first. Invalid addresses are omitted.
+//
+// Normally, all addresses of a pod are within the pod CIDRs. The exceptions are pods which run in the host network,
+// and report the node's addresses, and pods which have additional interfaces, e.g. via a multi-network plugin.
+func getPodIPs(pod *corev1.Pod, podCIDRs []*net.IPNet) []string {
+	all := make([]string, 0, 2)
+	addIP := func(ip string) {
+		if ipFamilyOf(ip) != "" && !slices.Contains(all, ip) {
+			all = append(all, ip)
+		}
+	}
+	addIP(pod.Status.PodIP)
+	for _, podIP := range pod.Status.PodIPs {
+		addIP(podIP.IP)
+	}
+
+	result := make([]string, 0, len(all))
+	for _, ip := range all {
+		if isInCIDRs(ip, podCIDRs) {
+			result = append(result, ip)
+		}
+	}
+	for _, ip := range all {
+		if !isInCIDRs(ip, podCIDRs) {
+			result = append(result, ip)
+		}
+	}
+	return result
+}
+
+// isInCIDRs returns true if the specified valid IP address is within any of the specified CIDRs
+func isInCIDRs(ip string, cidrs []*net.IPNet) bool {
+	parsedIP := net.ParseIP(ip)
+	for _, cidr := range cidrs {
+		if cidr.Contains(parsedIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// getMetricsURLs returns the URL at which the pod's metrics can be scraped at the specified endpoint, via the pod's IP
+// address of the preferred IP family. If the preferred family is empty, or the pod has no address of that family, the
+// pod's primary IP address is used. Addresses within podCIDRs take precedence over the other addresses of the same IP
+// family, and over the primary address. See getPodIPs.
+// If the pod also has an address of another IP family, the respective URL is returned as alternateURL. Otherwise,
+// alternateURL is empty.
+func getMetricsURLs(
+	pod *corev1.Pod,
+	preferredFamily corev1.IPFamily,
+	podCIDRs []*net.IPNet,
+	endpoint metricsEndpoint) (preferredURL string, alternateURL string) {
+
+	podIPs := getPodIPs(pod, podCIDRs)
+	if len(podIPs) == 0 {
+		return buildMetricsURL("", endpoint), ""
+	}
+
+	preferredIP := podIPs[0]
+	for _, podIP := range podIPs {
+		if ipFamilyOf(podIP) == preferredFamily {
+			preferredIP = podIP
+			break
+		}
+	}
+	for _, podIP := range podIPs {
+		if family := ipFamilyOf(podIP); family != "" && family != ipFamilyOf(preferredIP) {
+			alternateURL = buildMetricsURL(podIP, endpoint)
+			break
+		}
+	}
+
+	return buildMetricsURL(preferredIP, endpoint), alternateURL
+}
+
+// buildMetricsURL returns the URL at which the metrics of a Kapi pod with the specified IP address can be scraped, at
+// the specified endpoint
+func buildMetricsURL(ip string, endpoint metricsEndpoint) string {
+	host := ip
+	switch {
+	case endpoint.port != "":
+		host = net.JoinHostPort(ip, endpoint.port)
+	case ipFamilyOf(ip) == corev1.IPv6Protocol:
+		host = "[" + ip + "]"
+	}
+	return (&url.URL{Scheme: "https", Host: host, Path: endpoint.path}).String()
+}
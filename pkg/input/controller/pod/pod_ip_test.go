@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("input.controller.pod.getMetricsURLs", func() {
+	var (
+		newTestPod = func(primaryIP string, otherIPs ...string) *corev1.Pod {
+			pod := &corev1.Pod{Status: corev1.PodStatus{PodIP: primaryIP}}
+			for _, ip := range append([]string{primaryIP}, otherIPs...) {
+				pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: ip})
+			}
+			return pod
+		}
+	)
+
+	It("should return the primary address and no alternate, for a single-stack pod", func() {
+		// Arrange
+		pod := newTestPod("10.0.0.1")
+
+		// Act
+		preferredURL, alternateURL := getMetricsURLs(pod, corev1.IPv6Protocol, nil, defaultMetricsEndpoint)
+
+		// Assert
+		Expect(preferredURL).To(Equal("https://10.0.0.1/metrics"))
+		Expect(alternateURL).To(BeEmpty())
+	})
+	It("should enclose IPv6 addresses in brackets", func() {
+		// Arrange
+		pod := newTestPod("fd00::1")
+
+		// Act
+		preferredURL, _ := getMetricsURLs(pod, "", nil, defaultMetricsEndpoint)
+
+		// Assert
+		Expect(preferredURL).To(Equal("https://[fd00::1]/metrics"))
+	})
+	It("should prefer the primary address of a dual-stack pod, if no IP family is specified", func() {
+		// Arrange
+		pod := newTestPod("fd00::1", "10.0.0.1")
+
+		// Act
+		preferredURL, alternateURL := getMetricsURLs(pod, "", nil, defaultMetricsEndpoint)
+
+		// Assert
+		Expect(preferredURL).To(Equal("https://[fd00::1]/metrics"))
+		Expect(alternateURL).To(Equal("https://10.0.0.1/metrics"))
+	})
+	It("should prefer the address of the specified IP family, for a dual-stack pod", func() {
+		// Arrange
+		pod := newTestPod("fd00::1", "10.0.0.1")
+
+		// Act
+		preferredURL, alternateURL := getMetricsURLs(pod, corev1.IPv4Protocol, nil, defaultMetricsEndpoint)
+
+		// Assert
+		Expect(preferredURL).To(Equal("https://10.0.0.1/metrics"))
+		Expect(alternateURL).To(Equal("https://[fd00::1]/metrics"))
+	})
+	It("should build the URLs for the specified endpoint", func() {
+		// Arrange
+		pod := newTestPod("fd00::1", "10.0.0.1")
+		endpoint := metricsEndpoint{port: "8443", path: "/custom/metrics"}
+
+		// Act
+		preferredURL, alternateURL := getMetricsURLs(pod, "", nil, endpoint)
+
+		// Assert
+		Expect(preferredURL).To(Equal("https://[fd00::1]:8443/custom/metrics"))
+		Expect(alternateURL).To(Equal("https://10.0.0.1:8443/custom/metrics"))
+	})
+	It("should use the pod IP list, if the primary pod IP is not set", func() {
+		// Arrange
+		pod := newTestPod("", "10.0.0.1")
+
+		// Act
+		preferredURL, alternateURL := getMetricsURLs(pod, corev1.IPv6Protocol, nil, defaultMetricsEndpoint)
+
+		// Assert
+		Expect(preferredURL).To(Equal("https://10.0.0.1/metrics"))
+		Expect(alternateURL).To(BeEmpty())
+	})
+	It("should ignore invalid and duplicate addresses", func() {
+		// Arrange
+		pod := newTestPod("not-an-ip", "10.0.0.1", "10.0.0.1", "fd00::1")
+
+		// Act
+		preferredURL, alternateURL := getMetricsURLs(pod, "", nil, defaultMetricsEndpoint)
+
+		// Assert
+		Expect(preferredURL).To(Equal("https://10.0.0.1/metrics"))
+		Expect(alternateURL).To(Equal("https://[fd00::1]/metrics"))
+		Expect(getPodIPs(pod, nil)).To(Equal([]string{"10.0.0.1", "fd00::1"}))
+	})
+	It("should prefer the addresses within the pod CIDRs, within each IP family", func() {
+		// Arrange
+		_, podCIDR, _ := net.ParseCIDR("100.64.0.0/12")
+		pod := newTestPod("10.0.0.1", "fd00::1", "100.64.0.7")
+
+		// Act
+		podCIDRs := []*net.IPNet{podCIDR}
+		preferredURL, alternateURL := getMetricsURLs(pod, "", podCIDRs, defaultMetricsEndpoint)
+		preferredV6URL, alternateV4URL := getMetricsURLs(pod, corev1.IPv6Protocol, podCIDRs, defaultMetricsEndpoint)
+
+		// Assert
+		Expect(preferredURL).To(Equal("https://100.64.0.7/metrics"))
+		Expect(alternateURL).To(Equal("https://[fd00::1]/metrics"))
+		Expect(preferredV6URL).To(Equal("https://[fd00::1]/metrics"))
+		Expect(alternateV4URL).To(Equal("https://100.64.0.7/metrics"))
+	})
+})
@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
+)
+
+const (
+	// podRefreshRate is the maximum sustained number of pod refreshes per second, across all pods
+	podRefreshRate = 2
+	// podRefreshBurst is how many pod refreshes may take place in a quick succession, before podRefreshRate applies.
+	// Also the maximum number of pending refresh requests.
+	podRefreshBurst = 10
+)
+
+// PodRefresher re-reads individual Kapi pods directly from the API server, bypassing the informer cache, and updates
+// the registry the same way the pod controller does. It serves as fast path, when the scraper finds that a pod's
+// address on record is stale, e.g. because the pod was recreated during a rolling update, and the pod controller has
+// not processed the change yet.
+//
+// Refreshes are rate limited. Requests in excess of the limit are dropped - the pod controller processes the change
+// eventually, in any case.
+//
+// PodRefresher implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable]. Requests are processed while it runs.
+type PodRefresher struct {
+	actuator *actuator
+	// Reads the pods, bypassing the cache
+	podReader client.Reader
+	log       logr.Logger
+
+	limiter  *rate.Limiter
+	requests chan types.NamespacedName
+}
+
+// NewPodRefresher creates a PodRefresher which records the refreshed pods in dataRegistry.
+// podReader: reads the pods. Should bypass the cache, e.g. the manager's API reader.
+// namespaceReader: reads the shoot namespaces, which may carry a scrape period annotation.
+// For ipFamily, podCIDRs, metricsPortName, and selector, see NewActuator. Address conflicts found by refreshes are not
+// reported to a condition - the pod controller reports them, when it processes the change.
+func NewPodRefresher(
+	dataRegistry input_data_registry.InputDataRegistry,
+	podReader client.Reader,
+	namespaceReader client.Reader,
+	ipFamily corev1.IPFamily,
+	podCIDRs []*net.IPNet,
+	metricsPortName string,
+	selector *gutil.KapiSelector,
+	log logr.Logger) *PodRefresher {
+
+	podActuator := NewActuator(dataRegistry, namespaceReader, ipFamily, podCIDRs, metricsPortName, selector, nil, log)
+	return &PodRefresher{
+		actuator:  podActuator.(*actuator),
+		podReader: podReader,
+		log:       log,
+		limiter:   rate.NewLimiter(podRefreshRate, podRefreshBurst),
+		requests:  make(chan types.NamespacedName, podRefreshBurst),
+	}
+}
+
+// RequestRefresh schedules a refresh of the specified pod. It does not block, and the request is dropped, if it
+// exceeds the rate limit. Concurrency-safe.
+func (r *PodRefresher) RequestRefresh(namespace string, podName string) {
+	log := r.log.WithValues("namespace", namespace, "name", podName)
+	if !r.limiter.Allow() {
+		log.V(app.VerbosityVerbose).Info("Pod refresh rate limit reached, dropping refresh request")
+		return
+	}
+
+	select {
+	case r.requests <- types.NamespacedName{Namespace: namespace, Name: podName}:
+		log.V(app.VerbosityVerbose).Info("Pod refresh requested")
+	default:
+		log.V(app.VerbosityVerbose).Info("Too many pending pod refresh requests, dropping refresh request")
+	}
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It processes refresh requests, one at
+// a time, until the context is cancelled.
+func (r *PodRefresher) Start(ctx context.Context) error {
+	r.log.V(app.VerbosityVerbose).Info("Pod refresher started")
+	for {
+		select {
+		case <-ctx.Done():
+			r.log.V(app.VerbosityInfo).Info("Context closed, exiting")
+			return nil
+		case key := <-r.requests:
+			r.refresh(ctx, key)
+		}
+	}
+}
+
+// refresh reads the specified pod, and updates the registry accordingly. A pod which no longer exists is removed from
+// the registry.
+func (r *PodRefresher) refresh(ctx context.Context, key types.NamespacedName) {
+	log := r.log.WithValues("namespace", key.Namespace, "name", key.Name)
+
+	pod := &corev1.Pod{}
+	if err := r.podReader.Get(ctx, key, pod); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.V(app.VerbosityError).Error(err, "Failed to read pod for refresh")
+			return
+		}
+		log.V(app.VerbosityVerbose).Info("Refreshed pod no longer exists")
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+		_, _ = r.actuator.Delete(ctx, pod) // Never fails
+		return
+	}
+
+	if pod.DeletionTimestamp != nil {
+		log.V(app.VerbosityVerbose).Info("Refreshed pod is terminating")
+		_, _ = r.actuator.Delete(ctx, pod)
+		return
+	}
+	if _, err := r.actuator.CreateOrUpdate(ctx, pod); err != nil {
+		log.V(app.VerbosityError).Error(err, "Failed to refresh pod")
+		return
+	}
+	log.V(app.VerbosityVerbose).Info("Pod refreshed")
+}
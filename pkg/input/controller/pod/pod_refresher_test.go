@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+var _ = Describe("input.controller.pod.PodRefresher", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "my-pod"
+		oldIP       = "192.168.1.1"
+		newIP       = "192.168.1.2"
+	)
+
+	var (
+		newTestPod = func(ip string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: testNs,
+					Name:      testPodName,
+					Labels:    map[string]string{"app": "kubernetes", "role": "apiserver"},
+				},
+				Status: corev1.PodStatus{PodIP: ip},
+			}
+		}
+		// Creates a refresher which reads pods from a fake client containing the specified objects. The registry has
+		// a record of the test pod at oldIP.
+		newTestRefresher = func(objects ...client.Object) (*PodRefresher, input_data_registry.InputDataRegistry) {
+			idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
+			idr.SetKapiData(testNs, testPodName, "", nil, "https://"+oldIP+"/metrics")
+			podReader := fake.NewClientBuilder().WithObjects(objects...).Build()
+			refresher := NewPodRefresher(
+				idr, podReader, fake.NewClientBuilder().Build(), "", nil, "", nil, logr.Discard())
+			return refresher, idr
+		}
+	)
+
+	Describe("refresh", func() {
+		It("should record the pod's current metrics URL", func() {
+			// Arrange
+			refresher, idr := newTestRefresher(newTestPod(newIP))
+
+			// Act
+			refresher.refresh(context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName})
+
+			// Assert
+			Expect(idr.GetKapiData(testNs, testPodName).MetricsUrl).To(Equal("https://" + newIP + "/metrics"))
+		})
+
+		It("should remove the record of a pod which no longer exists", func() {
+			// Arrange
+			refresher, idr := newTestRefresher()
+
+			// Act
+			refresher.refresh(context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName})
+
+			// Assert
+			Expect(idr.GetKapiData(testNs, testPodName)).To(BeNil())
+		})
+	})
+
+	Describe("RequestRefresh", func() {
+		It("should refresh the pod, once started", func() {
+			// Arrange
+			refresher, idr := newTestRefresher(newTestPod(newIP))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() { _ = refresher.Start(ctx) }()
+
+			// Act
+			refresher.RequestRefresh(testNs, testPodName)
+
+			// Assert
+			Eventually(func() string {
+				return idr.GetKapiData(testNs, testPodName).MetricsUrl
+			}).Should(Equal("https://" + newIP + "/metrics"))
+		})
+
+		It("should drop requests in excess of the burst limit, without blocking", func() {
+			// Arrange
+			refresher, _ := newTestRefresher()
+
+			// Act
+			for i := 0; i < 2*podRefreshBurst; i++ {
+				refresher.RequestRefresh(testNs, testPodName)
+			}
+
+			// Assert
+			Expect(refresher.requests).To(HaveLen(podRefreshBurst))
+		})
+	})
+})
@@ -17,24 +17,22 @@ import (
 )
 
 // NewPredicate creates a predicate filter meant to run against a seed cluster. It allows a pod event if that pod is a
-// shoot kube-apiserver.
-func NewPredicate(log logr.Logger) predicate.Predicate {
+// shoot kube-apiserver, as identified by the specified selector. A nil selector applies the Gardener defaults.
+func NewPredicate(selector *gutil.KapiSelector, log logr.Logger) predicate.Predicate {
 	return &podPredicate{
-		log: log.WithName("pod-predicate"),
+		selector: selector,
+		log:      log.WithName("pod-predicate"),
 	}
 }
 
 // See NewPredicate
 type podPredicate struct {
-	log logr.Logger
+	selector *gutil.KapiSelector
+	log      logr.Logger
 }
 
-func isPodLabeledAsShootKapi(pod client.Object) bool {
-	return pod.GetLabels() != nil && pod.GetLabels()["app"] == "kubernetes" && pod.GetLabels()["role"] == "apiserver"
-}
-
-func isKapiPod(pod *corev1.Pod) bool {
-	return gutil.IsShootNamespace(pod.Namespace) && isPodLabeledAsShootKapi(pod)
+func isPodLabeledAsShootKapi(pod client.Object, selector *gutil.KapiSelector) bool {
+	return pod.GetLabels() != nil && selector.IsKapiPodLabels(pod.GetLabels())
 }
 
 // Is the object a shoot CP pod, containing one of shoot's kube-apiserver instances
@@ -49,7 +47,7 @@ func (p *podPredicate) isKapiPod(obj client.Object) bool {
 		return false
 	}
 
-	return isKapiPod(pod)
+	return p.selector.IsShootNamespace(pod.Namespace) && isPodLabeledAsShootKapi(pod, p.selector)
 }
 
 // Create returns true if the event target is a shoot control plane kube-apiserver pod
@@ -58,18 +56,19 @@ func (p *podPredicate) Create(e event.CreateEvent) bool {
 }
 
 // Update returns true if the event target is a shoot control plane kube-apiserver pod which experienced changes
-// which 1) affect metrics scraping, or 2) change the identification of the pod as shoot kube-apiserver pod
+// which 1) affect metrics scraping or the pod's readiness, or 2) change the identification of the pod as shoot
+// kube-apiserver pod
 func (p *podPredicate) Update(e event.UpdateEvent) (result bool) {
 	if e.ObjectNew == nil {
 		p.log.Error(nil, "Update event has no new object")
 		return false
 	}
-	if !gutil.IsShootNamespace(e.ObjectNew.GetNamespace()) {
+	if !p.selector.IsShootNamespace(e.ObjectNew.GetNamespace()) {
 		return false
 	}
 
-	isOldLabeledKapi := isPodLabeledAsShootKapi(e.ObjectOld)
-	isNewLabeledKapi := isPodLabeledAsShootKapi(e.ObjectNew)
+	isOldLabeledKapi := isPodLabeledAsShootKapi(e.ObjectOld, p.selector)
+	isNewLabeledKapi := isPodLabeledAsShootKapi(e.ObjectNew, p.selector)
 
 	if !isOldLabeledKapi && !isNewLabeledKapi {
 		return false // Pod has nothing to do with ShootKapis
@@ -95,7 +94,13 @@ func (p *podPredicate) Update(e event.UpdateEvent) (result bool) {
 		return true
 	}
 
-	return oldPod.Status.PodIP != newPod.Status.PodIP || !reflect.DeepEqual(oldPod.Labels, newPod.Labels)
+	return oldPod.Status.PodIP != newPod.Status.PodIP ||
+		isPodReady(oldPod) != isPodReady(newPod) ||
+		!reflect.DeepEqual(oldPod.Labels, newPod.Labels) ||
+		oldPod.Annotations[ScrapePeriodAnnotation] != newPod.Annotations[ScrapePeriodAnnotation] ||
+		oldPod.Annotations[MetricsPortAnnotation] != newPod.Annotations[MetricsPortAnnotation] ||
+		oldPod.Annotations[MetricsPathAnnotation] != newPod.Annotations[MetricsPathAnnotation] ||
+		oldPod.Annotations[ScrapeAnnotation] != newPod.Annotations[ScrapeAnnotation]
 }
 
 // Delete returns true if the event target is a shoot control plane kube-apiserver pod
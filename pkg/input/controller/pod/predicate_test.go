@@ -11,6 +11,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
 )
 
 var _ = Describe("input.controler.pod.predicate", func() {
@@ -32,7 +34,7 @@ var _ = Describe("input.controler.pod.predicate", func() {
 	Describe("Create and Delete", func() {
 		It("should return true if the event target is a shoot control plane kube-apiserver pod", func() {
 			// Arrange
-			predicate := NewPredicate(logr.Discard())
+			predicate := NewPredicate(nil, logr.Discard())
 
 			// Act
 			allowCreate := predicate.Create(event.CreateEvent{Object: newTestPod()})
@@ -44,7 +46,7 @@ var _ = Describe("input.controler.pod.predicate", func() {
 		})
 		It("should return false if the event target is not a shoot namespace", func() {
 			// Arrange
-			predicate := NewPredicate(logr.Discard())
+			predicate := NewPredicate(nil, logr.Discard())
 			pod := newTestPod()
 			pod.Namespace = "not--shoot"
 
@@ -58,7 +60,7 @@ var _ = Describe("input.controler.pod.predicate", func() {
 		})
 		It("should return false if the event target is not labeled accordingly", func() {
 			// Arrange
-			predicate := NewPredicate(logr.Discard())
+			predicate := NewPredicate(nil, logr.Discard())
 			podNoApp := newTestPod()
 			podNoApp.Labels["app"] = "not-kubernetes"
 			podNoRole := newTestPod()
@@ -76,9 +78,26 @@ var _ = Describe("input.controler.pod.predicate", func() {
 			Expect(allowCreateNoRole).To(BeFalse())
 			Expect(allowDeleteNoRole).To(BeFalse())
 		})
+		It("should apply the criteria of the specified selector", func() {
+			// Arrange
+			selector, err := gutil.NewKapiSelector("component=kube-apiserver", "cp-", "")
+			Expect(err).To(Succeed())
+			predicate := NewPredicate(selector, logr.Discard())
+			customPod := newTestPod()
+			customPod.Namespace = "cp-my-shoot"
+			customPod.Labels = map[string]string{"component": "kube-apiserver"}
+
+			// Act
+			allowCustom := predicate.Create(event.CreateEvent{Object: customPod})
+			allowDefault := predicate.Create(event.CreateEvent{Object: newTestPod()})
+
+			// Assert
+			Expect(allowCustom).To(BeTrue())
+			Expect(allowDefault).To(BeFalse())
+		})
 		It("should return false if the event target is not a pod", func() {
 			// Arrange
-			predicate := NewPredicate(logr.Discard())
+			predicate := NewPredicate(nil, logr.Discard())
 			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
 				Namespace: testNs,
 				Labels:    map[string]string{"app": "kubernetes", "role": "apiserver"},
@@ -96,7 +115,7 @@ var _ = Describe("input.controler.pod.predicate", func() {
 	Describe("Update", func() {
 		It("should return true if the pod IP changed", func() {
 			// Arrange
-			predicate := NewPredicate(logr.Discard())
+			predicate := NewPredicate(nil, logr.Discard())
 			oldPod := newTestPod()
 			newPod := newTestPod()
 			newPod.Status.PodIP = "192.168.22.22"
@@ -107,9 +126,50 @@ var _ = Describe("input.controler.pod.predicate", func() {
 			// Assert
 			Expect(allow).To(BeTrue())
 		})
+		It("should return true if the pod readiness changed", func() {
+			// Arrange
+			predicate := NewPredicate(nil, logr.Discard())
+			oldPod := newTestPod()
+			newPod := newTestPod()
+			newPod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+
+			// Act
+			allow := predicate.Update(event.UpdateEvent{ObjectOld: oldPod, ObjectNew: newPod})
+
+			// Assert
+			Expect(allow).To(BeTrue())
+		})
+		It("should return true if the scrape period annotation changed", func() {
+			// Arrange
+			predicate := NewPredicate(nil, logr.Discard())
+			oldPod := newTestPod()
+			newPod := newTestPod()
+			newPod.Annotations = map[string]string{ScrapePeriodAnnotation: "15s"}
+
+			// Act
+			allow := predicate.Update(event.UpdateEvent{ObjectOld: oldPod, ObjectNew: newPod})
+
+			// Assert
+			Expect(allow).To(BeTrue())
+		})
+		It("should return true if the metrics port, metrics path, or scrape annotation changed", func() {
+			for _, annotation := range []string{MetricsPortAnnotation, MetricsPathAnnotation, ScrapeAnnotation} {
+				// Arrange
+				predicate := NewPredicate(nil, logr.Discard())
+				oldPod := newTestPod()
+				newPod := newTestPod()
+				newPod.Annotations = map[string]string{annotation: "8443"}
+
+				// Act
+				allow := predicate.Update(event.UpdateEvent{ObjectOld: oldPod, ObjectNew: newPod})
+
+				// Assert
+				Expect(allow).To(BeTrue())
+			}
+		})
 		It("should return true if the pod labeling changed from Kapi to not Kapi", func() {
 			// Arrange
-			predicate := NewPredicate(logr.Discard())
+			predicate := NewPredicate(nil, logr.Discard())
 			oldPod := newTestPod()
 			newPod := newTestPod()
 			newPod.Labels["role"] = "no-apiserver"
@@ -122,7 +182,7 @@ var _ = Describe("input.controler.pod.predicate", func() {
 		})
 		It("should return true if the pod was labeled as Kapi, but the labels were removed", func() {
 			// Arrange
-			predicate := NewPredicate(logr.Discard())
+			predicate := NewPredicate(nil, logr.Discard())
 			oldPod := newTestPod()
 			newPod := newTestPod()
 			newPod.Labels = nil
@@ -135,7 +195,7 @@ var _ = Describe("input.controler.pod.predicate", func() {
 		})
 		It("should return true if the pod labeling changed from not Kapi to Kapi", func() {
 			// Arrange
-			predicate := NewPredicate(logr.Discard())
+			predicate := NewPredicate(nil, logr.Discard())
 			oldPod := newTestPod()
 			newPod := newTestPod()
 			oldPod.Labels["role"] = "no-apiserver"
@@ -151,7 +211,7 @@ var _ = Describe("input.controler.pod.predicate", func() {
 			"and do not affect metrics scraping", func() {
 
 			// Arrange
-			predicate := NewPredicate(logr.Discard())
+			predicate := NewPredicate(nil, logr.Discard())
 			oldPod := newTestPod()
 			newPod := newTestPod()
 			newPod.ObjectMeta.Annotations = map[string]string{"key": "value"}
@@ -168,7 +228,7 @@ var _ = Describe("input.controler.pod.predicate", func() {
 		Context("if the event target is a pod which experienced changes which affect metrics scraping:", func() {
 			It("should return false if the namespace is not a shoot namespace", func() {
 				// Arrange
-				predicate := NewPredicate(logr.Discard())
+				predicate := NewPredicate(nil, logr.Discard())
 				oldPod := newTestPod()
 				newPod := newTestPod()
 				newPod.Status.PodIP = "192.168.22.22"
@@ -183,7 +243,7 @@ var _ = Describe("input.controler.pod.predicate", func() {
 			})
 			It("should return false if the event targets are not labelled accordingly", func() {
 				// Arrange
-				predicate := NewPredicate(logr.Discard())
+				predicate := NewPredicate(nil, logr.Discard())
 				oldPod := newTestPod()
 				newPod := newTestPod()
 				newPod.Status.PodIP = "192.168.22.22"
@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ScrapeAnnotation, if present on a kube-apiserver pod with the value "false", excludes the pod from scraping, e.g.
+// while debugging it, or during a canary rollout. An excluded pod is never added to the scrape targets. Annotating a
+// pod which is already a scrape target removes the target, along with the metrics on record for it. Removing the
+// annotation, or setting it to "true", adds the target back, with no metrics on record, as for a newly created pod.
+// Other values are ignored, and the pod is scraped.
+const ScrapeAnnotation = "custom-metrics.gardener.cloud/scrape"
+
+// parseScrapeAnnotation returns false if the ScrapeAnnotation among the specified annotations excludes the pod from
+// scraping, and true if the annotation is absent, or allows scraping.
+func parseScrapeAnnotation(annotations map[string]string) (bool, error) {
+	value, ok := annotations[ScrapeAnnotation]
+	if !ok {
+		return true, nil
+	}
+
+	isScraped, err := strconv.ParseBool(value)
+	if err != nil {
+		return true, fmt.Errorf("parsing annotation %s: %w", ScrapeAnnotation, err)
+	}
+
+	return isScraped, nil
+}
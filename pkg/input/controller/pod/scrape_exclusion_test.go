@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("input.controller.pod scrape exclusion", func() {
+	Describe("parseScrapeAnnotation", func() {
+		It("should return false only if the annotation excludes the pod", func() {
+			Expect(parseScrapeAnnotation(map[string]string{ScrapeAnnotation: "false"})).To(BeFalse())
+			Expect(parseScrapeAnnotation(map[string]string{ScrapeAnnotation: "true"})).To(BeTrue())
+			Expect(parseScrapeAnnotation(nil)).To(BeTrue())
+		})
+		It("should return true and an error if the value is malformed", func() {
+			isScraped, err := parseScrapeAnnotation(map[string]string{ScrapeAnnotation: "never"})
+			Expect(err).To(HaveOccurred())
+			Expect(isScraped).To(BeTrue())
+		})
+	})
+})
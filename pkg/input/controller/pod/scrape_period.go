@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
+)
+
+const (
+	// ScrapePeriodAnnotation, if present on a kube-apiserver pod or on its shoot namespace, overrides the global scrape
+	// period for that pod. The value is a duration between 5s and 60s, e.g. "15s". Other values are logged and ignored.
+	// The pod annotation takes precedence over the namespace annotation.
+	ScrapePeriodAnnotation = "custom-metrics.gardener.cloud/scrape-period"
+
+	minScrapePeriodOverride = 5 * time.Second // Protects kube-apiservers from being scraped too aggressively
+	// Keeps the samples fresh enough to be served. Stays well below the default --max-sample-age of 90s, so a sample
+	// does not age out between two scrapes, even if a scrape takes long.
+	maxScrapePeriodOverride = 60 * time.Second
+)
+
+// The annotations on a shoot namespace, which affect the scraping of the kube-apiserver pods in that namespace
+var namespaceAnnotations = []string{
+	ScrapePeriodAnnotation, ScrapeSchemeAnnotation, InsecureSkipTLSVerifyAnnotation, ScrapeTransportAnnotation,
+	TLSServerNameAnnotation,
+}
+
+// parseScrapePeriodAnnotation returns the scrape period specified by the ScrapePeriodAnnotation among the specified
+// annotations, or zero if the annotation is absent. Values outside [minScrapePeriodOverride, maxScrapePeriodOverride]
+// are rejected.
+func parseScrapePeriodAnnotation(annotations map[string]string) (time.Duration, error) {
+	value, ok := annotations[ScrapePeriodAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	period, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("parsing annotation %s: %w", ScrapePeriodAnnotation, err)
+	}
+	if period < minScrapePeriodOverride {
+		return 0, fmt.Errorf(
+			"annotation %s: the value %s is less than the minimum of %s", ScrapePeriodAnnotation, value, minScrapePeriodOverride)
+	}
+	if period > maxScrapePeriodOverride {
+		return 0, fmt.Errorf(
+			"annotation %s: the value %s is more than the maximum of %s", ScrapePeriodAnnotation, value, maxScrapePeriodOverride)
+	}
+
+	return period, nil
+}
+
+// mapNamespaceToKapiPods returns a function which maps a shoot namespace to reconcile requests for the kube-apiserver
+// pods in that namespace, as identified by selector. It is used to reconcile the pods when the scrape period or scrape
+// settings annotations on their namespace change.
+func mapNamespaceToKapiPods(
+	reader client.Reader,
+	selector *gutil.KapiSelector,
+	log logr.Logger) func(ctx context.Context, obj client.Object) []reconcile.Request {
+
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		pods := &corev1.PodList{}
+		err := reader.List(
+			ctx, pods, client.InNamespace(obj.GetName()), client.MatchingLabelsSelector{Selector: selector.PodLabelSelector()})
+		if err != nil {
+			log.Error(err, "Listing kube-apiserver pods in namespace failed", "namespace", obj.GetName())
+			return nil
+		}
+
+		requests := make([]reconcile.Request, 0, len(pods.Items))
+		for i := range pods.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pods.Items[i])})
+		}
+		return requests
+	}
+}
+
+// newNamespacePredicate creates a predicate filter meant to run against a seed cluster. It allows a namespace update
+// event if the namespace is a shoot namespace, as identified by selector, and the scrape period or scrape settings
+// annotations changed.
+func newNamespacePredicate(selector *gutil.KapiSelector) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return false }, // The pods get reconciled on their own
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectOld == nil || e.ObjectNew == nil || !selector.IsShootNamespace(e.ObjectNew.GetName()) {
+				return false
+			}
+			for _, annotation := range namespaceAnnotations {
+				oldValue, oldOk := e.ObjectOld.GetAnnotations()[annotation]
+				newValue, newOk := e.ObjectNew.GetAnnotations()[annotation]
+				if oldValue != newValue || oldOk != newOk {
+					return true
+				}
+			}
+			return false
+		},
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
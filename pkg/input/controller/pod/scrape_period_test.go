@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("input.controller.pod scrape period", func() {
+	const testNs = "shoot--my-shoot"
+
+	Describe("parseScrapePeriodAnnotation", func() {
+		It("should return the annotated period, or zero if the annotation is absent", func() {
+			Expect(parseScrapePeriodAnnotation(map[string]string{ScrapePeriodAnnotation: "15s"})).
+				To(Equal(15 * time.Second))
+			Expect(parseScrapePeriodAnnotation(nil)).To(BeZero())
+		})
+		It("should return an error if the value is malformed, less than the minimum, or more than the maximum", func() {
+			for _, value := range []string{"fast", "4s", "-1m", "61s", "10m"} {
+				_, err := parseScrapePeriodAnnotation(map[string]string{ScrapePeriodAnnotation: value})
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Describe("mapNamespaceToKapiPods", func() {
+		It("should map the namespace to the kube-apiserver pods in it", func() {
+			// Arrange
+			newPod := func(ns, name, role string) *corev1.Pod {
+				return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+					Namespace: ns,
+					Name:      name,
+					Labels:    map[string]string{"app": "kubernetes", "role": role},
+				}}
+			}
+			client := fake.NewClientBuilder().WithObjects(
+				newPod(testNs, "kapi", "apiserver"),
+				newPod(testNs, "etcd", "etcd"),
+				newPod("shoot--other", "kapi", "apiserver"),
+			).Build()
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNs}}
+
+			// Act
+			requests := mapNamespaceToKapiPods(client, nil, logr.Discard())(context.Background(), namespace)
+
+			// Assert
+			Expect(requests).To(Equal([]reconcile.Request{
+				{NamespacedName: types.NamespacedName{Namespace: testNs, Name: "kapi"}},
+			}))
+		})
+	})
+
+	Describe("newNamespacePredicate", func() {
+		newNamespace := func(name string, scrapePeriod string) *corev1.Namespace {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+			if scrapePeriod != "" {
+				ns.Annotations = map[string]string{ScrapePeriodAnnotation: scrapePeriod}
+			}
+			return ns
+		}
+
+		It("should allow updates of shoot namespaces, which change the scrape period annotation", func() {
+			// Arrange
+			predicate := newNamespacePredicate(nil)
+
+			// Act & Assert
+			Expect(predicate.Update(event.UpdateEvent{
+				ObjectOld: newNamespace(testNs, ""), ObjectNew: newNamespace(testNs, "15s")})).To(BeTrue())
+			Expect(predicate.Update(event.UpdateEvent{
+				ObjectOld: newNamespace(testNs, "15s"), ObjectNew: newNamespace(testNs, "15s")})).To(BeFalse())
+			Expect(predicate.Update(event.UpdateEvent{
+				ObjectOld: newNamespace("garden", ""), ObjectNew: newNamespace("garden", "15s")})).To(BeFalse())
+			Expect(predicate.Create(event.CreateEvent{Object: newNamespace(testNs, "15s")})).To(BeFalse())
+		})
+
+		It("should allow updates of shoot namespaces, which change the scrape settings annotations", func() {
+			// Arrange
+			predicate := newNamespacePredicate(nil)
+			newNs := newNamespace(testNs, "")
+			newNs.Annotations = map[string]string{InsecureSkipTLSVerifyAnnotation: "true"}
+
+			// Act & Assert
+			Expect(predicate.Update(event.UpdateEvent{ObjectOld: newNamespace(testNs, ""), ObjectNew: newNs})).To(BeTrue())
+		})
+	})
+})
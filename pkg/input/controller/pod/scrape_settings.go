@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+const (
+	// ScrapeSchemeAnnotation, if present on a shoot namespace, specifies the URL scheme used to scrape the shoot's
+	// kube-apiserver pods: "https" or "http". See InsecureSkipTLSVerifyAnnotation.
+	ScrapeSchemeAnnotation = "custom-metrics.gardener.cloud/scrape-scheme"
+	// InsecureSkipTLSVerifyAnnotation, if present on a shoot namespace with the value "true", disables the verification
+	// of the serving certificates of the shoot's kube-apiserver pods. Meant for development clusters only.
+	//
+	// If any of this, the ScrapeSchemeAnnotation, the ScrapeTransportAnnotation, or the TLSServerNameAnnotation is
+	// present, the settings specified by the four annotations replace the global ones as a whole. An absent annotation
+	// then means https, certificate verification, direct connections, or the "kube-apiserver" server name,
+	// respectively.
+	InsecureSkipTLSVerifyAnnotation = "custom-metrics.gardener.cloud/insecure-skip-tls-verify"
+	// ScrapeTransportAnnotation, if present on a shoot namespace, specifies how the shoot's kube-apiserver pods are
+	// reached: "direct", or "port-forward" - through the seed kube-apiserver's pods/portforward subresource, for seeds
+	// where the pods cannot be reached directly. See InsecureSkipTLSVerifyAnnotation.
+	ScrapeTransportAnnotation = "custom-metrics.gardener.cloud/scrape-transport"
+	// TLSServerNameAnnotation, if present on a shoot namespace, specifies the server name which the serving
+	// certificates of the shoot's kube-apiserver pods are expected to carry. The value "*" accepts any server name, as
+	// long as the certificate is signed by the shoot CA. See InsecureSkipTLSVerifyAnnotation.
+	TLSServerNameAnnotation = "custom-metrics.gardener.cloud/tls-server-name"
+)
+
+// parseScrapeSettingsAnnotations returns the scrape settings specified by the annotations of a shoot namespace, or nil
+// if none of ScrapeSchemeAnnotation, InsecureSkipTLSVerifyAnnotation, ScrapeTransportAnnotation, and
+// TLSServerNameAnnotation is present.
+func parseScrapeSettingsAnnotations(annotations map[string]string) (*input_data_registry.ShootScrapeSettings, error) {
+	scheme, hasScheme := annotations[ScrapeSchemeAnnotation]
+	insecure, hasInsecure := annotations[InsecureSkipTLSVerifyAnnotation]
+	transport, hasTransport := annotations[ScrapeTransportAnnotation]
+	serverName, hasServerName := annotations[TLSServerNameAnnotation]
+	if !hasScheme && !hasInsecure && !hasTransport && !hasServerName {
+		return nil, nil
+	}
+
+	settings := &input_data_registry.ShootScrapeSettings{Scheme: input_data_registry.ScrapeSchemeHTTPS}
+	if hasScheme {
+		switch scheme {
+		case input_data_registry.ScrapeSchemeHTTPS, input_data_registry.ScrapeSchemeHTTP:
+			settings.Scheme = scheme
+		default:
+			return nil, fmt.Errorf(
+				"annotation %s: the value '%s' is neither '%s', nor '%s'", ScrapeSchemeAnnotation, scheme,
+				input_data_registry.ScrapeSchemeHTTPS, input_data_registry.ScrapeSchemeHTTP)
+		}
+	}
+	if hasInsecure {
+		var err error
+		if settings.InsecureSkipTLSVerify, err = strconv.ParseBool(insecure); err != nil {
+			return nil, fmt.Errorf("parsing annotation %s: %w", InsecureSkipTLSVerifyAnnotation, err)
+		}
+	}
+	if hasTransport {
+		switch transport {
+		case input_data_registry.ScrapeTransportDirect, input_data_registry.ScrapeTransportPortForward:
+			settings.Transport = transport
+		default:
+			return nil, fmt.Errorf(
+				"annotation %s: the value '%s' is neither '%s', nor '%s'", ScrapeTransportAnnotation, transport,
+				input_data_registry.ScrapeTransportDirect, input_data_registry.ScrapeTransportPortForward)
+		}
+	}
+	if hasServerName {
+		if serverName == "" {
+			return nil, fmt.Errorf("annotation %s: the value must not be empty", TLSServerNameAnnotation)
+		}
+		settings.TLSServerName = serverName
+	}
+
+	return settings, nil
+}
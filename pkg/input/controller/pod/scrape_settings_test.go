@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pod
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+var _ = Describe("input.controller.pod scrape settings", func() {
+	Describe("parseScrapeSettingsAnnotations", func() {
+		It("should return nil if none of the annotations is present", func() {
+			Expect(parseScrapeSettingsAnnotations(map[string]string{"other": "value"})).To(BeNil())
+			Expect(parseScrapeSettingsAnnotations(nil)).To(BeNil())
+		})
+		It("should return the annotated settings, with https and certificate verification for absent values", func() {
+			Expect(parseScrapeSettingsAnnotations(map[string]string{ScrapeSchemeAnnotation: "http"})).To(Equal(
+				&input_data_registry.ShootScrapeSettings{Scheme: input_data_registry.ScrapeSchemeHTTP}))
+			Expect(parseScrapeSettingsAnnotations(map[string]string{InsecureSkipTLSVerifyAnnotation: "true"})).To(Equal(
+				&input_data_registry.ShootScrapeSettings{
+					Scheme:                input_data_registry.ScrapeSchemeHTTPS,
+					InsecureSkipTLSVerify: true,
+				}))
+			Expect(parseScrapeSettingsAnnotations(map[string]string{ScrapeTransportAnnotation: "port-forward"})).To(Equal(
+				&input_data_registry.ShootScrapeSettings{
+					Scheme:    input_data_registry.ScrapeSchemeHTTPS,
+					Transport: input_data_registry.ScrapeTransportPortForward,
+				}))
+			Expect(parseScrapeSettingsAnnotations(map[string]string{TLSServerNameAnnotation: "*"})).To(Equal(
+				&input_data_registry.ShootScrapeSettings{
+					Scheme:        input_data_registry.ScrapeSchemeHTTPS,
+					TLSServerName: input_data_registry.TLSServerNameAny,
+				}))
+		})
+		It("should return an error if a value is malformed", func() {
+			for _, annotations := range []map[string]string{
+				{ScrapeSchemeAnnotation: "ftp"},
+				{InsecureSkipTLSVerifyAnnotation: "maybe"},
+				{ScrapeTransportAnnotation: "carrier-pigeon"},
+				{TLSServerNameAnnotation: ""},
+			} {
+				_, err := parseScrapeSettingsAnnotations(annotations)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+})
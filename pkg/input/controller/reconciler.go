@@ -7,7 +7,6 @@ package controller
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/go-logr/logr"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -15,6 +14,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
 )
 
 // reconciler implements a reconciler which takes care of plumbing and delegates the real work to an Actuator object
@@ -22,16 +22,26 @@ type reconciler struct {
 	actuator                  Actuator      // The actual work gets delegated to this actuator
 	controlledObjectPrototype client.Object // A prototype instance representing the type of objects reconciled by this reconciler
 	client                    client.Client // The k8s client to be used by the reconciler
-	log                       logr.Logger
+	// Receives the outcome of each reconciliation. May be nil.
+	condition *conditions.ComponentReporter
+	log       logr.Logger
 }
 
-// NewReconciler creates a new Reconciler which delegates the real work to the specified Actuator.
-func NewReconciler(actuator Actuator, controlledObjectPrototype client.Object, client client.Client, log logr.Logger) reconcile.Reconciler {
+// NewReconciler creates a new Reconciler which delegates the real work to the specified Actuator. The outcome of each
+// reconciliation is reported to condition, which may be nil.
+func NewReconciler(
+	actuator Actuator,
+	controlledObjectPrototype client.Object,
+	client client.Client,
+	condition *conditions.ComponentReporter,
+	log logr.Logger) reconcile.Reconciler {
+
 	log.V(app.VerbosityVerbose).Info("Creating reconciler")
 	return &reconciler{
 		actuator:                  actuator,
 		controlledObjectPrototype: controlledObjectPrototype,
 		client:                    client,
+		condition:                 condition,
 		log:                       log,
 	}
 }
@@ -45,7 +55,9 @@ func (r *reconciler) Reconcile(ctx context.Context, request reconcile.Request) (
 	isObjectMissing := false
 	if err := r.client.Get(ctx, request.NamespacedName, obj); err != nil {
 		if !apierrors.IsNotFound(err) {
-			return reconcile.Result{}, fmt.Errorf("error retrieving object from the server: %w", err)
+			err = fmt.Errorf("error retrieving object from the server: %w", err)
+			r.condition.ReportError(err)
+			return reconcile.Result{}, err
 		}
 		isObjectMissing = true
 	}
@@ -53,7 +65,7 @@ func (r *reconciler) Reconcile(ctx context.Context, request reconcile.Request) (
 	log := r.log.WithValues("name", obj.GetName(), "namespace", obj.GetNamespace())
 
 	var actionName string
-	var actionFunction func(context.Context, client.Object) (time.Duration, error)
+	var actionFunction func(context.Context, client.Object) (Result, error)
 	if isObjectMissing || obj.GetDeletionTimestamp() != nil {
 		actionName = "deletion"
 		actionFunction = r.actuator.Delete
@@ -63,10 +75,23 @@ func (r *reconciler) Reconcile(ctx context.Context, request reconcile.Request) (
 	}
 
 	log.V(app.VerbosityVerbose).Info("Reconciling object " + actionName)
-	requeueAfter, err := actionFunction(ctx, obj)
+	result, err := actionFunction(ctx, obj)
 	if err != nil {
 		log.V(app.VerbosityInfo).Info(fmt.Sprintf("Reconciling object %s failed: %s", actionName, err))
+		r.condition.ReportScopedError(
+			conditionScope(obj), fmt.Errorf("reconciling %s/%s: %w", obj.GetNamespace(), obj.GetName(), err))
+	} else {
+		r.condition.ReportScopedSuccess(conditionScope(obj))
 	}
 
-	return reconcile.Result{RequeueAfter: requeueAfter}, err
+	return result.reconcileResult(), err
+}
+
+// conditionScope returns the scope to which the reconciliation of the specified object pertains, in the condition of
+// the controller: the shoot namespace. A namespace object is the shoot namespace itself.
+func conditionScope(obj client.Object) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace()
 }
@@ -19,6 +19,8 @@ import (
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
 )
 
 var _ = Describe("input.controller.reconciler", func() {
@@ -34,7 +36,7 @@ var _ = Describe("input.controller.reconciler", func() {
 			actuator := &fakeActuator{}
 			fakeClient := fake.NewClientBuilder().Build()
 			controlledObjectPrototype := &corev1.Pod{}
-			reconciler := NewReconciler(actuator, controlledObjectPrototype, fakeClient, logr.Discard())
+			reconciler := NewReconciler(actuator, controlledObjectPrototype, fakeClient, nil, logr.Discard())
 			return reconciler, actuator, fakeClient, controlledObjectPrototype
 		}
 	)
@@ -142,7 +144,7 @@ var _ = Describe("input.controller.reconciler", func() {
 				Namespace: testNs,
 			}}
 			Expect(fakeClient.Create(ctx, pod)).To(Succeed())
-			actuator.RequeueAfter = 1 * time.Minute
+			actuator.Result.RequeueAfter = 1 * time.Minute
 			actuator.Err = expectedError
 
 			// Act
@@ -162,7 +164,7 @@ var _ = Describe("input.controller.reconciler", func() {
 				Namespace: testNs,
 			}}
 			Expect(fakeClient.Create(ctx, pod)).To(Succeed())
-			actuator.RequeueAfter = 2 * time.Minute
+			actuator.Result.RequeueAfter = 2 * time.Minute
 
 			// Act
 			result, err := reconciler.Reconcile(
@@ -172,6 +174,50 @@ var _ = Describe("input.controller.reconciler", func() {
 			Expect(err).To(BeNil())
 			Expect(result.RequeueAfter).To(Equal(2 * time.Minute))
 		})
+
+		It("should report the actuator's errors and successes to the condition", func() {
+			// Arrange
+			actuator := &fakeActuator{Err: errors.NewBadRequest("test error")}
+			fakeClient := fake.NewClientBuilder().Build()
+			conditionRegistry := conditions.NewRegistry(logr.Discard())
+			reconciler := NewReconciler(
+				actuator, &corev1.Pod{}, fakeClient, conditionRegistry.NewReporter("TestDegraded", 2, true), logr.Discard())
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: testNs, Name: testPodName}}
+
+			// Act
+			_, _ = reconciler.Reconcile(ctx, request)
+			_, _ = reconciler.Reconcile(ctx, request)
+			afterErrors := conditionRegistry.Conditions()[0]
+			actuator.Err = nil
+			_, _ = reconciler.Reconcile(ctx, request)
+			afterSuccess := conditionRegistry.Conditions()[0]
+
+			// Assert
+			Expect(afterErrors.Status).To(Equal(metav1.ConditionTrue))
+			Expect(afterErrors.Message).To(ContainSubstring(testNs + "/" + testPodName))
+			Expect(afterErrors.Message).To(ContainSubstring("test error"))
+			Expect(afterSuccess.Status).To(Equal(metav1.ConditionFalse))
+			Expect(afterSuccess.TotalErrorCount).To(Equal(int64(2)))
+		})
+
+		It("should report the actuator's errors in the scope of the object's namespace", func() {
+			// Arrange
+			actuator := &fakeActuator{Err: errors.NewBadRequest("test error")}
+			fakeClient := fake.NewClientBuilder().Build()
+			conditionRegistry := conditions.NewRegistry(logr.Discard())
+			condition := conditionRegistry.NewScopedReporter("TestDegraded", 2, true, func() int { return 3 })
+			reconciler := NewReconciler(actuator, &corev1.Pod{}, fakeClient, condition, logr.Discard())
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: testNs, Name: testPodName}}
+
+			// Act
+			_, _ = reconciler.Reconcile(ctx, request)
+			_, _ = reconciler.Reconcile(ctx, request)
+
+			// Assert
+			result := conditionRegistry.Conditions()[0]
+			Expect(result.Status).To(Equal(metav1.ConditionFalse)) // One of three shoots failing
+			Expect(result.FailingScopeCount).To(Equal(1))
+		})
 	})
 })
 
@@ -185,24 +231,24 @@ const (
 )
 
 type fakeActuator struct {
-	CallType     callType
-	Ctx          context.Context
-	Obj          kclient.Object
-	RequeueAfter time.Duration
-	Err          error
+	CallType callType
+	Ctx      context.Context
+	Obj      kclient.Object
+	Result   Result
+	Err      error
 }
 
-func (fa *fakeActuator) CreateOrUpdate(ctx context.Context, obj kclient.Object) (time.Duration, error) {
+func (fa *fakeActuator) CreateOrUpdate(ctx context.Context, obj kclient.Object) (Result, error) {
 	fa.CallType = callTypeCreateOrUpdate
 	fa.Ctx = ctx
 	fa.Obj = obj
-	return fa.RequeueAfter, fa.Err
+	return fa.Result, fa.Err
 }
-func (fa *fakeActuator) Delete(ctx context.Context, obj kclient.Object) (time.Duration, error) {
+func (fa *fakeActuator) Delete(ctx context.Context, obj kclient.Object) (Result, error) {
 	fa.CallType = callTypeDelete
 	fa.Ctx = ctx
 	fa.Obj = obj
-	return fa.RequeueAfter, fa.Err
+	return fa.Result, fa.Err
 }
 
 //#endregion fakeActuator
@@ -7,10 +7,14 @@ package secret
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
@@ -19,10 +23,39 @@ import (
 )
 
 const (
-	secretNameCA          = "ca"
-	secretNameAccessToken = "shoot-access-gardener-custom-metrics"
+	secretNameCA              = "ca"
+	secretNameCAClientCurrent = "ca-client-current"
+	secretNameAccessToken     = "shoot-access-gardener-custom-metrics"
+
+	// In token request mode, a requested token is refreshed once this fraction of its lifetime has passed
+	tokenRefreshLifetimeFraction = 0.8
+)
+
+var (
+	// The secrets which contribute CA certificates to a shoot's kube-apiserver trust pool. During CA rotation, the
+	// certificates of both the old and the new CA may be present, possibly spread across these secrets.
+	caSecretNames = []string{secretNameCA, secretNameCAClientCurrent}
+	// The data keys, in a CA secret, which may contain PEM encoded CA certificates
+	caDataKeys = []string{"ca.crt", "bundle.crt"}
 )
 
+// SecretNames returns the names of the secrets which the secret controller may act upon, in any of its token source
+// modes, including the optional scrape request secret. tokenRequestKubeconfigSecret, if not empty, is the 'name' label
+// of the kubeconfig secret used to request shoot access tokens via the TokenRequest API. Meant for restricting the
+// secrets held by the manager's cache, by their 'name' label.
+func SecretNames(tokenRequestKubeconfigSecret string) []string {
+	result := append(slices.Clone(caSecretNames), secretNameAccessToken, secretNameScrapeRequest)
+	if tokenRequestKubeconfigSecret != "" {
+		result = append(result, tokenRequestKubeconfigSecret)
+	}
+	return result
+}
+
+// isCASecretName returns true if the specified secret is one of the secrets which contribute CA certificates
+func isCASecretName(name string) bool {
+	return slices.Contains(caSecretNames, name)
+}
+
 // The secret actuator acts upon shoot secrets, maintaining the information necessary to scrape
 // the respective shoot kube-apiservers
 type actuator struct {
@@ -30,107 +63,349 @@ type actuator struct {
 	// А concurrency-safe data repository. Source of various data used by the controller and also where the controller
 	// stores the data it produces.
 	dataRegistry input_data_registry.InputDataRegistry
+	// If not nil, shoot access tokens are requested via the TokenRequest API, with the token in the shoot access
+	// secret, instead of using that token for scraping.
+	tokenRequest *TokenRequestConfig
+	// Reads the kubeconfig and access token secrets, in token request mode
+	secretReader client.Reader
+	// If true, shoot access tokens are supplied by another component, and the access token secret is ignored
+	ignoreAccessTokenSecret bool
+	// Records events on shoot access secrets whose token is near expiry, or invalid. May be nil.
+	eventRecorder record.EventRecorder
+	// Exposes the time left until each shoot's access token expires
+	tokenExpiries *tokenExpiryCollector
+
+	// The CA certificates most recently found in each CA secret, by shoot namespace and secret name. The registry
+	// receives the union of all CA secrets of a shoot, so an update or deletion of one secret does not remove the
+	// certificates contributed by the others.
+	caCertificates     map[string]map[string][]byte
+	caCertificatesLock sync.Mutex
+
+	testIsolation actuatorTestIsolation // Provides indirections necessary to isolate the unit during tests
 }
 
 // NewActuator creates a new secret actuator.
 // dataRegistry: a concurrency-safe data repository, source of various data used by the controller, and also where
 // the controller stores the data it produces.
-func NewActuator(dataRegistry input_data_registry.InputDataRegistry, log logr.Logger) gcmctl.Actuator {
+// tokenRequest: if not nil, shoot access tokens are requested via the TokenRequest API, using the kubeconfig secret
+// specified by the config, and the token in the shoot access secret, instead of using that token for scraping.
+// secretReader: reads the kubeconfig and access token secrets in token request mode. Ignored if tokenRequest is nil.
+// ignoreAccessTokenSecret: if true, shoot access tokens are supplied by another component, and the actuator only
+// maintains CA certificates.
+// eventRecorder: if not nil, records Warning events on shoot access secrets whose token is near expiry, or invalid.
+func NewActuator(
+	dataRegistry input_data_registry.InputDataRegistry,
+	tokenRequest *TokenRequestConfig,
+	secretReader client.Reader,
+	ignoreAccessTokenSecret bool,
+	eventRecorder record.EventRecorder,
+	log logr.Logger) gcmctl.Actuator {
 
 	log.V(app.VerbosityVerbose).Info("Creating actuator")
-	return &actuator{
-		dataRegistry: dataRegistry,
-		log:          log,
+	result := &actuator{
+		dataRegistry:            dataRegistry,
+		tokenRequest:            tokenRequest,
+		secretReader:            secretReader,
+		ignoreAccessTokenSecret: ignoreAccessTokenSecret,
+		eventRecorder:           eventRecorder,
+		caCertificates:          make(map[string]map[string][]byte),
+		log:                     log,
+		testIsolation: actuatorTestIsolation{
+			TimeNow: time.Now,
+		},
+	}
+	result.tokenExpiries = newTokenExpiryCollector(func() time.Time { return result.testIsolation.TimeNow() })
+	if tokenRequest != nil {
+		result.testIsolation.RequestToken = newTokenRequestor(tokenRequest).RequestToken
 	}
+
+	return result
 }
 
 // CreateOrUpdate tracks shoot secret creation and update events, and maintains a record of data which
 // is relevant to other components.
-// Returns:
-//   - If an error is returned, the operation is considered to have failed, and reconciliation will be requeued
-//     according to default (exponential) schedule.
-//   - If error is nil and the Duration is greater than 0, the operation completed successfully and a following
-//     reconciliation will be requeued after the specified Duration.
-//   - If error is nil, and the Duration is 0, the operation completed successfully and a following delay-based
-//     reconciliation is not necessary.
-func (a *actuator) CreateOrUpdate(_ context.Context, obj client.Object) (requeueAfter time.Duration, err error) {
+// See [gcmctl.Actuator] for the meaning of the returned values.
+func (a *actuator) CreateOrUpdate(ctx context.Context, obj client.Object) (gcmctl.Result, error) {
 	secret, ok := toSecret(obj, a.log.WithValues("namespace", obj.GetNamespace(), "name", obj.GetName()))
 	if !ok {
-		return 0, nil // Do not requeue
+		return gcmctl.Result{}, nil // Do not requeue
 	}
 
-	if secret.Name == secretNameCA {
+	if isCASecretName(secret.Name) {
 		return a.setCACertificate(secret, false)
 	}
-	if secret.Name == secretNameAccessToken {
+	if secret.Name == secretNameScrapeRequest {
+		return a.setScrapeRequestSettings(secret, false)
+	}
+	if a.tokenRequest != nil {
+		if a.tokenRequest.isKubeconfigSecret(secret) || secret.Name == secretNameAccessToken {
+			return a.requestAuthToken(ctx, secret.Namespace, false)
+		}
+		return gcmctl.Result{}, nil
+	}
+	if secret.Name == secretNameAccessToken && !a.ignoreAccessTokenSecret {
 		return a.setAuthToken(secret, false)
 	}
 
-	return 0, nil
+	return gcmctl.Result{}, nil
 }
 
 // Delete tracks shoot secret deletion events, and deletes the data record maintained for the respective shoot.
-// Returns:
-//   - If an error is returned, the operation is considered to have failed, and reconciliation will be requeued
-//     according to default (exponential) schedule.
-//   - If error is nil and the Duration is greater than 0, the operation completed successfully and a following
-//     reconciliation will be requeued after the specified Duration.
-//   - If error is nil, and the Duration is 0, the operation completed successfully and a following delay-based
-//     reconciliation is not necessary.
-func (a *actuator) Delete(_ context.Context, obj client.Object) (requeueAfter time.Duration, err error) {
+// See [gcmctl.Actuator] for the meaning of the returned values.
+func (a *actuator) Delete(ctx context.Context, obj client.Object) (gcmctl.Result, error) {
 	secret, ok := toSecret(obj, a.log.WithValues("namespace", obj.GetNamespace(), "name", obj.GetName()))
 	if !ok {
-		return 0, nil // Do not requeue
+		return gcmctl.Result{}, nil // Do not requeue
 	}
 
-	if secret.Name == secretNameCA {
+	if isCASecretName(secret.Name) {
 		return a.setCACertificate(secret, true)
 	}
-	if secret.Name == secretNameAccessToken {
+	if secret.Name == secretNameScrapeRequest {
+		return a.setScrapeRequestSettings(secret, true)
+	}
+	if a.tokenRequest != nil {
+		if a.tokenRequest.isKubeconfigSecret(secret) || secret.Name == secretNameAccessToken {
+			// E.g. an old kubeconfig secret, deleted after rotation. The shoot may still have the secrets it needs.
+			return a.requestAuthToken(ctx, secret.Namespace, true)
+		}
+		return gcmctl.Result{}, nil
+	}
+	if secret.Name == secretNameAccessToken && !a.ignoreAccessTokenSecret {
 		return a.setAuthToken(secret, true)
 	}
 
-	return 0, nil
+	return gcmctl.Result{}, nil
 }
 
-func (a *actuator) setCACertificate(secret *corev1.Secret, isDeleteOperation bool) (time.Duration, error) {
+// setCACertificate records the CA certificates in the specified secret, or forgets them upon deletion, and updates the
+// shoot's trust pool in the registry to the union of the certificates across all of the shoot's CA secrets.
+// Returns: (result, error)
+func (a *actuator) setCACertificate(secret *corev1.Secret, isDeleteOperation bool) (gcmctl.Result, error) {
+	var caData []byte
+	if !isDeleteOperation {
+		if secret.Data == nil {
+			return gcmctl.Result{}, fmt.Errorf("data missing in CA secret %s/%s", secret.Namespace, secret.Name)
+		}
+
+		for _, key := range caDataKeys {
+			if len(secret.Data[key]) > 0 {
+				caData = append(caData, secret.Data[key]...)
+				caData = append(caData, '\n')
+			}
+		}
+		if len(caData) == 0 {
+			return gcmctl.Result{}, fmt.Errorf("CA data missing in CA secret %s/%s", secret.Namespace, secret.Name)
+		}
+	}
+
+	a.caCertificatesLock.Lock()
+	defer a.caCertificatesLock.Unlock()
+
+	shootCAs := a.caCertificates[secret.Namespace]
 	if isDeleteOperation {
+		delete(shootCAs, secret.Name)
+	} else {
+		if shootCAs == nil {
+			shootCAs = make(map[string][]byte)
+			a.caCertificates[secret.Namespace] = shootCAs
+		}
+		shootCAs[secret.Name] = caData
+	}
+
+	if len(shootCAs) == 0 {
+		delete(a.caCertificates, secret.Namespace)
 		a.dataRegistry.SetShootCACertificate(secret.Namespace, nil)
-		return 0, nil
+		return gcmctl.Result{}, nil
 	}
 
-	if secret.Data == nil {
-		return 0, fmt.Errorf("data missing in CA secret %s/%s", secret.Namespace, secret.Name)
+	// Use a stable order, so the resulting pool does not depend on the order of events
+	var merged []byte
+	for _, name := range caSecretNames {
+		merged = append(merged, shootCAs[name]...)
 	}
+	a.dataRegistry.SetShootCACertificate(secret.Namespace, merged)
+	return gcmctl.Result{}, nil
+}
 
-	caData := secret.Data["ca.crt"]
-	if len(caData) == 0 {
-		return 0, fmt.Errorf("CA data missing in CA secret %s/%s", secret.Namespace, secret.Name)
+// setScrapeRequestSettings records the scrape request additions in the specified secret, or forgets them upon
+// deletion. If the secret is malformed, the additions on record are kept, and an error is returned.
+// Returns: (result, error)
+func (a *actuator) setScrapeRequestSettings(secret *corev1.Secret, isDeleteOperation bool) (gcmctl.Result, error) {
+	if isDeleteOperation {
+		a.dataRegistry.SetShootScrapeRequestSettings(secret.Namespace, nil)
+		return gcmctl.Result{}, nil
 	}
 
-	a.dataRegistry.SetShootCACertificate(secret.Namespace, caData)
-	return 0, nil
+	settings, err := parseScrapeRequestSettings(secret)
+	if err != nil {
+		return gcmctl.Result{}, fmt.Errorf("scrape request secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	a.dataRegistry.SetShootScrapeRequestSettings(secret.Namespace, settings)
+	return gcmctl.Result{}, nil
 }
 
-// Returns: (requeueAfter, error)
-func (a *actuator) setAuthToken(secret *corev1.Secret, isDeleteOperation bool) (time.Duration, error) {
+// setAuthToken records the token in the specified shoot access secret, or forgets it upon deletion. The token's expiry
+// is checked too, see checkTokenExpiry.
+// Returns: (result, error)
+func (a *actuator) setAuthToken(secret *corev1.Secret, isDeleteOperation bool) (gcmctl.Result, error) {
 	if isDeleteOperation {
 		a.dataRegistry.SetShootAuthSecret(secret.Namespace, "")
-		return 0, nil
+		a.tokenExpiries.set(secret.Namespace, time.Time{})
+		return gcmctl.Result{}, nil
 	}
 
 	if secret.Data == nil {
-		return 0, fmt.Errorf("data missing in auth secret %s/%s", secret.Namespace, secret.Name)
+		return gcmctl.Result{}, fmt.Errorf("data missing in auth secret %s/%s", secret.Namespace, secret.Name)
 	}
 
 	tokenData := secret.Data["token"]
 	if len(tokenData) == 0 {
-		return 0, fmt.Errorf("token data missing in auth secret %s/%s", secret.Namespace, secret.Name)
+		return gcmctl.Result{}, fmt.Errorf("token data missing in auth secret %s/%s", secret.Namespace, secret.Name)
 	}
 
 	a.dataRegistry.SetShootAuthSecret(secret.Namespace, string(tokenData))
 
-	return 0, nil
+	return a.checkTokenExpiry(secret, string(tokenData)), nil
+}
+
+// checkTokenExpiry checks whether the specified token, found in the specified shoot access secret, has expired, or is
+// about to. An expired, or unparsable, token marks the shoot's auth secret as degraded in the registry. A token which
+// is near expiry only raises a warning, ahead of the scrape failures which would follow its expiry. Both conditions are
+// logged, and recorded as events on the secret.
+//
+// Returns a result which requests a following reconciliation at the point in time when the token's state is due to
+// change next, so the warnings are raised even if the secret is not updated in the meantime.
+func (a *actuator) checkTokenExpiry(secret *corev1.Secret, token string) gcmctl.Result {
+	log := a.log.WithValues("namespace", secret.Namespace, "name", secret.Name)
+	expiry, err := parseTokenExpiry(token)
+	a.tokenExpiries.set(secret.Namespace, expiry)
+	if err != nil {
+		a.reportInvalidToken(secret, fmt.Sprintf("the token cannot be parsed: %v", err))
+		return gcmctl.Result{}
+	}
+	if expiry.IsZero() {
+		a.dataRegistry.SetShootAuthDegraded(secret.Namespace, "")
+		return gcmctl.Result{}
+	}
+
+	timeLeft := expiry.Sub(a.testIsolation.TimeNow())
+	if timeLeft <= 0 {
+		a.reportInvalidToken(secret, fmt.Sprintf("the token expired at %s", expiry.UTC().Format(time.RFC3339)))
+		return gcmctl.Result{}
+	}
+
+	a.dataRegistry.SetShootAuthDegraded(secret.Namespace, "")
+	if timeLeft > tokenNearExpiryPeriod {
+		return gcmctl.RequeueAfter(timeLeft - tokenNearExpiryPeriod)
+	}
+
+	log.V(app.VerbosityInfo).Info("Shoot access token is near expiry", "expiry", expiry, "timeLeft", timeLeft)
+	if a.eventRecorder != nil {
+		a.eventRecorder.Eventf(secret, corev1.EventTypeWarning, TokenNearExpiryEventReason,
+			"The shoot access token expires in %s, at %s", timeLeft.Round(time.Second), expiry.UTC().Format(time.RFC3339))
+	}
+	return gcmctl.RequeueAfter(timeLeft)
+}
+
+// reportInvalidToken marks the auth secret of the specified secret's shoot as degraded, for the specified reason, and
+// logs and records the fact
+func (a *actuator) reportInvalidToken(secret *corev1.Secret, reason string) {
+	a.dataRegistry.SetShootAuthDegraded(secret.Namespace, reason)
+	a.log.V(app.VerbosityError).Error(
+		nil, "Shoot access token is invalid", "namespace", secret.Namespace, "name", secret.Name, "reason", reason)
+	if a.eventRecorder != nil {
+		a.eventRecorder.Eventf(secret, corev1.EventTypeWarning, TokenInvalidEventReason,
+			"The shoot access token is invalid: %s", reason)
+	}
+}
+
+// requestAuthToken uses the kubeconfig secret and the access token secret of the specified shoot to request a shoot
+// access token, and records the token. The returned result requests a following reconciliation, so that the token gets
+// refreshed well before it expires.
+//
+// If the shoot lacks one of the secrets, no token is requested. If isDeleteOperation is true, i.e. one of the secrets
+// was deleted, the recorded token is then forgotten. Otherwise, it is kept until the shoot has both secrets again.
+func (a *actuator) requestAuthToken(
+	ctx context.Context, namespace string, isDeleteOperation bool) (gcmctl.Result, error) {
+
+	kubeconfigSecret, err := a.getKubeconfigSecret(ctx, namespace)
+	if err != nil {
+		return gcmctl.Result{}, err
+	}
+	accessTokenSecret := &corev1.Secret{}
+	err = a.secretReader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: secretNameAccessToken}, accessTokenSecret)
+	if apierrors.IsNotFound(err) {
+		accessTokenSecret = nil
+	} else if err != nil {
+		return gcmctl.Result{}, fmt.Errorf("shoot %s: reading the access token secret: %w", namespace, err)
+	}
+
+	if kubeconfigSecret == nil || accessTokenSecret == nil {
+		a.log.V(app.VerbosityVerbose).Info("Shoot lacks the secrets to request an access token",
+			"namespace", namespace,
+			"hasKubeconfigSecret", kubeconfigSecret != nil,
+			"hasAccessTokenSecret", accessTokenSecret != nil)
+		if isDeleteOperation {
+			a.dataRegistry.SetShootAuthSecret(namespace, "")
+			a.tokenExpiries.set(namespace, time.Time{})
+		}
+		return gcmctl.Result{}, nil
+	}
+
+	kubeconfig := kubeconfigSecret.Data["kubeconfig"]
+	if len(kubeconfig) == 0 {
+		return gcmctl.Result{}, fmt.Errorf(
+			"kubeconfig data missing in secret %s/%s", kubeconfigSecret.Namespace, kubeconfigSecret.Name)
+	}
+	bearerToken := accessTokenSecret.Data["token"]
+	if len(bearerToken) == 0 {
+		return gcmctl.Result{}, fmt.Errorf("token data missing in auth secret %s/%s", namespace, secretNameAccessToken)
+	}
+
+	token, expiration, err := a.testIsolation.RequestToken(ctx, namespace, kubeconfig, string(bearerToken))
+	if err != nil {
+		return gcmctl.Result{}, fmt.Errorf("shoot %s: %w", namespace, err)
+	}
+	if token == "" {
+		return gcmctl.Result{}, fmt.Errorf("shoot %s: the token request returned an empty token", namespace)
+	}
+
+	a.dataRegistry.SetShootAuthSecret(namespace, token)
+	a.tokenExpiries.set(namespace, expiration)
+
+	refreshAfter := time.Duration(float64(expiration.Sub(a.testIsolation.TimeNow())) * tokenRefreshLifetimeFraction)
+	if refreshAfter < time.Second {
+		refreshAfter = time.Second
+	}
+	a.log.V(app.VerbosityVerbose).Info(
+		"Requested shoot access token", "namespace", namespace, "refreshAfter", refreshAfter)
+
+	return gcmctl.RequeueAfter(refreshAfter), nil
+}
+
+// getKubeconfigSecret returns the kubeconfig secret of the specified shoot, or nil, if the shoot has none. The secret
+// is found by its 'name' label. If several secrets carry the label, e.g. while Gardener rotates the secret, the newest
+// one is returned.
+func (a *actuator) getKubeconfigSecret(ctx context.Context, namespace string) (*corev1.Secret, error) {
+	secrets := &corev1.SecretList{}
+	err := a.secretReader.List(
+		ctx, secrets, client.InNamespace(namespace), client.MatchingLabels{"name": a.tokenRequest.KubeconfigSecretName})
+	if err != nil {
+		return nil, fmt.Errorf("shoot %s: listing kubeconfig secrets: %w", namespace, err)
+	}
+
+	var result *corev1.Secret
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.DeletionTimestamp != nil {
+			continue
+		}
+		if result == nil || result.CreationTimestamp.Before(&secret.CreationTimestamp) {
+			result = secret
+		}
+	}
+	return result, nil
 }
 
 // Returns: (requeueAfter, error)
@@ -142,3 +417,17 @@ func toSecret(obj client.Object, log logr.Logger) (*corev1.Secret, bool) {
 
 	return secret, ok
 }
+
+//#region Test isolation
+
+// actuatorTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the secret actuator unit
+type actuatorTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+	// Requests a shoot access token. Points to [tokenRequestor.RequestToken]. Nil, unless in token request mode.
+	RequestToken func(
+		ctx context.Context, shootNamespace string, kubeconfig []byte, bearerToken string) (string, time.Time, error)
+}
+
+//#endregion Test isolation
@@ -6,16 +6,27 @@ package secret
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
+	gcmctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller"
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
-	"github.com/gardener/gardener-custom-metrics/pkg/util/testutil"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
 )
 
 var _ = Describe("input.controller.secret.actuator", func() {
@@ -27,7 +38,7 @@ var _ = Describe("input.controller.secret.actuator", func() {
 	var (
 		newTestActuator = func() (*actuator, input_data_registry.InputDataRegistry) {
 			idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
-			actuator := NewActuator(idr, logr.Discard()).(*actuator)
+			actuator := NewActuator(idr, nil, nil, false, nil, logr.Discard()).(*actuator)
 			return actuator, idr
 		}
 		newTestSecret = func(name string) (*corev1.Secret, []byte) {
@@ -37,7 +48,7 @@ var _ = Describe("input.controller.secret.actuator", func() {
 			switch name {
 			case secretNameCA:
 				dataKey = "ca.crt"
-				dataValue = testutil.GetExampleCACert(0)
+				dataValue = gcmtesting.GetExampleCACert(0)
 			case secretNameAccessToken:
 				dataKey = "token"
 				dataValue = []byte(testToken)
@@ -70,7 +81,7 @@ var _ = Describe("input.controller.secret.actuator", func() {
 			// Assert
 			actualCert := idr.GetShootCACertificate(testNs)
 			Expect(actualCert).NotTo(BeNil())
-			Expect(testutil.IsEqualCert(actualCert, caCertBytes)).To(BeTrue())
+			Expect(gcmtesting.IsEqualCert(actualCert, caCertBytes)).To(BeTrue())
 		})
 		It("should add the auth secret, if it does not exist", func() {
 			// Arrange
@@ -104,7 +115,7 @@ var _ = Describe("input.controller.secret.actuator", func() {
 			actuator, idr := newTestActuator()
 			secret, caCertBytes := newTestSecret(secretNameCA)
 			ctx := context.Background()
-			initialCertBytes := testutil.GetExampleCACert(1)
+			initialCertBytes := gcmtesting.GetExampleCACert(1)
 			idr.SetShootCACertificate(testNs, initialCertBytes)
 
 			// Act
@@ -113,15 +124,15 @@ var _ = Describe("input.controller.secret.actuator", func() {
 			// Assert
 			actualCert := idr.GetShootCACertificate(testNs)
 			Expect(actualCert).NotTo(BeNil())
-			Expect(testutil.IsEqualCert(actualCert, caCertBytes)).To(BeTrue())
-			Expect(testutil.IsEqualCert(actualCert, initialCertBytes)).To(BeFalse())
+			Expect(gcmtesting.IsEqualCert(actualCert, caCertBytes)).To(BeTrue())
+			Expect(gcmtesting.IsEqualCert(actualCert, initialCertBytes)).To(BeFalse())
 		})
 		It("should return no error, and a zero requeue delay, upon successfully adding a secret", func() {
 			// Arrange
 			actuator, idr := newTestActuator()
 			secret, _ := newTestSecret(secretNameCA)
 			ctx := context.Background()
-			initialCertBytes := testutil.GetExampleCACert(1)
+			initialCertBytes := gcmtesting.GetExampleCACert(1)
 			idr.SetShootCACertificate(testNs, initialCertBytes)
 
 			// Act
@@ -132,13 +143,70 @@ var _ = Describe("input.controller.secret.actuator", func() {
 			Expect(requeue).To(BeZero())
 		})
 	})
+	Describe("CA rotation", func() {
+		newCASecret := func(name string, data map[string][]byte) *corev1.Secret {
+			return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: name}, Data: data}
+		}
+		bothCerts := func() []byte {
+			return append(append(gcmtesting.GetExampleCACert(0), '\n'), gcmtesting.GetExampleCACert(1)...)
+		}
+
+		It("should trust the certificates in both the ca.crt and bundle.crt keys", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			secret := newCASecret(secretNameCA, map[string][]byte{
+				"ca.crt":     gcmtesting.GetExampleCACert(0),
+				"bundle.crt": gcmtesting.GetExampleCACert(1),
+			})
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), secret)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(gcmtesting.IsEqualCert(idr.GetShootCACertificate(testNs), bothCerts())).To(BeTrue())
+		})
+		It("should merge the certificates across CA secrets, and keep the remaining ones when a secret is deleted", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			ctx := context.Background()
+			oldCA := newCASecret(secretNameCA, map[string][]byte{"ca.crt": gcmtesting.GetExampleCACert(0)})
+			newCA := newCASecret(secretNameCAClientCurrent, map[string][]byte{"ca.crt": gcmtesting.GetExampleCACert(1)})
+
+			// Act & Assert
+			Expect(actuator.CreateOrUpdate(ctx, oldCA)).Error().To(Succeed())
+			Expect(actuator.CreateOrUpdate(ctx, newCA)).Error().To(Succeed())
+			Expect(gcmtesting.IsEqualCert(idr.GetShootCACertificate(testNs), bothCerts())).To(BeTrue())
+
+			Expect(actuator.Delete(ctx, oldCA)).Error().To(Succeed())
+			Expect(gcmtesting.IsEqualCert(idr.GetShootCACertificate(testNs), gcmtesting.GetExampleCACert(1))).To(BeTrue())
+
+			Expect(actuator.Delete(ctx, newCA)).Error().To(Succeed())
+			Expect(idr.GetShootCACertificate(testNs)).To(BeNil())
+		})
+		It("should return an error, and keep the recorded certificates, if a CA secret has no CA data", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			ctx := context.Background()
+			Expect(actuator.CreateOrUpdate(
+				ctx, newCASecret(secretNameCA, map[string][]byte{"ca.crt": gcmtesting.GetExampleCACert(0)}))).
+				Error().To(Succeed())
+
+			// Act
+			_, err := actuator.CreateOrUpdate(ctx, newCASecret(secretNameCA, map[string][]byte{"other": []byte("x")}))
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(gcmtesting.IsEqualCert(idr.GetShootCACertificate(testNs), gcmtesting.GetExampleCACert(0))).To(BeTrue())
+		})
+	})
 	Describe("Delete", func() {
 		It("should delete the respective CA cert, and return no error and zero requeue delay", func() {
 			// Arrange
 			actuator, idr := newTestActuator()
 			secret, _ := newTestSecret(secretNameCA)
 			ctx := context.Background()
-			initialCertBytes := testutil.GetExampleCACert(1)
+			initialCertBytes := gcmtesting.GetExampleCACert(1)
 			idr.SetShootCACertificate(testNs, initialCertBytes)
 			Expect(idr.GetShootCACertificate(testNs)).NotTo(BeNil())
 
@@ -169,4 +237,343 @@ var _ = Describe("input.controller.secret.actuator", func() {
 			Expect(actualAuthSecret).To(BeEmpty())
 		})
 	})
+	Describe("token request mode", func() {
+		const (
+			kubeconfigSecretName = "generic-token-kubeconfig"
+			accessToken          = "access-token"
+		)
+		var (
+			now             = time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+			requestedNs     []string
+			newTokenRequest = func(secrets ...client.Object) (*actuator, input_data_registry.InputDataRegistry) {
+				requestedNs = nil
+				idr := input_data_registry.NewInputDataRegistry(1*time.Second, logr.Discard())
+				config := &TokenRequestConfig{KubeconfigSecretName: kubeconfigSecretName, Expiration: time.Hour}
+				secretReader := fake.NewClientBuilder().WithObjects(secrets...).Build()
+				actuator := NewActuator(idr, config, secretReader, false, nil, logr.Discard()).(*actuator)
+				actuator.testIsolation.TimeNow = func() time.Time { return now }
+				actuator.testIsolation.RequestToken = func(
+					_ context.Context, shootNamespace string, kubeconfig []byte, bearerToken string,
+				) (string, time.Time, error) {
+
+					requestedNs = append(requestedNs, shootNamespace)
+					return testToken + "-" + string(kubeconfig) + "-" + bearerToken, now.Add(time.Hour), nil
+				}
+				return actuator, idr
+			}
+			// Creates a kubeconfig secret with Gardener's hash suffix, whose kubeconfig data is the specified text
+			newKubeconfigSecret = func(hash string, kubeconfig string, creationTime time.Time) *corev1.Secret {
+				return &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace:         testNs,
+						Name:              kubeconfigSecretName + "-" + hash,
+						Labels:            map[string]string{"name": kubeconfigSecretName},
+						CreationTimestamp: metav1.NewTime(creationTime),
+					},
+					Data: map[string][]byte{"kubeconfig": []byte(kubeconfig)},
+				}
+			}
+			newAccessTokenSecret = func() *corev1.Secret {
+				return &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: secretNameAccessToken},
+					Data:       map[string][]byte{"token": []byte(accessToken)},
+				}
+			}
+		)
+
+		It("should request a token with the kubeconfig and the access token, record it, and requeue after 80% of the "+
+			"token lifetime", func() {
+			// Arrange
+			kubeconfigSecret := newKubeconfigSecret("a1b2c3", "kc", now)
+			actuator, idr := newTokenRequest(kubeconfigSecret, newAccessTokenSecret())
+
+			// Act
+			requeue, err := actuator.CreateOrUpdate(context.Background(), kubeconfigSecret)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(requeue).To(Equal(gcmctl.RequeueAfter(48 * time.Minute)))
+			Expect(requestedNs).To(Equal([]string{testNs}))
+			Expect(idr.GetShootAuthSecret(testNs)).To(Equal(testToken + "-kc-" + accessToken))
+		})
+		It("should request a token, when the access token secret changes, and not scrape with the access token", func() {
+			// Arrange
+			accessTokenSecret := newAccessTokenSecret()
+			actuator, idr := newTokenRequest(newKubeconfigSecret("a1b2c3", "kc", now), accessTokenSecret)
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), accessTokenSecret)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(idr.GetShootAuthSecret(testNs)).To(Equal(testToken + "-kc-" + accessToken))
+		})
+		It("should use the newest kubeconfig secret, if several carry the name label", func() {
+			// Arrange
+			oldSecret := newKubeconfigSecret("old", "old-kc", now.Add(-time.Hour))
+			newSecret := newKubeconfigSecret("new", "new-kc", now)
+			actuator, idr := newTokenRequest(oldSecret, newSecret, newAccessTokenSecret())
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), oldSecret)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(idr.GetShootAuthSecret(testNs)).To(Equal(testToken + "-new-kc-" + accessToken))
+		})
+		It("should return an error and not record a token, if the token request fails", func() {
+			// Arrange
+			kubeconfigSecret := newKubeconfigSecret("a1b2c3", "kc", now)
+			actuator, idr := newTokenRequest(kubeconfigSecret, newAccessTokenSecret())
+			actuator.testIsolation.RequestToken = func(
+				context.Context, string, []byte, string) (string, time.Time, error) {
+
+				return "", time.Time{}, errors.New("forbidden")
+			}
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), kubeconfigSecret)
+
+			// Assert
+			Expect(err).To(MatchError(ContainSubstring("forbidden")))
+			Expect(idr.GetShootAuthSecret(testNs)).To(BeEmpty())
+		})
+		It("should return an error, if the kubeconfig is missing from the secret", func() {
+			// Arrange
+			kubeconfigSecret := newKubeconfigSecret("a1b2c3", "", now)
+			actuator, _ := newTokenRequest(kubeconfigSecret, newAccessTokenSecret())
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), kubeconfigSecret)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(requestedNs).To(BeEmpty())
+		})
+		It("should keep the recorded token, and not request one, until the shoot has the access token secret", func() {
+			// Arrange
+			kubeconfigSecret := newKubeconfigSecret("a1b2c3", "kc", now)
+			actuator, idr := newTokenRequest(kubeconfigSecret)
+			idr.SetShootAuthSecret(testNs, testToken)
+
+			// Act
+			requeue, err := actuator.CreateOrUpdate(context.Background(), kubeconfigSecret)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(requeue).To(BeZero())
+			Expect(requestedNs).To(BeEmpty())
+			Expect(idr.GetShootAuthSecret(testNs)).To(Equal(testToken))
+		})
+		It("should delete the recorded token, when the last kubeconfig secret is deleted", func() {
+			// Arrange
+			actuator, idr := newTokenRequest(newAccessTokenSecret())
+			idr.SetShootAuthSecret(testNs, testToken)
+			deletedSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: kubeconfigSecretName + "-a1b2c3"},
+			}
+
+			// Act
+			requeue, err := actuator.Delete(context.Background(), deletedSecret)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(requeue).To(BeZero())
+			Expect(idr.GetShootAuthSecret(testNs)).To(BeEmpty())
+		})
+		It("should request a token with the remaining kubeconfig secret, when a rotated one is deleted", func() {
+			// Arrange
+			actuator, idr := newTokenRequest(newKubeconfigSecret("new", "new-kc", now), newAccessTokenSecret())
+			deletedSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: kubeconfigSecretName + "-old"},
+			}
+
+			// Act
+			_, err := actuator.Delete(context.Background(), deletedSecret)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(idr.GetShootAuthSecret(testNs)).To(Equal(testToken + "-new-kc-" + accessToken))
+		})
+	})
+	Describe("token expiry", func() {
+		var (
+			now           = time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+			newExpiryTest = func() (*actuator, *fakes.FakeInputDataRegistry, *record.FakeRecorder) {
+				idr := &fakes.FakeInputDataRegistry{}
+				recorder := record.NewFakeRecorder(10)
+				actuator := NewActuator(idr, nil, nil, false, recorder, logr.Discard()).(*actuator)
+				actuator.testIsolation.TimeNow = func() time.Time { return now }
+				return actuator, idr, recorder
+			}
+			newTokenSecret = func(token string) *corev1.Secret {
+				return &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: secretNameAccessToken},
+					Data:       map[string][]byte{"token": []byte(token)},
+				}
+			}
+		)
+
+		It("should requeue one hour before the token expires, without raising a warning", func() {
+			// Arrange
+			actuator, idr, recorder := newExpiryTest()
+
+			// Act
+			requeue, err := actuator.CreateOrUpdate(context.Background(), newTokenSecret(newJWT(now.Add(3*time.Hour))))
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(requeue).To(Equal(gcmctl.RequeueAfter(2 * time.Hour)))
+			Expect(idr.AuthDegradedReasons[testNs]).To(BeEmpty())
+			Expect(recorder.Events).To(BeEmpty())
+		})
+		It("should record a warning event, and requeue at expiry, if the token is near expiry", func() {
+			// Arrange
+			actuator, idr, recorder := newExpiryTest()
+
+			// Act
+			requeue, err := actuator.CreateOrUpdate(context.Background(), newTokenSecret(newJWT(now.Add(10*time.Minute))))
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(requeue).To(Equal(gcmctl.RequeueAfter(10 * time.Minute)))
+			Expect(idr.AuthDegradedReasons[testNs]).To(BeEmpty())
+			Expect(recorder.Events).To(Receive(ContainSubstring(TokenNearExpiryEventReason)))
+		})
+		It("should mark the shoot as auth-degraded, and record a warning event, if the token has expired", func() {
+			// Arrange
+			actuator, idr, recorder := newExpiryTest()
+
+			// Act
+			requeue, err := actuator.CreateOrUpdate(context.Background(), newTokenSecret(newJWT(now.Add(-time.Minute))))
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(requeue).To(BeZero())
+			Expect(idr.GetShootAuthSecret(testNs)).NotTo(BeEmpty())
+			Expect(idr.AuthDegradedReasons[testNs]).To(ContainSubstring("expired"))
+			Expect(recorder.Events).To(Receive(ContainSubstring(TokenInvalidEventReason)))
+		})
+		It("should mark the shoot as auth-degraded, if the token looks like a JWT, but cannot be parsed", func() {
+			// Arrange
+			actuator, idr, recorder := newExpiryTest()
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), newTokenSecret("header.!!!.signature"))
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(idr.AuthDegradedReasons[testNs]).To(ContainSubstring("cannot be parsed"))
+			Expect(recorder.Events).To(Receive(ContainSubstring(TokenInvalidEventReason)))
+		})
+		It("should expose the time left until the token expires, and stop exposing it once the secret is deleted", func() {
+			// Arrange
+			actuator, _, _ := newExpiryTest()
+			secret := newTokenSecret(newJWT(now.Add(3 * time.Hour)))
+			expected := `
+# HELP gardener_custom_metrics_shoot_access_token_expiry_seconds The time left until the shoot access token expires, by shoot namespace. Negative once the token has expired. Only exposed for tokens which carry an expiry time.
+# TYPE gardener_custom_metrics_shoot_access_token_expiry_seconds gauge
+gardener_custom_metrics_shoot_access_token_expiry_seconds{namespace="shoot--my-shoot"} 10800
+`
+
+			// Act and assert
+			_, _ = actuator.CreateOrUpdate(context.Background(), secret)
+			Expect(promtestutil.CollectAndCompare(actuator.tokenExpiries, strings.NewReader(expected))).To(Succeed())
+
+			_, _ = actuator.Delete(context.Background(), secret)
+			Expect(promtestutil.CollectAndCount(actuator.tokenExpiries)).To(BeZero())
+		})
+	})
+
+	Describe("scrape request secret", func() {
+		var newScrapeRequestSecret = func(headers string, proxyURL string) *corev1.Secret {
+			return &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: secretNameScrapeRequest},
+				Data: map[string][]byte{
+					scrapeRequestHeadersKey:  []byte(headers),
+					scrapeRequestProxyURLKey: []byte(proxyURL),
+				},
+			}
+		}
+
+		It("should record the headers and the proxy URL, and forget them when the secret is deleted", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			idr.SetKapiData(testNs, "pod1", "uid1", nil, "https://10.0.0.1/metrics")
+			secret := newScrapeRequestSecret(
+				"X-Proxy-Token: abc\n\n  x-tenant : t1 \nX-Proxy-Token: def", "http://proxy.{namespace}:3128")
+
+			// Act
+			resultUpdate, errUpdate := actuator.CreateOrUpdate(context.Background(), secret)
+			settings := idr.GetScrapeContext(testNs, "pod1").RequestSettings
+			resultDelete, errDelete := actuator.Delete(context.Background(), secret)
+
+			// Assert
+			Expect(errUpdate).To(Succeed())
+			Expect(resultUpdate).To(BeZero())
+			Expect(settings).NotTo(BeNil())
+			Expect(settings.Headers).To(Equal(http.Header{
+				"X-Proxy-Token": {"abc", "def"},
+				"X-Tenant":      {"t1"},
+			}))
+			Expect(settings.ProxyURL.String()).To(Equal("http://proxy." + testNs + ":3128"))
+			Expect(errDelete).To(Succeed())
+			Expect(resultDelete).To(BeZero())
+			Expect(idr.GetScrapeContext(testNs, "pod1").RequestSettings).To(BeNil())
+		})
+		It("should record no settings, if the secret specifies neither headers, nor a proxy URL", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			idr.SetKapiData(testNs, "pod1", "uid1", nil, "https://10.0.0.1/metrics")
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), newScrapeRequestSecret(" \n", ""))
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(idr.GetScrapeContext(testNs, "pod1").RequestSettings).To(BeNil())
+		})
+		It("should return an error, and keep the recorded settings, if the secret is malformed", func() {
+			// Arrange
+			actuator, idr := newTestActuator()
+			idr.SetKapiData(testNs, "pod1", "uid1", nil, "https://10.0.0.1/metrics")
+			_, err := actuator.CreateOrUpdate(context.Background(), newScrapeRequestSecret("X-Proxy-Token: abc", ""))
+			Expect(err).To(Succeed())
+
+			// Act
+			_, errHeader := actuator.CreateOrUpdate(context.Background(), newScrapeRequestSecret("no colon", ""))
+			_, errName := actuator.CreateOrUpdate(context.Background(), newScrapeRequestSecret("Bad Name: x", ""))
+			_, errProxy := actuator.CreateOrUpdate(context.Background(), newScrapeRequestSecret("", "ftp://proxy"))
+
+			// Assert
+			Expect(errHeader).To(MatchError(ContainSubstring("line 1")))
+			Expect(errName).To(HaveOccurred())
+			Expect(errProxy).To(MatchError(ContainSubstring("proxy URL")))
+			settings := idr.GetScrapeContext(testNs, "pod1").RequestSettings
+			Expect(settings).NotTo(BeNil())
+			Expect(settings.Headers.Get("X-Proxy-Token")).To(Equal("abc"))
+		})
+	})
+
+	Describe("SecretNames", func() {
+		It("should name the CA, access token and scrape request secrets, and the token request kubeconfig secret, "+
+			"if specified", func() {
+
+			Expect(SecretNames("")).To(ConsistOf(
+				secretNameCA, secretNameCAClientCurrent, secretNameAccessToken, secretNameScrapeRequest))
+			Expect(SecretNames("my-kubeconfig")).To(ConsistOf(
+				secretNameCA, secretNameCAClientCurrent, secretNameAccessToken, secretNameScrapeRequest, "my-kubeconfig"))
+		})
+		It("should be safe to modify the result", func() {
+			SecretNames("my-kubeconfig")[0] = "modified"
+			Expect(SecretNames("")).To(ContainElement(secretNameCA))
+		})
+	})
 })
+
+// newJWT returns an unsigned JWT which expires at the specified time
+func newJWT(expiry time.Time) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"none"}`)) + "." +
+		encode([]byte(fmt.Sprintf(`{"sub":"test","exp":%d}`, expiry.Unix()))) + "." + encode([]byte("signature"))
+}
@@ -5,31 +5,63 @@
 package secret
 
 import (
+	"fmt"
+
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
 	gcmctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller"
 	scrape_target_registry "github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
 )
 
 // AddToManager adds a new secret controller to the specified manager.
 // dataRegistry is a concurrency-safe data repository where the controller finds data it needs, and stores
 // the data it produces.
+// tokenRequest, if not nil, directs the controller to request shoot access tokens via the TokenRequest API, instead of
+// reading them from the shoot access secret.
+// ignoreAccessTokenSecret, if true, directs the controller to only maintain CA certificates, because shoot access tokens
+// are supplied by another component.
+// selector identifies the shoot namespaces. If nil, the Gardener defaults apply.
+// condition, if not nil, receives the outcome of each reconciliation.
+// metricsRegisterer, if not nil, receives the collector which exposes the time left until each shoot access token
+// expires. Each controller registers a collector of its own, so controllers which share a registry, e.g. those of
+// additional clusters, need registerers which tell them apart, e.g. via a "cluster" const label.
 func AddToManager(
 	mgr manager.Manager,
 	dataRegistry scrape_target_registry.InputDataRegistry,
 	controllerOptions controller.Options,
+	tokenRequest *TokenRequestConfig,
+	ignoreAccessTokenSecret bool,
+	selector *gutil.KapiSelector,
+	condition *conditions.ComponentReporter,
+	metricsRegisterer prometheus.Registerer,
 	log logr.Logger) error {
 
+	secretActuator := NewActuator(
+		dataRegistry,
+		tokenRequest,
+		mgr.GetClient(),
+		ignoreAccessTokenSecret,
+		mgr.GetEventRecorderFor(app.Name),
+		log.WithName("secret-controller")).(*actuator)
+	if metricsRegisterer != nil {
+		if err := metricsRegisterer.Register(secretActuator.tokenExpiries); err != nil {
+			return fmt.Errorf("register shoot access token expiry metrics: %w", err)
+		}
+	}
 	return gcmctl.NewControllerFactory().AddNewControllerToManager(mgr, gcmctl.AddArgs{
-		Actuator:             NewActuator(dataRegistry, log.WithName("secret-controller")),
+		Actuator:             secretActuator,
 		ControllerName:       app.Name + "-secret-controller",
 		ControllerOptions:    controllerOptions,
 		ControlledObjectType: &corev1.Secret{},
-		Predicates:           []predicate.Predicate{NewPredicate(log)},
+		Predicates:           []predicate.Predicate{NewPredicate(tokenRequest, ignoreAccessTokenSecret, selector, log)},
+		Condition:            condition,
 	})
 }
@@ -15,19 +15,34 @@ import (
 )
 
 // NewPredicate creates a predicate filter meant to run against a seed cluster. It allows a secret event if that
-// secret is the CA certificate or the metrics scraping access token of a shoot kube-apiserver.
-func NewPredicate(log logr.Logger) predicate.Predicate {
+// secret contains CA certificates or the metrics scraping access token of a shoot kube-apiserver, or additions to the
+// metrics scraping requests. If tokenRequest is not nil, the kubeconfig secret used to request access tokens is allowed
+// too. If ignoreAccessTokenSecret is true, the access token secret is not allowed.
+// selector identifies the shoot namespaces. If nil, the Gardener defaults apply.
+func NewPredicate(
+	tokenRequest *TokenRequestConfig,
+	ignoreAccessTokenSecret bool,
+	selector *gutil.KapiSelector,
+	log logr.Logger) predicate.Predicate {
+
 	return &secretPredicate{
-		log: log.WithName("secret-predicate"),
+		tokenRequest:            tokenRequest,
+		ignoreAccessTokenSecret: ignoreAccessTokenSecret,
+		selector:                selector,
+		log:                     log.WithName("secret-predicate"),
 	}
 }
 
 // See NewPredicate
 type secretPredicate struct {
-	log logr.Logger
+	tokenRequest            *TokenRequestConfig
+	ignoreAccessTokenSecret bool
+	selector                *gutil.KapiSelector
+	log                     logr.Logger
 }
 
-// Is the object a shoot CP secret, containing the shoot's kube-apiserver CA certificate or metrics scraping access token
+// Is the object a shoot CP secret, containing the shoot's kube-apiserver CA certificate, metrics scraping access
+// token, or additions to the metrics scraping requests
 func (p *secretPredicate) isRelevantSecret(obj client.Object) bool {
 	if obj == nil {
 		p.log.Error(nil, "Event has no object")
@@ -39,8 +54,16 @@ func (p *secretPredicate) isRelevantSecret(obj client.Object) bool {
 		return false
 	}
 
-	return gutil.IsShootNamespace(secret.Namespace) &&
-		(secret.Name == secretNameCA || secret.Name == secretNameAccessToken)
+	if !p.selector.IsShootNamespace(secret.Namespace) {
+		return false
+	}
+	if isCASecretName(secret.Name) || secret.Name == secretNameScrapeRequest {
+		return true
+	}
+	if p.tokenRequest != nil && p.tokenRequest.isKubeconfigSecret(secret) {
+		return true
+	}
+	return secret.Name == secretNameAccessToken && !p.ignoreAccessTokenSecret
 }
 
 // Create returns true if the event target is a shoot control plane kube-apiserver's CA cert or metrics scraping token
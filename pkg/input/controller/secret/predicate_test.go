@@ -11,6 +11,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
 )
 
 var _ = Describe("input.controler.secret.predicate", func() {
@@ -31,11 +33,12 @@ var _ = Describe("input.controler.secret.predicate", func() {
 
 	Describe("Predicate operations", func() {
 		It("should return true if the event target is a shoot control plane secret, containing the shoot's "+
-			"kube-apiserver CA certificate or metrics scraping access token", func() {
+			"kube-apiserver CA certificate, metrics scraping access token, or scrape request additions", func() {
 
-			for _, name := range []string{"ca", "shoot-access-gardener-custom-metrics"} {
+			names := []string{"ca", "ca-client-current", "shoot-access-gardener-custom-metrics", "custom-metrics-scrape-request"}
+			for _, name := range names {
 				// Arrange
-				predicate := NewPredicate(logr.Discard())
+				predicate := NewPredicate(nil, false, nil, logr.Discard())
 				oldSecret := newTestSecret(name)
 				newSecret := newTestSecret(name)
 
@@ -53,7 +56,7 @@ var _ = Describe("input.controler.secret.predicate", func() {
 		It("should return false if the event target is not in a shoot namespace", func() {
 			for _, name := range []string{"ca", "shoot-access-gardener-custom-metrics"} {
 				// Arrange
-				predicate := NewPredicate(logr.Discard())
+				predicate := NewPredicate(nil, false, nil, logr.Discard())
 				oldSecret := newTestSecret(name)
 				newSecret := newTestSecret(name)
 				newSecret.Namespace = "another-ns"
@@ -72,7 +75,7 @@ var _ = Describe("input.controler.secret.predicate", func() {
 		It("should return true if the event target is not a secret", func() {
 			for _, name := range []string{"ca", "shoot-access-gardener-custom-metrics"} {
 				// Arrange
-				predicate := NewPredicate(logr.Discard())
+				predicate := NewPredicate(nil, false, nil, logr.Discard())
 				oldSecret := newTestSecret(name)
 				newSecret := &corev1.Pod{}
 
@@ -87,9 +90,25 @@ var _ = Describe("input.controler.secret.predicate", func() {
 				Expect(allowDelete).To(BeFalse())
 			}
 		})
+		It("should identify shoot namespaces by the specified selector", func() {
+			// Arrange
+			selector, err := gutil.NewKapiSelector(gutil.DefaultKapiPodSelector, "cp-", "")
+			Expect(err).To(Succeed())
+			predicate := NewPredicate(nil, false, selector, logr.Discard())
+			customSecret := newTestSecret("ca")
+			customSecret.Namespace = "cp-my-shoot"
+
+			// Act
+			allowCustom := predicate.Create(event.CreateEvent{Object: customSecret})
+			allowDefault := predicate.Create(event.CreateEvent{Object: newTestSecret("ca")})
+
+			// Assert
+			Expect(allowCustom).To(BeTrue())
+			Expect(allowDefault).To(BeFalse())
+		})
 		It("should return true if the event target is neither a CA cert, nor a metrics scraping token", func() {
 			// Arrange
-			predicate := NewPredicate(logr.Discard())
+			predicate := NewPredicate(nil, false, nil, logr.Discard())
 			oldSecret := newTestSecret("another-secret")
 			newSecret := newTestSecret("another-secret")
 
@@ -104,4 +123,61 @@ var _ = Describe("input.controler.secret.predicate", func() {
 			Expect(allowDelete).To(BeFalse())
 		})
 	})
+
+	Describe("Predicate operations in token request mode", func() {
+		tokenRequest := &TokenRequestConfig{KubeconfigSecretName: "generic-token-kubeconfig"}
+
+		It("should return true if the event target is the CA certificate, the metrics scraping access token, or the "+
+			"token request kubeconfig", func() {
+
+			for _, name := range []string{"ca", "shoot-access-gardener-custom-metrics", "generic-token-kubeconfig"} {
+				// Arrange
+				predicate := NewPredicate(tokenRequest, false, nil, logr.Discard())
+				oldSecret := newTestSecret(name)
+				newSecret := newTestSecret(name)
+
+				// Act
+				allowCreate := predicate.Create(event.CreateEvent{Object: newSecret})
+				allowUpdate := predicate.Update(event.UpdateEvent{ObjectOld: oldSecret, ObjectNew: newSecret})
+				allowDelete := predicate.Delete(event.DeleteEvent{Object: newSecret})
+
+				// Assert
+				Expect(allowCreate).To(BeTrue())
+				Expect(allowUpdate).To(BeTrue())
+				Expect(allowDelete).To(BeTrue())
+			}
+		})
+		It("should recognize the token request kubeconfig secret by its name label, regardless of its hash suffix",
+			func() {
+				// Arrange
+				predicate := NewPredicate(tokenRequest, false, nil, logr.Discard())
+				secret := newTestSecret("generic-token-kubeconfig-a1b2c3d4")
+				secret.Labels = map[string]string{"name": "generic-token-kubeconfig"}
+
+				// Act
+				allowCreate := predicate.Create(event.CreateEvent{Object: secret})
+				allowOther := predicate.Create(event.CreateEvent{Object: newTestSecret("other-kubeconfig")})
+
+				// Assert
+				Expect(allowCreate).To(BeTrue())
+				Expect(allowOther).To(BeFalse())
+			})
+	})
+
+	Describe("Predicate operations when the access token secret is ignored", func() {
+		It("should only return true if the event target is a CA certificate, or the scrape request secret", func() {
+			// Arrange
+			predicate := NewPredicate(nil, true, nil, logr.Discard())
+
+			// Act
+			allowCA := predicate.Create(event.CreateEvent{Object: newTestSecret("ca")})
+			allowToken := predicate.Create(event.CreateEvent{Object: newTestSecret("shoot-access-gardener-custom-metrics")})
+			allowScrapeRequest := predicate.Create(event.CreateEvent{Object: newTestSecret("custom-metrics-scrape-request")})
+
+			// Assert
+			Expect(allowCA).To(BeTrue())
+			Expect(allowToken).To(BeFalse())
+			Expect(allowScrapeRequest).To(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package secret
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/metrics_scraper"
+)
+
+const (
+	// The optional secret, in a shoot namespace, which specifies additions to the requests which scrape the shoot's
+	// Kapis, e.g. for Kapi metrics endpoints fronted by an authenticating proxy
+	secretNameScrapeRequest = "custom-metrics-scrape-request"
+
+	// The data key, in the scrape request secret, which holds extra request headers, one "Name: value" pair per line
+	scrapeRequestHeadersKey = "headers"
+	// The data key, in the scrape request secret, which holds the URL of the proxy through which the shoot's Kapis are
+	// scraped. Same format as the global proxy URL template. See [metrics_scraper.ResolveProxyURL].
+	scrapeRequestProxyURLKey = "proxy-url"
+)
+
+// parseScrapeRequestSettings extracts the scrape request additions from the specified scrape request secret. Fails if
+// a header line or the proxy URL is malformed. Returns nil if the secret specifies neither headers, nor a proxy URL.
+func parseScrapeRequestSettings(secret *corev1.Secret) (*input_data_registry.ShootScrapeRequestSettings, error) {
+	headers := http.Header{}
+	for i, line := range strings.Split(string(secret.Data[scrapeRequestHeadersKey]), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !httpguts.ValidHeaderFieldName(name) || !httpguts.ValidHeaderFieldValue(value) {
+			return nil, fmt.Errorf("line %d of the %s data is not a valid 'Name: value' header", i+1, scrapeRequestHeadersKey)
+		}
+		headers.Add(name, value)
+	}
+
+	proxyURL, err := metrics_scraper.ResolveProxyURL(
+		strings.TrimSpace(string(secret.Data[scrapeRequestProxyURLKey])), secret.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("the %s data is not a valid proxy URL: %w", scrapeRequestProxyURLKey, err)
+	}
+
+	if len(headers) == 0 && proxyURL == nil {
+		return nil, nil
+	}
+	result := &input_data_registry.ShootScrapeRequestSettings{ProxyURL: proxyURL}
+	if len(headers) > 0 {
+		result.Headers = headers
+	}
+	return result, nil
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package secret
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// A shoot access token which expires within this period is reported as near expiry
+	tokenNearExpiryPeriod = time.Hour
+
+	// TokenNearExpiryEventReason is the reason of the Warning event recorded on a shoot access secret, when the token
+	// in it is near expiry
+	TokenNearExpiryEventReason = "ShootAccessTokenNearExpiry"
+	// TokenInvalidEventReason is the reason of the Warning event recorded on a shoot access secret, when the token in
+	// it has expired, or cannot be parsed
+	TokenInvalidEventReason = "ShootAccessTokenInvalid"
+)
+
+var tokenExpiryDesc = prometheus.NewDesc(
+	"gardener_custom_metrics_shoot_access_token_expiry_seconds",
+	"The time left until the shoot access token expires, by shoot namespace. Negative once the token has expired. "+
+		"Only exposed for tokens which carry an expiry time.",
+	[]string{"namespace"},
+	nil)
+
+// parseTokenExpiry returns the expiry time of the specified bearer token, based on the "exp" claim of the token, if it
+// is a JWT. The token's signature is not verified - that's up to the Kapi. Returns the zero time if the token carries
+// no expiry time, or is not in JWT format at all, e.g. a static token. Returns an error if the token appears to be a
+// JWT, but its claims cannot be read.
+func parseTokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, nil
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("decoding the JWT claims: %w", err)
+	}
+	var claims struct {
+		Expiry *float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("parsing the JWT claims: %w", err)
+	}
+	if claims.Expiry == nil {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(int64(*claims.Expiry), 0), nil
+}
+
+// tokenExpiryCollector is a [prometheus.Collector] which exposes the time left until the shoot access token of each
+// shoot expires. The time left is calculated upon each collection. All operations are concurrency-safe.
+type tokenExpiryCollector struct {
+	lock     sync.Mutex
+	expiries map[string]time.Time // The expiry time of each shoot's token, by shoot namespace. Protected by lock.
+
+	timeNow func() time.Time
+}
+
+// newTokenExpiryCollector creates an empty tokenExpiryCollector, which uses the specified function to obtain the
+// current time
+func newTokenExpiryCollector(timeNow func() time.Time) *tokenExpiryCollector {
+	return &tokenExpiryCollector{
+		expiries: make(map[string]time.Time),
+		timeNow:  timeNow,
+	}
+}
+
+// set records the expiry time of the specified shoot's token. A zero expiry time removes the record.
+func (c *tokenExpiryCollector) set(shootNamespace string, expiry time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if expiry.IsZero() {
+		delete(c.expiries, shootNamespace)
+		return
+	}
+	c.expiries[shootNamespace] = expiry
+}
+
+// Describe implements [prometheus.Collector.Describe].
+func (c *tokenExpiryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tokenExpiryDesc
+}
+
+// Collect implements [prometheus.Collector.Collect].
+func (c *tokenExpiryCollector) Collect(ch chan<- prometheus.Metric) {
+	now := c.timeNow()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for namespace, expiry := range c.expiries {
+		ch <- prometheus.MustNewConstMetric(tokenExpiryDesc, prometheus.GaugeValue, expiry.Sub(now).Seconds(), namespace)
+	}
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package secret
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/ptr"
+)
+
+// TokenRequestConfig directs how shoot access tokens are minted via the TokenRequest API, as an alternative to using
+// the token in the shoot access secret for scraping.
+type TokenRequestConfig struct {
+	// The value of the 'name' label of the secret, in each shoot namespace, which contains a kubeconfig for the shoot
+	// kube-apiserver, e.g. Gardener's generic token kubeconfig. Gardener appends a hash suffix to the actual name of
+	// the secret. Tokens are requested with the kubeconfig's server and CA, and with the token in the shoot access
+	// secret, instead of the credentials in the kubeconfig.
+	KubeconfigSecretName string
+	// The shoot service account for which tokens are requested
+	ServiceAccountNamespace string
+	ServiceAccountName      string
+	// The requested token lifetime. Tokens are refreshed after 80% of their actual lifetime has passed.
+	Expiration time.Duration
+}
+
+// isKubeconfigSecret returns true if the specified secret is the kubeconfig secret of its shoot. The secret is
+// recognized by its 'name' label. The secret passed upon deletion may carry no labels, so the name, with or without
+// a hash suffix, is recognized too.
+func (c *TokenRequestConfig) isKubeconfigSecret(secret *corev1.Secret) bool {
+	return secret.Labels["name"] == c.KubeconfigSecretName ||
+		secret.Name == c.KubeconfigSecretName ||
+		strings.HasPrefix(secret.Name, c.KubeconfigSecretName+"-")
+}
+
+// tokenRequestor mints service account tokens in a shoot
+type tokenRequestor interface {
+	// RequestToken uses the specified kubeconfig and bearer token to request a token for the configured service
+	// account, from the shoot kube-apiserver. The kubeconfig is the one found in the kubeconfig secret in the specified
+	// shoot namespace. Its credentials are replaced by bearerToken. Returns the token and its expiration time.
+	RequestToken(
+		ctx context.Context, shootNamespace string, kubeconfig []byte, bearerToken string,
+	) (token string, expiration time.Time, err error)
+}
+
+type tokenRequestorImpl struct {
+	config *TokenRequestConfig
+}
+
+// newTokenRequestor creates a tokenRequestor which requests tokens according to the specified configuration
+func newTokenRequestor(config *TokenRequestConfig) tokenRequestor {
+	return &tokenRequestorImpl{config: config}
+}
+
+// RequestToken implements [tokenRequestor.RequestToken]
+func (tr *tokenRequestorImpl) RequestToken(
+	ctx context.Context,
+	shootNamespace string,
+	kubeconfig []byte,
+	bearerToken string) (token string, expiration time.Time, err error) {
+
+	restConfig, err := restConfigWithToken(kubeconfig, bearerToken)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("requesting token: %w", err)
+	}
+	restConfig.Host = qualifyServiceHost(restConfig.Host, shootNamespace)
+
+	clientSet, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("requesting token: creating shoot client: %w", err)
+	}
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: ptr.To(int64(tr.config.Expiration.Seconds())),
+		},
+	}
+	result, err := clientSet.CoreV1().
+		ServiceAccounts(tr.config.ServiceAccountNamespace).
+		CreateToken(ctx, tr.config.ServiceAccountName, tokenRequest, metav1.CreateOptions{})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf(
+			"requesting token for service account %s/%s: %w",
+			tr.config.ServiceAccountNamespace, tr.config.ServiceAccountName, err)
+	}
+
+	return result.Status.Token, result.Status.ExpirationTimestamp.Time, nil
+}
+
+// restConfigWithToken parses the specified kubeconfig, and replaces the credentials in it with the specified bearer
+// token. Gardener's generic token kubeconfig refers to a token file, which is mounted into the pods deployed along
+// with the kubeconfig, but not into this application's pod.
+func restConfigWithToken(kubeconfig []byte, bearerToken string) (*rest.Config, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("parsing kubeconfig: %w", err)
+	}
+	for _, authInfo := range config.AuthInfos {
+		authInfo.TokenFile = ""
+		authInfo.Token = bearerToken
+	}
+
+	restConfig, err := clientcmd.NewDefaultClientConfig(*config, nil).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("parsing kubeconfig: %w", err)
+	}
+	return restConfig, nil
+}
+
+// qualifyServiceHost turns a server URL which refers to a service by its bare name (e.g. "https://kube-apiserver",
+// as is the case in Gardener's generic token kubeconfig) into one which refers to the service in the specified
+// namespace, so it can be reached from outside that namespace. Other URLs are returned unchanged.
+func qualifyServiceHost(serverURL string, namespace string) string {
+	parsedURL, err := url.Parse(serverURL)
+	if err != nil || parsedURL.Hostname() == "" || strings.Contains(parsedURL.Hostname(), ".") ||
+		strings.Contains(parsedURL.Hostname(), ":") || parsedURL.Hostname() == "localhost" {
+
+		return serverURL
+	}
+
+	qualifiedHost := parsedURL.Hostname() + "." + namespace + ".svc"
+	if parsedURL.Port() != "" {
+		qualifiedHost += ":" + parsedURL.Port()
+	}
+	parsedURL.Host = qualifiedHost
+	return parsedURL.String()
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package secret
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("input.controller.secret.qualifyServiceHost", func() {
+	It("should qualify a bare service name with the shoot namespace", func() {
+		Expect(qualifyServiceHost("https://kube-apiserver", "shoot--a")).To(Equal("https://kube-apiserver.shoot--a.svc"))
+		Expect(qualifyServiceHost("https://kube-apiserver:443", "shoot--a")).
+			To(Equal("https://kube-apiserver.shoot--a.svc:443"))
+	})
+	It("should not change URLs which do not refer to a bare service name", func() {
+		for _, url := range []string{
+			"https://api.my-shoot.example.com",
+			"https://10.0.0.1:443",
+			"https://[::1]:443",
+			"https://localhost:6443",
+		} {
+			Expect(qualifyServiceHost(url, "shoot--a")).To(Equal(url))
+		}
+	})
+})
+
+var _ = Describe("input.controller.secret.restConfigWithToken", func() {
+	It("should replace the kubeconfig's token file with the specified token", func() {
+		// Arrange
+		kubeconfig := []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: shoot
+  cluster:
+    server: https://kube-apiserver
+contexts:
+- name: shoot
+  context:
+    cluster: shoot
+    user: shoot
+current-context: shoot
+users:
+- name: shoot
+  user:
+    tokenFile: /var/run/secrets/gardener.cloud/shoot/generic-kubeconfig/token
+`)
+
+		// Act
+		config, err := restConfigWithToken(kubeconfig, "access-token")
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(config.Host).To(Equal("https://kube-apiserver"))
+		Expect(config.BearerToken).To(Equal("access-token"))
+		Expect(config.BearerTokenFile).To(BeEmpty())
+	})
+})
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	gcmctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller"
+)
+
+// The etcd actuator acts upon shoot etcd pods, maintaining the information necessary to scrape them
+type actuator struct {
+	registry *Registry
+	// The port at which etcd pods serve metrics over plain HTTP
+	metricsPort int
+	log         logr.Logger
+}
+
+// newActuator creates a new etcd actuator, which records the etcd pods in the specified registry. The pods are scraped
+// at the specified port.
+func newActuator(registry *Registry, metricsPort int, log logr.Logger) gcmctl.Actuator {
+	log.V(app.VerbosityVerbose).Info("Creating actuator")
+	return &actuator{
+		registry:    registry,
+		metricsPort: metricsPort,
+		log:         log,
+	}
+}
+
+// CreateOrUpdate tracks shoot etcd pod creation and update events, and maintains a record of the data necessary to
+// scrape the pod.
+// See [gcmctl.Actuator] for the meaning of the returned values.
+func (a *actuator) CreateOrUpdate(ctx context.Context, obj client.Object) (gcmctl.Result, error) {
+	if !isEtcdPodLabels(obj.GetLabels()) {
+		// The pod is still there, but the labels which qualify it as an etcd pod were removed
+		return a.Delete(ctx, obj)
+	}
+
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		a.log.Error(nil, "etcd actuator: reconciled object is not a pod")
+		return gcmctl.Result{}, nil // Do not requeue
+	}
+	if pod.Status.PodIP == "" {
+		// Not scheduled yet. There will be an update event once the pod gets an IP.
+		a.registry.RemoveEtcdData(pod.Namespace, pod.Name)
+		return gcmctl.Result{}, nil
+	}
+
+	labelsCopy := make(map[string]string, len(pod.Labels))
+	for k, v := range pod.Labels {
+		labelsCopy[k] = v
+	}
+	metricsUrl := fmt.Sprintf("http://%s/metrics", net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(a.metricsPort)))
+	a.registry.SetEtcdData(pod.Namespace, pod.Name, pod.UID, labelsCopy, metricsUrl)
+	return gcmctl.Result{}, nil
+}
+
+// Delete tracks shoot etcd pod deletion events, and deletes the record maintained for the respective pod.
+// See [gcmctl.Actuator] for the meaning of the returned values.
+func (a *actuator) Delete(_ context.Context, obj client.Object) (gcmctl.Result, error) {
+	if !a.registry.RemoveEtcdData(obj.GetNamespace(), obj.GetName()) {
+		a.log.V(app.VerbosityVerbose).Info(
+			"Controller was notified about deletion of an etcd pod it was not currently tracking",
+			"namespace", obj.GetNamespace(), "name", obj.GetName())
+	}
+
+	return gcmctl.Result{}, nil
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcd
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("input.etcd.actuator", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "etcd-main-0"
+	)
+
+	var (
+		newTestActuator = func() (*actuator, *Registry) {
+			registry := NewRegistry(10 * time.Second)
+			return newActuator(registry, 2381, logr.Discard()).(*actuator), registry
+		}
+		newTestPod = func() *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: testNs,
+					Name:      testPodName,
+					UID:       "my-uid",
+					Labels:    map[string]string{EtcdPodLabelKey: EtcdPodLabelValue},
+				},
+				Status: corev1.PodStatus{PodIP: "10.0.0.1"},
+			}
+		}
+	)
+
+	Describe("CreateOrUpdate", func() {
+		It("should record the pod, with a metrics URL based on the pod IP and the metrics port", func() {
+			// Arrange
+			actuator, registry := newTestActuator()
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), newTestPod())
+
+			// Assert
+			Expect(err).To(Succeed())
+			etcds := registry.GetShootEtcds(testNs)
+			Expect(etcds).To(HaveLen(1))
+			Expect(etcds[0].PodName).To(Equal(testPodName))
+			Expect(string(etcds[0].PodUID)).To(Equal("my-uid"))
+			Expect(etcds[0].MetricsUrl).To(Equal("http://10.0.0.1:2381/metrics"))
+		})
+		It("should use a valid URL for IPv6 pods", func() {
+			// Arrange
+			actuator, registry := newTestActuator()
+			pod := newTestPod()
+			pod.Status.PodIP = "fd00::1"
+
+			// Act
+			_, err := actuator.CreateOrUpdate(context.Background(), pod)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(registry.GetShootEtcds(testNs)[0].MetricsUrl).To(Equal("http://[fd00::1]:2381/metrics"))
+		})
+		It("should remove the record, if the pod has no IP, or is no longer labeled as etcd", func() {
+			// Arrange
+			actuator, registry := newTestActuator()
+			noIP := newTestPod()
+			noIP.Status.PodIP = ""
+			noLabel := newTestPod()
+			noLabel.Labels = nil
+
+			// Act
+			_, _ = actuator.CreateOrUpdate(context.Background(), newTestPod())
+			_, errNoIP := actuator.CreateOrUpdate(context.Background(), noIP)
+			isEmptyAfterNoIP := len(registry.GetEtcds()) == 0
+			_, _ = actuator.CreateOrUpdate(context.Background(), newTestPod())
+			_, errNoLabel := actuator.CreateOrUpdate(context.Background(), noLabel)
+
+			// Assert
+			Expect(errNoIP).To(Succeed())
+			Expect(errNoLabel).To(Succeed())
+			Expect(isEmptyAfterNoIP).To(BeTrue())
+			Expect(registry.GetEtcds()).To(BeEmpty())
+		})
+	})
+
+	Describe("Delete", func() {
+		It("should remove the record", func() {
+			// Arrange
+			actuator, registry := newTestActuator()
+			_, _ = actuator.CreateOrUpdate(context.Background(), newTestPod())
+
+			// Act
+			_, err := actuator.Delete(context.Background(), newTestPod())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(registry.GetEtcds()).To(BeEmpty())
+		})
+	})
+})
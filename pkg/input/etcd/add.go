@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcd
+
+import (
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
+	gcmctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller"
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
+)
+
+// AddControllerToManager adds a new etcd pod controller to the specified manager. The controller records the shoot
+// etcd pods in the specified registry, to be scraped at metricsPort. selector identifies the shoot namespaces. If nil,
+// the Gardener defaults apply. condition, if not nil, receives the outcome of each reconciliation.
+func AddControllerToManager(
+	mgr manager.Manager,
+	registry *Registry,
+	controllerOptions controller.Options,
+	metricsPort int,
+	selector *gutil.KapiSelector,
+	condition *conditions.ComponentReporter,
+	log logr.Logger) error {
+
+	return gcmctl.NewControllerFactory().AddNewControllerToManager(mgr, gcmctl.AddArgs{
+		Actuator:             newActuator(registry, metricsPort, log.WithName("etcd-controller")),
+		ControllerName:       app.Name + "-etcd-controller",
+		ControllerOptions:    controllerOptions,
+		ControlledObjectType: &corev1.Pod{},
+		Predicates:           []predicate.Predicate{newPredicate(selector)},
+		Condition:            condition,
+	})
+}
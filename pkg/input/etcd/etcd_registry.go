@@ -0,0 +1,220 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package etcd provides application metrics of the shoot etcd pods on a seed, which are scraped separately from the
+// kube-apiserver metrics, because the kube-apiserver request rate correlates poorly with the load on etcd.
+package etcd
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The etcd_server_* counters which are scraped from each etcd pod, and served as rates
+const (
+	// ProposalsCommittedCounter counts the consensus proposals committed by the etcd member
+	ProposalsCommittedCounter = "etcd_server_proposals_committed_total"
+	// ProposalsAppliedCounter counts the consensus proposals applied by the etcd member
+	ProposalsAppliedCounter = "etcd_server_proposals_applied_total"
+	// ProposalsFailedCounter counts the failed consensus proposals
+	ProposalsFailedCounter = "etcd_server_proposals_failed_total"
+)
+
+// Counters lists the names of all counters which are scraped from each etcd pod
+var Counters = []string{ProposalsCommittedCounter, ProposalsAppliedCounter, ProposalsFailedCounter}
+
+// EtcdSample is the set of counter values obtained by a single scrape of an etcd pod
+type EtcdSample struct {
+	// When was the sample taken. Zero if there is no sample.
+	Time time.Time
+	// Maps <counter name> -> <value>. Contains the counters from the Counters list, which the pod exposes.
+	Counters map[string]float64
+}
+
+// EtcdData holds the registry information for a single etcd pod
+type EtcdData struct {
+	ShootNamespace string
+	PodName        string
+	PodUID         types.UID
+	PodLabels      map[string]string
+	MetricsUrl     string // The URL where the pod's metrics are scraped
+
+	// The two most recent samples. Old is the one before New.
+	SampleNew EtcdSample
+	SampleOld EtcdSample
+
+	// How many consecutive scrapes of the pod failed
+	FaultCount int
+}
+
+// copy returns a deep copy of the EtcdData
+func (e *EtcdData) copy() *EtcdData {
+	result := *e
+	result.PodLabels = make(map[string]string, len(e.PodLabels))
+	for k, v := range e.PodLabels {
+		result.PodLabels[k] = v
+	}
+	// Samples are replaced as a whole, and never modified, so they can be shared
+	return &result
+}
+
+// DataSource provides the etcd metrics of the shoots on a seed
+type DataSource interface {
+	// GetShootEtcds returns the etcd pods of the specified shoot. The result is a deep copy, and fully detached from
+	// the registry.
+	GetShootEtcds(shootNamespace string) []*EtcdData
+}
+
+// Registry holds the information necessary to scrape the shoot etcd pods on a seed, and the samples obtained by
+// scraping them. All public operations are concurrency-safe.
+type Registry struct {
+	// See MinSampleGap in input.CLIConfig. Samples which come sooner than this after the previous one are ignored.
+	minSampleGap time.Duration
+	// Maps <shoot namespace> -> <pod name> -> <EtcdData>. A shoot without etcd pods has no entry.
+	shoots map[string]map[string]*EtcdData
+	lock   sync.Mutex
+
+	testIsolation registryTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// NewRegistry creates an empty Registry, which ignores samples which come sooner than minSampleGap after the previous
+// one, because the pair would yield a rate of poor accuracy
+func NewRegistry(minSampleGap time.Duration) *Registry {
+	return &Registry{
+		minSampleGap:  minSampleGap,
+		shoots:        make(map[string]map[string]*EtcdData),
+		testIsolation: registryTestIsolation{TimeNow: time.Now},
+	}
+}
+
+// SetEtcdData records the identity and the metrics URL of the specified etcd pod. If the metrics URL changes, the
+// samples and the fault count on record are discarded, because they pertain to the old URL.
+func (r *Registry) SetEtcdData(
+	shootNamespace string, podName string, podUID types.UID, podLabels map[string]string, metricsUrl string) {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	pods := r.shoots[shootNamespace]
+	if pods == nil {
+		pods = make(map[string]*EtcdData)
+		r.shoots[shootNamespace] = pods
+	}
+	etcd := pods[podName]
+	if etcd == nil {
+		etcd = &EtcdData{ShootNamespace: shootNamespace, PodName: podName}
+		pods[podName] = etcd
+	}
+
+	if etcd.MetricsUrl != metricsUrl || etcd.PodUID != podUID {
+		etcd.SampleNew, etcd.SampleOld, etcd.FaultCount = EtcdSample{}, EtcdSample{}, 0
+	}
+	etcd.PodUID = podUID
+	etcd.PodLabels = podLabels
+	etcd.MetricsUrl = metricsUrl
+}
+
+// RemoveEtcdData deletes all information about the specified etcd pod. Returns false if there was none.
+func (r *Registry) RemoveEtcdData(shootNamespace string, podName string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	pods := r.shoots[shootNamespace]
+	if pods[podName] == nil {
+		return false
+	}
+
+	delete(pods, podName)
+	if len(pods) == 0 {
+		delete(r.shoots, shootNamespace)
+	}
+	return true
+}
+
+// GetEtcds returns all etcd pods on record, across all shoots. The result is a deep copy, and fully detached from the
+// registry.
+func (r *Registry) GetEtcds() []*EtcdData {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []*EtcdData
+	for _, pods := range r.shoots {
+		for _, etcd := range pods {
+			result = append(result, etcd.copy())
+		}
+	}
+	return result
+}
+
+// GetShootEtcds implements [DataSource.GetShootEtcds].
+func (r *Registry) GetShootEtcds(shootNamespace string) []*EtcdData {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	pods := r.shoots[shootNamespace]
+	result := make([]*EtcdData, 0, len(pods))
+	for _, etcd := range pods {
+		result = append(result, etcd.copy())
+	}
+	return result
+}
+
+// SetEtcdMetrics records the counter values obtained by a successful scrape of the specified etcd pod, and resets its
+// fault count. Maps <counter name> -> <value>. A sample which comes too soon after the previous one is ignored. If any
+// counter decreased, the etcd process is taken to have restarted, so the sample is recorded, but the previous one is
+// discarded, as the pair would yield a meaningless rate.
+// If the registry does not contain a record for the specified pod, the operation has no effect.
+func (r *Registry) SetEtcdMetrics(shootNamespace string, podName string, counters map[string]float64) {
+	now := r.testIsolation.TimeNow()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	etcd := r.shoots[shootNamespace][podName]
+	if etcd == nil {
+		return
+	}
+
+	etcd.FaultCount = 0
+	if now.Sub(etcd.SampleNew.Time) < r.minSampleGap {
+		return
+	}
+
+	etcd.SampleOld = etcd.SampleNew
+	for name, value := range counters {
+		if oldValue, ok := etcd.SampleOld.Counters[name]; ok && value < oldValue {
+			etcd.SampleOld = EtcdSample{}
+			break
+		}
+	}
+	etcd.SampleNew = EtcdSample{Time: now, Counters: counters}
+}
+
+// NotifyEtcdMetricsFault records that a scrape of the specified etcd pod failed. Returns the number of consecutive
+// faults on record, including this one, or -1 if the registry does not contain a record for the pod.
+func (r *Registry) NotifyEtcdMetricsFault(shootNamespace string, podName string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	etcd := r.shoots[shootNamespace][podName]
+	if etcd == nil {
+		return -1
+	}
+
+	etcd.FaultCount++
+	return etcd.FaultCount
+}
+
+//#region Test isolation
+
+// registryTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the Registry unit during tests
+type registryTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+}
+
+//#endregion Test isolation
@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcd
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("input.etcd.Registry", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "etcd-main-0"
+		testUID     = "my-uid"
+		testUrl     = "http://10.0.0.1:2381/metrics"
+	)
+
+	var (
+		newTestRegistry = func() *Registry {
+			registry := NewRegistry(10 * time.Second)
+			registry.SetEtcdData(testNs, testPodName, testUID, map[string]string{"app": "etcd-statefulset"}, testUrl)
+			return registry
+		}
+		counters = func(value float64) map[string]float64 {
+			return map[string]float64{ProposalsCommittedCounter: value, ProposalsAppliedCounter: value}
+		}
+	)
+
+	Describe("SetEtcdMetrics", func() {
+		It("should retain the two most recent samples", func() {
+			// Arrange
+			registry := newTestRegistry()
+
+			// Act
+			for i, second := range []int{0, 15, 30} {
+				registry.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, second)
+				registry.SetEtcdMetrics(testNs, testPodName, counters(float64(i)))
+			}
+
+			// Assert
+			etcds := registry.GetShootEtcds(testNs)
+			Expect(etcds).To(HaveLen(1))
+			Expect(etcds[0].SampleNew).To(Equal(EtcdSample{Time: gcmtesting.NewTime(1, 0, 30), Counters: counters(2)}))
+			Expect(etcds[0].SampleOld).To(Equal(EtcdSample{Time: gcmtesting.NewTime(1, 0, 15), Counters: counters(1)}))
+		})
+		It("should ignore a sample which comes sooner than the minimum sample gap", func() {
+			// Arrange
+			registry := newTestRegistry()
+			registry.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			registry.SetEtcdMetrics(testNs, testPodName, counters(1))
+
+			// Act
+			registry.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 5)
+			registry.SetEtcdMetrics(testNs, testPodName, counters(2))
+
+			// Assert
+			etcd := registry.GetShootEtcds(testNs)[0]
+			Expect(etcd.SampleNew.Counters).To(Equal(counters(1)))
+			Expect(etcd.SampleOld.Time.IsZero()).To(BeTrue())
+		})
+		It("should discard the previous sample if a counter decreased", func() {
+			// Arrange
+			registry := newTestRegistry()
+			registry.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			registry.SetEtcdMetrics(testNs, testPodName, counters(100))
+
+			// Act
+			registry.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 15)
+			registry.SetEtcdMetrics(testNs, testPodName, counters(3))
+
+			// Assert
+			etcd := registry.GetShootEtcds(testNs)[0]
+			Expect(etcd.SampleNew.Counters).To(Equal(counters(3)))
+			Expect(etcd.SampleOld.Time.IsZero()).To(BeTrue())
+		})
+		It("should reset the fault count", func() {
+			// Arrange
+			registry := newTestRegistry()
+			registry.NotifyEtcdMetricsFault(testNs, testPodName)
+			registry.NotifyEtcdMetricsFault(testNs, testPodName)
+
+			// Act
+			registry.SetEtcdMetrics(testNs, testPodName, counters(1))
+
+			// Assert
+			Expect(registry.GetShootEtcds(testNs)[0].FaultCount).To(Equal(0))
+			Expect(registry.NotifyEtcdMetricsFault(testNs, testPodName)).To(Equal(1))
+		})
+		It("should have no effect if there is no record for the pod", func() {
+			// Arrange
+			registry := newTestRegistry()
+
+			// Act
+			registry.SetEtcdMetrics(testNs, "other", counters(1))
+
+			// Assert
+			Expect(registry.GetEtcds()).To(HaveLen(1))
+			Expect(registry.NotifyEtcdMetricsFault(testNs, "other")).To(Equal(-1))
+		})
+	})
+
+	Describe("SetEtcdData", func() {
+		It("should discard the samples if the metrics URL changes", func() {
+			// Arrange
+			registry := newTestRegistry()
+			registry.SetEtcdMetrics(testNs, testPodName, counters(1))
+
+			// Act
+			registry.SetEtcdData(testNs, testPodName, testUID, nil, "http://10.0.0.2:2381/metrics")
+
+			// Assert
+			etcd := registry.GetShootEtcds(testNs)[0]
+			Expect(etcd.MetricsUrl).To(Equal("http://10.0.0.2:2381/metrics"))
+			Expect(etcd.SampleNew.Time.IsZero()).To(BeTrue())
+		})
+		It("should retain the samples if neither the metrics URL, nor the UID change", func() {
+			// Arrange
+			registry := newTestRegistry()
+			registry.SetEtcdMetrics(testNs, testPodName, counters(1))
+
+			// Act
+			registry.SetEtcdData(testNs, testPodName, testUID, map[string]string{"app": "changed"}, testUrl)
+
+			// Assert
+			etcd := registry.GetShootEtcds(testNs)[0]
+			Expect(etcd.PodLabels).To(Equal(map[string]string{"app": "changed"}))
+			Expect(etcd.SampleNew.Counters).To(Equal(counters(1)))
+		})
+	})
+
+	Describe("RemoveEtcdData", func() {
+		It("should remove the record, and report whether there was one", func() {
+			// Arrange
+			registry := newTestRegistry()
+
+			// Act
+			isRemoved := registry.RemoveEtcdData(testNs, testPodName)
+			isRemovedAgain := registry.RemoveEtcdData(testNs, testPodName)
+
+			// Assert
+			Expect(isRemoved).To(BeTrue())
+			Expect(isRemovedAgain).To(BeFalse())
+			Expect(registry.GetEtcds()).To(BeEmpty())
+			Expect(registry.GetShootEtcds(testNs)).To(BeEmpty())
+		})
+	})
+
+	Describe("GetShootEtcds", func() {
+		It("should return a copy which is detached from the registry", func() {
+			// Arrange
+			registry := newTestRegistry()
+
+			// Act
+			etcd := registry.GetShootEtcds(testNs)[0]
+			etcd.PodLabels["app"] = "modified"
+			etcd.FaultCount = 5
+
+			// Assert
+			etcd = registry.GetShootEtcds(testNs)[0]
+			Expect(etcd.PodLabels["app"]).To(Equal("etcd-statefulset"))
+			Expect(etcd.FaultCount).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcd
+
+import (
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
+)
+
+// EtcdPodLabelKey and EtcdPodLabelValue identify the etcd pods which etcd-druid creates in shoot namespaces
+const (
+	EtcdPodLabelKey   = "app"
+	EtcdPodLabelValue = "etcd-statefulset"
+)
+
+// PodLabelSelector returns the label selector which selects the etcd pods. The controller watches pods via the
+// manager's cache, so the cache must hold the pods which this selector selects.
+func PodLabelSelector() labels.Selector {
+	return labels.SelectorFromSet(labels.Set{EtcdPodLabelKey: EtcdPodLabelValue})
+}
+
+// isEtcdPodLabels returns true if the specified pod labels identify an etcd pod
+func isEtcdPodLabels(podLabels map[string]string) bool {
+	return podLabels[EtcdPodLabelKey] == EtcdPodLabelValue
+}
+
+// newPredicate creates a predicate filter meant to run against a seed cluster. It allows a pod event if that pod is an
+// etcd pod in a shoot namespace, as identified by the specified selector. A nil selector applies the Gardener defaults.
+func newPredicate(selector *gutil.KapiSelector) predicate.Predicate {
+	return &etcdPredicate{selector: selector}
+}
+
+// See newPredicate
+type etcdPredicate struct {
+	selector *gutil.KapiSelector
+}
+
+// isEtcdPod returns true if the object is an etcd pod in a shoot namespace
+func (p *etcdPredicate) isEtcdPod(obj client.Object) bool {
+	if _, ok := obj.(*corev1.Pod); !ok {
+		return false
+	}
+	return p.selector.IsShootNamespace(obj.GetNamespace()) && isEtcdPodLabels(obj.GetLabels())
+}
+
+// Create returns true if the event target is a shoot etcd pod
+func (p *etcdPredicate) Create(e event.CreateEvent) bool {
+	return p.isEtcdPod(e.Object)
+}
+
+// Update returns true if the event target is, or was, a shoot etcd pod, and experienced changes which affect metrics
+// scraping
+func (p *etcdPredicate) Update(e event.UpdateEvent) bool {
+	isOldEtcd, isNewEtcd := p.isEtcdPod(e.ObjectOld), p.isEtcdPod(e.ObjectNew)
+	if !isOldEtcd && !isNewEtcd {
+		return false
+	}
+	if isOldEtcd != isNewEtcd {
+		return true // The pod is entering/exiting controller oversight
+	}
+
+	oldPod, newPod := e.ObjectOld.(*corev1.Pod), e.ObjectNew.(*corev1.Pod)
+	return oldPod.Status.PodIP != newPod.Status.PodIP || !reflect.DeepEqual(oldPod.Labels, newPod.Labels)
+}
+
+// Delete returns true if the event target is a shoot etcd pod
+func (p *etcdPredicate) Delete(e event.DeleteEvent) bool {
+	return p.isEtcdPod(e.Object)
+}
+
+// Generic rejects the processing of generic events
+func (p *etcdPredicate) Generic(_ event.GenericEvent) bool {
+	return false
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcd
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("input.etcd.predicate", func() {
+	const (
+		testNs = "shoot--my-shoot"
+	)
+
+	var (
+		newTestPod = func() *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: testNs,
+					Labels:    map[string]string{EtcdPodLabelKey: EtcdPodLabelValue},
+				},
+				Status: corev1.PodStatus{PodIP: "10.0.0.1"},
+			}
+		}
+	)
+
+	Describe("Create and Delete", func() {
+		It("should return true only if the event target is an etcd pod in a shoot namespace", func() {
+			// Arrange
+			predicate := newPredicate(nil)
+			nonShootPod := newTestPod()
+			nonShootPod.Namespace = "garden"
+			nonEtcdPod := newTestPod()
+			nonEtcdPod.Labels[EtcdPodLabelKey] = "kubernetes"
+
+			// Act
+			allowEtcd := predicate.Create(event.CreateEvent{Object: newTestPod()})
+			allowNonShoot := predicate.Create(event.CreateEvent{Object: nonShootPod})
+			allowNonEtcd := predicate.Delete(event.DeleteEvent{Object: nonEtcdPod})
+
+			// Assert
+			Expect(allowEtcd).To(BeTrue())
+			Expect(allowNonShoot).To(BeFalse())
+			Expect(allowNonEtcd).To(BeFalse())
+		})
+	})
+
+	Describe("Update", func() {
+		It("should return true only if the pod IP or the labels changed", func() {
+			// Arrange
+			predicate := newPredicate(nil)
+			changedIP := newTestPod()
+			changedIP.Status.PodIP = "10.0.0.2"
+			changedLabels := newTestPod()
+			changedLabels.Labels["role"] = "main"
+			changedOther := newTestPod()
+			changedOther.Status.Phase = corev1.PodRunning
+
+			// Act
+			allowIP := predicate.Update(event.UpdateEvent{ObjectOld: newTestPod(), ObjectNew: changedIP})
+			allowLabels := predicate.Update(event.UpdateEvent{ObjectOld: newTestPod(), ObjectNew: changedLabels})
+			allowOther := predicate.Update(event.UpdateEvent{ObjectOld: newTestPod(), ObjectNew: changedOther})
+
+			// Assert
+			Expect(allowIP).To(BeTrue())
+			Expect(allowLabels).To(BeTrue())
+			Expect(allowOther).To(BeFalse())
+		})
+		It("should return true if the pod stops being an etcd pod", func() {
+			// Arrange
+			predicate := newPredicate(nil)
+			nonEtcdPod := newTestPod()
+			nonEtcdPod.Labels[EtcdPodLabelKey] = "kubernetes"
+
+			// Act
+			allow := predicate.Update(event.UpdateEvent{ObjectOld: newTestPod(), ObjectNew: nonEtcdPod})
+
+			// Assert
+			Expect(allow).To(BeTrue())
+		})
+	})
+
+	Describe("Generic", func() {
+		It("should return false", func() {
+			// Act
+			allow := newPredicate(nil).Generic(event.GenericEvent{Object: newTestPod()})
+
+			// Assert
+			Expect(allow).To(BeFalse())
+		})
+	})
+})
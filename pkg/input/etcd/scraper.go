@@ -0,0 +1,260 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
+)
+
+const (
+	// The number of etcd pods which are scraped concurrently
+	scrapeConcurrency = 10
+	// An etcd metrics response is normally well under 1MiB. Larger responses fail the scrape.
+	maxResponseSize = 10 * 1024 * 1024
+)
+
+// Scraper periodically scrapes the metrics of all etcd pods in the registry, and records the obtained samples there.
+// Unlike the kube-apiserver scraper, it makes no attempt to spread the scrapes over the scrape period: the number of
+// etcd pods per shoot is small and stable, and their metrics responses are cheap to produce.
+//
+// Scraper implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable].
+type Scraper struct {
+	registry     *Registry
+	scrapePeriod time.Duration
+	client       *http.Client
+	// If not nil, only the etcd pods in namespaces for which it returns true are scraped. See
+	// [github.com/gardener/gardener-custom-metrics/pkg/input.InputDataService.SetShardPredicate].
+	isNamespaceOwned func(namespace string) bool
+	// If not nil, receives the outcome of each scrape
+	condition *conditions.ComponentReporter
+	log       logr.Logger
+
+	testIsolation scraperTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// NewScraper creates a Scraper which scrapes each etcd pod in the registry once per scrapePeriod. Each scrape times out
+// after the scrape period. If isNamespaceOwned is not nil, only the pods in namespaces for which it returns true are
+// scraped. condition, if not nil, receives the outcome of each scrape.
+func NewScraper(
+	registry *Registry,
+	scrapePeriod time.Duration,
+	isNamespaceOwned func(namespace string) bool,
+	condition *conditions.ComponentReporter,
+	log logr.Logger) *Scraper {
+
+	return &Scraper{
+		registry:         registry,
+		scrapePeriod:     scrapePeriod,
+		client:           &http.Client{Timeout: scrapePeriod},
+		isNamespaceOwned: isNamespaceOwned,
+		condition:        condition,
+		log:              log,
+		testIsolation:    scraperTestIsolation{TimeAfter: time.After},
+	}
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It scrapes all etcd pods once per
+// scrape period, until the context is cancelled.
+func (s *Scraper) Start(ctx context.Context) error {
+	s.log.V(app.VerbosityVerbose).Info("Etcd scraper started", "period", s.scrapePeriod)
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.log.V(app.VerbosityInfo).Info("Context closed, exiting")
+			return nil
+		case <-s.testIsolation.TimeAfter(s.scrapePeriod):
+			s.scrapeAll(ctx)
+		}
+	}
+}
+
+// scrapeAll scrapes all etcd pods in the registry, no more than scrapeConcurrency at a time, and returns once all
+// scrapes are complete
+func (s *Scraper) scrapeAll(ctx context.Context) {
+	semaphore := make(chan struct{}, scrapeConcurrency)
+	var wg sync.WaitGroup
+	for _, etcd := range s.registry.GetEtcds() {
+		if s.isNamespaceOwned != nil && !s.isNamespaceOwned(etcd.ShootNamespace) {
+			continue
+		}
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(etcd *EtcdData) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			s.scrape(ctx, etcd)
+		}(etcd)
+	}
+	wg.Wait()
+}
+
+// scrape scrapes a single etcd pod, and records the outcome in the registry
+func (s *Scraper) scrape(ctx context.Context, etcd *EtcdData) {
+	log := s.log.WithValues("namespace", etcd.ShootNamespace, "pod", etcd.PodName)
+
+	counters, err := s.getCounters(ctx, etcd.MetricsUrl)
+	if err != nil {
+		faultCount := s.registry.NotifyEtcdMetricsFault(etcd.ShootNamespace, etcd.PodName)
+		log.V(app.VerbosityInfo).Info("Failed to scrape etcd pod", "error", err.Error(), "faultCount", faultCount)
+		s.condition.ReportScopedError(
+			etcd.ShootNamespace, fmt.Errorf("scraping etcd pod %s/%s: %w", etcd.ShootNamespace, etcd.PodName, err))
+		return
+	}
+
+	s.registry.SetEtcdMetrics(etcd.ShootNamespace, etcd.PodName, counters)
+	s.condition.ReportScopedSuccess(etcd.ShootNamespace)
+	log.V(app.VerbosityVerbose).Info("Scraped etcd pod", "counters", counters)
+}
+
+// getCounters scrapes the specified URL, and returns the values of the counters in the Counters list. Counters which
+// are exposed as multiple series, with different labels, are summed. Fails, if none of the counters is present.
+func (s *Scraper) getCounters(ctx context.Context, url string) (map[string]float64, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the server responded with status %s", response.Status)
+	}
+
+	// Read past the limit, to tell a response which exceeds it from one which is exactly at it. Silently truncating
+	// the response would yield partial sums.
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if len(body) > maxResponseSize {
+		return nil, fmt.Errorf("the metrics response exceeds the maximum size of %d bytes", maxResponseSize)
+	}
+
+	return parseCounters(bytes.NewReader(body))
+}
+
+// parseCounters processes a metrics response in the Prometheus text format, and returns the values of the counters in
+// the Counters list. Counters which are exposed as multiple series, with different labels, are summed. Fails, if none
+// of the counters is present.
+func parseCounters(metricsStream io.Reader) (map[string]float64, error) {
+	result := make(map[string]float64, len(Counters))
+	scanner := bufio.NewScanner(metricsStream)
+	scanner.Buffer(nil, maxResponseSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		name, value, err := parseSampleLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if !isScrapedCounter(name) {
+			continue
+		}
+		result[name] += value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read metrics response: %w", err)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("the metrics response contains none of the counters %s", strings.Join(Counters, ", "))
+	}
+	return result, nil
+}
+
+// parseSampleLine splits a sample line, e.g. `etcd_server_proposals_committed_total{member="a"} 15 1712345678000`,
+// into the metric name and the value. The label set, and the optional timestamp, are ignored.
+func parseSampleLine(line string) (string, float64, error) {
+	nameEnd := strings.IndexAny(line, "{ ")
+	if nameEnd == -1 {
+		return "", 0, fmt.Errorf("invalid sample line '%s'", line)
+	}
+	name := line[:nameEnd]
+	if !isScrapedCounter(name) {
+		// Do not bother parsing lines which are not of interest
+		return name, 0, nil
+	}
+
+	rest := line[nameEnd:]
+	if rest[0] == '{' {
+		labelsEnd := findLabelSetEnd(rest)
+		if labelsEnd == -1 {
+			return "", 0, fmt.Errorf("invalid sample line '%s': unterminated label set", line)
+		}
+		rest = rest[labelsEnd+1:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", 0, fmt.Errorf("invalid sample line '%s': missing value", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid sample line '%s': %w", line, err)
+	}
+	return name, value, nil
+}
+
+// findLabelSetEnd returns the index of the '}' which closes the label set at the start of the specified string, or -1
+// if the label set is not terminated. Braces within quoted label values are ignored.
+func findLabelSetEnd(str string) int {
+	isQuoted := false
+	for i := 1; i < len(str); i++ {
+		switch {
+		case isQuoted && str[i] == '\\':
+			i++ // Skip the escaped character
+		case str[i] == '"':
+			isQuoted = !isQuoted
+		case !isQuoted && str[i] == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// isScrapedCounter returns true if the specified metric is one of the counters in the Counters list
+func isScrapedCounter(name string) bool {
+	for _, counter := range Counters {
+		if name == counter {
+			return true
+		}
+	}
+	return false
+}
+
+//#region Test isolation
+
+// scraperTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the Scraper unit during tests
+type scraperTestIsolation struct {
+	// Points to [time.After]
+	TimeAfter func(time.Duration) <-chan time.Time
+}
+
+//#endregion Test isolation
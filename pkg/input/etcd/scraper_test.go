@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("input.etcd.Scraper", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "etcd-main-0"
+		testMetrics = `# HELP etcd_server_proposals_committed_total The total number of consensus proposals committed.
+# TYPE etcd_server_proposals_committed_total counter
+etcd_server_proposals_committed_total 1500
+etcd_server_proposals_applied_total{member="a"} 1000
+etcd_server_proposals_applied_total{member="b",note="with } brace"} 490 1712345678000
+etcd_server_proposals_pending 2
+`
+	)
+
+	Describe("parseCounters", func() {
+		It("should return the counters of interest, summed across label sets", func() {
+			// Act
+			counters, err := parseCounters(strings.NewReader(testMetrics))
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(counters).To(Equal(map[string]float64{
+				ProposalsCommittedCounter: 1500,
+				ProposalsAppliedCounter:   1490,
+			}))
+		})
+		It("should fail if none of the counters is present", func() {
+			// Act
+			_, err := parseCounters(strings.NewReader("etcd_server_proposals_pending 2\n"))
+
+			// Assert
+			Expect(err).To(MatchError(ContainSubstring("contains none of the counters")))
+		})
+		It("should fail on a malformed line of interest", func() {
+			// Arrange
+			inputs := []string{
+				"etcd_server_proposals_committed_total{member=\"a\" 15\n",
+				"etcd_server_proposals_committed_total abc\n",
+				"etcd_server_proposals_committed_total{}\n",
+			}
+
+			for _, input := range inputs {
+				// Act
+				_, err := parseCounters(strings.NewReader(input))
+
+				// Assert
+				Expect(err).To(HaveOccurred(), input)
+			}
+		})
+	})
+
+	Describe("scrapeAll", func() {
+		It("should record a sample for pods which respond, and a fault for pods which do not", func() {
+			// Arrange
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/metrics" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write([]byte(testMetrics))
+			}))
+			defer server.Close()
+			registry := NewRegistry(10 * time.Second)
+			registry.SetEtcdData(testNs, testPodName, "uid", nil, server.URL+"/metrics")
+			registry.SetEtcdData(testNs, "broken", "uid2", nil, server.URL+"/missing")
+			scraper := NewScraper(registry, time.Minute, nil, nil, logr.Discard())
+
+			// Act
+			scraper.scrapeAll(context.Background())
+
+			// Assert
+			etcds := map[string]*EtcdData{}
+			for _, etcd := range registry.GetShootEtcds(testNs) {
+				etcds[etcd.PodName] = etcd
+			}
+			Expect(etcds[testPodName].SampleNew.Counters).To(HaveKeyWithValue(ProposalsCommittedCounter, 1500.0))
+			Expect(etcds[testPodName].FaultCount).To(Equal(0))
+			Expect(etcds["broken"].SampleNew.Time.IsZero()).To(BeTrue())
+			Expect(etcds["broken"].FaultCount).To(Equal(1))
+		})
+		It("should skip pods in namespaces which are not owned", func() {
+			// Arrange
+			isCalled := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				isCalled = true
+				_, _ = w.Write([]byte(testMetrics))
+			}))
+			defer server.Close()
+			registry := NewRegistry(10 * time.Second)
+			registry.SetEtcdData(testNs, testPodName, "uid", nil, server.URL+"/metrics")
+			isOwned := func(string) bool { return false }
+			scraper := NewScraper(registry, time.Minute, isOwned, nil, logr.Discard())
+
+			// Act
+			scraper.scrapeAll(context.Background())
+
+			// Assert
+			Expect(isCalled).To(BeFalse())
+			Expect(registry.GetShootEtcds(testNs)[0].SampleNew.Time.IsZero()).To(BeTrue())
+		})
+	})
+})
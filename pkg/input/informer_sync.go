@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"fmt"
+
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// newInformerSyncWaiter returns a function which blocks until the informers for the specified object types complete
+// their initial sync, or the context is cancelled. The informers are obtained from the specified cache, which starts
+// them, if the controllers did not do so yet. They sync in parallel, so the wait takes as long as the slowest of them.
+func newInformerSyncWaiter(informers cache.Informers, objects ...client.Object) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		hasSynced := make([]toolscache.InformerSynced, 0, len(objects))
+		for _, obj := range objects {
+			informer, err := informers.GetInformer(ctx, obj, cache.BlockUntilSynced(false))
+			if err != nil {
+				return fmt.Errorf("waiting for informer sync: getting the informer for %T: %w", obj, err)
+			}
+			hasSynced = append(hasSynced, informer.HasSynced)
+		}
+
+		if !toolscache.WaitForCacheSync(ctx.Done(), hasSynced...) {
+			return fmt.Errorf("waiting for informer sync: %w", ctx.Err())
+		}
+		return nil
+	}
+}
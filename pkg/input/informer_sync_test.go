@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+)
+
+var _ = Describe("input.newInformerSyncWaiter", func() {
+	var (
+		// Creates fake informers for pods and secrets, with the specified sync state
+		newTestInformers = func(isPodSynced bool, isSecretSynced bool) *informertest.FakeInformers {
+			informers := &informertest.FakeInformers{}
+			podInformer, err := informers.FakeInformerFor(context.Background(), &corev1.Pod{})
+			Expect(err).NotTo(HaveOccurred())
+			podInformer.Synced = isPodSynced
+			secretInformer, err := informers.FakeInformerFor(context.Background(), &corev1.Secret{})
+			Expect(err).NotTo(HaveOccurred())
+			secretInformer.Synced = isSecretSynced
+			return informers
+		}
+	)
+
+	It("should return no error, once all informers synced", func() {
+		// Arrange
+		wait := newInformerSyncWaiter(newTestInformers(true, true), &corev1.Pod{}, &corev1.Secret{})
+
+		// Act
+		err := wait(context.Background())
+
+		// Assert
+		Expect(err).To(Succeed())
+	})
+	It("should return an error, if any of the informers does not sync before the context is cancelled", func() {
+		// Arrange
+		wait := newInformerSyncWaiter(newTestInformers(true, false), &corev1.Pod{}, &corev1.Secret{})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		// Act
+		err := wait(ctx)
+
+		// Assert
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+})
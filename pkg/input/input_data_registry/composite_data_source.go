@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input_data_registry
+
+import (
+	"sort"
+	"sync"
+)
+
+// CompositeDataSource is an [InputDataSource] which merges the data of multiple member sources, each covering the
+// shoots on a different cluster (seed). Members are keyed by cluster identity.
+//
+// A shoot's control plane normally resides on a single seed, but while it is being migrated between seeds, its Kapi
+// pods may briefly exist on both. So, the Kapis of a shoot are collected from all members, rather than from the first
+// member which knows the shoot.
+//
+// All operations are concurrency-safe. The set of members is immutable.
+type CompositeDataSource struct {
+	// Member sources, keyed by cluster identity
+	members map[string]InputDataSource
+	// Cluster identities, in the order in which members are consulted
+	clusters []string
+
+	// For each watcher added via AddKapiWatcher, the wrapper which was added to the members in its place. Protected by
+	// watchersLock.
+	watchers map[*KapiWatcher]*KapiWatcher
+	// Same as watchers, but for the watchers added via AddSampleWatcher. Protected by watchersLock.
+	sampleWatchers map[*SampleWatcher]*SampleWatcher
+	watchersLock   sync.Mutex
+}
+
+// NewCompositeDataSource creates a CompositeDataSource with the specified members, keyed by cluster identity. Members
+// are consulted in order of cluster identity.
+func NewCompositeDataSource(members map[string]InputDataSource) *CompositeDataSource {
+	clusters := make([]string, 0, len(members))
+	membersCopy := make(map[string]InputDataSource, len(members))
+	for cluster, member := range members {
+		clusters = append(clusters, cluster)
+		membersCopy[cluster] = member
+	}
+	sort.Strings(clusters)
+
+	return &CompositeDataSource{
+		members:        membersCopy,
+		clusters:       clusters,
+		watchers:       make(map[*KapiWatcher]*KapiWatcher),
+		sampleWatchers: make(map[*SampleWatcher]*SampleWatcher),
+	}
+}
+
+// Clusters returns the identities of the member clusters, in order
+func (c *CompositeDataSource) Clusters() []string {
+	return append([]string(nil), c.clusters...)
+}
+
+// Member returns the member source of the specified cluster, or nil if there is no such member
+func (c *CompositeDataSource) Member(cluster string) InputDataSource {
+	return c.members[cluster]
+}
+
+// GetShootKapis implements [InputDataSource.GetShootKapis]. Returns nil if the shoot is unknown to all members.
+func (c *CompositeDataSource) GetShootKapis(shootNamespace string) []ShootKapi {
+	var result []ShootKapi
+	for _, cluster := range c.clusters {
+		if kapis := c.members[cluster].GetShootKapis(shootNamespace); kapis != nil {
+			if result == nil {
+				result = make([]ShootKapi, 0, len(kapis))
+			}
+			result = append(result, kapis...)
+		}
+	}
+
+	return result
+}
+
+// GetShootGeneration implements [InputDataSource.GetShootGeneration]. Returns the sum of the members' generations,
+// which changes whenever any of them changes, since none of them decreases.
+func (c *CompositeDataSource) GetShootGeneration(shootNamespace string) uint64 {
+	var result uint64
+	for _, cluster := range c.clusters {
+		result += c.members[cluster].GetShootGeneration(shootNamespace)
+	}
+	return result
+}
+
+// GetGeneration implements [InputDataSource.GetGeneration]. Returns the sum of the members' generations.
+func (c *CompositeDataSource) GetGeneration() uint64 {
+	var result uint64
+	for _, cluster := range c.clusters {
+		result += c.members[cluster].GetGeneration()
+	}
+	return result
+}
+
+// AddKapiWatcher implements [InputDataSource.AddKapiWatcher]. The watcher receives the events of all members. Each
+// member delivers events on its own goroutine, so the watcher is wrapped in a way which delivers events one at a time.
+// Events from the same member retain their order. Adding the same watcher more than once has no effect.
+func (c *CompositeDataSource) AddKapiWatcher(watcher *KapiWatcher, shouldNotifyOfPreexisting bool) {
+	c.watchersLock.Lock()
+	defer c.watchersLock.Unlock()
+
+	if c.watchers[watcher] != nil {
+		return
+	}
+	var deliveryLock sync.Mutex
+	var wrapper KapiWatcher = func(kapi ShootKapi, event KapiEventType) {
+		deliveryLock.Lock()
+		defer deliveryLock.Unlock()
+		(*watcher)(kapi, event)
+	}
+	c.watchers[watcher] = &wrapper
+	for _, cluster := range c.clusters {
+		c.members[cluster].AddKapiWatcher(&wrapper, shouldNotifyOfPreexisting)
+	}
+}
+
+// RemoveKapiWatcher implements [InputDataSource.RemoveKapiWatcher].
+func (c *CompositeDataSource) RemoveKapiWatcher(watcher *KapiWatcher) bool {
+	c.watchersLock.Lock()
+	wrapper := c.watchers[watcher]
+	delete(c.watchers, watcher)
+	c.watchersLock.Unlock()
+
+	if wrapper == nil {
+		return false
+	}
+	for _, cluster := range c.clusters {
+		c.members[cluster].RemoveKapiWatcher(wrapper)
+	}
+	return true
+}
+
+// AddSampleWatcher implements [InputDataSource.AddSampleWatcher]. The watcher receives the notifications of all
+// members, one at a time, same as with AddKapiWatcher. Notifications from different members are not coalesced.
+// Adding the same watcher more than once has no effect.
+func (c *CompositeDataSource) AddSampleWatcher(watcher *SampleWatcher) {
+	c.watchersLock.Lock()
+	defer c.watchersLock.Unlock()
+
+	if c.sampleWatchers[watcher] != nil {
+		return
+	}
+	var deliveryLock sync.Mutex
+	var wrapper SampleWatcher = func(shootNamespace string) {
+		deliveryLock.Lock()
+		defer deliveryLock.Unlock()
+		(*watcher)(shootNamespace)
+	}
+	c.sampleWatchers[watcher] = &wrapper
+	for _, cluster := range c.clusters {
+		c.members[cluster].AddSampleWatcher(&wrapper)
+	}
+}
+
+// RemoveSampleWatcher implements [InputDataSource.RemoveSampleWatcher].
+func (c *CompositeDataSource) RemoveSampleWatcher(watcher *SampleWatcher) bool {
+	c.watchersLock.Lock()
+	wrapper := c.sampleWatchers[watcher]
+	delete(c.sampleWatchers, watcher)
+	c.watchersLock.Unlock()
+
+	if wrapper == nil {
+		return false
+	}
+	for _, cluster := range c.clusters {
+		c.members[cluster].RemoveSampleWatcher(wrapper)
+	}
+	return true
+}
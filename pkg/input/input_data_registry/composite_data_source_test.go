@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input_data_registry
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("input.input_data_registry.CompositeDataSource", func() {
+	const (
+		nsName     = "shoot--my-shoot"
+		metricsURL = "https://host:123/metrics"
+	)
+
+	var (
+		// Creates a composite of two registries, keyed as "seed-a" and "seed-b"
+		newTestComposite = func() (*CompositeDataSource, InputDataRegistry, InputDataRegistry) {
+			idrA := NewInputDataRegistry(time.Minute, logr.Discard())
+			idrB := NewInputDataRegistry(time.Minute, logr.Discard())
+			composite := NewCompositeDataSource(map[string]InputDataSource{
+				"seed-b": idrB.DataSource(),
+				"seed-a": idrA.DataSource(),
+			})
+			return composite, idrA, idrB
+		}
+		getPodNames = func(kapis []ShootKapi) []string {
+			var result []string
+			for _, kapi := range kapis {
+				result = append(result, kapi.PodName())
+			}
+			return result
+		}
+	)
+
+	Describe("Clusters and Member", func() {
+		It("should list the clusters in order, and return the respective members", func() {
+			// Arrange
+			composite, idrA, _ := newTestComposite()
+			idrA.SetKapiData(nsName, "pod-a", "", nil, metricsURL)
+
+			// Act
+			clusters := composite.Clusters()
+
+			// Assert
+			Expect(clusters).To(Equal([]string{"seed-a", "seed-b"}))
+			Expect(getPodNames(composite.Member("seed-a").GetShootKapis(nsName))).To(Equal([]string{"pod-a"}))
+			Expect(composite.Member("seed-b").GetShootKapis(nsName)).To(BeNil())
+			Expect(composite.Member("seed-c")).To(BeNil())
+		})
+	})
+
+	Describe("GetShootKapis", func() {
+		It("should return nil if no member knows the shoot", func() {
+			// Arrange
+			composite, _, _ := newTestComposite()
+
+			// Act
+			kapis := composite.GetShootKapis(nsName)
+
+			// Assert
+			Expect(kapis).To(BeNil())
+		})
+
+		It("should return the shoot's Kapis from all members which know the shoot", func() {
+			// Arrange
+			composite, idrA, idrB := newTestComposite()
+			idrA.SetKapiData(nsName, "pod-a", "", nil, metricsURL)
+			idrB.SetKapiData(nsName, "pod-b", "", nil, metricsURL)
+			idrB.SetKapiData(nsName+"2", "pod-c", "", nil, metricsURL)
+
+			// Act
+			kapis := composite.GetShootKapis(nsName)
+
+			// Assert
+			Expect(getPodNames(kapis)).To(Equal([]string{"pod-a", "pod-b"}))
+		})
+	})
+
+	Describe("GetShootGeneration", func() {
+		It("should change when the shoot's data changes on any of the members", func() {
+			// Arrange
+			composite, idrA, idrB := newTestComposite()
+			idrA.SetKapiData(nsName, "pod-a", "", nil, metricsURL)
+			before := composite.GetShootGeneration(nsName)
+
+			// Act
+			idrB.SetKapiData(nsName, "pod-b", "", nil, metricsURL)
+			afterB := composite.GetShootGeneration(nsName)
+			idrA.SetKapiMetrics(nsName, "pod-a", 42)
+
+			// Assert
+			Expect(afterB).To(BeNumerically(">", before))
+			Expect(composite.GetShootGeneration(nsName)).To(BeNumerically(">", afterB))
+			Expect(composite.GetShootGeneration("unknown")).To(BeZero())
+		})
+	})
+
+	Describe("AddKapiWatcher and RemoveKapiWatcher", func() {
+		It("should deliver the events of all members, and stop delivering once the watcher is removed", func() {
+			// Arrange
+			composite, idrA, idrB := newTestComposite()
+			var lock sync.Mutex
+			var podNames []string
+			var watcher KapiWatcher = func(kapi ShootKapi, event KapiEventType) {
+				lock.Lock()
+				defer lock.Unlock()
+				if event == KapiEventCreate {
+					podNames = append(podNames, kapi.PodName())
+				}
+			}
+			getWatchedPodNames := func() []string {
+				lock.Lock()
+				defer lock.Unlock()
+				return append([]string(nil), podNames...)
+			}
+			idrA.SetKapiData(nsName, "pod-a", "", nil, metricsURL)
+
+			// Act
+			composite.AddKapiWatcher(&watcher, true)
+			idrB.SetKapiData(nsName, "pod-b", "", nil, metricsURL)
+			Eventually(getWatchedPodNames).Should(ConsistOf("pod-a", "pod-b"))
+			isRemoved := composite.RemoveKapiWatcher(&watcher)
+			idrA.SetKapiData(nsName, "pod-c", "", nil, metricsURL)
+
+			// Assert
+			Expect(isRemoved).To(BeTrue())
+			Consistently(getWatchedPodNames, 100*time.Millisecond).Should(ConsistOf("pod-a", "pod-b"))
+			Expect(composite.RemoveKapiWatcher(&watcher)).To(BeFalse())
+		})
+	})
+
+	Describe("AddSampleWatcher and RemoveSampleWatcher", func() {
+		It("should deliver the notifications of all members, and stop delivering once the watcher is removed", func() {
+			// Arrange
+			composite, idrA, idrB := newTestComposite()
+			var deliveredCount atomic.Int32
+			var watcher SampleWatcher = func(_ string) { deliveredCount.Add(1) }
+			idrA.SetKapiData(nsName, "pod-a", "", nil, metricsURL)
+			idrB.SetKapiData(nsName, "pod-b", "", nil, metricsURL)
+			before := composite.GetGeneration()
+
+			// Act
+			composite.AddSampleWatcher(&watcher)
+			idrA.SetKapiMetrics(nsName, "pod-a", 1)
+			Eventually(deliveredCount.Load).Should(Equal(int32(1)))
+			idrB.SetKapiMetrics(nsName, "pod-b", 1)
+			Eventually(deliveredCount.Load).Should(Equal(int32(2)))
+			isRemoved := composite.RemoveSampleWatcher(&watcher)
+			idrA.SetKapiInflightRequests(nsName, "pod-a", 5)
+
+			// Assert
+			Expect(isRemoved).To(BeTrue())
+			Consistently(deliveredCount.Load, 100*time.Millisecond).Should(Equal(int32(2)))
+			Expect(composite.RemoveSampleWatcher(&watcher)).To(BeFalse())
+			Expect(composite.GetGeneration()).To(BeNumerically(">", before))
+		})
+	})
+})
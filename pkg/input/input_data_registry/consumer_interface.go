@@ -14,27 +14,97 @@ import (
 
 // ShootKapi contains metrics for a single kube-apiserver pod
 type ShootKapi interface {
-	ShootNamespace() string       // ShootNamespace and PodName are immutable and together serve as ID
-	PodName() string              // ShootNamespace and PodName are immutable and together serve as ID
-	PodLabels() map[string]string // The K8s labels on the pod object
-	TotalRequestCountNew() int64  // Most recent value for the number of Kapi requests to this pod, since the pod started.
-	TotalRequestCountOld() int64  // The previous value of TotalRequestCountNew. Enables rate-of-change calculations.
-	MetricsTimeNew() time.Time    // The point in time to which TotalRequestCountNew refers. Zero when the metrics sample is unavailable.
-	MetricsTimeOld() time.Time    // The point in time to which TotalRequestCountOld refers. Zero when the metrics sample is unavailable.
+	ShootNamespace() string         // ShootNamespace and PodName are immutable and together serve as ID
+	PodName() string                // ShootNamespace and PodName are immutable and together serve as ID
+	PodLabels() map[string]string   // The K8s labels on the pod object
+	TotalRequestCountNew() int64    // Most recent value for the number of Kapi requests to this pod, since the pod started.
+	TotalRequestCountOld() int64    // The previous value of TotalRequestCountNew. Enables rate-of-change calculations.
+	MetricsTimeNew() time.Time      // The point in time to which TotalRequestCountNew refers. Zero when the metrics sample is unavailable.
+	MetricsTimeOld() time.Time      // The point in time to which TotalRequestCountOld refers. Zero when the metrics sample is unavailable.
+	InflightRequestCount() int64    // Most recent value for the number of requests currently being served by the pod.
+	InflightRequestTime() time.Time // The point in time to which InflightRequestCount refers. Zero when the metrics sample is unavailable.
+	CPUSecondsNew() float64         // Most recent value for the CPU time consumed by the kube-apiserver process, since it started.
+	CPUSampleTimeNew() time.Time    // The point in time to which CPUSecondsNew refers. Zero when the sample is unavailable.
+	CPUSecondsOld() float64         // The previous value of CPUSecondsNew. Enables CPU usage rate calculations.
+	CPUSampleTimeOld() time.Time    // The point in time to which CPUSecondsOld refers. Zero when the sample is unavailable.
+	ResidentMemoryBytes() int64     // Most recent value for the resident memory size of the kube-apiserver process.
+	MemorySampleTime() time.Time    // The point in time to which ResidentMemoryBytes refers. Zero when the sample is unavailable.
 	PodUID() types.UID
+
+	RequestDurationSecondsNew() float64 // Most recent value for the total time spent serving requests, since the pod started.
+	RequestDurationCountNew() int64     // Most recent value for the number of requests in RequestDurationSecondsNew.
+	RequestDurationTimeNew() time.Time  // The point in time to which the ...New request duration values refer. Zero when unavailable.
+	RequestDurationSecondsOld() float64 // The previous value of RequestDurationSecondsNew. Enables average latency calculations.
+	RequestDurationCountOld() int64     // The previous value of RequestDurationCountNew.
+	RequestDurationTimeOld() time.Time  // The point in time to which the ...Old request duration values refer. Zero when unavailable.
+
+	ClientErrorCountNew() int64 // The number of requests in TotalRequestCountNew which failed with a 4xx code.
+	ServerErrorCountNew() int64 // The number of requests in TotalRequestCountNew which failed with a 5xx code.
+	ClientErrorCountOld() int64 // The previous value of ClientErrorCountNew. Refers to MetricsTimeOld.
+	ServerErrorCountOld() int64 // The previous value of ServerErrorCountNew. Refers to MetricsTimeOld.
+
+	// The most recent request count samples, oldest first. The last two are the ones in TotalRequestCountOld and
+	// TotalRequestCountNew. Holds up to RequestCountHistorySize samples.
+	RequestCountHistory() []RequestCountSample
+
+	// The durations of the most recent successful scrapes of the pod, oldest first. Holds up to
+	// ScrapeDurationHistorySize durations.
+	ScrapeDurationHistory() []time.Duration
+
+	// The point in time when the kube-apiserver process started, as reported by the process. Zero when unknown.
+	ProcessStartTime() time.Time
+
+	// True if the pod is ready, or if its readiness is unknown
+	IsReady() bool
 }
 
 // kapiDataAdapter adapts the KapiData type to the ShootKapi interface
 type kapiDataAdapter struct{ x *KapiData }
 
-func (kapi *kapiDataAdapter) PodName() string              { return kapi.x.PodName() }
-func (kapi *kapiDataAdapter) ShootNamespace() string       { return kapi.x.ShootNamespace() }
-func (kapi *kapiDataAdapter) PodLabels() map[string]string { return kapi.x.PodLabels }
-func (kapi *kapiDataAdapter) TotalRequestCountNew() int64  { return kapi.x.TotalRequestCountNew }
-func (kapi *kapiDataAdapter) MetricsTimeNew() time.Time    { return kapi.x.MetricsTimeNew }
-func (kapi *kapiDataAdapter) TotalRequestCountOld() int64  { return kapi.x.TotalRequestCountOld }
-func (kapi *kapiDataAdapter) MetricsTimeOld() time.Time    { return kapi.x.MetricsTimeOld }
-func (kapi *kapiDataAdapter) PodUID() types.UID            { return kapi.x.PodUID }
+func (kapi *kapiDataAdapter) PodName() string                { return kapi.x.PodName() }
+func (kapi *kapiDataAdapter) ShootNamespace() string         { return kapi.x.ShootNamespace() }
+func (kapi *kapiDataAdapter) PodLabels() map[string]string   { return kapi.x.PodLabels }
+func (kapi *kapiDataAdapter) TotalRequestCountNew() int64    { return kapi.x.TotalRequestCountNew }
+func (kapi *kapiDataAdapter) MetricsTimeNew() time.Time      { return kapi.x.MetricsTimeNew }
+func (kapi *kapiDataAdapter) TotalRequestCountOld() int64    { return kapi.x.TotalRequestCountOld }
+func (kapi *kapiDataAdapter) MetricsTimeOld() time.Time      { return kapi.x.MetricsTimeOld }
+func (kapi *kapiDataAdapter) InflightRequestCount() int64    { return kapi.x.InflightRequestCount }
+func (kapi *kapiDataAdapter) InflightRequestTime() time.Time { return kapi.x.InflightRequestTime }
+func (kapi *kapiDataAdapter) CPUSecondsNew() float64         { return kapi.x.CPUSecondsNew }
+func (kapi *kapiDataAdapter) CPUSampleTimeNew() time.Time    { return kapi.x.CPUSampleTimeNew }
+func (kapi *kapiDataAdapter) CPUSecondsOld() float64         { return kapi.x.CPUSecondsOld }
+func (kapi *kapiDataAdapter) CPUSampleTimeOld() time.Time    { return kapi.x.CPUSampleTimeOld }
+func (kapi *kapiDataAdapter) ResidentMemoryBytes() int64     { return kapi.x.ResidentMemoryBytes }
+func (kapi *kapiDataAdapter) MemorySampleTime() time.Time    { return kapi.x.MemorySampleTime }
+func (kapi *kapiDataAdapter) PodUID() types.UID              { return kapi.x.PodUID }
+
+func (kapi *kapiDataAdapter) RequestDurationSecondsNew() float64 {
+	return kapi.x.RequestDurationSecondsNew
+}
+func (kapi *kapiDataAdapter) RequestDurationCountNew() int64    { return kapi.x.RequestDurationCountNew }
+func (kapi *kapiDataAdapter) RequestDurationTimeNew() time.Time { return kapi.x.RequestDurationTimeNew }
+func (kapi *kapiDataAdapter) RequestDurationSecondsOld() float64 {
+	return kapi.x.RequestDurationSecondsOld
+}
+func (kapi *kapiDataAdapter) RequestDurationCountOld() int64    { return kapi.x.RequestDurationCountOld }
+func (kapi *kapiDataAdapter) RequestDurationTimeOld() time.Time { return kapi.x.RequestDurationTimeOld }
+
+func (kapi *kapiDataAdapter) ClientErrorCountNew() int64 { return kapi.x.ClientErrorCountNew }
+func (kapi *kapiDataAdapter) ServerErrorCountNew() int64 { return kapi.x.ServerErrorCountNew }
+func (kapi *kapiDataAdapter) ClientErrorCountOld() int64 { return kapi.x.ClientErrorCountOld }
+func (kapi *kapiDataAdapter) ServerErrorCountOld() int64 { return kapi.x.ServerErrorCountOld }
+
+func (kapi *kapiDataAdapter) RequestCountHistory() []RequestCountSample {
+	return kapi.x.RequestCountHistory.Samples()
+}
+
+func (kapi *kapiDataAdapter) ScrapeDurationHistory() []time.Duration {
+	return kapi.x.ScrapeDurationHistory.Durations()
+}
+
+func (kapi *kapiDataAdapter) ProcessStartTime() time.Time { return kapi.x.ProcessStartTime }
+
+func (kapi *kapiDataAdapter) IsReady() bool { return !kapi.x.NotReady }
 
 //#endregion ShootKapi interface
 
@@ -44,48 +114,74 @@ func (kapi *kapiDataAdapter) PodUID() types.UID            { return kapi.x.PodUI
 // on the same seed. All operations are concurrency-safe.
 type InputDataSource interface {
 	// GetShootKapis lists the known Kapi pods for the shoot identified by shootNamespace. Returns nil if the shoot
-	// is unknown to InputDataSource at the time of the call.
+	// is unknown to InputDataSource at the time of the call. The result is a snapshot, which may be shared by multiple
+	// callers, so callers must not modify the returned slice.
 	GetShootKapis(shootNamespace string) []ShootKapi
 
+	// GetShootGeneration returns a number which changes whenever the data returned by GetShootKapis for the shoot
+	// identified by shootNamespace changes, e.g. upon each new metrics sample. Consumers can compare it to a previously
+	// obtained value, to find out whether data they derived from the shoot's Kapis is still current. The value never
+	// decreases. Zero means that the shoot has never been known to the InputDataSource.
+	GetShootGeneration(shootNamespace string) uint64
+
+	// GetGeneration returns a number which changes whenever the data returned by GetShootKapis for any shoot changes.
+	// The value never decreases.
+	GetGeneration() uint64
+
 	// AddKapiWatcher subscribes an event handler which gets called when there is a change in the ShootKapi objects on
 	// record in the InputDataSource.
 	// If shouldNotifyOfPreexisting is true, a KapiEventCreate event will be delivered to the watcher for each ShootKapi
 	// which is already in the InputDataSource at the time of the call. If false, the watcher will only be notified of
 	// future changes.
 	//
-	// IMPORTANT:
-	// If a goroutine exists which could hold a given lock while calling a method on a given InputDataSource instance,
-	// then it is illegal for any KapiWatcher registered on that instance to block, even indirectly, on that same lock.
-	// The KapiWatcher is still allowed to e.g. create a separate goroutine which blocks in the lock, as long as it
-	// doesn't block waiting on the goroutine.
+	// Concurrency: events are delivered asynchronously, one at a time, in the order of the respective changes, on a
+	// goroutine dedicated to the watcher. The watcher may block, and may call back into the InputDataSource. Meanwhile,
+	// subsequent events are buffered. Each event carries a snapshot of the Kapi, as of the time of the change.
+	//
+	// Watchers must not panic, and must process events promptly. A watcher which fails to do so gets its deliveries
+	// paused, with exponential backoff. If it keeps misbehaving, or hangs, it is unsubscribed automatically.
 	AddKapiWatcher(watcher *KapiWatcher, shouldNotifyOfPreexisting bool)
 
 	// RemoveKapiWatcher removes the event watcher, registered by a prior AddKapiWatcher call.
 	// The watcher pointer must have the same value as the one provided to said AddKapiWatcher() call.
-	// Returns false, if the specified watcher has never been added to the InputDataSource, or was already removed.
+	// Returns false, if the specified watcher has never been added to the InputDataSource, or was already removed,
+	// including automatic removal due to misbehavior.
+	// Once the function returns, no further events are delivered to the watcher, and none are in flight. Events still
+	// buffered for the watcher are discarded. Must not be called from the watcher itself.
 	RemoveKapiWatcher(watcher *KapiWatcher) bool
+
+	// AddSampleWatcher subscribes a handler which gets called with the namespace of a shoot, when new metrics samples
+	// are recorded for any of its Kapis. Unlike Kapi watchers, sample watchers are not notified of Kapis being added or
+	// removed. Samples which the InputDataSource discards, e.g. because they come too soon after the previous ones,
+	// may still result in a notification.
+	//
+	// Concurrency: notifications are delivered asynchronously, one at a time, on a goroutine dedicated to the watcher.
+	// While a shoot's notification is pending delivery, further updates to the shoot do not result in additional
+	// notifications, so a slow watcher sees each shoot at most once per delivery round. The watcher may block, and may
+	// call back into the InputDataSource.
+	AddSampleWatcher(watcher *SampleWatcher)
+
+	// RemoveSampleWatcher removes the handler, registered by a prior AddSampleWatcher call.
+	// The watcher pointer must have the same value as the one provided to said AddSampleWatcher() call.
+	// Returns false, if the specified watcher has never been added to the InputDataSource, or was already removed.
+	// Once the function returns, no further notifications are delivered to the watcher, and none are in flight. Must
+	// not be called from the watcher itself.
+	RemoveSampleWatcher(watcher *SampleWatcher) bool
 }
 
 // dataSourceAdapter adapts the InputDataRegistry type to the InputDataSource interface
 type dataSourceAdapter struct{ x *inputDataRegistry }
 
 func (a *dataSourceAdapter) GetShootKapis(shootNamespace string) []ShootKapi {
-	a.x.lock.Lock()
-	defer a.x.lock.Unlock()
-
-	shoot := a.x.shoots[shootNamespace]
-	if shoot == nil {
-		return nil
-	}
-
-	// Copy
-	var result = make([]ShootKapi, len(shoot.KapiData))
-	for i := range shoot.KapiData {
-		x := *shoot.KapiData[i]
-		result[i] = &kapiDataAdapter{&x}
-	}
-
-	return result
+	return a.x.getShootKapis(shootNamespace)
+}
+
+func (a *dataSourceAdapter) GetShootGeneration(shootNamespace string) uint64 {
+	return a.x.getShootGeneration(shootNamespace)
+}
+
+func (a *dataSourceAdapter) GetGeneration() uint64 {
+	return a.x.getGeneration()
 }
 
 func (a *dataSourceAdapter) AddKapiWatcher(watcher *KapiWatcher, shouldNotifyOfPreexisting bool) {
@@ -96,6 +192,14 @@ func (a *dataSourceAdapter) RemoveKapiWatcher(watcher *KapiWatcher) bool {
 	return a.x.RemoveKapiWatcher(watcher)
 }
 
+func (a *dataSourceAdapter) AddSampleWatcher(watcher *SampleWatcher) {
+	a.x.AddSampleWatcher(watcher)
+}
+
+func (a *dataSourceAdapter) RemoveSampleWatcher(watcher *SampleWatcher) bool {
+	return a.x.RemoveSampleWatcher(watcher)
+}
+
 //#endregion InputDataSource interface
 
 //#region Events
@@ -106,12 +210,19 @@ type KapiEventType int
 const (
 	KapiEventCreate KapiEventType = iota // KapiEventCreate indicates that a ShootKapi was added.
 	KapiEventDelete                      // KapiEventDelete indicates that the ShootKapi is about to be removed.
+	KapiEventUpdate                      // KapiEventUpdate indicates that the ShootKapi's scraping schedule changed.
 )
 
 // KapiWatcher is the type of event handlers subscribing to receive ShootKapi events from an InputDataSource.
-// The kapi parameter may point to the actual memory backing the InputDataSource. It is illegal to modify the
-// object or access it after the event handler has returned.
+// The kapi parameter is a snapshot, owned by the event handler, which reflects the Kapi as of the time of the event.
+// The Kapi on record in the InputDataSource may have changed since.
+// Each event handler is called on its own goroutine, one event at a time. See InputDataSource.AddKapiWatcher.
 // See also: KapiEventType.
 type KapiWatcher func(kapi ShootKapi, event KapiEventType)
 
+// SampleWatcher is the type of handlers subscribing to receive "samples updated" notifications from an
+// InputDataSource. The shootNamespace parameter identifies the shoot, for which new samples were recorded. The handler
+// is called on its own goroutine, one notification at a time. See InputDataSource.AddSampleWatcher.
+type SampleWatcher func(shootNamespace string)
+
 //#endregion Events
@@ -66,7 +66,7 @@ var _ = Describe("the input.input_data_registry.InputDataSource implementation",
 			ds.GetShootKapis(nsName)
 
 			// Assert
-			Expect(idr.shoots).To(BeEmpty())
+			Expect(idr.allShoots()).To(BeEmpty())
 		})
 		It("should return empty collection if the requested shoot is in the registry, but it has no Kapis", func() {
 			// Arrange
@@ -112,6 +112,7 @@ var _ = Describe("the input.input_data_registry.InputDataSource implementation",
 			Expect(kapis[0].ShootNamespace()).To(Equal(nsName))
 			Expect(kapis[0].PodUID()).To(Equal(podUid))
 			Expect(kapis[0].MetricsTimeNew()).NotTo(BeZero())
+			Expect(kapis[0].InflightRequestTime()).To(BeZero())
 		})
 		It("should return objects which capture the state of the Kapis at the time of the call, and are not affected by subsequent changes to the registry", func() {
 			// Arrange
@@ -127,5 +128,60 @@ var _ = Describe("the input.input_data_registry.InputDataSource implementation",
 			// Assert
 			Expect(kapis[0].TotalRequestCountNew()).To(Equal(int64(42)))
 		})
+		It("should return the same snapshot to repeated calls, as long as the shoot's Kapis do not change", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			ds := idr.DataSource()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			kapis1 := ds.GetShootKapis(nsName)
+
+			// Act
+			kapis2 := ds.GetShootKapis(nsName)
+			idr.SetKapiLastScrapeTime(nsName, podName, time.Now()) // Not visible through ShootKapi
+			kapis3 := ds.GetShootKapis(nsName)
+
+			// Assert
+			Expect(&kapis2[0]).To(BeIdenticalTo(&kapis1[0]))
+			Expect(&kapis3[0]).To(BeIdenticalTo(&kapis1[0]))
+		})
+		It("should take a new snapshot once the shoot's Kapis change", func() {
+			for _, change := range []func(idr *inputDataRegistry){
+				func(idr *inputDataRegistry) { idr.SetKapiMetrics(nsName, podName, 43) },
+				func(idr *inputDataRegistry) { idr.SetKapiInflightRequests(nsName, podName, 5) },
+				func(idr *inputDataRegistry) {
+					idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{TotalRequestCount: 43})
+				},
+				func(idr *inputDataRegistry) { idr.SetKapiData(nsName, podName+"2", podUid, nil, metricsURL) },
+				func(idr *inputDataRegistry) { idr.RemoveKapiData(nsName, podName) },
+			} {
+				// Arrange
+				idr := newInputDataRegistry()
+				ds := idr.DataSource()
+				idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+				idr.SetKapiMetrics(nsName, podName, 42)
+				before := ds.GetShootKapis(nsName)
+
+				// Act
+				change(idr)
+				after := ds.GetShootKapis(nsName)
+
+				// Assert
+				isSameSnapshot := len(after) > 0 && &after[0] == &before[0]
+				Expect(isSameSnapshot).To(BeFalse())
+			}
+		})
+		It("should stop returning the snapshot of a shoot which was removed from the registry", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			ds := idr.DataSource()
+			idr.SetShootAuthSecret(nsName, "dummy")
+			Expect(ds.GetShootKapis(nsName)).NotTo(BeNil())
+
+			// Act
+			idr.SetShootAuthSecret(nsName, "")
+
+			// Assert
+			Expect(ds.GetShootKapis(nsName)).To(BeNil())
+		})
 	})
 })
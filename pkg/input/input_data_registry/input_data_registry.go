@@ -7,8 +7,17 @@
 package input_data_registry
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -16,6 +25,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
 )
 
 //#region Registry element types
@@ -30,9 +40,69 @@ type KapiData struct {
 	MetricsTimeNew        time.Time         // The point in time to which TotalRequestCountNew refers. Zero when the metrics sample is unavailable.
 	TotalRequestCountOld  int64             // The previous value of TotalRequestCountNew. Enables rate-of-change calculations.
 	MetricsTimeOld        time.Time         // The point in time to which TotalRequestCountOld refers. Zero when the metrics sample is unavailable.
+	InflightRequestCount  int64             // Most recent value for the number of requests currently being served by the pod (mutating + read-only).
+	InflightRequestTime   time.Time         // The point in time to which InflightRequestCount refers. Zero when the metrics sample is unavailable.
+	CPUSecondsNew         float64           // Most recent value for the CPU time consumed by the kube-apiserver process, since it started.
+	CPUSampleTimeNew      time.Time         // The point in time to which CPUSecondsNew refers. Zero when the sample is unavailable.
+	CPUSecondsOld         float64           // The previous value of CPUSecondsNew. Enables CPU usage rate calculations.
+	CPUSampleTimeOld      time.Time         // The point in time to which CPUSecondsOld refers. Zero when the sample is unavailable.
+	ResidentMemoryBytes   int64             // Most recent value for the resident memory size of the kube-apiserver process.
+	MemorySampleTime      time.Time         // The point in time to which ResidentMemoryBytes refers. Zero when the sample is unavailable.
 	PodUID                types.UID
 	LastMetricsScrapeTime time.Time // The start time of the most recent metrics scrape for the Kapi.
 	FaultCount            int       // Number of consecutive failed attempt to obtain metrics for this pod. Reset to zero upon success.
+	// The category of the most recent of the failures counted by FaultCount. Empty when FaultCount is zero.
+	LastFaultCategory ScrapeErrorCategory
+	// If not zero, overrides the global scrape period for this Kapi
+	ScrapePeriod time.Duration
+	// Further URLs where metrics for the pod are scraped, when the pod exposes several metrics endpoints (e.g. an
+	// apiserver-proxy sidecar, alongside the kube-apiserver container). The request counters scraped from MetricsUrl and
+	// from all of these are summed. The other values are scraped from MetricsUrl alone. Replaced as a whole on change,
+	// so the slice can be shared by shallow copies.
+	ExtraMetricsUrls []string
+
+	// Most recent value for the total time spent by the pod serving requests, since the pod started. Together with
+	// RequestDurationCountNew, enables average request latency calculations.
+	RequestDurationSecondsNew float64
+	RequestDurationCountNew   int64     // Most recent value for the number of requests in RequestDurationSecondsNew.
+	RequestDurationTimeNew    time.Time // The point in time to which the ...New request duration values refer. Zero when the sample is unavailable.
+	RequestDurationSecondsOld float64   // The previous value of RequestDurationSecondsNew.
+	RequestDurationCountOld   int64     // The previous value of RequestDurationCountNew.
+	RequestDurationTimeOld    time.Time // The point in time to which the ...Old request duration values refer. Zero when the sample is unavailable.
+
+	// Most recent values for the number of Kapi requests to this pod which failed with a 4xx, and a 5xx status code,
+	// respectively, since the pod started. Part of the same sample as TotalRequestCountNew, so they refer to
+	// MetricsTimeNew.
+	ClientErrorCountNew int64
+	ServerErrorCountNew int64
+	ClientErrorCountOld int64 // The previous value of ClientErrorCountNew. Refers to MetricsTimeOld.
+	ServerErrorCountOld int64 // The previous value of ServerErrorCountNew. Refers to MetricsTimeOld.
+
+	// True if the scraper skips the Kapi, because its namespace is excluded by the namespace filter, or owned by
+	// another replica. Such Kapis do not count towards scrape coverage. See GetScrapeCoverage.
+	ScrapeExcluded bool
+
+	// The most recent request count samples, including the ones in TotalRequestCountNew and TotalRequestCountOld.
+	// Enables the detection of short bursts, which the rate between the two most recent samples does not reflect.
+	RequestCountHistory RequestCountHistory
+
+	// The durations of the most recent successful scrapes of the Kapi. Enables consumers to account for the latency
+	// with which the metrics reflect the Kapi's state.
+	ScrapeDurationHistory ScrapeDurationHistory
+
+	// The point in time when the kube-apiserver process started, as reported by the process itself. Zero when unknown.
+	// Enables a rough request rate estimate, while the Kapi has only one request count sample.
+	ProcessStartTime time.Time
+
+	// True if the pod's Ready condition is not true. The zero value means ready, so records which come from sources
+	// that do not track readiness, e.g. the Kapi simulator, count as ready.
+	NotReady bool
+}
+
+// NewKapiData creates an empty KapiData for the specified pod. Meant for code which maintains KapiData records outside
+// of the registry, e.g. fakes of the InputDataRegistry interface.
+func NewKapiData(shootNamespace string, podName string) *KapiData {
+	return &KapiData{shootNamespace: shootNamespace, podName: podName}
 }
 
 // ShootNamespace and PodName jointly identify the KapiData
@@ -45,6 +115,12 @@ func (kapi *KapiData) PodName() string {
 	return kapi.podName
 }
 
+// AsShootKapi returns a ShootKapi view of the KapiData. The view does not copy the data, so it reflects later changes
+// to the KapiData.
+func (kapi *KapiData) AsShootKapi() ShootKapi {
+	return &kapiDataAdapter{x: kapi}
+}
+
 // Copy returns a deep copy.
 func (kapi *KapiData) Copy() *KapiData {
 	if kapi == nil {
@@ -60,9 +136,41 @@ func (kapi *KapiData) Copy() *KapiData {
 		MetricsTimeNew:        kapi.MetricsTimeNew,
 		TotalRequestCountOld:  kapi.TotalRequestCountOld,
 		MetricsTimeOld:        kapi.MetricsTimeOld,
+		InflightRequestCount:  kapi.InflightRequestCount,
+		InflightRequestTime:   kapi.InflightRequestTime,
+		CPUSecondsNew:         kapi.CPUSecondsNew,
+		CPUSampleTimeNew:      kapi.CPUSampleTimeNew,
+		CPUSecondsOld:         kapi.CPUSecondsOld,
+		CPUSampleTimeOld:      kapi.CPUSampleTimeOld,
+		ResidentMemoryBytes:   kapi.ResidentMemoryBytes,
+		MemorySampleTime:      kapi.MemorySampleTime,
 		PodUID:                kapi.PodUID,
 		LastMetricsScrapeTime: kapi.LastMetricsScrapeTime,
 		FaultCount:            kapi.FaultCount,
+		LastFaultCategory:     kapi.LastFaultCategory,
+		ScrapePeriod:          kapi.ScrapePeriod,
+		ExtraMetricsUrls:      slices.Clone(kapi.ExtraMetricsUrls),
+
+		RequestDurationSecondsNew: kapi.RequestDurationSecondsNew,
+		RequestDurationCountNew:   kapi.RequestDurationCountNew,
+		RequestDurationTimeNew:    kapi.RequestDurationTimeNew,
+		RequestDurationSecondsOld: kapi.RequestDurationSecondsOld,
+		RequestDurationCountOld:   kapi.RequestDurationCountOld,
+		RequestDurationTimeOld:    kapi.RequestDurationTimeOld,
+
+		ClientErrorCountNew: kapi.ClientErrorCountNew,
+		ServerErrorCountNew: kapi.ServerErrorCountNew,
+		ClientErrorCountOld: kapi.ClientErrorCountOld,
+		ServerErrorCountOld: kapi.ServerErrorCountOld,
+
+		RequestCountHistory:   kapi.RequestCountHistory,
+		ScrapeDurationHistory: kapi.ScrapeDurationHistory,
+
+		ScrapeExcluded: kapi.ScrapeExcluded,
+
+		ProcessStartTime: kapi.ProcessStartTime,
+
+		NotReady: kapi.NotReady,
 	}
 
 	for k, v := range kapi.PodLabels {
@@ -72,22 +180,173 @@ func (kapi *KapiData) Copy() *KapiData {
 	return result
 }
 
-// shootData holds all registry information for a single shoot
+// shootData holds all registry information for a single shoot. See shootStore.
 type shootData struct {
 	shootNamespace string // Serves as ID. Immutable.
 	AuthSecret     string // Authentication secret for the shoot Kapi. A missing authSecret is represented by an empty string.
+	// If not empty, the auth secret is known to be unusable, e.g. because it expired, and this is the reason why.
+	// Reset whenever the auth secret changes. See SetShootAuthDegraded.
+	AuthDegradedReason string
 
 	// CertPool containing the shoot Kapi CA certificate. Nil if there is no CA certificate on record for the shoot.
+	// Replaced only when the certificate content changes, so the same content always yields the same CertPool object.
 	CACertPool *x509.CertPool
+	// The PEM data from which CACertPool was built. Nil if there is no CA certificate on record for the shoot.
+	caCertificate []byte
+	// Hex encoded SHA-256 hash of caCertificate. Empty if there is no CA certificate on record for the shoot.
+	CACertHash string
+
+	// If not nil, replaces the registry's default scrape settings for the shoot. See SetShootScrapeSettings.
+	ScrapeSettings *ShootScrapeSettings
+	// If not nil, alters the scrape requests sent to the shoot's Kapis. See SetShootScrapeRequestSettings.
+	RequestSettings *ShootScrapeRequestSettings
 
 	KapiData []*KapiData // Information about individual Kapi pods
 }
 
+// Values of ShootScrapeSettings.Scheme
+const (
+	ScrapeSchemeHTTPS = "https"
+	ScrapeSchemeHTTP  = "http"
+)
+
+// Values of ShootScrapeSettings.Transport
+const (
+	// ScrapeTransportDirect connects directly to the Kapi pods
+	ScrapeTransportDirect = "direct"
+	// ScrapeTransportPortForward reaches the Kapi pods through the seed kube-apiserver's pods/portforward subresource,
+	// for seeds where the pods cannot be reached directly
+	ScrapeTransportPortForward = "port-forward"
+)
+
+// ScrapeErrorCategory classifies the cause of a failed metrics scrape. See KapiData.LastFaultCategory.
+type ScrapeErrorCategory string
+
+// Values of ScrapeErrorCategory
+const (
+	// ScrapeErrorNetwork means the Kapi could not be reached, or the connection to it failed
+	ScrapeErrorNetwork ScrapeErrorCategory = "network"
+	// ScrapeErrorTLS means the TLS handshake with the Kapi failed, e.g. because its certificate is not trusted
+	ScrapeErrorTLS ScrapeErrorCategory = "tls"
+	// ScrapeErrorAuth means the Kapi rejected the scrape request as unauthenticated or unauthorized
+	ScrapeErrorAuth ScrapeErrorCategory = "auth"
+	// ScrapeErrorParse means the Kapi responded, but the response could not be processed
+	ScrapeErrorParse ScrapeErrorCategory = "parse"
+	// ScrapeErrorTimeout means the scrape did not complete within the scrape timeout
+	ScrapeErrorTimeout ScrapeErrorCategory = "timeout"
+	// ScrapeErrorOther is any failure which does not fall in one of the other categories, e.g. an unexpected HTTP status
+	ScrapeErrorOther ScrapeErrorCategory = "other"
+)
+
+// Values of ShootScrapeSettings.TLSServerName, other than specific server names
+const (
+	// DefaultTLSServerName is the server name which Kapis present in their serving certificates, in a standard setup
+	DefaultTLSServerName = "kube-apiserver"
+	// TLSServerNameAny accepts a Kapi serving certificate which carries any server name, as long as the certificate is
+	// signed by the shoot CA. Meant as fallback, for Kapis whose certificates do not carry a predictable server name.
+	TLSServerNameAny = "*"
+)
+
+// ShootScrapeSettings holds the settings which control how the Kapis of a shoot are scraped
+type ShootScrapeSettings struct {
+	// The URL scheme used to scrape the Kapis. One of ScrapeSchemeHTTPS, ScrapeSchemeHTTP. Empty means https. Plain
+	// http is meant for test environments, where e.g. a sidecar terminates mTLS in front of the kube-apiserver.
+	Scheme string
+	// Do not verify the Kapis' serving certificates. Meant for development clusters only.
+	InsecureSkipTLSVerify bool
+	// How the Kapis are reached. One of ScrapeTransportDirect, ScrapeTransportPortForward. Empty means direct.
+	Transport string
+	// The server name which the Kapis are expected to present in their serving certificates, or TLSServerNameAny.
+	// Empty means DefaultTLSServerName.
+	TLSServerName string
+}
+
+// ShootScrapeRequestSettings holds shoot specific additions to the requests which scrape the shoot's Kapis, e.g. for
+// Kapi metrics endpoints fronted by an authenticating proxy
+type ShootScrapeRequestSettings struct {
+	// Extra HTTP headers sent with each scrape request. They do not replace the headers which the scraper itself sets,
+	// such as Authorization.
+	Headers http.Header
+	// If not nil, the scrape requests go through the HTTP CONNECT or SOCKS5 proxy at this URL, instead of the globally
+	// configured one. Does not apply to the port-forward transport.
+	ProxyURL *url.URL
+}
+
 // ShootNamespace serves as identifier for the shoot. Immutable.
 func (shoot *shootData) ShootNamespace() string {
 	return shoot.shootNamespace
 }
 
+// ScrapeContext holds the registry information necessary to scrape metrics from a single kube-apiserver pod
+type ScrapeContext struct {
+	PodUID       types.UID      // The UID of the pod
+	MetricsUrl   string         // The URL where metrics for the pod can be scraped
+	ScrapePeriod time.Duration  // If not zero, overrides the global scrape period for the pod
+	AuthSecret   string         // Authentication secret for the shoot Kapi. Empty if there is none on record.
+	CACertPool   *x509.CertPool // CertPool containing the shoot Kapi CA certificate. Nil if there is none on record.
+	// Further URLs where metrics for the pod are scraped. See KapiData.ExtraMetricsUrls. Callers should not modify it.
+	ExtraMetricsUrls []string
+	// Hash of the shoot Kapi CA certificate content. Changes if, and only if, the content changes, so it can serve as
+	// cache key for objects derived from CACertPool. Empty if there is no CA certificate on record.
+	CACertHash string
+	// The settings which apply to scraping the shoot's Kapis: the shoot's own, if it has any, or the default ones
+	ScrapeSettings ShootScrapeSettings
+	// If not empty, AuthSecret is known to be unusable, and this is the reason why. See shootData.AuthDegradedReason.
+	AuthDegradedReason string
+	// The shoot's additions to the scrape requests. Nil if the shoot has none. Callers should not modify it.
+	RequestSettings *ShootScrapeRequestSettings
+}
+
+// KapiScrapeResult holds the metrics values obtained by a successful scrape of a single kube-apiserver pod
+type KapiScrapeResult struct {
+	TotalRequestCount    int64 // The number of Kapi requests to the pod, since the pod started
+	ClientErrorCount     int64 // The number of requests in TotalRequestCount which failed with a 4xx status code
+	ServerErrorCount     int64 // The number of requests in TotalRequestCount which failed with a 5xx status code
+	InflightRequestCount int64 // The number of requests currently being served by the pod. See HasInflightRequestCount.
+	// Whether InflightRequestCount is valid. If false, the inflight request count on record is left unchanged.
+	HasInflightRequestCount bool
+	CPUSeconds              float64 // The CPU time consumed by the kube-apiserver process, since it started
+	// Whether CPUSeconds is valid. If false, the CPU sample on record is left unchanged.
+	HasCPUSeconds       bool
+	ResidentMemoryBytes int64 // The resident memory size of the kube-apiserver process
+	// Whether ResidentMemoryBytes is valid. If false, the memory sample on record is left unchanged.
+	HasResidentMemoryBytes bool
+	RequestDurationSeconds float64 // The total time spent by the pod serving requests, since the pod started
+	RequestDurationCount   int64   // The number of requests in RequestDurationSeconds
+	// Whether RequestDurationSeconds and RequestDurationCount are valid. If false, the request duration sample on
+	// record is left unchanged.
+	HasRequestDuration bool
+	// The point in time when the kube-apiserver process started. Zero means unknown, in which case the start time on
+	// record is left unchanged.
+	ProcessStartTime time.Time
+	// How long the scrape took. Zero means unknown, in which case no duration is recorded.
+	ScrapeDuration time.Duration
+}
+
+// ScrapeCoverage describes how many of a set of Kapis produced a fresh metrics sample. A sample is fresh if it is no
+// older than the Kapi's scrape period, plus an allowance for scrape duration and scheduling delays. See
+// freshSampleMaxAge.
+type ScrapeCoverage struct {
+	KapiCount      int // The number of Kapis which are to be scraped
+	FreshKapiCount int // How many of the KapiCount Kapis have a fresh sample
+}
+
+// Ratio returns the fraction of Kapis which have a fresh sample. A set without Kapis is fully covered.
+func (c ScrapeCoverage) Ratio() float64 {
+	if c.KapiCount == 0 {
+		return 1
+	}
+	return float64(c.FreshKapiCount) / float64(c.KapiCount)
+}
+
+// Add returns the combined coverage of the two sets of Kapis
+func (c ScrapeCoverage) Add(other ScrapeCoverage) ScrapeCoverage {
+	return ScrapeCoverage{
+		KapiCount:      c.KapiCount + other.KapiCount,
+		FreshKapiCount: c.FreshKapiCount + other.FreshKapiCount,
+	}
+}
+
 //#endregion Registry element types
 
 // InputDataRegistry abstracts the inputDataRegistry type, so it can be replaced for testing isolation purposes.
@@ -101,87 +360,277 @@ type InputDataRegistry interface {
 	// specified pod, nil is returned.
 	GetKapiData(shootNamespace string, podName string) *KapiData
 	// SetKapiData stores registry data specific to the k8s Kapi pod object identified by shootNamespace and podName.
+	// If the metrics URL changes, the Kapi's fault count is reset.
 	SetKapiData(
 		shootNamespace string, podName string, podUID types.UID, podLabels map[string]string, metricsUrl string)
 	// RemoveKapiData deletes all registry data specific to the Kapi pod identified by shootNamespace and podName.
 	// The output value is false if the registry did not contain data for the identified pod.
 	RemoveKapiData(shootNamespace string, podName string) bool
+	// RemoveShootData deletes all registry data specific to the shoot identified by shootNamespace: the data of all of
+	// its Kapi pods, its auth secret, CA certificate and scrape settings. Watchers are notified of the deletion of each
+	// Kapi. The output value is false if the registry did not contain data for the shoot.
+	RemoveShootData(shootNamespace string) bool
+	// GetShootNamespaces returns the namespaces of all shoots for which the registry contains data, in no particular
+	// order.
+	GetShootNamespaces() []string
+	// GetFaultyKapiData returns the KapiData objects for all Kapi pods, across all shoots, which have at least
+	// minFaultCount consecutive failed metrics scrapes on record.
+	// The output is a deep copy, and fully detached from the registry.
+	GetFaultyKapiData(minFaultCount int) []*KapiData
+	// GetKapiDataByMetricsUrl returns the KapiData objects for all Kapi pods, across all shoots, which are scraped at the
+	// specified URL, either as their MetricsUrl, or as one of their ExtraMetricsUrls. The Kapis are looked up in an
+	// index, so it is cheap enough to call upon each reconciliation.
+	// The output is a deep copy, and fully detached from the registry.
+	GetKapiDataByMetricsUrl(metricsUrl string) []*KapiData
 	// SetKapiMetrics records the current metrics value for the Kapi pod identified by shootNamespace and podName.
 	// If the registry does not contain a record for the specified pod, the operation has no effect.
 	SetKapiMetrics(shootNamespace string, podName string, currentTotalRequestCount int64)
+	// SetKapiInflightRequests records the current number of inflight requests for the Kapi pod identified by
+	// shootNamespace and podName. Unlike the total request count, this is an instantaneous value, so each call simply
+	// replaces the previous one.
+	// If the registry does not contain a record for the specified pod, the operation has no effect.
+	SetKapiInflightRequests(shootNamespace string, podName string, currentInflightRequestCount int64)
 	// SetKapiLastScrapeTime records the start time of the last scrape for the Kapi pod identified by shootNamespace and podName.
 	// If the registry does not contain a record for the specified pod, the operation has no effect.
 	SetKapiLastScrapeTime(shootNamespace string, podName string, value time.Time)
+	// SetKapiScrapePeriod records the scrape period override for the Kapi pod identified by shootNamespace and podName.
+	// Zero means that the global scrape period applies. If the value changes, a KapiEventUpdate is delivered to watchers.
+	// If the registry does not contain a record for the specified pod, the operation has no effect.
+	SetKapiScrapePeriod(shootNamespace string, podName string, scrapePeriod time.Duration)
+	// SetKapiExtraMetricsUrls records the further URLs where metrics for the Kapi pod identified by shootNamespace and
+	// podName are scraped. See KapiData.ExtraMetricsUrls. If the value changes, the Kapi's fault count is reset, and so
+	// are its request count, CPU and request duration samples, because the sums scraped before the change are not
+	// comparable with the ones scraped after it.
+	// If the registry does not contain a record for the specified pod, the operation has no effect.
+	SetKapiExtraMetricsUrls(shootNamespace string, podName string, metricsUrls []string)
+	// SetDefaultScrapePeriod records the global scrape period, which applies to Kapis without a scrape period override.
+	// The minimum sample gap applied to a Kapi is limited by its scrape period. See EffectiveMinSampleGap.
+	SetDefaultScrapePeriod(scrapePeriod time.Duration)
+	// GetScrapeContext returns the information necessary to scrape the Kapi pod identified by shootNamespace and podName,
+	// in a single registry operation. If the registry has no information about the specified pod, nil is returned.
+	// Callers should not modify the returned CertPool.
+	GetScrapeContext(shootNamespace string, podName string) *ScrapeContext
+	// SetKapiScrapeResult records the metrics values obtained by a successful scrape of the Kapi pod identified by
+	// shootNamespace and podName, in a single registry operation. It has the same effect as SetKapiMetrics, followed by
+	// SetKapiInflightRequests, if the result has an inflight request count.
+	// If the registry does not contain a record for the specified pod, the operation has no effect.
+	SetKapiScrapeResult(shootNamespace string, podName string, result KapiScrapeResult)
 	// NotifyKapiMetricsFault is the counterpart of SetKapiMetrics which is used when a metrics scrape fails. Instead of
 	// recording the newly obtained metrics values, it records the fact that values could not be obtained.
 	// If the registry does not contain a record for the specified pod, the operation has no effect.
 	//
 	// The function returns the number of consecutive faults on record, including the one reflected by this call.
 	// Returns -1 if the registry currently does not maintain a record for the specified pod.
-	NotifyKapiMetricsFault(shootNamespace string, podName string) int
+	// The category of the fault is recorded as KapiData.LastFaultCategory.
+	NotifyKapiMetricsFault(shootNamespace string, podName string, category ScrapeErrorCategory) int
+	// SetKapiScrapeExcluded records whether the scraper skips the Kapi pod identified by shootNamespace and podName.
+	// See KapiData.ScrapeExcluded.
+	// If the registry does not contain a record for the specified pod, the operation has no effect.
+	SetKapiScrapeExcluded(shootNamespace string, podName string, isExcluded bool)
+	// SetKapiReady records whether the Kapi pod identified by shootNamespace and podName is ready. See
+	// KapiData.NotReady.
+	// If the registry does not contain a record for the specified pod, the operation has no effect.
+	SetKapiReady(shootNamespace string, podName string, isReady bool)
+	// ImportKapiData replaces the record of the Kapi pod identified by kapi.ShootNamespace and kapi.PodName with a copy
+	// of kapi, creating the record if it does not exist. Used to take over data recorded by another replica. The fault
+	// count and category on record are retained, as they pertain to the scraping done by this process.
+	ImportKapiData(kapi *KapiData)
+	// GetScrapeCoverage returns the scrape coverage of each shoot, as a map of <shoot namespace> -> <coverage>. Kapis
+	// which the scraper skips are not counted, and shoots which only have such Kapis are omitted.
+	GetScrapeCoverage() map[string]ScrapeCoverage
 	// GetShootAuthSecret retrieves the authentication secret used to access Kapi metrics on the shoot identified by shootNamespace.
 	// Returns empty string if there is no auth secret on record for that shoot.
 	GetShootAuthSecret(shootNamespace string) string
 	// SetShootAuthSecret records the specified authentication secret for the shoot identified by ShootNamespace, so it can
 	// later be retrieved via GetShootAuthSecret(). Passing authSecret="" deletes the record, if one exists.
 	SetShootAuthSecret(shootNamespace string, authSecret string)
+	// SetShootAuthDegraded marks the auth secret of the shoot identified by shootNamespace as unusable, e.g. because it
+	// expired, for the specified reason. An empty reason clears the mark. The mark is also cleared whenever the auth
+	// secret changes. If the registry has no auth secret on record for the shoot, the operation has no effect.
+	SetShootAuthDegraded(shootNamespace string, reason string)
 	// GetShootCACertificate retrieves the Kapi CA certificate registered for the shoot identified by shootNamespace.
 	// Returns nil if a CA cert is not registered for the shoot. The result is in the form of a CertPool, containing
 	// only the shoot's CA certificate. Callers should not modify the returned object.
 	GetShootCACertificate(shootNamespace string) *x509.CertPool
 	// SetShootCACertificate records the specified certificate as the CA certificate for the Kapi of the shoot identified by
 	// shootNamespace, so it can later be retrieved via GetShootCACertificate(). Passing certificate=nil deletes the record,
-	// if one exists.
+	// if one exists. If the certificate content is the same as the one on record, the operation has no effect, and
+	// GetShootCACertificate() keeps returning the same CertPool object.
 	SetShootCACertificate(shootNamespace string, certificate []byte)
+	// SetShootScrapeSettings records scrape settings specific to the shoot identified by shootNamespace. They replace
+	// the default ones as a whole. Passing settings=nil deletes the record, if one exists, so the default settings
+	// apply. See GetScrapeContext.
+	SetShootScrapeSettings(shootNamespace string, settings *ShootScrapeSettings)
+	// SetShootScrapeRequestSettings records additions to the scrape requests sent to the Kapis of the shoot identified by
+	// shootNamespace. Passing settings=nil deletes the record, if one exists. See ScrapeContext.RequestSettings.
+	SetShootScrapeRequestSettings(shootNamespace string, settings *ShootScrapeRequestSettings)
+	// SetDefaultShootScrapeSettings records the scrape settings which apply to shoots without settings of their own
+	SetDefaultShootScrapeSettings(settings ShootScrapeSettings)
 	// AddKapiWatcher subscribes an event handler which gets called when there is a change in the ShootKapi objects on
 	// record in the registry.
 	// If shouldNotifyOfPreexisting is true, a KapiEventCreate event will be delivered to the watcher for each ShootKapi
 	// which is already in the registry at the time of the call. If false, the watcher will only be notified of subsequent
 	// changes.
 	//
-	// IMPORTANT:
-	// If a goroutine exists which could hold a given lock while calling a method on a given InputDataRegistry instance,
-	// then it is illegal for any KapiWatcher registered on that instance to block, even indirectly, on that same lock.
-	// The KapiWatcher is still allowed to e.g. create a separate goroutine which blocks in the lock, as long as it doesn't
-	// block waiting on the goroutine.
+	// Concurrency: events are delivered asynchronously, one at a time, in the order of the respective changes, on a
+	// goroutine dedicated to the watcher. The watcher may block, and may call back into the registry. Meanwhile,
+	// subsequent events are buffered. Each event carries a snapshot of the Kapi, as of the time of the change.
+	//
+	// A watcher which panics, or takes too long to process events, gets its deliveries paused, with exponential
+	// backoff. If it keeps misbehaving, or hangs, it is unsubscribed automatically. See kapiWatcherPolicy.
 	AddKapiWatcher(watcher *KapiWatcher, shouldNotifyOfPreexisting bool)
 	// RemoveKapiWatcher removes the event watcher, registered by a prior AddKapiWatcher call.
 	// The watcher pointer must have the same value as the one provided to said AddKapiWatcher() call.
-	// Returns false, if the specified watcher has never been added to the registry, or was already removed.
+	// Returns false, if the specified watcher has never been added to the registry, or was already removed, including
+	// automatic removal due to misbehavior.
+	// Once the function returns, no further events are delivered to the watcher, and none are in flight. Events still
+	// buffered for the watcher are discarded. Must not be called from the watcher itself.
 	RemoveKapiWatcher(watcher *KapiWatcher) bool
+	// SetKapiWatcherCondition directs the registry to report each Kapi watcher which it unsubscribes automatically,
+	// because the watcher misbehaved, as an error of the specified condition. The component fed by the watcher, e.g.
+	// the scraper, stops working once the watcher is unsubscribed, so nothing resets the condition. A nil condition
+	// stops the reporting.
+	SetKapiWatcherCondition(condition *conditions.ComponentReporter)
+	// AddSampleWatcher subscribes a handler which gets called when new metrics samples are recorded for a shoot. See
+	// InputDataSource.AddSampleWatcher.
+	AddSampleWatcher(watcher *SampleWatcher)
+	// RemoveSampleWatcher removes the handler, registered by a prior AddSampleWatcher call. See
+	// InputDataSource.RemoveSampleWatcher.
+	RemoveSampleWatcher(watcher *SampleWatcher) bool
+}
+
+// The number of independently locked partitions of the registry. Each shoot belongs to exactly one shard.
+const registryShardCount = 64
+
+// registryShard holds the data of the subset of shoots whose namespace hashes to the shard
+type registryShard struct {
+	// Synchronizes access to the store field. Also see inputDataRegistry.kapiWatchers and sampleWatchers.
+	lock sync.Mutex
+	// Holds the shootData objects of the shard's shoots
+	store shootStore
+	// Maps <shoot namespace> -> <[]ShootKapi>, an immutable snapshot of the shoot's Kapis, as returned by
+	// InputDataSource.GetShootKapis. Enables lock-free reads. A missing entry means that there is no up-to-date
+	// snapshot. Entries are only added and removed while holding the lock. See invalidateSnapshotThreadUnsafe.
+	snapshots sync.Map
+	// Maps <shoot namespace> -> <uint64>, the shoot's generation, as returned by InputDataSource.GetShootGeneration.
+	// Enables lock-free reads. Entries are only stored while holding the lock. See invalidateSnapshotThreadUnsafe.
+	generations sync.Map
+	// Points to inputDataRegistry.generation
+	registryGeneration *atomic.Uint64
 }
 
 // InputDataRegistry holds data based on kube-apiserver application metrics and information necessary to scrape such
 // metrics. The scope of one instance is multiple shoots on the same seed. All public operations are concurrency-safe.
+//
+// The data is partitioned by shoot namespace into shards, each protected by its own lock, so operations on different
+// shoots do not contend with each other. Operations which span all shoots lock the shards one at a time. Each shard
+// keeps its data in a shootStore.
 type inputDataRegistry struct {
-	// See MinSampleGap in input.CLIConfig
+	// See MinSampleGap in input.CLIConfig. The value actually applied to a Kapi is limited by its scrape period. See
+	// minSampleGapFor().
 	minSampleGap time.Duration
-	// Maps <shoot namespace> -> <shootData object>. Values cannot be null.
-	shoots map[string]*shootData
-
-	// Synchronizes access to all fields of the type.
-	lock sync.Mutex
-
-	// Records all subscribers who expressed interest in Kapi change notifications.
+	// The global scrape period, in nanoseconds. Zero if unknown. See SetDefaultScrapePeriod().
+	defaultScrapePeriod atomic.Int64
+	// The scrape settings which apply to shoots without settings of their own. Never nil.
+	defaultScrapeSettings atomic.Pointer[ShootScrapeSettings]
+	// The shoot data, partitioned by shoot namespace. See getShard().
+	shards [registryShardCount]registryShard
+	// Incremented upon each change visible through InputDataSource. The shoot generations are drawn from it, so a
+	// generation value is never reused, not even by a different shoot.
+	generation atomic.Uint64
+	// Maps the metrics URLs to the Kapis scraped at them. See GetKapiDataByMetricsUrl.
+	metricsUrls metricsUrlIndex
+
+	// Records all subscribers who expressed interest in Kapi change notifications, each with its own delivery queue.
 	// Note that closures cannot be compared for equality but pointers to closure can, so subscriber closures are
 	// represented by a pointer. Client code is responsible for sending the exact same pointer back, when requesting
 	// that a subscription be terminated.
-	kapiWatchers []*KapiWatcher
-	log          logr.Logger
+	// Reading requires holding the lock of any one shard. Writing requires holding the locks of all shards.
+	kapiWatchers []*kapiWatcherQueue
+	// Records all subscribers who expressed interest in "samples updated" notifications. Same rules as kapiWatchers.
+	sampleWatchers []*sampleWatcherQueue
+	log            logr.Logger
+	// Determines how the Kapi watcher queues respond to misbehaving watchers
+	kapiWatcherPolicy kapiWatcherPolicy
+	// Receives the Kapi watchers unsubscribed due to misbehavior. See SetKapiWatcherCondition.
+	kapiWatcherCondition atomic.Pointer[conditions.ComponentReporter]
 
 	testIsolation inputDataRegistryTestIsolation // Provides indirections necessary to isolate the unit during tests
 }
 
-// NewInputDataRegistry creates a new InputDataRegistry object
+// NewInputDataRegistry creates a new InputDataRegistry object, which keeps its data in process memory
 func NewInputDataRegistry(minSampleGap time.Duration, log logr.Logger) InputDataRegistry {
-	return &inputDataRegistry{
-		minSampleGap: minSampleGap,
-		shoots:       make(map[string]*shootData),
-		log:          log,
+	return newInputDataRegistryWithStore(minSampleGap, newMemoryShootStoreFactory, log)
+}
+
+// newInputDataRegistryWithStore creates a new InputDataRegistry object, which keeps the data of each shard in a store
+// created by the specified factory. The stores must initially be empty.
+func newInputDataRegistryWithStore(
+	minSampleGap time.Duration, storeFactory shootStoreFactory, log logr.Logger) InputDataRegistry {
+
+	reg := &inputDataRegistry{
+		minSampleGap:      minSampleGap,
+		log:               log,
+		kapiWatcherPolicy: defaultKapiWatcherPolicy,
 		testIsolation: inputDataRegistryTestIsolation{
 			TimeNow: time.Now,
 		},
 	}
+	for i := range reg.shards {
+		reg.shards[i].store = storeFactory(i)
+		reg.shards[i].registryGeneration = &reg.generation
+	}
+	reg.defaultScrapeSettings.Store(&ShootScrapeSettings{})
+
+	return reg
+}
+
+// EffectiveMinSampleGap returns the minimum sample gap which applies to a Kapi scraped with the specified period: the
+// configured gap, but no more than a third of the scrape period. Otherwise, if the scrape period were lowered below the
+// configured gap, every sample would be rejected as too close to the previous one. A scrape period of zero means that
+// the period is unknown, and the configured gap applies as is.
+func EffectiveMinSampleGap(configuredMinSampleGap time.Duration, scrapePeriod time.Duration) time.Duration {
+	if scrapePeriod <= 0 {
+		return configuredMinSampleGap
+	}
+	return min(configuredMinSampleGap, scrapePeriod/3)
+}
+
+// SetDefaultScrapePeriod records the global scrape period, which applies to Kapis without a scrape period override.
+// The minimum sample gap applied to a Kapi is limited by its scrape period. See EffectiveMinSampleGap.
+func (reg *inputDataRegistry) SetDefaultScrapePeriod(scrapePeriod time.Duration) {
+	reg.defaultScrapePeriod.Store(int64(scrapePeriod))
+}
+
+// minSampleGapFor returns the minimum sample gap which applies to the specified Kapi, based on its scrape period.
+// Caller must hold the lock of the shard which contains the Kapi.
+func (reg *inputDataRegistry) minSampleGapFor(kapi *KapiData) time.Duration {
+	scrapePeriod := kapi.ScrapePeriod
+	if scrapePeriod == 0 {
+		scrapePeriod = time.Duration(reg.defaultScrapePeriod.Load())
+	}
+	return EffectiveMinSampleGap(reg.minSampleGap, scrapePeriod)
+}
+
+// getShard returns the shard which holds the data for the specified shoot
+func (reg *inputDataRegistry) getShard(shootNamespace string) *registryShard {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(shootNamespace))
+	return &reg.shards[hash.Sum32()%registryShardCount]
+}
+
+// lockAllShards acquires the locks of all shards. To avoid deadlocks, the locks are always acquired in the same order.
+func (reg *inputDataRegistry) lockAllShards() {
+	for i := range reg.shards {
+		reg.shards[i].lock.Lock()
+	}
+}
+
+// unlockAllShards releases the locks acquired by lockAllShards
+func (reg *inputDataRegistry) unlockAllShards() {
+	for i := range reg.shards {
+		reg.shards[i].lock.Unlock()
+	}
 }
 
 // DataSource returns an InputDataSource interface to the registry, which is focused on metrics consumption, and
@@ -194,8 +643,8 @@ func (reg *inputDataRegistry) DataSource() InputDataSource {
 // Individual pod operations
 
 // getKapiDataThreadUnsafe returns a reference (not copy) to the respective KapiData in the registry, or nil
-func (reg *inputDataRegistry) getKapiDataThreadUnsafe(shootNamespace string, podName string) *KapiData {
-	shoot := reg.shoots[shootNamespace]
+func (shard *registryShard) getKapiDataThreadUnsafe(shootNamespace string, podName string) *KapiData {
+	shoot := shard.store.Get(shootNamespace)
 	if shoot == nil {
 		return nil
 	}
@@ -213,29 +662,35 @@ func (reg *inputDataRegistry) getKapiDataThreadUnsafe(shootNamespace string, pod
 // The output is a deep copy, and fully detached from the registry. If the registry has no information about the
 // specified pod, nil is returned.
 func (reg *inputDataRegistry) GetKapiData(shootNamespace string, podName string) *KapiData {
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
 
-	pkapi := reg.getKapiDataThreadUnsafe(shootNamespace, podName)
+	pkapi := shard.getKapiDataThreadUnsafe(shootNamespace, podName)
 
-	if pkapi == nil {
-		return nil
-	}
-	result := *pkapi
-	return &result
+	return pkapi.Copy()
 }
 
 // SetKapiData stores registry data specific to the k8s Kapi pod object identified by shootNamespace and podName.
+// If the metrics URL changes, the Kapi's fault count is reset.
 func (reg *inputDataRegistry) SetKapiData(
 	shootNamespace string, podName string, podUID types.UID, podLabels map[string]string, metricsUrl string) {
 
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
 
-	kapi, isCreate := reg.getOrCreateKapiDataThreadUnsafe(shootNamespace, podName)
+	kapi, isCreate := shard.getOrCreateKapiDataThreadUnsafe(shootNamespace, podName)
+	shard.invalidateSnapshotThreadUnsafe(shootNamespace)
 	kapi.PodUID = podUID
-	kapi.MetricsUrl = metricsUrl
+	if kapi.MetricsUrl != metricsUrl {
+		kapi.FaultCount, kapi.LastFaultCategory = 0, "" // Faults on record pertain to the old URL
+		oldUrls := kapi.metricsUrls()
+		kapi.MetricsUrl = metricsUrl
+		reg.metricsUrls.update(kapi.indexKey(), oldUrls, kapi.metricsUrls())
+	}
 	kapi.PodLabels = podLabels
+	shard.putShootThreadUnsafe(shootNamespace)
 	if isCreate {
 		reg.notifyKapiWatchersThreadUnsafe(kapi, KapiEventCreate)
 	}
@@ -244,10 +699,11 @@ func (reg *inputDataRegistry) SetKapiData(
 // RemoveKapiData deletes all registry data specific to the Kapi pod identified by shootNamespace and podName.
 // The output value is false if the registry did not contain data for the identified pod.
 func (reg *inputDataRegistry) RemoveKapiData(shootNamespace string, podName string) bool {
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
 
-	shoot := reg.shoots[shootNamespace]
+	shoot := shard.store.Get(shootNamespace)
 	if shoot == nil {
 		return false
 	}
@@ -258,65 +714,366 @@ func (reg *inputDataRegistry) RemoveKapiData(shootNamespace string, podName stri
 	}
 
 	// Raise event just before deleting
-	reg.notifyKapiWatchersThreadUnsafe(shoot.KapiData[kapiIndex], KapiEventDelete)
+	kapi := shoot.KapiData[kapiIndex]
+	reg.notifyKapiWatchersThreadUnsafe(kapi, KapiEventDelete)
+	shard.invalidateSnapshotThreadUnsafe(shootNamespace)
+	reg.metricsUrls.update(kapi.indexKey(), kapi.metricsUrls(), nil)
 
 	// Are we removing the last piece of information?
 	if len(shoot.KapiData) == 1 {
-		if shoot.AuthSecret == "" && shoot.CACertPool == nil {
+		if shoot.AuthSecret == "" && shoot.CACertPool == nil && shoot.ScrapeSettings == nil &&
+			shoot.RequestSettings == nil {
 			// No more data in the KapiData object, just remove from registry
-			delete(reg.shoots, shootNamespace)
+			shard.store.Delete(shootNamespace)
 			return true
 		}
 
 		// Removing the last KapiData for the shoot, just drop the slice
 		shoot.KapiData = nil
+		shard.store.Put(shoot)
 		return true
 	}
 
 	shoot.KapiData = append(shoot.KapiData[:kapiIndex], shoot.KapiData[kapiIndex+1:]...)
+	shard.store.Put(shoot)
+	return true
+}
+
+// RemoveShootData deletes all registry data specific to the shoot identified by shootNamespace: the data of all of its
+// Kapi pods, its auth secret, CA certificate and scrape settings. Watchers are notified of the deletion of each Kapi.
+// The output value is false if the registry did not contain data for the shoot.
+func (reg *inputDataRegistry) RemoveShootData(shootNamespace string) bool {
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	shoot := shard.store.Get(shootNamespace)
+	if shoot == nil {
+		return false
+	}
+
+	// Raise events just before deleting
+	for _, kapi := range shoot.KapiData {
+		reg.notifyKapiWatchersThreadUnsafe(kapi, KapiEventDelete)
+		reg.metricsUrls.update(kapi.indexKey(), kapi.metricsUrls(), nil)
+	}
+	shard.invalidateSnapshotThreadUnsafe(shootNamespace)
+	shard.store.Delete(shootNamespace)
 	return true
 }
 
-// SetKapiMetrics records the current metrics value for the Kapi pod identified by shootNamespace and podName.
+// GetShootNamespaces returns the namespaces of all shoots for which the registry contains data, in no particular order.
+// Shards are examined one at a time, so the result is not an atomic snapshot across shoots.
+func (reg *inputDataRegistry) GetShootNamespaces() []string {
+	var result []string
+	for i := range reg.shards {
+		shard := &reg.shards[i]
+		shard.lock.Lock()
+		shard.store.Range(func(shoot *shootData) bool {
+			result = append(result, shoot.ShootNamespace())
+			return true
+		})
+		shard.lock.Unlock()
+	}
+
+	return result
+}
+
+// GetFaultyKapiData returns the KapiData objects for all Kapi pods, across all shoots, which have at least
+// minFaultCount consecutive failed metrics scrapes on record.
+// The output is a deep copy, and fully detached from the registry. Shards are examined one at a time, so the result is
+// not an atomic snapshot across shoots.
+func (reg *inputDataRegistry) GetFaultyKapiData(minFaultCount int) []*KapiData {
+	var result []*KapiData
+	for i := range reg.shards {
+		shard := &reg.shards[i]
+		shard.lock.Lock()
+		shard.store.Range(func(shoot *shootData) bool {
+			for _, kapi := range shoot.KapiData {
+				if kapi.FaultCount >= minFaultCount {
+					result = append(result, kapi.Copy())
+				}
+			}
+			return true
+		})
+		shard.lock.Unlock()
+	}
+
+	return result
+}
+
+// GetKapiDataByMetricsUrl returns the KapiData objects for all Kapi pods, across all shoots, which are scraped at the
+// specified URL, either as their MetricsUrl, or as one of their ExtraMetricsUrls. The Kapis are looked up in an index,
+// so the cost does not grow with the number of Kapis in the registry.
+// The output is a deep copy, and fully detached from the registry. The shards of the Kapis found are locked one at a
+// time, so the result is not necessarily a consistent snapshot across shards.
+func (reg *inputDataRegistry) GetKapiDataByMetricsUrl(metricsUrl string) []*KapiData {
+	var result []*KapiData
+	for _, key := range reg.metricsUrls.get(metricsUrl) {
+		shard := reg.getShard(key.Namespace)
+		shard.lock.Lock()
+		// The Kapi may have been changed or removed since the index lookup
+		kapi := shard.getKapiDataThreadUnsafe(key.Namespace, key.Name)
+		if kapi != nil && slices.Contains(kapi.metricsUrls(), metricsUrl) {
+			result = append(result, kapi.Copy())
+		}
+		shard.lock.Unlock()
+	}
+
+	return result
+}
+
+// SetKapiMetrics records the current metrics value for the Kapi pod identified by shootNamespace and podName. The
+// error counts are recorded as zero - SetKapiScrapeResult records them along with the total.
 // If the registry does not contain a record for the specified pod, the operation has no effect.
 func (reg *inputDataRegistry) SetKapiMetrics(shootNamespace string, podName string, currentTotalRequestCount int64) {
 	now := reg.testIsolation.TimeNow()
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
 
-	kapi := reg.getKapiDataThreadUnsafe(shootNamespace, podName)
+	kapi := shard.getKapiDataThreadUnsafe(shootNamespace, podName)
 	if kapi == nil {
 		return
 	}
 
-	kapi.FaultCount = 0
+	shard.invalidateSnapshotThreadUnsafe(shootNamespace)
+	reg.setKapiMetricsThreadUnsafe(kapi, currentTotalRequestCount, 0, 0, now)
+	shard.putShootThreadUnsafe(shootNamespace)
+	reg.notifySampleWatchersThreadUnsafe(shootNamespace)
+}
+
+// setKapiMetricsThreadUnsafe records the total request count, and the error counts in it, sampled at the specified
+// time, for the specified Kapi.
+// Caller must hold the lock of the shard which contains the Kapi.
+func (reg *inputDataRegistry) setKapiMetricsThreadUnsafe(
+	kapi *KapiData, currentTotalRequestCount int64, clientErrorCount int64, serverErrorCount int64, now time.Time) {
+
+	kapi.FaultCount, kapi.LastFaultCategory = 0, ""
 	if currentTotalRequestCount < kapi.TotalRequestCountNew || // Sample is out of order
-		now.Sub(kapi.MetricsTimeNew) < reg.minSampleGap { // Scraped too soon, poor differentiation accuracy
+		now.Sub(kapi.MetricsTimeNew) < reg.minSampleGapFor(kapi) { // Scraped too soon, poor differentiation accuracy
 
 		return
 	}
 
 	kapi.MetricsTimeOld = kapi.MetricsTimeNew
 	kapi.TotalRequestCountOld = kapi.TotalRequestCountNew
+	kapi.ClientErrorCountOld, kapi.ServerErrorCountOld = kapi.ClientErrorCountNew, kapi.ServerErrorCountNew
 	kapi.MetricsTimeNew = now
 	kapi.TotalRequestCountNew = currentTotalRequestCount
+	kapi.ClientErrorCountNew, kapi.ServerErrorCountNew = clientErrorCount, serverErrorCount
+	kapi.RequestCountHistory.Add(RequestCountSample{TotalRequestCount: currentTotalRequestCount, Time: now})
 	reg.log.V(app.VerbosityVerbose).
-		WithValues("ns", shootNamespace, "name", podName, "requestCount", kapi.TotalRequestCountNew).
+		WithValues("ns", kapi.ShootNamespace(), "name", kapi.PodName(), "requestCount", kapi.TotalRequestCountNew).
 		Info("New total request count for kapi")
 }
 
+// SetKapiInflightRequests records the current number of inflight requests for the Kapi pod identified by
+// shootNamespace and podName. Unlike the total request count, this is an instantaneous value, so each call simply
+// replaces the previous one.
+// If the registry does not contain a record for the specified pod, the operation has no effect.
+func (reg *inputDataRegistry) SetKapiInflightRequests(
+	shootNamespace string, podName string, currentInflightRequestCount int64) {
+
+	now := reg.testIsolation.TimeNow()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	kapi := shard.getKapiDataThreadUnsafe(shootNamespace, podName)
+	if kapi == nil {
+		return
+	}
+
+	shard.invalidateSnapshotThreadUnsafe(shootNamespace)
+	kapi.InflightRequestCount = currentInflightRequestCount
+	kapi.InflightRequestTime = now
+	shard.putShootThreadUnsafe(shootNamespace)
+	reg.notifySampleWatchersThreadUnsafe(shootNamespace)
+}
+
 // SetKapiLastScrapeTime records the start time of the last scrape for the Kapi pod identified by shootNamespace and podName.
 // If the registry does not contain a record for the specified pod, the operation has no effect.
 func (reg *inputDataRegistry) SetKapiLastScrapeTime(shootNamespace string, podName string, value time.Time) {
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
 
-	kapi := reg.getKapiDataThreadUnsafe(shootNamespace, podName)
+	kapi := shard.getKapiDataThreadUnsafe(shootNamespace, podName)
 	if kapi == nil {
 		return
 	}
 
 	kapi.LastMetricsScrapeTime = value
+	shard.putShootThreadUnsafe(shootNamespace)
+}
+
+// SetKapiScrapePeriod records the scrape period override for the Kapi pod identified by shootNamespace and podName.
+// Zero means that the global scrape period applies. If the value changes, a KapiEventUpdate is delivered to watchers.
+// If the registry does not contain a record for the specified pod, the operation has no effect.
+func (reg *inputDataRegistry) SetKapiScrapePeriod(shootNamespace string, podName string, scrapePeriod time.Duration) {
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	kapi := shard.getKapiDataThreadUnsafe(shootNamespace, podName)
+	if kapi == nil || kapi.ScrapePeriod == scrapePeriod {
+		return
+	}
+
+	kapi.ScrapePeriod = scrapePeriod
+	shard.putShootThreadUnsafe(shootNamespace)
+	reg.notifyKapiWatchersThreadUnsafe(kapi, KapiEventUpdate)
+}
+
+// SetKapiExtraMetricsUrls records the further URLs where metrics for the Kapi pod identified by shootNamespace and
+// podName are scraped. See KapiData.ExtraMetricsUrls. If the value changes, the Kapi's fault count is reset, and so
+// are its request count samples and history, and its CPU and request duration samples, because the sums scraped
+// before the change are not comparable with the ones scraped after it.
+// If the registry does not contain a record for the specified pod, the operation has no effect.
+func (reg *inputDataRegistry) SetKapiExtraMetricsUrls(shootNamespace string, podName string, metricsUrls []string) {
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	kapi := shard.getKapiDataThreadUnsafe(shootNamespace, podName)
+	if kapi == nil || slices.Equal(kapi.ExtraMetricsUrls, metricsUrls) {
+		return
+	}
+
+	shard.invalidateSnapshotThreadUnsafe(shootNamespace)
+	oldUrls := kapi.metricsUrls()
+	kapi.ExtraMetricsUrls = slices.Clone(metricsUrls)
+	reg.metricsUrls.update(kapi.indexKey(), oldUrls, kapi.metricsUrls())
+	kapi.FaultCount, kapi.LastFaultCategory = 0, ""
+	kapi.TotalRequestCountNew, kapi.MetricsTimeNew = 0, time.Time{}
+	kapi.TotalRequestCountOld, kapi.MetricsTimeOld = 0, time.Time{}
+	kapi.ClientErrorCountNew, kapi.ServerErrorCountNew, kapi.ClientErrorCountOld, kapi.ServerErrorCountOld = 0, 0, 0, 0
+	kapi.RequestCountHistory = RequestCountHistory{}
+	kapi.CPUSecondsNew, kapi.CPUSampleTimeNew = 0, time.Time{}
+	kapi.CPUSecondsOld, kapi.CPUSampleTimeOld = 0, time.Time{}
+	kapi.RequestDurationSecondsNew, kapi.RequestDurationCountNew, kapi.RequestDurationTimeNew = 0, 0, time.Time{}
+	kapi.RequestDurationSecondsOld, kapi.RequestDurationCountOld, kapi.RequestDurationTimeOld = 0, 0, time.Time{}
+	kapi.ProcessStartTime = time.Time{}
+	shard.putShootThreadUnsafe(shootNamespace)
+}
+
+// GetScrapeContext returns the information necessary to scrape the Kapi pod identified by shootNamespace and podName,
+// in a single registry operation. If the registry has no information about the specified pod, nil is returned.
+// Callers should not modify the returned CertPool.
+func (reg *inputDataRegistry) GetScrapeContext(shootNamespace string, podName string) *ScrapeContext {
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	kapi := shard.getKapiDataThreadUnsafe(shootNamespace, podName)
+	if kapi == nil {
+		return nil
+	}
+
+	shoot := shard.store.Get(shootNamespace) // Not nil, since it contains the Kapi
+	scrapeSettings := shoot.ScrapeSettings
+	if scrapeSettings == nil {
+		scrapeSettings = reg.defaultScrapeSettings.Load()
+	}
+	return &ScrapeContext{
+		PodUID:           kapi.PodUID,
+		MetricsUrl:       kapi.MetricsUrl,
+		ExtraMetricsUrls: kapi.ExtraMetricsUrls,
+		ScrapePeriod:     kapi.ScrapePeriod,
+		AuthSecret:       shoot.AuthSecret,
+		CACertPool:       shoot.CACertPool,
+		CACertHash:       shoot.CACertHash,
+		ScrapeSettings:   *scrapeSettings,
+
+		AuthDegradedReason: shoot.AuthDegradedReason,
+		RequestSettings:    shoot.RequestSettings,
+	}
+}
+
+// SetKapiScrapeResult records the metrics values obtained by a successful scrape of the Kapi pod identified by
+// shootNamespace and podName, in a single registry operation. It has the same effect as SetKapiMetrics, followed by
+// SetKapiInflightRequests, if the result has an inflight request count. The process CPU and memory usage, the
+// request duration totals, the process start time, and the scrape duration, if present, are recorded too.
+// If the registry does not contain a record for the specified pod, the operation has no effect.
+func (reg *inputDataRegistry) SetKapiScrapeResult(shootNamespace string, podName string, result KapiScrapeResult) {
+	now := reg.testIsolation.TimeNow()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	kapi := shard.getKapiDataThreadUnsafe(shootNamespace, podName)
+	if kapi == nil {
+		return
+	}
+
+	shard.invalidateSnapshotThreadUnsafe(shootNamespace)
+	reg.setKapiMetricsThreadUnsafe(kapi, result.TotalRequestCount, result.ClientErrorCount, result.ServerErrorCount, now)
+	if result.HasInflightRequestCount {
+		kapi.InflightRequestCount = result.InflightRequestCount
+		kapi.InflightRequestTime = now
+	}
+	if result.HasCPUSeconds {
+		reg.setKapiCPUThreadUnsafe(kapi, result.CPUSeconds, now)
+	}
+	if result.HasResidentMemoryBytes {
+		kapi.ResidentMemoryBytes = result.ResidentMemoryBytes
+		kapi.MemorySampleTime = now
+	}
+	if result.HasRequestDuration {
+		reg.setKapiRequestDurationThreadUnsafe(kapi, result.RequestDurationSeconds, result.RequestDurationCount, now)
+	}
+	if !result.ProcessStartTime.IsZero() {
+		kapi.ProcessStartTime = result.ProcessStartTime
+	}
+	if result.ScrapeDuration > 0 {
+		kapi.ScrapeDurationHistory.Add(result.ScrapeDuration)
+	}
+	shard.putShootThreadUnsafe(shootNamespace)
+	reg.notifySampleWatchersThreadUnsafe(shootNamespace)
+}
+
+// setKapiCPUThreadUnsafe records the process CPU time sampled at the specified time, for the specified Kapi. Like the
+// total request count, samples which come too soon after the previous one are ignored. Unlike the total request count,
+// a decreasing value is taken to mean that the process restarted, so the sample is recorded, but the previous one is
+// discarded, as the pair would yield a meaningless rate.
+// Caller must hold the lock of the shard which contains the Kapi.
+func (reg *inputDataRegistry) setKapiCPUThreadUnsafe(kapi *KapiData, cpuSeconds float64, now time.Time) {
+	if now.Sub(kapi.CPUSampleTimeNew) < reg.minSampleGapFor(kapi) {
+		return
+	}
+
+	if cpuSeconds < kapi.CPUSecondsNew {
+		kapi.CPUSampleTimeOld = time.Time{}
+		kapi.CPUSecondsOld = 0
+	} else {
+		kapi.CPUSampleTimeOld = kapi.CPUSampleTimeNew
+		kapi.CPUSecondsOld = kapi.CPUSecondsNew
+	}
+	kapi.CPUSampleTimeNew = now
+	kapi.CPUSecondsNew = cpuSeconds
+}
+
+// setKapiRequestDurationThreadUnsafe records the request duration totals sampled at the specified time, for the
+// specified Kapi. Handles too frequent samples and process restarts the same way as setKapiCPUThreadUnsafe.
+// Caller must hold the lock of the shard which contains the Kapi.
+func (reg *inputDataRegistry) setKapiRequestDurationThreadUnsafe(
+	kapi *KapiData, durationSeconds float64, count int64, now time.Time) {
+
+	if now.Sub(kapi.RequestDurationTimeNew) < reg.minSampleGapFor(kapi) {
+		return
+	}
+
+	if count < kapi.RequestDurationCountNew || durationSeconds < kapi.RequestDurationSecondsNew {
+		kapi.RequestDurationTimeOld = time.Time{}
+		kapi.RequestDurationSecondsOld, kapi.RequestDurationCountOld = 0, 0
+	} else {
+		kapi.RequestDurationTimeOld = kapi.RequestDurationTimeNew
+		kapi.RequestDurationSecondsOld, kapi.RequestDurationCountOld =
+			kapi.RequestDurationSecondsNew, kapi.RequestDurationCountNew
+	}
+	kapi.RequestDurationTimeNew = now
+	kapi.RequestDurationSecondsNew, kapi.RequestDurationCountNew = durationSeconds, count
 }
 
 // NotifyKapiMetricsFault is the counterpart of SetKapiMetrics which is used when a metrics scrape fails. Instead of
@@ -325,25 +1082,150 @@ func (reg *inputDataRegistry) SetKapiLastScrapeTime(shootNamespace string, podNa
 //
 // The function returns the number of consecutive faults on record, including the one reflected by this call.
 // Returns -1 if the registry currently does not maintain a record for the specified pod.
-func (reg *inputDataRegistry) NotifyKapiMetricsFault(shootNamespace string, podName string) int {
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
+// The category of the fault is recorded as KapiData.LastFaultCategory.
+func (reg *inputDataRegistry) NotifyKapiMetricsFault(
+	shootNamespace string, podName string, category ScrapeErrorCategory) int {
 
-	kapi := reg.getKapiDataThreadUnsafe(shootNamespace, podName)
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	kapi := shard.getKapiDataThreadUnsafe(shootNamespace, podName)
 	if kapi == nil {
 		return -1
 	}
 
 	kapi.FaultCount++
+	kapi.LastFaultCategory = category
+	shard.putShootThreadUnsafe(shootNamespace)
 	return kapi.FaultCount
 }
 
-// Caller must acquire write lock before calling this function
+// SetKapiScrapeExcluded records whether the scraper skips the Kapi pod identified by shootNamespace and podName.
+// See KapiData.ScrapeExcluded.
+// If the registry does not contain a record for the specified pod, the operation has no effect.
+func (reg *inputDataRegistry) SetKapiScrapeExcluded(shootNamespace string, podName string, isExcluded bool) {
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	kapi := shard.getKapiDataThreadUnsafe(shootNamespace, podName)
+	if kapi == nil {
+		return
+	}
+
+	kapi.ScrapeExcluded = isExcluded
+	shard.putShootThreadUnsafe(shootNamespace)
+}
+
+// SetKapiReady records whether the Kapi pod identified by shootNamespace and podName is ready. See KapiData.NotReady.
+// If the registry does not contain a record for the specified pod, the operation has no effect.
+func (reg *inputDataRegistry) SetKapiReady(shootNamespace string, podName string, isReady bool) {
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	kapi := shard.getKapiDataThreadUnsafe(shootNamespace, podName)
+	if kapi == nil || kapi.NotReady == !isReady {
+		return
+	}
+
+	shard.invalidateSnapshotThreadUnsafe(shootNamespace)
+	kapi.NotReady = !isReady
+	shard.putShootThreadUnsafe(shootNamespace)
+}
+
+// ImportKapiData replaces the record of the Kapi pod identified by kapi.ShootNamespace and kapi.PodName with a copy of
+// kapi, creating the record if it does not exist. Used to take over data recorded by another replica. The fault count
+// and category on record are retained, as they pertain to the scraping done by this process.
+// Watchers are notified of the creation of the record, or of a change in the scrape period, and sample watchers - of
+// the new samples.
+func (reg *inputDataRegistry) ImportKapiData(kapi *KapiData) {
+	shootNamespace := kapi.ShootNamespace()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	target, isCreate := shard.getOrCreateKapiDataThreadUnsafe(shootNamespace, kapi.PodName())
+	shard.invalidateSnapshotThreadUnsafe(shootNamespace)
+	isScrapePeriodChanged := target.ScrapePeriod != kapi.ScrapePeriod
+	faultCount, lastFaultCategory := target.FaultCount, target.LastFaultCategory
+	oldUrls := target.metricsUrls()
+	*target = *kapi.Copy()
+	target.FaultCount, target.LastFaultCategory = faultCount, lastFaultCategory
+	reg.metricsUrls.update(target.indexKey(), oldUrls, target.metricsUrls())
+	shard.putShootThreadUnsafe(shootNamespace)
+	if isCreate {
+		reg.notifyKapiWatchersThreadUnsafe(target, KapiEventCreate)
+	} else if isScrapePeriodChanged {
+		reg.notifyKapiWatchersThreadUnsafe(target, KapiEventUpdate)
+	}
+	reg.notifySampleWatchersThreadUnsafe(shootNamespace)
+}
+
+// GetScrapeCoverage returns the scrape coverage of each shoot, as a map of <shoot namespace> -> <coverage>. Kapis
+// which the scraper skips are not counted, and shoots which only have such Kapis are omitted. Shards are examined one
+// at a time, so the result is not an atomic snapshot across shoots.
+//
+// Coverage reflects the outcome of recent scrapes: a Kapi which the scraper fails to scrape loses coverage as its last
+// sample ages, and a Kapi whose pod is gone stops counting once the pod controller, or the Kapi janitor, removes it.
+func (reg *inputDataRegistry) GetScrapeCoverage() map[string]ScrapeCoverage {
+	now := reg.testIsolation.TimeNow()
+	defaultScrapePeriod := time.Duration(reg.defaultScrapePeriod.Load())
+	result := make(map[string]ScrapeCoverage)
+	for i := range reg.shards {
+		shard := &reg.shards[i]
+		shard.lock.Lock()
+		shard.store.Range(func(shoot *shootData) bool {
+			if coverage := GetShootScrapeCoverage(shoot.KapiData, defaultScrapePeriod, now); coverage.KapiCount > 0 {
+				result[shoot.ShootNamespace()] = coverage
+			}
+			return true
+		})
+		shard.lock.Unlock()
+	}
+
+	return result
+}
+
+// GetShootScrapeCoverage returns the scrape coverage of the specified Kapis, as of the specified time. Kapis which do
+// not override the scrape period are considered to be scraped with defaultScrapePeriod. This is the calculation which
+// InputDataRegistry.GetScrapeCoverage applies to each shoot.
+func GetShootScrapeCoverage(kapis []*KapiData, defaultScrapePeriod time.Duration, now time.Time) ScrapeCoverage {
+	var coverage ScrapeCoverage
+	for _, kapi := range kapis {
+		if kapi.ScrapeExcluded {
+			continue
+		}
+		coverage.KapiCount++
+		scrapePeriod := kapi.ScrapePeriod
+		if scrapePeriod == 0 {
+			scrapePeriod = defaultScrapePeriod
+		}
+		if !kapi.MetricsTimeNew.IsZero() && now.Sub(kapi.MetricsTimeNew) <= freshSampleMaxAge(scrapePeriod) {
+			coverage.FreshKapiCount++
+		}
+	}
+	return coverage
+}
+
+// freshSampleMaxAge returns the maximum age of a fresh sample, for a Kapi scraped with the specified period. A Kapi's
+// next sample arrives one period after the previous one, plus the time it takes to scrape, so the age of the last
+// sample routinely exceeds the scrape period briefly. A quarter of the period accommodates that, along with scheduling
+// delays. A period of zero means that the period is unknown, and any sample is considered fresh.
+func freshSampleMaxAge(scrapePeriod time.Duration) time.Duration {
+	if scrapePeriod <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return scrapePeriod + scrapePeriod/4
+}
+
+// Caller must hold the lock of the shard which contains the shoot
 // Returns:
 // - Pointer to the resulting KapiData
 // - A bool: Was the KapiData created, or did it already exist. True means "created".
-func (reg *inputDataRegistry) getOrCreateKapiDataThreadUnsafe(shootNamespace string, podName string) (*KapiData, bool) {
-	shoot := reg.getOrCreateShootDataThreadUnsafe(shootNamespace)
+func (shard *registryShard) getOrCreateKapiDataThreadUnsafe(shootNamespace string, podName string) (*KapiData, bool) {
+	shoot := shard.getOrCreateShootDataThreadUnsafe(shootNamespace)
 	kapiIndex := slices.IndexFunc(shoot.KapiData, func(x *KapiData) bool { return x.PodName() == podName })
 
 	if kapiIndex != -1 { // Already exists
@@ -355,16 +1237,77 @@ func (reg *inputDataRegistry) getOrCreateKapiDataThreadUnsafe(shootNamespace str
 	return kapi, true
 }
 
+// invalidateSnapshotThreadUnsafe discards the snapshot of the shoot's Kapis, so the next GetShootKapis call for the
+// shoot takes a new one, and advances the shoot's generation. Must be called upon any change to the shoot's Kapis which
+// is visible through the ShootKapi interface, or to the existence of the shoot.
+// Caller must hold the lock of the shard which contains the shoot.
+func (shard *registryShard) invalidateSnapshotThreadUnsafe(shootNamespace string) {
+	shard.snapshots.Delete(shootNamespace)
+	shard.generations.Store(shootNamespace, shard.registryGeneration.Add(1))
+}
+
+// putShootThreadUnsafe passes the record of the specified shoot back to the store, after the record, or one of its
+// Kapis, was modified in place. See shootStore. If there is no record for the shoot, it has no effect.
+// Caller must hold the lock of the shard which contains the shoot.
+func (shard *registryShard) putShootThreadUnsafe(shootNamespace string) {
+	if shoot := shard.store.Get(shootNamespace); shoot != nil {
+		shard.store.Put(shoot)
+	}
+}
+
+// getShootKapis implements InputDataSource.GetShootKapis. Returns the shoot's snapshot, taking a new one if there is no
+// up-to-date snapshot. Reading an up-to-date snapshot requires neither locking, nor allocation.
+func (reg *inputDataRegistry) getShootKapis(shootNamespace string) []ShootKapi {
+	shard := reg.getShard(shootNamespace)
+	if snapshot, ok := shard.snapshots.Load(shootNamespace); ok {
+		return snapshot.([]ShootKapi)
+	}
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	shoot := shard.store.Get(shootNamespace)
+	if shoot == nil {
+		// Not cached, so creating the shoot does not need to invalidate anything
+		return nil
+	}
+
+	// Copy
+	var result = make([]ShootKapi, len(shoot.KapiData))
+	for i := range shoot.KapiData {
+		x := *shoot.KapiData[i]
+		result[i] = &kapiDataAdapter{&x}
+	}
+	shard.snapshots.Store(shootNamespace, result)
+
+	return result
+}
+
+// getGeneration implements InputDataSource.GetGeneration
+func (reg *inputDataRegistry) getGeneration() uint64 {
+	return reg.generation.Load()
+}
+
+// getShootGeneration implements InputDataSource.GetShootGeneration. The generation of a removed shoot is retained, so
+// it does not decrease if the shoot reappears. Requires neither locking, nor allocation.
+func (reg *inputDataRegistry) getShootGeneration(shootNamespace string) uint64 {
+	if generation, ok := reg.getShard(shootNamespace).generations.Load(shootNamespace); ok {
+		return generation.(uint64)
+	}
+	return 0
+}
+
 ///////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 // Shoot operations
 
 // GetShootAuthSecret retrieves the authentication secret used to access Kapi metrics on the shoot identified by shootNamespace.
 // Returns empty string if there is no auth secret on record for that shoot.
 func (reg *inputDataRegistry) GetShootAuthSecret(shootNamespace string) string {
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
 
-	shoot := reg.shoots[shootNamespace]
+	shoot := shard.store.Get(shootNamespace)
 
 	if shoot == nil {
 		return ""
@@ -376,10 +1319,11 @@ func (reg *inputDataRegistry) GetShootAuthSecret(shootNamespace string) string {
 // SetShootAuthSecret records the specified authentication secret for the shoot identified by ShootNamespace, so it can
 // later be retrieved via GetShootAuthSecret(). Passing authSecret="" deletes the record, if one exists.
 func (reg *inputDataRegistry) SetShootAuthSecret(shootNamespace string, authSecret string) {
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
 
-	shoot := reg.shoots[shootNamespace]
+	shoot := shard.store.Get(shootNamespace)
 
 	if shoot == nil {
 		if authSecret == "" {
@@ -388,26 +1332,49 @@ func (reg *inputDataRegistry) SetShootAuthSecret(shootNamespace string, authSecr
 		}
 
 		shoot = &shootData{shootNamespace: shootNamespace}
-		reg.shoots[shootNamespace] = shoot
 	} else {
 		// Was this the last piece of information for that shoot?
-		if authSecret == "" && shoot.CACertPool == nil && shoot.KapiData == nil {
-			delete(reg.shoots, shootNamespace)
+		if authSecret == "" && shoot.CACertPool == nil && shoot.ScrapeSettings == nil && shoot.RequestSettings == nil &&
+			shoot.KapiData == nil {
+			shard.store.Delete(shootNamespace)
+			shard.invalidateSnapshotThreadUnsafe(shootNamespace)
 			return
 		}
 	}
 
+	if shoot.AuthSecret != authSecret {
+		shoot.AuthDegradedReason = ""
+	}
 	shoot.AuthSecret = authSecret
+	shard.store.Put(shoot)
+}
+
+// SetShootAuthDegraded marks the auth secret of the shoot identified by shootNamespace as unusable, e.g. because it
+// expired, for the specified reason. An empty reason clears the mark. The mark is also cleared whenever the auth secret
+// changes. If the registry has no auth secret on record for the shoot, the operation has no effect.
+func (reg *inputDataRegistry) SetShootAuthDegraded(shootNamespace string, reason string) {
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	shoot := shard.store.Get(shootNamespace)
+	if shoot == nil || shoot.AuthSecret == "" || shoot.AuthDegradedReason == reason {
+		return
+	}
+
+	shoot.AuthDegradedReason = reason
+	shard.store.Put(shoot)
 }
 
 // GetShootCACertificate retrieves the Kapi CA certificate registered for the shoot identified by shootNamespace.
 // Returns nil if a CA cert is not registered for the shoot. The result is in the form of a CertPool, containing
 // only the shoot's CA certificate. Callers should not modify the returned object.
 func (reg *inputDataRegistry) GetShootCACertificate(shootNamespace string) *x509.CertPool {
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
 
-	shoot := reg.shoots[shootNamespace]
+	shoot := shard.store.Get(shootNamespace)
 	if shoot == nil {
 		return nil
 	}
@@ -417,12 +1384,14 @@ func (reg *inputDataRegistry) GetShootCACertificate(shootNamespace string) *x509
 
 // SetShootCACertificate records the specified certificate as the CA certificate for the Kapi of the shoot identified by
 // shootNamespace, so it can later be retrieved via GetShootCACertificate(). Passing certificate=nil deletes the record,
-// if one exists.
+// if one exists. If the certificate content is the same as the one on record, the operation has no effect, and
+// GetShootCACertificate() keeps returning the same CertPool object.
 func (reg *inputDataRegistry) SetShootCACertificate(shootNamespace string, certificate []byte) {
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
 
-	shoot := reg.shoots[shootNamespace]
+	shoot := shard.store.Get(shootNamespace)
 
 	if shoot == nil {
 		if certificate == nil {
@@ -431,33 +1400,128 @@ func (reg *inputDataRegistry) SetShootCACertificate(shootNamespace string, certi
 		}
 
 		shoot = &shootData{shootNamespace: shootNamespace}
-		reg.shoots[shootNamespace] = shoot
 	} else {
 		// Was this the last piece of information for that shoot?
-		if certificate == nil && shoot.AuthSecret == "" && shoot.KapiData == nil {
-			delete(reg.shoots, shootNamespace)
+		if certificate == nil && shoot.AuthSecret == "" && shoot.ScrapeSettings == nil && shoot.RequestSettings == nil &&
+			shoot.KapiData == nil {
+			shard.store.Delete(shootNamespace)
+			shard.invalidateSnapshotThreadUnsafe(shootNamespace)
 			return
 		}
 	}
 
 	if certificate == nil {
 		shoot.CACertPool = nil
+		shoot.caCertificate = nil
+		shoot.CACertHash = ""
+		shard.store.Put(shoot)
+		return
+	}
+	if shoot.caCertificate != nil && bytes.Equal(certificate, shoot.caCertificate) {
+		// Unchanged. Keep the existing CertPool, so consumers which cache objects derived from it can reuse them.
 		return
 	}
 
+	shoot.caCertificate = bytes.Clone(certificate)
+	hash := sha256.Sum256(certificate)
+	shoot.CACertHash = hex.EncodeToString(hash[:])
 	shoot.CACertPool = x509.NewCertPool()
 	shoot.CACertPool.AppendCertsFromPEM(certificate)
+	shard.store.Put(shoot)
+}
+
+// SetShootScrapeSettings records scrape settings specific to the shoot identified by shootNamespace. They replace
+// the default ones as a whole. Passing settings=nil deletes the record, if one exists, so the default settings
+// apply. See GetScrapeContext.
+func (reg *inputDataRegistry) SetShootScrapeSettings(shootNamespace string, settings *ShootScrapeSettings) {
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	shoot := shard.store.Get(shootNamespace)
+
+	if shoot == nil {
+		if settings == nil {
+			// There's nothing to remove. Just return.
+			return
+		}
+
+		shoot = &shootData{shootNamespace: shootNamespace}
+	} else {
+		// Was this the last piece of information for that shoot?
+		if settings == nil && shoot.AuthSecret == "" && shoot.CACertPool == nil && shoot.RequestSettings == nil &&
+			shoot.KapiData == nil {
+			shard.store.Delete(shootNamespace)
+			shard.invalidateSnapshotThreadUnsafe(shootNamespace)
+			return
+		}
+	}
+
+	if settings == nil {
+		shoot.ScrapeSettings = nil
+	} else {
+		settingsCopy := *settings
+		shoot.ScrapeSettings = &settingsCopy
+	}
+	shard.store.Put(shoot)
+}
+
+// SetShootScrapeRequestSettings records additions to the scrape requests sent to the Kapis of the shoot identified by
+// shootNamespace. Passing settings=nil deletes the record, if one exists. See ScrapeContext.RequestSettings.
+func (reg *inputDataRegistry) SetShootScrapeRequestSettings(
+	shootNamespace string, settings *ShootScrapeRequestSettings) {
+
+	shard := reg.getShard(shootNamespace)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	shoot := shard.store.Get(shootNamespace)
+
+	if shoot == nil {
+		if settings == nil {
+			// There's nothing to remove. Just return.
+			return
+		}
+
+		shoot = &shootData{shootNamespace: shootNamespace}
+	} else {
+		// Was this the last piece of information for that shoot?
+		if settings == nil && shoot.AuthSecret == "" && shoot.CACertPool == nil && shoot.ScrapeSettings == nil &&
+			shoot.KapiData == nil {
+			shard.store.Delete(shootNamespace)
+			shard.invalidateSnapshotThreadUnsafe(shootNamespace)
+			return
+		}
+	}
+
+	if settings == nil {
+		shoot.RequestSettings = nil
+	} else {
+		// A copy, so the caller cannot modify the settings on record, which scrapers read without holding the lock
+		settingsCopy := ShootScrapeRequestSettings{Headers: settings.Headers.Clone()}
+		if settings.ProxyURL != nil {
+			proxyURL := *settings.ProxyURL
+			settingsCopy.ProxyURL = &proxyURL
+		}
+		shoot.RequestSettings = &settingsCopy
+	}
+	shard.store.Put(shoot)
+}
+
+// SetDefaultShootScrapeSettings records the scrape settings which apply to shoots without settings of their own
+func (reg *inputDataRegistry) SetDefaultShootScrapeSettings(settings ShootScrapeSettings) {
+	reg.defaultScrapeSettings.Store(&settings)
 }
 
-// Caller must acquire write lock before calling this function
-func (reg *inputDataRegistry) getOrCreateShootDataThreadUnsafe(shootNamespace string) *shootData {
-	shoot := reg.shoots[shootNamespace]
+// Caller must hold the lock of the shard which contains the shoot
+func (shard *registryShard) getOrCreateShootDataThreadUnsafe(shootNamespace string) *shootData {
+	shoot := shard.store.Get(shootNamespace)
 
 	if shoot == nil {
 		shoot = &shootData{
 			shootNamespace: shootNamespace,
 		}
-		reg.shoots[shootNamespace] = shoot
+		shard.store.Put(shoot)
 	}
 
 	return shoot
@@ -471,47 +1535,131 @@ func (reg *inputDataRegistry) getOrCreateShootDataThreadUnsafe(shootNamespace st
 // which is already in the registry at the time of the call. If false, the watcher will only be notified of subsequent
 // changes.
 //
-// IMPORTANT:
-// If a goroutine exists which could hold a given lock while calling a method on a given InputDataRegistry instance,
-// then it is illegal for any KapiWatcher registered on that instance to block, even indirectly, on that same lock.
-// The KapiWatcher is still allowed to e.g. create a separate goroutine which blocks in the lock, as long as it doesn't
-// block waiting on the goroutine.
+// Concurrency: events are delivered asynchronously, one at a time, in the order of the respective changes, on a
+// goroutine dedicated to the watcher. The watcher may block, and may call back into the registry. Meanwhile,
+// subsequent events are buffered. Each event carries a snapshot of the Kapi, as of the time of the change.
+//
+// A watcher which panics, or takes too long to process events, gets its deliveries paused, with exponential backoff.
+// If it keeps misbehaving, or hangs, it is unsubscribed automatically. See kapiWatcherPolicy.
 func (reg *inputDataRegistry) AddKapiWatcher(watcher *KapiWatcher, shouldNotifyOfPreexisting bool) {
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
+	// Holding all locks makes the preexisting notifications and the registration atomic, with respect to changes
+	reg.lockAllShards()
+	defer reg.unlockAllShards()
 
+	queue := newKapiWatcherQueue(
+		watcher, reg.kapiWatcherPolicy, reg.removeTrippedKapiWatcher, reg.testIsolation.TimeNow, reg.log)
 	if shouldNotifyOfPreexisting {
-		for _, shoot := range reg.shoots {
-			for _, kapi := range shoot.KapiData {
-				(*watcher)(&kapiDataAdapter{x: kapi}, KapiEventCreate)
-			}
+		for i := range reg.shards {
+			reg.shards[i].store.Range(func(shoot *shootData) bool {
+				for _, kapi := range shoot.KapiData {
+					queue.enqueue(kapi, KapiEventCreate)
+				}
+				return true
+			})
 		}
 	}
 
-	reg.kapiWatchers = append(reg.kapiWatchers, watcher)
+	reg.kapiWatchers = append(reg.kapiWatchers, queue)
 }
 
 // RemoveKapiWatcher removes the event watcher, registered by a prior AddKapiWatcher call.
 // The watcher pointer must have the same value as the one provided to said AddKapiWatcher() call.
-// Returns false, if the specified watcher has never been added to the registry, or was already removed.
+// Returns false, if the specified watcher has never been added to the registry, or was already removed, including
+// automatic removal due to misbehavior.
+// Once the function returns, no further events are delivered to the watcher, and none are in flight. Events still
+// buffered for the watcher are discarded. Must not be called from the watcher itself.
 func (reg *inputDataRegistry) RemoveKapiWatcher(watcher *KapiWatcher) bool {
-	reg.lock.Lock()
-	defer reg.lock.Unlock()
-
-	for i, value := range reg.kapiWatchers {
-		if value == watcher {
+	reg.lockAllShards()
+	var removed *kapiWatcherQueue
+	for i, queue := range reg.kapiWatchers {
+		if queue.watcher == watcher {
+			removed = queue
 			reg.kapiWatchers = append(reg.kapiWatchers[:i], reg.kapiWatchers[i+1:]...)
-			return true
+			break
 		}
 	}
+	reg.unlockAllShards()
+
+	if removed == nil {
+		return false
+	}
+	// Wait for the event in flight outside the registry locks, because the watcher may be blocked on one of them
+	removed.close()
+	return true
+}
 
-	return false
+func (reg *inputDataRegistry) SetKapiWatcherCondition(condition *conditions.ComponentReporter) {
+	reg.kapiWatcherCondition.Store(condition)
 }
 
-// Caller must acquire read lock before calling this function (or a semantic extension of a read lock - e.g. a read-write lock)
+// removeTrippedKapiWatcher unsubscribes the watcher of a queue which cut its watcher off for the specified reason,
+// because it misbehaved, and reports the removal via the Kapi watcher condition. Unlike RemoveKapiWatcher, it does not
+// wait for the event in flight, as the watcher may be hung.
+func (reg *inputDataRegistry) removeTrippedKapiWatcher(tripped *kapiWatcherQueue, reason error) {
+	reg.kapiWatcherCondition.Load().ReportError(fmt.Errorf("Kapi watcher %s was unsubscribed: %w", tripped.name, reason))
+
+	reg.lockAllShards()
+	defer reg.unlockAllShards()
+
+	for i, queue := range reg.kapiWatchers {
+		if queue == tripped {
+			reg.kapiWatchers = append(reg.kapiWatchers[:i], reg.kapiWatchers[i+1:]...)
+			return
+		}
+	}
+}
+
+// notifyKapiWatchersThreadUnsafe queues the specified event for delivery to all watchers.
+// Caller must hold the lock of the shard which contains the Kapi.
 func (reg *inputDataRegistry) notifyKapiWatchersThreadUnsafe(kapi *KapiData, event KapiEventType) {
-	for _, watcher := range reg.kapiWatchers {
-		(*watcher)(&kapiDataAdapter{x: kapi}, event)
+	for _, queue := range reg.kapiWatchers {
+		queue.enqueue(kapi, event)
+	}
+}
+
+// AddSampleWatcher subscribes a handler which gets called when new metrics samples are recorded for a shoot.
+//
+// Concurrency: notifications are delivered asynchronously, one at a time, on a goroutine dedicated to the watcher.
+// Notifications for a shoot which is already pending delivery are coalesced. The watcher may block, and may call back
+// into the registry.
+func (reg *inputDataRegistry) AddSampleWatcher(watcher *SampleWatcher) {
+	reg.lockAllShards()
+	defer reg.unlockAllShards()
+
+	reg.sampleWatchers = append(reg.sampleWatchers, newSampleWatcherQueue(watcher))
+}
+
+// RemoveSampleWatcher removes the handler, registered by a prior AddSampleWatcher call.
+// The watcher pointer must have the same value as the one provided to said AddSampleWatcher() call.
+// Returns false, if the specified watcher has never been added to the registry, or was already removed.
+// Once the function returns, no further notifications are delivered to the watcher, and none are in flight. Must not
+// be called from the watcher itself.
+func (reg *inputDataRegistry) RemoveSampleWatcher(watcher *SampleWatcher) bool {
+	reg.lockAllShards()
+	var removed *sampleWatcherQueue
+	for i, queue := range reg.sampleWatchers {
+		if queue.watcher == watcher {
+			removed = queue
+			reg.sampleWatchers = append(reg.sampleWatchers[:i], reg.sampleWatchers[i+1:]...)
+			break
+		}
+	}
+	reg.unlockAllShards()
+
+	if removed == nil {
+		return false
+	}
+	// Wait for the notification in flight outside the registry locks, because the watcher may be blocked on one of them
+	removed.close()
+	return true
+}
+
+// notifySampleWatchersThreadUnsafe queues a "samples updated" notification for the specified shoot, for delivery to all
+// sample watchers.
+// Caller must hold the lock of the shard which contains the shoot.
+func (reg *inputDataRegistry) notifySampleWatchersThreadUnsafe(shootNamespace string) {
+	for _, queue := range reg.sampleWatchers {
+		queue.enqueue(shootNamespace)
 	}
 }
 
@@ -5,7 +5,12 @@
 package input_data_registry
 
 import (
+	"bytes"
 	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -13,7 +18,7 @@ import (
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/types"
 
-	"github.com/gardener/gardener-custom-metrics/pkg/util/testutil"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
 )
 
 var _ = Describe("input.input_data_registry", func() {
@@ -27,7 +32,7 @@ var _ = Describe("input.input_data_registry", func() {
 
 	var (
 		log         = logr.Discard()
-		shootCACert = testutil.GetExampleCACert(0)
+		shootCACert = gcmtesting.GetExampleCACert(0)
 	)
 	var (
 		newPodLabels = func() map[string]string {
@@ -48,6 +53,69 @@ var _ = Describe("input.input_data_registry", func() {
 			Expect(idr.GetShootAuthSecret(nsName)).To(BeEmpty())
 		})
 	})
+	Describe("newInputDataRegistryWithStore", func() {
+		It("should keep the data of each shard in the store created for it, and write back each modification", func() {
+			// Arrange
+			stores := make(map[int]*recordingShootStore)
+			idr := newInputDataRegistryWithStore(time.Minute, func(shardIndex int) shootStore {
+				stores[shardIndex] = &recordingShootStore{shootStore: newMemoryShootStore()}
+				return stores[shardIndex]
+			}, log).(*inputDataRegistry)
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			store := idr.getShard(nsName).store.(*recordingShootStore)
+			putCountBefore := store.PutCount
+
+			// Act
+			idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorNetwork)
+
+			// Assert
+			Expect(stores).To(HaveLen(registryShardCount))
+			Expect(store.Get(nsName).KapiData).To(HaveLen(1))
+			Expect(store.Get(nsName).KapiData[0].FaultCount).To(Equal(1))
+			Expect(store.PutCount).To(BeNumerically(">", putCountBefore))
+		})
+	})
+	Describe("getShard", func() {
+		It("should always return the same shard for the same shoot, and spread different shoots across shards", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			shards := make(map[*registryShard]bool)
+
+			// Act
+			for i := 0; i < 100; i++ {
+				ns := fmt.Sprintf("shoot--project--%d", i)
+				shard := idr.getShard(ns)
+				Expect(idr.getShard(ns)).To(BeIdenticalTo(shard))
+				shards[shard] = true
+			}
+
+			// Assert
+			Expect(len(shards)).To(BeNumerically(">", 1))
+		})
+		It("should not block operations on a shoot while the shard of another shoot is locked", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			otherNs := nsName + "2"
+			for i := 3; idr.getShard(otherNs) == idr.getShard(nsName); i++ {
+				otherNs = fmt.Sprintf("%s%d", nsName, i)
+			}
+			lockedShard := idr.getShard(nsName)
+			lockedShard.lock.Lock()
+			defer lockedShard.lock.Unlock()
+			done := make(chan struct{})
+
+			// Act
+			go func() {
+				idr.SetKapiData(otherNs, podName, podUid, nil, metricsURL)
+				idr.NotifyKapiMetricsFault(otherNs, podName, ScrapeErrorNetwork)
+				close(done)
+			}()
+
+			// Assert
+			Eventually(done).Should(BeClosed())
+			Expect(idr.getShard(otherNs).store.Get(otherNs)).NotTo(BeNil())
+		})
+	})
 	Describe("DataSource", func() {
 		It("should return a gateway to the same data, and not to a copy", func() {
 			// Arrange
@@ -69,6 +137,66 @@ var _ = Describe("input.input_data_registry", func() {
 			Expect(kapis[0].PodUID()).To(Equal(podUid))
 		})
 	})
+
+	Describe("GetShootGeneration", func() {
+		It("should be zero for an unknown shoot", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+
+			// Act
+			generation := idr.DataSource().GetShootGeneration(nsName)
+
+			// Assert
+			Expect(generation).To(BeZero())
+		})
+
+		It("should advance upon each new sample for the shoot, and only for that shoot", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			ds := idr.DataSource()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetKapiData(nsName+"2", podName, podUid, nil, metricsURL)
+			before, otherBefore := ds.GetShootGeneration(nsName), ds.GetShootGeneration(nsName+"2")
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{TotalRequestCount: 42})
+
+			// Assert
+			Expect(before).NotTo(BeZero())
+			Expect(ds.GetShootGeneration(nsName)).To(BeNumerically(">", before))
+			Expect(ds.GetShootGeneration(nsName + "2")).To(Equal(otherBefore))
+		})
+
+		It("should not change upon changes which are not visible through the data source", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			before := idr.DataSource().GetShootGeneration(nsName)
+
+			// Act
+			idr.SetKapiLastScrapeTime(nsName, podName, time.Now())
+			idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorNetwork)
+
+			// Assert
+			Expect(idr.DataSource().GetShootGeneration(nsName)).To(Equal(before))
+		})
+
+		It("should not decrease when the shoot is removed and added back", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			before := idr.DataSource().GetShootGeneration(nsName)
+
+			// Act
+			idr.RemoveShootData(nsName)
+			afterRemoval := idr.DataSource().GetShootGeneration(nsName)
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+
+			// Assert
+			Expect(afterRemoval).To(BeNumerically(">", before))
+			Expect(idr.DataSource().GetShootGeneration(nsName)).To(BeNumerically(">", afterRemoval))
+		})
+	})
 	Describe("GetKapiData", func() {
 		Context("when called for a non-existent kapi", func() {
 			It("should return nil", func() {
@@ -92,6 +220,22 @@ var _ = Describe("input.input_data_registry", func() {
 				Expect(idr.GetKapiData(nsName, podName)).To(BeNil())
 			})
 		})
+		It("should return a copy which is detached from the registry", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.SetKapiExtraMetricsUrls(nsName, podName, []string{metricsURL + "2"})
+
+			// Act
+			res := idr.GetKapiData(nsName, podName)
+			res.ExtraMetricsUrls[0] = "changed"
+			res.PodLabels["changed"] = "changed"
+
+			// Assert
+			kapi := idr.GetKapiData(nsName, podName)
+			Expect(kapi.ExtraMetricsUrls).To(Equal([]string{metricsURL + "2"}))
+			Expect(kapi.PodLabels).To(Equal(newPodLabels()))
+		})
 		It("should return a kapi containing the correct values", func() {
 			// Arrange
 			idr := newInputDataRegistry()
@@ -161,6 +305,7 @@ var _ = Describe("input.input_data_registry", func() {
 				idr.SetKapiData(nsName, podName, podUid, labels, metricsURL)
 
 				// Assert
+				idr.waitForKapiWatchers()
 				Expect(eventWatcher.EventTypes).To(HaveLen(1))
 				Expect(eventWatcher.EventTypes[0]).To(Equal(KapiEventCreate))
 				Expect(eventWatcher.EventKapis[0].ShootNamespace()).To(Equal(nsName))
@@ -176,17 +321,17 @@ var _ = Describe("input.input_data_registry", func() {
 				labels := newPodLabels()
 				idr.SetKapiData(nsName, podName, "", map[string]string{}, "metricsURL")
 
-				time1 := testutil.NewTime(1, 0, 0)
+				time1 := gcmtesting.NewTime(1, 0, 0)
 				var requestCount1 int64 = 41
 				idr.testIsolation.TimeNow = func() time.Time { return time1 }
 				idr.SetKapiMetrics(nsName, podName, requestCount1)
 
-				time2 := testutil.NewTime(2, 0, 0)
+				time2 := gcmtesting.NewTime(2, 0, 0)
 				var requestCount2 int64 = 42
 				idr.testIsolation.TimeNow = func() time.Time { return time2 }
 				idr.SetKapiMetrics(nsName, podName, requestCount2)
 
-				scrapeTime := testutil.NewTime(3, 0, 0)
+				scrapeTime := gcmtesting.NewTime(3, 0, 0)
 				idr.SetKapiLastScrapeTime(nsName, podName, scrapeTime)
 
 				// Act
@@ -208,6 +353,20 @@ var _ = Describe("input.input_data_registry", func() {
 				Expect(res.LastMetricsScrapeTime).To(Equal(scrapeTime))
 
 			})
+			It("resets the fault count if the metrics URL changes, and only then", func() {
+				// Arrange
+				idr := newInputDataRegistry()
+				labels := newPodLabels()
+				idr.SetKapiData(nsName, podName, podUid, labels, metricsURL)
+				idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorNetwork)
+
+				// Act & assert
+				idr.SetKapiData(nsName, podName, podUid, labels, metricsURL)
+				Expect(idr.GetKapiData(nsName, podName).FaultCount).To(Equal(1))
+
+				idr.SetKapiData(nsName, podName, podUid, labels, "example.com")
+				Expect(idr.GetKapiData(nsName, podName).FaultCount).To(BeZero())
+			})
 			It("does not deliver any notifications", func() {
 				// Arrange
 				idr := newInputDataRegistry()
@@ -221,6 +380,7 @@ var _ = Describe("input.input_data_registry", func() {
 				idr.SetKapiData(nsName, podName, podUid, labels, "example.com")
 
 				// Assert
+				idr.waitForKapiWatchers()
 				Expect(eventWatcher.EventTypes).To(BeEmpty())
 			})
 			It("does not modify shoot values", func() {
@@ -251,7 +411,7 @@ var _ = Describe("input.input_data_registry", func() {
 
 			// Assert
 			Expect(idr.GetKapiData(nsName, podName)).To(BeNil())
-			Expect(idr.shoots).To(BeEmpty())
+			Expect(idr.allShoots()).To(BeEmpty())
 		})
 		It("should remove the kapi and the output value should reflect it", func() {
 			// Arrange
@@ -277,6 +437,7 @@ var _ = Describe("input.input_data_registry", func() {
 			idr.RemoveKapiData(nsName, podName)
 
 			// Assert
+			idr.waitForKapiWatchers()
 			Expect(eventWatcher.EventTypes).To(HaveLen(1))
 			Expect(eventWatcher.EventTypes[0]).To(Equal(KapiEventDelete))
 			Expect(eventWatcher.EventKapis[0].PodName()).To(Equal(podName))
@@ -309,9 +470,149 @@ var _ = Describe("input.input_data_registry", func() {
 			Expect(idr.RemoveKapiData(nsName, podName)).To(BeTrue())
 
 			// Assert
-			Expect(idr.shoots).To(HaveLen(0))
+			Expect(idr.allShoots()).To(HaveLen(0))
+		})
+	})
+	Describe("RemoveShootData", func() {
+		It("should remove all data of the shoot, notify watchers of each Kapi, and leave other shoots intact", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.SetKapiData(nsName, podName+"2", podUid, newPodLabels(), metricsURL+"2")
+			idr.SetShootAuthSecret(nsName, "secret")
+			idr.SetShootCACertificate(nsName, shootCACert)
+			idr.SetKapiData(nsName+"2", podName, podUid, newPodLabels(), metricsURL+"3")
+			Expect(idr.DataSource().GetShootKapis(nsName)).To(HaveLen(2))
+			eventWatcher := newMockWatcher()
+			idr.AddKapiWatcher(&eventWatcher.Watcher, false)
+
+			// Act
+			result := idr.RemoveShootData(nsName)
+
+			// Assert
+			Expect(result).To(BeTrue())
+			Expect(idr.GetShootNamespaces()).To(ConsistOf(nsName + "2"))
+			Expect(idr.GetShootAuthSecret(nsName)).To(BeEmpty())
+			Expect(idr.GetShootCACertificate(nsName)).To(BeNil())
+			Expect(idr.DataSource().GetShootKapis(nsName)).To(BeEmpty())
+			idr.waitForKapiWatchers()
+			Expect(eventWatcher.EventTypes).To(Equal([]KapiEventType{KapiEventDelete, KapiEventDelete}))
+			Expect(idr.RemoveShootData(nsName)).To(BeFalse())
+		})
+	})
+	Describe("GetShootNamespaces", func() {
+		It("should return the namespaces of all shoots with data, including shoots without Kapis", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.SetShootAuthSecret(nsName+"2", "secret")
+
+			// Act
+			result := idr.GetShootNamespaces()
+
+			// Assert
+			Expect(result).To(ConsistOf(nsName, nsName+"2"))
+		})
+	})
+	Describe("GetFaultyKapiData", func() {
+		It("should return copies of the Kapis which reached the specified fault count, across all shoots", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.SetKapiData(nsName, podName+"2", podUid, newPodLabels(), metricsURL)
+			idr.SetKapiData(nsName+"2", podName, podUid, newPodLabels(), metricsURL)
+			idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorNetwork)
+			idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorNetwork)
+			idr.NotifyKapiMetricsFault(nsName, podName+"2", ScrapeErrorNetwork)
+			idr.NotifyKapiMetricsFault(nsName+"2", podName, ScrapeErrorNetwork)
+			idr.NotifyKapiMetricsFault(nsName+"2", podName, ScrapeErrorNetwork)
+
+			// Act
+			result := idr.GetFaultyKapiData(2)
+
+			// Assert
+			Expect(result).To(HaveLen(2))
+			for _, kapi := range result {
+				Expect(kapi.PodName()).To(Equal(podName))
+				Expect(kapi.FaultCount).To(Equal(2))
+			}
+			result[0].FaultCount = 0
+			Expect(idr.GetFaultyKapiData(2)).To(HaveLen(2))
+		})
+	})
+	Describe("GetKapiDataByMetricsUrl", func() {
+		It("should return copies of the Kapis scraped at the specified URL, as main or extra URL, across all shoots", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.SetKapiData(nsName, podName+"2", podUid, newPodLabels(), metricsURL+"2")
+			idr.SetKapiData(nsName+"2", podName, podUid, newPodLabels(), metricsURL+"3")
+			idr.SetKapiExtraMetricsUrls(nsName+"2", podName, []string{metricsURL})
+
+			// Act
+			result := idr.GetKapiDataByMetricsUrl(metricsURL)
+
+			// Assert
+			Expect(result).To(HaveLen(2))
+			namespaces := []string{result[0].ShootNamespace(), result[1].ShootNamespace()}
+			Expect(namespaces).To(ConsistOf(nsName, nsName+"2"))
+			for _, kapi := range result {
+				Expect(kapi.PodName()).To(Equal(podName))
+			}
+			Expect(idr.GetKapiDataByMetricsUrl("https://unknown/metrics")).To(BeEmpty())
+		})
+
+		It("should follow changes to the Kapis' URLs", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.SetKapiExtraMetricsUrls(nsName, podName, []string{metricsURL + "2"})
+
+			// Act
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL+"3")
+			idr.SetKapiExtraMetricsUrls(nsName, podName, nil)
+
+			// Assert
+			Expect(idr.GetKapiDataByMetricsUrl(metricsURL)).To(BeEmpty())
+			Expect(idr.GetKapiDataByMetricsUrl(metricsURL + "2")).To(BeEmpty())
+			Expect(idr.GetKapiDataByMetricsUrl(metricsURL + "3")).To(HaveLen(1))
+			Expect(idr.metricsUrls.kapis).To(HaveLen(1))
+		})
+
+		It("should not return removed Kapis", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.SetKapiData(nsName+"2", podName, podUid, newPodLabels(), metricsURL+"2")
+			idr.SetKapiExtraMetricsUrls(nsName+"2", podName, []string{metricsURL + "3"})
+
+			// Act
+			idr.RemoveKapiData(nsName, podName)
+			idr.RemoveShootData(nsName + "2")
+
+			// Assert
+			Expect(idr.GetKapiDataByMetricsUrl(metricsURL)).To(BeEmpty())
+			Expect(idr.GetKapiDataByMetricsUrl(metricsURL + "2")).To(BeEmpty())
+			Expect(idr.GetKapiDataByMetricsUrl(metricsURL + "3")).To(BeEmpty())
+			Expect(idr.metricsUrls.kapis).To(BeEmpty())
+		})
+
+		It("should find the Kapis imported from another replica", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			imported := idr.GetKapiData(nsName, podName)
+			imported.MetricsUrl = metricsURL + "2"
+
+			// Act
+			idr.ImportKapiData(imported)
+
+			// Assert
+			Expect(idr.GetKapiDataByMetricsUrl(metricsURL)).To(BeEmpty())
+			Expect(idr.GetKapiDataByMetricsUrl(metricsURL + "2")).To(HaveLen(1))
 		})
 	})
+
 	Describe("SetKapiMetrics", func() {
 		It("should reset fault count to zero", func() {
 			// Arrange
@@ -319,7 +620,7 @@ var _ = Describe("input.input_data_registry", func() {
 			labels := newPodLabels()
 			idr.SetKapiData(nsName, podName, podUid, labels, metricsURL)
 			Expect(idr.GetKapiData(nsName, podName).FaultCount).To(BeZero())
-			Expect(idr.NotifyKapiMetricsFault(nsName, podName)).To(Equal(1))
+			Expect(idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorNetwork)).To(Equal(1))
 			Expect(idr.GetKapiData(nsName, podName).FaultCount).To(Equal(1))
 
 			// Act
@@ -336,36 +637,36 @@ var _ = Describe("input.input_data_registry", func() {
 			values := []int64{41, 42, 43}
 
 			// Act and assert
-			idr.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			idr.SetKapiMetrics(nsName, podName, values[0])
 			Expect(idr.GetKapiData(nsName, podName).TotalRequestCountOld).To(Equal(int64(0)))
 			Expect(idr.GetKapiData(nsName, podName).TotalRequestCountNew).To(Equal(values[0]))
 			Expect(idr.GetKapiData(nsName, podName).MetricsTimeOld).To(Equal(time.Time{}))
-			Expect(idr.GetKapiData(nsName, podName).MetricsTimeNew).To(Equal(testutil.NewTime(1, 0, 0)))
+			Expect(idr.GetKapiData(nsName, podName).MetricsTimeNew).To(Equal(gcmtesting.NewTime(1, 0, 0)))
 
-			idr.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
 			idr.SetKapiMetrics(nsName, podName, values[1])
 			Expect(idr.GetKapiData(nsName, podName).TotalRequestCountOld).To(Equal(values[0]))
 			Expect(idr.GetKapiData(nsName, podName).TotalRequestCountNew).To(Equal(values[1]))
-			Expect(idr.GetKapiData(nsName, podName).MetricsTimeOld).To(Equal(testutil.NewTime(1, 0, 0)))
-			Expect(idr.GetKapiData(nsName, podName).MetricsTimeNew).To(Equal(testutil.NewTime(2, 0, 0)))
+			Expect(idr.GetKapiData(nsName, podName).MetricsTimeOld).To(Equal(gcmtesting.NewTime(1, 0, 0)))
+			Expect(idr.GetKapiData(nsName, podName).MetricsTimeNew).To(Equal(gcmtesting.NewTime(2, 0, 0)))
 
 			// One more step, just in case zero values have special treatment
-			idr.testIsolation.TimeNow = testutil.NewTimeNowStub(3, 0, 0)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(3, 0, 0)
 			idr.SetKapiMetrics(nsName, podName, values[2])
 			Expect(idr.GetKapiData(nsName, podName).TotalRequestCountOld).To(Equal(values[1]))
 			Expect(idr.GetKapiData(nsName, podName).TotalRequestCountNew).To(Equal(values[2]))
-			Expect(idr.GetKapiData(nsName, podName).MetricsTimeOld).To(Equal(testutil.NewTime(2, 0, 0)))
-			Expect(idr.GetKapiData(nsName, podName).MetricsTimeNew).To(Equal(testutil.NewTime(3, 0, 0)))
+			Expect(idr.GetKapiData(nsName, podName).MetricsTimeOld).To(Equal(gcmtesting.NewTime(2, 0, 0)))
+			Expect(idr.GetKapiData(nsName, podName).MetricsTimeNew).To(Equal(gcmtesting.NewTime(3, 0, 0)))
 		})
 		It("should reject samples which are too close in time", func() {
 			// Arrange
 			idr := newInputDataRegistry()
 			labels := newPodLabels()
 			idr.SetKapiData(nsName, podName, podUid, labels, metricsURL)
-			idr.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			idr.SetKapiMetrics(nsName, podName, 42)
-			idr.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 1)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 1)
 
 			// Act
 			idr.SetKapiMetrics(nsName, podName, 43)
@@ -374,12 +675,65 @@ var _ = Describe("input.input_data_registry", func() {
 			Expect(idr.GetKapiData(nsName, podName).TotalRequestCountOld).To(Equal(int64(0)))
 			Expect(idr.GetKapiData(nsName, podName).TotalRequestCountNew).To(Equal(int64(42)))
 			Expect(idr.GetKapiData(nsName, podName).MetricsTimeOld).To(Equal(time.Time{}))
-			Expect(idr.GetKapiData(nsName, podName).MetricsTimeNew).To(Equal(testutil.NewTime(1, 0, 0)))
+			Expect(idr.GetKapiData(nsName, podName).MetricsTimeNew).To(Equal(gcmtesting.NewTime(1, 0, 0)))
+			Expect(idr.GetKapiData(nsName, podName).RequestCountHistory.Len()).To(Equal(1))
+		})
+		It("should add the accepted samples to the request count history", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiMetrics(nsName, podName, 42)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0)
+			idr.SetKapiMetrics(nsName, podName, 40) // Out of order
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 2, 0)
+
+			// Act
+			idr.SetKapiMetrics(nsName, podName, 50)
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName).RequestCountHistory.Samples()).To(Equal([]RequestCountSample{
+				{TotalRequestCount: 42, Time: gcmtesting.NewTime(1, 0, 0)},
+				{TotalRequestCount: 50, Time: gcmtesting.NewTime(1, 2, 0)},
+			}))
+			Expect(idr.DataSource().GetShootKapis(nsName)[0].RequestCountHistory()).To(HaveLen(2))
+		})
+		It("should cap the minimum sample gap at a third of the default scrape period", func() {
+			// Arrange
+			idr := newInputDataRegistry() // Min sample gap is 1 minute
+			idr.SetDefaultScrapePeriod(30 * time.Second)
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiMetrics(nsName, podName, 42)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 10)
+
+			// Act
+			idr.SetKapiMetrics(nsName, podName, 43)
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName).TotalRequestCountNew).To(Equal(int64(43)))
+			Expect(idr.GetKapiData(nsName, podName).MetricsTimeOld).To(Equal(gcmtesting.NewTime(1, 0, 0)))
+		})
+		It("should cap the minimum sample gap based on the Kapi's scrape period override, if it has one", func() {
+			// Arrange
+			idr := newInputDataRegistry() // Min sample gap is 1 minute
+			idr.SetDefaultScrapePeriod(10 * time.Minute)
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.SetKapiScrapePeriod(nsName, podName, 30*time.Second)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiMetrics(nsName, podName, 42)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 10)
+
+			// Act
+			idr.SetKapiMetrics(nsName, podName, 43)
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName).TotalRequestCountNew).To(Equal(int64(43)))
 		})
 		It("should not create a new kapi if it is missing", func() {
 			// Arrange
 			idr := newInputDataRegistry()
-			idr.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 
 			// Act
 			idr.SetKapiMetrics(nsName, podName, 43)
@@ -392,7 +746,7 @@ var _ = Describe("input.input_data_registry", func() {
 			idr := newInputDataRegistry()
 			labels := newPodLabels()
 			idr.SetKapiData(nsName, podName, podUid, labels, metricsURL)
-			idr.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			eventWatcher := newMockWatcher()
 			idr.AddKapiWatcher(&eventWatcher.Watcher, false)
 
@@ -400,126 +754,858 @@ var _ = Describe("input.input_data_registry", func() {
 			idr.SetKapiMetrics(nsName, podName, 43)
 
 			// Assert
+			idr.waitForKapiWatchers()
 			Expect(eventWatcher.EventTypes).To(BeEmpty())
 		})
 	})
-	Describe("SetKapiLastScrapeTime", func() {
-		It("should set the correct value", func() {
+	Describe("SetKapiInflightRequests", func() {
+		It("should replace the previous value and record the time of the call", func() {
 			// Arrange
 			idr := newInputDataRegistry()
-			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
-			scrapeTime := testutil.NewTime(5, 0, 0)
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiInflightRequests(nsName, podName, 42)
 
 			// Act
-			idr.SetKapiLastScrapeTime(nsName, podName, scrapeTime)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 1) // Well within minSampleGap
+			idr.SetKapiInflightRequests(nsName, podName, 7)
 
 			// Assert
-			Expect(idr.GetKapiData(nsName, podName).LastMetricsScrapeTime).To(Equal(scrapeTime))
+			Expect(idr.GetKapiData(nsName, podName).InflightRequestCount).To(Equal(int64(7)))
+			Expect(idr.GetKapiData(nsName, podName).InflightRequestTime).To(Equal(gcmtesting.NewTime(1, 0, 1)))
 		})
-		It("should have no effect if the kapi is missing", func() {
+		It("should have no effect if the Kapi is not in the registry", func() {
 			// Arrange
 			idr := newInputDataRegistry()
-			scrapeTime := testutil.NewTime(5, 0, 0)
 
 			// Act
-			idr.SetKapiLastScrapeTime(nsName, podName, scrapeTime)
+			idr.SetKapiInflightRequests(nsName, podName, 42)
 
 			// Assert
 			Expect(idr.GetKapiData(nsName, podName)).To(BeNil())
 		})
 	})
-	Describe("NotifyKapiMetricsFault", func() {
-		It("should increment the count and return the new value", func() {
+
+	Describe("GetScrapeContext", func() {
+		It("should return nil if the kapi is missing, even if the shoot is present", func() {
 			// Arrange
 			idr := newInputDataRegistry()
-			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
-			Expect(idr.GetKapiData(nsName, podName).FaultCount).To(Equal(0))
+			idr.SetShootAuthSecret(nsName, shootAuthSecret)
 
-			// Act and assert
-			res := idr.NotifyKapiMetricsFault(nsName, podName)
-			Expect(res).To(Equal(1))
-			Expect(idr.GetKapiData(nsName, podName).FaultCount).To(Equal(1))
-			res = idr.NotifyKapiMetricsFault(nsName, podName)
-			Expect(res).To(Equal(2))
-			Expect(idr.GetKapiData(nsName, podName).FaultCount).To(Equal(2))
+			// Act
+			result := idr.GetScrapeContext(nsName, podName)
+
+			// Assert
+			Expect(result).To(BeNil())
 		})
-	})
-	Describe("GetShootAuthSecret", func() {
-		It("should return empty string if shoot is missing", func() {
+		It("should return the kapi and shoot values necessary for scraping", func() {
 			// Arrange
 			idr := newInputDataRegistry()
-			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.SetKapiScrapePeriod(nsName, podName, 15*time.Second)
+			idr.SetShootAuthSecret(nsName, shootAuthSecret)
+			idr.SetShootCACertificate(nsName, shootCACert)
 
 			// Act
-			res := idr.GetShootAuthSecret("AnotherNS")
+			result := idr.GetScrapeContext(nsName, podName)
 
 			// Assert
-			Expect(res).To(Equal(""))
+			Expect(result).NotTo(BeNil())
+			Expect(result.PodUID).To(Equal(podUid))
+			Expect(result.MetricsUrl).To(Equal(metricsURL))
+			Expect(result.ScrapePeriod).To(Equal(15 * time.Second))
+			Expect(result.AuthSecret).To(Equal(shootAuthSecret))
+			Expect(result.CACertPool.Equal(idr.GetShootCACertificate(nsName))).To(BeTrue())
+			Expect(result.CACertHash).NotTo(BeEmpty())
 		})
-		It("should not create the shoot if it is missing", func() {
+		It("should return empty shoot values if the shoot has no secret and CA certificate", func() {
 			// Arrange
 			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
 
 			// Act
-			idr.GetShootAuthSecret(nsName)
+			result := idr.GetScrapeContext(nsName, podName)
 
 			// Assert
-			Expect(idr.shoots).To(BeEmpty())
+			Expect(result).NotTo(BeNil())
+			Expect(result.AuthSecret).To(BeEmpty())
+			Expect(result.CACertPool).To(BeNil())
+			Expect(result.CACertHash).To(BeEmpty())
 		})
-		It("should return the last stored value", func() {
+		It("should return the default scrape settings, unless the shoot has its own", func() {
 			// Arrange
 			idr := newInputDataRegistry()
-			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
-			idr.SetShootAuthSecret(nsName, shootAuthSecret)
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.SetKapiData("other-ns", podName, podUid, newPodLabels(), metricsURL)
+			defaultSettings := ShootScrapeSettings{Scheme: ScrapeSchemeHTTP}
+			shootSettings := &ShootScrapeSettings{Scheme: ScrapeSchemeHTTPS, InsecureSkipTLSVerify: true}
 
 			// Act
-			res := idr.GetShootAuthSecret(nsName)
+			idr.SetDefaultShootScrapeSettings(defaultSettings)
+			idr.SetShootScrapeSettings(nsName, shootSettings)
+			shootSettings.Scheme = ScrapeSchemeHTTP // Must not affect the registry's copy
 
 			// Assert
-			Expect(res).To(Equal(shootAuthSecret))
+			Expect(idr.GetScrapeContext(nsName, podName).ScrapeSettings).To(Equal(
+				ShootScrapeSettings{Scheme: ScrapeSchemeHTTPS, InsecureSkipTLSVerify: true}))
+			Expect(idr.GetScrapeContext("other-ns", podName).ScrapeSettings).To(Equal(defaultSettings))
 		})
 	})
-	Describe("SetShootAuthSecret", func() {
-		Context("when the shoot does not exist", func() {
-			It("should store the specified value so it can be retrieved later", func() {
-				// Arrange
-				idr := newInputDataRegistry()
+	Describe("SetShootScrapeSettings", func() {
+		It("should revert the shoot to the default settings, when passed nil", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetShootScrapeSettings(nsName, &ShootScrapeSettings{InsecureSkipTLSVerify: true})
 
-				// Act
-				idr.SetShootAuthSecret(nsName, shootAuthSecret)
+			// Act
+			idr.SetShootScrapeSettings(nsName, nil)
 
-				// Assert
-				Expect(idr.GetShootAuthSecret(nsName)).To(Equal(shootAuthSecret))
-			})
-			It("should have no effect if the specified value is empty", func() {
-				// Arrange
-				idr := newInputDataRegistry()
+			// Assert
+			Expect(idr.GetScrapeContext(nsName, podName).ScrapeSettings).To(BeZero())
+		})
+		It("should delete the shoot, once it holds no more information", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetShootScrapeSettings(nsName, &ShootScrapeSettings{InsecureSkipTLSVerify: true})
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.RemoveKapiData(nsName, podName)
+			Expect(idr.allShoots()).To(HaveLen(1))
 
-				// Act
-				idr.SetShootAuthSecret(nsName, "")
+			// Act
+			idr.SetShootScrapeSettings(nsName, nil)
 
-				// Assert
-				Expect(idr.shoots).To(BeEmpty())
-			})
+			// Assert
+			Expect(idr.allShoots()).To(BeEmpty())
 		})
-		Context("when the shoot already exists", func() {
-			It("should store the specified value so it can be retrieved later", func() {
-				// Arrange
-				idr := newInputDataRegistry()
-				idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
-
-				// Act
-				idr.SetShootAuthSecret(nsName, shootAuthSecret)
+	})
+	Describe("SetShootScrapeRequestSettings", func() {
+		It("should expose a copy of the settings in the scrape context, and remove them when passed nil", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			proxyURL, _ := url.Parse("http://proxy:3128")
+			settings := &ShootScrapeRequestSettings{Headers: http.Header{"X-Token": {"abc"}}, ProxyURL: proxyURL}
 
-				// Assert
-				Expect(idr.GetShootAuthSecret(nsName)).To(Equal(shootAuthSecret))
-			})
-			It("should store an empty value but not delete the shoot if it contains Kapis", func() {
-				// Arrange
-				idr := newInputDataRegistry()
-				idr.SetKapiData(nsName, podName, podUid, nil, metricsURL) // Shoot with non-empty auth secret
-				idr.SetShootAuthSecret(nsName, shootAuthSecret)
-				idr.SetKapiData(nsName+"2", podName, podUid, nil, metricsURL) // Shoot with empty auth secret
+			// Act
+			idr.SetShootScrapeRequestSettings(nsName, settings)
+			settings.Headers.Set("X-Token", "modified")
+			proxyURL.Host = "modified"
+			recorded := idr.GetScrapeContext(nsName, podName).RequestSettings
+			idr.SetShootScrapeRequestSettings(nsName, nil)
+
+			// Assert
+			Expect(recorded).NotTo(BeNil())
+			Expect(recorded.Headers.Get("X-Token")).To(Equal("abc"))
+			Expect(recorded.ProxyURL.String()).To(Equal("http://proxy:3128"))
+			Expect(idr.GetScrapeContext(nsName, podName).RequestSettings).To(BeNil())
+		})
+		It("should keep the shoot, while it holds request settings, and delete it once it holds no more information", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetShootScrapeRequestSettings(nsName, &ShootScrapeRequestSettings{Headers: http.Header{"X-Token": {"abc"}}})
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetShootAuthSecret(nsName, "secret")
+
+			// Act
+			idr.RemoveKapiData(nsName, podName)
+			idr.SetShootAuthSecret(nsName, "")
+			shootCountWithSettings := len(idr.allShoots())
+			idr.SetShootScrapeRequestSettings(nsName, nil)
+
+			// Assert
+			Expect(shootCountWithSettings).To(Equal(1))
+			Expect(idr.allShoots()).To(BeEmpty())
+		})
+	})
+	Describe("SetKapiScrapeResult", func() {
+		It("should record the request count and the inflight request count, and reset the fault count", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorNetwork)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName,
+				KapiScrapeResult{TotalRequestCount: 42, InflightRequestCount: 7, HasInflightRequestCount: true})
+
+			// Assert
+			kapi := idr.GetKapiData(nsName, podName)
+			Expect(kapi.TotalRequestCountNew).To(Equal(int64(42)))
+			Expect(kapi.MetricsTimeNew).To(Equal(gcmtesting.NewTime(1, 0, 0)))
+			Expect(kapi.InflightRequestCount).To(Equal(int64(7)))
+			Expect(kapi.InflightRequestTime).To(Equal(gcmtesting.NewTime(1, 0, 0)))
+			Expect(kapi.FaultCount).To(BeZero())
+		})
+		It("should record the process start time, and keep it if the result carries none", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiScrapeResult(nsName, podName,
+				KapiScrapeResult{TotalRequestCount: 42, ProcessStartTime: gcmtesting.NewTime(0, 30, 0)})
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0)
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{TotalRequestCount: 43})
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName).ProcessStartTime).To(Equal(gcmtesting.NewTime(0, 30, 0)))
+			Expect(idr.DataSource().GetShootKapis(nsName)[0].ProcessStartTime()).To(Equal(gcmtesting.NewTime(0, 30, 0)))
+		})
+		It("should record the scrape duration, even if the sample comes too soon to be recorded", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiScrapeResult(nsName, podName,
+				KapiScrapeResult{TotalRequestCount: 42, ScrapeDuration: 100 * time.Millisecond})
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 1)
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName,
+				KapiScrapeResult{TotalRequestCount: 43, ScrapeDuration: 200 * time.Millisecond})
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{TotalRequestCount: 43})
+
+			// Assert
+			expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}
+			Expect(idr.GetKapiData(nsName, podName).ScrapeDurationHistory.Durations()).To(Equal(expected))
+			Expect(idr.DataSource().GetShootKapis(nsName)[0].ScrapeDurationHistory()).To(Equal(expected))
+		})
+		It("should apply the same sample gap rules as SetKapiMetrics, but still record the inflight request count", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{TotalRequestCount: 42})
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 1)
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName,
+				KapiScrapeResult{TotalRequestCount: 43, InflightRequestCount: 7, HasInflightRequestCount: true})
+
+			// Assert
+			kapi := idr.GetKapiData(nsName, podName)
+			Expect(kapi.TotalRequestCountNew).To(Equal(int64(42)))
+			Expect(kapi.MetricsTimeNew).To(Equal(gcmtesting.NewTime(1, 0, 0)))
+			Expect(kapi.InflightRequestCount).To(Equal(int64(7)))
+			Expect(kapi.InflightRequestTime).To(Equal(gcmtesting.NewTime(1, 0, 1)))
+		})
+		It("should record the error counts along with the request count, keeping the previous sample", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiScrapeResult(nsName, podName,
+				KapiScrapeResult{TotalRequestCount: 42, ClientErrorCount: 3, ServerErrorCount: 1})
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0)
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName,
+				KapiScrapeResult{TotalRequestCount: 52, ClientErrorCount: 5, ServerErrorCount: 4})
+
+			// Assert
+			kapi := idr.GetKapiData(nsName, podName)
+			Expect(kapi.ClientErrorCountOld).To(Equal(int64(3)))
+			Expect(kapi.ServerErrorCountOld).To(Equal(int64(1)))
+			Expect(kapi.ClientErrorCountNew).To(Equal(int64(5)))
+			Expect(kapi.ServerErrorCountNew).To(Equal(int64(4)))
+			Expect(kapi.MetricsTimeNew).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+		})
+		It("should leave the inflight request count unchanged, if the result has none", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiInflightRequests(nsName, podName, 7)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{TotalRequestCount: 42})
+
+			// Assert
+			kapi := idr.GetKapiData(nsName, podName)
+			Expect(kapi.InflightRequestCount).To(Equal(int64(7)))
+			Expect(kapi.InflightRequestTime).To(Equal(gcmtesting.NewTime(1, 0, 0)))
+		})
+		It("should record the process CPU and memory usage, keeping the previous CPU sample", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiScrapeResult(nsName, podName,
+				KapiScrapeResult{TotalRequestCount: 42, CPUSeconds: 10, HasCPUSeconds: true})
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0)
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{
+				TotalRequestCount:      43,
+				CPUSeconds:             25.5,
+				HasCPUSeconds:          true,
+				ResidentMemoryBytes:    1000,
+				HasResidentMemoryBytes: true,
+			})
+
+			// Assert
+			kapi := idr.GetKapiData(nsName, podName)
+			Expect(kapi.CPUSecondsOld).To(Equal(10.0))
+			Expect(kapi.CPUSampleTimeOld).To(Equal(gcmtesting.NewTime(1, 0, 0)))
+			Expect(kapi.CPUSecondsNew).To(Equal(25.5))
+			Expect(kapi.CPUSampleTimeNew).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+			Expect(kapi.ResidentMemoryBytes).To(Equal(int64(1000)))
+			Expect(kapi.MemorySampleTime).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+		})
+		It("should discard the previous CPU sample, if the CPU time decreased", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiScrapeResult(nsName, podName,
+				KapiScrapeResult{TotalRequestCount: 42, CPUSeconds: 100, HasCPUSeconds: true})
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0)
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName,
+				KapiScrapeResult{TotalRequestCount: 43, CPUSeconds: 2, HasCPUSeconds: true})
+
+			// Assert
+			kapi := idr.GetKapiData(nsName, podName)
+			Expect(kapi.CPUSecondsNew).To(Equal(2.0))
+			Expect(kapi.CPUSampleTimeNew).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+			Expect(kapi.CPUSampleTimeOld).To(BeZero())
+		})
+		It("should record the request duration totals, keeping the previous sample", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{
+				TotalRequestCount:      42,
+				RequestDurationSeconds: 3.5,
+				RequestDurationCount:   40,
+				HasRequestDuration:     true,
+			})
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0)
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{
+				TotalRequestCount:      52,
+				RequestDurationSeconds: 4.5,
+				RequestDurationCount:   50,
+				HasRequestDuration:     true,
+			})
+
+			// Assert
+			kapi := idr.GetKapiData(nsName, podName)
+			Expect(kapi.RequestDurationSecondsOld).To(Equal(3.5))
+			Expect(kapi.RequestDurationCountOld).To(Equal(int64(40)))
+			Expect(kapi.RequestDurationTimeOld).To(Equal(gcmtesting.NewTime(1, 0, 0)))
+			Expect(kapi.RequestDurationSecondsNew).To(Equal(4.5))
+			Expect(kapi.RequestDurationCountNew).To(Equal(int64(50)))
+			Expect(kapi.RequestDurationTimeNew).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+		})
+		It("should discard the previous request duration sample, if the request count decreased", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, newPodLabels(), metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{
+				TotalRequestCount:      42,
+				RequestDurationSeconds: 3.5,
+				RequestDurationCount:   40,
+				HasRequestDuration:     true,
+			})
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0)
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{
+				TotalRequestCount:      5,
+				RequestDurationSeconds: 0.5,
+				RequestDurationCount:   4,
+				HasRequestDuration:     true,
+			})
+
+			// Assert
+			kapi := idr.GetKapiData(nsName, podName)
+			Expect(kapi.RequestDurationCountNew).To(Equal(int64(4)))
+			Expect(kapi.RequestDurationTimeNew).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+			Expect(kapi.RequestDurationTimeOld).To(BeZero())
+		})
+		It("should have no effect if the Kapi is not in the registry", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+
+			// Act
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{TotalRequestCount: 42})
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName)).To(BeNil())
+		})
+	})
+
+	Describe("SetKapiLastScrapeTime", func() {
+		It("should set the correct value", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			scrapeTime := gcmtesting.NewTime(5, 0, 0)
+
+			// Act
+			idr.SetKapiLastScrapeTime(nsName, podName, scrapeTime)
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName).LastMetricsScrapeTime).To(Equal(scrapeTime))
+		})
+		It("should have no effect if the kapi is missing", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			scrapeTime := gcmtesting.NewTime(5, 0, 0)
+
+			// Act
+			idr.SetKapiLastScrapeTime(nsName, podName, scrapeTime)
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName)).To(BeNil())
+		})
+	})
+	Describe("SetKapiScrapePeriod", func() {
+		It("should set the value, and notify watchers of the change", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			eventWatcher := newMockWatcher()
+			idr.AddKapiWatcher(&eventWatcher.Watcher, false)
+
+			// Act
+			idr.SetKapiScrapePeriod(nsName, podName, 15*time.Second)
+
+			// Assert
+			idr.waitForKapiWatchers()
+			Expect(idr.GetKapiData(nsName, podName).ScrapePeriod).To(Equal(15 * time.Second))
+			Expect(eventWatcher.EventTypes).To(Equal([]KapiEventType{KapiEventUpdate}))
+		})
+		It("should not notify watchers if the value does not change", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetKapiScrapePeriod(nsName, podName, 15*time.Second)
+			eventWatcher := newMockWatcher()
+			idr.AddKapiWatcher(&eventWatcher.Watcher, false)
+
+			// Act
+			idr.SetKapiScrapePeriod(nsName, podName, 15*time.Second)
+
+			// Assert
+			idr.waitForKapiWatchers()
+			Expect(eventWatcher.EventTypes).To(BeEmpty())
+		})
+		It("should have no effect if the kapi is missing", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+
+			// Act
+			idr.SetKapiScrapePeriod(nsName, podName, 15*time.Second)
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName)).To(BeNil())
+		})
+	})
+	Describe("SetKapiExtraMetricsUrls", func() {
+		const extraURL = "https://10.0.0.1:9443/metrics"
+
+		It("should set the value, and reset the fault count and the cumulative samples, if the value changes", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{
+				TotalRequestCount:      42,
+				CPUSeconds:             1.5,
+				HasCPUSeconds:          true,
+				ResidentMemoryBytes:    1024,
+				HasResidentMemoryBytes: true,
+			})
+			idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorNetwork)
+
+			// Act
+			idr.SetKapiExtraMetricsUrls(nsName, podName, []string{extraURL})
+
+			// Assert
+			kapi := idr.GetKapiData(nsName, podName)
+			Expect(kapi.ExtraMetricsUrls).To(Equal([]string{extraURL}))
+			Expect(kapi.FaultCount).To(BeZero())
+			Expect(kapi.TotalRequestCountNew).To(BeZero())
+			Expect(kapi.MetricsTimeNew).To(BeZero())
+			Expect(kapi.CPUSampleTimeNew).To(BeZero())
+			Expect(kapi.ResidentMemoryBytes).To(Equal(int64(1024)))
+			Expect(idr.GetScrapeContext(nsName, podName).ExtraMetricsUrls).To(Equal([]string{extraURL}))
+		})
+		It("should reset the request count history, if the value changes", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			idr.SetKapiMetrics(nsName, podName, 42)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0)
+			idr.SetKapiMetrics(nsName, podName, 50)
+			Expect(idr.GetKapiData(nsName, podName).RequestCountHistory.Len()).To(Equal(2))
+
+			// Act
+			idr.SetKapiExtraMetricsUrls(nsName, podName, []string{extraURL})
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName).RequestCountHistory.Len()).To(BeZero())
+			Expect(idr.DataSource().GetShootKapis(nsName)[0].RequestCountHistory()).To(BeEmpty())
+		})
+		It("should not reset the samples if the value does not change", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetKapiExtraMetricsUrls(nsName, podName, []string{extraURL})
+			idr.SetKapiMetrics(nsName, podName, 42)
+
+			// Act
+			idr.SetKapiExtraMetricsUrls(nsName, podName, []string{extraURL})
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName).TotalRequestCountNew).To(Equal(int64(42)))
+		})
+		It("should have no effect if the kapi is missing", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+
+			// Act
+			idr.SetKapiExtraMetricsUrls(nsName, podName, []string{extraURL})
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName)).To(BeNil())
+		})
+	})
+	Describe("SetKapiReady", func() {
+		It("should record the readiness, and change the shoot generation, if the readiness changes", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			generation := idr.DataSource().GetShootGeneration(nsName)
+
+			// Act and assert
+			Expect(idr.DataSource().GetShootKapis(nsName)[0].IsReady()).To(BeTrue())
+			idr.SetKapiReady(nsName, podName, false)
+			Expect(idr.GetKapiData(nsName, podName).NotReady).To(BeTrue())
+			Expect(idr.DataSource().GetShootKapis(nsName)[0].IsReady()).To(BeFalse())
+			Expect(idr.DataSource().GetShootGeneration(nsName)).To(BeNumerically(">", generation))
+			generation = idr.DataSource().GetShootGeneration(nsName)
+			idr.SetKapiReady(nsName, podName, false)
+			Expect(idr.DataSource().GetShootGeneration(nsName)).To(Equal(generation))
+		})
+		It("should have no effect if the kapi is missing", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+
+			// Act
+			idr.SetKapiReady(nsName, podName, false)
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName)).To(BeNil())
+		})
+	})
+	Describe("NotifyKapiMetricsFault", func() {
+		It("should increment the count and return the new value", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			Expect(idr.GetKapiData(nsName, podName).FaultCount).To(Equal(0))
+
+			// Act and assert
+			res := idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorNetwork)
+			Expect(res).To(Equal(1))
+			Expect(idr.GetKapiData(nsName, podName).FaultCount).To(Equal(1))
+			res = idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorNetwork)
+			Expect(res).To(Equal(2))
+			Expect(idr.GetKapiData(nsName, podName).FaultCount).To(Equal(2))
+		})
+		It("should record the category of the most recent fault, and clear it upon success", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+
+			// Act and assert
+			idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorNetwork)
+			idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorAuth)
+			Expect(idr.GetKapiData(nsName, podName).LastFaultCategory).To(Equal(ScrapeErrorAuth))
+			idr.SetKapiMetrics(nsName, podName, 1)
+			Expect(idr.GetKapiData(nsName, podName).LastFaultCategory).To(BeEmpty())
+		})
+	})
+	Describe("ImportKapiData", func() {
+		newImportedKapi := func() *KapiData {
+			kapi := NewKapiData(nsName, podName)
+			kapi.PodUID = podUid
+			kapi.PodLabels = newPodLabels()
+			kapi.MetricsUrl = metricsURL
+			kapi.TotalRequestCountNew, kapi.MetricsTimeNew = 42, gcmtesting.NewTime(10, 1, 0)
+			kapi.TotalRequestCountOld, kapi.MetricsTimeOld = 12, gcmtesting.NewTime(10, 0, 0)
+			kapi.RequestCountHistory.Add(RequestCountSample{TotalRequestCount: 12, Time: kapi.MetricsTimeOld})
+			kapi.RequestCountHistory.Add(RequestCountSample{TotalRequestCount: 42, Time: kapi.MetricsTimeNew})
+			kapi.FaultCount, kapi.LastFaultCategory = 3, ScrapeErrorNetwork
+			return kapi
+		}
+
+		It("should create a missing record, without the fault state, and notify watchers", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			eventWatcher := newMockWatcher()
+			idr.AddKapiWatcher(&eventWatcher.Watcher, false)
+			var namespaces []string
+			var sampleWatcher SampleWatcher = func(shootNamespace string) {
+				namespaces = append(namespaces, shootNamespace)
+			}
+			idr.AddSampleWatcher(&sampleWatcher)
+
+			// Act
+			idr.ImportKapiData(newImportedKapi())
+
+			// Assert
+			idr.waitForKapiWatchers()
+			idr.waitForSampleWatchers()
+			expected := newImportedKapi()
+			expected.FaultCount, expected.LastFaultCategory = 0, ""
+			Expect(idr.GetKapiData(nsName, podName)).To(Equal(expected))
+			Expect(eventWatcher.EventTypes).To(Equal([]KapiEventType{KapiEventCreate}))
+			Expect(namespaces).To(Equal([]string{nsName}))
+			Expect(idr.DataSource().GetShootKapis(nsName)[0].TotalRequestCountNew()).To(Equal(int64(42)))
+		})
+		It("should replace an existing record, but retain its fault state", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, "https://old:123/metrics")
+			idr.SetKapiMetrics(nsName, podName, 7)
+			idr.NotifyKapiMetricsFault(nsName, podName, ScrapeErrorAuth)
+			eventWatcher := newMockWatcher()
+			idr.AddKapiWatcher(&eventWatcher.Watcher, false)
+			imported := newImportedKapi()
+
+			// Act
+			idr.ImportKapiData(imported)
+
+			// Assert
+			idr.waitForKapiWatchers()
+			kapi := idr.GetKapiData(nsName, podName)
+			Expect(kapi.MetricsUrl).To(Equal(metricsURL))
+			Expect(kapi.TotalRequestCountNew).To(Equal(int64(42)))
+			Expect(kapi.RequestCountHistory.Samples()).To(Equal(imported.RequestCountHistory.Samples()))
+			Expect(kapi.FaultCount).To(Equal(1))
+			Expect(kapi.LastFaultCategory).To(Equal(ScrapeErrorAuth))
+			Expect(eventWatcher.EventTypes).To(BeEmpty())
+		})
+		It("should notify watchers if the scrape period changes", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.ImportKapiData(newImportedKapi())
+			eventWatcher := newMockWatcher()
+			idr.AddKapiWatcher(&eventWatcher.Watcher, false)
+			imported := newImportedKapi()
+			imported.ScrapePeriod = 15 * time.Second
+
+			// Act
+			idr.ImportKapiData(imported)
+
+			// Assert
+			idr.waitForKapiWatchers()
+			Expect(idr.GetKapiData(nsName, podName).ScrapePeriod).To(Equal(15 * time.Second))
+			Expect(eventWatcher.EventTypes).To(Equal([]KapiEventType{KapiEventUpdate}))
+		})
+		It("should not share state with the imported object", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			imported := newImportedKapi()
+
+			// Act
+			idr.ImportKapiData(imported)
+			imported.PodLabels["k1"] = "changed"
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName).PodLabels).To(Equal(newPodLabels()))
+		})
+	})
+	Describe("GetScrapeCoverage", func() {
+		// Creates a registry with a 1 minute scrape period, and records a sample, taken at the specified time, for each
+		// of the specified pods
+		arrangeCoverageTest := func(sampleTime time.Time, namespace string, podNames ...string) *inputDataRegistry {
+			idr := newInputDataRegistry()
+			idr.SetDefaultScrapePeriod(time.Minute)
+			idr.testIsolation.TimeNow = func() time.Time { return sampleTime }
+			for _, name := range podNames {
+				idr.SetKapiData(namespace, name, podUid, nil, metricsURL)
+				idr.SetKapiMetrics(namespace, name, 1)
+			}
+			return idr
+		}
+
+		It("should count the Kapis of each shoot, and how many of them have a sample no older than the scrape "+
+			"period, plus a quarter", func() {
+
+			// Arrange
+			idr := arrangeCoverageTest(gcmtesting.NewTime(1, 0, 0), nsName, "fresh")
+			idr.SetKapiData(nsName, "no-sample", podUid, nil, metricsURL)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(0, 58, 0)
+			idr.SetKapiData(nsName, "stale", podUid, nil, metricsURL)
+			idr.SetKapiMetrics(nsName, "stale", 1)
+			idr.SetKapiData("other", "other-pod", podUid, nil, metricsURL)
+			idr.SetKapiMetrics("other", "other-pod", 1)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 15)
+
+			// Act
+			coverage := idr.GetScrapeCoverage()
+
+			// Assert
+			Expect(coverage).To(Equal(map[string]ScrapeCoverage{
+				nsName:  {KapiCount: 3, FreshKapiCount: 1},
+				"other": {KapiCount: 1, FreshKapiCount: 0},
+			}))
+		})
+
+		It("should apply a Kapi's own scrape period, if it overrides the default one", func() {
+			// Arrange
+			idr := arrangeCoverageTest(gcmtesting.NewTime(1, 0, 0), nsName, podName)
+			idr.SetKapiScrapePeriod(nsName, podName, 10*time.Minute)
+			idr.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 5, 0)
+
+			// Act
+			coverage := idr.GetScrapeCoverage()
+
+			// Assert
+			Expect(coverage[nsName]).To(Equal(ScrapeCoverage{KapiCount: 1, FreshKapiCount: 1}))
+		})
+
+		It("should not count Kapis which the scraper skips, and omit shoots which only have such Kapis", func() {
+			// Arrange
+			idr := arrangeCoverageTest(gcmtesting.NewTime(1, 0, 0), nsName, podName, "excluded")
+			idr.SetKapiData("other", "other-pod", podUid, nil, metricsURL)
+
+			// Act
+			idr.SetKapiScrapeExcluded(nsName, "excluded", true)
+			idr.SetKapiScrapeExcluded("other", "other-pod", true)
+			idr.SetKapiScrapeExcluded(nsName, "no-such-pod", true)
+			coverage := idr.GetScrapeCoverage()
+
+			// Assert
+			Expect(coverage).To(Equal(map[string]ScrapeCoverage{nsName: {KapiCount: 1, FreshKapiCount: 1}}))
+			Expect(idr.GetKapiData(nsName, "excluded").ScrapeExcluded).To(BeTrue())
+		})
+	})
+	Describe("ScrapeCoverage", func() {
+		It("should calculate the ratio of fresh Kapis, with a set without Kapis being fully covered", func() {
+			Expect(ScrapeCoverage{KapiCount: 4, FreshKapiCount: 3}.Ratio()).To(Equal(0.75))
+			Expect(ScrapeCoverage{}.Ratio()).To(Equal(float64(1)))
+			Expect(ScrapeCoverage{KapiCount: 4, FreshKapiCount: 3}.Add(ScrapeCoverage{KapiCount: 1})).
+				To(Equal(ScrapeCoverage{KapiCount: 5, FreshKapiCount: 3}))
+		})
+	})
+	Describe("GetShootAuthSecret", func() {
+		It("should return empty string if shoot is missing", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+
+			// Act
+			res := idr.GetShootAuthSecret("AnotherNS")
+
+			// Assert
+			Expect(res).To(Equal(""))
+		})
+		It("should not create the shoot if it is missing", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+
+			// Act
+			idr.GetShootAuthSecret(nsName)
+
+			// Assert
+			Expect(idr.allShoots()).To(BeEmpty())
+		})
+		It("should return the last stored value", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetShootAuthSecret(nsName, shootAuthSecret)
+
+			// Act
+			res := idr.GetShootAuthSecret(nsName)
+
+			// Assert
+			Expect(res).To(Equal(shootAuthSecret))
+		})
+	})
+	Describe("SetShootAuthDegraded", func() {
+		It("should expose the reason in the scrape context, until the auth secret changes", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetShootAuthSecret(nsName, shootAuthSecret)
+
+			// Act
+			idr.SetShootAuthDegraded(nsName, "token expired")
+
+			// Assert
+			Expect(idr.GetScrapeContext(nsName, podName).AuthDegradedReason).To(Equal("token expired"))
+			idr.SetShootAuthSecret(nsName, shootAuthSecret+"2")
+			Expect(idr.GetScrapeContext(nsName, podName).AuthDegradedReason).To(BeEmpty())
+		})
+		It("should have no effect, if the shoot has no auth secret", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+
+			// Act
+			idr.SetShootAuthDegraded(nsName, "token expired")
+
+			// Assert
+			Expect(idr.GetScrapeContext(nsName, podName).AuthDegradedReason).To(BeEmpty())
+		})
+	})
+
+	Describe("SetShootAuthSecret", func() {
+		Context("when the shoot does not exist", func() {
+			It("should store the specified value so it can be retrieved later", func() {
+				// Arrange
+				idr := newInputDataRegistry()
+
+				// Act
+				idr.SetShootAuthSecret(nsName, shootAuthSecret)
+
+				// Assert
+				Expect(idr.GetShootAuthSecret(nsName)).To(Equal(shootAuthSecret))
+			})
+			It("should have no effect if the specified value is empty", func() {
+				// Arrange
+				idr := newInputDataRegistry()
+
+				// Act
+				idr.SetShootAuthSecret(nsName, "")
+
+				// Assert
+				Expect(idr.allShoots()).To(BeEmpty())
+			})
+		})
+		Context("when the shoot already exists", func() {
+			It("should store the specified value so it can be retrieved later", func() {
+				// Arrange
+				idr := newInputDataRegistry()
+				idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+
+				// Act
+				idr.SetShootAuthSecret(nsName, shootAuthSecret)
+
+				// Assert
+				Expect(idr.GetShootAuthSecret(nsName)).To(Equal(shootAuthSecret))
+			})
+			It("should store an empty value but not delete the shoot if it contains Kapis", func() {
+				// Arrange
+				idr := newInputDataRegistry()
+				idr.SetKapiData(nsName, podName, podUid, nil, metricsURL) // Shoot with non-empty auth secret
+				idr.SetShootAuthSecret(nsName, shootAuthSecret)
+				idr.SetKapiData(nsName+"2", podName, podUid, nil, metricsURL) // Shoot with empty auth secret
 
 				// Act
 				idr.SetShootAuthSecret(nsName, "")
@@ -562,7 +1648,7 @@ var _ = Describe("input.input_data_registry", func() {
 				idr.SetShootAuthSecret(nsName+"2", "")
 
 				// Assert
-				Expect(idr.shoots).To(BeEmpty())
+				Expect(idr.allShoots()).To(BeEmpty())
 			})
 		})
 	})
@@ -586,7 +1672,7 @@ var _ = Describe("input.input_data_registry", func() {
 			idr.GetShootCACertificate(nsName)
 
 			// Assert
-			Expect(idr.shoots).To(BeEmpty())
+			Expect(idr.allShoots()).To(BeEmpty())
 		})
 		It("should return the last stored value", func() {
 			// Arrange
@@ -612,7 +1698,7 @@ var _ = Describe("input.input_data_registry", func() {
 				idr.SetShootCACertificate(nsName, shootCACert)
 
 				// Assert
-				Expect(testutil.IsEqualCert(idr.GetShootCACertificate(nsName), shootCACert)).To(BeTrue())
+				Expect(gcmtesting.IsEqualCert(idr.GetShootCACertificate(nsName), shootCACert)).To(BeTrue())
 			})
 			It("should have no effect if the specified value is empty", func() {
 				// Arrange
@@ -622,7 +1708,7 @@ var _ = Describe("input.input_data_registry", func() {
 				idr.SetShootCACertificate(nsName, nil)
 
 				// Assert
-				Expect(idr.shoots).To(BeEmpty())
+				Expect(idr.allShoots()).To(BeEmpty())
 			})
 		})
 		Context("when the shoot already exists", func() {
@@ -635,7 +1721,39 @@ var _ = Describe("input.input_data_registry", func() {
 				idr.SetShootCACertificate(nsName, shootCACert)
 
 				// Assert
-				Expect(testutil.IsEqualCert(idr.GetShootCACertificate(nsName), shootCACert)).To(BeTrue())
+				Expect(gcmtesting.IsEqualCert(idr.GetShootCACertificate(nsName), shootCACert)).To(BeTrue())
+			})
+			It("should keep the same CertPool object and hash if the content is unchanged", func() {
+				// Arrange
+				idr := newInputDataRegistry()
+				idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+				idr.SetShootCACertificate(nsName, shootCACert)
+				oldPool := idr.GetShootCACertificate(nsName)
+				oldHash := idr.GetScrapeContext(nsName, podName).CACertHash
+
+				// Act
+				idr.SetShootCACertificate(nsName, bytes.Clone(shootCACert))
+
+				// Assert
+				Expect(idr.GetShootCACertificate(nsName) == oldPool).To(BeTrue())
+				Expect(idr.GetScrapeContext(nsName, podName).CACertHash).To(Equal(oldHash))
+			})
+			It("should replace the CertPool object and hash if the content changes", func() {
+				// Arrange
+				idr := newInputDataRegistry()
+				idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+				idr.SetShootCACertificate(nsName, shootCACert)
+				oldPool := idr.GetShootCACertificate(nsName)
+				oldHash := idr.GetScrapeContext(nsName, podName).CACertHash
+				newCACert := gcmtesting.GetExampleCACert(1)
+
+				// Act
+				idr.SetShootCACertificate(nsName, newCACert)
+
+				// Assert
+				Expect(idr.GetShootCACertificate(nsName) == oldPool).To(BeFalse())
+				Expect(gcmtesting.IsEqualCert(idr.GetShootCACertificate(nsName), newCACert)).To(BeTrue())
+				Expect(idr.GetScrapeContext(nsName, podName).CACertHash).NotTo(Equal(oldHash))
 			})
 			It("should store an empty value but not delete the shoot if it contains Kapis", func() {
 				// Arrange
@@ -685,7 +1803,7 @@ var _ = Describe("input.input_data_registry", func() {
 				idr.SetShootCACertificate(nsName+"2", nil)
 
 				// Assert
-				Expect(idr.shoots).To(BeEmpty())
+				Expect(idr.allShoots()).To(BeEmpty())
 			})
 		})
 	})
@@ -700,6 +1818,7 @@ var _ = Describe("input.input_data_registry", func() {
 			idr.AddKapiWatcher(&watcher.Watcher, false)
 
 			// Assert
+			idr.waitForKapiWatchers()
 			Expect(watcher.EventTypes).To(BeEmpty())
 		})
 		It("should notify the watcher of existing objects, if the caller has requested so", func() {
@@ -713,8 +1832,25 @@ var _ = Describe("input.input_data_registry", func() {
 			idr.AddKapiWatcher(&watcher.Watcher, true)
 
 			// Assert
+			idr.waitForKapiWatchers()
 			Expect(watcher.EventTypes).To(HaveLen(2))
 		})
+		It("should notify the watcher of existing objects across all shoots, if the caller has requested so", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			watcher := newMockWatcher()
+			for i := 0; i < 20; i++ {
+				idr.SetKapiData(fmt.Sprintf("%s%d", nsName, i), podName, podUid, nil, metricsURL)
+			}
+
+			// Act
+			idr.AddKapiWatcher(&watcher.Watcher, true)
+
+			// Assert
+			idr.waitForKapiWatchers()
+			Expect(watcher.EventTypes).To(HaveLen(20))
+			Expect(watcher.EventTypes).To(HaveEach(KapiEventCreate))
+		})
 	})
 	Describe("RemoveKapiWatcher", func() {
 		It("should remove the specified watcher so it does not receive notifications for subsequent changes", func() {
@@ -728,6 +1864,7 @@ var _ = Describe("input.input_data_registry", func() {
 			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
 
 			// Assert
+			idr.waitForKapiWatchers()
 			Expect(watcher.EventTypes).To(BeEmpty())
 		})
 		It("should have no effect if called for a watcher which is currently not registered", func() {
@@ -746,9 +1883,185 @@ var _ = Describe("input.input_data_registry", func() {
 			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
 
 			// Assert
+			idr.waitForKapiWatchers()
 			Expect(watcher1.EventTypes).To(HaveLen(1))
 			Expect(watcher2.EventTypes).To(BeEmpty())
 			Expect(watcher3.EventTypes).To(BeEmpty())
 		})
+		It("should wait for the event in flight, and discard the events still buffered", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			release := make(chan struct{})
+			var deliveredCount atomic.Int32
+			var watcher KapiWatcher = func(_ ShootKapi, _ KapiEventType) {
+				deliveredCount.Add(1)
+				<-release
+			}
+			idr.AddKapiWatcher(&watcher, false)
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetKapiData(nsName, podName+"2", podUid, nil, metricsURL)
+			Eventually(deliveredCount.Load).Should(Equal(int32(1)))
+			var isRemoved atomic.Bool
+
+			// Act
+			go func() {
+				idr.RemoveKapiWatcher(&watcher)
+				isRemoved.Store(true)
+			}()
+
+			// Assert
+			Consistently(isRemoved.Load).Should(BeFalse())
+			close(release)
+			Eventually(isRemoved.Load).Should(BeTrue())
+			Expect(deliveredCount.Load()).To(Equal(int32(1)))
+		})
+	})
+	Describe("GetGeneration", func() {
+		It("should advance upon a change to any shoot", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			ds := idr.DataSource()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			before := ds.GetGeneration()
+
+			// Act
+			idr.SetKapiData(nsName+"2", podName, podUid, nil, metricsURL)
+			afterAdd := ds.GetGeneration()
+			idr.SetKapiMetrics(nsName, podName, 42)
+
+			// Assert
+			Expect(afterAdd).To(BeNumerically(">", before))
+			Expect(ds.GetGeneration()).To(BeNumerically(">", afterAdd))
+		})
 	})
+	Describe("AddSampleWatcher", func() {
+		It("should notify the watcher of new samples, and not of Kapis being added or removed", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			var namespaces []string
+			var watcher SampleWatcher = func(shootNamespace string) {
+				namespaces = append(namespaces, shootNamespace)
+			}
+			idr.AddSampleWatcher(&watcher)
+
+			// Act and assert
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetKapiData(nsName+"2", podName, podUid, nil, metricsURL)
+			idr.waitForSampleWatchers()
+			Expect(namespaces).To(BeEmpty())
+
+			idr.SetKapiMetrics(nsName, podName, 42)
+			idr.waitForSampleWatchers()
+			idr.SetKapiInflightRequests(nsName+"2", podName, 5)
+			idr.waitForSampleWatchers()
+			idr.SetKapiScrapeResult(nsName, podName, KapiScrapeResult{TotalRequestCount: 43})
+			idr.waitForSampleWatchers()
+			Expect(namespaces).To(Equal([]string{nsName, nsName + "2", nsName}))
+
+			idr.RemoveKapiData(nsName, podName)
+			idr.waitForSampleWatchers()
+			Expect(namespaces).To(HaveLen(3))
+		})
+		It("should coalesce the notifications for a shoot, while one is pending delivery", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			idr.SetKapiData(nsName+"2", podName, podUid, nil, metricsURL)
+			release := make(chan struct{})
+			var namespaces []string
+			var deliveredCount atomic.Int32
+			var watcher SampleWatcher = func(shootNamespace string) {
+				namespaces = append(namespaces, shootNamespace)
+				deliveredCount.Add(1)
+				<-release
+			}
+			idr.AddSampleWatcher(&watcher)
+			idr.SetKapiMetrics(nsName, podName, 1)
+			Eventually(deliveredCount.Load).Should(Equal(int32(1)))
+
+			// Act
+			for i := 2; i < 10; i++ {
+				idr.SetKapiMetrics(nsName, podName, int64(i))
+				idr.SetKapiMetrics(nsName+"2", podName, int64(i))
+			}
+
+			// Assert
+			close(release)
+			idr.waitForSampleWatchers()
+			Expect(namespaces).To(Equal([]string{nsName, nsName, nsName + "2"}))
+		})
+	})
+	Describe("RemoveSampleWatcher", func() {
+		It("should stop the delivery of notifications to the watcher, and return false if it is not registered", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			idr.SetKapiData(nsName, podName, podUid, nil, metricsURL)
+			var count1, count2 atomic.Int32
+			var watcher1 SampleWatcher = func(_ string) { count1.Add(1) } // This one gets added and never removed
+			var watcher2 SampleWatcher = func(_ string) { count2.Add(1) } // This one gets added, then removed twice
+			idr.AddSampleWatcher(&watcher1)
+			idr.AddSampleWatcher(&watcher2)
+
+			// Act
+			isRemoved := idr.RemoveSampleWatcher(&watcher2)
+			isRemovedAgain := idr.RemoveSampleWatcher(&watcher2)
+			idr.SetKapiMetrics(nsName, podName, 42)
+
+			// Assert
+			idr.waitForSampleWatchers()
+			Expect(isRemoved).To(BeTrue())
+			Expect(isRemovedAgain).To(BeFalse())
+			Expect(count1.Load()).To(Equal(int32(1)))
+			Expect(count2.Load()).To(BeZero())
+		})
+	})
+	Describe("event delivery", func() {
+		It("should allow the watcher to call back into the registry, and to block", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			var podNames []string
+			var watcher KapiWatcher = func(kapi ShootKapi, _ KapiEventType) {
+				// Blocks until the shard lock held by the notifying operation is released
+				podNames = append(podNames, idr.GetKapiData(kapi.ShootNamespace(), kapi.PodName()).PodName())
+			}
+			idr.AddKapiWatcher(&watcher, false)
+
+			// Act
+			for i := 0; i < 10; i++ {
+				idr.SetKapiData(nsName, fmt.Sprintf("%s%d", podName, i), podUid, nil, metricsURL)
+			}
+
+			// Assert
+			idr.waitForKapiWatchers()
+			Expect(podNames).To(HaveLen(10))
+			Expect(podNames[9]).To(Equal(podName + "9"))
+		})
+		It("should deliver a snapshot of the Kapi, as of the time of the event", func() {
+			// Arrange
+			idr := newInputDataRegistry()
+			watcher := newMockWatcher()
+			idr.AddKapiWatcher(&watcher.Watcher, false)
+
+			// Act
+			idr.SetKapiData(nsName, podName, podUid, map[string]string{"version": "1"}, metricsURL)
+			idr.SetKapiData(nsName, podName, podUid, map[string]string{"version": "2"}, metricsURL)
+
+			// Assert
+			idr.waitForKapiWatchers()
+			Expect(watcher.EventKapis).To(HaveLen(1))
+			Expect(watcher.EventKapis[0].PodLabels()).To(Equal(map[string]string{"version": "1"}))
+		})
+	})
+})
+
+var _ = Describe("EffectiveMinSampleGap", func() {
+	DescribeTable("should return the configured gap, capped at a third of the scrape period",
+		func(configuredGap time.Duration, scrapePeriod time.Duration, expected time.Duration) {
+			Expect(EffectiveMinSampleGap(configuredGap, scrapePeriod)).To(Equal(expected))
+		},
+		Entry("gap well below the scrape period", 10*time.Second, time.Minute, 10*time.Second),
+		Entry("gap above a third of the scrape period", 30*time.Second, time.Minute, 20*time.Second),
+		Entry("gap above the scrape period", 2*time.Minute, time.Minute, 20*time.Second),
+		Entry("unknown scrape period", 30*time.Second, time.Duration(0), 30*time.Second),
+	)
 })
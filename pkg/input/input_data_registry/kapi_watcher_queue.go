@@ -0,0 +1,308 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input_data_registry
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+// The reasons for which a KapiWatcher delivery counts as a fault. See kapiWatcherPolicy.
+const (
+	watcherFaultPanic = "panic" // The watcher panicked
+	watcherFaultSlow  = "slow"  // The watcher returned, but took longer than the time budget
+	watcherFaultHung  = "hung"  // The watcher has not returned for longer than the hang timeout
+)
+
+var (
+	// Tracks how long each watcher takes to process an event
+	watcherDeliverySeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gardener_custom_metrics_registry_watcher_delivery_seconds",
+			Help:    "The time taken by registry Kapi watchers to process an event, by watcher function",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		},
+		[]string{"watcher"})
+	// Counts the deliveries which counted as faults of the watcher
+	watcherFaultCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gardener_custom_metrics_registry_watcher_faults_total",
+			Help: "The number of events which registry Kapi watchers failed to process properly, by watcher " +
+				"function and reason: panic, slow (exceeded the time budget), or hung",
+		},
+		[]string{"watcher", "reason"})
+	// Counts the watchers which were unsubscribed, because they misbehaved
+	watcherRemovalCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gardener_custom_metrics_registry_watcher_removals_total",
+			Help: "The number of registry Kapi watchers which were unsubscribed automatically, because they " +
+				"repeatedly failed to process events properly, by watcher function",
+		},
+		[]string{"watcher"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(watcherDeliverySeconds, watcherFaultCount, watcherRemovalCount)
+}
+
+// kapiWatcherPolicy determines how a kapiWatcherQueue responds to a misbehaving watcher. A delivery counts as a fault,
+// if the watcher panics, or takes longer than TimeBudget. After each fault, delivery pauses for a backoff period,
+// which starts at BaseBackoff, and doubles with each consecutive fault, up to MaxBackoff. A successful delivery resets
+// the backoff. Once MaxFaults consecutive deliveries fault, or a delivery does not complete within HangTimeout, the
+// watcher is unsubscribed.
+type kapiWatcherPolicy struct {
+	TimeBudget  time.Duration
+	MaxFaults   int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	HangTimeout time.Duration
+}
+
+// defaultKapiWatcherPolicy is the kapiWatcherPolicy applied by the registry. The registry's own watchers only update
+// in-memory state, so a second per event already indicates a serious problem. A watcher which gets unsubscribed
+// usually feeds a core component, which stops working without it, so the registry reports the removal via its Kapi
+// watcher condition. See InputDataRegistry.SetKapiWatcherCondition.
+var defaultKapiWatcherPolicy = kapiWatcherPolicy{
+	TimeBudget:  time.Second,
+	MaxFaults:   5,
+	BaseBackoff: time.Second,
+	MaxBackoff:  30 * time.Second,
+	HangTimeout: 5 * time.Minute,
+}
+
+// backoff returns the period for which delivery pauses, after the specified number of consecutive faults
+func (p *kapiWatcherPolicy) backoff(faultCount int) time.Duration {
+	backoff := p.BaseBackoff
+	for i := 1; i < faultCount && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, p.MaxBackoff)
+}
+
+// kapiWatcherEvent is a single event, pending delivery to a KapiWatcher
+type kapiWatcherEvent struct {
+	kapi      ShootKapi
+	eventType KapiEventType
+}
+
+// kapiWatcherQueue delivers events to a single KapiWatcher, on a goroutine dedicated to that watcher. Events are
+// buffered without limit, so enqueueing never blocks, and the registry can enqueue while holding its locks, regardless
+// of what the watcher does. Each event carries a snapshot of the respective Kapi, taken at the time of the change.
+//
+// The queue shields the registry from a misbehaving watcher: panics are recovered, and a watcher which keeps failing
+// to process events in time is cut off, as specified by the queue's kapiWatcherPolicy. Otherwise, a hung watcher
+// would make the queue grow without limit.
+//
+// All methods are concurrency-safe.
+type kapiWatcherQueue struct {
+	watcher *KapiWatcher
+	// Identifies the watcher function in logs and metrics
+	name   string
+	policy kapiWatcherPolicy
+	log    logr.Logger
+	// Called on a separate goroutine, once the queue has cut the watcher off, with the reason. See tripThreadUnsafe.
+	onTrip  func(q *kapiWatcherQueue, reason error)
+	timeNow func() time.Time
+
+	// Synchronizes access to the fields below. Also used to signal changes to them.
+	lock sync.Mutex
+	cond *sync.Cond
+	// Events pending delivery, in order of occurrence
+	events []kapiWatcherEvent
+	// True while an event is being delivered
+	isDelivering bool
+	// When the delivery in flight started. Only meaningful while isDelivering is true.
+	deliveryStartTime time.Time
+	// The number of consecutive deliveries which faulted
+	faultCount int
+	// Once true, no further events are accepted or delivered
+	isClosed bool
+
+	// Closed along with the queue. Interrupts the backoff pause.
+	closing chan struct{}
+	// Closed once the delivery goroutine has exited
+	done chan struct{}
+}
+
+// newKapiWatcherQueue creates a kapiWatcherQueue which delivers events to the specified watcher, and starts its delivery
+// goroutine. The queue must eventually be closed, to release the goroutine, unless it cuts the watcher off, in which
+// case it calls onTrip, and closes itself. timeNow points to [time.Now].
+func newKapiWatcherQueue(
+	watcher *KapiWatcher,
+	policy kapiWatcherPolicy,
+	onTrip func(q *kapiWatcherQueue, reason error),
+	timeNow func() time.Time,
+	log logr.Logger) *kapiWatcherQueue {
+
+	name := watcherName(watcher)
+	q := &kapiWatcherQueue{
+		watcher: watcher,
+		name:    name,
+		policy:  policy,
+		log:     log.WithValues("watcher", name),
+		onTrip:  onTrip,
+		timeNow: timeNow,
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.lock)
+	go q.run()
+
+	return q
+}
+
+// watcherName returns the name of the watcher's function, e.g. "<package>.(*<type>).<method>.func1"
+func watcherName(watcher *KapiWatcher) string {
+	if function := runtime.FuncForPC(reflect.ValueOf(*watcher).Pointer()); function != nil {
+		return function.Name()
+	}
+	return "unknown"
+}
+
+// enqueue schedules the delivery of an event for the specified Kapi. The Kapi is copied, so the caller must hold the
+// lock which protects it. Has no effect if the queue is closed.
+func (q *kapiWatcherQueue) enqueue(kapi *KapiData, eventType KapiEventType) {
+	event := kapiWatcherEvent{kapi: &kapiDataAdapter{x: kapi.Copy()}, eventType: eventType}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.isClosed {
+		return
+	}
+	if q.isDelivering && q.timeNow().Sub(q.deliveryStartTime) > q.policy.HangTimeout {
+		watcherFaultCount.WithLabelValues(q.name, watcherFaultHung).Inc()
+		q.tripThreadUnsafe(fmt.Errorf("the watcher has not returned for longer than %s", q.policy.HangTimeout))
+		return
+	}
+	q.events = append(q.events, event)
+	q.cond.Broadcast()
+}
+
+// close discards pending events, and waits for the delivery of the event in flight, if any, to complete. Once close
+// returns, the watcher receives no further events. Must not be called from the watcher itself.
+func (q *kapiWatcherQueue) close() {
+	q.lock.Lock()
+	q.closeThreadUnsafe()
+	q.lock.Unlock()
+
+	<-q.done
+}
+
+// closeThreadUnsafe discards pending events, and stops the delivery goroutine, once the event in flight, if any, is
+// delivered. Has no effect if the queue is already closed.
+// The caller must hold the lock.
+func (q *kapiWatcherQueue) closeThreadUnsafe() {
+	if q.isClosed {
+		return
+	}
+	q.isClosed = true
+	q.events = nil
+	close(q.closing)
+	q.cond.Broadcast()
+}
+
+// tripThreadUnsafe cuts the watcher off, for the specified reason: closes the queue without waiting for the event in
+// flight, and notifies the owner of the queue via onTrip.
+// The caller must hold the lock.
+func (q *kapiWatcherQueue) tripThreadUnsafe(reason error) {
+	if q.isClosed {
+		return
+	}
+	q.closeThreadUnsafe()
+	watcherRemovalCount.WithLabelValues(q.name).Inc()
+	q.log.V(app.VerbosityError).Error(reason, "Kapi watcher misbehaves, unsubscribing it")
+	go q.onTrip(q, reason)
+}
+
+// run delivers events to the watcher, one at a time, in order, until the queue is closed
+func (q *kapiWatcherQueue) run() {
+	defer close(q.done)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for {
+		for len(q.events) == 0 && !q.isClosed {
+			q.cond.Wait()
+		}
+		if q.isClosed {
+			return
+		}
+		if q.faultCount > 0 {
+			// Give the watcher time to recover, before delivering further events
+			backoff := q.policy.backoff(q.faultCount)
+			q.lock.Unlock()
+			select {
+			case <-time.After(backoff):
+			case <-q.closing:
+			}
+			q.lock.Lock()
+			if q.isClosed {
+				return
+			}
+		}
+
+		event := q.events[0]
+		q.events[0] = kapiWatcherEvent{} // Release the snapshot
+		q.events = q.events[1:]
+		q.isDelivering = true
+		q.deliveryStartTime = q.timeNow()
+		q.lock.Unlock()
+
+		panicValue := q.deliver(event)
+
+		q.lock.Lock()
+		q.isDelivering = false
+		q.accountThreadUnsafe(q.timeNow().Sub(q.deliveryStartTime), panicValue)
+		q.cond.Broadcast()
+	}
+}
+
+// deliver passes the event to the watcher. Returns the value with which the watcher panicked, if it did. Otherwise,
+// nil.
+func (q *kapiWatcherQueue) deliver(event kapiWatcherEvent) (panicValue any) {
+	defer func() { panicValue = recover() }()
+
+	(*q.watcher)(event.kapi, event.eventType)
+	return nil
+}
+
+// accountThreadUnsafe records the outcome of a delivery, which took the specified time. Cuts the watcher off, if the
+// delivery was its last allowed consecutive fault.
+// The caller must hold the lock.
+func (q *kapiWatcherQueue) accountThreadUnsafe(duration time.Duration, panicValue any) {
+	watcherDeliverySeconds.WithLabelValues(q.name).Observe(duration.Seconds())
+
+	var fault error
+	var reason string
+	switch {
+	case panicValue != nil:
+		reason, fault = watcherFaultPanic, fmt.Errorf("the watcher panicked: %v", panicValue)
+	case duration > q.policy.TimeBudget:
+		reason, fault = watcherFaultSlow, fmt.Errorf("the watcher took %s, exceeding its budget of %s",
+			duration, q.policy.TimeBudget)
+	default:
+		q.faultCount = 0
+		return
+	}
+
+	q.faultCount++
+	watcherFaultCount.WithLabelValues(q.name, reason).Inc()
+	if q.faultCount >= q.policy.MaxFaults {
+		q.tripThreadUnsafe(fmt.Errorf("%d consecutive faults, the last one: %w", q.faultCount, fault))
+		return
+	}
+	q.log.V(app.VerbosityError).Error(fault, "Kapi watcher failed to process an event",
+		"consecutiveFaults", q.faultCount, "backoff", q.policy.backoff(q.faultCount))
+}
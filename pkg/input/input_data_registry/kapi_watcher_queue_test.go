@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input_data_registry
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
+)
+
+var _ = Describe("input_data_registry.kapiWatcherQueue", func() {
+	const (
+		nsName  = "MyNs"
+		podName = "MyPod"
+	)
+	var (
+		// Creates a registry whose watcher policy tolerates 3 consecutive faults, with a 10ms time budget, and a
+		// backoff short enough to not slow down the tests
+		newTestRegistry = func() *inputDataRegistry {
+			idr := NewInputDataRegistry(time.Minute, logr.Discard()).(*inputDataRegistry)
+			idr.kapiWatcherPolicy = kapiWatcherPolicy{
+				TimeBudget:  10 * time.Millisecond,
+				MaxFaults:   3,
+				BaseBackoff: time.Millisecond,
+				MaxBackoff:  time.Millisecond,
+				HangTimeout: time.Minute,
+			}
+			return idr
+		}
+		addKapis = func(idr *inputDataRegistry, count int) {
+			for i := 0; i < count; i++ {
+				idr.SetKapiData(nsName, fmt.Sprintf("%s%d", podName, i), "", nil, "")
+			}
+		}
+		watcherCount = func(idr *inputDataRegistry) int {
+			idr.lockAllShards()
+			defer idr.unlockAllShards()
+			return len(idr.kapiWatchers)
+		}
+	)
+
+	It("should recover from a panicking watcher, and keep delivering events to it", func() {
+		// Arrange
+		idr := newTestRegistry()
+		var deliveredCount atomic.Int32
+		var watcher KapiWatcher = func(_ ShootKapi, _ KapiEventType) {
+			if deliveredCount.Add(1)%2 == 1 {
+				panic("test panic")
+			}
+		}
+		idr.AddKapiWatcher(&watcher, false)
+		faultsBefore := promtestutil.ToFloat64(watcherFaultCount.WithLabelValues(watcherName(&watcher), "panic"))
+
+		// Act
+		addKapis(idr, 6)
+
+		// Assert
+		Eventually(deliveredCount.Load).Should(Equal(int32(6)))
+		idr.waitForKapiWatchers()
+		Expect(watcherCount(idr)).To(Equal(1))
+		Expect(promtestutil.ToFloat64(watcherFaultCount.WithLabelValues(watcherName(&watcher), "panic"))).
+			To(Equal(faultsBefore + 3))
+	})
+
+	It("should unsubscribe a watcher which keeps exceeding its time budget", func() {
+		// Arrange
+		idr := newTestRegistry()
+		var deliveredCount atomic.Int32
+		var watcher KapiWatcher = func(_ ShootKapi, _ KapiEventType) {
+			deliveredCount.Add(1)
+			time.Sleep(20 * time.Millisecond)
+		}
+		idr.AddKapiWatcher(&watcher, false)
+		removalsBefore := promtestutil.ToFloat64(watcherRemovalCount.WithLabelValues(watcherName(&watcher)))
+
+		// Act
+		addKapis(idr, 5)
+
+		// Assert
+		Eventually(func() int { return watcherCount(idr) }).Should(BeZero())
+		Expect(deliveredCount.Load()).To(Equal(int32(3)))
+		Expect(idr.RemoveKapiWatcher(&watcher)).To(BeFalse())
+		Expect(promtestutil.ToFloat64(watcherRemovalCount.WithLabelValues(watcherName(&watcher)))).
+			To(Equal(removalsBefore + 1))
+	})
+
+	It("should report an unsubscribed watcher via the Kapi watcher condition, which affects readiness", func() {
+		// Arrange
+		idr := newTestRegistry()
+		conditionRegistry := conditions.NewRegistry(logr.Discard())
+		idr.SetKapiWatcherCondition(conditionRegistry.NewReporter("KapiWatcherDegraded", 1, true))
+		var watcher KapiWatcher = func(_ ShootKapi, _ KapiEventType) {
+			panic("test panic")
+		}
+		idr.AddKapiWatcher(&watcher, false)
+		Expect(conditionRegistry.ReadyzCheck(nil)).To(Succeed())
+
+		// Act
+		addKapis(idr, 3)
+
+		// Assert
+		Eventually(func() int { return watcherCount(idr) }).Should(BeZero())
+		Eventually(func() error { return conditionRegistry.ReadyzCheck(nil) }).Should(
+			MatchError(ContainSubstring("unsubscribed")))
+	})
+
+	It("should only unsubscribe a watcher upon consecutive faults", func() {
+		// Arrange
+		idr := newTestRegistry()
+		var deliveredCount atomic.Int32
+		var watcher KapiWatcher = func(_ ShootKapi, _ KapiEventType) {
+			if deliveredCount.Add(1)%3 != 0 {
+				panic("test panic")
+			}
+		}
+		idr.AddKapiWatcher(&watcher, false)
+
+		// Act
+		addKapis(idr, 9)
+
+		// Assert
+		Eventually(deliveredCount.Load).Should(Equal(int32(9)))
+		idr.waitForKapiWatchers()
+		Expect(watcherCount(idr)).To(Equal(1))
+	})
+
+	It("should unsubscribe a hung watcher, once an event arrives after the hang timeout", func() {
+		// Arrange
+		idr := newTestRegistry()
+		idr.kapiWatcherPolicy.HangTimeout = 10 * time.Millisecond
+		release := make(chan struct{})
+		defer close(release)
+		var deliveredCount atomic.Int32
+		var watcher KapiWatcher = func(_ ShootKapi, _ KapiEventType) {
+			deliveredCount.Add(1)
+			<-release
+		}
+		idr.AddKapiWatcher(&watcher, false)
+		addKapis(idr, 1)
+		Eventually(deliveredCount.Load).Should(Equal(int32(1)))
+		time.Sleep(20 * time.Millisecond)
+
+		// Act
+		idr.SetKapiData(nsName, podName+"-new", "", nil, "")
+
+		// Assert
+		Eventually(func() int { return watcherCount(idr) }).Should(BeZero())
+	})
+
+	Describe("kapiWatcherPolicy.backoff", func() {
+		It("should double the backoff with each consecutive fault, up to the maximum", func() {
+			policy := kapiWatcherPolicy{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}
+			Expect(policy.backoff(1)).To(Equal(time.Second))
+			Expect(policy.backoff(2)).To(Equal(2 * time.Second))
+			Expect(policy.backoff(3)).To(Equal(4 * time.Second))
+			Expect(policy.backoff(4)).To(Equal(5 * time.Second))
+			Expect(policy.backoff(100)).To(Equal(5 * time.Second))
+		})
+	})
+})
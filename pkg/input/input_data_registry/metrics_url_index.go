@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input_data_registry
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// metricsUrlIndex maps each metrics URL to the Kapis scraped at it, across all shoots, so the Kapis at a URL can be
+// found without examining all Kapis. A Kapi is identified by shoot namespace (as namespace) and pod name (as name).
+// The zero value is an empty index. Concurrency-safe.
+//
+// The registry updates the index while holding the lock of the shard which contains the Kapi, so the index lock is
+// always acquired after a shard lock, and never the other way around.
+type metricsUrlIndex struct {
+	lock sync.Mutex
+	// Maps <metrics URL> -> <set of Kapis scraped at that URL>. Values cannot be empty.
+	kapis map[string]map[types.NamespacedName]struct{}
+}
+
+// update records that the specified Kapi is no longer scraped at oldUrls, but at newUrls. Either may be empty.
+func (idx *metricsUrlIndex) update(kapi types.NamespacedName, oldUrls []string, newUrls []string) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	for _, url := range oldUrls {
+		if kapis := idx.kapis[url]; kapis != nil {
+			delete(kapis, kapi)
+			if len(kapis) == 0 {
+				delete(idx.kapis, url)
+			}
+		}
+	}
+	for _, url := range newUrls {
+		if idx.kapis == nil {
+			idx.kapis = make(map[string]map[types.NamespacedName]struct{})
+		}
+		kapis := idx.kapis[url]
+		if kapis == nil {
+			kapis = make(map[types.NamespacedName]struct{})
+			idx.kapis[url] = kapis
+		}
+		kapis[kapi] = struct{}{}
+	}
+}
+
+// get returns the Kapis scraped at the specified URL, in no particular order
+func (idx *metricsUrlIndex) get(url string) []types.NamespacedName {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	result := make([]types.NamespacedName, 0, len(idx.kapis[url]))
+	for kapi := range idx.kapis[url] {
+		result = append(result, kapi)
+	}
+	return result
+}
+
+// metricsUrls returns all URLs at which the Kapi is scraped: its MetricsUrl, if not empty, and its ExtraMetricsUrls
+func (kapi *KapiData) metricsUrls() []string {
+	if kapi.MetricsUrl == "" {
+		return kapi.ExtraMetricsUrls
+	}
+	return append([]string{kapi.MetricsUrl}, kapi.ExtraMetricsUrls...)
+}
+
+// indexKey returns the key which identifies the Kapi in a metricsUrlIndex
+func (kapi *KapiData) indexKey() types.NamespacedName {
+	return types.NamespacedName{Namespace: kapi.shootNamespace, Name: kapi.podName}
+}
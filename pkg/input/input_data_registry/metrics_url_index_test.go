@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input_data_registry
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("input_data_registry.metricsUrlIndex", func() {
+	const (
+		url1 = "https://10.0.0.1/metrics"
+		url2 = "https://10.0.0.2/metrics"
+	)
+	kapi1 := types.NamespacedName{Namespace: "shoot--a", Name: "kube-apiserver-1"}
+	kapi2 := types.NamespacedName{Namespace: "shoot--b", Name: "kube-apiserver-1"}
+
+	It("should be empty when zero-initialized", func() {
+		// Arrange
+		var index metricsUrlIndex
+
+		// Act
+		result := index.get(url1)
+
+		// Assert
+		Expect(result).To(BeEmpty())
+	})
+
+	It("should return all Kapis scraped at the URL", func() {
+		// Arrange
+		var index metricsUrlIndex
+
+		// Act
+		index.update(kapi1, nil, []string{url1})
+		index.update(kapi2, nil, []string{url2, url1})
+
+		// Assert
+		Expect(index.get(url1)).To(ConsistOf(kapi1, kapi2))
+		Expect(index.get(url2)).To(ConsistOf(kapi2))
+	})
+
+	It("should drop the old URLs, and the URLs left without Kapis", func() {
+		// Arrange
+		var index metricsUrlIndex
+		index.update(kapi1, nil, []string{url1})
+		index.update(kapi2, nil, []string{url1})
+
+		// Act
+		index.update(kapi1, []string{url1}, []string{url2})
+		index.update(kapi2, []string{url1}, nil)
+
+		// Assert
+		Expect(index.get(url1)).To(BeEmpty())
+		Expect(index.get(url2)).To(ConsistOf(kapi1))
+		Expect(index.kapis).To(HaveLen(1))
+	})
+
+	It("should keep a Kapi whose URL is in both the old and the new URLs", func() {
+		// Arrange
+		var index metricsUrlIndex
+		index.update(kapi1, nil, []string{url1})
+
+		// Act
+		index.update(kapi1, []string{url1}, []string{url1, url2})
+
+		// Assert
+		Expect(index.get(url1)).To(ConsistOf(kapi1))
+		Expect(index.get(url2)).To(ConsistOf(kapi1))
+	})
+})
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input_data_registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RequestCountHistorySize is the number of most recent request count samples which the registry retains per Kapi
+const RequestCountHistorySize = 10
+
+// RequestCountSample is a single sample of the total number of requests served by a Kapi pod, since the pod started
+type RequestCountSample struct {
+	TotalRequestCount int64
+	Time              time.Time // The point in time to which TotalRequestCount refers
+}
+
+// RequestCountHistory retains the RequestCountHistorySize most recent request count samples for a Kapi, in a ring
+// buffer. Adding a sample takes constant time, and overwrites the oldest sample, once the buffer is full.
+//
+// The type has no references, so assignment yields an independent copy. The zero value is an empty history.
+type RequestCountHistory struct {
+	samples [RequestCountHistorySize]RequestCountSample
+	start   int // The index of the oldest sample
+	count   int // The number of samples on record
+}
+
+// Add records the specified sample as the most recent one, discarding the oldest one if the history is full
+func (h *RequestCountHistory) Add(sample RequestCountSample) {
+	if h.count < RequestCountHistorySize {
+		h.samples[(h.start+h.count)%RequestCountHistorySize] = sample
+		h.count++
+		return
+	}
+
+	h.samples[h.start] = sample
+	h.start = (h.start + 1) % RequestCountHistorySize
+}
+
+// Len returns the number of samples on record
+func (h *RequestCountHistory) Len() int {
+	return h.count
+}
+
+// At returns the sample at the specified position, counting from the oldest sample on record. Panics if the index is
+// not less than Len.
+func (h *RequestCountHistory) At(index int) RequestCountSample {
+	if index < 0 || index >= h.count {
+		panic("request count history index out of range")
+	}
+	return h.samples[(h.start+index)%RequestCountHistorySize]
+}
+
+// Samples returns the samples on record, oldest first
+func (h *RequestCountHistory) Samples() []RequestCountSample {
+	result := make([]RequestCountSample, h.count)
+	for i := range result {
+		result[i] = h.At(i)
+	}
+	return result
+}
+
+// MarshalJSON implements [json.Marshaler]. The history is represented by the array of its samples, oldest first.
+func (h RequestCountHistory) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Samples())
+}
+
+// UnmarshalJSON implements [json.Unmarshaler]. It replaces the history with the samples in the array, oldest first. If
+// the array has more than RequestCountHistorySize samples, only the most recent ones are retained.
+func (h *RequestCountHistory) UnmarshalJSON(data []byte) error {
+	var samples []RequestCountSample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return fmt.Errorf("decoding request count history: %w", err)
+	}
+
+	*h = RequestCountHistory{}
+	for _, sample := range samples {
+		h.Add(sample)
+	}
+	return nil
+}
+
+// ScrapeDurationHistorySize is the number of most recent successful scrape durations which the registry retains per
+// Kapi
+const ScrapeDurationHistorySize = 20
+
+// ScrapeDurationHistory retains the ScrapeDurationHistorySize most recent successful scrape durations for a Kapi, in a
+// ring buffer. Works the same way as RequestCountHistory.
+//
+// The type has no references, so assignment yields an independent copy. The zero value is an empty history.
+type ScrapeDurationHistory struct {
+	durations [ScrapeDurationHistorySize]time.Duration
+	start     int // The index of the oldest duration
+	count     int // The number of durations on record
+}
+
+// Add records the specified duration as the most recent one, discarding the oldest one if the history is full
+func (h *ScrapeDurationHistory) Add(duration time.Duration) {
+	if h.count < ScrapeDurationHistorySize {
+		h.durations[(h.start+h.count)%ScrapeDurationHistorySize] = duration
+		h.count++
+		return
+	}
+
+	h.durations[h.start] = duration
+	h.start = (h.start + 1) % ScrapeDurationHistorySize
+}
+
+// Len returns the number of durations on record
+func (h *ScrapeDurationHistory) Len() int {
+	return h.count
+}
+
+// Durations returns the durations on record, oldest first
+func (h *ScrapeDurationHistory) Durations() []time.Duration {
+	result := make([]time.Duration, h.count)
+	for i := range result {
+		result[i] = h.durations[(h.start+i)%ScrapeDurationHistorySize]
+	}
+	return result
+}
+
+// MarshalJSON implements [json.Marshaler]. Works the same way as RequestCountHistory.MarshalJSON.
+func (h ScrapeDurationHistory) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Durations())
+}
+
+// UnmarshalJSON implements [json.Unmarshaler]. Works the same way as RequestCountHistory.UnmarshalJSON.
+func (h *ScrapeDurationHistory) UnmarshalJSON(data []byte) error {
+	var durations []time.Duration
+	if err := json.Unmarshal(data, &durations); err != nil {
+		return fmt.Errorf("decoding scrape duration history: %w", err)
+	}
+
+	*h = ScrapeDurationHistory{}
+	for _, duration := range durations {
+		h.Add(duration)
+	}
+	return nil
+}
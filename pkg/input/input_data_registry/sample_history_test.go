@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input_data_registry
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("input_data_registry.RequestCountHistory", func() {
+	newSample := func(count int) RequestCountSample {
+		return RequestCountSample{TotalRequestCount: int64(count), Time: gcmtesting.NewTime(1, count, 0)}
+	}
+
+	It("should be empty when zero-initialized", func() {
+		// Arrange
+		var history RequestCountHistory
+
+		// Act
+		samples := history.Samples()
+
+		// Assert
+		Expect(history.Len()).To(BeZero())
+		Expect(samples).To(BeEmpty())
+	})
+	It("should return the samples oldest first, while not full", func() {
+		// Arrange
+		var history RequestCountHistory
+
+		// Act
+		history.Add(newSample(1))
+		history.Add(newSample(2))
+
+		// Assert
+		Expect(history.Samples()).To(Equal([]RequestCountSample{newSample(1), newSample(2)}))
+		Expect(history.At(1)).To(Equal(newSample(2)))
+	})
+	It("should discard the oldest samples, once full", func() {
+		// Arrange
+		var history RequestCountHistory
+
+		// Act
+		for i := 1; i <= RequestCountHistorySize+3; i++ {
+			history.Add(newSample(i))
+		}
+
+		// Assert
+		Expect(history.Len()).To(Equal(RequestCountHistorySize))
+		samples := history.Samples()
+		Expect(samples[0]).To(Equal(newSample(4)))
+		Expect(samples[RequestCountHistorySize-1]).To(Equal(newSample(RequestCountHistorySize + 3)))
+	})
+	It("should yield an independent copy upon assignment", func() {
+		// Arrange
+		var history RequestCountHistory
+		history.Add(newSample(1))
+
+		// Act
+		historyCopy := history
+		history.Add(newSample(2))
+
+		// Assert
+		Expect(historyCopy.Samples()).To(Equal([]RequestCountSample{newSample(1)}))
+	})
+	It("should survive a JSON round trip", func() {
+		// Arrange
+		var history RequestCountHistory
+		for i := 1; i <= RequestCountHistorySize+3; i++ {
+			history.Add(newSample(i))
+		}
+
+		// Act
+		data, err := json.Marshal(history)
+		Expect(err).NotTo(HaveOccurred())
+		var result RequestCountHistory
+		err = json.Unmarshal(data, &result)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Samples()).To(Equal(history.Samples()))
+	})
+	It("should retain only the most recent samples, when decoding a JSON array which exceeds the capacity", func() {
+		// Arrange
+		samples := make([]RequestCountSample, RequestCountHistorySize+1)
+		for i := range samples {
+			samples[i] = newSample(i + 1)
+		}
+		data, _ := json.Marshal(samples)
+		var history RequestCountHistory
+
+		// Act
+		err := json.Unmarshal(data, &history)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.Samples()).To(Equal(samples[1:]))
+	})
+	It("should panic on an index out of range", func() {
+		// Arrange
+		var history RequestCountHistory
+		history.Add(newSample(1))
+
+		// Act and assert
+		Expect(func() { history.At(1) }).To(Panic())
+	})
+})
+
+var _ = Describe("input_data_registry.ScrapeDurationHistory", func() {
+	It("should be empty when zero-initialized", func() {
+		// Arrange
+		var history ScrapeDurationHistory
+
+		// Act
+		durations := history.Durations()
+
+		// Assert
+		Expect(history.Len()).To(BeZero())
+		Expect(durations).To(BeEmpty())
+	})
+	It("should discard the oldest durations, once full, and return the rest oldest first", func() {
+		// Arrange
+		var history ScrapeDurationHistory
+
+		// Act
+		for i := 1; i <= ScrapeDurationHistorySize+3; i++ {
+			history.Add(time.Duration(i) * time.Millisecond)
+		}
+
+		// Assert
+		Expect(history.Len()).To(Equal(ScrapeDurationHistorySize))
+		durations := history.Durations()
+		Expect(durations[0]).To(Equal(4 * time.Millisecond))
+		Expect(durations[ScrapeDurationHistorySize-1]).To(Equal((ScrapeDurationHistorySize + 3) * time.Millisecond))
+	})
+	It("should survive a JSON round trip", func() {
+		// Arrange
+		var history ScrapeDurationHistory
+		history.Add(1 * time.Millisecond)
+		history.Add(2 * time.Millisecond)
+
+		// Act
+		data, err := json.Marshal(history)
+		Expect(err).NotTo(HaveOccurred())
+		var result ScrapeDurationHistory
+		err = json.Unmarshal(data, &result)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Durations()).To(Equal([]time.Duration{1 * time.Millisecond, 2 * time.Millisecond}))
+	})
+})
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input_data_registry
+
+import (
+	"sync"
+)
+
+// sampleWatcherQueue delivers "samples updated" notifications to a single SampleWatcher, on a goroutine dedicated to
+// that watcher. Unlike kapiWatcherQueue, it coalesces notifications: while a shoot's notification is pending delivery,
+// further updates to the same shoot do not add to the queue. So, the queue never holds more than one entry per shoot,
+// and enqueueing never blocks, regardless of how fast samples arrive, or of what the watcher does.
+//
+// All methods are concurrency-safe.
+type sampleWatcherQueue struct {
+	watcher *SampleWatcher
+
+	// Synchronizes access to the fields below. Also used to signal changes to them.
+	lock sync.Mutex
+	cond *sync.Cond
+	// The namespaces of the shoots pending delivery, in order of their first update since their last delivery. While a
+	// notification is being delivered, its namespace stays first, and is removed once the delivery completes.
+	namespaces []string
+	// The set of namespaces in the namespaces field, which are not being delivered
+	isPending map[string]bool
+	// Once true, no further notifications are accepted or delivered
+	isClosed bool
+
+	// Closed once the delivery goroutine has exited
+	done chan struct{}
+}
+
+// newSampleWatcherQueue creates a sampleWatcherQueue which delivers notifications to the specified watcher, and starts
+// its delivery goroutine. The queue must eventually be closed, to release the goroutine.
+func newSampleWatcherQueue(watcher *SampleWatcher) *sampleWatcherQueue {
+	q := &sampleWatcherQueue{
+		watcher:   watcher,
+		isPending: make(map[string]bool),
+		done:      make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.lock)
+	go q.run()
+
+	return q
+}
+
+// enqueue schedules a notification for the specified shoot, unless one is already pending. Has no effect if the queue
+// is closed.
+func (q *sampleWatcherQueue) enqueue(shootNamespace string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.isClosed || q.isPending[shootNamespace] {
+		return
+	}
+	q.isPending[shootNamespace] = true
+	q.namespaces = append(q.namespaces, shootNamespace)
+	q.cond.Broadcast()
+}
+
+// close discards pending notifications, and waits for the delivery of the notification in flight, if any, to
+// complete. Once close returns, the watcher receives no further notifications. Must not be called from the watcher
+// itself.
+func (q *sampleWatcherQueue) close() {
+	q.lock.Lock()
+	q.isClosed = true
+	q.namespaces = nil
+	q.isPending = nil
+	q.cond.Broadcast()
+	q.lock.Unlock()
+
+	<-q.done
+}
+
+// run delivers notifications to the watcher, one at a time, in order, until the queue is closed
+func (q *sampleWatcherQueue) run() {
+	defer close(q.done)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for {
+		for len(q.namespaces) == 0 && !q.isClosed {
+			q.cond.Wait()
+		}
+		if q.isClosed {
+			return
+		}
+
+		shootNamespace := q.namespaces[0]
+		// Updates which arrive from now on, are not reflected in what the watcher may already have read
+		delete(q.isPending, shootNamespace)
+		q.lock.Unlock()
+
+		(*q.watcher)(shootNamespace)
+
+		q.lock.Lock()
+		if !q.isClosed { // Closing discards the namespaces, including the one delivered
+			q.namespaces = q.namespaces[1:]
+		}
+		q.cond.Broadcast()
+	}
+}
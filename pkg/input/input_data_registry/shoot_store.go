@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input_data_registry
+
+// shootStore is the storage backend of the registry. Each registry shard keeps the records of its shoots in a store
+// of its own. The registry contains all the logic which operates on the records, so a store only needs to keep them,
+// and alternative backends (e.g. persistent ones) can be wired in without affecting the registry's clients. The records
+// have unexported fields, so backends are implemented in this package. See newInputDataRegistryWithStore.
+//
+// The registry serializes all access to a store via the lock of the respective shard, so implementations need not be
+// concurrency-safe.
+//
+// Get returns the stored record itself, not a copy. The registry modifies records in place, and passes a modified
+// record to Put, before releasing the shard lock. Until then, Get must keep returning the same object for the same
+// shoot. An implementation which keeps the records outside process memory can use Put as the point where it writes a
+// record back.
+type shootStore interface {
+	// Get returns the record of the specified shoot, or nil if there is no record for the shoot
+	Get(shootNamespace string) *shootData
+	// Put stores the specified record, replacing any record for the same shoot
+	Put(shoot *shootData)
+	// Delete removes the record of the specified shoot. If there is no record for the shoot, it has no effect.
+	Delete(shootNamespace string)
+	// Range calls fn for each record in the store, in unspecified order, until fn returns false. fn must not add or
+	// remove records.
+	Range(fn func(shoot *shootData) bool)
+}
+
+// shootStoreFactory creates the shootStore for the registry shard with the specified index. Stores of different
+// shards must not share records.
+type shootStoreFactory func(shardIndex int) shootStore
+
+// memoryShootStore is a shootStore which keeps the records in process memory. It is the registry's default backend.
+type memoryShootStore struct {
+	// Maps <shoot namespace> -> <shootData object>. Values cannot be null.
+	shoots map[string]*shootData
+}
+
+// newMemoryShootStore creates a shootStore which keeps the records in process memory
+func newMemoryShootStore() shootStore {
+	return &memoryShootStore{shoots: make(map[string]*shootData)}
+}
+
+// newMemoryShootStoreFactory is a shootStoreFactory which creates a memory store for each shard.
+// See newMemoryShootStore.
+func newMemoryShootStoreFactory(int) shootStore {
+	return newMemoryShootStore()
+}
+
+// Get implements [shootStore.Get].
+func (s *memoryShootStore) Get(shootNamespace string) *shootData {
+	return s.shoots[shootNamespace]
+}
+
+// Put implements [shootStore.Put].
+func (s *memoryShootStore) Put(shoot *shootData) {
+	s.shoots[shoot.ShootNamespace()] = shoot
+}
+
+// Delete implements [shootStore.Delete].
+func (s *memoryShootStore) Delete(shootNamespace string) {
+	delete(s.shoots, shootNamespace)
+}
+
+// Range implements [shootStore.Range].
+func (s *memoryShootStore) Range(fn func(shoot *shootData) bool) {
+	for _, shoot := range s.shoots {
+		if !fn(shoot) {
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input_data_registry
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// describeShootStoreConformance declares the specs which every shootStore implementation must pass. newStore must
+// return a new, empty store.
+func describeShootStoreConformance(newStore func() shootStore) {
+	const (
+		nsName      = "shoot--my-shoot"
+		otherNsName = "shoot--other-shoot"
+	)
+
+	Describe("Get", func() {
+		It("should return nil, if there is no record for the shoot", func() {
+			// Arrange
+			store := newStore()
+			store.Put(&shootData{shootNamespace: otherNsName})
+
+			// Act
+			shoot := store.Get(nsName)
+
+			// Assert
+			Expect(shoot).To(BeNil())
+		})
+		It("should return the stored object itself, and not a copy", func() {
+			// Arrange
+			store := newStore()
+			shoot := &shootData{shootNamespace: nsName}
+			store.Put(shoot)
+
+			// Act
+			result := store.Get(nsName)
+
+			// Assert
+			Expect(result).To(BeIdenticalTo(shoot))
+		})
+		It("should reflect in-place modifications, which were passed back to Put", func() {
+			// Arrange
+			store := newStore()
+			store.Put(&shootData{shootNamespace: nsName})
+			shoot := store.Get(nsName)
+			shoot.AuthSecret = "secret"
+			shoot.KapiData = append(shoot.KapiData, &KapiData{shootNamespace: nsName, podName: "pod"})
+
+			// Act
+			store.Put(shoot)
+
+			// Assert
+			result := store.Get(nsName)
+			Expect(result.AuthSecret).To(Equal("secret"))
+			Expect(result.KapiData).To(HaveLen(1))
+			Expect(result.KapiData[0].PodName()).To(Equal("pod"))
+		})
+	})
+
+	Describe("Put", func() {
+		It("should replace the existing record for the same shoot, and leave other shoots alone", func() {
+			// Arrange
+			store := newStore()
+			other := &shootData{shootNamespace: otherNsName}
+			store.Put(&shootData{shootNamespace: nsName, AuthSecret: "old"})
+			store.Put(other)
+			replacement := &shootData{shootNamespace: nsName, AuthSecret: "new"}
+
+			// Act
+			store.Put(replacement)
+
+			// Assert
+			Expect(store.Get(nsName)).To(BeIdenticalTo(replacement))
+			Expect(store.Get(otherNsName)).To(BeIdenticalTo(other))
+		})
+	})
+
+	Describe("Delete", func() {
+		It("should remove the record of the shoot, and leave other shoots alone", func() {
+			// Arrange
+			store := newStore()
+			store.Put(&shootData{shootNamespace: nsName})
+			store.Put(&shootData{shootNamespace: otherNsName})
+
+			// Act
+			store.Delete(nsName)
+
+			// Assert
+			Expect(store.Get(nsName)).To(BeNil())
+			Expect(store.Get(otherNsName)).NotTo(BeNil())
+		})
+		It("should have no effect, if there is no record for the shoot", func() {
+			// Arrange
+			store := newStore()
+			store.Put(&shootData{shootNamespace: otherNsName})
+
+			// Act
+			store.Delete(nsName)
+
+			// Assert
+			Expect(store.Get(otherNsName)).NotTo(BeNil())
+		})
+	})
+
+	Describe("Range", func() {
+		It("should visit each record exactly once", func() {
+			// Arrange
+			store := newStore()
+			store.Put(&shootData{shootNamespace: nsName})
+			store.Put(&shootData{shootNamespace: otherNsName})
+			store.Delete(otherNsName)
+			store.Put(&shootData{shootNamespace: otherNsName})
+			var visited []string
+
+			// Act
+			store.Range(func(shoot *shootData) bool {
+				visited = append(visited, shoot.ShootNamespace())
+				return true
+			})
+
+			// Assert
+			Expect(visited).To(ConsistOf(nsName, otherNsName))
+		})
+		It("should stop, once the callback returns false", func() {
+			// Arrange
+			store := newStore()
+			store.Put(&shootData{shootNamespace: nsName})
+			store.Put(&shootData{shootNamespace: otherNsName})
+			visitCount := 0
+
+			// Act
+			store.Range(func(shoot *shootData) bool {
+				visitCount++
+				return false
+			})
+
+			// Assert
+			Expect(visitCount).To(Equal(1))
+		})
+		It("should not call the callback, if the store is empty", func() {
+			// Arrange
+			store := newStore()
+			visitCount := 0
+
+			// Act
+			store.Range(func(shoot *shootData) bool {
+				visitCount++
+				return true
+			})
+
+			// Assert
+			Expect(visitCount).To(BeZero())
+		})
+	})
+}
+
+var _ = Describe("input_data_registry.memoryShootStore", func() {
+	describeShootStoreConformance(newMemoryShootStore)
+})
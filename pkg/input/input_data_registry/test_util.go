@@ -4,6 +4,8 @@
 
 package input_data_registry
 
+import "slices"
+
 type mockWatcher struct {
 	EventTypes []KapiEventType
 	EventKapis []ShootKapi
@@ -21,3 +23,56 @@ func newMockWatcher() *mockWatcher {
 	}
 	return mock
 }
+
+// allShoots returns the union of the shoot maps of all shards of the registry. Not concurrency-safe.
+func (reg *inputDataRegistry) allShoots() map[string]*shootData {
+	result := make(map[string]*shootData)
+	for i := range reg.shards {
+		reg.shards[i].store.Range(func(shoot *shootData) bool {
+			result[shoot.ShootNamespace()] = shoot
+			return true
+		})
+	}
+	return result
+}
+
+// waitForKapiWatchers blocks until all events raised so far have been delivered to all watchers
+func (reg *inputDataRegistry) waitForKapiWatchers() {
+	reg.lockAllShards()
+	queues := slices.Clone(reg.kapiWatchers)
+	reg.unlockAllShards()
+
+	for _, queue := range queues {
+		queue.lock.Lock()
+		for len(queue.events) > 0 || queue.isDelivering {
+			queue.cond.Wait()
+		}
+		queue.lock.Unlock()
+	}
+}
+
+// waitForSampleWatchers blocks until all notifications raised so far have been delivered to all sample watchers
+func (reg *inputDataRegistry) waitForSampleWatchers() {
+	reg.lockAllShards()
+	queues := slices.Clone(reg.sampleWatchers)
+	reg.unlockAllShards()
+
+	for _, queue := range queues {
+		queue.lock.Lock()
+		for len(queue.namespaces) > 0 {
+			queue.cond.Wait()
+		}
+		queue.lock.Unlock()
+	}
+}
+
+// recordingShootStore is a shootStore which counts the Put calls made on it
+type recordingShootStore struct {
+	shootStore
+	PutCount int
+}
+
+func (s *recordingShootStore) Put(shoot *shootData) {
+	s.PutCount++
+	s.shootStore.Put(shoot)
+}
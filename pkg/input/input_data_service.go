@@ -6,24 +6,71 @@
 package input
 
 import (
+	"context"
 	"fmt"
+	"reflect"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
+	namespacectl "github.com/gardener/gardener-custom-metrics/pkg/input/controller/namespace"
 	podctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller/pod"
 	secretctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller/secret"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/etcd"
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
 	"github.com/gardener/gardener-custom-metrics/pkg/input/metrics_scraper"
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
 )
 
+// The types of the conditions which report the health of the input data service's components. See package conditions.
+const (
+	PodControllerConditionType       = "PodControllerDegraded"
+	SecretControllerConditionType    = "SecretControllerDegraded"
+	ScraperConditionType             = "ScraperDegraded"
+	EtcdControllerConditionType      = "EtcdControllerDegraded"
+	EtcdScraperConditionType         = "EtcdScraperDegraded"
+	NamespaceControllerConditionType = "NamespaceControllerDegraded"
+	// Degraded while any Kapi pod is not scraped, because its address is already used by another Kapi
+	PodAddressConditionType = "PodAddressDegraded"
+	// Degraded once the registry unsubscribes a Kapi watcher, e.g. the scraper's, because the watcher misbehaved
+	KapiWatcherConditionType = "KapiWatcherDegraded"
+)
+
+// samplingInfoName is the name under which the effective sampling settings are exposed at the debug endpoint. See
+// [conditions.Registry.AddInfo].
+const samplingInfoName = "sampling"
+
+// How many consecutive errors make a shoot count as failing, in the conditions of the respective component. The
+// component is degraded while at least half of the shoots are failing. See conditions.Registry.NewScopedReporter.
+// Scrapes are far more frequent than reconciliations, and individual Kapis routinely fail while e.g. being replaced, so
+// the scrapers are more tolerant.
+const (
+	controllerDegradedThreshold = 5
+	scraperDegradedThreshold    = 10
+)
+
+// How many consecutive scrape faults of an individual Kapi result in a Kubernetes event on the Kapi pod. A Kapi being
+// replaced can fail a few scrapes in a row, so the threshold spans a few scrape periods.
+const scrapeFaultEventThreshold = 5
+
+// The number of on-demand pod reconciliations which may be pending, before further requests are dropped. See
+// InputDataService.RequestPodReconcile.
+const podReconcileRequestCapacity = 100
+
 // InputDataServiceFactory creates InputDataService instances. It allows replacing certain functions, to support
 // test isolation.
 type InputDataServiceFactory struct {
@@ -49,18 +96,80 @@ func (f *InputDataServiceFactory) NewInputDataService(cliConfig *CLIConfig, pare
 type InputDataService interface {
 	// DataSource returns an interface for consuming metrics provided by the InputDataService
 	DataSource() input_data_registry.InputDataSource
+	// DataRegistry returns the registry which holds the data gathered by the InputDataService. Meant for components
+	// which maintain the registry on behalf of the InputDataService, e.g. while this process is a standby replica.
+	DataRegistry() input_data_registry.InputDataRegistry
+	// EtcdDataSource returns an interface for consuming the shoot etcd metrics provided by the InputDataService. Returns
+	// nil if etcd metrics are not enabled. See CLIConfig.EnableEtcdMetrics.
+	EtcdDataSource() etcd.DataSource
 	// AddToManager adds all of InputDataService's underlying data gathering activities to the specified manager.
 	AddToManager(mgr manager.Manager) error
+	// SetShardPredicate restricts scraping to the namespaces for which isNamespaceOwned returns true. Used when scraping
+	// is sharded across replicas. Must be called before AddToManager.
+	SetShardPredicate(isNamespaceOwned func(namespace string) bool)
+	// SetConditionRegistry directs the controllers, the scraper, and the registry's Kapi watcher supervision to report
+	// their health to the specified registry, and exposes the effective sampling settings and the scrape coverage at
+	// the registry's debug endpoint. Must be called before AddToManager.
+	SetConditionRegistry(registry *conditions.Registry)
+	// SetKapiSelector sets the criteria which identify the shoot Kapi pods and the shoot namespaces. If not called, or
+	// if selector is nil, the Gardener defaults apply. Must be called before AddToManager.
+	SetKapiSelector(selector *gutil.KapiSelector)
+	// SetMetricsRegisterer sets the registerer with which the service's own metrics, i.e. the scrape coverage and the
+	// shoot access token expiry, are registered. If not called, the controller-runtime registry applies. Services
+	// which share a registry must be given registerers which tell them apart, e.g. via a const label. Must be called
+	// before AddToManager.
+	SetMetricsRegisterer(registerer prometheus.Registerer)
+	// SetStartGate holds off the controllers, the scraper, and the service's other leader-elected activities, until
+	// gate returns, e.g. until another component stops writing to the registry. The gate receives the context with
+	// which the manager starts the activities, and is called once by each of them. Must be called before AddToManager.
+	SetStartGate(gate func(ctx context.Context) error)
+	// NotifyNamespaceQueried records that the custom metrics of the shoot in the specified namespace were queried. See
+	// CLIConfig.BackgroundScrapePeriod. Has no effect before AddToManager. Concurrency-safe.
+	NotifyNamespaceQueried(namespace string)
+	// ExpediteNamespace makes the Kapis of the shoot in the specified namespace due for scraping right away. Returns the
+	// number of Kapis affected. Has no effect, and returns zero, before AddToManager. Concurrency-safe.
+	ExpediteNamespace(namespace string) int
+	// RequestPodReconcile makes the pod controller reconcile the specified Kapi pod right away. That adds the Kapi
+	// back to the registry, with a fresh record, if the pod still exists. Returns false, if the request was dropped,
+	// because too many requests are pending. Concurrency-safe.
+	RequestPodReconcile(namespace string, podName string) bool
+	// ApplyReloadableConfig applies those settings from the specified configuration, which can be changed at runtime:
+	// the scrape period and the namespace filter. All other settings are ignored.
+	ApplyReloadableConfig(cliConfig *CLIConfig)
+	// WarmupGate returns the gate which tracks the completion of the first scrape wave. AddToManager adds the gate to
+	// the manager. Returns nil, if the gate is not enabled. See CLIConfig.WarmupMinCoverage.
+	WarmupGate() *WarmupGate
 }
 
 type inputDataService struct {
 	// Central data repository, used to synchronize/communicate between the different components of InputDataRegistry,
 	// and as a sink for the data output by InputDataRegistry.
 	inputDataRegistry input_data_registry.InputDataRegistry
+	// Holds the shoot etcd pods and their metrics. Nil if etcd metrics are not enabled.
+	etcdRegistry *etcd.Registry
 
 	config *CLIConfig
 	log    logr.Logger
 
+	// If not nil, only namespaces for which it returns true are scraped
+	isNamespaceOwned func(namespace string) bool
+	// If not nil, components report their health here
+	conditionRegistry *conditions.Registry
+	// Identifies the shoot Kapi pods and namespaces. If nil, the Gardener defaults apply.
+	kapiSelector *gutil.KapiSelector
+	// The scrape coverage metrics are registered here
+	metricsRegisterer prometheus.Registerer
+	// Nil, unless CLIConfig.WarmupMinCoverage is set
+	warmupGate *WarmupGate
+	// Delivers the pods which the pod controller reconciles on demand. See RequestPodReconcile.
+	podReconcileRequests chan event.GenericEvent
+	// If not nil, the leader-elected activities start once it returns. See SetStartGate.
+	startGate func(ctx context.Context) error
+
+	// Created by AddToManager. Protected by scraperLock.
+	scraper     *metrics_scraper.Scraper
+	scraperLock sync.Mutex
+
 	testIsolation testIsolation
 }
 
@@ -69,10 +178,31 @@ type inputDataService struct {
 // cliConfig contains configurable settings which influence the behavior of the resulting object.
 func newInputDataService(cliConfig *CLIConfig, parentLogger logr.Logger) InputDataService {
 	log := parentLogger.WithName("input")
+	registry := input_data_registry.NewInputDataRegistry(cliConfig.MinSampleGap, log)
+	registry.SetDefaultScrapePeriod(cliConfig.ScrapePeriod)
+	registry.SetDefaultShootScrapeSettings(cliConfig.ScrapeSettings)
+	logMinSampleGapConflict(cliConfig.MinSampleGap, cliConfig.ScrapePeriod, log)
+	var etcdRegistry *etcd.Registry
+	if cliConfig.EnableEtcdMetrics {
+		etcdRegistry = etcd.NewRegistry(
+			input_data_registry.EffectiveMinSampleGap(cliConfig.MinSampleGap, cliConfig.ScrapePeriod))
+	}
+	var warmupGate *WarmupGate
+	if cliConfig.WarmupMinCoverage > 0 {
+		warmupGate = newWarmupGate(
+			registry,
+			cliConfig.WarmupMinCoverage,
+			cliConfig.WarmupMaxWait,
+			log.V(app.VerbosityVerbose).WithName("warmup-gate"))
+	}
 	return &inputDataService{
-		inputDataRegistry: input_data_registry.NewInputDataRegistry(cliConfig.MinSampleGap, log),
-		config:            cliConfig,
-		log:               log,
+		inputDataRegistry:    registry,
+		etcdRegistry:         etcdRegistry,
+		config:               cliConfig,
+		log:                  log,
+		metricsRegisterer:    ctrlmetrics.Registry,
+		warmupGate:           warmupGate,
+		podReconcileRequests: make(chan event.GenericEvent, podReconcileRequestCapacity),
 		testIsolation: testIsolation{
 			NewScraper: metrics_scraper.NewScraper,
 		},
@@ -83,13 +213,98 @@ func (ids *inputDataService) DataSource() input_data_registry.InputDataSource {
 	return ids.inputDataRegistry.DataSource()
 }
 
+func (ids *inputDataService) DataRegistry() input_data_registry.InputDataRegistry {
+	return ids.inputDataRegistry
+}
+
+// shootCount returns the number of shoots in the registry. Serves as the number of scopes of the service's conditions.
+// See conditions.Registry.NewScopedReporter.
+func (ids *inputDataService) shootCount() int {
+	return len(ids.inputDataRegistry.GetShootNamespaces())
+}
+
+func (ids *inputDataService) EtcdDataSource() etcd.DataSource {
+	if ids.etcdRegistry == nil {
+		return nil
+	}
+	return ids.etcdRegistry
+}
+
 func (ids *inputDataService) AddToManager(mgr manager.Manager) error {
+	if ids.startGate != nil {
+		mgr = &gatedManager{Manager: mgr, gate: ids.startGate}
+	}
+
+	if err := ids.metricsRegisterer.Register(newScrapeCoverageCollector(ids.inputDataRegistry)); err != nil {
+		return fmt.Errorf("register scrape coverage metrics: %w", err)
+	}
+
+	if ids.warmupGate != nil {
+		// No leader election opt-out, so the gate starts along with the scraper
+		if err := mgr.Add(ids.warmupGate); err != nil {
+			return fmt.Errorf("add warmup gate to controller manager: %w", err)
+		}
+	}
+
+	if ids.config.Simulation != nil {
+		// Synthetic Kapis replace the controllers and the scraper, which obtain data from actual shoots
+		ids.log.V(app.VerbosityInfo).Info("Simulation mode. Adding Kapi simulator to manager")
+		simulator := newKapiSimulator(
+			ids.inputDataRegistry, ids.config.Simulation, ids.config.ScrapePeriod, ids.log.V(1).WithName("simulator"))
+		if err := mgr.Add(simulator); err != nil {
+			return fmt.Errorf("add Kapi simulator to controller manager: %w", err)
+		}
+		return nil
+	}
+
+	// Re-reads pods directly from the server, when the scraper finds that their address on record is stale
+	podRefresher := podctl.NewPodRefresher(
+		ids.inputDataRegistry,
+		mgr.GetAPIReader(),
+		mgr.GetClient(),
+		ids.config.PodIPFamily,
+		ids.config.PodCIDRs,
+		ids.config.MetricsPortName,
+		ids.kapiSelector,
+		ids.log.V(1).WithName("pod-refresher"))
+
 	ids.log.V(app.VerbosityInfo).Info("Creating scraper")
+	ids.scraperLock.Lock()
 	scraper := ids.testIsolation.NewScraper(
 		ids.inputDataRegistry,
 		ids.config.ScrapePeriod,
 		ids.config.ScrapeFlowControlPeriod,
+		metrics_scraper.ScraperOptions{
+			ProxyURLTemplate: ids.config.ScrapeProxyURL,
+			NamespaceFilter:  ids.config.NamespaceFilter,
+			IsNamespaceOwned: ids.isNamespaceOwned,
+			Condition: ids.conditionRegistry.NewScopedReporter(
+				ScraperConditionType, scraperDegradedThreshold, true, ids.shootCount),
+
+			EventRecorder:       mgr.GetEventRecorderFor(app.Name),
+			FaultEventThreshold: scrapeFaultEventThreshold,
+
+			ShootScrapeLimits: ids.config.ShootScrapeLimits,
+			RefreshPod:        podRefresher.RequestRefresh,
+			MaxResponseSize:   ids.config.MaxScrapeResponseSize,
+			PortForwardConfig: mgr.GetConfig(),
+
+			CAGracePeriod:      ids.config.CAGracePeriod,
+			FallbackCACertPool: ids.config.FallbackCACertPool,
+
+			BackgroundScrapePeriod: ids.config.BackgroundScrapePeriod,
+			ConsumerWindow:         ids.config.ConsumerWindow,
+
+			TLS:            ids.config.ScrapeTLS,
+			AcceptProtobuf: ids.config.ScrapeProtobuf,
+			Response:       ids.config.ScrapeResponse,
+
+			SyncBarrierTimeout:  ids.config.SyncBarrierTimeout,
+			WaitForInformerSync: newInformerSyncWaiter(mgr.GetCache(), &corev1.Pod{}, &corev1.Secret{}),
+		},
 		ids.log.V(1).WithName("scraper"))
+	ids.scraper = scraper
+	ids.scraperLock.Unlock()
 
 	ids.log.V(app.VerbosityVerbose).Info("Updating manager schemes")
 	builder := runtime.NewSchemeBuilder(scheme.AddToScheme)
@@ -106,7 +321,22 @@ func (ids *inputDataService) AddToManager(mgr manager.Manager) error {
 		),
 	}
 	ids.config.PodController.Apply(&podControllerOptions)
-	if err := podctl.AddToManager(mgr, ids.inputDataRegistry, podControllerOptions, ids.log.V(1)); err != nil {
+	podCondition := ids.conditionRegistry.NewScopedReporter(
+		PodControllerConditionType, controllerDegradedThreshold, true, ids.shootCount)
+	// A single skipped pod is worth reporting, but it does not impair the service as a whole
+	podAddressCondition := ids.conditionRegistry.NewReporter(PodAddressConditionType, 1, false)
+	if err := podctl.AddToManager(
+		mgr,
+		ids.inputDataRegistry,
+		podControllerOptions,
+		ids.config.PodIPFamily,
+		ids.config.PodCIDRs,
+		ids.config.MetricsPortName,
+		ids.kapiSelector,
+		podCondition,
+		podAddressCondition,
+		ids.podReconcileRequests,
+		ids.log.V(1)); err != nil {
 		return fmt.Errorf("add pod controller to manager: %w", err)
 	}
 
@@ -118,18 +348,230 @@ func (ids *inputDataService) AddToManager(mgr manager.Manager) error {
 		),
 	}
 	ids.config.SecretController.Apply(&secretControllerOptions)
-	if err := secretctl.AddToManager(mgr, ids.inputDataRegistry, secretControllerOptions, ids.log.V(1)); err != nil {
+	secretCondition := ids.conditionRegistry.NewScopedReporter(
+		SecretControllerConditionType, controllerDegradedThreshold, true, ids.shootCount)
+	if err := secretctl.AddToManager(
+		mgr,
+		ids.inputDataRegistry,
+		secretControllerOptions,
+		ids.config.TokenRequest,
+		ids.config.TokenDirectory != "",
+		ids.kapiSelector,
+		secretCondition,
+		ids.metricsRegisterer,
+		ids.log.V(1)); err != nil {
 		return fmt.Errorf("add secret controller to manager: %w", err)
 	}
 
+	namespaceCondition := ids.conditionRegistry.NewScopedReporter(
+		NamespaceControllerConditionType, controllerDegradedThreshold, true, ids.shootCount)
+	if err := namespacectl.AddToManager(
+		mgr,
+		ids.inputDataRegistry,
+		controller.Options{},
+		ids.kapiSelector,
+		namespaceCondition,
+		ids.log.V(1)); err != nil {
+		return fmt.Errorf("add namespace controller to manager: %w", err)
+	}
+
+	if ids.config.TokenDirectory != "" {
+		ids.log.V(app.VerbosityVerbose).Info("Adding token file watcher to manager")
+		watcher := newTokenFileWatcher(
+			ids.inputDataRegistry,
+			ids.config.TokenDirectory,
+			tokenFileWatchPeriod,
+			ids.kapiSelector,
+			ids.log.V(1).WithName("token-files"))
+		if err := mgr.Add(watcher); err != nil {
+			return fmt.Errorf("add token file watcher to controller manager: %w", err)
+		}
+	}
+
 	ids.log.V(app.VerbosityVerbose).Info("Adding scraper to manager")
 	if err := mgr.Add(scraper); err != nil {
 		return fmt.Errorf("add scraper to controller manager: %w", err)
 	}
+	if err := mgr.Add(podRefresher); err != nil {
+		return fmt.Errorf("add pod refresher to controller manager: %w", err)
+	}
+
+	if ids.etcdRegistry != nil {
+		if err := ids.addEtcdToManager(mgr); err != nil {
+			return err
+		}
+	}
+
+	if ids.config.StaleKapiFaultCount > 0 {
+		ids.log.V(app.VerbosityVerbose).Info("Adding Kapi janitor to manager")
+		janitor := newKapiJanitor(
+			ids.inputDataRegistry,
+			mgr.GetAPIReader(),
+			ids.config.StaleKapiCheckPeriod,
+			ids.config.StaleKapiFaultCount,
+			ids.log.V(1).WithName("janitor"))
+		if err := mgr.Add(janitor); err != nil {
+			return fmt.Errorf("add Kapi janitor to controller manager: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// addEtcdToManager adds the etcd pod controller and the etcd scraper to the specified manager
+func (ids *inputDataService) addEtcdToManager(mgr manager.Manager) error {
+	ids.log.V(app.VerbosityVerbose).Info("Adding etcd controller and scraper to manager")
+	etcdControllerOptions := controller.Options{
+		RateLimiter: workqueue.NewMaxOfRateLimiter(
+			workqueue.NewItemExponentialFailureRateLimiter(1*time.Second, 10*time.Minute),
+			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+		),
+	}
+	ids.config.PodController.Apply(&etcdControllerOptions)
+	etcdControllerCondition := ids.conditionRegistry.NewScopedReporter(
+		EtcdControllerConditionType, controllerDegradedThreshold, true, ids.shootCount)
+	if err := etcd.AddControllerToManager(
+		mgr,
+		ids.etcdRegistry,
+		etcdControllerOptions,
+		ids.config.EtcdMetricsPort,
+		ids.kapiSelector,
+		etcdControllerCondition,
+		ids.log.V(1)); err != nil {
+		return fmt.Errorf("add etcd controller to manager: %w", err)
+	}
 
+	etcdScraper := etcd.NewScraper(
+		ids.etcdRegistry,
+		ids.config.ScrapePeriod,
+		ids.isNamespaceOwned,
+		ids.conditionRegistry.NewScopedReporter(EtcdScraperConditionType, scraperDegradedThreshold, true, ids.shootCount),
+		ids.log.V(1).WithName("etcd-scraper"))
+	if err := mgr.Add(etcdScraper); err != nil {
+		return fmt.Errorf("add etcd scraper to controller manager: %w", err)
+	}
 	return nil
 }
 
+func (ids *inputDataService) WarmupGate() *WarmupGate {
+	return ids.warmupGate
+}
+
+func (ids *inputDataService) SetShardPredicate(isNamespaceOwned func(namespace string) bool) {
+	ids.isNamespaceOwned = isNamespaceOwned
+}
+
+func (ids *inputDataService) SetKapiSelector(selector *gutil.KapiSelector) {
+	ids.kapiSelector = selector
+}
+
+func (ids *inputDataService) SetMetricsRegisterer(registerer prometheus.Registerer) {
+	ids.metricsRegisterer = registerer
+}
+
+func (ids *inputDataService) SetStartGate(gate func(ctx context.Context) error) {
+	ids.startGate = gate
+}
+
+func (ids *inputDataService) SetConditionRegistry(registry *conditions.Registry) {
+	ids.conditionRegistry = registry
+	ids.inputDataRegistry.SetKapiWatcherCondition(registry.NewReporter(KapiWatcherConditionType, 1, true))
+	registry.AddInfo(samplingInfoName, func() any { return ids.getSamplingInfo() })
+	registry.AddInfo(scrapeCoverageInfoName, func() any { return getScrapeCoverageInfo(ids.inputDataRegistry) })
+}
+
+// samplingInfo holds the effective sampling settings, as exposed at the debug endpoint
+type samplingInfo struct {
+	ScrapePeriod           string `json:"scrapePeriod"`
+	ConfiguredMinSampleGap string `json:"configuredMinSampleGap"`
+	// The minimum sample gap which applies to Kapis without a scrape period override. Kapis with an override get
+	// their own effective gap, calculated the same way. See [input_data_registry.EffectiveMinSampleGap].
+	EffectiveMinSampleGap string `json:"effectiveMinSampleGap"`
+}
+
+// getSamplingInfo returns the current effective sampling settings
+func (ids *inputDataService) getSamplingInfo() samplingInfo {
+	ids.scraperLock.Lock()
+	defer ids.scraperLock.Unlock()
+
+	return samplingInfo{
+		ScrapePeriod:           ids.config.ScrapePeriod.String(),
+		ConfiguredMinSampleGap: ids.config.MinSampleGap.String(),
+		EffectiveMinSampleGap: input_data_registry.EffectiveMinSampleGap(
+			ids.config.MinSampleGap, ids.config.ScrapePeriod).String(),
+	}
+}
+
+// logMinSampleGapConflict logs a warning, if the minimum sample gap is too large for the scrape period, and is
+// therefore reduced. See [input_data_registry.EffectiveMinSampleGap].
+func logMinSampleGapConflict(minSampleGap time.Duration, scrapePeriod time.Duration, log logr.Logger) {
+	effectiveMinSampleGap := input_data_registry.EffectiveMinSampleGap(minSampleGap, scrapePeriod)
+	if effectiveMinSampleGap < minSampleGap {
+		log.V(app.VerbosityWarning).Info(
+			"The minimum sample gap is too large for the scrape period, and is reduced to a third of the scrape period",
+			"minSampleGap", minSampleGap,
+			"scrapePeriod", scrapePeriod,
+			"effectiveMinSampleGap", effectiveMinSampleGap)
+	}
+}
+
+func (ids *inputDataService) NotifyNamespaceQueried(namespace string) {
+	ids.scraperLock.Lock()
+	scraper := ids.scraper
+	ids.scraperLock.Unlock()
+
+	if scraper != nil {
+		scraper.NotifyNamespaceQueried(namespace)
+	}
+}
+
+func (ids *inputDataService) ExpediteNamespace(namespace string) int {
+	ids.scraperLock.Lock()
+	scraper := ids.scraper
+	ids.scraperLock.Unlock()
+
+	if scraper == nil {
+		return 0
+	}
+	return scraper.ExpediteNamespace(namespace)
+}
+
+func (ids *inputDataService) RequestPodReconcile(namespace string, podName string) bool {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: podName}}
+	select {
+	case ids.podReconcileRequests <- event.GenericEvent{Object: pod}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (ids *inputDataService) ApplyReloadableConfig(cliConfig *CLIConfig) {
+	ids.scraperLock.Lock()
+	defer ids.scraperLock.Unlock()
+
+	if cliConfig.ScrapePeriod != ids.config.ScrapePeriod {
+		ids.inputDataRegistry.SetDefaultScrapePeriod(cliConfig.ScrapePeriod)
+		logMinSampleGapConflict(ids.config.MinSampleGap, cliConfig.ScrapePeriod, ids.log)
+	}
+
+	if ids.scraper == nil {
+		// Not added to a manager yet. The scraper will pick the settings up upon creation.
+		ids.config.ScrapePeriod = cliConfig.ScrapePeriod
+		ids.config.NamespaceFilter = cliConfig.NamespaceFilter
+		return
+	}
+
+	if cliConfig.ScrapePeriod != ids.config.ScrapePeriod {
+		ids.scraper.SetScrapePeriod(cliConfig.ScrapePeriod)
+		ids.config.ScrapePeriod = cliConfig.ScrapePeriod
+	}
+	if !reflect.DeepEqual(cliConfig.NamespaceFilter, ids.config.NamespaceFilter) {
+		ids.scraper.SetNamespaceFilter(cliConfig.NamespaceFilter)
+		ids.config.NamespaceFilter = cliConfig.NamespaceFilter
+	}
+}
+
 //#region Test isolation
 
 // testIsolation contains all points of indirection necessary to isolate static function calls
@@ -139,6 +581,7 @@ type testIsolation struct {
 	NewScraper func(dataRegistry input_data_registry.InputDataRegistry,
 		scrapePeriod time.Duration,
 		scrapeFlowControlPeriod time.Duration,
+		options metrics_scraper.ScraperOptions,
 		log logr.Logger) *metrics_scraper.Scraper
 }
 
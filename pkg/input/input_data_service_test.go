@@ -5,15 +5,35 @@
 package input
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"time"
 
 	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 
-	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/metrics_scraper"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
 )
 
+// fakeManager is a [manager.Manager] which only supports Add. It records the added runnables.
+type fakeManager struct {
+	manager.Manager
+	runnables []manager.Runnable
+}
+
+func (fm *fakeManager) Add(runnable manager.Runnable) error {
+	fm.runnables = append(fm.runnables, runnable)
+	return nil
+}
+
 var _ = Describe("input.inputDataService", func() {
 	const (
 		testScrapePeriod            = 1 * time.Minute
@@ -22,14 +42,14 @@ var _ = Describe("input.inputDataService", func() {
 	)
 
 	var (
-		newInputDataService = func() (*inputDataService, *input_data_registry.FakeInputDataRegistry) {
-			var idr *input_data_registry.FakeInputDataRegistry
+		newInputDataService = func() (*inputDataService, *fakes.FakeInputDataRegistry) {
+			var idr *fakes.FakeInputDataRegistry
 			instrumentedFactory := NewInputDataServiceFactory()
 			instrumentedFactory.newInputDataServiceFunc =
 				func(cliConfig *CLIConfig, parentLogger logr.Logger) InputDataService {
 
 					ids := NewInputDataServiceFactory().NewInputDataService(cliConfig, parentLogger).(*inputDataService)
-					idr = &input_data_registry.FakeInputDataRegistry{MinSampleGap: cliConfig.MinSampleGap}
+					idr = &fakes.FakeInputDataRegistry{MinSampleGap: cliConfig.MinSampleGap}
 					ids.inputDataRegistry = idr
 					return ids
 				}
@@ -50,7 +70,7 @@ var _ = Describe("input.inputDataService", func() {
 			ids, _ := newInputDataService()
 
 			// Assert
-			Expect(ids.inputDataRegistry.(*input_data_registry.FakeInputDataRegistry).MinSampleGap).To(Equal(testMinSampleGap))
+			Expect(ids.inputDataRegistry.(*fakes.FakeInputDataRegistry).MinSampleGap).To(Equal(testMinSampleGap))
 		})
 	})
 
@@ -69,4 +89,136 @@ var _ = Describe("input.inputDataService", func() {
 			Expect(kapis[0].PodName()).To(Equal("pod"))
 		})
 	})
+
+	Describe("DataRegistry", func() {
+		It("should return the registry supplied to the scraper", func() {
+			// Arrange
+			ids, idr := newInputDataService()
+
+			// Act
+			result := ids.DataRegistry()
+
+			// Assert
+			Expect(result).To(BeIdenticalTo(idr))
+		})
+	})
+
+	Describe("ApplyReloadableConfig", func() {
+		It("should update the scrape period and namespace filter, and ignore all other settings", func() {
+			// Arrange
+			ids, _ := newInputDataService()
+			filter := metrics_scraper.NamespaceFilter{Exclude: []string{"shoot--garden-*"}}
+
+			// Act
+			ids.ApplyReloadableConfig(&CLIConfig{
+				ScrapePeriod:    2 * testScrapePeriod,
+				MinSampleGap:    2 * testMinSampleGap,
+				NamespaceFilter: filter,
+			})
+
+			// Assert
+			Expect(ids.config.ScrapePeriod).To(Equal(2 * testScrapePeriod))
+			Expect(ids.config.NamespaceFilter).To(Equal(filter))
+			Expect(ids.config.MinSampleGap).To(Equal(testMinSampleGap))
+		})
+
+		It("should pass changed settings to the scraper", func() {
+			// Arrange
+			ids, idr := newInputDataService()
+			ids.scraper = metrics_scraper.NewScraper(
+				idr, testScrapePeriod, testScrapeFlowControlPeriod, metrics_scraper.ScraperOptions{}, logr.Discard())
+
+			// Act
+			ids.ApplyReloadableConfig(&CLIConfig{ScrapePeriod: 2 * testScrapePeriod})
+
+			// Assert
+			Expect(ids.config.ScrapePeriod).To(Equal(2 * testScrapePeriod))
+		})
+
+		It("should pass a changed scrape period to the registry, so it can adjust the effective sample gap", func() {
+			// Arrange
+			ids, idr := newInputDataService()
+
+			// Act
+			ids.ApplyReloadableConfig(&CLIConfig{ScrapePeriod: 2 * testScrapePeriod})
+
+			// Assert
+			Expect(idr.DefaultScrapePeriod).To(Equal(2 * testScrapePeriod))
+		})
+	})
+
+	Describe("RequestPodReconcile", func() {
+		It("should pass the pod to the pod controller, and drop requests beyond capacity", func() {
+			// Arrange
+			ids, _ := newInputDataService()
+			for i := 0; i < podReconcileRequestCapacity-1; i++ {
+				Expect(ids.RequestPodReconcile("ns", "other")).To(BeTrue())
+			}
+
+			// Act
+			accepted := ids.RequestPodReconcile("ns", "pod")
+			dropped := !ids.RequestPodReconcile("ns", "pod")
+
+			// Assert
+			Expect(accepted).To(BeTrue())
+			Expect(dropped).To(BeTrue())
+			var last client.Object
+			for len(ids.podReconcileRequests) > 0 {
+				last = (<-ids.podReconcileRequests).Object
+			}
+			Expect(last.GetNamespace()).To(Equal("ns"))
+			Expect(last.GetName()).To(Equal("pod"))
+		})
+	})
+
+	Describe("SetMetricsRegisterer", func() {
+		It("should let the services of different clusters register their metrics with the same registry", func() {
+			// Arrange
+			registry := prometheus.NewRegistry()
+			var services []*inputDataService
+			for _, cluster := range []string{"", "other"} {
+				ids, _ := newInputDataService()
+				// Simulation mode keeps AddToManager within the capabilities of the fake manager
+				ids.config.Simulation = &SimulationConfig{ShootCount: 1, KapiCountPerShoot: 1}
+				ids.SetMetricsRegisterer(prometheus.WrapRegistererWith(prometheus.Labels{"cluster": cluster}, registry))
+				services = append(services, ids)
+			}
+
+			// Act
+			err1 := services[0].AddToManager(&fakeManager{})
+			err2 := services[1].AddToManager(&fakeManager{})
+
+			// Assert
+			Expect(err1).To(Succeed())
+			Expect(err2).To(Succeed())
+			count, err := promtestutil.GatherAndCount(registry, "gardener_custom_metrics_seed_scrape_coverage_ratio")
+			Expect(err).To(Succeed())
+			Expect(count).To(Equal(2))
+		})
+	})
+
+	Describe("SetConditionRegistry", func() {
+		It("should expose the effective sampling settings at the debug endpoint", func() {
+			// Arrange
+			ids, _ := newInputDataService()
+			registry := conditions.NewRegistry(logr.Discard())
+			recorder := httptest.NewRecorder()
+
+			// Act
+			ids.SetConditionRegistry(registry)
+			ids.ApplyReloadableConfig(&CLIConfig{ScrapePeriod: 30 * time.Second})
+
+			// Assert
+			registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, conditions.DebugPath, nil))
+			var response struct {
+				Info map[string]samplingInfo `json:"info"`
+			}
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Info).To(HaveKeyWithValue(samplingInfoName, samplingInfo{
+				ScrapePeriod:           "30s",
+				ConfiguredMinSampleGap: "20s",
+				EffectiveMinSampleGap:  "10s",
+			}))
+		})
+	})
 })
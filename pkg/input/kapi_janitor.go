@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// kapiJanitor removes stale Kapi records from the registry. A record is stale if the pod controller missed the delete
+// event for the respective pod (e.g. during a disconnect from the seed kube-apiserver), so the scraper keeps failing to
+// scrape a pod which no longer exists.
+//
+// The janitor periodically checks Kapis whose consecutive scrape fault count reached a threshold, and removes the ones
+// whose pod is confirmed missing by a direct (non-cached) read from the seed kube-apiserver.
+//
+// kapiJanitor implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable].
+type kapiJanitor struct {
+	dataRegistry input_data_registry.InputDataRegistry
+	// Used to check whether a pod exists. Bypasses the cache, because the point is to catch cases where the
+	// cache-driven pod controller is out of sync.
+	apiReader client.Reader
+	// How often the janitor checks for stale Kapis
+	period time.Duration
+	// Kapis with fewer consecutive scrape faults than this are not checked
+	minFaultCount int
+	log           logr.Logger
+
+	testIsolation kapiJanitorTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// newKapiJanitor creates a kapiJanitor which checks the dataRegistry for stale Kapis once per period. Only Kapis which
+// have at least minFaultCount consecutive failed scrapes are considered. apiReader is used to check whether the
+// respective pod still exists.
+func newKapiJanitor(
+	dataRegistry input_data_registry.InputDataRegistry,
+	apiReader client.Reader,
+	period time.Duration,
+	minFaultCount int,
+	log logr.Logger) *kapiJanitor {
+
+	return &kapiJanitor{
+		dataRegistry:  dataRegistry,
+		apiReader:     apiReader,
+		period:        period,
+		minFaultCount: minFaultCount,
+		log:           log,
+		testIsolation: kapiJanitorTestIsolation{TimeAfter: time.After},
+	}
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It periodically removes stale Kapi
+// records, until the context is cancelled.
+func (j *kapiJanitor) Start(ctx context.Context) error {
+	j.log.V(app.VerbosityVerbose).Info("Kapi janitor started", "period", j.period, "minFaultCount", j.minFaultCount)
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.log.V(app.VerbosityInfo).Info("Context closed, exiting")
+			return nil
+		case <-j.testIsolation.TimeAfter(j.period):
+			j.removeStaleKapis(ctx)
+		}
+	}
+}
+
+// removeStaleKapis performs a single pass over the faulty Kapis in the registry, and removes the ones whose pod no
+// longer exists.
+func (j *kapiJanitor) removeStaleKapis(ctx context.Context) {
+	for _, kapi := range j.dataRegistry.GetFaultyKapiData(j.minFaultCount) {
+		log := j.log.WithValues("namespace", kapi.ShootNamespace(), "pod", kapi.PodName())
+
+		pod := &corev1.Pod{}
+		err := j.apiReader.Get(ctx, client.ObjectKey{Namespace: kapi.ShootNamespace(), Name: kapi.PodName()}, pod)
+		if err == nil {
+			if pod.UID == kapi.PodUID {
+				// The pod exists. Scrape failures are due to some other reason.
+				continue
+			}
+			// A new pod with the same name replaced the one we track. The stale record will be updated by the pod
+			// controller once it catches up.
+			log.V(app.VerbosityVerbose).Info("Kapi pod was recreated, leaving record update to the pod controller")
+			continue
+		}
+		if !errors.IsNotFound(err) {
+			log.V(app.VerbosityError).Error(err, "Failed to check whether faulty Kapi pod still exists")
+			continue
+		}
+
+		log.V(app.VerbosityInfo).Info(
+			"Removing record for Kapi pod which no longer exists", "faultCount", kapi.FaultCount)
+		j.dataRegistry.RemoveKapiData(kapi.ShootNamespace(), kapi.PodName())
+	}
+}
+
+//#region Test isolation
+
+// kapiJanitorTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the kapiJanitor unit during tests
+type kapiJanitorTestIsolation struct {
+	// Points to [time.After]
+	TimeAfter func(time.Duration) <-chan time.Time
+}
+
+//#endregion Test isolation
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+var _ = Describe("input.kapiJanitor", func() {
+	const (
+		nsName        = "shoot--my-shoot"
+		podName       = "kube-apiserver-1"
+		podUID        = types.UID("pod-uid")
+		minFaultCount = 3
+	)
+
+	var (
+		newTestJanitor = func(objects ...*corev1.Pod) (*kapiJanitor, input_data_registry.InputDataRegistry) {
+			builder := fake.NewClientBuilder()
+			for _, obj := range objects {
+				builder = builder.WithObjects(obj)
+			}
+			idr := input_data_registry.NewInputDataRegistry(time.Minute, logr.Discard())
+			idr.SetKapiData(nsName, podName, podUID, nil, "")
+			return newKapiJanitor(idr, builder.Build(), time.Minute, minFaultCount, logr.Discard()), idr
+		}
+		notifyFaults = func(idr input_data_registry.InputDataRegistry, count int) {
+			for i := 0; i < count; i++ {
+				idr.NotifyKapiMetricsFault(nsName, podName, input_data_registry.ScrapeErrorNetwork)
+			}
+		}
+	)
+
+	Describe("removeStaleKapis", func() {
+		It("should remove a faulty Kapi whose pod does not exist", func() {
+			// Arrange
+			janitor, idr := newTestJanitor()
+			notifyFaults(idr, minFaultCount)
+
+			// Act
+			janitor.removeStaleKapis(context.Background())
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName)).To(BeNil())
+		})
+
+		It("should not remove a faulty Kapi whose pod exists", func() {
+			// Arrange
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: nsName, Name: podName, UID: podUID}}
+			janitor, idr := newTestJanitor(pod)
+			notifyFaults(idr, minFaultCount)
+
+			// Act
+			janitor.removeStaleKapis(context.Background())
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName)).NotTo(BeNil())
+		})
+
+		It("should not remove a Kapi whose fault count is below the threshold, even if its pod does not exist", func() {
+			// Arrange
+			janitor, idr := newTestJanitor()
+			notifyFaults(idr, minFaultCount-1)
+
+			// Act
+			janitor.removeStaleKapis(context.Background())
+
+			// Assert
+			Expect(idr.GetKapiData(nsName, podName)).NotTo(BeNil())
+		})
+	})
+
+	Describe("Start", func() {
+		It("should remove stale Kapis when the period elapses, and exit when the context is cancelled", func() {
+			// Arrange
+			janitor, idr := newTestJanitor()
+			notifyFaults(idr, minFaultCount)
+			timeChannel := make(chan time.Time)
+			janitor.testIsolation.TimeAfter = func(period time.Duration) <-chan time.Time {
+				Expect(period).To(Equal(time.Minute))
+				return timeChannel
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			exited := make(chan struct{})
+
+			// Act
+			go func() {
+				defer close(exited)
+				Expect(janitor.Start(ctx)).To(Succeed())
+			}()
+			Consistently(func() *input_data_registry.KapiData { return idr.GetKapiData(nsName, podName) }).
+				WithTimeout(50 * time.Millisecond).ShouldNot(BeNil())
+			timeChannel <- time.Now()
+
+			// Assert
+			Eventually(func() *input_data_registry.KapiData { return idr.GetKapiData(nsName, podName) }).Should(BeNil())
+			cancel()
+			Eventually(exited).Should(BeClosed())
+		})
+	})
+})
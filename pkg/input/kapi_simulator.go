@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// The waveforms which can shape the simulated request rate over time
+const (
+	WaveformConstant = "constant"
+	WaveformSine     = "sine"
+	WaveformSquare   = "square"
+	WaveformSawtooth = "sawtooth"
+)
+
+// The simulated number of in-flight requests is derived from the request rate, assuming this average request duration
+const simulatedRequestDuration = 50 * time.Millisecond
+
+// SimulationConfig directs the population of the input data registry with synthetic Kapis, in place of scraping the
+// Kapis of actual shoots.
+type SimulationConfig struct {
+	ShootCount        int // How many shoots are simulated
+	KapiCountPerShoot int // How many Kapi pods each simulated shoot has
+
+	// One of the WaveformXxx constants. Each Kapi's request rate oscillates between BaseRate - Amplitude and
+	// BaseRate + Amplitude (but not below zero) according to the waveform, with a period of WaveformPeriod. The waves of
+	// different shoots are phase shifted, so that the shoots spread evenly across a single period.
+	Waveform       string
+	BaseRate       float64 // Requests per second
+	Amplitude      float64 // Requests per second
+	WaveformPeriod time.Duration
+}
+
+// validateSimulationWaveform returns an error if the specified waveform is not one of the WaveformXxx constants
+func validateSimulationWaveform(waveform string) error {
+	switch waveform {
+	case WaveformConstant, WaveformSine, WaveformSquare, WaveformSawtooth:
+		return nil
+	}
+	return fmt.Errorf(
+		"unknown waveform '%s'. Must be one of '%s', '%s', '%s', '%s'",
+		waveform, WaveformConstant, WaveformSine, WaveformSquare, WaveformSawtooth)
+}
+
+// kapiSimulator populates the registry with synthetic Kapis, and updates their request counters according to a
+// configurable waveform, so the metrics API can be exercised without a seed which hosts actual shoots.
+//
+// kapiSimulator implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable].
+type kapiSimulator struct {
+	dataRegistry input_data_registry.InputDataRegistry
+	config       *SimulationConfig
+	// How often the simulated request counters are updated
+	updatePeriod time.Duration
+	log          logr.Logger
+
+	// The simulated value of each Kapi's request counter. Indexed by shoot, then by Kapi. Only accessed by Start.
+	requestCounts [][]float64
+
+	testIsolation kapiSimulatorTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// newKapiSimulator creates a kapiSimulator which maintains the synthetic Kapis specified by config, in dataRegistry.
+// The request counters are updated once per updatePeriod.
+func newKapiSimulator(
+	dataRegistry input_data_registry.InputDataRegistry,
+	config *SimulationConfig,
+	updatePeriod time.Duration,
+	log logr.Logger) *kapiSimulator {
+
+	requestCounts := make([][]float64, config.ShootCount)
+	for i := range requestCounts {
+		requestCounts[i] = make([]float64, config.KapiCountPerShoot)
+	}
+
+	return &kapiSimulator{
+		dataRegistry:  dataRegistry,
+		config:        config,
+		updatePeriod:  updatePeriod,
+		log:           log,
+		requestCounts: requestCounts,
+		testIsolation: kapiSimulatorTestIsolation{TimeNow: time.Now, TimeAfter: time.After},
+	}
+}
+
+// simulatedShootNamespace returns the namespace of the simulated shoot with the specified index
+func simulatedShootNamespace(shootIndex int) string {
+	return fmt.Sprintf("shoot--sim--shoot-%d", shootIndex)
+}
+
+// simulatedKapiPodName returns the pod name of the simulated Kapi with the specified index
+func simulatedKapiPodName(kapiIndex int) string {
+	return fmt.Sprintf("kube-apiserver-sim-%d", kapiIndex)
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It adds the simulated Kapis to the
+// registry, and periodically updates their metrics, until the context is cancelled.
+func (s *kapiSimulator) Start(ctx context.Context) error {
+	s.log.V(app.VerbosityInfo).Info(
+		"Kapi simulator started",
+		"shoots", s.config.ShootCount,
+		"kapisPerShoot", s.config.KapiCountPerShoot,
+		"waveform", s.config.Waveform)
+
+	for shoot := 0; shoot < s.config.ShootCount; shoot++ {
+		for kapi := 0; kapi < s.config.KapiCountPerShoot; kapi++ {
+			ns, pod := simulatedShootNamespace(shoot), simulatedKapiPodName(kapi)
+			s.dataRegistry.SetKapiData(
+				ns,
+				pod,
+				types.UID(ns+"/"+pod),
+				map[string]string{"app": "kubernetes", "role": "apiserver"},
+				"simulated://"+ns+"/"+pod)
+		}
+	}
+
+	startTime := s.testIsolation.TimeNow()
+	lastUpdateTime := startTime
+	s.update(0, 0)
+	for {
+		select {
+		case <-ctx.Done():
+			s.log.V(app.VerbosityInfo).Info("Context closed, exiting")
+			return nil
+		case <-s.testIsolation.TimeAfter(s.updatePeriod):
+			now := s.testIsolation.TimeNow()
+			s.update(now.Sub(startTime), now.Sub(lastUpdateTime))
+			lastUpdateTime = now
+		}
+	}
+}
+
+// update advances the simulated request counters by the specified time step, at the request rates which correspond to
+// the specified time since the start of the simulation, and records the resulting metrics in the registry.
+func (s *kapiSimulator) update(elapsed time.Duration, step time.Duration) {
+	for shoot := range s.requestCounts {
+		rate := s.rate(shoot, elapsed)
+		ns := simulatedShootNamespace(shoot)
+		for kapi := range s.requestCounts[shoot] {
+			s.requestCounts[shoot][kapi] += rate * step.Seconds()
+			pod := simulatedKapiPodName(kapi)
+			s.dataRegistry.SetKapiMetrics(ns, pod, int64(s.requestCounts[shoot][kapi]))
+			s.dataRegistry.SetKapiInflightRequests(ns, pod, int64(rate*simulatedRequestDuration.Seconds()))
+		}
+	}
+}
+
+// rate returns the simulated request rate, in requests per second, for each Kapi of the specified shoot, at the
+// specified time since the start of the simulation.
+func (s *kapiSimulator) rate(shootIndex int, elapsed time.Duration) float64 {
+	// Spread the shoots evenly across a single period
+	phase := elapsed.Seconds()/s.config.WaveformPeriod.Seconds() + float64(shootIndex)/float64(s.config.ShootCount)
+	phase -= math.Floor(phase) // In [0, 1)
+
+	var wave float64 // In [-1, 1]
+	switch s.config.Waveform {
+	case WaveformSine:
+		wave = math.Sin(2 * math.Pi * phase)
+	case WaveformSquare:
+		wave = 1
+		if phase >= 0.5 {
+			wave = -1
+		}
+	case WaveformSawtooth:
+		wave = 2*phase - 1
+	}
+
+	return math.Max(0, s.config.BaseRate+s.config.Amplitude*wave)
+}
+
+//#region Test isolation
+
+// kapiSimulatorTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the kapiSimulator unit during tests
+type kapiSimulatorTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+	// Points to [time.After]
+	TimeAfter func(time.Duration) <-chan time.Time
+}
+
+//#endregion Test isolation
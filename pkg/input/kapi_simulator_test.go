@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("input.kapiSimulator", func() {
+	var (
+		newTestSimulator = func(waveform string) (*kapiSimulator, input_data_registry.InputDataRegistry) {
+			idr := input_data_registry.NewInputDataRegistry(time.Second, logr.Discard())
+			config := &SimulationConfig{
+				ShootCount:        4,
+				KapiCountPerShoot: 2,
+				Waveform:          waveform,
+				BaseRate:          100,
+				Amplitude:         50,
+				WaveformPeriod:    4 * time.Minute,
+			}
+			return newKapiSimulator(idr, config, time.Minute, logr.Discard()), idr
+		}
+	)
+
+	Describe("rate", func() {
+		It("should shape the rate according to the waveform, phase shifting the shoots across a single period", func() {
+			// Arrange
+			sine, _ := newTestSimulator(WaveformSine)
+			square, _ := newTestSimulator(WaveformSquare)
+			sawtooth, _ := newTestSimulator(WaveformSawtooth)
+			constant, _ := newTestSimulator(WaveformConstant)
+
+			// Act & Assert
+			Expect(sine.rate(0, 0)).To(BeNumerically("~", 100, 1e-9))
+			Expect(sine.rate(0, time.Minute)).To(BeNumerically("~", 150, 1e-9))
+			Expect(sine.rate(1, 0)).To(BeNumerically("~", 150, 1e-9)) // A quarter period ahead
+			Expect(sine.rate(0, 3*time.Minute)).To(BeNumerically("~", 50, 1e-9))
+			Expect(square.rate(0, time.Minute)).To(Equal(float64(150)))
+			Expect(square.rate(0, 3*time.Minute)).To(Equal(float64(50)))
+			Expect(sawtooth.rate(0, 0)).To(Equal(float64(50)))
+			Expect(sawtooth.rate(2, 0)).To(Equal(float64(100)))
+			Expect(constant.rate(3, time.Minute)).To(Equal(float64(100)))
+		})
+
+		It("should not return negative rates", func() {
+			// Arrange
+			simulator, _ := newTestSimulator(WaveformSquare)
+			simulator.config.Amplitude = 500
+
+			// Act & Assert
+			Expect(simulator.rate(0, 3*time.Minute)).To(BeZero())
+		})
+	})
+
+	Describe("Start", func() {
+		It("should populate the registry with the simulated Kapis, and advance their counters until the context is "+
+			"cancelled", func() {
+
+			// Arrange
+			simulator, _ := newTestSimulator(WaveformConstant)
+			idr := &fakes.FakeInputDataRegistry{}
+			simulator.dataRegistry = idr
+			startTime := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+			timeNowCallCount := 0
+			simulator.testIsolation.TimeNow = func() time.Time {
+				// Each call is a minute later than the previous one
+				result := startTime.Add(time.Duration(timeNowCallCount) * time.Minute)
+				timeNowCallCount++
+				return result
+			}
+			timeAfterChan := make(chan time.Time)
+			simulator.testIsolation.TimeAfter = func(time.Duration) <-chan time.Time { return timeAfterChan }
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+
+			// Act
+			go func() { done <- simulator.Start(ctx) }()
+			timeAfterChan <- time.Time{}
+			timeAfterChan <- time.Time{}
+			cancel()
+
+			// Assert
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(idr.GetKapis()).To(HaveLen(8))
+			kapi := idr.GetKapiData(simulatedShootNamespace(3), simulatedKapiPodName(1))
+			Expect(kapi).NotTo(BeNil())
+			Expect(kapi.PodLabels).To(HaveKeyWithValue("role", "apiserver"))
+			Expect(kapi.TotalRequestCountNew).To(Equal(int64(12000)))
+			Expect(kapi.InflightRequestCount).To(Equal(int64(5)))
+		})
+	})
+})
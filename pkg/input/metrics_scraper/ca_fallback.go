@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"crypto/x509"
+	"sync"
+	"time"
+)
+
+// caSource identifies where the CA certificates used to verify a Kapi's serving certificate came from
+type caSource int
+
+const (
+	// caSourceNone - no CA certificates are available for the shoot
+	caSourceNone caSource = iota
+	// caSourceShoot - the shoot's own CA certificates, as currently on record in the registry
+	caSourceShoot
+	// caSourceCached - the shoot's CA certificates, as last seen before they went missing from the registry
+	caSourceCached
+	// caSourceFallback - the generic fallback CA bundle
+	caSourceFallback
+)
+
+// caFallback bridges the temporary absence of a shoot's CA certificates from the registry, which typically occurs
+// while the CA secret is being rotated. It remembers the CA certificates last seen for each shoot, and keeps offering
+// them for a grace period after they go missing. After that, it offers the fallback CA bundle, if there is one.
+//
+// All methods are concurrency-safe.
+type caFallback struct {
+	// How long the last seen CA certificates of a shoot are used, after they go missing. Zero disables caching.
+	gracePeriod time.Duration
+	// If not nil, used after the grace period expires
+	fallbackPool *x509.CertPool
+
+	// Maps <shoot namespace> -> <CA certificates last seen for the shoot>
+	cache     map[string]cachedCA
+	lastSweep time.Time // When were the expired cache entries last removed
+	lock      sync.Mutex
+}
+
+// cachedCA is the CA certificates of a shoot, as last seen in the registry
+type cachedCA struct {
+	pool     *x509.CertPool
+	lastSeen time.Time
+}
+
+// newCAFallback creates a caFallback with the specified grace period and fallback CA bundle. See caFallback.
+func newCAFallback(gracePeriod time.Duration, fallbackPool *x509.CertPool) *caFallback {
+	return &caFallback{
+		gracePeriod:  gracePeriod,
+		fallbackPool: fallbackPool,
+		cache:        make(map[string]cachedCA),
+	}
+}
+
+// resolve returns the CA certificates to use for the specified shoot, and where they came from. registryPool is the
+// shoot's CA certificates, as currently on record in the registry. Nil, if there are none. The result is nil, if no CA
+// certificates are available for the shoot.
+func (f *caFallback) resolve(namespace string, registryPool *x509.CertPool, now time.Time) (*x509.CertPool, caSource) {
+	if f.gracePeriod <= 0 {
+		if registryPool != nil {
+			return registryPool, caSourceShoot
+		}
+		if f.fallbackPool != nil {
+			return f.fallbackPool, caSourceFallback
+		}
+		return nil, caSourceNone
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.sweepThreadUnsafe(now)
+	if registryPool != nil {
+		f.cache[namespace] = cachedCA{pool: registryPool, lastSeen: now}
+		return registryPool, caSourceShoot
+	}
+	if cached, ok := f.cache[namespace]; ok && now.Sub(cached.lastSeen) < f.gracePeriod {
+		return cached.pool, caSourceCached
+	}
+	if f.fallbackPool != nil {
+		return f.fallbackPool, caSourceFallback
+	}
+	return nil, caSourceNone
+}
+
+// sweepThreadUnsafe removes the cache entries whose grace period has expired, no more often than once per grace
+// period. The caller must hold the lock.
+func (f *caFallback) sweepThreadUnsafe(now time.Time) {
+	if now.Sub(f.lastSweep) < f.gracePeriod {
+		return
+	}
+
+	f.lastSweep = now
+	for namespace, cached := range f.cache {
+		if now.Sub(cached.lastSeen) >= f.gracePeriod {
+			delete(f.cache, namespace)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"crypto/x509"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("input.metrics_scraper.caFallback", func() {
+	const (
+		testNs = "shoot--my-shoot"
+	)
+
+	Describe("resolve", func() {
+		It("should return the shoot's CA certificates, if there are any in the registry", func() {
+			// Arrange
+			fallback := newCAFallback(time.Minute, x509.NewCertPool())
+			shootPool := getExampleCertPool()
+
+			// Act
+			pool, source := fallback.resolve(testNs, shootPool, gcmtesting.NewTime(1, 0, 0))
+
+			// Assert
+			Expect(pool).To(BeIdenticalTo(shootPool))
+			Expect(source).To(Equal(caSourceShoot))
+		})
+		It("should return the last seen CA certificates during the grace period, and the fallback ones after it", func() {
+			// Arrange
+			fallbackPool := x509.NewCertPool()
+			fallback := newCAFallback(time.Minute, fallbackPool)
+			shootPool := getExampleCertPool()
+			fallback.resolve(testNs, shootPool, gcmtesting.NewTime(1, 0, 0))
+
+			// Act
+			poolInGrace, sourceInGrace := fallback.resolve(testNs, nil, gcmtesting.NewTime(1, 0, 59))
+			poolAfterGrace, sourceAfterGrace := fallback.resolve(testNs, nil, gcmtesting.NewTime(1, 1, 0))
+
+			// Assert
+			Expect(poolInGrace).To(BeIdenticalTo(shootPool))
+			Expect(sourceInGrace).To(Equal(caSourceCached))
+			Expect(poolAfterGrace).To(BeIdenticalTo(fallbackPool))
+			Expect(sourceAfterGrace).To(Equal(caSourceFallback))
+		})
+		It("should return nothing, if the grace period expired and there is no fallback", func() {
+			// Arrange
+			fallback := newCAFallback(time.Minute, nil)
+			fallback.resolve(testNs, getExampleCertPool(), gcmtesting.NewTime(1, 0, 0))
+
+			// Act
+			poolOtherNs, sourceOtherNs := fallback.resolve("shoot--other", nil, gcmtesting.NewTime(1, 0, 30))
+			pool, source := fallback.resolve(testNs, nil, gcmtesting.NewTime(1, 2, 0))
+
+			// Assert
+			Expect(poolOtherNs).To(BeNil())
+			Expect(sourceOtherNs).To(Equal(caSourceNone))
+			Expect(pool).To(BeNil())
+			Expect(source).To(Equal(caSourceNone))
+		})
+		It("should not remember CA certificates, if the grace period is zero", func() {
+			// Arrange
+			fallback := newCAFallback(0, nil)
+			fallback.resolve(testNs, getExampleCertPool(), gcmtesting.NewTime(1, 0, 0))
+
+			// Act
+			pool, source := fallback.resolve(testNs, nil, gcmtesting.NewTime(1, 0, 0))
+
+			// Assert
+			Expect(pool).To(BeNil())
+			Expect(source).To(Equal(caSourceNone))
+			Expect(fallback.cache).To(BeEmpty())
+		})
+		It("should remove expired cache entries", func() {
+			// Arrange
+			fallback := newCAFallback(time.Minute, nil)
+			fallback.resolve(testNs, getExampleCertPool(), gcmtesting.NewTime(1, 0, 0))
+
+			// Act
+			fallback.resolve("shoot--other", getExampleCertPool(), gcmtesting.NewTime(1, 5, 0))
+
+			// Assert
+			Expect(fallback.cache).To(HaveLen(1))
+			Expect(fallback.cache).To(HaveKey("shoot--other"))
+		})
+	})
+})
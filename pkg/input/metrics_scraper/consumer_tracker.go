@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"sync"
+	"time"
+)
+
+// consumerSweepPeriod is how often consumerTracker looks for shoots whose consumers have gone
+const consumerSweepPeriod = 10 * time.Second
+
+// consumerTracker tracks which shoots have consumers of their metrics, e.g. a horizontal pod autoscaler. A shoot is
+// considered consumed if its metrics were queried within the consumer window.
+//
+// All methods are concurrency-safe.
+type consumerTracker struct {
+	// A shoot which was not queried for this long is no longer considered consumed
+	window time.Duration
+
+	// Maps <shoot namespace> -> <time of last query>. Contains only the consumed shoots.
+	lastQueryTimes map[string]time.Time
+	lastSweep      time.Time // When were the shoots which are no longer consumed last looked for
+	lock           sync.Mutex
+}
+
+// newConsumerTracker creates a consumerTracker with the specified consumer window. See consumerTracker.
+func newConsumerTracker(window time.Duration) *consumerTracker {
+	return &consumerTracker{
+		window:         window,
+		lastQueryTimes: make(map[string]time.Time),
+	}
+}
+
+// notifyQueried records that the metrics of the shoot in the specified namespace were queried at the specified time.
+// Returns true if the shoot was not considered consumed before that.
+func (t *consumerTracker) notifyQueried(namespace string, now time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	_, wasConsumed := t.lastQueryTimes[namespace]
+	t.lastQueryTimes[namespace] = now
+	return !wasConsumed
+}
+
+// expire stops considering consumed the shoots which were not queried within the consumer window, as of the specified
+// time, and returns their namespaces. Looks for such shoots no more often than once per consumerSweepPeriod, and
+// returns nil in between.
+func (t *consumerTracker) expire(now time.Time) []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if now.Sub(t.lastSweep) < consumerSweepPeriod {
+		return nil
+	}
+
+	t.lastSweep = now
+	var result []string
+	for namespace, lastQueryTime := range t.lastQueryTimes {
+		if now.Sub(lastQueryTime) >= t.window {
+			delete(t.lastQueryTimes, namespace)
+			result = append(result, namespace)
+		}
+	}
+	return result
+}
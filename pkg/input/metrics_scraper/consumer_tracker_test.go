@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("input.metrics_scraper.consumerTracker", func() {
+	const (
+		testNs = "shoot--my-shoot"
+	)
+
+	Describe("notifyQueried", func() {
+		It("should return true only for the first query of a shoot which is not consumed", func() {
+			// Arrange
+			tracker := newConsumerTracker(time.Minute)
+
+			// Act
+			isFirst := tracker.notifyQueried(testNs, gcmtesting.NewTime(1, 0, 0))
+			isSecond := tracker.notifyQueried(testNs, gcmtesting.NewTime(1, 0, 30))
+
+			// Assert
+			Expect(isFirst).To(BeTrue())
+			Expect(isSecond).To(BeFalse())
+		})
+	})
+
+	Describe("expire", func() {
+		It("should return the shoots which were not queried within the window, and forget them", func() {
+			// Arrange
+			tracker := newConsumerTracker(time.Minute)
+			tracker.notifyQueried(testNs, gcmtesting.NewTime(1, 0, 0))
+			tracker.notifyQueried("shoot--other", gcmtesting.NewTime(1, 0, 30))
+
+			// Act
+			expired := tracker.expire(gcmtesting.NewTime(1, 1, 0))
+
+			// Assert
+			Expect(expired).To(ConsistOf(testNs))
+			Expect(tracker.notifyQueried(testNs, gcmtesting.NewTime(1, 1, 1))).To(BeTrue())
+			Expect(tracker.notifyQueried("shoot--other", gcmtesting.NewTime(1, 1, 1))).To(BeFalse())
+		})
+		It("should look for expired shoots no more often than once per sweep period", func() {
+			// Arrange
+			tracker := newConsumerTracker(time.Second)
+			tracker.notifyQueried(testNs, gcmtesting.NewTime(1, 0, 0))
+			tracker.expire(gcmtesting.NewTime(1, 0, 0))
+
+			// Act
+			expiredTooSoon := tracker.expire(gcmtesting.NewTime(1, 0, 5))
+			expired := tracker.expire(gcmtesting.NewTime(1, 0, 10))
+
+			// Assert
+			Expect(expiredTooSoon).To(BeEmpty())
+			Expect(expired).To(ConsistOf(testNs))
+		})
+	})
+})
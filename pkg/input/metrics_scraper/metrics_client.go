@@ -6,88 +6,243 @@ package metrics_scraper
 
 import (
 	"bufio"
+	"bytes"
 	"compress/gzip"
 	"context"
-	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	neturl "net/url"
+	"runtime/pprof"
+	"slices"
 	"strconv"
-	"strings"
+	"time"
 
 	krest "k8s.io/client-go/rest"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/tracing"
 )
 
 const (
-	metricName = "apiserver_request_total"
+	metricName         = "apiserver_request_total"
+	inflightMetricName = "apiserver_current_inflight_requests"
+	cpuMetricName      = "process_cpu_seconds_total"
+	memoryMetricName   = "process_resident_memory_bytes"
+	// The sum and count series of the apiserver_request_duration_seconds histogram
+	durationSumMetricName   = "apiserver_request_duration_seconds_sum"
+	durationCountMetricName = "apiserver_request_duration_seconds_count"
+	startTimeMetricName     = "process_start_time_seconds"
 )
 
+// errNoRequestCounters is the error reported when a metrics response contains no apiserver_request_total counters
+var errNoRequestCounters = fmt.Errorf("the response contains no '%s' counters", metricName)
+
+// kapiMetrics holds the values obtained from a single scrape of a Kapi metrics endpoint
+type kapiMetrics struct {
+	TotalRequestCount    int64 // The sum of all apiserver_request_total counters
+	ClientErrorCount     int64 // The sum of the apiserver_request_total counters with a 4xx code
+	ServerErrorCount     int64 // The sum of the apiserver_request_total counters with a 5xx code
+	InflightRequestCount int64 // The sum of all apiserver_current_inflight_requests gauges (mutating + readOnly)
+	// Whether InflightRequestCount is valid, i.e. the response contained at least one
+	// apiserver_current_inflight_requests gauge
+	HasInflightRequestCount bool
+	CPUSeconds              float64 // The process_cpu_seconds_total counter of the kube-apiserver process
+	HasCPUSeconds           bool    // Whether CPUSeconds is valid, i.e. the response contained the counter
+	ResidentMemoryBytes     int64   // The process_resident_memory_bytes gauge of the kube-apiserver process
+	HasResidentMemoryBytes  bool    // Whether ResidentMemoryBytes is valid, i.e. the response contained the gauge
+	// The sum of all apiserver_request_duration_seconds_sum counters, i.e. the total time spent serving requests
+	RequestDurationSeconds float64
+	RequestDurationCount   int64 // The sum of all apiserver_request_duration_seconds_count counters
+	// Whether RequestDurationSeconds and RequestDurationCount are valid, i.e. the response contained the
+	// apiserver_request_duration_seconds histogram
+	HasRequestDuration bool
+	// The process_start_time_seconds gauge of the kube-apiserver process, i.e. its start time, in seconds since the
+	// Unix epoch
+	ProcessStartTimeSeconds float64
+	HasProcessStartTime     bool // Whether ProcessStartTimeSeconds is valid, i.e. the response contained the gauge
+}
+
+// addRequestCounts adds the apiserver_request_total counters of other to the receiver. The other values are those of
+// a single process, e.g. the CPU and memory usage of an apiserver-proxy sidecar, which do not add up to the ones of the
+// kube-apiserver process, so the receiver's are kept.
+func (m *kapiMetrics) addRequestCounts(other kapiMetrics) {
+	m.TotalRequestCount += other.TotalRequestCount
+	m.ClientErrorCount += other.ClientErrorCount
+	m.ServerErrorCount += other.ServerErrorCount
+}
+
+// processStartTime returns ProcessStartTimeSeconds as a point in time. Returns the zero time if the start time is not
+// valid.
+func (m *kapiMetrics) processStartTime() time.Time {
+	if !m.HasProcessStartTime {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(m.ProcessStartTimeSeconds * 1000))
+}
+
+// requestHeadersContextKey is the context key under which extra scrape request headers are stored. See
+// withRequestHeaders.
+type requestHeadersContextKey struct{}
+
+// withRequestHeaders returns a copy of ctx, which instructs [metricsClientImpl.GetKapiInstanceMetrics] to add the
+// specified headers to the requests sent with that context. The headers do not replace the ones which the client sets
+// itself, such as Authorization.
+func withRequestHeaders(ctx context.Context, headers http.Header) context.Context {
+	return context.WithValue(ctx, requestHeadersContextKey{}, headers)
+}
+
 type metricsClient interface {
-	// GetKapiInstanceMetrics scrapes a Kapi metric endpoint and returns the sum of all apiserver_request_total counters.
+	// GetKapiInstanceMetrics scrapes a Kapi metric endpoint and returns the sum of all apiserver_request_total counters,
+	// and the sum of all apiserver_current_inflight_requests gauges.
 	//
 	// Parameters:
 	//   - url points to the metrics endpoint.
 	//   - authSecret specifies a bearer auth token to present to the metrics endpoint.
 	//   - caCertificates lists trusted CA certificates which are used to verify the endpoint's certificate.
+	//   - serverName is the server name which the endpoint's certificate is expected to carry. See
+	//     [transportPool.GetHttpClient].
+	//   - insecureSkipTLSVerify, if true, skips the verification of the endpoint's certificate.
+	//   - proxyURL optionally points to an HTTP CONNECT or SOCKS5 proxy through which the endpoint is reached. Nil means
+	//     that the endpoint is reached directly.
 	//
 	// Returns:
-	//   - an int64 value which is the sum of all apiserver_request_total counters from the scraped metric response.
+	//   - a kapiMetrics value with the sums calculated from the scraped metric response.
 	//   - an optional error
 	//
-	// Exactly one of the int64 value and the error is non-zero.
-	// An error is returned if the metrics data contains no apiserver_request_total counters.
+	// Exactly one of the kapiMetrics value and the error is non-zero.
+	// An error is returned if the metrics data contains no apiserver_request_total counters. The absence of
+	// apiserver_current_inflight_requests gauges is not an error, and is reported via
+	// [kapiMetrics.HasInflightRequestCount]. The same applies to the process CPU and memory metrics, and to the
+	// request duration histogram.
+	// Redirects are only followed to the same host. The url may use the http scheme, in which case the CA certificates
+	// are not used.
+	// An error is returned if the response, after decompression, exceeds the client's maximum response size.
+	// Errors are classified by category. See errorCategory.
+	// Extra request headers may be specified via the context. See withRequestHeaders.
 	//
 	// Remarks: For performance reasons, this function requires that if a line containing the metric of interest start with
 	// whitespaces, those whitespaces be only ASCII whitespaces.
 	GetKapiInstanceMetrics(
-		ctx context.Context, url string, authSecret string, caCertificates *x509.CertPool) (result int64, err error)
+		ctx context.Context,
+		url string,
+		authSecret string,
+		caCertificates *x509.CertPool,
+		serverName string,
+		insecureSkipTLSVerify bool,
+		proxyURL *neturl.URL) (result kapiMetrics, err error)
 }
 
 type metricsClientImpl struct {
+	// Responses larger than this, after decompression, are rejected
+	maxResponseSize int64
+	// Decides, per URL, whether to request compressed responses
+	compression *compressionAdvisor
+	// Tunes how responses are requested and read
+	responseSettings ResponseSettings
+	// If true, requests prefer the protobuf exposition format over the text one
+	acceptProtobuf bool
+
 	testIsolation metricsClientTestIsolation // Provides indirections necessary to isolate the unit during tests
 }
 
-func newMetricsClient() metricsClient {
+// newMetricsClient creates a metricsClient which reuses connections across scrapes. A connection which remains unused
+// for longer than connectionIdleTime, gets closed.
+//
+// dialContext, if not nil, replaces the default function used to establish network connections (or connections to
+// a proxy, if one is used).
+//
+// maxResponseSize is the maximum size of a metrics response, after decompression. Zero means
+// DefaultMaxResponseSize. tlsSettings tunes the TLS configuration used to reach the endpoints. responseSettings tunes
+// how responses are requested and read.
+//
+// acceptProtobuf specifies whether requests prefer the Prometheus protobuf exposition format, which is cheaper to
+// parse. Servers which do not support it respond in the text format, which is handled as usual.
+func newMetricsClient(
+	connectionIdleTime time.Duration,
+	dialContext dialContextFunc,
+	maxResponseSize int64,
+	tlsSettings TLSSettings,
+	responseSettings ResponseSettings,
+	acceptProtobuf bool) metricsClient {
+
+	if maxResponseSize == 0 {
+		maxResponseSize = DefaultMaxResponseSize
+	}
+	transports := newTransportPool(connectionIdleTime, dialContext, tlsSettings)
 	return &metricsClientImpl{
+		maxResponseSize:  maxResponseSize,
+		compression:      newCompressionAdvisor(connectionIdleTime),
+		responseSettings: responseSettings,
+		acceptProtobuf:   acceptProtobuf,
 		testIsolation: metricsClientTestIsolation{
-			NewHttpClient: newHttpClient,
+			NewHttpClient: func(
+				caCertificates *x509.CertPool,
+				serverName string,
+				insecureSkipTLSVerify bool,
+				proxyURL *neturl.URL,
+				podIP string) krest.HTTPClient {
+
+				return transports.GetHttpClient(caCertificates, serverName, insecureSkipTLSVerify, proxyURL, podIP)
+			},
 		},
 	}
 }
 
-// GetKapiInstanceMetrics scrapes a Kapi metric endpoint and returns the sum of all apiserver_request_total counters.
+// GetKapiInstanceMetrics scrapes a Kapi metric endpoint and returns the sum of all apiserver_request_total counters,
+// and the sum of all apiserver_current_inflight_requests gauges.
 //
 // Parameters:
 //   - url points to the metrics endpoint.
 //   - authSecret specifies a bearer auth token to present to the metrics endpoint.
 //   - caCertificates lists trusted CA certificates which are used to verify the endpoint's certificate.
+//   - serverName is the server name which the endpoint's certificate is expected to carry. See
+//     [transportPool.GetHttpClient].
+//   - insecureSkipTLSVerify, if true, skips the verification of the endpoint's certificate.
+//   - proxyURL optionally points to an HTTP CONNECT or SOCKS5 proxy through which the endpoint is reached. Nil means
+//     that the endpoint is reached directly.
 //
 // Returns:
-//   - an int64 value which is the sum of all apiserver_request_total counters from the scraped metric response.
+//   - a kapiMetrics value with the sums calculated from the scraped metric response.
 //   - an optional error
 //
-// Exactly one of the int64 value and the error is non-zero.
-// An error is returned if the metrics data contains no apiserver_request_total counters.
+// Exactly one of the kapiMetrics value and the error is non-zero.
+// An error is returned if the metrics data contains no apiserver_request_total counters. The absence of
+// apiserver_current_inflight_requests gauges is not an error, and is reported via
+// [kapiMetrics.HasInflightRequestCount]. The same applies to the process CPU, memory and start time metrics, and to
+// the request duration histogram.
+// Redirects are only followed to the same host. The url may use the http scheme, in which case the CA certificates
+// are not used.
+// An error is returned if the response, after decompression, exceeds the client's maximum response size.
+// Extra request headers may be specified via the context. See withRequestHeaders.
+//
+// A compressed response is only requested if compression proved beneficial for the same url (see compressionAdvisor),
+// and compression is not disabled in the client's ResponseSettings.
+// The size of each response is recorded in Prometheus metrics.
+// If the client accepts the protobuf exposition format (see newMetricsClient), the response is parsed according to
+// its content type.
 //
 // Remarks: For performance reasons, this function requires that if a line containing the metric of interest start with
 // whitespaces, those whitespaces be only ASCII whitespaces.
 func (mc *metricsClientImpl) GetKapiInstanceMetrics(
-	ctx context.Context, url string, authSecret string, caCertificates *x509.CertPool) (result int64, err error) {
-
-	// Prepare request
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	ctx context.Context,
+	url string,
+	authSecret string,
+	caCertificates *x509.CertPool,
+	serverName string,
+	insecureSkipTLSVerify bool,
+	proxyURL *neturl.URL) (result kapiMetrics, err error) {
+
+	requestCtx, requestSpan := tracing.Tracer().Start(ctx, "http request")
+	requestGzip := !mc.responseSettings.DisableGzip && mc.compression.ShouldRequestGzip(url)
+	response, err := mc.sendRequest(
+		requestCtx, url, authSecret, caCertificates, serverName, insecureSkipTLSVerify, proxyURL, requestGzip)
+	tracing.EndSpan(requestSpan, err)
 	if err != nil {
-		return 0, fmt.Errorf("metrics client: creating http request object: %w", err)
-	}
-	request.Header.Set("Authorization", "Bearer "+authSecret)
-	request.Header.Set("Accept-Encoding", "gzip")
-	client := mc.testIsolation.NewHttpClient(caCertificates)
-
-	// Send request
-	response, err := client.Do(request)
-	if err != nil {
-		return 0, fmt.Errorf("metrics client: making http request: %w", err)
+		return kapiMetrics{}, err
 	}
 	defer func(responseBodyStream io.ReadCloser) {
 		e := responseBodyStream.Close()
@@ -96,41 +251,133 @@ func (mc *metricsClientImpl) GetKapiInstanceMetrics(
 		}
 	}(response.Body)
 
-	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		return 0, fmt.Errorf("metrics client: response reported HTTP status %d", response.StatusCode)
-	}
+	_, parseSpan := tracing.Tracer().Start(ctx, "parse")
+	defer func() { tracing.EndSpan(parseSpan, err) }()
 
+	wireReader := &countingReader{reader: response.Body}
+	var payloadReader io.Reader = wireReader
 	// If the server returned compressed response, use decompressing reader
-	if response.Header.Get("Content-Encoding") == "gzip" {
-		reader, err := gzip.NewReader(response.Body)
+	isGzip := response.Header.Get("Content-Encoding") == "gzip"
+	if isGzip {
+		reader, err := gzip.NewReader(wireReader)
 		if err != nil {
-			return 0, fmt.Errorf("metrics client: scraping '%s': reading gzip encoded response stream: %w", url, err)
+			return kapiMetrics{}, withCategory(classifyResponseError(err),
+				fmt.Errorf("metrics client: scraping '%s': reading gzip encoded response stream: %w", url, err))
 		}
 		defer reader.Close()
+		payloadReader = reader
+	}
+
+	// The limit applies after decompression, so a small, highly compressed response can't exhaust memory either
+	limitedReader := &maxSizeReader{reader: payloadReader, maxSize: mc.maxResponseSize}
+	// The parsers use a buffered reader as is, if its buffer is at least as large as the default one, which the read
+	// buffer size is
+	bufferedReader := bufio.NewReaderSize(limitedReader, mc.responseSettings.readBufferSize())
+	// Labelled separately, so CPU profiles tell the cost of parsing apart from that of the TLS and network I/O, which
+	// are interleaved with it
+	parse := getKapiMetrics
+	if isProtobufResponse(response.Header.Get("Content-Type")) {
+		parse = getKapiMetricsProtobuf
+	}
+	pprof.Do(ctx, pprof.Labels("phase", "parse"), func(context.Context) {
+		result, err = parse(bufferedReader)
+	})
+	if errors.Is(err, errResponseTooLarge) {
+		scrapeResponseTooLargeCount.Inc()
+		return kapiMetrics{}, withCategory(
+			input_data_registry.ScrapeErrorParse, fmt.Errorf("metrics client: scraping '%s': %w", url, err))
+	}
+	if err != nil {
+		return kapiMetrics{}, withCategory(classifyResponseError(err), err)
+	}
+
+	encoding := "identity"
+	if isGzip {
+		encoding = "gzip"
+	}
+	scrapeResponseBytes.WithLabelValues(encoding).Observe(float64(wireReader.count))
+	scrapePayloadBytes.Observe(float64(limitedReader.count))
+	mc.compression.RecordResponse(url, isGzip, wireReader.count, limitedReader.count)
+
+	return result, nil
+}
+
+// sendRequest sends the metrics request and returns the response. If the response status does not indicate success,
+// the response is closed, and an error is returned instead. The requestGzip parameter specifies whether a compressed
+// response is requested. The rest of the parameters have the same meaning as in
+// [metricsClientImpl.GetKapiInstanceMetrics].
+func (mc *metricsClientImpl) sendRequest(
+	ctx context.Context,
+	url string,
+	authSecret string,
+	caCertificates *x509.CertPool,
+	serverName string,
+	insecureSkipTLSVerify bool,
+	proxyURL *neturl.URL,
+	requestGzip bool) (*http.Response, error) {
+
+	// Prepare request
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, withCategory(
+			input_data_registry.ScrapeErrorOther, fmt.Errorf("metrics client: creating http request object: %w", err))
+	}
+	if headers, ok := ctx.Value(requestHeadersContextKey{}).(http.Header); ok {
+		// Added first, so the headers set below take precedence
+		for name, values := range headers {
+			request.Header[name] = slices.Clone(values)
+		}
+	}
+	request.Header.Set("Authorization", "Bearer "+authSecret)
+	if mc.acceptProtobuf {
+		request.Header.Set("Accept", protobufAcceptHeader)
+	}
+	// An explicit identity encoding also keeps the HTTP transport from requesting compression on its own
+	if requestGzip {
+		request.Header.Set("Accept-Encoding", "gzip")
+	} else {
+		request.Header.Set("Accept-Encoding", "identity")
+	}
+	// The metrics URL addresses the pod by IP, which is what the server certificate may be pinned to
+	client := mc.testIsolation.NewHttpClient(
+		caCertificates, serverName, insecureSkipTLSVerify, proxyURL, request.URL.Hostname())
+
+	// Send request
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, withCategory(classifyRequestError(err), fmt.Errorf("metrics client: making http request: %w", err))
+	}
 
-		return getTotalRequestCount(reader)
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		_ = response.Body.Close()
+		return nil, withCategory(classifyHTTPStatus(response.StatusCode),
+			fmt.Errorf("metrics client: response reported HTTP status %d", response.StatusCode))
 	}
 
-	return getTotalRequestCount(response.Body)
+	return response, nil
 }
 
-// getTotalRequestCount processes a metrics response stream and returns the sum of all apiserver_request_total counters.
+// getKapiMetrics processes a metrics response stream and returns the sum of all apiserver_request_total counters, the
+// sums of the ones which count failed requests, by class of status code, the sum of all
+// apiserver_current_inflight_requests gauges, the process CPU and memory usage, and the sums of the
+// apiserver_request_duration_seconds histogram, if present. The process start time is returned too, if present.
 //
 // Returns:
-//   - an int64 value which is the sum of all apiserver_request_total counters from the scraped metric response.
+//   - a kapiMetrics value with the sums calculated from the scraped metric response.
 //   - an optional error
 //
-// Exactly one of the int64 value and the error is non-zero.
-func getTotalRequestCount(metricsStream io.Reader) (int64, error) {
-	// Limit the metrics response as a general precaution. It should be < 5MiB, so if we're getting >20MiB something's wrong.
-	metricsStream = &io.LimitedReader{R: metricsStream, N: 20 * 1024 * 1024}
+// Exactly one of the kapiMetrics value and the error is non-zero.
+//
+// Remarks: Large seeds scrape thousands of Kapis per minute, so this is a hot path. Lines are processed in place, in
+// the reader's buffer, and the parsing of a successful response does not allocate beyond the buffer itself.
+func getKapiMetrics(metricsStream io.Reader) (kapiMetrics, error) {
 	reader := bufio.NewReader(metricsStream)
 
-	totalRequestCount := int64(0)
+	result := kapiMetrics{}
 	isCounterFound := false
 	isLastReadPartial := false
-	lineBytes, isPrefix, err := reader.ReadLine()
-	for ; err == nil; lineBytes, isPrefix, err = reader.ReadLine() {
+	line, isPrefix, err := reader.ReadLine()
+	for ; err == nil; line, isPrefix, err = reader.ReadLine() {
 		if isPrefix {
 			// Long lines are not expected, and not of interest to us. Just skip them.
 			isLastReadPartial = true
@@ -143,49 +390,191 @@ func getTotalRequestCount(metricsStream io.Reader) (int64, error) {
 			continue
 		}
 
-		line := string(lineBytes)
 		if len(line) > 0 && isSpace(line, 0) {
 			i := skipSpace(line, 1)
 			line = line[i:]
 		}
-		if !strings.HasPrefix(line, metricName) {
+		var lineMetricName string
+		switch {
+		case hasPrefix(line, metricName):
+			lineMetricName = metricName
+		case hasPrefix(line, inflightMetricName):
+			lineMetricName = inflightMetricName
+		case hasPrefix(line, cpuMetricName):
+			// CPU time is fractional, so it does not fit the integer parsing below
+			_, cpuSeconds, err := parseFloatLine(line, cpuMetricName)
+			if err != nil {
+				return kapiMetrics{}, fmt.Errorf("parsing metrics line '%s': %w", line, err)
+			}
+			result.CPUSeconds = cpuSeconds
+			result.HasCPUSeconds = true
+			continue
+		case hasPrefix(line, memoryMetricName):
+			lineMetricName = memoryMetricName
+		case hasPrefix(line, startTimeMetricName):
+			// The start time is fractional, and often comes in scientific notation, e.g. 1.71234567891e+09
+			_, startTimeSeconds, err := parseFloatLine(line, startTimeMetricName)
+			if err != nil {
+				return kapiMetrics{}, fmt.Errorf("parsing metrics line '%s': %w", line, err)
+			}
+			result.ProcessStartTimeSeconds = startTimeSeconds
+			result.HasProcessStartTime = true
+			continue
+		case hasPrefix(line, durationSumMetricName):
+			// Like CPU time, the total request duration is fractional
+			_, durationSeconds, err := parseFloatLine(line, durationSumMetricName)
+			if err != nil {
+				return kapiMetrics{}, fmt.Errorf("parsing metrics line '%s': %w", line, err)
+			}
+			result.RequestDurationSeconds += durationSeconds
+			result.HasRequestDuration = true
+			continue
+		case hasPrefix(line, durationCountMetricName):
+			lineMetricName = durationCountMetricName
+		default:
 			// One of the other metrics. Not of interest to us.
 			continue
 		}
 
-		_, seriesCurrentValue, err := parseLine(line)
+		seriesId, seriesCurrentValue, err := parseLine(line, lineMetricName)
 		if err != nil {
-			return 0, fmt.Errorf("parsing metrics line '%s': %w", line, err)
+			return kapiMetrics{}, fmt.Errorf("parsing metrics line '%s': %w", line, err)
 		}
 
-		totalRequestCount += seriesCurrentValue
-		isCounterFound = true
+		switch lineMetricName {
+		case metricName:
+			result.TotalRequestCount += seriesCurrentValue
+			switch statusCodeClass(seriesId) {
+			case '4':
+				result.ClientErrorCount += seriesCurrentValue
+			case '5':
+				result.ServerErrorCount += seriesCurrentValue
+			}
+			isCounterFound = true
+		case inflightMetricName:
+			result.InflightRequestCount += seriesCurrentValue
+			result.HasInflightRequestCount = true
+		case durationCountMetricName:
+			result.RequestDurationCount += seriesCurrentValue
+			result.HasRequestDuration = true
+		default:
+			result.ResidentMemoryBytes = seriesCurrentValue
+			result.HasResidentMemoryBytes = true
+		}
 	}
 
 	if err != io.EOF {
-		return 0, err
+		return kapiMetrics{}, err
 	}
 
 	if !isCounterFound {
-		return 0, fmt.Errorf(
-			"calculating total request count from metrics response: the response contains no '%s' counters", metricName)
+		return kapiMetrics{}, fmt.Errorf("calculating total request count from metrics response: %w", errNoRequestCounters)
+	}
+
+	return result, nil
+}
+
+// Assumes that the line starts with the specified lineMetricName, no leading whitespace.
+// Returns (seriesId, seriesValue, error). Exactly one of seriesValue/error is nil. The returned seriesId is a
+// sub-slice of line.
+func parseLine(line []byte, lineMetricName string) ([]byte, int64, error) {
+	seriesId, valueBytes, err := splitLine(line, lineMetricName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	seriesValue, ok := parseDecimalInt(valueBytes)
+	if !ok {
+		// Some integer values come in scientific notation, e.g. 1.234567e+06. Those are rare enough to not warrant
+		// a specialised parser.
+		floatValue, err := strconv.ParseFloat(string(valueBytes), 64)
+		if err != nil || bytes.IndexByte(valueBytes, 'e') < 0 {
+			return nil, 0, newMalformedLineError(line)
+		}
+		seriesValue = int64(floatValue) // The significand of double is 53 bits - should represent request count accurately
+	}
+
+	return seriesId, seriesValue, nil
+}
+
+// parseDecimalInt parses a base 10 integer with an optional sign, without allocating. Returns false if the value is not
+// in that form, or does not fit in an int64.
+func parseDecimalInt(value []byte) (int64, bool) {
+	isNegative := false
+	if len(value) > 0 && (value[0] == '-' || value[0] == '+') {
+		isNegative = value[0] == '-'
+		value = value[1:]
+	}
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	var result uint64
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		if result > (math.MaxUint64-9)/10 {
+			return 0, false
+		}
+		result = result*10 + uint64(c-'0')
+	}
+
+	if isNegative {
+		if result > -math.MinInt64 {
+			return 0, false
+		}
+		return -int64(result), true
 	}
+	if result > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(result), true
+}
 
-	return totalRequestCount, nil
+// statusCodeClass returns the first digit of the value of the "code" label in the specified series ID, e.g. '4' for
+// code="404",verb="GET". Returns 0 if the series has no such label.
+func statusCodeClass(seriesId []byte) byte {
+	const codeLabelPrefix = `code="`
+	for remaining := seriesId; len(remaining) > 0; {
+		var label []byte
+		label, remaining, _ = bytes.Cut(remaining, []byte{','})
+		label = bytes.TrimSpace(label)
+		if hasPrefix(label, codeLabelPrefix) && len(label) > len(codeLabelPrefix) {
+			return label[len(codeLabelPrefix)]
+		}
+	}
+	return 0
 }
 
-// Assumes that the line starts with metricName, no leading whitespace.
+// parseFloatLine is the counterpart of parseLine, for metrics with fractional values.
 // Returns (seriesId, seriesValue, error). Exactly one of seriesValue/error is nil.
-func parseLine(line string) (string, int64, error) {
+func parseFloatLine(line []byte, lineMetricName string) ([]byte, float64, error) {
+	seriesId, valueBytes, err := splitLine(line, lineMetricName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	seriesValue, err := strconv.ParseFloat(string(valueBytes), 64)
+	if err != nil {
+		return nil, 0, newMalformedLineError(line)
+	}
+
+	return seriesId, seriesValue, nil
+}
+
+// Assumes that the line starts with the specified lineMetricName, no leading whitespace.
+// Returns (seriesId, valueBytes, error), where valueBytes is the unparsed value section of the line. Both are
+// sub-slices of line.
+func splitLine(line []byte, lineMetricName string) ([]byte, []byte, error) {
 	// Sample line: apiserver_request_total{code="200",component="apiserver",dry_run="",group="",resource="configmaps",scope="namespace",subresource="",verb="LIST",version="v1"} 15
 
-	malformedLineError := fmt.Errorf("parsing metrics line: malformed line '%s'", line)
-	seriesId := ""
+	var seriesId []byte
 
 	// Process series name section, e.g: {code="200",component="apiserver",dry_run="",group="",resource="configmaps",scope="namespace",subresource="",verb="LIST",version="v1"}
-	i := len(metricName)
+	i := len(lineMetricName)
 	if i >= len(line) {
-		return "", 0, malformedLineError
+		return nil, nil, newMalformedLineError(line)
 	}
 
 	// Process optional labels section
@@ -196,7 +585,7 @@ func parseLine(line string) (string, int64, error) {
 		for i++; i < len(line) && line[i] != '}'; i++ {
 		}
 		if i == len(line) {
-			return "", 0, malformedLineError
+			return nil, nil, newMalformedLineError(line)
 		}
 
 		seriesId = line[seriesIdStart:i]
@@ -206,34 +595,32 @@ func parseLine(line string) (string, int64, error) {
 	// Process value section
 	i = skipSpace(line, i)
 	if i >= len(line) {
-		return "", 0, malformedLineError
+		return nil, nil, newMalformedLineError(line)
 	}
 	valueEnd := i + 1
 	for ; valueEnd < len(line) && !isSpace(line, valueEnd); valueEnd++ {
 	}
-	valueString := line[i:valueEnd]
-	var seriesValue int64
-	var err error
-	if strings.Contains(valueString, "e") { // Some integer values come in scientific notation, e.g. 1.234567e+06
-		var floatValue float64
-		floatValue, err = strconv.ParseFloat(valueString, 64)
-		seriesValue = int64(floatValue) // The significand of double is 53 bits - should represent request count accurately
-	} else {
-		seriesValue, err = strconv.ParseInt(valueString, 10, 64)
-	}
-	if err != nil {
-		return "", 0, malformedLineError
-	}
 
-	return seriesId, seriesValue, nil
+	return seriesId, line[i:valueEnd], nil
+}
+
+// newMalformedLineError returns the error reported for a line which cannot be parsed. The error is only built once a
+// line proves malformed, because formatting it allocates.
+func newMalformedLineError(line []byte) error {
+	return fmt.Errorf("parsing metrics line: malformed line '%s'", line)
 }
 
-func isSpace(str string, i int) bool {
+// hasPrefix is the allocation-free counterpart of [strings.HasPrefix], for a byte slice and a string prefix
+func hasPrefix(line []byte, prefix string) bool {
+	return len(line) >= len(prefix) && string(line[:len(prefix)]) == prefix
+}
+
+func isSpace(str []byte, i int) bool {
 	return str[i] == ' ' || str[i] == '\t'
 }
 
 // Starts at i and returns the index of the first non whitespace character, or one-past-end
-func skipSpace(str string, i int) int {
+func skipSpace(str []byte, i int) int {
 	for ; i < len(str) && isSpace(str, i); i++ {
 	}
 	return i
@@ -244,20 +631,15 @@ func skipSpace(str string, i int) int {
 // metricsClientTestIsolation contains all points of indirection necessary to isolate static function calls
 // in the metrics client unit
 type metricsClientTestIsolation struct {
-	// Creates a new HTTP client with default settings
-	NewHttpClient func(caCertificates *x509.CertPool) krest.HTTPClient
-}
-
-func newHttpClient(caCertificates *x509.CertPool) krest.HTTPClient {
-	return &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				RootCAs:    caCertificates,
-				ServerName: "kube-apiserver",
-				MinVersion: tls.VersionTLS13,
-			},
-		},
-	}
+	// Returns an HTTP client which trusts the specified CA certificates (or skips server certificate verification),
+	// expects the specified server name, and uses the specified proxy.
+	// Points to [transportPool.GetHttpClient].
+	NewHttpClient func(
+		caCertificates *x509.CertPool,
+		serverName string,
+		insecureSkipTLSVerify bool,
+		proxyURL *neturl.URL,
+		podIP string) krest.HTTPClient
 }
 
 //#endregion Test isolation
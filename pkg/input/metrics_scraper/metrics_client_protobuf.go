@@ -0,0 +1,345 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// The Accept header of scrapes which prefer the protobuf exposition format. The text format remains acceptable, so
+	// servers which do not support protobuf still respond, and the response is parsed according to its content type.
+	protobufAcceptHeader = protobufMediaType + ";proto=" + protobufMessageName + ";encoding=delimited;q=0.7," +
+		"text/plain;version=0.0.4;q=0.3,*/*;q=0.1"
+
+	protobufMediaType   = "application/vnd.google.protobuf"
+	protobufMessageName = "io.prometheus.client.MetricFamily"
+
+	// In the protobuf format, the histogram is a single family, instead of separate _sum and _count series
+	durationMetricName = "apiserver_request_duration_seconds"
+
+	// The numbers of the fields of interest in the messages of the io.prometheus.client package. See
+	// github.com/prometheus/client_model/io/prometheus/client/metrics.proto.
+	metricFamilyNameField          protowire.Number = 1 // MetricFamily.name
+	metricFamilyMetricField        protowire.Number = 4 // MetricFamily.metric
+	metricLabelField               protowire.Number = 1 // Metric.label
+	metricGaugeField               protowire.Number = 2 // Metric.gauge
+	metricCounterField             protowire.Number = 3 // Metric.counter
+	metricUntypedField             protowire.Number = 5 // Metric.untyped
+	metricHistogramField           protowire.Number = 7 // Metric.histogram
+	labelPairNameField             protowire.Number = 1 // LabelPair.name
+	labelPairValueField            protowire.Number = 2 // LabelPair.value
+	simpleValueField               protowire.Number = 1 // Gauge.value, Counter.value, Untyped.value
+	histogramSampleCountField      protowire.Number = 1 // Histogram.sample_count
+	histogramSampleSumField        protowire.Number = 2 // Histogram.sample_sum
+	histogramSampleCountFloatField protowire.Number = 4 // Histogram.sample_count_float
+)
+
+// isProtobufResponse returns true if the specified Content-Type header value denotes the delimited protobuf exposition
+// format, i.e. a sequence of length-prefixed MetricFamily messages
+func isProtobufResponse(contentType string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	return err == nil &&
+		mediaType == protobufMediaType &&
+		params["proto"] == protobufMessageName &&
+		params["encoding"] == "delimited"
+}
+
+// getKapiMetricsProtobuf is the counterpart of getKapiMetrics, for responses in the delimited protobuf exposition
+// format. Only the families of interest are decoded. The rest are skipped, based on their name, which saves most of the
+// decoding effort, since a Kapi exposes a few hundred families, and only a handful are of interest. The families of
+// interest are decoded in place, without building the full message structure, so the parsing of a successful response
+// does not allocate beyond the reused buffers.
+//
+// Returns:
+//   - a kapiMetrics value with the sums calculated from the scraped metric response.
+//   - an optional error
+//
+// Exactly one of the kapiMetrics value and the error is non-zero.
+func getKapiMetricsProtobuf(metricsStream io.Reader) (kapiMetrics, error) {
+	reader := bufio.NewReader(metricsStream)
+
+	result := kapiMetrics{}
+	isCounterFound := false
+	// Reused across messages
+	var message bytes.Buffer
+	limitedReader := &io.LimitedReader{R: reader}
+	for {
+		length, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return kapiMetrics{}, fmt.Errorf("parsing protobuf metrics response: reading message length: %w", err)
+		}
+
+		// The name is the first field of the message, as encoded by the Prometheus client libraries, so the families not
+		// of interest can usually be skipped without buffering them. Peek returns less than asked, if the stream ends
+		// early.
+		head, _ := reader.Peek(int(min(length, uint64(reader.Size()))))
+		name, isDecided, err := getFamilyOfInterest(head, len(head) == int(length))
+		if err != nil {
+			return kapiMetrics{}, fmt.Errorf("parsing protobuf metrics response: %w", err)
+		}
+		if isDecided && name == "" {
+			// One of the other metrics. Not of interest to us.
+			if _, err := reader.Discard(int(length)); err != nil {
+				return kapiMetrics{}, fmt.Errorf("parsing protobuf metrics response: skipping message: %w", err)
+			}
+			continue
+		}
+
+		// The buffer grows as data arrives, so a bogus length can't exhaust memory before the response size limit
+		// kicks in
+		message.Reset()
+		limitedReader.N = int64(length)
+		n, err := message.ReadFrom(limitedReader)
+		if err != nil {
+			return kapiMetrics{}, fmt.Errorf("parsing protobuf metrics response: reading message: %w", err)
+		}
+		if n != int64(length) {
+			return kapiMetrics{}, fmt.Errorf(
+				"parsing protobuf metrics response: reading message: %w", io.ErrUnexpectedEOF)
+		}
+		if !isDecided {
+			if name, _, err = getFamilyOfInterest(message.Bytes(), true); err != nil {
+				return kapiMetrics{}, fmt.Errorf("parsing protobuf metrics response: %w", err)
+			}
+			if name == "" {
+				continue
+			}
+		}
+
+		err = forEachField(message.Bytes(), func(field protobufField) error {
+			if field.number != metricFamilyMetricField || field.wireType != protowire.BytesType {
+				return nil
+			}
+			metric, err := decodeMetric(field.bytes)
+			if err != nil {
+				return err
+			}
+
+			switch name {
+			case metricName:
+				value := int64(metric.value)
+				result.TotalRequestCount += value
+				switch metric.statusCodeClass {
+				case '4':
+					result.ClientErrorCount += value
+				case '5':
+					result.ServerErrorCount += value
+				}
+				isCounterFound = true
+			case inflightMetricName:
+				result.InflightRequestCount += int64(metric.value)
+				result.HasInflightRequestCount = true
+			case cpuMetricName:
+				result.CPUSeconds = metric.value
+				result.HasCPUSeconds = true
+			case memoryMetricName:
+				result.ResidentMemoryBytes = int64(metric.value)
+				result.HasResidentMemoryBytes = true
+			case startTimeMetricName:
+				result.ProcessStartTimeSeconds = metric.value
+				result.HasProcessStartTime = true
+			case durationMetricName:
+				if metric.hasHistogram {
+					result.RequestDurationSeconds += metric.histogramSum
+					result.RequestDurationCount += int64(metric.histogramCount)
+					result.HasRequestDuration = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return kapiMetrics{}, fmt.Errorf("parsing protobuf metrics response: family '%s': %w", name, err)
+		}
+	}
+
+	if !isCounterFound {
+		return kapiMetrics{}, fmt.Errorf("calculating total request count from metrics response: %w", errNoRequestCounters)
+	}
+
+	return result, nil
+}
+
+// protobufField is a single field of a protobuf message, as encoded on the wire
+type protobufField struct {
+	number   protowire.Number
+	wireType protowire.Type
+	bytes    []byte // The value of a field of protowire.BytesType. A sub-slice of the message.
+	scalar   uint64 // The value of a field of the varint or fixed types. Doubles need math.Float64frombits.
+}
+
+// forEachField calls fn for each field of the specified protobuf message, in order, and stops at the first error.
+// Groups are skipped.
+func forEachField(message []byte, fn func(field protobufField) error) error {
+	for len(message) > 0 {
+		number, wireType, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		field := protobufField{number: number, wireType: wireType}
+		switch wireType {
+		case protowire.BytesType:
+			field.bytes, n = protowire.ConsumeBytes(message)
+		case protowire.VarintType:
+			field.scalar, n = protowire.ConsumeVarint(message)
+		case protowire.Fixed64Type:
+			field.scalar, n = protowire.ConsumeFixed64(message)
+		case protowire.Fixed32Type:
+			var value uint32
+			value, n = protowire.ConsumeFixed32(message)
+			field.scalar = uint64(value)
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, message)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		if wireType == protowire.StartGroupType {
+			continue
+		}
+		if err := fn(field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// protobufMetric holds the values of interest of a single Metric message
+type protobufMetric struct {
+	// The value of a counter, gauge, or untyped metric. Zero for other types of metrics.
+	value float64
+	// The first digit of the "code" label, e.g. '4' for code="404". Zero if the metric has no such label.
+	statusCodeClass byte
+	// The sum and count of a histogram metric. Only valid if hasHistogram is true.
+	histogramSum   float64
+	histogramCount uint64
+	hasHistogram   bool
+}
+
+// decodeMetric decodes the values of interest of the specified Metric message. The type of the metric is inferred from
+// the value present, so the metric's family does not need to be consulted.
+func decodeMetric(message []byte) (protobufMetric, error) {
+	var result protobufMetric
+	err := forEachField(message, func(field protobufField) error {
+		if field.wireType != protowire.BytesType {
+			return nil
+		}
+
+		switch field.number {
+		case metricLabelField:
+			var labelName, labelValue []byte
+			err := forEachField(field.bytes, func(labelField protobufField) error {
+				switch {
+				case labelField.wireType != protowire.BytesType:
+				case labelField.number == labelPairNameField:
+					labelName = labelField.bytes
+				case labelField.number == labelPairValueField:
+					labelValue = labelField.bytes
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if string(labelName) == "code" && len(labelValue) > 0 {
+				result.statusCodeClass = labelValue[0]
+			}
+		case metricGaugeField, metricCounterField, metricUntypedField:
+			// Gauge, Counter, and Untyped all carry their value in the same double field
+			return forEachField(field.bytes, func(valueField protobufField) error {
+				if valueField.number == simpleValueField && valueField.wireType == protowire.Fixed64Type {
+					result.value = math.Float64frombits(valueField.scalar)
+				}
+				return nil
+			})
+		case metricHistogramField:
+			result.hasHistogram = true
+			return forEachField(field.bytes, func(histogramField protobufField) error {
+				switch {
+				case histogramField.number == histogramSampleCountField &&
+					histogramField.wireType == protowire.VarintType:
+					result.histogramCount = histogramField.scalar
+				case histogramField.number == histogramSampleCountFloatField &&
+					histogramField.wireType == protowire.Fixed64Type:
+					// Native histograms may carry a float count instead
+					result.histogramCount = uint64(math.Float64frombits(histogramField.scalar))
+				case histogramField.number == histogramSampleSumField &&
+					histogramField.wireType == protowire.Fixed64Type:
+					result.histogramSum = math.Float64frombits(histogramField.scalar)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// getFamilyOfInterest returns the name of the MetricFamily message in the specified buffer, if it is one of the
+// families of interest, or an empty string otherwise. If isComplete is false, the buffer holds only the start of the
+// message, and the result is decided only if the name is found within it. The result is always decided for a complete
+// message.
+func getFamilyOfInterest(message []byte, isComplete bool) (name string, isDecided bool, err error) {
+	nameBytes, err := getMetricFamilyName(message)
+	if !isComplete && (err != nil || nameBytes == nil) {
+		// The name may come further on
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	switch string(nameBytes) { // The conversion does not allocate
+	case metricName, inflightMetricName, cpuMetricName, memoryMetricName, startTimeMetricName, durationMetricName:
+		return string(nameBytes), true, nil
+	default:
+		return "", true, nil
+	}
+}
+
+// getMetricFamilyName returns the name of the MetricFamily message in the specified buffer, without decoding the rest
+// of the message. The result is a sub-slice of the buffer. Returns nil if the message carries no name.
+func getMetricFamilyName(message []byte) ([]byte, error) {
+	for len(message) > 0 {
+		number, fieldType, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return nil, fmt.Errorf("reading metric family name: %w", protowire.ParseError(n))
+		}
+		message = message[n:]
+
+		if number == metricFamilyNameField && fieldType == protowire.BytesType {
+			name, n := protowire.ConsumeBytes(message)
+			if n < 0 {
+				return nil, fmt.Errorf("reading metric family name: %w", protowire.ParseError(n))
+			}
+			return name, nil
+		}
+
+		n = protowire.ConsumeFieldValue(number, fieldType, message)
+		if n < 0 {
+			return nil, fmt.Errorf("reading metric family name: %w", protowire.ParseError(n))
+		}
+		message = message[n:]
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,278 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/client-go/rest"
+)
+
+const protobufContentType = "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; " +
+	"encoding=delimited"
+
+// newProtobufResponse returns a metrics response in the delimited protobuf exposition format, with the specified
+// families
+func newProtobufResponse(families ...*dto.MetricFamily) []byte {
+	var buffer bytes.Buffer
+	for _, family := range families {
+		if _, err := protodelim.MarshalTo(&buffer, family); err != nil {
+			panic(err)
+		}
+	}
+	return buffer.Bytes()
+}
+
+// newMetricFamily returns a family of the specified type, with one metric per specified value. The metrics' "code"
+// label takes the corresponding value from codes, if specified.
+func newMetricFamily(name string, metricType dto.MetricType, values []float64, codes ...string) *dto.MetricFamily {
+	family := &dto.MetricFamily{Name: proto.String(name), Type: metricType.Enum()}
+	for i, value := range values {
+		metric := &dto.Metric{}
+		if i < len(codes) {
+			metric.Label = []*dto.LabelPair{{Name: proto.String("code"), Value: proto.String(codes[i])}}
+		}
+		switch metricType {
+		case dto.MetricType_COUNTER:
+			metric.Counter = &dto.Counter{Value: proto.Float64(value)}
+		case dto.MetricType_GAUGE:
+			metric.Gauge = &dto.Gauge{Value: proto.Float64(value)}
+		default:
+			metric.Untyped = &dto.Untyped{Value: proto.Float64(value)}
+		}
+		family.Metric = append(family.Metric, metric)
+	}
+	return family
+}
+
+var _ = Describe("input.metrics_scraper.metricsClientImpl protobuf exposition format", func() {
+	const metricsUrl = "https://my/metrics"
+
+	var (
+		newTestMetricsClient = func(
+			acceptProtobuf bool, responseBody []byte, contentType string) (*metricsClientImpl, *fakeHttpClient) {
+
+			metricsClient :=
+				newMetricsClient(time.Minute, nil, 0, TLSSettings{}, ResponseSettings{}, acceptProtobuf).(*metricsClientImpl)
+			httpClient := newFakeHttpClient(responseBody)
+			httpClient.Response.Header = http.Header{"Content-Type": {contentType}}
+			metricsClient.testIsolation.NewHttpClient = func(
+				_ *x509.CertPool, _ string, _ bool, _ *url.URL, _ string) rest.HTTPClient {
+
+				return httpClient
+			}
+			return metricsClient, httpClient
+		}
+		newDurationFamily = func(sums []float64, counts []uint64) *dto.MetricFamily {
+			family := &dto.MetricFamily{Name: proto.String(durationMetricName), Type: dto.MetricType_HISTOGRAM.Enum()}
+			for i := range sums {
+				family.Metric = append(family.Metric, &dto.Metric{
+					Histogram: &dto.Histogram{SampleSum: proto.Float64(sums[i]), SampleCount: proto.Uint64(counts[i])},
+				})
+			}
+			return family
+		}
+	)
+
+	It("should request the protobuf format, if enabled", func() {
+		// Arrange
+		response := newProtobufResponse(newMetricFamily(metricName, dto.MetricType_COUNTER, []float64{1}))
+		mc, httpClient := newTestMetricsClient(true, response, protobufContentType)
+
+		// Act
+		_, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, "", nil, "", false, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(httpClient.Request.Header.Get("Accept")).To(HavePrefix(protobufMediaType))
+		Expect(httpClient.Request.Header.Get("Accept")).To(ContainSubstring("text/plain"))
+	})
+
+	It("should not request the protobuf format, if not enabled", func() {
+		// Arrange
+		mc, httpClient := newTestMetricsClient(false, []byte("apiserver_request_total 1\n"), "text/plain")
+
+		// Act
+		_, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, "", nil, "", false, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(httpClient.Request.Header.Get("Accept")).To(BeEmpty())
+	})
+
+	It("should extract the metrics of interest from a protobuf response, skipping the other families", func() {
+		// Arrange
+		response := newProtobufResponse(
+			newMetricFamily("some_metric", dto.MetricType_COUNTER, []float64{1000}),
+			newMetricFamily(metricName, dto.MetricType_COUNTER, []float64{100, 20, 3}, "200", "404", "503"),
+			newMetricFamily(inflightMetricName, dto.MetricType_GAUGE, []float64{4, 5}),
+			newMetricFamily(cpuMetricName, dto.MetricType_COUNTER, []float64{12.5}),
+			newMetricFamily(memoryMetricName, dto.MetricType_GAUGE, []float64{1.5e9}),
+			newMetricFamily(startTimeMetricName, dto.MetricType_GAUGE, []float64{1.71234567891e+09}),
+			newDurationFamily([]float64{1.5, 2.5}, []uint64{10, 20}),
+			newMetricFamily("another_metric", dto.MetricType_UNTYPED, []float64{2000}))
+		mc, _ := newTestMetricsClient(true, response, protobufContentType)
+
+		// Act
+		result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, "", nil, "", false, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(result).To(Equal(kapiMetrics{
+			TotalRequestCount:       123,
+			ClientErrorCount:        20,
+			ServerErrorCount:        3,
+			InflightRequestCount:    9,
+			HasInflightRequestCount: true,
+			CPUSeconds:              12.5,
+			HasCPUSeconds:           true,
+			ResidentMemoryBytes:     1.5e9,
+			HasResidentMemoryBytes:  true,
+			RequestDurationSeconds:  4,
+			RequestDurationCount:    30,
+			HasRequestDuration:      true,
+			ProcessStartTimeSeconds: 1.71234567891e+09,
+			HasProcessStartTime:     true,
+		}))
+	})
+
+	It("should find the name of a family, even if it comes after the metrics, in a message which is not buffered "+
+		"at once", func() {
+
+		// Arrange
+		family := newMetricFamily(metricName, dto.MetricType_COUNTER, make([]float64, 5000))
+		family.Metric[0].Counter.Value = proto.Float64(7)
+		family.Name = nil
+		message, err := proto.Marshal(family)
+		Expect(err).To(Succeed())
+		message = protowire.AppendTag(message, metricFamilyNameField, protowire.BytesType)
+		message = protowire.AppendString(message, metricName)
+		response := protowire.AppendVarint(nil, uint64(len(message)))
+		response = append(response, message...)
+		mc, _ := newTestMetricsClient(true, response, protobufContentType)
+
+		// Act
+		result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, "", nil, "", false, nil)
+
+		// Assert
+		Expect(len(message)).To(BeNumerically(">", 4096))
+		Expect(err).To(Succeed())
+		Expect(result.TotalRequestCount).To(Equal(int64(7)))
+	})
+
+	It("should fall back to the text parser, if the server responds in the text format", func() {
+		// Arrange
+		mc, _ := newTestMetricsClient(true, []byte("apiserver_request_total{code=\"200\"} 42\n"), "text/plain")
+
+		// Act
+		result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, "", nil, "", false, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(result.TotalRequestCount).To(Equal(int64(42)))
+	})
+
+	It("should fail, if the protobuf response contains no request counters", func() {
+		// Arrange
+		response := newProtobufResponse(newMetricFamily(inflightMetricName, dto.MetricType_GAUGE, []float64{4}))
+		mc, _ := newTestMetricsClient(true, response, protobufContentType)
+
+		// Act
+		result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, "", nil, "", false, nil)
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("no '%s' counters", metricName)))
+		Expect(result).To(BeZero())
+	})
+
+	It("should fail, if the protobuf response is truncated", func() {
+		// Arrange
+		response := newProtobufResponse(newMetricFamily(metricName, dto.MetricType_COUNTER, []float64{1, 2, 3}))
+		mc, _ := newTestMetricsClient(true, response[:len(response)-3], protobufContentType)
+
+		// Act
+		result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, "", nil, "", false, nil)
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+		Expect(result).To(BeZero())
+	})
+
+	It("should reject a response which exceeds the maximum response size, regardless of the message lengths", func() {
+		// Arrange
+		response := newProtobufResponse(newMetricFamily(metricName, dto.MetricType_COUNTER, make([]float64, 100)))
+		mc, _ := newTestMetricsClient(true, response, protobufContentType)
+		mc.maxResponseSize = 100
+
+		// Act
+		_, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, "", nil, "", false, nil)
+
+		// Assert
+		Expect(err).To(MatchError(errResponseTooLarge))
+	})
+
+	Describe("isProtobufResponse", func() {
+		It("should only accept the delimited MetricFamily format", func() {
+			Expect(isProtobufResponse(protobufContentType)).To(BeTrue())
+			Expect(isProtobufResponse("text/plain; version=0.0.4; charset=utf-8")).To(BeFalse())
+			Expect(isProtobufResponse(protobufMediaType + "; proto=io.prometheus.client.MetricFamily; encoding=text")).
+				To(BeFalse())
+			Expect(isProtobufResponse("")).To(BeFalse())
+		})
+	})
+})
+
+//#region Benchmarks
+
+// BenchmarkGetKapiMetricsProtobuf is the protobuf counterpart of BenchmarkGetKapiMetrics, over an equivalent response
+func BenchmarkGetKapiMetricsProtobuf(b *testing.B) {
+	requests := &dto.MetricFamily{Name: proto.String(metricName), Type: dto.MetricType_COUNTER.Enum()}
+	other := &dto.MetricFamily{Name: proto.String("etcd_request_duration_seconds"), Type: dto.MetricType_UNTYPED.Enum()}
+	for i := 0; i < 3000; i++ {
+		requests.Metric = append(requests.Metric, &dto.Metric{
+			Label: []*dto.LabelPair{
+				{Name: proto.String("code"), Value: proto.String("200")},
+				{Name: proto.String("resource"), Value: proto.String("configmaps")},
+				{Name: proto.String("verb"), Value: proto.String("LIST")},
+			},
+			Counter: &dto.Counter{Value: proto.Float64(float64(1000 + i*37))},
+		})
+	}
+	for i := 0; i < 30000; i++ {
+		other.Metric = append(other.Metric, &dto.Metric{
+			Label: []*dto.LabelPair{
+				{Name: proto.String("operation"), Value: proto.String("get")},
+				{Name: proto.String("type"), Value: proto.String(fmt.Sprintf("resource%d", i/10))},
+				{Name: proto.String("le"), Value: proto.String(fmt.Sprint(i % 10))},
+			},
+			Untyped: &dto.Untyped{Value: proto.Float64(float64(i))},
+		})
+	}
+	response := newProtobufResponse(requests, other)
+	b.SetBytes(int64(len(response)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := getKapiMetricsProtobuf(bytes.NewReader(response)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+//#endregion Benchmarks
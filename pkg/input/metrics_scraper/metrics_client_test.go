@@ -5,19 +5,27 @@
 package metrics_scraper
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/client-go/rest"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
 )
 
 //#region fakeHttpClient
@@ -93,9 +101,11 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 	)
 	var (
 		newTestMetricsClient = func(responseBody interface{}) (*metricsClientImpl, *fakeHttpClient) {
-			metricsClient := newMetricsClient().(*metricsClientImpl)
+			metricsClient := newMetricsClient(time.Minute, nil, 0, TLSSettings{}, ResponseSettings{}, false).(*metricsClientImpl)
 			httpClient := newFakeHttpClient(responseBody)
-			metricsClient.testIsolation.NewHttpClient = func(_ *x509.CertPool) rest.HTTPClient {
+			metricsClient.testIsolation.NewHttpClient = func(
+				_ *x509.CertPool, _ string, _ bool, _ *url.URL, _ string) rest.HTTPClient {
+
 				return httpClient
 			}
 			return metricsClient, httpClient
@@ -125,7 +135,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			http.Err = errors.New("my error")
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).NotTo(BeNil())
@@ -139,7 +149,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			http.Response.StatusCode = 400
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).NotTo(BeNil())
@@ -147,12 +157,41 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			Expect(result).To(BeZero())
 		})
 
+		It("should classify a rejected request as an auth failure, and other HTTP error codes as other failures", func() {
+			// Arrange
+			mc, http := newTestMetricsClient("")
+			http.Response.StatusCode = 403
+
+			// Act
+			_, errForbidden := mc.GetKapiInstanceMetrics(
+				context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+			http.Response.StatusCode = 503
+			_, errUnavailable := mc.GetKapiInstanceMetrics(
+				context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(errorCategory(errForbidden)).To(Equal(input_data_registry.ScrapeErrorAuth))
+			Expect(errorCategory(errUnavailable)).To(Equal(input_data_registry.ScrapeErrorOther))
+		})
+
+		It("should classify a response which cannot be parsed as a parse failure", func() {
+			// Arrange
+			mc, _ := newTestMetricsClient("apiserver_request_total{code=\"200\"} x\n")
+
+			// Act
+			_, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(errorCategory(err)).To(Equal(input_data_registry.ScrapeErrorParse))
+		})
+
 		It("should return an error and zero value when the HTTP response is empty", func() {
 			// Arrange
 			mc, _ := newTestMetricsClient("")
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).NotTo(BeNil())
@@ -165,7 +204,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient([]byte{1, 5, 10, 20, 40, 80, 160})
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).NotTo(BeNil())
@@ -177,7 +216,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(""))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).NotTo(BeNil())
@@ -190,11 +229,11 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total{code=\"200\"} 5678\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(5678)))
+			Expect(result.TotalRequestCount).To(Equal(int64(5678)))
 		})
 
 		It("should sum up all RPS metric counters", func() {
@@ -205,11 +244,144 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 					"apiserver_request_total{code=\"201\"} 16\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).To(BeNil())
+			Expect(result.TotalRequestCount).To(Equal(int64(31)))
+		})
+
+		It("should sum up the RPS metric counters of failed requests, separately for 4xx and 5xx codes", func() {
+			// Arrange
+			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody(
+				"apiserver_request_total{code=\"200\",verb=\"GET\"} 100\n" +
+					"apiserver_request_total{code=\"404\",verb=\"GET\"} 7\n" +
+					"apiserver_request_total{verb=\"LIST\",code=\"429\"} 3\n" +
+					"apiserver_request_total{code=\"503\",verb=\"GET\"} 2\n" +
+					"apiserver_request_total{error_code=\"500\",code=\"201\"} 8\n")))
+
+			// Act
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).To(BeNil())
+			Expect(result.TotalRequestCount).To(Equal(int64(120)))
+			Expect(result.ClientErrorCount).To(Equal(int64(10)))
+			Expect(result.ServerErrorCount).To(Equal(int64(2)))
+		})
+
+		It("should sum up all inflight request gauges", func() {
+			// Arrange
+			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody(
+				"apiserver_request_total{code=\"200\"} 15\n" +
+					"apiserver_current_inflight_requests{request_kind=\"mutating\"} 3\n" +
+					"apiserver_current_inflight_requests{request_kind=\"readOnly\"} 10\n")))
+
+			// Act
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).To(BeNil())
+			Expect(result.TotalRequestCount).To(Equal(int64(15)))
+			Expect(result.InflightRequestCount).To(Equal(int64(13)))
+			Expect(result.HasInflightRequestCount).To(BeTrue())
+		})
+
+		It("should succeed and report no inflight request count, if the response contains no inflight request gauges", func() {
+			// Arrange
+			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total{code=\"200\"} 15\n")))
+
+			// Act
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).To(BeNil())
+			Expect(result.TotalRequestCount).To(Equal(int64(15)))
+			Expect(result.HasInflightRequestCount).To(BeFalse())
+			Expect(result.HasCPUSeconds).To(BeFalse())
+			Expect(result.HasResidentMemoryBytes).To(BeFalse())
+		})
+
+		It("should return the process CPU and memory usage", func() {
+			// Arrange
+			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody(
+				"apiserver_request_total{code=\"200\"} 15\n" +
+					"process_cpu_seconds_total 1234.56\n" +
+					"process_resident_memory_bytes 1.073741824e+09\n")))
+
+			// Act
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(31)))
+			Expect(result.TotalRequestCount).To(Equal(int64(15)))
+			Expect(result.CPUSeconds).To(Equal(1234.56))
+			Expect(result.HasCPUSeconds).To(BeTrue())
+			Expect(result.ResidentMemoryBytes).To(Equal(int64(1073741824)))
+			Expect(result.HasResidentMemoryBytes).To(BeTrue())
+		})
+
+		It("should sum up the request duration histogram sums and counts, ignoring its buckets", func() {
+			// Arrange
+			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody(
+				"apiserver_request_total{code=\"200\"} 15\n" +
+					"apiserver_request_duration_seconds_bucket{verb=\"GET\",le=\"0.05\"} 8\n" +
+					"apiserver_request_duration_seconds_sum{verb=\"GET\"} 0.25\n" +
+					"apiserver_request_duration_seconds_count{verb=\"GET\"} 10\n" +
+					"apiserver_request_duration_seconds_sum{verb=\"LIST\"} 1.5\n" +
+					"apiserver_request_duration_seconds_count{verb=\"LIST\"} 5\n")))
+
+			// Act
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).To(BeNil())
+			Expect(result.TotalRequestCount).To(Equal(int64(15)))
+			Expect(result.RequestDurationSeconds).To(Equal(1.75))
+			Expect(result.RequestDurationCount).To(Equal(int64(15)))
+			Expect(result.HasRequestDuration).To(BeTrue())
+		})
+
+		It("should return the process start time", func() {
+			// Arrange
+			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody(
+				"apiserver_request_total{code=\"200\"} 15\n" +
+					"process_start_time_seconds 1.71234567891e+09\n")))
+
+			// Act
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).To(BeNil())
+			Expect(result.HasProcessStartTime).To(BeTrue())
+			Expect(result.processStartTime()).To(Equal(time.UnixMilli(1712345678910)))
+		})
+
+		It("should return an error and zero value when the process CPU metric line has a value which is not a number", func() {
+			// Arrange
+			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody(
+				"apiserver_request_total{code=\"200\"} 15\n" +
+					"process_cpu_seconds_total abc\n")))
+
+			// Act
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).NotTo(BeNil())
+			Expect(result).To(BeZero())
+		})
+
+		It("should return an error if the response contains inflight request gauges, but no RPS counters", func() {
+			// Arrange
+			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody(
+				"apiserver_current_inflight_requests{request_kind=\"mutating\"} 3\n")))
+
+			// Act
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).NotTo(BeNil())
+			Expect(result).To(BeZero())
 		})
 
 		It("should succeed when an RPS metric line has a negative int64 value which does not fit in int32", func() {
@@ -217,11 +389,11 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total{code=\"200\"} -10000000000\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(-10 * 1000 * 1000 * 1000)))
+			Expect(result.TotalRequestCount).To(Equal(int64(-10 * 1000 * 1000 * 1000)))
 		})
 
 		It("should succeed when an RPS metric line has a floating point value which corresponds to an integer", func() {
@@ -229,11 +401,11 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total{code=\"200\"} 1.0056e4\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(10056)))
+			Expect(result.TotalRequestCount).To(Equal(int64(10056)))
 		})
 
 		It("should succeed when an RPS metric line has no series identifier", func() {
@@ -241,11 +413,11 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total 15\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(15)))
+			Expect(result.TotalRequestCount).To(Equal(int64(15)))
 		})
 
 		It("should succeed if an RPS metric line has whitespace between the metric name and the series identifier", func() {
@@ -253,11 +425,11 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total \t{code=\"200\"} 15\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(15)))
+			Expect(result.TotalRequestCount).To(Equal(int64(15)))
 		})
 
 		It("should return an error and zero value when an RPS metric line has unterminated series identifier", func() {
@@ -265,7 +437,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total{code=\"200\" 15\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).NotTo(BeNil())
@@ -278,7 +450,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total{code=\"200\"}\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).NotTo(BeNil())
@@ -291,7 +463,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total{code=\"200\"} BadValue\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).NotTo(BeNil())
@@ -304,7 +476,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total{code=\"200\"} 1.5\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).NotTo(BeNil())
@@ -317,7 +489,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total{code=\"200\"} 99999999999999999999\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).NotTo(BeNil())
@@ -330,7 +502,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total\x00{code=\"200\"} 15\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).NotTo(BeNil())
@@ -343,11 +515,11 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(newResponseBody("\n\napiserver_request_total{code=\"200\"} 15\n")))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(15)))
+			Expect(result.TotalRequestCount).To(Equal(int64(15)))
 		})
 
 		It("should attempt to parse the response as plaintext metrics, when the HTTP response has unexpected content encoding", func() {
@@ -356,11 +528,11 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			http.Response.Header = map[string][]string{"Content-Encoding": {"surprise"}}
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(15)))
+			Expect(result.TotalRequestCount).To(Equal(int64(15)))
 		})
 
 		It("should succeed when the HTTP response payload starts with a comment", func() {
@@ -368,11 +540,11 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody("# HELP abc\napiserver_request_total{code=\"200\"} 15\n"))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(15)))
+			Expect(result.TotalRequestCount).To(Equal(int64(15)))
 		})
 
 		It("should succeed when the HTTP response payload does not start with a comment", func() {
@@ -380,11 +552,11 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody("apiserver_request_total{code=\"200\"} 15\n"))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(15)))
+			Expect(result.TotalRequestCount).To(Equal(int64(15)))
 		})
 
 		It("should succeed when the HTTP response is gzip compressed", func() {
@@ -395,11 +567,11 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			http.Response.Header = map[string][]string{"Content-Encoding": {"gzip"}}
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(15)))
+			Expect(result.TotalRequestCount).To(Equal(int64(15)))
 		})
 
 		It("should process correctly a 19.38MB (< 20MiB) plain text HTTP response", func() {
@@ -424,11 +596,78 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, _ := newTestMetricsClient(newResponseBody(responseBuilder.String()))
 
 			// Act
-			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(err).To(BeNil())
-			Expect(result).To(Equal(int64(2 * counterCount)))
+			Expect(result.TotalRequestCount).To(Equal(int64(2 * counterCount)))
+		})
+
+		It("should fail with a clear error, if the response exceeds the maximum response size", func() {
+			// Arrange
+			mc, _ := newTestMetricsClient(newResponseBody("apiserver_request_total{code=\"200\"} 15\n"))
+			mc.maxResponseSize = 100
+
+			// Act
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).To(MatchError(errResponseTooLarge))
+			Expect(err.Error()).To(ContainSubstring("100 bytes"))
+			Expect(result).To(BeZero())
+		})
+
+		It("should stop requesting compression from a target whose compressed response is too small to benefit", func() {
+			// Arrange
+			gzipBytes, err := os.ReadFile("testdata/metrics-response-sample.gz")
+			Expect(err).To(Succeed())
+			mc, http := newTestMetricsClient(gzipBytes)
+			http.Response.Header = map[string][]string{"Content-Encoding": {"gzip"}}
+			_, err = mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+			Expect(err).To(Succeed())
+			Expect(http.Request.Header.Get("Accept-Encoding")).To(Equal("gzip"))
+			http.Response.Header = nil
+			http.Response.Body = newFakeReader(newResponseBody("apiserver_request_total{code=\"200\"} 15\n"))
+
+			// Act
+			_, err = mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(http.Request.Header.Get("Accept-Encoding")).To(Equal("identity"))
+		})
+
+		It("should not request compression, if it is disabled", func() {
+			// Arrange
+			mc, http := newTestMetricsClient(newResponseBody("apiserver_request_total{code=\"200\"} 15\n"))
+			mc.responseSettings.DisableGzip = true
+
+			// Act
+			_, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(http.Request.Header.Get("Accept-Encoding")).To(Equal("identity"))
+		})
+
+		It("should parse lines which exceed the default read buffer, if the read buffer is large enough", func() {
+			// Arrange
+			longLine := "apiserver_request_total{code=\"200\",resource=\"" +
+				strings.Repeat("x", DefaultReadBufferSize) + "\"} 15\n"
+			mc, _ := newTestMetricsClient(newResponseBody(longLine + "apiserver_request_total{code=\"200\"} 2\n"))
+			defaultResult, err := mc.GetKapiInstanceMetrics(
+				context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+			Expect(err).To(Succeed())
+			mc, _ = newTestMetricsClient(newResponseBody(longLine + "apiserver_request_total{code=\"200\"} 2\n"))
+			mc.responseSettings.ReadBufferSize = 4 * DefaultReadBufferSize
+
+			// Act
+			result, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(defaultResult.TotalRequestCount).To(Equal(int64(2)))
+			Expect(result.TotalRequestCount).To(Equal(int64(17)))
 		})
 
 		It("when failing, should close the response stream", func() {
@@ -436,7 +675,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, http := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total{code=\"200\" 15\n")))
 
 			// Act
-			_, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			_, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 			Expect(err).NotTo(BeNil())
 
 			// Assert
@@ -447,7 +686,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, http := newTestMetricsClient(newResponseBody(newResponseBody("apiserver_request_total{code=\"200\"} 15\n")))
 
 			// Act
-			_, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool)
+			_, err := mc.GetKapiInstanceMetrics(context.Background(), metricsUrl, authSecret, certPool, "", false, nil)
 			Expect(err).To(BeNil())
 
 			// Assert
@@ -459,7 +698,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			mc, http := newTestMetricsClient("")
 
 			// Act
-			mc.GetKapiInstanceMetrics(context.Background(), "https://my/metrics", authSecret, certPool)
+			mc.GetKapiInstanceMetrics(context.Background(), "https://my/metrics", authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(http.Request.URL.Scheme).To(Equal("https"))
@@ -468,6 +707,38 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			Expect(http.Request.Header["Authorization"]).To(Equal([]string{"Bearer " + authSecret}))
 		})
 
+		It("should obtain an HTTP client for the IP address in the URL, so the certificate can be pinned to it", func() {
+			// Arrange
+			mc, http := newTestMetricsClient("")
+			var podIP string
+			mc.testIsolation.NewHttpClient = func(_ *x509.CertPool, _ string, _ bool, _ *url.URL, ip string) rest.HTTPClient {
+				podIP = ip
+				return http
+			}
+
+			// Act
+			mc.GetKapiInstanceMetrics(context.Background(), "https://10.0.0.1:443/metrics", authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(podIP).To(Equal("10.0.0.1"))
+		})
+
+		It("should add the extra headers carried by the context, without letting them replace its own", func() {
+			// Arrange
+			mc, http := newTestMetricsClient("")
+			ctx := withRequestHeaders(context.Background(), map[string][]string{
+				"X-Proxy-Token": {"abc", "def"},
+				"Authorization": {"Basic xyz"},
+			})
+
+			// Act
+			mc.GetKapiInstanceMetrics(ctx, "https://my/metrics", authSecret, certPool, "", false, nil)
+
+			// Assert
+			Expect(http.Request.Header["X-Proxy-Token"]).To(Equal([]string{"abc", "def"}))
+			Expect(http.Request.Header["Authorization"]).To(Equal([]string{"Bearer " + authSecret}))
+		})
+
 		It("should pass the specified context to the HTTP client, so it can abort work when context is cancelled", func() {
 			// Arrange
 			mc, http := newTestMetricsClient("")
@@ -475,7 +746,7 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 			defer cancel()
 
 			// Act
-			mc.GetKapiInstanceMetrics(ctx, "https://my/metrics", authSecret, certPool)
+			mc.GetKapiInstanceMetrics(ctx, "https://my/metrics", authSecret, certPool, "", false, nil)
 
 			// Assert
 			Expect(http.Request.Context().Err()).To(BeNil())
@@ -487,14 +758,237 @@ var _ = Describe("input.metrics_scraper.metricsClientImpl", func() {
 	Describe("newMetricsClient", func() {
 		It("should return a client which uses specified cert pool for HTTP clients it creates", func() {
 			// Arrange
-			mc := newMetricsClient().(*metricsClientImpl)
+			mc := newMetricsClient(time.Minute, nil, 0, TLSSettings{}, ResponseSettings{}, false).(*metricsClientImpl)
 
 			// Act
-			hc := mc.testIsolation.NewHttpClient(certPool)
+			hc := mc.testIsolation.NewHttpClient(certPool, "", false, nil, "")
 
 			// Assert
 			actualCertPool := hc.(*http.Client).Transport.(*http.Transport).TLSClientConfig.RootCAs
 			Expect(actualCertPool == certPool).To(BeTrue())
 		})
+
+		It("should reuse HTTP clients across calls with the same cert pool", func() {
+			// Arrange
+			mc := newMetricsClient(time.Minute, nil, 0, TLSSettings{}, ResponseSettings{}, false).(*metricsClientImpl)
+
+			// Act
+			hc1 := mc.testIsolation.NewHttpClient(certPool, "", false, nil, "")
+			hc2 := mc.testIsolation.NewHttpClient(certPool, "", false, nil, "")
+			hc3 := mc.testIsolation.NewHttpClient(getExampleCertPool(), "", false, nil, "")
+
+			// Assert
+			Expect(hc1 == hc2).To(BeTrue())
+			Expect(hc1 == hc3).To(BeFalse())
+		})
+	})
+
+	Describe("parseDecimalInt", func() {
+		DescribeTable("should parse the value the way strconv.ParseInt does",
+			func(value string, expected int64, expectedOk bool) {
+				// Act
+				result, ok := parseDecimalInt([]byte(value))
+
+				// Assert
+				Expect(ok).To(Equal(expectedOk))
+				Expect(result).To(Equal(expected))
+			},
+			Entry("plain", "1234", int64(1234), true),
+			Entry("signed", "-42", int64(-42), true),
+			Entry("max", "9223372036854775807", int64(math.MaxInt64), true),
+			Entry("min", "-9223372036854775808", int64(math.MinInt64), true),
+			Entry("overflow", "9223372036854775808", int64(0), false),
+			Entry("large overflow", "123456789012345678901234567890", int64(0), false),
+			Entry("fractional", "1.5", int64(0), false),
+			Entry("scientific notation", "1e+06", int64(0), false),
+			Entry("empty", "", int64(0), false),
+			Entry("sign only", "-", int64(0), false),
+		)
+	})
+
+	Describe("kapiMetrics.addRequestCounts", func() {
+		It("should add the request counters, and keep the receiver's other values", func() {
+			// Arrange
+			sum := kapiMetrics{
+				TotalRequestCount:       10,
+				ClientErrorCount:        2,
+				ServerErrorCount:        1,
+				CPUSeconds:              5,
+				HasCPUSeconds:           true,
+				ResidentMemoryBytes:     1000,
+				ProcessStartTimeSeconds: 2000,
+				HasProcessStartTime:     true,
+			}
+			sidecar := kapiMetrics{
+				TotalRequestCount:       3,
+				ClientErrorCount:        1,
+				ServerErrorCount:        1,
+				CPUSeconds:              7,
+				HasCPUSeconds:           true,
+				ResidentMemoryBytes:     500,
+				HasResidentMemoryBytes:  true,
+				ProcessStartTimeSeconds: 1000,
+				HasProcessStartTime:     true,
+			}
+
+			// Act
+			sum.addRequestCounts(sidecar)
+
+			// Assert
+			Expect(sum.TotalRequestCount).To(Equal(int64(13)))
+			Expect(sum.ClientErrorCount).To(Equal(int64(3)))
+			Expect(sum.ServerErrorCount).To(Equal(int64(2)))
+			Expect(sum.CPUSeconds).To(Equal(5.0))
+			Expect(sum.ResidentMemoryBytes).To(Equal(int64(1000)))
+			Expect(sum.HasResidentMemoryBytes).To(BeFalse())
+			Expect(sum.ProcessStartTimeSeconds).To(Equal(2000.0))
+		})
 	})
 })
+
+//#region Benchmarks
+
+// newBenchmarkMetricsResponse returns a Kapi metrics response resembling one from a busy kube-apiserver: a few thousand
+// apiserver_request_total series, outnumbered tenfold by the series of metrics which are not of interest, most of
+// which are histogram buckets
+func newBenchmarkMetricsResponse() []byte {
+	var buffer bytes.Buffer
+	codes := []string{"200", "201", "404", "409", "500"}
+	verbs := []string{"GET", "LIST", "WATCH", "PATCH", "UPDATE"}
+	buffer.WriteString("# HELP apiserver_request_total Counter of apiserver requests\n")
+	buffer.WriteString("# TYPE apiserver_request_total counter\n")
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&buffer,
+			`apiserver_request_total{code="%s",component="apiserver",dry_run="",group="",resource="resource%d",`+
+				`scope="namespace",subresource="",verb="%s",version="v1"} %d`+"\n",
+			codes[i%len(codes)], i/25, verbs[(i/5)%len(verbs)], 1000+i*37)
+	}
+	for i := 0; i < 30000; i++ {
+		fmt.Fprintf(&buffer, `etcd_request_duration_seconds_bucket{operation="get",type="resource%d",le="%d"} %d`+"\n",
+			i/10, i%10, i)
+	}
+	buffer.WriteString("apiserver_current_inflight_requests{request_kind=\"mutating\"} 3\n")
+	buffer.WriteString("apiserver_current_inflight_requests{request_kind=\"readOnly\"} 12\n")
+	buffer.WriteString("process_cpu_seconds_total 12345.67\n")
+	buffer.WriteString("process_resident_memory_bytes 1.2345678e+09\n")
+	buffer.WriteString("process_start_time_seconds 1.71234567891e+09\n")
+	return buffer.Bytes()
+}
+
+func BenchmarkGetKapiMetrics(b *testing.B) {
+	response := newBenchmarkMetricsResponse()
+	b.SetBytes(int64(len(response)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := getKapiMetrics(bytes.NewReader(response)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// chunkedReader returns at most chunkSize bytes per read, like a network connection, which delivers a large response
+// in TLS record sized chunks
+type chunkedReader struct {
+	reader    io.Reader
+	chunkSize int
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if len(p) > r.chunkSize {
+		p = p[:r.chunkSize]
+	}
+	return r.reader.Read(p)
+}
+
+// BenchmarkGetKapiMetrics_ReadBufferSize measures the parsing of a response, arriving in network sized chunks, through
+// read buffers of different sizes. See ResponseSettings.ReadBufferSize.
+func BenchmarkGetKapiMetrics_ReadBufferSize(b *testing.B) {
+	response := newBenchmarkMetricsResponse()
+	for _, bufferSize := range []int{DefaultReadBufferSize, 64 * 1024, 1024 * 1024} {
+		b.Run(fmt.Sprintf("buffer=%dKiB", bufferSize/1024), func(b *testing.B) {
+			b.SetBytes(int64(len(response)))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				network := &chunkedReader{reader: bytes.NewReader(response), chunkSize: 16 * 1024}
+				if _, err := getKapiMetrics(bufio.NewReaderSize(network, bufferSize)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetKapiMetrics_Gzip measures the CPU cost of decompression, by comparing the parsing of a response with and
+// without gzip encoding. Compression is worth it only where the bandwidth saved, as reported, outweighs that cost.
+// See ResponseSettings.DisableGzip.
+func BenchmarkGetKapiMetrics_Gzip(b *testing.B) {
+	response := newBenchmarkMetricsResponse()
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(response); err != nil {
+		b.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("identity", func(b *testing.B) {
+		b.SetBytes(int64(len(response)))
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := getKapiMetrics(bytes.NewReader(response)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(len(response)), "wire-bytes/op")
+	})
+	b.Run("gzip", func(b *testing.B) {
+		b.SetBytes(int64(len(response)))
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			reader, err := gzip.NewReader(bytes.NewReader(compressed.Bytes()))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := getKapiMetrics(reader); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(compressed.Len()), "wire-bytes/op")
+	})
+}
+
+func BenchmarkParseLine(b *testing.B) {
+	line := []byte(`apiserver_request_total{code="200",component="apiserver",dry_run="",group="",` +
+		`resource="configmaps",scope="namespace",subresource="",verb="LIST",version="v1"} 15`)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, _, err := parseLine(line, metricName); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseLine_ScientificNotation(b *testing.B) {
+	line := []byte(`apiserver_request_total{code="200",verb="LIST"} 1.234567e+06`)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, _, err := parseLine(line, metricName); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+//#endregion Benchmarks
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"fmt"
+	"path"
+)
+
+// NamespaceFilter selects the shoot namespaces whose kube-apiserver pods are scraped. Patterns use the syntax of
+// [path.Match], e.g. "shoot--garden-*". The zero value selects all namespaces.
+type NamespaceFilter struct {
+	// If not empty, only namespaces matching at least one of these patterns are selected
+	Include []string
+	// Namespaces matching any of these patterns are not selected, even if they match an Include pattern
+	Exclude []string
+}
+
+// Validate returns an error if any of the filter's patterns is malformed
+func (f *NamespaceFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid namespace pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the filter selects the specified namespace. Malformed patterns match nothing.
+func (f *NamespaceFilter) Matches(namespace string) bool {
+	if len(f.Include) > 0 && !matchesAny(f.Include, namespace) {
+		return false
+	}
+	return !matchesAny(f.Exclude, namespace)
+}
+
+// matchesAny returns true if the namespace matches at least one of the patterns
+func matchesAny(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if isMatch, _ := path.Match(pattern, namespace); isMatch {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("input.metrics_scraper.NamespaceFilter", func() {
+	Describe("Matches", func() {
+		DescribeTable("should select namespaces according to the include and exclude patterns",
+			func(filter NamespaceFilter, namespace string, expected bool) {
+				Expect(filter.Matches(namespace)).To(Equal(expected))
+			},
+			Entry("zero value", NamespaceFilter{}, "shoot--a--b", true),
+			Entry("included", NamespaceFilter{Include: []string{"shoot--a--*"}}, "shoot--a--b", true),
+			Entry("not included", NamespaceFilter{Include: []string{"shoot--a--*"}}, "shoot--c--b", false),
+			Entry("excluded", NamespaceFilter{Exclude: []string{"*--b"}}, "shoot--a--b", false),
+			Entry("included and excluded",
+				NamespaceFilter{Include: []string{"shoot--a--*"}, Exclude: []string{"*--b"}}, "shoot--a--b", false),
+			Entry("malformed pattern", NamespaceFilter{Include: []string{"["}}, "shoot--a--b", false),
+		)
+	})
+
+	Describe("Validate", func() {
+		It("should accept well-formed patterns", func() {
+			// Arrange
+			filter := NamespaceFilter{Include: []string{"shoot--*"}, Exclude: []string{"shoot--garden-?"}}
+
+			// Act & Assert
+			Expect(filter.Validate()).To(Succeed())
+		})
+
+		It("should reject a malformed pattern", func() {
+			// Arrange
+			filter := NamespaceFilter{Exclude: []string{"shoot--["}}
+
+			// Act
+			err := filter.Validate()
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("shoot--["))
+		})
+	})
+})
@@ -8,7 +8,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
-	"github.com/gardener/gardener-custom-metrics/pkg/util/testutil"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
 )
 
 var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
@@ -137,7 +137,7 @@ var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
 					rateSurplusLimit := expectedAllowedCalls + 5
 
 					pm := newTestPacemaker(2, maxRate, 10, rateSurplusLimit)
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 
 					// Exhaust the surplus
 					for i := 0; i < rateSurplusLimit; i++ {
@@ -146,7 +146,7 @@ var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
 					Expect(pm.GetScrapePermission(true)).To(BeFalse())
 
 					// Now advance time. All subsequent allowance should be due to rate, not surplus
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, secondsElapsed)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, secondsElapsed)
 
 					// Act and assert
 					for i := 0; i < expectedAllowedCalls; i++ {
@@ -162,14 +162,14 @@ var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
 					// Arrange
 					surplusLimit := 10
 					pm := newTestPacemaker(5, 10, 50, surplusLimit)
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 
 					// Start the timer
 					Expect(pm.GetScrapePermission(true)).To(BeTrue())
 					Expect(pm.GetScrapePermission(false)).To(BeFalse())
 
 					// Advance time to accumulate debt
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 1, 0)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0)
 
 					// Act and assert
 					for i := 0; i < surplusLimit; i++ {
@@ -191,14 +191,14 @@ var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
 					expectedAllowedCalls := int(minRate * float64(secondsElapsed))
 
 					pm := newTestPacemaker(minRate, 100, 100, 100)
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 
 					// Start the timer
 					Expect(pm.GetScrapePermission(true)).To(BeTrue())
 					Expect(pm.GetScrapePermission(false)).To(BeFalse())
 
 					// Now advance time. All subsequent allowance should be due to accumulated debt
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, secondsElapsed)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, secondsElapsed)
 
 					// Act and assert
 					for i := 0; i < expectedAllowedCalls; i++ {
@@ -216,14 +216,14 @@ var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
 					debtLimit := 5
 
 					pm := newTestPacemaker(minRate, 100, debtLimit, 100)
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 
 					// Start the timer
 					Expect(pm.GetScrapePermission(true)).To(BeTrue())
 					Expect(pm.GetScrapePermission(false)).To(BeFalse())
 
 					// Now advance time. All subsequent allowance should be due to accumulated debt
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, secondsElapsed)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, secondsElapsed)
 
 					// Act and assert
 					for i := 0; i < debtLimit; i++ {
@@ -256,14 +256,14 @@ var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
 
 				for _, isEager := range []bool{true, false} {
 					pm := newTestPacemaker(minRate, 10, 1000, 1000)
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 
 					// Start the timer
 					Expect(pm.GetScrapePermission(true)).To(BeTrue())
 					Expect(pm.GetScrapePermission(false)).To(BeFalse())
 
 					// Advance time to accumulate debt
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, secondsElapsed)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, secondsElapsed)
 
 					// Act and assert
 					for i := 0; i < expectedAllowedCalls; i++ {
@@ -282,14 +282,14 @@ var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
 
 				for _, isEager := range []bool{true, false} {
 					pm := newTestPacemaker(5, maxRate, 1000, surplusLimit)
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 
 					// Start the timer
 					Expect(pm.GetScrapePermission(true)).To(BeTrue())
 					Expect(pm.GetScrapePermission(false)).To(BeFalse())
 
 					// Advance time to accumulate debt
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 1, 0)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0)
 
 					// Consume the surplus
 					for i := 0; i < surplusLimit; i++ {
@@ -298,7 +298,7 @@ var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
 					Expect(pm.GetScrapePermission(true)).To(BeFalse())
 
 					// Advance time a bit more to accumulate allowance based on MaxRate
-					pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 1, secondsElapsed)
+					pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, secondsElapsed)
 
 					// Act and assert
 					for i := 0; i < expectedAllowedCalls; i++ {
@@ -318,14 +318,14 @@ var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
 			minRate := 1.0
 			maxRate := 10.0
 			pm := newTestPacemaker(minRate, maxRate, debtLimit, surplusLimit)
-			pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 
 			// Start the timer
 			Expect(pm.GetScrapePermission(true)).To(BeTrue())
 			Expect(pm.GetScrapePermission(false)).To(BeFalse())
 
 			// Stay idle until debt limit exceeded
-			pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 1, 0) // Debt=30, SurplusAllowance=20
+			pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0) // Debt=30, SurplusAllowance=20
 			Expect(pm.GetScrapePermission(false)).To(BeTrue())
 			Expect(pm.GetScrapePermission(true)).To(BeTrue())
 
@@ -338,7 +338,7 @@ var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
 
 			// Wait a bit to recover surplus allowance
 			// Debt=10, SurplusAllowance=0
-			pm.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 1, 2) // Debt=12, SurplusAllowance=20
+			pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 2) // Debt=12, SurplusAllowance=20
 
 			// Fulfill debt by a mix of eager and lazy calls
 			for i := 0; i < 12-1; i++ { // -1 for the call below
@@ -349,7 +349,7 @@ var _ = Describe("input.metrics_scraper.pacemakerImpl", func() {
 			Expect(pm.GetScrapePermission(true)).To(BeTrue())   // Surplus available
 
 			// Stay idle until debt limit exceeded again
-			pm.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0) // Debt=30, SurplusAllowance=20
+			pm.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0) // Debt=30, SurplusAllowance=20
 			Expect(pm.GetScrapePermission(false)).To(BeTrue())
 			Expect(pm.GetScrapePermission(true)).To(BeTrue())
 		})
@@ -0,0 +1,389 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	krest "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// errNoPortForwardTarget is returned by portForwarder.DialContext if the context does not identify the target pod
+var errNoPortForwardTarget = errors.New("port-forward: the dial context does not specify a target pod")
+
+// portForwardTarget identifies the pod, which a port-forward connection leads to
+type portForwardTarget struct {
+	namespace string
+	podName   string
+}
+
+// portForwardTargetContextKey is the context key under which a portForwardTarget is stored. See
+// withPortForwardTarget.
+type portForwardTargetContextKey struct{}
+
+// withPortForwardTarget returns a copy of ctx, which instructs portForwarder.DialContext to connect to the specified
+// pod. Requests sent with that context, by an HTTP client which dials via a portForwarder, reach the pod.
+func withPortForwardTarget(ctx context.Context, namespace string, podName string) context.Context {
+	return context.WithValue(ctx, portForwardTargetContextKey{}, portForwardTarget{namespace: namespace, podName: podName})
+}
+
+// portForwardConnection is a pooled connection to the port-forward subresource of a single pod, plus the bookkeeping
+// necessary to evict it once it falls out of use
+type portForwardConnection struct {
+	connection httpstream.Connection
+	lastUsed   time.Time
+	// Each pair of streams, which carries a single forwarded connection, is identified by a request ID, unique within
+	// the connection
+	nextRequestID int
+}
+
+// portForwarder establishes network connections to pod ports through the seed kube-apiserver's pods/portforward
+// subresource, the way "kubectl port-forward" does. It is meant for seeds where the pods cannot be reached directly.
+//
+// The connection to the kube-apiserver is the expensive part: it requires a TLS handshake, and an authorization check
+// on the kube-apiserver side. To limit the load on the kube-apiserver, there is one such connection per pod, which is
+// kept open across scrapes, and each connection to a pod port is a pair of streams, multiplexed over it. Connections
+// which have not been used for longer than maxIdleTime are closed.
+//
+// All public members are concurrency-safe.
+type portForwarder struct {
+	// Maps <pod> -> <connection to the pod's port-forward subresource>. Values cannot be nil.
+	connections map[portForwardTarget]*portForwardConnection
+	// Connections which are not used for this long are closed
+	maxIdleTime time.Duration
+	// When did the last eviction pass take place
+	lastEvictionTime time.Time
+	lock             sync.Mutex
+
+	testIsolation portForwarderTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// newPortForwarder creates a portForwarder which reaches the pods' port-forward subresource via the kube-apiserver
+// specified by restConfig, and closes connections after they are left unused for maxIdleTime.
+func newPortForwarder(restConfig *krest.Config, maxIdleTime time.Duration) *portForwarder {
+	return &portForwarder{
+		connections: make(map[portForwardTarget]*portForwardConnection),
+		maxIdleTime: maxIdleTime,
+		testIsolation: portForwarderTestIsolation{
+			TimeNow: time.Now,
+			DialPod: func(namespace string, podName string) (httpstream.Connection, error) {
+				return dialPortForward(restConfig, namespace, podName)
+			},
+		},
+	}
+}
+
+// DialContext has the semantics of [net.Dialer.DialContext]. The target pod is the one specified by the
+// withPortForwardTarget context. The host part of the address is ignored - only the port is used.
+func (pf *portForwarder) DialContext(ctx context.Context, _ string, address string) (net.Conn, error) {
+	target, ok := ctx.Value(portForwardTargetContextKey{}).(portForwardTarget)
+	if !ok {
+		return nil, errNoPortForwardTarget
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("port-forward: parsing address '%s': %w", address, err)
+	}
+
+	connection, requestID, err := pf.getConnection(target)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := newPortForwardConn(connection, target, port, requestID)
+	if err != nil {
+		// The connection is likely broken. Do not let the next dial reuse it.
+		pf.closeConnection(target, connection)
+		return nil, fmt.Errorf("port-forward to pod %s/%s: %w", target.namespace, target.podName, err)
+	}
+	return conn, nil
+}
+
+// Close closes all pooled connections
+func (pf *portForwarder) Close() {
+	pf.lock.Lock()
+	defer pf.lock.Unlock()
+
+	for target, entry := range pf.connections {
+		_ = entry.connection.Close()
+		delete(pf.connections, target)
+	}
+}
+
+// Count returns the number of connections currently in the pool
+func (pf *portForwarder) Count() int {
+	pf.lock.Lock()
+	defer pf.lock.Unlock()
+
+	return len(pf.connections)
+}
+
+// getConnection returns an open connection to the target pod's port-forward subresource, and a request ID for a new
+// stream pair on that connection. A pooled connection is reused, if there is one.
+func (pf *portForwarder) getConnection(target portForwardTarget) (httpstream.Connection, int, error) {
+	if connection, requestID := pf.reuseConnection(target); connection != nil {
+		return connection, requestID, nil
+	}
+
+	// Dial without holding the lock, so a slow kube-apiserver response does not block the dials to other pods
+	connection, err := pf.testIsolation.DialPod(target.namespace, target.podName)
+	if err != nil {
+		return nil, 0, fmt.Errorf("port-forward to pod %s/%s: %w", target.namespace, target.podName, err)
+	}
+	connection.SetIdleTimeout(pf.maxIdleTime)
+
+	pf.lock.Lock()
+	defer pf.lock.Unlock()
+
+	entry := pf.connections[target]
+	if entry != nil && !isConnectionClosed(entry.connection) {
+		// Another dial to the same pod won the race. Use its connection, so there remains only one.
+		_ = connection.Close()
+	} else {
+		entry = &portForwardConnection{connection: connection}
+		pf.connections[target] = entry
+	}
+	entry.lastUsed = pf.testIsolation.TimeNow()
+	requestID := entry.nextRequestID
+	entry.nextRequestID++
+
+	return entry.connection, requestID, nil
+}
+
+// reuseConnection returns the pooled connection to the target pod, and a request ID for a new stream pair on that
+// connection. Returns a nil connection, if there is no open connection to the pod in the pool.
+func (pf *portForwarder) reuseConnection(target portForwardTarget) (httpstream.Connection, int) {
+	now := pf.testIsolation.TimeNow()
+
+	pf.lock.Lock()
+	defer pf.lock.Unlock()
+
+	pf.evictIdleThreadUnsafe(now)
+
+	entry := pf.connections[target]
+	if entry == nil {
+		return nil, 0
+	}
+	if isConnectionClosed(entry.connection) {
+		delete(pf.connections, target)
+		return nil, 0
+	}
+	entry.lastUsed = now
+	requestID := entry.nextRequestID
+	entry.nextRequestID++
+
+	return entry.connection, requestID
+}
+
+// closeConnection closes the specified connection, and removes it from the pool, if it is the target's connection
+// on record
+func (pf *portForwarder) closeConnection(target portForwardTarget, connection httpstream.Connection) {
+	_ = connection.Close()
+
+	pf.lock.Lock()
+	defer pf.lock.Unlock()
+
+	if entry := pf.connections[target]; entry != nil && entry.connection == connection {
+		delete(pf.connections, target)
+	}
+}
+
+// evictIdleThreadUnsafe closes and removes connections which have not been used for longer than maxIdleTime, or have
+// been closed by the other side. To keep the cost of frequent calls low, a full pass over the pool is made no more
+// than once per maxIdleTime.
+//
+// The caller must acquire the lock before calling this method.
+func (pf *portForwarder) evictIdleThreadUnsafe(now time.Time) {
+	if now.Sub(pf.lastEvictionTime) < pf.maxIdleTime {
+		return
+	}
+	pf.lastEvictionTime = now
+
+	for target, entry := range pf.connections {
+		if now.Sub(entry.lastUsed) > pf.maxIdleTime || isConnectionClosed(entry.connection) {
+			_ = entry.connection.Close()
+			delete(pf.connections, target)
+		}
+	}
+}
+
+// isConnectionClosed returns true if the specified connection has been closed
+func isConnectionClosed(connection httpstream.Connection) bool {
+	select {
+	case <-connection.CloseChan():
+		return true
+	default:
+		return false
+	}
+}
+
+// dialPortForward opens a connection to the port-forward subresource of the specified pod, via the kube-apiserver
+// specified by restConfig
+func dialPortForward(restConfig *krest.Config, namespace string, podName string) (httpstream.Connection, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("creating SPDY round tripper: %w", err)
+	}
+	url, _, err := krest.DefaultServerUrlFor(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("determining the kube-apiserver URL: %w", err)
+	}
+	url.Path = path.Join(url.Path, "api", "v1", "namespaces", namespace, "pods", podName, "portforward")
+
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+	connection, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return nil, fmt.Errorf("upgrading the connection: %w", err)
+	}
+	return connection, nil
+}
+
+// portForwardConn implements [net.Conn] on top of a port-forward stream pair: a data stream, which carries the
+// forwarded traffic, and an error stream, on which the kube-apiserver reports failures to reach the pod port.
+//
+// Deadlines are not supported. Timeouts are enforced by the HTTP client, via the request context.
+type portForwardConn struct {
+	connection  httpstream.Connection
+	dataStream  httpstream.Stream
+	errorStream httpstream.Stream
+	address     portForwardAddr
+	// The failure reported by the kube-apiserver on the error stream, if any. Holds an error.
+	remoteError atomic.Value
+	closeOnce   sync.Once
+}
+
+// newPortForwardConn creates the stream pair for a forwarded connection to the specified port, on the specified
+// connection to the port-forward subresource
+func newPortForwardConn(
+	connection httpstream.Connection, target portForwardTarget, port string, requestID int) (*portForwardConn, error) {
+
+	headers := http.Header{}
+	headers.Set(corev1.StreamType, corev1.StreamTypeError)
+	headers.Set(corev1.PortHeader, port)
+	headers.Set(corev1.PortForwardRequestIDHeader, strconv.Itoa(requestID))
+	errorStream, err := connection.CreateStream(headers)
+	if err != nil {
+		return nil, fmt.Errorf("creating error stream: %w", err)
+	}
+	// The error stream is only read from
+	_ = errorStream.Close()
+
+	headers.Set(corev1.StreamType, corev1.StreamTypeData)
+	dataStream, err := connection.CreateStream(headers)
+	if err != nil {
+		connection.RemoveStreams(errorStream)
+		return nil, fmt.Errorf("creating data stream: %w", err)
+	}
+
+	conn := &portForwardConn{
+		connection:  connection,
+		dataStream:  dataStream,
+		errorStream: errorStream,
+		address:     portForwardAddr(fmt.Sprintf("%s/%s:%s", target.namespace, target.podName, port)),
+	}
+	go conn.watchErrorStream()
+	return conn, nil
+}
+
+// watchErrorStream waits for a failure report on the error stream. Upon such report, it aborts the data stream, so
+// the failure surfaces to the reader, rather than having it wait for data which will never arrive.
+func (c *portForwardConn) watchErrorStream() {
+	message, err := io.ReadAll(c.errorStream)
+	if err != nil || len(message) == 0 {
+		return
+	}
+	c.remoteError.Store(fmt.Errorf("port-forward to %s: %s", c.address, message))
+	_ = c.dataStream.Reset()
+}
+
+func (c *portForwardConn) Read(b []byte) (int, error) {
+	n, err := c.dataStream.Read(b)
+	if err != nil && err != io.EOF {
+		if remoteError, ok := c.remoteError.Load().(error); ok {
+			return n, remoteError
+		}
+	}
+	return n, err
+}
+
+func (c *portForwardConn) Write(b []byte) (int, error) {
+	n, err := c.dataStream.Write(b)
+	if err != nil {
+		if remoteError, ok := c.remoteError.Load().(error); ok {
+			return n, remoteError
+		}
+	}
+	return n, err
+}
+
+// Close closes the data stream, and releases both streams. The underlying connection to the port-forward subresource
+// remains open, and is reused by subsequent dials.
+func (c *portForwardConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.dataStream.Close()
+		c.connection.RemoveStreams(c.dataStream, c.errorStream)
+	})
+	return err
+}
+
+func (c *portForwardConn) LocalAddr() net.Addr {
+	return c.address
+}
+
+func (c *portForwardConn) RemoteAddr() net.Addr {
+	return c.address
+}
+
+func (c *portForwardConn) SetDeadline(_ time.Time) error {
+	return nil
+}
+
+func (c *portForwardConn) SetReadDeadline(_ time.Time) error {
+	return nil
+}
+
+func (c *portForwardConn) SetWriteDeadline(_ time.Time) error {
+	return nil
+}
+
+// portForwardAddr implements [net.Addr] for port-forward connections. The address has the form
+// <namespace>/<pod>:<port>.
+type portForwardAddr string
+
+func (a portForwardAddr) Network() string {
+	return "portforward"
+}
+
+func (a portForwardAddr) String() string {
+	return string(a)
+}
+
+//#region Test isolation
+
+// portForwarderTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the portForwarder unit during tests
+type portForwarderTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+	// Opens a connection to the port-forward subresource of the specified pod. Points to dialPortForward.
+	DialPod func(namespace string, podName string) (httpstream.Connection, error)
+}
+
+//#endregion Test isolation
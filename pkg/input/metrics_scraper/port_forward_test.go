@@ -0,0 +1,254 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("input.metrics_scraper.portForwarder", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "kube-apiserver-1"
+		testAddress = "10.0.0.1:443"
+	)
+
+	var (
+		// Creates a portForwarder which dials fake connections, and records them, in order of creation, in the returned
+		// slice
+		newTestPortForwarder = func() (*portForwarder, *[]*fakeStreamConnection, *[]portForwardTarget) {
+			var connections []*fakeStreamConnection
+			var dialedTargets []portForwardTarget
+			forwarder := newPortForwarder(nil, time.Minute)
+			forwarder.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			forwarder.testIsolation.DialPod = func(namespace string, podName string) (httpstream.Connection, error) {
+				connection := newFakeStreamConnection()
+				connections = append(connections, connection)
+				dialedTargets = append(dialedTargets, portForwardTarget{namespace: namespace, podName: podName})
+				return connection, nil
+			}
+			return forwarder, &connections, &dialedTargets
+		}
+		testCtx = func() context.Context {
+			return withPortForwardTarget(context.Background(), testNs, testPodName)
+		}
+	)
+
+	Describe("DialContext", func() {
+		It("should fail, if the context does not specify a target pod", func() {
+			// Arrange
+			forwarder, _, _ := newTestPortForwarder()
+
+			// Act
+			_, err := forwarder.DialContext(context.Background(), "tcp", testAddress)
+
+			// Assert
+			Expect(err).To(MatchError(errNoPortForwardTarget))
+		})
+
+		It("should create an error stream and a data stream to the address port, on a connection to the target pod", func() {
+			// Arrange
+			forwarder, connections, dialedTargets := newTestPortForwarder()
+
+			// Act
+			conn, err := forwarder.DialContext(testCtx(), "tcp", testAddress)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(*dialedTargets).To(Equal([]portForwardTarget{{namespace: testNs, podName: testPodName}}))
+			Expect((*connections)[0].IdleTimeout).To(Equal(time.Minute))
+			streams, _ := (*connections)[0].GetStreams()
+			Expect(streams).To(HaveLen(2))
+			Expect(streams[0].Headers().Get(corev1.StreamType)).To(Equal(corev1.StreamTypeError))
+			Expect(streams[0].IsClosed.Load()).To(BeTrue())
+			Expect(streams[1].Headers().Get(corev1.StreamType)).To(Equal(corev1.StreamTypeData))
+			for _, stream := range streams {
+				Expect(stream.Headers().Get(corev1.PortHeader)).To(Equal("443"))
+				Expect(stream.Headers().Get(corev1.PortForwardRequestIDHeader)).To(Equal("0"))
+			}
+			Expect(conn.RemoteAddr().String()).To(Equal(testNs + "/" + testPodName + ":443"))
+		})
+
+		It("should carry the connection's traffic over the data stream", func() {
+			// Arrange
+			forwarder, connections, _ := newTestPortForwarder()
+			conn, err := forwarder.DialContext(testCtx(), "tcp", testAddress)
+			Expect(err).To(Succeed())
+			_, serverEnds := (*connections)[0].GetStreams()
+			received := make(chan string, 1)
+			go func() {
+				buffer := make([]byte, 5)
+				_, _ = io.ReadFull(serverEnds[1], buffer)
+				received <- string(buffer)
+			}()
+
+			// Act
+			_, err = conn.Write([]byte("hello"))
+
+			// Assert
+			Expect(err).To(Succeed())
+			Eventually(received).Should(Receive(Equal("hello")))
+		})
+
+		It("should reuse the connection to the same pod, with a new request ID", func() {
+			// Arrange
+			forwarder, connections, _ := newTestPortForwarder()
+			_, err := forwarder.DialContext(testCtx(), "tcp", testAddress)
+			Expect(err).To(Succeed())
+
+			// Act
+			_, err = forwarder.DialContext(testCtx(), "tcp", testAddress)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(*connections).To(HaveLen(1))
+			streams, _ := (*connections)[0].GetStreams()
+			Expect(streams).To(HaveLen(4))
+			Expect(streams[3].Headers().Get(corev1.PortForwardRequestIDHeader)).To(Equal("1"))
+			Expect(forwarder.Count()).To(Equal(1))
+		})
+
+		It("should use a separate connection for each pod", func() {
+			// Arrange
+			forwarder, connections, _ := newTestPortForwarder()
+			_, err := forwarder.DialContext(testCtx(), "tcp", testAddress)
+			Expect(err).To(Succeed())
+
+			// Act
+			otherCtx := withPortForwardTarget(context.Background(), testNs, "kube-apiserver-2")
+			_, err = forwarder.DialContext(otherCtx, "tcp", testAddress)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(*connections).To(HaveLen(2))
+			Expect(forwarder.Count()).To(Equal(2))
+		})
+
+		It("should open a new connection, if the pooled one was closed", func() {
+			// Arrange
+			forwarder, connections, _ := newTestPortForwarder()
+			_, err := forwarder.DialContext(testCtx(), "tcp", testAddress)
+			Expect(err).To(Succeed())
+			_ = (*connections)[0].Close()
+
+			// Act
+			_, err = forwarder.DialContext(testCtx(), "tcp", testAddress)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(*connections).To(HaveLen(2))
+			Expect(forwarder.Count()).To(Equal(1))
+		})
+
+		It("should close a connection and remove it from the pool, if creating streams on it fails", func() {
+			// Arrange
+			forwarder, connections, _ := newTestPortForwarder()
+			_, err := forwarder.DialContext(testCtx(), "tcp", testAddress)
+			Expect(err).To(Succeed())
+			(*connections)[0].CreateErr = errors.New("broken")
+
+			// Act
+			_, err = forwarder.DialContext(testCtx(), "tcp", testAddress)
+
+			// Assert
+			Expect(err).To(MatchError(ContainSubstring("broken")))
+			Expect(isConnectionClosed((*connections)[0])).To(BeTrue())
+			Expect(forwarder.Count()).To(Equal(0))
+		})
+
+		It("should fail, if dialing the pod fails", func() {
+			// Arrange
+			forwarder, _, _ := newTestPortForwarder()
+			forwarder.testIsolation.DialPod = func(_ string, _ string) (httpstream.Connection, error) {
+				return nil, errors.New("forbidden")
+			}
+
+			// Act
+			_, err := forwarder.DialContext(testCtx(), "tcp", testAddress)
+
+			// Assert
+			Expect(err).To(MatchError(ContainSubstring("forbidden")))
+			Expect(forwarder.Count()).To(Equal(0))
+		})
+
+		It("should close connections which have not been used for longer than the max idle time", func() {
+			// Arrange
+			forwarder, connections, _ := newTestPortForwarder()
+			_, err := forwarder.DialContext(testCtx(), "tcp", testAddress)
+			Expect(err).To(Succeed())
+			forwarder.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 2, 0)
+
+			// Act
+			otherCtx := withPortForwardTarget(context.Background(), testNs, "kube-apiserver-2")
+			_, err = forwarder.DialContext(otherCtx, "tcp", testAddress)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(isConnectionClosed((*connections)[0])).To(BeTrue())
+			Expect(forwarder.Count()).To(Equal(1))
+		})
+	})
+
+	Describe("portForwardConn", func() {
+		It("should fail reads with the error reported by the kube-apiserver on the error stream", func() {
+			// Arrange
+			forwarder, connections, _ := newTestPortForwarder()
+			conn, err := forwarder.DialContext(testCtx(), "tcp", testAddress)
+			Expect(err).To(Succeed())
+			_, serverEnds := (*connections)[0].GetStreams()
+
+			// Act
+			_, _ = serverEnds[0].Write([]byte("connection refused"))
+			_ = serverEnds[0].Close()
+			_, err = conn.Read(make([]byte, 1))
+
+			// Assert
+			Expect(err).To(MatchError(ContainSubstring("connection refused")))
+		})
+
+		It("should release both streams upon close, and keep the connection open", func() {
+			// Arrange
+			forwarder, connections, _ := newTestPortForwarder()
+			conn, err := forwarder.DialContext(testCtx(), "tcp", testAddress)
+			Expect(err).To(Succeed())
+
+			// Act
+			err = conn.Close()
+
+			// Assert
+			Expect(err).To(Succeed())
+			streams, _ := (*connections)[0].GetStreams()
+			Expect(streams[1].IsClosed.Load()).To(BeTrue())
+			Expect((*connections)[0].RemovedStreams).To(ConsistOf(streams[0], streams[1]))
+			Expect(isConnectionClosed((*connections)[0])).To(BeFalse())
+		})
+	})
+
+	Describe("Close", func() {
+		It("should close all pooled connections", func() {
+			// Arrange
+			forwarder, connections, _ := newTestPortForwarder()
+			_, err := forwarder.DialContext(testCtx(), "tcp", testAddress)
+			Expect(err).To(Succeed())
+
+			// Act
+			forwarder.Close()
+
+			// Assert
+			Expect(isConnectionClosed((*connections)[0])).To(BeTrue())
+			Expect(forwarder.Count()).To(Equal(0))
+		})
+	})
+})
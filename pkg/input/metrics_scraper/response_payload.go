@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// DefaultMaxResponseSize is the default limit on the size of a Kapi metrics response, after decompression. A Kapi
+	// response is normally well under 5MiB.
+	DefaultMaxResponseSize = 20 * 1024 * 1024
+
+	// Compression is only requested from targets whose uncompressed response is at least this large. Below that, the
+	// bandwidth saved does not justify the CPU cost of decompression.
+	minGzipPayloadSize = 32 * 1024
+	// Compression is only requested from targets where it reduces the response to less than this fraction of its size
+	maxGzipRatio = 0.8
+	// A target, for which compression was found not to be beneficial, is periodically probed with a compressed request
+	// again, in case its response has changed
+	gzipReprobePeriod = 10 * time.Minute
+
+	// DefaultReadBufferSize is the size of the buffer through which metrics responses are parsed, unless configured
+	// otherwise. It is also the minimum: the text format parser skips lines which do not fit in the buffer, and Kapi
+	// counter lines, with their many labels, are a few hundred bytes long.
+	DefaultReadBufferSize = 4 * 1024
+)
+
+// ResponseSettings tunes how the scrape clients request and read Kapi metrics responses. The zero value applies the
+// defaults.
+type ResponseSettings struct {
+	// DisableGzip, if true, keeps the clients from requesting compressed responses, regardless of the benefit of
+	// compression (see compressionAdvisor). On fast networks, decompression may cost more CPU than the bandwidth it saves
+	// is worth.
+	DisableGzip bool
+	// ReadBufferSize is the size, in bytes, of the buffer through which responses are parsed. A larger buffer takes
+	// fewer reads to consume a large response, at the cost of memory for each concurrent scrape. Zero means
+	// DefaultReadBufferSize. The caller is responsible for ensuring that it is not less than DefaultReadBufferSize.
+	ReadBufferSize int
+}
+
+// readBufferSize returns ReadBufferSize, or DefaultReadBufferSize, if it is zero
+func (s ResponseSettings) readBufferSize() int {
+	if s.ReadBufferSize == 0 {
+		return DefaultReadBufferSize
+	}
+	return s.ReadBufferSize
+}
+
+// errResponseTooLarge is the error reported when a metrics response exceeds the maximum response size
+var errResponseTooLarge = errors.New("the metrics response exceeds the maximum response size")
+
+var (
+	// Tracks the size of scrape responses, as transferred over the network
+	scrapeResponseBytes = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gardener_custom_metrics_scrape_response_bytes",
+			Help:    "The size of Kapi metrics responses, as transferred over the network, by content encoding",
+			Buckets: prometheus.ExponentialBuckets(4*1024, 4, 8),
+		},
+		[]string{"encoding"})
+	// Tracks the size of scrape responses, after decompression
+	scrapePayloadBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gardener_custom_metrics_scrape_payload_bytes",
+		Help:    "The size of Kapi metrics responses, after decompression",
+		Buckets: prometheus.ExponentialBuckets(4*1024, 4, 8),
+	})
+	// Counts the scrapes which failed, because the response exceeded the maximum response size
+	scrapeResponseTooLargeCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gardener_custom_metrics_scrape_response_too_large_total",
+		Help: "The number of Kapi metrics responses which were rejected, because they exceeded the maximum size",
+	})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(scrapeResponseBytes, scrapePayloadBytes, scrapeResponseTooLargeCount)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// maxSizeReader fails with errResponseTooLarge, once more than maxSize bytes are read through it. Unlike
+// [io.LimitedReader], it does not silently truncate the stream, which would result in a partial, yet seemingly valid,
+// metrics response.
+type maxSizeReader struct {
+	reader  io.Reader
+	maxSize int64
+	count   int64
+}
+
+func (r *maxSizeReader) Read(p []byte) (int, error) {
+	// Allow reading one byte past the limit, so a stream of exactly maxSize bytes can reach EOF without error
+	if remaining := r.maxSize + 1 - r.count; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	if r.count > r.maxSize {
+		return n, fmt.Errorf("%w of %d bytes", errResponseTooLarge, r.maxSize)
+	}
+	return n, err
+}
+
+// compressionAdvisorEntry records what is known about the benefit of compression for a single scrape URL
+type compressionAdvisorEntry struct {
+	useGzip bool
+	// When was useGzip last decided, based on a compressed response
+	decisionTime time.Time
+	lastUsed     time.Time
+}
+
+// compressionAdvisor decides, per scrape URL, whether to request a gzip compressed response. Compression is requested,
+// unless a previous compressed response from the same URL showed that it is not beneficial - the response is too small,
+// or does not compress well. Such URLs are periodically probed with a compressed request again.
+//
+// All public members are concurrency-safe.
+type compressionAdvisor struct {
+	entries map[string]*compressionAdvisorEntry
+	// Entries which are not used for this long are evicted
+	maxIdleTime time.Duration
+	// When did the last eviction pass take place
+	lastEvictionTime time.Time
+	lock             sync.Mutex
+
+	testIsolation compressionAdvisorTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// newCompressionAdvisor creates a compressionAdvisor which forgets URLs after they are left unused for maxIdleTime
+func newCompressionAdvisor(maxIdleTime time.Duration) *compressionAdvisor {
+	return &compressionAdvisor{
+		entries:       make(map[string]*compressionAdvisorEntry),
+		maxIdleTime:   maxIdleTime,
+		testIsolation: compressionAdvisorTestIsolation{TimeNow: time.Now},
+	}
+}
+
+// ShouldRequestGzip returns true if a compressed response should be requested from the specified URL
+func (ca *compressionAdvisor) ShouldRequestGzip(url string) bool {
+	now := ca.testIsolation.TimeNow()
+
+	ca.lock.Lock()
+	defer ca.lock.Unlock()
+
+	ca.evictIdleThreadUnsafe(now)
+	entry := ca.entries[url]
+	if entry == nil {
+		return true
+	}
+	entry.lastUsed = now
+	return entry.useGzip || now.Sub(entry.decisionTime) >= gzipReprobePeriod
+}
+
+// RecordResponse records the outcome of a scrape of the specified URL. The wireSize is the size of the response as
+// transferred over the network, and payloadSize - after decompression. Only compressed responses carry information
+// about the benefit of compression, so uncompressed ones leave the URL's record unchanged.
+func (ca *compressionAdvisor) RecordResponse(url string, isGzip bool, wireSize int64, payloadSize int64) {
+	now := ca.testIsolation.TimeNow()
+
+	ca.lock.Lock()
+	defer ca.lock.Unlock()
+
+	entry := ca.entries[url]
+	if entry == nil {
+		entry = &compressionAdvisorEntry{useGzip: true}
+		ca.entries[url] = entry
+	}
+	entry.lastUsed = now
+	if isGzip {
+		entry.useGzip = payloadSize >= minGzipPayloadSize && float64(wireSize) < float64(payloadSize)*maxGzipRatio
+		entry.decisionTime = now
+	}
+}
+
+// evictIdleThreadUnsafe removes entries which have not been used for longer than maxIdleTime. To keep the cost of
+// frequent calls low, a full pass is made no more than once per maxIdleTime.
+//
+// The caller must acquire the lock before calling this method.
+func (ca *compressionAdvisor) evictIdleThreadUnsafe(now time.Time) {
+	if now.Sub(ca.lastEvictionTime) < ca.maxIdleTime {
+		return
+	}
+	ca.lastEvictionTime = now
+
+	for url, entry := range ca.entries {
+		if now.Sub(entry.lastUsed) > ca.maxIdleTime {
+			delete(ca.entries, url)
+		}
+	}
+}
+
+//#region Test isolation
+
+// compressionAdvisorTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the compressionAdvisor unit during tests
+type compressionAdvisorTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+}
+
+//#endregion Test isolation
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("input.metrics_scraper.maxSizeReader", func() {
+	It("should read a stream which is exactly as large as the maximum size", func() {
+		// Arrange
+		reader := &maxSizeReader{reader: strings.NewReader("0123456789"), maxSize: 10}
+
+		// Act
+		content, err := io.ReadAll(reader)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(string(content)).To(Equal("0123456789"))
+	})
+
+	It("should fail, rather than truncate, a stream which is larger than the maximum size", func() {
+		// Arrange
+		reader := &maxSizeReader{reader: strings.NewReader("0123456789A"), maxSize: 10}
+
+		// Act
+		_, err := io.ReadAll(reader)
+
+		// Assert
+		Expect(err).To(MatchError(errResponseTooLarge))
+	})
+})
+
+var _ = Describe("input.metrics_scraper.compressionAdvisor", func() {
+	const testUrl = "https://kapi/metrics"
+
+	It("should request compression from unknown targets", func() {
+		// Arrange
+		advisor := newCompressionAdvisor(time.Minute)
+
+		// Act & Assert
+		Expect(advisor.ShouldRequestGzip(testUrl)).To(BeTrue())
+	})
+
+	DescribeTable("should decide based on the size and the compression ratio of the last compressed response",
+		func(wireSize int64, payloadSize int64, isExpectedToUseGzip bool) {
+			// Arrange
+			advisor := newCompressionAdvisor(time.Minute)
+
+			// Act
+			advisor.RecordResponse(testUrl, true, wireSize, payloadSize)
+
+			// Assert
+			Expect(advisor.ShouldRequestGzip(testUrl)).To(Equal(isExpectedToUseGzip))
+		},
+		Entry("large and well compressed", int64(100*1024), int64(1024*1024), true),
+		Entry("too small", int64(1024), int64(10*1024), false),
+		Entry("poorly compressed", int64(900*1024), int64(1024*1024), false),
+	)
+
+	It("should not change its decision based on uncompressed responses", func() {
+		// Arrange
+		advisor := newCompressionAdvisor(time.Minute)
+		advisor.RecordResponse(testUrl, true, 1024, 10*1024)
+
+		// Act
+		advisor.RecordResponse(testUrl, false, 1024*1024, 1024*1024)
+
+		// Assert
+		Expect(advisor.ShouldRequestGzip(testUrl)).To(BeFalse())
+	})
+
+	It("should probe a target with a compressed request again, once the reprobe period has passed", func() {
+		// Arrange
+		advisor := newCompressionAdvisor(time.Hour)
+		advisor.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+		advisor.RecordResponse(testUrl, true, 1024, 10*1024)
+
+		// Act
+		advisor.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 9, 0)
+		beforeReprobe := advisor.ShouldRequestGzip(testUrl)
+		advisor.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 10, 0)
+		afterReprobe := advisor.ShouldRequestGzip(testUrl)
+
+		// Assert
+		Expect(beforeReprobe).To(BeFalse())
+		Expect(afterReprobe).To(BeTrue())
+	})
+
+	It("should forget targets which were not scraped for longer than the max idle time", func() {
+		// Arrange
+		advisor := newCompressionAdvisor(time.Minute)
+		advisor.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+		advisor.RecordResponse(testUrl, true, 1024, 10*1024)
+
+		// Act
+		advisor.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 2, 0)
+		advisor.ShouldRequestGzip("https://other/metrics")
+
+		// Assert
+		Expect(advisor.entries).NotTo(HaveKey(testUrl))
+	})
+})
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Tracks the duration of successful scrapes, by shoot. The series of a shoot are removed once the scrape queue has no
+// targets left in the shoot's namespace. See forgetShootScrapeDurations.
+var scrapeDurationSeconds = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "gardener_custom_metrics_scrape_duration_seconds",
+		Help:    "The duration of successful Kapi metrics scrapes, by shoot namespace",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 10),
+	},
+	[]string{"namespace"})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(scrapeDurationSeconds)
+}
+
+// forgetShootScrapeDurations removes the scrape duration histogram of the shoot in the specified namespace
+func forgetShootScrapeDurations(namespace string) {
+	scrapeDurationSeconds.DeleteLabelValues(namespace)
+}
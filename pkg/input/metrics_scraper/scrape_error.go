@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// Counts failed scrapes, by the category of the failure
+var scrapeFailureCount = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "gardener_custom_metrics_scrape_failures_total",
+		Help: "The number of failed Kapi metrics scrapes, by category of the failure",
+	},
+	[]string{"category"})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(scrapeFailureCount)
+}
+
+// scrapeError is a scrape failure, classified in one of the input_data_registry.ScrapeErrorCategory categories
+type scrapeError struct {
+	category input_data_registry.ScrapeErrorCategory
+	err      error
+}
+
+// Error implements [error.Error]
+func (e *scrapeError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the error which caused the scrape failure
+func (e *scrapeError) Unwrap() error {
+	return e.err
+}
+
+// withCategory returns an error which wraps err, and classifies it in the specified category
+func withCategory(category input_data_registry.ScrapeErrorCategory, err error) error {
+	return &scrapeError{category: category, err: err}
+}
+
+// errorCategory returns the category of a scrape failure. Errors which were not classified where they originated are
+// classified by their cause: an exceeded deadline is a timeout, a network or system call error is a network failure,
+// and anything else falls in the ScrapeErrorOther category.
+func errorCategory(err error) input_data_registry.ScrapeErrorCategory {
+	var (
+		scrapeErr *scrapeError
+		netErr    net.Error
+		errno     syscall.Errno
+	)
+	switch {
+	case errors.As(err, &scrapeErr):
+		return scrapeErr.category
+	case isTimeoutError(err):
+		return input_data_registry.ScrapeErrorTimeout
+	case errors.As(err, &netErr), errors.As(err, &errno):
+		return input_data_registry.ScrapeErrorNetwork
+	default:
+		return input_data_registry.ScrapeErrorOther
+	}
+}
+
+// classifyRequestError returns the category of an error returned by the HTTP client, when sending a metrics request
+func classifyRequestError(err error) input_data_registry.ScrapeErrorCategory {
+	switch {
+	case isTimeoutError(err):
+		return input_data_registry.ScrapeErrorTimeout
+	case isTLSError(err):
+		return input_data_registry.ScrapeErrorTLS
+	default:
+		return input_data_registry.ScrapeErrorNetwork
+	}
+}
+
+// classifyResponseError returns the category of an error which occurred while reading and processing a metrics
+// response. Failures to read the response stream are network failures, or timeouts. Everything else means the
+// response itself could not be processed.
+func classifyResponseError(err error) input_data_registry.ScrapeErrorCategory {
+	var netErr net.Error
+	switch {
+	case isTimeoutError(err):
+		return input_data_registry.ScrapeErrorTimeout
+	case errors.As(err, &netErr):
+		return input_data_registry.ScrapeErrorNetwork
+	default:
+		return input_data_registry.ScrapeErrorParse
+	}
+}
+
+// classifyHTTPStatus returns the category of a metrics response which reports the specified, unsuccessful HTTP status
+func classifyHTTPStatus(statusCode int) input_data_registry.ScrapeErrorCategory {
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		return input_data_registry.ScrapeErrorAuth
+	}
+	return input_data_registry.ScrapeErrorOther
+}
+
+// isTimeoutError returns true if err reports an exceeded deadline
+func isTimeoutError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// isTLSError returns true if err reports a failed TLS handshake
+func isTLSError(err error) bool {
+	var (
+		verificationErr  *tls.CertificateVerificationError
+		recordHeaderErr  tls.RecordHeaderError
+		alertErr         tls.AlertError
+		unknownAuthority x509.UnknownAuthorityError
+		invalidCert      x509.CertificateInvalidError
+		hostnameErr      x509.HostnameError
+	)
+	return errors.As(err, &verificationErr) ||
+		errors.As(err, &recordHeaderErr) ||
+		errors.As(err, &alertErr) ||
+		errors.As(err, &unknownAuthority) ||
+		errors.As(err, &invalidCert) ||
+		errors.As(err, &hostnameErr)
+}
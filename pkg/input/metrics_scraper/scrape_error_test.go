@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+var _ = Describe("input.metrics_scraper scrape error categories", func() {
+	refusedErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+	DescribeTable("errorCategory",
+		func(err error, expected input_data_registry.ScrapeErrorCategory) {
+			Expect(errorCategory(err)).To(Equal(expected))
+		},
+		Entry("a classified error", fmt.Errorf("outer: %w", withCategory(input_data_registry.ScrapeErrorAuth,
+			errors.New("inner"))), input_data_registry.ScrapeErrorAuth),
+		Entry("an exceeded deadline", fmt.Errorf("outer: %w", context.DeadlineExceeded),
+			input_data_registry.ScrapeErrorTimeout),
+		Entry("a refused connection", refusedErr, input_data_registry.ScrapeErrorNetwork),
+		Entry("a bare system call error", syscall.ECONNRESET, input_data_registry.ScrapeErrorNetwork),
+		Entry("anything else", errors.New("my error"), input_data_registry.ScrapeErrorOther),
+	)
+
+	DescribeTable("classifyRequestError",
+		func(err error, expected input_data_registry.ScrapeErrorCategory) {
+			Expect(classifyRequestError(err)).To(Equal(expected))
+		},
+		Entry("an exceeded deadline", context.DeadlineExceeded, input_data_registry.ScrapeErrorTimeout),
+		Entry("an untrusted certificate", fmt.Errorf("outer: %w", x509.UnknownAuthorityError{}),
+			input_data_registry.ScrapeErrorTLS),
+		Entry("a certificate for another host", x509.HostnameError{Host: "my-host"}, input_data_registry.ScrapeErrorTLS),
+		Entry("a refused connection", refusedErr, input_data_registry.ScrapeErrorNetwork),
+		Entry("anything else", errors.New("my error"), input_data_registry.ScrapeErrorNetwork),
+	)
+
+	DescribeTable("classifyResponseError",
+		func(err error, expected input_data_registry.ScrapeErrorCategory) {
+			Expect(classifyResponseError(err)).To(Equal(expected))
+		},
+		Entry("an exceeded deadline", context.DeadlineExceeded, input_data_registry.ScrapeErrorTimeout),
+		Entry("a reset connection", &net.OpError{Op: "read", Err: syscall.ECONNRESET},
+			input_data_registry.ScrapeErrorNetwork),
+		Entry("a truncated response", io.ErrUnexpectedEOF, input_data_registry.ScrapeErrorParse),
+		Entry("an oversized response", errResponseTooLarge, input_data_registry.ScrapeErrorParse),
+	)
+
+	DescribeTable("classifyHTTPStatus",
+		func(statusCode int, expected input_data_registry.ScrapeErrorCategory) {
+			Expect(classifyHTTPStatus(statusCode)).To(Equal(expected))
+		},
+		Entry("unauthorized", 401, input_data_registry.ScrapeErrorAuth),
+		Entry("forbidden", 403, input_data_registry.ScrapeErrorAuth),
+		Entry("not found", 404, input_data_registry.ScrapeErrorOther),
+		Entry("server error", 500, input_data_registry.ScrapeErrorOther),
+	)
+})
@@ -5,8 +5,11 @@
 package metrics_scraper
 
 import (
-	"container/list"
+	"container/heap"
+	"context"
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"sync"
 	"time"
 
@@ -16,17 +19,32 @@ import (
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
 )
 
-// scrapeTarget identifies a pod in a [input_data_registry.InputDataRegistry] as target for metrics scraping
-type scrapeTarget struct {
-	Namespace string
-	PodName   string
+// maxShootLimitedSkipCount is how many targets of shoots which have reached their ShootScrapeLimits GetNext skips
+// over, in search of a target which can be scraped, before giving up
+const maxShootLimitedSkipCount = 100
+
+// lowPriorityFaultCount is the number of consecutive failed scrapes, after which a target is demoted to the low
+// priority lane of the scrape queue. A single failure is often transient, so it does not demote the target.
+// See lowPriorityFaultCountFor.
+const lowPriorityFaultCount = 2
+
+// lowPriorityFaultCountFor returns the number of consecutive failed scrapes, after which a target is demoted to the
+// low priority lane, given the category of the most recent failure. Rejected credentials, an untrusted certificate, or
+// a response which cannot be processed, are unlikely to go away on an immediate retry, so such a failure demotes the
+// target right away. Network failures and timeouts are often transient, and are subject to lowPriorityFaultCount.
+func lowPriorityFaultCountFor(category input_data_registry.ScrapeErrorCategory) int {
+	switch category {
+	case input_data_registry.ScrapeErrorAuth, input_data_registry.ScrapeErrorTLS, input_data_registry.ScrapeErrorParse:
+		return 1
+	default:
+		return lowPriorityFaultCount
+	}
 }
 
-// kapiEvent holds information pertaining to a Kapi update event, for the purpose of asynchronous event processing
-type kapiEvent struct {
+// scrapeTarget identifies a pod in a [input_data_registry.InputDataRegistry] as target for metrics scraping
+type scrapeTarget struct {
 	Namespace string
 	PodName   string
-	EventType input_data_registry.KapiEventType
 }
 
 type scrapeQueue interface {
@@ -34,15 +52,45 @@ type scrapeQueue interface {
 	// moment, it returns nil.
 	//
 	// Criteria to scrape a target (any of the following):
-	// - Scrape period interval elapsed since the last time the target was scraped
+	// - The target's scrape period elapsed since the last time the target was scraped
 	// - A scrape is required to maintain the queue's desired minimum scrape rate
+	//
+	// Targets of shoots which have reached their ShootScrapeLimits are skipped over, without losing their place in
+	// the queue. Targets in the low priority lane are only returned when no other target is due. Each target returned
+	// by GetNext must be passed to Release, once the caller is done with it.
 	GetNext() *scrapeTarget
+	// Release notifies the queue that the scrape of a target, previously returned by GetNext, is over. Must be called
+	// for every target returned by GetNext, whether the target was actually scraped or not. Based on the outcome of
+	// the scrape, as recorded in the registry, the target is moved between the regular and the low priority lane.
+	Release(target *scrapeTarget)
 	// Count returns the number of targets in the queue
 	Count() int
 	// DueCount counts the targets for which a scrape would be due (including overdue), at the specified time, per
-	// current state of the queue.
+	// current state of the queue. Targets in the low priority lane are not counted.
 	DueCount(dueAtTime time.Time, excludeUnscraped bool) int
-	// Close terminates this scrapeQueueImpl's subscription to [input_data_registry.InputDataRegistry] events.
+	// SetScrapePeriod changes the interval at which each target becomes due for scraping, except for targets which have
+	// their own scrape period (see [input_data_registry.KapiData.ScrapePeriod]). Takes effect immediately.
+	SetScrapePeriod(scrapePeriod time.Duration)
+	// SetBackgroundScrapePeriod enables background scraping: the targets of shoots which are not marked as consumed
+	// (see SetNamespaceConsumed) are scraped at the specified period, or at their own scrape period, whichever is
+	// longer. Zero disables background scraping. Takes effect immediately.
+	SetBackgroundScrapePeriod(backgroundScrapePeriod time.Duration)
+	// SetNamespaceConsumed marks the shoot in the specified namespace as having consumers of its metrics, or not. With
+	// background scraping enabled, targets of consumed shoots are scraped at the regular rate. Marking a shoot as
+	// consumed takes effect immediately, so its targets become due once a regular scrape period has passed since their
+	// last scrape.
+	SetNamespaceConsumed(namespace string, isConsumed bool)
+	// ExpediteNamespace makes the targets of the shoot in the specified namespace due for scraping right away,
+	// regardless of when they were last scraped, and moves those in the low priority lane back to the regular lane.
+	// The targets resume their regular schedule after the next scrape. Returns the number of targets affected.
+	ExpediteNamespace(namespace string) int
+	// Open subscribes the queue to [input_data_registry.InputDataRegistry] events, which populate it with targets. The
+	// subscription lasts until ctx is cancelled, or until the queue is closed, whichever comes first. Calls after the
+	// first one, and calls after Close, have no effect.
+	Open(ctx context.Context)
+	// Close terminates this scrapeQueueImpl's subscription to [input_data_registry.InputDataRegistry] events. The
+	// subscription is also terminated when the context passed to Open is cancelled, whichever comes first.
+	// Calls after the first one have no effect. A queue which was never opened is just marked as closed.
 	//
 	// Remarks:
 	// The queue does not respond to events which occur after Close() returns. However, Close() may return while a past
@@ -54,48 +102,132 @@ type scrapeQueue interface {
 // scrapeQueue prescribes an order and timing for scraping the pods in a [input_data_registry.InputDataRegistry].
 // It tracks the state of the [input_data_registry.InputDataRegistry] by subscribing for events.
 //
-// Scraping is governed by a configurable scraping period. It progresses at a default rate of ScrapePeriod/TargetCount.
-// If for some reason scraping is delayed from that default schedule, it temporarily switches to a higher rate, until
-// it catches up.
+// Scraping is governed by a configurable scraping period, which individual targets may override. Targets are scraped
+// in the order of the time at which each target becomes due for scraping. Scraping progresses at a default rate equal
+// to the sum of 1/ScrapePeriod across targets (TargetCount/ScrapePeriod, if no target overrides the period). If for
+// some reason scraping is delayed from that default schedule, it temporarily switches to a higher rate, until it
+// catches up.
+//
+// Targets whose Kapis failed lowPriorityFaultCount consecutive scrapes are demoted to a low priority lane, so a few
+// slow or unresponsive Kapis do not hold up the workers while healthy targets miss their period. Low priority targets
+// keep their due times, but are only scraped with leftover capacity - when no regular target is due. A demoted target
+// returns to the regular lane after a successful scrape.
+//
+// A target which has never been scraped becomes due at a point within one scrape period after it was added to the
+// queue. The point is derived from a hash of the target's identity, so the first scrapes of targets added at the same
+// time, e.g. all targets upon process start, are spread uniformly across the scrape period, instead of causing a
+// synchronized burst of scrapes. On top of that, [ShootScrapeLimits.MaxFirstScrapeConcurrency] caps the first scrapes
+// in progress per shoot, so a shoot whose Kapis all get replaced at once, e.g. during a seed upgrade, does not receive
+// its first scrapes as a burst, even if their spread due times happen to fall close together.
+//
+// Remarks:
+// To keep the cost of queue operations logarithmic in the number of targets, the queue caches the due time of each
+// target, and splits targets across two heaps, ordered by due time: one for targets which are due as of a point in
+// time called the due watermark, and one for targets which are not. DueCount moves the watermark forward, and with it,
+// the targets which become due. The count of due targets is then maintained incrementally. Low priority targets are
+// kept in a third heap, ordered by due time alone.
 //
 // Public members are concurrency-safe.
 type scrapeQueueImpl struct {
-	targets     *list.List                            // That's the queue proper, reflecting the scrape order
-	registry    input_data_registry.InputDataRegistry // scrapeQueueImpl does not cache pod data. It fetches it from the registry when needed.
+	registry    input_data_registry.InputDataRegistry // scrapeQueueImpl fetches pod data from the registry when a target is added or updated
 	pacemaker   pacemaker                             // Determines the scrape timing, based on rate/burst settings
 	kapiWatcher input_data_registry.KapiWatcher       // The event handler subscribed for data events
 	log         logr.Logger
 
-	// Synchronizes access to targets. The kapiWatcher should not acquire this lock during its invocation (see
-	// [input_data_registry.InputDataRegistry.AddKapiWatcher]).
+	// Synchronizes access to all fields below
 	targetLock sync.Mutex
 
-	// Mediates Kapi update events, for delayed asynchronous processing, preserving order.
-	updateQueue     chan *kapiEvent
-	updateQueueLock sync.Mutex
-
-	// How long before all targets are scraped, and we get back to scraping the same target again
+	// That's the queue proper. Each target is in exactly one of the three heaps.
+	targets            map[scrapeTarget]*scheduledTarget // All targets, indexed by identity
+	dueTargets         targetHeap                        // Regular targets due as of dueWatermark
+	pendingTargets     targetHeap                        // Regular targets not due as of dueWatermark
+	lowPriorityTargets targetHeap                        // Targets demoted to the low priority lane
+	dueWatermark       time.Time
+	// How many of the targets in dueTargets have never been scraped
+	dueUnscrapedCount int
+	// Assigned to targets as they get scheduled. Orders targets with the same due time, in the order of scheduling.
+	nextSequence uint64
+	// Limits the scrape load on individual shoots. Nil if there are no such limits.
+	shootLimiter *shootLimiter
+	// The targets whose first scrape is in progress. Only maintained if shootLimiter is not nil. See
+	// ShootScrapeLimits.MaxFirstScrapeConcurrency.
+	firstScrapes map[scrapeTarget]bool
+
+	// How long before all targets are scraped, and we get back to scraping the same target again. Applies to targets
+	// which do not override the scrape period.
 	scrapePeriod time.Duration
+	// The targets which use scrapePeriod are counted in defaultPeriodCount. The others are counted in
+	// overriddenPeriodCounts, by their respective scrape periods. Used to calculate the rate at which scraping progresses.
+	defaultPeriodCount     int
+	overriddenPeriodCounts map[time.Duration]int
+	// The number of targets in each namespace
+	namespaceTargetCounts map[string]int
+
+	// If not zero, targets of shoots which are not in consumedNamespaces use this scrape period, or their own, whichever
+	// is longer. See SetBackgroundScrapePeriod.
+	backgroundScrapePeriod time.Duration
+	// The namespaces of the shoots which have consumers of their metrics. See SetNamespaceConsumed.
+	consumedNamespaces map[string]bool
+
+	// Synchronizes Close with the subscription to registry events, and protects the fields below
+	closeLock sync.Mutex
+	isOpen    bool
+	isClosed  bool
+	// Releases the context callback which closes the queue upon context cancellation. Nil until the queue is opened.
+	stopCloseOnCancel func() bool
 
 	testIsolation scrapeQueueTestIsolation // Provides indirections necessary to isolate the unit during tests
 }
 
-// getNextCandidateThreadUnsafe returns the next target from the head of the queue, plus its respective Kapi from the
-// registry. It returns (nil, nil) if there are no suitable targets on the queue. If the target in front of queue is
-// missing from the registry it removes it from the queue and proceeds to try the next target.
+// scheduledTarget is the queue's record of a single target
+type scheduledTarget struct {
+	target scrapeTarget
+	// The last time the target was scraped. Zero, if the target has never been scraped.
+	lastScrapeTime time.Time
+	// The time at which the target was added to the queue
+	addTime time.Time
+	// The target's own scrape period (see [input_data_registry.KapiData.ScrapePeriod]). Zero, if the target uses the
+	// queue's scrape period.
+	scrapePeriod time.Duration
+	// True if the target is scraped at the background scrape period. See scrapeQueueImpl.backgroundScrapePeriod.
+	isBackground bool
+	// The time at which the target becomes due for scraping
+	dueTime time.Time
+	// Orders targets with the same due time. See scrapeQueueImpl.nextSequence.
+	sequence uint64
+	// The position of the target in its heap, as maintained by [container/heap]
+	heapIndex int
+	// True if the target is in scrapeQueueImpl.dueTargets, false if in scrapeQueueImpl.pendingTargets, or in
+	// scrapeQueueImpl.lowPriorityTargets
+	isDue bool
+	// True if the target is in scrapeQueueImpl.lowPriorityTargets. See lowPriorityFaultCount.
+	isLowPriority bool
+	// If not zero, the target is due at this time, instead of at the time determined by its scrape schedule. Cleared
+	// once the target is scraped. See scrapeQueue.ExpediteNamespace.
+	expediteTime time.Time
+}
+
+// getNextCandidateThreadUnsafe returns the next target from the head of the regular lane, plus its respective Kapi
+// from the registry. It returns (nil, nil) if there are no suitable targets in the lane. If the target in front of the
+// lane is missing from the registry it removes it from the queue and proceeds to try the next target.
 //
 // The caller must acquire the targetLock before calling this method.
 func (q *scrapeQueueImpl) getNextCandidateThreadUnsafe(
-	log logr.Logger) (currentTarget *scrapeTarget, kapi *input_data_registry.KapiData) {
+	log logr.Logger) (currentTarget *scheduledTarget, kapi *input_data_registry.KapiData) {
 
 	for {
-		if q.targets.Len() == 0 {
+		// All due targets are due before all pending targets, so the head of the queue is the head of dueTargets
+		switch {
+		case q.dueTargets.Len() > 0:
+			currentTarget = q.dueTargets[0]
+		case q.pendingTargets.Len() > 0:
+			currentTarget = q.pendingTargets[0]
+		default:
 			log.V(app.VerbosityVerbose).Info("Queue already empty.")
 			return nil, nil
 		}
 
-		currentTarget = q.targets.Front().Value.(*scrapeTarget)
-		kapi = q.registry.GetKapiData(currentTarget.Namespace, currentTarget.PodName)
+		kapi = q.registry.GetKapiData(currentTarget.target.Namespace, currentTarget.target.PodName)
 		if kapi != nil {
 			// We have our target and kapi
 			return currentTarget, kapi
@@ -103,30 +235,88 @@ func (q *scrapeQueueImpl) getNextCandidateThreadUnsafe(
 
 		// Target was removed from the registry, but the remove notification has not yet been acted upon. Remove from
 		// queue and continue with next target on the queue.
-		log.WithValues("namespace", currentTarget.Namespace, "pod", currentTarget.PodName).
+		log.WithValues("namespace", currentTarget.target.Namespace, "pod", currentTarget.target.PodName).
 			V(app.VerbosityInfo).Info("The target is in the scrape queue but missing from the registry.")
-		q.targets.Remove(q.targets.Front())
+		q.removeThreadUnsafe(currentTarget)
 	}
 }
 
+// getLowPriorityCandidateThreadUnsafe returns the target at the head of the low priority lane, or nil if the lane is
+// empty, or the target's shoot has reached its scrape limits. Like getNextCandidateThreadUnsafe, it removes targets
+// which are missing from the registry.
+//
+// The caller must acquire the targetLock before calling this method.
+func (q *scrapeQueueImpl) getLowPriorityCandidateThreadUnsafe(log logr.Logger, now time.Time) *scheduledTarget {
+	for q.lowPriorityTargets.Len() > 0 {
+		st := q.lowPriorityTargets[0]
+		if q.registry.GetKapiData(st.target.Namespace, st.target.PodName) == nil {
+			log.WithValues("namespace", st.target.Namespace, "pod", st.target.PodName).
+				V(app.VerbosityInfo).Info("The target is in the scrape queue but missing from the registry.")
+			q.removeThreadUnsafe(st)
+			continue
+		}
+		if q.shootLimiter != nil && !q.shootLimiter.IsAvailable(st.target.Namespace, now, st.lastScrapeTime.IsZero()) {
+			return nil
+		}
+		return st
+	}
+	return nil
+}
+
 func (q *scrapeQueueImpl) GetNext() *scrapeTarget {
 	log := q.log.WithValues("op", "GetNext")
 	q.targetLock.Lock()
 	defer q.targetLock.Unlock()
 
-	currentTarget, kapi := q.getNextCandidateThreadUnsafe(log)
+	now := q.testIsolation.TimeNow()
+
+	// Targets of shoots which have reached their scrape limits are set aside while looking for a candidate, and are
+	// put back afterwards, in their original place
+	var setAside []*scheduledTarget
+	defer func() {
+		for _, st := range setAside {
+			q.restoreThreadUnsafe(st)
+		}
+	}()
+
+	var currentTarget *scheduledTarget
+	for {
+		currentTarget, _ = q.getNextCandidateThreadUnsafe(log)
+		if currentTarget == nil {
+			break
+		}
+		if q.shootLimiter == nil ||
+			q.shootLimiter.IsAvailable(currentTarget.target.Namespace, now, currentTarget.lastScrapeTime.IsZero()) {
+			break
+		}
+		if len(setAside) >= maxShootLimitedSkipCount {
+			log.V(app.VerbosityVerbose).Info("Too many targets of shoots at their scrape limits.")
+			currentTarget = nil
+			break
+		}
+		q.unscheduleThreadUnsafe(currentTarget)
+		setAside = append(setAside, currentTarget)
+	}
+
+	// The low priority lane only gets the capacity which no regular target is due to use
+	if currentTarget == nil || now.Before(currentTarget.dueTime) {
+		lowPriorityTarget := q.getLowPriorityCandidateThreadUnsafe(log, now)
+		if lowPriorityTarget != nil && (currentTarget == nil || !now.Before(lowPriorityTarget.dueTime)) {
+			currentTarget = lowPriorityTarget
+		}
+	}
 	if currentTarget == nil {
 		return nil
 	}
-	log = log.WithValues("namespace", currentTarget.Namespace, "pod", currentTarget.PodName)
 
 	// Act based on time
-	lastScrapeTime := kapi.LastMetricsScrapeTime
-	nextScrapeTime := lastScrapeTime.Add(q.scrapePeriod)
-	now := q.testIsolation.TimeNow()
-	eagerToProcess := !now.Before(nextScrapeTime) // If it's due time, or past due time, we're eager to scrape
-	log = log.WithValues("namespace", currentTarget.Namespace, "pod", currentTarget.PodName)
-	log.V(app.VerbosityVerbose).Info("Candidate target selected.", "lastScrape", lastScrapeTime, "eager", eagerToProcess, "now", now)
+	eagerToProcess := !now.Before(currentTarget.dueTime) // If it's due time, or past due time, we're eager to scrape
+	log = log.WithValues("namespace", currentTarget.target.Namespace, "pod", currentTarget.target.PodName)
+	log.V(app.VerbosityVerbose).Info("Candidate target selected.",
+		"lastScrape", currentTarget.lastScrapeTime,
+		"eager", eagerToProcess,
+		"lowPriority", currentTarget.isLowPriority,
+		"now", now)
 
 	if !q.pacemaker.GetScrapePermission(eagerToProcess) {
 		log.V(app.VerbosityVerbose).Info("Refused by pacemaker.")
@@ -134,22 +324,102 @@ func (q *scrapeQueueImpl) GetNext() *scrapeTarget {
 	}
 
 	// It's settled: the target will be scraped now
-	q.registry.SetKapiLastScrapeTime(currentTarget.Namespace, currentTarget.PodName, now)
+	if q.shootLimiter != nil {
+		isFirstScrape := currentTarget.lastScrapeTime.IsZero()
+		q.shootLimiter.Acquire(currentTarget.target.Namespace, now, isFirstScrape)
+		if isFirstScrape {
+			q.firstScrapes[currentTarget.target] = true
+		}
+	}
+	q.registry.SetKapiLastScrapeTime(currentTarget.target.Namespace, currentTarget.target.PodName, now)
+	q.unscheduleThreadUnsafe(currentTarget)
+	currentTarget.lastScrapeTime = now
+	currentTarget.expediteTime = time.Time{}
+	q.scheduleThreadUnsafe(currentTarget)
 	log.V(app.VerbosityVerbose).Info("Target rescheduled.")
-	q.targets.MoveToBack(q.targets.Front())
-	return currentTarget
+	result := currentTarget.target
+	return &result
+}
+
+// Release implements [scrapeQueue.Release].
+func (q *scrapeQueueImpl) Release(target *scrapeTarget) {
+	kapi := q.registry.GetKapiData(target.Namespace, target.PodName)
+
+	q.targetLock.Lock()
+	defer q.targetLock.Unlock()
+
+	if q.shootLimiter != nil {
+		isFirstScrape := q.firstScrapes[*target]
+		delete(q.firstScrapes, *target)
+		q.shootLimiter.Release(target.Namespace, q.testIsolation.TimeNow(), isFirstScrape)
+	}
+
+	st, ok := q.targets[*target]
+	if !ok || kapi == nil {
+		return
+	}
+	isLowPriority := kapi.FaultCount >= lowPriorityFaultCountFor(kapi.LastFaultCategory)
+	if isLowPriority != st.isLowPriority {
+		q.unscheduleThreadUnsafe(st)
+		st.isLowPriority = isLowPriority
+		q.scheduleThreadUnsafe(st)
+		q.log.V(app.VerbosityVerbose).Info("Target moved to another lane",
+			"namespace", target.Namespace,
+			"pod", target.PodName,
+			"lowPriority", isLowPriority,
+			"faultCount", kapi.FaultCount,
+			"faultCategory", kapi.LastFaultCategory)
+	}
 }
 
 // onKapiUpdated responds to [input_data_registry.InputDataSource] events, updating the target list and background
 // scrape rate
 func (q *scrapeQueueImpl) onKapiUpdated(shootKapi input_data_registry.ShootKapi, eventType input_data_registry.KapiEventType) {
-	q.updateQueueLock.Lock()
-	defer q.updateQueueLock.Unlock()
+	namespace, podName := shootKapi.ShootNamespace(), shootKapi.PodName()
+	log := q.log.WithValues("op", "onKapiUpdated", "namespace", namespace, "pod", podName)
+
+	q.targetLock.Lock()
+	defer q.targetLock.Unlock()
 
-	// Queue the data, so it can be asynchronously used by the goroutine below. See [input_data_registry.KapiWatcher].
-	if q.updateQueue != nil {
-		q.updateQueue <- &kapiEvent{shootKapi.ShootNamespace(), shootKapi.PodName(), eventType}
+	target := scrapeTarget{Namespace: namespace, PodName: podName}
+	switch eventType {
+	case input_data_registry.KapiEventCreate:
+		if _, ok := q.targets[target]; ok {
+			break
+		}
+		st := &scheduledTarget{
+			target:       target,
+			addTime:      q.testIsolation.TimeNow(),
+			isBackground: q.isBackgroundNamespaceThreadUnsafe(namespace),
+		}
+		// The Kapi may have been scraped before, e.g. by a queue which preceded this one
+		if kapi := q.registry.GetKapiData(namespace, podName); kapi != nil {
+			st.lastScrapeTime = kapi.LastMetricsScrapeTime
+			st.scrapePeriod = kapi.ScrapePeriod
+			st.isLowPriority = kapi.FaultCount >= lowPriorityFaultCountFor(kapi.LastFaultCategory)
+		}
+		q.addThreadUnsafe(st)
+		log.V(app.VerbosityVerbose).Info("Target added")
+	case input_data_registry.KapiEventDelete:
+		if st, ok := q.targets[target]; ok {
+			q.removeThreadUnsafe(st)
+			if q.namespaceTargetCounts[namespace] == 0 {
+				forgetShootScrapeDurations(namespace)
+			}
+		}
+	case input_data_registry.KapiEventUpdate:
+		// The target's scrape period changed, and with it - its due time
+		st, ok := q.targets[target]
+		kapi := q.registry.GetKapiData(namespace, podName)
+		if ok && kapi != nil {
+			q.removeThreadUnsafe(st)
+			st.scrapePeriod = kapi.ScrapePeriod
+			q.addThreadUnsafe(st)
+			log.V(app.VerbosityVerbose).Info("Target rescheduled", "scrapePeriod", q.targetScrapePeriod(st))
+		}
 	}
+
+	q.updateRateThreadUnsafe(log)
 }
 
 // Count returns the number of targets in the queue
@@ -157,99 +427,401 @@ func (q *scrapeQueueImpl) Count() int {
 	q.targetLock.Lock()
 	defer q.targetLock.Unlock()
 
-	return q.targets.Len()
+	return len(q.targets)
 }
 
+// DueCount implements [scrapeQueue.DueCount]. Targets which were removed from the registry are counted, until the
+// respective removal notification is processed.
+//
+// Counting at a time no earlier than the time of the previous call has logarithmic amortised cost. Counting at an
+// earlier time has cost proportional to the result.
 func (q *scrapeQueueImpl) DueCount(dueAtTime time.Time, excludeUnscraped bool) int {
-	// Targets become due for scraping at the moment when one scrape period elapses from their last scrape
-	lastScrapeCutoffTime := dueAtTime.Add(-q.scrapePeriod)
 	q.targetLock.Lock()
 	defer q.targetLock.Unlock()
-	count := 0
 
-	for element := q.targets.Front(); element != nil; element = element.Next() {
-		target := element.Value.(*scrapeTarget)
-		kapi := q.registry.GetKapiData(target.Namespace, target.PodName)
-		if kapi == nil {
-			continue // Was removed from the registry, but the removal notification not processed yet. Act as if removed.
-		}
+	if dueAtTime.Before(q.dueWatermark) {
+		return q.dueTargets.countDue(0, dueAtTime, excludeUnscraped)
+	}
+
+	q.advanceDueWatermarkThreadUnsafe(dueAtTime)
+	if excludeUnscraped {
+		return q.dueTargets.Len() - q.dueUnscrapedCount
+	}
+	return q.dueTargets.Len()
+}
+
+func (q *scrapeQueueImpl) SetScrapePeriod(scrapePeriod time.Duration) {
+	q.targetLock.Lock()
+	defer q.targetLock.Unlock()
+
+	q.scrapePeriod = scrapePeriod
+
+	// Due times of targets which use the global period changed relative to the ones which don't. Reschedule all targets,
+	// preserving the relative order of targets with the same due time.
+	all := make([]*scheduledTarget, 0, len(q.targets))
+	all = append(all, q.dueTargets...)
+	all = append(all, q.pendingTargets...)
+	all = append(all, q.lowPriorityTargets...)
+	sort.Slice(all, func(i, j int) bool { return all[i].sequence < all[j].sequence })
+	q.dueTargets, q.pendingTargets, q.lowPriorityTargets, q.dueUnscrapedCount = nil, nil, nil, 0
+	for _, st := range all {
+		q.scheduleThreadUnsafe(st)
+	}
+
+	q.updateRateThreadUnsafe(q.log.WithValues("op", "SetScrapePeriod"))
+}
+
+func (q *scrapeQueueImpl) SetBackgroundScrapePeriod(backgroundScrapePeriod time.Duration) {
+	q.targetLock.Lock()
+	defer q.targetLock.Unlock()
+
+	if q.backgroundScrapePeriod == backgroundScrapePeriod {
+		return
+	}
+
+	// The period of background targets is counted in overriddenPeriodCounts, so targets are removed before the change,
+	// and re-added after it, preserving the relative order of targets with the same due time
+	all := make([]*scheduledTarget, 0, len(q.targets))
+	for _, st := range q.targets {
+		all = append(all, st)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].sequence < all[j].sequence })
+	for _, st := range all {
+		q.removeThreadUnsafe(st)
+	}
+	q.backgroundScrapePeriod = backgroundScrapePeriod
+	for _, st := range all {
+		st.isBackground = q.isBackgroundNamespaceThreadUnsafe(st.target.Namespace)
+		q.addThreadUnsafe(st)
+	}
+
+	q.updateRateThreadUnsafe(q.log.WithValues("op", "SetBackgroundScrapePeriod"))
+}
+
+func (q *scrapeQueueImpl) SetNamespaceConsumed(namespace string, isConsumed bool) {
+	q.targetLock.Lock()
+	defer q.targetLock.Unlock()
+
+	if q.consumedNamespaces[namespace] == isConsumed {
+		return
+	}
+	if isConsumed {
+		q.consumedNamespaces[namespace] = true
+	} else {
+		delete(q.consumedNamespaces, namespace)
+	}
+	if q.backgroundScrapePeriod == 0 {
+		return
+	}
 
-		if kapi.LastMetricsScrapeTime.After(lastScrapeCutoffTime) {
-			return count
+	// Shoots have few Kapis, and their consumers come and go rarely, so a linear search is acceptable here
+	var rescheduled []*scheduledTarget
+	for _, st := range q.targets {
+		if st.target.Namespace == namespace {
+			rescheduled = append(rescheduled, st)
 		}
+	}
+	sort.Slice(rescheduled, func(i, j int) bool { return rescheduled[i].sequence < rescheduled[j].sequence })
+	for _, st := range rescheduled {
+		q.removeThreadUnsafe(st)
+		st.isBackground = !isConsumed
+		q.addThreadUnsafe(st)
+	}
 
-		if !excludeUnscraped || !kapi.LastMetricsScrapeTime.IsZero() {
-			count++
+	log := q.log.WithValues("op", "SetNamespaceConsumed", "namespace", namespace)
+	log.V(app.VerbosityVerbose).Info("Targets rescheduled", "isConsumed", isConsumed, "count", len(rescheduled))
+	q.updateRateThreadUnsafe(log)
+}
+
+// ExpediteNamespace implements [scrapeQueue.ExpediteNamespace].
+func (q *scrapeQueueImpl) ExpediteNamespace(namespace string) int {
+	q.targetLock.Lock()
+	defer q.targetLock.Unlock()
+
+	now := q.testIsolation.TimeNow()
+	var expedited []*scheduledTarget
+	for _, st := range q.targets {
+		if st.target.Namespace == namespace {
+			expedited = append(expedited, st)
 		}
 	}
+	sort.Slice(expedited, func(i, j int) bool { return expedited[i].sequence < expedited[j].sequence })
+	for _, st := range expedited {
+		q.unscheduleThreadUnsafe(st)
+		st.isLowPriority = false
+		st.expediteTime = now
+		q.scheduleThreadUnsafe(st)
+	}
 
-	return count
+	q.log.V(app.VerbosityInfo).Info("Targets expedited", "namespace", namespace, "count", len(expedited))
+	return len(expedited)
 }
 
+// Open implements [scrapeQueue.Open]
+func (q *scrapeQueueImpl) Open(ctx context.Context) {
+	// Hold the close lock, so a context which is already cancelled can't close the queue before it is subscribed
+	q.closeLock.Lock()
+	defer q.closeLock.Unlock()
+
+	if q.isOpen || q.isClosed {
+		return
+	}
+	q.isOpen = true
+	q.registry.AddKapiWatcher(&q.kapiWatcher, true)
+	q.stopCloseOnCancel = context.AfterFunc(ctx, func() { _ = q.Close() })
+}
+
+// Close implements [scrapeQueue.Close]
 func (q *scrapeQueueImpl) Close() (err error) {
+	q.closeLock.Lock()
+	defer q.closeLock.Unlock()
+
+	if q.isClosed {
+		return nil
+	}
+	q.isClosed = true
+	if !q.isOpen {
+		return nil
+	}
+	q.stopCloseOnCancel()
 	if !q.registry.RemoveKapiWatcher(&q.kapiWatcher) { // Must pass the same address as when adding
 		err = fmt.Errorf("close scrape queue: remove data watcher: the queue was not registered as watcher")
 	}
+	return
+}
 
-	q.updateQueueLock.Lock()
-	defer q.updateQueueLock.Unlock()
-	if q.updateQueue != nil {
-		close(q.updateQueue)
-		q.updateQueue = nil
+// updateRateThreadUnsafe adjusts the pacemaker rate to the current targets and their scrape periods.
+//
+// The caller must acquire the targetLock before calling this method.
+func (q *scrapeQueueImpl) updateRateThreadUnsafe(log logr.Logger) {
+	targetCount := len(q.targets)
+	rate := float64(q.defaultPeriodCount) / q.scrapePeriod.Seconds()
+	for scrapePeriod, count := range q.overriddenPeriodCounts {
+		rate += float64(count) / scrapePeriod.Seconds()
 	}
-	return
+	log.V(app.VerbosityVerbose).Info("New target count", "count", targetCount, "rate", rate)
+	// Aim for even temporal distribution of scrapes. Do not track more than targetCount delayed scrapes. targetCount+1
+	// would track a second delayed scrape for a target for which we already created rate debt, so don't do that.
+	q.pacemaker.UpdateRate(rate, targetCount)
 }
 
-// processKapiEvents executes all of a scrapeQueueImpl's ongoing activities. It only returns after all such activities have stopped.
+// targetScrapePeriod returns the scrape period which applies to the specified target.
 //
-// It acts on Kapi update event asynchronously, so the event handler (onKapiUpdated) can return without
-// directly acquiring the scrapeQueueImpl.targetLock.
+// The caller must acquire the targetLock before calling this method.
+func (q *scrapeQueueImpl) targetScrapePeriod(st *scheduledTarget) time.Duration {
+	if overriddenPeriod := q.overriddenScrapePeriod(st); overriddenPeriod > 0 {
+		return overriddenPeriod
+	}
+	return q.scrapePeriod
+}
+
+// overriddenScrapePeriod returns the scrape period which the specified target uses instead of the queue's scrape
+// period, or zero if it uses the queue's scrape period. Only changes while the target is out of the queue, so it also
+// serves to count the target in overriddenPeriodCounts.
 //
-// See scrapeQueueImpl.targetLock.
-func (q *scrapeQueueImpl) processKapiEvents() {
-	q.updateQueueLock.Lock()
-	queue := q.updateQueue
-	q.updateQueueLock.Unlock()
+// The caller must acquire the targetLock before calling this method.
+func (q *scrapeQueueImpl) overriddenScrapePeriod(st *scheduledTarget) time.Duration {
+	if st.isBackground {
+		return max(st.scrapePeriod, q.backgroundScrapePeriod)
+	}
+	return st.scrapePeriod
+}
 
-	if queue == nil {
-		return
+// isBackgroundNamespaceThreadUnsafe returns true if the targets in the specified namespace are scraped at the
+// background scrape period. See SetBackgroundScrapePeriod.
+//
+// The caller must acquire the targetLock before calling this method.
+func (q *scrapeQueueImpl) isBackgroundNamespaceThreadUnsafe(namespace string) bool {
+	return q.backgroundScrapePeriod > 0 && !q.consumedNamespaces[namespace]
+}
+
+// addThreadUnsafe adds the specified target to the queue, and to the counts which determine the scrape rate. It does
+// not update the pacemaker.
+//
+// The caller must acquire the targetLock before calling this method.
+func (q *scrapeQueueImpl) addThreadUnsafe(st *scheduledTarget) {
+	q.targets[st.target] = st
+	q.namespaceTargetCounts[st.target.Namespace]++
+	if overriddenPeriod := q.overriddenScrapePeriod(st); overriddenPeriod > 0 {
+		q.overriddenPeriodCounts[overriddenPeriod]++
+	} else {
+		q.defaultPeriodCount++
 	}
+	q.scheduleThreadUnsafe(st)
+}
 
-	// Run Kapi updates asynchronously, so onKapiUpdated can return without directly acquiring the scrapeQueueImpl.targetLock.
-	// See scrapeQueueImpl.targetLock.
-	for event := range queue {
-		q.processSingleKapiEvent(event)
+// removeThreadUnsafe removes the specified target from the queue, and from the counts which determine the scrape rate.
+// It does not update the pacemaker.
+//
+// The caller must acquire the targetLock before calling this method.
+func (q *scrapeQueueImpl) removeThreadUnsafe(st *scheduledTarget) {
+	q.unscheduleThreadUnsafe(st)
+	delete(q.targets, st.target)
+	q.namespaceTargetCounts[st.target.Namespace]--
+	if q.namespaceTargetCounts[st.target.Namespace] <= 0 {
+		delete(q.namespaceTargetCounts, st.target.Namespace)
+	}
+	if overriddenPeriod := q.overriddenScrapePeriod(st); overriddenPeriod > 0 {
+		q.overriddenPeriodCounts[overriddenPeriod]--
+		if q.overriddenPeriodCounts[overriddenPeriod] <= 0 {
+			delete(q.overriddenPeriodCounts, overriddenPeriod)
+		}
+	} else {
+		q.defaultPeriodCount--
 	}
 }
 
-func (q *scrapeQueueImpl) processSingleKapiEvent(event *kapiEvent) {
-	log := q.log.WithValues("op", "onKapiUpdated", "namespace", event.Namespace, "pod", event.PodName)
+// scheduleThreadUnsafe places the specified target in the heap which corresponds to its lane and due time. It is placed
+// after all other targets with the same due time, so targets which share a scrape period retain their cyclic order.
+//
+// The caller must acquire the targetLock before calling this method.
+func (q *scrapeQueueImpl) scheduleThreadUnsafe(st *scheduledTarget) {
+	switch {
+	case !st.expediteTime.IsZero():
+		st.dueTime = st.expediteTime
+	case st.lastScrapeTime.IsZero():
+		st.dueTime = st.addTime.Add(initialScrapeDelay(st.target, q.targetScrapePeriod(st)))
+	default:
+		st.dueTime = st.lastScrapeTime.Add(q.targetScrapePeriod(st))
+	}
+	st.sequence = q.nextSequence
+	q.nextSequence++
 
-	q.targetLock.Lock()
-	defer q.targetLock.Unlock()
+	if st.isLowPriority {
+		st.isDue = false
+		heap.Push(&q.lowPriorityTargets, st)
+		return
+	}
+	st.isDue = !st.dueTime.After(q.dueWatermark)
+	if !st.isDue {
+		heap.Push(&q.pendingTargets, st)
+		return
+	}
+	heap.Push(&q.dueTargets, st)
+	if st.lastScrapeTime.IsZero() {
+		q.dueUnscrapedCount++
+	}
+}
 
-	switch event.EventType {
-	case input_data_registry.KapiEventCreate:
-		q.targets.PushFront(&scrapeTarget{Namespace: event.Namespace, PodName: event.PodName})
-		log.V(app.VerbosityVerbose).Info("Target added")
-	case input_data_registry.KapiEventDelete:
-		for listElement := q.targets.Front(); listElement != nil; listElement = listElement.Next() {
-			target := listElement.Value.(*scrapeTarget)
-			if target.Namespace == event.Namespace && target.PodName == event.PodName {
-				q.targets.Remove(listElement)
-				break
-			}
+// restoreThreadUnsafe places a target which was removed via unscheduleThreadUnsafe back in the heap which held it, at
+// its original position relative to the other targets. Neither the due watermark, nor the target's due time may have
+// changed in the meantime.
+//
+// The caller must acquire the targetLock before calling this method.
+func (q *scrapeQueueImpl) restoreThreadUnsafe(st *scheduledTarget) {
+	if st.isLowPriority {
+		heap.Push(&q.lowPriorityTargets, st)
+		return
+	}
+	if !st.isDue {
+		heap.Push(&q.pendingTargets, st)
+		return
+	}
+	heap.Push(&q.dueTargets, st)
+	if st.lastScrapeTime.IsZero() {
+		q.dueUnscrapedCount++
+	}
+}
+
+// unscheduleThreadUnsafe removes the specified target from the heap which holds it.
+//
+// The caller must acquire the targetLock before calling this method.
+func (q *scrapeQueueImpl) unscheduleThreadUnsafe(st *scheduledTarget) {
+	if st.isLowPriority {
+		heap.Remove(&q.lowPriorityTargets, st.heapIndex)
+		return
+	}
+	if !st.isDue {
+		heap.Remove(&q.pendingTargets, st.heapIndex)
+		return
+	}
+	heap.Remove(&q.dueTargets, st.heapIndex)
+	if st.lastScrapeTime.IsZero() {
+		q.dueUnscrapedCount--
+	}
+}
+
+// advanceDueWatermarkThreadUnsafe moves the due watermark forward to the specified time, and with it, the targets which
+// become due by that time, from pendingTargets to dueTargets.
+//
+// The caller must acquire the targetLock before calling this method.
+func (q *scrapeQueueImpl) advanceDueWatermarkThreadUnsafe(dueWatermark time.Time) {
+	q.dueWatermark = dueWatermark
+	for q.pendingTargets.Len() > 0 && !q.pendingTargets[0].dueTime.After(dueWatermark) {
+		st := heap.Pop(&q.pendingTargets).(*scheduledTarget)
+		st.isDue = true
+		heap.Push(&q.dueTargets, st)
+		if st.lastScrapeTime.IsZero() {
+			q.dueUnscrapedCount++
 		}
 	}
+}
 
-	targetCount := q.targets.Len()
-	rate := float64(targetCount) / q.scrapePeriod.Seconds()
-	log.V(app.VerbosityVerbose).Info("New target count", "count", targetCount, "rate", rate)
-	// Aim for even temporal distribution of scrapes. Do not track more than targetCount delayed scrapes. targetCount+1
-	// would track a second delayed scrape for a target for which we already created rate debt, so don't do that.
-	q.pacemaker.UpdateRate(rate, targetCount)
+// initialScrapeDelay returns how long after being added to the queue, the specified target becomes due for its first
+// scrape. The delay is in the range [0, scrapePeriod), and is the same each time for a given target and period, so
+// rescheduling does not move a target's first scrape around.
+func initialScrapeDelay(target scrapeTarget, scrapePeriod time.Duration) time.Duration {
+	if scrapePeriod <= 0 {
+		return 0
+	}
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(target.Namespace + "/" + target.PodName))
+	return time.Duration(hash.Sum64() % uint64(scrapePeriod))
+}
+
+//#region targetHeap
+
+// targetHeap implements [heap.Interface], ordering targets by due time, and then by sequence
+type targetHeap []*scheduledTarget
+
+func (h targetHeap) Len() int {
+	return len(h)
+}
+
+func (h targetHeap) Less(i, j int) bool {
+	if h[i].dueTime.Equal(h[j].dueTime) {
+		return h[i].sequence < h[j].sequence
+	}
+	return h[i].dueTime.Before(h[j].dueTime)
+}
+
+func (h targetHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *targetHeap) Push(x any) {
+	st := x.(*scheduledTarget)
+	st.heapIndex = len(*h)
+	*h = append(*h, st)
+}
+
+func (h *targetHeap) Pop() any {
+	old := *h
+	st := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return st
+}
+
+// countDue counts the targets which are due at the specified time, in the subtree rooted at the specified index. It
+// only visits the counted targets and their immediate children, because targets below a target which is not due are
+// not due either.
+func (h targetHeap) countDue(index int, dueAtTime time.Time, excludeUnscraped bool) int {
+	if index >= len(h) || h[index].dueTime.After(dueAtTime) {
+		return 0
+	}
+
+	count := h.countDue(2*index+1, dueAtTime, excludeUnscraped) + h.countDue(2*index+2, dueAtTime, excludeUnscraped)
+	if !excludeUnscraped || !h[index].lastScrapeTime.IsZero() {
+		count++
+	}
+	return count
 }
 
+//#endregion targetHeap
+
 //#region Test isolation
 
 // scrapeQueueTestIsolation contains all points of indirection necessary to isolate static function calls
@@ -279,56 +851,42 @@ type scrapeQueueFactory struct {
 }
 
 // NewScrapeQueue creates a new scrapeQueueImpl which suggests scraping schedule for the specified
-// [input_data_registry.InputDataRegistry].
+// [input_data_registry.InputDataRegistry], keeping the scrapes of each shoot within the specified shootLimits.
+//
+// The queue has no targets until it is opened. Upon Open, it subscribes to registry events, which are processed on a
+// dedicated goroutine. The subscription, and with it the goroutine, ends when the context passed to Open is cancelled,
+// or when the queue is closed, whichever comes first.
 func (sqf *scrapeQueueFactory) NewScrapeQueue(
-	registry input_data_registry.InputDataRegistry, scrapePeriod time.Duration, log logr.Logger) *scrapeQueueImpl {
+	registry input_data_registry.InputDataRegistry,
+	scrapePeriod time.Duration,
+	shootLimits ShootScrapeLimits,
+	log logr.Logger) *scrapeQueueImpl {
 
 	queue := &scrapeQueueImpl{
-		registry:     registry,
-		targets:      list.New(),
-		scrapePeriod: scrapePeriod,
-		log:          log,
+		registry:               registry,
+		targets:                make(map[scrapeTarget]*scheduledTarget),
+		scrapePeriod:           scrapePeriod,
+		overriddenPeriodCounts: make(map[time.Duration]int),
+		namespaceTargetCounts:  make(map[string]int),
+		consumedNamespaces:     make(map[string]bool),
+		firstScrapes:           make(map[scrapeTarget]bool),
+		log:                    log,
 		pacemaker: sqf.newPacemaker(&pacemakerConfig{
 			MaxRate:          100,
 			RateSurplusLimit: 50,
 		}),
 
-		// This channel serves as an update notification buffer, critical to temporally decoupling notification emission,
-		// from notification handling. A deadlock occurs if sending blocks. Keep the size of the channel large.
-		//
-		// Details:
-		// While sending a synchronous update notification, the InputDataRegistry is holding a data lock. The same lock
-		// must also be acquired by us, as part of data access during notification processing. So this here channel is
-		// the implicit second link of a deadlock chain (note that our notification handling consists of a synchronous
-		// phase which simply queues the notification on the channel, and an asynchronous phase, which dequeues from
-		// channel and does the actual work):
-		// 1) InputDataRegistry holds the explicit lock while sending synchronous notifications
-		// 2) Our asynchronous phase handler blocks trying to acquire same lock
-		// 3) InputDataRegistry synchronously calls our (synchronous phase) handler. It tries to send on the channel. It blocks.
-		// 4) Our async phase handler is now waiting for access to registry data. The data registry has locked its data
-		// and is waiting to send on our channel. Deadlock!
-		//
-		// This is solved by two principles:
-		// 1) Notification processing is much faster than notification creation.
-		// 2) Sending notifications is decoupled from processing them, via a large buffer (the channel).
-		updateQueue: make(chan *kapiEvent, 10000),
-
 		testIsolation: scrapeQueueTestIsolation{TimeNow: time.Now},
 	}
+	if !shootLimits.IsZero() {
+		queue.shootLimiter = newShootLimiter(shootLimits)
+	}
 
 	// We store the closure in the kapiWatcher field so that we have a fixed memory address for it. We need to pass
 	// the same address when unsubscribing.
 	queue.kapiWatcher = func(kapi input_data_registry.ShootKapi, event input_data_registry.KapiEventType) {
 		queue.onKapiUpdated(kapi, event)
 	}
-	registry.AddKapiWatcher(&queue.kapiWatcher, true)
-	func() {
-		queue.targetLock.Lock()
-		defer queue.targetLock.Unlock()
-		queue.log.V(app.VerbosityVerbose).Info("Initial target count", "count", queue.targets.Len())
-	}()
-
-	go queue.processKapiEvents()
 
 	return queue
 }
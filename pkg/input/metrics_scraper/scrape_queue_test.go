@@ -5,7 +5,10 @@
 package metrics_scraper
 
 import (
+	"context"
 	"fmt"
+	"runtime"
+	"testing"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -16,7 +19,8 @@ import (
 	"k8s.io/utils/ptr"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
-	"github.com/gardener/gardener-custom-metrics/pkg/util/testutil"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
 )
 
 //#region Fakes
@@ -74,10 +78,98 @@ func (fsk *FakeShootKapi) MetricsTimeOld() time.Time {
 	panic("implement me")
 }
 
+func (fsk *FakeShootKapi) InflightRequestCount() int64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) InflightRequestTime() time.Time {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) CPUSecondsNew() float64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) CPUSampleTimeNew() time.Time {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) CPUSecondsOld() float64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) CPUSampleTimeOld() time.Time {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) ResidentMemoryBytes() int64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) MemorySampleTime() time.Time {
+	panic("implement me")
+}
+
 func (fsk *FakeShootKapi) PodUID() types.UID {
 	panic("implement me")
 }
 
+func (fsk *FakeShootKapi) RequestDurationSecondsNew() float64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) RequestDurationCountNew() int64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) RequestDurationTimeNew() time.Time {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) RequestDurationSecondsOld() float64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) RequestDurationCountOld() int64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) RequestDurationTimeOld() time.Time {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) ClientErrorCountNew() int64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) ServerErrorCountNew() int64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) ClientErrorCountOld() int64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) ServerErrorCountOld() int64 {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) RequestCountHistory() []input_data_registry.RequestCountSample {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) ScrapeDurationHistory() []time.Duration {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) ProcessStartTime() time.Time {
+	panic("implement me")
+}
+
+func (fsk *FakeShootKapi) IsReady() bool {
+	panic("implement me")
+}
+
 //#endregion Fakes
 
 var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
@@ -89,7 +181,9 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 	)
 
 	var (
-		newTestScrapeQueue = func(scrapePeriod time.Duration) (*scrapeQueueImpl, *input_data_registry.FakeInputDataRegistry, *FakePacemaker) {
+		newTestScrapeQueue = func(
+			scrapePeriod time.Duration) (*scrapeQueueImpl, *fakes.FakeInputDataRegistry, *FakePacemaker) {
+
 			var pm *FakePacemaker
 			factory := newScrapeQueueFactory()
 			factory.newPacemaker = func(config *pacemakerConfig) pacemaker {
@@ -101,8 +195,10 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 				pm.PermissionResponse = ptr.To(true)
 				return pm
 			}
-			idr := &input_data_registry.FakeInputDataRegistry{}
-			return factory.NewScrapeQueue(idr, scrapePeriod, logr.Discard()), idr, pm
+			idr := &fakes.FakeInputDataRegistry{}
+			sq := factory.NewScrapeQueue(idr, scrapePeriod, ShootScrapeLimits{}, logr.Discard())
+			sq.Open(context.Background())
+			return sq, idr, pm
 		}
 
 		// Executes an arbitrary number of GetNext(), then adds the specified target, then does one last GetNext()
@@ -185,6 +281,26 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 					return next.PodName == podName && next.Namespace == nsName
 				}).Should(BeTrue())
 			})
+
+			It("should place a target in the low priority lane, if its faults so far demote it", func() {
+				// Arrange
+				sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
+				sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+				defer sq.Close()
+				idr.SetKapiData(nsName, podName, "", nil, "")
+				idr.NotifyKapiMetricsFault(nsName, podName, input_data_registry.ScrapeErrorNetwork)
+				idr.SetKapiData(nsName, podName+"2", "", nil, "")
+				idr.NotifyKapiMetricsFault(nsName, podName+"2", input_data_registry.ScrapeErrorAuth)
+
+				// Act
+				sq.onKapiUpdated(&FakeShootKapi{Namespace: nsName, Name: podName}, input_data_registry.KapiEventCreate)
+				sq.onKapiUpdated(&FakeShootKapi{Namespace: nsName, Name: podName + "2"}, input_data_registry.KapiEventCreate)
+
+				// Assert
+				Expect(sq.Count()).To(Equal(2))
+				Expect(sq.DueCount(gcmtesting.NewTime(2, 0, 0), false)).To(Equal(1)) // A single network fault does not demote
+				Expect(sq.targets[scrapeTarget{Namespace: nsName, PodName: podName + "2"}].isLowPriority).To(BeTrue())
+			})
 		})
 
 		Context("if the event is a remove", func() {
@@ -214,11 +330,11 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 			It("should remove the new target from the queue", func() {
 				// Arrange
 				sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
-				sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+				sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 				defer sq.Close()
 				addTargetScrambleQueue(nsName, podName, sq, idr)
 				addTargetScrambleQueue(nsName, podName+"2", sq, idr)
-				sq.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0)
+				sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
 
 				// Act
 				sq.onKapiUpdated(&FakeShootKapi{Namespace: nsName, Name: podName}, input_data_registry.KapiEventDelete)
@@ -235,6 +351,35 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 				}).Should(BeTrue())
 			})
 
+			It("should keep the shoot's scrape duration histogram, while the shoot has targets left", func() {
+				// Arrange
+				sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
+				defer sq.Close()
+				addTargetScrambleQueue(nsName, podName, sq, idr)
+				addTargetScrambleQueue(nsName, podName+"2", sq, idr)
+				scrapeDurationSeconds.WithLabelValues(nsName).Observe(1)
+
+				// Act
+				sq.onKapiUpdated(&FakeShootKapi{Namespace: nsName, Name: podName}, input_data_registry.KapiEventDelete)
+
+				// Assert
+				Expect(scrapeDurationSeconds.DeleteLabelValues(nsName)).To(BeTrue())
+			})
+
+			It("should remove the shoot's scrape duration histogram, once the shoot's last target is removed", func() {
+				// Arrange
+				sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
+				defer sq.Close()
+				addTargetScrambleQueue(nsName, podName, sq, idr)
+				scrapeDurationSeconds.WithLabelValues(nsName).Observe(1)
+
+				// Act
+				sq.onKapiUpdated(&FakeShootKapi{Namespace: nsName, Name: podName}, input_data_registry.KapiEventDelete)
+
+				// Assert
+				Expect(scrapeDurationSeconds.DeleteLabelValues(nsName)).To(BeFalse())
+			})
+
 			It("should have no effect if the target is missing", func() {
 				// Arrange
 				sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
@@ -242,7 +387,7 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 				addTargetScrambleQueue(nsName, podName, sq, idr)
 				// Add the second Kapi to the registry, but not to the queue
 				idr.SetKapiData(nsName, podName+"2", "", nil, "")
-				sq.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0)
+				sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
 
 				// Act
 				sq.onKapiUpdated(&FakeShootKapi{Namespace: nsName, Name: podName + "2"}, input_data_registry.KapiEventDelete)
@@ -266,7 +411,7 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 					next := sq.GetNext()
 					return next != nil && next.PodName == podName
 				}).Should(BeTrue())
-				sq.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0)
+				sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
 
 				// Act
 				sq.onKapiUpdated(&FakeShootKapi{Namespace: nsName, Name: podName + "2"}, 0xBADF00D)
@@ -295,29 +440,37 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 			Expect(result).To(BeNil())
 		})
 
-		It("on a queue with multiple targets and a newly added target, should immediately request an eager scrape for the new target", func() {
+		It("on a queue with multiple targets and a newly added target, should request an eager scrape for the new "+
+			"target, once its initial scrape delay elapses", func() {
+
 			// Arrange
 			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			defer sq.Close()
 			addTargetScrambleQueue(nsName, podName, sq, idr)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0)
 			idr.SetKapiData(nsName, podName+"2", "", nil, "")
 			sq.onKapiUpdated(&FakeShootKapi{Namespace: nsName, Name: podName + "2"}, input_data_registry.KapiEventCreate)
 			Eventually(sq.Count).Should(Equal(2))
 			pm.PermissionResponse = nil // Only allow eager scrapes
+			dueTime := gcmtesting.NewTime(1, 0, 0).Add(
+				initialScrapeDelay(scrapeTarget{Namespace: nsName, PodName: podName + "2"}, time.Minute))
 
 			// Act
-			next := sq.GetNext()
+			sq.testIsolation.TimeNow = func() time.Time { return dueTime.Add(-time.Millisecond) }
+			beforeDue := sq.GetNext()
+			sq.testIsolation.TimeNow = func() time.Time { return dueTime }
+			atDue := sq.GetNext()
 
 			// Assert
-			Expect(next.PodName).To(Equal(podName + "2"))
+			Expect(beforeDue).To(BeNil())
+			Expect(atDue).NotTo(BeNil())
+			Expect(atDue.PodName).To(Equal(podName + "2"))
 		})
 
 		It("should request a scrape operation from the scrape client, if the pacemaker grants permission", func() {
 			// Arrange
 			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			defer sq.Close()
 			addTargetScrambleQueue(nsName, podName, sq, idr)
 
@@ -331,7 +484,7 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 		It("should not request a scrape operation from the scrape client, if the pacemaker denies permission", func() {
 			// Arrange
 			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			defer sq.Close()
 			addTargetScrambleQueue(nsName, podName, sq, idr)
 			pm.PermissionResponse = ptr.To(false)
@@ -346,25 +499,25 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 		It("upon successful scrape, should record the scrape time in the data registry", func() {
 			// Arrange
 			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			defer sq.Close()
 			addTargetScrambleQueue(nsName, podName, sq, idr)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
 
 			// Act
 			sq.GetNext()
 
 			// Assert
-			Expect(idr.GetKapiData(nsName, podName).LastMetricsScrapeTime).To(Equal(testutil.NewTimeNowStub(2, 0, 0)()))
+			Expect(idr.GetKapiData(nsName, podName).LastMetricsScrapeTime).To(Equal(gcmtesting.NewTimeNowStub(2, 0, 0)()))
 		})
 
 		It("should not change the last scrape time for the Kapi, if the pacemaker denies permission", func() {
 			// Arrange
 			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			defer sq.Close()
 			addTargetScrambleQueue(nsName, podName, sq, idr)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
 			initialScrapeTime := idr.GetKapiData(nsName, podName).LastMetricsScrapeTime
 			pm.PermissionResponse = ptr.To(false)
 
@@ -378,7 +531,7 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 		It("should return targets in a strictly cyclic order", func() {
 			// Arrange
 			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			defer sq.Close()
 
 			// Arrange - add three targets
@@ -387,7 +540,7 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 			}
 
 			// Arrange - record the target order
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
 			var namesInOrder [3]string
 			for i := 0; i < 3; i++ {
 				namesInOrder[i] = sq.GetNext().PodName
@@ -395,7 +548,7 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 
 			// Act and assert
 			for iteration := 0; iteration < 5; iteration++ {
-				sq.testIsolation.TimeNow = testutil.NewTimeNowStub(3+iteration, 0, 0)
+				sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(3+iteration, 0, 0)
 				for i := 0; i < 3; i++ {
 					next := sq.GetNext()
 					Expect(next.PodName).To(Equal(namesInOrder[i]))
@@ -406,11 +559,11 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 		It("should return nil if there are only ineligible targets at the time of the call", func() {
 			// Arrange
 			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			defer sq.Close()
 			addTargetScrambleQueue(nsName, podName, sq, idr)
 			addTargetScrambleQueue(nsName, podName+"2", sq, idr)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
 			pm.PermissionResponse = nil
 			Expect(sq.GetNext()).To(Not(BeNil())) // These two are eager scrapes
 			Expect(sq.GetNext()).To(Not(BeNil()))
@@ -425,7 +578,7 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 		It("should return nil, if the queue is empty", func() {
 			// Arrange
 			sq, _, _ := newTestScrapeQueue(1 * time.Minute)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			defer sq.Close()
 
 			// Act
@@ -440,14 +593,14 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 
 			// Arrange
 			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			defer sq.Close()
 
 			for i := 0; i < 2; i++ {
 				addTargetScrambleQueue(nsName, getIndexedPodName(i), sq, idr)
 			}
 
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
 			pm.PermissionResponse = nil
 			Expect(sq.GetNext()).NotTo(BeNil()) // These two are eager scrapes
 			Expect(sq.GetNext()).NotTo(BeNil())
@@ -466,7 +619,7 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 		It("should skip targets which are missing from the registry, and return the first target which is not missing", func() {
 			// Arrange
 			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			defer sq.Close()
 			for i := 0; i < 10; i++ {
 				addTargetScrambleQueue(nsName, getIndexedPodName(i), sq, idr)
@@ -474,7 +627,7 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 			for i := 0; i < 5; i++ {
 				idr.RemoveKapiData(nsName, getIndexedPodName(i))
 			}
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(2, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
 			pm.PermissionResponse = nil
 
 			// Act and assert
@@ -483,6 +636,171 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 			}
 			Expect(sq.GetNext()).To(BeNil()) // This should be back to the first target, thus not eager
 		})
+		It("should honor per-target scrape periods, scraping a target with a shorter period more often", func() {
+			// Arrange
+			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			defer sq.Close()
+			for i := 0; i < 2; i++ {
+				addTargetScrambleQueue(nsName, getIndexedPodName(i), sq, idr)
+			}
+			idr.SetKapiScrapePeriod(nsName, getIndexedPodName(0), 15*time.Second)
+			sq.onKapiUpdated(
+				&FakeShootKapi{Namespace: nsName, Name: getIndexedPodName(0)}, input_data_registry.KapiEventUpdate)
+			Eventually(func() float64 { return pm.MinRate.Load() }).Should(Equal(float64(1)/60 + float64(1)/15))
+			pm.PermissionResponse = nil
+			scrapeCount := map[string]int{}
+
+			// Act
+			for second := 0; second < 120; second++ {
+				sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, second)
+				for next := sq.GetNext(); next != nil; next = sq.GetNext() {
+					scrapeCount[next.PodName]++
+				}
+			}
+
+			// Assert
+			Expect(scrapeCount[getIndexedPodName(0)]).To(Equal(8))
+			Expect(scrapeCount[getIndexedPodName(1)]).To(Equal(2))
+		})
+
+		It("should skip targets of shoots which reached their scrape limits, and keep their place in the queue", func() {
+			// Arrange
+			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			defer sq.Close()
+			addTargetScrambleQueue(nsName, getIndexedPodName(0), sq, idr)
+			addTargetScrambleQueue(nsName, getIndexedPodName(1), sq, idr)
+			addTargetScrambleQueue(nsName+"2", getIndexedPodName(0), sq, idr)
+			sq.shootLimiter = newShootLimiter(ShootScrapeLimits{MaxConcurrency: 1})
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
+			pm.PermissionResponse = nil
+
+			// Act
+			first := sq.GetNext()
+			second := sq.GetNext()
+			third := sq.GetNext()
+			sq.Release(first)
+			fourth := sq.GetNext()
+
+			// Assert
+			Expect(*first).To(Equal(scrapeTarget{Namespace: nsName, PodName: getIndexedPodName(0)}))
+			Expect(*second).To(Equal(scrapeTarget{Namespace: nsName + "2", PodName: getIndexedPodName(0)}))
+			Expect(third).To(BeNil())
+			Expect(*fourth).To(Equal(scrapeTarget{Namespace: nsName, PodName: getIndexedPodName(1)}))
+			Expect(sq.DueCount(sq.testIsolation.TimeNow(), false)).To(BeZero())
+		})
+
+		It("should limit the first scrapes in progress per shoot, but not the subsequent scrapes", func() {
+			// Arrange
+			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			defer sq.Close()
+			addTargetScrambleQueue(nsName+"2", getIndexedPodName(0), sq, idr) // Scraped at 1:00:00
+			for _, target := range []scrapeTarget{
+				{Namespace: nsName, PodName: getIndexedPodName(0)},
+				{Namespace: nsName, PodName: getIndexedPodName(1)},
+				{Namespace: nsName + "2", PodName: getIndexedPodName(1)},
+			} {
+				idr.SetKapiData(target.Namespace, target.PodName, "", nil, "")
+				sq.onKapiUpdated(
+					&FakeShootKapi{Namespace: target.Namespace, Name: target.PodName}, input_data_registry.KapiEventCreate)
+			}
+			sq.shootLimiter = newShootLimiter(ShootScrapeLimits{MaxFirstScrapeConcurrency: 1})
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
+			pm.PermissionResponse = nil
+
+			// Act
+			var started []scrapeTarget
+			for next := sq.GetNext(); next != nil; next = sq.GetNext() {
+				started = append(started, *next)
+			}
+			var firstOfShoot *scrapeTarget
+			for i := range started {
+				if started[i].Namespace == nsName {
+					firstOfShoot = &started[i]
+				}
+			}
+			sq.Release(firstOfShoot)
+			afterRelease := sq.GetNext()
+
+			// Assert
+			Expect(started).To(HaveLen(3)) // One first scrape per shoot, plus the repeat scrape
+			Expect(started).To(ContainElement(scrapeTarget{Namespace: nsName + "2", PodName: getIndexedPodName(0)}))
+			Expect(firstOfShoot).NotTo(BeNil())
+			Expect(afterRelease).NotTo(BeNil())
+			Expect(afterRelease.Namespace).To(Equal(nsName))
+			Expect(afterRelease.PodName).NotTo(Equal(firstOfShoot.PodName))
+		})
+
+		It("should only return targets in the low priority lane, when no other target is due", func() {
+			// Arrange
+			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			defer sq.Close()
+			addTargetScrambleQueue(nsName, getIndexedPodName(0), sq, idr) // Scraped at 1:00:00
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 10)
+			addTargetScrambleQueue(nsName, getIndexedPodName(1), sq, idr) // Scraped at 1:00:10
+			for i := 0; i < lowPriorityFaultCount; i++ {
+				idr.NotifyKapiMetricsFault(nsName, getIndexedPodName(0), input_data_registry.ScrapeErrorNetwork)
+			}
+			sq.Release(&scrapeTarget{Namespace: nsName, PodName: getIndexedPodName(0)})
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(2, 0, 0)
+			pm.PermissionResponse = nil
+
+			// Act
+			first := sq.GetNext()
+			second := sq.GetNext()
+			third := sq.GetNext()
+
+			// Assert
+			Expect(*first).To(Equal(scrapeTarget{Namespace: nsName, PodName: getIndexedPodName(1)}))
+			Expect(*second).To(Equal(scrapeTarget{Namespace: nsName, PodName: getIndexedPodName(0)}))
+			Expect(third).To(BeNil())
+		})
+	})
+
+	Describe("Release", func() {
+		It("should demote a target with repeated faults to the low priority lane, and promote it after a success", func() {
+			// Arrange
+			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			defer sq.Close()
+			addTargetScrambleQueue(nsName, podName, sq, idr)
+			target := &scrapeTarget{Namespace: nsName, PodName: podName}
+			dueTime := gcmtesting.NewTime(1, 1, 0)
+
+			// Act and assert
+			idr.NotifyKapiMetricsFault(nsName, podName, input_data_registry.ScrapeErrorNetwork)
+			sq.Release(target)
+			Expect(sq.DueCount(dueTime, false)).To(Equal(1)) // A single fault does not demote
+
+			idr.NotifyKapiMetricsFault(nsName, podName, input_data_registry.ScrapeErrorNetwork)
+			sq.Release(target)
+			Expect(sq.DueCount(dueTime, false)).To(BeZero())
+			Expect(sq.Count()).To(Equal(1))
+
+			idr.SetKapiMetrics(nsName, podName, 42) // Resets the fault count
+			sq.Release(target)
+			Expect(sq.DueCount(dueTime, false)).To(Equal(1))
+		})
+		It("should demote a target to the low priority lane upon a single fault which is unlikely to be transient", func() {
+			// Arrange
+			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			defer sq.Close()
+			addTargetScrambleQueue(nsName, podName, sq, idr)
+			target := &scrapeTarget{Namespace: nsName, PodName: podName}
+			dueTime := gcmtesting.NewTime(1, 1, 0)
+
+			// Act
+			idr.NotifyKapiMetricsFault(nsName, podName, input_data_registry.ScrapeErrorAuth)
+			sq.Release(target)
+
+			// Assert
+			Expect(sq.DueCount(dueTime, false)).To(BeZero())
+			Expect(sq.Count()).To(Equal(1))
+		})
 	})
 
 	Describe("DueCount", func() {
@@ -497,16 +815,18 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 			Expect(due).To(BeZero())
 		})
 
-		It("should return zero if the queue contains only targets which are missing from the registry", func() {
+		It("should stop counting targets which are removed from the registry, once the removal is processed", func() {
 			// Arrange
 			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
 			defer sq.Close()
-			sq.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			addTargetScrambleQueue(nsName, podName, sq, idr)
 			idr.RemoveKapiData(nsName, podName)
+			sq.onKapiUpdated(&FakeShootKapi{Namespace: nsName, Name: podName}, input_data_registry.KapiEventDelete)
+			Eventually(sq.Count).Should(BeZero())
 
 			// Act
-			due := sq.DueCount(testutil.NewTimeNowStub(2, 0, 0)(), false)
+			due := sq.DueCount(gcmtesting.NewTimeNowStub(2, 0, 0)(), false)
 
 			// Assert
 			Expect(due).To(BeZero())
@@ -517,32 +837,216 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 
 			// Arrange
 			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
-			for i := 0; i < 30; i++ {
+			defer sq.Close()
+			firstScrapeTime := gcmtesting.NewTimeNowStub(1, 0, 0)()
+			secondScrapeTime := firstScrapeTime.Add(sq.scrapePeriod)
+			thirdScrapeTime := secondScrapeTime.Add(sq.scrapePeriod)
+
+			// Arrange - 20 targets scraped at the first scrape time, then 10 of them scraped again at the second one
+			sq.testIsolation.TimeNow = func() time.Time { return firstScrapeTime }
+			for i := 0; i < 20; i++ {
 				addTargetScrambleQueue(nsName, getIndexedPodName(i), sq, idr)
 			}
+			sq.testIsolation.TimeNow = func() time.Time { return secondScrapeTime }
+			for i := 0; i < 10; i++ {
+				Expect(sq.GetNext()).NotTo(BeNil())
+			}
 
-			firstScrapeTime := testutil.NewTimeNowStub(1, 0, 0)()
-			secondScrapeTime := firstScrapeTime.Add(sq.scrapePeriod)
-			thirdScrapeTime := secondScrapeTime.Add(sq.scrapePeriod)
-			for i := 0; i < 30; i++ {
-				next := sq.GetNext()
-				if i < 10 {
-					idr.SetKapiLastScrapeTime(next.Namespace, next.PodName, time.Time{})
-				} else if i < 20 {
-					idr.SetKapiLastScrapeTime(next.Namespace, next.PodName, firstScrapeTime)
-				} else {
-					idr.SetKapiLastScrapeTime(next.Namespace, next.PodName, secondScrapeTime)
-				}
+			// Arrange - 10 targets which have never been scraped, and become due within one period after being added
+			for i := 20; i < 30; i++ {
+				idr.SetKapiData(nsName, getIndexedPodName(i), "", nil, "")
+				sq.onKapiUpdated(
+					&FakeShootKapi{Namespace: nsName, Name: getIndexedPodName(i)}, input_data_registry.KapiEventCreate)
 			}
+			Eventually(sq.Count).Should(Equal(30))
 
 			// Act and assert
-			Expect(sq.DueCount(secondScrapeTime.Add(-time.Millisecond), false)).To(Equal(10))
+			Expect(sq.DueCount(secondScrapeTime.Add(-time.Millisecond), false)).To(Equal(0))
 			Expect(sq.DueCount(secondScrapeTime.Add(-time.Millisecond), true)).To(Equal(0))
-			Expect(sq.DueCount(secondScrapeTime, false)).To(Equal(20))
+			Expect(sq.DueCount(secondScrapeTime, false)).To(Equal(10))
 			Expect(sq.DueCount(secondScrapeTime, true)).To(Equal(10))
 			Expect(sq.DueCount(thirdScrapeTime, false)).To(Equal(30))
 			Expect(sq.DueCount(thirdScrapeTime, true)).To(Equal(20))
 		})
+		It("should count correctly at a time earlier than the time of a previous count", func() {
+			// Arrange
+			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
+			defer sq.Close()
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			for i := 0; i < 10; i++ {
+				idr.SetKapiData(nsName, getIndexedPodName(i), "", nil, "")
+				sq.onKapiUpdated(
+					&FakeShootKapi{Namespace: nsName, Name: getIndexedPodName(i)}, input_data_registry.KapiEventCreate)
+			}
+			Eventually(sq.Count).Should(Equal(10))
+			for i := 0; i < 10; i++ {
+				// One target scraped at each second
+				sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, i)
+				Expect(sq.GetNext()).NotTo(BeNil())
+			}
+			Expect(sq.DueCount(gcmtesting.NewTimeNowStub(1, 2, 0)(), false)).To(Equal(10))
+
+			// Act and assert
+			Expect(sq.DueCount(gcmtesting.NewTimeNowStub(1, 1, 4)(), false)).To(Equal(5))
+			Expect(sq.DueCount(gcmtesting.NewTimeNowStub(1, 0, 59)(), false)).To(Equal(0))
+			Expect(sq.DueCount(gcmtesting.NewTimeNowStub(1, 1, 9)(), false)).To(Equal(10))
+		})
+	})
+
+	Describe("initialScrapeDelay", func() {
+		It("should spread the first scrapes of targets across the scrape period, the same way each time", func() {
+			// Arrange
+			const targetCount = 1000
+			period := time.Minute
+			var delays []time.Duration
+
+			// Act
+			for i := 0; i < targetCount; i++ {
+				delays = append(delays, initialScrapeDelay(scrapeTarget{Namespace: nsName, PodName: getIndexedPodName(i)}, period))
+			}
+
+			// Assert
+			firstHalfCount := 0
+			for i, delay := range delays {
+				Expect(delay).To(BeNumerically(">=", 0))
+				Expect(delay).To(BeNumerically("<", period))
+				Expect(initialScrapeDelay(scrapeTarget{Namespace: nsName, PodName: getIndexedPodName(i)}, period)).
+					To(Equal(delay))
+				if delay < period/2 {
+					firstHalfCount++
+				}
+			}
+			Expect(firstHalfCount).To(BeNumerically("~", targetCount/2, targetCount/10))
+		})
+	})
+
+	Describe("SetScrapePeriod", func() {
+		It("should update the due time of targets and the pacemaker rate", func() {
+			// Arrange
+			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
+			defer sq.Close()
+			scrapeTime := gcmtesting.NewTimeNowStub(1, 0, 0)()
+			sq.testIsolation.TimeNow = func() time.Time { return scrapeTime }
+			for i := 0; i < 30; i++ {
+				addTargetScrambleQueue(nsName, getIndexedPodName(i), sq, idr)
+			}
+
+			// Act
+			sq.SetScrapePeriod(30 * time.Second)
+
+			// Assert
+			Expect(sq.DueCount(scrapeTime.Add(30*time.Second), false)).To(Equal(30))
+			Expect(pm.MinRate.Load()).To(Equal(float64(1)))
+			Expect(pm.RateDebtLimit.Load()).To(Equal(int32(30)))
+		})
+	})
+
+	Describe("SetBackgroundScrapePeriod", func() {
+		It("should scrape the targets of shoots which are not consumed at the background period", func() {
+			// Arrange
+			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
+			defer sq.Close()
+			scrapeTime := gcmtesting.NewTimeNowStub(1, 0, 0)()
+			sq.testIsolation.TimeNow = func() time.Time { return scrapeTime }
+			addTargetScrambleQueue(nsName, getIndexedPodName(0), sq, idr)
+			addTargetScrambleQueue("other", getIndexedPodName(1), sq, idr)
+			sq.SetNamespaceConsumed(nsName, true)
+
+			// Act
+			sq.SetBackgroundScrapePeriod(5 * time.Minute)
+
+			// Assert
+			Expect(sq.DueCount(scrapeTime.Add(1*time.Minute), false)).To(Equal(1))
+			Expect(sq.DueCount(scrapeTime.Add(5*time.Minute), false)).To(Equal(2))
+			Expect(pm.MinRate.Load()).To(Equal(float64(1)/60 + float64(1)/300))
+		})
+		It("should not shorten per-target scrape periods which are longer than the background period", func() {
+			// Arrange
+			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
+			defer sq.Close()
+			scrapeTime := gcmtesting.NewTimeNowStub(1, 0, 0)()
+			sq.testIsolation.TimeNow = func() time.Time { return scrapeTime }
+			addTargetScrambleQueue(nsName, getIndexedPodName(0), sq, idr)
+			idr.SetKapiScrapePeriod(nsName, getIndexedPodName(0), 10*time.Minute)
+			sq.onKapiUpdated(
+				&FakeShootKapi{Namespace: nsName, Name: getIndexedPodName(0)}, input_data_registry.KapiEventUpdate)
+
+			// Act
+			sq.SetBackgroundScrapePeriod(5 * time.Minute)
+
+			// Assert
+			Expect(sq.DueCount(scrapeTime.Add(5*time.Minute), false)).To(Equal(0))
+			Expect(sq.DueCount(scrapeTime.Add(10*time.Minute), false)).To(Equal(1))
+		})
+	})
+
+	Describe("SetNamespaceConsumed", func() {
+		It("should move the shoot's targets between the background and the regular scrape period", func() {
+			// Arrange
+			sq, idr, pm := newTestScrapeQueue(1 * time.Minute)
+			defer sq.Close()
+			scrapeTime := gcmtesting.NewTimeNowStub(1, 0, 0)()
+			sq.testIsolation.TimeNow = func() time.Time { return scrapeTime }
+			sq.SetBackgroundScrapePeriod(5 * time.Minute)
+			for i := 0; i < 2; i++ {
+				addTargetScrambleQueue(nsName, getIndexedPodName(i), sq, idr)
+			}
+			dueBeforeConsumed := sq.DueCount(scrapeTime.Add(1*time.Minute), false)
+
+			// Act
+			sq.SetNamespaceConsumed(nsName, true)
+			dueWhileConsumed := sq.DueCount(scrapeTime.Add(1*time.Minute), false)
+			rateWhileConsumed := pm.MinRate.Load()
+			sq.SetNamespaceConsumed(nsName, false)
+
+			// Assert
+			Expect(dueBeforeConsumed).To(Equal(0))
+			Expect(dueWhileConsumed).To(Equal(2))
+			Expect(rateWhileConsumed).To(Equal(float64(2) / 60))
+			Expect(sq.DueCount(scrapeTime.Add(1*time.Minute), false)).To(Equal(0))
+			Expect(pm.MinRate.Load()).To(Equal(float64(2) / 300))
+		})
+	})
+
+	Describe("ExpediteNamespace", func() {
+		It("should make the shoot's targets due right away, until they are scraped", func() {
+			// Arrange
+			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
+			defer sq.Close()
+			now := gcmtesting.NewTime(1, 0, 0)
+			sq.testIsolation.TimeNow = func() time.Time { return now }
+			addTargetScrambleQueue(nsName, podName, sq, idr)
+			addTargetScrambleQueue("OtherNs", podName, sq, idr)
+			now = now.Add(10 * time.Second)
+
+			// Act
+			count := sq.ExpediteNamespace(nsName)
+
+			// Assert
+			Expect(count).To(Equal(1))
+			Expect(sq.DueCount(now, false)).To(Equal(1))
+			Expect(sq.GetNext()).To(Equal(&scrapeTarget{Namespace: nsName, PodName: podName}))
+			Expect(sq.DueCount(now, false)).To(BeZero())
+			// The other shoot's target keeps its schedule. The expedited one is due a scrape period after its scrape.
+			Expect(sq.DueCount(now.Add(1*time.Minute-time.Nanosecond), false)).To(Equal(1))
+			Expect(sq.DueCount(now.Add(1*time.Minute), false)).To(Equal(2))
+		})
+
+		It("should move the shoot's targets from the low priority lane to the regular lane", func() {
+			// Arrange
+			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
+			defer sq.Close()
+			sq.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			addTargetScrambleQueue(nsName, podName, sq, idr)
+			idr.NotifyKapiMetricsFault(nsName, podName, input_data_registry.ScrapeErrorAuth)
+			sq.Release(&scrapeTarget{Namespace: nsName, PodName: podName})
+
+			// Act
+			sq.ExpediteNamespace(nsName)
+
+			// Assert
+			Expect(sq.DueCount(gcmtesting.NewTime(1, 0, 0), false)).To(Equal(1))
+		})
 	})
 
 	Describe("Close", func() {
@@ -559,16 +1063,206 @@ var _ = Describe("input.metrics_scraper.scrapeQueueImpl", func() {
 		})
 
 		It("should terminate the processing of InputDataRegistry events", func() {
+			// Arrange
+			idr := input_data_registry.NewInputDataRegistry(time.Second, logr.Discard())
+			sq := newScrapeQueueFactory().NewScrapeQueue(idr, time.Minute, ShootScrapeLimits{}, logr.Discard())
+			sq.Open(context.Background())
+
+			// Act
+			Expect(sq.Close()).To(Succeed())
+
+			// Assert
+			idr.SetKapiData(nsName, podName, "", nil, "")
+			Consistently(sq.Count).Should(BeZero())
+		})
+
+		It("should have no effect, if called more than once", func() {
 			// Arrange
 			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
+			Expect(sq.Close()).To(Succeed())
 
 			// Act
-			sq.Close()
+			err := sq.Close()
 
 			// Assert
+			Expect(err).To(Succeed())
+			Expect(idr.Watcher).To(BeNil())
+		})
+
+		It("should succeed, and keep the queue from being opened, if the queue was never opened", func() {
+			// Arrange
+			idr := &fakes.FakeInputDataRegistry{}
+			sq := newScrapeQueueFactory().NewScrapeQueue(idr, time.Minute, ShootScrapeLimits{}, logr.Discard())
+
+			// Act
+			err := sq.Close()
+			sq.Open(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(idr.Watcher).To(BeNil())
+		})
+	})
+
+	Describe("Open", func() {
+		It("should subscribe the queue to InputDataRegistry events", func() {
+			// Arrange
+			idr := input_data_registry.NewInputDataRegistry(time.Second, logr.Discard())
+			sq := newScrapeQueueFactory().NewScrapeQueue(idr, time.Minute, ShootScrapeLimits{}, logr.Discard())
+			DeferCleanup(sq.Close)
 			idr.SetKapiData(nsName, podName, "", nil, "")
-			sq.onKapiUpdated(&FakeShootKapi{Namespace: nsName, Name: podName}, input_data_registry.KapiEventCreate)
-			Consistently(sq.GetNext).Should(BeNil())
+			Consistently(sq.Count).Should(BeZero())
+
+			// Act
+			sq.Open(context.Background())
+
+			// Assert
+			Eventually(sq.Count).Should(Equal(1))
+		})
+
+		It("should have no effect, if called more than once", func() {
+			// Arrange
+			sq, idr, _ := newTestScrapeQueue(1 * time.Minute)
+			watcher := idr.Watcher
+
+			// Act
+			sq.Open(context.Background())
+
+			// Assert
+			Expect(idr.Watcher).To(BeIdenticalTo(watcher))
+		})
+	})
+
+	Describe("context cancellation", func() {
+		It("should terminate the processing of InputDataRegistry events", func() {
+			// Arrange
+			idr := input_data_registry.NewInputDataRegistry(time.Second, logr.Discard())
+			ctx, cancel := context.WithCancel(context.Background())
+			sq := newScrapeQueueFactory().NewScrapeQueue(idr, time.Minute, ShootScrapeLimits{}, logr.Discard())
+			sq.Open(ctx)
+
+			// Act
+			cancel()
+
+			// Assert
+			Eventually(func() bool {
+				sq.closeLock.Lock()
+				defer sq.closeLock.Unlock()
+				return sq.isClosed
+			}).Should(BeTrue())
+			idr.SetKapiData(nsName, podName, "", nil, "")
+			Consistently(sq.Count).Should(BeZero())
+			Expect(sq.Close()).To(Succeed())
+		})
+
+		It("should release the event processing goroutine", func() {
+			// Arrange
+			idr := input_data_registry.NewInputDataRegistry(time.Second, logr.Discard())
+			baseline := runtime.NumGoroutine()
+			ctx, cancel := context.WithCancel(context.Background())
+			newScrapeQueueFactory().NewScrapeQueue(idr, time.Minute, ShootScrapeLimits{}, logr.Discard()).Open(ctx)
+			Expect(runtime.NumGoroutine()).To(BeNumerically(">", baseline))
+
+			// Act
+			cancel()
+
+			// Assert
+			Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", baseline))
+		})
+
+		It("should close the queue right away, if the context is already cancelled", func() {
+			// Arrange
+			idr := input_data_registry.NewInputDataRegistry(time.Second, logr.Discard())
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			sq := newScrapeQueueFactory().NewScrapeQueue(idr, time.Minute, ShootScrapeLimits{}, logr.Discard())
+
+			// Act
+			sq.Open(ctx)
+
+			// Assert
+			Eventually(func() bool {
+				sq.closeLock.Lock()
+				defer sq.closeLock.Unlock()
+				return sq.isClosed
+			}).Should(BeTrue())
 		})
 	})
 })
+
+//#region Benchmarks
+
+// newBenchmarkScrapeQueue creates a queue over a registry with the specified number of targets, which have all been
+// scraped once, at evenly spread times. At the returned time, scraping lags behind, with half the targets being due.
+// If overriddenScrapePeriod is not zero, every other target has that scrape period.
+func newBenchmarkScrapeQueue(
+	b *testing.B, targetCount int, overriddenScrapePeriod time.Duration) (*scrapeQueueImpl, time.Time) {
+
+	factory := newScrapeQueueFactory()
+	factory.newPacemaker = func(*pacemakerConfig) pacemaker {
+		return &FakePacemaker{PermissionResponse: ptr.To(true)}
+	}
+	idr := input_data_registry.NewInputDataRegistry(time.Second, logr.Discard())
+	for i := 0; i < targetCount; i++ {
+		idr.SetKapiData(fmt.Sprintf("shoot--ns-%d", i), podName(), "", nil, "")
+		if i%2 == 1 && overriddenScrapePeriod > 0 {
+			idr.SetKapiScrapePeriod(fmt.Sprintf("shoot--ns-%d", i), podName(), overriddenScrapePeriod)
+		}
+	}
+	sq := factory.NewScrapeQueue(idr, time.Minute, ShootScrapeLimits{}, logr.Discard())
+	sq.Open(context.Background())
+	b.Cleanup(func() { _ = sq.Close() })
+	for sq.Count() < targetCount {
+		time.Sleep(time.Millisecond)
+	}
+
+	startTime := gcmtesting.NewTime(1, 0, 0)
+	scrapeInterval := time.Minute / time.Duration(targetCount)
+	for i := 0; i < targetCount; i++ {
+		scrapeTime := startTime.Add(time.Duration(i) * scrapeInterval)
+		sq.testIsolation.TimeNow = func() time.Time { return scrapeTime }
+		sq.GetNext()
+	}
+	return sq, startTime.Add(time.Minute + time.Minute/2)
+}
+
+// podName returns the name of the Kapi pod used by the benchmarks
+func podName() string { return "kube-apiserver-0" }
+
+func BenchmarkScrapeQueue_DueCount(b *testing.B) {
+	sq, now := newBenchmarkScrapeQueue(b, 6000, 0)
+	shiftPeriod := 10 * time.Millisecond
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// The calls a Scraper makes at the start of each shift
+		shiftStartTime := now.Add(time.Duration(i) * shiftPeriod)
+		sq.DueCount(shiftStartTime.Add(-shiftPeriod), true)
+		sq.DueCount(shiftStartTime, false)
+	}
+}
+
+func BenchmarkScrapeQueue_GetNext(b *testing.B) {
+	sq, now := newBenchmarkScrapeQueue(b, 6000, 0)
+	benchmarkGetNext(b, sq, now)
+}
+
+func BenchmarkScrapeQueue_GetNext_MixedPeriods(b *testing.B) {
+	sq, now := newBenchmarkScrapeQueue(b, 6000, 15*time.Second)
+	benchmarkGetNext(b, sq, now)
+}
+
+// benchmarkGetNext measures GetNext, called at the rate at which targets become due
+func benchmarkGetNext(b *testing.B, sq *scrapeQueueImpl, now time.Time) {
+	scrapeInterval := time.Minute / 6000
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		scrapeTime := now.Add(time.Duration(i) * scrapeInterval)
+		sq.testIsolation.TimeNow = func() time.Time { return scrapeTime }
+		sq.GetNext()
+	}
+}
+
+//#endregion Benchmarks
@@ -6,16 +6,30 @@ package metrics_scraper
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"math"
+	"net"
+	neturl "net/url"
 	"runtime/pprof"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	krest "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/tracing"
 )
 
 // Scraper tracks the kube-apiserver pods in a [input_data_registry.InputDataRegistry] and populates the registry back
@@ -23,8 +37,8 @@ import (
 //
 // Remarks:
 // The current Scraper implementation is meant for seeds which contain 20-6000 shoot kube-apiserver pods.
-// With a much lower number of shoots, operation is functionally correct, but somewhat suboptimal. With a much higher
-// number of shoots, contention for some internal synchronisation objects may become a bottleneck.
+// With a much lower number of shoots, operation is functionally correct, but somewhat suboptimal. Queue operations
+// have logarithmic cost, so a much higher number of shoots is supported, but has not been tested at scale.
 type Scraper struct {
 	// The dataRegistry serves as both a source of input data driving the scraper, and as store for the output data
 	// produced by the scraper.
@@ -47,8 +61,44 @@ type Scraper struct {
 	// from previous shifts
 	maxActiveWorkerCount int
 
-	// Abort a scrape request if it takes longer than that
-	scrapeTimeout time.Duration
+	// Abort a scrape request if it takes longer than that. Holds a time.Duration. Changes along with the scrape period.
+	scrapeTimeout atomic.Int64
+
+	// If not empty, scrapes are routed through the proxy at this URL. See [ScraperOptions.ProxyURLTemplate].
+	proxyURLTemplate string
+
+	// Only Kapis in namespaces selected by this filter are scraped. Can be replaced at runtime.
+	namespaceFilter atomic.Pointer[NamespaceFilter]
+
+	// If not nil, only Kapis in namespaces owned by this replica are scraped. See [ScraperOptions.IsNamespaceOwned].
+	isNamespaceOwned func(namespace string) bool
+
+	// Receives the outcome of each scrape. May be nil. See [ScraperOptions.Condition].
+	condition *conditions.ComponentReporter
+
+	// Records scrape fault events on the Kapi pods. May be nil. See [ScraperOptions.EventRecorder].
+	eventRecorder record.EventRecorder
+
+	// How many consecutive scrape faults trigger a fault event. See [ScraperOptions.FaultEventThreshold].
+	faultEventThreshold int
+
+	// Requests an immediate re-read of a Kapi pod. May be nil. See [ScraperOptions.RefreshPod].
+	refreshPod func(namespace string, podName string)
+
+	// Bridges the temporary absence of a shoot's CA certificates. See [ScraperOptions.CAGracePeriod].
+	caFallback *caFallback
+
+	// Tracks which shoots have consumers of their metrics. Nil if background scraping is disabled. See
+	// [ScraperOptions.BackgroundScrapePeriod].
+	consumers *consumerTracker
+
+	// Reaches Kapi pods through the seed kube-apiserver, for shoots which use the port-forward scrape transport. Nil if
+	// that transport is not available. See [ScraperOptions.PortForwardConfig].
+	portForwarder *portForwarder
+
+	// Holds off the first scrapes until the registry has the data necessary to scrape. See
+	// [ScraperOptions.SyncBarrierTimeout].
+	syncBarrier *syncBarrier
 
 	///////////////////////////////////////////////////////////////////////////
 	// Worker scheduling state:
@@ -72,6 +122,14 @@ type Scraper struct {
 	// Tracks the worker goprocs doing the actual scraping
 	workerWaitGroup sync.WaitGroup
 
+	///////////////////////////////////////////////////////////////////////////
+	// Fault event state:
+
+	// For each target with a fault event on record and no recovery event since, the time of the last fault event.
+	// Protected by faultEventLock.
+	faultEventTimes map[scrapeTarget]time.Time
+	faultEventLock  sync.Mutex
+
 	// Provides indirections necessary to isolate the unit during tests
 	testIsolation scraperTestIsolation
 }
@@ -81,12 +139,22 @@ type Scraper struct {
 //
 // Errors which occur during individual scrapes do not terminate the overall scraping process, and are thus not
 // reflected in the error returned by this function.
+//
+// Scraping only begins once the sync barrier passes. See [ScraperOptions.SyncBarrierTimeout].
 func (s *Scraper) Start(ctx context.Context) error {
 	log := s.log.WithValues("op", "scraperProc")
 
+	// Open the queue right away, so it is populated while the sync barrier holds off the scrapes
+	s.queue.Open(ctx)
+	s.syncBarrier.Wait(ctx)
 	ticker := s.testIsolation.NewTicker(s.scrapeShiftPeriod)
 	log.V(app.VerbosityVerbose).Info("Scraper started", "schedulingPeriod", s.scrapeShiftPeriod)
 	defer ticker.Stop()
+	defer func() {
+		if s.portForwarder != nil {
+			s.portForwarder.Close()
+		}
+	}()
 	defer s.workerWaitGroup.Wait()
 
 loop:
@@ -99,6 +167,7 @@ loop:
 			}
 			break loop
 		case <-ticker.C():
+			s.expireConsumers()
 			s.startShiftWorkers(ctx)
 		}
 	}
@@ -132,6 +201,11 @@ func (s *Scraper) startShiftWorkers(ctx context.Context) {
 		TargetCount: s.lastShiftScrapeTargetCount,
 		WorkerCount: s.lastShiftWorkerCount,
 	}
+	// How many from last shift have not even been picked for processing. We don't count targets which have never been
+	// scraped. Chances are, they were added after last shift ended. Counting in chronological order is cheaper for the
+	// queue, so this is counted before the targets for this shift.
+	lastShiftUnprocessedCount := s.queue.DueCount(lastShift.StartTime, true)
+
 	// Allocate a place where we'll store values for the new frame of reference. We'll apply these later.
 	now := s.testIsolation.TimeNow()
 	thisShift := shiftScheduleArgs{
@@ -139,10 +213,6 @@ func (s *Scraper) startShiftWorkers(ctx context.Context) {
 		TargetCount: s.queue.DueCount(now, false),
 		WorkerCount: -1, // We'll calculate this one shortly
 	}
-
-	// How many from last shift have not even been picked for processing. We don't count targets which have never been
-	// scraped. Chances are, they were added after last shift ended.
-	lastShiftUnprocessedCount := s.queue.DueCount(lastShift.StartTime, true)
 	lastShiftWorkerThroughput := float64(lastShift.TargetCount-lastShiftUnprocessedCount) / float64(lastShift.WorkerCount)
 	if lastShiftWorkerThroughput < 1 {
 		// A worker is practically guaranteed to pick at least one target. So, if we're getting throughput < 1, that's
@@ -213,8 +283,15 @@ func (s *Scraper) workerProc(ctx context.Context) {
 
 // ScrapeQueue sequentially picks targets from the queue and scrapes them, until there are no more eligible targets.
 func (s *Scraper) ScrapeQueue(ctx context.Context) {
-	for target := s.queue.GetNext(); target != nil && ctx.Err() == nil; target = s.queue.GetNext() {
-		s.scrape(ctx, target)
+	for target := s.queue.GetNext(); target != nil; target = s.queue.GetNext() {
+		isCancelled := ctx.Err() != nil
+		if !isCancelled {
+			s.scrape(ctx, target)
+		}
+		s.queue.Release(target)
+		if isCancelled {
+			return
+		}
 	}
 }
 
@@ -223,37 +300,303 @@ func (s *Scraper) ScrapeQueue(ctx context.Context) {
 // scrape data becomes temporarily stale, until a subsequent scrape of the same target succeeds.
 func (s *Scraper) scrape(ctx context.Context, target *scrapeTarget) {
 	log := s.log.WithValues("op", "scrape", "namespace", target.Namespace, "pod", target.PodName)
-	kapi := s.dataRegistry.GetKapiData(target.Namespace, target.PodName)
-	if kapi == nil {
+	ctx, span := tracing.Tracer().Start(ctx, "scrape", trace.WithAttributes(
+		attribute.String("namespace", target.Namespace), attribute.String("pod", target.PodName)))
+	var err error
+	defer func() { tracing.EndSpan(span, err) }()
+
+	if !s.namespaceFilter.Load().Matches(target.Namespace) {
+		log.V(app.VerbosityVerbose).Info("Namespace excluded by filter, skipping scrape")
+		s.dataRegistry.SetKapiScrapeExcluded(target.Namespace, target.PodName, true)
+		return
+	}
+	if s.isNamespaceOwned != nil && !s.isNamespaceOwned(target.Namespace) {
+		log.V(app.VerbosityVerbose).Info("Namespace owned by another replica, skipping scrape")
+		s.dataRegistry.SetKapiScrapeExcluded(target.Namespace, target.PodName, true)
+		return
+	}
+	// From here on, a failure to produce a sample counts against the Kapi's scrape coverage
+	s.dataRegistry.SetKapiScrapeExcluded(target.Namespace, target.PodName, false)
+	scrapeContext := s.dataRegistry.GetScrapeContext(target.Namespace, target.PodName)
+	if scrapeContext == nil {
 		log.V(app.VerbosityError).Error(nil, "No record for this Kapi in the registry")
 		return
 	}
-	authToken := s.dataRegistry.GetShootAuthSecret(target.Namespace)
-	if authToken == "" {
+	if scrapeContext.AuthSecret == "" {
+		if s.syncBarrier.IsHolding(s.testIsolation.TimeNow()) {
+			log.V(app.VerbosityVerbose).Info("No secret for this shoot in the registry yet, holding off the scrape")
+			return
+		}
 		log.V(app.VerbosityError).Error(nil, "No secret for this shoot in the registry")
 		return
 	}
-	caCert := s.dataRegistry.GetShootCACertificate(target.Namespace)
-	if caCert == nil {
-		log.V(app.VerbosityError).Error(nil, "No CA cert for this shoot in the registry")
-		return
+	settings := scrapeContext.ScrapeSettings
+	isCARequired := settings.Scheme != input_data_registry.ScrapeSchemeHTTP && !settings.InsecureSkipTLSVerify
+	if isCARequired {
+		caCertPool, source := s.caFallback.resolve(
+			target.Namespace, scrapeContext.CACertPool, s.testIsolation.TimeNow())
+		switch source {
+		case caSourceNone:
+			if s.syncBarrier.IsHolding(s.testIsolation.TimeNow()) {
+				log.V(app.VerbosityVerbose).Info("No CA cert for this shoot in the registry yet, holding off the scrape")
+				return
+			}
+			log.V(app.VerbosityError).Error(nil, "No CA cert for this shoot in the registry")
+			return
+		case caSourceCached:
+			log.V(app.VerbosityVerbose).Info("No CA cert for this shoot in the registry, using the last one seen")
+		case caSourceFallback:
+			log.V(app.VerbosityVerbose).Info("No CA cert for this shoot in the registry, using the fallback CA bundle")
+		}
+		scrapeContext.CACertPool = caCertPool
+	}
+
+	var proxyURL *neturl.URL
+	if settings.Transport != input_data_registry.ScrapeTransportPortForward {
+		// Port-forward traffic goes through the seed kube-apiserver, not through the proxy
+		if requestSettings := scrapeContext.RequestSettings; requestSettings != nil && requestSettings.ProxyURL != nil {
+			proxyURL = requestSettings.ProxyURL // The shoot's own proxy takes precedence over the global one
+		} else {
+			proxyURL, err = ResolveProxyURL(s.proxyURLTemplate, target.Namespace)
+			if err != nil {
+				log.V(app.VerbosityError).Error(err, "Invalid proxy URL for this shoot")
+				return
+			}
+		}
 	}
 
-	timeoutContext, cancel := context.WithTimeout(ctx, s.scrapeTimeout)
+	timeout := time.Duration(s.scrapeTimeout.Load())
+	if scrapeContext.ScrapePeriod > 0 && scrapeContext.ScrapePeriod/2 < timeout {
+		timeout = scrapeContext.ScrapePeriod / 2 // A shorter, target-specific scrape period also shortens the timeout
+	}
+	timeoutContext, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	totalRequestCount, err := s.testIsolation.NewMetricsClient().GetKapiInstanceMetrics(timeoutContext, kapi.MetricsUrl, authToken, caCert)
+	var metrics kapiMetrics
+	scrapeStartTime := s.testIsolation.TimeNow()
+	metrics, err = s.getMetrics(timeoutContext, target, scrapeContext, proxyURL)
+	scrapeDuration := s.testIsolation.TimeNow().Sub(scrapeStartTime)
 	if err != nil {
-		consecutiveFaultCount := s.dataRegistry.NotifyKapiMetricsFault(target.Namespace, target.PodName)
+		s.condition.ReportScopedError(
+			target.Namespace, fmt.Errorf("scraping %s/%s: %w", target.Namespace, target.PodName, err))
+		category := errorCategory(err)
+		scrapeFailureCount.WithLabelValues(string(category)).Inc()
+		consecutiveFaultCount := s.dataRegistry.NotifyKapiMetricsFault(target.Namespace, target.PodName, category)
 		message := "Kapi metrics retrieval failed"
+		log = log.WithValues("category", category)
+		if scrapeContext.AuthDegradedReason != "" {
+			// Likely the cause of the failure
+			log = log.WithValues("authDegraded", scrapeContext.AuthDegradedReason)
+		}
 		if consecutiveFaultCount&(consecutiveFaultCount-1) == 0 { // Is it a power of 2? Exponential backoff on errors.
 			log.V(app.VerbosityError).Error(err, message)
 		} else {
 			log.V(app.VerbosityVerbose).Info(message)
 		}
+		s.recordFaultEvent(target, scrapeContext, consecutiveFaultCount, err)
+		isDirect := proxyURL == nil && settings.Transport != input_data_registry.ScrapeTransportPortForward
+		if s.refreshPod != nil && isDirect && errors.Is(err, syscall.ECONNREFUSED) {
+			// Likely, the pod was recreated at a different address, and the pod controller did not catch up yet
+			log.V(app.VerbosityVerbose).Info("Connection refused, requesting pod refresh")
+			s.refreshPod(target.Namespace, target.PodName)
+		}
+		return
+	}
+	log.V(app.VerbosityVerbose).Info("Request count scraped",
+		"totalRequestCount", metrics.TotalRequestCount, "duration", scrapeDuration)
+	scrapeDurationSeconds.WithLabelValues(target.Namespace).Observe(scrapeDuration.Seconds())
+	s.condition.ReportScopedSuccess(target.Namespace)
+	s.recordRecoveryEvent(target, scrapeContext)
+	_, writeSpan := tracing.Tracer().Start(ctx, "registry write")
+	defer writeSpan.End()
+	s.dataRegistry.SetKapiScrapeResult(target.Namespace, target.PodName, input_data_registry.KapiScrapeResult{
+		TotalRequestCount:       metrics.TotalRequestCount,
+		ClientErrorCount:        metrics.ClientErrorCount,
+		ServerErrorCount:        metrics.ServerErrorCount,
+		InflightRequestCount:    metrics.InflightRequestCount,
+		HasInflightRequestCount: metrics.HasInflightRequestCount,
+		CPUSeconds:              metrics.CPUSeconds,
+		HasCPUSeconds:           metrics.HasCPUSeconds,
+		ResidentMemoryBytes:     metrics.ResidentMemoryBytes,
+		HasResidentMemoryBytes:  metrics.HasResidentMemoryBytes,
+		RequestDurationSeconds:  metrics.RequestDurationSeconds,
+		RequestDurationCount:    metrics.RequestDurationCount,
+		HasRequestDuration:      metrics.HasRequestDuration,
+		ProcessStartTime:        metrics.processStartTime(),
+		ScrapeDuration:          scrapeDuration,
+	})
+}
+
+// getMetrics scrapes all metrics endpoints of a Kapi pod, and returns the values scraped from MetricsUrl, with the
+// request counters scraped from the extra endpoints added. Fails if any of the endpoints fails, because a partial sum
+// is not comparable with the complete ones scraped before and after. An extra endpoint which serves no request
+// counters, e.g. a sidecar which exposes only its process metrics, counts as zero.
+func (s *Scraper) getMetrics(
+	ctx context.Context,
+	target *scrapeTarget,
+	scrapeContext *input_data_registry.ScrapeContext,
+	proxyURL *neturl.URL) (kapiMetrics, error) {
+
+	client := s.testIsolation.NewMetricsClient()
+	settings := scrapeContext.ScrapeSettings
+	if settings.Transport == input_data_registry.ScrapeTransportPortForward {
+		client = s.testIsolation.NewPortForwardMetricsClient()
+		if client == nil {
+			return kapiMetrics{}, errors.New("the port-forward scrape transport is not available")
+		}
+		ctx = withPortForwardTarget(ctx, target.Namespace, target.PodName)
+	}
+	if requestSettings := scrapeContext.RequestSettings; requestSettings != nil && len(requestSettings.Headers) > 0 {
+		ctx = withRequestHeaders(ctx, requestSettings.Headers)
+	}
+	result, err := client.GetKapiInstanceMetrics(
+		ctx,
+		withScheme(scrapeContext.MetricsUrl, settings.Scheme),
+		scrapeContext.AuthSecret,
+		scrapeContext.CACertPool,
+		settings.TLSServerName,
+		settings.InsecureSkipTLSVerify,
+		proxyURL)
+	if err != nil {
+		return kapiMetrics{}, err
+	}
+	for _, url := range scrapeContext.ExtraMetricsUrls {
+		metrics, err := client.GetKapiInstanceMetrics(
+			ctx,
+			withScheme(url, settings.Scheme),
+			scrapeContext.AuthSecret,
+			scrapeContext.CACertPool,
+			settings.TLSServerName,
+			settings.InsecureSkipTLSVerify,
+			proxyURL)
+		if errors.Is(err, errNoRequestCounters) {
+			continue
+		}
+		if err != nil {
+			return kapiMetrics{}, fmt.Errorf("scraping the extra metrics endpoint %s: %w", url, err)
+		}
+		result.addRequestCounts(metrics)
+	}
+
+	return result, nil
+}
+
+// withScheme returns the specified URL, with its scheme replaced by the specified one. If scheme is empty, or the URL
+// cannot be parsed, the URL is returned unchanged.
+func withScheme(url string, scheme string) string {
+	if scheme == "" {
+		return url
+	}
+	parsedURL, err := neturl.Parse(url)
+	if err != nil || parsedURL.Scheme == scheme {
+		return url
+	}
+	parsedURL.Scheme = scheme
+	return parsedURL.String()
+}
+
+// recordFaultEvent emits a Warning event on the target's pod, once the target has failed faultEventThreshold consecutive
+// scrapes. While the target keeps failing, the event is repeated at most once per faultEventRepeatPeriod.
+func (s *Scraper) recordFaultEvent(
+	target *scrapeTarget, scrapeContext *input_data_registry.ScrapeContext, consecutiveFaultCount int, err error) {
+
+	if s.eventRecorder == nil || s.faultEventThreshold <= 0 || consecutiveFaultCount < s.faultEventThreshold {
+		return
+	}
+
+	now := s.testIsolation.TimeNow()
+	s.faultEventLock.Lock()
+	lastEventTime, isOnRecord := s.faultEventTimes[*target]
+	if isOnRecord && now.Sub(lastEventTime) < faultEventRepeatPeriod {
+		s.faultEventLock.Unlock()
+		return
+	}
+	// Drop targets which stopped being scraped (e.g. deleted pods) while failing, so they do not pile up
+	for t, eventTime := range s.faultEventTimes {
+		if now.Sub(eventTime) >= 2*faultEventRepeatPeriod {
+			delete(s.faultEventTimes, t)
+		}
+	}
+	s.faultEventTimes[*target] = now
+	s.faultEventLock.Unlock()
+
+	s.eventRecorder.Eventf(podReference(target, scrapeContext), corev1.EventTypeWarning, FaultEventReason,
+		"Failed to scrape metrics %d consecutive times: %v", consecutiveFaultCount, err)
+}
+
+// recordRecoveryEvent emits a Normal event on the target's pod, if a fault event was recorded for the target, and no
+// recovery event since
+func (s *Scraper) recordRecoveryEvent(target *scrapeTarget, scrapeContext *input_data_registry.ScrapeContext) {
+	if s.eventRecorder == nil {
 		return
 	}
-	log.V(app.VerbosityVerbose).Info("Request count scraped", "totalRequestCount", totalRequestCount)
-	s.dataRegistry.SetKapiMetrics(target.Namespace, target.PodName, totalRequestCount)
+
+	s.faultEventLock.Lock()
+	_, isOnRecord := s.faultEventTimes[*target]
+	delete(s.faultEventTimes, *target)
+	s.faultEventLock.Unlock()
+	if !isOnRecord {
+		return
+	}
+
+	s.eventRecorder.Event(
+		podReference(target, scrapeContext), corev1.EventTypeNormal, RecoveryEventReason, "Metrics scrape succeeded")
+}
+
+// podReference returns a reference to the target's pod, suitable as subject of an event
+func podReference(target *scrapeTarget, scrapeContext *input_data_registry.ScrapeContext) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind:       "Pod",
+		APIVersion: "v1",
+		Namespace:  target.Namespace,
+		Name:       target.PodName,
+		UID:        scrapeContext.PodUID,
+	}
+}
+
+// NotifyNamespaceQueried records that the metrics of the shoot in the specified namespace were queried, e.g. by a
+// horizontal pod autoscaler. With background scraping enabled, this brings the shoot's Kapis back to the regular scrape
+// rate. Otherwise, it has no effect. Concurrency-safe.
+func (s *Scraper) NotifyNamespaceQueried(namespace string) {
+	if s.consumers == nil || !s.consumers.notifyQueried(namespace, s.testIsolation.TimeNow()) {
+		return
+	}
+
+	s.log.V(app.VerbosityVerbose).Info("Shoot consumed, scraping at regular rate", "namespace", namespace)
+	s.queue.SetNamespaceConsumed(namespace, true)
+}
+
+// expireConsumers moves the shoots which are no longer queried back to background scraping
+func (s *Scraper) expireConsumers() {
+	if s.consumers == nil {
+		return
+	}
+
+	for _, namespace := range s.consumers.expire(s.testIsolation.TimeNow()) {
+		s.log.V(app.VerbosityVerbose).Info("Shoot no longer consumed, scraping in background", "namespace", namespace)
+		s.queue.SetNamespaceConsumed(namespace, false)
+	}
+}
+
+// ExpediteNamespace makes the Kapis of the shoot in the specified namespace due for scraping right away, e.g. so an
+// operator can check whether a shoot recovered, without waiting for its next regular scrape. Returns the number of
+// Kapis affected. Concurrency-safe.
+func (s *Scraper) ExpediteNamespace(namespace string) int {
+	return s.queue.ExpediteNamespace(namespace)
+}
+
+// SetScrapePeriod changes how often the same pod is scraped. Takes effect immediately. Concurrency-safe.
+func (s *Scraper) SetScrapePeriod(scrapePeriod time.Duration) {
+	s.log.V(app.VerbosityInfo).Info("Changing scrape period", "scrapePeriod", scrapePeriod)
+	s.queue.SetScrapePeriod(scrapePeriod)
+	s.scrapeTimeout.Store(int64(scrapePeriod / 2))
+}
+
+// SetNamespaceFilter changes the filter which selects the namespaces to be scraped. Takes effect for all subsequent
+// scrapes. Concurrency-safe.
+func (s *Scraper) SetNamespaceFilter(filter NamespaceFilter) {
+	s.log.V(app.VerbosityInfo).Info(
+		"Changing namespace filter", "include", filter.Include, "exclude", filter.Exclude)
+	s.namespaceFilter.Store(&filter)
 }
 
 //#region Test isolation
@@ -298,8 +641,11 @@ func (ft *fakeTicker) Stop() {
 type scraperTestIsolation struct {
 	// Points to [time.Now]
 	TimeNow func() time.Time
-	// Points to [newMetricsClient]
+	// Returns the metricsClient instance shared by all scrapes
 	NewMetricsClient func() metricsClient
+	// Returns the metricsClient instance shared by all scrapes which use the port-forward transport. Returns nil if
+	// that transport is not available.
+	NewPortForwardMetricsClient func() metricsClient
 	// Points to time.NewTicker
 	NewTicker func(duration time.Duration) ticker
 	// Points to workerProc
@@ -310,21 +656,142 @@ type scraperTestIsolation struct {
 
 //#region scraperFactory
 
+// The reasons of the events recorded on Kapi pods. See [ScraperOptions.EventRecorder].
+const (
+	FaultEventReason    = "MetricsScrapeFailing"
+	RecoveryEventReason = "MetricsScrapeRecovered"
+)
+
+// faultEventRepeatPeriod is the minimum time between two fault events for the same pod
+const faultEventRepeatPeriod = 10 * time.Minute
+
+// ProxyURLNamespacePlaceholder is replaced by the shoot namespace, when it appears in [ScraperOptions.ProxyURLTemplate]
+const ProxyURLNamespacePlaceholder = "{namespace}"
+
+// ScraperOptions contains optional settings which alter the way a Scraper reaches its targets. The zero value results
+// in direct connections to the scraped pods.
+type ScraperOptions struct {
+	// ProxyURLTemplate, if not empty, is the URL of an HTTP CONNECT ("http" or "https" scheme) or SOCKS5 ("socks5"
+	// scheme) proxy, through which scrape traffic is routed. Any occurrence of [ProxyURLNamespacePlaceholder] is
+	// replaced by the shoot namespace, which allows routing each shoot's traffic through a per-shoot tunnel endpoint
+	// (e.g. the shoot's reversed VPN or konnectivity server).
+	ProxyURLTemplate string
+	// DialContext, if not nil, replaces the default function used to establish network connections to the scraped
+	// pods, or to the proxy, if one is used. Has the semantics of [net.Dialer.DialContext].
+	DialContext func(ctx context.Context, network string, address string) (net.Conn, error)
+	// NamespaceFilter selects the namespaces whose pods are scraped. See [Scraper.SetNamespaceFilter].
+	NamespaceFilter NamespaceFilter
+	// IsNamespaceOwned, if not nil, is consulted before each scrape, and the scrape is skipped if it returns false.
+	// Used when scraping is sharded across replicas, to restrict scraping to the namespaces owned by this replica.
+	// Must be concurrency-safe.
+	IsNamespaceOwned func(namespace string) bool
+	// Condition, if not nil, receives the outcome of each metrics retrieval attempt
+	Condition *conditions.ComponentReporter
+	// EventRecorder, if not nil, is used to record Kubernetes events on a Kapi pod, when it fails FaultEventThreshold
+	// consecutive scrapes, and when it recovers from that. See [FaultEventReason] and [RecoveryEventReason].
+	EventRecorder record.EventRecorder
+	// FaultEventThreshold is how many consecutive scrape faults trigger a fault event. Zero disables events.
+	FaultEventThreshold int
+	// ShootScrapeLimits caps the scrape load on each individual shoot, on top of the global scrape rate limit
+	ShootScrapeLimits ShootScrapeLimits
+	// RefreshPod, if not nil, is called when a direct connection to a pod is refused, which typically means that the
+	// pod was recreated at a different address. It is expected to re-read the pod and update its record in the
+	// registry, without waiting for the pod controller. Must be concurrency-safe and non-blocking.
+	RefreshPod func(namespace string, podName string)
+	// MaxResponseSize is the maximum size, in bytes, of a metrics response, after decompression. Larger responses fail
+	// the scrape. Zero means DefaultMaxResponseSize.
+	MaxResponseSize int64
+	// PortForwardConfig, if not nil, specifies the seed kube-apiserver through whose pods/portforward subresource the
+	// Kapi pods of shoots with the port-forward scrape transport are reached (see
+	// [input_data_registry.ScrapeTransportPortForward]). If nil, scrapes of such shoots fail.
+	PortForwardConfig *krest.Config
+	// CAGracePeriod is how long the last seen CA certificates of a shoot keep being used to verify its Kapis, after
+	// they go missing from the registry, e.g. while the shoot's CA secret is being rotated. Zero disables that.
+	CAGracePeriod time.Duration
+	// TLS tunes the TLS configuration used to reach the Kapis, e.g. session resumption. The zero value applies the
+	// defaults.
+	TLS TLSSettings
+	// Response tunes how metrics responses are requested and read, e.g. whether compression is requested. The zero
+	// value applies the defaults.
+	Response ResponseSettings
+	// AcceptProtobuf, if true, makes scrapes prefer the Prometheus protobuf exposition format, which is cheaper to parse
+	// than the text one. Kapis which do not support it keep responding in the text format.
+	AcceptProtobuf bool
+	// BackgroundScrapePeriod, if not zero, enables background scraping: the Kapis of shoots whose metrics were not
+	// queried (see [Scraper.NotifyNamespaceQueried]) within the ConsumerWindow are scraped at this period, instead of
+	// the regular one. A query brings the shoot back to the regular scrape period immediately.
+	BackgroundScrapePeriod time.Duration
+	// ConsumerWindow is how long after the last query of its metrics a shoot keeps being scraped at the regular rate.
+	// Only applies if BackgroundScrapePeriod is not zero.
+	ConsumerWindow time.Duration
+	// FallbackCACertPool, if not nil, is used to verify the Kapis of shoots which have no CA certificates in the
+	// registry, once the CAGracePeriod expires. Typically, the seed cluster's generic CA bundle. If nil, such shoots are
+	// not scraped.
+	FallbackCACertPool *x509.CertPool
+	// SyncBarrierTimeout, if not zero, bounds a sync barrier, which holds off the first scrapes upon start, while the
+	// controllers populate the registry. Scraping begins once WaitForInformerSync returns, and all shoots with Kapis
+	// in the registry have auth data on record, or once the timeout elapses. Until the timeout elapses, targets whose
+	// shoot still lacks auth data are skipped quietly.
+	SyncBarrierTimeout time.Duration
+	// WaitForInformerSync, if not nil, blocks until the informers which feed the registry complete their initial sync,
+	// or the context is cancelled. Only applies if SyncBarrierTimeout is not zero.
+	WaitForInformerSync func(ctx context.Context) error
+}
+
+// ResolveProxyURL returns the proxy URL which results from applying the specified namespace to the specified proxy URL
+// template. For the meaning of the template, see [ScraperOptions.ProxyURLTemplate]. Returns nil if the template is
+// empty, or an error if the resulting URL is not a valid proxy URL.
+func ResolveProxyURL(proxyURLTemplate string, namespace string) (*neturl.URL, error) {
+	if proxyURLTemplate == "" {
+		return nil, nil
+	}
+
+	proxyURL, err := neturl.Parse(strings.ReplaceAll(proxyURLTemplate, ProxyURLNamespacePlaceholder, namespace))
+	if err != nil {
+		return nil, fmt.Errorf("parse proxy URL: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy URL scheme '%s'. Supported schemes: http, https, socks5", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy URL '%s' does not specify a host", proxyURL.Redacted())
+	}
+
+	return proxyURL, nil
+}
+
 // NewScraper creates a new Scraper object which tracks the kube-apiserver pods in the specified dataRegistry and
 // populates the registry back with metrics scraped from the pods.
 //
 // scrapePeriodMilliseconds is how often the same pod will be scraped.
 // scrapeFlowControlPeriodMilliseconds is how often the Scraper will adjust the number of parallel workers responsible
 // for the actual pod scraping.
+// options alters the way the Scraper reaches its targets. See ScraperOptions.
 func NewScraper(
 	dataRegistry input_data_registry.InputDataRegistry,
 	scrapePeriod time.Duration,
 	scrapeFlowControlPeriod time.Duration,
+	options ScraperOptions,
 	log logr.Logger) *Scraper {
 
+	// All scrapes share one client, so connections to a Kapi can be reused across scrapes
+	client := newMetricsClient(2*scrapePeriod,
+		options.DialContext, options.MaxResponseSize, options.TLS, options.Response, options.AcceptProtobuf)
+	var forwarder *portForwarder
+	var portForwardClient metricsClient
+	if options.PortForwardConfig != nil {
+		forwarder = newPortForwarder(options.PortForwardConfig, 2*scrapePeriod)
+		portForwardClient = newMetricsClient(2*scrapePeriod,
+			forwarder.DialContext, options.MaxResponseSize, options.TLS, options.Response, options.AcceptProtobuf)
+	}
+	// Opened by Start, with the context passed to it
+	queue := newScrapeQueueFactory().NewScrapeQueue(
+		dataRegistry, scrapePeriod, options.ShootScrapeLimits, log.V(1).WithName("queue"))
 	scraper := &Scraper{
 		dataRegistry:         dataRegistry,
-		queue:                newScrapeQueueFactory().NewScrapeQueue(dataRegistry, scrapePeriod, log.V(1).WithName("queue")),
+		queue:                queue,
 		log:                  log,
 		lastShiftWorkerCount: 1, // Avoid division by zero
 		// Parameters:
@@ -333,22 +800,48 @@ func NewScraper(
 		maxShiftWorkerCount:  10,
 		maxActiveWorkerCount: 50,
 
-		// Longer timeout increases tolerance to intermittent disruptions and server overload.
-		// On the downside:
-		// - It creates a risk that a delayed sample and the one after it are too close and hurt impact
-		// differential (rate) calculation accuracy.
-		// - Allows unresponsive server to tie more resources (active goroutines) on our side.
-		scrapeTimeout: scrapePeriod / 2,
+		proxyURLTemplate: options.ProxyURLTemplate,
+		isNamespaceOwned: options.IsNamespaceOwned,
+		condition:        options.Condition,
+
+		eventRecorder:       options.EventRecorder,
+		faultEventThreshold: options.FaultEventThreshold,
+		faultEventTimes:     make(map[scrapeTarget]time.Time),
+
+		refreshPod:    options.RefreshPod,
+		caFallback:    newCAFallback(options.CAGracePeriod, options.FallbackCACertPool),
+		portForwarder: forwarder,
 
 		testIsolation: scraperTestIsolation{
-			TimeNow:          time.Now,
-			NewMetricsClient: newMetricsClient,
+			TimeNow:                     time.Now,
+			NewMetricsClient:            func() metricsClient { return client },
+			NewPortForwardMetricsClient: func() metricsClient { return portForwardClient },
 			NewTicker: func(period time.Duration) ticker {
 				return &tickerAdapter{ticker: time.NewTicker(period)}
 			},
 		},
 	}
 	scraper.testIsolation.workerProc = scraper.workerProc
+	scraper.syncBarrier = newSyncBarrier(
+		dataRegistry,
+		options.WaitForInformerSync,
+		func(namespace string) bool {
+			return scraper.namespaceFilter.Load().Matches(namespace) &&
+				(scraper.isNamespaceOwned == nil || scraper.isNamespaceOwned(namespace))
+		},
+		options.SyncBarrierTimeout,
+		log.V(1).WithName("sync-barrier"))
+	// Longer timeout increases tolerance to intermittent disruptions and server overload.
+	// On the downside:
+	// - It creates a risk that a delayed sample and the one after it are too close and hurt impact
+	// differential (rate) calculation accuracy.
+	// - Allows unresponsive server to tie more resources (active goroutines) on our side.
+	scraper.scrapeTimeout.Store(int64(scrapePeriod / 2))
+	scraper.namespaceFilter.Store(&options.NamespaceFilter)
+	if options.BackgroundScrapePeriod > 0 {
+		scraper.consumers = newConsumerTracker(options.ConsumerWindow)
+		queue.SetBackgroundScrapePeriod(options.BackgroundScrapePeriod)
+	}
 
 	return scraper
 }
@@ -6,16 +6,33 @@ package metrics_scraper
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
+	"net/http"
+	neturl "net/url"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
-	"github.com/gardener/gardener-custom-metrics/pkg/util/testutil"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
 )
 
 var _ = Describe("input.metrics_scraper.Scraper", func() {
@@ -28,7 +45,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 		// Creates a test scraper instance which works well as starting point for most tests. The queue is empty.
 		newTestScraper = func() (
 			*Scraper,
-			*input_data_registry.FakeInputDataRegistry,
+			*fakes.FakeInputDataRegistry,
 			*fakeScrapeQueue,
 			*fakeMetricsClient,
 			*fakeTicker,
@@ -36,12 +53,12 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 
 			clientMetrics := &scraperTestMetrics{}
 			schedulingPeriod := 50 * time.Millisecond
-			idr := &input_data_registry.FakeInputDataRegistry{}
+			idr := &fakes.FakeInputDataRegistry{}
 			fakeQueue := newFakeScrapeQueue(idr, scrapePeriod)
 			fakeTicker := newFakeTicker()
 			fakeClient := &fakeMetricsClient{}
 
-			scraper := NewScraper(idr, scrapePeriod, schedulingPeriod, logr.Discard())
+			scraper := NewScraper(idr, scrapePeriod, schedulingPeriod, ScraperOptions{}, logr.Discard())
 			scraper.queue = fakeQueue
 			scraper.testIsolation.NewTicker = func(period time.Duration) ticker {
 				fakeTicker.Period.Store(int64(period))
@@ -62,7 +79,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 		// if it has already been scraping. Some of the parameters control the effects of the forged last scrape shift.
 		setScraperState = func(
 			scraper *Scraper,
-			idr *input_data_registry.FakeInputDataRegistry,
+			idr *fakes.FakeInputDataRegistry,
 			sq *fakeScrapeQueue,
 			lastShiftTime time.Time,
 			lastShiftTargetCount int,
@@ -80,7 +97,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 					// Newly added since last shift. Leave scrape time unset.
 				} else if i < thisShiftTargetTotalCount-lastShiftTargetCount+leftoverCount {
 					// Leftover from last shift. Use some non-zero scrape time before last shift.
-					idr.SetKapiLastScrapeTime(nsName, getIndexedPodName(i), testutil.NewTime(1, 0, 0))
+					idr.SetKapiLastScrapeTime(nsName, getIndexedPodName(i), gcmtesting.NewTime(1, 0, 0))
 				} else {
 					// Successfully scraped during last shift
 					idr.SetKapiLastScrapeTime(nsName, getIndexedPodName(i), lastShiftTime)
@@ -92,14 +109,14 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 		// The queue has only one target, and GetNext() permanently dequeues the target, so it can be scraped only once.
 		arrangeWorkerTest = func() (
 			*Scraper,
-			*input_data_registry.FakeInputDataRegistry,
+			*fakes.FakeInputDataRegistry,
 			*fakeMetricsClient,
 			*scraperTestMetrics,
 			*scrapeTarget) {
 
 			scraper, idr, sq, client, _, testMetrics := newTestScraper()
 			sq.IsNoRequeue = true
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 1, 1, 1, 1)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 1, 1, 1, 1)
 			target := sq.Queue[0]
 			// Upon exit, workers check out with the wait group and some other counters. Prime those so they'd accept
 			// the checkout.
@@ -120,7 +137,9 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 				input_data_registry.NewInputDataRegistry(0, logr.Discard()),
 				scrapePeriod,
 				100*time.Millisecond,
+				ScraperOptions{},
 				logr.Discard())
+			DeferCleanup(scraper.queue.Close)
 
 			// Assert
 			Expect(scraper.queue.(*scrapeQueueImpl).scrapePeriod).To(Equal(scrapePeriod))
@@ -145,17 +164,17 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 				isRunning.Store(false)
 				scraper.Start(ctx)
 			}()
-			ticker.Channel <- testutil.NewTime(1, 1, 0)
+			ticker.Channel <- gcmtesting.NewTime(1, 1, 0)
 			Eventually(isRunning.Load).Should(BeTrue())
 			isRunning.Store(false)
-			ticker.Channel <- testutil.NewTime(1, 2, 0)
+			ticker.Channel <- gcmtesting.NewTime(1, 2, 0)
 			Eventually(isRunning.Load).Should(BeTrue())
 			cancel()
 			isRunning.Store(false)
 			abortChan := make(chan bool)
 			go func() {
 				select {
-				case ticker.Channel <- testutil.NewTime(1, 3, 0):
+				case ticker.Channel <- gcmtesting.NewTime(1, 3, 0):
 					// The expectation is, because context has been cancelled, no one will be there to read from the channel
 					break
 				case <-abortChan:
@@ -183,7 +202,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 				scraper.Start(ctx)
 				isRunning.Store(false)
 			}()
-			ticker.Channel <- testutil.NewTime(1, 1, 0)
+			ticker.Channel <- gcmtesting.NewTime(1, 1, 0)
 			Eventually(isRunning.Load).Should(BeTrue())
 			Consistently(isRunning.Load).Should(BeTrue())
 			// Ensure the first precondition to scraper.Start() exiting - context cancelled. After that it will only be
@@ -219,7 +238,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 
 			// Arrange
 			scraper, idr, sq, _, ticker, metrics := newTestScraper()
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 9, 1, 9, 9)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 9, 1, 9, 9)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
@@ -228,7 +247,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 
 			for testIteration, expected := range []int32{2, 4, 8, 9} {
 				metrics.WorkerProcCount.Store(0)
-				now := testutil.NewTimeNowStub(3, 0, testIteration)
+				now := gcmtesting.NewTimeNowStub(3, 0, testIteration)
 				scraper.testIsolation.TimeNow = now
 				ticker.Channel <- now()
 				// Make sure some workers have started
@@ -243,21 +262,21 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 		It("if last shift managed to scrape all of its targets, should attempt scraping with one less worker", func() {
 			// Arrange
 			scraper, idr, sq, _, ticker, metrics := newTestScraper()
-			scraper.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 0, 0)
+			scraper.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
 			scraper.lastShiftScrapeTargetCount = 10
 			scraper.lastShiftWorkerCount = 10
 			for i := 0; i < 12; i++ {
 				sq.Queue = append(sq.Queue, &scrapeTarget{nsName, getIndexedPodName(i)})
 				idr.SetKapiData(nsName, getIndexedPodName(i), "", nil, "")
-				idr.SetKapiLastScrapeTime(nsName, getIndexedPodName(i), testutil.NewTime(1, 0, 0))
+				idr.SetKapiLastScrapeTime(nsName, getIndexedPodName(i), gcmtesting.NewTime(1, 0, 0))
 			}
-			scraper.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 1, 0)
+			scraper.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 0)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
 			// Act
 			go scraper.Start(ctx)
-			ticker.Channel <- testutil.NewTime(1, 1, 0)
+			ticker.Channel <- gcmtesting.NewTime(1, 1, 0)
 
 			Eventually(metrics.WorkerProcCount.Load).Should(Equal(int32(9)))
 		})
@@ -269,15 +288,15 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 			// Last shift scraped 10 out of 11 targets with 5 workers. This shift has 12 targets. Expected worker count
 			// at estimated worker velocity=2, is 6
 			scraper, idr, sq, _, ticker, metrics := newTestScraper()
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 11, 5, 1, 12)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 11, 5, 1, 12)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
 			// Act
 			go scraper.Start(ctx)
 
-			scraper.testIsolation.TimeNow = testutil.NewTimeNowStub(3, 0, 0)
-			ticker.Channel <- testutil.NewTime(3, 0, 0)
+			scraper.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(3, 0, 0)
+			ticker.Channel <- gcmtesting.NewTime(3, 0, 0)
 			Eventually(metrics.WorkerProcCount.Load).Should(Equal(int32(6)))
 			Consistently(metrics.WorkerProcCount.Load).Should(Equal(int32(6)))
 		})
@@ -287,15 +306,15 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 			// Last shift scraped 1 out of 6 targets with 6 workers. This shift has 3 new targets and 5 leftover
 			// targets. Expected worker count at bounded worker velocity=0.133..->1, is 8
 			scraper, idr, sq, _, ticker, metrics := newTestScraper()
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 6, 6, 5, 8)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 6, 6, 5, 8)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
 			// Act
 			go scraper.Start(ctx)
 
-			scraper.testIsolation.TimeNow = testutil.NewTimeNowStub(3, 0, 0)
-			ticker.Channel <- testutil.NewTime(3, 0, 0)
+			scraper.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(3, 0, 0)
+			ticker.Channel <- gcmtesting.NewTime(3, 0, 0)
 			Eventually(metrics.WorkerProcCount.Load).Should(Equal(int32(8)))
 			Consistently(metrics.WorkerProcCount.Load).Should(Equal(int32(8)))
 		})
@@ -305,15 +324,15 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 			// Last shift scraped 1 out of 6 targets with 6 workers. This shift has 10 new targets and 5 leftover
 			// targets. Expected worker count at bounded worker velocity=0.133..->1, is 15, but should be capped to 10
 			scraper, idr, sq, _, ticker, metrics := newTestScraper()
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 6, 6, 5, 15)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 6, 6, 5, 15)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
 			// Act
 			go scraper.Start(ctx)
 
-			scraper.testIsolation.TimeNow = testutil.NewTimeNowStub(3, 0, 0)
-			ticker.Channel <- testutil.NewTime(3, 0, 0)
+			scraper.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(3, 0, 0)
+			ticker.Channel <- gcmtesting.NewTime(3, 0, 0)
 			Eventually(metrics.WorkerProcCount.Load).Should(Equal(int32(10)))
 			Consistently(metrics.WorkerProcCount.Load).Should(Equal(int32(10)))
 		})
@@ -321,7 +340,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 		It("should respect minShiftWorkerCount", func() {
 			// Arrange
 			scraper, idr, sq, _, ticker, metrics := newTestScraper()
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 0, 5, 0, 0)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 0, 5, 0, 0)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
@@ -330,7 +349,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 
 			for i := 0; i < 20; i++ {
 				metrics.WorkerProcCount.Store(0)
-				now := testutil.NewTimeNowStub(3, 0, i)
+				now := gcmtesting.NewTimeNowStub(3, 0, i)
 				scraper.testIsolation.TimeNow = now
 				ticker.Channel <- now()
 				// Make sure workers have started
@@ -345,7 +364,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 		It("if the queue is empty, should slowly reduce the number of workers to 1", func() {
 			// Arrange
 			scraper, idr, sq, _, ticker, metrics := newTestScraper()
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 0, 5, 0, 0)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 0, 5, 0, 0)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
@@ -354,7 +373,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 
 			for testIteration, expected := range []int32{4, 3, 2, 1, 1} {
 				metrics.WorkerProcCount.Store(0)
-				now := testutil.NewTimeNowStub(3, 0, testIteration)
+				now := gcmtesting.NewTimeNowStub(3, 0, testIteration)
 				scraper.testIsolation.TimeNow = now
 				ticker.Channel <- now()
 				Eventually(metrics.WorkerProcCount.Load).Should(Equal(expected))
@@ -367,7 +386,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 		It("should respect maxActiveWorkerCount", func() {
 			// Arrange
 			scraper, idr, sq, _, ticker, metrics := newTestScraper()
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 5, 5, 1, 10)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 5, 5, 1, 10)
 			scraper.activeWorkerCount.Add(41) // Simulate lots of workers, limit is 50
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
@@ -375,8 +394,8 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 			// Act
 			go scraper.Start(ctx)
 
-			scraper.testIsolation.TimeNow = testutil.NewTimeNowStub(3, 0, 0)
-			ticker.Channel <- testutil.NewTime(3, 0, 0)
+			scraper.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(3, 0, 0)
+			ticker.Channel <- gcmtesting.NewTime(3, 0, 0)
 			// 10 targets at velocity 1 should cause 10 workers. However, because 41 out of a max of 50 workers are
 			// counted as active, new workers should be capped to 9
 			Eventually(metrics.WorkerProcCount.Load).Should(Equal(int32(9)))
@@ -388,7 +407,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 			schedulingPeriod := 100 * time.Millisecond
 			fakeTicker := newFakeTicker()
 			scraper := NewScraper(
-				&input_data_registry.FakeInputDataRegistry{}, time.Minute, schedulingPeriod, logr.Discard())
+				&fakes.FakeInputDataRegistry{}, time.Minute, schedulingPeriod, ScraperOptions{}, logr.Discard())
 			scraper.testIsolation.NewTicker = func(period time.Duration) ticker {
 				fakeTicker.Period.Store(int64(period))
 				return fakeTicker
@@ -406,7 +425,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 		It("should schedule scrape shifts when and only when the ticket ticks", func() {
 			// Arrange
 			scraper, idr, sq, _, ticker, metrics := newTestScraper()
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 5, 5, 1, 5)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 5, 5, 1, 5)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
@@ -414,7 +433,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 			go scraper.Start(ctx)
 
 			for i := 0; i < 3; i++ {
-				now := testutil.NewTimeNowStub(3, i, 0)
+				now := gcmtesting.NewTimeNowStub(3, i, 0)
 				scraper.testIsolation.TimeNow = now
 				ticker.Channel <- now()
 				Eventually(metrics.WorkerProcCount.Load).Should(Equal(int32((i + 1) * 5)))
@@ -428,7 +447,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 		It("polls the targets returned by GetNext(),until the context is cancelled", func() {
 			// Arrange
 			scraper, idr, sq, client, _, _ := newTestScraper()
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 1, 1, 0, 1)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 1, 1, 0, 1)
 			scraper.workerWaitGroup.Add(1)
 			scraper.activeWorkerCount.Add(1)
 			ctx, cancel := context.WithCancel(context.Background())
@@ -439,15 +458,16 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 			Eventually(client.WasScraped.Load).Should(BeTrue())
 			Consistently(func() bool { return client.WasScraped.Swap(false) }).Should(BeTrue())
 			cancel()
-			Eventually(func() bool { return client.WasScraped.Swap(false) }).Should(BeFalse())
+			// A scrape may still be in flight. Wait for the worker to exit, before checking that scraping stopped.
+			Eventually(scraper.activeWorkerCount.Load).Should(BeZero())
+			client.WasScraped.Store(false)
 			Consistently(client.WasScraped.Load).Should(BeFalse())
-			Expect(scraper.activeWorkerCount.Load()).To(BeZero())
 		})
 
 		It("if context has not been cancelled, polls the queue until GetNext() returns nil", func() {
 			// Arrange
 			scraper, idr, sq, client, _, _ := newTestScraper()
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 1, 1, 0, 1)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 1, 1, 0, 1)
 			scraper.workerWaitGroup.Add(1)
 			scraper.activeWorkerCount.Add(1)
 			ctx, cancel := context.WithCancel(context.Background())
@@ -458,9 +478,10 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 			Eventually(client.WasScraped.Load).Should(BeTrue())
 			Consistently(func() bool { return client.WasScraped.Swap(false) }).Should(BeTrue())
 			sq.EmptyQueue()
-			Eventually(func() bool { return client.WasScraped.Swap(false) }).Should(BeFalse())
+			// A scrape may still be in flight. Wait for the worker to exit, before checking that scraping stopped.
+			Eventually(scraper.activeWorkerCount.Load).Should(BeZero())
+			client.WasScraped.Store(false)
 			Consistently(client.WasScraped.Load).Should(BeFalse())
-			Expect(scraper.activeWorkerCount.Load()).To(BeZero())
 		})
 
 		It("if context has been cancelled, exits before scraping the queue", func() {
@@ -477,11 +498,11 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 			Expect(scraper.activeWorkerCount.Load()).To(BeZero())
 		})
 
-		It("should scrape each target returned by the queue", func() {
+		It("should scrape and release each target returned by the queue", func() {
 			// Arrange
 			scraper, idr, sq, _, _, _ := newTestScraper()
 			sq.IsNoRequeue = true
-			setScraperState(scraper, idr, sq, testutil.NewTime(2, 0, 0), 5, 5, 0, 5)
+			setScraperState(scraper, idr, sq, gcmtesting.NewTime(2, 0, 0), 5, 5, 0, 5)
 			scraper.workerWaitGroup.Add(1)
 			scraper.activeWorkerCount.Add(1)
 			ctx, cancel := context.WithCancel(context.Background())
@@ -495,6 +516,7 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 			for _, kapi := range idr.GetKapis() {
 				Expect(kapi.TotalRequestCountNew).To(Equal(fakeMetricsClientMetricsValue))
 			}
+			Expect(sq.ReleaseCount).To(Equal(5))
 		})
 
 		Context("when scraping a target", func() {
@@ -551,6 +573,64 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 				Expect(idr.GetKapiData(target.Namespace, target.PodName).MetricsTimeNew).To(BeZero())
 			})
 
+			It("should use the fallback CA certificates, if the CA certificate is missing from the registry", func() {
+				// Arrange
+				scraper, idr, client, _, _ := arrangeWorkerTest()
+				idr.HasNoCACertificate = true
+				fallbackPool := getExampleCertPool()
+				scraper.caFallback = newCAFallback(0, fallbackPool)
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				Expect(client.WasScraped.Load()).To(BeTrue())
+				Expect(client.lastCACertificates.Load()).To(BeIdenticalTo(fallbackPool))
+			})
+
+			It("should apply the shoot's scrape settings, which make the CA certificate unnecessary", func() {
+				// Arrange
+				scraper, idr, client, _, target := arrangeWorkerTest()
+				idr.HasNoCACertificate = true
+				idr.SetDefaultShootScrapeSettings(input_data_registry.ShootScrapeSettings{
+					Scheme:                input_data_registry.ScrapeSchemeHTTP,
+					InsecureSkipTLSVerify: true,
+				})
+				idr.SetKapiExtraMetricsUrls(target.Namespace, target.PodName, []string{"https://10.0.0.1:9443/metrics"})
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				Expect(client.WasScraped.Load()).To(BeTrue())
+				Expect(client.GetLastURL()).To(Equal("http://10.0.0.1:9443/metrics"))
+				Expect(client.lastInsecureSkipTLSVerify.Load()).To(BeTrue())
+			})
+
+			It("should pass the TLS server name from the shoot's scrape settings to the metrics client", func() {
+				// Arrange
+				scraper, idr, client, _, target := arrangeWorkerTest()
+				idr.SetShootScrapeSettings(target.Namespace, &input_data_registry.ShootScrapeSettings{
+					TLSServerName: input_data_registry.TLSServerNameAny,
+				})
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				Expect(client.WasScraped.Load()).To(BeTrue())
+				Expect(*client.lastServerName.Load()).To(Equal(input_data_registry.TLSServerNameAny))
+			})
+
 			It("should record the resulting metric value in the registry", func() {
 				// Arrange
 				scraper, idr, _, _, target := arrangeWorkerTest()
@@ -566,6 +646,238 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 				}).Should(Equal(fakeMetricsClientMetricsValue))
 			})
 
+			It("should record the scrape duration in the registry, and in the shoot's scrape duration histogram", func() {
+				// Arrange
+				scraper, idr, _, _, target := arrangeWorkerTest()
+				forgetShootScrapeDurations(target.Namespace)
+				var callCount atomic.Int64
+				scraper.testIsolation.TimeNow = func() time.Time {
+					return gcmtesting.NewTime(2, 0, 0).Add(time.Duration(callCount.Add(1)) * 250 * time.Millisecond)
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				kapi := idr.GetKapiData(target.Namespace, target.PodName)
+				Expect(kapi.ScrapeDurationHistory.Durations()).To(Equal([]time.Duration{250 * time.Millisecond}))
+				histogram := &dto.Metric{}
+				Expect(scrapeDurationSeconds.WithLabelValues(target.Namespace).(prometheus.Metric).Write(histogram)).
+					To(Succeed())
+				Expect(histogram.GetHistogram().GetSampleCount()).To(Equal(uint64(1)))
+				Expect(histogram.GetHistogram().GetSampleSum()).To(Equal(0.25))
+			})
+
+			It("should report the successful scrape to the condition", func() {
+				// Arrange
+				scraper, _, _, _, _ := arrangeWorkerTest()
+				conditionRegistry := conditions.NewRegistry(logr.Discard())
+				scraper.condition = conditionRegistry.NewReporter("ScraperDegraded", 1, true)
+				scraper.condition.ReportError(errors.New("test error"))
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				Eventually(func() metav1.ConditionStatus {
+					return conditionRegistry.Conditions()[0].Status
+				}).Should(Equal(metav1.ConditionFalse))
+			})
+
+			It("should record the sum of the request counters scraped from all metrics endpoints of the pod", func() {
+				// Arrange
+				scraper, idr, _, _, target := arrangeWorkerTest()
+				idr.SetKapiExtraMetricsUrls(target.Namespace, target.PodName, []string{"https://10.0.0.1:9443/metrics"})
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				kapi := idr.GetKapiData(target.Namespace, target.PodName)
+				Expect(kapi.TotalRequestCountNew).To(Equal(2 * fakeMetricsClientMetricsValue))
+				Expect(kapi.InflightRequestCount).To(Equal(fakeMetricsClientInflightMetricsValue))
+			})
+
+			It("should count an extra metrics endpoint which serves no request counters as zero", func() {
+				// Arrange
+				scraper, idr, client, _, target := arrangeWorkerTest()
+				extraUrl := "https://10.0.0.1:9443/metrics"
+				idr.SetKapiExtraMetricsUrls(target.Namespace, target.PodName, []string{extraUrl})
+				client.URLErrors = map[string]error{
+					extraUrl: withCategory(input_data_registry.ScrapeErrorParse, fmt.Errorf("test: %w", errNoRequestCounters)),
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				kapi := idr.GetKapiData(target.Namespace, target.PodName)
+				Expect(kapi.TotalRequestCountNew).To(Equal(fakeMetricsClientMetricsValue))
+				Expect(kapi.FaultCount).To(BeZero())
+			})
+
+			It("should fail the scrape, if an extra metrics endpoint fails for another reason", func() {
+				// Arrange
+				scraper, idr, client, _, target := arrangeWorkerTest()
+				extraUrl := "https://10.0.0.1:9443/metrics"
+				idr.SetKapiExtraMetricsUrls(target.Namespace, target.PodName, []string{extraUrl})
+				client.URLErrors = map[string]error{extraUrl: errors.New("test error")}
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				kapi := idr.GetKapiData(target.Namespace, target.PodName)
+				Expect(kapi.TotalRequestCountNew).To(BeZero())
+				Expect(kapi.FaultCount).To(Equal(1))
+			})
+
+			It("should record the resulting inflight request count in the registry", func() {
+				// Arrange
+				scraper, idr, _, _, target := arrangeWorkerTest()
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				Eventually(func() int64 {
+					return idr.GetKapiData(target.Namespace, target.PodName).InflightRequestCount
+				}).Should(Equal(fakeMetricsClientInflightMetricsValue))
+			})
+
+			It("should trace the scrape and the registry write", func() {
+				// Arrange
+				recorder := tracetest.NewSpanRecorder()
+				otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+				DeferCleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+				scraper, _, _, _, target := arrangeWorkerTest()
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				spans := recorder.Ended()
+				Expect(spans).To(HaveLen(2))
+				Expect(spans[0].Name()).To(Equal("registry write"))
+				Expect(spans[1].Name()).To(Equal("scrape"))
+				Expect(spans[0].Parent().SpanID()).To(Equal(spans[1].SpanContext().SpanID()))
+				Expect(spans[1].Attributes()).To(ContainElement(attribute.String("namespace", target.Namespace)))
+			})
+
+			It("should route the scrape through the proxy resolved for the target's namespace", func() {
+				// Arrange
+				scraper, _, client, _, target := arrangeWorkerTest()
+				scraper.proxyURLTemplate = "http://tunnel.{namespace}.svc:8132"
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				Expect(client.WasScraped.Load()).To(BeTrue())
+				Expect(client.GetLastProxyURL().String()).To(Equal("http://tunnel." + target.Namespace + ".svc:8132"))
+			})
+
+			It("should apply the shoot's own proxy URL, in place of the global one, and its extra headers", func() {
+				// Arrange
+				scraper, idr, client, _, target := arrangeWorkerTest()
+				scraper.proxyURLTemplate = "http://tunnel.{namespace}.svc:8132"
+				shootProxyURL, _ := neturl.Parse("socks5://shoot-proxy:1080")
+				idr.SetShootScrapeRequestSettings(target.Namespace, &input_data_registry.ShootScrapeRequestSettings{
+					Headers:  http.Header{"X-Proxy-Token": {"abc"}},
+					ProxyURL: shootProxyURL,
+				})
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				Expect(client.WasScraped.Load()).To(BeTrue())
+				Expect(client.GetLastProxyURL()).To(Equal(shootProxyURL))
+				Expect(client.GetLastRequestHeaders()).To(Equal(http.Header{"X-Proxy-Token": {"abc"}}))
+			})
+
+			It("should scrape via the port-forward client, without proxy, if the shoot uses port-forward", func() {
+				// Arrange
+				scraper, idr, directClient, _, target := arrangeWorkerTest()
+				scraper.proxyURLTemplate = "http://tunnel.{namespace}.svc:8132"
+				portForwardClient := &fakeMetricsClient{}
+				scraper.testIsolation.NewPortForwardMetricsClient = func() metricsClient { return portForwardClient }
+				idr.SetDefaultShootScrapeSettings(input_data_registry.ShootScrapeSettings{
+					Transport: input_data_registry.ScrapeTransportPortForward,
+				})
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				Expect(directClient.WasScraped.Load()).To(BeFalse())
+				Expect(portForwardClient.WasScraped.Load()).To(BeTrue())
+				Expect(portForwardClient.GetLastProxyURL()).To(BeNil())
+				Expect(*portForwardClient.lastPortForwardTarget.Load()).To(Equal(
+					portForwardTarget{namespace: target.Namespace, podName: target.PodName}))
+			})
+
+			It("should fail the scrape, if the shoot uses port-forward, and that transport is not available", func() {
+				// Arrange
+				scraper, idr, directClient, _, target := arrangeWorkerTest()
+				idr.SetDefaultShootScrapeSettings(input_data_registry.ShootScrapeSettings{
+					Transport: input_data_registry.ScrapeTransportPortForward,
+				})
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				Expect(directClient.WasScraped.Load()).To(BeFalse())
+				Expect(idr.GetKapiData(target.Namespace, target.PodName).TotalRequestCountNew).To(BeZero())
+			})
+
+			It("should not route the scrape through a proxy, if no proxy is configured", func() {
+				// Arrange
+				scraper, _, client, _, _ := arrangeWorkerTest()
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				Expect(client.WasScraped.Load()).To(BeTrue())
+				Expect(client.GetLastProxyURL()).To(BeNil())
+			})
+
 			It("should use scrapePeriod / 2 as timeout for individual scrapes", func() {
 				// Arrange
 				scraper, _, client, _, _ := arrangeWorkerTest()
@@ -584,8 +896,288 @@ var _ = Describe("input.metrics_scraper.Scraper", func() {
 				// fakeMetricsClient.GetLastContextDuration.
 				// Use generous 10% margin to avoid test flakiness due to sensitivity to timing
 				Expect(math.Abs(relativeDifference) < 0.1).To(BeTrue())
-				Expect(scraper.scrapeTimeout).To(Equal(scrapePeriod / 2))
+				Expect(time.Duration(scraper.scrapeTimeout.Load())).To(Equal(scrapePeriod / 2))
+			})
+
+			It("should not scrape targets in namespaces owned by another replica, and exclude them from coverage", func() {
+				// Arrange
+				scraper, idr, client, _, target := arrangeWorkerTest()
+				var askedNamespace atomic.Value
+				scraper.isNamespaceOwned = func(namespace string) bool {
+					askedNamespace.Store(namespace)
+					return false
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				Expect(client.WasScraped.Load()).To(BeFalse())
+				Expect(askedNamespace.Load()).To(Equal(target.Namespace))
+				Expect(idr.GetKapiData(target.Namespace, target.PodName).ScrapeExcluded).To(BeTrue())
 			})
+
+			It("should include scraped targets in coverage", func() {
+				// Arrange
+				scraper, idr, _, _, target := arrangeWorkerTest()
+				idr.SetKapiScrapeExcluded(target.Namespace, target.PodName, true)
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				Expect(idr.GetKapiData(target.Namespace, target.PodName).ScrapeExcluded).To(BeFalse())
+			})
+
+			Context("with an event recorder", func() {
+				// Applied to objects created by arrangeWorkerTest. Attaches a fake event recorder with the specified
+				// fault event threshold, and makes the scraper run once per scrape() call.
+				arrangeEventTest := func(scraper *Scraper, threshold int) *record.FakeRecorder {
+					recorder := record.NewFakeRecorder(10)
+					scraper.eventRecorder = recorder
+					scraper.faultEventThreshold = threshold
+					return recorder
+				}
+
+				It("should record a warning event once the fault threshold is reached, and a normal event upon "+
+					"recovery", func() {
+					// Arrange
+					scraper, _, client, _, target := arrangeWorkerTest()
+					recorder := arrangeEventTest(scraper, 2)
+					client.Err = errors.New("test error")
+					ctx := context.Background()
+
+					// Act
+					scraper.scrape(ctx, target)
+					eventsAfterFirstFault := len(recorder.Events)
+					scraper.scrape(ctx, target)
+					scraper.scrape(ctx, target)
+					eventsAfterThreeFaults := len(recorder.Events)
+					client.Err = nil
+					scraper.scrape(ctx, target)
+					scraper.scrape(ctx, target)
+
+					// Assert
+					Expect(eventsAfterFirstFault).To(BeZero())
+					Expect(eventsAfterThreeFaults).To(Equal(1))
+					Expect(recorder.Events).To(HaveLen(2))
+					warning := <-recorder.Events
+					Expect(warning).To(HavePrefix("Warning " + FaultEventReason))
+					Expect(warning).To(ContainSubstring("test error"))
+					Expect(<-recorder.Events).To(HavePrefix("Normal " + RecoveryEventReason))
+				})
+
+				It("should repeat the warning event only after the repeat period", func() {
+					// Arrange
+					scraper, _, client, _, target := arrangeWorkerTest()
+					recorder := arrangeEventTest(scraper, 1)
+					client.Err = errors.New("test error")
+					ctx := context.Background()
+					now := gcmtesting.NewTime(2, 0, 0)
+					scraper.testIsolation.TimeNow = func() time.Time { return now }
+
+					// Act
+					scraper.scrape(ctx, target)
+					now = now.Add(faultEventRepeatPeriod - time.Second)
+					scraper.scrape(ctx, target)
+					eventsBeforeRepeatPeriod := len(recorder.Events)
+					now = now.Add(time.Second)
+					scraper.scrape(ctx, target)
+
+					// Assert
+					Expect(eventsBeforeRepeatPeriod).To(Equal(1))
+					Expect(recorder.Events).To(HaveLen(2))
+				})
+
+				It("should not record events if the threshold is zero", func() {
+					// Arrange
+					scraper, _, client, _, target := arrangeWorkerTest()
+					recorder := arrangeEventTest(scraper, 0)
+					client.Err = errors.New("test error")
+
+					// Act
+					scraper.scrape(context.Background(), target)
+					client.Err = nil
+					scraper.scrape(context.Background(), target)
+
+					// Assert
+					Expect(recorder.Events).To(BeEmpty())
+				})
+			})
+
+			It("should record the category of a failed scrape in the registry and in the failure counter", func() {
+				// Arrange
+				scraper, idr, client, _, target := arrangeWorkerTest()
+				client.Err = withCategory(input_data_registry.ScrapeErrorAuth, errors.New("test error"))
+				counter := scrapeFailureCount.WithLabelValues(string(input_data_registry.ScrapeErrorAuth))
+				failuresBefore := promtestutil.ToFloat64(counter)
+
+				// Act
+				scraper.scrape(context.Background(), target)
+
+				// Assert
+				kapi := idr.GetKapiData(target.Namespace, target.PodName)
+				Expect(kapi.FaultCount).To(Equal(1))
+				Expect(kapi.LastFaultCategory).To(Equal(input_data_registry.ScrapeErrorAuth))
+				Expect(promtestutil.ToFloat64(counter)).To(Equal(failuresBefore + 1))
+			})
+
+			Context("with a pod refresh function", func() {
+				// Applied to objects created by arrangeWorkerTest. Attaches a refresh function which records the pods
+				// it is called for.
+				arrangeRefreshTest := func(scraper *Scraper) *[]string {
+					var refreshed []string
+					scraper.refreshPod = func(namespace string, podName string) {
+						refreshed = append(refreshed, namespace+"/"+podName)
+					}
+					return &refreshed
+				}
+
+				It("should request a refresh of the pod, if the connection is refused", func() {
+					// Arrange
+					scraper, _, client, _, target := arrangeWorkerTest()
+					refreshed := arrangeRefreshTest(scraper)
+					client.Err = fmt.Errorf("get metrics: %w", syscall.ECONNREFUSED)
+
+					// Act
+					scraper.scrape(context.Background(), target)
+
+					// Assert
+					Expect(*refreshed).To(Equal([]string{target.Namespace + "/" + target.PodName}))
+				})
+
+				It("should not request a refresh of the pod upon other errors", func() {
+					// Arrange
+					scraper, _, client, _, target := arrangeWorkerTest()
+					refreshed := arrangeRefreshTest(scraper)
+					client.Err = errors.New("test error")
+
+					// Act
+					scraper.scrape(context.Background(), target)
+
+					// Assert
+					Expect(*refreshed).To(BeEmpty())
+				})
+
+				It("should not request a refresh of the pod, if the scrape is routed through a proxy", func() {
+					// Arrange
+					scraper, _, client, _, target := arrangeWorkerTest()
+					refreshed := arrangeRefreshTest(scraper)
+					scraper.proxyURLTemplate = "http://tunnel.{namespace}.svc:8132"
+					client.Err = fmt.Errorf("get metrics: %w", syscall.ECONNREFUSED)
+
+					// Act
+					scraper.scrape(context.Background(), target)
+
+					// Assert
+					Expect(*refreshed).To(BeEmpty())
+				})
+			})
+
+			It("should not scrape targets in namespaces excluded by the namespace filter", func() {
+				// Arrange
+				scraper, _, client, _, target := arrangeWorkerTest()
+				scraper.SetNamespaceFilter(NamespaceFilter{Exclude: []string{target.Namespace}})
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// Act
+				go scraper.workerProc(ctx)
+
+				// Assert
+				scraper.workerWaitGroup.Wait()
+				Expect(client.WasScraped.Load()).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("SetScrapePeriod", func() {
+		It("should update the queue's scrape period and the scrape timeout", func() {
+			// Arrange
+			scraper, _, queue, _, _, _ := newTestScraper()
+
+			// Act
+			scraper.SetScrapePeriod(10 * time.Second)
+
+			// Assert
+			Expect(queue.ScrapePeriod).To(Equal(10 * time.Second))
+			Expect(time.Duration(scraper.scrapeTimeout.Load())).To(Equal(5 * time.Second))
+		})
+	})
+
+	Describe("NotifyNamespaceQueried", func() {
+		It("should mark the shoot as consumed, until it is not queried for the length of the consumer window", func() {
+			// Arrange
+			scraper, _, queue, _, _, _ := newTestScraper()
+			scraper.consumers = newConsumerTracker(time.Minute)
+			scraper.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+
+			// Act
+			scraper.NotifyNamespaceQueried(nsName)
+			isConsumed := queue.IsNamespaceConsumed(nsName)
+			scraper.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 59)
+			scraper.expireConsumers()
+			isConsumedWithinWindow := queue.IsNamespaceConsumed(nsName)
+			scraper.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+			scraper.expireConsumers()
+
+			// Assert
+			Expect(isConsumed).To(BeTrue())
+			Expect(isConsumedWithinWindow).To(BeTrue())
+			Expect(queue.IsNamespaceConsumed(nsName)).To(BeFalse())
+		})
+		It("should have no effect, if background scraping is disabled", func() {
+			// Arrange
+			scraper, _, queue, _, _, _ := newTestScraper()
+
+			// Act
+			scraper.NotifyNamespaceQueried(nsName)
+
+			// Assert
+			Expect(queue.ConsumedNamespaces).To(BeEmpty())
+		})
+	})
+
+	Describe("ResolveProxyURL", func() {
+		It("should return nil if the template is empty", func() {
+			// Act
+			result, err := ResolveProxyURL("", nsName)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result).To(BeNil())
+		})
+
+		It("should substitute the namespace placeholder", func() {
+			// Act
+			result, err := ResolveProxyURL("socks5://{namespace}.tunnel:1080", "shoot--a--b")
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result.String()).To(Equal("socks5://shoot--a--b.tunnel:1080"))
+		})
+
+		It("should fail if the scheme is not supported", func() {
+			// Act
+			_, err := ResolveProxyURL("ftp://tunnel:1080", nsName)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unsupported proxy URL scheme"))
+		})
+
+		It("should fail if the URL does not specify a host", func() {
+			// Act
+			_, err := ResolveProxyURL("http://", nsName)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
 		})
 	})
 })
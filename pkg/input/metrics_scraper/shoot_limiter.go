@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"time"
+)
+
+// shootLimiterSweepPeriod is how often the shootLimiter drops the records of shoots which are no longer subject to
+// limiting
+const shootLimiterSweepPeriod = time.Minute
+
+// ShootScrapeLimits caps the scrape load which a single shoot receives, regardless of how many Kapi pods it has. Zero
+// values mean no limit.
+type ShootScrapeLimits struct {
+	// MaxConcurrency is the maximum number of scrapes of the same shoot, which are in progress at the same time
+	MaxConcurrency int
+	// MaxRate is the maximum number of scrapes of the same shoot, per second
+	MaxRate float64
+	// MaxFirstScrapeConcurrency is the maximum number of first scrapes of newly added Kapis of the same shoot, which
+	// are in progress at the same time. First scrapes also count towards MaxConcurrency.
+	MaxFirstScrapeConcurrency int
+}
+
+// IsZero returns true if the limits do not limit anything
+func (limits ShootScrapeLimits) IsZero() bool {
+	return limits.MaxConcurrency <= 0 && limits.MaxRate <= 0 && limits.MaxFirstScrapeConcurrency <= 0
+}
+
+// shootLimiter enforces ShootScrapeLimits, by tracking the scrapes in progress, and the start time of the last scrape,
+// for each shoot namespace.
+//
+// The shootLimiter is not concurrency-safe. The scrape queue protects it with its own lock.
+type shootLimiter struct {
+	limits ShootScrapeLimits
+	// The minimum time between the starts of two scrapes of the same shoot. Zero if the rate is not limited.
+	minInterval time.Duration
+	// Only shoots which are currently subject to limiting have a record here
+	shoots map[string]*shootLimiterRecord
+	// When did the last sweep of records which are no longer necessary take place
+	lastSweepTime time.Time
+}
+
+// shootLimiterRecord is the shootLimiter's record of a single shoot
+type shootLimiterRecord struct {
+	inProgressCount            int       // Scrapes which started, but did not finish yet
+	firstScrapeInProgressCount int       // How many of the scrapes in inProgressCount are first scrapes of their Kapis
+	lastStartTime              time.Time // When did the last scrape start
+}
+
+// newShootLimiter creates a shootLimiter which enforces the specified limits
+func newShootLimiter(limits ShootScrapeLimits) *shootLimiter {
+	l := &shootLimiter{
+		limits: limits,
+		shoots: make(map[string]*shootLimiterRecord),
+	}
+	if limits.MaxRate > 0 {
+		l.minInterval = time.Duration(float64(time.Second) / limits.MaxRate)
+	}
+	return l
+}
+
+// IsAvailable returns true if a scrape of the specified shoot may start at the specified time. isFirstScrape specifies
+// whether the scrape would be the first one of its Kapi.
+func (l *shootLimiter) IsAvailable(namespace string, now time.Time, isFirstScrape bool) bool {
+	record := l.shoots[namespace]
+	if record == nil {
+		return true
+	}
+	if l.limits.MaxConcurrency > 0 && record.inProgressCount >= l.limits.MaxConcurrency {
+		return false
+	}
+	if isFirstScrape && l.limits.MaxFirstScrapeConcurrency > 0 &&
+		record.firstScrapeInProgressCount >= l.limits.MaxFirstScrapeConcurrency {
+		return false
+	}
+	return !now.Before(record.lastStartTime.Add(l.minInterval))
+}
+
+// Acquire records that a scrape of the specified shoot starts at the specified time. The caller is expected to have
+// checked IsAvailable first, and to call Release, with the same isFirstScrape value, once the scrape is over.
+func (l *shootLimiter) Acquire(namespace string, now time.Time, isFirstScrape bool) {
+	l.sweep(now)
+
+	record := l.shoots[namespace]
+	if record == nil {
+		record = &shootLimiterRecord{}
+		l.shoots[namespace] = record
+	}
+	record.inProgressCount++
+	if isFirstScrape {
+		record.firstScrapeInProgressCount++
+	}
+	record.lastStartTime = now
+}
+
+// Release records that a scrape of the specified shoot, previously recorded via Acquire, is over
+func (l *shootLimiter) Release(namespace string, now time.Time, isFirstScrape bool) {
+	record := l.shoots[namespace]
+	if record == nil {
+		return
+	}
+	if record.inProgressCount > 0 {
+		record.inProgressCount--
+	}
+	if isFirstScrape && record.firstScrapeInProgressCount > 0 {
+		record.firstScrapeInProgressCount--
+	}
+	if l.isIdle(record, now) {
+		delete(l.shoots, namespace)
+	}
+}
+
+// Count returns the number of shoots which have a record
+func (l *shootLimiter) Count() int {
+	return len(l.shoots)
+}
+
+// isIdle returns true if the record no longer limits scraping of its shoot, and can be dropped
+func (l *shootLimiter) isIdle(record *shootLimiterRecord, now time.Time) bool {
+	return record.inProgressCount == 0 &&
+		record.firstScrapeInProgressCount == 0 &&
+		!now.Before(record.lastStartTime.Add(l.minInterval))
+}
+
+// sweep drops the records which no longer limit scraping. Release drops a record, if it is idle at the time of the
+// call, but with a rate limit, a record is typically released before it becomes idle. To keep the cost of frequent
+// calls low, a full pass is made no more than once per shootLimiterSweepPeriod.
+func (l *shootLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweepTime) < shootLimiterSweepPeriod {
+		return
+	}
+	l.lastSweepTime = now
+
+	for namespace, record := range l.shoots {
+		if l.isIdle(record, now) {
+			delete(l.shoots, namespace)
+		}
+	}
+}
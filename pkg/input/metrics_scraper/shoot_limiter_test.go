@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("input.metrics_scraper.shootLimiter", func() {
+	const nsName = "shoot--my-shoot"
+
+	It("should limit the number of scrapes in progress per shoot", func() {
+		// Arrange
+		limiter := newShootLimiter(ShootScrapeLimits{MaxConcurrency: 2})
+		now := gcmtesting.NewTime(1, 0, 0)
+
+		// Act
+		limiter.Acquire(nsName, now, false)
+		isAvailableAfterOne := limiter.IsAvailable(nsName, now, false)
+		limiter.Acquire(nsName, now, false)
+		isAvailableAfterTwo := limiter.IsAvailable(nsName, now, false)
+		isOtherAvailable := limiter.IsAvailable(nsName+"2", now, false)
+		limiter.Release(nsName, now, false)
+		isAvailableAfterRelease := limiter.IsAvailable(nsName, now, false)
+
+		// Assert
+		Expect(isAvailableAfterOne).To(BeTrue())
+		Expect(isAvailableAfterTwo).To(BeFalse())
+		Expect(isOtherAvailable).To(BeTrue())
+		Expect(isAvailableAfterRelease).To(BeTrue())
+	})
+
+	It("should limit the number of first scrapes in progress per shoot, without limiting other scrapes", func() {
+		// Arrange
+		limiter := newShootLimiter(ShootScrapeLimits{MaxFirstScrapeConcurrency: 1})
+		now := gcmtesting.NewTime(1, 0, 0)
+
+		// Act
+		limiter.Acquire(nsName, now, true)
+		isFirstAvailable := limiter.IsAvailable(nsName, now, true)
+		isOtherAvailable := limiter.IsAvailable(nsName, now, false)
+		limiter.Release(nsName, now, true)
+		isFirstAvailableAfterRelease := limiter.IsAvailable(nsName, now, true)
+
+		// Assert
+		Expect(isFirstAvailable).To(BeFalse())
+		Expect(isOtherAvailable).To(BeTrue())
+		Expect(isFirstAvailableAfterRelease).To(BeTrue())
+		Expect(limiter.Count()).To(BeZero())
+	})
+
+	It("should limit the rate of scrapes per shoot", func() {
+		// Arrange
+		limiter := newShootLimiter(ShootScrapeLimits{MaxRate: 2})
+		limiter.Acquire(nsName, gcmtesting.NewTime(1, 0, 0), false)
+		limiter.Release(nsName, gcmtesting.NewTime(1, 0, 0), false)
+
+		// Act
+		isAvailableEarly := limiter.IsAvailable(nsName, gcmtesting.NewTime(1, 0, 0).Add(499*time.Millisecond), false)
+		isAvailableLater := limiter.IsAvailable(nsName, gcmtesting.NewTime(1, 0, 0).Add(500*time.Millisecond), false)
+
+		// Assert
+		Expect(isAvailableEarly).To(BeFalse())
+		Expect(isAvailableLater).To(BeTrue())
+	})
+
+	It("should drop the records of shoots which are no longer limited", func() {
+		// Arrange
+		limiter := newShootLimiter(ShootScrapeLimits{MaxConcurrency: 1, MaxRate: 1})
+		limiter.Acquire(nsName, gcmtesting.NewTime(1, 0, 0), false)
+		limiter.Release(nsName, gcmtesting.NewTime(1, 0, 0), false)
+		Expect(limiter.Count()).To(Equal(1)) // Still rate limited
+
+		// Act
+		limiter.Acquire(nsName+"2", gcmtesting.NewTime(1, 2, 0), false)
+
+		// Assert
+		Expect(limiter.Count()).To(Equal(1))
+		Expect(limiter.IsAvailable(nsName, gcmtesting.NewTime(1, 2, 0), false)).To(BeTrue())
+	})
+})
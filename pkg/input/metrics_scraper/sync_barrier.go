@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// How often the syncBarrier checks whether the shoots have auth data on record, while waiting
+const syncBarrierPollPeriod = 200 * time.Millisecond
+
+// syncBarrier holds off the first scrapes upon startup, until the controllers populate the registry with the data
+// necessary to scrape. Without it, targets which become due before the secret controller catches up are scraped in
+// vain, producing a burst of error logs. The barrier is bounded in time: once the timeout elapses after the barrier
+// starts, it no longer holds anything off.
+//
+// All methods are concurrency-safe.
+type syncBarrier struct {
+	dataRegistry input_data_registry.InputDataRegistry
+	// If not nil, blocks until the informers which feed the registry complete their initial sync
+	waitForInformerSync func(ctx context.Context) error
+	// Only shoots for which this returns true are waited for
+	isScraped func(namespace string) bool
+	// Zero disables the barrier
+	timeout time.Duration
+	log     logr.Logger
+
+	// The end of the barrier, in Unix nanoseconds. Zero before the barrier starts.
+	deadline atomic.Int64
+
+	testIsolation syncBarrierTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// newSyncBarrier creates a syncBarrier which waits at most timeout for the informers to sync, via waitForInformerSync,
+// and for the shoots with Kapis in dataRegistry, and for which isScraped returns true, to have auth data on record.
+// waitForInformerSync may be nil. A zero timeout disables the barrier.
+func newSyncBarrier(
+	dataRegistry input_data_registry.InputDataRegistry,
+	waitForInformerSync func(ctx context.Context) error,
+	isScraped func(namespace string) bool,
+	timeout time.Duration,
+	log logr.Logger) *syncBarrier {
+
+	return &syncBarrier{
+		dataRegistry:        dataRegistry,
+		waitForInformerSync: waitForInformerSync,
+		isScraped:           isScraped,
+		timeout:             timeout,
+		log:                 log,
+		testIsolation:       syncBarrierTestIsolation{TimeNow: time.Now, TimeAfter: time.After},
+	}
+}
+
+// Wait starts the barrier, as per the barrier's own clock, and blocks until the informers sync and all scraped shoots
+// with Kapis have auth data on record, until the barrier timeout elapses, or until the context is cancelled.
+func (b *syncBarrier) Wait(ctx context.Context) {
+	if b.timeout == 0 {
+		return
+	}
+	b.deadline.Store(b.testIsolation.TimeNow().Add(b.timeout).UnixNano())
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	if b.waitForInformerSync != nil {
+		if err := b.waitForInformerSync(ctx); err != nil {
+			b.log.V(app.VerbosityInfo).Info("The informers did not sync before the sync barrier timeout. Scraping anyway",
+				"reason", err.Error())
+			return
+		}
+	}
+
+	for {
+		pendingShootCount := b.countShootsWithoutAuth()
+		if pendingShootCount == 0 {
+			b.log.V(app.VerbosityInfo).Info("Sync barrier passed. Scraping")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			b.log.V(app.VerbosityInfo).Info("Some shoots have no auth data before the sync barrier timeout. Scraping anyway",
+				"shootCount", pendingShootCount)
+			return
+		case <-b.testIsolation.TimeAfter(syncBarrierPollPeriod):
+		}
+	}
+}
+
+// IsHolding returns true if, at the specified point in time, the barrier started, and its timeout has not elapsed yet.
+// While the barrier is holding, targets whose shoot lacks auth data are not worth reporting.
+func (b *syncBarrier) IsHolding(now time.Time) bool {
+	deadline := b.deadline.Load()
+	return deadline != 0 && now.UnixNano() < deadline
+}
+
+// countShootsWithoutAuth returns the number of scraped shoots which have Kapis in the registry, but no auth secret
+func (b *syncBarrier) countShootsWithoutAuth() int {
+	result := 0
+	for _, namespace := range b.dataRegistry.GetShootNamespaces() {
+		if !b.isScraped(namespace) || b.dataRegistry.GetShootAuthSecret(namespace) != "" {
+			continue
+		}
+		if len(b.dataRegistry.DataSource().GetShootKapis(namespace)) > 0 {
+			result++
+		}
+	}
+	return result
+}
+
+//#region Test isolation
+
+// syncBarrierTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the syncBarrier unit during tests
+type syncBarrierTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+	// Points to [time.After]
+	TimeAfter func(time.Duration) <-chan time.Time
+}
+
+//#endregion Test isolation
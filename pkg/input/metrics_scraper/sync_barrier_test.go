@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("input.metrics_scraper.syncBarrier", func() {
+	const (
+		testNs  = "shoot--my-shoot"
+		timeout = time.Minute
+	)
+
+	var (
+		isScrapedAll = func(string) bool { return true }
+		// Creates a registry with a single Kapi, whose shoot has no auth secret
+		newTestRegistry = func() input_data_registry.InputDataRegistry {
+			idr := input_data_registry.NewInputDataRegistry(time.Second, logr.Discard())
+			idr.SetKapiData(testNs, "pod1", "uid1", nil, "https://10.0.0.1/metrics")
+			return idr
+		}
+		// Runs Wait in the background. Returns a channel which is closed when Wait returns.
+		startWait = func(ctx context.Context, barrier *syncBarrier) chan struct{} {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				barrier.Wait(ctx)
+			}()
+			return done
+		}
+	)
+
+	Describe("Wait", func() {
+		It("should return once the informers synced, and the shoots with Kapis have auth data on record", func() {
+			// Arrange
+			idr := newTestRegistry()
+			informerSync := make(chan struct{})
+			waitForInformerSync := func(ctx context.Context) error {
+				<-informerSync
+				return nil
+			}
+			barrier := newSyncBarrier(idr, waitForInformerSync, isScrapedAll, timeout, logr.Discard())
+			poll := make(chan time.Time)
+			barrier.testIsolation.TimeAfter = func(time.Duration) <-chan time.Time { return poll }
+
+			// Act and assert
+			done := startWait(context.Background(), barrier)
+			Consistently(done, "50ms").ShouldNot(BeClosed())
+			close(informerSync)
+			poll <- time.Now() // Received once the barrier finds the shoot without auth data
+			Consistently(done, "50ms").ShouldNot(BeClosed())
+			idr.SetShootAuthSecret(testNs, "token")
+			poll <- time.Now()
+			Eventually(done).Should(BeClosed())
+		})
+		It("should not wait for shoots which are not scraped by this scraper", func() {
+			// Arrange
+			barrier := newSyncBarrier(
+				newTestRegistry(), nil, func(string) bool { return false }, timeout, logr.Discard())
+
+			// Act
+			done := startWait(context.Background(), barrier)
+
+			// Assert
+			Eventually(done).Should(BeClosed())
+		})
+		It("should stop waiting, once the timeout elapses", func() {
+			// Arrange
+			waitForInformerSync := func(ctx context.Context) error {
+				<-ctx.Done()
+				return errors.New("not synced")
+			}
+			barrier := newSyncBarrier(newTestRegistry(), waitForInformerSync, isScrapedAll, 50*time.Millisecond,
+				logr.Discard())
+
+			// Act
+			done := startWait(context.Background(), barrier)
+
+			// Assert
+			Eventually(done).Should(BeClosed())
+		})
+		It("should have no effect, if the timeout is zero", func() {
+			// Arrange
+			barrier := newSyncBarrier(newTestRegistry(), nil, isScrapedAll, 0, logr.Discard())
+
+			// Act
+			barrier.Wait(context.Background())
+
+			// Assert
+			Expect(barrier.IsHolding(gcmtesting.NewTime(1, 0, 0))).To(BeFalse())
+		})
+	})
+
+	Describe("IsHolding", func() {
+		It("should return true from the start of the barrier, until the timeout elapses", func() {
+			// Arrange
+			idr := newTestRegistry()
+			idr.SetShootAuthSecret(testNs, "token")
+			barrier := newSyncBarrier(idr, nil, isScrapedAll, timeout, logr.Discard())
+			barrier.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			isHoldingBeforeStart := barrier.IsHolding(gcmtesting.NewTime(1, 0, 0))
+
+			// Act
+			barrier.Wait(context.Background())
+
+			// Assert
+			Expect(isHoldingBeforeStart).To(BeFalse())
+			Expect(barrier.IsHolding(gcmtesting.NewTime(1, 0, 59))).To(BeTrue())
+			Expect(barrier.IsHolding(gcmtesting.NewTime(1, 1, 0))).To(BeFalse())
+		})
+	})
+})
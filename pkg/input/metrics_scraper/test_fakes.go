@@ -8,10 +8,15 @@ package metrics_scraper
 import (
 	"context"
 	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"k8s.io/apimachinery/pkg/util/httpstream"
+
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
 )
 
@@ -23,7 +28,11 @@ type fakeScrapeQueue struct {
 	isClosed     bool
 	ScrapePeriod time.Duration
 	IsNoRequeue  bool // If true, GetNext() permanently dequeues the head, instead re-queuing it on the back
-	lock         sync.Mutex
+	ReleaseCount int  // How many times Release() was called
+	// The arguments of the last SetBackgroundScrapePeriod and SetNamespaceConsumed calls
+	BackgroundScrapePeriod time.Duration
+	ConsumedNamespaces     map[string]bool
+	lock                   sync.Mutex
 }
 
 func newFakeScrapeQueue(registry input_data_registry.InputDataRegistry, scrapePeriod time.Duration) *fakeScrapeQueue {
@@ -46,6 +55,13 @@ func (fsq *fakeScrapeQueue) GetNext() *scrapeTarget {
 	return head
 }
 
+func (fsq *fakeScrapeQueue) Release(_ *scrapeTarget) {
+	fsq.lock.Lock()
+	defer fsq.lock.Unlock()
+
+	fsq.ReleaseCount++
+}
+
 func (fsq *fakeScrapeQueue) Count() int {
 	fsq.lock.Lock()
 	defer fsq.lock.Unlock()
@@ -71,6 +87,53 @@ func (fsq *fakeScrapeQueue) DueCount(dueAtTime time.Time, excludeUnscraped bool)
 	return dueCount
 }
 
+func (fsq *fakeScrapeQueue) SetScrapePeriod(scrapePeriod time.Duration) {
+	fsq.lock.Lock()
+	defer fsq.lock.Unlock()
+
+	fsq.ScrapePeriod = scrapePeriod
+}
+
+func (fsq *fakeScrapeQueue) SetBackgroundScrapePeriod(backgroundScrapePeriod time.Duration) {
+	fsq.lock.Lock()
+	defer fsq.lock.Unlock()
+
+	fsq.BackgroundScrapePeriod = backgroundScrapePeriod
+}
+
+func (fsq *fakeScrapeQueue) SetNamespaceConsumed(namespace string, isConsumed bool) {
+	fsq.lock.Lock()
+	defer fsq.lock.Unlock()
+
+	if fsq.ConsumedNamespaces == nil {
+		fsq.ConsumedNamespaces = make(map[string]bool)
+	}
+	fsq.ConsumedNamespaces[namespace] = isConsumed
+}
+
+// IsNamespaceConsumed returns the value last passed to SetNamespaceConsumed for the specified namespace
+func (fsq *fakeScrapeQueue) IsNamespaceConsumed(namespace string) bool {
+	fsq.lock.Lock()
+	defer fsq.lock.Unlock()
+
+	return fsq.ConsumedNamespaces[namespace]
+}
+
+func (fsq *fakeScrapeQueue) ExpediteNamespace(namespace string) int {
+	fsq.lock.Lock()
+	defer fsq.lock.Unlock()
+
+	count := 0
+	for _, target := range fsq.Queue {
+		if target.Namespace == namespace {
+			count++
+		}
+	}
+	return count
+}
+
+func (fsq *fakeScrapeQueue) Open(context.Context) {}
+
 func (fsq *fakeScrapeQueue) Close() (err error) {
 	fsq.lock.Lock()
 	defer fsq.lock.Unlock()
@@ -104,11 +167,25 @@ type scraperTestMetrics struct {
 //#region fakeMetricsClient
 
 type fakeMetricsClient struct {
-	WasScraped          atomic.Bool
+	WasScraped atomic.Bool
+	Err        error // If not nil, GetKapiInstanceMetrics fails with this error
+	// GetKapiInstanceMetrics fails with the error mapped to its URL, if any. Not to be modified while scraping.
+	URLErrors           map[string]error
 	lastContextDuration atomic.Int64
+	lastProxyURL        atomic.Pointer[url.URL]
+	lastURL             atomic.Pointer[string]
+
+	lastInsecureSkipTLSVerify atomic.Bool
+	lastServerName            atomic.Pointer[string]
+	lastPortForwardTarget     atomic.Pointer[portForwardTarget]
+	lastCACertificates        atomic.Pointer[x509.CertPool]
+	lastRequestHeaders        atomic.Pointer[http.Header]
 }
 
-const fakeMetricsClientMetricsValue int64 = 777
+const (
+	fakeMetricsClientMetricsValue         int64 = 777
+	fakeMetricsClientInflightMetricsValue int64 = 33
+)
 
 // GetLastContextDuration returns an approximation of the duration constraint of the context passed to the last
 // GetKapiInstanceMetrics call. The value is inaccurate, because contexts have a deadline, instead of duration.
@@ -118,14 +195,158 @@ func (mc *fakeMetricsClient) GetLastContextDuration() time.Duration {
 	return time.Duration(mc.lastContextDuration.Load())
 }
 
-func (mc *fakeMetricsClient) GetKapiInstanceMetrics(ctx context.Context, _ string, _ string, _ *x509.CertPool) (result int64, err error) {
+// GetLastURL returns the URL passed to the last GetKapiInstanceMetrics call, or an empty string if there was none.
+func (mc *fakeMetricsClient) GetLastURL() string {
+	if metricsUrl := mc.lastURL.Load(); metricsUrl != nil {
+		return *metricsUrl
+	}
+	return ""
+}
+
+// GetLastRequestHeaders returns the extra request headers carried by the context passed to the last
+// GetKapiInstanceMetrics call, or nil if there were none. See withRequestHeaders.
+func (mc *fakeMetricsClient) GetLastRequestHeaders() http.Header {
+	if headers := mc.lastRequestHeaders.Load(); headers != nil {
+		return *headers
+	}
+	return nil
+}
+
+// GetLastProxyURL returns the proxy URL passed to the last GetKapiInstanceMetrics call.
+func (mc *fakeMetricsClient) GetLastProxyURL() *url.URL {
+	return mc.lastProxyURL.Load()
+}
+
+func (mc *fakeMetricsClient) GetKapiInstanceMetrics(
+	ctx context.Context,
+	metricsUrl string,
+	_ string,
+	caCertificates *x509.CertPool,
+	serverName string,
+	insecureSkipTLSVerify bool,
+	proxyURL *url.URL) (result kapiMetrics, err error) {
+
+	mc.lastURL.Store(&metricsUrl)
+	mc.lastServerName.Store(&serverName)
+	mc.lastCACertificates.Store(caCertificates)
+	mc.lastInsecureSkipTLSVerify.Store(insecureSkipTLSVerify)
+	mc.lastProxyURL.Store(proxyURL)
+	if headers, ok := ctx.Value(requestHeadersContextKey{}).(http.Header); ok {
+		mc.lastRequestHeaders.Store(&headers)
+	} else {
+		mc.lastRequestHeaders.Store(nil)
+	}
+	if target, ok := ctx.Value(portForwardTargetContextKey{}).(portForwardTarget); ok {
+		mc.lastPortForwardTarget.Store(&target)
+	} else {
+		mc.lastPortForwardTarget.Store(nil)
+	}
 	if deadline, ok := ctx.Deadline(); ok {
 		mc.lastContextDuration.Store(int64(deadline.Sub(time.Now()))) // Assumes instantaneous test execution
 	} else {
 		mc.lastContextDuration.Store(0)
 	}
 	mc.WasScraped.Store(true)
-	return fakeMetricsClientMetricsValue, nil
+	if mc.Err != nil {
+		return kapiMetrics{}, mc.Err
+	}
+	if err := mc.URLErrors[metricsUrl]; err != nil {
+		return kapiMetrics{}, err
+	}
+	return kapiMetrics{
+		TotalRequestCount:       fakeMetricsClientMetricsValue,
+		InflightRequestCount:    fakeMetricsClientInflightMetricsValue,
+		HasInflightRequestCount: true,
+	}, nil
 }
 
 //#endregion fakeMetricsClient
+
+//#region fakeStreamConnection
+
+// fakeStream is an httpstream.Stream, whose data is carried by a net.Conn. The other end of the net.Conn plays the role
+// of the kube-apiserver.
+type fakeStream struct {
+	net.Conn
+	headers  http.Header
+	IsClosed atomic.Bool
+}
+
+// Close only records the call. Like an SPDY stream, which is half-closed by Close, the stream remains readable.
+func (fs *fakeStream) Close() error {
+	fs.IsClosed.Store(true)
+	return nil
+}
+
+func (fs *fakeStream) Reset() error {
+	return fs.Conn.Close()
+}
+
+func (fs *fakeStream) Headers() http.Header {
+	return fs.headers
+}
+
+func (fs *fakeStream) Identifier() uint32 {
+	return 0
+}
+
+// fakeStreamConnection is an httpstream.Connection, which records the streams created on it. Each stream is backed by a
+// net.Pipe, and the kube-apiserver end of the pipe is available in ServerEnds.
+type fakeStreamConnection struct {
+	Streams        []*fakeStream
+	ServerEnds     []net.Conn
+	RemovedStreams []httpstream.Stream
+	IdleTimeout    time.Duration
+	CreateErr      error // If not nil, CreateStream fails with this error
+	closeChan      chan bool
+	closeOnce      sync.Once
+	lock           sync.Mutex
+}
+
+func newFakeStreamConnection() *fakeStreamConnection {
+	return &fakeStreamConnection{closeChan: make(chan bool)}
+}
+
+func (fc *fakeStreamConnection) CreateStream(headers http.Header) (httpstream.Stream, error) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	if fc.CreateErr != nil {
+		return nil, fc.CreateErr
+	}
+	clientEnd, serverEnd := net.Pipe()
+	stream := &fakeStream{Conn: clientEnd, headers: headers.Clone()}
+	fc.Streams = append(fc.Streams, stream)
+	fc.ServerEnds = append(fc.ServerEnds, serverEnd)
+	return stream, nil
+}
+
+func (fc *fakeStreamConnection) Close() error {
+	fc.closeOnce.Do(func() { close(fc.closeChan) })
+	return nil
+}
+
+func (fc *fakeStreamConnection) CloseChan() <-chan bool {
+	return fc.closeChan
+}
+
+func (fc *fakeStreamConnection) SetIdleTimeout(timeout time.Duration) {
+	fc.IdleTimeout = timeout
+}
+
+func (fc *fakeStreamConnection) RemoveStreams(streams ...httpstream.Stream) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	fc.RemovedStreams = append(fc.RemovedStreams, streams...)
+}
+
+// GetStreams returns a copy of the streams created so far, and the kube-apiserver ends of their pipes
+func (fc *fakeStreamConnection) GetStreams() ([]*fakeStream, []net.Conn) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	return append([]*fakeStream(nil), fc.Streams...), append([]net.Conn(nil), fc.ServerEnds...)
+}
+
+//#endregion fakeStreamConnection
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultTLSSessionCacheSize is the number of TLS sessions cached for resumption by each scrape client, unless
+// configured otherwise. Each client serves the Kapis of a single shoot, so a small cache suffices.
+const DefaultTLSSessionCacheSize = 64
+
+// The curve names accepted by ParseCurveID, and the respective curves
+var curvesByName = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// TLSSettings tunes the TLS clients which scrape the Kapis. The zero value applies the defaults.
+type TLSSettings struct {
+	// SessionCacheSize is the number of TLS sessions each client caches, so that a new connection to a Kapi can resume
+	// a previous session, instead of performing a full handshake. Zero means DefaultTLSSessionCacheSize. Negative
+	// disables session resumption.
+	SessionCacheSize int
+	// CurvePreferences lists the elliptic curves used in the key exchange, in order of preference. Empty means the Go
+	// defaults.
+	CurvePreferences []tls.CurveID
+	// IdentityPattern, if not nil, requires the server certificate to carry a DNS name SAN which the pattern matches, on
+	// top of the regular verification. Pins the scrapes to the endpoints with a Kapi identity, rather than to any
+	// endpoint with a certificate signed by the shoot CA. See ParseIdentityPattern.
+	IdentityPattern *regexp.Regexp
+	// PinPodIP, if true, requires the server certificate to carry the IP address of the scraped pod, as an IP SAN. Guards
+	// against scraping another endpoint, which took over the IP address of a deleted Kapi pod, before the registry
+	// caught up.
+	PinPodIP bool
+}
+
+// ApplyTo applies the settings to the specified TLS client configuration
+func (s TLSSettings) ApplyTo(config *tls.Config) {
+	switch {
+	case s.SessionCacheSize == 0:
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(DefaultTLSSessionCacheSize)
+	case s.SessionCacheSize > 0:
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(s.SessionCacheSize)
+	}
+	if len(s.CurvePreferences) > 0 {
+		config.CurvePreferences = append([]tls.CurveID(nil), s.CurvePreferences...)
+	}
+}
+
+// isIdentityVerified returns true if the settings require verification of the server identity, on top of the regular
+// verification
+func (s TLSSettings) isIdentityVerified() bool {
+	return s.IdentityPattern != nil || s.PinPodIP
+}
+
+// verifyIdentity checks that the specified server certificate carries the identity which the settings require. The
+// podIP is the address of the scraped pod. Only used if PinPodIP is true.
+func (s TLSSettings) verifyIdentity(certificate *x509.Certificate, podIP string) error {
+	if s.IdentityPattern != nil && !slices.ContainsFunc(certificate.DNSNames, s.IdentityPattern.MatchString) {
+		return fmt.Errorf(
+			"the server certificate carries no DNS name matching the identity pattern '%s'. DNS names: %s",
+			s.IdentityPattern, strings.Join(certificate.DNSNames, ", "))
+	}
+	if s.PinPodIP {
+		ip := net.ParseIP(podIP)
+		if ip == nil {
+			return fmt.Errorf("can't pin the server certificate to the pod IP: '%s' is not an IP address", podIP)
+		}
+		if !slices.ContainsFunc(certificate.IPAddresses, ip.Equal) {
+			return fmt.Errorf("the server certificate does not carry the pod IP %s", podIP)
+		}
+	}
+	return nil
+}
+
+// ParseIdentityPattern compiles a regular expression for [TLSSettings.IdentityPattern]. The expression must match a
+// DNS name entirely, e.g. 'kube-apiserver(\..+)?' accepts 'kube-apiserver' and 'kube-apiserver.shoot--a--b.svc'.
+func ParseIdentityPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, errors.New("the identity pattern must not be empty")
+	}
+	result, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("parsing the identity pattern '%s': %w", pattern, err)
+	}
+	return result, nil
+}
+
+// ParseCurveID returns the elliptic curve with the specified name: one of X25519, P256, P384, P521. The name is case
+// insensitive.
+func ParseCurveID(name string) (tls.CurveID, error) {
+	curve, ok := curvesByName[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown curve '%s', must be one of X25519, P256, P384, P521", name)
+	}
+	return curve, nil
+}
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("input.metrics_scraper.TLSSettings", func() {
+	Describe("ApplyTo", func() {
+		It("should install a session cache, unless the cache is disabled", func() {
+			// Arrange
+			defaultConfig, sizedConfig, disabledConfig := &tls.Config{}, &tls.Config{}, &tls.Config{}
+
+			// Act
+			TLSSettings{}.ApplyTo(defaultConfig)
+			TLSSettings{SessionCacheSize: 5}.ApplyTo(sizedConfig)
+			TLSSettings{SessionCacheSize: -1}.ApplyTo(disabledConfig)
+
+			// Assert
+			Expect(defaultConfig.ClientSessionCache).NotTo(BeNil())
+			Expect(sizedConfig.ClientSessionCache).NotTo(BeNil())
+			Expect(disabledConfig.ClientSessionCache).To(BeNil())
+		})
+
+		It("should apply a copy of the curve preferences, if any", func() {
+			// Arrange
+			curves := []tls.CurveID{tls.CurveP256, tls.X25519}
+			config, unchangedConfig := &tls.Config{}, &tls.Config{}
+
+			// Act
+			TLSSettings{CurvePreferences: curves}.ApplyTo(config)
+			TLSSettings{}.ApplyTo(unchangedConfig)
+			curves[0] = tls.CurveP521
+
+			// Assert
+			Expect(config.CurvePreferences).To(Equal([]tls.CurveID{tls.CurveP256, tls.X25519}))
+			Expect(unchangedConfig.CurvePreferences).To(BeNil())
+		})
+	})
+
+	Describe("verifyIdentity", func() {
+		var (
+			certificate = &x509.Certificate{
+				DNSNames:    []string{"kube-apiserver", "kube-apiserver.shoot--a--b.svc"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+			}
+		)
+
+		It("should accept a certificate with a DNS name which the identity pattern matches entirely", func() {
+			// Arrange
+			matching, err := ParseIdentityPattern(`kube-apiserver\.shoot--.+\.svc`)
+			Expect(err).To(Succeed())
+			partial, err := ParseIdentityPattern("shoot--a--b")
+			Expect(err).To(Succeed())
+
+			// Act
+			matchingErr := TLSSettings{IdentityPattern: matching}.verifyIdentity(certificate, "")
+			partialErr := TLSSettings{IdentityPattern: partial}.verifyIdentity(certificate, "")
+
+			// Assert
+			Expect(matchingErr).To(Succeed())
+			Expect(partialErr).To(MatchError(ContainSubstring("no DNS name matching")))
+		})
+
+		It("should accept a certificate which carries the pod IP, if the pod IP is pinned", func() {
+			// Arrange
+			settings := TLSSettings{PinPodIP: true}
+
+			// Act
+			sameIPErr := settings.verifyIdentity(certificate, "10.0.0.1")
+			otherIPErr := settings.verifyIdentity(certificate, "10.0.0.2")
+			notIPErr := settings.verifyIdentity(certificate, "kapi.example")
+
+			// Assert
+			Expect(sameIPErr).To(Succeed())
+			Expect(otherIPErr).To(MatchError(ContainSubstring("does not carry the pod IP 10.0.0.2")))
+			Expect(notIPErr).To(MatchError(ContainSubstring("not an IP address")))
+		})
+
+		It("should accept any certificate, if the settings require no identity", func() {
+			// Act
+			err := TLSSettings{}.verifyIdentity(&x509.Certificate{}, "10.0.0.2")
+
+			// Assert
+			Expect(err).To(Succeed())
+		})
+	})
+
+	Describe("ParseIdentityPattern", func() {
+		It("should reject an empty or malformed pattern", func() {
+			// Act
+			_, emptyErr := ParseIdentityPattern("")
+			_, malformedErr := ParseIdentityPattern("kube-apiserver(")
+
+			// Assert
+			Expect(emptyErr).To(HaveOccurred())
+			Expect(malformedErr).To(MatchError(ContainSubstring("kube-apiserver(")))
+		})
+	})
+
+	Describe("ParseCurveID", func() {
+		It("should accept the known curve names, regardless of case, and reject others", func() {
+			// Act
+			x25519, x25519Err := ParseCurveID("x25519")
+			p384, p384Err := ParseCurveID("P384")
+			_, unknownErr := ParseCurveID("P224")
+
+			// Assert
+			Expect(x25519Err).To(Succeed())
+			Expect(x25519).To(Equal(tls.X25519))
+			Expect(p384Err).To(Succeed())
+			Expect(p384).To(Equal(tls.CurveP384))
+			Expect(unknownErr).To(MatchError(ContainSubstring("P224")))
+		})
+	})
+})
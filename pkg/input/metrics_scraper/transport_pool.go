@@ -0,0 +1,273 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// The maximum number of redirects followed in a single request
+const maxRedirects = 3
+
+// dialContextFunc establishes a network connection. Has the semantics of [net.Dialer.DialContext].
+type dialContextFunc func(ctx context.Context, network string, address string) (net.Conn, error)
+
+// transportPoolKey identifies a set of HTTP clients which can share connections
+type transportPoolKey struct {
+	caCertificates *x509.CertPool
+	serverName     string // A server name, or input_data_registry.TLSServerNameAny
+	proxyURL       string // Empty means no proxy
+	// Do not verify the server certificate. Meant for development clusters only.
+	insecureSkipTLSVerify bool
+	// The pod IP which the server certificate must carry. Empty, unless the TLS settings pin the pod IP.
+	podIP string
+}
+
+// transportPoolEntry is a cached HTTP client, plus the bookkeeping necessary to evict it once it falls out of use
+type transportPoolEntry struct {
+	client   *http.Client
+	lastUsed time.Time
+}
+
+// transportPool caches HTTP clients, so consecutive scrapes of the same shoot reuse keep-alive (and, where the server
+// supports it, HTTP/2) connections, instead of performing a full TLS handshake for each scrape.
+//
+// Clients are keyed by CA cert pool, server name, and proxy URL. The registry creates a new CA cert pool object whenever
+// the content of the shoot's CA certificate changes, and only then, so a CA change results in a new client and a new set
+// of connections, while reconciles of an unchanged CA secret do not. Clients which have not been used for longer than
+// maxIdleTime are evicted, and their idle connections closed.
+//
+// All public members are concurrency-safe.
+type transportPool struct {
+	entries map[transportPoolKey]*transportPoolEntry
+	// Cached clients which are not used for this long are evicted. Also used as idle timeout for pooled connections.
+	maxIdleTime time.Duration
+	// If not nil, used by all clients to establish connections to the target (or to the proxy, if one is used)
+	dialContext dialContextFunc
+	// Applied to the TLS configuration of each client
+	tlsSettings TLSSettings
+	// When did the last eviction pass take place
+	lastEvictionTime time.Time
+	lock             sync.Mutex
+
+	testIsolation transportPoolTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// newTransportPool creates a transportPool which evicts clients after they are left unused for maxIdleTime.
+// If dialContext is nil, clients establish connections via the default [net.Dialer]. tlsSettings tunes the TLS
+// configuration of the clients.
+func newTransportPool(maxIdleTime time.Duration, dialContext dialContextFunc, tlsSettings TLSSettings) *transportPool {
+	return &transportPool{
+		entries:     make(map[transportPoolKey]*transportPoolEntry),
+		maxIdleTime: maxIdleTime,
+		dialContext: dialContext,
+		tlsSettings: tlsSettings,
+		testIsolation: transportPoolTestIsolation{
+			TimeNow: time.Now,
+		},
+	}
+}
+
+// GetHttpClient returns an HTTP client which verifies server certificates against the specified CA certificates, unless
+// insecureSkipTLSVerify is true. The certificates are expected to carry the specified server name. Empty serverName
+// means [input_data_registry.DefaultTLSServerName]. [input_data_registry.TLSServerNameAny] accepts certificates which
+// carry any server name, as long as they are signed by one of the CA certificates. If proxyURL is not nil, the client
+// reaches the server through that proxy (HTTP CONNECT, or SOCKS5 for the "socks5" scheme). The client only follows
+// redirects to the host of the original request. See checkRedirect.
+// If the pool's TLS settings require the server identity to be verified (see [TLSSettings.IdentityPattern] and
+// [TLSSettings.PinPodIP]), the client checks it too, unless insecureSkipTLSVerify is true. The podIP is the address of
+// the pod which the client scrapes. Only used if the TLS settings pin the pod IP.
+// Calls with the same caCertificates object, server name, proxy URL, insecureSkipTLSVerify value, and, if the pod IP is
+// pinned, pod IP, return the same client, as long as that client has not been evicted.
+func (tp *transportPool) GetHttpClient(
+	caCertificates *x509.CertPool,
+	serverName string,
+	insecureSkipTLSVerify bool,
+	proxyURL *neturl.URL,
+	podIP string) *http.Client {
+
+	if serverName == "" {
+		serverName = input_data_registry.DefaultTLSServerName
+	}
+	key := transportPoolKey{
+		caCertificates:        caCertificates,
+		serverName:            serverName,
+		insecureSkipTLSVerify: insecureSkipTLSVerify,
+	}
+	if proxyURL != nil {
+		key.proxyURL = proxyURL.String()
+	}
+	if tp.tlsSettings.PinPodIP {
+		// Each pod needs a client of its own, since the TLS configuration carries the expected IP
+		key.podIP = podIP
+	}
+	now := tp.testIsolation.TimeNow()
+
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	tp.evictIdleThreadUnsafe(now)
+
+	entry := tp.entries[key]
+	if entry == nil {
+		entry = &transportPoolEntry{client: tp.newHttpClient(key)}
+		tp.entries[key] = entry
+	}
+	entry.lastUsed = now
+
+	return entry.client
+}
+
+// Count returns the number of clients currently in the pool
+func (tp *transportPool) Count() int {
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	return len(tp.entries)
+}
+
+// evictIdleThreadUnsafe removes clients which have not been used for longer than maxIdleTime. To keep the cost of
+// frequent calls low, a full pass over the pool is made no more than once per maxIdleTime.
+//
+// The caller must acquire the lock before calling this method.
+func (tp *transportPool) evictIdleThreadUnsafe(now time.Time) {
+	if now.Sub(tp.lastEvictionTime) < tp.maxIdleTime {
+		return
+	}
+	tp.lastEvictionTime = now
+
+	for key, entry := range tp.entries {
+		if now.Sub(entry.lastUsed) > tp.maxIdleTime {
+			entry.client.CloseIdleConnections()
+			delete(tp.entries, key)
+		}
+	}
+}
+
+func (tp *transportPool) newHttpClient(key transportPoolKey) *http.Client {
+	tlsConfig := &tls.Config{
+		RootCAs:            key.caCertificates,
+		ServerName:         key.serverName,
+		MinVersion:         tls.VersionTLS13,
+		InsecureSkipVerify: key.insecureSkipTLSVerify, //nolint:gosec // Only if configured, for development clusters
+	}
+	if key.serverName == input_data_registry.TLSServerNameAny && !key.insecureSkipTLSVerify {
+		// The standard verification can't be told to ignore the server name. Replace it with one which only verifies
+		// the certificate chain. The expected server name is still sent, as SNI.
+		tlsConfig.ServerName = input_data_registry.DefaultTLSServerName
+		tlsConfig.InsecureSkipVerify = true //nolint:gosec // VerifyConnection takes over the verification
+		tlsConfig.VerifyConnection = verifySignedByCA(key.caCertificates)
+	}
+	if tp.tlsSettings.isIdentityVerified() && !key.insecureSkipTLSVerify {
+		// Called after the regular verification, or after verifySignedByCA, if the latter replaces it
+		tlsConfig.VerifyConnection = withIdentityVerification(tlsConfig.VerifyConnection, tp.tlsSettings, key.podIP)
+	}
+	// Session resumption spares the full handshake on new connections, e.g. after an idle connection was closed. All
+	// Kapis of a shoot present the same server name, so they share a cache entry, and a resumption attempt against a
+	// different replica than the one which issued the ticket falls back to a full handshake.
+	tp.tlsSettings.ApplyTo(tlsConfig)
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+		// A custom TLS config disables HTTP/2 by default. Explicitly re-enable it.
+		ForceAttemptHTTP2: true,
+		// A connection must survive until the next scrape of the same target, a full scrape period later
+		IdleConnTimeout: tp.maxIdleTime,
+	}
+	if tp.dialContext != nil {
+		transport.DialContext = tp.dialContext
+	}
+	if key.proxyURL != "" {
+		// The key was built from a valid URL, so parsing it back can't fail
+		proxyURL, _ := neturl.Parse(key.proxyURL)
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{Transport: transport, CheckRedirect: checkRedirect}
+}
+
+// verifySignedByCA returns a function with the semantics of [tls.Config.VerifyConnection], which accepts a server
+// certificate signed by one of the specified CA certificates, regardless of the server names which the certificate
+// carries
+func verifySignedByCA(caCertificates *x509.CertPool) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("the server presented no certificate")
+		}
+		intermediates := x509.NewCertPool()
+		for _, certificate := range state.PeerCertificates[1:] {
+			intermediates.AddCert(certificate)
+		}
+		_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         caCertificates,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		if err != nil {
+			return fmt.Errorf("verifying the server certificate against the CA certificates: %w", err)
+		}
+		return nil
+	}
+}
+
+// withIdentityVerification returns a function with the semantics of [tls.Config.VerifyConnection], which calls the
+// specified verification function, if not nil, and then checks that the server certificate carries the identity which
+// the TLS settings require. See [TLSSettings.verifyIdentity].
+func withIdentityVerification(
+	verify func(tls.ConnectionState) error, settings TLSSettings, podIP string) func(tls.ConnectionState) error {
+
+	return func(state tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(state); err != nil {
+				return err
+			}
+		}
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("the server presented no certificate")
+		}
+		if err := settings.verifyIdentity(state.PeerCertificates[0], podIP); err != nil {
+			return fmt.Errorf("verifying the server identity: %w", err)
+		}
+		return nil
+	}
+}
+
+// checkRedirect has the semantics of [http.Client.CheckRedirect]. It only allows redirects to the host of the original
+// request, and not from https to another scheme, so the scrape auth token is neither disclosed to another server, nor
+// sent in the clear.
+func checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	original := via[0].URL
+	if request.URL.Host != original.Host {
+		return fmt.Errorf("refusing to follow a redirect to another host '%s'", request.URL.Host)
+	}
+	if original.Scheme == "https" && request.URL.Scheme != "https" {
+		return fmt.Errorf("refusing to follow a redirect from https to %s", request.URL.Scheme)
+	}
+	return nil
+}
+
+//#region Test isolation
+
+// transportPoolTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the transportPool unit during tests
+type transportPoolTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+}
+
+//#endregion Test isolation
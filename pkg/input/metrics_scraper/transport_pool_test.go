@@ -0,0 +1,302 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("input.metrics_scraper.transportPool", func() {
+	Describe("GetHttpClient", func() {
+		It("should return a client configured with the specified CA certificates and the kapi server name", func() {
+			// Arrange
+			pool := newTransportPool(time.Minute, nil, TLSSettings{})
+			certPool := getExampleCertPool()
+
+			// Act
+			client := pool.GetHttpClient(certPool, "", false, nil, "")
+
+			// Assert
+			transport := client.Transport.(*http.Transport)
+			Expect(transport.TLSClientConfig.RootCAs == certPool).To(BeTrue())
+			Expect(transport.TLSClientConfig.ServerName).To(Equal(input_data_registry.DefaultTLSServerName))
+			Expect(transport.ForceAttemptHTTP2).To(BeTrue())
+			Expect(transport.IdleConnTimeout).To(Equal(time.Minute))
+		})
+
+		It("should enable TLS session resumption by default, and apply the configured curve preferences", func() {
+			// Arrange
+			defaultPool := newTransportPool(time.Minute, nil, TLSSettings{})
+			tunedPool := newTransportPool(
+				time.Minute, nil, TLSSettings{SessionCacheSize: -1, CurvePreferences: []tls.CurveID{tls.X25519}})
+
+			// Act
+			defaultClient := defaultPool.GetHttpClient(getExampleCertPool(), "", false, nil, "")
+			tunedClient := tunedPool.GetHttpClient(getExampleCertPool(), "", false, nil, "")
+
+			// Assert
+			defaultConfig := defaultClient.Transport.(*http.Transport).TLSClientConfig
+			Expect(defaultConfig.ClientSessionCache).NotTo(BeNil())
+			Expect(defaultConfig.CurvePreferences).To(BeEmpty())
+			tunedConfig := tunedClient.Transport.(*http.Transport).TLSClientConfig
+			Expect(tunedConfig.ClientSessionCache).To(BeNil())
+			Expect(tunedConfig.CurvePreferences).To(Equal([]tls.CurveID{tls.X25519}))
+		})
+
+		It("should return the same client for the same CA cert pool object", func() {
+			// Arrange
+			pool := newTransportPool(time.Minute, nil, TLSSettings{})
+			certPool := getExampleCertPool()
+
+			// Act
+			client1 := pool.GetHttpClient(certPool, "", false, nil, "")
+			client2 := pool.GetHttpClient(certPool, "", false, nil, "")
+
+			// Assert
+			Expect(client1 == client2).To(BeTrue())
+			Expect(pool.Count()).To(Equal(1))
+		})
+
+		It("should return a new client once the CA cert pool object gets replaced", func() {
+			// Arrange
+			pool := newTransportPool(time.Minute, nil, TLSSettings{})
+			client1 := pool.GetHttpClient(getExampleCertPool(), "", false, nil, "")
+
+			// Act
+			client2 := pool.GetHttpClient(getExampleCertPool(), "", false, nil, "")
+
+			// Assert
+			Expect(client1 == client2).To(BeFalse())
+		})
+
+		It("should route the client through the specified proxy, and key the client by proxy URL", func() {
+			// Arrange
+			pool := newTransportPool(time.Minute, nil, TLSSettings{})
+			certPool := getExampleCertPool()
+			proxyURL, _ := url.Parse("socks5://proxy.shoot--a:1080")
+			directClient := pool.GetHttpClient(certPool, "", false, nil, "")
+
+			// Act
+			proxiedClient := pool.GetHttpClient(certPool, "", false, proxyURL, "")
+
+			// Assert
+			Expect(proxiedClient == directClient).To(BeFalse())
+			Expect(directClient.Transport.(*http.Transport).Proxy).To(BeNil())
+			request, _ := http.NewRequest(http.MethodGet, "https://kapi:443/metrics", nil)
+			actualProxyURL, err := proxiedClient.Transport.(*http.Transport).Proxy(request)
+			Expect(err).To(Succeed())
+			Expect(actualProxyURL.String()).To(Equal(proxyURL.String()))
+		})
+
+		It("should establish connections via the specified dial function", func() {
+			// Arrange
+			var dialedAddress string
+			dial := func(_ context.Context, _ string, address string) (net.Conn, error) {
+				dialedAddress = address
+				return nil, errors.New("dial failed")
+			}
+			pool := newTransportPool(time.Minute, dial, TLSSettings{})
+			client := pool.GetHttpClient(getExampleCertPool(), "", false, nil, "")
+
+			// Act
+			_, err := client.Get("https://kapi.example:443/metrics")
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(dialedAddress).To(Equal("kapi.example:443"))
+		})
+
+		It("should evict clients which were not used for longer than the max idle time", func() {
+			// Arrange
+			pool := newTransportPool(time.Minute, nil, TLSSettings{})
+			pool.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			oldCertPool := getExampleCertPool()
+			currentCertPool := getExampleCertPool()
+			pool.GetHttpClient(oldCertPool, "", false, nil, "")
+			pool.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 50)
+			currentClient := pool.GetHttpClient(currentCertPool, "", false, nil, "")
+			Expect(pool.Count()).To(Equal(2))
+
+			// Act
+			pool.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 30)
+			client := pool.GetHttpClient(currentCertPool, "", false, nil, "")
+
+			// Assert
+			Expect(pool.Count()).To(Equal(1))
+			Expect(client == currentClient).To(BeTrue())
+		})
+
+		It("should skip server certificate verification if requested, and key the client by that setting", func() {
+			// Arrange
+			pool := newTransportPool(time.Minute, nil, TLSSettings{})
+			certPool := getExampleCertPool()
+			verifyingClient := pool.GetHttpClient(certPool, "", false, nil, "")
+
+			// Act
+			insecureClient := pool.GetHttpClient(certPool, "", true, nil, "")
+
+			// Assert
+			Expect(insecureClient == verifyingClient).To(BeFalse())
+			Expect(verifyingClient.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify).To(BeFalse())
+			Expect(insecureClient.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify).To(BeTrue())
+		})
+
+		It("should expect the specified server name, and key the client by server name", func() {
+			// Arrange
+			pool := newTransportPool(time.Minute, nil, TLSSettings{})
+			certPool := getExampleCertPool()
+			defaultClient := pool.GetHttpClient(certPool, "", false, nil, "")
+
+			// Act
+			namedClient := pool.GetHttpClient(certPool, "kapi.shoot--a.svc", false, nil, "")
+
+			// Assert
+			Expect(namedClient == defaultClient).To(BeFalse())
+			Expect(namedClient.Transport.(*http.Transport).TLSClientConfig.ServerName).To(Equal("kapi.shoot--a.svc"))
+			Expect(pool.GetHttpClient(certPool, input_data_registry.DefaultTLSServerName, false, nil, "")).
+				To(BeIdenticalTo(defaultClient))
+		})
+
+		It("should accept a certificate with any server name, as long as it is signed by the CA, if so requested", func() {
+			// Arrange
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+			serverCA := x509.NewCertPool()
+			serverCA.AddCert(server.Certificate())
+			pool := newTransportPool(time.Minute, nil, TLSSettings{})
+			namedClient := pool.GetHttpClient(serverCA, "", false, nil, "")
+			anyNameClient := pool.GetHttpClient(serverCA, input_data_registry.TLSServerNameAny, false, nil, "")
+			otherCAClient := pool.GetHttpClient(getExampleCertPool(), input_data_registry.TLSServerNameAny, false, nil, "")
+
+			// Act
+			_, namedErr := namedClient.Get(server.URL)
+			anyNameResponse, anyNameErr := anyNameClient.Get(server.URL)
+			_, otherCAErr := otherCAClient.Get(server.URL)
+
+			// Assert
+			Expect(namedErr).To(MatchError(ContainSubstring(input_data_registry.DefaultTLSServerName)))
+			Expect(anyNameErr).To(Succeed())
+			_ = anyNameResponse.Body.Close()
+			Expect(otherCAErr).To(MatchError(ContainSubstring("verifying the server certificate")))
+		})
+
+		It("should verify the server identity, if the TLS settings require it", func() {
+			// Arrange
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+			serverCA := x509.NewCertPool()
+			serverCA.AddCert(server.Certificate()) // Carries the DNS name example.com, and the IP 127.0.0.1
+			serverIP := server.Listener.Addr().(*net.TCPAddr).IP.String()
+			kapiPattern, err := ParseIdentityPattern("kube-apiserver.*")
+			Expect(err).To(Succeed())
+			examplePattern, err := ParseIdentityPattern(`example\.com`)
+			Expect(err).To(Succeed())
+			get := func(settings TLSSettings, podIP string) error {
+				client := newTransportPool(time.Minute, nil, settings).
+					GetHttpClient(serverCA, input_data_registry.TLSServerNameAny, false, nil, podIP)
+				response, err := client.Get(server.URL)
+				if err == nil {
+					_ = response.Body.Close()
+				}
+				return err
+			}
+
+			// Act
+			matchingPatternErr := get(TLSSettings{IdentityPattern: examplePattern}, "")
+			otherPatternErr := get(TLSSettings{IdentityPattern: kapiPattern}, "")
+			pinnedIPErr := get(TLSSettings{PinPodIP: true}, serverIP)
+			otherIPErr := get(TLSSettings{PinPodIP: true}, "10.0.0.1")
+
+			// Assert
+			Expect(matchingPatternErr).To(Succeed())
+			Expect(otherPatternErr).To(MatchError(ContainSubstring("verifying the server identity")))
+			Expect(pinnedIPErr).To(Succeed())
+			Expect(otherIPErr).To(MatchError(ContainSubstring("does not carry the pod IP 10.0.0.1")))
+		})
+
+		It("should return a separate client for each pod, only if the pod IP is pinned", func() {
+			// Arrange
+			certPool := getExampleCertPool()
+			pool := newTransportPool(time.Minute, nil, TLSSettings{})
+			pinningPool := newTransportPool(time.Minute, nil, TLSSettings{PinPodIP: true})
+
+			// Act
+			client1 := pool.GetHttpClient(certPool, "", false, nil, "10.0.0.1")
+			client2 := pool.GetHttpClient(certPool, "", false, nil, "10.0.0.2")
+			pinningClient1 := pinningPool.GetHttpClient(certPool, "", false, nil, "10.0.0.1")
+			pinningClient2 := pinningPool.GetHttpClient(certPool, "", false, nil, "10.0.0.2")
+
+			// Assert
+			Expect(client1 == client2).To(BeTrue())
+			Expect(pinningClient1 == pinningClient2).To(BeFalse())
+		})
+
+		It("should follow redirects to the same host, but not to other hosts", func() {
+			// Arrange
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/same-host":
+					http.Redirect(w, r, "/metrics", http.StatusFound)
+				case "/other-host":
+					http.Redirect(w, r, "http://other.example/metrics", http.StatusFound)
+				default:
+					w.WriteHeader(http.StatusOK)
+				}
+			}))
+			defer server.Close()
+			client := newTransportPool(time.Minute, nil, TLSSettings{}).GetHttpClient(getExampleCertPool(), "", false, nil, "")
+
+			// Act
+			sameHostResponse, sameHostErr := client.Get(server.URL + "/same-host")
+			_, otherHostErr := client.Get(server.URL + "/other-host")
+
+			// Assert
+			Expect(sameHostErr).To(Succeed())
+			_ = sameHostResponse.Body.Close()
+			Expect(sameHostResponse.Request.URL.Path).To(Equal("/metrics"))
+			Expect(otherHostErr).To(MatchError(ContainSubstring("another host")))
+		})
+	})
+
+	Describe("checkRedirect", func() {
+		newRequest := func(rawURL string) *http.Request {
+			request, err := http.NewRequest(http.MethodGet, rawURL, nil)
+			Expect(err).To(Succeed())
+			return request
+		}
+
+		It("should refuse redirects from https to http, and redirect chains which are too long", func() {
+			// Arrange
+			original := newRequest("https://kapi:443/metrics")
+			longChain := make([]*http.Request, maxRedirects)
+			for i := range longChain {
+				longChain[i] = original
+			}
+
+			// Act & Assert
+			Expect(checkRedirect(newRequest("https://kapi:443/other"), []*http.Request{original})).To(Succeed())
+			Expect(checkRedirect(newRequest("http://kapi:443/other"), []*http.Request{original})).NotTo(Succeed())
+			Expect(checkRedirect(newRequest("https://kapi:443/other"), longChain)).NotTo(Succeed())
+		})
+	})
+})
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// scrapeCoverageInfoName is the name under which the seed-wide scrape coverage is exposed at the debug endpoint. See
+// [conditions.Registry.AddInfo].
+const scrapeCoverageInfoName = "scrapeCoverage"
+
+var (
+	shootScrapeCoverageDesc = prometheus.NewDesc(
+		"gardener_custom_metrics_shoot_scrape_coverage_ratio",
+		"The fraction of the shoot's kube-apiserver pods which produced a fresh metrics sample within the last scrape "+
+			"period",
+		[]string{"namespace"},
+		nil)
+	seedScrapeCoverageDesc = prometheus.NewDesc(
+		"gardener_custom_metrics_seed_scrape_coverage_ratio",
+		"The fraction of all kube-apiserver pods scraped by this replica, which produced a fresh metrics sample "+
+			"within the last scrape period",
+		nil,
+		nil)
+	seedScrapeKapisDesc = prometheus.NewDesc(
+		"gardener_custom_metrics_seed_scrape_kapis",
+		"The number of kube-apiserver pods scraped by this replica, by whether they produced a fresh metrics sample "+
+			"within the last scrape period",
+		[]string{"fresh"},
+		nil)
+)
+
+// scrapeCoverageCollector is a [prometheus.Collector] which exposes the scrape coverage, i.e. the fraction of Kapis
+// which produced a fresh metrics sample within the last scrape period, per shoot and seed-wide. The values are
+// calculated from the registry upon each collection. Only Kapis scraped by this replica are counted. See
+// [input_data_registry.InputDataRegistry.GetScrapeCoverage].
+type scrapeCoverageCollector struct {
+	dataRegistry input_data_registry.InputDataRegistry
+}
+
+// newScrapeCoverageCollector creates a scrapeCoverageCollector which exposes the scrape coverage recorded in the
+// specified registry
+func newScrapeCoverageCollector(dataRegistry input_data_registry.InputDataRegistry) *scrapeCoverageCollector {
+	return &scrapeCoverageCollector{dataRegistry: dataRegistry}
+}
+
+// Describe implements [prometheus.Collector.Describe].
+func (c *scrapeCoverageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- shootScrapeCoverageDesc
+	ch <- seedScrapeCoverageDesc
+	ch <- seedScrapeKapisDesc
+}
+
+// Collect implements [prometheus.Collector.Collect].
+func (c *scrapeCoverageCollector) Collect(ch chan<- prometheus.Metric) {
+	var seedCoverage input_data_registry.ScrapeCoverage
+	for namespace, coverage := range c.dataRegistry.GetScrapeCoverage() {
+		ch <- prometheus.MustNewConstMetric(shootScrapeCoverageDesc, prometheus.GaugeValue, coverage.Ratio(), namespace)
+		seedCoverage = seedCoverage.Add(coverage)
+	}
+
+	ch <- prometheus.MustNewConstMetric(seedScrapeCoverageDesc, prometheus.GaugeValue, seedCoverage.Ratio())
+	ch <- prometheus.MustNewConstMetric(
+		seedScrapeKapisDesc, prometheus.GaugeValue, float64(seedCoverage.FreshKapiCount), "true")
+	ch <- prometheus.MustNewConstMetric(
+		seedScrapeKapisDesc, prometheus.GaugeValue, float64(seedCoverage.KapiCount-seedCoverage.FreshKapiCount), "false")
+}
+
+// scrapeCoverageInfo holds the seed-wide scrape coverage, as exposed at the debug endpoint
+type scrapeCoverageInfo struct {
+	Ratio          float64 `json:"ratio"`
+	KapiCount      int     `json:"kapiCount"`
+	FreshKapiCount int     `json:"freshKapiCount"`
+	// The number of shoots which have at least one Kapi without a fresh sample
+	IncompleteShootCount int `json:"incompleteShootCount"`
+}
+
+// getScrapeCoverageInfo returns the current seed-wide scrape coverage of the specified registry
+func getScrapeCoverageInfo(dataRegistry input_data_registry.InputDataRegistry) scrapeCoverageInfo {
+	var seedCoverage input_data_registry.ScrapeCoverage
+	incompleteShootCount := 0
+	for _, coverage := range dataRegistry.GetScrapeCoverage() {
+		seedCoverage = seedCoverage.Add(coverage)
+		if coverage.FreshKapiCount < coverage.KapiCount {
+			incompleteShootCount++
+		}
+	}
+
+	return scrapeCoverageInfo{
+		Ratio:                seedCoverage.Ratio(),
+		KapiCount:            seedCoverage.KapiCount,
+		FreshKapiCount:       seedCoverage.FreshKapiCount,
+		IncompleteShootCount: incompleteShootCount,
+	}
+}
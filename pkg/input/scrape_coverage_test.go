@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("input.scrapeCoverageCollector", func() {
+	// Creates a registry with two shoots: one with two Kapis, only one of which has a fresh sample, and one with a
+	// single Kapi, which has a fresh sample
+	newTestRegistry := func() *fakes.FakeInputDataRegistry {
+		idr := &fakes.FakeInputDataRegistry{
+			DefaultScrapePeriod: time.Minute,
+			FakeTimeNow:         gcmtesting.NewTime(1, 0, 30),
+		}
+		for _, kapi := range []struct{ namespace, pod string }{
+			{"shoot--a", "kapi1"}, {"shoot--a", "kapi2"}, {"shoot--b", "kapi1"},
+		} {
+			idr.SetKapiData(kapi.namespace, kapi.pod, "", nil, "")
+		}
+		idr.SetKapiMetricsWithTime("shoot--a", "kapi1", 1, gcmtesting.NewTime(1, 0, 0))
+		idr.SetKapiMetricsWithTime("shoot--a", "kapi2", 1, gcmtesting.NewTime(0, 50, 0))
+		idr.SetKapiMetricsWithTime("shoot--b", "kapi1", 1, gcmtesting.NewTime(1, 0, 0))
+		return idr
+	}
+
+	It("should expose the coverage of each shoot, and the seed-wide coverage", func() {
+		// Arrange
+		collector := newScrapeCoverageCollector(newTestRegistry())
+		expected := `
+# HELP gardener_custom_metrics_seed_scrape_coverage_ratio The fraction of all kube-apiserver pods scraped by this replica, which produced a fresh metrics sample within the last scrape period
+# TYPE gardener_custom_metrics_seed_scrape_coverage_ratio gauge
+gardener_custom_metrics_seed_scrape_coverage_ratio 0.6666666666666666
+# HELP gardener_custom_metrics_seed_scrape_kapis The number of kube-apiserver pods scraped by this replica, by whether they produced a fresh metrics sample within the last scrape period
+# TYPE gardener_custom_metrics_seed_scrape_kapis gauge
+gardener_custom_metrics_seed_scrape_kapis{fresh="false"} 1
+gardener_custom_metrics_seed_scrape_kapis{fresh="true"} 2
+# HELP gardener_custom_metrics_shoot_scrape_coverage_ratio The fraction of the shoot's kube-apiserver pods which produced a fresh metrics sample within the last scrape period
+# TYPE gardener_custom_metrics_shoot_scrape_coverage_ratio gauge
+gardener_custom_metrics_shoot_scrape_coverage_ratio{namespace="shoot--a"} 0.5
+gardener_custom_metrics_shoot_scrape_coverage_ratio{namespace="shoot--b"} 1
+`
+
+		// Act
+		err := promtestutil.CollectAndCompare(collector, strings.NewReader(expected))
+
+		// Assert
+		Expect(err).To(Succeed())
+	})
+
+	It("should report full seed-wide coverage, if there are no Kapis to scrape", func() {
+		// Arrange
+		collector := newScrapeCoverageCollector(&fakes.FakeInputDataRegistry{})
+		expected := `
+# HELP gardener_custom_metrics_seed_scrape_coverage_ratio The fraction of all kube-apiserver pods scraped by this replica, which produced a fresh metrics sample within the last scrape period
+# TYPE gardener_custom_metrics_seed_scrape_coverage_ratio gauge
+gardener_custom_metrics_seed_scrape_coverage_ratio 1
+`
+
+		// Act
+		err := promtestutil.CollectAndCompare(
+			collector, strings.NewReader(expected), "gardener_custom_metrics_seed_scrape_coverage_ratio")
+		shootCount := promtestutil.CollectAndCount(collector, "gardener_custom_metrics_shoot_scrape_coverage_ratio")
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(shootCount).To(BeZero())
+	})
+
+	Describe("getScrapeCoverageInfo", func() {
+		It("should summarize the seed-wide coverage, and count the shoots which are not fully covered", func() {
+			// Arrange
+			idr := newTestRegistry()
+
+			// Act
+			info := getScrapeCoverageInfo(idr)
+
+			// Assert
+			Expect(info).To(Equal(scrapeCoverageInfo{
+				Ratio:                float64(2) / 3,
+				KapiCount:            3,
+				FreshKapiCount:       2,
+				IncompleteShootCount: 1,
+			}))
+		})
+	})
+})
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// gatedManager is a [manager.Manager] which holds off the runnables that need leader election, until the gate
+// function returns. The controllers add themselves to the manager they are created with, so creating them with a
+// gatedManager holds them off too. Runnables which opt out of leader election are added as they are.
+type gatedManager struct {
+	manager.Manager
+	// Blocks until the gated runnables may start, or until the context is cancelled
+	gate func(ctx context.Context) error
+}
+
+// Add implements [manager.Manager.Add]
+func (m *gatedManager) Add(runnable manager.Runnable) error {
+	if electionRunnable, ok := runnable.(manager.LeaderElectionRunnable); ok && !electionRunnable.NeedLeaderElection() {
+		return m.Manager.Add(runnable)
+	}
+	return m.Manager.Add(&gatedRunnable{runnable: runnable, gate: m.gate})
+}
+
+// gatedRunnable is a [manager.Runnable] which needs leader election, and which starts the wrapped runnable once the
+// gate function returns
+type gatedRunnable struct {
+	runnable manager.Runnable
+	gate     func(ctx context.Context) error
+}
+
+// Start implements [manager.Runnable.Start]
+func (r *gatedRunnable) Start(ctx context.Context) error {
+	if err := r.gate(ctx); err != nil {
+		return fmt.Errorf("waiting for start gate: %w", err)
+	}
+	return r.runnable.Start(ctx)
+}
+
+// NeedLeaderElection implements [manager.LeaderElectionRunnable]
+func (r *gatedRunnable) NeedLeaderElection() bool {
+	return true
+}
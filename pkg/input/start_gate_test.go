@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// fakeRunnable is a [manager.Runnable] which records whether it was started
+type fakeRunnable struct {
+	isStarted       bool
+	needsLeadership bool
+}
+
+func (fr *fakeRunnable) Start(context.Context) error {
+	fr.isStarted = true
+	return nil
+}
+
+func (fr *fakeRunnable) NeedLeaderElection() bool {
+	return fr.needsLeadership
+}
+
+var _ = Describe("input.gatedManager", func() {
+	It("should hold off the runnables which need leader election, until the gate returns", func() {
+		// Arrange
+		innerManager := &fakeManager{}
+		gateOpen := make(chan struct{})
+		mgr := &gatedManager{
+			Manager: innerManager,
+			gate: func(ctx context.Context) error {
+				<-gateOpen
+				return nil
+			},
+		}
+		runnable := &fakeRunnable{needsLeadership: true}
+		Expect(mgr.Add(runnable)).To(Succeed())
+		Expect(innerManager.runnables).To(HaveLen(1))
+		gated := innerManager.runnables[0]
+		done := make(chan error)
+
+		// Act and assert
+		Expect(gated.(manager.LeaderElectionRunnable).NeedLeaderElection()).To(BeTrue())
+		go func() { done <- gated.Start(context.Background()) }()
+		Consistently(done).ShouldNot(Receive())
+		close(gateOpen)
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(runnable.isStarted).To(BeTrue())
+	})
+
+	It("should not start the runnable, if the gate fails", func() {
+		// Arrange
+		innerManager := &fakeManager{}
+		mgr := &gatedManager{
+			Manager: innerManager,
+			gate:    func(ctx context.Context) error { return errors.New("test error") },
+		}
+		runnable := &fakeRunnable{needsLeadership: true}
+		Expect(mgr.Add(runnable)).To(Succeed())
+
+		// Act
+		err := innerManager.runnables[0].Start(context.Background())
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("test error")))
+		Expect(runnable.isStarted).To(BeFalse())
+	})
+
+	It("should add the runnables which opt out of leader election as they are", func() {
+		// Arrange
+		innerManager := &fakeManager{}
+		mgr := &gatedManager{Manager: innerManager, gate: func(context.Context) error { return nil }}
+		runnable := &fakeRunnable{}
+
+		// Act
+		err := mgr.Add(runnable)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(innerManager.runnables).To(Equal([]manager.Runnable{runnable}))
+	})
+})
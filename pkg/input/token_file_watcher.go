@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gutil "github.com/gardener/gardener-custom-metrics/pkg/util/gardener"
+)
+
+// tokenFileName is the name of the file which contains a shoot's access token, in the shoot's token subdirectory
+const tokenFileName = "token"
+
+// tokenFileWatchPeriod is how often the token directory is checked for changes
+const tokenFileWatchPeriod = 10 * time.Second
+
+// tokenFileWatcher feeds shoot access tokens from files into the registry. It is used instead of the secret controller's
+// token handling, when the tokens are not available as secrets in the shoot namespaces, but are mounted into the pod,
+// e.g. projected from another workload.
+//
+// The token directory contains one subdirectory per shoot namespace, named after the namespace, and the shoot's token
+// is read from the tokenFileName file in that subdirectory. The files are polled, rather than watched for file system
+// events, so changes are detected reliably, even when files are replaced via a symbolic link swap, as is the case with
+// projected volumes.
+//
+// tokenFileWatcher implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable].
+type tokenFileWatcher struct {
+	dataRegistry input_data_registry.InputDataRegistry
+	directory    string
+	period       time.Duration
+	selector     *gutil.KapiSelector // Identifies the shoot namespaces. If nil, the Gardener defaults apply.
+	log          logr.Logger
+
+	// The token recorded for each shoot namespace, as of the last check. Only accessed by the watcher goroutine.
+	tokens map[string]string
+
+	testIsolation tokenFileWatcherTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// newTokenFileWatcher creates a tokenFileWatcher which checks the specified directory once per period, and records the
+// tokens found there in dataRegistry.
+func newTokenFileWatcher(
+	dataRegistry input_data_registry.InputDataRegistry,
+	directory string,
+	period time.Duration,
+	selector *gutil.KapiSelector,
+	log logr.Logger) *tokenFileWatcher {
+
+	return &tokenFileWatcher{
+		dataRegistry:  dataRegistry,
+		directory:     directory,
+		period:        period,
+		selector:      selector,
+		log:           log,
+		tokens:        make(map[string]string),
+		testIsolation: tokenFileWatcherTestIsolation{TimeAfter: time.After},
+	}
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It checks the token directory right
+// away, and then once per period, until the context is cancelled.
+func (w *tokenFileWatcher) Start(ctx context.Context) error {
+	w.log.V(app.VerbosityVerbose).Info("Token file watcher started", "directory", w.directory, "period", w.period)
+
+	w.check()
+	for {
+		select {
+		case <-ctx.Done():
+			w.log.V(app.VerbosityInfo).Info("Context closed, exiting")
+			return nil
+		case <-w.testIsolation.TimeAfter(w.period):
+			w.check()
+		}
+	}
+}
+
+// check reads the tokens of all shoot namespaces under the token directory, and updates the registry with the ones
+// which changed, appeared, or disappeared since the last check. If a token file cannot be read, for reasons other than
+// its absence, the previously recorded token is retained.
+func (w *tokenFileWatcher) check() {
+	entries, err := os.ReadDir(w.directory)
+	if err != nil {
+		w.log.V(app.VerbosityError).Error(err, "Failed to read token directory", "directory", w.directory)
+		return
+	}
+
+	tokens := make(map[string]string)
+	for _, entry := range entries {
+		namespace := entry.Name()
+		if !w.selector.IsShootNamespace(namespace) {
+			continue
+		}
+
+		path := filepath.Join(w.directory, namespace, tokenFileName)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				w.log.V(app.VerbosityError).Error(err, "Failed to read token file", "path", path)
+				if previous, ok := w.tokens[namespace]; ok {
+					tokens[namespace] = previous
+				}
+			}
+			continue
+		}
+		token := strings.TrimSpace(string(content))
+		if token == "" {
+			w.log.V(app.VerbosityWarning).Info("Token file is empty", "path", path)
+			continue
+		}
+		tokens[namespace] = token
+	}
+
+	for namespace, token := range tokens {
+		if w.tokens[namespace] != token {
+			w.log.V(app.VerbosityVerbose).Info("Recording shoot access token from file", "namespace", namespace)
+			w.dataRegistry.SetShootAuthSecret(namespace, token)
+		}
+	}
+	for namespace := range w.tokens {
+		if _, ok := tokens[namespace]; !ok {
+			w.log.V(app.VerbosityVerbose).Info("Shoot access token file removed", "namespace", namespace)
+			w.dataRegistry.SetShootAuthSecret(namespace, "")
+		}
+	}
+	w.tokens = tokens
+}
+
+//#region Test isolation
+
+// tokenFileWatcherTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the tokenFileWatcher unit during tests
+type tokenFileWatcherTestIsolation struct {
+	// Points to [time.After]
+	TimeAfter func(time.Duration) <-chan time.Time
+}
+
+//#endregion Test isolation
@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+var _ = Describe("input.tokenFileWatcher", func() {
+	const (
+		nsName    = "shoot--my-shoot"
+		testToken = "my-token"
+	)
+
+	var (
+		newTestWatcher = func() (*tokenFileWatcher, input_data_registry.InputDataRegistry, string) {
+			directory := GinkgoT().TempDir()
+			idr := input_data_registry.NewInputDataRegistry(time.Minute, logr.Discard())
+			return newTokenFileWatcher(idr, directory, time.Minute, nil, logr.Discard()), idr, directory
+		}
+		writeToken = func(directory string, namespace string, token string) {
+			Expect(os.MkdirAll(filepath.Join(directory, namespace), 0o700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(directory, namespace, tokenFileName), []byte(token), 0o600)).To(Succeed())
+		}
+	)
+
+	Describe("check", func() {
+		It("should record the tokens of shoot namespaces, and ignore other directory entries", func() {
+			// Arrange
+			watcher, idr, directory := newTestWatcher()
+			writeToken(directory, nsName, testToken+"\n")
+			writeToken(directory, "garden", "garden-token")
+
+			// Act
+			watcher.check()
+
+			// Assert
+			Expect(idr.GetShootAuthSecret(nsName)).To(Equal(testToken))
+			Expect(idr.GetShootAuthSecret("garden")).To(BeEmpty())
+		})
+
+		It("should record a changed token", func() {
+			// Arrange
+			watcher, idr, directory := newTestWatcher()
+			writeToken(directory, nsName, testToken)
+			watcher.check()
+			writeToken(directory, nsName, "new-token")
+
+			// Act
+			watcher.check()
+
+			// Assert
+			Expect(idr.GetShootAuthSecret(nsName)).To(Equal("new-token"))
+		})
+
+		It("should remove the token of a namespace whose token file disappeared", func() {
+			// Arrange
+			watcher, idr, directory := newTestWatcher()
+			writeToken(directory, nsName, testToken)
+			watcher.check()
+			Expect(os.RemoveAll(filepath.Join(directory, nsName))).To(Succeed())
+
+			// Act
+			watcher.check()
+
+			// Assert
+			Expect(idr.GetShootAuthSecret(nsName)).To(BeEmpty())
+		})
+
+		It("should not record an empty token", func() {
+			// Arrange
+			watcher, idr, directory := newTestWatcher()
+			writeToken(directory, nsName, " \n")
+
+			// Act
+			watcher.check()
+
+			// Assert
+			Expect(idr.GetShootAuthSecret(nsName)).To(BeEmpty())
+		})
+
+		It("should retain the recorded tokens, if the token directory cannot be read", func() {
+			// Arrange
+			watcher, idr, directory := newTestWatcher()
+			writeToken(directory, nsName, testToken)
+			watcher.check()
+			watcher.directory = filepath.Join(directory, "missing")
+
+			// Act
+			watcher.check()
+
+			// Assert
+			Expect(idr.GetShootAuthSecret(nsName)).To(Equal(testToken))
+		})
+	})
+
+	Describe("Start", func() {
+		It("should check right away, and then once per period, until the context is cancelled", func() {
+			// Arrange
+			watcher, idr, directory := newTestWatcher()
+			writeToken(directory, nsName, testToken)
+			timeAfterChan := make(chan time.Time)
+			watcher.testIsolation.TimeAfter = func(_ time.Duration) <-chan time.Time { return timeAfterChan }
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var isComplete atomic.Bool
+
+			// Act and assert
+			go func() {
+				_ = watcher.Start(ctx)
+				isComplete.Store(true)
+			}()
+
+			Eventually(func() string { return idr.GetShootAuthSecret(nsName) }).Should(Equal(testToken))
+			writeToken(directory, nsName, "new-token")
+			timeAfterChan <- time.Now()
+			Eventually(func() string { return idr.GetShootAuthSecret(nsName) }).Should(Equal("new-token"))
+
+			cancel()
+			Eventually(isComplete.Load).Should(BeTrue())
+		})
+	})
+})
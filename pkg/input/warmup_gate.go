@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// How often the WarmupGate checks the scrape coverage, while closed
+const warmupGatePollPeriod = 1 * time.Second
+
+// WarmupGate tracks whether the first scrape wave is complete, i.e. whether enough of the known Kapis produced a fresh
+// metrics sample, since scraping started. Until then, a freshly elected leader only has empty or stale values to
+// serve. The gate starts along with the scraper, i.e. upon election, if leader election is in effect. It opens once
+// the scrape coverage reaches the required fraction, or once the maximum wait elapses, and stays open from then on.
+//
+// The gate is meant to hold off the readiness of the process (see ReadyzCheck), and the registration of the process
+// in the service endpoints (see IsOpen).
+//
+// WarmupGate implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable].
+type WarmupGate struct {
+	dataRegistry input_data_registry.InputDataRegistry
+	// The fraction of the known Kapis which must have a fresh sample, for the gate to open
+	minCoverage float64
+	// The gate opens after this much time, regardless of the scrape coverage
+	maxWait time.Duration
+	log     logr.Logger
+
+	isStarted atomic.Bool
+	isOpen    atomic.Bool
+
+	testIsolation warmupGateTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// newWarmupGate creates a WarmupGate which opens once a minCoverage fraction of the Kapis in dataRegistry have a
+// fresh sample, or maxWait after the gate started, whichever comes first
+func newWarmupGate(
+	dataRegistry input_data_registry.InputDataRegistry,
+	minCoverage float64,
+	maxWait time.Duration,
+	log logr.Logger) *WarmupGate {
+
+	return &WarmupGate{
+		dataRegistry:  dataRegistry,
+		minCoverage:   minCoverage,
+		maxWait:       maxWait,
+		log:           log,
+		testIsolation: warmupGateTestIsolation{TimeNow: time.Now, TimeAfter: time.After},
+	}
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It checks the scrape coverage
+// periodically, until the gate opens, or the context is cancelled.
+func (g *WarmupGate) Start(ctx context.Context) error {
+	startTime := g.testIsolation.TimeNow()
+	g.isStarted.Store(true)
+	g.log.V(app.VerbosityInfo).Info("Waiting for the first scrape wave",
+		"minCoverage", g.minCoverage, "maxWait", g.maxWait)
+
+	for {
+		coverage := g.getCoverage()
+		elapsed := g.testIsolation.TimeNow().Sub(startTime)
+		if coverage.KapiCount > 0 && coverage.Ratio() >= g.minCoverage {
+			g.log.V(app.VerbosityInfo).Info("First scrape wave complete",
+				"kapiCount", coverage.KapiCount, "freshKapiCount", coverage.FreshKapiCount, "elapsed", elapsed)
+			break
+		}
+		if elapsed >= g.maxWait {
+			g.log.V(app.VerbosityInfo).Info("First scrape wave incomplete, but the maximum wait elapsed. Opening anyway",
+				"kapiCount", coverage.KapiCount, "freshKapiCount", coverage.FreshKapiCount)
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-g.testIsolation.TimeAfter(warmupGatePollPeriod):
+		}
+	}
+
+	g.isOpen.Store(true)
+	return nil
+}
+
+// IsOpen returns true once the first scrape wave is complete, or the maximum wait elapsed. Returns false before the
+// gate starts. Concurrency-safe.
+func (g *WarmupGate) IsOpen() bool {
+	return g.isOpen.Load()
+}
+
+// ReadyzCheck implements [sigs.k8s.io/controller-runtime/pkg/healthz.Checker]. It fails while the gate is started,
+// but not yet open. Before the gate starts, e.g. while the process is not the leader, the check succeeds, so a standby
+// replica is not reported unready for the mere fact that it does not scrape.
+func (g *WarmupGate) ReadyzCheck(_ *http.Request) error {
+	if !g.isStarted.Load() || g.isOpen.Load() {
+		return nil
+	}
+	coverage := g.getCoverage()
+	return fmt.Errorf(
+		"waiting for the first scrape wave: %d of %d kube-apiserver pods have a fresh sample, %.0f%% required",
+		coverage.FreshKapiCount, coverage.KapiCount, g.minCoverage*100)
+}
+
+// getCoverage returns the seed-wide scrape coverage
+func (g *WarmupGate) getCoverage() input_data_registry.ScrapeCoverage {
+	var result input_data_registry.ScrapeCoverage
+	for _, coverage := range g.dataRegistry.GetScrapeCoverage() {
+		result = result.Add(coverage)
+	}
+	return result
+}
+
+//#region Test isolation
+
+// warmupGateTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the WarmupGate unit during tests
+type warmupGateTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+	// Points to [time.After]
+	TimeAfter func(time.Duration) <-chan time.Time
+}
+
+//#endregion Test isolation
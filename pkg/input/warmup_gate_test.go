@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package input
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("input.WarmupGate", func() {
+	const maxWait = time.Minute
+
+	var (
+		// Creates a registry with three Kapis, two of which have a fresh sample
+		newTestRegistry = func() *fakes.FakeInputDataRegistry {
+			idr := &fakes.FakeInputDataRegistry{
+				DefaultScrapePeriod: time.Minute,
+				FakeTimeNow:         gcmtesting.NewTime(1, 0, 30),
+			}
+			for _, pod := range []string{"kapi1", "kapi2", "kapi3"} {
+				idr.SetKapiData("shoot--a", pod, "", nil, "")
+			}
+			idr.SetKapiMetricsWithTime("shoot--a", "kapi1", 1, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime("shoot--a", "kapi2", 1, gcmtesting.NewTime(1, 0, 0))
+			return idr
+		}
+		// Creates a gate over the specified registry. The gate's clock advances by the specified step upon each poll.
+		// Returns the gate, and a channel which triggers the gate's next poll.
+		newTestGate = func(
+			idr *fakes.FakeInputDataRegistry, minCoverage float64, step time.Duration) (*WarmupGate, chan time.Time) {
+
+			gate := newWarmupGate(idr, minCoverage, maxWait, logr.Discard())
+			var now atomic.Int64
+			now.Store(gcmtesting.NewTime(1, 0, 0).UnixNano())
+			poll := make(chan time.Time)
+			gate.testIsolation.TimeNow = func() time.Time { return time.Unix(0, now.Load()) }
+			gate.testIsolation.TimeAfter = func(_ time.Duration) <-chan time.Time {
+				now.Add(int64(step))
+				return poll
+			}
+			return gate, poll
+		}
+		// Starts the gate in the background. Returns a function which tells whether Start returned.
+		startGate = func(ctx context.Context, gate *WarmupGate) func() bool {
+			var isComplete atomic.Bool
+			go func() {
+				defer GinkgoRecover()
+				Expect(gate.Start(ctx)).To(Succeed())
+				isComplete.Store(true)
+			}()
+			return isComplete.Load
+		}
+	)
+
+	It("should open right away, if enough Kapis have a fresh sample", func() {
+		// Arrange
+		gate, _ := newTestGate(newTestRegistry(), 0.6, time.Second)
+
+		// Act
+		err := gate.Start(context.Background())
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(gate.IsOpen()).To(BeTrue())
+		Expect(gate.ReadyzCheck(nil)).To(Succeed())
+	})
+
+	It("should stay closed and fail the readiness check, until enough Kapis have a fresh sample", func() {
+		// Arrange
+		idr := newTestRegistry()
+		gate, poll := newTestGate(idr, 0.9, time.Second)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// Act and assert
+		isComplete := startGate(ctx, gate)
+		Eventually(func() error { return gate.ReadyzCheck(nil) }).Should(MatchError(ContainSubstring("2 of 3")))
+		poll <- time.Time{}
+		Consistently(isComplete).Should(BeFalse())
+		Expect(gate.IsOpen()).To(BeFalse())
+
+		idr.SetKapiMetricsWithTime("shoot--a", "kapi3", 1, gcmtesting.NewTime(1, 0, 20))
+		poll <- time.Time{}
+		Eventually(isComplete).Should(BeTrue())
+		Expect(gate.IsOpen()).To(BeTrue())
+		Expect(gate.ReadyzCheck(nil)).To(Succeed())
+	})
+
+	It("should open once the maximum wait elapses, even if too few Kapis have a fresh sample", func() {
+		// Arrange
+		gate, poll := newTestGate(newTestRegistry(), 0.9, maxWait/2)
+
+		// Act
+		isComplete := startGate(context.Background(), gate)
+		poll <- time.Time{}
+		poll <- time.Time{}
+
+		// Assert
+		Eventually(isComplete).Should(BeTrue())
+		Expect(gate.IsOpen()).To(BeTrue())
+	})
+
+	It("should not open while no Kapis are known", func() {
+		// Arrange
+		gate, poll := newTestGate(&fakes.FakeInputDataRegistry{DefaultScrapePeriod: time.Minute}, 0.5, time.Second)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// Act
+		isComplete := startGate(ctx, gate)
+		poll <- time.Time{}
+
+		// Assert
+		Consistently(isComplete).Should(BeFalse())
+		Expect(gate.IsOpen()).To(BeFalse())
+		cancel()
+		Eventually(isComplete).Should(BeTrue())
+		Expect(gate.IsOpen()).To(BeFalse())
+	})
+
+	It("should pass the readiness check before it starts, e.g. while the process is not the leader", func() {
+		// Arrange
+		gate, _ := newTestGate(newTestRegistry(), 0.9, time.Second)
+
+		// Act
+		err := gate.ReadyzCheck(nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(gate.IsOpen()).To(BeFalse())
+	})
+})
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package kapi_api
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	bindAddressFlagName       = "kapi-api-bind-address"
+	tlsCertFileFlagName       = "kapi-api-tls-cert-file"
+	tlsPrivateKeyFileFlagName = "kapi-api-tls-private-key-file"
+	clientCAFileFlagName      = "kapi-api-client-ca-file"
+)
+
+// CLIOptions are command line options related to the gRPC API, which serves the Kapi metrics records to other seed
+// components.
+type CLIOptions struct {
+	config *CLIConfig // Contains the final, processed values of the options
+
+	// For the meaning of the different option fields, see the CLIConfig type, which mirrors these fields
+	BindAddress       string
+	TLSCertFile       string
+	TLSPrivateKeyFile string
+	ClientCAFile      string
+}
+
+// NewCLIOptions creates a CLIOptions object with default values
+func NewCLIOptions() *CLIOptions {
+	return &CLIOptions{}
+}
+
+// AddFlags implements [github.com/gardener/gardener/extensions/pkg/controller/cmd.Flagger.AddFlags].
+func (options *CLIOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(
+		&options.BindAddress,
+		bindAddressFlagName,
+		options.BindAddress,
+		"If specified, a gRPC API serving the Kapi metrics records is exposed at this address (e.g. ':9444'). Clients "+
+			fmt.Sprintf("must present a certificate signed by the CA in --%s. ", clientCAFileFlagName)+
+			"Default: gRPC API disabled")
+	flags.StringVar(
+		&options.TLSCertFile,
+		tlsCertFileFlagName,
+		options.TLSCertFile,
+		"Path to a PEM file with the serving certificate of the gRPC API. Reloaded when the file changes.")
+	flags.StringVar(
+		&options.TLSPrivateKeyFile,
+		tlsPrivateKeyFileFlagName,
+		options.TLSPrivateKeyFile,
+		fmt.Sprintf("Path to a PEM file with the private key matching --%s.", tlsCertFileFlagName))
+	flags.StringVar(
+		&options.ClientCAFile,
+		clientCAFileFlagName,
+		options.ClientCAFile,
+		"Path to a PEM file with the CA certificates which verify the client certificates presented to the gRPC API.")
+}
+
+// Complete implements [github.com/gardener/gardener/extensions/pkg/controller/cmd.Completer.Complete].
+func (options *CLIOptions) Complete() error {
+	if options.BindAddress != "" {
+		if _, _, err := net.SplitHostPort(options.BindAddress); err != nil {
+			return fmt.Errorf("invalid --%s option: %w", bindAddressFlagName, err)
+		}
+		if options.TLSCertFile == "" || options.TLSPrivateKeyFile == "" || options.ClientCAFile == "" {
+			return fmt.Errorf(
+				"the --%s option requires the --%s, --%s, and --%s options",
+				bindAddressFlagName, tlsCertFileFlagName, tlsPrivateKeyFileFlagName, clientCAFileFlagName)
+		}
+	}
+
+	options.config = &CLIConfig{
+		BindAddress:       options.BindAddress,
+		TLSCertFile:       options.TLSCertFile,
+		TLSPrivateKeyFile: options.TLSPrivateKeyFile,
+		ClientCAFile:      options.ClientCAFile,
+	}
+	return nil
+}
+
+// Completed returns the final, processed values of the options. Only call this if `Complete` was successful.
+func (options *CLIOptions) Completed() *CLIConfig {
+	return options.config
+}
+
+// CLIConfig is a completed configuration, result of successfully parsing and processing CLI options.
+// It contains configuration which directs the gRPC API serving the Kapi metrics records.
+type CLIConfig struct {
+	BindAddress string // The address where the API is served. Empty means the API is disabled.
+
+	// Mutual TLS. All three files are specified, if the API is enabled.
+	TLSCertFile       string // Path to a PEM file with the serving certificate. Reloaded when the file changes.
+	TLSPrivateKeyFile string // Path to a PEM file with the private key of the serving certificate
+	ClientCAFile      string // Path to a PEM file with CA certificates which verify the client certificates
+}
+
+// IsEnabled tells whether the gRPC API is enabled
+func (config *CLIConfig) IsEnabled() bool {
+	return config.BindAddress != ""
+}
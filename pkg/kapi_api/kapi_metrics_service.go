@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package kapi_api
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/utils/ptr"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/kapi_api/kapiv1"
+)
+
+// kapiMetricsService implements [kapiv1.KapiMetricsServer], based on the Kapi records held by an InputDataSource
+type kapiMetricsService struct {
+	kapiv1.UnimplementedKapiMetricsServer
+
+	dataSource input_data_registry.InputDataSource
+	log        logr.Logger
+}
+
+// newKapiMetricsService creates a kapiMetricsService which serves the Kapi records held by dataSource
+func newKapiMetricsService(dataSource input_data_registry.InputDataSource, log logr.Logger) *kapiMetricsService {
+	return &kapiMetricsService{
+		dataSource: dataSource,
+		log:        log,
+	}
+}
+
+// GetShootKapis implements [kapiv1.KapiMetricsServer.GetShootKapis]
+func (s *kapiMetricsService) GetShootKapis(
+	_ context.Context, request *kapiv1.GetShootKapisRequest) (*kapiv1.ShootKapis, error) {
+
+	if request.ShootNamespace == "" {
+		return nil, status.Error(codes.InvalidArgument, "the shoot namespace is not specified")
+	}
+	return s.getShootKapis(request.ShootNamespace), nil
+}
+
+// WatchShootKapis implements [kapiv1.KapiMetricsServer.WatchShootKapis]. The stream ends when the client cancels it.
+func (s *kapiMetricsService) WatchShootKapis(
+	request *kapiv1.WatchShootKapisRequest, stream kapiv1.KapiMetrics_WatchShootKapisServer) error {
+
+	shootNamespace := request.ShootNamespace
+	if shootNamespace == "" {
+		return status.Error(codes.InvalidArgument, "the shoot namespace is not specified")
+	}
+	log := s.log.WithValues("op", "watchShootKapis", "namespace", shootNamespace)
+	log.V(app.VerbosityVerbose).Info("Watch started")
+	defer log.V(app.VerbosityVerbose).Info("Watch ended")
+
+	// Capacity of one is enough: a pending signal already guarantees that the latest records get sent
+	changed := make(chan struct{}, 1)
+	signalChange := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	var sampleWatcher input_data_registry.SampleWatcher = func(namespace string) {
+		if namespace == shootNamespace {
+			signalChange()
+		}
+	}
+	var kapiWatcher input_data_registry.KapiWatcher = func(
+		kapi input_data_registry.ShootKapi, _ input_data_registry.KapiEventType) {
+
+		if kapi.ShootNamespace() == shootNamespace {
+			signalChange()
+		}
+	}
+	s.dataSource.AddSampleWatcher(&sampleWatcher)
+	defer s.dataSource.RemoveSampleWatcher(&sampleWatcher)
+	s.dataSource.AddKapiWatcher(&kapiWatcher, false)
+	defer s.dataSource.RemoveKapiWatcher(&kapiWatcher)
+
+	isSent := false
+	var sentGeneration uint64
+	for {
+		// A change signal may not come with a new generation, e.g. if it refers to a change already sent
+		if message := s.getShootKapis(shootNamespace); !isSent || message.Generation != sentGeneration {
+			if err := stream.Send(message); err != nil {
+				return err
+			}
+			isSent, sentGeneration = true, message.Generation
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+// getShootKapis returns the current records for the Kapis of the specified shoot
+func (s *kapiMetricsService) getShootKapis(shootNamespace string) *kapiv1.ShootKapis {
+	// Read the generation first. If the records change in between, the generation is older than the records, and
+	// watchers send the same records again, instead of missing the change.
+	result := &kapiv1.ShootKapis{
+		ShootNamespace: shootNamespace,
+		Generation:     s.dataSource.GetShootGeneration(shootNamespace),
+	}
+	for _, kapi := range s.dataSource.GetShootKapis(shootNamespace) {
+		result.Kapis = append(result.Kapis, toShootKapiMessage(kapi))
+	}
+	return result
+}
+
+// toShootKapiMessage converts the specified Kapi record to its API representation
+func toShootKapiMessage(kapi input_data_registry.ShootKapi) *kapiv1.ShootKapi {
+	result := &kapiv1.ShootKapi{
+		PodName:              kapi.PodName(),
+		PodUid:               string(kapi.PodUID()),
+		TotalRequestCountNew: kapi.TotalRequestCountNew(),
+		MetricsTimeNew:       toTimestamp(kapi.MetricsTimeNew()),
+		TotalRequestCountOld: kapi.TotalRequestCountOld(),
+		MetricsTimeOld:       toTimestamp(kapi.MetricsTimeOld()),
+		InflightRequestCount: kapi.InflightRequestCount(),
+		InflightRequestTime:  toTimestamp(kapi.InflightRequestTime()),
+	}
+	if !kapi.MetricsTimeNew().IsZero() && !kapi.MetricsTimeOld().IsZero() {
+		if gap := kapi.MetricsTimeNew().Sub(kapi.MetricsTimeOld()); gap > 0 {
+			requestCount := kapi.TotalRequestCountNew() - kapi.TotalRequestCountOld()
+			result.RequestRate = ptr.To(float64(requestCount) / gap.Seconds())
+		}
+	}
+	return result
+}
+
+// toTimestamp converts the specified point in time to its API representation. Returns nil for the zero time.
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package kapi_api
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/kapi_api/kapiv1"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+// fakeWatchStream implements [kapiv1.KapiMetrics_WatchShootKapisServer]. Sent messages are delivered to a channel.
+type fakeWatchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *kapiv1.ShootKapis
+}
+
+func (s *fakeWatchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeWatchStream) Send(message *kapiv1.ShootKapis) error {
+	s.sent <- message
+	return nil
+}
+
+var _ = Describe("kapi_api.kapiMetricsService", func() {
+	const testNs = "shoot--my-shoot"
+
+	var (
+		newTestService = func() (*kapiMetricsService, *fakes.FakeInputDataRegistry) {
+			idr := &fakes.FakeInputDataRegistry{}
+			idr.SetKapiData(testNs, "pod1", "uid1", nil, "https://10.0.0.1/metrics")
+			return newKapiMetricsService(idr.DataSource(), logr.Discard()), idr
+		}
+	)
+
+	Describe("GetShootKapis", func() {
+		It("should return the Kapi records, with the request rate between the two most recent samples", func() {
+			// Arrange
+			service, idr := newTestService()
+			idr.SetKapiMetricsWithTime(testNs, "pod1", 100, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, "pod1", 700, gcmtesting.NewTime(1, 1, 0))
+			idr.SetKapiInflightRequestsWithTime(testNs, "pod1", 5, gcmtesting.NewTime(1, 1, 0))
+
+			// Act
+			result, err := service.GetShootKapis(context.Background(), &kapiv1.GetShootKapisRequest{ShootNamespace: testNs})
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result.ShootNamespace).To(Equal(testNs))
+			Expect(result.Generation).NotTo(BeZero())
+			Expect(result.Kapis).To(HaveLen(1))
+			kapi := result.Kapis[0]
+			Expect(kapi.PodName).To(Equal("pod1"))
+			Expect(kapi.PodUid).To(Equal("uid1"))
+			Expect(kapi.TotalRequestCountNew).To(Equal(int64(700)))
+			Expect(kapi.MetricsTimeNew.AsTime()).To(BeTemporally("==", gcmtesting.NewTime(1, 1, 0)))
+			Expect(kapi.TotalRequestCountOld).To(Equal(int64(100)))
+			Expect(kapi.MetricsTimeOld.AsTime()).To(BeTemporally("==", gcmtesting.NewTime(1, 0, 0)))
+			Expect(kapi.RequestRate).NotTo(BeNil())
+			Expect(*kapi.RequestRate).To(BeNumerically("~", 10.0))
+			Expect(kapi.InflightRequestCount).To(Equal(int64(5)))
+			Expect(kapi.InflightRequestTime.AsTime()).To(BeTemporally("==", gcmtesting.NewTime(1, 1, 0)))
+		})
+		It("should omit the request rate and the sample times, if the samples are missing", func() {
+			// Arrange
+			service, idr := newTestService()
+			idr.SetKapiMetricsWithTime(testNs, "pod1", 100, gcmtesting.NewTime(1, 0, 0))
+
+			// Act
+			result, err := service.GetShootKapis(context.Background(), &kapiv1.GetShootKapisRequest{ShootNamespace: testNs})
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result.Kapis).To(HaveLen(1))
+			Expect(result.Kapis[0].MetricsTimeNew).NotTo(BeNil())
+			Expect(result.Kapis[0].MetricsTimeOld).To(BeNil())
+			Expect(result.Kapis[0].RequestRate).To(BeNil())
+			Expect(result.Kapis[0].InflightRequestTime).To(BeNil())
+		})
+		It("should fail with InvalidArgument, if the shoot namespace is not specified", func() {
+			// Arrange
+			service, _ := newTestService()
+
+			// Act
+			_, err := service.GetShootKapis(context.Background(), &kapiv1.GetShootKapisRequest{})
+
+			// Assert
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Describe("WatchShootKapis", func() {
+		It("should send the current records first, and then the records upon each change to the shoot", func() {
+			// Arrange
+			service, idr := newTestService()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream := &fakeWatchStream{ctx: ctx, sent: make(chan *kapiv1.ShootKapis, 10)}
+			done := make(chan error)
+
+			// Act and assert
+			go func() {
+				done <- service.WatchShootKapis(&kapiv1.WatchShootKapisRequest{ShootNamespace: testNs}, stream)
+			}()
+			Eventually(stream.sent).Should(Receive()) // The watchers are added by now
+			Expect(idr.GetSampleWatcher()).NotTo(BeNil())
+			Expect(idr.GetWatcher()).NotTo(BeNil())
+			(*idr.GetSampleWatcher())("shoot--other-shoot")
+			Consistently(stream.sent, "50ms").ShouldNot(Receive())
+			idr.SetKapiMetricsWithTime(testNs, "pod1", 100, gcmtesting.NewTime(1, 0, 0))
+			(*idr.GetSampleWatcher())(testNs)
+			var message *kapiv1.ShootKapis
+			Eventually(stream.sent).Should(Receive(&message))
+			Expect(message.Kapis[0].TotalRequestCountNew).To(Equal(int64(100)))
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(idr.GetSampleWatcher()).To(BeNil())
+			Expect(idr.GetWatcher()).To(BeNil())
+		})
+		It("should fail with InvalidArgument, if the shoot namespace is not specified", func() {
+			// Arrange
+			service, _ := newTestService()
+			stream := &fakeWatchStream{ctx: context.Background(), sent: make(chan *kapiv1.ShootKapis, 10)}
+
+			// Act
+			err := service.WatchShootKapis(&kapiv1.WatchShootKapisRequest{}, stream)
+
+			// Assert
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(stream.sent).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package kapi_api serves the Kapi metrics records via a gRPC API, secured with mutual TLS. The API gives other seed
+// components, e.g. a proactive scaler, programmatic access to the records, without going through the aggregated K8s
+// API. The API is defined in the kapiv1 package.
+package kapi_api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/kapi_api/kapiv1"
+)
+
+// Server serves the [kapiv1.KapiMetricsServer] API, over mutual TLS. The serving certificate is reloaded when its
+// file changes.
+//
+// Server implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable]. Like the other consumers of the registry,
+// it only runs on the leader.
+type Server struct {
+	config      *CLIConfig
+	service     *kapiMetricsService
+	certWatcher *certwatcher.CertWatcher
+	tlsConfig   *tls.Config
+	log         logr.Logger
+}
+
+// NewServer creates a Server which serves the Kapi records held by dataSource, as directed by config. Fails if the
+// certificate files specified by config cannot be loaded.
+func NewServer(
+	dataSource input_data_registry.InputDataSource, config *CLIConfig, parentLogger logr.Logger) (*Server, error) {
+
+	certWatcher, err := certwatcher.New(config.TLSCertFile, config.TLSPrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("creating Kapi gRPC API server: loading serving certificate: %w", err)
+	}
+	clientCACertificates, err := os.ReadFile(config.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("creating Kapi gRPC API server: reading client CA file: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(clientCACertificates) {
+		return nil, fmt.Errorf(
+			"creating Kapi gRPC API server: client CA file '%s' contains no certificates", config.ClientCAFile)
+	}
+
+	log := parentLogger.WithName("kapi-api")
+	return &Server{
+		config:      config,
+		service:     newKapiMetricsService(dataSource, log),
+		certWatcher: certWatcher,
+		tlsConfig: &tls.Config{
+			GetCertificate: certWatcher.GetCertificate,
+			ClientCAs:      clientCAs,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			MinVersion:     tls.VersionTLS12,
+		},
+		log: log,
+	}, nil
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It serves the API until the context is
+// cancelled. Fails if the bind address is not available.
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.config.BindAddress)
+	if err != nil {
+		return fmt.Errorf("starting Kapi gRPC API server: %w", err)
+	}
+	return s.serve(ctx, listener)
+}
+
+// serve serves the API on the specified listener, until the context is cancelled. Closes the listener.
+func (s *Server) serve(ctx context.Context, listener net.Listener) error {
+	log := s.log.WithValues("op", "kapiAPIProc")
+	go func() {
+		if err := s.certWatcher.Start(ctx); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to watch the serving certificate files")
+		}
+	}()
+
+	grpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	kapiv1.RegisterKapiMetricsServer(grpcServer, s.service)
+	serveResult := make(chan error, 1)
+	go func() {
+		serveResult <- grpcServer.Serve(listener)
+	}()
+	log.V(app.VerbosityInfo).Info("Kapi gRPC API server started", "address", listener.Addr().String())
+
+	select {
+	case <-ctx.Done():
+		// Not a graceful stop. Watch streams only end when the client cancels them, so it could take forever.
+		grpcServer.Stop()
+		log.V(app.VerbosityInfo).Info("Context closed, exiting")
+		return nil
+	case err := <-serveResult:
+		return fmt.Errorf("serving Kapi gRPC API: %w", err)
+	}
+}
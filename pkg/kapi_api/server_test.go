@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package kapi_api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/kapi_api/kapiv1"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("kapi_api.Server", func() {
+	const testNs = "shoot--my-shoot"
+
+	var (
+		// Creates a certificate for 127.0.0.1, signed by the specified parent. A nil parent means self-signed CA.
+		newCertificate = func(
+			commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(time.Now().UnixNano()),
+				Subject:      pkix.Name{CommonName: commonName},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(time.Hour),
+				IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+				KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			}
+			if parent == nil {
+				template.IsCA, template.BasicConstraintsValid = true, true
+				parent, parentKey = template, key
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+			Expect(err).NotTo(HaveOccurred())
+			certificate, err := x509.ParseCertificate(der)
+			Expect(err).NotTo(HaveOccurred())
+			return certificate, key
+		}
+		// Writes the certificate, and optionally the key, as PEM files to dir. Returns the paths.
+		writePEM = func(dir string, name string, certificate *x509.Certificate, key *ecdsa.PrivateKey) (string, string) {
+			certPath := filepath.Join(dir, name+".crt")
+			Expect(os.WriteFile(
+				certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}), 0600)).To(Succeed())
+			if key == nil {
+				return certPath, ""
+			}
+			keyDER, err := x509.MarshalECPrivateKey(key)
+			Expect(err).NotTo(HaveOccurred())
+			keyPath := filepath.Join(dir, name+".key")
+			Expect(os.WriteFile(
+				keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)).To(Succeed())
+			return certPath, keyPath
+		}
+	)
+
+	Describe("serve", func() {
+		var (
+			serverCA   *x509.Certificate
+			clientCA   *x509.Certificate
+			clientCert tls.Certificate
+			address    string
+		)
+
+		BeforeEach(func() {
+			// Arrange
+			dir := GinkgoT().TempDir()
+			var serverCAKey, clientCAKey *ecdsa.PrivateKey
+			serverCA, serverCAKey = newCertificate("server-ca", nil, nil)
+			clientCA, clientCAKey = newCertificate("client-ca", nil, nil)
+			servingCert, servingKey := newCertificate("server", serverCA, serverCAKey)
+			certificate, key := newCertificate("client", clientCA, clientCAKey)
+			clientCert = tls.Certificate{Certificate: [][]byte{certificate.Raw}, PrivateKey: key}
+
+			config := &CLIConfig{BindAddress: "127.0.0.1:0"}
+			config.TLSCertFile, config.TLSPrivateKeyFile = writePEM(dir, "server", servingCert, servingKey)
+			config.ClientCAFile, _ = writePEM(dir, "client-ca", clientCA, nil)
+			idr := &fakes.FakeInputDataRegistry{}
+			idr.SetKapiData(testNs, "pod1", "uid1", nil, "https://10.0.0.1/metrics")
+			server, err := NewServer(idr.DataSource(), config, logr.Discard())
+			Expect(err).NotTo(HaveOccurred())
+
+			listener, err := net.Listen("tcp", config.BindAddress)
+			Expect(err).NotTo(HaveOccurred())
+			address = listener.Addr().String()
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() { done <- server.serve(ctx, listener) }()
+			DeferCleanup(func() {
+				cancel()
+				Eventually(done).Should(Receive(BeNil()))
+			})
+		})
+
+		// Calls GetShootKapis over a connection which presents the specified client certificates
+		var getShootKapis = func(clientCertificates []tls.Certificate) (*kapiv1.ShootKapis, error) {
+			rootCAs := x509.NewCertPool()
+			rootCAs.AddCert(serverCA)
+			tlsConfig := &tls.Config{RootCAs: rootCAs, Certificates: clientCertificates, MinVersion: tls.VersionTLS12}
+			connection, err := grpc.Dial(address, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+			Expect(err).NotTo(HaveOccurred())
+			defer connection.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return kapiv1.NewKapiMetricsClient(connection).GetShootKapis(
+				ctx, &kapiv1.GetShootKapisRequest{ShootNamespace: testNs})
+		}
+
+		It("should serve clients which present a certificate signed by the client CA", func() {
+			// Act
+			result, err := getShootKapis([]tls.Certificate{clientCert})
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Kapis).To(HaveLen(1))
+			Expect(result.Kapis[0].PodName).To(Equal("pod1"))
+		})
+		It("should reject clients which present no certificate", func() {
+			// Act
+			_, err := getShootKapis(nil)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("NewServer", func() {
+		It("should fail, if the client CA file contains no certificates", func() {
+			// Arrange
+			dir := GinkgoT().TempDir()
+			caCert, caKey := newCertificate("ca", nil, nil)
+			config := &CLIConfig{BindAddress: "127.0.0.1:0", ClientCAFile: filepath.Join(dir, "empty.crt")}
+			config.TLSCertFile, config.TLSPrivateKeyFile = writePEM(dir, "server", caCert, caKey)
+			Expect(os.WriteFile(config.ClientCAFile, []byte("no certificates here"), 0600)).To(Succeed())
+
+			// Act
+			_, err := NewServer((&fakes.FakeInputDataRegistry{}).DataSource(), config, logr.Discard())
+
+			// Assert
+			Expect(err).To(MatchError(ContainSubstring("contains no certificates")))
+		})
+	})
+})
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+)
+
+// AverageRequestRateMetricName is the name of the metric which describes a shoot namespace with the request rate of
+// the shoot's Kapis, averaged across the ready Kapi pods: the sum of the request rates of all Kapi pods, divided by the
+// number of ready ones. HPAs which target Pods metrics average across pods on their own. This metric serves consumers
+// which use Object metrics, and thus need an explicit average. See SetAverageRequestRateMetric.
+const AverageRequestRateMetricName = "shoot:apiserver_request_total:avg"
+
+// SetAverageRequestRateMetric enables or disables serving the AverageRequestRateMetricName metric, for each shoot
+// namespace. The metric is not subject to [MetricNaming.NameOverrides]. Must be called before the MetricsProvider
+// starts serving requests.
+func (mp *MetricsProvider) SetAverageRequestRateMetric(isEnabled bool) {
+	mp.serveAverageRequestRate = isEnabled
+}
+
+// isAverageRequestRateRequest returns true if the request is for the average request rate metric
+func (mp *MetricsProvider) isAverageRequestRateRequest(metricInfo provider.CustomMetricInfo) bool {
+	return mp.serveAverageRequestRate &&
+		metricInfo.GroupResource == namespacesGroupResource &&
+		metricInfo.Metric == AverageRequestRateMetricName
+}
+
+// listAverageRequestRateMetrics returns the average request rate metric, if it is enabled. Otherwise, empty.
+func (mp *MetricsProvider) listAverageRequestRateMetrics() []provider.CustomMetricInfo {
+	if !mp.serveAverageRequestRate {
+		return nil
+	}
+	return []provider.CustomMetricInfo{{GroupResource: namespacesGroupResource, Metric: AverageRequestRateMetricName}}
+}
+
+// getAverageRequestRateMetric returns the request rate of the Kapis of the specified shoot, averaged across the ready
+// Kapi pods. The rates are calculated like the request rate metric. Kapis whose rate cannot be calculated, e.g. because
+// their samples are too old, do not contribute to the sum, but still count as ready. Returns nil, if no Kapi pod is
+// ready, if the rate cannot be calculated for any Kapi, or if the value does not match the metricSelector.
+func (mp *MetricsProvider) getAverageRequestRateMetric(
+	shootNamespace string, metricSelector labels.Selector) *custom_metrics.MetricValue {
+
+	computer := &requestRateComputer{}
+	computeContext := mp.newComputeContext()
+	var (
+		readyCount    int64
+		totalMilli    int64
+		isComputed    bool
+		timestamp     time.Time
+		windowSeconds *int64
+	)
+	for _, kapi := range mp.dataSource.GetShootKapis(shootNamespace) {
+		if kapi.IsReady() {
+			readyCount++
+		}
+		computed, ok := computer.Compute(kapi, computeContext)
+		if !ok {
+			continue
+		}
+		isComputed = true
+		totalMilli += computed.Value.MilliValue()
+		if computed.Timestamp.After(timestamp) {
+			timestamp = computed.Timestamp
+		}
+		if windowSeconds == nil || *computed.WindowSeconds > *windowSeconds {
+			windowSeconds = computed.WindowSeconds
+		}
+	}
+	if readyCount == 0 || !isComputed {
+		return nil
+	}
+	if metricSelector != nil && !metricSelector.Matches(mp.naming.selectableLabels(windowSeconds)) {
+		return nil
+	}
+
+	return &custom_metrics.MetricValue{
+		DescribedObject: custom_metrics.ObjectReference{
+			Kind:       "Namespace",
+			Name:       shootNamespace,
+			APIVersion: "v1",
+		},
+		Metric: custom_metrics.MetricIdentifier{
+			Name:     AverageRequestRateMetricName,
+			Selector: mp.naming.staticLabelSelector(),
+		},
+		Value:         *resource.NewMilliQuantity(totalMilli/readyCount, resource.DecimalSI),
+		Timestamp:     metav1.Time{Time: timestamp},
+		WindowSeconds: windowSeconds,
+	}
+}
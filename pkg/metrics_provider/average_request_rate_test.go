@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("MetricsProvider average request rate metric", func() {
+	const (
+		testNs = "shoot--my-shoot"
+	)
+	var (
+		averageMetricInfo = mxprov.CustomMetricInfo{
+			GroupResource: schema.GroupResource{Resource: "namespaces"},
+			Metric:        AverageRequestRateMetricName,
+		}
+
+		// Creates a provider which serves the average request rate metric, over three Kapis, with request rates of
+		// 10, 20, and 30 per second. The third Kapi is not ready.
+		newTestProvider = func() (*MetricsProvider, *fakes.FakeInputDataRegistry) {
+			idr := &fakes.FakeInputDataRegistry{}
+			for i, podName := range []string{"pod1", "pod2", "pod3"} {
+				idr.SetKapiData(testNs, podName, "", nil, "")
+				idr.SetKapiMetricsWithTime(testNs, podName, 0, gcmtesting.NewTime(1, 0, 0))
+				idr.SetKapiMetricsWithTime(testNs, podName, int64(600*(i+1)), gcmtesting.NewTime(1, 1, 0))
+			}
+			idr.SetKapiReady(testNs, "pod3", false)
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			provider.SetAverageRequestRateMetric(true)
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+			return provider, idr
+		}
+		getAverage = func(provider *MetricsProvider) (*float64, error) {
+			result, err := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Name: testNs}, averageMetricInfo, labels.Everything())
+			if result == nil {
+				return nil, err
+			}
+			value := result.Value.AsApproximateFloat64()
+			return &value, err
+		}
+	)
+
+	It("should list the metric as describing namespaces, if enabled", func() {
+		// Arrange
+		provider, _ := newTestProvider()
+
+		// Act
+		metrics := provider.ListAllMetrics()
+
+		// Assert
+		Expect(metrics).To(ContainElement(averageMetricInfo))
+	})
+	It("should not list the metric, if not enabled", func() {
+		// Arrange
+		provider, _ := newTestProvider()
+		provider.SetAverageRequestRateMetric(false)
+
+		// Act
+		metrics := provider.ListAllMetrics()
+
+		// Assert
+		Expect(metrics).NotTo(ContainElement(averageMetricInfo))
+	})
+	It("should serve the total request rate of the shoot's Kapis, divided by the number of ready Kapis", func() {
+		// Arrange
+		provider, _ := newTestProvider()
+
+		// Act
+		average, err := getAverage(provider)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(average).NotTo(BeNil())
+		Expect(*average).To(BeNumerically("~", 30)) // (10 + 20 + 30) / 2
+	})
+	It("should describe the namespace, with the time and window of the samples", func() {
+		// Arrange
+		provider, _ := newTestProvider()
+
+		// Act
+		result, err := provider.GetMetricByName(
+			context.Background(), types.NamespacedName{Name: testNs}, averageMetricInfo, labels.Everything())
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(result.DescribedObject.Kind).To(Equal("Namespace"))
+		Expect(result.DescribedObject.Name).To(Equal(testNs))
+		Expect(result.Timestamp.Time).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+		Expect(*result.WindowSeconds).To(Equal(int64(60)))
+	})
+	It("should not serve the metric, if no Kapi is ready", func() {
+		// Arrange
+		provider, idr := newTestProvider()
+		idr.SetKapiReady(testNs, "pod1", false)
+		idr.SetKapiReady(testNs, "pod2", false)
+
+		// Act
+		average, err := getAverage(provider)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(average).To(BeNil())
+	})
+	It("should not serve the metric, if the samples are too old", func() {
+		// Arrange
+		provider, _ := newTestProvider()
+		provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 10, 0)
+
+		// Act
+		average, err := getAverage(provider)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(average).To(BeNil())
+	})
+	It("should not serve the metric, if not enabled", func() {
+		// Arrange
+		provider, _ := newTestProvider()
+		provider.SetAverageRequestRateMetric(false)
+
+		// Act
+		average, err := getAverage(provider)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(average).To(BeNil())
+	})
+})
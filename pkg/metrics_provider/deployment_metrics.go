@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+)
+
+// deploymentsGroupResource identifies requests for object metrics which describe Deployments, rather than pods
+var deploymentsGroupResource = schema.GroupResource{Group: "apps", Resource: "deployments"}
+
+// DeploymentSource provides the Deployment objects, for which the MetricsProvider serves object metrics, aggregated
+// over the Kapi pods which match the Deployment's selector
+type DeploymentSource interface {
+	// GetDeployment returns the Deployment with the specified name. Returns nil, and no error, if there is no such
+	// Deployment.
+	GetDeployment(ctx context.Context, namespace string, name string) (*appsv1.Deployment, error)
+	// ListDeployments returns the Deployments in the specified namespace, which match the selector
+	ListDeployments(ctx context.Context, namespace string, selector labels.Selector) ([]appsv1.Deployment, error)
+}
+
+// MetricAggregator can optionally be implemented by a MetricComputer, to control how the values it calculates for the
+// individual Kapi pods are combined into the single value served for a Deployment. Computers which do not implement
+// it have their values summed.
+type MetricAggregator interface {
+	// Aggregate combines the specified values, of which there is at least one, into a single value
+	Aggregate(values []ComputedValue) ComputedValue
+}
+
+// SetDeploymentSource enables serving object metrics for Deployments (GroupResource apps/deployments), based on the
+// Deployments provided by the specified source. Must be called before the MetricsProvider starts serving requests.
+func (mp *MetricsProvider) SetDeploymentSource(source DeploymentSource) {
+	mp.deploymentSource = source
+}
+
+// getDeploymentMetrics returns a metric value for each of the specified Deployments, aggregated over the Kapi pods
+// which match the Deployment's selector. Deployments which have no such pods with a value are omitted from the result.
+// Metric values which do not match the metricSelector are excluded from the result.
+func (mp *MetricsProvider) getDeploymentMetrics(
+	namespace string,
+	deployments []appsv1.Deployment,
+	metricInfo provider.CustomMetricInfo,
+	metricSelector labels.Selector) (*custom_metrics.MetricValueList, error) {
+
+	computer := mp.findComputer(metricInfo.Metric)
+	if computer == nil {
+		return &custom_metrics.MetricValueList{}, nil
+	}
+
+	kapis := mp.dataSource.GetShootKapis(namespace)
+	computeContext := mp.newComputeContext()
+	staticLabelSelector := mp.naming.staticLabelSelector()
+	result := &custom_metrics.MetricValueList{}
+	for i := range deployments {
+		deployment := &deployments[i]
+		podSelector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("parsing the pod selector of deployment %s/%s: %w", namespace, deployment.Name, err)
+		}
+		if podSelector.Empty() {
+			// Selects every pod in the namespace. Not a meaningful way to identify the Kapi pods.
+			continue
+		}
+
+		var values []ComputedValue
+		for _, kapi := range kapis {
+			if !podSelector.Matches(labels.Set(kapi.PodLabels())) || mp.isExcluded(kapi) {
+				continue
+			}
+			if computed, ok := computer.Compute(kapi, computeContext); ok {
+				values = append(values, computed)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		aggregated := sumValues(values)
+		if aggregator, ok := computer.(MetricAggregator); ok {
+			aggregated = aggregator.Aggregate(values)
+		}
+		if metricSelector != nil && !metricSelector.Matches(mp.naming.selectableLabels(aggregated.WindowSeconds)) {
+			continue
+		}
+
+		result.Items = append(result.Items, custom_metrics.MetricValue{
+			DescribedObject: custom_metrics.ObjectReference{
+				Kind:       "Deployment",
+				Name:       deployment.Name,
+				Namespace:  namespace,
+				APIVersion: appsv1.SchemeGroupVersion.String(),
+				UID:        deployment.UID,
+			},
+			Metric: custom_metrics.MetricIdentifier{
+				Name:     metricInfo.Metric,
+				Selector: staticLabelSelector,
+			},
+			Value:         aggregated.Value,
+			Timestamp:     metav1.Time{Time: aggregated.Timestamp},
+			WindowSeconds: aggregated.WindowSeconds,
+		})
+	}
+
+	return result, nil
+}
+
+// sumValues is the default aggregation of per-pod values into a Deployment's value. The timestamp and the window of the
+// result are those of the oldest, respectively the longest, of the values, so the result does not claim more freshness
+// or precision than its least fresh and least precise part.
+func sumValues(values []ComputedValue) ComputedValue {
+	result := combineTimeAndWindow(values)
+	result.Value = *resource.NewMilliQuantity(0, resource.DecimalSI)
+	for _, value := range values {
+		result.Value.Add(value.Value)
+	}
+	return result
+}
+
+// combineTimeAndWindow returns a ComputedValue with no value, and with the oldest timestamp and the longest window
+// among the specified values
+func combineTimeAndWindow(values []ComputedValue) ComputedValue {
+	result := ComputedValue{Timestamp: values[0].Timestamp}
+	for _, value := range values {
+		if value.Timestamp.Before(result.Timestamp) {
+			result.Timestamp = value.Timestamp
+		}
+		if value.WindowSeconds != nil && (result.WindowSeconds == nil || *value.WindowSeconds > *result.WindowSeconds) {
+			result.WindowSeconds = value.WindowSeconds
+		}
+	}
+	return result
+}
+
+// Aggregate implements MetricAggregator. The age of a Deployment's data is that of its stalest pod.
+func (c *sampleAgeComputer) Aggregate(values []ComputedValue) ComputedValue {
+	result := combineTimeAndWindow(values)
+	result.Value = values[0].Value
+	for _, value := range values {
+		if value.Value.Cmp(result.Value) > 0 {
+			result.Value = value.Value
+		}
+	}
+	return result
+}
+
+// Aggregate implements MetricAggregator. The latency of a Deployment is the mean of its pods' average latencies.
+func (c *requestLatencyComputer) Aggregate(values []ComputedValue) ComputedValue {
+	result := sumValues(values)
+	mean := float64(result.Value.MilliValue()) / float64(len(values))
+	result.Value = *resource.NewMilliQuantity(int64(math.Round(mean)), resource.DecimalSI)
+	return result
+}
+
+// clientDeploymentSource implements DeploymentSource by reading Deployments via a controller-runtime client
+type clientDeploymentSource struct {
+	reader client.Reader
+}
+
+// NewClientDeploymentSource creates a DeploymentSource which reads Deployments via the specified reader. Deployments
+// are read upon each request, and upon each collection by the ProviderMetricsCollector, so the reader is meant to be
+// backed by a cache.
+func NewClientDeploymentSource(reader client.Reader) DeploymentSource {
+	return &clientDeploymentSource{reader: reader}
+}
+
+func (s *clientDeploymentSource) GetDeployment(
+	ctx context.Context, namespace string, name string) (*appsv1.Deployment, error) {
+
+	deployment := &appsv1.Deployment{}
+	err := s.reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, deployment)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
+
+func (s *clientDeploymentSource) ListDeployments(
+	ctx context.Context, namespace string, selector labels.Selector) ([]appsv1.Deployment, error) {
+
+	deployments := &appsv1.DeploymentList{}
+	err := s.reader.List(ctx, deployments, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return deployments.Items, nil
+}
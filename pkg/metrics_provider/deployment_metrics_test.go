@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("MetricsProvider deployment metrics", func() {
+	const (
+		testNs             = "shoot--my-shoot"
+		testDeploymentName = "kube-apiserver"
+		testDeploymentUID  = "my-deployment-uid"
+	)
+	var (
+		deploymentMetricInfo = mxprov.CustomMetricInfo{
+			GroupResource: deploymentsGroupResource,
+			Namespaced:    true,
+			Metric:        metricName,
+		}
+		kapiLabels = map[string]string{"app": "kubernetes", "role": "apiserver"}
+
+		newDeployment = func(name string, uid string, objectLabels map[string]string) *appsv1.Deployment {
+			return &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: name, UID: types.UID(uid), Labels: objectLabels},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: kapiLabels},
+				},
+			}
+		}
+
+		// Creates a provider which serves deployment metrics for the specified deployments, and has data for two Kapi
+		// pods which match the deployments' selector, and one which does not
+		newTestProvider = func(
+			deployments ...*appsv1.Deployment) (*MetricsProvider, *fakes.FakeInputDataRegistry) {
+
+			idr := &fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			builder := fake.NewClientBuilder()
+			for _, deployment := range deployments {
+				builder.WithObjects(deployment)
+			}
+			provider.SetDeploymentSource(NewClientDeploymentSource(builder.Build()))
+
+			idr.SetKapiData(testNs, "kapi1", "", kapiLabels, "")
+			idr.SetKapiData(testNs, "kapi2", "", kapiLabels, "")
+			idr.SetKapiData(testNs, "other", "", map[string]string{"app": "other"}, "")
+			for pod, count := range map[string]int64{"kapi1": 60, "kapi2": 120, "other": 600} {
+				idr.SetKapiMetricsWithTime(testNs, pod, 0, gcmtesting.NewTime(1, 0, 0))
+				idr.SetKapiMetricsWithTime(testNs, pod, count, gcmtesting.NewTime(1, 1, 0))
+			}
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+			return provider, idr
+		}
+	)
+
+	Describe("ListAllMetrics", func() {
+		It("should list each metric for deployments, in addition to pods, if a deployment source is set", func() {
+			// Arrange
+			provider, _ := newTestProvider()
+
+			// Act
+			metrics := provider.ListAllMetrics()
+
+			// Assert
+			Expect(metrics).To(HaveLen(2 * len(defaultMetricNames)))
+			Expect(metrics[len(defaultMetricNames)].GroupResource).To(Equal(deploymentsGroupResource))
+			Expect(metrics[len(defaultMetricNames)].Metric).To(Equal(metricName))
+		})
+	})
+
+	Describe("GetMetricByName", func() {
+		It("should return the sum of the values of the Kapi pods which match the deployment's selector", func() {
+			// Arrange
+			provider, _ := newTestProvider(newDeployment(testDeploymentName, testDeploymentUID, nil))
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(),
+				types.NamespacedName{Namespace: testNs, Name: testDeploymentName},
+				deploymentMetricInfo,
+				nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Value.AsApproximateFloat64()).To(Equal(float64(3)))
+			Expect(*val.WindowSeconds).To(Equal(int64(60)))
+			Expect(val.Timestamp.Time).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+			Expect(val.DescribedObject.Kind).To(Equal("Deployment"))
+			Expect(val.DescribedObject.APIVersion).To(Equal("apps/v1"))
+			Expect(val.DescribedObject.Name).To(Equal(testDeploymentName))
+			Expect(val.DescribedObject.Namespace).To(Equal(testNs))
+			Expect(val.DescribedObject.UID).To(Equal(types.UID(testDeploymentUID)))
+		})
+
+		It("should return nothing if the deployment does not exist", func() {
+			// Arrange
+			provider, _ := newTestProvider()
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(),
+				types.NamespacedName{Namespace: testNs, Name: testDeploymentName},
+				deploymentMetricInfo,
+				nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).To(BeNil())
+		})
+
+		It("should aggregate the sample age metric as the age of the stalest pod's sample", func() {
+			// Arrange
+			provider, idr := newTestProvider(newDeployment(testDeploymentName, testDeploymentUID, nil))
+			idr.SetKapiMetricsWithTime(testNs, "kapi1", 90, gcmtesting.NewTime(1, 1, 5))
+			sampleAgeMetricInfo := deploymentMetricInfo
+			sampleAgeMetricInfo.Metric = sampleAgeMetricName
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(),
+				types.NamespacedName{Namespace: testNs, Name: testDeploymentName},
+				sampleAgeMetricInfo,
+				nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Value.AsApproximateFloat64()).To(Equal(float64(10)))
+		})
+	})
+
+	Describe("GetMetricBySelector", func() {
+		It("should return one value per deployment which matches the selector", func() {
+			// Arrange
+			provider, _ := newTestProvider(
+				newDeployment(testDeploymentName, testDeploymentUID, map[string]string{"role": "apiserver"}),
+				newDeployment("other", "", map[string]string{"role": "other"}))
+			selector, err := labels.Parse("role=apiserver")
+			Expect(err).To(Succeed())
+
+			// Act
+			list, err := provider.GetMetricBySelector(context.Background(), testNs, selector, deploymentMetricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(list.Items).To(HaveLen(1))
+			Expect(list.Items[0].DescribedObject.Name).To(Equal(testDeploymentName))
+			Expect(list.Items[0].Value.AsApproximateFloat64()).To(Equal(float64(3)))
+		})
+	})
+})
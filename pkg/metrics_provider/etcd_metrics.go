@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/etcd"
+)
+
+// etcdMetricNames maps the name under which each etcd metric is served, to the etcd counter it is based on. Each metric
+// is the per-second rate of the counter, calculated based on the two most recent samples for the etcd pod.
+var etcdMetricNames = map[string]string{
+	"shoot:etcd_server_proposals_committed:rate": etcd.ProposalsCommittedCounter,
+	"shoot:etcd_server_proposals_applied:rate":   etcd.ProposalsAppliedCounter,
+	"shoot:etcd_server_proposals_failed:rate":    etcd.ProposalsFailedCounter,
+}
+
+// SetEtcdSource enables serving the metrics of the shoot etcd pods provided by the specified source. The etcd metrics
+// are served for pods, separately from the kube-apiserver metrics, and are not subject to [MetricNaming.NameOverrides].
+// Must be called before the MetricsProvider starts serving requests.
+func (mp *MetricsProvider) SetEtcdSource(source etcd.DataSource) {
+	mp.etcdSource = source
+}
+
+// isEtcdRequest returns true if the request is for one of the etcd metrics
+func (mp *MetricsProvider) isEtcdRequest(metricInfo provider.CustomMetricInfo) bool {
+	if mp.etcdSource == nil || metricInfo.GroupResource.Resource != "pods" {
+		return false
+	}
+	_, ok := etcdMetricNames[metricInfo.Metric]
+	return ok
+}
+
+// listEtcdMetrics returns the etcd metrics served by the MetricsProvider. Empty, if etcd metrics are not enabled.
+func (mp *MetricsProvider) listEtcdMetrics() []provider.CustomMetricInfo {
+	if mp.etcdSource == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(etcdMetricNames))
+	for name := range etcdMetricNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]provider.CustomMetricInfo, 0, len(names))
+	for _, name := range names {
+		result = append(result, provider.CustomMetricInfo{
+			GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+			Metric:        name,
+			Namespaced:    true,
+		})
+	}
+	return result
+}
+
+// getEtcdMetrics returns the value of the requested etcd metric, for each etcd pod in the namespace for which the
+// predicate returns true. Pods which do not have samples suitable for rate calculation are omitted from the result.
+// Metric values which do not match the metricSelector are excluded from the result.
+func (mp *MetricsProvider) getEtcdMetrics(
+	namespace string,
+	predicate func(etcdData *etcd.EtcdData) bool,
+	metricInfo provider.CustomMetricInfo,
+	metricSelector labels.Selector) *custom_metrics.MetricValueList {
+
+	counter := etcdMetricNames[metricInfo.Metric]
+	now := mp.testIsolation.TimeNow()
+	staticLabelSelector := mp.naming.staticLabelSelector()
+	result := &custom_metrics.MetricValueList{}
+	for _, etcdData := range mp.etcdSource.GetShootEtcds(namespace) {
+		if !predicate(etcdData) {
+			continue
+		}
+
+		newSample, oldSample := etcdData.SampleNew, etcdData.SampleOld
+		freshness := CheckSampleFreshness(newSample.Time, oldSample.Time, now, mp.maxSampleAge, mp.maxSampleGap)
+		if freshness != SamplesUsable {
+			continue
+		}
+		newValue, isInNew := newSample.Counters[counter]
+		oldValue, isInOld := oldSample.Counters[counter]
+		if !isInNew || !isInOld {
+			continue
+		}
+
+		windowSeconds := int64(newSample.Time.Sub(oldSample.Time).Seconds())
+		if metricSelector != nil && !metricSelector.Matches(mp.naming.selectableLabels(&windowSeconds)) {
+			continue
+		}
+		rate := (newValue - oldValue) / newSample.Time.Sub(oldSample.Time).Seconds()
+
+		result.Items = append(result.Items, custom_metrics.MetricValue{
+			DescribedObject: custom_metrics.ObjectReference{
+				Kind:       "Pod",
+				Name:       etcdData.PodName,
+				Namespace:  etcdData.ShootNamespace,
+				APIVersion: "v1",
+				UID:        etcdData.PodUID,
+			},
+			Metric: custom_metrics.MetricIdentifier{
+				Name:     metricInfo.Metric,
+				Selector: staticLabelSelector,
+			},
+			Value:         *resource.NewMilliQuantity(int64(rate*1000), resource.DecimalSI),
+			Timestamp:     metav1.Time{Time: newSample.Time},
+			WindowSeconds: &windowSeconds,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/etcd"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+// fakeEtcdDataSource is a static etcd.DataSource
+type fakeEtcdDataSource map[string][]*etcd.EtcdData
+
+func (f fakeEtcdDataSource) GetShootEtcds(shootNamespace string) []*etcd.EtcdData {
+	return f[shootNamespace]
+}
+
+var _ = Describe("MetricsProvider etcd metrics", func() {
+	const (
+		testNs = "shoot--my-shoot"
+	)
+	var (
+		committedMetricInfo = mxprov.CustomMetricInfo{
+			GroupResource: schema.GroupResource{Resource: "pods"},
+			Namespaced:    true,
+			Metric:        "shoot:etcd_server_proposals_committed:rate",
+		}
+
+		newEtcdData = func(podName string, role string, oldValue float64, newValue float64) *etcd.EtcdData {
+			return &etcd.EtcdData{
+				ShootNamespace: testNs,
+				PodName:        podName,
+				PodUID:         types.UID(podName + "-uid"),
+				PodLabels:      map[string]string{etcd.EtcdPodLabelKey: etcd.EtcdPodLabelValue, "role": role},
+				SampleOld: etcd.EtcdSample{
+					Time:     gcmtesting.NewTime(1, 0, 0),
+					Counters: map[string]float64{etcd.ProposalsCommittedCounter: oldValue},
+				},
+				SampleNew: etcd.EtcdSample{
+					Time:     gcmtesting.NewTime(1, 1, 0),
+					Counters: map[string]float64{etcd.ProposalsCommittedCounter: newValue},
+				},
+			}
+		}
+
+		newTestProvider = func(etcds ...*etcd.EtcdData) *MetricsProvider {
+			idr := &fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			provider.SetEtcdSource(fakeEtcdDataSource{testNs: etcds})
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+			return provider
+		}
+	)
+
+	Describe("ListAllMetrics", func() {
+		It("should list the etcd metrics, in addition to the Kapi ones, if an etcd source is set", func() {
+			// Arrange
+			provider := newTestProvider()
+
+			// Act
+			metrics := provider.ListAllMetrics()
+
+			// Assert
+			Expect(metrics).To(HaveLen(len(defaultMetricNames) + len(etcdMetricNames)))
+			Expect(metrics).To(ContainElement(committedMetricInfo))
+		})
+		It("should not list the etcd metrics, if no etcd source is set", func() {
+			// Arrange
+			idr := &fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+
+			// Act
+			metrics := provider.ListAllMetrics()
+
+			// Assert
+			Expect(metrics).NotTo(ContainElement(committedMetricInfo))
+		})
+	})
+
+	Describe("GetMetricByName", func() {
+		It("should return the per-second rate of the counter for the named etcd pod", func() {
+			// Arrange
+			provider := newTestProvider(
+				newEtcdData("etcd-main-0", "main", 100, 400), newEtcdData("etcd-events-0", "events", 0, 60))
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(),
+				types.NamespacedName{Namespace: testNs, Name: "etcd-main-0"},
+				committedMetricInfo,
+				nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Value.AsApproximateFloat64()).To(Equal(float64(5)))
+			Expect(*val.WindowSeconds).To(Equal(int64(60)))
+			Expect(val.Timestamp.Time).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+			Expect(val.DescribedObject.Kind).To(Equal("Pod"))
+			Expect(val.DescribedObject.UID).To(Equal(types.UID("etcd-main-0-uid")))
+		})
+		It("should return nothing if the pod's samples are not suitable for rate calculation", func() {
+			// Arrange
+			etcdData := newEtcdData("etcd-main-0", "main", 100, 400)
+			etcdData.SampleOld = etcd.EtcdSample{}
+			provider := newTestProvider(etcdData)
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(),
+				types.NamespacedName{Namespace: testNs, Name: "etcd-main-0"},
+				committedMetricInfo,
+				nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).To(BeNil())
+		})
+	})
+
+	Describe("GetMetricBySelector", func() {
+		It("should return the metric for each etcd pod which matches the selector", func() {
+			// Arrange
+			provider := newTestProvider(
+				newEtcdData("etcd-main-0", "main", 100, 400), newEtcdData("etcd-events-0", "events", 0, 60))
+			selector := labels.SelectorFromSet(labels.Set{"role": "events"})
+
+			// Act
+			vals, err := provider.GetMetricBySelector(context.Background(), testNs, selector, committedMetricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(vals.Items).To(HaveLen(1))
+			Expect(vals.Items[0].DescribedObject.Name).To(Equal("etcd-events-0"))
+			Expect(vals.Items[0].Value.AsApproximateFloat64()).To(Equal(float64(1)))
+		})
+	})
+})
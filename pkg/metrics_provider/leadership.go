@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NotLeaderRetryAfterSeconds is the retry delay which a non-leader replica suggests to clients, via the Retry-After
+// header, when it rejects a metrics request. It is of the order of the time it takes a replica to become leader.
+const NotLeaderRetryAfterSeconds = 10
+
+// isLeader returns true if the replica is the leader, or if leadership is not tracked. See SetLeaderElected.
+func (mp *MetricsProvider) isLeader() bool {
+	return isElected(mp.leaderElected)
+}
+
+// isLeader returns true if the replica is the leader, or if leadership is not tracked. See SetLeaderElected.
+func (rmp *ResourceMetricsProvider) isLeader() bool {
+	return isElected(rmp.leaderElected)
+}
+
+// isElected returns true if the specified channel, which is closed once the replica becomes leader, is closed or nil
+func isElected(leaderElected <-chan struct{}) bool {
+	if leaderElected == nil {
+		return true
+	}
+	select {
+	case <-leaderElected:
+		return true
+	default:
+		return false
+	}
+}
+
+// newNotLeaderError returns the error with which a non-leader replica rejects metrics requests. The error is a
+// [apierrors.StatusError], which the API server turns into a 503 response with a Retry-After header. It must be
+// returned unwrapped, because the API server does not look into wrapped errors.
+func newNotLeaderError() *apierrors.StatusError {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status: metav1.StatusFailure,
+		Code:   http.StatusServiceUnavailable,
+		Reason: metav1.StatusReasonServiceUnavailable,
+		Message: "this replica is not the leader, and has no metrics data. The request should be sent to the leader " +
+			"via the service.",
+		Details: &metav1.StatusDetails{RetryAfterSeconds: NotLeaderRetryAfterSeconds},
+	}}
+}
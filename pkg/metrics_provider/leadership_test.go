@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("MetricsProvider leadership", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "my-pod"
+	)
+	var (
+		metricInfo = mxprov.CustomMetricInfo{
+			GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+			Namespaced:    true,
+			Metric:        metricName,
+		}
+		provider *MetricsProvider
+		elected  chan struct{}
+	)
+
+	BeforeEach(func() {
+		idr := &fakes.FakeInputDataRegistry{}
+		provider = NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+		provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+		idr.SetKapiData(testNs, testPodName, "", nil, "")
+		idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+		idr.SetKapiMetricsWithTime(testNs, testPodName, 20, gcmtesting.NewTime(1, 1, 0))
+		elected = make(chan struct{})
+		provider.SetLeaderElected(elected)
+	})
+
+	It("should reject requests with 503 and a retry delay, while the replica is not the leader", func() {
+		// Act
+		_, err := provider.GetMetricByName(
+			context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+		_, listErr := provider.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+
+		// Assert
+		for _, err := range []error{err, listErr} {
+			Expect(apierrors.IsServiceUnavailable(err)).To(BeTrue())
+			statusErr, ok := err.(*apierrors.StatusError) // The API server only recognizes unwrapped status errors
+			Expect(ok).To(BeTrue())
+			Expect(statusErr.ErrStatus.Code).To(Equal(int32(http.StatusServiceUnavailable)))
+			Expect(statusErr.ErrStatus.Details.RetryAfterSeconds).To(Equal(int32(NotLeaderRetryAfterSeconds)))
+		}
+	})
+
+	It("should serve requests, once the replica becomes leader", func() {
+		// Arrange
+		close(elected)
+
+		// Act
+		val, err := provider.GetMetricByName(
+			context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+		list, listErr := provider.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(val.DescribedObject.Name).To(Equal(testPodName))
+		Expect(listErr).To(Succeed())
+		Expect(list.Items).To(HaveLen(1))
+	})
+
+	It("should list the metrics, even if the replica is not the leader", func() {
+		// Act
+		metrics := provider.ListAllMetrics()
+
+		// Assert
+		Expect(metrics).NotTo(BeEmpty())
+	})
+})
@@ -0,0 +1,234 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+)
+
+const (
+	// DefaultMaxInflightRequests is the default value of the --max-inflight-requests option
+	DefaultMaxInflightRequests = 100
+	// DefaultMaxClientQPS is the default value of the --max-client-qps option
+	DefaultMaxClientQPS = 20
+	// DefaultMaxClientBurst is the default value of the --max-client-burst option
+	DefaultMaxClientBurst = 40
+
+	// ThrottledRetryAfterSeconds is the retry delay which the server suggests to clients, via the Retry-After header,
+	// when it rejects a request due to load shedding
+	ThrottledRetryAfterSeconds = 1
+
+	// The rate limiter of a client which has not made a request for this long is discarded
+	clientLimiterMaxIdleTime = 10 * time.Minute
+)
+
+// DefaultPriorityUsers is the default value of the --priority-users option. It contains the identities under which
+// the seed's kube-controller-manager runs the horizontal pod autoscaler, with and without service account credentials.
+var DefaultPriorityUsers = []string{
+	"system:serviceaccount:kube-system:horizontal-pod-autoscaler",
+	"system:kube-controller-manager",
+}
+
+var (
+	// Counts the custom metrics API requests rejected by load shedding. Not labelled by client identity, because the
+	// set of identities is not bounded. If request auditing is enabled, rejected requests are audited along with the
+	// identity of the client.
+	apiRequestsRejectedCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gardener_custom_metrics_api_requests_rejected_total",
+			Help: "Number of custom metrics API requests rejected by load shedding, by reason",
+		},
+		[]string{"reason"})
+	// Tracks the number of custom metrics API requests being served
+	apiRequestsInflight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gardener_custom_metrics_api_requests_inflight",
+		Help: "Number of custom metrics API requests currently being served",
+	})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(apiRequestsRejectedCount, apiRequestsInflight)
+}
+
+// LoadSheddingConfig specifies the limits which a loadShedder enforces. A zero limit means no limit.
+type LoadSheddingConfig struct {
+	// No more than this many requests are served concurrently
+	MaxInflightRequests int
+	// Each client may make this many requests per second, on average
+	MaxClientQPS float64
+	// Each client may exceed MaxClientQPS with a burst of up to this many requests
+	MaxClientBurst int
+	// Requests from these users are never rejected. They still count towards MaxInflightRequests, so they take
+	// precedence over other clients, when the server is busy.
+	PriorityUsers []string
+}
+
+// clientLimiterEntry is the rate limiter of a single client
+type clientLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// loadShedder is a [provider.CustomMetricsProvider] which passes requests through to another provider, unless the
+// server is overloaded, or the client exceeds its request rate. Rejected requests fail with a 429 (Too Many Requests)
+// response. Requests from priority users, i.e. the horizontal pod autoscaler, are never rejected, so a runaway client
+// can not starve the autoscaler.
+//
+// The client identity is determined the same way as for the requestAuditor.
+type loadShedder struct {
+	provider.CustomMetricsProvider
+	config        LoadSheddingConfig
+	priorityUsers map[string]bool
+
+	inflightCount int
+	// Maps <user name> -> <rate limiter of the user>
+	clientLimiters map[string]*clientLimiterEntry
+	// When did the last eviction of idle client limiters take place
+	lastEvictionTime time.Time
+	lock             sync.Mutex
+
+	testIsolation loadShedderTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// newLoadShedder creates a loadShedder which passes requests through to the specified provider
+func newLoadShedder(inner provider.CustomMetricsProvider, config LoadSheddingConfig) *loadShedder {
+	priorityUsers := make(map[string]bool, len(config.PriorityUsers))
+	for _, user := range config.PriorityUsers {
+		priorityUsers[user] = true
+	}
+
+	return &loadShedder{
+		CustomMetricsProvider: inner,
+		config:                config,
+		priorityUsers:         priorityUsers,
+		clientLimiters:        make(map[string]*clientLimiterEntry),
+		testIsolation:         loadShedderTestIsolation{TimeNow: time.Now},
+	}
+}
+
+// GetMetricByName implements [provider.CustomMetricsProvider.GetMetricByName].
+func (ls *loadShedder) GetMetricByName(
+	ctx context.Context,
+	name types.NamespacedName,
+	metricInfo provider.CustomMetricInfo,
+	metricSelector labels.Selector) (*custom_metrics.MetricValue, error) {
+
+	if err := ls.admit(ctx); err != nil {
+		return nil, err
+	}
+	defer ls.release()
+
+	return ls.CustomMetricsProvider.GetMetricByName(ctx, name, metricInfo, metricSelector)
+}
+
+// GetMetricBySelector implements [provider.CustomMetricsProvider.GetMetricBySelector].
+func (ls *loadShedder) GetMetricBySelector(
+	ctx context.Context,
+	namespace string,
+	podSelector labels.Selector,
+	metricInfo provider.CustomMetricInfo,
+	metricSelector labels.Selector) (*custom_metrics.MetricValueList, error) {
+
+	if err := ls.admit(ctx); err != nil {
+		return nil, err
+	}
+	defer ls.release()
+
+	return ls.CustomMetricsProvider.GetMetricBySelector(ctx, namespace, podSelector, metricInfo, metricSelector)
+}
+
+// admit decides whether the request with the specified context is to be served. If so, the request is counted as
+// inflight, and the caller must call release once it is served. Otherwise, the returned error is the one to respond
+// with. It is a [apierrors.StatusError], and must be returned unwrapped, because the API server does not look into
+// wrapped errors.
+func (ls *loadShedder) admit(ctx context.Context) *apierrors.StatusError {
+	userName := anonymousUser
+	if user, ok := genericapirequest.UserFrom(ctx); ok && user.GetName() != "" {
+		userName = user.GetName()
+	}
+	now := ls.testIsolation.TimeNow()
+
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	if !ls.priorityUsers[userName] {
+		if ls.config.MaxInflightRequests > 0 && ls.inflightCount >= ls.config.MaxInflightRequests {
+			apiRequestsRejectedCount.WithLabelValues("inflight").Inc()
+			return apierrors.NewTooManyRequests(
+				fmt.Sprintf("the server is serving the maximum of %d concurrent requests", ls.config.MaxInflightRequests),
+				ThrottledRetryAfterSeconds)
+		}
+		if ls.config.MaxClientQPS > 0 && !ls.clientLimiterThreadUnsafe(userName, now).AllowN(now, 1) {
+			apiRequestsRejectedCount.WithLabelValues("rate").Inc()
+			return apierrors.NewTooManyRequests(
+				fmt.Sprintf("the client exceeds the limit of %g requests per second", ls.config.MaxClientQPS),
+				ThrottledRetryAfterSeconds)
+		}
+	}
+
+	ls.inflightCount++
+	apiRequestsInflight.Inc()
+	return nil
+}
+
+// release marks the end of a request which was admitted by admit
+func (ls *loadShedder) release() {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	ls.inflightCount--
+	apiRequestsInflight.Dec()
+}
+
+// clientLimiterThreadUnsafe returns the rate limiter of the specified user, creating one if necessary. Limiters which
+// have not been used for clientLimiterMaxIdleTime are discarded, no more than once per clientLimiterMaxIdleTime.
+//
+// The caller must acquire the lock before calling this method.
+func (ls *loadShedder) clientLimiterThreadUnsafe(userName string, now time.Time) *rate.Limiter {
+	if now.Sub(ls.lastEvictionTime) >= clientLimiterMaxIdleTime {
+		ls.lastEvictionTime = now
+		for name, entry := range ls.clientLimiters {
+			if now.Sub(entry.lastUsed) > clientLimiterMaxIdleTime {
+				delete(ls.clientLimiters, name)
+			}
+		}
+	}
+
+	entry := ls.clientLimiters[userName]
+	if entry == nil {
+		burst := ls.config.MaxClientBurst
+		if burst < 1 {
+			burst = 1
+		}
+		entry = &clientLimiterEntry{limiter: rate.NewLimiter(rate.Limit(ls.config.MaxClientQPS), burst)}
+		ls.clientLimiters[userName] = entry
+	}
+	entry.lastUsed = now
+	return entry.limiter
+}
+
+//#region Test isolation
+
+// loadShedderTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the loadShedder unit during tests
+type loadShedderTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+}
+
+//#endregion Test isolation
@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+// blockingMetricsProvider is a [mxprov.CustomMetricsProvider] which serves requests only once unblocked
+type blockingMetricsProvider struct {
+	mxprov.CustomMetricsProvider
+	started   chan struct{}
+	unblocked chan struct{}
+}
+
+func (p *blockingMetricsProvider) GetMetricByName(
+	context.Context, types.NamespacedName, mxprov.CustomMetricInfo, labels.Selector) (*custom_metrics.MetricValue, error) {
+
+	p.started <- struct{}{}
+	<-p.unblocked
+	return &custom_metrics.MetricValue{}, nil
+}
+
+func (p *blockingMetricsProvider) GetMetricBySelector(
+	context.Context,
+	string,
+	labels.Selector,
+	mxprov.CustomMetricInfo,
+	labels.Selector) (*custom_metrics.MetricValueList, error) {
+
+	return &custom_metrics.MetricValueList{}, nil
+}
+
+var _ = Describe("loadShedder", func() {
+	const (
+		testNs       = "shoot--my-shoot"
+		testPodName  = "my-pod"
+		testUser     = "my-user"
+		priorityUser = "system:serviceaccount:kube-system:horizontal-pod-autoscaler"
+	)
+	var (
+		metricInfo = mxprov.CustomMetricInfo{
+			GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+			Namespaced:    true,
+			Metric:        metricName,
+		}
+
+		// newTestShedder returns a load shedder around a provider which blocks each GetMetricByName request until
+		// unblocked, and serves GetMetricBySelector requests immediately
+		newTestShedder = func(config LoadSheddingConfig) (*loadShedder, *blockingMetricsProvider) {
+			inner := &blockingMetricsProvider{started: make(chan struct{}, 10), unblocked: make(chan struct{})}
+			shedder := newLoadShedder(inner, config)
+			shedder.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			return shedder, inner
+		}
+		userCtx = func(name string) context.Context {
+			return genericapirequest.WithUser(context.Background(), &user.DefaultInfo{Name: name})
+		}
+		getBySelector = func(shedder *loadShedder, ctx context.Context) error {
+			_, err := shedder.GetMetricBySelector(ctx, testNs, labels.Everything(), metricInfo, nil)
+			return err
+		}
+		// Starts a GetMetricByName request, and waits until it reaches the inner provider
+		startBlockedRequest = func(shedder *loadShedder, inner *blockingMetricsProvider, ctx context.Context) {
+			go func() {
+				_, _ = shedder.GetMetricByName(ctx, types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+			}()
+			Eventually(inner.started).Should(Receive())
+		}
+		expectTooManyRequests = func(err error) {
+			Expect(err).To(HaveOccurred())
+			statusErr, ok := err.(*apierrors.StatusError)
+			Expect(ok).To(BeTrue())
+			Expect(statusErr.ErrStatus.Code).To(Equal(int32(http.StatusTooManyRequests)))
+			Expect(statusErr.ErrStatus.Details.RetryAfterSeconds).To(Equal(int32(ThrottledRetryAfterSeconds)))
+		}
+	)
+
+	It("should pass requests through to the inner provider, if the limits are not exceeded", func() {
+		// Arrange
+		shedder, _ := newTestShedder(LoadSheddingConfig{MaxInflightRequests: 1, MaxClientQPS: 1, MaxClientBurst: 1})
+
+		// Act
+		err := getBySelector(shedder, userCtx(testUser))
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(shedder.inflightCount).To(Equal(0))
+	})
+
+	It("should reject requests beyond the inflight limit, with 429, and count them", func() {
+		// Arrange
+		shedder, inner := newTestShedder(LoadSheddingConfig{MaxInflightRequests: 1})
+		defer close(inner.unblocked)
+		startBlockedRequest(shedder, inner, userCtx(testUser))
+		rejectedCounter := apiRequestsRejectedCount.WithLabelValues("inflight")
+		countBefore := promtestutil.ToFloat64(rejectedCounter)
+
+		// Act
+		err := getBySelector(shedder, userCtx(testUser))
+
+		// Assert
+		expectTooManyRequests(err)
+		Expect(promtestutil.ToFloat64(rejectedCounter) - countBefore).To(Equal(float64(1)))
+	})
+
+	It("should admit requests from priority users beyond the inflight limit", func() {
+		// Arrange
+		shedder, inner := newTestShedder(
+			LoadSheddingConfig{MaxInflightRequests: 1, PriorityUsers: []string{priorityUser}})
+		defer close(inner.unblocked)
+		startBlockedRequest(shedder, inner, userCtx(testUser))
+
+		// Act
+		err := getBySelector(shedder, userCtx(priorityUser))
+
+		// Assert
+		Expect(err).To(Succeed())
+	})
+
+	It("should count requests from priority users towards the inflight limit", func() {
+		// Arrange
+		shedder, inner := newTestShedder(
+			LoadSheddingConfig{MaxInflightRequests: 1, PriorityUsers: []string{priorityUser}})
+		defer close(inner.unblocked)
+		startBlockedRequest(shedder, inner, userCtx(priorityUser))
+
+		// Act
+		err := getBySelector(shedder, userCtx(testUser))
+
+		// Assert
+		expectTooManyRequests(err)
+	})
+
+	It("should reject requests beyond the client's rate limit, with 429, and count them", func() {
+		// Arrange
+		shedder, _ := newTestShedder(LoadSheddingConfig{MaxClientQPS: 1, MaxClientBurst: 2})
+		Expect(getBySelector(shedder, userCtx(testUser))).To(Succeed())
+		Expect(getBySelector(shedder, userCtx(testUser))).To(Succeed())
+		rejectedCounter := apiRequestsRejectedCount.WithLabelValues("rate")
+		countBefore := promtestutil.ToFloat64(rejectedCounter)
+
+		// Act
+		err := getBySelector(shedder, userCtx(testUser))
+
+		// Assert
+		expectTooManyRequests(err)
+		Expect(promtestutil.ToFloat64(rejectedCounter) - countBefore).To(Equal(float64(1)))
+	})
+
+	It("should limit the rate of each client separately, and exempt priority users", func() {
+		// Arrange
+		shedder, _ := newTestShedder(
+			LoadSheddingConfig{MaxClientQPS: 1, MaxClientBurst: 1, PriorityUsers: []string{priorityUser}})
+		Expect(getBySelector(shedder, userCtx(testUser))).To(Succeed())
+
+		// Act
+		otherUserErr := getBySelector(shedder, userCtx("other-user"))
+		anonymousErr := getBySelector(shedder, context.Background())
+		var priorityErrs []error
+		for i := 0; i < 5; i++ {
+			priorityErrs = append(priorityErrs, getBySelector(shedder, userCtx(priorityUser)))
+		}
+
+		// Assert
+		Expect(otherUserErr).To(Succeed())
+		Expect(anonymousErr).To(Succeed())
+		Expect(priorityErrs).To(HaveEach(BeNil()))
+	})
+
+	It("should admit further requests from a client, once its rate limit allows", func() {
+		// Arrange
+		shedder, _ := newTestShedder(LoadSheddingConfig{MaxClientQPS: 1, MaxClientBurst: 1})
+		Expect(getBySelector(shedder, userCtx(testUser))).To(Succeed())
+		expectTooManyRequests(getBySelector(shedder, userCtx(testUser)))
+
+		// Act
+		shedder.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 1)
+		err := getBySelector(shedder, userCtx(testUser))
+
+		// Assert
+		Expect(err).To(Succeed())
+	})
+
+	It("should discard the rate limiters of clients which have been idle for long", func() {
+		// Arrange
+		shedder, _ := newTestShedder(LoadSheddingConfig{MaxClientQPS: 1, MaxClientBurst: 1})
+		Expect(getBySelector(shedder, userCtx(testUser))).To(Succeed())
+		shedder.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 20, 0)
+
+		// Act
+		err := getBySelector(shedder, userCtx("other-user"))
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(shedder.clientLimiters).To(HaveLen(1))
+		Expect(shedder.clientLimiters).To(HaveKey("other-user"))
+	})
+})
@@ -0,0 +1,404 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// MetricComputer calculates a metric, derived from the samples which the registry holds for a Kapi. A new metric is
+// served by implementing this interface, and adding the implementation to the MetricsProvider via AddMetricComputer.
+//
+// Implementations must be concurrency-safe.
+type MetricComputer interface {
+	// Name returns the default name of the metric. Unless renamed via [MetricNaming.NameOverrides], this is also the
+	// name under which the metric is served.
+	Name() string
+	// Compute calculates the value of the metric for the specified Kapi. The Kapi carries the two most recent samples
+	// on record. Returns ok=false if the Kapi does not have data suitable for calculating the metric.
+	Compute(kapi input_data_registry.ShootKapi, computeContext *ComputeContext) (result ComputedValue, ok bool)
+}
+
+// ComputeContext holds the settings and the point in time, which apply to a single MetricComputer.Compute call
+type ComputeContext struct {
+	// The point in time as of which the metric is calculated
+	Now time.Time
+	// The last sample for a pod is valid for this long
+	MaxSampleAge time.Duration
+	// If two consecutive samples are further apart than this, the pair is not suitable for rate calculation
+	MaxSampleGap time.Duration
+	// Rates are served as the number of events per this period. Zero means one second.
+	RateWindow time.Duration
+	// If true, a rate may be estimated from a single sample, where two are normally needed. See
+	// MetricsProvider.SetSingleSampleEstimation.
+	EstimateFromSingleSample bool
+}
+
+// ComputedValue is the outcome of a MetricComputer.Compute call
+type ComputedValue struct {
+	Value resource.Quantity
+	// The point in time to which the value refers
+	Timestamp time.Time
+	// The length of the window over which the value was calculated. Nil for instantaneous values.
+	WindowSeconds *int64
+}
+
+// newBuiltinMetricComputers returns the computers of the metrics which are served by default, in the order of
+// defaultMetricNames
+func newBuiltinMetricComputers() []MetricComputer {
+	return []MetricComputer{
+		&requestRateComputer{},
+		&sampleAgeComputer{},
+		&inflightRequestsComputer{},
+		&requestLatencyComputer{},
+		&errorRatioComputer{},
+		&burstRateComputer{},
+		&windowedRequestRateComputer{name: shortRateMetricName, window: DefaultShortRateWindow},
+		&windowedRequestRateComputer{name: longRateMetricName, window: DefaultLongRateWindow},
+	}
+}
+
+// requestRateComputer implements MetricComputer for the request rate metric. The rate is calculated based on the two
+// most recent samples for the Kapi.
+//
+// By default, the rate is per second, and the reported window is the time between the two samples. With a rate window
+// longer than one second, the rate is scaled to the number of requests per window - the same value Prometheus'
+// increase() function yields over a range of that length - and the reported window is the rate window.
+//
+// If estimation from a single sample is enabled, and the Kapi has only one sample, the rate is estimated as the average
+// since the Kapi process started: the request count, divided by the process uptime. The reported window is then the
+// uptime, which is normally much longer than the gap between two samples, so consumers can tell the estimate apart.
+type requestRateComputer struct{}
+
+func (c *requestRateComputer) Name() string {
+	return metricName
+}
+
+func (c *requestRateComputer) Compute(
+	kapi input_data_registry.ShootKapi, computeContext *ComputeContext) (result ComputedValue, ok bool) {
+
+	freshness := CheckSampleFreshness(
+		kapi.MetricsTimeNew(),
+		kapi.MetricsTimeOld(),
+		computeContext.Now,
+		computeContext.MaxSampleAge,
+		computeContext.MaxSampleGap)
+	if freshness == SingleSample && computeContext.EstimateFromSingleSample {
+		return c.estimate(kapi, computeContext)
+	}
+	if freshness != SamplesUsable {
+		return ComputedValue{}, false
+	}
+
+	gap := kapi.MetricsTimeNew().Sub(kapi.MetricsTimeOld())
+	requestRate := float64(kapi.TotalRequestCountNew()-kapi.TotalRequestCountOld()) / gap.Seconds()
+	windowSeconds := ptr.To(int64(math.Round(gap.Seconds())))
+	if computeContext.RateWindow > time.Second {
+		requestRate *= computeContext.RateWindow.Seconds()
+		windowSeconds = ptr.To(int64(computeContext.RateWindow.Seconds()))
+	}
+	return ComputedValue{
+		Value:         *resource.NewMilliQuantity(int64(requestRate*1000), resource.DecimalSI),
+		Timestamp:     kapi.MetricsTimeNew(),
+		WindowSeconds: windowSeconds,
+	}, true
+}
+
+// estimate calculates the average request rate since the Kapi process started, based on the Kapi's only sample.
+// Returns ok=false if the process start time is unknown, or less than a second before the sample.
+func (c *requestRateComputer) estimate(
+	kapi input_data_registry.ShootKapi, computeContext *ComputeContext) (result ComputedValue, ok bool) {
+
+	startTime := kapi.ProcessStartTime()
+	if startTime.IsZero() {
+		return ComputedValue{}, false
+	}
+	uptime := kapi.MetricsTimeNew().Sub(startTime)
+	if uptime < time.Second {
+		return ComputedValue{}, false
+	}
+
+	requestRate := float64(kapi.TotalRequestCountNew()) / uptime.Seconds()
+	windowSeconds := int64(math.Round(uptime.Seconds()))
+	if computeContext.RateWindow > time.Second {
+		requestRate *= computeContext.RateWindow.Seconds()
+		windowSeconds = max(windowSeconds, int64(computeContext.RateWindow.Seconds()))
+	}
+	return ComputedValue{
+		Value:         *resource.NewMilliQuantity(int64(requestRate*1000), resource.DecimalSI),
+		Timestamp:     kapi.MetricsTimeNew(),
+		WindowSeconds: ptr.To(windowSeconds),
+	}, true
+}
+
+// sampleAgeComputer implements MetricComputer for the sample age metric. The age is reported for any Kapi which has at
+// least one sample on record, even if that sample is too old to be used for request rate calculation - reporting the
+// staleness of such samples is the very purpose of the metric.
+type sampleAgeComputer struct{}
+
+func (c *sampleAgeComputer) Name() string {
+	return sampleAgeMetricName
+}
+
+func (c *sampleAgeComputer) Compute(
+	kapi input_data_registry.ShootKapi, computeContext *ComputeContext) (result ComputedValue, ok bool) {
+
+	if kapi.MetricsTimeNew().IsZero() {
+		// No sample recorded yet
+		return ComputedValue{}, false
+	}
+
+	age := computeContext.Now.Sub(kapi.MetricsTimeNew())
+	if age < 0 {
+		age = 0
+	}
+	return ComputedValue{
+		Value:     *resource.NewMilliQuantity(age.Milliseconds(), resource.DecimalSI),
+		Timestamp: kapi.MetricsTimeNew(),
+	}, true
+}
+
+// inflightRequestsComputer implements MetricComputer for the inflight requests metric. The metric is an instantaneous
+// value, so it is based on the most recent sample alone, as long as that sample is not too old.
+type inflightRequestsComputer struct{}
+
+func (c *inflightRequestsComputer) Name() string {
+	return inflightRequestsMetricName
+}
+
+func (c *inflightRequestsComputer) Compute(
+	kapi input_data_registry.ShootKapi, computeContext *ComputeContext) (result ComputedValue, ok bool) {
+
+	if kapi.InflightRequestTime().IsZero() {
+		// No sample recorded yet
+		return ComputedValue{}, false
+	}
+	if kapi.InflightRequestTime().Before(computeContext.Now.Add(-computeContext.MaxSampleAge)) {
+		// Sample too old
+		return ComputedValue{}, false
+	}
+
+	return ComputedValue{
+		Value:     *resource.NewQuantity(kapi.InflightRequestCount(), resource.DecimalSI),
+		Timestamp: kapi.InflightRequestTime(),
+	}, true
+}
+
+// requestLatencyComputer implements MetricComputer for the average request latency metric. The average is calculated
+// over the requests served between the two most recent request duration samples for the Kapi, so it reflects recent
+// load, e.g. expensive LIST requests, rather than the whole lifetime of the pod. The reported window is the time
+// between the two samples.
+type requestLatencyComputer struct{}
+
+func (c *requestLatencyComputer) Name() string {
+	return requestLatencyMetricName
+}
+
+func (c *requestLatencyComputer) Compute(
+	kapi input_data_registry.ShootKapi, computeContext *ComputeContext) (result ComputedValue, ok bool) {
+
+	freshness := CheckSampleFreshness(
+		kapi.RequestDurationTimeNew(),
+		kapi.RequestDurationTimeOld(),
+		computeContext.Now,
+		computeContext.MaxSampleAge,
+		computeContext.MaxSampleGap)
+	if freshness != SamplesUsable {
+		return ComputedValue{}, false
+	}
+	requestCount := kapi.RequestDurationCountNew() - kapi.RequestDurationCountOld()
+	if requestCount <= 0 {
+		// No requests served between the samples. The average is undefined.
+		return ComputedValue{}, false
+	}
+
+	latency := (kapi.RequestDurationSecondsNew() - kapi.RequestDurationSecondsOld()) / float64(requestCount)
+	gap := kapi.RequestDurationTimeNew().Sub(kapi.RequestDurationTimeOld())
+	return ComputedValue{
+		Value:         *resource.NewMilliQuantity(int64(math.Round(latency*1000)), resource.DecimalSI),
+		Timestamp:     kapi.RequestDurationTimeNew(),
+		WindowSeconds: ptr.To(int64(math.Round(gap.Seconds()))),
+	}, true
+}
+
+// errorRatioComputer implements MetricComputer for the error ratio metric. The ratio is calculated over the requests
+// served between the two most recent request count samples for the Kapi, so it reflects the recent failure rate,
+// rather than the whole lifetime of the pod. Client (4xx) and server (5xx) errors are counted alike. The reported
+// window is the time between the two samples.
+type errorRatioComputer struct{}
+
+func (c *errorRatioComputer) Name() string {
+	return errorRatioMetricName
+}
+
+func (c *errorRatioComputer) Compute(
+	kapi input_data_registry.ShootKapi, computeContext *ComputeContext) (result ComputedValue, ok bool) {
+
+	freshness := CheckSampleFreshness(
+		kapi.MetricsTimeNew(),
+		kapi.MetricsTimeOld(),
+		computeContext.Now,
+		computeContext.MaxSampleAge,
+		computeContext.MaxSampleGap)
+	if freshness != SamplesUsable {
+		return ComputedValue{}, false
+	}
+	requestCount := kapi.TotalRequestCountNew() - kapi.TotalRequestCountOld()
+	if requestCount <= 0 {
+		// No requests served between the samples. The ratio is undefined.
+		return ComputedValue{}, false
+	}
+	errorCount := kapi.ClientErrorCountNew() + kapi.ServerErrorCountNew() -
+		kapi.ClientErrorCountOld() - kapi.ServerErrorCountOld()
+	if errorCount < 0 || errorCount > requestCount {
+		// The samples are inconsistent, e.g. some counter series were reset in between
+		return ComputedValue{}, false
+	}
+
+	ratio := float64(errorCount) / float64(requestCount)
+	gap := kapi.MetricsTimeNew().Sub(kapi.MetricsTimeOld())
+	return ComputedValue{
+		Value:         *resource.NewMilliQuantity(int64(math.Round(ratio*1000)), resource.DecimalSI),
+		Timestamp:     kapi.MetricsTimeNew(),
+		WindowSeconds: ptr.To(int64(math.Round(gap.Seconds()))),
+	}, true
+}
+
+// burstRatePercentile is the percentile of the per-interval request rates, which the burst rate metric reports
+const burstRatePercentile = 0.95
+
+// burstRateComputer implements MetricComputer for the burst rate metric. The metric is a high percentile of the request
+// rates over the intervals between consecutive samples in the Kapi's request count history. A burst which fits between
+// two scrapes lifts the rate of a single interval, so it shows in the burst rate, even after the two most recent
+// samples have moved past it.
+//
+// Only the unbroken run of intervals which ends with the most recent sample, and in which no interval exceeds the max
+// sample gap, is considered. The reported window spans that run. Rate window scaling applies as for the request rate.
+type burstRateComputer struct{}
+
+func (c *burstRateComputer) Name() string {
+	return burstRateMetricName
+}
+
+func (c *burstRateComputer) Compute(
+	kapi input_data_registry.ShootKapi, computeContext *ComputeContext) (result ComputedValue, ok bool) {
+
+	history := kapi.RequestCountHistory()
+	if len(history) < 2 {
+		return ComputedValue{}, false
+	}
+	newest := history[len(history)-1]
+	freshness := CheckSampleFreshness(
+		newest.Time,
+		history[len(history)-2].Time,
+		computeContext.Now,
+		computeContext.MaxSampleAge,
+		computeContext.MaxSampleGap)
+	if freshness != SamplesUsable {
+		return ComputedValue{}, false
+	}
+
+	rates := make([]float64, 0, len(history)-1)
+	windowStart := newest.Time
+	for i := len(history) - 1; i > 0; i-- {
+		newer, older := history[i], history[i-1]
+		gap := newer.Time.Sub(older.Time)
+		if gap <= 0 || gap > computeContext.MaxSampleGap || newer.TotalRequestCount < older.TotalRequestCount {
+			break
+		}
+		rates = append(rates, float64(newer.TotalRequestCount-older.TotalRequestCount)/gap.Seconds())
+		windowStart = older.Time
+	}
+	if len(rates) == 0 { // The most recent interval is broken, e.g. by a counter reset
+		return ComputedValue{}, false
+	}
+
+	// Nearest-rank percentile
+	slices.Sort(rates)
+	burstRate := rates[int(math.Ceil(burstRatePercentile*float64(len(rates))))-1]
+	windowSeconds := ptr.To(int64(math.Round(newest.Time.Sub(windowStart).Seconds())))
+	if computeContext.RateWindow > time.Second {
+		burstRate *= computeContext.RateWindow.Seconds()
+		windowSeconds = ptr.To(int64(computeContext.RateWindow.Seconds()))
+	}
+	return ComputedValue{
+		Value:         *resource.NewMilliQuantity(int64(burstRate*1000), resource.DecimalSI),
+		Timestamp:     newest.Time,
+		WindowSeconds: windowSeconds,
+	}, true
+}
+
+// windowedRequestRateComputer implements MetricComputer for the request rate over a trailing window of fixed length.
+// Two instances serve the short and the long rate metrics side by side, so each consumer can choose between
+// responsiveness and stability via the metric name.
+//
+// The rate is calculated from the most recent sample in the Kapi's request count history, and the newest earlier sample
+// which is at least the window length older. If the history does not reach that far back, or is broken by a gap which
+// exceeds the max sample gap, or by a counter reset, the oldest sample of the unbroken run ending with the most recent
+// sample is used instead. So, with a scrape period longer than the window, the rate is the same as the request rate
+// metric. The reported window is the time between the two samples. Rate window scaling applies as for the request
+// rate.
+type windowedRequestRateComputer struct {
+	name string
+	// The length of the trailing window
+	window time.Duration
+}
+
+func (c *windowedRequestRateComputer) Name() string {
+	return c.name
+}
+
+func (c *windowedRequestRateComputer) Compute(
+	kapi input_data_registry.ShootKapi, computeContext *ComputeContext) (result ComputedValue, ok bool) {
+
+	history := kapi.RequestCountHistory()
+	if len(history) < 2 {
+		return ComputedValue{}, false
+	}
+	newest := history[len(history)-1]
+	freshness := CheckSampleFreshness(
+		newest.Time,
+		history[len(history)-2].Time,
+		computeContext.Now,
+		computeContext.MaxSampleAge,
+		computeContext.MaxSampleGap)
+	if freshness != SamplesUsable {
+		return ComputedValue{}, false
+	}
+
+	oldest := newest
+	for i := len(history) - 1; i > 0 && newest.Time.Sub(oldest.Time) < c.window; i-- {
+		newer, older := history[i], history[i-1]
+		gap := newer.Time.Sub(older.Time)
+		if gap <= 0 || gap > computeContext.MaxSampleGap || newer.TotalRequestCount < older.TotalRequestCount {
+			break
+		}
+		oldest = older
+	}
+	if oldest == newest {
+		// The two most recent samples do not form a usable pair, e.g. because of a counter reset
+		return ComputedValue{}, false
+	}
+
+	span := newest.Time.Sub(oldest.Time)
+	requestRate := float64(newest.TotalRequestCount-oldest.TotalRequestCount) / span.Seconds()
+	windowSeconds := ptr.To(int64(math.Round(span.Seconds())))
+	if computeContext.RateWindow > time.Second {
+		requestRate *= computeContext.RateWindow.Seconds()
+		windowSeconds = ptr.To(int64(computeContext.RateWindow.Seconds()))
+	}
+	return ComputedValue{
+		Value:         *resource.NewMilliQuantity(int64(requestRate*1000), resource.DecimalSI),
+		Timestamp:     newest.Time,
+		WindowSeconds: windowSeconds,
+	}, true
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+// fakeMetricComputer implements MetricComputer by reporting the request count of the most recent sample
+type fakeMetricComputer struct {
+	name        string
+	lastContext *ComputeContext
+}
+
+func (c *fakeMetricComputer) Name() string {
+	return c.name
+}
+
+func (c *fakeMetricComputer) Compute(
+	kapi input_data_registry.ShootKapi, computeContext *ComputeContext) (result ComputedValue, ok bool) {
+
+	c.lastContext = computeContext
+	if kapi.MetricsTimeNew().IsZero() {
+		return ComputedValue{}, false
+	}
+	return ComputedValue{
+		Value:     *resource.NewQuantity(kapi.TotalRequestCountNew(), resource.DecimalSI),
+		Timestamp: kapi.MetricsTimeNew(),
+	}, true
+}
+
+var _ = Describe("MetricComputer", func() {
+	const (
+		testNs         = "shoot--my-shoot"
+		testPodName    = "my-pod"
+		testMetricName = "shoot:apiserver_request_total:last"
+	)
+
+	Describe("newBuiltinMetricComputers", func() {
+		It("should return a computer for each of the default metrics, in the same order", func() {
+			// Act
+			computers := newBuiltinMetricComputers()
+
+			// Assert
+			names := make([]string, 0, len(computers))
+			for _, computer := range computers {
+				names = append(names, computer.Name())
+			}
+			Expect(names).To(Equal(defaultMetricNames))
+		})
+	})
+
+	Describe("AddMetricComputer", func() {
+		It("should list and serve the metric calculated by the added computer", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			provider.SetRateWindow(time.Minute)
+			idr.SetKapiData(testNs, testPodName, "", nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 42, gcmtesting.NewTime(1, 0, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 10)
+			computer := &fakeMetricComputer{name: testMetricName}
+			metricInfo := mxprov.CustomMetricInfo{
+				GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+				Namespaced:    true,
+				Metric:        testMetricName,
+			}
+
+			// Act
+			err := provider.AddMetricComputer(computer)
+			metrics := provider.ListAllMetrics()
+			val, getErr := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(metrics).To(HaveLen(len(defaultMetricNames) + 1))
+			Expect(metrics[len(metrics)-1].Metric).To(Equal(testMetricName))
+			Expect(getErr).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Value.Value()).To(Equal(int64(42)))
+			Expect(val.WindowSeconds).To(BeNil())
+			Expect(*computer.lastContext).To(Equal(ComputeContext{
+				Now:          gcmtesting.NewTime(1, 0, 10),
+				MaxSampleAge: 90 * time.Second,
+				MaxSampleGap: 10 * time.Minute,
+				RateWindow:   time.Minute,
+			}))
+		})
+
+		It("should reject computers whose metric would be served under the name of an existing metric", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			naming := MetricNaming{NameOverrides: map[string]string{metricName: testMetricName}}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, naming)
+
+			// Act
+			errDefault := provider.AddMetricComputer(&fakeMetricComputer{name: sampleAgeMetricName})
+			errOverridden := provider.AddMetricComputer(&fakeMetricComputer{name: testMetricName})
+			errEmpty := provider.AddMetricComputer(&fakeMetricComputer{})
+
+			// Assert
+			Expect(errDefault).To(HaveOccurred())
+			Expect(errOverridden).To(HaveOccurred())
+			Expect(errEmpty).To(HaveOccurred())
+			Expect(provider.ListAllMetrics()).To(HaveLen(len(defaultMetricNames)))
+		})
+	})
+})
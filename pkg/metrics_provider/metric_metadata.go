@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// MetadataPath is the path, on the controller manager's metrics server, at which the metadata of the served metrics is
+// exposed in JSON format. See MetricMetadata.
+const MetadataPath = "/metrics-metadata"
+
+// Values of MetricDescription.Window
+const (
+	// WindowInstantaneous means that the metric value refers to a single point in time, and has no window
+	WindowInstantaneous = "instantaneous"
+	// WindowSamplePair means that the metric value is calculated over the period between the two most recent samples.
+	// For rates served per a rate window longer than one second, the reported window is the rate window instead.
+	WindowSamplePair = "sample-pair"
+	// WindowSampleHistory means that the metric value is calculated over the samples which the registry retains for
+	// the pod, as far back as they form an unbroken run. For rates served per a rate window longer than one second, the
+	// reported window is the rate window instead.
+	WindowSampleHistory = "sample-history"
+	// WindowTrailing means that the metric value is calculated over a trailing window of configured length, ending
+	// with the most recent sample, as far as the retained samples reach. For rates served per a rate window longer
+	// than one second, the reported window is the rate window instead.
+	WindowTrailing = "trailing"
+)
+
+// MetricDescription explains the meaning of a metric to its consumers
+type MetricDescription struct {
+	// What the metric value means
+	Description string `json:"description"`
+	// The unit in which the metric value is expressed, e.g. "seconds", or "requests/s"
+	Unit string `json:"unit"`
+	// The period over which the metric value is calculated. One of WindowInstantaneous, WindowSamplePair,
+	// WindowSampleHistory, WindowTrailing.
+	Window string `json:"window"`
+}
+
+// DescribedMetricComputer is a MetricComputer which also describes its metric. The metadata of metrics whose computer
+// does not implement this interface carries the metric name alone.
+type DescribedMetricComputer interface {
+	MetricComputer
+	// Describe returns the description of the metric. rateWindow is the period per which rates are served. Zero means
+	// one second.
+	Describe(rateWindow time.Duration) MetricDescription
+}
+
+// MetricMetadata is the metadata of a single served metric
+type MetricMetadata struct {
+	// The name under which the metric is served
+	Name string `json:"name"`
+	// The resources for which the metric is served, in <resource>[.<group>] form, e.g. "pods"
+	Resources []string `json:"resources"`
+	MetricDescription
+}
+
+// MetricMetadata returns the metadata of all metrics served by the MetricsProvider, sorted by metric name
+func (mp *MetricsProvider) MetricMetadata() []MetricMetadata {
+	resources := []string{"pods"}
+	if mp.deploymentSource != nil {
+		resources = append(resources, deploymentsGroupResource.String())
+	}
+
+	result := make([]MetricMetadata, 0, len(mp.computers)+len(etcdMetricNames))
+	for _, computer := range mp.computers {
+		metadata := MetricMetadata{Name: mp.naming.servedName(computer.Name()), Resources: resources}
+		if describedComputer, ok := computer.(DescribedMetricComputer); ok {
+			metadata.MetricDescription = describedComputer.Describe(mp.rateWindow)
+		}
+		result = append(result, metadata)
+	}
+	for _, metricInfo := range mp.listEtcdMetrics() {
+		result = append(result, MetricMetadata{
+			Name:      metricInfo.Metric,
+			Resources: []string{metricInfo.GroupResource.String()},
+			MetricDescription: MetricDescription{
+				Description: fmt.Sprintf(
+					"The per-second rate of the etcd counter %s, for the etcd pod.", etcdMetricNames[metricInfo.Metric]),
+				Unit:   "proposals/s",
+				Window: WindowSamplePair,
+			},
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// MetadataHandler returns an [http.Handler] which responds with the metadata of the metrics served by the
+// MetricsProvider, in JSON format. The handler can be created before CLI configuration is completed, and responds with
+// 503 Service Unavailable until then.
+func (mps *MetricsProviderService) MetadataHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if mps.provider == nil {
+			http.Error(w, "the metrics provider is not initialized yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := json.Marshal(mps.provider.MetricMetadata())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("rendering the metric metadata: %s", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+}
+
+// rateUnit returns the unit of a rate of the specified quantity, served per the specified rate window
+func rateUnit(quantity string, rateWindow time.Duration) string {
+	if rateWindow > time.Second {
+		return fmt.Sprintf("%s/%s", quantity, rateWindow)
+	}
+	return quantity + "/s"
+}
+
+func (c *requestRateComputer) Describe(rateWindow time.Duration) MetricDescription {
+	return MetricDescription{
+		Description: "The rate of requests served by the kube-apiserver pod, over the period between the two most " +
+			"recent samples.",
+		Unit:   rateUnit("requests", rateWindow),
+		Window: WindowSamplePair,
+	}
+}
+
+func (c *sampleAgeComputer) Describe(_ time.Duration) MetricDescription {
+	return MetricDescription{
+		Description: "The age of the most recent sample on which the request rate of the kube-apiserver pod is based. " +
+			"Allows consumers to gate decisions on data freshness.",
+		Unit:   "seconds",
+		Window: WindowInstantaneous,
+	}
+}
+
+func (c *inflightRequestsComputer) Describe(_ time.Duration) MetricDescription {
+	return MetricDescription{
+		Description: "The number of requests currently being served by the kube-apiserver pod, mutating and " +
+			"read-only combined.",
+		Unit:   "requests",
+		Window: WindowInstantaneous,
+	}
+}
+
+func (c *requestLatencyComputer) Describe(_ time.Duration) MetricDescription {
+	return MetricDescription{
+		Description: "The average time the kube-apiserver pod took to serve a request, over the period between the " +
+			"two most recent samples.",
+		Unit:   "seconds",
+		Window: WindowSamplePair,
+	}
+}
+
+func (c *errorRatioComputer) Describe(_ time.Duration) MetricDescription {
+	return MetricDescription{
+		Description: "The fraction of the requests to the kube-apiserver pod, which failed with a 4xx or 5xx status " +
+			"code, over the period between the two most recent samples.",
+		Unit:   "ratio",
+		Window: WindowSamplePair,
+	}
+}
+
+func (c *burstRateComputer) Describe(rateWindow time.Duration) MetricDescription {
+	return MetricDescription{
+		Description: fmt.Sprintf(
+			"The %.0fth percentile of the request rates of the kube-apiserver pod, over the intervals between the "+
+				"samples retained for the pod. Unlike the request rate, it reflects short bursts of requests.",
+			burstRatePercentile*100),
+		Unit:   rateUnit("requests", rateWindow),
+		Window: WindowSampleHistory,
+	}
+}
+
+func (c *windowedRequestRateComputer) Describe(rateWindow time.Duration) MetricDescription {
+	return MetricDescription{
+		Description: fmt.Sprintf(
+			"The rate of requests served by the kube-apiserver pod, over the trailing %s, as far as the samples "+
+				"retained for the pod reach. With a scrape period longer than that, the same as the request rate.",
+			c.window),
+		Unit:   rateUnit("requests", rateWindow),
+		Window: WindowTrailing,
+	}
+}
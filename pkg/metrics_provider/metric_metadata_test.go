@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("MetricsProvider metric metadata", func() {
+	Describe("MetricMetadata", func() {
+		It("should describe each built-in metric, sorted by served name", func() {
+			// Arrange
+			idr := &fakes.FakeInputDataRegistry{}
+			naming := MetricNaming{NameOverrides: map[string]string{metricName: "my_rate"}}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, naming)
+
+			// Act
+			metadata := provider.MetricMetadata()
+
+			// Assert
+			Expect(metadata).To(HaveLen(len(defaultMetricNames)))
+			for i, item := range metadata {
+				Expect(item.Description).NotTo(BeEmpty(), item.Name)
+				Expect(item.Unit).NotTo(BeEmpty(), item.Name)
+				Expect(item.Window).NotTo(BeEmpty(), item.Name)
+				Expect(item.Resources).To(Equal([]string{"pods"}))
+				if i > 0 {
+					Expect(item.Name > metadata[i-1].Name).To(BeTrue())
+				}
+			}
+			Expect(metadata).To(ContainElement(MetricMetadata{
+				Name:      "my_rate",
+				Resources: []string{"pods"},
+				MetricDescription: MetricDescription{
+					Description: (&requestRateComputer{}).Describe(0).Description,
+					Unit:        "requests/s",
+					Window:      WindowSamplePair,
+				},
+			}))
+		})
+
+		It("should express rates per the rate window, and list deployments and etcd metrics, if enabled", func() {
+			// Arrange
+			idr := &fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			provider.SetRateWindow(time.Minute)
+			provider.SetDeploymentSource(NewClientDeploymentSource(fake.NewClientBuilder().Build()))
+			provider.SetEtcdSource(fakeEtcdDataSource{})
+
+			// Act
+			metadata := provider.MetricMetadata()
+
+			// Assert
+			Expect(metadata).To(HaveLen(len(defaultMetricNames) + len(etcdMetricNames)))
+			for _, item := range metadata {
+				switch item.Name {
+				case metricName, burstRateMetricName:
+					Expect(item.Unit).To(Equal("requests/1m0s"))
+				case "shoot:etcd_server_proposals_committed:rate":
+					Expect(item.Resources).To(Equal([]string{"pods"}))
+					Expect(item.Unit).To(Equal("proposals/s"))
+				}
+				if _, isEtcd := etcdMetricNames[item.Name]; !isEtcd {
+					Expect(item.Resources).To(Equal([]string{"pods", "deployments.apps"}))
+				}
+			}
+		})
+
+		It("should report the name alone, for computers which do not describe their metric", func() {
+			// Arrange
+			idr := &fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			Expect(provider.AddMetricComputer(&fakeMetricComputer{name: "a_custom_metric"})).To(Succeed())
+
+			// Act
+			metadata := provider.MetricMetadata()
+
+			// Assert
+			Expect(metadata[0]).To(Equal(MetricMetadata{Name: "a_custom_metric", Resources: []string{"pods"}}))
+		})
+	})
+
+	Describe("MetadataHandler", func() {
+		It("should respond with 503, until the provider is created", func() {
+			// Arrange
+			handler := NewMetricsProviderService().MetadataHandler()
+			recorder := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, MetadataPath, nil))
+
+			// Assert
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+		})
+
+		It("should respond with the metric metadata in JSON format", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+			handler := mps.MetadataHandler()
+			idr := fakes.FakeInputDataRegistry{}
+			Expect(mps.CompleteCLIConfiguration(idr.DataSource(), logr.Discard())).To(Succeed())
+			recorder := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, MetadataPath, nil))
+
+			// Assert
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+			var metadata []MetricMetadata
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &metadata)).To(Succeed())
+			Expect(metadata).To(Equal(mps.Provider().MetricMetadata()))
+		})
+	})
+})
@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// defaultMetricNames lists the names under which the served metrics are known internally. Unless renamed via
+// [MetricNaming.NameOverrides], these are also the names under which the metrics are served.
+var defaultMetricNames = []string{
+	metricName,
+	sampleAgeMetricName,
+	inflightRequestsMetricName,
+	requestLatencyMetricName,
+	errorRatioMetricName,
+	burstRateMetricName,
+	shortRateMetricName,
+	longRateMetricName,
+}
+
+// MetricNaming controls the names and the static labels with which the custom metrics are served.
+type MetricNaming struct {
+	// NameOverrides maps default metric names to the names under which the respective metrics should be served.
+	// Metrics not present in the map are served under their default names.
+	NameOverrides map[string]string
+	// StaticLabels are attached to every served metric value, via the value's metric selector. Useful to identify the
+	// source of the metric (e.g. the seed name), once values from many sources are aggregated.
+	StaticLabels map[string]string
+}
+
+// validate returns an error if the MetricNaming contains unknown metric names, results in duplicate served names, or
+// contains invalid labels.
+func (naming *MetricNaming) validate() error {
+	for defaultName, servedName := range naming.NameOverrides {
+		if !slices.Contains(defaultMetricNames, defaultName) {
+			return fmt.Errorf(
+				"unknown metric name '%s'. Known metrics: %s", defaultName, strings.Join(defaultMetricNames, ", "))
+		}
+		if servedName == "" {
+			return fmt.Errorf("the new name for metric '%s' must not be empty", defaultName)
+		}
+	}
+
+	servedNames := make(map[string]bool, len(defaultMetricNames))
+	for _, defaultName := range defaultMetricNames {
+		servedName := naming.servedName(defaultName)
+		if servedNames[servedName] {
+			return fmt.Errorf("metric name overrides result in more than one metric named '%s'", servedName)
+		}
+		servedNames[servedName] = true
+	}
+
+	for key, value := range naming.StaticLabels {
+		if key == WindowSecondsLabel {
+			return fmt.Errorf("the static label key '%s' is reserved", key)
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid static label key '%s': %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid value for static label '%s': %s", key, strings.Join(errs, "; "))
+		}
+	}
+
+	return nil
+}
+
+// servedName returns the name under which the metric with the specified default name is served
+func (naming *MetricNaming) servedName(defaultName string) string {
+	if servedName, ok := naming.NameOverrides[defaultName]; ok {
+		return servedName
+	}
+	return defaultName
+}
+
+// defaultName is the inverse of servedName. Returns empty string if no metric is served under the specified name.
+func (naming *MetricNaming) defaultName(servedName string) string {
+	for _, defaultName := range defaultMetricNames {
+		if naming.servedName(defaultName) == servedName {
+			return defaultName
+		}
+	}
+	return ""
+}
+
+// staticLabelSelector returns a label selector which matches the static labels, or nil if there are none
+func (naming *MetricNaming) staticLabelSelector() *metav1.LabelSelector {
+	if len(naming.StaticLabels) == 0 {
+		return nil
+	}
+
+	matchLabels := make(map[string]string, len(naming.StaticLabels))
+	for k, v := range naming.StaticLabels {
+		matchLabels[k] = v
+	}
+	return &metav1.LabelSelector{MatchLabels: matchLabels}
+}
+
+// WindowSecondsLabel is a virtual label which a metric selector can use to filter metric values by the length of the
+// window over which they were calculated, e.g. "window_seconds<120". The label is not reported with the metric value.
+// Values which have no window, do not have the label.
+const WindowSecondsLabel = "window_seconds"
+
+// selectableLabels returns the label set against which a metric selector is matched, for a metric value with the
+// specified window. It consists of the static labels, and the virtual WindowSecondsLabel.
+func (naming *MetricNaming) selectableLabels(windowSeconds *int64) labels.Set {
+	result := make(labels.Set, len(naming.StaticLabels)+1)
+	for k, v := range naming.StaticLabels {
+		result[k] = v
+	}
+	if windowSeconds != nil {
+		result[WindowSecondsLabel] = strconv.FormatInt(*windowSeconds, 10)
+	}
+	return result
+}
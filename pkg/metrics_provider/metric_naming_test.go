@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var _ = Describe("MetricNaming", func() {
+	Describe("validate", func() {
+		It("should accept the zero value", func() {
+			// Arrange
+			naming := MetricNaming{}
+
+			// Act
+			err := naming.validate()
+
+			// Assert
+			Expect(err).To(Succeed())
+		})
+
+		It("should accept valid overrides and labels", func() {
+			// Arrange
+			naming := MetricNaming{
+				NameOverrides: map[string]string{metricName: "my_rate", sampleAgeMetricName: "my_age"},
+				StaticLabels:  map[string]string{"seed": "my-seed", "example.com/region": "eu"},
+			}
+
+			// Act
+			err := naming.validate()
+
+			// Assert
+			Expect(err).To(Succeed())
+		})
+
+		DescribeTable("should reject invalid configuration",
+			func(naming MetricNaming, expectedSubstring string) {
+				// Act
+				err := naming.validate()
+
+				// Assert
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(expectedSubstring))
+			},
+			Entry("unknown metric",
+				MetricNaming{NameOverrides: map[string]string{"no-such-metric": "x"}}, "unknown metric name"),
+			Entry("empty new name",
+				MetricNaming{NameOverrides: map[string]string{metricName: ""}}, "must not be empty"),
+			Entry("rename to another metric's default name",
+				MetricNaming{NameOverrides: map[string]string{metricName: sampleAgeMetricName}}, "more than one metric"),
+			Entry("two metrics renamed to the same name",
+				MetricNaming{NameOverrides: map[string]string{metricName: "x", sampleAgeMetricName: "x"}},
+				"more than one metric"),
+			Entry("invalid label key",
+				MetricNaming{StaticLabels: map[string]string{"in valid": "x"}}, "invalid static label key"),
+			Entry("invalid label value",
+				MetricNaming{StaticLabels: map[string]string{"seed": "in valid"}}, "invalid value for static label"),
+			Entry("reserved label key",
+				MetricNaming{StaticLabels: map[string]string{WindowSecondsLabel: "x"}}, "reserved"),
+		)
+	})
+
+	Describe("servedName and defaultName", func() {
+		It("should map between default and served names", func() {
+			// Arrange
+			naming := MetricNaming{NameOverrides: map[string]string{metricName: "my_rate"}}
+
+			// Act & Assert
+			Expect(naming.servedName(metricName)).To(Equal("my_rate"))
+			Expect(naming.servedName(sampleAgeMetricName)).To(Equal(sampleAgeMetricName))
+			Expect(naming.defaultName("my_rate")).To(Equal(metricName))
+			Expect(naming.defaultName(sampleAgeMetricName)).To(Equal(sampleAgeMetricName))
+			Expect(naming.defaultName(metricName)).To(BeEmpty())
+		})
+	})
+
+	Describe("staticLabelSelector", func() {
+		It("should return nil if there are no static labels", func() {
+			// Arrange
+			naming := MetricNaming{}
+
+			// Act & Assert
+			Expect(naming.staticLabelSelector()).To(BeNil())
+		})
+
+		It("should return a selector matching the static labels", func() {
+			// Arrange
+			naming := MetricNaming{StaticLabels: map[string]string{"seed": "my-seed"}}
+
+			// Act
+			selector := naming.staticLabelSelector()
+
+			// Assert
+			Expect(selector.MatchLabels).To(Equal(map[string]string{"seed": "my-seed"}))
+		})
+	})
+
+	Describe("selectableLabels", func() {
+		It("should contain the static labels and the window length", func() {
+			// Arrange
+			naming := MetricNaming{StaticLabels: map[string]string{"seed": "my-seed"}}
+			windowSeconds := int64(60)
+
+			// Act & Assert
+			Expect(naming.selectableLabels(&windowSeconds)).To(Equal(labels.Set{"seed": "my-seed", WindowSecondsLabel: "60"}))
+			Expect(naming.selectableLabels(nil)).To(Equal(labels.Set{"seed": "my-seed"}))
+		})
+	})
+})
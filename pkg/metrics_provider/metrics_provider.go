@@ -7,25 +7,97 @@ package metrics_provider
 import (
 	"context"
 	"fmt"
-	"math"
 	"time"
 
-	"k8s.io/apimachinery/pkg/api/resource"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/metrics/pkg/apis/custom_metrics"
-	"k8s.io/utils/ptr"
 	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
 
+	"github.com/gardener/gardener-custom-metrics/pkg/input/etcd"
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/tracing"
 )
 
 const (
 	metricName = "shoot:apiserver_request_total:sum"
+	// sampleAgeMetricName is the age, in seconds, of the most recent sample on which metricName is based. Allows
+	// consumers to gate decisions on data freshness.
+	sampleAgeMetricName = "shoot:apiserver_request_total:sample_age_seconds"
+	// inflightRequestsMetricName is the number of requests currently being served by the kube-apiserver pod, mutating
+	// and read-only combined.
+	inflightRequestsMetricName = "shoot:apiserver_current_inflight_requests:sum"
+	// requestLatencyMetricName is the average time, in seconds, which the kube-apiserver pod took to serve a request,
+	// over the period between the two most recent samples
+	requestLatencyMetricName = "shoot:apiserver_request_duration_seconds:avg"
+	// errorRatioMetricName is the fraction of the requests to the kube-apiserver pod, which failed with a 4xx or 5xx
+	// status code, over the period between the two most recent samples
+	errorRatioMetricName = "shoot:apiserver_request_error_ratio"
+	// burstRateMetricName is the 95th percentile of the request rates over the intervals between the samples which the
+	// registry retains for the kube-apiserver pod. Unlike metricName, it reflects short bursts of requests.
+	burstRateMetricName = "shoot:apiserver_request_total:burst_rate"
+	// shortRateMetricName is the request rate of the kube-apiserver pod, over a short trailing window (see
+	// DefaultShortRateWindow), as far as the samples which the registry retains reach. Responsive, but noisy.
+	shortRateMetricName = "shoot:apiserver_request_total:short_rate"
+	// longRateMetricName is like shortRateMetricName, but over a long trailing window (see DefaultLongRateWindow).
+	// Stable, but slow to reflect changes.
+	longRateMetricName = "shoot:apiserver_request_total:long_rate"
 )
 
+// RequestRateMetricName and SampleAgeMetricName are the default names under which the request rate, and the age of the
+// samples it is based on, are served
+const (
+	RequestRateMetricName = metricName
+	SampleAgeMetricName   = sampleAgeMetricName
+)
+
+// SampleFreshness is the outcome of checking whether the samples on record for a Kapi are suitable for request rate
+// calculation. See CheckSampleFreshness.
+type SampleFreshness string
+
+const (
+	// SamplesUsable means that the samples are suitable for request rate calculation
+	SamplesUsable SampleFreshness = "the samples are suitable for request rate calculation"
+	// NoSamples means that no sample has been recorded yet
+	NoSamples SampleFreshness = "no sample recorded yet"
+	// SingleSample means that only one sample has been recorded, and a rate needs two
+	SingleSample SampleFreshness = "only one sample recorded, and a rate needs two"
+	// SampleGapTooLarge means that the two most recent samples are further apart than the max sample gap
+	SampleGapTooLarge SampleFreshness = "the two most recent samples are further apart than the max sample gap"
+	// SamplesTooOld means that there is no sample newer than the max sample age
+	SamplesTooOld SampleFreshness = "no sample newer than the max sample age"
+)
+
+// CheckSampleFreshness determines whether a pair of samples, taken at newTime and oldTime, is suitable for request rate
+// calculation at the point in time now. A zero time means that the respective sample is missing. The maxSampleAge and
+// maxSampleGap parameters have the same meaning as in NewMetricsProvider.
+func CheckSampleFreshness(
+	newTime time.Time, oldTime time.Time, now time.Time, maxSampleAge time.Duration, maxSampleGap time.Duration,
+) SampleFreshness {
+
+	if newTime.IsZero() {
+		return NoSamples
+	}
+	if newTime.Before(now.Add(-maxSampleAge)) {
+		return SamplesTooOld
+	}
+	gap := newTime.Sub(oldTime)
+	if oldTime.IsZero() || gap <= 0 {
+		return SingleSample
+	}
+	if gap > maxSampleGap {
+		// Too many samples missed between old and new samples. The calculation would be correct, but not relevant
+		// enough to the present moment, as it may be applying excessive smoothing to a sharply changing quantity.
+		return SampleGapTooLarge
+	}
+	return SamplesUsable
+}
+
 // MetricsProvider implements [provider.CustomMetricsProvider]
 type MetricsProvider struct {
 	dataSource input_data_registry.InputDataSource
@@ -36,6 +108,52 @@ type MetricsProvider struct {
 	// If two consecutive samples are further apart than this, the pair is not considered in rate calculation
 	maxSampleGap time.Duration
 
+	// Controls the names and static labels of the served metrics
+	naming MetricNaming
+
+	// If not nil, requests for namespaces owned by other replicas are forwarded through it
+	shardForwarder ShardForwarder
+
+	// The request rate is served as the number of requests per this period. Zero means one second.
+	rateWindow time.Duration
+
+	// Calculate the served metrics, one computer per metric. See AddMetricComputer.
+	computers []MetricComputer
+
+	// If not nil, object metrics are also served for Deployments. See SetDeploymentSource.
+	deploymentSource DeploymentSource
+
+	// If not nil, the metrics of the shoot etcd pods are also served. See SetEtcdSource.
+	etcdSource etcd.DataSource
+
+	// If not nil, notified of the namespace of each metrics request served locally. See SetQueryObserver.
+	queryObserver func(namespace string)
+
+	// If not nil, closed once this replica becomes leader. Until then, metrics requests are rejected. See
+	// SetLeaderElected.
+	leaderElected <-chan struct{}
+
+	// If not nil, the results of GetMetricBySelector requests for Kapi pods are cached here. See SetResultCacheTTL.
+	resultCache *resultCache
+
+	// If true, the request rate is estimated for Kapis with a single sample. See SetSingleSampleEstimation.
+	estimateFromSingleSample bool
+
+	// If true, the scrape latency of each shoot is served as a metric of the shoot's namespace. See
+	// SetScrapeLatencyMetric.
+	serveScrapeLatency bool
+
+	// If true, the average request rate of each shoot is served as a metric of the shoot's namespace. See
+	// SetAverageRequestRateMetric.
+	serveAverageRequestRate bool
+
+	// If true, Kapi pods which are not ready are left out of the served pod and Deployment metrics. See
+	// SetNotReadyKapiExclusion.
+	excludeNotReadyKapis bool
+
+	// If positive, GetMetricBySelector results are truncated to this many items. See SetMaxResultItems.
+	maxResultItems int
+
 	testIsolation metricsProviderTestIsolation
 }
 
@@ -46,41 +164,224 @@ type MetricsProvider struct {
 //
 // maxSampleGap - When calculating metrics based on difference between two samples, if the samples are further apart
 // than this, they will not be considered.
+//
+// naming - Controls the names and static labels of the served metrics. The caller is responsible for validating it.
 func NewMetricsProvider(
 	dataSource input_data_registry.InputDataSource,
 	maxSampleAge time.Duration,
-	maxSampleGap time.Duration) *MetricsProvider {
+	maxSampleGap time.Duration,
+	naming MetricNaming) *MetricsProvider {
 
 	return &MetricsProvider{
 		dataSource:    dataSource,
 		maxSampleAge:  maxSampleAge,
 		maxSampleGap:  maxSampleGap,
+		naming:        naming,
+		computers:     newBuiltinMetricComputers(),
 		testIsolation: metricsProviderTestIsolation{TimeNow: time.Now},
 	}
 }
 
+// SetShardForwarder enables forwarding of requests for namespaces which are owned by other replicas, when metric
+// scraping is sharded across replicas. Must be called before the MetricsProvider starts serving requests.
+func (mp *MetricsProvider) SetShardForwarder(forwarder ShardForwarder) {
+	mp.shardForwarder = forwarder
+}
+
+// SetLeaderElected makes the MetricsProvider aware of this replica's leadership. The specified channel is closed once
+// the replica becomes leader. Until then, the replica has no metrics data, so instead of serving misleading empty
+// results, the MetricsProvider rejects metric requests with 503 (Service Unavailable), and a Retry-After header. Such
+// requests only arrive if a consumer bypasses the service, which points to the leader. Must be called before the
+// MetricsProvider starts serving requests.
+func (mp *MetricsProvider) SetLeaderElected(elected <-chan struct{}) {
+	mp.leaderElected = elected
+}
+
+// SetRateWindow sets the unit of the request rate metric: the metric is served as the number of requests per the
+// specified window, e.g. per minute, rather than per second. A window of zero restores the default of one second.
+// Must be called before the MetricsProvider starts serving requests. The caller is responsible for ensuring that the
+// window is a positive whole number of seconds.
+func (mp *MetricsProvider) SetRateWindow(window time.Duration) {
+	mp.rateWindow = window
+}
+
+// SetRequestRateWindows sets the trailing windows over which the short and the long request rate metrics are
+// calculated. Must be called before the MetricsProvider starts serving requests. The caller is responsible for ensuring
+// that both windows are positive.
+func (mp *MetricsProvider) SetRequestRateWindows(short time.Duration, long time.Duration) {
+	for _, computer := range mp.computers {
+		windowedComputer, ok := computer.(*windowedRequestRateComputer)
+		if !ok {
+			continue
+		}
+		switch windowedComputer.name {
+		case shortRateMetricName:
+			windowedComputer.window = short
+		case longRateMetricName:
+			windowedComputer.window = long
+		}
+	}
+}
+
+// SetSingleSampleEstimation enables or disables the estimation of the request rate for Kapis which have only one
+// sample on record, e.g. right after this process started. Normally, a rate requires two samples. The estimate is the
+// average rate since the Kapi process started, as reported by the process' start time, and is served with a window as
+// long as the process' uptime, which lets consumers discount it. Must be called before the MetricsProvider starts
+// serving requests.
+func (mp *MetricsProvider) SetSingleSampleEstimation(isEnabled bool) {
+	mp.estimateFromSingleSample = isEnabled
+}
+
+// SetNotReadyKapiExclusion enables or disables the exclusion of Kapi pods which are not ready, e.g. crash-looping ones,
+// from the served pod and Deployment metrics. Such pods are still scraped, so their data is warm once they become
+// ready, but their near-zero request rates no longer drag down the averages which consumers compute. Must be called
+// before the MetricsProvider starts serving requests.
+func (mp *MetricsProvider) SetNotReadyKapiExclusion(isEnabled bool) {
+	mp.excludeNotReadyKapis = isEnabled
+}
+
+// isExcluded returns true if the metrics of the specified Kapi should not be served
+func (mp *MetricsProvider) isExcluded(kapi input_data_registry.ShootKapi) bool {
+	return mp.excludeNotReadyKapis && !kapi.IsReady()
+}
+
+// AddMetricComputer adds a computer, which calculates an additional metric, to the ones served by the MetricsProvider.
+// Fails if the computer's metric would be served under the same name as an existing one. Must be called before the
+// MetricsProvider starts serving requests.
+func (mp *MetricsProvider) AddMetricComputer(computer MetricComputer) error {
+	if computer.Name() == "" {
+		return fmt.Errorf("the metric computer name must not be empty")
+	}
+	servedName := mp.naming.servedName(computer.Name())
+	if mp.findComputer(servedName) != nil {
+		return fmt.Errorf("a metric named '%s' is already served", servedName)
+	}
+
+	mp.computers = append(mp.computers, computer)
+	return nil
+}
+
+// findComputer returns the computer of the metric served under the specified name, or nil if there is no such metric
+func (mp *MetricsProvider) findComputer(servedName string) MetricComputer {
+	for _, computer := range mp.computers {
+		if mp.naming.servedName(computer.Name()) == servedName {
+			return computer
+		}
+	}
+	return nil
+}
+
+// isRemote returns true if the request for the specified namespace should be forwarded to another replica
+func (mp *MetricsProvider) isRemote(namespace string, metricSelector labels.Selector) bool {
+	return mp.shardForwarder != nil && !isForwarded(metricSelector) && !mp.shardForwarder.IsLocal(namespace)
+}
+
 // ListAllMetrics implements [provider.CustomMetricsProvider.ListAllMetrics].
 func (mp *MetricsProvider) ListAllMetrics() []provider.CustomMetricInfo {
-	return []provider.CustomMetricInfo{
-		{
-			GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
-			Metric:        metricName,
-			Namespaced:    true,
-		},
+	groupResources := []schema.GroupResource{{Group: "", Resource: "pods"}}
+	if mp.deploymentSource != nil {
+		groupResources = append(groupResources, deploymentsGroupResource)
+	}
+
+	result := make([]provider.CustomMetricInfo, 0, len(mp.computers)*len(groupResources))
+	for _, groupResource := range groupResources {
+		for _, computer := range mp.computers {
+			result = append(result, provider.CustomMetricInfo{
+				GroupResource: groupResource,
+				Metric:        mp.naming.servedName(computer.Name()),
+				Namespaced:    true,
+			})
+		}
+	}
+	result = append(result, mp.listEtcdMetrics()...)
+	result = append(result, mp.listAverageRequestRateMetrics()...)
+	return append(result, mp.listScrapeLatencyMetrics()...)
+}
+
+// SetQueryObserver directs the MetricsProvider to call the specified function with the namespace of each metrics
+// request it serves, e.g. to track which shoots have consumers of their metrics. Requests forwarded to other shards
+// are observed by the replica which serves them. Requests made with a context returned by WithoutQueryObservation, e.g.
+// by the application's own periodic collection of all values, are not observed. The function must be concurrency-safe,
+// and return quickly. Must be called before the MetricsProvider starts serving requests.
+func (mp *MetricsProvider) SetQueryObserver(observer func(namespace string)) {
+	mp.queryObserver = observer
+}
+
+// noQueryObservationContextKey is the context key which marks requests as exempt from query observation. See
+// WithoutQueryObservation.
+type noQueryObservationContextKey struct{}
+
+// WithoutQueryObservation returns a copy of ctx, which marks the metrics requests made with it as not originating
+// from a consumer of the metrics, so they are not reported to the query observer. See
+// [MetricsProvider.SetQueryObserver].
+func WithoutQueryObservation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noQueryObservationContextKey{}, true)
+}
+
+// notifyQueryObserver notifies the query observer, if there is one, of a request for the specified namespace, unless
+// ctx exempts the request from observation
+func (mp *MetricsProvider) notifyQueryObserver(ctx context.Context, namespace string) {
+	if mp.queryObserver == nil || ctx.Value(noQueryObservationContextKey{}) != nil {
+		return
 	}
+	mp.queryObserver(namespace)
 }
 
 // GetMetricByName implements [provider.CustomMetricsProvider.GetMetricByName].
 func (mp *MetricsProvider) GetMetricByName(
-	_ context.Context,
+	ctx context.Context,
 	name types.NamespacedName,
 	metricInfo provider.CustomMetricInfo,
-	_ labels.Selector) (*custom_metrics.MetricValue, error) {
+	metricSelector labels.Selector) (result *custom_metrics.MetricValue, err error) {
 
-	metrics, err := mp.getMetricByPredicate(
-		name.Namespace,
-		func(kapi input_data_registry.ShootKapi) bool { return kapi.PodName() == name.Name },
-		metricInfo)
+	ctx, span := startRequestSpan(ctx, "GetMetricByName", name.Namespace, metricInfo)
+	span.SetAttributes(attribute.String("pod", name.Name))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	if !mp.isLeader() {
+		return nil, newNotLeaderError()
+	}
+	namespace := name.Namespace
+	if mp.isScrapeLatencyRequest(metricInfo) || mp.isAverageRequestRateRequest(metricInfo) {
+		namespace = name.Name // A metric describing a namespace is requested by the namespace's name
+	}
+	if mp.isRemote(namespace, metricSelector) {
+		span.SetAttributes(attribute.Bool("forwarded", true))
+		return mp.shardForwarder.GetMetricByName(ctx, name, metricInfo, metricSelector)
+	}
+	mp.notifyQueryObserver(ctx, namespace)
+
+	if mp.isScrapeLatencyRequest(metricInfo) {
+		return mp.getScrapeLatencyMetric(namespace, metricSelector), nil
+	}
+	if mp.isAverageRequestRateRequest(metricInfo) {
+		return mp.getAverageRequestRateMetric(namespace, metricSelector), nil
+	}
+	var metrics *custom_metrics.MetricValueList
+	if mp.isEtcdRequest(metricInfo) {
+		metrics = mp.getEtcdMetrics(
+			name.Namespace,
+			func(etcdData *etcd.EtcdData) bool { return etcdData.PodName == name.Name },
+			metricInfo,
+			metricSelector)
+	} else if mp.isDeploymentRequest(metricInfo) {
+		var deployment *appsv1.Deployment
+		deployment, err = mp.deploymentSource.GetDeployment(ctx, name.Namespace, name.Name)
+		if err != nil {
+			return nil, fmt.Errorf("retrieving deployment %s/%s: %w", name.Namespace, name.Name, err)
+		}
+		if deployment == nil {
+			return nil, nil
+		}
+		metrics, err = mp.getDeploymentMetrics(
+			name.Namespace, []appsv1.Deployment{*deployment}, metricInfo, metricSelector)
+	} else {
+		metrics, err = mp.getMetricByPredicate(
+			name.Namespace,
+			func(kapi input_data_registry.ShootKapi) bool { return kapi.PodName() == name.Name },
+			metricInfo,
+			metricSelector)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("retrieving custom metric %s/%s: %w", name.Namespace, name.Name, err)
 	}
@@ -96,18 +397,87 @@ func (mp *MetricsProvider) GetMetricByName(
 
 // GetMetricBySelector implements [provider.CustomMetricsProvider.GetMetricBySelector].
 func (mp *MetricsProvider) GetMetricBySelector(
-	_ context.Context,
+	ctx context.Context,
 	namespace string,
 	podSelector labels.Selector,
 	metricInfo provider.CustomMetricInfo,
-	_ labels.Selector) (*custom_metrics.MetricValueList, error) {
+	metricSelector labels.Selector) (result *custom_metrics.MetricValueList, err error) {
+
+	ctx, span := startRequestSpan(ctx, "GetMetricBySelector", namespace, metricInfo)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	if !mp.isLeader() {
+		return nil, newNotLeaderError()
+	}
+	if mp.isRemote(namespace, metricSelector) {
+		span.SetAttributes(attribute.Bool("forwarded", true))
+		return mp.shardForwarder.GetMetricBySelector(ctx, namespace, podSelector, metricInfo, metricSelector)
+	}
+	mp.notifyQueryObserver(ctx, namespace)
 
-	return mp.getMetricByPredicate(
-		namespace,
-		func(kapi input_data_registry.ShootKapi) bool {
-			return podSelector.Matches(labels.Set(kapi.PodLabels()))
-		},
-		metricInfo)
+	result, err = mp.getLocalMetricBySelector(ctx, namespace, podSelector, metricInfo, metricSelector)
+	if err != nil {
+		return nil, err
+	}
+	if mp.limitResult(result) {
+		span.SetAttributes(attribute.Int64("truncatedItemCount", *result.RemainingItemCount))
+	}
+	return result, nil
+}
+
+// getLocalMetricBySelector implements GetMetricBySelector for requests which are served by this replica, before the
+// result is limited
+func (mp *MetricsProvider) getLocalMetricBySelector(
+	ctx context.Context,
+	namespace string,
+	podSelector labels.Selector,
+	metricInfo provider.CustomMetricInfo,
+	metricSelector labels.Selector) (*custom_metrics.MetricValueList, error) {
+
+	if mp.isEtcdRequest(metricInfo) {
+		return mp.getEtcdMetrics(
+			namespace,
+			func(etcdData *etcd.EtcdData) bool { return podSelector.Matches(labels.Set(etcdData.PodLabels)) },
+			metricInfo,
+			metricSelector), nil
+	}
+	if mp.isDeploymentRequest(metricInfo) {
+		deployments, err := mp.deploymentSource.ListDeployments(ctx, namespace, podSelector)
+		if err != nil {
+			return nil, fmt.Errorf("listing deployments in namespace %s: %w", namespace, err)
+		}
+		return mp.getDeploymentMetrics(namespace, deployments, metricInfo, metricSelector)
+	}
+
+	if mp.resultCache != nil {
+		return mp.getMetricBySelectorCached(namespace, podSelector, metricInfo, metricSelector)
+	}
+	return mp.getMetricByPredicate(namespace, podSelectorPredicate(podSelector), metricInfo, metricSelector)
+}
+
+// isDeploymentRequest returns true if the request is for object metrics describing Deployments, rather than pods
+func (mp *MetricsProvider) isDeploymentRequest(metricInfo provider.CustomMetricInfo) bool {
+	return mp.deploymentSource != nil && metricInfo.GroupResource == deploymentsGroupResource
+}
+
+// newComputeContext returns a ComputeContext, which applies the provider's settings as of the present moment
+func (mp *MetricsProvider) newComputeContext() *ComputeContext {
+	return &ComputeContext{
+		Now:          mp.testIsolation.TimeNow(),
+		MaxSampleAge: mp.maxSampleAge,
+		MaxSampleGap: mp.maxSampleGap,
+		RateWindow:   mp.rateWindow,
+
+		EstimateFromSingleSample: mp.estimateFromSingleSample,
+	}
+}
+
+// startRequestSpan starts a trace span for a metric request
+func startRequestSpan(
+	ctx context.Context, operation string, namespace string, metricInfo provider.CustomMetricInfo) (context.Context, trace.Span) {
+
+	return tracing.Tracer().Start(ctx, operation, trace.WithAttributes(
+		attribute.String("namespace", namespace), attribute.String("metric", metricInfo.Metric)))
 }
 
 // kapiPredicate is solely used in conjunction with getMetricByPredicate()
@@ -117,40 +487,36 @@ type kapiPredicate func(kapi input_data_registry.ShootKapi) bool
 // of [provider.CustomMetricsProvider.GetMetricBySelector]
 //
 // The predicate returns true for [input_data_registry.ShootKapi] instances which should be included in the result.
+// Metric values which do not match the metricSelector are excluded from the result. A nil metricSelector matches all
+// values. See [MetricNaming.selectableLabels] for the labels which the metricSelector can refer to.
 func (mp *MetricsProvider) getMetricByPredicate(
 	namespace string,
 	predicate kapiPredicate,
-	metricInfo provider.CustomMetricInfo) (*custom_metrics.MetricValueList, error) {
+	metricInfo provider.CustomMetricInfo,
+	metricSelector labels.Selector) (*custom_metrics.MetricValueList, error) {
 
-	if metricInfo.Metric != metricName {
+	computer := mp.findComputer(metricInfo.Metric)
+	if computer == nil {
 		return &custom_metrics.MetricValueList{}, nil
 	}
 
 	kapis := mp.dataSource.GetShootKapis(namespace)
+	computeContext := mp.newComputeContext()
+	staticLabelSelector := mp.naming.staticLabelSelector()
 	result := &custom_metrics.MetricValueList{}
 	for _, kapi := range kapis {
-		if !predicate(kapi) {
+		if !predicate(kapi) || mp.isExcluded(kapi) {
 			continue
 		}
 
-		gap := kapi.MetricsTimeNew().Sub(kapi.MetricsTimeOld())
-		if gap == 0 {
-			// Before actual samples get recorded, the times point to the start of the epoch
-			continue
-		}
-		if gap > mp.maxSampleGap {
-			// Too many samples missed between old and new samples. The calculation would be correct, but not relevant
-			// enough to the present moment, as it may be applying excessive smoothing to a sharply changing quantity.
-			// Also covers the case right after the very first sample gets registered, so the old sample still points
-			// to the start of the epoch.
+		computed, ok := computer.Compute(kapi, computeContext)
+		if !ok {
 			continue
 		}
-		if kapi.MetricsTimeNew().Before(mp.testIsolation.TimeNow().Add(-mp.maxSampleAge)) {
-			// Samples too old
+		if metricSelector != nil && !metricSelector.Matches(mp.naming.selectableLabels(computed.WindowSeconds)) {
 			continue
 		}
 
-		requestRate := float64(kapi.TotalRequestCountNew()-kapi.TotalRequestCountOld()) / gap.Seconds()
 		result.Items = append(result.Items, custom_metrics.MetricValue{
 			DescribedObject: custom_metrics.ObjectReference{
 				Kind:       "Pod",
@@ -160,11 +526,12 @@ func (mp *MetricsProvider) getMetricByPredicate(
 				UID:        kapi.PodUID(),
 			},
 			Metric: custom_metrics.MetricIdentifier{
-				Name: metricName,
+				Name:     metricInfo.Metric,
+				Selector: staticLabelSelector,
 			},
-			Value:         *resource.NewMilliQuantity(int64(requestRate*1000), resource.DecimalSI),
-			Timestamp:     metav1.Time{Time: kapi.MetricsTimeNew()},
-			WindowSeconds: ptr.To(int64(math.Round(gap.Seconds()))),
+			Value:         computed.Value,
+			Timestamp:     metav1.Time{Time: computed.Timestamp},
+			WindowSeconds: computed.WindowSeconds,
 		})
 	}
 
@@ -8,11 +8,15 @@ package metrics_provider
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/pflag"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	basecmd "sigs.k8s.io/custom-metrics-apiserver/pkg/cmd"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/app"
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
@@ -20,6 +24,31 @@ import (
 
 const (
 	adapterName = app.Name
+
+	maxSampleAgeFlagName = "max-sample-age"
+	maxSampleGapFlagName = "max-sample-gap"
+	rateWindowFlagName   = "rate-window"
+
+	shortRateWindowFlagName = "short-rate-window"
+	longRateWindowFlagName  = "long-rate-window"
+
+	resultCacheTTLFlagName = "result-cache-ttl"
+	maxResultItemsFlagName = "max-result-items"
+
+	maxInflightRequestsFlagName = "max-inflight-requests"
+	maxClientQPSFlagName        = "max-client-qps"
+	maxClientBurstFlagName      = "max-client-burst"
+
+	// DefaultMaxSampleAge is the default value of the --max-sample-age option
+	DefaultMaxSampleAge = 90 * time.Second
+	// DefaultMaxSampleGap is the default value of the --max-sample-gap option
+	DefaultMaxSampleGap = 600 * time.Second
+	// DefaultRateWindow is the default value of the --rate-window option
+	DefaultRateWindow = time.Second
+	// DefaultShortRateWindow is the default value of the --short-rate-window option
+	DefaultShortRateWindow = 30 * time.Second
+	// DefaultLongRateWindow is the default value of the --long-rate-window option
+	DefaultLongRateWindow = 5 * time.Minute
 )
 
 // MetricsProviderService is the main type of the package. It runs a custom metrics server, which exposes shoot
@@ -29,6 +58,9 @@ type MetricsProviderService struct {
 	basecmd.AdapterBase                                     // AdapterBase provides a metrics server framework
 	dataSource          input_data_registry.InputDataSource // Contains the data exposed as custom metrics
 	log                 logr.Logger
+	provider            *MetricsProvider // The custom metrics handler. Nil until CLI configuration is completed.
+	// The metrics.k8s.io handler. Nil until CLI configuration is completed, and if resource metrics are disabled.
+	resourceProvider *ResourceMetricsProvider
 
 	// The last sample for a pod is valid for this long
 	maxSampleAge time.Duration
@@ -36,6 +68,49 @@ type MetricsProviderService struct {
 	// If two consecutive samples are further apart than this, the pair is not considered in rate calculation
 	maxSampleGap time.Duration
 
+	// Controls the names and static labels of the served metrics
+	naming MetricNaming
+
+	// The request rate is served as the number of requests per this period
+	rateWindow time.Duration
+
+	// The trailing windows over which the short and the long request rate metrics are calculated
+	shortRateWindow time.Duration
+	longRateWindow  time.Duration
+
+	// Selector query results are served from a cache for up to this long. Zero disables the cache.
+	resultCacheTTL time.Duration
+
+	// Selector query results are truncated to this many items. Zero means no limit.
+	maxResultItems int
+
+	// If true, the request rate of a Kapi with a single sample is estimated from the Kapi process' uptime
+	estimateFromSingleSample bool
+
+	// If true, the p90 scrape latency of each shoot is served as a metric of the shoot's namespace
+	serveScrapeLatency bool
+
+	// If true, the request rate of each shoot, averaged across its ready Kapi pods, is served as a metric of the
+	// shoot's namespace
+	serveAverageRequestRate bool
+
+	// If true, Kapi pods which are not ready are left out of the served pod and Deployment metrics
+	excludeNotReadyKapis bool
+
+	// If true, resource metrics (the metrics.k8s.io API) are served for Kapi pods, in addition to custom metrics
+	enableResourceMetrics bool
+
+	// If true, object metrics are also served for Deployments, aggregated over the Kapi pods they select
+	enableDeploymentMetrics bool
+
+	// If true, each custom metrics API request is logged, and counted in Prometheus metrics. See requestAuditor.
+	auditRequests bool
+	// The request audit metrics are registered here
+	auditMetricsRegisterer prometheus.Registerer
+
+	// The limits beyond which custom metrics API requests are rejected. See loadShedder.
+	loadShedding LoadSheddingConfig
+
 	testIsolation metricsServiceTestIsolation
 }
 
@@ -46,8 +121,24 @@ func NewMetricsProviderService() *MetricsProviderService {
 		AdapterBase: basecmd.AdapterBase{
 			Name: adapterName,
 		},
-		maxSampleAge:  90 * time.Second,
-		maxSampleGap:  600 * time.Second,
+		maxSampleAge: DefaultMaxSampleAge,
+		maxSampleGap: DefaultMaxSampleGap,
+		rateWindow:   DefaultRateWindow,
+
+		shortRateWindow: DefaultShortRateWindow,
+		longRateWindow:  DefaultLongRateWindow,
+
+		resultCacheTTL: DefaultResultCacheTTL,
+		maxResultItems: DefaultMaxResultItems,
+
+		auditMetricsRegisterer: ctrlmetrics.Registry,
+		loadShedding: LoadSheddingConfig{
+			MaxInflightRequests: DefaultMaxInflightRequests,
+			MaxClientQPS:        DefaultMaxClientQPS,
+			MaxClientBurst:      DefaultMaxClientBurst,
+			PriorityUsers:       DefaultPriorityUsers,
+		},
+
 		testIsolation: metricsServiceTestIsolation{NewMetricsProvider: NewMetricsProvider},
 	}
 
@@ -63,7 +154,7 @@ func (mps *MetricsProviderService) AddCLIFlags(cliFlagSet *pflag.FlagSet) {
 
 	mps.Flags().DurationVar(
 		&mps.maxSampleAge,
-		"max-sample-age",
+		maxSampleAgeFlagName,
 		mps.maxSampleAge,
 		fmt.Sprintf(
 			"How long will the last metrics sample for a given pod be considered valid, after it is collected. Default: %s",
@@ -71,13 +162,224 @@ func (mps *MetricsProviderService) AddCLIFlags(cliFlagSet *pflag.FlagSet) {
 	)
 	mps.Flags().DurationVar(
 		&mps.maxSampleGap,
-		"max-sample-gap",
+		maxSampleGapFlagName,
 		mps.maxSampleGap,
 		fmt.Sprintf(
 			"The maximum time between a pair of two consecutive samples, before the pair is considered unsuitable "+
 				"for rate calculation. Default: %s",
 			mps.maxSampleGap),
 	)
+	mps.Flags().StringToStringVar(
+		&mps.naming.NameOverrides,
+		"metric-name-override",
+		mps.naming.NameOverrides,
+		fmt.Sprintf(
+			"Serve metrics under names different from the default ones, e.g. '%s=my_request_rate'. "+
+				"Format: <default name>=<new name>[,...]. Default metric names: %s",
+			metricName, strings.Join(defaultMetricNames, ", ")),
+	)
+	mps.Flags().StringToStringVar(
+		&mps.naming.StaticLabels,
+		"metric-static-labels",
+		mps.naming.StaticLabels,
+		"Labels attached to every served metric value, e.g. 'seed=my-seed'. Format: <key>=<value>[,...]",
+	)
+	mps.Flags().DurationVar(
+		&mps.rateWindow,
+		rateWindowFlagName,
+		mps.rateWindow,
+		fmt.Sprintf(
+			"The unit of the request rate metric: the rate is served as the number of requests per this period, "+
+				"e.g. '1m' for requests per minute. Must be a whole number of seconds. With a value other than the "+
+				"default, the metric's window is reported as this period. Default: %s",
+			mps.rateWindow),
+	)
+	mps.Flags().DurationVar(
+		&mps.shortRateWindow,
+		shortRateWindowFlagName,
+		mps.shortRateWindow,
+		fmt.Sprintf(
+			"The trailing window over which the %s metric is calculated. Takes effect as far as the retained "+
+				"samples allow: with a scrape period longer than the window, the metric equals the request rate. "+
+				"Default: %s",
+			shortRateMetricName, mps.shortRateWindow),
+	)
+	mps.Flags().DurationVar(
+		&mps.longRateWindow,
+		longRateWindowFlagName,
+		mps.longRateWindow,
+		fmt.Sprintf(
+			"The trailing window over which the %s metric is calculated. Must be longer than --%s. Only %d "+
+				"samples are retained per pod, so a window longer than %d scrape periods is cut short. Default: %s",
+			longRateMetricName, shortRateWindowFlagName, input_data_registry.RequestCountHistorySize,
+			input_data_registry.RequestCountHistorySize-1, mps.longRateWindow),
+	)
+	mps.Flags().DurationVar(
+		&mps.resultCacheTTL,
+		resultCacheTTLFlagName,
+		mps.resultCacheTTL,
+		fmt.Sprintf(
+			"For up to this long, the result of a metrics request for the kube-apiserver pods matching a selector is "+
+				"reused for identical requests, unless new data arrives for the shoot in the meantime. Saves "+
+				"recomputing the same values for each of many HPAs. Zero disables reuse. Default: %s",
+			mps.resultCacheTTL),
+	)
+	mps.Flags().IntVar(
+		&mps.maxResultItems,
+		maxResultItemsFlagName,
+		mps.maxResultItems,
+		"The max number of items which a custom metrics query for multiple objects returns, protecting the adapter "+
+			"from building giant responses. The items are ordered by object name, and the count of the ones left out "+
+			"is reported as the list's remainingItemCount. Note that an HPA which receives a truncated list "+
+			"computes its average over the returned items only. Zero means no limit.",
+	)
+	mps.Flags().BoolVar(
+		&mps.estimateFromSingleSample,
+		"estimate-from-single-sample",
+		mps.estimateFromSingleSample,
+		"While a kube-apiserver pod has only one metrics sample, e.g. right after this process started, serve an "+
+			"estimated request rate: the pod's request count, divided by the uptime of the kube-apiserver process. "+
+			"The estimate is served with a window as long as the uptime, so consumers can discount it.",
+	)
+	mps.Flags().BoolVar(
+		&mps.serveScrapeLatency,
+		"enable-scrape-latency-metric",
+		mps.serveScrapeLatency,
+		fmt.Sprintf(
+			"Also serve the '%s' metric for each shoot namespace: the 90th percentile of the durations of the "+
+				"recent successful scrapes of the shoot's kube-apiserver pods. Tells consumers, e.g. HPA tuning, how "+
+				"late the served metrics are. Served at /namespaces/{namespace}/metrics/{metric}.",
+			ScrapeLatencyMetricName),
+	)
+	mps.Flags().BoolVar(
+		&mps.serveAverageRequestRate,
+		"enable-average-request-rate-metric",
+		mps.serveAverageRequestRate,
+		fmt.Sprintf(
+			"Also serve the '%s' metric for each shoot namespace: the sum of the request rates of the shoot's "+
+				"kube-apiserver pods, divided by the number of ready ones. For consumers, e.g. HPAs with Object "+
+				"metrics, which need an explicit average. Served at /namespaces/{namespace}/metrics/{metric}.",
+			AverageRequestRateMetricName),
+	)
+	mps.Flags().BoolVar(
+		&mps.excludeNotReadyKapis,
+		"exclude-not-ready-kube-apiservers",
+		mps.excludeNotReadyKapis,
+		"Leave kube-apiserver pods which are not ready, e.g. crash-looping ones, out of the served pod and "+
+			"Deployment metrics, so their near-zero request rates do not drag down the averages which HPAs compute. "+
+			"Such pods are still scraped.",
+	)
+	mps.Flags().BoolVar(
+		&mps.enableResourceMetrics,
+		"enable-resource-metrics",
+		mps.enableResourceMetrics,
+		"Also serve resource metrics (the metrics.k8s.io API) for kube-apiserver pods, based on the CPU and memory "+
+			"usage which each kube-apiserver process reports about itself. Only shoot namespaces which this replica "+
+			"scrapes are served. Note that metrics.k8s.io can only be served by one APIService per cluster.",
+	)
+	mps.Flags().BoolVar(
+		&mps.enableDeploymentMetrics,
+		"enable-deployment-metrics",
+		mps.enableDeploymentMetrics,
+		"Also serve each metric as an object metric for deployments (apps/deployments), aggregated over the "+
+			"kube-apiserver pods which match the deployment's selector, so an HPA can target the kube-apiserver "+
+			"deployment with an Object metric. Requires permission to get, list and watch deployments.",
+	)
+	mps.Flags().BoolVar(
+		&mps.auditRequests,
+		"audit-requests",
+		mps.auditRequests,
+		"Log each custom metrics API request, with the client identity, the requested namespace and metric, and the "+
+			"time taken to serve it. The requests are also counted in Prometheus metrics, on the metrics endpoint.",
+	)
+	mps.Flags().IntVar(
+		&mps.loadShedding.MaxInflightRequests,
+		maxInflightRequestsFlagName,
+		mps.loadShedding.MaxInflightRequests,
+		fmt.Sprintf(
+			"The maximum number of custom metrics API requests served concurrently. Further requests are rejected "+
+				"with 429 (Too Many Requests), unless they come from a priority user. 0 means no limit. Default: %d",
+			mps.loadShedding.MaxInflightRequests),
+	)
+	mps.Flags().Float64Var(
+		&mps.loadShedding.MaxClientQPS,
+		maxClientQPSFlagName,
+		mps.loadShedding.MaxClientQPS,
+		fmt.Sprintf(
+			"The maximum average rate of custom metrics API requests per second, per client identity. Requests "+
+				"beyond that are rejected with 429 (Too Many Requests), unless they come from a priority user. "+
+				"0 means no limit. Default: %g",
+			mps.loadShedding.MaxClientQPS),
+	)
+	mps.Flags().IntVar(
+		&mps.loadShedding.MaxClientBurst,
+		maxClientBurstFlagName,
+		mps.loadShedding.MaxClientBurst,
+		fmt.Sprintf(
+			"The number of requests by which a client may exceed the --%s rate in a burst. Default: %d",
+			maxClientQPSFlagName, mps.loadShedding.MaxClientBurst),
+	)
+	mps.Flags().StringSliceVar(
+		&mps.loadShedding.PriorityUsers,
+		"priority-users",
+		mps.loadShedding.PriorityUsers,
+		fmt.Sprintf(
+			"The client identities whose custom metrics API requests are never rejected due to load, typically "+
+				"the horizontal pod autoscaler. Default: %s",
+			strings.Join(mps.loadShedding.PriorityUsers, ",")),
+	)
+}
+
+// ValidateCLIConfiguration checks the CLI options for invalid values, and for combinations with the specified scrape
+// period, which would result in missing metrics. The check does not depend on the environment, and can be done before
+// CompleteCLIConfiguration().
+func (mps *MetricsProviderService) ValidateCLIConfiguration(scrapePeriod time.Duration) error {
+	if mps.maxSampleAge <= 0 {
+		return fmt.Errorf("the --%s option must be positive", maxSampleAgeFlagName)
+	}
+	if mps.maxSampleAge < scrapePeriod {
+		return fmt.Errorf(
+			"the --%s option (%s) must not be less than the scrape period (%s). Otherwise, samples expire before the "+
+				"next scrape, and metrics are intermittently missing",
+			maxSampleAgeFlagName, mps.maxSampleAge, scrapePeriod)
+	}
+	if mps.maxSampleGap <= scrapePeriod {
+		return fmt.Errorf(
+			"the --%s option (%s) must be greater than the scrape period (%s). Otherwise, consecutive samples are "+
+				"too far apart to calculate a rate, and the request rate metric is missing",
+			maxSampleGapFlagName, mps.maxSampleGap, scrapePeriod)
+	}
+	if mps.rateWindow < time.Second || mps.rateWindow%time.Second != 0 {
+		return fmt.Errorf(
+			"the --%s option (%s) must be a positive whole number of seconds", rateWindowFlagName, mps.rateWindow)
+	}
+	if mps.shortRateWindow <= 0 {
+		return fmt.Errorf("the --%s option must be positive", shortRateWindowFlagName)
+	}
+	if mps.longRateWindow <= mps.shortRateWindow {
+		return fmt.Errorf(
+			"the --%s option (%s) must be longer than the --%s option (%s)",
+			longRateWindowFlagName, mps.longRateWindow, shortRateWindowFlagName, mps.shortRateWindow)
+	}
+	if mps.resultCacheTTL < 0 {
+		return fmt.Errorf("the --%s option must not be negative", resultCacheTTLFlagName)
+	}
+	if mps.maxResultItems < 0 {
+		return fmt.Errorf("the --%s option must not be negative", maxResultItemsFlagName)
+	}
+	if err := mps.naming.validate(); err != nil {
+		return fmt.Errorf("invalid metric naming options: %w", err)
+	}
+	if mps.loadShedding.MaxInflightRequests < 0 {
+		return fmt.Errorf("the --%s option must not be negative", maxInflightRequestsFlagName)
+	}
+	if mps.loadShedding.MaxClientQPS < 0 {
+		return fmt.Errorf("the --%s option must not be negative", maxClientQPSFlagName)
+	}
+	if mps.loadShedding.MaxClientBurst < 0 {
+		return fmt.Errorf("the --%s option must not be negative", maxClientBurstFlagName)
+	}
+	return nil
 }
 
 // CompleteCLIConfiguration sets the logger and dataSource to be used for the rest of the object's lifetime,
@@ -98,11 +400,117 @@ func (mps *MetricsProviderService) CompleteCLIConfiguration(
 // createProvider creates the proper metrics provider - a MetricsProvider instance, and registers it as the metrics
 // server's custom metrics handler.
 func (mps *MetricsProviderService) createProvider() error {
-	mps.WithCustomMetrics(
-		mps.testIsolation.NewMetricsProvider(mps.dataSource, mps.maxSampleAge, mps.maxSampleGap))
+	if err := mps.naming.validate(); err != nil {
+		return fmt.Errorf("invalid metric naming options: %w", err)
+	}
+	mps.provider =
+		mps.testIsolation.NewMetricsProvider(mps.dataSource, mps.maxSampleAge, mps.maxSampleGap, mps.naming)
+	mps.provider.SetRateWindow(mps.rateWindow)
+	mps.provider.SetRequestRateWindows(mps.shortRateWindow, mps.longRateWindow)
+	mps.provider.SetResultCacheTTL(mps.resultCacheTTL)
+	mps.provider.SetMaxResultItems(mps.maxResultItems)
+	mps.provider.SetSingleSampleEstimation(mps.estimateFromSingleSample)
+	mps.provider.SetScrapeLatencyMetric(mps.serveScrapeLatency)
+	mps.provider.SetAverageRequestRateMetric(mps.serveAverageRequestRate)
+	mps.provider.SetNotReadyKapiExclusion(mps.excludeNotReadyKapis)
+	// The load shedder is wrapped in the auditor, so rejected requests are audited too
+	var customMetricsProvider provider.CustomMetricsProvider = newLoadShedder(mps.provider, mps.loadShedding)
+	if mps.auditRequests {
+		auditor := newRequestAuditor(customMetricsProvider, mps.log.WithName("audit"))
+		if err := mps.auditMetricsRegisterer.Register(auditor); err != nil {
+			return fmt.Errorf("registering request audit metrics: %w", err)
+		}
+		customMetricsProvider = auditor
+	}
+	mps.WithCustomMetrics(customMetricsProvider)
+	if mps.enableResourceMetrics {
+		mps.resourceProvider = NewResourceMetricsProvider(mps.dataSource, mps.maxSampleAge, mps.maxSampleGap)
+	}
 	return nil
 }
 
+// Run starts the metrics server and blocks until stopCh is closed. It is the same as [cmd.AdapterBase.Run], except
+// that it also installs the resource metrics API on the server, if resource metrics are enabled.
+func (mps *MetricsProviderService) Run(stopCh <-chan struct{}) error {
+	server, err := mps.Server()
+	if err != nil {
+		return err
+	}
+
+	if mps.resourceProvider != nil {
+		if err := installResourceMetricsAPI(server.GenericAPIServer, mps.resourceProvider); err != nil {
+			return fmt.Errorf("installing the resource metrics API: %w", err)
+		}
+	}
+
+	return server.GenericAPIServer.PrepareRun().Run(stopCh)
+}
+
+// DeploymentMetricsEnabled returns true if object metrics are to be served for Deployments. If so, the caller is
+// responsible for calling [MetricsProvider.SetDeploymentSource] once CLI configuration is completed.
+func (mps *MetricsProviderService) DeploymentMetricsEnabled() bool {
+	return mps.enableDeploymentMetrics
+}
+
+// MetricsProviderConfig is a summary of the settings which a MetricsProviderService applies, as returned by
+// MetricsProviderService.Config
+type MetricsProviderConfig struct {
+	MaxSampleAge            time.Duration
+	MaxSampleGap            time.Duration
+	Naming                  MetricNaming
+	RateWindow              time.Duration
+	ShortRateWindow         time.Duration
+	LongRateWindow          time.Duration
+	ResultCacheTTL          time.Duration
+	MaxResultItems          int
+	SingleSampleEstimation  bool
+	ScrapeLatencyMetric     bool
+	AverageRequestRate      bool
+	ExcludeNotReadyKapis    bool
+	EnableResourceMetrics   bool
+	EnableDeploymentMetrics bool
+	AuditRequests           bool
+	LoadShedding            LoadSheddingConfig
+}
+
+// Config returns the settings applied by the service. Only meaningful after CLI flags are parsed.
+func (mps *MetricsProviderService) Config() MetricsProviderConfig {
+	return MetricsProviderConfig{
+		MaxSampleAge:            mps.maxSampleAge,
+		MaxSampleGap:            mps.maxSampleGap,
+		Naming:                  mps.naming,
+		RateWindow:              mps.rateWindow,
+		ShortRateWindow:         mps.shortRateWindow,
+		LongRateWindow:          mps.longRateWindow,
+		ResultCacheTTL:          mps.resultCacheTTL,
+		MaxResultItems:          mps.maxResultItems,
+		SingleSampleEstimation:  mps.estimateFromSingleSample,
+		ScrapeLatencyMetric:     mps.serveScrapeLatency,
+		AverageRequestRate:      mps.serveAverageRequestRate,
+		ExcludeNotReadyKapis:    mps.excludeNotReadyKapis,
+		EnableResourceMetrics:   mps.enableResourceMetrics,
+		EnableDeploymentMetrics: mps.enableDeploymentMetrics,
+		AuditRequests:           mps.auditRequests,
+		LoadShedding:            mps.loadShedding,
+	}
+}
+
+// Provider returns the MetricsProvider which serves custom metrics. Returns nil if called before
+// CompleteCLIConfiguration().
+func (mps *MetricsProviderService) Provider() *MetricsProvider {
+	return mps.provider
+}
+
+// SetLeaderElected makes both the custom metrics and the resource metrics providers aware of this replica's
+// leadership. See [MetricsProvider.SetLeaderElected]. Must be called after CompleteCLIConfiguration(), and before the
+// service starts serving requests.
+func (mps *MetricsProviderService) SetLeaderElected(elected <-chan struct{}) {
+	mps.provider.SetLeaderElected(elected)
+	if mps.resourceProvider != nil {
+		mps.resourceProvider.SetLeaderElected(elected)
+	}
+}
+
 // metricsServiceTestIsolation contains all points of indirection necessary to isolate static function calls
 // in the MetricsService unit during tests
 type metricsServiceTestIsolation struct {
@@ -110,5 +518,6 @@ type metricsServiceTestIsolation struct {
 	NewMetricsProvider func(
 		dataSource input_data_registry.InputDataSource,
 		maxSampleAge time.Duration,
-		maxSampleGap time.Duration) *MetricsProvider
+		maxSampleGap time.Duration,
+		naming MetricNaming) *MetricsProvider
 }
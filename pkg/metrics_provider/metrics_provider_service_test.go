@@ -10,9 +10,11 @@ import (
 	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/pflag"
 
 	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
 )
 
 var _ = Describe("MetricsService", func() {
@@ -32,6 +34,9 @@ var _ = Describe("MetricsService", func() {
 				Expect(flag).NotTo(BeNil())
 				Expect(flag.DefValue).NotTo(BeZero())
 			}
+			for _, flagName := range []string{"metric-name-override", "metric-static-labels"} {
+				Expect(flags.Lookup(flagName)).NotTo(BeNil())
+			}
 		})
 	})
 
@@ -41,14 +46,15 @@ var _ = Describe("MetricsService", func() {
 			mps := NewMetricsProviderService()
 			var actualDataSource input_data_registry.InputDataSource
 			var actualMaxSampleAge, actualMaxSampleGap time.Duration
-			mps.testIsolation.NewMetricsProvider =
-				func(ds input_data_registry.InputDataSource, msa time.Duration, msg time.Duration) *MetricsProvider {
-					actualDataSource = ds
-					actualMaxSampleAge = msa
-					actualMaxSampleGap = msg
-					return nil
-				}
-			idr := input_data_registry.FakeInputDataRegistry{}
+			mps.testIsolation.NewMetricsProvider = func(
+				ds input_data_registry.InputDataSource, msa time.Duration, msg time.Duration, _ MetricNaming,
+			) *MetricsProvider {
+				actualDataSource = ds
+				actualMaxSampleAge = msa
+				actualMaxSampleGap = msg
+				return &MetricsProvider{}
+			}
+			idr := fakes.FakeInputDataRegistry{}
 			expectedDataSource := idr.DataSource()
 
 			// Act
@@ -61,4 +67,218 @@ var _ = Describe("MetricsService", func() {
 			Expect(mps.Name).To(Equal(adapterName))
 		})
 	})
+
+	Describe("CompleteCLIConfiguration with metric naming", func() {
+		It("should pass the metric naming flags to the MetricsProvider", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+			flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+			mps.AddCLIFlags(flags)
+			Expect(flags.Parse([]string{
+				"--metric-name-override=" + metricName + "=my_rate", "--metric-static-labels=seed=my-seed"})).To(Succeed())
+			idr := fakes.FakeInputDataRegistry{}
+
+			// Act
+			err := mps.CompleteCLIConfiguration(idr.DataSource(), logr.Discard())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(mps.Provider().naming.NameOverrides).To(Equal(map[string]string{metricName: "my_rate"}))
+			Expect(mps.Provider().naming.StaticLabels).To(Equal(map[string]string{"seed": "my-seed"}))
+		})
+
+		It("should pass the rate window to the MetricsProvider", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+			flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+			mps.AddCLIFlags(flags)
+			Expect(flags.Parse([]string{"--rate-window=1m"})).To(Succeed())
+			idr := fakes.FakeInputDataRegistry{}
+
+			// Act
+			err := mps.CompleteCLIConfiguration(idr.DataSource(), logr.Discard())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(mps.Provider().rateWindow).To(Equal(time.Minute))
+		})
+
+		It("should pass the short and long rate windows to the MetricsProvider", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+			flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+			mps.AddCLIFlags(flags)
+			Expect(flags.Parse([]string{"--short-rate-window=20s", "--long-rate-window=10m"})).To(Succeed())
+			idr := fakes.FakeInputDataRegistry{}
+
+			// Act
+			err := mps.CompleteCLIConfiguration(idr.DataSource(), logr.Discard())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(mps.Provider().findComputer(shortRateMetricName)).
+				To(Equal(&windowedRequestRateComputer{name: shortRateMetricName, window: 20 * time.Second}))
+			Expect(mps.Provider().findComputer(longRateMetricName)).
+				To(Equal(&windowedRequestRateComputer{name: longRateMetricName, window: 10 * time.Minute}))
+		})
+
+		It("should pass the scrape latency metric setting to the MetricsProvider", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+			flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+			mps.AddCLIFlags(flags)
+			Expect(flags.Parse([]string{"--enable-scrape-latency-metric"})).To(Succeed())
+			idr := fakes.FakeInputDataRegistry{}
+
+			// Act
+			err := mps.CompleteCLIConfiguration(idr.DataSource(), logr.Discard())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(mps.Provider().serveScrapeLatency).To(BeTrue())
+		})
+
+		It("should pass the max result items setting to the MetricsProvider", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+			flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+			mps.AddCLIFlags(flags)
+			Expect(flags.Parse([]string{"--max-result-items=100"})).To(Succeed())
+			idr := fakes.FakeInputDataRegistry{}
+
+			// Act
+			err := mps.CompleteCLIConfiguration(idr.DataSource(), logr.Discard())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(mps.Provider().maxResultItems).To(Equal(100))
+		})
+
+		It("should pass the not ready Kapi exclusion setting to the MetricsProvider", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+			flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+			mps.AddCLIFlags(flags)
+			Expect(flags.Parse([]string{"--exclude-not-ready-kube-apiservers"})).To(Succeed())
+			idr := fakes.FakeInputDataRegistry{}
+
+			// Act
+			err := mps.CompleteCLIConfiguration(idr.DataSource(), logr.Discard())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(mps.Provider().excludeNotReadyKapis).To(BeTrue())
+		})
+
+		It("should pass the average request rate metric setting to the MetricsProvider", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+			flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+			mps.AddCLIFlags(flags)
+			Expect(flags.Parse([]string{"--enable-average-request-rate-metric"})).To(Succeed())
+			idr := fakes.FakeInputDataRegistry{}
+
+			// Act
+			err := mps.CompleteCLIConfiguration(idr.DataSource(), logr.Discard())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(mps.Provider().serveAverageRequestRate).To(BeTrue())
+		})
+
+		It("should fail if the metric naming flags are invalid", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+			flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+			mps.AddCLIFlags(flags)
+			Expect(flags.Parse([]string{"--metric-name-override=no-such-metric=x"})).To(Succeed())
+			idr := fakes.FakeInputDataRegistry{}
+
+			// Act
+			err := mps.CompleteCLIConfiguration(idr.DataSource(), logr.Discard())
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unknown metric name"))
+		})
+	})
+
+	Describe("ValidateCLIConfiguration", func() {
+		It("should accept the default configuration, with the default scrape period", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+
+			// Act & Assert
+			Expect(mps.ValidateCLIConfiguration(time.Minute)).To(Succeed())
+		})
+
+		DescribeTable("should reject configurations which would result in missing metrics",
+			func(args []string, scrapePeriod time.Duration, expectedSubstring string) {
+				// Arrange
+				mps := NewMetricsProviderService()
+				flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+				mps.AddCLIFlags(flags)
+				Expect(flags.Parse(args)).To(Succeed())
+
+				// Act
+				err := mps.ValidateCLIConfiguration(scrapePeriod)
+
+				// Assert
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(expectedSubstring))
+			},
+			Entry("non-positive max sample age", []string{"--max-sample-age=0s"}, time.Minute, "must be positive"),
+			Entry("max sample age less than scrape period",
+				[]string{"--max-sample-age=30s"}, time.Minute, "--max-sample-age option (30s) must not be less"),
+			Entry("max sample gap not greater than scrape period",
+				[]string{"--max-sample-gap=1m"}, time.Minute, "--max-sample-gap option (1m0s) must be greater"),
+			Entry("zero rate window", []string{"--rate-window=0s"}, time.Minute, "--rate-window option (0s) must be"),
+			Entry("fractional rate window",
+				[]string{"--rate-window=1500ms"}, time.Minute, "must be a positive whole number of seconds"),
+			Entry("invalid naming", []string{"--metric-name-override=no-such-metric=x"}, time.Minute, "unknown metric name"),
+			Entry("non-positive short rate window",
+				[]string{"--short-rate-window=0s"}, time.Minute, "--short-rate-window option must be positive"),
+			Entry("long rate window not longer than short one",
+				[]string{"--short-rate-window=1m", "--long-rate-window=1m"}, time.Minute,
+				"--long-rate-window option (1m0s) must be longer"),
+			Entry("negative max inflight requests",
+				[]string{"--max-inflight-requests=-1"}, time.Minute, "--max-inflight-requests option must not be negative"),
+			Entry("negative max result items",
+				[]string{"--max-result-items=-1"}, time.Minute, "--max-result-items option must not be negative"),
+		)
+	})
+
+	Describe("Provider", func() {
+		It("should return the MetricsProvider created by CompleteCLIConfiguration", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+			idr := fakes.FakeInputDataRegistry{}
+			Expect(mps.Provider()).To(BeNil())
+
+			// Act
+			mps.CompleteCLIConfiguration(idr.DataSource(), logr.Discard())
+
+			// Assert
+			Expect(mps.Provider()).NotTo(BeNil())
+			Expect(mps.Provider().dataSource).To(Equal(idr.DataSource()))
+		})
+
+		It("should serve custom metrics through a request auditor, if request auditing is enabled", func() {
+			// Arrange
+			mps := NewMetricsProviderService()
+			registry := prometheus.NewRegistry()
+			mps.auditMetricsRegisterer = registry
+			flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+			mps.AddCLIFlags(flags)
+			Expect(flags.Parse([]string{"--audit-requests"})).To(Succeed())
+			idr := fakes.FakeInputDataRegistry{}
+
+			// Act
+			err := mps.CompleteCLIConfiguration(idr.DataSource(), logr.Discard())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(registry.Unregister(newRequestAuditor(nil, logr.Discard()))).To(BeTrue())
+		})
+	})
 })
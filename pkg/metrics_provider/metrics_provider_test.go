@@ -13,10 +13,11 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
 	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
 
-	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
-	"github.com/gardener/gardener-custom-metrics/pkg/util/testutil"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
 )
 
 var _ = Describe("MetricsProvider", func() {
@@ -38,8 +39,8 @@ var _ = Describe("MetricsProvider", func() {
 	Describe("GetMetricByName", func() {
 		It("should return nothing if there are no Kapis", func() {
 			// Arrange
-			idr := input_data_registry.FakeInputDataRegistry{}
-			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute)
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
 
 			// Act
 			metricValue, err := provider.GetMetricByName(
@@ -52,15 +53,15 @@ var _ = Describe("MetricsProvider", func() {
 
 		It("should return metrics for the Kapi pod specified by the namespaced name", func() {
 			// Arrange
-			idr := input_data_registry.FakeInputDataRegistry{}
-			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute)
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
 			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
 			idr.SetKapiData(testNs, testPodName+"2", "", nil, "")
-			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, testutil.NewTime(1, 0, 0))
-			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, testutil.NewTime(1, 1, 0))
-			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 100, testutil.NewTime(1, 0, 0))
-			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 120, testutil.NewTime(1, 1, 0))
-			provider.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 1, 10)
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, gcmtesting.NewTime(1, 1, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 100, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 120, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
 
 			// Act
 			val, err := provider.GetMetricByName(
@@ -80,15 +81,15 @@ var _ = Describe("MetricsProvider", func() {
 
 		It("should respect maxSampleAge", func() {
 			// Arrange
-			idr := input_data_registry.FakeInputDataRegistry{}
-			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute)
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
 			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
 			idr.SetKapiData(testNs, testPodName+"2", "", nil, "")
-			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, testutil.NewTime(1, 0, 0))
-			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, testutil.NewTime(1, 1, 0))
-			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 10, testutil.NewTime(1, 0, 1))
-			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 20, testutil.NewTime(1, 1, 1))
-			provider.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 2, 31)
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, gcmtesting.NewTime(1, 1, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 10, gcmtesting.NewTime(1, 0, 1))
+			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 20, gcmtesting.NewTime(1, 1, 1))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 2, 31)
 
 			// Act
 			valExpired, errExpired := provider.GetMetricByName(
@@ -104,17 +105,37 @@ var _ = Describe("MetricsProvider", func() {
 			Expect(valStillGood.DescribedObject.Name).To(Equal(testPodName + "2"))
 		})
 
+		It("should scale the request rate to the rate window, and report the rate window as the metric's window", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			provider.SetRateWindow(5 * time.Minute)
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 70, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val.Value.AsApproximateFloat64()).To(Equal(float64(300)))
+			Expect(*val.WindowSeconds).To(Equal(int64(300)))
+		})
+
 		It("should respect maxSampleGap", func() {
 			// Arrange
-			idr := input_data_registry.FakeInputDataRegistry{}
-			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute)
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
 			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
 			idr.SetKapiData(testNs, testPodName+"2", "", nil, "")
-			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, testutil.NewTime(1, 0, 0))
-			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, testutil.NewTime(1, 10, 0))
-			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 10, testutil.NewTime(1, 0, 0))
-			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 20, testutil.NewTime(1, 10, 1))
-			provider.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 11, 0)
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, gcmtesting.NewTime(1, 10, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 20, gcmtesting.NewTime(1, 10, 1))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 11, 0)
 
 			// Act
 			valGood, errGood := provider.GetMetricByName(
@@ -131,11 +152,707 @@ var _ = Describe("MetricsProvider", func() {
 		})
 	})
 
+	Describe("ListAllMetrics", func() {
+		It("should list the request rate, sample age, inflight requests, latency, error ratio, burst, and windowed "+
+			"rate metrics", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+
+			// Act
+			metrics := provider.ListAllMetrics()
+
+			// Assert
+			Expect(metrics).To(HaveLen(8))
+			Expect(metrics[0].Metric).To(Equal(metricName))
+			Expect(metrics[1].Metric).To(Equal(sampleAgeMetricName))
+			Expect(metrics[2].Metric).To(Equal(inflightRequestsMetricName))
+			Expect(metrics[3].Metric).To(Equal(requestLatencyMetricName))
+			Expect(metrics[4].Metric).To(Equal(errorRatioMetricName))
+			Expect(metrics[5].Metric).To(Equal(burstRateMetricName))
+			Expect(metrics[6].Metric).To(Equal(shortRateMetricName))
+			Expect(metrics[7].Metric).To(Equal(longRateMetricName))
+			for _, metric := range metrics {
+				Expect(metric.GroupResource.Resource).To(Equal("pods"))
+				Expect(metric.Namespaced).To(BeTrue())
+			}
+		})
+	})
+
+	Describe("metric naming", func() {
+		It("should list and serve metrics under their overridden names, with the static labels", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			naming := MetricNaming{
+				NameOverrides: map[string]string{metricName: "my_rate"},
+				StaticLabels:  map[string]string{"seed": "my-seed"},
+			}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, naming)
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+			renamedMetricInfo := metricInfo
+			renamedMetricInfo.Metric = "my_rate"
+
+			// Act
+			metrics := provider.ListAllMetrics()
+			val, err := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, renamedMetricInfo, nil)
+			valByDefaultName, errByDefaultName := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+
+			// Assert
+			Expect(metrics[0].Metric).To(Equal("my_rate"))
+			Expect(metrics[1].Metric).To(Equal(sampleAgeMetricName))
+			Expect(err).To(Succeed())
+			Expect(val.Metric.Name).To(Equal("my_rate"))
+			Expect(val.Metric.Selector.MatchLabels).To(Equal(map[string]string{"seed": "my-seed"}))
+			Expect(val.Value.AsApproximateFloat64()).To(Equal(float64(10*1000/60) / 1000))
+			Expect(errByDefaultName).To(Succeed())
+			Expect(valByDefaultName).To(BeNil())
+		})
+	})
+
+	Describe("metric selector", func() {
+		var provider *MetricsProvider
+
+		BeforeEach(func() {
+			idr := &fakes.FakeInputDataRegistry{}
+			naming := MetricNaming{StaticLabels: map[string]string{"seed": "my-seed"}}
+			provider = NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, naming)
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+		})
+
+		DescribeTable("should only return metric values which match the selector",
+			func(selectorText string, isExpectedToMatch bool) {
+				// Arrange
+				selector, err := labels.Parse(selectorText)
+				Expect(err).To(Succeed())
+
+				// Act
+				list, listErr := provider.GetMetricBySelector(
+					context.Background(), testNs, labels.Everything(), metricInfo, selector)
+				val, valErr := provider.GetMetricByName(
+					context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, selector)
+
+				// Assert
+				Expect(listErr).To(Succeed())
+				Expect(valErr).To(Succeed())
+				if isExpectedToMatch {
+					Expect(list.Items).To(HaveLen(1))
+					Expect(val).NotTo(BeNil())
+				} else {
+					Expect(list.Items).To(BeEmpty())
+					Expect(val).To(BeNil())
+				}
+			},
+			Entry("empty selector", "", true),
+			Entry("matching static label", "seed=my-seed", true),
+			Entry("non-matching static label", "seed=other-seed", false),
+			Entry("window shorter than threshold", WindowSecondsLabel+"<120", true),
+			Entry("window longer than threshold", WindowSecondsLabel+"<30", false),
+			Entry("forwarded marker", "!"+ForwardedMarkerLabel, true),
+		)
+
+		It("should exclude values which have no window, if the selector requires a window length", func() {
+			// Arrange
+			selector, err := labels.Parse(WindowSecondsLabel + "<30")
+			Expect(err).To(Succeed())
+			sampleAgeMetricInfo := metricInfo
+			sampleAgeMetricInfo.Metric = sampleAgeMetricName
+
+			// Act
+			list, err := provider.GetMetricBySelector(
+				context.Background(), testNs, labels.Everything(), sampleAgeMetricInfo, selector)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(list.Items).To(BeEmpty())
+		})
+	})
+
+	Describe("single sample estimation", func() {
+		var (
+			// Creates a provider over a Kapi which started at 00:30:00, and served 3600 requests until its only sample,
+			// taken at 01:00:00
+			newTestProvider = func() (*MetricsProvider, *fakes.FakeInputDataRegistry) {
+				idr := &fakes.FakeInputDataRegistry{}
+				provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+				idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+				idr.SetKapiMetricsWithTime(testNs, testPodName, 3600, gcmtesting.NewTime(1, 0, 0))
+				idr.SetKapiProcessStartTime(testNs, testPodName, gcmtesting.NewTime(0, 30, 0))
+				provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 10)
+				return provider, idr
+			}
+			getMetric = func(provider *MetricsProvider) *custom_metrics.MetricValue {
+				val, err := provider.GetMetricByName(
+					context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+				Expect(err).To(Succeed())
+				return val
+			}
+		)
+
+		It("should not estimate the rate, unless enabled", func() {
+			// Arrange
+			provider, _ := newTestProvider()
+
+			// Act
+			val := getMetric(provider)
+
+			// Assert
+			Expect(val).To(BeNil())
+		})
+
+		It("should estimate the rate as the average since the process started, and report the uptime as window", func() {
+			// Arrange
+			provider, _ := newTestProvider()
+			provider.SetSingleSampleEstimation(true)
+
+			// Act
+			val := getMetric(provider)
+
+			// Assert
+			Expect(val.Value.AsApproximateFloat64()).To(Equal(2.0))
+			Expect(*val.WindowSeconds).To(Equal(int64(1800)))
+		})
+
+		It("should not estimate the rate, if the process start time is unknown", func() {
+			// Arrange
+			provider, idr := newTestProvider()
+			provider.SetSingleSampleEstimation(true)
+			idr.SetKapiProcessStartTime(testNs, testPodName, time.Time{})
+
+			// Act
+			val := getMetric(provider)
+
+			// Assert
+			Expect(val).To(BeNil())
+		})
+
+		It("should compute the rate from two samples, once they are available", func() {
+			// Arrange
+			provider, idr := newTestProvider()
+			provider.SetSingleSampleEstimation(true)
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 3660, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+
+			// Act
+			val := getMetric(provider)
+
+			// Assert
+			Expect(val.Value.AsApproximateFloat64()).To(Equal(1.0))
+			Expect(*val.WindowSeconds).To(Equal(int64(60)))
+		})
+	})
+
+	Describe("sample age metric", func() {
+		var (
+			sampleAgeMetricInfo = mxprov.CustomMetricInfo{
+				GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+				Namespaced:    true,
+				Metric:        sampleAgeMetricName,
+			}
+		)
+
+		It("should return the age of the most recent sample", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 15)
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, sampleAgeMetricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Metric.Name).To(Equal(sampleAgeMetricName))
+			Expect(val.Value.AsApproximateFloat64()).To(Equal(float64(15)))
+			Expect(val.WindowSeconds).To(BeNil())
+			Expect(val.Timestamp.Time).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+			Expect(val.DescribedObject.Name).To(Equal(testPodName))
+			Expect(val.DescribedObject.UID).To(Equal(types.UID(testUID)))
+		})
+
+		It("should report the age of samples which are too old to be used for rate calculation", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 5, 0)
+
+			// Act
+			rateVal, rateErr := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+			ageVal, ageErr := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, sampleAgeMetricInfo, nil)
+
+			// Assert
+			Expect(rateErr).To(Succeed())
+			Expect(ageErr).To(Succeed())
+			Expect(rateVal).To(BeNil())
+			Expect(ageVal).NotTo(BeNil())
+			Expect(ageVal.Value.AsApproximateFloat64()).To(Equal(float64(300)))
+		})
+
+		It("should return nothing for Kapis which have no samples yet", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+
+			// Act
+			metricList, err := provider.GetMetricBySelector(
+				context.Background(), testNs, labels.Everything(), sampleAgeMetricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(metricList.Items).To(BeEmpty())
+		})
+	})
+
+	Describe("burst rate metric", func() {
+		var (
+			burstRateMetricInfo = mxprov.CustomMetricInfo{
+				GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+				Namespaced:    true,
+				Metric:        burstRateMetricName,
+			}
+			getBurstRate = func(provider *MetricsProvider) (*custom_metrics.MetricValue, error) {
+				return provider.GetMetricByName(
+					context.Background(),
+					types.NamespacedName{Namespace: testNs, Name: testPodName},
+					burstRateMetricInfo,
+					nil)
+			}
+		)
+
+		It("should return the 95th percentile of the rates over the intervals in the request count history", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			for i, count := range []int64{0, 600, 1200, 7200, 7800} { // 10/s, except for a 100/s burst in the 3rd minute
+				idr.SetKapiMetricsWithTime(testNs, testPodName, count, gcmtesting.NewTime(1, i, 0))
+			}
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 4, 10)
+
+			// Act
+			val, err := getBurstRate(provider)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Metric.Name).To(Equal(burstRateMetricName))
+			Expect(val.Value.MilliValue()).To(Equal(int64(100 * 1000)))
+			Expect(*val.WindowSeconds).To(Equal(int64(240)))
+			Expect(val.Timestamp.Time).To(Equal(gcmtesting.NewTime(1, 4, 0)))
+		})
+
+		It("should only consider the intervals after the most recent gap which exceeds the max sample gap", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 0, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 120000, gcmtesting.NewTime(1, 20, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 120600, gcmtesting.NewTime(1, 21, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 121200, gcmtesting.NewTime(1, 22, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 22, 10)
+
+			// Act
+			val, err := getBurstRate(provider)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Value.MilliValue()).To(Equal(int64(10 * 1000)))
+			Expect(*val.WindowSeconds).To(Equal(int64(120)))
+		})
+
+		It("should return nothing for Kapis with a single sample", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 600, gcmtesting.NewTime(1, 0, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 10)
+
+			// Act
+			val, err := getBurstRate(provider)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).To(BeNil())
+		})
+
+		It("should return nothing, if the request count decreased between the two most recent samples", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 600, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 1200, gcmtesting.NewTime(1, 1, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 300, gcmtesting.NewTime(1, 2, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 2, 10)
+
+			// Act
+			val, err := getBurstRate(provider)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).To(BeNil())
+		})
+	})
+
+	Describe("short and long rate metrics", func() {
+		var (
+			getRate = func(provider *MetricsProvider, metric string) (*custom_metrics.MetricValue, error) {
+				return provider.GetMetricByName(
+					context.Background(),
+					types.NamespacedName{Namespace: testNs, Name: testPodName},
+					mxprov.CustomMetricInfo{
+						GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+						Namespaced:    true,
+						Metric:        metric,
+					},
+					nil)
+			}
+			// Creates a provider over a Kapi scraped every 10 seconds for 10 minutes, at 10 requests/s, except for the
+			// last 30 seconds, at 40 requests/s
+			newTestProvider = func() *MetricsProvider {
+				idr := fakes.FakeInputDataRegistry{}
+				provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+				idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+				count := int64(0)
+				for second := 0; second <= 600; second += 10 {
+					idr.SetKapiMetricsWithTime(testNs, testPodName, count, gcmtesting.NewTime(1, 0, second))
+					if second < 570 {
+						count += 100
+					} else {
+						count += 400
+					}
+				}
+				provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 10, 5)
+				return provider
+			}
+		)
+
+		It("should serve the rate over the short window", func() {
+			// Arrange
+			provider := newTestProvider()
+
+			// Act
+			val, err := getRate(provider, shortRateMetricName)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Value.MilliValue()).To(Equal(int64(40 * 1000)))
+			Expect(*val.WindowSeconds).To(Equal(int64(30)))
+			Expect(val.Timestamp.Time).To(Equal(gcmtesting.NewTime(1, 10, 0)))
+		})
+
+		It("should serve the rate over as much of the long window as the retained samples reach", func() {
+			// Arrange
+			provider := newTestProvider()
+
+			// Act
+			val, err := getRate(provider, longRateMetricName)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			// The 10 retained samples span 90 seconds: 60 at 10/s, and 30 at 40/s
+			Expect(val.Value.MilliValue()).To(Equal(int64(20 * 1000)))
+			Expect(*val.WindowSeconds).To(Equal(int64(90)))
+		})
+
+		It("should use the configured windows", func() {
+			// Arrange
+			provider := newTestProvider()
+			provider.SetRequestRateWindows(20*time.Second, time.Minute)
+
+			// Act
+			shortVal, shortErr := getRate(provider, shortRateMetricName)
+			longVal, longErr := getRate(provider, longRateMetricName)
+
+			// Assert
+			Expect(shortErr).To(Succeed())
+			Expect(*shortVal.WindowSeconds).To(Equal(int64(20)))
+			Expect(longErr).To(Succeed())
+			Expect(*longVal.WindowSeconds).To(Equal(int64(60)))
+			Expect(longVal.Value.MilliValue()).To(Equal(int64(25 * 1000)))
+		})
+
+		It("should fall back to the two most recent samples, if they are further apart than the window", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 0, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 600, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+
+			// Act
+			val, err := getRate(provider, shortRateMetricName)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Value.MilliValue()).To(Equal(int64(10 * 1000)))
+			Expect(*val.WindowSeconds).To(Equal(int64(60)))
+		})
+
+		It("should not reach back past a counter reset", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			for i, count := range []int64{5000, 5600, 0, 600, 1200} {
+				idr.SetKapiMetricsWithTime(testNs, testPodName, count, gcmtesting.NewTime(1, i, 0))
+			}
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 4, 10)
+
+			// Act
+			val, err := getRate(provider, longRateMetricName)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Value.MilliValue()).To(Equal(int64(10 * 1000)))
+			Expect(*val.WindowSeconds).To(Equal(int64(120)))
+		})
+
+		It("should return nothing for Kapis with a single sample", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 600, gcmtesting.NewTime(1, 0, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 10)
+
+			// Act
+			val, err := getRate(provider, shortRateMetricName)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).To(BeNil())
+		})
+
+		It("should not span a change of the extra metrics URLs, nor should the burst rate", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 0, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 600, gcmtesting.NewTime(1, 1, 0))
+			// The extra URL adds its own counters to the sum, which would look like a jump of 100000 requests
+			idr.SetKapiExtraMetricsUrls(testNs, testPodName, []string{"https://10.0.0.1:9443/metrics"})
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 101200, gcmtesting.NewTime(1, 2, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 2, 10)
+			metrics := []string{shortRateMetricName, longRateMetricName, burstRateMetricName}
+
+			// Act and assert
+			for _, metric := range metrics {
+				val, err := getRate(provider, metric)
+				Expect(err).To(Succeed())
+				Expect(val).To(BeNil(), metric)
+			}
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 101800, gcmtesting.NewTime(1, 3, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 3, 10)
+			for _, metric := range metrics {
+				val, err := getRate(provider, metric)
+				Expect(err).To(Succeed())
+				Expect(val).NotTo(BeNil(), metric)
+				Expect(val.Value.MilliValue()).To(Equal(int64(10*1000)), metric)
+			}
+		})
+	})
+
+	Describe("error ratio metric", func() {
+		var (
+			errorRatioMetricInfo = mxprov.CustomMetricInfo{
+				GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+				Namespaced:    true,
+				Metric:        errorRatioMetricName,
+			}
+		)
+
+		It("should return the fraction of the requests between the two most recent samples, which failed", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiErrorCountsWithTime(testNs, testPodName, 1000, 20, 5, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiErrorCountsWithTime(testNs, testPodName, 1200, 30, 15, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(),
+				types.NamespacedName{Namespace: testNs, Name: testPodName},
+				errorRatioMetricInfo,
+				nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Metric.Name).To(Equal(errorRatioMetricName))
+			Expect(val.Value.MilliValue()).To(Equal(int64(100)))
+			Expect(*val.WindowSeconds).To(Equal(int64(60)))
+			Expect(val.Timestamp.Time).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+		})
+
+		It("should return nothing if no requests were served between the two most recent samples", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiErrorCountsWithTime(testNs, testPodName, 1000, 20, 5, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiErrorCountsWithTime(testNs, testPodName, 1000, 20, 5, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+
+			// Act
+			metricList, err := provider.GetMetricBySelector(
+				context.Background(), testNs, labels.Everything(), errorRatioMetricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(metricList.Items).To(BeEmpty())
+		})
+	})
+
+	Describe("request latency metric", func() {
+		var (
+			latencyMetricInfo = mxprov.CustomMetricInfo{
+				GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+				Namespaced:    true,
+				Metric:        requestLatencyMetricName,
+			}
+		)
+
+		It("should return the average latency of the requests served between the two most recent samples", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiRequestDurationWithTime(testNs, testPodName, 100, 1000, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiRequestDurationWithTime(testNs, testPodName, 110, 1040, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, latencyMetricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Metric.Name).To(Equal(requestLatencyMetricName))
+			Expect(val.Value.MilliValue()).To(Equal(int64(250)))
+			Expect(*val.WindowSeconds).To(Equal(int64(60)))
+			Expect(val.Timestamp.Time).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+			Expect(val.DescribedObject.UID).To(Equal(types.UID(testUID)))
+		})
+
+		It("should return nothing if no requests were served between the two most recent samples", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiRequestDurationWithTime(testNs, testPodName, 100, 1000, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiRequestDurationWithTime(testNs, testPodName, 100, 1000, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, latencyMetricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).To(BeNil())
+		})
+	})
+
+	Describe("inflight requests metric", func() {
+		var (
+			inflightMetricInfo = mxprov.CustomMetricInfo{
+				GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+				Namespaced:    true,
+				Metric:        inflightRequestsMetricName,
+			}
+		)
+
+		It("should return the most recent inflight request count", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiInflightRequestsWithTime(testNs, testPodName, 5, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiInflightRequestsWithTime(testNs, testPodName, 13, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 15)
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, inflightMetricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).NotTo(BeNil())
+			Expect(val.Metric.Name).To(Equal(inflightRequestsMetricName))
+			Expect(val.Value.Value()).To(Equal(int64(13)))
+			Expect(val.WindowSeconds).To(BeNil())
+			Expect(val.Timestamp.Time).To(Equal(gcmtesting.NewTime(1, 1, 0)))
+			Expect(val.DescribedObject.UID).To(Equal(types.UID(testUID)))
+		})
+
+		It("should respect maxSampleAge", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+			idr.SetKapiInflightRequestsWithTime(testNs, testPodName, 13, gcmtesting.NewTime(1, 0, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 31)
+
+			// Act
+			val, err := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, inflightMetricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(val).To(BeNil())
+		})
+
+		It("should return nothing for Kapis which have no samples yet", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			idr.SetKapiData(testNs, testPodName, testUID, nil, "")
+
+			// Act
+			metricList, err := provider.GetMetricBySelector(
+				context.Background(), testNs, labels.Everything(), inflightMetricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(metricList.Items).To(BeEmpty())
+		})
+	})
+
 	Describe("GetMetricBySelector", func() {
 		It("should return nothing if there are no Kapis", func() {
 			// Arrange
-			idr := input_data_registry.FakeInputDataRegistry{}
-			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute)
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
 
 			// Act
 			metricValue, err := provider.GetMetricBySelector(
@@ -149,15 +866,15 @@ var _ = Describe("MetricsProvider", func() {
 
 		It("should return only metrics for Kapi pods which match the selector", func() {
 			// Arrange
-			idr := input_data_registry.FakeInputDataRegistry{}
-			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute)
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
 			idr.SetKapiData(testNs, testPodName, testUID, map[string]string{testLabel: testLabelValue}, "")
 			idr.SetKapiData(testNs, testPodName+"2", "", nil, "")
-			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, testutil.NewTime(1, 0, 0))
-			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, testutil.NewTime(1, 1, 0))
-			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 10, testutil.NewTime(1, 0, 0))
-			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 20, testutil.NewTime(1, 1, 0))
-			provider.testIsolation.TimeNow = testutil.NewTimeNowStub(1, 2, 0)
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, gcmtesting.NewTime(1, 1, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName+"2", 20, gcmtesting.NewTime(1, 1, 0))
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 2, 0)
 			podSelector, _ := labels.Parse(testLabel + "=" + testLabelValue)
 
 			// Act
@@ -178,4 +895,98 @@ var _ = Describe("MetricsProvider", func() {
 			Expect(val.DescribedObject.Kind).To(Equal("Pod"))
 		})
 	})
+
+	Describe("SetNotReadyKapiExclusion", func() {
+		var (
+			// Creates a provider over two Kapis with usable samples, of which the second one is not ready
+			newTestProvider = func() *MetricsProvider {
+				idr := &fakes.FakeInputDataRegistry{}
+				for _, podName := range []string{testPodName, testPodName + "2"} {
+					idr.SetKapiData(testNs, podName, "", nil, "")
+					idr.SetKapiMetricsWithTime(testNs, podName, 10, gcmtesting.NewTime(1, 0, 0))
+					idr.SetKapiMetricsWithTime(testNs, podName, 20, gcmtesting.NewTime(1, 1, 0))
+				}
+				idr.SetKapiReady(testNs, testPodName+"2", false)
+				provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+				provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 2, 0)
+				return provider
+			}
+		)
+
+		It("should serve the metrics of Kapis which are not ready, unless enabled", func() {
+			// Arrange
+			provider := newTestProvider()
+
+			// Act
+			metricList, err := provider.GetMetricBySelector(
+				context.Background(), testNs, labels.Everything(), metricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(metricList.Items).To(HaveLen(2))
+		})
+
+		It("should leave the Kapis which are not ready out of selector queries, if enabled", func() {
+			// Arrange
+			provider := newTestProvider()
+			provider.SetNotReadyKapiExclusion(true)
+
+			// Act
+			metricList, err := provider.GetMetricBySelector(
+				context.Background(), testNs, labels.Everything(), metricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(metricList.Items).To(HaveLen(1))
+			Expect(metricList.Items[0].DescribedObject.Name).To(Equal(testPodName))
+		})
+
+		It("should not serve the metrics of a Kapi which is not ready, when requested by name, if enabled", func() {
+			// Arrange
+			provider := newTestProvider()
+			provider.SetNotReadyKapiExclusion(true)
+
+			// Act
+			metricValue, err := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName + "2"}, metricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(metricValue).To(BeNil())
+		})
+	})
+
+	Describe("SetQueryObserver", func() {
+		It("should notify the observer of the namespace of each request", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			var observed []string
+			provider.SetQueryObserver(func(namespace string) { observed = append(observed, namespace) })
+
+			// Act
+			_, _ = provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+			_, _ = provider.GetMetricBySelector(context.Background(), "shoot--other", labels.Everything(), metricInfo, nil)
+
+			// Assert
+			Expect(observed).To(Equal([]string{testNs, "shoot--other"}))
+		})
+
+		It("should not notify the observer of requests made without query observation", func() {
+			// Arrange
+			idr := fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			var observed []string
+			provider.SetQueryObserver(func(namespace string) { observed = append(observed, namespace) })
+			ctx := WithoutQueryObservation(context.Background())
+
+			// Act
+			_, _ = provider.GetMetricByName(ctx, types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+			_, _ = provider.GetMetricBySelector(ctx, "shoot--other", labels.Everything(), metricInfo, nil)
+
+			// Assert
+			Expect(observed).To(BeEmpty())
+		})
+	})
 })
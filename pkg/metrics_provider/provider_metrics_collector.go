@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// ProviderMetricsPath is the path, on the controller manager's metrics server, at which the values served by the
+// MetricsProvider are exposed in Prometheus format
+const ProviderMetricsPath = "/provider-metrics"
+
+// ProviderMetricsCollector is a [prometheus.Collector] which exposes the values currently served by a MetricsProvider,
+// so they can be compared with what Prometheus scrapes from the shoots. Each value becomes a gauge with the same name as
+// the served metric, labeled with the namespace and the name of the object which the value describes, and with the
+// static labels of the served metric. The object name is the value of the "pod" label, or, for values which describe a
+// Deployment, of the "deployment" label. The other one of the two labels is empty.
+//
+// In sharded mode, only the values for namespaces owned by this replica are exposed.
+//
+// ProviderMetricsCollector implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable]. While it runs, it tracks
+// the shoot namespaces which contain Kapis. It collects no values before it is started.
+type ProviderMetricsCollector struct {
+	metricsProvider *MetricsProvider
+	log             logr.Logger
+
+	// Maps <shoot namespace> -> <number of Kapis in that namespace>
+	namespaces map[string]int
+	lock       sync.Mutex // Synchronises access to namespaces
+}
+
+// NewProviderMetricsCollector creates a ProviderMetricsCollector which exposes the values served by metricsProvider
+func NewProviderMetricsCollector(metricsProvider *MetricsProvider, parentLogger logr.Logger) *ProviderMetricsCollector {
+	return &ProviderMetricsCollector{
+		metricsProvider: metricsProvider,
+		log:             parentLogger.WithName("provider-metrics"),
+		namespaces:      make(map[string]int),
+	}
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It tracks the shoot namespaces which
+// contain Kapis, until the context is cancelled.
+func (c *ProviderMetricsCollector) Start(ctx context.Context) error {
+	c.log.V(app.VerbosityVerbose).Info("Provider metrics collector started", "path", ProviderMetricsPath)
+
+	var watcher input_data_registry.KapiWatcher = c.onKapiUpdated
+	c.metricsProvider.dataSource.AddKapiWatcher(&watcher, true)
+	defer c.metricsProvider.dataSource.RemoveKapiWatcher(&watcher)
+
+	<-ctx.Done()
+	c.log.V(app.VerbosityInfo).Info("Context closed, exiting")
+	return nil
+}
+
+// onKapiUpdated is a [input_data_registry.KapiWatcher] which tracks the shoot namespaces containing Kapis
+func (c *ProviderMetricsCollector) onKapiUpdated(
+	kapi input_data_registry.ShootKapi, event input_data_registry.KapiEventType) {
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch event {
+	case input_data_registry.KapiEventCreate:
+		c.namespaces[kapi.ShootNamespace()]++
+	case input_data_registry.KapiEventDelete:
+		c.namespaces[kapi.ShootNamespace()]--
+		if c.namespaces[kapi.ShootNamespace()] <= 0 {
+			delete(c.namespaces, kapi.ShootNamespace())
+		}
+	}
+}
+
+// getNamespaces returns the shoot namespaces which currently contain Kapis, in alphabetical order
+func (c *ProviderMetricsCollector) getNamespaces() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	result := make([]string, 0, len(c.namespaces))
+	for namespace := range c.namespaces {
+		result = append(result, namespace)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Describe implements [prometheus.Collector.Describe]. The set of exposed series depends on the shoots present at
+// collection time, so the collector describes nothing, which makes it an unchecked collector.
+func (c *ProviderMetricsCollector) Describe(_ chan<- *prometheus.Desc) {
+}
+
+// Collect implements [prometheus.Collector.Collect]. It sends a gauge for each value currently served by the
+// MetricsProvider.
+func (c *ProviderMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, namespace := range c.getNamespaces() {
+		for _, metricInfo := range c.metricsProvider.ListAllMetrics() {
+			// Mark the request as forwarded, so it is served from local data, even in sharded mode. It does not count as
+			// a query of the shoot's metrics.
+			values, err := c.metricsProvider.GetMetricBySelector(
+				WithoutQueryObservation(context.Background()),
+				namespace,
+				labels.Everything(),
+				metricInfo,
+				MarkForwarded(labels.Everything()))
+			if err != nil {
+				c.log.V(app.VerbosityError).Error(
+					err, "Failed to collect metric", "metric", metricInfo.Metric, "namespace", namespace)
+				continue
+			}
+
+			for _, value := range values.Items {
+				// Static labels configured on the provider are carried by the metric selector
+				// Pod and Deployment values of the same metric share a metric family, so they carry the same labels
+				constLabels := prometheus.Labels{
+					"namespace":  value.DescribedObject.Namespace,
+					"pod":        "",
+					"deployment": "",
+				}
+				if value.DescribedObject.Kind == "Deployment" {
+					constLabels["deployment"] = value.DescribedObject.Name
+				} else {
+					constLabels["pod"] = value.DescribedObject.Name
+				}
+				if value.Metric.Selector != nil {
+					for name, labelValue := range value.Metric.Selector.MatchLabels {
+						constLabels[name] = labelValue
+					}
+				}
+				desc := prometheus.NewDesc(
+					metricInfo.Metric, "Value currently served by the custom metrics API", nil, constLabels)
+				metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, value.Value.AsApproximateFloat64())
+				if err != nil {
+					metric = prometheus.NewInvalidMetric(desc, err)
+				}
+				ch <- metric
+			}
+		}
+	}
+}
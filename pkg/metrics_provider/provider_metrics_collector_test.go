@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("ProviderMetricsCollector", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "my-pod"
+	)
+
+	var (
+		// Creates a collector over a provider with one Kapi, which has a request rate of 1/s
+		newTestCollector = func(naming MetricNaming) (*ProviderMetricsCollector, *fakes.FakeInputDataRegistry) {
+			idr := &fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, naming)
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+			idr.SetKapiData(testNs, testPodName, "", nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 70, gcmtesting.NewTime(1, 1, 0))
+			return NewProviderMetricsCollector(provider, logr.Discard()), idr
+		}
+
+		// Gathers the metrics exposed by the collector, keyed by metric name
+		gather = func(collector *ProviderMetricsCollector) map[string]*dto.MetricFamily {
+			registry := prometheus.NewRegistry()
+			Expect(registry.Register(collector)).To(Succeed())
+			families, err := registry.Gather()
+			Expect(err).To(Succeed())
+			result := make(map[string]*dto.MetricFamily)
+			for _, family := range families {
+				result[family.GetName()] = family
+			}
+			return result
+		}
+
+		// Returns the labels of the specified metric, as a map
+		labelMap = func(metric *dto.Metric) map[string]string {
+			result := make(map[string]string)
+			for _, pair := range metric.GetLabel() {
+				result[pair.GetName()] = pair.GetValue()
+			}
+			return result
+		}
+	)
+
+	Describe("Collect", func() {
+		It("should expose nothing before any Kapis are known", func() {
+			// Arrange
+			collector, _ := newTestCollector(MetricNaming{})
+
+			// Act
+			families := gather(collector)
+
+			// Assert
+			Expect(families).To(BeEmpty())
+		})
+
+		It("should expose each served value as a gauge, labeled with namespace and pod", func() {
+			// Arrange
+			collector, idr := newTestCollector(MetricNaming{})
+			collector.onKapiUpdated(idr.DataSource().GetShootKapis(testNs)[0], input_data_registry.KapiEventCreate)
+
+			// Act
+			families := gather(collector)
+
+			// Assert
+			Expect(families).To(HaveKey(metricName))
+			Expect(families[metricName].GetType()).To(Equal(dto.MetricType_GAUGE))
+			Expect(families[metricName].GetMetric()).To(HaveLen(1))
+			metric := families[metricName].GetMetric()[0]
+			Expect(metric.GetGauge().GetValue()).To(Equal(1.0))
+			Expect(labelMap(metric)).To(Equal(map[string]string{"namespace": testNs, "pod": testPodName, "deployment": ""}))
+			Expect(families).To(HaveKey(sampleAgeMetricName))
+			Expect(families[sampleAgeMetricName].GetMetric()[0].GetGauge().GetValue()).To(Equal(10.0))
+		})
+
+		It("should not report the collection to the provider's query observer", func() {
+			// Arrange
+			collector, idr := newTestCollector(MetricNaming{})
+			collector.onKapiUpdated(idr.DataSource().GetShootKapis(testNs)[0], input_data_registry.KapiEventCreate)
+			var observed []string
+			collector.metricsProvider.SetQueryObserver(func(namespace string) { observed = append(observed, namespace) })
+
+			// Act
+			families := gather(collector)
+
+			// Assert
+			Expect(families).To(HaveKey(metricName))
+			Expect(observed).To(BeEmpty())
+		})
+
+		It("should use the served metric names and static labels", func() {
+			// Arrange
+			naming := MetricNaming{
+				NameOverrides: map[string]string{metricName: "my:metric"},
+				StaticLabels:  map[string]string{"cluster": "my-seed"},
+			}
+			collector, idr := newTestCollector(naming)
+			collector.onKapiUpdated(idr.DataSource().GetShootKapis(testNs)[0], input_data_registry.KapiEventCreate)
+
+			// Act
+			families := gather(collector)
+
+			// Assert
+			Expect(families).To(HaveKey("my:metric"))
+			Expect(families).NotTo(HaveKey(metricName))
+			Expect(labelMap(families["my:metric"].GetMetric()[0])).To(Equal(
+				map[string]string{"namespace": testNs, "pod": testPodName, "deployment": "", "cluster": "my-seed"}))
+		})
+
+		It("should label the values which describe a Deployment with the deployment name, rather than a pod name", func() {
+			// Arrange
+			idr := &fakes.FakeInputDataRegistry{}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+			kapiLabels := map[string]string{"app": "kubernetes"}
+			idr.SetKapiData(testNs, testPodName, "", kapiLabels, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 70, gcmtesting.NewTime(1, 1, 0))
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: "kube-apiserver"},
+				Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: kapiLabels}},
+			}
+			provider.SetDeploymentSource(NewClientDeploymentSource(fake.NewClientBuilder().WithObjects(deployment).Build()))
+			collector := NewProviderMetricsCollector(provider, logr.Discard())
+			collector.onKapiUpdated(idr.DataSource().GetShootKapis(testNs)[0], input_data_registry.KapiEventCreate)
+
+			// Act
+			families := gather(collector)
+
+			// Assert
+			Expect(families).To(HaveKey(metricName))
+			var labelSets []map[string]string
+			for _, metric := range families[metricName].GetMetric() {
+				labelSets = append(labelSets, labelMap(metric))
+			}
+			Expect(labelSets).To(ConsistOf(
+				map[string]string{"namespace": testNs, "pod": testPodName, "deployment": ""},
+				map[string]string{"namespace": testNs, "pod": "", "deployment": "kube-apiserver"}))
+		})
+
+		It("should stop exposing values for a namespace, once its last Kapi is deleted", func() {
+			// Arrange
+			collector, idr := newTestCollector(MetricNaming{})
+			kapi := idr.DataSource().GetShootKapis(testNs)[0]
+			collector.onKapiUpdated(kapi, input_data_registry.KapiEventCreate)
+			collector.onKapiUpdated(kapi, input_data_registry.KapiEventDelete)
+
+			// Act
+			families := gather(collector)
+
+			// Assert
+			Expect(families).To(BeEmpty())
+		})
+	})
+
+	Describe("Start", func() {
+		It("should watch the data source until the context is cancelled", func() {
+			// Arrange
+			collector, idr := newTestCollector(MetricNaming{})
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+
+			// Act
+			go func() { done <- collector.Start(ctx) }()
+
+			// Assert
+			Eventually(idr.GetWatcher).ShouldNot(BeNil())
+			Expect(idr.ShouldWatcherNotifyOfPreexisting).To(BeTrue())
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(idr.GetWatcher()).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+const (
+	// The user label value of requests which carry no user identity
+	anonymousUser = "<anonymous>"
+	// The namespace label value of requests for root-scoped objects
+	noNamespace = "<none>"
+)
+
+// requestAuditor is a [provider.CustomMetricsProvider] which passes requests through to another provider, and records
+// who requests which metric, for which namespace, and how long it takes to serve the request. Each request is logged,
+// and counted in Prometheus metrics.
+//
+// The client identity is the user on whose behalf the request was made. For requests which arrive via the
+// aggregated API, that is the user which the kube-apiserver authenticated, as passed on via its request header
+// authentication, e.g. the horizontal pod autoscaler's service account.
+//
+// requestAuditor implements [prometheus.Collector], exposing the metrics it maintains.
+type requestAuditor struct {
+	provider.CustomMetricsProvider
+	log logr.Logger
+
+	requestCount    *prometheus.CounterVec   // Labels: user, namespace, metric, result
+	requestDuration *prometheus.HistogramVec // Labels: metric
+
+	testIsolation requestAuditorTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// newRequestAuditor creates a requestAuditor which passes requests through to the specified provider
+func newRequestAuditor(inner provider.CustomMetricsProvider, log logr.Logger) *requestAuditor {
+	return &requestAuditor{
+		CustomMetricsProvider: inner,
+		log:                   log,
+		requestCount: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gardener_custom_metrics_api_requests_total",
+				Help: "Number of custom metrics API requests, by client identity, namespace, metric, and result",
+			},
+			[]string{"user", "namespace", "metric", "result"}),
+		requestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "gardener_custom_metrics_api_request_duration_seconds",
+				Help:    "Time taken to serve custom metrics API requests, by metric",
+				Buckets: prometheus.ExponentialBuckets(0.0005, 4, 8),
+			},
+			[]string{"metric"}),
+		testIsolation: requestAuditorTestIsolation{TimeNow: time.Now},
+	}
+}
+
+// GetMetricByName implements [provider.CustomMetricsProvider.GetMetricByName].
+func (ra *requestAuditor) GetMetricByName(
+	ctx context.Context,
+	name types.NamespacedName,
+	metricInfo provider.CustomMetricInfo,
+	metricSelector labels.Selector) (*custom_metrics.MetricValue, error) {
+
+	startTime := ra.testIsolation.TimeNow()
+	result, err := ra.CustomMetricsProvider.GetMetricByName(ctx, name, metricInfo, metricSelector)
+	resultCount := 0
+	if result != nil {
+		resultCount = 1
+	}
+	ra.record(ctx, name.Namespace, metricInfo, startTime, resultCount, err, "pod", name.Name)
+	return result, err
+}
+
+// GetMetricBySelector implements [provider.CustomMetricsProvider.GetMetricBySelector].
+func (ra *requestAuditor) GetMetricBySelector(
+	ctx context.Context,
+	namespace string,
+	podSelector labels.Selector,
+	metricInfo provider.CustomMetricInfo,
+	metricSelector labels.Selector) (*custom_metrics.MetricValueList, error) {
+
+	startTime := ra.testIsolation.TimeNow()
+	result, err := ra.CustomMetricsProvider.GetMetricBySelector(ctx, namespace, podSelector, metricInfo, metricSelector)
+	resultCount := 0
+	if result != nil {
+		resultCount = len(result.Items)
+	}
+	ra.record(ctx, namespace, metricInfo, startTime, resultCount, err, "selector", podSelector.String())
+	return result, err
+}
+
+// record logs a request which started at startTime and has just completed, and counts it in the metrics. The
+// keysAndValues are added to the log entry.
+func (ra *requestAuditor) record(
+	ctx context.Context,
+	namespace string,
+	metricInfo provider.CustomMetricInfo,
+	startTime time.Time,
+	resultCount int,
+	err error,
+	keysAndValues ...any) {
+
+	duration := ra.testIsolation.TimeNow().Sub(startTime)
+	userName, groups := anonymousUser, []string(nil)
+	if user, ok := genericapirequest.UserFrom(ctx); ok && user.GetName() != "" {
+		userName, groups = user.GetName(), user.GetGroups()
+	}
+	namespaceLabel := namespace
+	if namespaceLabel == "" {
+		namespaceLabel = noNamespace
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	ra.requestCount.WithLabelValues(userName, namespaceLabel, metricInfo.Metric, result).Inc()
+	ra.requestDuration.WithLabelValues(metricInfo.Metric).Observe(duration.Seconds())
+
+	log := ra.log.WithValues(keysAndValues...)
+	log = log.WithValues(
+		"user", userName, "groups", groups, "namespace", namespace, "metric", metricInfo.Metric,
+		"resultCount", resultCount, "duration", duration)
+	if err != nil {
+		log.V(app.VerbosityInfo).Info("Custom metrics API request failed", "error", err.Error())
+		return
+	}
+	log.V(app.VerbosityInfo).Info("Custom metrics API request served")
+}
+
+// Describe implements [prometheus.Collector.Describe].
+func (ra *requestAuditor) Describe(ch chan<- *prometheus.Desc) {
+	ra.requestCount.Describe(ch)
+	ra.requestDuration.Describe(ch)
+}
+
+// Collect implements [prometheus.Collector.Collect].
+func (ra *requestAuditor) Collect(ch chan<- prometheus.Metric) {
+	ra.requestCount.Collect(ch)
+	ra.requestDuration.Collect(ch)
+}
+
+//#region Test isolation
+
+// requestAuditorTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the requestAuditor unit during tests
+type requestAuditorTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+}
+
+//#endregion Test isolation
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+// failingMetricsProvider is a [mxprov.CustomMetricsProvider] which fails all requests
+type failingMetricsProvider struct {
+	mxprov.CustomMetricsProvider
+}
+
+func (p *failingMetricsProvider) GetMetricByName(
+	context.Context, types.NamespacedName, mxprov.CustomMetricInfo, labels.Selector) (*custom_metrics.MetricValue, error) {
+
+	return nil, errors.New("test error")
+}
+
+var _ = Describe("requestAuditor", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "my-pod"
+		testUser    = "system:serviceaccount:kube-system:horizontal-pod-autoscaler"
+	)
+	var (
+		metricInfo = mxprov.CustomMetricInfo{
+			GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+			Namespaced:    true,
+			Metric:        metricName,
+		}
+
+		// newTestAuditor returns an auditor around a provider which serves the request rate for testPodName
+		newTestAuditor = func() *requestAuditor {
+			idr := &fakes.FakeInputDataRegistry{}
+			idr.SetKapiData(testNs, testPodName, "", nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 20, gcmtesting.NewTime(1, 1, 0))
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+			return newRequestAuditor(provider, logr.Discard())
+		}
+	)
+
+	It("should pass requests through to the inner provider", func() {
+		// Arrange
+		auditor := newTestAuditor()
+
+		// Act
+		byName, errByName := auditor.GetMetricByName(
+			context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+		bySelector, errBySelector := auditor.GetMetricBySelector(
+			context.Background(), testNs, labels.Everything(), metricInfo, nil)
+		all := auditor.ListAllMetrics()
+
+		// Assert
+		Expect(errByName).To(Succeed())
+		Expect(errBySelector).To(Succeed())
+		Expect(byName.DescribedObject.Name).To(Equal(testPodName))
+		Expect(bySelector.Items).To(HaveLen(1))
+		Expect(all).NotTo(BeEmpty())
+	})
+
+	It("should count requests by client identity, namespace, metric, and result", func() {
+		// Arrange
+		auditor := newTestAuditor()
+		ctx := genericapirequest.WithUser(context.Background(), &user.DefaultInfo{Name: testUser})
+
+		// Act
+		auditor.GetMetricBySelector(ctx, testNs, labels.Everything(), metricInfo, nil)
+		auditor.GetMetricByName(ctx, types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+		auditor.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+
+		// Assert
+		Expect(promtestutil.ToFloat64(
+			auditor.requestCount.WithLabelValues(testUser, testNs, metricName, "success"))).To(Equal(float64(2)))
+		Expect(promtestutil.ToFloat64(
+			auditor.requestCount.WithLabelValues(anonymousUser, testNs, metricName, "success"))).To(Equal(float64(1)))
+		Expect(promtestutil.CollectAndCount(auditor, "gardener_custom_metrics_api_request_duration_seconds")).
+			To(Equal(1))
+	})
+
+	It("should count failed requests as errors", func() {
+		// Arrange
+		auditor := newRequestAuditor(&failingMetricsProvider{}, logr.Discard())
+
+		// Act
+		_, err := auditor.GetMetricByName(
+			context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+		Expect(promtestutil.ToFloat64(
+			auditor.requestCount.WithLabelValues(anonymousUser, testNs, metricName, "error"))).To(Equal(float64(1)))
+	})
+})
@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"fmt"
+
+	apidiscoveryv2beta1 "k8s.io/api/apidiscovery/v2beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/managedfields"
+	genericapi "k8s.io/apiserver/pkg/endpoints"
+	"k8s.io/apiserver/pkg/endpoints/discovery"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/metrics/pkg/apis/metrics"
+	metricsinstall "k8s.io/metrics/pkg/apis/metrics/install"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/apiserver"
+)
+
+// installResourceMetricsAPI adds the metrics.k8s.io API group to the specified server, serving the pods resource
+// based on the specified provider. The server must use the custom metrics adapter's scheme and codecs.
+//
+// The installation mimics what [apiserver.CustomMetricsAdapterServer] does for the custom metrics API, because the
+// adapter's OpenAPI definitions do not cover the metrics.k8s.io types, which rules out
+// [genericapiserver.GenericAPIServer.InstallAPIGroup].
+func installResourceMetricsAPI(server *genericapiserver.GenericAPIServer, provider *ResourceMetricsProvider) error {
+	metricsinstall.Install(apiserver.Scheme)
+
+	groupVersion := metricsv1beta1.SchemeGroupVersion
+	apiGroupVersion := &genericapi.APIGroupVersion{
+		Root:         genericapiserver.APIGroupPrefix,
+		GroupVersion: groupVersion,
+		Storage:      map[string]rest.Storage{"pods": newPodMetricsStorage(provider)},
+
+		ParameterCodec:  runtime.NewParameterCodec(apiserver.Scheme),
+		Serializer:      apiserver.Codecs,
+		Creater:         apiserver.Scheme,
+		Convertor:       apiserver.Scheme,
+		UnsafeConvertor: runtime.UnsafeObjectConvertor(apiserver.Scheme),
+		Typer:           apiserver.Scheme,
+		Namer:           runtime.Namer(meta.NewAccessor()),
+
+		EquivalentResourceRegistry: server.EquivalentResourceRegistry,
+		// The resource is read-only, so field management is irrelevant, but the installer requires a type converter
+		TypeConverter: managedfields.NewDeducedTypeConverter(),
+	}
+	container := server.Handler.GoRestfulContainer
+	discoveryResources, _, err := apiGroupVersion.InstallREST(container)
+	if err != nil {
+		return fmt.Errorf("installing the %s REST handlers: %w", groupVersion, err)
+	}
+
+	discoveryVersion := metav1.GroupVersionForDiscovery{
+		GroupVersion: groupVersion.String(),
+		Version:      groupVersion.Version,
+	}
+	apiGroup := metav1.APIGroup{
+		Name:             groupVersion.Group,
+		Versions:         []metav1.GroupVersionForDiscovery{discoveryVersion},
+		PreferredVersion: discoveryVersion,
+	}
+	server.DiscoveryGroupManager.AddGroup(apiGroup)
+	container.Add(discovery.NewAPIGroupHandler(server.Serializer, apiGroup).WebService())
+	if server.AggregatedDiscoveryGroupManager != nil {
+		server.AggregatedDiscoveryGroupManager.AddGroupVersion(groupVersion.Group, apidiscoveryv2beta1.APIVersionDiscovery{
+			Freshness: apidiscoveryv2beta1.DiscoveryFreshnessCurrent,
+			Version:   groupVersion.Version,
+			Resources: discoveryResources,
+		})
+	}
+
+	return nil
+}
+
+// podMetricsStorage implements the read-only REST storage of the pods resource in the metrics.k8s.io API, on top of
+// a ResourceMetricsProvider
+type podMetricsStorage struct {
+	rest.TableConvertor
+	provider *ResourceMetricsProvider
+}
+
+var _ rest.Storage = &podMetricsStorage{}
+var _ rest.KindProvider = &podMetricsStorage{}
+var _ rest.Scoper = &podMetricsStorage{}
+var _ rest.SingularNameProvider = &podMetricsStorage{}
+var _ rest.Getter = &podMetricsStorage{}
+var _ rest.Lister = &podMetricsStorage{}
+
+func newPodMetricsStorage(provider *ResourceMetricsProvider) *podMetricsStorage {
+	return &podMetricsStorage{
+		TableConvertor: rest.NewDefaultTableConvertor(metrics.Resource("pods")),
+		provider:       provider,
+	}
+}
+
+// New implements [rest.Storage.New].
+func (s *podMetricsStorage) New() runtime.Object {
+	return &metrics.PodMetrics{}
+}
+
+// Destroy implements [rest.Storage.Destroy].
+func (s *podMetricsStorage) Destroy() {
+}
+
+// Kind implements [rest.KindProvider.Kind].
+func (s *podMetricsStorage) Kind() string {
+	return "PodMetrics"
+}
+
+// NamespaceScoped implements [rest.Scoper.NamespaceScoped].
+func (s *podMetricsStorage) NamespaceScoped() bool {
+	return true
+}
+
+// GetSingularName implements [rest.SingularNameProvider.GetSingularName].
+func (s *podMetricsStorage) GetSingularName() string {
+	return "pod"
+}
+
+// NewList implements [rest.Lister.NewList].
+func (s *podMetricsStorage) NewList() runtime.Object {
+	return &metrics.PodMetricsList{}
+}
+
+// List implements [rest.Lister.List]. Only namespaced requests are served. A request across all namespaces returns an
+// empty list, because Kapis are only looked up by shoot namespace.
+func (s *podMetricsStorage) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	if !s.provider.isLeader() {
+		return nil, newNotLeaderError()
+	}
+	labelSelector := labels.Everything()
+	fieldSelector := fields.Everything()
+	if options != nil {
+		if options.LabelSelector != nil {
+			labelSelector = options.LabelSelector
+		}
+		if options.FieldSelector != nil {
+			fieldSelector = options.FieldSelector
+		}
+	}
+
+	result := &metrics.PodMetricsList{}
+	namespace := genericapirequest.NamespaceValue(ctx)
+	if namespace == "" {
+		return result, nil
+	}
+	for _, podMetrics := range s.provider.GetPodMetrics(namespace, labelSelector) {
+		podFields := fields.Set{"metadata.name": podMetrics.Name, "metadata.namespace": podMetrics.Namespace}
+		if fieldSelector.Matches(podFields) {
+			result.Items = append(result.Items, podMetrics)
+		}
+	}
+
+	return result, nil
+}
+
+// Get implements [rest.Getter.Get].
+func (s *podMetricsStorage) Get(ctx context.Context, name string, _ *metav1.GetOptions) (runtime.Object, error) {
+	if !s.provider.isLeader() {
+		return nil, newNotLeaderError()
+	}
+	namespace := genericapirequest.NamespaceValue(ctx)
+	for _, podMetrics := range s.provider.GetPodMetrics(namespace, labels.Everything()) {
+		if podMetrics.Name == name {
+			return &podMetrics, nil
+		}
+	}
+
+	return nil, apierrors.NewNotFound(metrics.Resource("pods"), name)
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/rest"
+	"k8s.io/metrics/pkg/apis/metrics"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/apiserver"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("resource metrics API", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "my-pod"
+	)
+
+	// newTestProvider returns a provider with two Kapis in testNs: testPodName, which has resource metrics, and
+	// testPodName+"2", which has none
+	newTestProvider := func() *ResourceMetricsProvider {
+		idr := &fakes.FakeInputDataRegistry{}
+		idr.SetKapiData(testNs, testPodName, "", map[string]string{"app": "kube-apiserver"}, "")
+		idr.SetKapiData(testNs, testPodName+"2", "", map[string]string{"app": "kube-apiserver"}, "")
+		idr.SetKapiCPUWithTime(testNs, testPodName, 10, gcmtesting.NewTime(1, 0, 0))
+		idr.SetKapiCPUWithTime(testNs, testPodName, 40, gcmtesting.NewTime(1, 1, 0))
+		idr.SetKapiMemoryWithTime(testNs, testPodName, 1024, gcmtesting.NewTime(1, 1, 0))
+		provider := NewResourceMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute)
+		provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+		return provider
+	}
+
+	Describe("podMetricsStorage", func() {
+		It("should list the metrics of the pods in the request's namespace", func() {
+			// Arrange
+			storage := newPodMetricsStorage(newTestProvider())
+			ctx := genericapirequest.WithNamespace(context.Background(), testNs)
+
+			// Act
+			result, err := storage.List(ctx, &metainternalversion.ListOptions{})
+
+			// Assert
+			Expect(err).To(Succeed())
+			list := result.(*metrics.PodMetricsList)
+			Expect(list.Items).To(HaveLen(1))
+			Expect(list.Items[0].Name).To(Equal(testPodName))
+		})
+
+		It("should apply the label and field selectors", func() {
+			// Arrange
+			storage := newPodMetricsStorage(newTestProvider())
+			ctx := genericapirequest.WithNamespace(context.Background(), testNs)
+			nonMatchingLabels, err := labels.Parse("app=other")
+			Expect(err).To(Succeed())
+			nonMatchingFields := fields.OneTermEqualSelector("metadata.name", "other-pod")
+
+			// Act
+			byLabel, errLabel := storage.List(ctx, &metainternalversion.ListOptions{LabelSelector: nonMatchingLabels})
+			byField, errField := storage.List(ctx, &metainternalversion.ListOptions{FieldSelector: nonMatchingFields})
+
+			// Assert
+			Expect(errLabel).To(Succeed())
+			Expect(errField).To(Succeed())
+			Expect(byLabel.(*metrics.PodMetricsList).Items).To(BeEmpty())
+			Expect(byField.(*metrics.PodMetricsList).Items).To(BeEmpty())
+		})
+
+		It("should return an empty list for requests across all namespaces", func() {
+			// Arrange
+			storage := newPodMetricsStorage(newTestProvider())
+
+			// Act
+			result, err := storage.List(context.Background(), nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result.(*metrics.PodMetricsList).Items).To(BeEmpty())
+		})
+
+		It("should get the metrics of a single pod, and return not found for pods without metrics", func() {
+			// Arrange
+			storage := newPodMetricsStorage(newTestProvider())
+			ctx := genericapirequest.WithNamespace(context.Background(), testNs)
+
+			// Act
+			found, errFound := storage.Get(ctx, testPodName, nil)
+			_, errMissing := storage.Get(ctx, testPodName+"2", nil)
+
+			// Assert
+			Expect(errFound).To(Succeed())
+			Expect(found.(*metrics.PodMetrics).Name).To(Equal(testPodName))
+			Expect(errMissing).To(HaveOccurred())
+		})
+
+		It("should reject requests with 503, while the replica is not the leader", func() {
+			// Arrange
+			provider := newTestProvider()
+			provider.SetLeaderElected(make(chan struct{}))
+			storage := newPodMetricsStorage(provider)
+			ctx := genericapirequest.WithNamespace(context.Background(), testNs)
+
+			// Act
+			_, errList := storage.List(ctx, &metainternalversion.ListOptions{})
+			_, errGet := storage.Get(ctx, testPodName, nil)
+
+			// Assert
+			for _, err := range []error{errList, errGet} {
+				statusErr, ok := err.(*apierrors.StatusError) // The API server only recognizes unwrapped status errors
+				Expect(ok).To(BeTrue())
+				Expect(apierrors.IsServiceUnavailable(statusErr)).To(BeTrue())
+			}
+		})
+
+		It("should serve requests, once the replica becomes leader", func() {
+			// Arrange
+			provider := newTestProvider()
+			elected := make(chan struct{})
+			provider.SetLeaderElected(elected)
+			storage := newPodMetricsStorage(provider)
+			ctx := genericapirequest.WithNamespace(context.Background(), testNs)
+			close(elected)
+
+			// Act
+			result, err := storage.Get(ctx, testPodName, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result.(*metrics.PodMetrics).Name).To(Equal(testPodName))
+		})
+	})
+
+	Describe("installResourceMetricsAPI", func() {
+		It("should serve pod metrics via the metrics.k8s.io API", func() {
+			// Arrange
+			config := genericapiserver.NewRecommendedConfig(apiserver.Codecs)
+			config.ExternalAddress = "localhost:443"
+			config.LoopbackClientConfig = &rest.Config{}
+			server, err := config.Complete().New("test", genericapiserver.NewEmptyDelegate())
+			Expect(err).To(Succeed())
+
+			// Act
+			err = installResourceMetricsAPI(server, newTestProvider())
+
+			// Assert
+			Expect(err).To(Succeed())
+			request := httptest.NewRequest(
+				http.MethodGet, "/apis/metrics.k8s.io/v1beta1/namespaces/"+testNs+"/pods/"+testPodName, nil)
+			recorder := httptest.NewRecorder()
+			server.Handler.ServeHTTP(recorder, request)
+			Expect(recorder.Code).To(Equal(http.StatusOK), recorder.Body.String())
+			var podMetrics metricsv1beta1.PodMetrics
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &podMetrics)).To(Succeed())
+			Expect(podMetrics.Name).To(Equal(testPodName))
+			Expect(podMetrics.Containers).To(HaveLen(1))
+			Expect(podMetrics.Containers[0].Usage.Cpu().MilliValue()).To(Equal(int64(500)))
+			Expect(podMetrics.Containers[0].Usage.Memory().Value()).To(Equal(int64(1024)))
+			Expect(podMetrics.Window.Duration).To(Equal(time.Minute))
+		})
+	})
+})
+
+var _ = Describe("ResourceMetricsProvider", func() {
+	const testNs = "shoot--my-shoot"
+
+	DescribeTable("GetPodMetrics should omit pods with unsuitable samples",
+		func(cpuOldTime, cpuNewTime, memoryTime time.Time, isExpected bool) {
+			// Arrange
+			idr := &fakes.FakeInputDataRegistry{}
+			idr.SetKapiData(testNs, "pod", "", nil, "")
+			idr.SetKapiCPUWithTime(testNs, "pod", 1, cpuOldTime)
+			idr.SetKapiCPUWithTime(testNs, "pod", 2, cpuNewTime)
+			idr.SetKapiMemoryWithTime(testNs, "pod", 100, memoryTime)
+			provider := NewResourceMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute)
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 30, 0)
+
+			// Act
+			result := provider.GetPodMetrics(testNs, labels.Everything())
+
+			// Assert
+			if isExpected {
+				Expect(result).To(HaveLen(1))
+				Expect(result[0].Containers[0].Name).To(Equal(kapiContainerName))
+				Expect(result[0].Containers[0].Usage).To(HaveKey(corev1.ResourceMemory))
+			} else {
+				Expect(result).To(BeEmpty())
+			}
+		},
+		Entry("suitable samples",
+			gcmtesting.NewTime(1, 29, 0), gcmtesting.NewTime(1, 29, 30), gcmtesting.NewTime(1, 29, 30), true),
+		Entry("single CPU sample",
+			time.Time{}, gcmtesting.NewTime(1, 29, 30), gcmtesting.NewTime(1, 29, 30), false),
+		Entry("CPU samples too far apart",
+			gcmtesting.NewTime(1, 0, 0), gcmtesting.NewTime(1, 29, 30), gcmtesting.NewTime(1, 29, 30), false),
+		Entry("CPU sample too old",
+			gcmtesting.NewTime(1, 20, 0), gcmtesting.NewTime(1, 25, 0), gcmtesting.NewTime(1, 29, 30), false),
+		Entry("no memory sample",
+			gcmtesting.NewTime(1, 29, 0), gcmtesting.NewTime(1, 29, 30), time.Time{}, false),
+	)
+})
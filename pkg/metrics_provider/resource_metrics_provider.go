@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"math"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/metrics/pkg/apis/metrics"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// kapiContainerName is the name of the kube-apiserver container in Kapi pods. The resource usage of a Kapi pod is
+// attributed to that container.
+const kapiContainerName = "kube-apiserver"
+
+// ResourceMetricsProvider provides resource metrics (the metrics.k8s.io API) for Kapi pods, so that CPU and memory
+// based autoscaling of kube-apiserver does not depend on a separate metrics-server.
+//
+// The usage of a pod is the one which the kube-apiserver process reports about itself, via its
+// process_cpu_seconds_total and process_resident_memory_bytes metrics, and is attributed to the pod's kube-apiserver
+// container. Other containers in the pod are not covered. Note that the memory value is the resident set size, and not
+// the working set, which metrics-server reports.
+type ResourceMetricsProvider struct {
+	dataSource input_data_registry.InputDataSource
+
+	// The last sample for a pod is valid for this long
+	maxSampleAge time.Duration
+
+	// If two consecutive CPU samples are further apart than this, the pair is not considered in rate calculation
+	maxSampleGap time.Duration
+
+	// If not nil, closed once this replica becomes leader. Until then, resource metrics requests are rejected. See
+	// SetLeaderElected.
+	leaderElected <-chan struct{}
+
+	testIsolation metricsProviderTestIsolation
+}
+
+// NewResourceMetricsProvider creates a ResourceMetricsProvider which relies on the specified
+// [input_data_registry.InputDataSource] as source of data. The maxSampleAge and maxSampleGap parameters have the same
+// meaning as in [NewMetricsProvider].
+func NewResourceMetricsProvider(
+	dataSource input_data_registry.InputDataSource,
+	maxSampleAge time.Duration,
+	maxSampleGap time.Duration) *ResourceMetricsProvider {
+
+	return &ResourceMetricsProvider{
+		dataSource:    dataSource,
+		maxSampleAge:  maxSampleAge,
+		maxSampleGap:  maxSampleGap,
+		testIsolation: metricsProviderTestIsolation{TimeNow: time.Now},
+	}
+}
+
+// SetLeaderElected makes the ResourceMetricsProvider aware of this replica's leadership, the same way as
+// [MetricsProvider.SetLeaderElected] does. Must be called before the ResourceMetricsProvider starts serving requests.
+func (rmp *ResourceMetricsProvider) SetLeaderElected(elected <-chan struct{}) {
+	rmp.leaderElected = elected
+}
+
+// GetPodMetrics returns resource metrics for the Kapi pods in the specified namespace, whose labels match the specified
+// selector. Pods which lack a recent enough pair of CPU samples, or a recent enough memory sample, are omitted.
+func (rmp *ResourceMetricsProvider) GetPodMetrics(namespace string, selector labels.Selector) []metrics.PodMetrics {
+	now := rmp.testIsolation.TimeNow()
+	var result []metrics.PodMetrics
+	for _, kapi := range rmp.dataSource.GetShootKapis(namespace) {
+		if !selector.Matches(labels.Set(kapi.PodLabels())) {
+			continue
+		}
+		if podMetrics, ok := rmp.getPodMetrics(kapi, now); ok {
+			result = append(result, *podMetrics)
+		}
+	}
+
+	return result
+}
+
+// getPodMetrics calculates the resource metrics for the specified Kapi. The CPU usage is calculated based on the two
+// most recent CPU samples for the Kapi. Returns false if the samples on record are not suitable for that.
+func (rmp *ResourceMetricsProvider) getPodMetrics(kapi input_data_registry.ShootKapi, now time.Time) (
+	*metrics.PodMetrics, bool) {
+
+	if kapi.CPUSampleTimeOld().IsZero() {
+		// Fewer than two CPU samples since the process started
+		return nil, false
+	}
+	gap := kapi.CPUSampleTimeNew().Sub(kapi.CPUSampleTimeOld())
+	if gap <= 0 || gap > rmp.maxSampleGap {
+		return nil, false
+	}
+	oldestAcceptable := now.Add(-rmp.maxSampleAge)
+	if kapi.CPUSampleTimeNew().Before(oldestAcceptable) || kapi.MemorySampleTime().Before(oldestAcceptable) {
+		// Samples too old
+		return nil, false
+	}
+
+	cpuCores := (kapi.CPUSecondsNew() - kapi.CPUSecondsOld()) / gap.Seconds()
+	return &metrics.PodMetrics{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              kapi.PodName(),
+			Namespace:         kapi.ShootNamespace(),
+			Labels:            kapi.PodLabels(),
+			CreationTimestamp: metav1.NewTime(now),
+		},
+		Timestamp: metav1.NewTime(kapi.CPUSampleTimeNew()),
+		Window:    metav1.Duration{Duration: gap},
+		Containers: []metrics.ContainerMetrics{
+			{
+				Name: kapiContainerName,
+				Usage: corev1.ResourceList{
+					corev1.ResourceCPU:    *resource.NewMilliQuantity(int64(math.Round(cpuCores*1000)), resource.DecimalSI),
+					corev1.ResourceMemory: *resource.NewQuantity(kapi.ResidentMemoryBytes(), resource.BinarySI),
+				},
+			},
+		},
+	}, true
+}
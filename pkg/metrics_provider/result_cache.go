@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// DefaultResultCacheTTL is the default value of the --result-cache-ttl option
+const DefaultResultCacheTTL = 5 * time.Second
+
+// resultCacheKey identifies a GetMetricBySelector request within a namespace
+type resultCacheKey struct {
+	groupResource  schema.GroupResource
+	metric         string
+	podSelector    string
+	metricSelector string
+}
+
+// namespaceResults holds the cached results of the requests for a single namespace. The results were all computed from
+// the same generation of the namespace's data, and expire together.
+type namespaceResults struct {
+	generation uint64    // The generation of the shoot data, from which the results were computed
+	expiryTime time.Time // The results are not served after this point in time
+	results    map[resultCacheKey]*custom_metrics.MetricValueList
+}
+
+// resultCache holds the results of recent GetMetricBySelector requests, keyed by namespace. Many HPAs poll the same
+// metrics of the same shoot, each every few seconds, so a short-lived cache saves recomputing the same values for each
+// of them.
+//
+// A cached result is served until it expires, or until the generation of the namespace's shoot data changes, whichever
+// comes first. The expiry bounds the staleness of values which depend on the present moment, e.g. sample ages.
+//
+// All public operations are concurrency-safe.
+type resultCache struct {
+	ttl time.Duration
+
+	lock          sync.Mutex
+	namespaces    map[string]*namespaceResults // Protected by lock
+	lastSweepTime time.Time                    // When expired results were last removed. Protected by lock.
+}
+
+// newResultCache creates a resultCache which retains each result for no longer than the specified period
+func newResultCache(ttl time.Duration) *resultCache {
+	return &resultCache{
+		ttl:        ttl,
+		namespaces: make(map[string]*namespaceResults),
+	}
+}
+
+// newResultCacheKey returns the key of the specified request. A nil metric selector is equivalent to one which
+// matches everything.
+func newResultCacheKey(
+	podSelector labels.Selector, metricInfo provider.CustomMetricInfo, metricSelector labels.Selector) resultCacheKey {
+
+	key := resultCacheKey{
+		groupResource: metricInfo.GroupResource,
+		metric:        metricInfo.Metric,
+		podSelector:   podSelector.String(),
+	}
+	if metricSelector != nil {
+		key.metricSelector = metricSelector.String()
+	}
+	return key
+}
+
+// get returns the cached result of the specified request, if it was computed from the specified generation of the
+// namespace's data, and has not expired. Otherwise, returns nil. The caller must not modify the result.
+func (c *resultCache) get(
+	namespace string, key resultCacheKey, generation uint64, now time.Time) *custom_metrics.MetricValueList {
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry := c.namespaces[namespace]
+	if entry == nil || entry.generation != generation || !now.Before(entry.expiryTime) {
+		return nil
+	}
+	return entry.results[key]
+}
+
+// put caches the result of the specified request, computed from the specified generation of the namespace's data. The
+// cache takes ownership of the result. Results for the namespace which were computed from a different generation, or
+// have expired, are discarded.
+func (c *resultCache) put(
+	namespace string,
+	key resultCacheKey,
+	generation uint64,
+	now time.Time,
+	result *custom_metrics.MetricValueList) {
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.sweepThreadUnsafe(now)
+	entry := c.namespaces[namespace]
+	if entry == nil || entry.generation != generation || !now.Before(entry.expiryTime) {
+		entry = &namespaceResults{
+			generation: generation,
+			expiryTime: now.Add(c.ttl),
+			results:    make(map[resultCacheKey]*custom_metrics.MetricValueList),
+		}
+		c.namespaces[namespace] = entry
+	}
+	entry.results[key] = result
+}
+
+// sweepThreadUnsafe removes the expired results of all namespaces, so namespaces which are no longer requested do not
+// linger. Does so at most once per TTL.
+// Caller must hold the lock.
+func (c *resultCache) sweepThreadUnsafe(now time.Time) {
+	if now.Sub(c.lastSweepTime) < c.ttl {
+		return
+	}
+
+	c.lastSweepTime = now
+	for namespace, entry := range c.namespaces {
+		if !now.Before(entry.expiryTime) {
+			delete(c.namespaces, namespace)
+		}
+	}
+}
+
+// SetResultCacheTTL enables caching of the results of GetMetricBySelector requests for Kapi pods. A result is served
+// from the cache for up to the specified period, unless the shoot's data changes in the meantime. Zero disables
+// caching. Must be called before the MetricsProvider starts serving requests.
+func (mp *MetricsProvider) SetResultCacheTTL(ttl time.Duration) {
+	mp.resultCache = nil
+	if ttl > 0 {
+		mp.resultCache = newResultCache(ttl)
+	}
+}
+
+// getMetricBySelectorCached implements GetMetricBySelector for Kapi pods, serving the result from the result cache, if
+// possible
+func (mp *MetricsProvider) getMetricBySelectorCached(
+	namespace string,
+	podSelector labels.Selector,
+	metricInfo provider.CustomMetricInfo,
+	metricSelector labels.Selector) (*custom_metrics.MetricValueList, error) {
+
+	// The generation is read before the data, so a change made in between is detected by the next request, instead of
+	// the result computed from the old data being cached under the new generation
+	generation := mp.dataSource.GetShootGeneration(namespace)
+	now := mp.testIsolation.TimeNow()
+	key := newResultCacheKey(podSelector, metricInfo, metricSelector)
+	if cached := mp.resultCache.get(namespace, key, generation, now); cached != nil {
+		return cached.DeepCopy(), nil
+	}
+
+	result, err := mp.getMetricByPredicate(namespace, podSelectorPredicate(podSelector), metricInfo, metricSelector)
+	if err != nil {
+		return nil, err
+	}
+	mp.resultCache.put(namespace, key, generation, now, result.DeepCopy())
+	return result, nil
+}
+
+// podSelectorPredicate returns a predicate which is true for the Kapis whose pod labels match the selector
+func podSelectorPredicate(podSelector labels.Selector) kapiPredicate {
+	return func(kapi input_data_registry.ShootKapi) bool {
+		return podSelector.Matches(labels.Set(kapi.PodLabels()))
+	}
+}
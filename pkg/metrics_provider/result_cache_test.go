@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+// controlledGenerationDataSource is an InputDataSource whose shoot generation is set by the test
+type controlledGenerationDataSource struct {
+	input_data_registry.InputDataSource
+	generation uint64
+}
+
+func (ds *controlledGenerationDataSource) GetShootGeneration(_ string) uint64 {
+	return ds.generation
+}
+
+var _ = Describe("MetricsProvider result cache", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "my-pod"
+	)
+	var (
+		metricInfo = mxprov.CustomMetricInfo{
+			GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+			Namespaced:    true,
+			Metric:        metricName,
+		}
+
+		// Creates a provider with a 5s result cache, over a Kapi which served 60 requests in the minute before 01:01:00
+		newTestProvider = func() (*MetricsProvider, *fakes.FakeInputDataRegistry, *controlledGenerationDataSource) {
+			idr := &fakes.FakeInputDataRegistry{}
+			idr.SetKapiData(testNs, testPodName, "", nil, "")
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 0, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 60, gcmtesting.NewTime(1, 1, 0))
+			dataSource := &controlledGenerationDataSource{InputDataSource: idr.DataSource(), generation: 1}
+			provider := NewMetricsProvider(dataSource, 90*time.Second, 10*time.Minute, MetricNaming{})
+			provider.SetResultCacheTTL(5 * time.Second)
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+			return provider, idr, dataSource
+		}
+		// Records a new sample, which changes the rate to 2 requests/s
+		addSample = func(idr *fakes.FakeInputDataRegistry) {
+			idr.SetKapiMetricsWithTime(testNs, testPodName, 180, gcmtesting.NewTime(1, 2, 0))
+		}
+		getRate = func(provider *MetricsProvider) float64 {
+			result, err := provider.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+			Expect(err).To(Succeed())
+			Expect(result.Items).To(HaveLen(1))
+			return result.Items[0].Value.AsApproximateFloat64()
+		}
+	)
+
+	It("should serve the cached result, while the shoot's generation is unchanged and the result has not expired", func() {
+		// Arrange
+		provider, idr, _ := newTestProvider()
+		Expect(getRate(provider)).To(Equal(1.0))
+		addSample(idr)
+
+		// Act
+		rate := getRate(provider)
+
+		// Assert
+		Expect(rate).To(Equal(1.0))
+	})
+
+	It("should recompute the result, once the shoot's generation changes", func() {
+		// Arrange
+		provider, idr, dataSource := newTestProvider()
+		Expect(getRate(provider)).To(Equal(1.0))
+		addSample(idr)
+		dataSource.generation++
+
+		// Act
+		rate := getRate(provider)
+
+		// Assert
+		Expect(rate).To(Equal(2.0))
+	})
+
+	It("should recompute the result, once it expires", func() {
+		// Arrange
+		provider, idr, _ := newTestProvider()
+		Expect(getRate(provider)).To(Equal(1.0))
+		addSample(idr)
+		provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 2, 10)
+
+		// Act
+		rate := getRate(provider)
+
+		// Assert
+		Expect(rate).To(Equal(2.0))
+	})
+
+	It("should cache the results of requests with different selectors separately", func() {
+		// Arrange
+		provider, _, _ := newTestProvider()
+		Expect(getRate(provider)).To(Equal(1.0))
+		podSelector, _ := labels.Parse("app=other")
+
+		// Act
+		result, err := provider.GetMetricBySelector(context.Background(), testNs, podSelector, metricInfo, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(result.Items).To(BeEmpty())
+	})
+
+	It("should return a copy, which the caller can modify without affecting the cached result", func() {
+		// Arrange
+		provider, _, _ := newTestProvider()
+		result, err := provider.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+		Expect(err).To(Succeed())
+
+		// Act
+		result.Items[0].DescribedObject.Name = "modified"
+
+		// Assert
+		result, err = provider.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+		Expect(err).To(Succeed())
+		Expect(result.Items[0].DescribedObject.Name).To(Equal(testPodName))
+	})
+
+	It("should not cache results, if the TTL is zero", func() {
+		// Arrange
+		provider, idr, _ := newTestProvider()
+		provider.SetResultCacheTTL(0)
+		Expect(getRate(provider)).To(Equal(1.0))
+		addSample(idr)
+		provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 2, 1)
+
+		// Act
+		rate := getRate(provider)
+
+		// Assert
+		Expect(rate).To(Equal(2.0))
+	})
+
+	Describe("resultCache", func() {
+		It("should remove the expired results of namespaces which are no longer requested", func() {
+			// Arrange
+			cache := newResultCache(5 * time.Second)
+			key := resultCacheKey{metric: metricName}
+			cache.put("ns1", key, 1, gcmtesting.NewTime(1, 0, 0), &custom_metrics.MetricValueList{})
+
+			// Act
+			cache.put("ns2", key, 1, gcmtesting.NewTime(1, 0, 10), &custom_metrics.MetricValueList{})
+
+			// Assert
+			Expect(cache.namespaces).To(HaveLen(1))
+			Expect(cache.namespaces).To(HaveKey("ns2"))
+		})
+	})
+})
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"sort"
+
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+)
+
+// DefaultMaxResultItems is the default value of the --max-result-items option. Zero means no limit.
+const DefaultMaxResultItems = 0
+
+// SetMaxResultItems bounds the number of items which a GetMetricBySelector request returns. The custom metrics
+// provider interface does not pass the limit and continue parameters of list requests through, so instead of
+// paginating, the result is truncated after the specified number of items, and the number of items left out is
+// reported in the result's remainingItemCount. Zero means no limit. Must be called before the MetricsProvider starts
+// serving requests. The caller is responsible for ensuring that the limit is not negative.
+func (mp *MetricsProvider) SetMaxResultItems(maxItems int) {
+	mp.maxResultItems = maxItems
+}
+
+// limitResult sorts the items of the specified result by namespace and name of the described object, so results are
+// stable across requests, and truncates the result to the max result items. Returns true if items were left out.
+func (mp *MetricsProvider) limitResult(result *custom_metrics.MetricValueList) bool {
+	sort.SliceStable(result.Items, func(i, j int) bool {
+		left, right := &result.Items[i].DescribedObject, &result.Items[j].DescribedObject
+		if left.Namespace != right.Namespace {
+			return left.Namespace < right.Namespace
+		}
+		return left.Name < right.Name
+	})
+
+	if mp.maxResultItems == 0 || len(result.Items) <= mp.maxResultItems {
+		return false
+	}
+	remaining := int64(len(result.Items) - mp.maxResultItems)
+	result.Items = result.Items[:mp.maxResultItems]
+	result.RemainingItemCount = &remaining
+	return true
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"k8s.io/utils/ptr"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("MetricsProvider result limit", func() {
+	const (
+		testNs = "shoot--my-shoot"
+	)
+	var (
+		metricInfo = mxprov.CustomMetricInfo{
+			GroupResource: schema.GroupResource{Resource: "pods"},
+			Namespaced:    true,
+			Metric:        metricName,
+		}
+
+		// Creates a provider over Kapis with usable samples, registered in the specified order
+		newTestProvider = func(podNames ...string) *MetricsProvider {
+			idr := &fakes.FakeInputDataRegistry{}
+			for _, podName := range podNames {
+				idr.SetKapiData(testNs, podName, "", nil, "")
+				idr.SetKapiMetricsWithTime(testNs, podName, 10, gcmtesting.NewTime(1, 0, 0))
+				idr.SetKapiMetricsWithTime(testNs, podName, 20, gcmtesting.NewTime(1, 1, 0))
+			}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 2, 0)
+			return provider
+		}
+		podNamesOf = func(list *custom_metrics.MetricValueList) []string {
+			var result []string
+			for _, item := range list.Items {
+				result = append(result, item.DescribedObject.Name)
+			}
+			return result
+		}
+	)
+
+	It("should order the items by pod name, and not truncate them, if there is no limit", func() {
+		// Arrange
+		provider := newTestProvider("pod-c", "pod-a", "pod-b")
+
+		// Act
+		metricList, err := provider.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(podNamesOf(metricList)).To(Equal([]string{"pod-a", "pod-b", "pod-c"}))
+		Expect(metricList.RemainingItemCount).To(BeNil())
+	})
+
+	It("should return the first items, and report the count of the ones left out, if the limit is exceeded", func() {
+		// Arrange
+		provider := newTestProvider("pod-c", "pod-a", "pod-b")
+		provider.SetMaxResultItems(2)
+
+		// Act
+		metricList, err := provider.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(podNamesOf(metricList)).To(Equal([]string{"pod-a", "pod-b"}))
+		Expect(metricList.RemainingItemCount).To(Equal(ptr.To(int64(1))))
+	})
+
+	It("should not truncate the result, if it is within the limit", func() {
+		// Arrange
+		provider := newTestProvider("pod-b", "pod-a")
+		provider.SetMaxResultItems(2)
+
+		// Act
+		metricList, err := provider.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(podNamesOf(metricList)).To(Equal([]string{"pod-a", "pod-b"}))
+		Expect(metricList.RemainingItemCount).To(BeNil())
+	})
+
+	It("should not truncate the cached result, when truncating a result served from the cache", func() {
+		// Arrange
+		provider := newTestProvider("pod-c", "pod-a", "pod-b")
+		provider.SetResultCacheTTL(time.Minute)
+		_, err := provider.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+		Expect(err).To(Succeed())
+		provider.SetMaxResultItems(1)
+
+		// Act
+		truncated, err := provider.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+		Expect(err).To(Succeed())
+		provider.SetMaxResultItems(0)
+		full, err := provider.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(podNamesOf(truncated)).To(Equal([]string{"pod-a"}))
+		Expect(podNamesOf(full)).To(Equal([]string{"pod-a", "pod-b", "pod-c"}))
+	})
+})
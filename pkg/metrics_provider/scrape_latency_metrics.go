@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+)
+
+// ScrapeLatencyMetricName is the name of the metric which describes a shoot namespace with the 90th percentile of the
+// recent successful scrape durations of the shoot's Kapis. See SetScrapeLatencyMetric.
+const ScrapeLatencyMetricName = "shoot:scrape_latency_p90_seconds"
+
+// namespacesGroupResource identifies requests for metrics which describe namespaces. The custom metrics API serves
+// such metrics at /namespaces/{namespace}/metrics/{metric}, and requests them as root-scoped metrics of the namespace
+// object.
+var namespacesGroupResource = schema.GroupResource{Group: "", Resource: "namespaces"}
+
+// SetScrapeLatencyMetric enables or disables serving the ScrapeLatencyMetricName metric, for each shoot namespace. The
+// metric is not subject to [MetricNaming.NameOverrides]. Must be called before the MetricsProvider starts serving
+// requests.
+func (mp *MetricsProvider) SetScrapeLatencyMetric(isEnabled bool) {
+	mp.serveScrapeLatency = isEnabled
+}
+
+// isScrapeLatencyRequest returns true if the request is for the scrape latency metric
+func (mp *MetricsProvider) isScrapeLatencyRequest(metricInfo provider.CustomMetricInfo) bool {
+	return mp.serveScrapeLatency &&
+		metricInfo.GroupResource == namespacesGroupResource &&
+		metricInfo.Metric == ScrapeLatencyMetricName
+}
+
+// listScrapeLatencyMetrics returns the scrape latency metric, if it is enabled. Otherwise, empty.
+func (mp *MetricsProvider) listScrapeLatencyMetrics() []provider.CustomMetricInfo {
+	if !mp.serveScrapeLatency {
+		return nil
+	}
+	return []provider.CustomMetricInfo{{GroupResource: namespacesGroupResource, Metric: ScrapeLatencyMetricName}}
+}
+
+// getScrapeLatencyMetric returns the 90th percentile of the scrape durations on record for the Kapis of the specified
+// shoot. Only Kapis with a sample no older than maxSampleAge are considered, so the value does not reflect Kapis which
+// are no longer scraped successfully. Returns nil, if there are no such durations, or if the value does not match the
+// metricSelector.
+func (mp *MetricsProvider) getScrapeLatencyMetric(
+	shootNamespace string, metricSelector labels.Selector) *custom_metrics.MetricValue {
+
+	now := mp.testIsolation.TimeNow()
+	var durations []time.Duration
+	for _, kapi := range mp.dataSource.GetShootKapis(shootNamespace) {
+		if kapi.MetricsTimeNew().IsZero() || now.Sub(kapi.MetricsTimeNew()) > mp.maxSampleAge {
+			continue
+		}
+		durations = append(durations, kapi.ScrapeDurationHistory()...)
+	}
+	if len(durations) == 0 {
+		return nil
+	}
+	if metricSelector != nil && !metricSelector.Matches(mp.naming.selectableLabels(nil)) {
+		return nil
+	}
+
+	return &custom_metrics.MetricValue{
+		DescribedObject: custom_metrics.ObjectReference{
+			Kind:       "Namespace",
+			Name:       shootNamespace,
+			APIVersion: "v1",
+		},
+		Metric: custom_metrics.MetricIdentifier{
+			Name:     ScrapeLatencyMetricName,
+			Selector: mp.naming.staticLabelSelector(),
+		},
+		Value:     *resource.NewMilliQuantity(percentile(durations, 0.9).Milliseconds(), resource.DecimalSI),
+		Timestamp: metav1.Time{Time: now},
+	}
+}
+
+// percentile returns the specified percentile (0, 1] of the durations, by the nearest-rank method. Sorts the
+// durations in place. The durations must not be empty.
+func percentile(durations []time.Duration, fraction float64) time.Duration {
+	slices.Sort(durations)
+	rank := int(math.Ceil(fraction * float64(len(durations))))
+	return durations[max(rank, 1)-1]
+}
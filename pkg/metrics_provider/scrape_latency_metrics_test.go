@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+var _ = Describe("MetricsProvider scrape latency metric", func() {
+	const (
+		testNs = "shoot--my-shoot"
+	)
+	var (
+		latencyMetricInfo = mxprov.CustomMetricInfo{
+			GroupResource: schema.GroupResource{Resource: "namespaces"},
+			Metric:        ScrapeLatencyMetricName,
+		}
+
+		// Creates a provider which serves the scrape latency metric, over two Kapis, with the specified scrape
+		// durations, in milliseconds. The second Kapi's sample is older than the maximum sample age.
+		newTestProvider = func(freshDurations []int, staleDurations []int) *MetricsProvider {
+			idr := &fakes.FakeInputDataRegistry{}
+			idr.SetKapiData(testNs, "fresh-pod", "", nil, "")
+			idr.SetKapiMetricsWithTime(testNs, "fresh-pod", 1, gcmtesting.NewTime(1, 1, 0))
+			idr.SetKapiData(testNs, "stale-pod", "", nil, "")
+			idr.SetKapiMetricsWithTime(testNs, "stale-pod", 1, gcmtesting.NewTime(0, 50, 0))
+			for _, duration := range freshDurations {
+				idr.AddKapiScrapeDuration(testNs, "fresh-pod", time.Duration(duration)*time.Millisecond)
+			}
+			for _, duration := range staleDurations {
+				idr.AddKapiScrapeDuration(testNs, "stale-pod", time.Duration(duration)*time.Millisecond)
+			}
+			provider := NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+			provider.SetScrapeLatencyMetric(true)
+			provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+			return provider
+		}
+		getLatency = func(provider *MetricsProvider) (*float64, error) {
+			result, err := provider.GetMetricByName(
+				context.Background(), types.NamespacedName{Name: testNs}, latencyMetricInfo, labels.Everything())
+			if result == nil {
+				return nil, err
+			}
+			value := result.Value.AsApproximateFloat64()
+			return &value, err
+		}
+	)
+
+	It("should list the metric as describing namespaces, if enabled", func() {
+		// Arrange
+		provider := newTestProvider(nil, nil)
+
+		// Act
+		metrics := provider.ListAllMetrics()
+
+		// Assert
+		Expect(metrics).To(ContainElement(latencyMetricInfo))
+	})
+	It("should not list the metric, if not enabled", func() {
+		// Arrange
+		provider := newTestProvider(nil, nil)
+		provider.SetScrapeLatencyMetric(false)
+
+		// Act
+		metrics := provider.ListAllMetrics()
+
+		// Assert
+		Expect(metrics).NotTo(ContainElement(latencyMetricInfo))
+	})
+	It("should serve the 90th percentile of the scrape durations of the shoot's Kapis with a fresh sample", func() {
+		// Arrange
+		provider := newTestProvider([]int{100, 200, 300, 400, 500, 600, 700, 800, 900, 1000}, []int{5000})
+
+		// Act
+		latency, err := getLatency(provider)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(latency).NotTo(BeNil())
+		Expect(*latency).To(Equal(0.9))
+	})
+	It("should describe the namespace", func() {
+		// Arrange
+		provider := newTestProvider([]int{100}, nil)
+
+		// Act
+		result, err := provider.GetMetricByName(
+			context.Background(), types.NamespacedName{Name: testNs}, latencyMetricInfo, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(result.DescribedObject.Kind).To(Equal("Namespace"))
+		Expect(result.DescribedObject.Name).To(Equal(testNs))
+		Expect(result.DescribedObject.Namespace).To(BeEmpty())
+		Expect(result.Metric.Name).To(Equal(ScrapeLatencyMetricName))
+	})
+	It("should serve nothing, if no durations are on record for Kapis with a fresh sample", func() {
+		// Arrange
+		provider := newTestProvider(nil, []int{100})
+
+		// Act
+		latency, err := getLatency(provider)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(latency).To(BeNil())
+	})
+	It("should serve nothing, if not enabled", func() {
+		// Arrange
+		provider := newTestProvider([]int{100}, nil)
+		provider.SetScrapeLatencyMetric(false)
+
+		// Act
+		latency, err := getLatency(provider)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(latency).To(BeNil())
+	})
+
+	Describe("percentile", func() {
+		It("should use the nearest rank", func() {
+			Expect(percentile([]time.Duration{3, 1, 2}, 0.9)).To(Equal(time.Duration(3)))
+			Expect(percentile([]time.Duration{3, 1, 2}, 0.5)).To(Equal(time.Duration(2)))
+			Expect(percentile([]time.Duration{7}, 0.9)).To(Equal(time.Duration(7)))
+		})
+	})
+})
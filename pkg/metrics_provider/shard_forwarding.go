@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+)
+
+// ForwardedMarkerLabel marks metric requests which were forwarded from another replica. It is added to the metric
+// selector of forwarded requests, as a "does not exist" requirement. That requirement matches all metric values, so it
+// does not alter the result, but it tells the receiving replica to serve the request from local data, even if it
+// considers another replica to be the owner of the namespace. This prevents requests from bouncing between replicas,
+// while their views of shard ownership differ.
+const ForwardedMarkerLabel = "custom-metrics.gardener.cloud/forwarded"
+
+// ShardForwarder serves metrics for namespaces owned by other replicas, when metric scraping is sharded across
+// replicas. Implementations must be concurrency-safe.
+type ShardForwarder interface {
+	// IsLocal returns true if this replica owns the specified namespace, and thus serves its metrics from local data
+	IsLocal(namespace string) bool
+	// GetMetricByName has the semantics of [provider.CustomMetricsProvider.GetMetricByName]. It obtains the metric from
+	// the replica which owns the namespace.
+	GetMetricByName(
+		ctx context.Context,
+		name types.NamespacedName,
+		info provider.CustomMetricInfo,
+		metricSelector labels.Selector) (*custom_metrics.MetricValue, error)
+	// GetMetricBySelector has the semantics of [provider.CustomMetricsProvider.GetMetricBySelector]. It obtains the
+	// metrics from the replica which owns the namespace.
+	GetMetricBySelector(
+		ctx context.Context,
+		namespace string,
+		selector labels.Selector,
+		info provider.CustomMetricInfo,
+		metricSelector labels.Selector) (*custom_metrics.MetricValueList, error)
+}
+
+// MarkForwarded returns a copy of the specified metric selector, extended with the ForwardedMarkerLabel requirement.
+// A nil selector is treated as one which selects everything.
+func MarkForwarded(metricSelector labels.Selector) labels.Selector {
+	if metricSelector == nil {
+		metricSelector = labels.Everything()
+	}
+	requirement, err := labels.NewRequirement(ForwardedMarkerLabel, selection.DoesNotExist, nil)
+	if err != nil {
+		panic(err) // The requirement is constant, so this indicates a bug
+	}
+	return metricSelector.Add(*requirement)
+}
+
+// isForwarded returns true if the metric selector contains the ForwardedMarkerLabel requirement
+func isForwarded(metricSelector labels.Selector) bool {
+	if metricSelector == nil {
+		return false
+	}
+	requirements, _ := metricSelector.Requirements()
+	for _, requirement := range requirements {
+		if requirement.Key() == ForwardedMarkerLabel {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_provider
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+// fakeShardForwarder is a ShardForwarder which owns a fixed namespace, and records forwarded requests
+type fakeShardForwarder struct {
+	localNamespace  string
+	forwardedByName []types.NamespacedName
+	forwardedBySel  []string
+}
+
+func (f *fakeShardForwarder) IsLocal(namespace string) bool {
+	return namespace == f.localNamespace
+}
+
+func (f *fakeShardForwarder) GetMetricByName(
+	_ context.Context,
+	name types.NamespacedName,
+	_ mxprov.CustomMetricInfo,
+	_ labels.Selector) (*custom_metrics.MetricValue, error) {
+
+	f.forwardedByName = append(f.forwardedByName, name)
+	return &custom_metrics.MetricValue{DescribedObject: custom_metrics.ObjectReference{Name: "forwarded"}}, nil
+}
+
+func (f *fakeShardForwarder) GetMetricBySelector(
+	_ context.Context,
+	namespace string,
+	_ labels.Selector,
+	_ mxprov.CustomMetricInfo,
+	_ labels.Selector) (*custom_metrics.MetricValueList, error) {
+
+	f.forwardedBySel = append(f.forwardedBySel, namespace)
+	return &custom_metrics.MetricValueList{Items: []custom_metrics.MetricValue{{}, {}, {}}}, nil
+}
+
+var _ = Describe("MetricsProvider shard forwarding", func() {
+	const (
+		localNs     = "shoot--local"
+		remoteNs    = "shoot--remote"
+		testPodName = "my-pod"
+		remotePod   = "remote-pod"
+	)
+	var (
+		metricInfo = mxprov.CustomMetricInfo{
+			GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
+			Namespaced:    true,
+			Metric:        metricName,
+		}
+		idr       *fakes.FakeInputDataRegistry
+		provider  *MetricsProvider
+		forwarder *fakeShardForwarder
+	)
+
+	BeforeEach(func() {
+		idr = &fakes.FakeInputDataRegistry{}
+		provider = NewMetricsProvider(idr.DataSource(), 90*time.Second, 10*time.Minute, MetricNaming{})
+		provider.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+		for ns, pod := range map[string]string{localNs: testPodName, remoteNs: remotePod} {
+			idr.SetKapiData(ns, pod, "", nil, "")
+			idr.SetKapiMetricsWithTime(ns, pod, 10, gcmtesting.NewTime(1, 0, 0))
+			idr.SetKapiMetricsWithTime(ns, pod, 20, gcmtesting.NewTime(1, 1, 0))
+		}
+		forwarder = &fakeShardForwarder{localNamespace: localNs}
+		provider.SetShardForwarder(forwarder)
+	})
+
+	It("should serve requests for local namespaces from local data", func() {
+		// Act
+		val, err := provider.GetMetricByName(
+			context.Background(), types.NamespacedName{Namespace: localNs, Name: testPodName}, metricInfo, nil)
+		list, listErr := provider.GetMetricBySelector(context.Background(), localNs, labels.Everything(), metricInfo, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(val.DescribedObject.Name).To(Equal(testPodName))
+		Expect(listErr).To(Succeed())
+		Expect(list.Items).NotTo(BeEmpty())
+		Expect(forwarder.forwardedByName).To(BeEmpty())
+		Expect(forwarder.forwardedBySel).To(BeEmpty())
+	})
+
+	It("should forward requests for namespaces owned by other replicas", func() {
+		// Act
+		val, err := provider.GetMetricByName(
+			context.Background(), types.NamespacedName{Namespace: remoteNs, Name: testPodName}, metricInfo, nil)
+		list, listErr := provider.GetMetricBySelector(context.Background(), remoteNs, labels.Everything(), metricInfo, nil)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(val.DescribedObject.Name).To(Equal("forwarded"))
+		Expect(listErr).To(Succeed())
+		Expect(list.Items).To(HaveLen(3))
+		Expect(forwarder.forwardedByName).To(Equal([]types.NamespacedName{{Namespace: remoteNs, Name: testPodName}}))
+		Expect(forwarder.forwardedBySel).To(Equal([]string{remoteNs}))
+	})
+
+	It("should serve already forwarded requests from local data, even if the namespace is not local", func() {
+		// Act
+		val, err := provider.GetMetricByName(
+			context.Background(),
+			types.NamespacedName{Namespace: remoteNs, Name: remotePod},
+			metricInfo,
+			MarkForwarded(labels.Everything()))
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(val.DescribedObject.Name).To(Equal(remotePod))
+		Expect(forwarder.forwardedByName).To(BeEmpty())
+	})
+
+	Describe("MarkForwarded", func() {
+		It("should add the marker, without affecting which label sets the selector matches", func() {
+			// Arrange
+			selector := labels.SelectorFromSet(labels.Set{"a": "b"})
+
+			// Act
+			result := MarkForwarded(selector)
+
+			// Assert
+			Expect(isForwarded(result)).To(BeTrue())
+			Expect(isForwarded(selector)).To(BeFalse())
+			Expect(result.Matches(labels.Set{"a": "b"})).To(BeTrue())
+			Expect(result.Matches(labels.Set{"a": "c"})).To(BeFalse())
+		})
+
+		It("should treat a nil selector as selecting everything", func() {
+			// Act
+			result := MarkForwarded(nil)
+
+			// Assert
+			Expect(isForwarded(result)).To(BeTrue())
+			Expect(result.Matches(labels.Set{"a": "b"})).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,231 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package probe implements a troubleshooting client for the custom metrics API served by the application. It queries
+// the API the same way an autoscaler would, and explains why a metric is, or is not, available for a given pod.
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	custommetricsv1beta2 "k8s.io/metrics/pkg/apis/custom_metrics/v1beta2"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/metrics_provider"
+)
+
+// The root path of the custom metrics API version queried by the probe
+const customMetricsAPIPath = "/apis/custom.metrics.k8s.io/v1beta2"
+
+// Options are the command line options of the probe
+type Options struct {
+	Kubeconfig            string        // Path to a kubeconfig file. Default: the standard kubeconfig loading rules
+	Server                string        // If not empty, overrides the API server address from the kubeconfig
+	InsecureSkipTLSVerify bool          // Do not verify the server's certificate
+	Namespace             string        // The namespace of the probed pod
+	Pod                   string        // The name of the probed pod
+	RequestRateMetricName string        // The name under which the adapter serves the request rate
+	SampleAgeMetricName   string        // The name under which the adapter serves the sample age
+	MaxSampleAge          time.Duration // Must match the adapter's --max-sample-age option
+	MaxSampleGap          time.Duration // Must match the adapter's --max-sample-gap option
+}
+
+// NewOptions creates an Options object with default values
+func NewOptions() *Options {
+	return &Options{
+		RequestRateMetricName: metrics_provider.RequestRateMetricName,
+		SampleAgeMetricName:   metrics_provider.SampleAgeMetricName,
+		MaxSampleAge:          metrics_provider.DefaultMaxSampleAge,
+		MaxSampleGap:          metrics_provider.DefaultMaxSampleGap,
+	}
+}
+
+// AddFlags binds the options to the specified flag set
+func (options *Options) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&options.Kubeconfig, "kubeconfig", options.Kubeconfig,
+		"Path to the kubeconfig file used to access the custom metrics API. Default: the standard kubeconfig "+
+			"loading rules")
+	flags.StringVar(&options.Server, "server", options.Server,
+		"Address of the server to query. Overrides the one in the kubeconfig. Use it to query an adapter replica "+
+			"directly, instead of the aggregated API.")
+	flags.BoolVar(&options.InsecureSkipTLSVerify, "insecure-skip-tls-verify", options.InsecureSkipTLSVerify,
+		"Do not verify the server's certificate")
+	flags.StringVar(&options.Namespace, "namespace", options.Namespace, "The namespace of the pod to probe")
+	flags.StringVar(&options.Pod, "pod", options.Pod, "The name of the kube-apiserver pod to probe")
+	flags.StringVar(&options.RequestRateMetricName, "request-rate-metric", options.RequestRateMetricName,
+		"The name under which the adapter serves the request rate metric")
+	flags.StringVar(&options.SampleAgeMetricName, "sample-age-metric", options.SampleAgeMetricName,
+		"The name under which the adapter serves the sample age metric")
+	flags.DurationVar(&options.MaxSampleAge, "max-sample-age", options.MaxSampleAge,
+		"The adapter's --max-sample-age setting")
+	flags.DurationVar(&options.MaxSampleGap, "max-sample-gap", options.MaxSampleGap,
+		"The adapter's --max-sample-gap setting")
+}
+
+// Validate checks the options for missing and invalid values
+func (options *Options) Validate() error {
+	if options.Namespace == "" || options.Pod == "" {
+		return fmt.Errorf("both --namespace and --pod must be specified")
+	}
+	if options.MaxSampleAge <= 0 || options.MaxSampleGap <= 0 {
+		return fmt.Errorf("--max-sample-age and --max-sample-gap must be positive")
+	}
+	return nil
+}
+
+// RESTConfig returns the client configuration for accessing the custom metrics API, as specified by the options
+func (options *Options) RESTConfig() (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = options.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{}
+	overrides.ClusterInfo.Server = options.Server
+	overrides.ClusterInfo.InsecureSkipTLSVerify = options.InsecureSkipTLSVerify
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("creating client configuration: %w", err)
+	}
+	return config, nil
+}
+
+// Prober queries the custom metrics API for the metrics of a single pod, and explains the outcome
+type Prober struct {
+	client        rest.Interface
+	options       *Options
+	testIsolation proberTestIsolation
+}
+
+// NewProber creates a Prober which accesses the custom metrics API based on the specified client configuration
+func NewProber(config *rest.Config, options *Options) (*Prober, error) {
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+
+	return &Prober{
+		client:        clientSet.Discovery().RESTClient(),
+		options:       options,
+		testIsolation: proberTestIsolation{TimeNow: time.Now},
+	}, nil
+}
+
+// Run queries the custom metrics API, and writes a human-readable report to out. Returns an error if the API cannot be
+// reached, or if it does not serve the request rate for the probed pod.
+func (p *Prober) Run(ctx context.Context, out io.Writer) error {
+	resources := &metav1.APIResourceList{}
+	if err := p.get(ctx, customMetricsAPIPath, resources); err != nil {
+		return fmt.Errorf("listing the custom metrics API. Check that the adapter's APIService is available: %w", err)
+	}
+	fmt.Fprintf(out, "Available custom metrics (%d):\n", len(resources.APIResources))
+	for _, resource := range resources.APIResources {
+		fmt.Fprintf(out, "  %s\n", resource.Name)
+	}
+
+	fmt.Fprintf(out, "Pod %s/%s:\n", p.options.Namespace, p.options.Pod)
+	rate := p.getPodMetric(ctx, out, p.options.RequestRateMetricName)
+	sampleAge := p.getPodMetric(ctx, out, p.options.SampleAgeMetricName)
+
+	fmt.Fprintf(out, "Diagnosis: %s\n", diagnose(rate, sampleAge, p.testIsolation.TimeNow(), p.options))
+	if rate == nil {
+		return fmt.Errorf("metric %s is not available for pod %s/%s",
+			p.options.RequestRateMetricName, p.options.Namespace, p.options.Pod)
+	}
+	return nil
+}
+
+// getPodMetric fetches the value of the specified metric for the probed pod, and reports it to out. Returns nil if the
+// metric is not available.
+//
+// The value is looked up among the values for all pods in the namespace, as an autoscaler would do, rather than by pod
+// name, because the adapter does not report an absent value for a named pod as "not found".
+func (p *Prober) getPodMetric(ctx context.Context, out io.Writer, metricName string) *custommetricsv1beta2.MetricValue {
+	path := fmt.Sprintf("%s/namespaces/%s/pods/*/%s", customMetricsAPIPath, p.options.Namespace, metricName)
+	values := &custommetricsv1beta2.MetricValueList{}
+	if err := p.get(ctx, path, values); err != nil {
+		fmt.Fprintf(out, "  %s: not available (%s)\n", metricName, err)
+		return nil
+	}
+
+	for i := range values.Items {
+		value := &values.Items[i]
+		if value.DescribedObject.Name != p.options.Pod {
+			continue
+		}
+		window := ""
+		if value.WindowSeconds != nil {
+			window = fmt.Sprintf(", window %ds", *value.WindowSeconds)
+		}
+		fmt.Fprintf(out, "  %s: %s (at %s%s)\n",
+			metricName, value.Value.String(), value.Timestamp.UTC().Format(time.RFC3339), window)
+		return value
+	}
+
+	fmt.Fprintf(out, "  %s: not available\n", metricName)
+	return nil
+}
+
+// get retrieves the object at the specified API path, and decodes it into result
+func (p *Prober) get(ctx context.Context, path string, result any) error {
+	body, err := p.client.Get().AbsPath(path).DoRaw(ctx)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("decoding the response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// diagnose explains why the request rate is, or is not, available, based on the metric values served for a pod. Any of
+// the values may be nil, if absent. The sample age metric is timestamped with the time of the most recent sample, and
+// the request rate window tells how far back the sample before it was taken.
+func diagnose(
+	rate *custommetricsv1beta2.MetricValue,
+	sampleAge *custommetricsv1beta2.MetricValue,
+	now time.Time,
+	options *Options) string {
+
+	if rate != nil {
+		return "the request rate is served"
+	}
+	if sampleAge == nil {
+		return string(metrics_provider.NoSamples) + ". Check that the pod exists, that it is a kube-apiserver pod " +
+			"with the labels the adapter watches for, and that its namespace is not excluded by the adapter's " +
+			"namespace filter. In sharded HA mode, query the replica which owns the namespace."
+	}
+
+	// Without the request rate, the time of the sample before the most recent one is unknown
+	freshness := metrics_provider.CheckSampleFreshness(
+		sampleAge.Timestamp.Time, time.Time{}, now, options.MaxSampleAge, options.MaxSampleGap)
+	switch freshness {
+	case metrics_provider.SamplesTooOld:
+		return fmt.Sprintf("%s (%s). Check the adapter's log for scrape errors for the pod.",
+			freshness, options.MaxSampleAge)
+	case metrics_provider.SingleSample:
+		return fmt.Sprintf("fewer than two samples recorded, or the two most recent samples are further apart "+
+			"than the max sample gap (%s). If the pod has just started, retry after a couple of scrape periods.",
+			options.MaxSampleGap)
+	default:
+		return string(freshness)
+	}
+}
+
+//#region Test isolation
+
+// proberTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the Prober unit during tests
+type proberTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+}
+
+//#endregion Test isolation
@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	custommetricsv1beta2 "k8s.io/metrics/pkg/apis/custom_metrics/v1beta2"
+	"k8s.io/utils/ptr"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/metrics_provider"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("Prober", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "kube-apiserver-1"
+	)
+
+	var (
+		newMetricValue = func(podName string, value int64, timestamp time.Time) custommetricsv1beta2.MetricValue {
+			return custommetricsv1beta2.MetricValue{
+				DescribedObject: corev1.ObjectReference{Kind: "Pod", Namespace: testNs, Name: podName},
+				Value:           *resource.NewQuantity(value, resource.DecimalSI),
+				Timestamp:       metav1.NewTime(timestamp),
+			}
+		}
+
+		// newTestServer returns a server which serves the specified metric values for testNs
+		newTestServer = func(values map[string][]custommetricsv1beta2.MetricValue) *httptest.Server {
+			mux := http.NewServeMux()
+			mux.HandleFunc(customMetricsAPIPath, func(w http.ResponseWriter, _ *http.Request) {
+				list := metav1.APIResourceList{}
+				for name := range values {
+					list.APIResources = append(list.APIResources, metav1.APIResource{Name: "pods/" + name})
+				}
+				_ = json.NewEncoder(w).Encode(list)
+			})
+			for name, items := range values {
+				items := items
+				mux.HandleFunc(customMetricsAPIPath+"/namespaces/"+testNs+"/pods/*/"+name,
+					func(w http.ResponseWriter, _ *http.Request) {
+						_ = json.NewEncoder(w).Encode(custommetricsv1beta2.MetricValueList{Items: items})
+					})
+			}
+			return httptest.NewServer(mux)
+		}
+
+		newTestProber = func(server *httptest.Server) *Prober {
+			options := NewOptions()
+			options.Namespace = testNs
+			options.Pod = testPodName
+			prober, err := NewProber(&rest.Config{Host: server.URL}, options)
+			Expect(err).To(Succeed())
+			prober.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 1, 10)
+			return prober
+		}
+	)
+
+	Describe("Run", func() {
+		It("should report the pod's metric values, and succeed, if the request rate is served", func() {
+			// Arrange
+			rate := newMetricValue(testPodName, 12, gcmtesting.NewTime(1, 1, 0))
+			rate.WindowSeconds = ptr.To(int64(60))
+			server := newTestServer(map[string][]custommetricsv1beta2.MetricValue{
+				metrics_provider.RequestRateMetricName: {newMetricValue("other-pod", 1, gcmtesting.NewTime(1, 1, 0)), rate},
+				metrics_provider.SampleAgeMetricName:   {newMetricValue(testPodName, 10, gcmtesting.NewTime(1, 1, 0))},
+			})
+			defer server.Close()
+			out := &bytes.Buffer{}
+
+			// Act
+			err := newTestProber(server).Run(context.Background(), out)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(out.String()).To(ContainSubstring("pods/" + metrics_provider.RequestRateMetricName))
+			Expect(out.String()).To(ContainSubstring(metrics_provider.RequestRateMetricName + ": 12 ("))
+			Expect(out.String()).To(ContainSubstring("window 60s"))
+			Expect(out.String()).To(ContainSubstring("Diagnosis: the request rate is served"))
+		})
+
+		It("should explain the absence of the request rate, and fail", func() {
+			// Arrange
+			server := newTestServer(map[string][]custommetricsv1beta2.MetricValue{
+				metrics_provider.RequestRateMetricName: nil,
+				metrics_provider.SampleAgeMetricName:   {newMetricValue(testPodName, 130, gcmtesting.NewTime(0, 59, 0))},
+			})
+			defer server.Close()
+			out := &bytes.Buffer{}
+
+			// Act
+			err := newTestProber(server).Run(context.Background(), out)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(out.String()).To(ContainSubstring(metrics_provider.RequestRateMetricName + ": not available"))
+			Expect(out.String()).To(ContainSubstring(string(metrics_provider.SamplesTooOld)))
+		})
+
+		It("should fail if the custom metrics API is not available", func() {
+			// Arrange
+			server := httptest.NewServer(http.NotFoundHandler())
+			defer server.Close()
+
+			// Act
+			err := newTestProber(server).Run(context.Background(), &bytes.Buffer{})
+
+			// Assert
+			Expect(err).To(MatchError(ContainSubstring("APIService")))
+		})
+	})
+
+	DescribeTable("diagnose",
+		func(hasRate bool, sampleTime time.Time, expected string) {
+			// Arrange
+			var rate, sampleAge *custommetricsv1beta2.MetricValue
+			if hasRate {
+				value := newMetricValue(testPodName, 1, sampleTime)
+				rate = &value
+			}
+			if !sampleTime.IsZero() {
+				value := newMetricValue(testPodName, 1, sampleTime)
+				sampleAge = &value
+			}
+
+			// Act
+			result := diagnose(rate, sampleAge, gcmtesting.NewTime(1, 10, 0), NewOptions())
+
+			// Assert
+			Expect(result).To(ContainSubstring(expected))
+		},
+		Entry("rate served", true, gcmtesting.NewTime(1, 9, 30), "the request rate is served"),
+		Entry("no samples", false, time.Time{}, string(metrics_provider.NoSamples)),
+		Entry("samples too old", false, gcmtesting.NewTime(1, 5, 0), string(metrics_provider.SamplesTooOld)),
+		Entry("fresh sample without rate", false, gcmtesting.NewTime(1, 9, 30), "fewer than two samples"),
+	)
+})
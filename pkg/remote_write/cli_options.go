@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package remote_write
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	urlFlagName             = "remote-write-url"
+	periodFlagName          = "remote-write-period"
+	timeoutFlagName         = "remote-write-timeout"
+	bearerTokenFileFlagName = "remote-write-bearer-token-file"
+	usernameFlagName        = "remote-write-username"
+	passwordFileFlagName    = "remote-write-password-file"
+	caFileFlagName          = "remote-write-ca-file"
+)
+
+// CLIOptions are command line options related to exporting metrics via the Prometheus remote-write protocol.
+type CLIOptions struct {
+	config *CLIConfig // Contains the final, processed values of the options
+
+	// For the meaning of the different option fields, see the CLIConfig type, which mirrors these fields
+	URL             string
+	Period          time.Duration
+	Timeout         time.Duration
+	BearerTokenFile string
+	Username        string
+	PasswordFile    string
+	CAFile          string
+}
+
+// NewCLIOptions creates a CLIOptions object with default values
+func NewCLIOptions() *CLIOptions {
+	return &CLIOptions{
+		Period:  60 * time.Second,
+		Timeout: 30 * time.Second,
+	}
+}
+
+// AddFlags implements [github.com/gardener/gardener/extensions/pkg/controller/cmd.Flagger.AddFlags].
+func (options *CLIOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(
+		&options.URL,
+		urlFlagName,
+		options.URL,
+		"If specified, the custom metrics are periodically pushed to this Prometheus remote-write endpoint. "+
+			"Default: remote-write export disabled")
+	flags.DurationVar(
+		&options.Period,
+		periodFlagName,
+		options.Period,
+		fmt.Sprintf("How often are metrics pushed to the remote-write endpoint. Default: %s", options.Period))
+	flags.DurationVar(
+		&options.Timeout,
+		timeoutFlagName,
+		options.Timeout,
+		fmt.Sprintf("Abort a push to the remote-write endpoint if it takes longer than this. Default: %s", options.Timeout))
+	flags.StringVar(
+		&options.BearerTokenFile,
+		bearerTokenFileFlagName,
+		options.BearerTokenFile,
+		"Path to a file containing a bearer token, presented to the remote-write endpoint. Read before each push.")
+	flags.StringVar(
+		&options.Username,
+		usernameFlagName,
+		options.Username,
+		fmt.Sprintf(
+			"User name for basic authentication to the remote-write endpoint. Requires --%s.", passwordFileFlagName))
+	flags.StringVar(
+		&options.PasswordFile,
+		passwordFileFlagName,
+		options.PasswordFile,
+		"Path to a file containing the password for basic authentication to the remote-write endpoint. "+
+			"Read before each push.")
+	flags.StringVar(
+		&options.CAFile,
+		caFileFlagName,
+		options.CAFile,
+		"Path to a PEM file with CA certificates used to verify the remote-write endpoint. Default: system CAs")
+}
+
+// Complete implements [github.com/gardener/gardener/extensions/pkg/controller/cmd.Completer.Complete].
+func (options *CLIOptions) Complete() error {
+	if options.URL != "" {
+		parsedURL, err := url.Parse(options.URL)
+		if err != nil {
+			return fmt.Errorf("invalid --%s option: %w", urlFlagName, err)
+		}
+		if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+			return fmt.Errorf("invalid --%s option: the URL scheme must be http or https", urlFlagName)
+		}
+		if options.Period <= 0 {
+			return fmt.Errorf("the --%s option must be positive", periodFlagName)
+		}
+		if options.Timeout <= 0 {
+			return fmt.Errorf("the --%s option must be positive", timeoutFlagName)
+		}
+		if options.BearerTokenFile != "" && options.Username != "" {
+			return fmt.Errorf("the --%s and --%s options are mutually exclusive", bearerTokenFileFlagName, usernameFlagName)
+		}
+		if (options.Username == "") != (options.PasswordFile == "") {
+			return fmt.Errorf("the --%s and --%s options must be specified together", usernameFlagName, passwordFileFlagName)
+		}
+	}
+
+	options.config = &CLIConfig{
+		URL:             options.URL,
+		Period:          options.Period,
+		Timeout:         options.Timeout,
+		BearerTokenFile: options.BearerTokenFile,
+		Username:        options.Username,
+		PasswordFile:    options.PasswordFile,
+		CAFile:          options.CAFile,
+	}
+
+	return nil
+}
+
+// Completed returns the final, processed values of the options. Only call this if `Complete` was successful.
+func (options *CLIOptions) Completed() *CLIConfig {
+	return options.config
+}
+
+// CLIConfig is a completed configuration, result of successfully parsing and processing CLI options.
+// It contains configuration which directs the export of metrics via the Prometheus remote-write protocol.
+type CLIConfig struct {
+	URL     string        // The remote-write endpoint. Empty means remote-write export is disabled.
+	Period  time.Duration // How often are metrics pushed
+	Timeout time.Duration // Abort a push if it takes longer than this
+
+	// Authentication. At most one of BearerTokenFile and Username is specified. The files are read before each push,
+	// so credential rotation does not require a restart.
+	BearerTokenFile string // Path to a file containing a bearer token
+	Username        string // User name for basic authentication
+	PasswordFile    string // Path to a file containing the password for basic authentication
+
+	CAFile string // Path to a PEM file with CA certificates which verify the endpoint. Empty means system CAs.
+}
+
+// IsEnabled tells whether remote-write export is enabled
+func (config *CLIConfig) IsEnabled() bool {
+	return config.URL != ""
+}
@@ -0,0 +1,254 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package remote_write exports the custom metrics served by the application to a central Prometheus, via the
+// Prometheus remote-write protocol.
+package remote_write
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/snappy"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	"github.com/gardener/gardener-custom-metrics/pkg/metrics_provider"
+)
+
+// Exporter periodically pushes all custom metrics served by a [provider.CustomMetricsProvider] to a Prometheus
+// remote-write endpoint. Each metric value becomes a sample of a series with the same name as the metric, labeled
+// with the namespace and name of the pod which the value describes, and with the labels of the value's metric selector.
+//
+// Exporter implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable].
+type Exporter struct {
+	// The source of the exported metric values
+	metricsProvider provider.CustomMetricsProvider
+	// Used to track which shoot namespaces have Kapis, and thus need to be queried for metrics
+	dataSource input_data_registry.InputDataSource
+	config     *CLIConfig
+	httpClient *http.Client
+	log        logr.Logger
+
+	// Maps <shoot namespace> -> <number of Kapis in that namespace>
+	namespaces map[string]int
+	lock       sync.Mutex // Synchronises access to namespaces
+
+	testIsolation exporterTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// NewExporter creates an Exporter which pushes the metrics served by metricsProvider, for all shoots known to
+// dataSource, as directed by config.
+func NewExporter(
+	metricsProvider provider.CustomMetricsProvider,
+	dataSource input_data_registry.InputDataSource,
+	config *CLIConfig,
+	parentLogger logr.Logger) (*Exporter, error) {
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.CAFile != "" {
+		caCertificates, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("creating remote-write exporter: reading CA file: %w", err)
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(caCertificates) {
+			return nil, fmt.Errorf("creating remote-write exporter: CA file '%s' contains no certificates", config.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: certPool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &Exporter{
+		metricsProvider: metricsProvider,
+		dataSource:      dataSource,
+		config:          config,
+		httpClient:      &http.Client{Transport: transport},
+		log:             parentLogger.WithName("remote-write"),
+		namespaces:      make(map[string]int),
+		testIsolation: exporterTestIsolation{
+			TimeNow:   time.Now,
+			TimeAfter: time.After,
+			ReadFile:  os.ReadFile,
+		},
+	}, nil
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It pushes metrics once per period,
+// until the context is cancelled. Push failures are logged, and do not stop the exporter.
+func (e *Exporter) Start(ctx context.Context) error {
+	log := e.log.WithValues("op", "remoteWriteProc")
+	log.V(app.VerbosityVerbose).Info("Remote-write exporter started", "period", e.config.Period)
+
+	var watcher input_data_registry.KapiWatcher = e.onKapiUpdated
+	e.dataSource.AddKapiWatcher(&watcher, true)
+	defer e.dataSource.RemoveKapiWatcher(&watcher)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.V(app.VerbosityInfo).Info("Context closed, exiting")
+			return nil
+		case <-e.testIsolation.TimeAfter(e.config.Period):
+			if err := e.push(ctx); err != nil {
+				log.V(app.VerbosityError).Error(err, "Failed to push metrics to remote-write endpoint")
+			}
+		}
+	}
+}
+
+// onKapiUpdated is a [input_data_registry.KapiWatcher] which tracks the shoot namespaces containing Kapis
+func (e *Exporter) onKapiUpdated(kapi input_data_registry.ShootKapi, event input_data_registry.KapiEventType) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	switch event {
+	case input_data_registry.KapiEventCreate:
+		e.namespaces[kapi.ShootNamespace()]++
+	case input_data_registry.KapiEventDelete:
+		e.namespaces[kapi.ShootNamespace()]--
+		if e.namespaces[kapi.ShootNamespace()] <= 0 {
+			delete(e.namespaces, kapi.ShootNamespace())
+		}
+	}
+}
+
+// getNamespaces returns the shoot namespaces which currently contain Kapis
+func (e *Exporter) getNamespaces() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	result := make([]string, 0, len(e.namespaces))
+	for namespace := range e.namespaces {
+		result = append(result, namespace)
+	}
+	return result
+}
+
+// collect returns the current values of all metrics served by the provider, as remote-write series. All samples are
+// stamped with the time of the call, same as if they were scraped by Prometheus at that time.
+func (e *Exporter) collect(ctx context.Context) ([]timeSeries, error) {
+	timestamp := e.testIsolation.TimeNow().UnixMilli()
+	var result []timeSeries
+	for _, namespace := range e.getNamespaces() {
+		for _, metricInfo := range e.metricsProvider.ListAllMetrics() {
+			// The export does not count as a query of the shoot's metrics
+			values, err := e.metricsProvider.GetMetricBySelector(
+				metrics_provider.WithoutQueryObservation(ctx), namespace, labels.Everything(), metricInfo, labels.Everything())
+			if err != nil {
+				return nil, fmt.Errorf("collecting metric %s for namespace %s: %w", metricInfo.Metric, namespace, err)
+			}
+
+			for _, value := range values.Items {
+				seriesLabels := []label{
+					{Name: "__name__", Value: metricInfo.Metric},
+					{Name: "namespace", Value: value.DescribedObject.Namespace},
+					{Name: "pod", Value: value.DescribedObject.Name},
+				}
+				// Static labels configured on the provider are carried by the metric selector
+				if value.Metric.Selector != nil {
+					for name, labelValue := range value.Metric.Selector.MatchLabels {
+						seriesLabels = append(seriesLabels, label{Name: name, Value: labelValue})
+					}
+				}
+				result = append(result, timeSeries{
+					Labels:    seriesLabels,
+					Value:     value.Value.AsApproximateFloat64(),
+					Timestamp: timestamp,
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// push sends the current values of all metrics to the remote-write endpoint
+func (e *Exporter) push(ctx context.Context) error {
+	series, err := e.collect(ctx)
+	if err != nil {
+		return err
+	}
+	if len(series) == 0 {
+		e.log.V(app.VerbosityVerbose).Info("No metrics to push")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.config.Timeout)
+	defer cancel()
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating remote-write request: %w", err)
+	}
+	request.Header.Set("Content-Encoding", "snappy")
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	request.Header.Set("User-Agent", app.Name)
+	request.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if err := e.setAuthHeader(request); err != nil {
+		return err
+	}
+
+	response, err := e.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("sending remote-write request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf(
+			"remote-write endpoint responded with HTTP status %d: %s", response.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	e.log.V(app.VerbosityVerbose).Info("Metrics pushed", "seriesCount", len(series))
+	return nil
+}
+
+// setAuthHeader sets the request's Authorization header, according to the configured authentication method.
+// Credential files are read on each call, so rotated credentials take effect without a restart.
+func (e *Exporter) setAuthHeader(request *http.Request) error {
+	switch {
+	case e.config.BearerTokenFile != "":
+		token, err := e.testIsolation.ReadFile(e.config.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("reading remote-write bearer token file: %w", err)
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	case e.config.Username != "":
+		password, err := e.testIsolation.ReadFile(e.config.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("reading remote-write password file: %w", err)
+		}
+		request.SetBasicAuth(e.config.Username, strings.TrimSpace(string(password)))
+	}
+
+	return nil
+}
+
+//#region Test isolation
+
+// exporterTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the Exporter unit during tests
+type exporterTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+	// Points to [time.After]
+	TimeAfter func(time.Duration) <-chan time.Time
+	// Points to [os.ReadFile]
+	ReadFile func(name string) ([]byte, error)
+}
+
+//#endregion Test isolation
@@ -0,0 +1,249 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package remote_write
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/snappy"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+// fakeMetricsProvider serves a single metric, with value 42 for a single pod named "<namespace>-pod" in each namespace.
+// The metric selector of each value matches selectorLabels, if any.
+type fakeMetricsProvider struct {
+	selectorLabels map[string]string
+}
+
+const fakeMetricName = "my:metric"
+
+func (p *fakeMetricsProvider) ListAllMetrics() []provider.CustomMetricInfo {
+	return []provider.CustomMetricInfo{
+		{GroupResource: schema.GroupResource{Resource: "pods"}, Metric: fakeMetricName, Namespaced: true},
+	}
+}
+
+func (p *fakeMetricsProvider) GetMetricByName(
+	context.Context, types.NamespacedName, provider.CustomMetricInfo, labels.Selector) (*custom_metrics.MetricValue, error) {
+
+	return nil, errors.New("not implemented")
+}
+
+func (p *fakeMetricsProvider) GetMetricBySelector(
+	_ context.Context,
+	namespace string,
+	_ labels.Selector,
+	_ provider.CustomMetricInfo,
+	_ labels.Selector) (*custom_metrics.MetricValueList, error) {
+
+	value := custom_metrics.MetricValue{
+		DescribedObject: custom_metrics.ObjectReference{Namespace: namespace, Name: namespace + "-pod"},
+		Metric:          custom_metrics.MetricIdentifier{Name: fakeMetricName},
+		Value:           *resource.NewQuantity(42, resource.DecimalSI),
+	}
+	if p.selectorLabels != nil {
+		value.Metric.Selector = &metav1.LabelSelector{MatchLabels: p.selectorLabels}
+	}
+	return &custom_metrics.MetricValueList{Items: []custom_metrics.MetricValue{value}}, nil
+}
+
+var _ = Describe("remote_write.Exporter", func() {
+	const (
+		nsName = "shoot--my-shoot"
+	)
+
+	var (
+		// Creates an exporter which tracks a real registry with one Kapi, and pushes to a test HTTP server which
+		// records the last request. The returned function provides the last request and its body.
+		newTestExporter = func(config *CLIConfig, responseStatus int) (
+			*Exporter, input_data_registry.InputDataRegistry, *httptest.Server, func() (*http.Request, []byte)) {
+
+			var lock sync.Mutex
+			var lastRequest http.Request
+			var lastBody []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				lock.Lock()
+				lastRequest, lastBody = *r, body
+				lock.Unlock()
+				w.WriteHeader(responseStatus)
+			}))
+			DeferCleanup(server.Close)
+
+			idr := input_data_registry.NewInputDataRegistry(0, logr.Discard())
+			idr.SetKapiData(nsName, "pod", "", nil, "")
+			config.URL = server.URL
+			config.Timeout = time.Minute
+			exporter, err := NewExporter(&fakeMetricsProvider{}, idr.DataSource(), config, logr.Discard())
+			Expect(err).To(Succeed())
+			exporter.testIsolation.TimeNow = gcmtesting.NewTimeNowStub(1, 0, 0)
+			exporter.testIsolation.ReadFile = func(name string) ([]byte, error) {
+				return []byte("secret-from-" + name + "\n"), nil
+			}
+			var watcher input_data_registry.KapiWatcher = exporter.onKapiUpdated
+			idr.AddKapiWatcher(&watcher, true)
+			DeferCleanup(idr.RemoveKapiWatcher, &watcher)
+			Eventually(exporter.getNamespaces).ShouldNot(BeEmpty())
+
+			getLastRequest := func() (*http.Request, []byte) {
+				lock.Lock()
+				defer lock.Unlock()
+				request := lastRequest
+				return &request, lastBody
+			}
+			return exporter, idr, server, getLastRequest
+		}
+	)
+
+	Describe("push", func() {
+		It("should send all metrics for all namespaces with Kapis, as a snappy-compressed remote-write request", func() {
+			// Arrange
+			exporter, _, _, getLastRequest := newTestExporter(&CLIConfig{}, http.StatusNoContent)
+
+			// Act
+			err := exporter.push(context.Background())
+
+			// Assert
+			request, body := getLastRequest()
+			Expect(err).To(Succeed())
+			Expect(request.Method).To(Equal(http.MethodPost))
+			Expect(request.Header.Get("Content-Encoding")).To(Equal("snappy"))
+			Expect(request.Header.Get("Content-Type")).To(Equal("application/x-protobuf"))
+			Expect(request.Header.Get("X-Prometheus-Remote-Write-Version")).To(Equal("0.1.0"))
+			Expect(request.Header.Get("Authorization")).To(BeEmpty())
+			message, err := snappy.Decode(nil, body)
+			Expect(err).To(Succeed())
+			Expect(decodeWriteRequest(message)).To(Equal([]timeSeries{{
+				Labels: []label{
+					{Name: "__name__", Value: fakeMetricName},
+					{Name: "namespace", Value: nsName},
+					{Name: "pod", Value: nsName + "-pod"},
+				},
+				Value:     42,
+				Timestamp: gcmtesting.NewTime(1, 0, 0).UnixMilli(),
+			}}))
+		})
+
+		It("should add the labels of the metric selector to the series", func() {
+			// Arrange
+			exporter, _, _, getLastRequest := newTestExporter(&CLIConfig{}, http.StatusNoContent)
+			exporter.metricsProvider = &fakeMetricsProvider{selectorLabels: map[string]string{"seed": "my-seed"}}
+
+			// Act
+			err := exporter.push(context.Background())
+
+			// Assert
+			_, body := getLastRequest()
+			Expect(err).To(Succeed())
+			message, err := snappy.Decode(nil, body)
+			Expect(err).To(Succeed())
+			series := decodeWriteRequest(message)
+			Expect(series).To(HaveLen(1))
+			Expect(series[0].Labels).To(ContainElement(label{Name: "seed", Value: "my-seed"}))
+			Expect(series[0].Labels).To(HaveLen(4))
+		})
+
+		It("should not send anything, once the last Kapi is removed", func() {
+			// Arrange
+			exporter, idr, _, getLastRequest := newTestExporter(&CLIConfig{}, http.StatusNoContent)
+			idr.RemoveKapiData(nsName, "pod")
+			Eventually(exporter.getNamespaces).Should(BeEmpty())
+
+			// Act
+			err := exporter.push(context.Background())
+
+			// Assert
+			request, _ := getLastRequest()
+			Expect(err).To(Succeed())
+			Expect(request.Method).To(BeEmpty())
+		})
+
+		It("should present the bearer token read from the token file", func() {
+			// Arrange
+			exporter, _, _, getLastRequest := newTestExporter(&CLIConfig{BearerTokenFile: "token"}, http.StatusOK)
+
+			// Act
+			err := exporter.push(context.Background())
+
+			// Assert
+			request, _ := getLastRequest()
+			Expect(err).To(Succeed())
+			Expect(request.Header.Get("Authorization")).To(Equal("Bearer secret-from-token"))
+		})
+
+		It("should use basic authentication with the password read from the password file", func() {
+			// Arrange
+			exporter, _, _, getLastRequest :=
+				newTestExporter(&CLIConfig{Username: "user", PasswordFile: "password"}, http.StatusOK)
+
+			// Act
+			err := exporter.push(context.Background())
+
+			// Assert
+			request, _ := getLastRequest()
+			Expect(err).To(Succeed())
+			username, password, ok := request.BasicAuth()
+			Expect(ok).To(BeTrue())
+			Expect(username).To(Equal("user"))
+			Expect(password).To(Equal("secret-from-password"))
+		})
+
+		It("should return an error if the endpoint responds with a non-success status", func() {
+			// Arrange
+			exporter, _, _, _ := newTestExporter(&CLIConfig{}, http.StatusBadRequest)
+
+			// Act
+			err := exporter.push(context.Background())
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("400"))
+		})
+	})
+
+	Describe("Start", func() {
+		It("should push when the period elapses, and exit when the context is cancelled", func() {
+			// Arrange
+			exporter, _, _, getLastRequest := newTestExporter(&CLIConfig{Period: time.Minute}, http.StatusOK)
+			exporter.dataSource = input_data_registry.NewInputDataRegistry(0, logr.Discard()).DataSource()
+			timeChannel := make(chan time.Time)
+			exporter.testIsolation.TimeAfter = func(time.Duration) <-chan time.Time { return timeChannel }
+			ctx, cancel := context.WithCancel(context.Background())
+			exited := make(chan struct{})
+
+			// Act
+			go func() {
+				defer close(exited)
+				Expect(exporter.Start(ctx)).To(Succeed())
+			}()
+			timeChannel <- time.Now()
+			timeChannel <- time.Now() // Blocks until the first push completes
+
+			// Assert
+			request, _ := getLastRequest()
+			Expect(request.Method).To(Equal(http.MethodPost))
+			cancel()
+			Eventually(exited).Should(BeClosed())
+		})
+	})
+})
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package remote_write
+
+import (
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the Prometheus remote-write (v1) protobuf messages. See prometheus/prompb/types.proto and
+// prometheus/prompb/remote.proto.
+const (
+	writeRequestTimeSeriesField = 1 // WriteRequest.timeseries
+	timeSeriesLabelsField       = 1 // TimeSeries.labels
+	timeSeriesSamplesField      = 2 // TimeSeries.samples
+	labelNameField              = 1 // Label.name
+	labelValueField             = 2 // Label.value
+	sampleValueField            = 1 // Sample.value
+	sampleTimestampField        = 2 // Sample.timestamp
+)
+
+// label is a single Prometheus label
+type label struct {
+	Name  string
+	Value string
+}
+
+// timeSeries is a single Prometheus time series, with a single sample
+type timeSeries struct {
+	Labels    []label
+	Value     float64
+	Timestamp int64 // Milliseconds since the epoch
+}
+
+// encodeWriteRequest encodes the specified series as a Prometheus remote-write WriteRequest protobuf message.
+// The labels of each series are sorted by name, as required by the protocol. The input is not modified.
+//
+// The message is small and fixed, so it is encoded directly, rather than via code generated from the .proto files.
+func encodeWriteRequest(series []timeSeries) []byte {
+	var result []byte
+	for _, ts := range series {
+		result = protowire.AppendTag(result, writeRequestTimeSeriesField, protowire.BytesType)
+		result = protowire.AppendBytes(result, encodeTimeSeries(ts))
+	}
+	return result
+}
+
+func encodeTimeSeries(ts timeSeries) []byte {
+	labels := make([]label, len(ts.Labels))
+	copy(labels, ts.Labels)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+	var result []byte
+	for _, l := range labels {
+		var encodedLabel []byte
+		encodedLabel = protowire.AppendTag(encodedLabel, labelNameField, protowire.BytesType)
+		encodedLabel = protowire.AppendString(encodedLabel, l.Name)
+		encodedLabel = protowire.AppendTag(encodedLabel, labelValueField, protowire.BytesType)
+		encodedLabel = protowire.AppendString(encodedLabel, l.Value)
+
+		result = protowire.AppendTag(result, timeSeriesLabelsField, protowire.BytesType)
+		result = protowire.AppendBytes(result, encodedLabel)
+	}
+
+	var encodedSample []byte
+	encodedSample = protowire.AppendTag(encodedSample, sampleValueField, protowire.Fixed64Type)
+	encodedSample = protowire.AppendFixed64(encodedSample, math.Float64bits(ts.Value))
+	encodedSample = protowire.AppendTag(encodedSample, sampleTimestampField, protowire.VarintType)
+	encodedSample = protowire.AppendVarint(encodedSample, uint64(ts.Timestamp))
+
+	result = protowire.AppendTag(result, timeSeriesSamplesField, protowire.BytesType)
+	result = protowire.AppendBytes(result, encodedSample)
+
+	return result
+}
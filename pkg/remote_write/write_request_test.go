@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package remote_write
+
+import (
+	"math"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest is the inverse of encodeWriteRequest. It fails the test if the message is malformed.
+func decodeWriteRequest(message []byte) []timeSeries {
+	var result []timeSeries
+	forEachField(message, func(number protowire.Number, value []byte, _ uint64) {
+		Expect(number).To(Equal(protowire.Number(writeRequestTimeSeriesField)))
+		ts := timeSeries{}
+		forEachField(value, func(number protowire.Number, value []byte, _ uint64) {
+			switch number {
+			case timeSeriesLabelsField:
+				l := label{}
+				forEachField(value, func(number protowire.Number, value []byte, _ uint64) {
+					if number == labelNameField {
+						l.Name = string(value)
+					} else {
+						l.Value = string(value)
+					}
+				})
+				ts.Labels = append(ts.Labels, l)
+			case timeSeriesSamplesField:
+				forEachField(value, func(number protowire.Number, _ []byte, scalar uint64) {
+					if number == sampleValueField {
+						ts.Value = math.Float64frombits(scalar)
+					} else {
+						ts.Timestamp = int64(scalar)
+					}
+				})
+			}
+		})
+		result = append(result, ts)
+	})
+	return result
+}
+
+// forEachField calls fn for each field in the message. Length-delimited fields are passed as value, all other fields
+// are passed as scalar.
+func forEachField(message []byte, fn func(number protowire.Number, value []byte, scalar uint64)) {
+	for len(message) > 0 {
+		number, fieldType, n := protowire.ConsumeTag(message)
+		Expect(n).To(BeNumerically(">", 0))
+		message = message[n:]
+		switch fieldType {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(message)
+			Expect(n).To(BeNumerically(">", 0))
+			fn(number, value, 0)
+			message = message[n:]
+		case protowire.Fixed64Type:
+			value, n := protowire.ConsumeFixed64(message)
+			Expect(n).To(BeNumerically(">", 0))
+			fn(number, nil, value)
+			message = message[n:]
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(message)
+			Expect(n).To(BeNumerically(">", 0))
+			fn(number, nil, value)
+			message = message[n:]
+		default:
+			Fail("unexpected protobuf field type")
+		}
+	}
+}
+
+var _ = Describe("remote_write.encodeWriteRequest", func() {
+	It("should encode all series, with labels sorted by name", func() {
+		// Arrange
+		series := []timeSeries{
+			{
+				Labels:    []label{{Name: "pod", Value: "p1"}, {Name: "__name__", Value: "m1"}, {Name: "namespace", Value: "ns"}},
+				Value:     1.5,
+				Timestamp: 1000,
+			},
+			{
+				Labels:    []label{{Name: "__name__", Value: "m2"}},
+				Value:     -3,
+				Timestamp: 2000,
+			},
+		}
+
+		// Act
+		result := decodeWriteRequest(encodeWriteRequest(series))
+
+		// Assert
+		Expect(result).To(HaveLen(2))
+		Expect(result[0].Labels).To(Equal(
+			[]label{{Name: "__name__", Value: "m1"}, {Name: "namespace", Value: "ns"}, {Name: "pod", Value: "p1"}}))
+		Expect(result[0].Value).To(Equal(1.5))
+		Expect(result[0].Timestamp).To(Equal(int64(1000)))
+		Expect(result[1]).To(Equal(series[1]))
+	})
+
+	It("should not modify the input", func() {
+		// Arrange
+		series := []timeSeries{{Labels: []label{{Name: "pod", Value: "p1"}, {Name: "__name__", Value: "m1"}}}}
+
+		// Act
+		encodeWriteRequest(series)
+
+		// Assert
+		Expect(series[0].Labels[0].Name).To(Equal("pod"))
+	})
+})
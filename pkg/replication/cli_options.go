@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package replication
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	enabledFlagName   = "replication"
+	periodFlagName    = "replication-period"
+	peerPortFlagName  = "replication-peer-port"
+	tokenFileFlagName = "replication-token-file"
+)
+
+// CLIOptions are command line options related to replicating the leader's registry to standby replicas. They only take
+// effect in active-passive HA mode.
+type CLIOptions struct {
+	config *CLIConfig // Contains the final, processed values of the options
+
+	// For the meaning of the different option fields, see the CLIConfig type, which mirrors these fields
+	Enabled   bool
+	Period    time.Duration
+	PeerPort  int
+	TokenFile string
+}
+
+// NewCLIOptions creates a CLIOptions object with default values
+func NewCLIOptions() *CLIOptions {
+	return &CLIOptions{
+		Period:   10 * time.Second,
+		PeerPort: 8080,
+	}
+}
+
+// AddFlags implements [github.com/gardener/gardener/extensions/pkg/controller/cmd.Flagger.AddFlags].
+func (options *CLIOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&options.Enabled, enabledFlagName, options.Enabled,
+		"In active-passive HA mode, standby replicas periodically copy the leader's Kapi metrics records, so a new "+
+			"leader can compute metrics right after failover, instead of waiting for fresh samples. Default: false")
+	flags.DurationVar(&options.Period, periodFlagName, options.Period,
+		fmt.Sprintf("How often standby replicas copy the leader's Kapi metrics records. Default: %s", options.Period))
+	flags.IntVar(&options.PeerPort, peerPortFlagName, options.PeerPort,
+		fmt.Sprintf(
+			"The port of the leader's metrics server (see --metrics-bind-address), where standby replicas fetch the "+
+				"leader's Kapi metrics records. Default: %d",
+			options.PeerPort))
+	flags.StringVar(&options.TokenFile, tokenFileFlagName, options.TokenFile,
+		"The path to a file containing a token shared by all replicas, e.g. mounted from a secret. The leader serves "+
+			"its Kapi metrics records only to requests which carry the token. Required if replication is enabled.")
+}
+
+// Complete implements [github.com/gardener/gardener/extensions/pkg/controller/cmd.Completer.Complete].
+func (options *CLIOptions) Complete() error {
+	if options.Period <= 0 {
+		return fmt.Errorf("the --%s option must be positive", periodFlagName)
+	}
+	if options.PeerPort <= 0 || options.PeerPort > 65535 {
+		return fmt.Errorf("the --%s option must be a valid port number", peerPortFlagName)
+	}
+
+	var token string
+	if options.Enabled {
+		if options.TokenFile == "" {
+			return fmt.Errorf("the --%s option is required, if replication is enabled", tokenFileFlagName)
+		}
+		content, err := os.ReadFile(options.TokenFile)
+		if err != nil {
+			return fmt.Errorf("reading the --%s file: %w", tokenFileFlagName, err)
+		}
+		if token = strings.TrimSpace(string(content)); token == "" {
+			return fmt.Errorf("the --%s file is empty", tokenFileFlagName)
+		}
+	}
+
+	options.config = &CLIConfig{
+		Enabled:     options.Enabled,
+		Period:      options.Period,
+		PeerPort:    options.PeerPort,
+		TokenFile:   options.TokenFile,
+		BearerToken: token,
+	}
+	return nil
+}
+
+// Completed returns the final, processed values of the options. Only call this if `Complete` was successful.
+func (options *CLIOptions) Completed() *CLIConfig {
+	return options.config
+}
+
+// CLIConfig is a completed configuration, result of successfully parsing and processing CLI options.
+// It contains configuration which directs the replication of the leader's registry to standby replicas.
+type CLIConfig struct {
+	// If true, standby replicas copy the leader's Kapi records
+	Enabled bool
+	// How often standby replicas copy the leader's Kapi records
+	Period time.Duration
+	// The port of the leader's metrics server, where the records are served at SnapshotPath
+	PeerPort int
+	// The path to the file from which BearerToken was read
+	TokenFile string
+	// The token shared by all replicas. The leader serves its records only to requests which carry it.
+	BearerToken string
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package replication
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// Counts failed attempts to copy the leader's Kapi records
+var replicationFailureCount = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "gardener_custom_metrics_replication_failures_total",
+	Help: "The number of failed attempts of a standby replica to copy the Kapi records of the leader",
+})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(replicationFailureCount)
+}
+
+// Replicator runs on a standby replica, and periodically copies the Kapi records of the leader's registry to the local
+// registry. Records which the leader no longer has are removed from the local registry. Once this replica is elected
+// leader, the Replicator stops, and the controllers and the scraper take over the local registry, starting from the
+// state copied last. The components which take over must hold off, until WaitForStop returns, because the Replicator
+// may be in the middle of a copy, upon election.
+//
+// Replicator implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable].
+type Replicator struct {
+	registry input_data_registry.InputDataRegistry
+	// Returns the IP address of the leader, or an empty string, if there is no leader
+	leaderAddress func(ctx context.Context) (string, error)
+	// The IP address of this replica. The Replicator does not copy records from itself.
+	selfIPAddress string
+	// Closed when this replica is elected leader
+	isElected <-chan struct{}
+	// Closed when Start returns
+	stopped    chan struct{}
+	config     *CLIConfig
+	httpClient *http.Client
+	log        logr.Logger
+
+	testIsolation testIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// Enables redirecting some function calls for the purposes of test isolation
+type testIsolation struct {
+	// Points to time.After
+	TimeAfter func(time.Duration) <-chan time.Time
+}
+
+// NewReplicator creates a Replicator which copies the leader's Kapi records to the specified registry, as directed by
+// config.
+//
+// leaderAddress returns the IP address of the leader, or an empty string, if there is currently no leader. The leader
+// serves its records at SnapshotPath, on config.PeerPort.
+//
+// selfIPAddress is the IP address of this replica.
+//
+// isElected is closed when this replica is elected leader. See [sigs.k8s.io/controller-runtime/pkg/manager.Manager].
+func NewReplicator(
+	registry input_data_registry.InputDataRegistry,
+	leaderAddress func(ctx context.Context) (string, error),
+	selfIPAddress string,
+	isElected <-chan struct{},
+	config *CLIConfig,
+	parentLogger logr.Logger) *Replicator {
+
+	return &Replicator{
+		registry:      registry,
+		leaderAddress: leaderAddress,
+		selfIPAddress: selfIPAddress,
+		isElected:     isElected,
+		stopped:       make(chan struct{}),
+		config:        config,
+		httpClient:    &http.Client{},
+		log:           parentLogger.WithName("replicator"),
+		testIsolation: testIsolation{TimeAfter: time.After},
+	}
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It copies the leader's records once
+// per period, until the context is cancelled, or this replica is elected leader.
+func (r *Replicator) Start(ctx context.Context) error {
+	defer close(r.stopped)
+	r.log.V(app.VerbosityInfo).Info("Replicator started")
+
+	for {
+		select {
+		case <-r.isElected:
+			r.log.V(app.VerbosityInfo).Info("Elected leader. Replicator exiting")
+			return nil
+		default:
+		}
+
+		if err := r.replicate(ctx); err != nil {
+			replicationFailureCount.Inc()
+			r.log.V(app.VerbosityError).Error(err, "Failed to copy the Kapi records of the leader")
+		}
+
+		select {
+		case <-ctx.Done():
+			r.log.V(app.VerbosityInfo).Info("Context closed. Replicator exiting")
+			return nil
+		case <-r.isElected:
+		case <-r.testIsolation.TimeAfter(r.config.Period):
+		}
+	}
+}
+
+// WaitForStop blocks until the Replicator stopped, or the context is cancelled, in which case it returns the context's
+// error. Once it returns nil, the Replicator no longer modifies the registry. Meant to hold off the components which
+// take over the registry, once this replica is elected leader. Only returns nil after Start was called.
+func (r *Replicator) WaitForStop(ctx context.Context) error {
+	select {
+	case <-r.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NeedLeaderElection implements [sigs.k8s.io/controller-runtime/pkg/manager.LeaderElectionRunnable]. The Replicator
+// runs on standby replicas.
+func (r *Replicator) NeedLeaderElection() bool {
+	return false
+}
+
+// replicate copies the leader's records once. It has no effect if there is no leader, or if this replica is the
+// leader.
+func (r *Replicator) replicate(ctx context.Context) error {
+	address, err := r.leaderAddress(ctx)
+	if err != nil {
+		return err
+	}
+	if address == "" || address == r.selfIPAddress {
+		return nil
+	}
+
+	requestCtx, cancel := context.WithTimeout(ctx, r.config.Period)
+	defer cancel()
+	go func() {
+		// Upon election, the components which take over the registry wait for the Replicator. Do not keep them waiting.
+		select {
+		case <-r.isElected:
+			cancel()
+		case <-requestCtx.Done():
+		}
+	}()
+	url := "http://" + net.JoinHostPort(address, strconv.Itoa(r.config.PeerPort)) + SnapshotPath
+	request, err := http.NewRequestWithContext(requestCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("copying the Kapi records of the leader: creating request: %w", err)
+	}
+	request.Header.Set("Authorization", "Bearer "+r.config.BearerToken)
+	response, err := r.httpClient.Do(request)
+	if err != nil {
+		if r.hasBeenElected() { // The request was cancelled upon election
+			return nil
+		}
+		return fmt.Errorf("copying the Kapi records of the leader: %w", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("copying the Kapi records of the leader at %s: status %s", address, response.Status)
+	}
+
+	kapis, err := readSnapshot(response.Body)
+	if err != nil {
+		return fmt.Errorf("copying the Kapi records of the leader at %s: %w", address, err)
+	}
+
+	if r.hasBeenElected() { // The controllers and the scraper are about to take over the registry
+		return nil
+	}
+	r.apply(kapis)
+	r.log.V(app.VerbosityVerbose).Info("Copied the Kapi records of the leader", "leader", address, "count", len(kapis))
+	return nil
+}
+
+// hasBeenElected returns true, if this replica has been elected leader
+func (r *Replicator) hasBeenElected() bool {
+	select {
+	case <-r.isElected:
+		return true
+	default:
+		return false
+	}
+}
+
+// apply makes the Kapi records in the local registry match the specified ones
+func (r *Replicator) apply(kapis []*input_data_registry.KapiData) {
+	isImported := make(map[types.NamespacedName]bool, len(kapis))
+	for _, kapi := range kapis {
+		r.registry.ImportKapiData(kapi)
+		isImported[types.NamespacedName{Namespace: kapi.ShootNamespace(), Name: kapi.PodName()}] = true
+	}
+
+	for _, namespace := range r.registry.GetShootNamespaces() {
+		for _, kapi := range r.registry.DataSource().GetShootKapis(namespace) {
+			if !isImported[types.NamespacedName{Namespace: namespace, Name: kapi.PodName()}] {
+				r.registry.RemoveKapiData(namespace, kapi.PodName())
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package replication
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+var _ = Describe("replication.Replicator", func() {
+	const selfIPAddress = "10.1.1.1"
+
+	var (
+		// Serves the specified handler at SnapshotPath, and returns the address and port of the server
+		newLeaderServer = func(handler http.Handler) (string, int) {
+			mux := http.NewServeMux()
+			mux.Handle(SnapshotPath, handler)
+			server := httptest.NewServer(mux)
+			DeferCleanup(server.Close)
+			serverURL, err := url.Parse(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			host, port, err := net.SplitHostPort(serverURL.Host)
+			Expect(err).NotTo(HaveOccurred())
+			portNumber, err := strconv.Atoi(port)
+			Expect(err).NotTo(HaveOccurred())
+			return host, portNumber
+		}
+		newReplicator = func(
+			registry input_data_registry.InputDataRegistry, leaderAddress string, port int) *Replicator {
+
+			return NewReplicator(
+				registry,
+				func(context.Context) (string, error) { return leaderAddress, nil },
+				selfIPAddress,
+				make(chan struct{}),
+				&CLIConfig{Enabled: true, Period: 5 * time.Second, PeerPort: port, BearerToken: testToken},
+				logr.Discard())
+		}
+		newLeaderHandler = func(registry input_data_registry.InputDataRegistry) *SnapshotHandler {
+			handler := NewSnapshotHandler()
+			handler.SetRegistry(registry, testToken)
+			return handler
+		}
+	)
+
+	Describe("replicate", func() {
+		It("should copy the leader's records, and remove the local records which the leader does not have", func() {
+			// Arrange
+			leaderRegistry := newTestRegistry()
+			address, port := newLeaderServer(newLeaderHandler(leaderRegistry))
+			registry := input_data_registry.NewInputDataRegistry(0, logr.Discard())
+			registry.SetKapiData("ns1", "stale", "uid3", nil, "https://10.0.0.3:443/metrics")
+			registry.SetKapiData("ns3", "stale", "uid4", nil, "https://10.0.0.4:443/metrics")
+			replicator := newReplicator(registry, address, port)
+
+			// Act
+			err := replicator.replicate(context.Background())
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(registry.GetKapiData("ns1", "stale")).To(BeNil())
+			Expect(registry.GetKapiData("ns3", "stale")).To(BeNil())
+			kapi := registry.GetKapiData("ns1", "pod1")
+			Expect(kapi).NotTo(BeNil())
+			Expect(kapi.TotalRequestCountNew).To(Equal(int64(30)))
+			Expect(kapi.TotalRequestCountOld).To(Equal(int64(10)))
+			Expect(kapi.RequestCountHistory.Len()).To(Equal(2))
+			Expect(kapi.PodLabels).To(Equal(map[string]string{"k": "v"}))
+			Expect(registry.GetKapiData("ns2", "pod2").ScrapePeriod).To(Equal(15 * time.Second))
+		})
+		It("should have no effect, if there is no leader, or if this replica is the leader", func() {
+			// Arrange
+			var requestCount int
+			address, port := newLeaderServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				requestCount++
+			}))
+			Expect(address).NotTo(Equal(selfIPAddress))
+			registry := input_data_registry.NewInputDataRegistry(0, logr.Discard())
+			registry.SetKapiData("ns1", "pod1", "uid1", nil, "https://10.0.0.1:443/metrics")
+
+			// Act
+			errNoLeader := newReplicator(registry, "", port).replicate(context.Background())
+			errSelf := newReplicator(registry, selfIPAddress, port).replicate(context.Background())
+
+			// Assert
+			Expect(errNoLeader).NotTo(HaveOccurred())
+			Expect(errSelf).NotTo(HaveOccurred())
+			Expect(requestCount).To(BeZero())
+			Expect(registry.GetKapiData("ns1", "pod1")).NotTo(BeNil())
+		})
+		It("should fail, and leave the local records as they are, if the leader does not serve a snapshot", func() {
+			// Arrange
+			address, port := newLeaderServer(NewSnapshotHandler()) // No registry, so it responds with 503
+			registry := input_data_registry.NewInputDataRegistry(0, logr.Discard())
+			registry.SetKapiData("ns1", "pod1", "uid1", nil, "https://10.0.0.1:443/metrics")
+
+			// Act
+			err := newReplicator(registry, address, port).replicate(context.Background())
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("503"))
+			Expect(registry.GetKapiData("ns1", "pod1")).NotTo(BeNil())
+		})
+		It("should fail, and leave the local records as they are, if the leader rejects the token", func() {
+			// Arrange
+			leaderHandler := NewSnapshotHandler()
+			leaderHandler.SetRegistry(newTestRegistry(), "other-token")
+			address, port := newLeaderServer(leaderHandler)
+			registry := input_data_registry.NewInputDataRegistry(0, logr.Discard())
+			registry.SetKapiData("ns1", "stale", "uid3", nil, "https://10.0.0.3:443/metrics")
+
+			// Act
+			err := newReplicator(registry, address, port).replicate(context.Background())
+
+			// Assert
+			Expect(err).To(MatchError(ContainSubstring("401")))
+			Expect(registry.GetKapiData("ns1", "stale")).NotTo(BeNil())
+		})
+		It("should fail, if the leader address cannot be determined", func() {
+			// Arrange
+			replicator := newReplicator(input_data_registry.NewInputDataRegistry(0, logr.Discard()), "", 8080)
+			replicator.leaderAddress = func(context.Context) (string, error) { return "", errors.New("test error") }
+
+			// Act
+			err := replicator.replicate(context.Background())
+
+			// Assert
+			Expect(err).To(MatchError("test error"))
+		})
+		It("should not apply the snapshot, once this replica is elected leader", func() {
+			// Arrange
+			address, port := newLeaderServer(newLeaderHandler(newTestRegistry()))
+			registry := input_data_registry.NewInputDataRegistry(0, logr.Discard())
+			replicator := newReplicator(registry, address, port)
+			isElected := make(chan struct{})
+			close(isElected)
+			replicator.isElected = isElected
+
+			// Act
+			err := replicator.replicate(context.Background())
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(registry.GetShootNamespaces()).To(BeEmpty())
+		})
+		It("should abandon the request to the leader, once this replica is elected leader", func() {
+			// Arrange
+			requestReceived := make(chan struct{})
+			address, port := newLeaderServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				close(requestReceived)
+				<-r.Context().Done() // The leader never responds
+			}))
+			registry := input_data_registry.NewInputDataRegistry(0, logr.Discard())
+			replicator := newReplicator(registry, address, port)
+			isElected := make(chan struct{})
+			replicator.isElected = isElected
+			done := make(chan error)
+
+			// Act
+			go func() { done <- replicator.replicate(context.Background()) }()
+			<-requestReceived
+			close(isElected)
+
+			// Assert
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(registry.GetShootNamespaces()).To(BeEmpty())
+		})
+	})
+
+	Describe("WaitForStop", func() {
+		It("should block until Start returns", func() {
+			// Arrange
+			replicator := newReplicator(input_data_registry.NewInputDataRegistry(0, logr.Discard()), "", 8080)
+			isElected := make(chan struct{})
+			replicator.isElected = isElected
+			replicator.testIsolation.TimeAfter = func(time.Duration) <-chan time.Time { return nil }
+			waitResult := make(chan error)
+			go func() { waitResult <- replicator.WaitForStop(context.Background()) }()
+			go func() { _ = replicator.Start(context.Background()) }()
+
+			// Act and assert
+			Consistently(waitResult, 50*time.Millisecond).ShouldNot(Receive())
+			close(isElected)
+			Eventually(waitResult).Should(Receive(BeNil()))
+		})
+		It("should fail, if the context is cancelled before Start returns", func() {
+			// Arrange
+			replicator := newReplicator(input_data_registry.NewInputDataRegistry(0, logr.Discard()), "", 8080)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			// Act
+			err := replicator.WaitForStop(ctx)
+
+			// Assert
+			Expect(err).To(MatchError(context.Canceled))
+		})
+	})
+
+	Describe("Start", func() {
+		It("should replicate once per period, and exit once this replica is elected leader", func() {
+			// Arrange
+			leaderRegistry := input_data_registry.NewInputDataRegistry(0, logr.Discard())
+			address, port := newLeaderServer(newLeaderHandler(leaderRegistry))
+			registry := input_data_registry.NewInputDataRegistry(0, logr.Discard())
+			replicator := newReplicator(registry, address, port)
+			isElected := make(chan struct{})
+			replicator.isElected = isElected
+			timeAfterChan := make(chan time.Time)
+			replicator.testIsolation.TimeAfter = func(time.Duration) <-chan time.Time { return timeAfterChan }
+			done := make(chan error)
+
+			// Act and assert
+			go func() { done <- replicator.Start(context.Background()) }()
+			timeAfterChan <- time.Now() // Received after the first, empty, replication
+			Expect(registry.GetShootNamespaces()).To(BeEmpty())
+			leaderRegistry.SetKapiData("ns1", "pod1", "uid1", nil, "https://10.0.0.1:443/metrics")
+			timeAfterChan <- time.Now()
+			Eventually(func() *input_data_registry.KapiData { return registry.GetKapiData("ns1", "pod1") }).
+				ShouldNot(BeNil())
+			close(isElected)
+			Eventually(done).Should(Receive(BeNil()))
+		})
+		It("should exit when the context is cancelled", func() {
+			// Arrange
+			replicator := newReplicator(input_data_registry.NewInputDataRegistry(0, logr.Discard()), "", 8080)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			// Act
+			err := replicator.Start(ctx)
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
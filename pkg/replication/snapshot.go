@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package replication copies the Kapi records of the leader's registry to the registries of standby replicas, so that
+// upon failover, the new leader can compute metrics right away, instead of waiting until it accumulates enough samples
+// of its own.
+package replication
+
+import (
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// SnapshotPath is the path, on the controller manager's metrics server, at which a snapshot of the Kapi records in the
+// registry is exposed in JSON format, gzip-compressed if the client accepts it, to requests which carry the replicas'
+// shared bearer token. See SnapshotHandler.
+const SnapshotPath = "/registry-snapshot"
+
+// snapshot is the serialized form of the Kapi records in a registry
+type snapshot struct {
+	Kapis []snapshotKapi `json:"kapis"`
+}
+
+// snapshotKapi is the serialized form of a single Kapi record. The identity of the Kapi is not part of the data, as
+// the KapiData type does not expose it for modification.
+type snapshotKapi struct {
+	Namespace string          `json:"namespace"`
+	Pod       string          `json:"pod"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// writeSnapshot writes a snapshot of all Kapi records in the registry to the specified writer. Shoots are examined one
+// at a time, so the snapshot is not atomic across shoots.
+func writeSnapshot(w io.Writer, registry input_data_registry.InputDataRegistry) error {
+	result := snapshot{Kapis: []snapshotKapi{}}
+	for _, namespace := range registry.GetShootNamespaces() {
+		for _, shootKapi := range registry.DataSource().GetShootKapis(namespace) {
+			kapi := registry.GetKapiData(namespace, shootKapi.PodName())
+			if kapi == nil { // Removed in the meantime
+				continue
+			}
+			data, err := json.Marshal(kapi)
+			if err != nil {
+				return fmt.Errorf("writing registry snapshot: encoding Kapi %s/%s: %w", namespace, kapi.PodName(), err)
+			}
+			result.Kapis = append(result.Kapis, snapshotKapi{Namespace: namespace, Pod: kapi.PodName(), Data: data})
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		return fmt.Errorf("writing registry snapshot: %w", err)
+	}
+	return nil
+}
+
+// readSnapshot reads a snapshot written by writeSnapshot, and returns the Kapi records in it
+func readSnapshot(r io.Reader) ([]*input_data_registry.KapiData, error) {
+	var source snapshot
+	if err := json.NewDecoder(r).Decode(&source); err != nil {
+		return nil, fmt.Errorf("reading registry snapshot: %w", err)
+	}
+
+	result := make([]*input_data_registry.KapiData, 0, len(source.Kapis))
+	for _, item := range source.Kapis {
+		if item.Namespace == "" || item.Pod == "" {
+			return nil, fmt.Errorf("reading registry snapshot: a Kapi record has no namespace or pod name")
+		}
+		kapi := input_data_registry.NewKapiData(item.Namespace, item.Pod)
+		if err := json.Unmarshal(item.Data, kapi); err != nil {
+			return nil, fmt.Errorf("reading registry snapshot: decoding Kapi %s/%s: %w", item.Namespace, item.Pod, err)
+		}
+		result = append(result, kapi)
+	}
+	return result, nil
+}
+
+// SnapshotHandler is an [http.Handler] which responds with a snapshot of the Kapi records in a registry. The records
+// reveal the shoot Kapi addresses, and the metrics server is not authenticated, so the handler only serves requests
+// which carry the bearer token shared by the replicas, and responds with 401 Unauthorized to others.
+//
+// The registry and the token are specified after creation, because the handler is registered with the metrics server
+// before the registry exists. Until then, the handler responds with 503 Service Unavailable.
+type SnapshotHandler struct {
+	source atomic.Pointer[snapshotSource]
+}
+
+// snapshotSource is what a SnapshotHandler needs to serve a snapshot
+type snapshotSource struct {
+	registry    input_data_registry.InputDataRegistry
+	bearerToken string
+}
+
+// NewSnapshotHandler creates a SnapshotHandler with no registry. See SetRegistry.
+func NewSnapshotHandler() *SnapshotHandler {
+	return &SnapshotHandler{}
+}
+
+// SetRegistry specifies the registry whose Kapi records the handler serves, and the bearer token which requests must
+// carry. Concurrency-safe.
+func (h *SnapshotHandler) SetRegistry(registry input_data_registry.InputDataRegistry, bearerToken string) {
+	h.source.Store(&snapshotSource{registry: registry, bearerToken: bearerToken})
+}
+
+// ServeHTTP implements [http.Handler].
+func (h *SnapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	source := h.source.Load()
+	if source == nil {
+		http.Error(w, "the registry is not initialized yet", http.StatusServiceUnavailable)
+		return
+	}
+	token, hasToken := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !hasToken || subtle.ConstantTimeCompare([]byte(token), []byte(source.bearerToken)) != 1 {
+		http.Error(w, "the request does not carry the replicas' token", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		// Too late to report a failure via the status code. The client detects the truncated body.
+		_ = writeSnapshot(w, source.registry)
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	gzipWriter := gzip.NewWriter(w)
+	_ = writeSnapshot(gzipWriter, source.registry)
+	_ = gzipWriter.Close()
+}
@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package replication
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// The bearer token shared by the replicas in the tests
+const testToken = "test-token"
+
+// newSnapshotRequest creates a request for a snapshot, which carries testToken
+func newSnapshotRequest() *http.Request {
+	request := httptest.NewRequest(http.MethodGet, SnapshotPath, nil)
+	request.Header.Set("Authorization", "Bearer "+testToken)
+	return request
+}
+
+// newTestRegistry creates a registry with the Kapis ns1/pod1, with two request count samples, and ns2/pod2
+func newTestRegistry() input_data_registry.InputDataRegistry {
+	registry := input_data_registry.NewInputDataRegistry(0, logr.Discard())
+	registry.SetKapiData("ns1", "pod1", "uid1", map[string]string{"k": "v"}, "https://10.0.0.1:443/metrics")
+	registry.SetKapiData("ns2", "pod2", "uid2", nil, "https://10.0.0.2:443/metrics")
+	registry.SetKapiScrapeResult("ns1", "pod1", input_data_registry.KapiScrapeResult{
+		TotalRequestCount: 10,
+		ScrapeDuration:    20 * time.Millisecond,
+	})
+	registry.SetKapiScrapeResult("ns1", "pod1", input_data_registry.KapiScrapeResult{TotalRequestCount: 30})
+	registry.SetKapiScrapePeriod("ns2", "pod2", 15*time.Second)
+	return registry
+}
+
+var _ = Describe("replication.snapshot", func() {
+	Describe("writeSnapshot and readSnapshot", func() {
+		It("should reproduce the Kapi records of the registry", func() {
+			// Arrange
+			registry := newTestRegistry()
+			var buffer bytes.Buffer
+
+			// Act
+			err := writeSnapshot(&buffer, registry)
+			Expect(err).NotTo(HaveOccurred())
+			kapis, err := readSnapshot(&buffer)
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kapis).To(HaveLen(2))
+			for _, kapi := range kapis {
+				expected := registry.GetKapiData(kapi.ShootNamespace(), kapi.PodName())
+				Expect(expected).NotTo(BeNil())
+				Expect(kapi.PodUID).To(Equal(expected.PodUID))
+				Expect(kapi.MetricsUrl).To(Equal(expected.MetricsUrl))
+				Expect(kapi.ScrapePeriod).To(Equal(expected.ScrapePeriod))
+				Expect(kapi.TotalRequestCountNew).To(Equal(expected.TotalRequestCountNew))
+				Expect(kapi.MetricsTimeNew.Equal(expected.MetricsTimeNew)).To(BeTrue())
+				Expect(kapi.RequestCountHistory.Len()).To(Equal(expected.RequestCountHistory.Len()))
+				Expect(kapi.ScrapeDurationHistory.Durations()).To(Equal(expected.ScrapeDurationHistory.Durations()))
+			}
+		})
+		It("should fail on a record without a pod name", func() {
+			// Arrange
+			source := strings.NewReader(`{"kapis":[{"namespace":"ns1","data":{}}]}`)
+
+			// Act
+			kapis, err := readSnapshot(source)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(kapis).To(BeNil())
+		})
+	})
+
+	Describe("SnapshotHandler", func() {
+		It("should respond with 503, until the registry is set", func() {
+			// Arrange
+			handler := NewSnapshotHandler()
+			recorder := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(recorder, newSnapshotRequest())
+
+			// Assert
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+		})
+		It("should respond with 401, if the request does not carry the replicas' token", func() {
+			// Arrange
+			handler := NewSnapshotHandler()
+			handler.SetRegistry(newTestRegistry(), testToken)
+			noTokenRecorder := httptest.NewRecorder()
+			wrongTokenRecorder := httptest.NewRecorder()
+			wrongTokenRequest := httptest.NewRequest(http.MethodGet, SnapshotPath, nil)
+			wrongTokenRequest.Header.Set("Authorization", "Bearer wrong-token")
+
+			// Act
+			handler.ServeHTTP(noTokenRecorder, httptest.NewRequest(http.MethodGet, SnapshotPath, nil))
+			handler.ServeHTTP(wrongTokenRecorder, wrongTokenRequest)
+
+			// Assert
+			Expect(noTokenRecorder.Code).To(Equal(http.StatusUnauthorized))
+			Expect(noTokenRecorder.Body.String()).NotTo(ContainSubstring("10.0.0."))
+			Expect(wrongTokenRecorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+		It("should respond with a gzip-compressed snapshot, if the client accepts gzip", func() {
+			// Arrange
+			handler := NewSnapshotHandler()
+			handler.SetRegistry(newTestRegistry(), testToken)
+			recorder := httptest.NewRecorder()
+			request := newSnapshotRequest()
+			request.Header.Set("Accept-Encoding", "gzip")
+
+			// Act
+			handler.ServeHTTP(recorder, request)
+
+			// Assert
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Encoding")).To(Equal("gzip"))
+			reader, err := gzip.NewReader(recorder.Body)
+			Expect(err).NotTo(HaveOccurred())
+			kapis, err := readSnapshot(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kapis).To(HaveLen(2))
+		})
+		It("should respond with an uncompressed snapshot, if the client does not accept gzip", func() {
+			// Arrange
+			handler := NewSnapshotHandler()
+			registry := input_data_registry.NewInputDataRegistry(0, logr.Discard())
+			registry.SetKapiData("ns1", "pod1", "uid1", nil, "https://10.0.0.1:443/metrics")
+			handler.SetRegistry(registry, testToken)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(recorder, newSnapshotRequest())
+
+			// Assert
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Encoding")).To(BeEmpty())
+			kapis, err := readSnapshot(recorder.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kapis).To(HaveLen(1))
+			Expect(kapis[0].ShootNamespace()).To(Equal("ns1"))
+			Expect(kapis[0].PodName()).To(Equal("pod1"))
+			Expect(kapis[0].PodUID).To(BeEquivalentTo("uid1"))
+		})
+	})
+})
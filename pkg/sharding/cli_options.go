@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sharding
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	identityFlagName       = "shard-identity"
+	leaseDurationFlagName  = "shard-lease-duration"
+	renewPeriodFlagName    = "shard-renew-period"
+	peerCAFileFlagName     = "shard-peer-ca-file"
+	peerServerNameFlagName = "shard-peer-server-name"
+	peerTokenFileFlagName  = "shard-peer-token-file"
+)
+
+// CLIOptions are command line options related to sharding metric scraping across replicas. They only take effect in
+// sharded HA mode.
+type CLIOptions struct {
+	config *CLIConfig // Contains the final, processed values of the options
+
+	// For the meaning of the different option fields, see the CLIConfig type, which mirrors these fields
+	Identity       string
+	LeaseDuration  time.Duration
+	RenewPeriod    time.Duration
+	PeerCAFile     string
+	PeerServerName string
+	PeerTokenFile  string
+}
+
+// NewCLIOptions creates a CLIOptions object with default values
+func NewCLIOptions() *CLIOptions {
+	hostname, _ := os.Hostname()
+	return &CLIOptions{
+		Identity:      hostname,
+		LeaseDuration: 30 * time.Second,
+		RenewPeriod:   10 * time.Second,
+		PeerTokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+	}
+}
+
+// AddFlags implements [github.com/gardener/gardener/extensions/pkg/controller/cmd.Flagger.AddFlags].
+func (options *CLIOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&options.Identity, identityFlagName, options.Identity,
+		"In sharded HA mode, the unique name of this replica among all replicas. Default: the host (pod) name")
+	flags.DurationVar(&options.LeaseDuration, leaseDurationFlagName, options.LeaseDuration,
+		fmt.Sprintf(
+			"In sharded HA mode, a replica which has not renewed its shard membership for this long is considered "+
+				"gone, and its namespaces are taken over by the remaining replicas. Default: %s",
+			options.LeaseDuration))
+	flags.DurationVar(&options.RenewPeriod, renewPeriodFlagName, options.RenewPeriod,
+		fmt.Sprintf(
+			"In sharded HA mode, how often a replica renews its shard membership and refreshes its view of the other "+
+				"replicas. Default: %s",
+			options.RenewPeriod))
+	flags.StringVar(&options.PeerCAFile, peerCAFileFlagName, options.PeerCAFile,
+		"In sharded HA mode, the CA bundle used to verify the serving certificates of other replicas, when forwarding "+
+			"metric requests to them. Default: system CA bundle")
+	flags.StringVar(&options.PeerServerName, peerServerNameFlagName, options.PeerServerName,
+		"In sharded HA mode, the server name expected in the serving certificates of other replicas. Default: "+
+			"<application name>.<namespace>.svc")
+	flags.StringVar(&options.PeerTokenFile, peerTokenFileFlagName, options.PeerTokenFile,
+		fmt.Sprintf(
+			"In sharded HA mode, the file containing the bearer token presented to other replicas, when forwarding "+
+				"metric requests to them. The token's identity must be allowed to read custom metrics. Default: %s",
+			options.PeerTokenFile))
+}
+
+// Complete implements [github.com/gardener/gardener/extensions/pkg/controller/cmd.Completer.Complete].
+func (options *CLIOptions) Complete() error {
+	if options.Identity == "" {
+		return fmt.Errorf("the --%s option must not be empty", identityFlagName)
+	}
+	if options.RenewPeriod <= 0 {
+		return fmt.Errorf("the --%s option must be positive", renewPeriodFlagName)
+	}
+	if options.LeaseDuration <= options.RenewPeriod {
+		return fmt.Errorf("the --%s option must be greater than --%s", leaseDurationFlagName, renewPeriodFlagName)
+	}
+
+	options.config = &CLIConfig{
+		Identity:       options.Identity,
+		LeaseDuration:  options.LeaseDuration,
+		RenewPeriod:    options.RenewPeriod,
+		PeerCAFile:     options.PeerCAFile,
+		PeerServerName: options.PeerServerName,
+		PeerTokenFile:  options.PeerTokenFile,
+	}
+	return nil
+}
+
+// Completed returns the final, processed values of the options. Only call this if `Complete` was successful.
+func (options *CLIOptions) Completed() *CLIConfig {
+	return options.config
+}
+
+// CLIConfig is a completed configuration, result of successfully parsing and processing CLI options.
+// It contains configuration which directs sharding of metric scraping across replicas.
+type CLIConfig struct {
+	// The unique name of this replica among all replicas
+	Identity string
+	// A replica which has not renewed its membership lease for this long is considered gone
+	LeaseDuration time.Duration
+	// How often a replica renews its membership lease and refreshes its view of the other replicas
+	RenewPeriod time.Duration
+	// If not empty, the CA bundle used to verify the serving certificates of other replicas
+	PeerCAFile string
+	// If not empty, the server name expected in the serving certificates of other replicas
+	PeerServerName string
+	// The file containing the bearer token presented to other replicas
+	PeerTokenFile string
+}
@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sharding
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"k8s.io/metrics/pkg/apis/custom_metrics/v1beta2"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/metrics_provider"
+)
+
+// How long do we wait for a peer replica to respond to a forwarded request
+const forwardTimeout = 10 * time.Second
+
+// PeerForwarder forwards metric requests to the replica which owns the respective namespace, via that replica's
+// custom metrics API endpoint.
+//
+// PeerForwarder implements [metrics_provider.ShardForwarder].
+type PeerForwarder struct {
+	membership *Membership
+	config     *CLIConfig
+	httpClient *http.Client
+
+	testIsolation forwarderTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// NewPeerForwarder creates a PeerForwarder which uses the specified membership to determine namespace ownership.
+//
+// namespace is the K8s namespace where the replicas run. It is used to derive the default server name expected in the
+// serving certificates of peer replicas.
+func NewPeerForwarder(membership *Membership, config *CLIConfig, namespace string) (*PeerForwarder, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config.PeerServerName,
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = fmt.Sprintf("%s.%s.svc", app.Name, namespace)
+	}
+	if config.PeerCAFile != "" {
+		caBundle, err := os.ReadFile(config.PeerCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("creating peer forwarder: reading CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("creating peer forwarder: no certificates found in CA file '%s'", config.PeerCAFile)
+		}
+	}
+
+	return &PeerForwarder{
+		membership: membership,
+		config:     config,
+		httpClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			Timeout:   forwardTimeout,
+		},
+		testIsolation: forwarderTestIsolation{
+			ReadFile: os.ReadFile,
+		},
+	}, nil
+}
+
+// IsLocal implements [metrics_provider.ShardForwarder.IsLocal]
+func (f *PeerForwarder) IsLocal(namespace string) bool {
+	return f.membership.IsLocal(namespace)
+}
+
+// GetMetricByName implements [metrics_provider.ShardForwarder.GetMetricByName]
+func (f *PeerForwarder) GetMetricByName(
+	ctx context.Context,
+	name types.NamespacedName,
+	info provider.CustomMetricInfo,
+	metricSelector labels.Selector) (*custom_metrics.MetricValue, error) {
+
+	namespace := name.Namespace
+	if isNamespaceMetric(info) {
+		namespace = name.Name // A metric describing a namespace is requested by the namespace's name
+	}
+	list, err := f.get(ctx, namespace, name.Name, labels.Everything(), info, metricSelector)
+	if err != nil || list == nil || len(list.Items) == 0 {
+		return nil, err
+	}
+	return &list.Items[0], nil
+}
+
+// GetMetricBySelector implements [metrics_provider.ShardForwarder.GetMetricBySelector]
+func (f *PeerForwarder) GetMetricBySelector(
+	ctx context.Context,
+	namespace string,
+	selector labels.Selector,
+	info provider.CustomMetricInfo,
+	metricSelector labels.Selector) (*custom_metrics.MetricValueList, error) {
+
+	list, err := f.get(ctx, namespace, "*", selector, info, metricSelector)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		return &custom_metrics.MetricValueList{}, nil
+	}
+	return list, nil
+}
+
+// get requests the metric values for the specified object name (or "*" for all objects) from the replica which owns
+// the namespace. Returns a nil list, if the owner reports that the object does not exist.
+func (f *PeerForwarder) get(
+	ctx context.Context,
+	namespace string,
+	objectName string,
+	selector labels.Selector,
+	info provider.CustomMetricInfo,
+	metricSelector labels.Selector) (*custom_metrics.MetricValueList, error) {
+
+	owner := f.membership.Owner(namespace)
+	errorPrefix := fmt.Sprintf("forwarding metric request for namespace '%s' to shard member '%s'", namespace, owner.Identity)
+	if owner.Address == "" {
+		return nil, fmt.Errorf("%s: the member's address is unknown", errorPrefix)
+	}
+
+	query := url.Values{}
+	if selector != nil && !selector.Empty() {
+		query.Set("labelSelector", selector.String())
+	}
+	query.Set("metricLabelSelector", metrics_provider.MarkForwarded(metricSelector).String())
+	pathParts := []string{"namespaces", namespace, info.GroupResource.String(), objectName, info.Metric}
+	if isNamespaceMetric(info) {
+		pathParts = []string{"namespaces", namespace, "metrics", info.Metric}
+	}
+	requestUrl := url.URL{
+		Scheme: "https",
+		Host:   owner.Address,
+		Path: strings.Join(append(
+			[]string{"/apis", v1beta2.SchemeGroupVersion.Group, v1beta2.SchemeGroupVersion.Version}, pathParts...), "/"),
+		RawQuery: query.Encode(),
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: creating request: %w", errorPrefix, err)
+	}
+	token, err := f.testIsolation.ReadFile(f.config.PeerTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: reading token file: %w", errorPrefix, err)
+	}
+	request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	request.Header.Set("Accept", "application/json")
+
+	response, err := f.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errorPrefix, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected response status '%s'", errorPrefix, response.Status)
+	}
+
+	var external v1beta2.MetricValueList
+	if err := json.NewDecoder(response.Body).Decode(&external); err != nil {
+		return nil, fmt.Errorf("%s: decoding response: %w", errorPrefix, err)
+	}
+	result := &custom_metrics.MetricValueList{}
+	if err := v1beta2.Convert_v1beta2_MetricValueList_To_custom_metrics_MetricValueList(&external, result, nil); err != nil {
+		return nil, fmt.Errorf("%s: converting response: %w", errorPrefix, err)
+	}
+	return result, nil
+}
+
+// isNamespaceMetric returns true if the metric describes a namespace, rather than an object in the namespace
+func isNamespaceMetric(info provider.CustomMetricInfo) bool {
+	return !info.Namespaced && info.GroupResource.Group == "" && info.GroupResource.Resource == "namespaces"
+}
+
+//#region Test isolation
+
+// forwarderTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the PeerForwarder unit during tests
+type forwarderTestIsolation struct {
+	// Points to [os.ReadFile]
+	ReadFile func(name string) ([]byte, error)
+}
+
+//#endregion Test isolation
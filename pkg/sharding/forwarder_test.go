@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sharding
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/metrics/pkg/apis/custom_metrics/v1beta2"
+	mxprov "sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/metrics_provider"
+)
+
+var _ = Describe("sharding.PeerForwarder", func() {
+	const (
+		testNs      = "shoot--my-shoot"
+		testPodName = "my-pod"
+		testToken   = "my-token"
+	)
+	var (
+		metricInfo = mxprov.CustomMetricInfo{
+			GroupResource: schema.GroupResource{Resource: "pods"},
+			Namespaced:    true,
+			Metric:        "shoot:apiserver_request_total:sum",
+		}
+		server       *httptest.Server
+		lastRequest  *http.Request
+		responseCode int
+		responseBody v1beta2.MetricValueList
+		forwarder    *PeerForwarder
+	)
+
+	BeforeEach(func() {
+		responseCode = http.StatusOK
+		responseBody = v1beta2.MetricValueList{}
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lastRequest = r
+			w.WriteHeader(responseCode)
+			_ = json.NewEncoder(w).Encode(&responseBody)
+		}))
+		DeferCleanup(server.Close)
+
+		// Trust the test server's certificate
+		caFile := filepath.Join(GinkgoT().TempDir(), "ca.crt")
+		caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		Expect(os.WriteFile(caFile, caBundle, 0600)).To(Succeed())
+
+		config := &CLIConfig{Identity: "local", PeerCAFile: caFile, PeerServerName: "example.com"}
+		membership := NewMembership(nil, nil, "garden", "", config, logr.Discard())
+		// A single remote member owns all namespaces
+		membership.members = []Member{{Identity: "remote", Address: strings.TrimPrefix(server.URL, "https://")}}
+
+		var err error
+		forwarder, err = NewPeerForwarder(membership, config, "garden")
+		Expect(err).To(Succeed())
+		forwarder.testIsolation.ReadFile = func(string) ([]byte, error) { return []byte(testToken + "\n"), nil }
+	})
+
+	Describe("IsLocal", func() {
+		It("should report namespaces owned by other members as not local", func() {
+			Expect(forwarder.IsLocal(testNs)).To(BeFalse())
+		})
+	})
+
+	Describe("GetMetricBySelector", func() {
+		It("should request the metrics from the owner, and mark the request as forwarded", func() {
+			// Arrange
+			responseBody.Items = []v1beta2.MetricValue{
+				{
+					DescribedObject: corev1.ObjectReference{Kind: "Pod", Namespace: testNs, Name: testPodName},
+					Metric:          v1beta2.MetricIdentifier{Name: metricInfo.Metric},
+					Value:           resource.MustParse("5"),
+				},
+			}
+			selector := labels.SelectorFromSet(labels.Set{"app": "kube-apiserver"})
+
+			// Act
+			result, err := forwarder.GetMetricBySelector(context.Background(), testNs, selector, metricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result.Items).To(HaveLen(1))
+			Expect(result.Items[0].DescribedObject.Name).To(Equal(testPodName))
+			Expect(result.Items[0].Value.Value()).To(Equal(int64(5)))
+			Expect(lastRequest.URL.Path).To(Equal(
+				"/apis/custom.metrics.k8s.io/v1beta2/namespaces/" + testNs + "/pods/*/" + metricInfo.Metric))
+			Expect(lastRequest.URL.Query().Get("labelSelector")).To(Equal("app=kube-apiserver"))
+			metricSelector, err := labels.Parse(lastRequest.URL.Query().Get("metricLabelSelector"))
+			Expect(err).To(Succeed())
+			Expect(metricSelector.String()).To(Equal(metrics_provider.MarkForwarded(nil).String()))
+			Expect(lastRequest.Header.Get("Authorization")).To(Equal("Bearer " + testToken))
+		})
+
+		It("should return an error if the owner responds with an error status", func() {
+			// Arrange
+			responseCode = http.StatusForbidden
+
+			// Act
+			_, err := forwarder.GetMetricBySelector(context.Background(), testNs, labels.Everything(), metricInfo, nil)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("403"))
+		})
+	})
+
+	Describe("GetMetricByName", func() {
+		It("should request the metric for the named object from the owner", func() {
+			// Arrange
+			responseBody.Items = []v1beta2.MetricValue{
+				{DescribedObject: corev1.ObjectReference{Name: testPodName}, Value: resource.MustParse("7")},
+			}
+
+			// Act
+			result, err := forwarder.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result.Value.Value()).To(Equal(int64(7)))
+			Expect(lastRequest.URL.Path).To(HaveSuffix("/pods/" + testPodName + "/" + metricInfo.Metric))
+		})
+
+		It("should request a metric describing a namespace at the namespace's metrics path", func() {
+			// Arrange
+			responseBody.Items = []v1beta2.MetricValue{
+				{DescribedObject: corev1.ObjectReference{Name: testNs}, Value: resource.MustParse("250m")},
+			}
+			namespaceMetricInfo := mxprov.CustomMetricInfo{
+				GroupResource: schema.GroupResource{Resource: "namespaces"},
+				Metric:        metrics_provider.ScrapeLatencyMetricName,
+			}
+
+			// Act
+			result, err := forwarder.GetMetricByName(
+				context.Background(), types.NamespacedName{Name: testNs}, namespaceMetricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result.Value.MilliValue()).To(Equal(int64(250)))
+			Expect(lastRequest.URL.Path).To(Equal(
+				"/apis/custom.metrics.k8s.io/v1beta2/namespaces/" + testNs + "/metrics/" + namespaceMetricInfo.Metric))
+		})
+
+		It("should return nothing if the owner does not know the object", func() {
+			// Arrange
+			responseCode = http.StatusNotFound
+
+			// Act
+			result, err := forwarder.GetMetricByName(
+				context.Background(), types.NamespacedName{Namespace: testNs, Name: testPodName}, metricInfo, nil)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(result).To(BeNil())
+		})
+	})
+
+	Describe("NewPeerForwarder", func() {
+		It("should fail if the CA file does not contain certificates", func() {
+			// Arrange
+			caFile := filepath.Join(GinkgoT().TempDir(), "ca.crt")
+			Expect(os.WriteFile(caFile, []byte("not a certificate"), 0600)).To(Succeed())
+			config := &CLIConfig{Identity: "local", PeerCAFile: caFile}
+
+			// Act
+			_, err := NewPeerForwarder(NewMembership(nil, nil, "garden", "", config, logr.Discard()), config, "garden")
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
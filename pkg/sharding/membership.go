@@ -0,0 +1,246 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sharding distributes metric scraping across multiple active replicas. Each replica owns a subset (shard) of
+// the shoot namespaces, scrapes only the kube-apiserver pods in its shard, and forwards metric requests for other
+// namespaces to the owning replica.
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+	"github.com/gardener/gardener-custom-metrics/pkg/util/errutil"
+)
+
+const (
+	// Identifies the leases which record shard membership
+	memberLabel = "custom-metrics.gardener.cloud/shard-member"
+	// The address (host:port) at which a member serves custom metrics
+	addressAnnotation = "custom-metrics.gardener.cloud/address"
+	// How long do we wait for the membership lease removal, upon exit
+	leaseCleanupTimeout = 10 * time.Second
+)
+
+// Member is a replica participating in sharding
+type Member struct {
+	// Unique name of the replica
+	Identity string
+	// The address (host:port) at which the replica serves custom metrics
+	Address string
+}
+
+// ownerOf returns the member which owns the specified namespace. Members must be sorted by identity, and non-empty.
+// Ownership is determined by hashing the namespace name, so all replicas which see the same member list agree on
+// ownership.
+func ownerOf(members []Member, namespace string) Member {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(namespace))
+	return members[hash.Sum32()%uint32(len(members))]
+}
+
+// Membership maintains this replica's membership in the shard ring, and tracks the other members. Each member
+// announces itself via a [coordinationv1.Lease] object, which it renews periodically. A member whose lease has not
+// been renewed within the lease duration is considered gone.
+//
+// Membership implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable]. Public members are concurrency-safe.
+type Membership struct {
+	apiReader client.Reader
+	client    client.Client
+	namespace string
+	self      Member
+	config    *CLIConfig
+	log       logr.Logger
+
+	// All live members, including self, sorted by identity. Never empty.
+	members []Member
+	lock    sync.Mutex // Synchronises access to members
+
+	testIsolation membershipTestIsolation // Provides indirections necessary to isolate the unit during tests
+}
+
+// NewMembership creates a Membership for this replica.
+//
+// apiReader is used to read leases, bypassing the client cache. client is used to write leases.
+//
+// namespace is the K8s namespace where the membership leases are kept.
+//
+// address is the address (host:port) at which this replica serves custom metrics.
+func NewMembership(
+	apiReader client.Reader,
+	client client.Client,
+	namespace string,
+	address string,
+	config *CLIConfig,
+	parentLogger logr.Logger) *Membership {
+
+	self := Member{Identity: config.Identity, Address: address}
+	return &Membership{
+		apiReader: apiReader,
+		client:    client,
+		namespace: namespace,
+		self:      self,
+		config:    config,
+		log:       parentLogger.WithName("sharding"),
+		// Until we learn about other members, act as the sole member, so no namespace is left unscraped
+		members: []Member{self},
+		testIsolation: membershipTestIsolation{
+			TimeNow:   time.Now,
+			TimeAfter: time.After,
+		},
+	}
+}
+
+// Start implements [sigs.k8s.io/controller-runtime/pkg/manager.Runnable.Start]. It renews this replica's membership
+// and refreshes the member list once per renew period, until the context is cancelled. Upon exit, it removes this
+// replica's membership, so the remaining replicas take over its namespaces without waiting for the lease to expire.
+func (m *Membership) Start(ctx context.Context) error {
+	log := m.log.WithValues("op", "membershipProc")
+	log.V(app.VerbosityInfo).Info("Shard membership started", "identity", m.self.Identity)
+
+	for {
+		if err := m.renew(ctx); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to renew shard membership")
+		}
+		if err := m.refresh(ctx); err != nil {
+			log.V(app.VerbosityError).Error(err, "Failed to refresh shard member list")
+		}
+
+		select {
+		case <-ctx.Done():
+			log.V(app.VerbosityInfo).Info("Context closed, exiting")
+			// The original context is already cancelled. Allow the cleanup a brief period of its own.
+			cleanupCtx, cancel := context.WithTimeout(context.Background(), leaseCleanupTimeout)
+			defer cancel()
+			if err := m.leave(cleanupCtx); err != nil {
+				log.V(app.VerbosityError).Error(err, "Failed to remove shard membership")
+			}
+			return nil
+		case <-m.testIsolation.TimeAfter(m.config.RenewPeriod):
+		}
+	}
+}
+
+// NeedLeaderElection implements [sigs.k8s.io/controller-runtime/pkg/manager.LeaderElectionRunnable]. All replicas
+// participate in sharding.
+func (m *Membership) NeedLeaderElection() bool {
+	return false
+}
+
+// Members returns all live members, including this replica, sorted by identity
+func (m *Membership) Members() []Member {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.members
+}
+
+// Owner returns the member which owns the specified namespace
+func (m *Membership) Owner(namespace string) Member {
+	return ownerOf(m.Members(), namespace)
+}
+
+// IsLocal returns true if this replica owns the specified namespace
+func (m *Membership) IsLocal(namespace string) bool {
+	return m.Owner(namespace).Identity == m.self.Identity
+}
+
+// newLease returns a Lease object which identifies this replica's membership lease, with no other data
+func (m *Membership) newLease() *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-shard-%s", app.Name, m.self.Identity),
+			Namespace: m.namespace,
+		},
+	}
+}
+
+// renew creates or updates this replica's membership lease
+func (m *Membership) renew(ctx context.Context) error {
+	lease := m.newLease()
+	err := m.apiReader.Get(ctx, client.ObjectKeyFromObject(lease), lease)
+	isNotFound := errors.IsNotFound(err)
+	if err != nil && !isNotFound {
+		return fmt.Errorf("renewing shard membership: retrieving lease: %w", err)
+	}
+
+	lease.Labels = map[string]string{"app": app.Name, memberLabel: "true"}
+	lease.Annotations = map[string]string{addressAnnotation: m.self.Address}
+	lease.Spec.HolderIdentity = ptr.To(m.self.Identity)
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(m.config.LeaseDuration.Seconds()))
+	lease.Spec.RenewTime = &metav1.MicroTime{Time: m.testIsolation.TimeNow()}
+
+	if isNotFound {
+		err = m.client.Create(ctx, lease)
+	} else {
+		err = m.client.Update(ctx, lease)
+	}
+	return errutil.Wrap("renewing shard membership", err)
+}
+
+// refresh updates the member list, based on the live membership leases
+func (m *Membership) refresh(ctx context.Context) error {
+	leases := &coordinationv1.LeaseList{}
+	err := m.apiReader.List(ctx, leases, client.InNamespace(m.namespace), client.MatchingLabels{memberLabel: "true"})
+	if err != nil {
+		return fmt.Errorf("refreshing shard member list: listing leases: %w", err)
+	}
+
+	now := m.testIsolation.TimeNow()
+	members := []Member{m.self} // Always count self in, even if the renewal failed
+	for _, lease := range leases.Items {
+		if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == m.self.Identity ||
+			lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiration := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		if !now.Before(expiration) {
+			continue
+		}
+		members = append(members, Member{Identity: *lease.Spec.HolderIdentity, Address: lease.Annotations[addressAnnotation]})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Identity < members[j].Identity })
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(members) != len(m.members) {
+		m.log.V(app.VerbosityInfo).Info("Shard member count changed", "count", len(members))
+	}
+	m.members = members
+	return nil
+}
+
+// leave removes this replica's membership lease
+func (m *Membership) leave(ctx context.Context) error {
+	err := m.client.Delete(ctx, m.newLease())
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return errutil.Wrap("removing shard membership", err)
+}
+
+//#region Test isolation
+
+// membershipTestIsolation contains all points of indirection necessary to isolate static function calls
+// in the Membership unit during tests
+type membershipTestIsolation struct {
+	// Points to [time.Now]
+	TimeNow func() time.Time
+	// Points to [time.After]
+	TimeAfter func(time.Duration) <-chan time.Time
+}
+
+//#endregion Test isolation
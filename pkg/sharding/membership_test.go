@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("sharding.Membership", func() {
+	const (
+		testNs      = "garden"
+		testAddress = "1.2.3.4:443"
+	)
+	var (
+		fakeClient kclient.Client
+		membership *Membership
+		now        time.Time
+		config     = &CLIConfig{Identity: "replica-b", LeaseDuration: 30 * time.Second, RenewPeriod: 10 * time.Second}
+	)
+
+	// createPeerLease creates a membership lease for a peer replica, renewed at the specified time
+	createPeerLease := func(identity string, renewTime time.Time) {
+		lease := &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "shard-" + identity,
+				Namespace:   testNs,
+				Labels:      map[string]string{memberLabel: "true"},
+				Annotations: map[string]string{addressAnnotation: identity + ":443"},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(identity),
+				LeaseDurationSeconds: ptr.To(int32(30)),
+				RenewTime:            &metav1.MicroTime{Time: renewTime},
+			},
+		}
+		Expect(fakeClient.Create(context.Background(), lease)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		fakeClient = fake.NewClientBuilder().Build()
+		membership = NewMembership(fakeClient, fakeClient, testNs, testAddress, config, logr.Discard())
+		now = time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+		membership.testIsolation.TimeNow = func() time.Time { return now }
+	})
+
+	Describe("IsLocal", func() {
+		It("should own all namespaces, before the member list is known", func() {
+			// Act & Assert
+			for i := 0; i < 20; i++ {
+				Expect(membership.IsLocal(fmt.Sprintf("shoot--ns-%d", i))).To(BeTrue())
+			}
+		})
+	})
+
+	Describe("renew", func() {
+		It("should create, and then update this replica's lease", func() {
+			// Act
+			Expect(membership.renew(context.Background())).To(Succeed())
+			now = now.Add(5 * time.Second)
+			Expect(membership.renew(context.Background())).To(Succeed())
+
+			// Assert
+			lease := membership.newLease()
+			Expect(fakeClient.Get(context.Background(), kclient.ObjectKeyFromObject(lease), lease)).To(Succeed())
+			Expect(*lease.Spec.HolderIdentity).To(Equal(config.Identity))
+			Expect(*lease.Spec.LeaseDurationSeconds).To(Equal(int32(30)))
+			Expect(lease.Spec.RenewTime.Time).To(BeTemporally("==", now))
+			Expect(lease.Labels[memberLabel]).To(Equal("true"))
+			Expect(lease.Annotations[addressAnnotation]).To(Equal(testAddress))
+		})
+	})
+
+	Describe("refresh", func() {
+		It("should include self and the peers with live leases, sorted by identity", func() {
+			// Arrange
+			createPeerLease("replica-c", now.Add(-10*time.Second))
+			createPeerLease("replica-a", now)
+			createPeerLease("replica-expired", now.Add(-31*time.Second))
+
+			// Act
+			err := membership.refresh(context.Background())
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(membership.Members()).To(Equal([]Member{
+				{Identity: "replica-a", Address: "replica-a:443"},
+				{Identity: "replica-b", Address: testAddress},
+				{Identity: "replica-c", Address: "replica-c:443"},
+			}))
+		})
+
+		It("should split namespaces among members, consistently with the peers' view", func() {
+			// Arrange
+			createPeerLease("replica-a", now)
+			Expect(membership.refresh(context.Background())).To(Succeed())
+			peerView := []Member{{Identity: "replica-a"}, {Identity: "replica-b"}}
+
+			// Act & Assert
+			localCount := 0
+			for i := 0; i < 100; i++ {
+				ns := fmt.Sprintf("shoot--ns-%d", i)
+				isLocal := membership.IsLocal(ns)
+				Expect(isLocal).To(Equal(ownerOf(peerView, ns).Identity == config.Identity))
+				if isLocal {
+					localCount++
+				}
+			}
+			Expect(localCount).To(BeNumerically(">", 0))
+			Expect(localCount).To(BeNumerically("<", 100))
+		})
+	})
+
+	Describe("Start", func() {
+		It("should renew membership until the context is cancelled, and remove the lease upon exit", func() {
+			// Arrange
+			ctx, cancel := context.WithCancel(context.Background())
+			timeAfterChan := make(chan time.Time)
+			membership.testIsolation.TimeAfter = func(time.Duration) <-chan time.Time { return timeAfterChan }
+			done := make(chan error)
+			go func() { done <- membership.Start(ctx) }()
+			lease := membership.newLease()
+
+			// Act & Assert
+			Eventually(func() error {
+				return fakeClient.Get(context.Background(), kclient.ObjectKeyFromObject(lease), lease)
+			}).Should(Succeed())
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+			err := fakeClient.Get(context.Background(), kclient.ObjectKeyFromObject(lease), lease)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should not require leader election", func() {
+			Expect(membership.NeedLeaderElection()).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package testing_test
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+// NewTimeNowStub stands in for time.Now, in the test isolation indirections of the units under test
+func ExampleNewTimeNowStub() {
+	timeNow := gcmtesting.NewTimeNowStub(10, 30, 0)
+
+	fmt.Println(timeNow().Sub(gcmtesting.NewTime(10, 0, 0)))
+	// Output: 30m0s
+}
+
+func ExampleIsEqualCert() {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(gcmtesting.GetExampleCACert(0))
+
+	fmt.Println(gcmtesting.IsEqualCert(pool, gcmtesting.GetExampleCACert(0)))
+	fmt.Println(gcmtesting.IsEqualCert(pool, gcmtesting.GetExampleCACert(1)))
+	// Output:
+	// true
+	// false
+}
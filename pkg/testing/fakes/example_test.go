@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fakes_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+	"github.com/gardener/gardener-custom-metrics/pkg/testing/fakes"
+)
+
+// The fake stands in for the registry, wherever code expects an InputDataRegistry, or the InputDataSource view of it
+func ExampleFakeInputDataRegistry() {
+	var registry input_data_registry.InputDataRegistry = &fakes.FakeInputDataRegistry{}
+	registry.SetKapiData("shoot--my-shoot", "kube-apiserver-0", "uid", nil, "https://10.0.0.1/metrics")
+	registry.SetKapiScrapeResult(
+		"shoot--my-shoot", "kube-apiserver-0", input_data_registry.KapiScrapeResult{TotalRequestCount: 42})
+
+	for _, kapi := range registry.DataSource().GetShootKapis("shoot--my-shoot") {
+		fmt.Println(kapi.PodName(), kapi.TotalRequestCountNew())
+	}
+	// Output: kube-apiserver-0 42
+}
+
+// Coverage is computed as of FakeTimeNow, which lets tests control sample freshness
+func ExampleFakeInputDataRegistry_GetScrapeCoverage() {
+	registry := &fakes.FakeInputDataRegistry{FakeTimeNow: gcmtesting.NewTime(10, 0, 30)}
+	registry.SetDefaultScrapePeriod(time.Minute)
+	registry.SetKapiData("shoot--my-shoot", "kube-apiserver-0", "uid-0", nil, "https://10.0.0.1/metrics")
+	registry.SetKapiData("shoot--my-shoot", "kube-apiserver-1", "uid-1", nil, "https://10.0.0.2/metrics")
+	registry.SetKapiMetricsWithTime("shoot--my-shoot", "kube-apiserver-0", 42, gcmtesting.NewTime(10, 0, 0))
+
+	coverage := registry.GetScrapeCoverage()["shoot--my-shoot"]
+	fmt.Printf("%d of %d Kapis have fresh samples\n", coverage.FreshKapiCount, coverage.KapiCount)
+	// Output: 1 of 2 Kapis have fresh samples
+}
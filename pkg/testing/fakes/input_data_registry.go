@@ -0,0 +1,808 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fakes provides in-memory fakes of the interfaces through which the components of this module exchange data.
+// The fakes are meant for unit tests, including tests of components which embed this module. Their exported API is
+// kept stable.
+package fakes
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"slices"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/conditions"
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+)
+
+// FakeInputDataRegistry is an in-memory implementation of [input_data_registry.InputDataRegistry], meant for tests. The
+// zero value is ready to use. Unlike the real registry, it does not sample or validate metrics: each setter records
+// the values passed to it as they are, and does not notify the Kapi watcher. Tests which exercise a watcher call its
+// methods directly, after reading the Watcher field.
+//
+// Shoots without an auth secret of their own have the secret "auth secret", unless RemoveShootAuthSecret was called.
+// Shoots without a CA certificate of their own have an empty CA cert pool, unless HasNoCACertificate is true.
+type FakeInputDataRegistry struct {
+	authSecret string
+	// If true, shoots without a CA certificate of their own have no CA certificate
+	HasNoCACertificate bool
+	// The watcher added via AddKapiWatcher. The fake supports no more than one watcher.
+	Watcher *input_data_registry.KapiWatcher
+	// The shouldNotifyOfPreexisting value passed to AddKapiWatcher
+	ShouldWatcherNotifyOfPreexisting bool
+	kapis                            []*input_data_registry.KapiData
+	shootAuthSecrets                 map[string]string
+	shootCACertPools                 map[string]*x509.CertPool
+	shootCACertHashes                map[string]string
+	shootScrapeSettings              map[string]input_data_registry.ShootScrapeSettings
+	shootRequestSettings             map[string]*input_data_registry.ShootScrapeRequestSettings
+	lock                             sync.Mutex
+	// The sample watcher added via AddSampleWatcher. The fake supports no more than one sample watcher.
+	SampleWatcher *input_data_registry.SampleWatcher
+	// The reasons recorded via SetShootAuthDegraded, by shoot namespace. Unlike the registry, the fake does not clear
+	// them when the auth secret changes.
+	AuthDegradedReasons map[string]string
+
+	// Not used by the fake. Lets tests verify the value which the code under test configured.
+	MinSampleGap time.Duration
+	// The scrape period of Kapis which do not override it, as seen by GetScrapeCoverage
+	DefaultScrapePeriod time.Duration
+	// The scrape settings of shoots without settings of their own
+	ScrapeSettings input_data_registry.ShootScrapeSettings
+	// The current time, as seen by GetScrapeCoverage
+	FakeTimeNow time.Time
+	// The most recent generation returned by the data source. See fakeDataSourceAdapter.GetGeneration.
+	generation uint64
+}
+
+var _ input_data_registry.InputDataRegistry = &FakeInputDataRegistry{}
+
+// GetKapis returns a copy of all Kapis on record
+func (fidr *FakeInputDataRegistry) GetKapis() []*input_data_registry.KapiData {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	result := make([]*input_data_registry.KapiData, len(fidr.kapis))
+	for i, kapi := range fidr.kapis {
+		result[i] = kapi.Copy()
+	}
+	return result
+}
+
+// SetKapis replaces all Kapis on record with the specified ones. The fake takes ownership of the specified objects.
+func (fidr *FakeInputDataRegistry) SetKapis(kapis []*input_data_registry.KapiData) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	fidr.kapis = kapis
+}
+
+// DataSource implements [input_data_registry.InputDataRegistry.DataSource]. The data source returns the Kapis of all
+// shoots, regardless of the requested namespace.
+func (fidr *FakeInputDataRegistry) DataSource() input_data_registry.InputDataSource {
+	return &fakeDataSourceAdapter{fidr}
+}
+
+// Caller must hold the lock
+func (fidr *FakeInputDataRegistry) getKapiDataThreadUnsafe(
+	shootNamespace string, podName string) *input_data_registry.KapiData {
+
+	for _, kapi := range fidr.kapis {
+		if kapi.ShootNamespace() == shootNamespace && kapi.PodName() == podName {
+			return kapi
+		}
+	}
+	return nil
+}
+
+// GetKapiData implements [input_data_registry.InputDataRegistry.GetKapiData]
+func (fidr *FakeInputDataRegistry) GetKapiData(shootNamespace string, podName string) *input_data_registry.KapiData {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	return fidr.getKapiDataThreadUnsafe(shootNamespace, podName).Copy()
+}
+
+// SetKapiData implements [input_data_registry.InputDataRegistry.SetKapiData]
+func (fidr *FakeInputDataRegistry) SetKapiData(
+	shootNamespace string, podName string, uid types.UID, podLabels map[string]string, metricsUrl string) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName); kapi != nil {
+		if kapi.MetricsUrl != metricsUrl {
+			kapi.FaultCount, kapi.LastFaultCategory = 0, ""
+		}
+		kapi.MetricsUrl = metricsUrl
+		kapi.PodUID = uid
+		kapi.PodLabels = podLabels
+		return
+	}
+
+	kapi := input_data_registry.NewKapiData(shootNamespace, podName)
+	kapi.PodUID = uid
+	kapi.MetricsUrl = metricsUrl
+	kapi.PodLabels = podLabels
+	fidr.kapis = append(fidr.kapis, kapi)
+}
+
+// ImportKapiData implements [input_data_registry.InputDataRegistry.ImportKapiData]
+func (fidr *FakeInputDataRegistry) ImportKapiData(kapi *input_data_registry.KapiData) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	imported := kapi.Copy()
+	target := fidr.getKapiDataThreadUnsafe(kapi.ShootNamespace(), kapi.PodName())
+	if target == nil {
+		imported.FaultCount, imported.LastFaultCategory = 0, ""
+		fidr.kapis = append(fidr.kapis, imported)
+		return
+	}
+
+	imported.FaultCount, imported.LastFaultCategory = target.FaultCount, target.LastFaultCategory
+	*target = *imported
+}
+
+// RemoveKapiData implements [input_data_registry.InputDataRegistry.RemoveKapiData]
+func (fidr *FakeInputDataRegistry) RemoveKapiData(shootNamespace string, podName string) bool {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	for i, kapi := range fidr.kapis {
+		if kapi.ShootNamespace() == shootNamespace && kapi.PodName() == podName {
+			fidr.kapis = append(fidr.kapis[:i], fidr.kapis[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveShootData implements [input_data_registry.InputDataRegistry.RemoveShootData]
+func (fidr *FakeInputDataRegistry) RemoveShootData(shootNamespace string) bool {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	_, hadAuthSecret := fidr.shootAuthSecrets[shootNamespace]
+	_, hadCACertPool := fidr.shootCACertPools[shootNamespace]
+	_, hadScrapeSettings := fidr.shootScrapeSettings[shootNamespace]
+	_, hadRequestSettings := fidr.shootRequestSettings[shootNamespace]
+	delete(fidr.shootAuthSecrets, shootNamespace)
+	delete(fidr.shootCACertPools, shootNamespace)
+	delete(fidr.shootCACertHashes, shootNamespace)
+	delete(fidr.shootScrapeSettings, shootNamespace)
+	delete(fidr.shootRequestSettings, shootNamespace)
+
+	count := len(fidr.kapis)
+	fidr.kapis = slices.DeleteFunc(fidr.kapis, func(kapi *input_data_registry.KapiData) bool {
+		return kapi.ShootNamespace() == shootNamespace
+	})
+	return len(fidr.kapis) != count || hadAuthSecret || hadCACertPool || hadScrapeSettings || hadRequestSettings
+}
+
+// GetShootNamespaces implements [input_data_registry.InputDataRegistry.GetShootNamespaces]
+func (fidr *FakeInputDataRegistry) GetShootNamespaces() []string {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	var result []string
+	add := func(shootNamespace string) {
+		if !slices.Contains(result, shootNamespace) {
+			result = append(result, shootNamespace)
+		}
+	}
+	for _, kapi := range fidr.kapis {
+		add(kapi.ShootNamespace())
+	}
+	for shootNamespace := range fidr.shootAuthSecrets {
+		add(shootNamespace)
+	}
+	for shootNamespace := range fidr.shootCACertPools {
+		add(shootNamespace)
+	}
+	for shootNamespace := range fidr.shootScrapeSettings {
+		add(shootNamespace)
+	}
+	for shootNamespace := range fidr.shootRequestSettings {
+		add(shootNamespace)
+	}
+	return result
+}
+
+// GetFaultyKapiData implements [input_data_registry.InputDataRegistry.GetFaultyKapiData]
+func (fidr *FakeInputDataRegistry) GetFaultyKapiData(minFaultCount int) []*input_data_registry.KapiData {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	var result []*input_data_registry.KapiData
+	for _, kapi := range fidr.kapis {
+		if kapi.FaultCount >= minFaultCount {
+			result = append(result, kapi.Copy())
+		}
+	}
+	return result
+}
+
+// GetKapiDataByMetricsUrl implements [input_data_registry.InputDataRegistry.GetKapiDataByMetricsUrl]
+func (fidr *FakeInputDataRegistry) GetKapiDataByMetricsUrl(metricsUrl string) []*input_data_registry.KapiData {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	var result []*input_data_registry.KapiData
+	for _, kapi := range fidr.kapis {
+		if kapi.MetricsUrl == metricsUrl || slices.Contains(kapi.ExtraMetricsUrls, metricsUrl) {
+			result = append(result, kapi.Copy())
+		}
+	}
+	return result
+}
+
+// SetKapiMetrics implements [input_data_registry.InputDataRegistry.SetKapiMetrics]. Unlike the real registry, it only
+// replaces the most recent request count, and does not record a sample time.
+func (fidr *FakeInputDataRegistry) SetKapiMetrics(
+	shootNamespace string, podName string, currentTotalRequestCount int64) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName)
+	kapi.TotalRequestCountNew = currentTotalRequestCount
+	kapi.FaultCount, kapi.LastFaultCategory = 0, ""
+}
+
+// SetKapiMetricsWithTime records a request count sample taken at the specified time. The previous sample becomes the
+// old one. The sample is also added to the Kapi's request count history.
+func (fidr *FakeInputDataRegistry) SetKapiMetricsWithTime(
+	shootNamespace string, podName string, currentTotalRequestCount int64, metricsTime time.Time) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName)
+	kapi.TotalRequestCountOld = kapi.TotalRequestCountNew
+	kapi.MetricsTimeOld = kapi.MetricsTimeNew
+	kapi.TotalRequestCountNew = currentTotalRequestCount
+	kapi.MetricsTimeNew = metricsTime
+	kapi.RequestCountHistory.Add(
+		input_data_registry.RequestCountSample{TotalRequestCount: currentTotalRequestCount, Time: metricsTime})
+}
+
+// SetKapiErrorCountsWithTime records a request count sample, like SetKapiMetricsWithTime, along with the number of
+// requests in it which failed with a 4xx, and a 5xx status code
+func (fidr *FakeInputDataRegistry) SetKapiErrorCountsWithTime(
+	shootNamespace string,
+	podName string,
+	currentTotalRequestCount int64,
+	clientErrorCount int64,
+	serverErrorCount int64,
+	metricsTime time.Time) {
+
+	fidr.SetKapiMetricsWithTime(shootNamespace, podName, currentTotalRequestCount, metricsTime)
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName)
+	kapi.ClientErrorCountOld, kapi.ServerErrorCountOld = kapi.ClientErrorCountNew, kapi.ServerErrorCountNew
+	kapi.ClientErrorCountNew, kapi.ServerErrorCountNew = clientErrorCount, serverErrorCount
+}
+
+// SetKapiInflightRequests implements [input_data_registry.InputDataRegistry.SetKapiInflightRequests]. The sample time
+// is the current wall clock time.
+func (fidr *FakeInputDataRegistry) SetKapiInflightRequests(
+	shootNamespace string, podName string, currentInflightRequestCount int64) {
+
+	fidr.SetKapiInflightRequestsWithTime(shootNamespace, podName, currentInflightRequestCount, time.Now())
+}
+
+// SetKapiInflightRequestsWithTime records an inflight request count sample taken at the specified time
+func (fidr *FakeInputDataRegistry) SetKapiInflightRequestsWithTime(
+	shootNamespace string, podName string, currentInflightRequestCount int64, metricsTime time.Time) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName)
+	kapi.InflightRequestCount = currentInflightRequestCount
+	kapi.InflightRequestTime = metricsTime
+}
+
+// SetKapiLastScrapeTime implements [input_data_registry.InputDataRegistry.SetKapiLastScrapeTime]
+func (fidr *FakeInputDataRegistry) SetKapiLastScrapeTime(shootNamespace string, podName string, value time.Time) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	fidr.getKapiDataThreadUnsafe(shootNamespace, podName).LastMetricsScrapeTime = value
+}
+
+// SetKapiScrapePeriod implements [input_data_registry.InputDataRegistry.SetKapiScrapePeriod]
+func (fidr *FakeInputDataRegistry) SetKapiScrapePeriod(
+	shootNamespace string, podName string, scrapePeriod time.Duration) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName); kapi != nil {
+		kapi.ScrapePeriod = scrapePeriod
+	}
+}
+
+// SetKapiExtraMetricsUrls implements [input_data_registry.InputDataRegistry.SetKapiExtraMetricsUrls]
+func (fidr *FakeInputDataRegistry) SetKapiExtraMetricsUrls(
+	shootNamespace string, podName string, metricsUrls []string) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName)
+	if kapi == nil || slices.Equal(kapi.ExtraMetricsUrls, metricsUrls) {
+		return
+	}
+
+	// Like the real registry, discard the samples which are not comparable with the ones scraped after the change
+	kapi.ExtraMetricsUrls = metricsUrls
+	kapi.TotalRequestCountNew, kapi.MetricsTimeNew = 0, time.Time{}
+	kapi.TotalRequestCountOld, kapi.MetricsTimeOld = 0, time.Time{}
+	kapi.ClientErrorCountNew, kapi.ServerErrorCountNew, kapi.ClientErrorCountOld, kapi.ServerErrorCountOld = 0, 0, 0, 0
+	kapi.RequestCountHistory = input_data_registry.RequestCountHistory{}
+	kapi.CPUSecondsNew, kapi.CPUSampleTimeNew = 0, time.Time{}
+	kapi.CPUSecondsOld, kapi.CPUSampleTimeOld = 0, time.Time{}
+	kapi.RequestDurationSecondsNew, kapi.RequestDurationCountNew, kapi.RequestDurationTimeNew = 0, 0, time.Time{}
+	kapi.RequestDurationSecondsOld, kapi.RequestDurationCountOld, kapi.RequestDurationTimeOld = 0, 0, time.Time{}
+	kapi.ProcessStartTime = time.Time{}
+}
+
+// GetScrapeContext implements [input_data_registry.InputDataRegistry.GetScrapeContext]
+func (fidr *FakeInputDataRegistry) GetScrapeContext(
+	shootNamespace string, podName string) *input_data_registry.ScrapeContext {
+
+	kapi := fidr.GetKapiData(shootNamespace, podName)
+	if kapi == nil {
+		return nil
+	}
+
+	fidr.lock.Lock()
+	scrapeSettings, ok := fidr.shootScrapeSettings[shootNamespace]
+	if !ok {
+		scrapeSettings = fidr.ScrapeSettings
+	}
+	caCertHash := fidr.shootCACertHashes[shootNamespace]
+	requestSettings := fidr.shootRequestSettings[shootNamespace]
+	fidr.lock.Unlock()
+
+	return &input_data_registry.ScrapeContext{
+		PodUID:           kapi.PodUID,
+		MetricsUrl:       kapi.MetricsUrl,
+		ExtraMetricsUrls: kapi.ExtraMetricsUrls,
+		ScrapePeriod:     kapi.ScrapePeriod,
+		AuthSecret:       fidr.GetShootAuthSecret(shootNamespace),
+		CACertPool:       fidr.GetShootCACertificate(shootNamespace),
+		CACertHash:       caCertHash,
+		ScrapeSettings:   scrapeSettings,
+
+		AuthDegradedReason: fidr.getAuthDegradedReason(shootNamespace),
+		RequestSettings:    requestSettings,
+	}
+}
+
+// SetKapiScrapeResult implements [input_data_registry.InputDataRegistry.SetKapiScrapeResult]. The sample times are
+// the current wall clock time.
+func (fidr *FakeInputDataRegistry) SetKapiScrapeResult(
+	shootNamespace string, podName string, result input_data_registry.KapiScrapeResult) {
+
+	fidr.SetKapiMetrics(shootNamespace, podName, result.TotalRequestCount)
+	fidr.lock.Lock()
+	kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName)
+	kapi.ClientErrorCountNew, kapi.ServerErrorCountNew = result.ClientErrorCount, result.ServerErrorCount
+	fidr.lock.Unlock()
+	if result.HasInflightRequestCount {
+		fidr.SetKapiInflightRequests(shootNamespace, podName, result.InflightRequestCount)
+	}
+	if result.HasCPUSeconds {
+		fidr.SetKapiCPUWithTime(shootNamespace, podName, result.CPUSeconds, time.Now())
+	}
+	if result.HasResidentMemoryBytes {
+		fidr.SetKapiMemoryWithTime(shootNamespace, podName, result.ResidentMemoryBytes, time.Now())
+	}
+	if result.HasRequestDuration {
+		fidr.SetKapiRequestDurationWithTime(
+			shootNamespace, podName, result.RequestDurationSeconds, result.RequestDurationCount, time.Now())
+	}
+	if !result.ProcessStartTime.IsZero() {
+		fidr.SetKapiProcessStartTime(shootNamespace, podName, result.ProcessStartTime)
+	}
+	if result.ScrapeDuration > 0 {
+		fidr.AddKapiScrapeDuration(shootNamespace, podName, result.ScrapeDuration)
+	}
+}
+
+// SetKapiProcessStartTime records the start time of the Kapi process
+func (fidr *FakeInputDataRegistry) SetKapiProcessStartTime(shootNamespace string, podName string, startTime time.Time) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	fidr.getKapiDataThreadUnsafe(shootNamespace, podName).ProcessStartTime = startTime
+}
+
+// AddKapiScrapeDuration records the duration of a successful scrape of the Kapi
+func (fidr *FakeInputDataRegistry) AddKapiScrapeDuration(
+	shootNamespace string, podName string, duration time.Duration) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	fidr.getKapiDataThreadUnsafe(shootNamespace, podName).ScrapeDurationHistory.Add(duration)
+}
+
+// SetKapiRequestDurationWithTime records a request duration sample taken at the specified time. The previous sample
+// becomes the old one.
+func (fidr *FakeInputDataRegistry) SetKapiRequestDurationWithTime(
+	shootNamespace string, podName string, durationSeconds float64, count int64, sampleTime time.Time) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName)
+	kapi.RequestDurationSecondsOld = kapi.RequestDurationSecondsNew
+	kapi.RequestDurationCountOld = kapi.RequestDurationCountNew
+	kapi.RequestDurationTimeOld = kapi.RequestDurationTimeNew
+	kapi.RequestDurationSecondsNew = durationSeconds
+	kapi.RequestDurationCountNew = count
+	kapi.RequestDurationTimeNew = sampleTime
+}
+
+// SetKapiCPUWithTime records a CPU time sample taken at the specified time. The previous sample becomes the old one.
+func (fidr *FakeInputDataRegistry) SetKapiCPUWithTime(
+	shootNamespace string, podName string, cpuSeconds float64, sampleTime time.Time) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName)
+	kapi.CPUSecondsOld = kapi.CPUSecondsNew
+	kapi.CPUSampleTimeOld = kapi.CPUSampleTimeNew
+	kapi.CPUSecondsNew = cpuSeconds
+	kapi.CPUSampleTimeNew = sampleTime
+}
+
+// SetKapiMemoryWithTime records a resident memory sample taken at the specified time
+func (fidr *FakeInputDataRegistry) SetKapiMemoryWithTime(
+	shootNamespace string, podName string, residentMemoryBytes int64, sampleTime time.Time) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName)
+	kapi.ResidentMemoryBytes = residentMemoryBytes
+	kapi.MemorySampleTime = sampleTime
+}
+
+// NotifyKapiMetricsFault implements [input_data_registry.InputDataRegistry.NotifyKapiMetricsFault]
+func (fidr *FakeInputDataRegistry) NotifyKapiMetricsFault(
+	shootNamespace string, podName string, category input_data_registry.ScrapeErrorCategory) int {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName)
+	if kapi == nil {
+		return -1
+	}
+	kapi.FaultCount++
+	kapi.LastFaultCategory = category
+	return kapi.FaultCount
+}
+
+// SetKapiScrapeExcluded implements [input_data_registry.InputDataRegistry.SetKapiScrapeExcluded]
+func (fidr *FakeInputDataRegistry) SetKapiScrapeExcluded(shootNamespace string, podName string, isExcluded bool) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName); kapi != nil {
+		kapi.ScrapeExcluded = isExcluded
+	}
+}
+
+// SetKapiReady implements [input_data_registry.InputDataRegistry.SetKapiReady]
+func (fidr *FakeInputDataRegistry) SetKapiReady(shootNamespace string, podName string, isReady bool) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if kapi := fidr.getKapiDataThreadUnsafe(shootNamespace, podName); kapi != nil {
+		kapi.NotReady = !isReady
+	}
+}
+
+// GetScrapeCoverage computes the coverage the same way as the real registry, as of FakeTimeNow
+func (fidr *FakeInputDataRegistry) GetScrapeCoverage() map[string]input_data_registry.ScrapeCoverage {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	shootKapis := make(map[string][]*input_data_registry.KapiData)
+	for _, kapi := range fidr.kapis {
+		shootKapis[kapi.ShootNamespace()] = append(shootKapis[kapi.ShootNamespace()], kapi)
+	}
+	result := make(map[string]input_data_registry.ScrapeCoverage)
+	for namespace, kapis := range shootKapis {
+		coverage := input_data_registry.GetShootScrapeCoverage(kapis, fidr.DefaultScrapePeriod, fidr.FakeTimeNow)
+		if coverage.KapiCount > 0 {
+			result[namespace] = coverage
+		}
+	}
+	return result
+}
+
+// GetShootAuthSecret implements [input_data_registry.InputDataRegistry.GetShootAuthSecret]
+func (fidr *FakeInputDataRegistry) GetShootAuthSecret(shootNamespace string) string {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if authSecret, ok := fidr.shootAuthSecrets[shootNamespace]; ok {
+		return authSecret
+	}
+	if fidr.authSecret == "" {
+		return "auth secret"
+	}
+	if fidr.authSecret == "__EMPTY__" {
+		return ""
+	}
+	return fidr.authSecret
+}
+
+// RemoveShootAuthSecret makes shoots without an auth secret of their own have no auth secret
+func (fidr *FakeInputDataRegistry) RemoveShootAuthSecret() {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	fidr.authSecret = "__EMPTY__"
+}
+
+// SetShootAuthSecret implements [input_data_registry.InputDataRegistry.SetShootAuthSecret]. Passing authSecret=""
+// leaves the shoot without an auth secret, regardless of the default.
+func (fidr *FakeInputDataRegistry) SetShootAuthSecret(shootNamespace string, authSecret string) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if fidr.shootAuthSecrets == nil {
+		fidr.shootAuthSecrets = make(map[string]string)
+	}
+	fidr.shootAuthSecrets[shootNamespace] = authSecret
+}
+
+// SetShootAuthDegraded implements [input_data_registry.InputDataRegistry.SetShootAuthDegraded]. The reason is
+// recorded in the AuthDegradedReasons field.
+func (fidr *FakeInputDataRegistry) SetShootAuthDegraded(shootNamespace string, reason string) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if fidr.AuthDegradedReasons == nil {
+		fidr.AuthDegradedReasons = make(map[string]string)
+	}
+	fidr.AuthDegradedReasons[shootNamespace] = reason
+}
+
+// getAuthDegradedReason returns the reason recorded via SetShootAuthDegraded for the specified shoot
+func (fidr *FakeInputDataRegistry) getAuthDegradedReason(shootNamespace string) string {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	return fidr.AuthDegradedReasons[shootNamespace]
+}
+
+// GetShootCACertificate implements [input_data_registry.InputDataRegistry.GetShootCACertificate]
+func (fidr *FakeInputDataRegistry) GetShootCACertificate(shootNamespace string) *x509.CertPool {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if certPool, ok := fidr.shootCACertPools[shootNamespace]; ok {
+		return certPool
+	}
+	if fidr.HasNoCACertificate {
+		return nil
+	}
+	return x509.NewCertPool()
+}
+
+// SetShootCACertificate implements [input_data_registry.InputDataRegistry.SetShootCACertificate]. Passing
+// certificate=nil leaves the shoot without a CA certificate, regardless of HasNoCACertificate.
+func (fidr *FakeInputDataRegistry) SetShootCACertificate(shootNamespace string, certificate []byte) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if fidr.shootCACertPools == nil {
+		fidr.shootCACertPools = make(map[string]*x509.CertPool)
+		fidr.shootCACertHashes = make(map[string]string)
+	}
+	if certificate == nil {
+		fidr.shootCACertPools[shootNamespace] = nil
+		delete(fidr.shootCACertHashes, shootNamespace)
+		return
+	}
+
+	certPool := x509.NewCertPool()
+	certPool.AppendCertsFromPEM(certificate)
+	hash := sha256.Sum256(certificate)
+	fidr.shootCACertPools[shootNamespace] = certPool
+	fidr.shootCACertHashes[shootNamespace] = hex.EncodeToString(hash[:])
+}
+
+// SetShootScrapeSettings implements [input_data_registry.InputDataRegistry.SetShootScrapeSettings]
+func (fidr *FakeInputDataRegistry) SetShootScrapeSettings(
+	shootNamespace string, settings *input_data_registry.ShootScrapeSettings) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if settings == nil {
+		delete(fidr.shootScrapeSettings, shootNamespace)
+		return
+	}
+	if fidr.shootScrapeSettings == nil {
+		fidr.shootScrapeSettings = make(map[string]input_data_registry.ShootScrapeSettings)
+	}
+	fidr.shootScrapeSettings[shootNamespace] = *settings
+}
+
+// SetShootScrapeRequestSettings implements [input_data_registry.InputDataRegistry.SetShootScrapeRequestSettings].
+// Unlike the registry, the fake does not copy the settings.
+func (fidr *FakeInputDataRegistry) SetShootScrapeRequestSettings(
+	shootNamespace string, settings *input_data_registry.ShootScrapeRequestSettings) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if settings == nil {
+		delete(fidr.shootRequestSettings, shootNamespace)
+		return
+	}
+	if fidr.shootRequestSettings == nil {
+		fidr.shootRequestSettings = make(map[string]*input_data_registry.ShootScrapeRequestSettings)
+	}
+	fidr.shootRequestSettings[shootNamespace] = settings
+}
+
+// SetDefaultShootScrapeSettings implements [input_data_registry.InputDataRegistry.SetDefaultShootScrapeSettings]. The
+// settings are stored in the ScrapeSettings field.
+func (fidr *FakeInputDataRegistry) SetDefaultShootScrapeSettings(settings input_data_registry.ShootScrapeSettings) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	fidr.ScrapeSettings = settings
+}
+
+// SetDefaultScrapePeriod implements [input_data_registry.InputDataRegistry.SetDefaultScrapePeriod]. The period is
+// stored in the DefaultScrapePeriod field.
+func (fidr *FakeInputDataRegistry) SetDefaultScrapePeriod(scrapePeriod time.Duration) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	fidr.DefaultScrapePeriod = scrapePeriod
+}
+
+// AddKapiWatcher implements [input_data_registry.InputDataRegistry.AddKapiWatcher]. The watcher is stored in the
+// Watcher field. Panics if a watcher is already added.
+func (fidr *FakeInputDataRegistry) AddKapiWatcher(
+	watcher *input_data_registry.KapiWatcher, shouldNotifyOfPreexisting bool) {
+
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if fidr.Watcher != nil {
+		panic("more than one watchers added")
+	}
+	fidr.Watcher = watcher
+	fidr.ShouldWatcherNotifyOfPreexisting = shouldNotifyOfPreexisting
+}
+
+// RemoveKapiWatcher implements [input_data_registry.InputDataRegistry.RemoveKapiWatcher]
+func (fidr *FakeInputDataRegistry) RemoveKapiWatcher(*input_data_registry.KapiWatcher) bool {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if fidr.Watcher == nil {
+		return false
+	}
+	fidr.Watcher = nil
+	return true
+}
+
+// SetKapiWatcherCondition implements [input_data_registry.InputDataRegistry.SetKapiWatcherCondition]. The fake never
+// unsubscribes watchers, so it has no effect.
+func (fidr *FakeInputDataRegistry) SetKapiWatcherCondition(*conditions.ComponentReporter) {
+}
+
+// GetWatcher returns the watcher added via AddKapiWatcher, or nil if there is none. Unlike the Watcher field, it is
+// safe to call while the watcher is being added or removed by another goroutine.
+func (fidr *FakeInputDataRegistry) GetWatcher() *input_data_registry.KapiWatcher {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	return fidr.Watcher
+}
+
+// AddSampleWatcher implements [input_data_registry.InputDataRegistry.AddSampleWatcher]. The watcher is stored in the
+// SampleWatcher field. Panics if a sample watcher is already added.
+func (fidr *FakeInputDataRegistry) AddSampleWatcher(watcher *input_data_registry.SampleWatcher) {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if fidr.SampleWatcher != nil {
+		panic("more than one sample watchers added")
+	}
+	fidr.SampleWatcher = watcher
+}
+
+// RemoveSampleWatcher implements [input_data_registry.InputDataRegistry.RemoveSampleWatcher]
+func (fidr *FakeInputDataRegistry) RemoveSampleWatcher(*input_data_registry.SampleWatcher) bool {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	if fidr.SampleWatcher == nil {
+		return false
+	}
+	fidr.SampleWatcher = nil
+	return true
+}
+
+// GetSampleWatcher returns the sample watcher added via AddSampleWatcher, or nil if there is none. Unlike the
+// SampleWatcher field, it is safe to call while the watcher is being added or removed by another goroutine.
+func (fidr *FakeInputDataRegistry) GetSampleWatcher() *input_data_registry.SampleWatcher {
+	fidr.lock.Lock()
+	defer fidr.lock.Unlock()
+
+	return fidr.SampleWatcher
+}
+
+// fakeDataSourceAdapter adapts the FakeInputDataRegistry to the InputDataSource interface
+type fakeDataSourceAdapter struct{ x *FakeInputDataRegistry }
+
+func (a *fakeDataSourceAdapter) GetShootKapis(_ string) []input_data_registry.ShootKapi {
+	a.x.lock.Lock()
+	defer a.x.lock.Unlock()
+
+	var result = make([]input_data_registry.ShootKapi, len(a.x.kapis))
+	for i := range a.x.kapis {
+		result[i] = a.x.kapis[i].Copy().AsShootKapi()
+	}
+
+	return result
+}
+
+// GetShootGeneration implements [input_data_registry.InputDataSource.GetShootGeneration]. Same as GetGeneration.
+func (a *fakeDataSourceAdapter) GetShootGeneration(_ string) uint64 {
+	return a.GetGeneration()
+}
+
+// GetGeneration implements [input_data_registry.InputDataSource.GetGeneration]. The fake does not track changes, so
+// the generation advances with each call, as if the data changed every time.
+func (a *fakeDataSourceAdapter) GetGeneration() uint64 {
+	a.x.lock.Lock()
+	defer a.x.lock.Unlock()
+
+	a.x.generation++
+	return a.x.generation
+}
+
+func (a *fakeDataSourceAdapter) AddKapiWatcher(
+	watcher *input_data_registry.KapiWatcher, shouldNotifyOfPreexisting bool) {
+
+	a.x.AddKapiWatcher(watcher, shouldNotifyOfPreexisting)
+}
+
+func (a *fakeDataSourceAdapter) RemoveKapiWatcher(watcher *input_data_registry.KapiWatcher) bool {
+	return a.x.RemoveKapiWatcher(watcher)
+}
+
+func (a *fakeDataSourceAdapter) AddSampleWatcher(watcher *input_data_registry.SampleWatcher) {
+	a.x.AddSampleWatcher(watcher)
+}
+
+func (a *fakeDataSourceAdapter) RemoveSampleWatcher(watcher *input_data_registry.SampleWatcher) bool {
+	return a.x.RemoveSampleWatcher(watcher)
+}
@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fakes
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/input_data_registry"
+	gcmtesting "github.com/gardener/gardener-custom-metrics/pkg/testing"
+)
+
+var _ = Describe("fakes.FakeInputDataRegistry", func() {
+	const (
+		testNs  = "shoot--my-shoot"
+		testPod = "kube-apiserver-0"
+	)
+
+	Describe("GetScrapeContext", func() {
+		It("should return nil for an unknown Kapi", func() {
+			// Arrange
+			fidr := &FakeInputDataRegistry{}
+
+			// Act
+			result := fidr.GetScrapeContext(testNs, testPod)
+
+			// Assert
+			Expect(result).To(BeNil())
+		})
+		It("should apply the defaults to a shoot without data of its own", func() {
+			// Arrange
+			fidr := &FakeInputDataRegistry{}
+			fidr.SetKapiData(testNs, testPod, "uid", nil, "https://url")
+			fidr.SetDefaultShootScrapeSettings(input_data_registry.ShootScrapeSettings{Scheme: "http"})
+
+			// Act
+			result := fidr.GetScrapeContext(testNs, testPod)
+
+			// Assert
+			Expect(result.MetricsUrl).To(Equal("https://url"))
+			Expect(result.AuthSecret).To(Equal("auth secret"))
+			Expect(result.CACertPool).NotTo(BeNil())
+			Expect(result.CACertHash).To(BeEmpty())
+			Expect(result.ScrapeSettings.Scheme).To(Equal("http"))
+		})
+		It("should return the shoot data recorded via the setters", func() {
+			// Arrange
+			fidr := &FakeInputDataRegistry{}
+			fidr.SetKapiData(testNs, testPod, "uid", nil, "https://url")
+			fidr.SetShootAuthSecret(testNs, "secret")
+			fidr.SetShootCACertificate(testNs, gcmtesting.GetExampleCACert(0))
+			fidr.SetShootScrapeSettings(testNs, &input_data_registry.ShootScrapeSettings{InsecureSkipTLSVerify: true})
+
+			// Act
+			result := fidr.GetScrapeContext(testNs, testPod)
+
+			// Assert
+			Expect(result.AuthSecret).To(Equal("secret"))
+			Expect(gcmtesting.IsEqualCert(result.CACertPool, gcmtesting.GetExampleCACert(0))).To(BeTrue())
+			Expect(result.CACertHash).NotTo(BeEmpty())
+			Expect(result.ScrapeSettings.InsecureSkipTLSVerify).To(BeTrue())
+		})
+		It("should reflect the removal of shoot data via the setters", func() {
+			// Arrange
+			fidr := &FakeInputDataRegistry{}
+			fidr.SetKapiData(testNs, testPod, "uid", nil, "https://url")
+			fidr.SetShootCACertificate(testNs, gcmtesting.GetExampleCACert(0))
+			fidr.SetShootScrapeSettings(testNs, &input_data_registry.ShootScrapeSettings{Scheme: "http"})
+
+			// Act
+			fidr.SetShootAuthSecret(testNs, "")
+			fidr.SetShootCACertificate(testNs, nil)
+			fidr.SetShootScrapeSettings(testNs, nil)
+			result := fidr.GetScrapeContext(testNs, testPod)
+
+			// Assert
+			Expect(result.AuthSecret).To(BeEmpty())
+			Expect(result.CACertPool).To(BeNil())
+			Expect(result.CACertHash).To(BeEmpty())
+			Expect(result.ScrapeSettings.Scheme).To(BeEmpty())
+		})
+	})
+
+	Describe("RemoveShootData", func() {
+		It("should remove the shoot's Kapis and shoot data, and leave other shoots intact", func() {
+			// Arrange
+			fidr := &FakeInputDataRegistry{}
+			fidr.SetKapiData(testNs, testPod, "uid", nil, "https://url")
+			fidr.SetKapiData("other-ns", testPod, "uid2", nil, "https://url2")
+			fidr.SetShootAuthSecret(testNs, "secret")
+
+			// Act
+			result := fidr.RemoveShootData(testNs)
+
+			// Assert
+			Expect(result).To(BeTrue())
+			Expect(fidr.GetShootNamespaces()).To(ConsistOf("other-ns"))
+			Expect(fidr.GetShootAuthSecret(testNs)).To(Equal("auth secret"))
+			Expect(fidr.GetKapiData("other-ns", testPod)).NotTo(BeNil())
+		})
+		It("should return false for an unknown shoot", func() {
+			// Arrange
+			fidr := &FakeInputDataRegistry{}
+
+			// Act
+			result := fidr.RemoveShootData(testNs)
+
+			// Assert
+			Expect(result).To(BeFalse())
+		})
+	})
+
+	Describe("DataSource", func() {
+		It("should return snapshots of the Kapis, unaffected by later changes", func() {
+			// Arrange
+			fidr := &FakeInputDataRegistry{}
+			fidr.SetKapiData(testNs, testPod, "uid", nil, "https://url")
+			fidr.SetKapiMetrics(testNs, testPod, 10)
+
+			// Act
+			result := fidr.DataSource().GetShootKapis(testNs)
+			fidr.SetKapiMetrics(testNs, testPod, 20)
+
+			// Assert
+			Expect(result).To(HaveLen(1))
+			Expect(result[0].ShootNamespace()).To(Equal(testNs))
+			Expect(result[0].PodName()).To(Equal(testPod))
+			Expect(result[0].TotalRequestCountNew()).To(Equal(int64(10)))
+		})
+	})
+})
@@ -2,17 +2,21 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
-package testutil
+// Package testing provides helpers for unit tests of this component, and of components which embed it. The helpers have
+// no dependencies on the rest of the module, so tests of any package can use them.
+//
+// Fakes of the module's interfaces are in the [github.com/gardener/gardener-custom-metrics/pkg/testing/fakes] package.
+package testing
 
 import (
 	"crypto/x509"
 	"time"
 )
 
-// DefaultDate returns the default date used by other functions in this package
+// DefaultDate returns the default date used by other functions in this package: January 1st of year 1, UTC
 func DefaultDate() time.Time { return time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC) }
 
-// GetExampleCACert returns one of several available sample CA certificates
+// GetExampleCACert returns one of several available sample CA certificates, in PEM format. Valid IDs are 0 and 1.
 func GetExampleCACert(id int) []byte {
 	certs := [][]byte{
 		[]byte(`-----BEGIN CERTIFICATE-----
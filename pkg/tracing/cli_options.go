@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	endpointFlagName      = "tracing-endpoint"
+	samplingRatioFlagName = "tracing-sampling-ratio"
+	insecureFlagName      = "tracing-insecure"
+)
+
+// CLIOptions are command line options related to exporting internal traces via OTLP.
+type CLIOptions struct {
+	config *CLIConfig // Contains the final, processed values of the options
+
+	// For the meaning of the different option fields, see the CLIConfig type, which mirrors these fields
+	Endpoint      string
+	SamplingRatio float64
+	Insecure      bool
+}
+
+// NewCLIOptions creates a CLIOptions object with default values
+func NewCLIOptions() *CLIOptions {
+	return &CLIOptions{
+		SamplingRatio: 0.01,
+	}
+}
+
+// AddFlags implements [github.com/gardener/gardener/extensions/pkg/controller/cmd.Flagger.AddFlags].
+func (options *CLIOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(
+		&options.Endpoint,
+		endpointFlagName,
+		options.Endpoint,
+		"If specified, traces of scrape operations and metric requests are exported to this OTLP/gRPC collector "+
+			"endpoint (host:port). Default: tracing disabled")
+	flags.Float64Var(
+		&options.SamplingRatio,
+		samplingRatioFlagName,
+		options.SamplingRatio,
+		fmt.Sprintf(
+			"The fraction of operations which are traced, between 0 and 1. Operations which are part of a sampled "+
+				"parent trace are always traced. Default: %g",
+			options.SamplingRatio))
+	flags.BoolVar(
+		&options.Insecure,
+		insecureFlagName,
+		options.Insecure,
+		"Connect to the tracing collector endpoint without TLS. Default: false")
+}
+
+// Complete implements [github.com/gardener/gardener/extensions/pkg/controller/cmd.Completer.Complete].
+func (options *CLIOptions) Complete() error {
+	if options.SamplingRatio < 0 || options.SamplingRatio > 1 {
+		return fmt.Errorf("the --%s option must be between 0 and 1", samplingRatioFlagName)
+	}
+
+	options.config = &CLIConfig{
+		Endpoint:      options.Endpoint,
+		SamplingRatio: options.SamplingRatio,
+		Insecure:      options.Insecure,
+	}
+
+	return nil
+}
+
+// Completed returns the final, processed values of the options. Only call this if `Complete` was successful.
+func (options *CLIOptions) Completed() *CLIConfig {
+	return options.config
+}
+
+// CLIConfig is a completed configuration, result of successfully parsing and processing CLI options.
+// It contains configuration which directs the export of internal traces.
+type CLIConfig struct {
+	Endpoint      string  // The OTLP/gRPC collector endpoint (host:port). Empty means tracing is disabled.
+	SamplingRatio float64 // The fraction of root operations which are traced
+	Insecure      bool    // Connect to the collector without TLS
+}
+
+// IsEnabled tells whether trace export is enabled
+func (config *CLIConfig) IsEnabled() bool {
+	return config.Endpoint != ""
+}
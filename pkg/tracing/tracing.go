@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tracing exports internal traces of scrape operations and metric requests via OpenTelemetry OTLP.
+//
+// Instrumented code obtains its tracer via [Tracer]. Until [Setup] is called with tracing enabled, the tracer is a
+// no-op, so instrumentation has negligible cost when tracing is disabled.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/component-base/version"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+// TracerName is the instrumentation name under which the application's spans are reported
+const TracerName = "github.com/gardener/gardener-custom-metrics"
+
+// Tracer returns the tracer which application components use to create spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// EndSpan records the error, if any, on the span, and ends the span
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Setup installs the global trace provider, which exports traces to the collector specified in the configuration. If
+// tracing is disabled, Setup does nothing.
+//
+// The returned function flushes pending traces and releases the exporter. It must be called upon application exit.
+func Setup(ctx context.Context, config *CLIConfig) (shutdown func(ctx context.Context) error, err error) {
+	if !config.IsEnabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Endpoint)}
+	if config.Insecure {
+		exporterOptions = append(exporterOptions, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("setting up tracing: creating OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SamplingRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(app.Name),
+			semconv.ServiceVersionKey.String(version.Get().GitVersion),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
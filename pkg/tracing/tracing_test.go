@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("tracing", func() {
+	Describe("Setup", func() {
+		It("should do nothing, if tracing is disabled", func() {
+			// Act
+			shutdown, err := Setup(context.Background(), &CLIConfig{})
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(shutdown(context.Background())).To(Succeed())
+		})
+	})
+
+	Describe("EndSpan", func() {
+		var recorder *tracetest.SpanRecorder
+		var tracerProvider *sdktrace.TracerProvider
+
+		BeforeEach(func() {
+			recorder = tracetest.NewSpanRecorder()
+			tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		})
+
+		It("should end the span, and mark it as failed, if there is an error", func() {
+			// Arrange
+			_, span := tracerProvider.Tracer(TracerName).Start(context.Background(), "op")
+
+			// Act
+			EndSpan(span, fmt.Errorf("my error"))
+
+			// Assert
+			Expect(recorder.Ended()).To(HaveLen(1))
+			Expect(recorder.Ended()[0].Status().Code).To(Equal(codes.Error))
+			Expect(recorder.Ended()[0].Status().Description).To(Equal("my error"))
+			Expect(recorder.Ended()[0].Events()).To(HaveLen(1))
+		})
+
+		It("should end the span, without marking it as failed, if there is no error", func() {
+			// Arrange
+			_, span := tracerProvider.Tracer(TracerName).Start(context.Background(), "op")
+
+			// Act
+			EndSpan(span, nil)
+
+			// Assert
+			Expect(recorder.Ended()).To(HaveLen(1))
+			Expect(recorder.Ended()[0].Status().Code).To(Equal(codes.Unset))
+		})
+	})
+})
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package flagutil provides utilities for working with command line flag sets
+package flagutil
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Defaults returns the default values of the flags in the specified flag set, keyed by flag name. Boolean and numeric
+// defaults are returned as bool, int64, uint64 and float64 respectively, the defaults of list flags as []string, the
+// defaults of map flags as map[string]string, and all other defaults (e.g. durations) in their textual form. Flags
+// whose default is an empty list or map are omitted: the syntax of some of them cannot express an empty value, and
+// leaving a flag unset yields its default anyway.
+//
+// The result, marshalled to YAML, is a valid config file (see package
+// [github.com/gardener/gardener-custom-metrics/pkg/config_file]), which sets all flags to their default values.
+func Defaults(flags *pflag.FlagSet) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if err != nil {
+			return
+		}
+		if flag.DefValue == "[]" {
+			return // An empty list or map
+		}
+		var value interface{}
+		value, err = defaultValue(flag)
+		if err != nil {
+			err = fmt.Errorf("flag '%s': %w", flag.Name, err)
+			return
+		}
+		result[flag.Name] = value
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// defaultValue converts the flag's textual default value to the typed form described in Defaults
+func defaultValue(flag *pflag.Flag) (interface{}, error) {
+	text := flag.DefValue
+	valueType := flag.Value.Type()
+	switch {
+	case valueType == "bool":
+		return strconv.ParseBool(text)
+	case strings.HasPrefix(valueType, "int") && !strings.HasSuffix(valueType, "Slice"):
+		return strconv.ParseInt(text, 10, 64)
+	case strings.HasPrefix(valueType, "uint") && !strings.HasSuffix(valueType, "Slice"):
+		return strconv.ParseUint(text, 10, 64)
+	case valueType == "float32" || valueType == "float64":
+		return strconv.ParseFloat(text, 64)
+	case valueType == "stringToString":
+		items, err := parseList(text)
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]string, len(items))
+		for _, item := range items {
+			key, value, isFound := strings.Cut(item, "=")
+			if !isFound {
+				return nil, fmt.Errorf("invalid map entry '%s' in default value '%s'", item, text)
+			}
+			result[key] = value
+		}
+		return result, nil
+	}
+
+	if _, isSlice := flag.Value.(pflag.SliceValue); isSlice {
+		return parseList(text)
+	}
+	return text, nil
+}
+
+// parseList parses the textual default value of a list flag, which pflag renders as a bracketed, comma-separated list,
+// e.g. "[a,b]". Items which contain commas are quoted.
+func parseList(text string) ([]string, error) {
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "["), "]")
+	items, err := csv.NewReader(strings.NewReader(text)).Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid list default value '%s': %w", text, err)
+	}
+	return items, nil
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package flagutil
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+)
+
+var _ = Describe("flagutil", func() {
+	Describe("Defaults", func() {
+		It("should return typed default values, keyed by flag name", func() {
+			// Arrange
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.Bool("debug", true, "")
+			flags.Int("count", -3, "")
+			flags.Uint16("port", 8080, "")
+			flags.Float32("qps", 2.5, "")
+			flags.String("name", "a b", "")
+			flags.Duration("period", 90*time.Second, "")
+			flags.StringSlice("patterns", []string{"a*", "b,c"}, "")
+			flags.StringToString("labels", map[string]string{"seed": "s1", "region": "eu"}, "")
+
+			// Act
+			defaults, err := Defaults(flags)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(defaults).To(Equal(map[string]interface{}{
+				"debug":    true,
+				"count":    int64(-3),
+				"port":     uint64(8080),
+				"qps":      float64(2.5),
+				"name":     "a b",
+				"period":   "1m30s",
+				"patterns": []string{"a*", "b,c"},
+				"labels":   map[string]string{"seed": "s1", "region": "eu"},
+			}))
+		})
+
+		It("should omit flags whose default is an empty list or map", func() {
+			// Arrange
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.StringSlice("patterns", nil, "")
+			flags.StringToString("labels", nil, "")
+			flags.String("name", "", "")
+
+			// Act
+			defaults, err := Defaults(flags)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(defaults).To(Equal(map[string]interface{}{"name": ""}))
+		})
+
+		It("should return the defaults, rather than the current values", func() {
+			// Arrange
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.Int("count", 1, "")
+			Expect(flags.Set("count", "2")).To(Succeed())
+
+			// Act
+			defaults, err := Defaults(flags)
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(defaults).To(HaveKeyWithValue("count", int64(1)))
+		})
+	})
+})
@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gardener
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Defaults, which match the way Gardener labels shoot kube-apiserver pods, and names shoot namespaces
+const (
+	DefaultKapiPodSelector      = "app=kubernetes,role=apiserver"
+	DefaultShootNamespacePrefix = "shoot-"
+)
+
+// KapiSelector identifies the shoot kube-apiserver (Kapi) pods in a seed, and the namespaces which contain shoot
+// control planes. It allows running the application on landscapes which label or name those differently than Gardener.
+//
+// A nil *KapiSelector is valid, and applies the Gardener defaults. All methods are concurrency-safe.
+type KapiSelector struct {
+	// PodLabels selects the Kapi pods
+	PodLabels labels.Selector
+	// NamespacePrefix is a prefix which all shoot namespace names have. May be empty.
+	NamespacePrefix string
+	// NamespacePattern, if not nil, must also match the name of a shoot namespace
+	NamespacePattern *regexp.Regexp
+}
+
+// NewKapiSelector creates a KapiSelector from its textual specification. podSelector is a label selector in the
+// form accepted by [labels.Parse]. namespacePattern, if not empty, is a regular expression which shoot namespace
+// names must match, in addition to having namespacePrefix.
+func NewKapiSelector(podSelector string, namespacePrefix string, namespacePattern string) (*KapiSelector, error) {
+	podLabels, err := labels.Parse(podSelector)
+	if err != nil {
+		return nil, fmt.Errorf("parsing pod selector: %w", err)
+	}
+	if podLabels.Empty() {
+		return nil, fmt.Errorf("the pod selector must not be empty")
+	}
+
+	selector := &KapiSelector{PodLabels: podLabels, NamespacePrefix: namespacePrefix}
+	if namespacePattern != "" {
+		if selector.NamespacePattern, err = regexp.Compile(namespacePattern); err != nil {
+			return nil, fmt.Errorf("parsing namespace pattern: %w", err)
+		}
+	}
+	return selector, nil
+}
+
+// defaultKapiPodLabels is the parsed form of DefaultKapiPodSelector
+var defaultKapiPodLabels = labels.SelectorFromSet(labels.Set{"app": "kubernetes", "role": "apiserver"})
+
+// IsShootNamespace determines whether the specified namespace contains a shoot control plane
+func (s *KapiSelector) IsShootNamespace(namespace string) bool {
+	if s == nil {
+		return IsShootNamespace(namespace)
+	}
+	if namespace == "" || !strings.HasPrefix(namespace, s.NamespacePrefix) {
+		return false
+	}
+	return s.NamespacePattern == nil || s.NamespacePattern.MatchString(namespace)
+}
+
+// IsKapiPodLabels determines whether a pod with the specified labels is a Kapi pod
+func (s *KapiSelector) IsKapiPodLabels(podLabels map[string]string) bool {
+	return s.PodLabelSelector().Matches(labels.Set(podLabels))
+}
+
+// PodLabelSelector returns the label selector which selects the Kapi pods
+func (s *KapiSelector) PodLabelSelector() labels.Selector {
+	if s == nil {
+		return defaultKapiPodLabels
+	}
+	return s.PodLabels
+}
+
+// PodLabelSelectorWith returns a label selector which selects the Kapi pods, and also the pods selected by other. If
+// other is nil, the result is the same as that of PodLabelSelector.
+//
+// Label selectors cannot express a disjunction, so the result may select more pods than those two sets. If both
+// selectors require a specific value, or one of a set of values, for the same label, the result requires one of the
+// values of either selector for that label. E.g. "app=kubernetes,role=apiserver" with "app=etcd-statefulset" results
+// in "app in (etcd-statefulset,kubernetes)". Otherwise, the result selects all pods.
+func (s *KapiSelector) PodLabelSelectorWith(other labels.Selector) labels.Selector {
+	kapiPodLabels := s.PodLabelSelector()
+	if other == nil {
+		return kapiPodLabels
+	}
+
+	kapiRequirements, _ := kapiPodLabels.Requirements()
+	otherRequirements, _ := other.Requirements()
+	for _, kapiRequirement := range kapiRequirements {
+		kapiValues, ok := requiredValues(kapiRequirement)
+		if !ok {
+			continue
+		}
+		for _, otherRequirement := range otherRequirements {
+			otherValues, ok := requiredValues(otherRequirement)
+			if !ok || otherRequirement.Key() != kapiRequirement.Key() {
+				continue
+			}
+			requirement, err := labels.NewRequirement(
+				kapiRequirement.Key(), selection.In, sets.List(kapiValues.Union(otherValues)))
+			if err != nil {
+				continue
+			}
+			return labels.NewSelector().Add(*requirement)
+		}
+	}
+	return labels.Everything()
+}
+
+// requiredValues returns the values one of which the requirement demands for its label, or false if the requirement
+// does not demand specific values, e.g. because it is an exclusion
+func requiredValues(requirement labels.Requirement) (sets.Set[string], bool) {
+	switch requirement.Operator() {
+	case selection.Equals, selection.DoubleEquals, selection.In:
+		return sets.New(requirement.Values().UnsortedList()...), true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gardener
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var _ = Describe("util/gardener.KapiSelector", func() {
+	var kapiLabels = map[string]string{"app": "kubernetes", "role": "apiserver", "other": "x"}
+
+	Describe("nil selector", func() {
+		It("should apply the Gardener defaults", func() {
+			// Arrange
+			var selector *KapiSelector
+
+			// Act and assert
+			Expect(selector.IsShootNamespace("shoot--my-shoot")).To(BeTrue())
+			Expect(selector.IsShootNamespace("garden")).To(BeFalse())
+			Expect(selector.IsKapiPodLabels(kapiLabels)).To(BeTrue())
+			Expect(selector.IsKapiPodLabels(map[string]string{"app": "kubernetes"})).To(BeFalse())
+			Expect(selector.IsKapiPodLabels(nil)).To(BeFalse())
+		})
+	})
+
+	Describe("NewKapiSelector", func() {
+		It("should be equivalent to the nil selector, when created with the default values", func() {
+			// Arrange
+			selector, err := NewKapiSelector(DefaultKapiPodSelector, DefaultShootNamespacePrefix, "")
+
+			// Act and assert
+			Expect(err).To(Succeed())
+			Expect(selector.IsShootNamespace("shoot--my-shoot")).To(BeTrue())
+			Expect(selector.IsShootNamespace("garden")).To(BeFalse())
+			Expect(selector.IsShootNamespace("")).To(BeFalse())
+			Expect(selector.IsKapiPodLabels(kapiLabels)).To(BeTrue())
+			Expect(selector.IsKapiPodLabels(map[string]string{"app": "kubernetes"})).To(BeFalse())
+			Expect(selector.PodLabelSelector().String()).To(Equal((*KapiSelector)(nil).PodLabelSelector().String()))
+		})
+
+		It("should apply custom criteria", func() {
+			// Arrange
+			selector, err := NewKapiSelector("component in (kube-apiserver,apiserver)", "cp-", "^cp-[a-z]+$")
+
+			// Act and assert
+			Expect(err).To(Succeed())
+			Expect(selector.IsShootNamespace("cp-abc")).To(BeTrue())
+			Expect(selector.IsShootNamespace("cp-abc-1")).To(BeFalse())
+			Expect(selector.IsShootNamespace("shoot--abc")).To(BeFalse())
+			Expect(selector.IsKapiPodLabels(map[string]string{"component": "kube-apiserver"})).To(BeTrue())
+			Expect(selector.IsKapiPodLabels(kapiLabels)).To(BeFalse())
+		})
+
+		It("should fail on invalid input", func() {
+			for _, args := range [][]string{{"=x", "", ""}, {"app in (", "", ""}, {"", "", ""}, {"app=x", "", "("}} {
+				// Act
+				_, err := NewKapiSelector(args[0], args[1], args[2])
+
+				// Assert
+				Expect(err).To(HaveOccurred(), "%v", args)
+			}
+		})
+	})
+
+	Describe("PodLabelSelectorWith", func() {
+		etcdLabels := map[string]string{"app": "etcd-statefulset", "role": "main"}
+		etcdSelector := labels.SelectorFromSet(labels.Set{"app": "etcd-statefulset"})
+
+		It("should select both the Kapi pods and the other pods, if the selectors share a label", func() {
+			// Arrange
+			var selector *KapiSelector
+
+			// Act
+			result := selector.PodLabelSelectorWith(etcdSelector)
+
+			// Assert
+			Expect(result.String()).To(Equal("app in (etcd-statefulset,kubernetes)"))
+			Expect(result.Matches(labels.Set(kapiLabels))).To(BeTrue())
+			Expect(result.Matches(labels.Set(etcdLabels))).To(BeTrue())
+			Expect(result.Matches(labels.Set{"app": "other"})).To(BeFalse())
+		})
+
+		It("should select all pods, if the selectors share no label", func() {
+			// Arrange
+			selector, err := NewKapiSelector("component=kube-apiserver", "", "")
+			Expect(err).To(Succeed())
+
+			// Act
+			result := selector.PodLabelSelectorWith(etcdSelector)
+
+			// Assert
+			Expect(result.Empty()).To(BeTrue())
+		})
+
+		It("should select only the Kapi pods, if there is no other selector", func() {
+			// Arrange
+			var selector *KapiSelector
+
+			// Act
+			result := selector.PodLabelSelectorWith(nil)
+
+			// Assert
+			Expect(result.String()).To(Equal(selector.PodLabelSelector().String()))
+		})
+	})
+})
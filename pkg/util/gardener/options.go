@@ -7,14 +7,18 @@ package gardener
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/util/flagutil"
 )
 
 const (
@@ -40,6 +44,9 @@ const (
 	// HealthBindAddressFlag is the name of the command line flag to specify the TCP address that the controller
 	// should bind to for serving health probes
 	HealthBindAddressFlag = "health-bind-address"
+	// PprofBindAddressFlag is the name of the command line flag to specify the TCP address that the controller
+	// should bind to for serving the pprof profiling endpoints. Empty (the default) disables profiling.
+	PprofBindAddressFlag = "pprof-bind-address"
 
 	// KubeconfigFlag is the name of the command line flag to specify a kubeconfig used to retrieve
 	// a rest.Config for a manager.Manager.
@@ -47,6 +54,9 @@ const (
 	// MasterURLFlag is the name of the command line flag to specify the master URL override for
 	// a rest.Config of a manager.Manager.
 	MasterURLFlag = "master"
+	// AdditionalKubeconfigFlag is the name of the command line flag to specify a kubeconfig for an additional cluster,
+	// which is monitored along with the one specified by KubeconfigFlag.
+	AdditionalKubeconfigFlag = "additional-kubeconfig"
 )
 
 // ManagerOptions are command line options that can be set for manager.Options.
@@ -81,6 +91,9 @@ type ManagerOptions struct {
 	MetricsBindAddress string
 	// HealthBindAddress is the TCP address that the controller should bind to for serving health probes.
 	HealthBindAddress string
+	// PprofBindAddress is the TCP address that the controller should bind to for serving the pprof profiling
+	// endpoints. Empty means that profiling is disabled.
+	PprofBindAddress string
 
 	config *ManagerConfig
 }
@@ -103,11 +116,24 @@ func (m *ManagerOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&m.WebhookCertDir, WebhookCertDirFlag, m.WebhookCertDir, "The directory that contains the webhook server key and certificate.")
 	fs.StringVar(&m.MetricsBindAddress, MetricsBindAddressFlag, ":8080", "bind address for the metrics server")
 	fs.StringVar(&m.HealthBindAddress, HealthBindAddressFlag, ":8081", "bind address for the health server")
+	fs.StringVar(&m.PprofBindAddress, PprofBindAddressFlag, m.PprofBindAddress,
+		"bind address for the pprof profiling endpoints, e.g. ':6060'. Continuous profilers which pull profiles, "+
+			"such as Pyroscope, can scrape these endpoints. Empty disables profiling.")
+}
+
+// Defaults returns the default values which AddFlags registers for the flags it binds, keyed by flag name. Those are
+// the current values of the options, save for the flags which have fixed defaults. See [flagutil.Defaults] for the
+// form of the values. Does not modify the options.
+func (m *ManagerOptions) Defaults() (map[string]interface{}, error) {
+	optionsCopy := *m // Binding to a flag overwrites the field with the flag default
+	flags := pflag.NewFlagSet("manager", pflag.ContinueOnError)
+	optionsCopy.AddFlags(flags)
+	return flagutil.Defaults(flags)
 }
 
 // Complete implements Completer.Complete.
 func (m *ManagerOptions) Complete() error {
-	m.config = &ManagerConfig{m.LeaderElection, m.LeaderElectionResourceLock, m.LeaderElectionID, m.LeaderElectionNamespace, m.WebhookServerHost, m.WebhookServerPort, m.WebhookCertDir, m.MetricsBindAddress, m.HealthBindAddress}
+	m.config = &ManagerConfig{m.LeaderElection, m.LeaderElectionResourceLock, m.LeaderElectionID, m.LeaderElectionNamespace, m.WebhookServerHost, m.WebhookServerPort, m.WebhookCertDir, m.MetricsBindAddress, m.HealthBindAddress, m.PprofBindAddress}
 	return nil
 }
 
@@ -136,6 +162,9 @@ type ManagerConfig struct {
 	MetricsBindAddress string
 	// HealthBindAddress is the TCP address that the controller should bind to for serving health probes.
 	HealthBindAddress string
+	// PprofBindAddress is the TCP address that the controller should bind to for serving the pprof profiling
+	// endpoints. Empty means that profiling is disabled.
+	PprofBindAddress string
 }
 
 // Apply sets the values of this ManagerConfig in the given manager.Options.
@@ -146,6 +175,7 @@ func (c *ManagerConfig) Apply(opts *manager.Options) {
 	opts.LeaderElectionNamespace = c.LeaderElectionNamespace
 	opts.Metrics = metricsserver.Options{BindAddress: c.MetricsBindAddress}
 	opts.HealthProbeBindAddress = c.HealthBindAddress
+	opts.PprofBindAddress = c.PprofBindAddress
 	opts.WebhookServer = webhook.NewServer(webhook.Options{
 		Host:    c.WebhookServerHost,
 		Port:    c.WebhookServerPort,
@@ -171,6 +201,10 @@ type RESTOptions struct {
 	Kubeconfig string
 	// MasterURL is an override for the URL in a kubeconfig. Only used if out-of-cluster.
 	MasterURL string
+	// AdditionalKubeconfigs specifies additional clusters, each in the form <name>=<kubeconfig path>[:<context>].
+	// The name identifies the cluster, and must be a DNS label. If the context is omitted, the kubeconfig's current
+	// context is used.
+	AdditionalKubeconfigs []string
 
 	config        *RESTConfig
 	testIsolation testIsolation
@@ -183,6 +217,8 @@ func NewRESTOptions() *RESTOptions {
 			K8sBuildConfigFromFlags: clientcmd.BuildConfigFromFlags,
 			K8sInClusterConfig:      rest.InClusterConfig,
 			OsGetenv:                os.Getenv,
+
+			K8sBuildConfigFromKubeconfigContext: buildConfigFromKubeconfigContext,
 		},
 	}
 }
@@ -191,6 +227,16 @@ func NewRESTOptions() *RESTOptions {
 type RESTConfig struct {
 	// Config is the rest.Config.
 	Config *rest.Config
+	// AdditionalClusters are the clusters specified via AdditionalKubeconfigFlag, in the order specified.
+	AdditionalClusters []ClusterRESTConfig
+}
+
+// ClusterRESTConfig is the REST configuration of a named cluster
+type ClusterRESTConfig struct {
+	// Name identifies the cluster
+	Name string
+	// Config is the rest.Config.
+	Config *rest.Config
 }
 
 // Enables redirecting library calls, originating in the RESTOptions unit, during test
@@ -201,6 +247,48 @@ type testIsolation struct {
 	K8sInClusterConfig func() (*rest.Config, error)
 	// Points to os.Getenv()
 	OsGetenv func(key string) string
+	// Points to buildConfigFromKubeconfigContext
+	K8sBuildConfigFromKubeconfigContext func(kubeconfigPath string, context string) (*rest.Config, error)
+}
+
+// buildConfigFromKubeconfigContext builds a rest.Config from the specified context of the specified kubeconfig file.
+// An empty context means the kubeconfig's current context.
+func buildConfigFromKubeconfigContext(kubeconfigPath string, context string) (*rest.Config, error) {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
+		&clientcmd.ConfigOverrides{CurrentContext: context},
+	).ClientConfig()
+}
+
+// buildAdditionalConfigs builds the REST configurations of the clusters specified by AdditionalKubeconfigs
+func (r *RESTOptions) buildAdditionalConfigs() ([]ClusterRESTConfig, error) {
+	var result []ClusterRESTConfig
+	names := make(map[string]bool, len(r.AdditionalKubeconfigs))
+	for _, spec := range r.AdditionalKubeconfigs {
+		name, location, ok := strings.Cut(spec, "=")
+		if !ok || location == "" {
+			return nil, fmt.Errorf(
+				"invalid --%s option '%s'. Expected format: <name>=<kubeconfig path>[:<context>]",
+				AdditionalKubeconfigFlag, spec)
+		}
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, fmt.Errorf(
+				"invalid cluster name '%s' in --%s option: %s", name, AdditionalKubeconfigFlag, strings.Join(errs, "; "))
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate cluster name '%s' in --%s options", name, AdditionalKubeconfigFlag)
+		}
+		names[name] = true
+
+		path, context, _ := strings.Cut(location, ":")
+		config, err := r.testIsolation.K8sBuildConfigFromKubeconfigContext(path, context)
+		if err != nil {
+			return nil, fmt.Errorf("building configuration for cluster '%s': %w", name, err)
+		}
+		result = append(result, ClusterRESTConfig{Name: name, Config: config})
+	}
+
+	return result, nil
 }
 
 func (r *RESTOptions) buildConfig() (*rest.Config, error) {
@@ -226,8 +314,12 @@ func (r *RESTOptions) Complete() error {
 	if err != nil {
 		return err
 	}
+	additionalClusters, err := r.buildAdditionalConfigs()
+	if err != nil {
+		return err
+	}
 
-	r.config = &RESTConfig{config}
+	r.config = &RESTConfig{Config: config, AdditionalClusters: additionalClusters}
 	return nil
 }
 
@@ -240,4 +332,17 @@ func (r *RESTOptions) Completed() *RESTConfig {
 func (r *RESTOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&r.Kubeconfig, KubeconfigFlag, "", "Paths to a kubeconfig. Only required if out-of-cluster.")
 	fs.StringVar(&r.MasterURL, MasterURLFlag, "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	fs.StringSliceVar(&r.AdditionalKubeconfigs, AdditionalKubeconfigFlag, nil,
+		"An additional seed cluster whose kube-apiserver pods are monitored, in the form "+
+			"<name>=<kubeconfig path>[:<context>]. The name identifies the cluster, and must be a DNS label. If the "+
+			"context is omitted, the kubeconfig's current context is used. May be repeated, or comma-separated.")
+}
+
+// Defaults returns the default values which AddFlags registers for the flags it binds, keyed by flag name. See
+// [flagutil.Defaults] for the form of the values. Does not modify the options.
+func (r *RESTOptions) Defaults() (map[string]interface{}, error) {
+	optionsCopy := *r // Binding to a flag overwrites the field with the flag default
+	flags := pflag.NewFlagSet("rest", pflag.ContinueOnError)
+	optionsCopy.AddFlags(flags)
+	return flagutil.Defaults(flags)
 }
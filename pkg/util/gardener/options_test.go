@@ -117,5 +117,123 @@ var _ = Describe("RESTOptions", func() {
 			Expect(options.Completed().Config).To(BeNil())
 			Expect(output.ForwardedKubeconfig).To(Equal(clientcmd.RecommendedHomeFile))
 		})
+
+		Context("with additional kubeconfigs", func() {
+			// Applied to options created by newRestOptions. Records the kubeconfig path and context used to build each
+			// additional cluster's configuration, and returns a config whose host is the path.
+			arrangeAdditional := func(options *RESTOptions) *[]string {
+				var forwarded []string
+				options.testIsolation.K8sBuildConfigFromKubeconfigContext =
+					func(kubeconfigPath string, context string) (*rest.Config, error) {
+						forwarded = append(forwarded, kubeconfigPath+"|"+context)
+						return &rest.Config{Host: kubeconfigPath}, nil
+					}
+				return &forwarded
+			}
+
+			It("should build the configuration of each additional cluster, in order", func() {
+				// Arrange
+				options, _ := newRestOptions()
+				forwarded := arrangeAdditional(options)
+				options.AdditionalKubeconfigs = []string{"seed-a=/kc/a", "seed-b=/kc/b:my-context"}
+
+				// Act
+				err := options.Complete()
+
+				// Assert
+				Expect(err).To(Succeed())
+				Expect(*forwarded).To(Equal([]string{"/kc/a|", "/kc/b|my-context"}))
+				clusters := options.Completed().AdditionalClusters
+				Expect(clusters).To(HaveLen(2))
+				Expect(clusters[0].Name).To(Equal("seed-a"))
+				Expect(clusters[0].Config.Host).To(Equal("/kc/a"))
+				Expect(clusters[1].Name).To(Equal("seed-b"))
+				Expect(clusters[1].Config.Host).To(Equal("/kc/b"))
+			})
+
+			It("should fail if a cluster name is duplicated", func() {
+				// Arrange
+				options, _ := newRestOptions()
+				arrangeAdditional(options)
+				options.AdditionalKubeconfigs = []string{"seed-a=/kc/a", "seed-a=/kc/b"}
+
+				// Act
+				err := options.Complete()
+
+				// Assert
+				Expect(err).To(MatchError(ContainSubstring("duplicate cluster name 'seed-a'")))
+			})
+
+			It("should fail if the specification is malformed", func() {
+				for _, spec := range []string{"/kc/a", "seed-a=", "Seed_A=/kc/a"} {
+					// Arrange
+					options, _ := newRestOptions()
+					arrangeAdditional(options)
+					options.AdditionalKubeconfigs = []string{spec}
+
+					// Act
+					err := options.Complete()
+
+					// Assert
+					Expect(err).To(HaveOccurred(), spec)
+				}
+			})
+
+			It("should fail if the configuration cannot be built", func() {
+				// Arrange
+				options, _ := newRestOptions()
+				options.testIsolation.K8sBuildConfigFromKubeconfigContext = func(_ string, _ string) (*rest.Config, error) {
+					return nil, fmt.Errorf("my error")
+				}
+				options.AdditionalKubeconfigs = []string{"seed-a=/kc/a"}
+
+				// Act
+				err := options.Complete()
+
+				// Assert
+				Expect(err).To(MatchError(ContainSubstring("seed-a")))
+				Expect(err).To(MatchError(ContainSubstring("my error")))
+			})
+		})
+	})
+})
+
+var _ = Describe("ManagerOptions", func() {
+	Describe("Defaults", func() {
+		It("should return the flag defaults, without modifying the options", func() {
+			// Arrange
+			options := &ManagerOptions{
+				LeaderElection:     true,
+				LeaderElectionID:   "my-id",
+				MetricsBindAddress: ":9090",
+			}
+
+			// Act
+			defaults, err := options.Defaults()
+
+			// Assert
+			Expect(err).To(Succeed())
+			Expect(defaults).To(HaveKeyWithValue(LeaderElectionFlag, true))
+			Expect(defaults).To(HaveKeyWithValue(LeaderElectionIDFlag, "my-id"))
+			Expect(defaults).To(HaveKeyWithValue(LeaderElectionResourceLockFlag, "leases"))
+			Expect(defaults).To(HaveKeyWithValue(MetricsBindAddressFlag, ":8080"))
+			Expect(options.MetricsBindAddress).To(Equal(":9090"))
+			Expect(options.LeaderElectionResourceLock).To(BeEmpty())
+			Expect(defaults).To(HaveKeyWithValue(PprofBindAddressFlag, ""))
+		})
+	})
+
+	Describe("Completed", func() {
+		It("should enable the pprof endpoints in the manager options, if a bind address is specified", func() {
+			// Arrange
+			options := &ManagerOptions{PprofBindAddress: ":6060"}
+
+			// Act
+			Expect(options.Complete()).To(Succeed())
+			result := options.Completed().Options()
+
+			// Assert
+			Expect(result.PprofBindAddress).To(Equal(":6060"))
+		})
 	})
 })
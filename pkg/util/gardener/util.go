@@ -14,7 +14,7 @@ import (
 // IsShootNamespace determines whether the format of specified name implies that it is a shoot namespace in a seed
 // cluster
 func IsShootNamespace(namespace string) bool {
-	return strings.HasPrefix(namespace, "shoot-")
+	return strings.HasPrefix(namespace, DefaultShootNamespacePrefix)
 }
 
 // WatchBuilder holds various functions which add watch controls to the passed Controller.
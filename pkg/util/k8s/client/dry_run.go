@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+// NewDryRunClient returns a client which reads through the specified client, but does not write. Instead of making
+// each write request, the client logs it, and reports success. Used to run the application without making any changes
+// to the cluster, e.g. for a canary deployment alongside the active one.
+func NewDryRunClient(c ctrlclient.Client, parentLogger logr.Logger) ctrlclient.Client {
+	return &dryRunClient{Client: c, log: parentLogger.WithName("dry-run")}
+}
+
+// dryRunClient implements [ctrlclient.Client]. See NewDryRunClient.
+type dryRunClient struct {
+	ctrlclient.Client
+	log logr.Logger
+}
+
+// logWrite logs the intended write request, which is not being made
+func (c *dryRunClient) logWrite(verb string, subResource string, obj ctrlclient.Object) {
+	var gvk schema.GroupVersionKind
+	if obj != nil {
+		gvk, _ = apiutil.GVKForObject(obj, c.Scheme())
+	}
+	log := c.log.WithValues("verb", verb, "kind", gvk.Kind)
+	if obj != nil {
+		log = log.WithValues("namespace", obj.GetNamespace(), "name", obj.GetName())
+	}
+	if subResource != "" {
+		log = log.WithValues("subresource", subResource)
+	}
+	log.V(app.VerbosityInfo).Info("Dry run. Skipping write request")
+}
+
+func (c *dryRunClient) Create(_ context.Context, obj ctrlclient.Object, _ ...ctrlclient.CreateOption) error {
+	c.logWrite("create", "", obj)
+	return nil
+}
+
+func (c *dryRunClient) Update(_ context.Context, obj ctrlclient.Object, _ ...ctrlclient.UpdateOption) error {
+	c.logWrite("update", "", obj)
+	return nil
+}
+
+func (c *dryRunClient) Patch(
+	_ context.Context, obj ctrlclient.Object, _ ctrlclient.Patch, _ ...ctrlclient.PatchOption) error {
+
+	c.logWrite("patch", "", obj)
+	return nil
+}
+
+func (c *dryRunClient) Delete(_ context.Context, obj ctrlclient.Object, _ ...ctrlclient.DeleteOption) error {
+	c.logWrite("delete", "", obj)
+	return nil
+}
+
+func (c *dryRunClient) DeleteAllOf(_ context.Context, obj ctrlclient.Object, _ ...ctrlclient.DeleteAllOfOption) error {
+	c.logWrite("deletecollection", "", obj)
+	return nil
+}
+
+func (c *dryRunClient) Status() ctrlclient.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *dryRunClient) SubResource(subResource string) ctrlclient.SubResourceClient {
+	return &dryRunSubResourceClient{
+		SubResourceClient: c.Client.SubResource(subResource), parent: c, subResource: subResource}
+}
+
+// dryRunSubResourceClient implements [ctrlclient.SubResourceClient] for dryRunClient. It reads through the specified
+// client, but only logs write requests.
+type dryRunSubResourceClient struct {
+	ctrlclient.SubResourceClient
+	parent      *dryRunClient
+	subResource string
+}
+
+func (c *dryRunSubResourceClient) Create(
+	_ context.Context, obj ctrlclient.Object, _ ctrlclient.Object, _ ...ctrlclient.SubResourceCreateOption) error {
+
+	c.parent.logWrite("create", c.subResource, obj)
+	return nil
+}
+
+func (c *dryRunSubResourceClient) Update(
+	_ context.Context, obj ctrlclient.Object, _ ...ctrlclient.SubResourceUpdateOption) error {
+
+	c.parent.logWrite("update", c.subResource, obj)
+	return nil
+}
+
+func (c *dryRunSubResourceClient) Patch(
+	_ context.Context, obj ctrlclient.Object, _ ctrlclient.Patch, _ ...ctrlclient.SubResourcePatchOption) error {
+
+	c.parent.logWrite("patch", c.subResource, obj)
+	return nil
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("util.k8s.client.NewDryRunClient", func() {
+	var (
+		newEndpoints = func(name string) *corev1.Endpoints {
+			return &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: "my-ns", Name: name}}
+		}
+		// Creates a dry-run client on top of a fake client, which contains the "existing" Endpoints object
+		newTestClient = func() (ctrlclient.Client, ctrlclient.Client) {
+			underlying := fake.NewClientBuilder().WithObjects(newEndpoints("existing")).Build()
+			return NewDryRunClient(underlying, logr.Discard()), underlying
+		}
+	)
+
+	It("should read through the underlying client", func() {
+		// Arrange
+		dryRunClient, _ := newTestClient()
+		endpoints := newEndpoints("existing")
+
+		// Act
+		err := dryRunClient.Get(context.Background(), ctrlclient.ObjectKeyFromObject(endpoints), endpoints)
+
+		// Assert
+		Expect(err).To(Succeed())
+		Expect(endpoints.ResourceVersion).NotTo(BeEmpty())
+	})
+
+	It("should report success for writes, without making them", func() {
+		// Arrange
+		dryRunClient, underlying := newTestClient()
+		ctx := context.Background()
+		existing := newEndpoints("existing")
+		Expect(underlying.Get(ctx, ctrlclient.ObjectKeyFromObject(existing), existing)).To(Succeed())
+
+		// Act
+		createErr := dryRunClient.Create(ctx, newEndpoints("new"))
+		existing.Subsets = []corev1.EndpointSubset{{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}}}
+		updateErr := dryRunClient.Update(ctx, existing)
+		statusErr := dryRunClient.Status().Update(ctx, existing)
+		deleteErr := dryRunClient.Delete(ctx, existing)
+
+		// Assert
+		Expect(createErr).To(Succeed())
+		Expect(updateErr).To(Succeed())
+		Expect(statusErr).To(Succeed())
+		Expect(deleteErr).To(Succeed())
+		err := underlying.Get(ctx, ctrlclient.ObjectKeyFromObject(newEndpoints("new")), newEndpoints("new"))
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		actual := newEndpoints("existing")
+		Expect(underlying.Get(ctx, ctrlclient.ObjectKeyFromObject(actual), actual)).To(Succeed())
+		Expect(actual.Subsets).To(BeEmpty())
+	})
+})
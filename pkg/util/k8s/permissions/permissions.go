@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package permissions verifies that the application has the K8s API permissions it requires. Misconfigured RBAC is a
+// common installation failure, which otherwise surfaces late, or not at all - e.g. as a controller which silently
+// never receives any secrets.
+package permissions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authorizationclient "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+// Permission is a single verb on a single kind of K8s resource, which the application requires
+type Permission struct {
+	Verb     string
+	Group    string // The API group of the resource. Empty for the core group.
+	Resource string
+	// The namespace in which the permission is required. Empty means that it is required in all namespaces.
+	Namespace string
+	// If not empty, the permission is only required for the object with this name
+	Name string
+}
+
+// String returns a human-readable form of the permission, e.g. "update coordination.k8s.io/leases 'my-lease' in
+// namespace 'garden'"
+func (p Permission) String() string {
+	var builder strings.Builder
+	builder.WriteString(p.Verb)
+	builder.WriteString(" ")
+	if p.Group != "" {
+		builder.WriteString(p.Group + "/")
+	}
+	builder.WriteString(p.Resource)
+	if p.Name != "" {
+		builder.WriteString(fmt.Sprintf(" '%s'", p.Name))
+	}
+	if p.Namespace != "" {
+		builder.WriteString(fmt.Sprintf(" in namespace '%s'", p.Namespace))
+	} else {
+		builder.WriteString(" in all namespaces")
+	}
+	return builder.String()
+}
+
+// Check asks the K8s API server, via SelfSubjectAccessReview, whether the application has each of the specified
+// permissions. Returns an error which lists all missing permissions, or nil if none is missing. Also fails if any of the
+// reviews fails.
+func Check(
+	ctx context.Context, client authorizationclient.SelfSubjectAccessReviewsGetter, permissions []Permission) error {
+
+	var missing []string
+	for _, permission := range permissions {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: permission.Namespace,
+					Verb:      permission.Verb,
+					Group:     permission.Group,
+					Resource:  permission.Resource,
+					Name:      permission.Name,
+				},
+			},
+		}
+		result, err := client.SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("checking permission to %s: %w", permission, err)
+		}
+		if !result.Status.Allowed {
+			missing = append(missing, permission.String())
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf(
+			"the application lacks the following K8s API permissions, which it requires: %s. Please check the RBAC "+
+				"configuration", strings.Join(missing, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package permissions
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("permissions", func() {
+	var (
+		// Creates a client which allows the access reviews for which isAllowed returns true
+		newTestClient = func(isAllowed func(attributes *authorizationv1.ResourceAttributes) bool) *fake.Clientset {
+			client := fake.NewSimpleClientset()
+			client.PrependReactor(
+				"create",
+				"selfsubjectaccessreviews",
+				func(action ktesting.Action) (bool, runtime.Object, error) {
+					review := action.(ktesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+					review.Status.Allowed = isAllowed(review.Spec.ResourceAttributes)
+					return true, review, nil
+				})
+			return client
+		}
+		testPermissions = []Permission{
+			{Verb: "watch", Resource: "secrets"},
+			{Verb: "update", Group: "coordination.k8s.io", Resource: "leases", Namespace: "garden", Name: "my-lease"},
+		}
+	)
+
+	Describe("Check", func() {
+		It("should succeed if all permissions are granted", func() {
+			// Arrange
+			client := newTestClient(func(_ *authorizationv1.ResourceAttributes) bool { return true })
+
+			// Act
+			err := Check(context.Background(), client.AuthorizationV1(), testPermissions)
+
+			// Assert
+			Expect(err).To(Succeed())
+		})
+
+		It("should fail, listing all missing permissions", func() {
+			// Arrange
+			client := newTestClient(func(_ *authorizationv1.ResourceAttributes) bool { return false })
+
+			// Act
+			err := Check(context.Background(), client.AuthorizationV1(), testPermissions)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("watch secrets in all namespaces"))
+			Expect(err.Error()).To(ContainSubstring(
+				"update coordination.k8s.io/leases 'my-lease' in namespace 'garden'"))
+		})
+
+		It("should pass the permission's attributes to the access review", func() {
+			// Arrange
+			var reviewed []authorizationv1.ResourceAttributes
+			client := newTestClient(func(attributes *authorizationv1.ResourceAttributes) bool {
+				reviewed = append(reviewed, *attributes)
+				return attributes.Resource == "secrets"
+			})
+
+			// Act
+			err := Check(context.Background(), client.AuthorizationV1(), testPermissions)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).NotTo(ContainSubstring("secrets"))
+			Expect(reviewed).To(Equal([]authorizationv1.ResourceAttributes{
+				{Verb: "watch", Resource: "secrets"},
+				{Verb: "update", Group: "coordination.k8s.io", Resource: "leases", Namespace: "garden", Name: "my-lease"},
+			}))
+		})
+
+		It("should fail if an access review fails", func() {
+			// Arrange
+			client := fake.NewSimpleClientset()
+			client.PrependReactor(
+				"create",
+				"selfsubjectaccessreviews",
+				func(_ ktesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("review failed")
+				})
+
+			// Act
+			err := Check(context.Background(), client.AuthorizationV1(), testPermissions)
+
+			// Assert
+			Expect(err).To(MatchError(ContainSubstring("review failed")))
+		})
+	})
+})
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package logging supports setting the log level of individual application components (see app.LogComponentScraper)
+// separately from the log level of the application as a whole, e.g. to debug the scraper without flooding the log with
+// messages from the controllers.
+//
+// A component is identified by the names of its loggers. A logger belongs to a component if the name of the logger,
+// or of any of its ancestors, is one of the component's logger names (see [logr.Logger.WithName]).
+package logging
+
+import (
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+// componentLoggerNames maps logger names to the component (e.g. [app.LogComponentScraper]) to which the respective
+// loggers belong
+var componentLoggerNames = map[string]string{
+	"scraper":                       app.LogComponentScraper,
+	"pod-controller":                app.LogComponentControllers,
+	"pod-predicate":                 app.LogComponentControllers,
+	"secret-controller":             app.LogComponentControllers,
+	"secret-predicate":              app.LogComponentControllers,
+	app.Name + "-pod-controller":    app.LogComponentControllers,
+	app.Name + "-secret-controller": app.LogComponentControllers,
+}
+
+// levelSettings is an immutable snapshot of the settings held by Levels
+type levelSettings struct {
+	defaultLevel    int
+	componentLevels map[string]int
+}
+
+// Levels holds the log level thresholds of the application: messages which have their level greater than the
+// threshold are suppressed. The threshold of a component, if set, replaces the application-wide one for the loggers of
+// that component. The thresholds can be changed at runtime. All operations are concurrency-safe.
+type Levels struct {
+	settings atomic.Pointer[levelSettings]
+}
+
+// NewLevels creates a Levels instance with the specified application-wide threshold, and no component thresholds
+func NewLevels(defaultLevel int) *Levels {
+	levels := &Levels{}
+	levels.Set(defaultLevel, nil)
+	return levels
+}
+
+// Set replaces all thresholds. componentLevels maps component names (e.g. [app.LogComponentScraper]) to the thresholds
+// of the respective components. Components which are not in the map use the application-wide threshold. The caller
+// should not modify componentLevels after the call.
+func (levels *Levels) Set(defaultLevel int, componentLevels map[string]int) {
+	levels.settings.Store(&levelSettings{defaultLevel: defaultLevel, componentLevels: componentLevels})
+}
+
+// isEnabled returns true if a message at the specified level, logged by a logger of the specified component, should be
+// logged. An empty component means that the logger does not belong to any component.
+func (levels *Levels) isEnabled(component string, level int) bool {
+	settings := levels.settings.Load()
+	threshold := settings.defaultLevel
+	if componentLevel, ok := settings.componentLevels[component]; ok {
+		threshold = componentLevel
+	}
+	return level <= threshold
+}
+
+// NewSink wraps the specified sink, so messages which exceed the respective threshold in levels get suppressed. The
+// wrapped sink's own level filtering still applies, so it should be at least as permissive as any of the thresholds.
+func NewSink(sink logr.LogSink, levels *Levels) logr.LogSink {
+	return &levelFilterSink{sink: sink, levels: levels}
+}
+
+// levelFilterSink implements logr.LogSink by filtering messages based on a Levels object, and the component to which
+// the logger belongs, and forwarding the remaining messages to another sink.
+type levelFilterSink struct {
+	sink   logr.LogSink
+	levels *Levels
+	// The component to which the logger belongs. Empty if it does not belong to any.
+	component string
+}
+
+func (s *levelFilterSink) Init(info logr.RuntimeInfo) {
+	// Account for the extra stack frame which this sink adds between the caller and the wrapped sink
+	info.CallDepth++
+	s.sink.Init(info)
+}
+
+func (s *levelFilterSink) Enabled(level int) bool {
+	return s.levels.isEnabled(s.component, level) && s.sink.Enabled(level)
+}
+
+func (s *levelFilterSink) Info(level int, msg string, keysAndValues ...any) {
+	s.sink.Info(level, msg, keysAndValues...)
+}
+
+func (s *levelFilterSink) Error(err error, msg string, keysAndValues ...any) {
+	s.sink.Error(err, msg, keysAndValues...)
+}
+
+func (s *levelFilterSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &levelFilterSink{sink: s.sink.WithValues(keysAndValues...), levels: s.levels, component: s.component}
+}
+
+func (s *levelFilterSink) WithName(name string) logr.LogSink {
+	component := s.component
+	if component == "" {
+		component = componentLoggerNames[name]
+	}
+	return &levelFilterSink{sink: s.sink.WithName(name), levels: s.levels, component: component}
+}
+
+// WithCallDepth implements logr.CallDepthLogSink
+func (s *levelFilterSink) WithCallDepth(depth int) logr.LogSink {
+	sink := s.sink
+	if callDepthSink, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = callDepthSink.WithCallDepth(depth)
+	}
+	return &levelFilterSink{sink: sink, levels: s.levels, component: s.component}
+}
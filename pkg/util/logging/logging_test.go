@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/app"
+)
+
+var _ = Describe("logging", func() {
+	var (
+		// Creates a root logger which filters messages based on the specified levels, and records the messages which
+		// pass the filter
+		newTestLogger = func(levels *Levels) (logr.Logger, *[]string) {
+			var messages []string
+			sink := funcr.New(func(_, args string) { messages = append(messages, args) }, funcr.Options{Verbosity: 1000})
+			return logr.New(NewSink(sink.GetSink(), levels)), &messages
+		}
+	)
+
+	Describe("NewSink", func() {
+		It("should suppress messages which have their level greater than the application-wide threshold", func() {
+			// Arrange
+			log, messages := newTestLogger(NewLevels(50))
+
+			// Act
+			log.V(50).Info("logged")
+			log.V(51).Info("suppressed")
+
+			// Assert
+			Expect(*messages).To(HaveLen(1))
+			Expect((*messages)[0]).To(ContainSubstring("logged"))
+		})
+
+		It("should apply a component's threshold to the loggers of that component, and to their descendants", func() {
+			// Arrange
+			levels := NewLevels(50)
+			levels.Set(50, map[string]int{app.LogComponentScraper: 100})
+			log, messages := newTestLogger(levels)
+			scraperLog := log.WithName("input").WithName("scraper").WithName("queue")
+			controllerLog := log.WithName("pod-controller")
+
+			// Act
+			scraperLog.V(100).Info("scraper")
+			controllerLog.V(100).Info("controller")
+
+			// Assert
+			Expect(*messages).To(HaveLen(1))
+			Expect((*messages)[0]).To(ContainSubstring("scraper"))
+		})
+
+		It("should apply threshold changes to existing loggers", func() {
+			// Arrange
+			levels := NewLevels(50)
+			log, messages := newTestLogger(levels)
+			controllerLog := log.WithName("secret-controller").WithValues("key", "value")
+
+			// Act
+			levels.Set(50, map[string]int{app.LogComponentControllers: 0})
+			controllerLog.V(25).Info("suppressed")
+			log.V(25).Info("logged")
+
+			// Assert
+			Expect(*messages).To(HaveLen(1))
+			Expect((*messages)[0]).To(ContainSubstring("logged"))
+		})
+
+		It("should not suppress errors", func() {
+			// Arrange
+			levels := NewLevels(0)
+			levels.Set(0, map[string]int{app.LogComponentScraper: 0})
+			log, messages := newTestLogger(levels)
+
+			// Act
+			log.WithName("scraper").V(75).Error(nil, "failed")
+
+			// Assert
+			Expect(*messages).To(HaveLen(1))
+		})
+	})
+})
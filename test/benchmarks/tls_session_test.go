@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package benchmarks contains benchmarks which span components, or which measure the cost of interactions with
+// external parties, such as the kube-apiservers being scraped
+package benchmarks
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input/metrics_scraper"
+)
+
+// BenchmarkTLSHandshake measures the cost of a request over a new TLS connection, with and without session resumption.
+// Keep-alives are disabled, so each request performs a handshake, the way a scrape does after its idle connection
+// expires.
+func BenchmarkTLSHandshake(b *testing.B) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("apiserver_request_total 1\n"))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	cases := []struct {
+		name     string
+		settings metrics_scraper.TLSSettings
+	}{
+		{"FullHandshake", metrics_scraper.TLSSettings{SessionCacheSize: -1}},
+		{"SessionResumption", metrics_scraper.TLSSettings{}},
+		{"SessionResumptionX25519", metrics_scraper.TLSSettings{CurvePreferences: []tls.CurveID{tls.X25519}}},
+		{"SessionResumptionP256", metrics_scraper.TLSSettings{CurvePreferences: []tls.CurveID{tls.CurveP256}}},
+	}
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			tlsConfig := &tls.Config{
+				RootCAs:    rootCAs,
+				ServerName: "example.com", // The name in the httptest server certificate
+				MinVersion: tls.VersionTLS13,
+			}
+			c.settings.ApplyTo(tlsConfig)
+			client := &http.Client{
+				Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true},
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				response, err := client.Get(server.URL)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_, _ = io.Copy(io.Discard, response.Body)
+				_ = response.Body.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// The server name under which the scraper verifies Kapi certificates
+const fakeKapiServerName = "kube-apiserver"
+
+// fakeKapi is a TLS server which serves kube-apiserver metrics in the Prometheus text format, the way a shoot
+// kube-apiserver pod does. The request count grows by requestsPerScrape with each scrape.
+type fakeKapi struct {
+	server *httptest.Server
+	// The PEM encoded certificate of the CA which issued the server's certificate
+	CACertificate []byte
+	// Scrapes which do not present this bearer token are rejected
+	Token string
+	// How many scrapes the server has served successfully
+	ScrapeCount atomic.Int64
+}
+
+const requestsPerScrape = 100
+
+// newFakeKapi starts a fakeKapi which accepts the specified token. The server listens on 127.0.0.1, and must be closed
+// after use.
+func newFakeKapi(token string) *fakeKapi {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(Succeed())
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake-kapi-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	Expect(err).To(Succeed())
+	caCert, err := x509.ParseCertificate(caDER)
+	Expect(err).To(Succeed())
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(Succeed())
+	serverTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: fakeKapiServerName},
+		DNSNames:     []string{fakeKapiServerName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caCert, &serverKey.PublicKey, caKey)
+	Expect(err).To(Succeed())
+
+	kapi := &fakeKapi{
+		CACertificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		Token:         token,
+	}
+	kapi.server = httptest.NewUnstartedServer(http.HandlerFunc(kapi.serveMetrics))
+	kapi.server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}},
+	}
+	kapi.server.StartTLS()
+
+	return kapi
+}
+
+// Port returns the port at which the server listens
+func (kapi *fakeKapi) Port() int {
+	return kapi.server.Listener.Addr().(*net.TCPAddr).Port
+}
+
+// Close shuts the server down
+func (kapi *fakeKapi) Close() {
+	kapi.server.Close()
+}
+
+func (kapi *fakeKapi) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/metrics" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+kapi.Token {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	requestCount := (kapi.ScrapeCount.Add(1)) * requestsPerScrape
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# TYPE apiserver_request_total counter\n")
+	fmt.Fprintf(w, "apiserver_request_total{code=\"200\",verb=\"GET\"} %d\n", requestCount)
+	fmt.Fprintf(w, "# TYPE apiserver_current_inflight_requests gauge\n")
+	fmt.Fprintf(w, "apiserver_current_inflight_requests{request_kind=\"readOnly\"} 3\n")
+	fmt.Fprintf(w, "apiserver_current_inflight_requests{request_kind=\"mutating\"} 2\n")
+}
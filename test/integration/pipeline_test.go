@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+
+	"github.com/gardener/gardener-custom-metrics/pkg/input"
+	podctl "github.com/gardener/gardener-custom-metrics/pkg/input/controller/pod"
+	"github.com/gardener/gardener-custom-metrics/pkg/metrics_provider"
+)
+
+var _ = Describe("data pipeline", func() {
+	const (
+		testToken   = "test-token"
+		testPodName = "kube-apiserver-0"
+		// The secret names which the secret controller looks for
+		caSecretName    = "ca"
+		tokenSecretName = "shoot-access-gardener-custom-metrics"
+	)
+
+	var (
+		// Accesses the API server directly, bypassing the manager's cache
+		k8sClient client.Client
+		// Serves metrics based on the data gathered by the pipeline under test
+		metricsProvider *metrics_provider.MetricsProvider
+
+		// Creates a shoot namespace, containing a CA secret which matches the specified Kapi, and a Kapi pod which is
+		// scraped at the Kapi's address. Returns the namespace name.
+		createShoot = func(ctx context.Context, kapi *fakeKapi) string {
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "shoot--it--"}}
+			Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+			caSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace.Name, Name: caSecretName},
+				Data:       map[string][]byte{"ca.crt": kapi.CACertificate},
+			}
+			Expect(k8sClient.Create(ctx, caSecret)).To(Succeed())
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   namespace.Name,
+					Name:        testPodName,
+					Labels:      map[string]string{"app": "kubernetes", "role": "apiserver"},
+					Annotations: map[string]string{podctl.MetricsPortAnnotation: strconv.Itoa(kapi.Port())},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "kube-apiserver", Image: "kube-apiserver"}}},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			// There is no kubelet to assign the pod an address
+			pod.Status.PodIP = "127.0.0.1"
+			pod.Status.PodIPs = []corev1.PodIP{{IP: "127.0.0.1"}}
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+
+			return namespace.Name
+		}
+		// Creates the shoot access secret, containing the specified token, in the specified namespace
+		createTokenSecret = func(ctx context.Context, namespace string, token string) {
+			tokenSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: tokenSecretName},
+				Data:       map[string][]byte{"token": []byte(token)},
+			}
+			Expect(k8sClient.Create(ctx, tokenSecret)).To(Succeed())
+		}
+		// Returns the request rate values served for the pods in the specified namespace
+		getRequestRates = func(ctx context.Context, namespace string) []custom_metrics.MetricValue {
+			metricInfo := provider.CustomMetricInfo{
+				GroupResource: schema.GroupResource{Resource: "pods"},
+				Namespaced:    true,
+				Metric:        metrics_provider.RequestRateMetricName,
+			}
+			result, err := metricsProvider.GetMetricBySelector(
+				ctx, namespace, labels.Everything(), metricInfo, labels.Everything())
+			Expect(err).To(Succeed())
+			return result.Items
+		}
+	)
+
+	BeforeEach(func() {
+		var err error
+		k8sClient, err = client.New(restConfig, client.Options{})
+		Expect(err).To(Succeed())
+
+		// Assemble the pipeline the way the application does, with short periods, to keep the tests fast
+		options := input.NewCLIOptions()
+		options.ScrapePeriod = time.Second
+		options.MinSampleGap = 500 * time.Millisecond
+		Expect(options.Complete()).To(Succeed())
+		inputService := input.NewInputDataServiceFactory().NewInputDataService(options.Completed(), GinkgoLogr)
+		mgr, err := manager.New(restConfig, manager.Options{Metrics: metricsserver.Options{BindAddress: "0"}})
+		Expect(err).To(Succeed())
+		Expect(inputService.AddToManager(mgr)).To(Succeed())
+		metricsProvider = metrics_provider.NewMetricsProvider(
+			inputService.DataSource(),
+			metrics_provider.DefaultMaxSampleAge,
+			metrics_provider.DefaultMaxSampleGap,
+			metrics_provider.MetricNaming{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		managerDone := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(managerDone)
+			Expect(mgr.Start(ctx)).To(Succeed())
+		}()
+		DeferCleanup(func() {
+			cancel()
+			<-managerDone
+		})
+	})
+
+	It("should scrape a shoot's kube-apiserver pod, and serve its request rate", func(ctx SpecContext) {
+		// Arrange
+		kapi := newFakeKapi(testToken)
+		DeferCleanup(kapi.Close)
+
+		// Act
+		namespace := createShoot(ctx, kapi)
+		createTokenSecret(ctx, namespace, testToken)
+
+		// Assert
+		Eventually(func(g Gomega) {
+			rates := getRequestRates(ctx, namespace)
+			g.Expect(rates).To(HaveLen(1))
+			g.Expect(rates[0].DescribedObject.Name).To(Equal(testPodName))
+			g.Expect(rates[0].Value.Sign()).To(Equal(1))
+		}).WithTimeout(30 * time.Second).Should(Succeed())
+	}, SpecTimeout(time.Minute))
+
+	It("should not scrape a pod before the shoot's access token is available", func(ctx SpecContext) {
+		// Arrange
+		kapi := newFakeKapi(testToken)
+		DeferCleanup(kapi.Close)
+		namespace := createShoot(ctx, kapi)
+
+		// Act & assert
+		Consistently(kapi.ScrapeCount.Load).WithTimeout(3 * time.Second).Should(BeZero())
+		createTokenSecret(ctx, namespace, testToken)
+		Eventually(kapi.ScrapeCount.Load).WithTimeout(30 * time.Second).Should(BeNumerically(">", 0))
+	}, SpecTimeout(time.Minute))
+
+	It("should stop serving the metrics of a pod, once the pod is deleted", func(ctx SpecContext) {
+		// Arrange
+		kapi := newFakeKapi(testToken)
+		DeferCleanup(kapi.Close)
+		namespace := createShoot(ctx, kapi)
+		createTokenSecret(ctx, namespace, testToken)
+		Eventually(func() []custom_metrics.MetricValue { return getRequestRates(ctx, namespace) }).
+			WithTimeout(30 * time.Second).Should(HaveLen(1))
+
+		// Act
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: testPodName}}
+		Expect(k8sClient.Delete(ctx, pod, client.GracePeriodSeconds(0))).To(Succeed())
+
+		// Assert
+		Eventually(func() []custom_metrics.MetricValue { return getRequestRates(ctx, namespace) }).
+			WithTimeout(30 * time.Second).Should(BeEmpty())
+	}, SpecTimeout(time.Minute))
+})
@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package integration contains end-to-end tests of the data pipeline: pod and secret controllers, registry, scraper,
+// and metrics provider, assembled in-process against an envtest API server. The tests are skipped, unless the envtest
+// binaries are available, as indicated by the KUBEBUILDER_ASSETS environment variable. See the test-integration make
+// target.
+package integration
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// The API server shared by all tests in the suite
+var restConfig *rest.Config
+
+func TestGardenerCustomMetrics(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Gardener custom metrics integration test suite")
+}
+
+var _ = BeforeSuite(func() {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		Skip("KUBEBUILDER_ASSETS is not set. Skipping integration tests, which require the envtest binaries.")
+	}
+
+	testEnv := &envtest.Environment{}
+	var err error
+	restConfig, err = testEnv.Start()
+	Expect(err).To(Succeed())
+	DeferCleanup(testEnv.Stop)
+})